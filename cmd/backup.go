@@ -0,0 +1,93 @@
+/*
+Copyright © 2025 OpenMANET - Corey Wagehoft
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/openmanet/openmanetd/internal/network"
+	"github.com/spf13/cobra"
+)
+
+var backupSection string
+
+// backupCmd groups the commands that export and import the UCI configuration
+// managed by openmanetd
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Export or import this node's mesh UCI configuration",
+	Long: `Export or import the UCI configuration openmanetd manages: the network interface
+and DHCP pool of the mesh section, the static DHCP leases and the openmanetd
+section. An export taken on one node can be imported on a replacement device to
+give it the same mesh address and pool.`,
+}
+
+// backupExportCmd prints the managed UCI configuration as JSON
+var backupExportCmd = &cobra.Command{
+	Use:     "export",
+	Short:   "Print the managed UCI configuration as JSON",
+	Example: `  openmanetd backup export > node.json`,
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, err := network.ExportConfig(backupSection)
+		if err != nil {
+			return fmt.Errorf("failed to export configuration: %w", err)
+		}
+
+		_, err = fmt.Fprintln(os.Stdout, string(data))
+		return err
+	},
+}
+
+// backupImportCmd applies a configuration written by backup export
+var backupImportCmd = &cobra.Command{
+	Use:   "import FILE",
+	Short: "Apply a configuration written by backup export",
+	Long: `Apply a configuration written by backup export. Nothing is changed if any part
+of it cannot be applied. The network must be reloaded, or the node rebooted, for
+the imported configuration to take effect.`,
+	Example: `  openmanetd backup import node.json && reboot`,
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			return err
+		}
+
+		changed, err := network.ImportConfig(data)
+		if err != nil {
+			return fmt.Errorf("failed to import configuration: %w", err)
+		}
+		if !changed {
+			fmt.Println("Configuration already up to date")
+			return nil
+		}
+
+		fmt.Println("Configuration imported, reboot to apply it")
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(backupCmd)
+	backupCmd.AddCommand(backupExportCmd)
+	backupCmd.AddCommand(backupImportCmd)
+
+	backupExportCmd.Flags().StringVar(&backupSection, "section", strings.TrimPrefix(network.DefaultInterfaceName, "br-"), "UCI section of the mesh interface")
+}
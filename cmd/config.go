@@ -0,0 +1,70 @@
+/*
+Copyright © 2025 OpenMANET - Corey Wagehoft
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/openmanet/openmanetd/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// configCmd groups the commands that describe the config file
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Describe the config file",
+}
+
+// configSchemaCmd prints the JSON Schema of the config file
+var configSchemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the JSON Schema of the config file",
+	Long: `Print a JSON Schema describing every key of the config file, its type, default
+and accepted values. Editors use it to complete and check config files.`,
+	Example: `  openmanetd config schema > openmanetd.schema.json`,
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		schema, err := config.JSONSchema()
+		if err != nil {
+			return fmt.Errorf("failed to generate schema: %w", err)
+		}
+
+		_, err = fmt.Fprintln(os.Stdout, string(schema))
+		return err
+	},
+}
+
+// configExampleCmd prints an example config file
+var configExampleCmd = &cobra.Command{
+	Use:   "example",
+	Short: "Print an example config file with every key set to its default",
+	Long: `Print a config file that sets every key to its default, each preceded by a
+comment describing it.`,
+	Example: `  openmanetd config example > /etc/openmanet/config.yml`,
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, err := os.Stdout.Write(config.ExampleYAML())
+		return err
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configSchemaCmd)
+	configCmd.AddCommand(configExampleCmd)
+}
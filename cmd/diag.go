@@ -0,0 +1,119 @@
+/*
+Copyright © 2025 OpenMANET - Corey Wagehoft
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/digineo/go-uci/v2"
+	"github.com/openmanet/openmanetd/internal/config"
+	"github.com/openmanet/openmanetd/internal/diag"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	diagOutput      string
+	diagRedact      []string
+	diagLogFile     string
+	diagLogMaxBytes int64
+	diagTimeout     time.Duration
+	diagMeshLog     time.Duration
+)
+
+// diagCmd writes a troubleshooting bundle for this node
+var diagCmd = &cobra.Command{
+	Use:   "diag",
+	Short: "Collect a troubleshooting bundle from this node",
+	Long: `Collect UCI config, routes and rules, interfaces, batman-adv mesh state and a
+few seconds of its debug log, the alfred reservation, gateway and node records,
+persisted state and version information into a gzipped tarball with a
+manifest.json describing each file.
+
+A source that cannot be read is recorded in the manifest with its error and the
+rest are still collected. Secrets such as the mesh SAE key are redacted; --redact
+adds option or key names to the built in list.`,
+	Example: `  openmanetd diag --output bundle.tar.gz
+  openmanetd diag --output bundle.tar.gz --log-file /tmp/openmanetd.log`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg := config.New(viper.GetViper())
+		hostname, _ := os.Hostname()
+
+		output := diagOutput
+		if output == "" {
+			output = fmt.Sprintf("openmanetd-diag-%s-%s.tar.gz", hostname, time.Now().UTC().Format("20060102T150405Z"))
+		}
+
+		sources := diag.DefaultSources(diag.SourceConfig{
+			Version:          Version,
+			UCIDir:           uci.DefaultTreePath,
+			MeshInterface:    cfg.GetAlfredBatInterface(),
+			AlfredSocketPath: cfg.GetAlfredSocketPath(),
+			StatePath:        cfg.GetStateFile(),
+			ConfigFile:       viper.ConfigFileUsed(),
+			LogPath:          diagLogFile,
+			LogMaxBytes:      diagLogMaxBytes,
+			MeshLogWindow:    diagMeshLog,
+		})
+
+		f, err := os.OpenFile(output, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+		if err != nil {
+			return fmt.Errorf("failed to create bundle: %w", err)
+		}
+		defer f.Close()
+
+		ctx, cancel := context.WithTimeout(cmd.Context(), diagTimeout)
+		defer cancel()
+
+		manifest, err := diag.WriteBundle(ctx, f, sources, diag.Options{
+			Version:  Version,
+			Hostname: hostname,
+			Redact:   append(append([]string{}, diag.DefaultRedactions...), diagRedact...),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to write bundle: %w", err)
+		}
+		if err := f.Close(); err != nil {
+			return fmt.Errorf("failed to write bundle: %w", err)
+		}
+
+		failed := 0
+		for _, entry := range manifest.Entries {
+			if entry.Error != "" {
+				failed++
+				fmt.Fprintf(os.Stderr, "%s: %s\n", entry.Name, entry.Error)
+			}
+		}
+		fmt.Printf("Wrote %s (%d sources, %d failed)\n", output, len(manifest.Entries), failed)
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(diagCmd)
+	diagCmd.Flags().StringVarP(&diagOutput, "output", "o", "", "bundle path (default openmanetd-diag-<host>-<time>.tar.gz)")
+	diagCmd.Flags().StringSliceVar(&diagRedact, "redact", nil, "additional option or key names to redact")
+	diagCmd.Flags().StringVar(&diagLogFile, "log-file", "", "log file to include an excerpt of")
+	diagCmd.Flags().Int64Var(&diagLogMaxBytes, "log-max-bytes", diag.DefaultLogMaxBytes, "maximum bytes taken from the end of the log file")
+	diagCmd.Flags().DurationVar(&diagMeshLog, "mesh-log", 3*time.Second, "how long to tail the batman-adv debug log for; 0 leaves it out")
+	diagCmd.Flags().DurationVar(&diagTimeout, "timeout", time.Minute, "time limit for collecting all sources")
+}
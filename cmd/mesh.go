@@ -0,0 +1,98 @@
+/*
+Copyright © 2025 OpenMANET - Corey Wagehoft
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	batmanadv "github.com/openmanet/openmanetd/internal/batman-adv"
+	"github.com/openmanet/openmanetd/internal/config"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	meshLogFollow bool
+	meshLogWindow time.Duration
+)
+
+// meshCmd groups the commands that troubleshoot the batman-adv mesh
+var meshCmd = &cobra.Command{
+	Use:   "mesh",
+	Short: "Troubleshoot the batman-adv mesh",
+}
+
+// meshLogCmd prints the batman-adv debug log
+var meshLogCmd = &cobra.Command{
+	Use:   "log",
+	Short: "Print the batman-adv debug log",
+	Long: `Print the batman-adv debug log of the mesh interface for a few seconds, or
+until interrupted with --follow. Set the log level first with
+"batctl meshif bat0 loglevel all"; the kernel must be built with batman-adv
+debug support.`,
+	Example: `  openmanetd mesh log
+  openmanetd mesh log --follow`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg := config.New(viper.GetViper())
+		iface := cfg.GetAlfredBatInterface()
+
+		if !meshLogFollow {
+			lines, err := batmanadv.ReadMeshLog(cmd.Context(), iface, meshLogWindow)
+			if err != nil {
+				return meshLogError(err)
+			}
+			for _, line := range lines {
+				fmt.Println(line)
+			}
+			return nil
+		}
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		lines, err := batmanadv.StreamMeshLog(ctx, iface)
+		if err != nil {
+			return meshLogError(err)
+		}
+		for line := range lines {
+			fmt.Println(line)
+		}
+
+		return nil
+	},
+}
+
+// meshLogError explains a failure to read the debug log.
+func meshLogError(err error) error {
+	if errors.Is(err, batmanadv.ErrMeshLogUnsupported) {
+		return err
+	}
+	return fmt.Errorf("failed to read the batman-adv debug log: %w", err)
+}
+
+func init() {
+	rootCmd.AddCommand(meshCmd)
+	meshCmd.AddCommand(meshLogCmd)
+	meshLogCmd.Flags().BoolVarP(&meshLogFollow, "follow", "f", false, "keep printing new lines until interrupted")
+	meshLogCmd.Flags().DurationVar(&meshLogWindow, "window", 5*time.Second, "how long to read the log for without --follow")
+}
@@ -0,0 +1,65 @@
+/*
+Copyright © 2025 OpenMANET - Corey Wagehoft
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/openmanet/openmanetd/internal/network"
+	"github.com/spf13/cobra"
+)
+
+var poolShrink bool
+
+// poolCmd asks the running daemon to resize this node's DHCP pool
+var poolCmd = &cobra.Command{
+	Use:   "pool",
+	Short: "Manage this node's DHCP pool size",
+	Long: `Manage the size of this node's DHCP pool when pool autosizing is enabled.
+
+With --shrink the daemon shrinks the pool on its next pass to the smallest size
+that still leaves headroom for the peak usage it has observed, never below the
+configured floor. Without flags the pending request, if any, is printed.`,
+	Example: `  openmanetd pool --shrink`,
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if poolShrink {
+			if err := network.RequestPoolShrink(); err != nil {
+				return fmt.Errorf("failed to request pool shrink: %w", err)
+			}
+			fmt.Println("Pool shrink requested")
+			return nil
+		}
+
+		requested, err := network.IsPoolShrinkRequested()
+		if err != nil {
+			return fmt.Errorf("failed to read pool shrink request: %w", err)
+		}
+		if requested {
+			fmt.Println("Pool shrink pending")
+		} else {
+			fmt.Println("No pool shrink pending")
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(poolCmd)
+	poolCmd.Flags().BoolVar(&poolShrink, "shrink", false, "shrink the DHCP pool to fit observed usage")
+}
@@ -0,0 +1,90 @@
+/*
+Copyright © 2025 OpenMANET - Corey Wagehoft
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/openmanet/openmanetd/internal/config"
+	"github.com/openmanet/openmanetd/internal/network"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	reservePinIP string
+	reserveClear bool
+)
+
+// reserveCmd manages the static IP pin stored in the openmanetd UCI config
+var reserveCmd = &cobra.Command{
+	Use:   "reserve",
+	Short: "Pin this node to a specific mesh IP address",
+	Long: `Pin this node to a specific mesh IP address instead of letting the address
+reservation worker select one. The pin must be inside the configured mesh subnet
+and outside its excluded ranges. It is claimed the next time the node configures its address,
+provided no peer holds it.
+
+Without flags the current pin is printed.`,
+	Example: `  openmanetd reserve --ip 10.41.2.10
+  openmanetd reserve --clear`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		switch {
+		case reservePinIP != "" && reserveClear:
+			return errors.New("--ip and --clear cannot be used together")
+
+		case reserveClear:
+			if err := network.ClearPinnedIP(); err != nil {
+				return fmt.Errorf("failed to clear pinned IP: %w", err)
+			}
+			fmt.Println("Pinned IP cleared")
+
+		case reservePinIP != "":
+			cfg := config.New(viper.GetViper())
+			addressing, err := network.NewMeshAddressing(cfg.GetMeshSubnet(), cfg.GetMeshExcludedRanges())
+			if err != nil {
+				return fmt.Errorf("invalid mesh subnet in config: %w", err)
+			}
+			if err := network.SetPinnedIP(reservePinIP, addressing); err != nil {
+				return fmt.Errorf("failed to pin IP: %w", err)
+			}
+			fmt.Printf("Pinned to %s\n", reservePinIP)
+
+		default:
+			pin, err := network.GetPinnedIP()
+			if err != nil {
+				return fmt.Errorf("failed to read pinned IP: %w", err)
+			}
+			if pin == "" {
+				fmt.Println("No pinned IP")
+				return nil
+			}
+			fmt.Printf("Pinned to %s\n", pin)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(reserveCmd)
+
+	reserveCmd.Flags().StringVar(&reservePinIP, "ip", "", "mesh IP address to pin this node to")
+	reserveCmd.Flags().BoolVar(&reserveClear, "clear", false, "remove the pinned IP")
+}
@@ -0,0 +1,132 @@
+/*
+Copyright © 2025 OpenMANET - Corey Wagehoft
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/openmanet/openmanetd/internal/safemode"
+	"github.com/spf13/cobra"
+)
+
+// safeModeCmd switches the running daemon in and out of safe mode
+var safeModeCmd = &cobra.Command{
+	Use:   "safemode [on|off]",
+	Short: "Stop or resume system changes made by the running daemon",
+	Long: `In safe mode the running daemon keeps publishing and observing node, gateway and
+reservation records but suppresses every change to UCI, routes, addresses and
+services. Leaving safe mode reconciles right away.
+
+Without an argument the current state is printed. Sending SIGUSR2 to the daemon
+toggles safe mode as well.`,
+	Example: `  openmanetd safemode on
+  openmanetd safemode off`,
+	Args:      cobra.MaximumNArgs(1),
+	ValidArgs: []string{"on", "off"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			on, err := safemode.ReadState(safemode.DefaultRunDir)
+			if err != nil {
+				return fmt.Errorf("failed to read safe mode state, is openmanetd running? %w", err)
+			}
+			fmt.Printf("Safe mode is %s\n", onOff(on))
+			return nil
+		}
+
+		var on bool
+		switch args[0] {
+		case "on":
+			on = true
+		case "off":
+			on = false
+		default:
+			return fmt.Errorf("invalid argument %q, want on or off", args[0])
+		}
+
+		pids, err := daemonPIDs()
+		if err != nil {
+			return err
+		}
+		if len(pids) == 0 {
+			return errors.New("openmanetd is not running")
+		}
+
+		if err := safemode.RequestState(safemode.DefaultRunDir, on); err != nil {
+			return err
+		}
+		for _, pid := range pids {
+			if err := syscall.Kill(pid, syscall.SIGUSR2); err != nil {
+				return fmt.Errorf("failed to signal openmanetd (pid %d): %w", pid, err)
+			}
+		}
+
+		// The daemon records the new state once it has applied it
+		for range 20 {
+			if state, err := safemode.ReadState(safemode.DefaultRunDir); err == nil && state == on {
+				fmt.Printf("Safe mode is %s\n", onOff(on))
+				return nil
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+
+		return errors.New("openmanetd did not confirm the change")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(safeModeCmd)
+}
+
+// daemonPIDs returns the PIDs of running openmanetd processes other than this one.
+func daemonPIDs() ([]int, error) {
+	self := os.Getpid()
+
+	comms, err := filepath.Glob("/proc/[0-9]*/comm")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list processes: %w", err)
+	}
+
+	var pids []int
+	for _, comm := range comms {
+		name, err := os.ReadFile(comm)
+		if err != nil || strings.TrimSpace(string(name)) != "openmanetd" {
+			continue
+		}
+
+		pid, err := strconv.Atoi(filepath.Base(filepath.Dir(comm)))
+		if err != nil || pid == self {
+			continue
+		}
+		pids = append(pids, pid)
+	}
+
+	return pids, nil
+}
+
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
@@ -0,0 +1,155 @@
+/*
+Copyright © 2025 OpenMANET - Corey Wagehoft
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	proto "github.com/openmanet/openmanetd/internal/api/openmanet/v1"
+	"github.com/openmanet/openmanetd/internal/config"
+	batmanadv "github.com/openmanet/openmanetd/internal/batman-adv"
+	"github.com/openmanet/openmanetd/internal/mgmt"
+	"github.com/openmanet/openmanetd/internal/network"
+	"github.com/rs/zerolog"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var showTopologyDOT bool
+
+// showCmd groups the commands that print mesh state
+var showCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show mesh state",
+}
+
+// showServicesCmd lists the services announced over the mesh
+var showServicesCmd = &cobra.Command{
+	Use:   "services",
+	Short: "List the services announced over the mesh",
+	Long: `List the services announced by the nodes of the mesh, this node included, as
+currently held by alfred. Services announced at "self" are shown at the address
+of the announcing node.`,
+	Example: `  openmanetd show services`,
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg := config.New(viper.GetViper())
+
+		client, err := mgmt.NewAlfredClient(cfg.GetAlfredSocketPath(), cfg.GetAlfredCallTimeout(), zerolog.Nop())
+		if err != nil {
+			return fmt.Errorf("failed to connect to alfred: %w", err)
+		}
+
+		records, err := client.RequestCtx(cmd.Context(), mgmt.ServiceDataType)
+		if err != nil {
+			return fmt.Errorf("failed to request services: %w", err)
+		}
+
+		filter := mgmt.NewMeshFilter(cfg.GetMeshID(), true, cfg.GetMeshIDAcceptLegacy(), zerolog.Nop())
+		table := mgmt.NewServiceTable()
+		for _, rec := range filter.FilterServices(records) {
+			var announcements proto.ServiceAnnouncements
+			if err := announcements.UnmarshalVT(rec.Data); err != nil {
+				continue
+			}
+			table.Observe(&announcements)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tPROTO\tPORT\tADDRESS\tNODE\tEXPIRES\tDESCRIPTION")
+		for _, svc := range table.Active() {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\t%s\n",
+				svc.Name, svc.Proto, svc.Port, svc.Address, svc.Hostname,
+				time.Until(svc.Expires).Round(time.Second), svc.Description)
+		}
+
+		return w.Flush()
+	},
+}
+
+// showTopologyCmd prints the mesh topology graph
+var showTopologyCmd = &cobra.Command{
+	Use:   "topology",
+	Short: "Print the mesh topology graph",
+	Long: `Print the mesh as a graph of originators and the links between direct
+neighbors, as JSON or, with --dot, for graphviz. Links are read from this node's
+batman-adv tables and from the summaries of nodes that set topology.publish;
+nodes are named from the node records held by alfred.`,
+	Example: `  openmanetd show topology
+  openmanetd show topology --dot | dot -Tsvg > mesh.svg`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg := config.New(viper.GetViper())
+
+		topo, err := batmanadv.BuildTopology(cfg.GetAlfredBatInterface())
+		if err != nil {
+			return fmt.Errorf("failed to read the mesh topology: %w", err)
+		}
+
+		client, err := mgmt.NewAlfredClient(cfg.GetAlfredSocketPath(), cfg.GetAlfredCallTimeout(), zerolog.Nop())
+		if err != nil {
+			return fmt.Errorf("failed to connect to alfred: %w", err)
+		}
+
+		filter := mgmt.NewMeshFilter(cfg.GetMeshID(), true, cfg.GetMeshIDAcceptLegacy(), zerolog.Nop())
+
+		nodeRecords, err := client.RequestCtx(cmd.Context(), mgmt.NodeDataType)
+		if err != nil {
+			return fmt.Errorf("failed to request nodes: %w", err)
+		}
+		hostnames := make(map[string]string)
+		for _, rec := range filter.FilterNodes(nodeRecords) {
+			var node proto.Node
+			if err := node.UnmarshalVT(rec.Data); err != nil {
+				continue
+			}
+			hostnames[node.GetMac()] = node.GetHostname()
+		}
+
+		summaryRecords, err := client.RequestCtx(cmd.Context(), mgmt.TopologyDataType)
+		if err != nil {
+			return fmt.Errorf("failed to request topology summaries: %w", err)
+		}
+		var summaries []*proto.TopologySummary
+		for _, rec := range filter.FilterTopology(summaryRecords) {
+			var summary proto.TopologySummary
+			if err := summary.UnmarshalVT(rec.Data); err != nil {
+				continue
+			}
+			summaries = append(summaries, &summary)
+		}
+
+		iface := network.GetInterfaceByName(cfg.GetMeshNetInterface())
+		mgmt.MergeTopology(topo, iface.MAC, summaries, hostnames)
+
+		if showTopologyDOT {
+			return topo.WriteDOT(os.Stdout)
+		}
+		return topo.WriteJSON(os.Stdout)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(showCmd)
+	showCmd.AddCommand(showServicesCmd)
+	showCmd.AddCommand(showTopologyCmd)
+
+	showTopologyCmd.Flags().BoolVar(&showTopologyDOT, "dot", false, "print the graph in graphviz DOT format")
+}
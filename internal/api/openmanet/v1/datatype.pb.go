@@ -31,6 +31,10 @@ const (
 	DataType_DATA_TYPE_ADDRESS_RESERVATION DataType = 101
 	// Node data type
 	DataType_DATA_TYPE_NODE DataType = 102
+	// Service announcement data type
+	DataType_DATA_TYPE_SERVICE DataType = 103
+	// Topology summary data type
+	DataType_DATA_TYPE_TOPOLOGY DataType = 104
 )
 
 // Enum value maps for DataType.
@@ -40,12 +44,16 @@ var (
 		100: "DATA_TYPE_GATEWAY",
 		101: "DATA_TYPE_ADDRESS_RESERVATION",
 		102: "DATA_TYPE_NODE",
+		103: "DATA_TYPE_SERVICE",
+		104: "DATA_TYPE_TOPOLOGY",
 	}
 	DataType_value = map[string]int32{
 		"DATA_TYPE_UNSPECIFIED":         0,
 		"DATA_TYPE_GATEWAY":             100,
 		"DATA_TYPE_ADDRESS_RESERVATION": 101,
 		"DATA_TYPE_NODE":                102,
+		"DATA_TYPE_SERVICE":             103,
+		"DATA_TYPE_TOPOLOGY":            104,
 	}
 )
 
@@ -80,12 +88,14 @@ var File_openmanet_v1_datatype_proto protoreflect.FileDescriptor
 
 const file_openmanet_v1_datatype_proto_rawDesc = "" +
 	"\n" +
-	"\x1bopenmanet/v1/datatype.proto\x12\fopenmanet.v1*s\n" +
+	"\x1bopenmanet/v1/datatype.proto\x12\fopenmanet.v1*\xa2\x01\n" +
 	"\bDataType\x12\x19\n" +
 	"\x15DATA_TYPE_UNSPECIFIED\x10\x00\x12\x15\n" +
 	"\x11DATA_TYPE_GATEWAY\x10d\x12!\n" +
 	"\x1dDATA_TYPE_ADDRESS_RESERVATION\x10e\x12\x12\n" +
-	"\x0eDATA_TYPE_NODE\x10fB\x86\x01\n" +
+	"\x0eDATA_TYPE_NODE\x10f\x12\x15\n" +
+	"\x11DATA_TYPE_SERVICE\x10g\x12\x16\n" +
+	"\x12DATA_TYPE_TOPOLOGY\x10hB\x86\x01\n" +
 	"\x10com.openmanet.v1B\rDatatypeProtoP\x01Z\x12internal/api/proto\xa2\x02\x03OXX\xaa\x02\fOpenmanet.V1\xca\x02\fOpenmanet\\V1\xe2\x02\x18Openmanet\\V1\\GPBMetadata\xea\x02\rOpenmanet::V1b\x06proto3"
 
 var (
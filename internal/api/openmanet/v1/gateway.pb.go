@@ -28,7 +28,11 @@ type Gateway struct {
 	// Hostname of the gateway
 	Hostname string `protobuf:"bytes,2,opt,name=hostname,proto3" json:"hostname,omitempty"`
 	// IP address of the gateway
-	Ipaddr        string `protobuf:"bytes,3,opt,name=ipaddr,proto3" json:"ipaddr,omitempty"`
+	Ipaddr string `protobuf:"bytes,3,opt,name=ipaddr,proto3" json:"ipaddr,omitempty"`
+	// Deployment ID of the mesh the record belongs to
+	MeshId string `protobuf:"bytes,4,opt,name=mesh_id,json=meshId,proto3" json:"mesh_id,omitempty"`
+	// Whether the gateway is shutting down and must no longer be selected
+	Withdrawing   bool `protobuf:"varint,5,opt,name=withdrawing,proto3" json:"withdrawing,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -84,15 +88,31 @@ func (x *Gateway) GetIpaddr() string {
 	return ""
 }
 
+func (x *Gateway) GetMeshId() string {
+	if x != nil {
+		return x.MeshId
+	}
+	return ""
+}
+
+func (x *Gateway) GetWithdrawing() bool {
+	if x != nil {
+		return x.Withdrawing
+	}
+	return false
+}
+
 var File_openmanet_v1_gateway_proto protoreflect.FileDescriptor
 
 const file_openmanet_v1_gateway_proto_rawDesc = "" +
 	"\n" +
-	"\x1aopenmanet/v1/gateway.proto\x12\fopenmanet.v1\"O\n" +
+	"\x1aopenmanet/v1/gateway.proto\x12\fopenmanet.v1\"\x8a\x01\n" +
 	"\aGateway\x12\x10\n" +
 	"\x03mac\x18\x01 \x01(\tR\x03mac\x12\x1a\n" +
 	"\bhostname\x18\x02 \x01(\tR\bhostname\x12\x16\n" +
-	"\x06ipaddr\x18\x03 \x01(\tR\x06ipaddrB\x85\x01\n" +
+	"\x06ipaddr\x18\x03 \x01(\tR\x06ipaddr\x12\x17\n" +
+	"\amesh_id\x18\x04 \x01(\tR\x06meshId\x12 \n" +
+	"\vwithdrawing\x18\x05 \x01(\bR\vwithdrawingB\x85\x01\n" +
 	"\x10com.openmanet.v1B\fGatewayProtoP\x01Z\x12internal/api/proto\xa2\x02\x03OXX\xaa\x02\fOpenmanet.V1\xca\x02\fOpenmanet\\V1\xe2\x02\x18Openmanet\\V1\\GPBMetadata\xea\x02\rOpenmanet::V1b\x06proto3"
 
 var (
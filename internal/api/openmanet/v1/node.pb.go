@@ -35,8 +35,26 @@ type AddressReservation struct {
 	UciDhcpLimit string `protobuf:"bytes,5,opt,name=uci_dhcp_limit,json=uciDhcpLimit,proto3" json:"uci_dhcp_limit,omitempty"`
 	// Whether the node is requesting a reservation
 	RequestingReservation bool `protobuf:"varint,6,opt,name=requesting_reservation,json=requestingReservation,proto3" json:"requesting_reservation,omitempty"`
-	unknownFields         protoimpl.UnknownFields
-	sizeCache             protoimpl.SizeCache
+	// Hostname of the node
+	Hostname string `protobuf:"bytes,7,opt,name=hostname,proto3" json:"hostname,omitempty"`
+	// Deployment ID of the mesh the record belongs to
+	MeshId string `protobuf:"bytes,8,opt,name=mesh_id,json=meshId,proto3" json:"mesh_id,omitempty"`
+	// Schema version of the record, absent in records published before it existed
+	SchemaVersion uint32 `protobuf:"varint,9,opt,name=schema_version,json=schemaVersion,proto3" json:"schema_version,omitempty"`
+	// Unix time the record was last changed, set on the final record of a node shutting down
+	RefreshedAt int64 `protobuf:"varint,10,opt,name=refreshed_at,json=refreshedAt,proto3" json:"refreshed_at,omitempty"`
+	// Whether the node is shutting down; its reservation stays valid
+	ShuttingDown bool `protobuf:"varint,11,opt,name=shutting_down,json=shuttingDown,proto3" json:"shutting_down,omitempty"`
+	// MAC of the block owner a delegated reservation request is directed to
+	TargetMac string `protobuf:"bytes,12,opt,name=target_mac,json=targetMac,proto3" json:"target_mac,omitempty"`
+	// /24 blocks the node hands out addresses from in delegated allocation mode
+	DelegatedBlocks []string `protobuf:"bytes,13,rep,name=delegated_blocks,json=delegatedBlocks,proto3" json:"delegated_blocks,omitempty"`
+	// Number of addresses left free in the delegated blocks
+	BlockFree uint32 `protobuf:"varint,14,opt,name=block_free,json=blockFree,proto3" json:"block_free,omitempty"`
+	// Answers to the delegated reservation requests directed to the node
+	Offers        []*BlockOffer `protobuf:"bytes,15,rep,name=offers,proto3" json:"offers,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
 }
 
 func (x *AddressReservation) Reset() {
@@ -111,6 +129,69 @@ func (x *AddressReservation) GetRequestingReservation() bool {
 	return false
 }
 
+func (x *AddressReservation) GetHostname() string {
+	if x != nil {
+		return x.Hostname
+	}
+	return ""
+}
+
+func (x *AddressReservation) GetMeshId() string {
+	if x != nil {
+		return x.MeshId
+	}
+	return ""
+}
+
+func (x *AddressReservation) GetSchemaVersion() uint32 {
+	if x != nil {
+		return x.SchemaVersion
+	}
+	return 0
+}
+
+func (x *AddressReservation) GetRefreshedAt() int64 {
+	if x != nil {
+		return x.RefreshedAt
+	}
+	return 0
+}
+
+func (x *AddressReservation) GetShuttingDown() bool {
+	if x != nil {
+		return x.ShuttingDown
+	}
+	return false
+}
+
+func (x *AddressReservation) GetTargetMac() string {
+	if x != nil {
+		return x.TargetMac
+	}
+	return ""
+}
+
+func (x *AddressReservation) GetDelegatedBlocks() []string {
+	if x != nil {
+		return x.DelegatedBlocks
+	}
+	return nil
+}
+
+func (x *AddressReservation) GetBlockFree() uint32 {
+	if x != nil {
+		return x.BlockFree
+	}
+	return 0
+}
+
+func (x *AddressReservation) GetOffers() []*BlockOffer {
+	if x != nil {
+		return x.Offers
+	}
+	return nil
+}
+
 type Node struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
 	// MAC address of the node
@@ -120,7 +201,15 @@ type Node struct {
 	// IP address of the node
 	Ipaddr string `protobuf:"bytes,3,opt,name=ipaddr,proto3" json:"ipaddr,omitempty"`
 	// Position of the node
-	Position      *Position `protobuf:"bytes,4,opt,name=position,proto3" json:"position,omitempty"`
+	Position *Position `protobuf:"bytes,4,opt,name=position,proto3" json:"position,omitempty"`
+	// Router advertisement role of the node ("gateway" or "client")
+	RaRole string `protobuf:"bytes,5,opt,name=ra_role,json=raRole,proto3" json:"ra_role,omitempty"`
+	// Deployment ID of the mesh the record belongs to
+	MeshId string `protobuf:"bytes,6,opt,name=mesh_id,json=meshId,proto3" json:"mesh_id,omitempty"`
+	// Number of live single hop batman-adv neighbors
+	NeighborCount uint32 `protobuf:"varint,7,opt,name=neighbor_count,json=neighborCount,proto3" json:"neighbor_count,omitempty"`
+	// Coarse mesh health as seen by the node ("isolated", "sparse" or "healthy")
+	MeshHealth    string `protobuf:"bytes,8,opt,name=mesh_health,json=meshHealth,proto3" json:"mesh_health,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -183,6 +272,34 @@ func (x *Node) GetPosition() *Position {
 	return nil
 }
 
+func (x *Node) GetRaRole() string {
+	if x != nil {
+		return x.RaRole
+	}
+	return ""
+}
+
+func (x *Node) GetMeshId() string {
+	if x != nil {
+		return x.MeshId
+	}
+	return ""
+}
+
+func (x *Node) GetNeighborCount() uint32 {
+	if x != nil {
+		return x.NeighborCount
+	}
+	return 0
+}
+
+func (x *Node) GetMeshHealth() string {
+	if x != nil {
+		return x.MeshHealth
+	}
+	return ""
+}
+
 type Position struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
 	// Latitude of the node
@@ -246,27 +363,271 @@ func (x *Position) GetAltitude() float32 {
 	return 0
 }
 
+type BlockOffer struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// MAC of the node that requested an address
+	TargetMac string `protobuf:"bytes,1,opt,name=target_mac,json=targetMac,proto3" json:"target_mac,omitempty"`
+	// Static IP offered to the node, empty if the request was refused
+	StaticIp string `protobuf:"bytes,2,opt,name=static_ip,json=staticIp,proto3" json:"static_ip,omitempty"`
+	// Whether the request was refused because the blocks are full
+	Refused       bool `protobuf:"varint,3,opt,name=refused,proto3" json:"refused,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BlockOffer) Reset() {
+	*x = BlockOffer{}
+	mi := &file_openmanet_v1_node_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BlockOffer) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BlockOffer) ProtoMessage() {}
+
+func (x *BlockOffer) ProtoReflect() protoreflect.Message {
+	mi := &file_openmanet_v1_node_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BlockOffer.ProtoReflect.Descriptor instead.
+func (*BlockOffer) Descriptor() ([]byte, []int) {
+	return file_openmanet_v1_node_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *BlockOffer) GetTargetMac() string {
+	if x != nil {
+		return x.TargetMac
+	}
+	return ""
+}
+
+func (x *BlockOffer) GetStaticIp() string {
+	if x != nil {
+		return x.StaticIp
+	}
+	return ""
+}
+
+func (x *BlockOffer) GetRefused() bool {
+	if x != nil {
+		return x.Refused
+	}
+	return false
+}
+
+type TopologySummary struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// MAC of the node publishing the summary
+	Mac string `protobuf:"bytes,1,opt,name=mac,proto3" json:"mac,omitempty"`
+	// batman-adv originator address of the node
+	Originator string `protobuf:"bytes,2,opt,name=originator,proto3" json:"originator,omitempty"`
+	// Mesh ID
+	MeshId string `protobuf:"bytes,3,opt,name=mesh_id,json=meshId,proto3" json:"mesh_id,omitempty"`
+	// Direct neighbors of the node
+	Links         []*TopologyLink `protobuf:"bytes,4,rep,name=links,proto3" json:"links,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TopologySummary) Reset() {
+	*x = TopologySummary{}
+	mi := &file_openmanet_v1_node_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TopologySummary) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TopologySummary) ProtoMessage() {}
+
+func (x *TopologySummary) ProtoReflect() protoreflect.Message {
+	mi := &file_openmanet_v1_node_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TopologySummary.ProtoReflect.Descriptor instead.
+func (*TopologySummary) Descriptor() ([]byte, []int) {
+	return file_openmanet_v1_node_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *TopologySummary) GetMac() string {
+	if x != nil {
+		return x.Mac
+	}
+	return ""
+}
+
+func (x *TopologySummary) GetOriginator() string {
+	if x != nil {
+		return x.Originator
+	}
+	return ""
+}
+
+func (x *TopologySummary) GetMeshId() string {
+	if x != nil {
+		return x.MeshId
+	}
+	return ""
+}
+
+func (x *TopologySummary) GetLinks() []*TopologyLink {
+	if x != nil {
+		return x.Links
+	}
+	return nil
+}
+
+type TopologyLink struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Originator address of the neighbor
+	Neighbor string `protobuf:"bytes,1,opt,name=neighbor,proto3" json:"neighbor,omitempty"`
+	// Transmit quality towards the neighbor (B.A.T.M.A.N. IV)
+	Tq uint32 `protobuf:"varint,2,opt,name=tq,proto3" json:"tq,omitempty"`
+	// Throughput towards the neighbor in kbit/s (B.A.T.M.A.N. V)
+	Throughput uint32 `protobuf:"varint,3,opt,name=throughput,proto3" json:"throughput,omitempty"`
+	// Milliseconds since the neighbor was last seen
+	LastSeenMsecs uint32 `protobuf:"varint,4,opt,name=last_seen_msecs,json=lastSeenMsecs,proto3" json:"last_seen_msecs,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TopologyLink) Reset() {
+	*x = TopologyLink{}
+	mi := &file_openmanet_v1_node_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TopologyLink) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TopologyLink) ProtoMessage() {}
+
+func (x *TopologyLink) ProtoReflect() protoreflect.Message {
+	mi := &file_openmanet_v1_node_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TopologyLink.ProtoReflect.Descriptor instead.
+func (*TopologyLink) Descriptor() ([]byte, []int) {
+	return file_openmanet_v1_node_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *TopologyLink) GetNeighbor() string {
+	if x != nil {
+		return x.Neighbor
+	}
+	return ""
+}
+
+func (x *TopologyLink) GetTq() uint32 {
+	if x != nil {
+		return x.Tq
+	}
+	return 0
+}
+
+func (x *TopologyLink) GetThroughput() uint32 {
+	if x != nil {
+		return x.Throughput
+	}
+	return 0
+}
+
+func (x *TopologyLink) GetLastSeenMsecs() uint32 {
+	if x != nil {
+		return x.LastSeenMsecs
+	}
+	return 0
+}
+
 var File_openmanet_v1_node_proto protoreflect.FileDescriptor
 
 const file_openmanet_v1_node_proto_rawDesc = "" +
 	"\n" +
-	"\x17openmanet/v1/node.proto\x12\fopenmanet.v1\"\xf1\x01\n" +
+	"\x17openmanet/v1/node.proto\x12\fopenmanet.v1\"\xb0\x04\n" +
 	"\x12AddressReservation\x12\x10\n" +
 	"\x03mac\x18\x01 \x01(\tR\x03mac\x12\x1b\n" +
 	"\tstatic_ip\x18\x02 \x01(\tR\bstaticIp\x12)\n" +
 	"\x10reservation_cidr\x18\x03 \x01(\tR\x0freservationCidr\x12$\n" +
 	"\x0euci_dhcp_start\x18\x04 \x01(\tR\fuciDhcpStart\x12$\n" +
 	"\x0euci_dhcp_limit\x18\x05 \x01(\tR\fuciDhcpLimit\x125\n" +
-	"\x16requesting_reservation\x18\x06 \x01(\bR\x15requestingReservation\"\x80\x01\n" +
+	"\x16requesting_reservation\x18\x06 \x01(\bR\x15requestingReservation\x12\x1a\n" +
+	"\bhostname\x18\a \x01(\tR\bhostname\x12\x17\n" +
+	"\amesh_id\x18\b \x01(\tR\x06meshId\x12%\n" +
+	"\x0eschema_version\x18\t \x01(\rR\rschemaVersion\x12!\n" +
+	"\frefreshed_at\x18\n" +
+	" \x01(\x03R\vrefreshedAt\x12#\n" +
+	"\rshutting_down\x18\v \x01(\bR\fshuttingDown\x12\x1d\n" +
+	"\n" +
+	"target_mac\x18\f \x01(\tR\ttargetMac\x12)\n" +
+	"\x10delegated_blocks\x18\r \x03(\tR\x0fdelegatedBlocks\x12\x1d\n" +
+	"\n" +
+	"block_free\x18\x0e \x01(\rR\tblockFree\x120\n" +
+	"\x06offers\x18\x0f \x03(\v2\x18.openmanet.v1.BlockOfferR\x06offers\"\xfa\x01\n" +
 	"\x04Node\x12\x10\n" +
 	"\x03mac\x18\x01 \x01(\tR\x03mac\x12\x1a\n" +
 	"\bhostname\x18\x02 \x01(\tR\bhostname\x12\x16\n" +
 	"\x06ipaddr\x18\x03 \x01(\tR\x06ipaddr\x122\n" +
-	"\bposition\x18\x04 \x01(\v2\x16.openmanet.v1.PositionR\bposition\"`\n" +
+	"\bposition\x18\x04 \x01(\v2\x16.openmanet.v1.PositionR\bposition\x12\x17\n" +
+	"\ara_role\x18\x05 \x01(\tR\x06raRole\x12\x17\n" +
+	"\amesh_id\x18\x06 \x01(\tR\x06meshId\x12%\n" +
+	"\x0eneighbor_count\x18\a \x01(\rR\rneighborCount\x12\x1f\n" +
+	"\vmesh_health\x18\b \x01(\tR\n" +
+	"meshHealth\"`\n" +
 	"\bPosition\x12\x1a\n" +
 	"\blatitude\x18\x01 \x01(\x01R\blatitude\x12\x1c\n" +
 	"\tlongitude\x18\x02 \x01(\x01R\tlongitude\x12\x1a\n" +
-	"\baltitude\x18\x03 \x01(\x02R\baltitudeB\x82\x01\n" +
+	"\baltitude\x18\x03 \x01(\x02R\baltitude\"b\n" +
+	"\n" +
+	"BlockOffer\x12\x1d\n" +
+	"\n" +
+	"target_mac\x18\x01 \x01(\tR\ttargetMac\x12\x1b\n" +
+	"\tstatic_ip\x18\x02 \x01(\tR\bstaticIp\x12\x18\n" +
+	"\arefused\x18\x03 \x01(\bR\arefused\"\x8e\x01\n" +
+	"\x0fTopologySummary\x12\x10\n" +
+	"\x03mac\x18\x01 \x01(\tR\x03mac\x12\x1e\n" +
+	"\n" +
+	"originator\x18\x02 \x01(\tR\n" +
+	"originator\x12\x17\n" +
+	"\amesh_id\x18\x03 \x01(\tR\x06meshId\x120\n" +
+	"\x05links\x18\x04 \x03(\v2\x1a.openmanet.v1.TopologyLinkR\x05links\"\x82\x01\n" +
+	"\fTopologyLink\x12\x1a\n" +
+	"\bneighbor\x18\x01 \x01(\tR\bneighbor\x12\x0e\n" +
+	"\x02tq\x18\x02 \x01(\rR\x02tq\x12\x1e\n" +
+	"\n" +
+	"throughput\x18\x03 \x01(\rR\n" +
+	"throughput\x12&\n" +
+	"\x0flast_seen_msecs\x18\x04 \x01(\rR\rlastSeenMsecsB\x82\x01\n" +
 	"\x10com.openmanet.v1B\tNodeProtoP\x01Z\x12internal/api/proto\xa2\x02\x03OXX\xaa\x02\fOpenmanet.V1\xca\x02\fOpenmanet\\V1\xe2\x02\x18Openmanet\\V1\\GPBMetadata\xea\x02\rOpenmanet::V1b\x06proto3"
 
 var (
@@ -281,19 +642,24 @@ func file_openmanet_v1_node_proto_rawDescGZIP() []byte {
 	return file_openmanet_v1_node_proto_rawDescData
 }
 
-var file_openmanet_v1_node_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_openmanet_v1_node_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
 var file_openmanet_v1_node_proto_goTypes = []any{
 	(*AddressReservation)(nil), // 0: openmanet.v1.AddressReservation
 	(*Node)(nil),               // 1: openmanet.v1.Node
 	(*Position)(nil),           // 2: openmanet.v1.Position
+	(*BlockOffer)(nil),         // 3: openmanet.v1.BlockOffer
+	(*TopologySummary)(nil),    // 4: openmanet.v1.TopologySummary
+	(*TopologyLink)(nil),       // 5: openmanet.v1.TopologyLink
 }
 var file_openmanet_v1_node_proto_depIdxs = []int32{
-	2, // 0: openmanet.v1.Node.position:type_name -> openmanet.v1.Position
-	1, // [1:1] is the sub-list for method output_type
-	1, // [1:1] is the sub-list for method input_type
-	1, // [1:1] is the sub-list for extension type_name
-	1, // [1:1] is the sub-list for extension extendee
-	0, // [0:1] is the sub-list for field type_name
+	3, // 0: openmanet.v1.AddressReservation.offers:type_name -> openmanet.v1.BlockOffer
+	2, // 1: openmanet.v1.Node.position:type_name -> openmanet.v1.Position
+	5, // 2: openmanet.v1.TopologySummary.links:type_name -> openmanet.v1.TopologyLink
+	3, // [3:3] is the sub-list for method output_type
+	3, // [3:3] is the sub-list for method input_type
+	3, // [3:3] is the sub-list for extension type_name
+	3, // [3:3] is the sub-list for extension extendee
+	0, // [0:3] is the sub-list for field type_name
 }
 
 func init() { file_openmanet_v1_node_proto_init() }
@@ -307,7 +673,7 @@ func file_openmanet_v1_node_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_openmanet_v1_node_proto_rawDesc), len(file_openmanet_v1_node_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   3,
+			NumMessages:   6,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
@@ -2,7 +2,6 @@ package batmanadv
 
 import (
 	"encoding/json"
-	"os/exec"
 	"sort"
 )
 
@@ -20,8 +19,12 @@ type Gateway struct {
 type Gateways []Gateway
 
 func GetMeshGateways(iface string) (*Gateways, error) {
-	cmd := exec.Command("batctl", "gwj")
-	output, err := cmd.Output()
+	return GetMeshGatewaysWithRunner(NewBatctlRunner(), iface)
+}
+
+// GetMeshGatewaysWithRunner returns the gateway table using the provided runner.
+func GetMeshGatewaysWithRunner(runner Runner, iface string) (*Gateways, error) {
+	output, err := runner.Run("gwj")
 	if err != nil {
 		return nil, err
 	}
@@ -1,9 +1,17 @@
 package batmanadv
 
-import "os"
+import (
+	"os"
+
+	"github.com/openmanet/openmanetd/internal/safemode"
+)
 
 // ClearBatHosts clears the batman-adv hosts file by writing empty content to /tmp/bat-hosts.
-// Returns an error if the file write operation fails.
+// Returns an error if the file write operation fails or safe mode is active.
 func ClearBatHosts() error {
+	if err := safemode.Check("clear /tmp/bat-hosts"); err != nil {
+		return err
+	}
+
 	return os.WriteFile("/tmp/bat-hosts", []byte{}, 0644)
 }
@@ -0,0 +1,118 @@
+package batmanadv
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/openmanet/openmanetd/internal/safemode"
+)
+
+// validIsolationMark reports whether mark only sets bits that are in mask. batman-adv
+// compares the masked firewall mark of a packet against mark, so a bit outside the
+// mask could never match.
+func validIsolationMark(mark, mask uint32) bool {
+	return mark&^mask == 0
+}
+
+// formatIsolationMark formats a mark and mask the way batctl accepts them.
+func formatIsolationMark(mark, mask uint32) string {
+	return fmt.Sprintf("0x%08x/0x%08x", mark, mask)
+}
+
+// parseIsolationMark parses the "mark/mask" value batctl prints for isolation_mark.
+func parseIsolationMark(output []byte) (uint32, uint32, error) {
+	value := strings.TrimSpace(string(output))
+
+	markStr, maskStr, ok := strings.Cut(value, "/")
+	if !ok {
+		return 0, 0, fmt.Errorf("unexpected value %q", value)
+	}
+
+	mark, err := strconv.ParseUint(markStr, 0, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid mark %q", markStr)
+	}
+	mask, err := strconv.ParseUint(maskStr, 0, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid mask %q", maskStr)
+	}
+
+	return uint32(mark), uint32(mask), nil
+}
+
+// GetIsolationMark returns the firewall mark batman-adv uses to classify clients as
+// isolated on a mesh interface.
+//
+// Parameters:
+//   - meshIface: The batman-adv mesh interface, e.g. "bat0"
+//
+// Returns:
+//   - The mark and the mask it is compared under; both are 0 when unset
+//   - An error if batctl fails or prints something unexpected
+//
+// Example:
+//
+//	mark, mask, err := GetIsolationMark("bat0")
+//	if err == nil && mask == 0 {
+//	    log.Printf("No isolation mark configured")
+//	}
+func GetIsolationMark(meshIface string) (uint32, uint32, error) {
+	return GetIsolationMarkWithRunner(NewBatctlRunner(), meshIface)
+}
+
+// GetIsolationMarkWithRunner returns the isolation mark of a mesh interface using the
+// provided runner.
+func GetIsolationMarkWithRunner(runner Runner, meshIface string) (uint32, uint32, error) {
+	output, err := runner.Run("meshif", meshIface, "isolation_mark")
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read isolation_mark of %s: %w", meshIface, err)
+	}
+
+	mark, mask, err := parseIsolationMark(output)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to parse isolation_mark of %s: %w", meshIface, err)
+	}
+
+	return mark, mask, nil
+}
+
+// SetIsolationMark sets the firewall mark that classifies clients as isolated on a
+// mesh interface. Traffic from a client whose packets carry mark under mask is
+// treated like traffic on an AP isolated VLAN, so isolation can follow a firewall
+// rule instead of a VLAN.
+//
+// Parameters:
+//   - meshIface: The batman-adv mesh interface, e.g. "bat0"
+//   - mark: The mark value, e.g. 0x10
+//   - mask: The bits of the firewall mark compared against mark, e.g. 0xf0
+//
+// Returns:
+//   - An error if mark has bits outside mask, safe mode is active or batctl fails
+//
+// Example:
+//
+//	if err := SetIsolationMark("bat0", 0x10, 0xf0); err != nil {
+//	    log.Printf("Failed to set isolation mark: %v", err)
+//	}
+func SetIsolationMark(meshIface string, mark, mask uint32) error {
+	return SetIsolationMarkWithRunner(NewBatctlRunner(), meshIface, mark, mask)
+}
+
+// SetIsolationMarkWithRunner sets the isolation mark of a mesh interface using the
+// provided runner.
+func SetIsolationMarkWithRunner(runner Runner, meshIface string, mark, mask uint32) error {
+	if !validIsolationMark(mark, mask) {
+		return fmt.Errorf("isolation mark 0x%x does not fit within mask 0x%x", mark, mask)
+	}
+
+	if err := safemode.Check(fmt.Sprintf("set isolation_mark of %s", meshIface)); err != nil {
+		return err
+	}
+
+	if _, err := runner.Run("meshif", meshIface, "isolation_mark", formatIsolationMark(mark, mask)); err != nil {
+		return fmt.Errorf("failed to set isolation_mark of %s: %w", meshIface, err)
+	}
+
+	return nil
+}
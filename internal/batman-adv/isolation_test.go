@@ -0,0 +1,88 @@
+package batmanadv
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSetIsolationMark(t *testing.T) {
+	tests := []struct {
+		name     string
+		mark     uint32
+		mask     uint32
+		wantCall string
+		wantErr  bool
+	}{
+		{name: "mark within mask", mark: 0x10, mask: 0xf0, wantCall: "meshif bat0 isolation_mark 0x00000010/0x000000f0"},
+		{name: "full mask", mark: 0xdeadbeef, mask: 0xffffffff, wantCall: "meshif bat0 isolation_mark 0xdeadbeef/0xffffffff"},
+		{name: "disabled", mark: 0, mask: 0, wantCall: "meshif bat0 isolation_mark 0x00000000/0x00000000"},
+		{name: "mark outside mask", mark: 0x11, mask: 0xf0, wantErr: true},
+		{name: "mark without mask", mark: 0x10, mask: 0, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := &fakeRunner{}
+
+			err := SetIsolationMarkWithRunner(runner, "bat0", tt.mark, tt.mask)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SetIsolationMarkWithRunner() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var want []string
+			if !tt.wantErr {
+				want = []string{tt.wantCall}
+			}
+			if !reflect.DeepEqual(runner.calls, want) {
+				t.Errorf("commands = %q, want %q", runner.calls, want)
+			}
+		})
+	}
+}
+
+func TestGetIsolationMark(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   string
+		wantMark uint32
+		wantMask uint32
+		wantErr  bool
+	}{
+		{name: "set", output: "0x00000010/0x000000f0\n", wantMark: 0x10, wantMask: 0xf0},
+		{name: "unset", output: "0x00000000/0x00000000\n", wantMark: 0, wantMask: 0},
+		{name: "no mask", output: "0x00000010\n", wantErr: true},
+		{name: "invalid mark", output: "mark/0xf0\n", wantErr: true},
+		{name: "mask too wide", output: "0x10/0x1ffffffff\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := &fakeRunner{outputs: map[string]string{"meshif bat0 isolation_mark": tt.output}}
+
+			mark, mask, err := GetIsolationMarkWithRunner(runner, "bat0")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetIsolationMarkWithRunner() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if mark != tt.wantMark || mask != tt.wantMask {
+				t.Errorf("GetIsolationMarkWithRunner() = 0x%x/0x%x, want 0x%x/0x%x", mark, mask, tt.wantMark, tt.wantMask)
+			}
+		})
+	}
+}
+
+func TestIsolationMarkRoundTrip(t *testing.T) {
+	runner := &fakeRunner{outputs: map[string]string{}}
+	if err := SetIsolationMarkWithRunner(runner, "bat0", 0x400, 0xff00); err != nil {
+		t.Fatalf("SetIsolationMarkWithRunner() error = %v", err)
+	}
+
+	// batctl prints the value back in the form it was given
+	args := strings.Fields(runner.calls[0])
+	runner.outputs["meshif bat0 isolation_mark"] = args[len(args)-1] + "\n"
+
+	mark, mask, err := GetIsolationMarkWithRunner(runner, "bat0")
+	if err != nil || mark != 0x400 || mask != 0xff00 {
+		t.Errorf("GetIsolationMarkWithRunner() = 0x%x/0x%x, %v; want 0x400/0xff00", mark, mask, err)
+	}
+}
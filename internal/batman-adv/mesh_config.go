@@ -1,8 +1,8 @@
 package batmanadv
 
 import (
+	"context"
 	"encoding/json"
-	"os/exec"
 )
 
 type MeshConfig struct {
@@ -54,9 +54,34 @@ type McastFlagsPriv struct {
 	Raw                  int  `json:"raw"`
 }
 
+// GetMeshConfig runs batctl and returns the current mesh configuration. Every call
+// execs batctl; callers that read it often share a MeshConfigCache instead.
 func GetMeshConfig(iface string) (*MeshConfig, error) {
-	cmd := exec.Command("batctl", "mj")
-	output, err := cmd.Output()
+	return GetMeshConfigWithRunner(NewBatctlRunner(), iface)
+}
+
+// GetMeshConfigWithRunner returns the current mesh configuration using the provided
+// runner.
+func GetMeshConfigWithRunner(runner Runner, iface string) (*MeshConfig, error) {
+	return GetMeshConfigContextWithRunner(context.Background(), runner, iface)
+}
+
+// GetMeshConfigContext is GetMeshConfig with batctl killed when ctx is done, so that
+// a worker reading the mesh configuration does not hold up a shutdown.
+//
+// Example:
+//
+//	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+//	defer cancel()
+//	config, err := GetMeshConfigContext(ctx, "bat0")
+func GetMeshConfigContext(ctx context.Context, iface string) (*MeshConfig, error) {
+	return GetMeshConfigContextWithRunner(ctx, NewBatctlRunner(), iface)
+}
+
+// GetMeshConfigContextWithRunner returns the current mesh configuration using the
+// provided runner, cancelled by ctx if the runner is a ContextRunner.
+func GetMeshConfigContextWithRunner(ctx context.Context, runner Runner, iface string) (*MeshConfig, error) {
+	output, err := runContext(ctx, runner, "mj")
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,135 @@
+package batmanadv
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultMeshConfigCacheTTL is how long a MeshConfigCache serves a mesh configuration
+// before reading it again.
+const DefaultMeshConfigCacheTTL = 2 * time.Second
+
+// MeshConfigCache shares the mesh configuration between the workers that read it
+// every tick, so that one batctl run serves all of them. Concurrent reads of an
+// expired entry wait for a single batctl run. Failed reads are not cached.
+//
+// Writes through the setters of the cache invalidate it, so a write is never followed
+// by a stale read. Callers that need a guaranteed-fresh read use GetMeshConfig.
+type MeshConfigCache struct {
+	runner Runner
+	ttl    time.Duration
+	now    func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*meshConfigEntry
+}
+
+// meshConfigEntry is the cached configuration of one mesh interface. done is closed
+// once the read that fills it has finished.
+type meshConfigEntry struct {
+	done    chan struct{}
+	config  *MeshConfig
+	err     error
+	fetched time.Time
+}
+
+// NewMeshConfigCache creates a cache reading through batctl. A ttl of zero or less
+// uses DefaultMeshConfigCacheTTL.
+func NewMeshConfigCache(ttl time.Duration) *MeshConfigCache {
+	return NewMeshConfigCacheWithRunner(NewBatctlRunner(), ttl)
+}
+
+// NewMeshConfigCacheWithRunner creates a cache reading through the provided runner.
+func NewMeshConfigCacheWithRunner(runner Runner, ttl time.Duration) *MeshConfigCache {
+	if ttl <= 0 {
+		ttl = DefaultMeshConfigCacheTTL
+	}
+
+	return &MeshConfigCache{
+		runner:  runner,
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]*meshConfigEntry),
+	}
+}
+
+// Get returns the mesh configuration of iface, reading it with batctl if the cached
+// one is older than the TTL. Each caller gets its own copy.
+func (c *MeshConfigCache) Get(iface string) (*MeshConfig, error) {
+	return c.GetContext(context.Background(), iface)
+}
+
+// GetContext is Get that gives up when ctx is done, both while waiting for another
+// caller's read and while running batctl itself. A read cancelled this way is not
+// cached.
+func (c *MeshConfigCache) GetContext(ctx context.Context, iface string) (*MeshConfig, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[iface]
+	if ok {
+		select {
+		case <-entry.done:
+			if c.now().Sub(entry.fetched) < c.ttl {
+				c.mu.Unlock()
+				return entry.result()
+			}
+		default:
+			// Another caller is reading it; share its result
+			c.mu.Unlock()
+			select {
+			case <-entry.done:
+				return entry.result()
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+	}
+
+	entry = &meshConfigEntry{done: make(chan struct{})}
+	c.entries[iface] = entry
+	c.mu.Unlock()
+
+	config, err := GetMeshConfigContextWithRunner(ctx, c.runner, iface)
+
+	c.mu.Lock()
+	entry.config, entry.err, entry.fetched = config, err, c.now()
+	if err != nil && c.entries[iface] == entry {
+		delete(c.entries, iface)
+	}
+	close(entry.done)
+	c.mu.Unlock()
+
+	return entry.result()
+}
+
+// result returns a copy of the configuration of a finished entry.
+func (e *meshConfigEntry) result() (*MeshConfig, error) {
+	if e.err != nil {
+		return nil, e.err
+	}
+
+	config := *e.config
+	return &config, nil
+}
+
+// Invalidate drops the cached configuration of iface, so the next Get reads it again.
+// A read already in progress still completes for its callers but is not cached.
+func (c *MeshConfigCache) Invalidate(iface string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, iface)
+}
+
+// SetVLANAPIsolation enables or disables AP isolation on one VLAN of a mesh interface
+// and invalidates the cached configuration of the interface.
+func (c *MeshConfigCache) SetVLANAPIsolation(meshIface string, vid int, enabled bool) error {
+	defer c.Invalidate(meshIface)
+	return SetVLANAPIsolationWithRunner(c.runner, meshIface, vid, enabled)
+}
+
+// SetIsolationMark sets the isolation mark of a mesh interface and invalidates the
+// cached configuration of the interface.
+func (c *MeshConfigCache) SetIsolationMark(meshIface string, mark, mask uint32) error {
+	defer c.Invalidate(meshIface)
+	return SetIsolationMarkWithRunner(c.runner, meshIface, mark, mask)
+}
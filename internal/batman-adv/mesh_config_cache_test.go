@@ -0,0 +1,172 @@
+package batmanadv
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingRunner answers batctl mj after release is closed and counts the runs.
+type countingRunner struct {
+	release chan struct{}
+	err     error
+	mj      atomic.Int32
+	writes  atomic.Int32
+}
+
+func newCountingRunner() *countingRunner {
+	r := &countingRunner{release: make(chan struct{})}
+	close(r.release)
+	return r
+}
+
+func (r *countingRunner) Run(args ...string) ([]byte, error) {
+	if len(args) == 1 && args[0] == "mj" {
+		r.mj.Add(1)
+		<-r.release
+		if r.err != nil {
+			return nil, r.err
+		}
+		return []byte(mockBatctlOutput()), nil
+	}
+
+	r.writes.Add(1)
+	return nil, nil
+}
+
+// newTestCache returns a cache with a clock that only moves when advanced.
+func newTestCache(runner Runner) (*MeshConfigCache, func(time.Duration)) {
+	now := time.Unix(0, 0)
+	cache := NewMeshConfigCacheWithRunner(runner, time.Second)
+	cache.now = func() time.Time { return now }
+
+	return cache, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestMeshConfigCache_Concurrent(t *testing.T) {
+	runner := &countingRunner{release: make(chan struct{})}
+	cache, _ := newTestCache(runner)
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if cfg, err := cache.Get("bat0"); err != nil || cfg.MeshIfname != "bat0" {
+				t.Errorf("Get() = %v, %v", cfg, err)
+			}
+		}()
+	}
+
+	// Let every caller reach the cache before batctl answers
+	for runner.mj.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(runner.release)
+	wg.Wait()
+
+	if got := runner.mj.Load(); got != 1 {
+		t.Errorf("batctl mj ran %d times, want 1", got)
+	}
+}
+
+func TestMeshConfigCache_TTL(t *testing.T) {
+	runner := newCountingRunner()
+	cache, advance := newTestCache(runner)
+
+	first, _ := cache.Get("bat0")
+	first.GwMode = "changed"
+
+	advance(500 * time.Millisecond)
+	second, _ := cache.Get("bat0")
+	if got := runner.mj.Load(); got != 1 {
+		t.Errorf("batctl mj ran %d times within the TTL, want 1", got)
+	}
+	if second.GwMode == "changed" {
+		t.Error("Get() returned a configuration modified by another caller")
+	}
+
+	advance(time.Second)
+	if _, err := cache.Get("bat0"); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if got := runner.mj.Load(); got != 2 {
+		t.Errorf("batctl mj ran %d times after the TTL, want 2", got)
+	}
+}
+
+func TestMeshConfigCache_ErrorsNotCached(t *testing.T) {
+	runner := newCountingRunner()
+	runner.err = errors.New("exit status 1")
+	cache, _ := newTestCache(runner)
+
+	for range 2 {
+		if _, err := cache.Get("bat0"); err == nil {
+			t.Error("Get() error = nil")
+		}
+	}
+	if got := runner.mj.Load(); got != 2 {
+		t.Errorf("batctl mj ran %d times, want 2", got)
+	}
+}
+
+func TestMeshConfigCache_GetContextCancelled(t *testing.T) {
+	runner := &countingRunner{release: make(chan struct{})}
+	cache, _ := newTestCache(runner)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := cache.Get("bat0"); err != nil {
+			t.Errorf("Get() error = %v", err)
+		}
+	}()
+	for runner.mj.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// A caller waiting for the read in progress gives up with its ctx
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := cache.GetContext(ctx, "bat0"); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetContext() error = %v, want context.Canceled", err)
+	}
+
+	close(runner.release)
+	<-done
+	if got := runner.mj.Load(); got != 1 {
+		t.Errorf("batctl mj ran %d times, want 1", got)
+	}
+}
+
+func TestMeshConfigCache_SetterInvalidates(t *testing.T) {
+	runner := newCountingRunner()
+	cache, _ := newTestCache(runner)
+
+	if _, err := cache.Get("bat0"); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if err := cache.SetIsolationMark("bat0", 0x10, 0xf0); err != nil {
+		t.Fatalf("SetIsolationMark() error = %v", err)
+	}
+	if _, err := cache.Get("bat0"); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if err := cache.SetVLANAPIsolation("bat0", 100, true); err != nil {
+		t.Fatalf("SetVLANAPIsolation() error = %v", err)
+	}
+	if _, err := cache.Get("bat0"); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+
+	if got := runner.mj.Load(); got != 3 {
+		t.Errorf("batctl mj ran %d times, want 3", got)
+	}
+	if got := runner.writes.Load(); got != 2 {
+		t.Errorf("batctl wrote %d times, want 2", got)
+	}
+}
@@ -1,9 +1,14 @@
 package batmanadv
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 // mockBatctlOutput returns a sample batctl mj JSON output
@@ -479,6 +484,35 @@ func TestGetMeshConfig_CommandError(t *testing.T) {
 	}
 }
 
+func TestGetMeshConfigContext_Cancelled(t *testing.T) {
+	// A batctl that hangs is killed once ctx is done
+	path := filepath.Join(t.TempDir(), "batctl")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\nexec sleep 10\n"), 0o755); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := GetMeshConfigContextWithRunner(ctx, &BatctlRunner{Path: path}, "bat0")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("GetMeshConfigContextWithRunner() error = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("GetMeshConfigContextWithRunner() returned after %v", elapsed)
+	}
+
+	// A runner that cannot be cancelled is not started once ctx is done
+	runner := newCountingRunner()
+	if _, err := GetMeshConfigContextWithRunner(ctx, runner, "bat0"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("GetMeshConfigContextWithRunner() error = %v, want context.DeadlineExceeded", err)
+	}
+	if got := runner.mj.Load(); got != 0 {
+		t.Errorf("batctl mj ran %d times, want 0", got)
+	}
+}
+
 func TestMeshConfig_AllFields(t *testing.T) {
 	// Test that all fields can be set and retrieved
 	config := MeshConfig{
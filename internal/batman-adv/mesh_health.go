@@ -0,0 +1,126 @@
+package batmanadv
+
+import (
+	"fmt"
+	"time"
+)
+
+// MeshHealthState is a coarse classification of how connected a node is to the mesh.
+type MeshHealthState string
+
+const (
+	// MeshIsolated means the node has no live neighbor.
+	MeshIsolated MeshHealthState = "isolated"
+	// MeshSparse means the node reaches few nodes, so there is little to choose from.
+	MeshSparse MeshHealthState = "sparse"
+	// MeshHealthy means the node has enough neighbors and originators.
+	MeshHealthy MeshHealthState = "healthy"
+)
+
+// MeshHealthThresholds decide when a mesh counts as sparse.
+type MeshHealthThresholds struct {
+	// LiveWithin is how recently a neighbor must have been heard to count as live.
+	LiveWithin time.Duration
+	// SparseNeighbors is the number of live neighbors below which the mesh is sparse.
+	SparseNeighbors int
+	// SparseOriginators is the number of originators below which the mesh is sparse.
+	SparseOriginators int
+}
+
+// DefaultMeshHealthThresholds are the thresholds used when none are configured.
+var DefaultMeshHealthThresholds = MeshHealthThresholds{
+	LiveWithin:        10 * time.Second,
+	SparseNeighbors:   2,
+	SparseOriginators: 3,
+}
+
+// MeshHealth summarises the originator and neighbor tables of a node.
+type MeshHealth struct {
+	// Neighbors is the number of live single hop neighbors.
+	Neighbors int `json:"neighbors"`
+	// Originators is the number of nodes batman-adv has a route to.
+	Originators int `json:"originators"`
+	// BestTQ and BestThroughput are the link quality of the best direct neighbor;
+	// BATMAN_IV reports TQ and BATMAN_V throughput, so one of them is 0.
+	BestTQ         int             `json:"bestTq"`
+	BestThroughput int             `json:"bestThroughput"`
+	State          MeshHealthState `json:"state"`
+}
+
+// ClassifyMeshHealth returns the state of a mesh with the given number of live
+// neighbors and originators.
+func ClassifyMeshHealth(neighbors, originators int, th MeshHealthThresholds) MeshHealthState {
+	switch {
+	case neighbors == 0:
+		return MeshIsolated
+	case neighbors < th.SparseNeighbors || originators < th.SparseOriginators:
+		return MeshSparse
+	default:
+		return MeshHealthy
+	}
+}
+
+// SummarizeMeshHealth computes the health summary of the given tables.
+func SummarizeMeshHealth(originators Originators, neighbors Neighbors, th MeshHealthThresholds) MeshHealth {
+	var health MeshHealth
+
+	live := make(map[string]bool)
+	for _, n := range neighbors {
+		if time.Duration(n.LastSeenMsecs)*time.Millisecond <= th.LiveWithin {
+			live[n.NeighAddress] = true
+		}
+	}
+	health.Neighbors = len(live)
+
+	seen := make(map[string]bool)
+	for _, o := range originators {
+		seen[o.OrigAddress] = true
+
+		// A direct neighbor is its own next hop
+		if o.Best && o.OrigAddress == o.NeighAddress && live[o.NeighAddress] {
+			health.BestTQ = max(health.BestTQ, o.TQ)
+			health.BestThroughput = max(health.BestThroughput, o.Throughput)
+		}
+	}
+	health.Originators = len(seen)
+
+	health.State = ClassifyMeshHealth(health.Neighbors, health.Originators, th)
+
+	return health
+}
+
+// GetMeshHealth reads the originator and neighbor tables and summarises them.
+//
+// Parameters:
+//   - iface: The batman-adv mesh interface, e.g. "bat0"
+//   - th: The thresholds that classify the mesh
+//
+// Returns:
+//   - The health summary
+//   - An error if either table cannot be read
+//
+// Example:
+//
+//	health, err := GetMeshHealth("bat0", DefaultMeshHealthThresholds)
+//	if err == nil && health.State == MeshIsolated {
+//	    log.Printf("No neighbors in range")
+//	}
+func GetMeshHealth(iface string, th MeshHealthThresholds) (*MeshHealth, error) {
+	return GetMeshHealthWithRunner(NewBatctlRunner(), iface, th)
+}
+
+// GetMeshHealthWithRunner summarises the mesh health using the provided runner.
+func GetMeshHealthWithRunner(runner Runner, iface string, th MeshHealthThresholds) (*MeshHealth, error) {
+	originators, err := GetMeshOriginatorsWithRunner(runner, iface)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read originators: %w", err)
+	}
+
+	neighbors, err := GetMeshNeighborsWithRunner(runner, iface)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read neighbors: %w", err)
+	}
+
+	health := SummarizeMeshHealth(*originators, *neighbors, th)
+	return &health, nil
+}
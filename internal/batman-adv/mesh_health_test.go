@@ -0,0 +1,72 @@
+package batmanadv
+
+import (
+	"testing"
+)
+
+func TestClassifyMeshHealth(t *testing.T) {
+	th := MeshHealthThresholds{SparseNeighbors: 2, SparseOriginators: 3}
+
+	tests := []struct {
+		name        string
+		neighbors   int
+		originators int
+		want        MeshHealthState
+	}{
+		{"alone", 0, 0, MeshIsolated},
+		{"stale originators only", 0, 5, MeshIsolated},
+		{"one neighbor", 1, 4, MeshSparse},
+		{"few originators", 2, 2, MeshSparse},
+		{"at the thresholds", 2, 3, MeshHealthy},
+		{"dense", 6, 20, MeshHealthy},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyMeshHealth(tt.neighbors, tt.originators, th); got != tt.want {
+				t.Errorf("ClassifyMeshHealth(%d, %d) = %s, want %s", tt.neighbors, tt.originators, got, tt.want)
+			}
+		})
+	}
+}
+
+const meshHealthOriginators = `[
+  {"orig_address": "aa:00:00:00:00:01", "neigh_address": "aa:00:00:00:00:01", "hard_ifname": "wlan0", "last_seen_msecs": 400, "tq": 230, "best": true},
+  {"orig_address": "aa:00:00:00:00:02", "neigh_address": "aa:00:00:00:00:02", "hard_ifname": "wlan0", "last_seen_msecs": 600, "tq": 180, "best": true},
+  {"orig_address": "aa:00:00:00:00:03", "neigh_address": "aa:00:00:00:00:01", "hard_ifname": "wlan0", "last_seen_msecs": 900, "tq": 240, "best": true},
+  {"orig_address": "aa:00:00:00:00:03", "neigh_address": "aa:00:00:00:00:02", "hard_ifname": "wlan0", "last_seen_msecs": 900, "tq": 120, "best": false},
+  {"orig_address": "aa:00:00:00:00:04", "neigh_address": "aa:00:00:00:00:04", "hard_ifname": "wlan0", "last_seen_msecs": 60000, "tq": 250, "best": true}
+]`
+
+const meshHealthNeighbors = `[
+  {"neigh_address": "aa:00:00:00:00:01", "hard_ifname": "wlan0", "last_seen_msecs": 400},
+  {"neigh_address": "aa:00:00:00:00:02", "hard_ifname": "wlan0", "last_seen_msecs": 600},
+  {"neigh_address": "aa:00:00:00:00:04", "hard_ifname": "wlan0", "last_seen_msecs": 60000}
+]`
+
+func TestGetMeshHealth(t *testing.T) {
+	runner := &fakeRunner{outputs: map[string]string{"oj": meshHealthOriginators, "nj": meshHealthNeighbors}}
+
+	health, err := GetMeshHealthWithRunner(runner, "bat0", DefaultMeshHealthThresholds)
+	if err != nil {
+		t.Fatalf("GetMeshHealthWithRunner() error = %v", err)
+	}
+
+	// The neighbor last heard a minute ago is not live, and its TQ does not count
+	want := MeshHealth{Neighbors: 2, Originators: 4, BestTQ: 230, State: MeshHealthy}
+	if *health != want {
+		t.Errorf("GetMeshHealthWithRunner() = %+v, want %+v", *health, want)
+	}
+}
+
+func TestGetMeshHealth_Empty(t *testing.T) {
+	runner := &fakeRunner{outputs: map[string]string{"oj": "[]", "nj": "[]"}}
+
+	health, err := GetMeshHealthWithRunner(runner, "bat0", DefaultMeshHealthThresholds)
+	if err != nil {
+		t.Fatalf("GetMeshHealthWithRunner() error = %v", err)
+	}
+	if health.State != MeshIsolated || health.Neighbors != 0 {
+		t.Errorf("GetMeshHealthWithRunner() = %+v, want isolated", *health)
+	}
+}
@@ -0,0 +1,351 @@
+package batmanadv
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMeshLogRetention is how many mesh log lines GetRecentMeshLog keeps.
+	DefaultMeshLogRetention = 500
+
+	// maxMeshLogLine is the longest log line kept; longer lines are cut.
+	maxMeshLogLine = 4096
+	// meshLogBuffer is how many lines a StreamMeshLog channel holds before new lines
+	// are dropped.
+	meshLogBuffer = 256
+	// meshLogRestartMin and meshLogRestartMax bound the wait before batctl is
+	// started again after it exits.
+	meshLogRestartMin = time.Second
+	meshLogRestartMax = 30 * time.Second
+)
+
+// ErrMeshLogUnsupported is returned when the kernel module was built without debug
+// log support, so there is no log to tail.
+var ErrMeshLogUnsupported = errors.New("batman-adv debug log not supported by this kernel (CONFIG_BATMAN_ADV_DEBUG not set)")
+
+// LogLine is one entry of the batman-adv debug log.
+type LogLine struct {
+	// Uptime is the kernel timestamp of the entry, the time since boot.
+	Uptime time.Duration `json:"uptime"`
+	// Received is when the line was read.
+	Received time.Time `json:"received"`
+	// Subsystem is the prefix of the message, such as "TT" or "DAT", if it has one.
+	Subsystem string `json:"subsystem,omitempty"`
+	Message   string `json:"message"`
+	// Continuation is set on lines without a timestamp, which carry on the previous
+	// entry.
+	Continuation bool `json:"continuation,omitempty"`
+}
+
+// String formats the line the way batctl prints it.
+func (l LogLine) String() string {
+	message := l.Message
+	if l.Subsystem != "" {
+		message = l.Subsystem + ": " + message
+	}
+	if l.Continuation {
+		return message
+	}
+
+	return fmt.Sprintf("[%10d] %s", l.Uptime.Milliseconds(), message)
+}
+
+var (
+	logTimestampRe = regexp.MustCompile(`^\[\s*(\d+)\]\s?(.*)$`)
+	logSubsystemRe = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9_-]{0,15}): (.*)$`)
+)
+
+// ParseLogLine parses one line of `batctl log` output. The kernel stamps each entry
+// with the milliseconds since boot in brackets; a line without one continues the
+// entry before it and is returned with Continuation set.
+func ParseLogLine(line string) LogLine {
+	line = strings.TrimRight(line, "\r\n")
+
+	var entry LogLine
+	if m := logTimestampRe.FindStringSubmatch(line); m != nil {
+		ms, _ := strconv.ParseInt(m[1], 10, 64)
+		entry.Uptime = time.Duration(ms) * time.Millisecond
+		line = m[2]
+	} else {
+		entry.Continuation = true
+		line = strings.TrimLeft(line, " \t")
+	}
+
+	if m := logSubsystemRe.FindStringSubmatch(line); m != nil && !entry.Continuation {
+		entry.Subsystem, line = m[1], m[2]
+	}
+	entry.Message = line
+
+	return entry
+}
+
+// LogRing keeps the most recent log entries. Continuation lines are appended to the
+// entry they carry on rather than taking a slot of their own.
+type LogRing struct {
+	mu    sync.Mutex
+	lines []LogLine
+	next  int
+	full  bool
+}
+
+// NewLogRing creates a ring keeping the last size entries. A size of zero or less
+// uses DefaultMeshLogRetention.
+func NewLogRing(size int) *LogRing {
+	if size <= 0 {
+		size = DefaultMeshLogRetention
+	}
+
+	return &LogRing{lines: make([]LogLine, size)}
+}
+
+// Add stores line, dropping the oldest entry if the ring is full.
+func (r *LogRing) Add(line LogLine) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if line.Continuation && (r.next > 0 || r.full) {
+		last := &r.lines[(r.next-1+len(r.lines))%len(r.lines)]
+		if len(last.Message)+1+len(line.Message) <= maxMeshLogLine {
+			last.Message += " " + line.Message
+		}
+		return
+	}
+
+	line.Continuation = false
+	r.lines[r.next] = line
+	r.next = (r.next + 1) % len(r.lines)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// Lines returns the stored entries, oldest first.
+func (r *LogRing) Lines() []LogLine {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.full {
+		return append([]LogLine(nil), r.lines[:r.next]...)
+	}
+
+	lines := make([]LogLine, 0, len(r.lines))
+	lines = append(lines, r.lines[r.next:]...)
+	return append(lines, r.lines[:r.next]...)
+}
+
+var (
+	recentMeshLogMu sync.Mutex
+	recentMeshLog   = NewLogRing(DefaultMeshLogRetention)
+)
+
+// SetMeshLogRetention replaces the ring behind GetRecentMeshLog by one keeping size
+// entries. Entries already kept are dropped.
+func SetMeshLogRetention(size int) {
+	recentMeshLogMu.Lock()
+	defer recentMeshLogMu.Unlock()
+
+	recentMeshLog = NewLogRing(size)
+}
+
+// GetRecentMeshLog returns the last entries read by StreamMeshLog, oldest first.
+func GetRecentMeshLog() []LogLine {
+	return meshLogRing().Lines()
+}
+
+// meshLogRing returns the ring behind GetRecentMeshLog.
+func meshLogRing() *LogRing {
+	recentMeshLogMu.Lock()
+	defer recentMeshLogMu.Unlock()
+
+	return recentMeshLog
+}
+
+// meshLogPath returns the debugfs file batctl reads the log of meshIface from.
+func meshLogPath(meshIface string) string {
+	return "/sys/kernel/debug/batman_adv/" + meshIface + "/log"
+}
+
+// statMeshLog and startMeshLog are overridable for tests.
+var (
+	statMeshLog = func(path string) error {
+		_, err := os.Stat(path)
+		return err
+	}
+	startMeshLog = startBatctlLog
+)
+
+// startBatctlLog starts `batctl meshif meshIface log -w`. It returns the output of
+// batctl and a function that waits for it to exit, returning what it wrote to stderr
+// in the error.
+func startBatctlLog(ctx context.Context, meshIface string) (io.Reader, func() error, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "batctl", "meshif", meshIface, "log", "-w")
+	cmd.Stderr = &stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, nil, fmt.Errorf("batctl log: %w", err)
+	}
+
+	wait := func() error {
+		if err := cmd.Wait(); err != nil {
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return fmt.Errorf("batctl log: %w: %s", err, msg)
+			}
+			return fmt.Errorf("batctl log: %w", err)
+		}
+		return nil
+	}
+
+	return stdout, wait, nil
+}
+
+// CheckMeshLog returns ErrMeshLogUnsupported if the kernel keeps no debug log for
+// meshIface.
+func CheckMeshLog(meshIface string) error {
+	if err := statMeshLog(meshLogPath(meshIface)); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return ErrMeshLogUnsupported
+		}
+		return fmt.Errorf("batman-adv debug log: %w", err)
+	}
+
+	return nil
+}
+
+// isUnsupportedLogError reports whether batctl failed because the kernel has no
+// debug log.
+func isUnsupportedLogError(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "not to be compiled") || strings.Contains(msg, "can't open file")
+}
+
+// StreamMeshLog tails the batman-adv debug log of meshIface. Every entry is kept in
+// the ring behind GetRecentMeshLog and sent on the returned channel; entries are
+// dropped rather than blocking when the reader falls behind. batctl is started again
+// whenever it exits, with a growing wait between attempts. The channel is closed
+// once ctx is done or batctl reports that the log is unsupported.
+//
+// Example:
+//
+//	lines, err := StreamMeshLog(ctx, "bat0")
+//	if errors.Is(err, ErrMeshLogUnsupported) {
+//	    return
+//	}
+//	for line := range lines {
+//	    fmt.Println(line)
+//	}
+func StreamMeshLog(ctx context.Context, meshIface string) (<-chan LogLine, error) {
+	if err := CheckMeshLog(meshIface); err != nil {
+		return nil, err
+	}
+
+	lines := make(chan LogLine, meshLogBuffer)
+	go func() {
+		defer close(lines)
+
+		wait := meshLogRestartMin
+		for ctx.Err() == nil {
+			read, err := tailMeshLog(ctx, meshIface, lines)
+			if isUnsupportedLogError(err) {
+				return
+			}
+			if read > 0 {
+				wait = meshLogRestartMin
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+			wait = min(2*wait, meshLogRestartMax)
+		}
+	}()
+
+	return lines, nil
+}
+
+// tailMeshLog runs batctl once and forwards its lines until it exits. It returns
+// the number of lines read and the exit error of batctl.
+func tailMeshLog(ctx context.Context, meshIface string, lines chan<- LogLine) (int, error) {
+	output, wait, err := startMeshLog(ctx, meshIface)
+	if err != nil {
+		return 0, err
+	}
+
+	ring := meshLogRing()
+	read := 0
+	err = scanLogLines(output, func(line LogLine) {
+		read++
+		line.Received = time.Now()
+		ring.Add(line)
+		select {
+		case lines <- line:
+		default:
+		}
+	})
+	if waitErr := wait(); waitErr != nil {
+		err = waitErr
+	}
+
+	return read, err
+}
+
+// scanLogLines parses every line of r, including a final line without a newline.
+// Lines longer than maxMeshLogLine are cut.
+func scanLogLines(r io.Reader, emit func(LogLine)) error {
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if len(line) > maxMeshLogLine {
+			line = line[:maxMeshLogLine]
+		}
+		if strings.TrimSpace(line) != "" {
+			emit(ParseLogLine(line))
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// ReadMeshLog tails the debug log of meshIface for window and returns the entries
+// read, with continuation lines merged into their entry.
+func ReadMeshLog(ctx context.Context, meshIface string, window time.Duration) ([]LogLine, error) {
+	ctx, cancel := context.WithTimeout(ctx, window)
+	defer cancel()
+
+	lines, err := StreamMeshLog(ctx, meshIface)
+	if err != nil {
+		return nil, err
+	}
+
+	ring := NewLogRing(DefaultMeshLogRetention)
+	for line := range lines {
+		ring.Add(line)
+	}
+
+	return ring.Lines(), nil
+}
@@ -0,0 +1,205 @@
+package batmanadv
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// cannedMeshLog is `batctl log` output with a wrapped entry and a partial last line.
+const cannedMeshLog = `[   4285736] TT: Local changes committed, updating to ttvn 12
+[   4285740] Received BATMAN packet via NB: 02:11:22:33:44:55, IF: wlan0 [02:aa:bb:cc:dd:ee]
+	(from OG: 02:11:22:33:44:55, via prev OG: 02:11:22:33:44:55, seqno 4711, tq 255)
+[   4285901] DAT: Entry updated: 10.41.0.7 02:11:22:33:44:66 (vid: -1)
+[   4286`
+
+func TestParseLogLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want LogLine
+	}{
+		{
+			"[   4285736] TT: Local changes committed, updating to ttvn 12\n",
+			LogLine{Uptime: 4285736 * time.Millisecond, Subsystem: "TT", Message: "Local changes committed, updating to ttvn 12"},
+		},
+		{
+			"[   4285740] Received BATMAN packet via NB: 02:11:22:33:44:55",
+			LogLine{Uptime: 4285740 * time.Millisecond, Message: "Received BATMAN packet via NB: 02:11:22:33:44:55"},
+		},
+		{
+			"\t(from OG: 02:11:22:33:44:55, seqno 4711)",
+			LogLine{Message: "(from OG: 02:11:22:33:44:55, seqno 4711)", Continuation: true},
+		},
+		{
+			"[12] ",
+			LogLine{Uptime: 12 * time.Millisecond},
+		},
+		{
+			"[   4286",
+			LogLine{Message: "[   4286", Continuation: true},
+		},
+	}
+
+	for _, tt := range tests {
+		if got := ParseLogLine(tt.line); got != tt.want {
+			t.Errorf("ParseLogLine(%q) = %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestLogLine_String(t *testing.T) {
+	line := LogLine{Uptime: 4285736 * time.Millisecond, Subsystem: "TT", Message: "ttvn 12"}
+	if got, want := line.String(), "[   4285736] TT: ttvn 12"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestScanLogLines(t *testing.T) {
+	var got []LogLine
+	if err := scanLogLines(strings.NewReader(cannedMeshLog), func(l LogLine) { got = append(got, l) }); err != nil {
+		t.Fatalf("scanLogLines() error = %v", err)
+	}
+
+	if len(got) != 5 {
+		t.Fatalf("scanLogLines() read %d lines, want 5: %+v", len(got), got)
+	}
+	if !got[2].Continuation || !got[4].Continuation {
+		t.Errorf("wrapped and partial lines not marked as continuations: %+v", got)
+	}
+	if got[3].Subsystem != "DAT" {
+		t.Errorf("Subsystem = %q, want DAT", got[3].Subsystem)
+	}
+}
+
+func TestScanLogLines_LongLine(t *testing.T) {
+	long := "[1] " + strings.Repeat("x", 2*maxMeshLogLine) + "\n[2] next\n"
+
+	var got []LogLine
+	_ = scanLogLines(strings.NewReader(long), func(l LogLine) { got = append(got, l) })
+
+	if len(got) != 2 || len(got[0].Message) > maxMeshLogLine || got[1].Message != "next" {
+		t.Errorf("scanLogLines() = %d lines, first %d bytes", len(got), len(got[0].Message))
+	}
+}
+
+func TestLogRing(t *testing.T) {
+	ring := NewLogRing(3)
+	_ = scanLogLines(strings.NewReader(cannedMeshLog), ring.Add)
+
+	got := ring.Lines()
+	if len(got) != 3 {
+		t.Fatalf("Lines() = %d entries, want 3: %+v", len(got), got)
+	}
+	if !strings.HasSuffix(got[1].Message, "seqno 4711, tq 255)") {
+		t.Errorf("wrapped line not merged: %q", got[1].Message)
+	}
+	if got[2].Subsystem != "DAT" || !strings.HasSuffix(got[2].Message, "(vid: -1) [   4286") {
+		t.Errorf("partial line not merged into the previous entry: %+v", got[2])
+	}
+
+	// Oldest entries are dropped in order
+	for i := range 5 {
+		ring.Add(LogLine{Uptime: time.Duration(i) * time.Millisecond, Message: "m"})
+	}
+	got = ring.Lines()
+	for i, line := range got {
+		if want := time.Duration(i+2) * time.Millisecond; line.Uptime != want {
+			t.Errorf("Lines()[%d].Uptime = %v, want %v", i, line.Uptime, want)
+		}
+	}
+}
+
+func TestLogRing_LeadingContinuation(t *testing.T) {
+	ring := NewLogRing(2)
+	ring.Add(LogLine{Message: "tail of an entry read before", Continuation: true})
+
+	if got := ring.Lines(); len(got) != 1 || got[0].Continuation {
+		t.Errorf("Lines() = %+v, want one entry", got)
+	}
+}
+
+// fakeMeshLog replaces the debugfs check and batctl for a test. Each run of batctl
+// writes output and exits with err.
+func fakeMeshLog(t *testing.T, exists bool, output string, err error) *atomic.Int32 {
+	t.Helper()
+
+	var runs atomic.Int32
+	oldStat, oldStart := statMeshLog, startMeshLog
+	t.Cleanup(func() { statMeshLog, startMeshLog = oldStat, oldStart })
+
+	statMeshLog = func(string) error {
+		if !exists {
+			return fs.ErrNotExist
+		}
+		return nil
+	}
+	startMeshLog = func(context.Context, string) (io.Reader, func() error, error) {
+		runs.Add(1)
+		return strings.NewReader(output), func() error { return err }, nil
+	}
+
+	return &runs
+}
+
+func TestStreamMeshLog_Unsupported(t *testing.T) {
+	fakeMeshLog(t, false, "", nil)
+
+	if _, err := StreamMeshLog(context.Background(), "bat0"); !errors.Is(err, ErrMeshLogUnsupported) {
+		t.Errorf("StreamMeshLog() error = %v, want ErrMeshLogUnsupported", err)
+	}
+}
+
+func TestStreamMeshLog_UnsupportedByBatctl(t *testing.T) {
+	runs := fakeMeshLog(t, true, "", errors.New("batctl log: exit status 1: Error - can't open file '/sys/kernel/debug/batman_adv/bat0/log'"))
+
+	lines, err := StreamMeshLog(context.Background(), "bat0")
+	if err != nil {
+		t.Fatalf("StreamMeshLog() error = %v", err)
+	}
+
+	select {
+	case _, ok := <-lines:
+		if ok {
+			t.Error("received a line, want the channel closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("channel not closed after batctl reported the log unsupported")
+	}
+	if runs.Load() != 1 {
+		t.Errorf("batctl ran %d times, want 1", runs.Load())
+	}
+}
+
+func TestStreamMeshLog_Restarts(t *testing.T) {
+	runs := fakeMeshLog(t, true, "[1] TT: first\n[2] TT: second\n", nil)
+	SetMeshLogRetention(10)
+	t.Cleanup(func() { SetMeshLogRetention(DefaultMeshLogRetention) })
+
+	ctx, cancel := context.WithTimeout(context.Background(), meshLogRestartMin+500*time.Millisecond)
+	defer cancel()
+
+	lines, err := StreamMeshLog(ctx, "bat0")
+	if err != nil {
+		t.Fatalf("StreamMeshLog() error = %v", err)
+	}
+
+	var got []LogLine
+	for line := range lines {
+		got = append(got, line)
+	}
+
+	if runs.Load() != 2 {
+		t.Errorf("batctl ran %d times, want 2", runs.Load())
+	}
+	if len(got) != 4 || got[0].Subsystem != "TT" || got[0].Received.IsZero() {
+		t.Errorf("received %+v, want 4 TT lines", got)
+	}
+	if recent := GetRecentMeshLog(); len(recent) != 4 {
+		t.Errorf("GetRecentMeshLog() = %d entries, want 4", len(recent))
+	}
+}
@@ -0,0 +1,71 @@
+package batmanadv
+
+import (
+	"encoding/json"
+)
+
+// Originator is one entry of the batman-adv originator table.
+type Originator struct {
+	OrigAddress   string `json:"orig_address"`
+	NeighAddress  string `json:"neigh_address"`
+	HardIfindex   int    `json:"hard_ifindex"`
+	HardIfname    string `json:"hard_ifname"`
+	LastSeenMsecs int    `json:"last_seen_msecs"`
+	Throughput    int    `json:"throughput"`
+	TQ            int    `json:"tq"`
+	Best          bool   `json:"best"`
+}
+
+type Originators []Originator
+
+// Neighbor is one entry of the batman-adv single hop neighbor table.
+type Neighbor struct {
+	NeighAddress  string `json:"neigh_address"`
+	HardIfindex   int    `json:"hard_ifindex"`
+	HardIfname    string `json:"hard_ifname"`
+	LastSeenMsecs int    `json:"last_seen_msecs"`
+	Throughput    int    `json:"throughput"`
+}
+
+type Neighbors []Neighbor
+
+// GetMeshOriginators returns the originator table from batctl oj
+func GetMeshOriginators(iface string) (*Originators, error) {
+	return GetMeshOriginatorsWithRunner(NewBatctlRunner(), iface)
+}
+
+// GetMeshOriginatorsWithRunner returns the originator table using the provided runner.
+func GetMeshOriginatorsWithRunner(runner Runner, iface string) (*Originators, error) {
+	output, err := runner.Run("oj")
+	if err != nil {
+		return nil, err
+	}
+
+	var originators Originators
+	if err := json.Unmarshal(output, &originators); err != nil {
+		return nil, err
+	}
+
+	return &originators, nil
+}
+
+// GetMeshNeighbors returns the single hop neighbor table from batctl nj
+func GetMeshNeighbors(iface string) (*Neighbors, error) {
+	return GetMeshNeighborsWithRunner(NewBatctlRunner(), iface)
+}
+
+// GetMeshNeighborsWithRunner returns the single hop neighbor table using the provided
+// runner.
+func GetMeshNeighborsWithRunner(runner Runner, iface string) (*Neighbors, error) {
+	output, err := runner.Run("nj")
+	if err != nil {
+		return nil, err
+	}
+
+	var neighbors Neighbors
+	if err := json.Unmarshal(output, &neighbors); err != nil {
+		return nil, err
+	}
+
+	return &neighbors, nil
+}
@@ -0,0 +1,73 @@
+package batmanadv
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Runner runs batctl. It is an interface so tests can supply canned output and
+// check the commands issued.
+type Runner interface {
+	// Run runs batctl with args and returns its standard output.
+	Run(args ...string) ([]byte, error)
+}
+
+// ContextRunner is a Runner whose runs can be cancelled, so that a batctl hanging on
+// a wedged kernel module does not hold up a shutdown.
+type ContextRunner interface {
+	Runner
+	// RunContext runs batctl with args, killing it when ctx is done.
+	RunContext(ctx context.Context, args ...string) ([]byte, error)
+}
+
+// runContext runs batctl through runner, cancelled by ctx if runner supports it. A
+// runner that does not is only kept from starting once ctx is done.
+func runContext(ctx context.Context, runner Runner, args ...string) ([]byte, error) {
+	if r, ok := runner.(ContextRunner); ok {
+		return r.RunContext(ctx, args...)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return runner.Run(args...)
+}
+
+// BatctlRunner runs the batctl binary.
+type BatctlRunner struct {
+	// Path is the batctl binary to run; empty runs the batctl found in PATH.
+	Path string
+}
+
+// NewBatctlRunner creates a runner for the batctl binary.
+func NewBatctlRunner() *BatctlRunner {
+	return &BatctlRunner{}
+}
+
+// Run runs batctl with args. The error includes what batctl wrote to stderr.
+func (r *BatctlRunner) Run(args ...string) ([]byte, error) {
+	return r.RunContext(context.Background(), args...)
+}
+
+// RunContext runs batctl with args, killing it when ctx is done. The error includes
+// what batctl wrote to stderr, or the error of ctx if it was killed.
+func (r *BatctlRunner) RunContext(ctx context.Context, args ...string) ([]byte, error) {
+	path := r.Path
+	if path == "" {
+		path = "batctl"
+	}
+
+	output, err := exec.CommandContext(ctx, path, args...).Output()
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, fmt.Errorf("batctl %s: %w", strings.Join(args, " "), ctxErr)
+		}
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("batctl %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("batctl %s: %w", strings.Join(args, " "), err)
+	}
+
+	return output, nil
+}
@@ -0,0 +1,245 @@
+package batmanadv
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// TopologyNode is a node of the mesh topology graph, identified by its originator
+// address.
+type TopologyNode struct {
+	Originator string `json:"originator"`
+	// NextHop is the neighbor the local node routes to the originator through; empty
+	// for the local node and for nodes only known from peer summaries.
+	NextHop string `json:"nextHop,omitempty"`
+	// Hostname is empty unless the node could be matched to a node record.
+	Hostname string `json:"hostname,omitempty"`
+	Local    bool   `json:"local,omitempty"`
+}
+
+// TopologyEdge is a link from a node to one of its direct neighbors, as reported
+// by From. Link quality is directional, so both ends may report the same pair.
+type TopologyEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	// TQ and Throughput are the link quality; BATMAN_IV reports TQ and BATMAN_V
+	// throughput, so one of them is 0.
+	TQ            int `json:"tq,omitempty"`
+	Throughput    int `json:"throughput,omitempty"`
+	LastSeenMsecs int `json:"lastSeenMsecs"`
+}
+
+// Topology is the mesh as seen from the local node: the originators it knows and
+// the links between direct neighbors. Nodes are sorted by originator and edges by
+// their ends.
+type Topology struct {
+	// Self is the originator address of the local node.
+	Self  string         `json:"self"`
+	Nodes []TopologyNode `json:"nodes"`
+	Edges []TopologyEdge `json:"edges"`
+}
+
+// AssembleTopology builds the topology graph of the local node self from its
+// originator and neighbor tables. Every originator becomes a node with its best next
+// hop, and every direct neighbor an edge from self.
+func AssembleTopology(self string, originators Originators, neighbors Neighbors) *Topology {
+	topo := &Topology{Self: self, Nodes: []TopologyNode{}, Edges: []TopologyEdge{}}
+	topo.addNode(TopologyNode{Originator: self, Local: true})
+
+	// TQ towards a neighbor is the originator entry that routes through itself
+	direct := make(map[string]Originator)
+	for _, o := range originators {
+		if o.OrigAddress == o.NeighAddress {
+			direct[o.OrigAddress] = o
+		}
+
+		node := TopologyNode{Originator: o.OrigAddress}
+		if o.Best {
+			node.NextHop = o.NeighAddress
+		}
+		topo.addNode(node)
+	}
+
+	for _, n := range neighbors {
+		edge := TopologyEdge{
+			From:          self,
+			To:            n.NeighAddress,
+			TQ:            direct[n.NeighAddress].TQ,
+			Throughput:    n.Throughput,
+			LastSeenMsecs: n.LastSeenMsecs,
+		}
+		topo.addNode(TopologyNode{Originator: n.NeighAddress})
+		topo.addEdge(edge)
+	}
+
+	topo.sort()
+	return topo
+}
+
+// AddLinks merges the direct neighbors reported by the node source, replacing what
+// it reported before. Links reported for the local node are ignored, its own tables
+// are authoritative.
+func (t *Topology) AddLinks(source string, links []TopologyEdge) {
+	if source == "" || source == t.Self {
+		return
+	}
+
+	t.Edges = slices.DeleteFunc(t.Edges, func(e TopologyEdge) bool { return e.From == source })
+
+	t.addNode(TopologyNode{Originator: source})
+	for _, link := range links {
+		if link.To == "" || link.To == source {
+			continue
+		}
+		link.From = source
+		t.addNode(TopologyNode{Originator: link.To})
+		t.addEdge(link)
+	}
+
+	t.sort()
+}
+
+// LocalLinks returns the edges reported by the local node.
+func (t *Topology) LocalLinks() []TopologyEdge {
+	var links []TopologyEdge
+	for _, e := range t.Edges {
+		if e.From == t.Self {
+			links = append(links, e)
+		}
+	}
+	return links
+}
+
+// SetHostnames names the nodes found in hostnames, keyed by originator address.
+func (t *Topology) SetHostnames(hostnames map[string]string) {
+	for i := range t.Nodes {
+		if name, ok := hostnames[t.Nodes[i].Originator]; ok && name != "" {
+			t.Nodes[i].Hostname = name
+		}
+	}
+}
+
+// addNode adds n unless a node with the same originator exists, in which case
+// the fields it leaves empty are filled in.
+func (t *Topology) addNode(n TopologyNode) {
+	i := slices.IndexFunc(t.Nodes, func(existing TopologyNode) bool { return existing.Originator == n.Originator })
+	if i < 0 {
+		t.Nodes = append(t.Nodes, n)
+		return
+	}
+
+	existing := &t.Nodes[i]
+	if existing.NextHop == "" {
+		existing.NextHop = n.NextHop
+	}
+	if existing.Hostname == "" {
+		existing.Hostname = n.Hostname
+	}
+	existing.Local = existing.Local || n.Local
+}
+
+// addEdge adds e. Of two edges with the same ends the one seen more recently is
+// kept, as when a neighbor is heard on several interfaces.
+func (t *Topology) addEdge(e TopologyEdge) {
+	i := slices.IndexFunc(t.Edges, func(existing TopologyEdge) bool { return existing.From == e.From && existing.To == e.To })
+	switch {
+	case i < 0:
+		t.Edges = append(t.Edges, e)
+	case e.LastSeenMsecs < t.Edges[i].LastSeenMsecs:
+		t.Edges[i] = e
+	}
+}
+
+func (t *Topology) sort() {
+	slices.SortFunc(t.Nodes, func(a, b TopologyNode) int { return strings.Compare(a.Originator, b.Originator) })
+	slices.SortFunc(t.Edges, func(a, b TopologyEdge) int {
+		if c := strings.Compare(a.From, b.From); c != 0 {
+			return c
+		}
+		return strings.Compare(a.To, b.To)
+	})
+}
+
+// WriteJSON writes the topology as indented JSON.
+func (t *Topology) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(t)
+}
+
+// WriteDOT writes the topology as a graphviz digraph. Nodes are labelled with their
+// hostname when known, the local node is drawn as a double circle and edges are
+// labelled with their link quality.
+func (t *Topology) WriteDOT(w io.Writer) error {
+	var b strings.Builder
+
+	b.WriteString("digraph mesh {\n")
+	for _, n := range t.Nodes {
+		label := n.Originator
+		if n.Hostname != "" {
+			label = n.Hostname + "\n" + n.Originator
+		}
+		attrs := fmt.Sprintf("label=%q", label)
+		if n.Local {
+			attrs += ", shape=doublecircle"
+		}
+		fmt.Fprintf(&b, "\t%q [%s];\n", n.Originator, attrs)
+	}
+	for _, e := range t.Edges {
+		var quality []string
+		if e.TQ > 0 {
+			quality = append(quality, fmt.Sprintf("tq %d", e.TQ))
+		}
+		if e.Throughput > 0 {
+			quality = append(quality, fmt.Sprintf("throughput %d", e.Throughput))
+		}
+		fmt.Fprintf(&b, "\t%q -> %q [label=%q];\n", e.From, e.To, strings.Join(quality, ", "))
+	}
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// BuildTopology reads the mesh configuration, originator and neighbor tables of
+// meshIface and assembles the topology graph of the local node.
+//
+// Parameters:
+//   - meshIface: The batman-adv mesh interface, e.g. "bat0"
+//
+// Returns:
+//   - The topology graph, without peer links or hostnames
+//   - An error if any of the tables cannot be read
+//
+// Example:
+//
+//	topo, err := BuildTopology("bat0")
+//	if err == nil {
+//	    topo.WriteDOT(os.Stdout)
+//	}
+func BuildTopology(meshIface string) (*Topology, error) {
+	return BuildTopologyWithRunner(NewBatctlRunner(), meshIface)
+}
+
+// BuildTopologyWithRunner assembles the topology graph using the provided runner.
+func BuildTopologyWithRunner(runner Runner, meshIface string) (*Topology, error) {
+	config, err := GetMeshConfigWithRunner(runner, meshIface)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mesh configuration: %w", err)
+	}
+
+	originators, err := GetMeshOriginatorsWithRunner(runner, meshIface)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read originators: %w", err)
+	}
+
+	neighbors, err := GetMeshNeighborsWithRunner(runner, meshIface)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read neighbors: %w", err)
+	}
+
+	return AssembleTopology(config.HardAddress, *originators, *neighbors), nil
+}
@@ -0,0 +1,168 @@
+package batmanadv
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+const (
+	topologySelf = "aa:00:00:00:00:01"
+
+	topologyMeshConfig = `{"mesh_ifname": "bat0", "hard_ifname": "wlan0", "hard_address": "aa:00:00:00:00:01", "algo_name": "BATMAN_IV"}`
+
+	// 02 and 03 are direct neighbors, 04 is reached through 03; 02 is heard on two
+	// interfaces
+	topologyOriginators = `[
+  {"orig_address": "aa:00:00:00:00:02", "neigh_address": "aa:00:00:00:00:02", "hard_ifname": "wlan0", "last_seen_msecs": 300, "tq": 220, "best": true},
+  {"orig_address": "aa:00:00:00:00:03", "neigh_address": "aa:00:00:00:00:03", "hard_ifname": "wlan0", "last_seen_msecs": 500, "tq": 180, "best": true},
+  {"orig_address": "aa:00:00:00:00:04", "neigh_address": "aa:00:00:00:00:03", "hard_ifname": "wlan0", "last_seen_msecs": 900, "tq": 150, "best": true},
+  {"orig_address": "aa:00:00:00:00:04", "neigh_address": "aa:00:00:00:00:02", "hard_ifname": "wlan0", "last_seen_msecs": 900, "tq": 90, "best": false}
+]`
+
+	topologyNeighbors = `[
+  {"neigh_address": "aa:00:00:00:00:02", "hard_ifname": "wlan0", "last_seen_msecs": 300},
+  {"neigh_address": "aa:00:00:00:00:02", "hard_ifname": "mesh1", "last_seen_msecs": 4000},
+  {"neigh_address": "aa:00:00:00:00:03", "hard_ifname": "wlan0", "last_seen_msecs": 500}
+]`
+)
+
+// testTopology returns the graph of the canned local tables merged with the
+// summaries of 03 and 04, as a node would assemble it.
+func testTopology(t *testing.T) *Topology {
+	t.Helper()
+
+	runner := &fakeRunner{outputs: map[string]string{"mj": topologyMeshConfig, "oj": topologyOriginators, "nj": topologyNeighbors}}
+	topo, err := BuildTopologyWithRunner(runner, "bat0")
+	if err != nil {
+		t.Fatalf("BuildTopologyWithRunner() error = %v", err)
+	}
+
+	topo.AddLinks("aa:00:00:00:00:03", []TopologyEdge{
+		{To: "aa:00:00:00:00:01", TQ: 200, LastSeenMsecs: 400},
+		{To: "aa:00:00:00:00:04", TQ: 240, LastSeenMsecs: 200},
+	})
+	// 05 is beyond the local node's originator table
+	topo.AddLinks("aa:00:00:00:00:04", []TopologyEdge{
+		{To: "aa:00:00:00:00:03", TQ: 235, LastSeenMsecs: 100},
+		{To: "aa:00:00:00:00:05", TQ: 160, LastSeenMsecs: 700},
+	})
+	// A peer cannot speak for the local node
+	topo.AddLinks(topologySelf, []TopologyEdge{{To: "aa:00:00:00:00:09", TQ: 1}})
+
+	topo.SetHostnames(map[string]string{topologySelf: "alpha", "aa:00:00:00:00:03": "charlie"})
+
+	return topo
+}
+
+func TestBuildTopology_Local(t *testing.T) {
+	runner := &fakeRunner{outputs: map[string]string{"mj": topologyMeshConfig, "oj": topologyOriginators, "nj": topologyNeighbors}}
+
+	topo, err := BuildTopologyWithRunner(runner, "bat0")
+	if err != nil {
+		t.Fatalf("BuildTopologyWithRunner() error = %v", err)
+	}
+
+	wantNodes := []TopologyNode{
+		{Originator: topologySelf, Local: true},
+		{Originator: "aa:00:00:00:00:02", NextHop: "aa:00:00:00:00:02"},
+		{Originator: "aa:00:00:00:00:03", NextHop: "aa:00:00:00:00:03"},
+		{Originator: "aa:00:00:00:00:04", NextHop: "aa:00:00:00:00:03"},
+	}
+	if !reflect.DeepEqual(topo.Nodes, wantNodes) {
+		t.Errorf("Nodes = %+v, want %+v", topo.Nodes, wantNodes)
+	}
+
+	// The neighbor heard on two interfaces keeps the fresher link
+	wantEdges := []TopologyEdge{
+		{From: topologySelf, To: "aa:00:00:00:00:02", TQ: 220, LastSeenMsecs: 300},
+		{From: topologySelf, To: "aa:00:00:00:00:03", TQ: 180, LastSeenMsecs: 500},
+	}
+	if !reflect.DeepEqual(topo.Edges, wantEdges) {
+		t.Errorf("Edges = %+v, want %+v", topo.Edges, wantEdges)
+	}
+}
+
+func TestBuildTopology_TableError(t *testing.T) {
+	runner := &fakeRunner{
+		outputs: map[string]string{"mj": topologyMeshConfig, "oj": topologyOriginators},
+		errs:    map[string]error{"nj": os.ErrNotExist},
+	}
+
+	if _, err := BuildTopologyWithRunner(runner, "bat0"); err == nil {
+		t.Fatal("BuildTopologyWithRunner() error = nil with the neighbor table unreadable")
+	}
+}
+
+func TestTopology_AddLinks(t *testing.T) {
+	topo := testTopology(t)
+
+	wantEdges := []TopologyEdge{
+		{From: topologySelf, To: "aa:00:00:00:00:02", TQ: 220, LastSeenMsecs: 300},
+		{From: topologySelf, To: "aa:00:00:00:00:03", TQ: 180, LastSeenMsecs: 500},
+		{From: "aa:00:00:00:00:03", To: topologySelf, TQ: 200, LastSeenMsecs: 400},
+		{From: "aa:00:00:00:00:03", To: "aa:00:00:00:00:04", TQ: 240, LastSeenMsecs: 200},
+		{From: "aa:00:00:00:00:04", To: "aa:00:00:00:00:03", TQ: 235, LastSeenMsecs: 100},
+		{From: "aa:00:00:00:00:04", To: "aa:00:00:00:00:05", TQ: 160, LastSeenMsecs: 700},
+	}
+	if !reflect.DeepEqual(topo.Edges, wantEdges) {
+		t.Errorf("Edges = %+v, want %+v", topo.Edges, wantEdges)
+	}
+
+	// A newer summary replaces the links reported before
+	topo.AddLinks("aa:00:00:00:00:04", []TopologyEdge{{To: "aa:00:00:00:00:03", TQ: 210, LastSeenMsecs: 50}})
+	if got := len(topo.Edges); got != 5 {
+		t.Errorf("len(Edges) = %d after 04 dropped a link, want 5", got)
+	}
+
+	var unknown TopologyNode
+	for _, n := range topo.Nodes {
+		if n.Originator == "aa:00:00:00:00:05" {
+			unknown = n
+		}
+	}
+	if unknown.Originator == "" || unknown.NextHop != "" {
+		t.Errorf("node only known from a summary = %+v, want listed without a next hop", unknown)
+	}
+}
+
+func TestTopology_Exporters(t *testing.T) {
+	topo := testTopology(t)
+
+	tests := []struct {
+		golden string
+		write  func(*bytes.Buffer) error
+	}{
+		{"topology.json", func(b *bytes.Buffer) error { return topo.WriteJSON(b) }},
+		{"topology.dot", func(b *bytes.Buffer) error { return topo.WriteDOT(b) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			var got bytes.Buffer
+			if err := tt.write(&got); err != nil {
+				t.Fatalf("write error = %v", err)
+			}
+
+			path := filepath.Join("testdata", tt.golden)
+			if *updateGolden {
+				if err := os.WriteFile(path, got.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got.Bytes(), want) {
+				t.Errorf("output differs from %s:\n%s", path, got.String())
+			}
+		})
+	}
+}
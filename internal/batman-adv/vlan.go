@@ -0,0 +1,238 @@
+package batmanadv
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/openmanet/openmanetd/internal/safemode"
+)
+
+// MeshVLANConfig is the batman-adv configuration of one VLAN on a mesh interface.
+type MeshVLANConfig struct {
+	VID         int  `json:"vid"`
+	APIsolation bool `json:"ap_isolation"`
+}
+
+// vlanArgs returns the batctl arguments that scope a command to one VLAN.
+func vlanArgs(meshIface string, vid int, args ...string) []string {
+	return append([]string{"meshif", meshIface, "vid", strconv.Itoa(vid)}, args...)
+}
+
+// validVID reports whether vid is a VLAN id batman-adv accepts.
+func validVID(vid int) bool {
+	return vid >= 0 && vid < 4095
+}
+
+// ListMeshVLANs returns the VLAN ids in use on a mesh interface, in ascending order.
+//
+// Parameters:
+//   - meshIface: The batman-adv mesh interface, e.g. "bat0"
+//
+// Returns:
+//   - The VLAN ids, excluding untagged traffic
+//   - An error if batctl fails
+//
+// Example:
+//
+//	vids, err := ListMeshVLANs("bat0")
+//	if err != nil {
+//	    log.Printf("Failed to list VLANs: %v", err)
+//	}
+func ListMeshVLANs(meshIface string) ([]int, error) {
+	return ListMeshVLANsWithRunner(NewBatctlRunner(), meshIface)
+}
+
+// ListMeshVLANsWithRunner returns the VLAN ids in use on a mesh interface using the
+// provided runner.
+//
+// batman-adv announces the MAC of the mesh interface on every VLAN created on top of
+// it, so each VLAN appears in the local translation table even without clients.
+func ListMeshVLANsWithRunner(runner Runner, meshIface string) ([]int, error) {
+	output, err := runner.Run("meshif", meshIface, "transtable_local")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read translation table of %s: %w", meshIface, err)
+	}
+
+	return parseTranstableVIDs(output)
+}
+
+// parseTranstableVIDs returns the distinct VLAN ids of a batctl transtable_local
+// listing. Untagged entries have VID -1 and are skipped.
+func parseTranstableVIDs(output []byte) ([]int, error) {
+	seen := make(map[int]bool)
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		// Entries start with a MAC, optionally preceded by the "*" of the best
+		// entry; the header lines do not
+		if len(fields) > 0 && fields[0] == "*" {
+			fields = fields[1:]
+		}
+		if len(fields) < 2 || strings.Count(fields[0], ":") != 5 {
+			continue
+		}
+
+		vid, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid VID %q in translation table", fields[1])
+		}
+		if vid >= 0 {
+			seen[vid] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	vids := make([]int, 0, len(seen))
+	for vid := range seen {
+		vids = append(vids, vid)
+	}
+	sort.Ints(vids)
+
+	return vids, nil
+}
+
+// GetMeshVLANConfig returns the configuration of one VLAN on a mesh interface.
+//
+// Parameters:
+//   - meshIface: The batman-adv mesh interface, e.g. "bat0"
+//   - vid: The VLAN id, e.g. 100 for bat0.100
+//
+// Returns:
+//   - The VLAN configuration
+//   - An error if the VLAN id is invalid or batctl fails
+//
+// Example:
+//
+//	cfg, err := GetMeshVLANConfig("bat0", 100)
+//	if err == nil && !cfg.APIsolation {
+//	    log.Printf("Guest VLAN is not isolated")
+//	}
+func GetMeshVLANConfig(meshIface string, vid int) (*MeshVLANConfig, error) {
+	return GetMeshVLANConfigWithRunner(NewBatctlRunner(), meshIface, vid)
+}
+
+// GetMeshVLANConfigWithRunner returns the configuration of one VLAN on a mesh
+// interface using the provided runner.
+func GetMeshVLANConfigWithRunner(runner Runner, meshIface string, vid int) (*MeshVLANConfig, error) {
+	if !validVID(vid) {
+		return nil, fmt.Errorf("invalid VLAN id %d", vid)
+	}
+
+	output, err := runner.Run(vlanArgs(meshIface, vid, "ap_isolation")...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ap_isolation of %s VLAN %d: %w", meshIface, vid, err)
+	}
+
+	apIsolation, err := parseBatctlBool(output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ap_isolation of %s VLAN %d: %w", meshIface, vid, err)
+	}
+
+	return &MeshVLANConfig{VID: vid, APIsolation: apIsolation}, nil
+}
+
+// parseBatctlBool parses the value batctl prints for a boolean setting.
+func parseBatctlBool(output []byte) (bool, error) {
+	switch value := strings.TrimSpace(string(output)); value {
+	case "enabled", "1":
+		return true, nil
+	case "disabled", "0":
+		return false, nil
+	default:
+		return false, fmt.Errorf("unexpected value %q", value)
+	}
+}
+
+// SetVLANAPIsolation enables or disables AP isolation on one VLAN of a mesh interface.
+//
+// Parameters:
+//   - meshIface: The batman-adv mesh interface, e.g. "bat0"
+//   - vid: The VLAN id, e.g. 100 for bat0.100
+//   - enabled: Whether clients on the VLAN may only talk to the mesh, not to each other
+//
+// Returns:
+//   - An error if the VLAN id is invalid, safe mode is active or batctl fails
+//
+// Example:
+//
+//	if err := SetVLANAPIsolation("bat0", 100, true); err != nil {
+//	    log.Printf("Failed to isolate guest VLAN: %v", err)
+//	}
+func SetVLANAPIsolation(meshIface string, vid int, enabled bool) error {
+	return SetVLANAPIsolationWithRunner(NewBatctlRunner(), meshIface, vid, enabled)
+}
+
+// SetVLANAPIsolationWithRunner enables or disables AP isolation on one VLAN of a
+// mesh interface using the provided runner.
+func SetVLANAPIsolationWithRunner(runner Runner, meshIface string, vid int, enabled bool) error {
+	if !validVID(vid) {
+		return fmt.Errorf("invalid VLAN id %d", vid)
+	}
+
+	if err := safemode.Check(fmt.Sprintf("set ap_isolation of %s VLAN %d", meshIface, vid)); err != nil {
+		return err
+	}
+
+	value := "0"
+	if enabled {
+		value = "1"
+	}
+
+	if _, err := runner.Run(vlanArgs(meshIface, vid, "ap_isolation", value)...); err != nil {
+		return fmt.Errorf("failed to set ap_isolation of %s VLAN %d: %w", meshIface, vid, err)
+	}
+
+	return nil
+}
+
+// ReconcileVLANs brings the VLANs of a mesh interface to the desired configuration.
+// Only settings that differ are written. A VLAN that cannot be read or written does
+// not stop the others from being reconciled.
+//
+// Parameters:
+//   - meshIface: The batman-adv mesh interface, e.g. "bat0"
+//   - desired: The desired configuration of each VLAN
+//
+// Returns:
+//   - The errors of all VLANs that could not be reconciled, joined
+//
+// Example:
+//
+//	err := ReconcileVLANs("bat0", []MeshVLANConfig{{VID: 100, APIsolation: true}})
+//	if err != nil {
+//	    log.Printf("Failed to reconcile VLANs: %v", err)
+//	}
+func ReconcileVLANs(meshIface string, desired []MeshVLANConfig) error {
+	return ReconcileVLANsWithRunner(NewBatctlRunner(), meshIface, desired)
+}
+
+// ReconcileVLANsWithRunner brings the VLANs of a mesh interface to the desired
+// configuration using the provided runner.
+func ReconcileVLANsWithRunner(runner Runner, meshIface string, desired []MeshVLANConfig) error {
+	var errs []error
+	for _, want := range desired {
+		current, err := GetMeshVLANConfigWithRunner(runner, meshIface, want.VID)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if current.APIsolation == want.APIsolation {
+			continue
+		}
+
+		if err := SetVLANAPIsolationWithRunner(runner, meshIface, want.VID, want.APIsolation); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,150 @@
+package batmanadv
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeRunner answers batctl commands from canned output and records every command.
+type fakeRunner struct {
+	outputs map[string]string
+	errs    map[string]error
+	calls   []string
+}
+
+func (r *fakeRunner) Run(args ...string) ([]byte, error) {
+	cmd := strings.Join(args, " ")
+	r.calls = append(r.calls, cmd)
+
+	if err, ok := r.errs[cmd]; ok {
+		return nil, err
+	}
+	return []byte(r.outputs[cmd]), nil
+}
+
+const transtableLocalOutput = `[B.A.T.M.A.N. adv 2023.1, MainIF/MAC: wlan0/aa:bb:cc:dd:ee:ff (bat0/02:00:00:00:00:01 BATMAN_IV), TTVN: 7]
+Client             VID Flags    Last seen (CRC       )
+* 02:00:00:00:00:01   -1 [.P....]   0.000   (0x1a2b3c4d)
+* 02:00:00:00:00:01  100 [.P....]   0.000   (0x5e6f7a8b)
+* 02:00:00:00:00:01   20 [.P....]   0.000   (0x9c0d1e2f)
+* 6e:11:22:33:44:55  100 [....W.]   1.250   (0x5e6f7a8b)
+`
+
+func TestListMeshVLANs(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		want    []int
+		wantErr bool
+	}{
+		{name: "tagged and untagged entries", output: transtableLocalOutput, want: []int{20, 100}},
+		{name: "untagged only", output: "Client VID Flags\n* 02:00:00:00:00:01 -1 [.P....] 0.000 (0x1)\n", want: []int{}},
+		{name: "empty table", output: "", want: []int{}},
+		{name: "invalid VID", output: "* 02:00:00:00:00:01 abc [.P....] 0.000 (0x1)\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := &fakeRunner{outputs: map[string]string{"meshif bat0 transtable_local": tt.output}}
+
+			got, err := ListMeshVLANsWithRunner(runner, "bat0")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ListMeshVLANsWithRunner() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ListMeshVLANsWithRunner() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetMeshVLANConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		vid     int
+		output  string
+		want    bool
+		wantErr bool
+	}{
+		{name: "enabled", vid: 100, output: "enabled\n", want: true},
+		{name: "disabled", vid: 100, output: "disabled\n", want: false},
+		{name: "numeric", vid: 100, output: "1\n", want: true},
+		{name: "unexpected output", vid: 100, output: "Error - no such VLAN\n", wantErr: true},
+		{name: "invalid VID", vid: 4095, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := &fakeRunner{outputs: map[string]string{"meshif bat0 vid 100 ap_isolation": tt.output}}
+
+			got, err := GetMeshVLANConfigWithRunner(runner, "bat0", tt.vid)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetMeshVLANConfigWithRunner() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.VID != tt.vid || got.APIsolation != tt.want {
+				t.Errorf("GetMeshVLANConfigWithRunner() = %+v, want VID %d APIsolation %v", got, tt.vid, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetVLANAPIsolation(t *testing.T) {
+	runner := &fakeRunner{}
+
+	if err := SetVLANAPIsolationWithRunner(runner, "bat0", 100, true); err != nil {
+		t.Fatalf("SetVLANAPIsolationWithRunner() error = %v", err)
+	}
+	if err := SetVLANAPIsolationWithRunner(runner, "bat0", 200, false); err != nil {
+		t.Fatalf("SetVLANAPIsolationWithRunner() error = %v", err)
+	}
+	if err := SetVLANAPIsolationWithRunner(runner, "bat0", -1, true); err == nil {
+		t.Error("SetVLANAPIsolationWithRunner() with an invalid VID succeeded")
+	}
+
+	want := []string{"meshif bat0 vid 100 ap_isolation 1", "meshif bat0 vid 200 ap_isolation 0"}
+	if !reflect.DeepEqual(runner.calls, want) {
+		t.Errorf("commands = %q, want %q", runner.calls, want)
+	}
+}
+
+func TestReconcileVLANs(t *testing.T) {
+	runner := &fakeRunner{
+		outputs: map[string]string{
+			"meshif bat0 vid 100 ap_isolation": "disabled\n",
+			"meshif bat0 vid 200 ap_isolation": "disabled\n",
+			"meshif bat0 vid 300 ap_isolation": "enabled\n",
+		},
+		errs: map[string]error{
+			"meshif bat0 vid 400 ap_isolation": errors.New("exit status 1"),
+		},
+	}
+
+	desired := []MeshVLANConfig{
+		{VID: 100, APIsolation: true},
+		{VID: 200, APIsolation: false},
+		{VID: 400, APIsolation: true},
+		{VID: 300, APIsolation: false},
+	}
+
+	err := ReconcileVLANsWithRunner(runner, "bat0", desired)
+	if err == nil || !strings.Contains(err.Error(), "VLAN 400") {
+		t.Errorf("ReconcileVLANsWithRunner() error = %v, want the VLAN 400 failure", err)
+	}
+
+	want := []string{
+		"meshif bat0 vid 100 ap_isolation",
+		"meshif bat0 vid 100 ap_isolation 1",
+		"meshif bat0 vid 200 ap_isolation",
+		"meshif bat0 vid 400 ap_isolation",
+		"meshif bat0 vid 300 ap_isolation",
+		"meshif bat0 vid 300 ap_isolation 0",
+	}
+	if !reflect.DeepEqual(runner.calls, want) {
+		t.Errorf("commands = %q, want %q", runner.calls, want)
+	}
+}
@@ -1,7 +1,10 @@
 package config
 
 import (
+	"fmt"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/viper"
@@ -14,42 +17,141 @@ const (
 	DefaultAlfredMode                  = "primary"
 	DefaultAlfredBatInterface          = "bat0"
 	DefaultAlfredSocketPath            = "/var/run/alfred.sock"
+	DefaultAlfredCallTimeout           = 5 * time.Second
 	DefaultAlfredDataTypeGateway       = true
 	DefaultAlfredDataTypeNode          = true
 	DefaultAlfredDataTypePosition      = true
 	DefaultAlfredDataTypeAddressReserv = true
+	DefaultAlfredDataTypeService       = true
+	DefaultServicesPublishDNS          = false
 	DefaultPTTEnable                   = false
 	DefaultPTTMcastAddr                = "224.0.0.1"
 	DefaultPTTMcastPort                = 5007
+	DefaultPTTMcastTTL                 = 1
 	DefaultPTTPttKey                   = "any"
 	DefaultPTTDebug                    = false
 	DefaultPTTLoopback                 = false
 	DefaultPTTPttDevice                = "/dev/hidraw0/*"
 	DefaultPTTPttDeviceName            = ""
+	DefaultPTTTxLogPath                = "/tmp/openmanet/ptt_tx.jsonl"
+	DefaultPTTTxLogMaxSize             = 1 << 20
+	DefaultPTTTxLogMaxBackups          = 3
+	DefaultPTTRecordEnable             = false
+	DefaultPTTRecordDir                = "/tmp/openmanet/recordings"
+	DefaultPTTRecordMaxTotalSize       = 64 << 20
+	DefaultCapacityWarnPct             = 80.0
+	DefaultCapacityCriticalPct         = 95.0
+	DefaultReservationPinnedIP         = ""
+	DefaultFallbackOnPinConflict       = "fail"
+	DefaultIPAllocationStrategy        = "sequential"
+	DefaultGatewayProbeEnable          = true
+	DefaultGatewayProbeProtocol        = "icmp"
+	DefaultGatewayProbePort            = 5010
+	DefaultGatewayProbeTarget          = ""
+	DefaultGatewayProbeTimeout         = 2 * time.Second
+	DefaultAddressCheckEvery           = 6
+	DefaultAddressMissThreshold        = 3
+	DefaultAddressReprovision          = false
+	DefaultPoolAutosizeEnable          = false
+	DefaultPoolAutosizeGrowAt          = 0.8
+	DefaultPoolAutosizeQuietPeriod     = 7 * 24 * time.Hour
+	DefaultPoolAutosizeFloor           = 16
+	DefaultPoolAutosizeCeiling         = 155
+	DefaultStateFile                   = "/etc/openmanet/state.json"
+	DefaultDHCPLeasesFile              = "/tmp/dhcp.leases"
+	DefaultSafeMode                    = false
+	DefaultMeshID                      = "default"
+	DefaultMeshIDStrict                = true
+	DefaultMeshIDAcceptLegacy          = true
+	DefaultUbusEnable                  = false
+	DefaultMaxRecordsPerTick           = 1000
+	DefaultAutoZone                    = ""
+	DefaultDnsmasqInstance             = ""
+	DefaultOpenServices                = false
+	DefaultGatewayMasquerade           = false
+	DefaultUplinkZone                  = "wan"
+	DefaultMeshConfigCacheTTL          = 2 * time.Second
+	DefaultGuestIsolationEnable        = false
+	DefaultGuestIsolationSection       = "guest"
+	DefaultGuestIsolationMark          = 0x10
+	DefaultGuestIsolationMask          = 0x10
+	DefaultUbusSocketPath              = "/var/run/ubus/ubus.sock"
+	DefaultLogLevel                    = "info"
+	DefaultConfigStrictKeys            = false
+	DefaultMeshHealthLiveWithin        = 10 * time.Second
+	DefaultMeshHealthSparseNeighbors   = 2
+	DefaultMeshHealthSparseOriginators = 3
+	DefaultMeshHealthSkipClaimWait     = true
+	DefaultMeshHealthShortGatewayHold  = true
+	DefaultBootstrapGracePeriod        = 60 * time.Second
+	DefaultIPAllocationMode            = "distributed"
+	DefaultDelegationFallbackTimeout   = 90 * time.Second
+	DefaultMeshLogEnable               = false
+	DefaultMeshLogRetention            = 500
+	DefaultTopologyPublish             = false
+	DefaultMeshSubnet                  = "10.41.0.0/16"
+	DefaultSourceRoutingPriority       = 10000
 )
 
+// DefaultMeshExcludedRanges are the ranges of the default mesh subnet that are never
+// handed out as static addresses.
+var DefaultMeshExcludedRanges = []string{"10.41.253.0/24", "10.41.254.0/24"}
+
+// StaticRoute is an entry of the staticRoutes list. It is validated when it is
+// turned into a kernel route, not when the config is loaded.
+type StaticRoute struct {
+	Destination string `mapstructure:"destination"`
+	Gateway     string `mapstructure:"gateway"`
+	Interface   string `mapstructure:"interface"`
+	Metric      int    `mapstructure:"metric"`
+	Table       int    `mapstructure:"table"`
+}
+
+// SourceRoutingUplink is an entry of the sourceRouting.uplinks list, an uplink of a
+// gateway and the mesh traffic sent out through it. A table of 0 is registered under
+// the name openmanet-<name> in rt_tables. It is validated when the source routing is
+// applied, not when the config is loaded.
+type SourceRoutingUplink struct {
+	Name      string   `mapstructure:"name"`
+	Interface string   `mapstructure:"interface"`
+	Gateway   string   `mapstructure:"gateway"`
+	Table     int      `mapstructure:"table"`
+	Sources   []string `mapstructure:"sources"`
+}
+
+// Service is an entry of the services.announce list, a service this node announces
+// to the mesh. It is validated when the announcement is built, not when the config
+// is loaded.
+type Service struct {
+	Name        string        `mapstructure:"name"`
+	Proto       string        `mapstructure:"proto"`
+	Port        int           `mapstructure:"port"`
+	Address     string        `mapstructure:"address"`
+	Description string        `mapstructure:"description"`
+	TTL         time.Duration `mapstructure:"ttl"`
+}
+
+// MeshVLAN is an entry of the mesh.vlans list, the desired batman-adv settings of
+// one VLAN on the mesh interface.
+type MeshVLAN struct {
+	VID         int  `mapstructure:"vid"`
+	APIsolation bool `mapstructure:"apIsolation"`
+}
+
 // Config holds the application configuration values with automatic reloading support.
+// Every key is declared in the registry; the getters return the loaded values.
 type Config struct {
-	mu                          sync.RWMutex
-	v                           *viper.Viper
-	MeshNetInterface            string
-	GatewayMode                 bool
-	AlfredMode                  string
-	AlfredBatInterface          string
-	AlfredSocketPath            string
-	AlfredDataTypeGateway       bool
-	AlfredDataTypeNode          bool
-	AlfredDataTypePosition      bool
-	AlfredDataTypeAddressReserv bool
-	PTTEnable                   bool
-	PTTMcastAddr                string
-	PTTMcastPort                int
-	PTTPttKey                   string
-	PTTDebug                    bool
-	PTTLoopback                 bool
-	PTTPttDevice                string
-	PTTPttDeviceName            string
-	onChangeCallbacks           []func(*Config)
+	mu sync.RWMutex
+	v  *viper.Viper
+
+	// values holds the value of every registered key, by name.
+	values map[string]any
+	// problems are the values rejected by the last reload; unknown are the keys it
+	// found that are not registered.
+	problems []string
+	unknown  []string
+
+	onChangeCallbacks []func(*Config)
 }
 
 // New creates a new Config instance with the given viper instance.
@@ -78,116 +180,66 @@ func New(v *viper.Viper) *Config {
 	return c
 }
 
-// reload reads all configuration values from viper and updates the Config fields.
+// reload reads the value of every registered key from viper.
 func (c *Config) reload() {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	// Load mesh network configuration
-	if val := c.v.GetString("meshNetInterface"); val != "" {
-		c.MeshNetInterface = val
-	} else {
-		c.MeshNetInterface = DefaultMeshNetInterface
+	values := make(map[string]any, len(registry))
+	var problems []string
+	for _, k := range registry {
+		val, problem := k.load(c.v)
+		values[k.Name] = val
+		if problem != "" {
+			problems = append(problems, problem)
+		}
 	}
 
-	if c.v.IsSet("gatewayMode") {
-		c.GatewayMode = c.v.GetBool("gatewayMode")
-	} else {
-		c.GatewayMode = DefaultGatewayMode
+	// The pool is never grown past a ceiling below its floor
+	if floor := values["poolAutosize.floor"].(int); values["poolAutosize.ceiling"].(int) < floor {
+		if c.v.IsSet("poolAutosize.ceiling") {
+			problems = append(problems, fmt.Sprintf("poolAutosize.ceiling: %d is below the floor %d", values["poolAutosize.ceiling"], floor))
+		}
+		values["poolAutosize.ceiling"] = max(DefaultPoolAutosizeCeiling, floor)
 	}
 
-	// Load Alfred configuration
-	if val := c.v.GetString("alfred.mode"); val != "" {
-		c.AlfredMode = val
-	} else {
-		c.AlfredMode = DefaultAlfredMode
-	}
-
-	if val := c.v.GetString("alfred.batInterface"); val != "" {
-		c.AlfredBatInterface = val
-	} else {
-		c.AlfredBatInterface = DefaultAlfredBatInterface
-	}
-
-	if val := c.v.GetString("alfred.socketPath"); val != "" {
-		c.AlfredSocketPath = val
-	} else {
-		c.AlfredSocketPath = DefaultAlfredSocketPath
-	}
-
-	// Load Alfred data type configuration
-	if c.v.IsSet("alfred.dataTypes.gateway") {
-		c.AlfredDataTypeGateway = c.v.GetBool("alfred.dataTypes.gateway")
-	} else {
-		c.AlfredDataTypeGateway = DefaultAlfredDataTypeGateway
-	}
-
-	if c.v.IsSet("alfred.dataTypes.node") {
-		c.AlfredDataTypeNode = c.v.GetBool("alfred.dataTypes.node")
-	} else {
-		c.AlfredDataTypeNode = DefaultAlfredDataTypeNode
-	}
-
-	if c.v.IsSet("alfred.dataTypes.position") {
-		c.AlfredDataTypePosition = c.v.GetBool("alfred.dataTypes.position")
-	} else {
-		c.AlfredDataTypePosition = DefaultAlfredDataTypePosition
-	}
-
-	if c.v.IsSet("alfred.dataTypes.addressReservation") {
-		c.AlfredDataTypeAddressReserv = c.v.GetBool("alfred.dataTypes.addressReservation")
-	} else {
-		c.AlfredDataTypeAddressReserv = DefaultAlfredDataTypeAddressReserv
-	}
+	unknown := unknownKeys(c.v)
 
-	// Load PTT configuration
-	if c.v.IsSet("ptt.enable") {
-		c.PTTEnable = c.v.GetBool("ptt.enable")
-	} else {
-		c.PTTEnable = DefaultPTTEnable
-	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values, c.problems, c.unknown = values, problems, unknown
+}
 
-	if val := c.v.GetString("ptt.mcastAddr"); val != "" {
-		c.PTTMcastAddr = val
-	} else {
-		c.PTTMcastAddr = DefaultPTTMcastAddr
-	}
+// Validate returns the problems found by the last reload: values that were replaced
+// by their default and keys that are not registered, which are ignored. With
+// config.strictKeys set, unknown keys are returned as an error instead.
+func (c *Config) Validate() (warnings []string, err error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 
-	if val := c.v.GetInt("ptt.mcastPort"); val != 0 {
-		c.PTTMcastPort = val
-	} else {
-		c.PTTMcastPort = DefaultPTTMcastPort
+	warnings = append(warnings, c.problems...)
+	if len(c.unknown) == 0 {
+		return warnings, nil
 	}
 
-	if val := c.v.GetString("ptt.pttKey"); val != "" {
-		c.PTTPttKey = val
-	} else {
-		c.PTTPttKey = DefaultPTTPttKey
+	if c.values["config.strictKeys"].(bool) {
+		return warnings, fmt.Errorf("unknown config keys: %s", strings.Join(c.unknown, ", "))
 	}
-
-	if c.v.IsSet("ptt.debug") {
-		c.PTTDebug = c.v.GetBool("ptt.debug")
-	} else {
-		c.PTTDebug = DefaultPTTDebug
+	for _, name := range c.unknown {
+		warnings = append(warnings, fmt.Sprintf("%s: unknown key, ignored", name))
 	}
 
-	if c.v.IsSet("ptt.loopback") {
-		c.PTTLoopback = c.v.GetBool("ptt.loopback")
-	} else {
-		c.PTTLoopback = DefaultPTTLoopback
-	}
+	return warnings, nil
+}
 
-	if val := c.v.GetString("ptt.pttDevice"); val != "" {
-		c.PTTPttDevice = val
-	} else {
-		c.PTTPttDevice = DefaultPTTPttDevice
-	}
+// value returns the loaded value of the registered key name. Asking for a key that
+// is not registered is a programming error and panics.
+func value[T any](c *Config, name string) T {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 
-	if val := c.v.GetString("ptt.pttDeviceName"); val != "" {
-		c.PTTPttDeviceName = val
-	} else {
-		c.PTTPttDeviceName = DefaultPTTPttDeviceName
+	val, ok := c.values[name]
+	if !ok {
+		panic(fmt.Sprintf("config: key %q is not registered", name))
 	}
+	return val.(T)
 }
 
 // OnConfigChange registers a callback function to be called when the configuration changes.
@@ -211,119 +263,420 @@ func (c *Config) notifyCallbacks() {
 
 // GetMeshNetInterface returns the mesh network interface name.
 func (c *Config) GetMeshNetInterface() string {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	return c.MeshNetInterface
+	return value[string](c, "meshNetInterface")
 }
 
 // GetGatewayMode returns whether gateway mode is enabled.
 func (c *Config) GetGatewayMode() bool {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	return c.GatewayMode
+	return value[bool](c, "gatewayMode")
 }
 
 // GetAlfredMode returns the Alfred operating mode (primary/secondary).
 func (c *Config) GetAlfredMode() string {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	return c.AlfredMode
+	return value[string](c, "alfred.mode")
 }
 
 // GetAlfredBatInterface returns the batman-adv interface name for Alfred.
 func (c *Config) GetAlfredBatInterface() string {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	return c.AlfredBatInterface
+	return value[string](c, "alfred.batInterface")
 }
 
 // GetAlfredSocketPath returns the Alfred socket path.
 func (c *Config) GetAlfredSocketPath() string {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	return c.AlfredSocketPath
+	return value[string](c, "alfred.socketPath")
+}
+
+// GetAlfredCallTimeout returns the deadline for a single Alfred set or request call.
+func (c *Config) GetAlfredCallTimeout() time.Duration {
+	return value[time.Duration](c, "alfred.callTimeout")
 }
 
 // GetAlfredDataTypeGateway returns whether gateway data type is enabled.
 func (c *Config) GetAlfredDataTypeGateway() bool {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	return c.AlfredDataTypeGateway
+	return value[bool](c, "alfred.dataTypes.gateway")
 }
 
 // GetAlfredDataTypeNode returns whether node data type is enabled.
 func (c *Config) GetAlfredDataTypeNode() bool {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	return c.AlfredDataTypeNode
+	return value[bool](c, "alfred.dataTypes.node")
 }
 
 // GetAlfredDataTypePosition returns whether position data type is enabled.
 func (c *Config) GetAlfredDataTypePosition() bool {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	return c.AlfredDataTypePosition
+	return value[bool](c, "alfred.dataTypes.position")
 }
 
 // GetAlfredDataTypeAddressReservation returns whether address reservation data type is enabled.
 func (c *Config) GetAlfredDataTypeAddressReservation() bool {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	return c.AlfredDataTypeAddressReserv
+	return value[bool](c, "alfred.dataTypes.addressReservation")
 }
 
 // GetPTTEnable returns whether PTT (Push-to-Talk) is enabled.
 func (c *Config) GetPTTEnable() bool {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	return c.PTTEnable
+	return value[bool](c, "ptt.enable")
 }
 
 // GetPTTMcastAddr returns the PTT multicast address.
 func (c *Config) GetPTTMcastAddr() string {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	return c.PTTMcastAddr
+	return value[string](c, "ptt.mcastAddr")
 }
 
 // GetPTTMcastPort returns the PTT multicast port.
 func (c *Config) GetPTTMcastPort() int {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	return c.PTTMcastPort
+	return value[int](c, "ptt.mcastPort")
+}
+
+// GetPTTMcastTTL returns the multicast TTL of PTT audio.
+func (c *Config) GetPTTMcastTTL() int {
+	return value[int](c, "ptt.mcastTTL")
 }
 
 // GetPTTPttKey returns the PTT key configuration.
 func (c *Config) GetPTTPttKey() string {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	return c.PTTPttKey
+	return value[string](c, "ptt.pttKey")
 }
 
 // GetPTTDebug returns whether PTT debug mode is enabled.
 func (c *Config) GetPTTDebug() bool {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	return c.PTTDebug
+	return value[bool](c, "ptt.debug")
 }
 
 // GetPTTLoopback returns whether PTT loopback mode is enabled.
 func (c *Config) GetPTTLoopback() bool {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	return c.PTTLoopback
+	return value[bool](c, "ptt.loopback")
 }
 
 // GetPTTPttDevice returns the PTT device path.
 func (c *Config) GetPTTPttDevice() string {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	return c.PTTPttDevice
+	return value[string](c, "ptt.pttDevice")
 }
 
 // GetPTTPttDeviceName returns the PTT device name.
 func (c *Config) GetPTTPttDeviceName() string {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	return c.PTTPttDeviceName
+	return value[string](c, "ptt.pttDeviceName")
+}
+
+// GetPTTTxLogPath returns the path of the PTT transmission log.
+func (c *Config) GetPTTTxLogPath() string {
+	return value[string](c, "ptt.txLog.path")
+}
+
+// GetPTTTxLogMaxSize returns the size in bytes at which the PTT transmission log is rotated.
+func (c *Config) GetPTTTxLogMaxSize() int64 {
+	return value[int64](c, "ptt.txLog.maxSize")
+}
+
+// GetPTTTxLogMaxBackups returns how many rotated PTT transmission logs are kept.
+func (c *Config) GetPTTTxLogMaxBackups() int {
+	return value[int](c, "ptt.txLog.maxBackups")
+}
+
+// GetPTTRecordEnable returns whether PTT transmissions are recorded to disk.
+func (c *Config) GetPTTRecordEnable() bool {
+	return value[bool](c, "ptt.record.enable")
+}
+
+// GetPTTRecordDir returns the directory PTT recordings are written to.
+func (c *Config) GetPTTRecordDir() string {
+	return value[string](c, "ptt.record.dir")
+}
+
+// GetPTTRecordMaxTotalSize returns the total size in bytes PTT recordings may take up.
+func (c *Config) GetPTTRecordMaxTotalSize() int64 {
+	return value[int64](c, "ptt.record.maxTotalSize")
+}
+
+// GetCapacityWarnPct returns the address utilization percentage that triggers a capacity warning.
+func (c *Config) GetCapacityWarnPct() float64 {
+	return value[float64](c, "capacity.warnPct")
+}
+
+// GetCapacityCriticalPct returns the address utilization percentage that is reported as critical.
+func (c *Config) GetCapacityCriticalPct() float64 {
+	return value[float64](c, "capacity.criticalPct")
+}
+
+// GetReservationPinnedIP returns the static IP this node is pinned to in the config file.
+func (c *Config) GetReservationPinnedIP() string {
+	return value[string](c, "reservation.pinnedIP")
+}
+
+// GetFallbackOnPinConflict returns what to do when the pinned IP is taken ("auto" or "fail").
+func (c *Config) GetFallbackOnPinConflict() string {
+	return value[string](c, "reservation.fallbackOnPinConflict")
+}
+
+// GetIPAllocationStrategy returns how a free static IP is picked ("sequential", "random" or "mac-hash").
+func (c *Config) GetIPAllocationStrategy() string {
+	return value[string](c, "reservation.ipAllocationStrategy")
+}
+
+// GetGatewayProbeEnable returns whether the return path through the selected gateway is verified.
+func (c *Config) GetGatewayProbeEnable() bool {
+	return value[bool](c, "gatewayProbe.enable")
+}
+
+// GetGatewayProbeProtocol returns the protocol used to probe gateways ("icmp" or "udp").
+func (c *Config) GetGatewayProbeProtocol() string {
+	return value[string](c, "gatewayProbe.protocol")
+}
+
+// GetGatewayProbePort returns the UDP port of the gateway probe responder.
+func (c *Config) GetGatewayProbePort() int {
+	return value[int](c, "gatewayProbe.port")
+}
+
+// GetGatewayProbeTarget returns the external address probed through the gateway, if any.
+func (c *Config) GetGatewayProbeTarget() string {
+	return value[string](c, "gatewayProbe.target")
+}
+
+// GetGatewayProbeTimeout returns how long a gateway probe waits for a reply.
+func (c *Config) GetGatewayProbeTimeout() time.Duration {
+	return value[time.Duration](c, "gatewayProbe.timeout")
+}
+
+// GetStaticRoutes returns the configured static routes.
+func (c *Config) GetStaticRoutes() []StaticRoute {
+	return append([]StaticRoute(nil), value[[]StaticRoute](c, "staticRoutes")...)
+}
+
+// GetSourceRoutingPriority returns the priority of the first source routing rule.
+func (c *Config) GetSourceRoutingPriority() int {
+	return value[int](c, "sourceRouting.priority")
+}
+
+// GetSourceRoutingUplinks returns the uplinks mesh traffic is routed out through by
+// source.
+func (c *Config) GetSourceRoutingUplinks() []SourceRoutingUplink {
+	return append([]SourceRoutingUplink(nil), value[[]SourceRoutingUplink](c, "sourceRouting.uplinks")...)
+}
+
+// GetAlfredDataTypeService returns whether the service announcement data type is enabled.
+func (c *Config) GetAlfredDataTypeService() bool {
+	return value[bool](c, "alfred.dataTypes.service")
+}
+
+// GetServices returns the services this node announces.
+func (c *Config) GetServices() []Service {
+	return append([]Service(nil), value[[]Service](c, "services.announce")...)
+}
+
+// GetMeshConfigCacheTTL returns how long the batman-adv mesh configuration is shared
+// between workers before batctl is run again.
+func (c *Config) GetMeshConfigCacheTTL() time.Duration {
+	return value[time.Duration](c, "mesh.configCacheTTL")
+}
+
+// GetMeshHealthLiveWithin returns how recently a batman-adv neighbor must have been
+// heard to count as live.
+func (c *Config) GetMeshHealthLiveWithin() time.Duration {
+	return value[time.Duration](c, "meshHealth.liveWithin")
+}
+
+// GetMeshHealthSparseNeighbors returns the live neighbor count below which the mesh is sparse.
+func (c *Config) GetMeshHealthSparseNeighbors() int {
+	return value[int](c, "meshHealth.sparseNeighbors")
+}
+
+// GetMeshHealthSparseOriginators returns the originator count below which the mesh is sparse.
+func (c *Config) GetMeshHealthSparseOriginators() int {
+	return value[int](c, "meshHealth.sparseOriginators")
+}
+
+// GetMeshHealthSkipClaimWait returns whether an isolated node claims an address
+// without waiting for peers to answer its reservation request.
+func (c *Config) GetMeshHealthSkipClaimWait() bool {
+	return value[bool](c, "meshHealth.skipClaimWaitWhenIsolated")
+}
+
+// GetMeshHealthShortGatewayHold returns whether the selected gateway is held for a
+// shorter time on a sparse mesh.
+func (c *Config) GetMeshHealthShortGatewayHold() bool {
+	return value[bool](c, "meshHealth.shortGatewayHoldWhenSparse")
+}
+
+// GetBootstrapGracePeriod returns how long an unconfigured node that has heard from
+// no peer waits for the mesh to form before selecting an address.
+func (c *Config) GetBootstrapGracePeriod() time.Duration {
+	return value[time.Duration](c, "mgmt.bootstrapGracePeriod")
+}
+
+// GetIPAllocationMode returns how unconfigured nodes get an address: "distributed",
+// picking one themselves, or "delegated", requesting one from a gateway's block.
+func (c *Config) GetIPAllocationMode() string {
+	return value[string](c, "mgmt.ipAllocationMode")
+}
+
+// GetDelegationFallbackTimeout returns how long a node in delegated mode waits for an
+// offer before selecting an address itself.
+func (c *Config) GetDelegationFallbackTimeout() time.Duration {
+	return value[time.Duration](c, "delegation.fallbackTimeout")
+}
+
+// GetMeshLogEnable returns whether the batman-adv debug log is tailed into memory.
+func (c *Config) GetMeshLogEnable() bool {
+	return value[bool](c, "meshLog.enable")
+}
+
+// GetMeshLogRetention returns how many batman-adv debug log lines are kept.
+func (c *Config) GetMeshLogRetention() int {
+	return value[int](c, "meshLog.retention")
+}
+
+// GetTopologyPublish returns whether this node publishes its direct neighbors for the
+// mesh topology graph.
+func (c *Config) GetTopologyPublish() bool {
+	return value[bool](c, "topology.publish")
+}
+
+// GetServicesPublishDNS returns whether announced services are published as DNS SRV records.
+func (c *Config) GetServicesPublishDNS() bool {
+	return value[bool](c, "services.publishDNS")
+}
+
+// GetMeshSubnet returns the IPv4 subnet of the mesh in CIDR notation.
+func (c *Config) GetMeshSubnet() string {
+	return value[string](c, "mesh.subnet")
+}
+
+// GetMeshExcludedRanges returns the ranges of the mesh subnet that are never handed
+// out as static addresses.
+func (c *Config) GetMeshExcludedRanges() []string {
+	return append([]string(nil), value[[]string](c, "mesh.excludedRanges")...)
+}
+
+// GetMeshVLANs returns the desired settings of the mesh VLANs.
+func (c *Config) GetMeshVLANs() []MeshVLAN {
+	return append([]MeshVLAN(nil), value[[]MeshVLAN](c, "mesh.vlans")...)
+}
+
+// GetAddressCheckEvery returns how many receive ticks pass between mesh address checks.
+func (c *Config) GetAddressCheckEvery() int {
+	return value[int](c, "addressWatchdog.checkEvery")
+}
+
+// GetAddressMissThreshold returns how many failed address checks trigger the next remediation step.
+func (c *Config) GetAddressMissThreshold() int {
+	return value[int](c, "addressWatchdog.missThreshold")
+}
+
+// GetAddressReprovision returns whether a node that cannot recover its address is reprovisioned.
+func (c *Config) GetAddressReprovision() bool {
+	return value[bool](c, "addressWatchdog.reprovision")
+}
+
+// GetPoolAutosizeEnable returns whether DHCP pools are resized based on observed usage.
+func (c *Config) GetPoolAutosizeEnable() bool {
+	return value[bool](c, "poolAutosize.enable")
+}
+
+// GetPoolAutosizeGrowAt returns the fraction of a DHCP pool in use at which it grows.
+func (c *Config) GetPoolAutosizeGrowAt() float64 {
+	return value[float64](c, "poolAutosize.growAt")
+}
+
+// GetPoolAutosizeQuietPeriod returns how long a DHCP pool must be quiet before it shrinks.
+func (c *Config) GetPoolAutosizeQuietPeriod() time.Duration {
+	return value[time.Duration](c, "poolAutosize.quietPeriod")
+}
+
+// GetPoolAutosizeFloor returns the smallest size a DHCP pool is shrunk to.
+func (c *Config) GetPoolAutosizeFloor() int {
+	return value[int](c, "poolAutosize.floor")
+}
+
+// GetPoolAutosizeCeiling returns the largest size a DHCP pool is grown to.
+func (c *Config) GetPoolAutosizeCeiling() int {
+	return value[int](c, "poolAutosize.ceiling")
+}
+
+// GetStateFile returns the path of the file runtime state is persisted in.
+func (c *Config) GetStateFile() string {
+	return value[string](c, "stateFile")
+}
+
+// GetDHCPLeasesFile returns the path of the dnsmasq lease database.
+func (c *Config) GetDHCPLeasesFile() string {
+	return value[string](c, "dhcpLeasesFile")
+}
+
+// GetSafeMode returns whether openmanetd starts with system changes suppressed.
+func (c *Config) GetSafeMode() bool {
+	return value[bool](c, "safeMode")
+}
+
+// GetMeshID returns the deployment ID that published records are tagged with and
+// received records must carry.
+func (c *Config) GetMeshID() string {
+	return value[string](c, "meshId")
+}
+
+// GetMeshIDStrict returns whether records from another mesh are excluded rather than only flagged.
+func (c *Config) GetMeshIDStrict() bool {
+	return value[bool](c, "meshIdStrict")
+}
+
+// GetMeshIDAcceptLegacy returns whether records without a mesh ID are treated as ours.
+func (c *Config) GetMeshIDAcceptLegacy() bool {
+	return value[bool](c, "meshIdAcceptLegacy")
+}
+
+// GetUbusEnable returns whether openmanetd publishes its state on ubus.
+func (c *Config) GetUbusEnable() bool {
+	return value[bool](c, "ubus.enable")
+}
+
+// GetUbusSocketPath returns the path of the ubusd socket.
+func (c *Config) GetUbusSocketPath() string {
+	return value[string](c, "ubus.socketPath")
+}
+
+// GetMaxRecordsPerTick returns how many alfred records of one data type a receive tick processes.
+func (c *Config) GetMaxRecordsPerTick() int {
+	return value[int](c, "mgmt.maxRecordsPerTick")
+}
+
+// GetAutoZone returns the firewall zone a newly configured mesh network is added to
+// when no zone covers it, or "" to only warn.
+func (c *Config) GetAutoZone() string {
+	return value[string](c, "mgmt.autoZone")
+}
+
+// GetDnsmasqInstance returns the dnsmasq instance serving the mesh DHCP pool, or ""
+// for the main instance.
+func (c *Config) GetDnsmasqInstance() string {
+	return value[string](c, "mgmt.dnsmasqInstance")
+}
+
+// GetOpenServices returns whether firewall rules accepting DHCP, DNS and alfred are
+// added to the zone covering the mesh network.
+func (c *Config) GetOpenServices() bool {
+	return value[bool](c, "mgmt.openServices")
+}
+
+// GetGatewayMasquerade returns whether a gateway masquerades mesh traffic leaving
+// through the uplink zone.
+func (c *Config) GetGatewayMasquerade() bool {
+	return value[bool](c, "mgmt.gatewayMasquerade")
+}
+
+// GetUplinkZone returns the firewall zone of a gateway's uplink.
+func (c *Config) GetUplinkZone() string {
+	return value[string](c, "mgmt.uplinkZone")
+}
+
+// GetGuestIsolationEnable returns whether guest traffic is marked for batman-adv AP isolation.
+func (c *Config) GetGuestIsolationEnable() bool {
+	return value[bool](c, "guestIsolation.enable")
+}
+
+// GetGuestIsolationSection returns the UCI network section of the guest network.
+func (c *Config) GetGuestIsolationSection() string {
+	return value[string](c, "guestIsolation.section")
+}
+
+// GetGuestIsolationMark returns the firewall mark and mask that flag guest traffic as isolated.
+func (c *Config) GetGuestIsolationMark() (uint32, uint32) {
+	return value[uint32](c, "guestIsolation.mark"), value[uint32](c, "guestIsolation.mask")
 }
@@ -1,7 +1,11 @@
 package config
 
 import (
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -19,6 +23,10 @@ func strPtr(s string) *string {
 	return &s
 }
 
+func floatPtr(f float64) *float64 {
+	return &f
+}
+
 func TestGetMeshNetInterface(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -316,6 +324,88 @@ func TestGetAlfredSocketPath(t *testing.T) {
 	}
 }
 
+func TestGetAlfredCallTimeout(t *testing.T) {
+	tests := []struct {
+		name     string
+		setValue *string
+		want     time.Duration
+	}{
+		{
+			name:     "returns default when not set",
+			setValue: nil,
+			want:     DefaultAlfredCallTimeout,
+		},
+		{
+			name:     "returns configured timeout",
+			setValue: strPtr("2s"),
+			want:     2 * time.Second,
+		},
+		{
+			name:     "returns default when invalid",
+			setValue: strPtr("soon"),
+			want:     DefaultAlfredCallTimeout,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := viper.New()
+			if tt.setValue != nil {
+				v.Set("alfred.callTimeout", *tt.setValue)
+			}
+
+			cfg := New(v)
+			got := cfg.GetAlfredCallTimeout()
+			if got != tt.want {
+				t.Errorf("GetAlfredCallTimeout() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetCapacityThresholds(t *testing.T) {
+	tests := []struct {
+		name         string
+		warnPct      *float64
+		criticalPct  *float64
+		wantWarn     float64
+		wantCritical float64
+	}{
+		{
+			name:         "returns configured thresholds",
+			warnPct:      floatPtr(70),
+			criticalPct:  floatPtr(90),
+			wantWarn:     70,
+			wantCritical: 90,
+		},
+		{
+			name:         "returns defaults when not set",
+			wantWarn:     DefaultCapacityWarnPct,
+			wantCritical: DefaultCapacityCriticalPct,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := viper.New()
+			if tt.warnPct != nil {
+				v.Set("capacity.warnPct", *tt.warnPct)
+			}
+			if tt.criticalPct != nil {
+				v.Set("capacity.criticalPct", *tt.criticalPct)
+			}
+
+			cfg := New(v)
+			if got := cfg.GetCapacityWarnPct(); got != tt.wantWarn {
+				t.Errorf("GetCapacityWarnPct() = %v, want %v", got, tt.wantWarn)
+			}
+			if got := cfg.GetCapacityCriticalPct(); got != tt.wantCritical {
+				t.Errorf("GetCapacityCriticalPct() = %v, want %v", got, tt.wantCritical)
+			}
+		})
+	}
+}
+
 func TestConfigReload(t *testing.T) {
 	v := viper.New()
 	v.Set("meshNetInterface", "eth0")
@@ -386,3 +476,798 @@ func TestConfigOnChangeCallback(t *testing.T) {
 		t.Errorf("Callback config GetMeshNetInterface() = %v, want wlan0", got)
 	}
 }
+
+func TestGetReservationPin(t *testing.T) {
+	tests := []struct {
+		name         string
+		pinnedIP     *string
+		fallback     *string
+		wantPinnedIP string
+		wantFallback string
+	}{
+		{
+			name:         "returns defaults when not set",
+			wantPinnedIP: DefaultReservationPinnedIP,
+			wantFallback: DefaultFallbackOnPinConflict,
+		},
+		{
+			name:         "returns configured pin and policy",
+			pinnedIP:     strPtr("10.41.2.10"),
+			fallback:     strPtr("auto"),
+			wantPinnedIP: "10.41.2.10",
+			wantFallback: "auto",
+		},
+		{
+			name:         "returns default policy when invalid",
+			fallback:     strPtr("retry"),
+			wantPinnedIP: DefaultReservationPinnedIP,
+			wantFallback: DefaultFallbackOnPinConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := viper.New()
+			if tt.pinnedIP != nil {
+				v.Set("reservation.pinnedIP", *tt.pinnedIP)
+			}
+			if tt.fallback != nil {
+				v.Set("reservation.fallbackOnPinConflict", *tt.fallback)
+			}
+
+			cfg := New(v)
+			if got := cfg.GetReservationPinnedIP(); got != tt.wantPinnedIP {
+				t.Errorf("GetReservationPinnedIP() = %v, want %v", got, tt.wantPinnedIP)
+			}
+			if got := cfg.GetFallbackOnPinConflict(); got != tt.wantFallback {
+				t.Errorf("GetFallbackOnPinConflict() = %v, want %v", got, tt.wantFallback)
+			}
+		})
+	}
+}
+
+func TestGetIPAllocationStrategy(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy *string
+		want     string
+	}{
+		{name: "returns default when not set", want: DefaultIPAllocationStrategy},
+		{name: "returns random", strategy: strPtr("random"), want: "random"},
+		{name: "returns mac-hash", strategy: strPtr("mac-hash"), want: "mac-hash"},
+		{name: "returns default when invalid", strategy: strPtr("lowest"), want: DefaultIPAllocationStrategy},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := viper.New()
+			if tt.strategy != nil {
+				v.Set("reservation.ipAllocationStrategy", *tt.strategy)
+			}
+
+			if got := New(v).GetIPAllocationStrategy(); got != tt.want {
+				t.Errorf("GetIPAllocationStrategy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetGatewayProbe(t *testing.T) {
+	t.Run("returns defaults when not set", func(t *testing.T) {
+		cfg := New(viper.New())
+
+		if got := cfg.GetGatewayProbeEnable(); got != DefaultGatewayProbeEnable {
+			t.Errorf("GetGatewayProbeEnable() = %v, want %v", got, DefaultGatewayProbeEnable)
+		}
+		if got := cfg.GetGatewayProbeProtocol(); got != DefaultGatewayProbeProtocol {
+			t.Errorf("GetGatewayProbeProtocol() = %v, want %v", got, DefaultGatewayProbeProtocol)
+		}
+		if got := cfg.GetGatewayProbePort(); got != DefaultGatewayProbePort {
+			t.Errorf("GetGatewayProbePort() = %v, want %v", got, DefaultGatewayProbePort)
+		}
+		if got := cfg.GetGatewayProbeTarget(); got != DefaultGatewayProbeTarget {
+			t.Errorf("GetGatewayProbeTarget() = %v, want %v", got, DefaultGatewayProbeTarget)
+		}
+		if got := cfg.GetGatewayProbeTimeout(); got != DefaultGatewayProbeTimeout {
+			t.Errorf("GetGatewayProbeTimeout() = %v, want %v", got, DefaultGatewayProbeTimeout)
+		}
+	})
+
+	t.Run("returns configured values", func(t *testing.T) {
+		v := viper.New()
+		v.Set("gatewayProbe.enable", false)
+		v.Set("gatewayProbe.protocol", "udp")
+		v.Set("gatewayProbe.port", 6000)
+		v.Set("gatewayProbe.target", "1.1.1.1")
+		v.Set("gatewayProbe.timeout", "500ms")
+		cfg := New(v)
+
+		if got := cfg.GetGatewayProbeEnable(); got {
+			t.Errorf("GetGatewayProbeEnable() = %v, want false", got)
+		}
+		if got := cfg.GetGatewayProbeProtocol(); got != "udp" {
+			t.Errorf("GetGatewayProbeProtocol() = %v, want udp", got)
+		}
+		if got := cfg.GetGatewayProbePort(); got != 6000 {
+			t.Errorf("GetGatewayProbePort() = %v, want 6000", got)
+		}
+		if got := cfg.GetGatewayProbeTarget(); got != "1.1.1.1" {
+			t.Errorf("GetGatewayProbeTarget() = %v, want 1.1.1.1", got)
+		}
+		if got := cfg.GetGatewayProbeTimeout(); got != 500*time.Millisecond {
+			t.Errorf("GetGatewayProbeTimeout() = %v, want 500ms", got)
+		}
+	})
+
+	t.Run("returns defaults when invalid", func(t *testing.T) {
+		v := viper.New()
+		v.Set("gatewayProbe.protocol", "tcp")
+		v.Set("gatewayProbe.port", 70000)
+		cfg := New(v)
+
+		if got := cfg.GetGatewayProbeProtocol(); got != DefaultGatewayProbeProtocol {
+			t.Errorf("GetGatewayProbeProtocol() = %v, want %v", got, DefaultGatewayProbeProtocol)
+		}
+		if got := cfg.GetGatewayProbePort(); got != DefaultGatewayProbePort {
+			t.Errorf("GetGatewayProbePort() = %v, want %v", got, DefaultGatewayProbePort)
+		}
+	})
+}
+
+func TestGetStaticRoutes(t *testing.T) {
+	t.Run("returns no routes when not set", func(t *testing.T) {
+		cfg := New(viper.New())
+
+		if got := cfg.GetStaticRoutes(); len(got) != 0 {
+			t.Errorf("GetStaticRoutes() = %v, want none", got)
+		}
+	})
+
+	t.Run("returns configured routes", func(t *testing.T) {
+		v := viper.New()
+		v.Set("staticRoutes", []map[string]any{
+			{"destination": "192.168.50.0/24", "gateway": "10.41.0.1", "interface": "br-ahwlan", "metric": 10},
+			{"destination": "172.16.0.0/12", "interface": "eth0", "table": 100},
+		})
+		cfg := New(v)
+
+		want := []StaticRoute{
+			{Destination: "192.168.50.0/24", Gateway: "10.41.0.1", Interface: "br-ahwlan", Metric: 10},
+			{Destination: "172.16.0.0/12", Interface: "eth0", Table: 100},
+		}
+		got := cfg.GetStaticRoutes()
+		if len(got) != len(want) {
+			t.Fatalf("GetStaticRoutes() = %v, want %v", got, want)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("GetStaticRoutes()[%d] = %+v, want %+v", i, got[i], want[i])
+			}
+		}
+	})
+
+	t.Run("returns no routes when malformed", func(t *testing.T) {
+		v := viper.New()
+		v.Set("staticRoutes", "192.168.50.0/24")
+		cfg := New(v)
+
+		if got := cfg.GetStaticRoutes(); len(got) != 0 {
+			t.Errorf("GetStaticRoutes() = %v, want none", got)
+		}
+	})
+}
+
+func TestGetSourceRouting(t *testing.T) {
+	t.Run("returns defaults when not set", func(t *testing.T) {
+		cfg := New(viper.New())
+
+		if got := cfg.GetSourceRoutingPriority(); got != DefaultSourceRoutingPriority {
+			t.Errorf("GetSourceRoutingPriority() = %v, want %v", got, DefaultSourceRoutingPriority)
+		}
+		if got := cfg.GetSourceRoutingUplinks(); len(got) != 0 {
+			t.Errorf("GetSourceRoutingUplinks() = %v, want none", got)
+		}
+	})
+
+	t.Run("returns configured uplinks", func(t *testing.T) {
+		v := viper.New()
+		v.Set("sourceRouting.priority", 20000)
+		v.Set("sourceRouting.uplinks", []map[string]any{
+			{"name": "wan", "interface": "eth0", "gateway": "192.0.2.1", "table": 200, "sources": []string{"10.41.0.0/16"}},
+			{"name": "lte", "interface": "wwan0", "sources": []string{"10.41.0.23", "10.41.5.0/24"}},
+		})
+		cfg := New(v)
+
+		if got := cfg.GetSourceRoutingPriority(); got != 20000 {
+			t.Errorf("GetSourceRoutingPriority() = %v, want 20000", got)
+		}
+		want := []SourceRoutingUplink{
+			{Name: "wan", Interface: "eth0", Gateway: "192.0.2.1", Table: 200, Sources: []string{"10.41.0.0/16"}},
+			{Name: "lte", Interface: "wwan0", Sources: []string{"10.41.0.23", "10.41.5.0/24"}},
+		}
+		if got := cfg.GetSourceRoutingUplinks(); !reflect.DeepEqual(got, want) {
+			t.Errorf("GetSourceRoutingUplinks() = %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("returns defaults when invalid", func(t *testing.T) {
+		v := viper.New()
+		v.Set("sourceRouting.priority", 40000)
+		v.Set("sourceRouting.uplinks", "eth0")
+		cfg := New(v)
+
+		if got := cfg.GetSourceRoutingPriority(); got != DefaultSourceRoutingPriority {
+			t.Errorf("GetSourceRoutingPriority() = %v, want %v", got, DefaultSourceRoutingPriority)
+		}
+		if got := cfg.GetSourceRoutingUplinks(); len(got) != 0 {
+			t.Errorf("GetSourceRoutingUplinks() = %v, want none", got)
+		}
+	})
+}
+
+func TestGetServices(t *testing.T) {
+	t.Run("returns defaults when not set", func(t *testing.T) {
+		cfg := New(viper.New())
+
+		if got := cfg.GetServices(); len(got) != 0 {
+			t.Errorf("GetServices() = %v, want none", got)
+		}
+		if got := cfg.GetServicesPublishDNS(); got != DefaultServicesPublishDNS {
+			t.Errorf("GetServicesPublishDNS() = %v, want %v", got, DefaultServicesPublishDNS)
+		}
+		if got := cfg.GetAlfredDataTypeService(); got != DefaultAlfredDataTypeService {
+			t.Errorf("GetAlfredDataTypeService() = %v, want %v", got, DefaultAlfredDataTypeService)
+		}
+	})
+
+	t.Run("returns configured services", func(t *testing.T) {
+		v := viper.New()
+		v.Set("services.announce", []map[string]any{
+			{"name": "rtsp-cam", "port": 554, "proto": "tcp", "ttl": "10m"},
+			{"name": "mqtt", "port": 1883, "address": "10.41.1.20", "description": "broker"},
+		})
+		v.Set("services.publishDNS", true)
+		v.Set("alfred.dataTypes.service", false)
+		cfg := New(v)
+
+		want := []Service{
+			{Name: "rtsp-cam", Port: 554, Proto: "tcp", TTL: 10 * time.Minute},
+			{Name: "mqtt", Port: 1883, Address: "10.41.1.20", Description: "broker"},
+		}
+		got := cfg.GetServices()
+		if len(got) != len(want) {
+			t.Fatalf("GetServices() = %v, want %v", got, want)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("GetServices()[%d] = %+v, want %+v", i, got[i], want[i])
+			}
+		}
+		if !cfg.GetServicesPublishDNS() {
+			t.Error("GetServicesPublishDNS() = false, want true")
+		}
+		if cfg.GetAlfredDataTypeService() {
+			t.Error("GetAlfredDataTypeService() = true, want false")
+		}
+	})
+}
+
+func TestGetMeshVLANs(t *testing.T) {
+	t.Run("returns no VLANs when not set", func(t *testing.T) {
+		cfg := New(viper.New())
+
+		if got := cfg.GetMeshVLANs(); len(got) != 0 {
+			t.Errorf("GetMeshVLANs() = %v, want none", got)
+		}
+	})
+
+	t.Run("returns configured VLANs", func(t *testing.T) {
+		v := viper.New()
+		v.Set("mesh.vlans", []map[string]any{
+			{"vid": 100, "apIsolation": true},
+			{"vid": 200},
+		})
+		cfg := New(v)
+
+		want := []MeshVLAN{{VID: 100, APIsolation: true}, {VID: 200}}
+		got := cfg.GetMeshVLANs()
+		if len(got) != len(want) {
+			t.Fatalf("GetMeshVLANs() = %v, want %v", got, want)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("GetMeshVLANs()[%d] = %+v, want %+v", i, got[i], want[i])
+			}
+		}
+	})
+
+	t.Run("returns no VLANs when malformed", func(t *testing.T) {
+		v := viper.New()
+		v.Set("mesh.vlans", "100")
+		cfg := New(v)
+
+		if got := cfg.GetMeshVLANs(); len(got) != 0 {
+			t.Errorf("GetMeshVLANs() = %v, want none", got)
+		}
+	})
+}
+
+func TestGetAddressWatchdog(t *testing.T) {
+	t.Run("returns defaults when not set", func(t *testing.T) {
+		cfg := New(viper.New())
+
+		if got := cfg.GetAddressCheckEvery(); got != DefaultAddressCheckEvery {
+			t.Errorf("GetAddressCheckEvery() = %v, want %v", got, DefaultAddressCheckEvery)
+		}
+		if got := cfg.GetAddressMissThreshold(); got != DefaultAddressMissThreshold {
+			t.Errorf("GetAddressMissThreshold() = %v, want %v", got, DefaultAddressMissThreshold)
+		}
+		if got := cfg.GetAddressReprovision(); got != DefaultAddressReprovision {
+			t.Errorf("GetAddressReprovision() = %v, want %v", got, DefaultAddressReprovision)
+		}
+	})
+
+	t.Run("returns configured values", func(t *testing.T) {
+		v := viper.New()
+		v.Set("addressWatchdog.checkEvery", 2)
+		v.Set("addressWatchdog.missThreshold", 5)
+		v.Set("addressWatchdog.reprovision", true)
+		cfg := New(v)
+
+		if got := cfg.GetAddressCheckEvery(); got != 2 {
+			t.Errorf("GetAddressCheckEvery() = %v, want 2", got)
+		}
+		if got := cfg.GetAddressMissThreshold(); got != 5 {
+			t.Errorf("GetAddressMissThreshold() = %v, want 5", got)
+		}
+		if got := cfg.GetAddressReprovision(); !got {
+			t.Errorf("GetAddressReprovision() = %v, want true", got)
+		}
+	})
+
+	t.Run("returns defaults when invalid", func(t *testing.T) {
+		v := viper.New()
+		v.Set("addressWatchdog.checkEvery", 0)
+		v.Set("addressWatchdog.missThreshold", -1)
+		cfg := New(v)
+
+		if got := cfg.GetAddressCheckEvery(); got != DefaultAddressCheckEvery {
+			t.Errorf("GetAddressCheckEvery() = %v, want %v", got, DefaultAddressCheckEvery)
+		}
+		if got := cfg.GetAddressMissThreshold(); got != DefaultAddressMissThreshold {
+			t.Errorf("GetAddressMissThreshold() = %v, want %v", got, DefaultAddressMissThreshold)
+		}
+	})
+}
+
+func TestGetPoolAutosize(t *testing.T) {
+	t.Run("returns defaults when not set", func(t *testing.T) {
+		cfg := New(viper.New())
+
+		if got := cfg.GetPoolAutosizeEnable(); got != DefaultPoolAutosizeEnable {
+			t.Errorf("GetPoolAutosizeEnable() = %v, want %v", got, DefaultPoolAutosizeEnable)
+		}
+		if got := cfg.GetPoolAutosizeGrowAt(); got != DefaultPoolAutosizeGrowAt {
+			t.Errorf("GetPoolAutosizeGrowAt() = %v, want %v", got, DefaultPoolAutosizeGrowAt)
+		}
+		if got := cfg.GetPoolAutosizeQuietPeriod(); got != DefaultPoolAutosizeQuietPeriod {
+			t.Errorf("GetPoolAutosizeQuietPeriod() = %v, want %v", got, DefaultPoolAutosizeQuietPeriod)
+		}
+		if got := cfg.GetPoolAutosizeFloor(); got != DefaultPoolAutosizeFloor {
+			t.Errorf("GetPoolAutosizeFloor() = %v, want %v", got, DefaultPoolAutosizeFloor)
+		}
+		if got := cfg.GetPoolAutosizeCeiling(); got != DefaultPoolAutosizeCeiling {
+			t.Errorf("GetPoolAutosizeCeiling() = %v, want %v", got, DefaultPoolAutosizeCeiling)
+		}
+		if got := cfg.GetStateFile(); got != DefaultStateFile {
+			t.Errorf("GetStateFile() = %v, want %v", got, DefaultStateFile)
+		}
+		if got := cfg.GetDHCPLeasesFile(); got != DefaultDHCPLeasesFile {
+			t.Errorf("GetDHCPLeasesFile() = %v, want %v", got, DefaultDHCPLeasesFile)
+		}
+	})
+
+	t.Run("returns configured values", func(t *testing.T) {
+		v := viper.New()
+		v.Set("poolAutosize.enable", true)
+		v.Set("poolAutosize.growAt", 0.5)
+		v.Set("poolAutosize.quietPeriod", "48h")
+		v.Set("poolAutosize.floor", 32)
+		v.Set("poolAutosize.ceiling", 128)
+		v.Set("stateFile", "/tmp/state.json")
+		v.Set("dhcpLeasesFile", "/var/lib/misc/dnsmasq.leases")
+		cfg := New(v)
+
+		if got := cfg.GetPoolAutosizeEnable(); !got {
+			t.Errorf("GetPoolAutosizeEnable() = %v, want true", got)
+		}
+		if got := cfg.GetPoolAutosizeGrowAt(); got != 0.5 {
+			t.Errorf("GetPoolAutosizeGrowAt() = %v, want 0.5", got)
+		}
+		if got := cfg.GetPoolAutosizeQuietPeriod(); got != 48*time.Hour {
+			t.Errorf("GetPoolAutosizeQuietPeriod() = %v, want 48h", got)
+		}
+		if got := cfg.GetPoolAutosizeFloor(); got != 32 {
+			t.Errorf("GetPoolAutosizeFloor() = %v, want 32", got)
+		}
+		if got := cfg.GetPoolAutosizeCeiling(); got != 128 {
+			t.Errorf("GetPoolAutosizeCeiling() = %v, want 128", got)
+		}
+		if got := cfg.GetStateFile(); got != "/tmp/state.json" {
+			t.Errorf("GetStateFile() = %v, want /tmp/state.json", got)
+		}
+		if got := cfg.GetDHCPLeasesFile(); got != "/var/lib/misc/dnsmasq.leases" {
+			t.Errorf("GetDHCPLeasesFile() = %v, want /var/lib/misc/dnsmasq.leases", got)
+		}
+	})
+
+	t.Run("returns defaults when invalid", func(t *testing.T) {
+		v := viper.New()
+		v.Set("poolAutosize.growAt", 1.5)
+		v.Set("poolAutosize.floor", 0)
+		v.Set("poolAutosize.ceiling", 8)
+		cfg := New(v)
+
+		if got := cfg.GetPoolAutosizeGrowAt(); got != DefaultPoolAutosizeGrowAt {
+			t.Errorf("GetPoolAutosizeGrowAt() = %v, want %v", got, DefaultPoolAutosizeGrowAt)
+		}
+		if got := cfg.GetPoolAutosizeFloor(); got != DefaultPoolAutosizeFloor {
+			t.Errorf("GetPoolAutosizeFloor() = %v, want %v", got, DefaultPoolAutosizeFloor)
+		}
+		if got := cfg.GetPoolAutosizeCeiling(); got != DefaultPoolAutosizeCeiling {
+			t.Errorf("GetPoolAutosizeCeiling() = %v, want %v", got, DefaultPoolAutosizeCeiling)
+		}
+	})
+}
+
+func TestGetPTTTransmissionLog(t *testing.T) {
+	t.Run("returns defaults when not set", func(t *testing.T) {
+		cfg := New(viper.New())
+
+		if got := cfg.GetPTTTxLogPath(); got != DefaultPTTTxLogPath {
+			t.Errorf("GetPTTTxLogPath() = %v, want %v", got, DefaultPTTTxLogPath)
+		}
+		if got := cfg.GetPTTTxLogMaxSize(); got != DefaultPTTTxLogMaxSize {
+			t.Errorf("GetPTTTxLogMaxSize() = %v, want %v", got, DefaultPTTTxLogMaxSize)
+		}
+		if got := cfg.GetPTTTxLogMaxBackups(); got != DefaultPTTTxLogMaxBackups {
+			t.Errorf("GetPTTTxLogMaxBackups() = %v, want %v", got, DefaultPTTTxLogMaxBackups)
+		}
+		if got := cfg.GetPTTRecordEnable(); got {
+			t.Errorf("GetPTTRecordEnable() = %v, want recording disabled by default", got)
+		}
+		if got := cfg.GetPTTRecordDir(); got != DefaultPTTRecordDir {
+			t.Errorf("GetPTTRecordDir() = %v, want %v", got, DefaultPTTRecordDir)
+		}
+		if got := cfg.GetPTTRecordMaxTotalSize(); got != DefaultPTTRecordMaxTotalSize {
+			t.Errorf("GetPTTRecordMaxTotalSize() = %v, want %v", got, DefaultPTTRecordMaxTotalSize)
+		}
+	})
+
+	t.Run("returns configured values", func(t *testing.T) {
+		v := viper.New()
+		v.Set("ptt.txLog.path", "/mnt/usb/tx.jsonl")
+		v.Set("ptt.txLog.maxSize", 4096)
+		v.Set("ptt.txLog.maxBackups", 5)
+		v.Set("ptt.record.enable", true)
+		v.Set("ptt.record.dir", "/mnt/usb/rec")
+		v.Set("ptt.record.maxTotalSize", 1<<30)
+		cfg := New(v)
+
+		if got := cfg.GetPTTTxLogPath(); got != "/mnt/usb/tx.jsonl" {
+			t.Errorf("GetPTTTxLogPath() = %v, want /mnt/usb/tx.jsonl", got)
+		}
+		if got := cfg.GetPTTTxLogMaxSize(); got != 4096 {
+			t.Errorf("GetPTTTxLogMaxSize() = %v, want 4096", got)
+		}
+		if got := cfg.GetPTTTxLogMaxBackups(); got != 5 {
+			t.Errorf("GetPTTTxLogMaxBackups() = %v, want 5", got)
+		}
+		if got := cfg.GetPTTRecordEnable(); !got {
+			t.Errorf("GetPTTRecordEnable() = %v, want true", got)
+		}
+		if got := cfg.GetPTTRecordDir(); got != "/mnt/usb/rec" {
+			t.Errorf("GetPTTRecordDir() = %v, want /mnt/usb/rec", got)
+		}
+		if got := cfg.GetPTTRecordMaxTotalSize(); got != 1<<30 {
+			t.Errorf("GetPTTRecordMaxTotalSize() = %v, want %v", got, 1<<30)
+		}
+	})
+}
+
+func TestGetSafeMode(t *testing.T) {
+	if got := New(viper.New()).GetSafeMode(); got != DefaultSafeMode {
+		t.Errorf("GetSafeMode() = %v, want %v", got, DefaultSafeMode)
+	}
+
+	v := viper.New()
+	v.Set("safeMode", true)
+	if got := New(v).GetSafeMode(); !got {
+		t.Errorf("GetSafeMode() = %v, want true", got)
+	}
+}
+
+func TestGetMeshID(t *testing.T) {
+	c := New(viper.New())
+	if got := c.GetMeshID(); got != DefaultMeshID {
+		t.Errorf("GetMeshID() = %q, want %q", got, DefaultMeshID)
+	}
+	if got := c.GetMeshIDStrict(); got != DefaultMeshIDStrict {
+		t.Errorf("GetMeshIDStrict() = %v, want %v", got, DefaultMeshIDStrict)
+	}
+	if got := c.GetMeshIDAcceptLegacy(); got != DefaultMeshIDAcceptLegacy {
+		t.Errorf("GetMeshIDAcceptLegacy() = %v, want %v", got, DefaultMeshIDAcceptLegacy)
+	}
+
+	v := viper.New()
+	v.Set("meshId", "warehouse-a")
+	v.Set("meshIdStrict", false)
+	v.Set("meshIdAcceptLegacy", false)
+	c = New(v)
+	if got := c.GetMeshID(); got != "warehouse-a" {
+		t.Errorf("GetMeshID() = %q, want %q", got, "warehouse-a")
+	}
+	if c.GetMeshIDStrict() || c.GetMeshIDAcceptLegacy() {
+		t.Errorf("GetMeshIDStrict(), GetMeshIDAcceptLegacy() = %v, %v; want false, false", c.GetMeshIDStrict(), c.GetMeshIDAcceptLegacy())
+	}
+}
+
+func TestGetUbus(t *testing.T) {
+	c := New(viper.New())
+	if got := c.GetUbusEnable(); got != DefaultUbusEnable {
+		t.Errorf("GetUbusEnable() = %v, want %v", got, DefaultUbusEnable)
+	}
+	if got := c.GetUbusSocketPath(); got != DefaultUbusSocketPath {
+		t.Errorf("GetUbusSocketPath() = %q, want %q", got, DefaultUbusSocketPath)
+	}
+
+	v := viper.New()
+	v.Set("ubus.enable", true)
+	v.Set("ubus.socketPath", "/tmp/ubus.sock")
+	c = New(v)
+	if !c.GetUbusEnable() {
+		t.Errorf("GetUbusEnable() = false, want true")
+	}
+	if got := c.GetUbusSocketPath(); got != "/tmp/ubus.sock" {
+		t.Errorf("GetUbusSocketPath() = %q, want %q", got, "/tmp/ubus.sock")
+	}
+}
+
+func TestGetMaxRecordsPerTick(t *testing.T) {
+	tests := []struct {
+		name string
+		set  any
+		want int
+	}{
+		{name: "returns default when not set", want: DefaultMaxRecordsPerTick},
+		{name: "returns configured value", set: 250, want: 250},
+		{name: "returns default when not positive", set: 0, want: DefaultMaxRecordsPerTick},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := viper.New()
+			if tt.set != nil {
+				v.Set("mgmt.maxRecordsPerTick", tt.set)
+			}
+			if got := New(v).GetMaxRecordsPerTick(); got != tt.want {
+				t.Errorf("GetMaxRecordsPerTick() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetAutoZone(t *testing.T) {
+	v := viper.New()
+	if got := New(v).GetAutoZone(); got != DefaultAutoZone {
+		t.Errorf("GetAutoZone() = %q, want %q", got, DefaultAutoZone)
+	}
+
+	v.Set("mgmt.autoZone", "lan")
+	if got := New(v).GetAutoZone(); got != "lan" {
+		t.Errorf("GetAutoZone() = %q, want lan", got)
+	}
+}
+
+func TestGetFirewallManagement(t *testing.T) {
+	v := viper.New()
+	c := New(v)
+	if c.GetOpenServices() != DefaultOpenServices || c.GetGatewayMasquerade() != DefaultGatewayMasquerade || c.GetUplinkZone() != DefaultUplinkZone {
+		t.Errorf("defaults = %t, %t, %q", c.GetOpenServices(), c.GetGatewayMasquerade(), c.GetUplinkZone())
+	}
+
+	v.Set("mgmt.openServices", true)
+	v.Set("mgmt.gatewayMasquerade", true)
+	v.Set("mgmt.uplinkZone", "wwan")
+	c = New(v)
+	if !c.GetOpenServices() || !c.GetGatewayMasquerade() || c.GetUplinkZone() != "wwan" {
+		t.Errorf("configured = %t, %t, %q", c.GetOpenServices(), c.GetGatewayMasquerade(), c.GetUplinkZone())
+	}
+}
+
+func TestGetGuestIsolation(t *testing.T) {
+	v := viper.New()
+	cfg := New(v)
+	if cfg.GetGuestIsolationEnable() != DefaultGuestIsolationEnable || cfg.GetGuestIsolationSection() != DefaultGuestIsolationSection {
+		t.Errorf("guest isolation = %v, %q; want the defaults", cfg.GetGuestIsolationEnable(), cfg.GetGuestIsolationSection())
+	}
+	if mark, mask := cfg.GetGuestIsolationMark(); mark != DefaultGuestIsolationMark || mask != DefaultGuestIsolationMask {
+		t.Errorf("GetGuestIsolationMark() = 0x%x/0x%x, want the defaults", mark, mask)
+	}
+
+	v.Set("guestIsolation.enable", true)
+	v.Set("guestIsolation.section", "visitors")
+	v.Set("guestIsolation.mark", 0x400)
+	v.Set("guestIsolation.mask", 0xff00)
+	cfg = New(v)
+	if !cfg.GetGuestIsolationEnable() || cfg.GetGuestIsolationSection() != "visitors" {
+		t.Errorf("guest isolation = %v, %q; want true, visitors", cfg.GetGuestIsolationEnable(), cfg.GetGuestIsolationSection())
+	}
+	if mark, mask := cfg.GetGuestIsolationMark(); mark != 0x400 || mask != 0xff00 {
+		t.Errorf("GetGuestIsolationMark() = 0x%x/0x%x, want 0x400/0xff00", mark, mask)
+	}
+}
+
+func TestGetMeshConfigCacheTTL(t *testing.T) {
+	v := viper.New()
+	if got := New(v).GetMeshConfigCacheTTL(); got != DefaultMeshConfigCacheTTL {
+		t.Errorf("GetMeshConfigCacheTTL() = %v, want %v", got, DefaultMeshConfigCacheTTL)
+	}
+
+	v.Set("mesh.configCacheTTL", "500ms")
+	if got := New(v).GetMeshConfigCacheTTL(); got != 500*time.Millisecond {
+		t.Errorf("GetMeshConfigCacheTTL() = %v, want 500ms", got)
+	}
+}
+
+func TestGetMeshSubnet(t *testing.T) {
+	v := viper.New()
+	cfg := New(v)
+	if got := cfg.GetMeshSubnet(); got != DefaultMeshSubnet {
+		t.Errorf("GetMeshSubnet() = %q, want %q", got, DefaultMeshSubnet)
+	}
+	if got := cfg.GetMeshExcludedRanges(); !slices.Equal(got, DefaultMeshExcludedRanges) {
+		t.Errorf("GetMeshExcludedRanges() = %v, want %v", got, DefaultMeshExcludedRanges)
+	}
+
+	v.Set("mesh.subnet", "172.16.0.0/12")
+	v.Set("mesh.excludedRanges", []string{"172.31.0.0/16"})
+	cfg = New(v)
+	if got := cfg.GetMeshSubnet(); got != "172.16.0.0/12" {
+		t.Errorf("GetMeshSubnet() = %q, want 172.16.0.0/12", got)
+	}
+	if got := cfg.GetMeshExcludedRanges(); !slices.Equal(got, []string{"172.31.0.0/16"}) {
+		t.Errorf("GetMeshExcludedRanges() = %v, want [172.31.0.0/16]", got)
+	}
+
+	v.Set("mesh.excludedRanges", []string{})
+	if got := New(v).GetMeshExcludedRanges(); len(got) != 0 {
+		t.Errorf("GetMeshExcludedRanges() = %v, want none", got)
+	}
+}
+
+func TestGetMeshHealth(t *testing.T) {
+	v := viper.New()
+	cfg := New(v)
+	if cfg.GetMeshHealthLiveWithin() != DefaultMeshHealthLiveWithin ||
+		cfg.GetMeshHealthSparseNeighbors() != DefaultMeshHealthSparseNeighbors ||
+		cfg.GetMeshHealthSparseOriginators() != DefaultMeshHealthSparseOriginators {
+		t.Errorf("mesh health thresholds = %v, %d, %d; want the defaults",
+			cfg.GetMeshHealthLiveWithin(), cfg.GetMeshHealthSparseNeighbors(), cfg.GetMeshHealthSparseOriginators())
+	}
+	if !cfg.GetMeshHealthSkipClaimWait() || !cfg.GetMeshHealthShortGatewayHold() {
+		t.Error("adaptive mesh health behaviors should be enabled by default")
+	}
+
+	v.Set("meshHealth.liveWithin", "30s")
+	v.Set("meshHealth.sparseNeighbors", 3)
+	v.Set("meshHealth.sparseOriginators", 5)
+	v.Set("meshHealth.skipClaimWaitWhenIsolated", false)
+	v.Set("meshHealth.shortGatewayHoldWhenSparse", false)
+	cfg = New(v)
+	if cfg.GetMeshHealthLiveWithin() != 30*time.Second || cfg.GetMeshHealthSparseNeighbors() != 3 || cfg.GetMeshHealthSparseOriginators() != 5 {
+		t.Errorf("mesh health thresholds = %v, %d, %d; want 30s, 3, 5",
+			cfg.GetMeshHealthLiveWithin(), cfg.GetMeshHealthSparseNeighbors(), cfg.GetMeshHealthSparseOriginators())
+	}
+	if cfg.GetMeshHealthSkipClaimWait() || cfg.GetMeshHealthShortGatewayHold() {
+		t.Error("adaptive mesh health behaviors should be disabled")
+	}
+}
+
+func TestGettersAreRegistered(t *testing.T) {
+	cfg := New(viper.New())
+
+	typ := reflect.TypeOf(cfg)
+	for i := range typ.NumMethod() {
+		method := typ.Method(i)
+		if !strings.HasPrefix(method.Name, "Get") || method.Type.NumIn() != 1 {
+			continue
+		}
+
+		t.Run(method.Name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Errorf("%s() panicked: %v", method.Name, r)
+				}
+			}()
+			method.Func.Call([]reflect.Value{reflect.ValueOf(cfg)})
+		})
+	}
+}
+
+func TestRegistryDefaultsAccepted(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, k := range registry {
+		if seen[k.Name] {
+			t.Errorf("key %s is registered twice", k.Name)
+		}
+		seen[k.Name] = true
+
+		if k.Description == "" {
+			t.Errorf("key %s has no description", k.Name)
+		}
+		if err := k.check(k.Default); err != nil {
+			t.Errorf("key %s rejects its default: %v", k.Name, err)
+		}
+	}
+}
+
+func TestValidate_UnknownKeys(t *testing.T) {
+	v := viper.New()
+	v.Set("ptt.mcastPrt", 5008)
+	v.Set("gatewayMod", true)
+	v.Set("staticRoutes", []map[string]any{{"destination": "192.168.50.0/24", "gateway": "10.41.0.1"}})
+
+	warnings, err := New(v).Validate()
+	if err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	want := []string{"gatewaymod: unknown key, ignored", "ptt.mcastprt: unknown key, ignored"}
+	if !reflect.DeepEqual(warnings, want) {
+		t.Errorf("Validate() warnings = %q, want %q", warnings, want)
+	}
+
+	v.Set("config.strictKeys", true)
+	if _, err := New(v).Validate(); err == nil || !strings.Contains(err.Error(), "ptt.mcastprt") {
+		t.Errorf("Validate() error = %v, want the unknown keys", err)
+	}
+}
+
+func TestValidate_RejectedValues(t *testing.T) {
+	v := viper.New()
+	v.Set("gatewayProbe.port", 70000)
+	v.Set("reservation.ipAllocationStrategy", "round-robin")
+	v.Set("poolAutosize.floor", 64)
+	v.Set("poolAutosize.ceiling", 32)
+
+	cfg := New(v)
+	if got := cfg.GetGatewayProbePort(); got != DefaultGatewayProbePort {
+		t.Errorf("GetGatewayProbePort() = %d, want %d", got, DefaultGatewayProbePort)
+	}
+
+	warnings, err := cfg.Validate()
+	if err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if len(warnings) != 3 {
+		t.Fatalf("Validate() warnings = %q, want 3", warnings)
+	}
+	for i, key := range []string{"reservation.ipAllocationStrategy", "gatewayProbe.port", "poolAutosize.ceiling"} {
+		if !strings.HasPrefix(warnings[i], key+":") {
+			t.Errorf("warning %d = %q, want one about %s", i, warnings[i], key)
+		}
+	}
+}
+
+func TestExampleConfigIsRegistered(t *testing.T) {
+	v := viper.New()
+	v.SetConfigFile("../../example_config.yml")
+	if err := v.ReadInConfig(); err != nil {
+		t.Fatalf("ReadInConfig() error = %v", err)
+	}
+
+	warnings, err := New(v).Validate()
+	if err != nil || len(warnings) > 0 {
+		t.Errorf("Validate() = %q, %v; want no problems", warnings, err)
+	}
+}
@@ -0,0 +1,263 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// key declares one configuration key. The Go type of Default is the type of the key:
+// string, bool, int, int64, uint32, float64, time.Duration, a slice of strings, or a
+// slice of structs decoded through their mapstructure tags.
+type key struct {
+	// Name is the dotted path of the key in the config file.
+	Name        string
+	Default     any
+	Description string
+
+	// Enum lists the accepted values of a string key.
+	Enum []string
+	// Positive rejects numbers that are not greater than zero.
+	Positive bool
+	// Max is the largest accepted number, if non-zero.
+	Max float64
+}
+
+// registry declares every key of the config file, in the order they are documented.
+// Values a key does not accept fall back to its default; an empty string always
+// means the default.
+var registry = []key{
+	{Name: "logLevel", Default: DefaultLogLevel, Description: "Minimum level of the messages logged",
+		Enum: []string{"debug", "info", "warn", "error", "fatal", "panic"}},
+	{Name: "meshNetInterface", Default: DefaultMeshNetInterface, Description: "Bridge interface of the mesh network"},
+	{Name: "gatewayMode", Default: DefaultGatewayMode, Description: "Whether this node is a mesh gateway"},
+	{Name: "safeMode", Default: DefaultSafeMode, Description: "Start with changes to the system suppressed"},
+	{Name: "meshId", Default: DefaultMeshID, Description: "Deployment ID that published records are tagged with and received records must carry"},
+	{Name: "meshIdStrict", Default: DefaultMeshIDStrict, Description: "Exclude records from another mesh rather than only flagging them"},
+	{Name: "meshIdAcceptLegacy", Default: DefaultMeshIDAcceptLegacy, Description: "Treat records without a mesh ID as ours"},
+	{Name: "stateFile", Default: DefaultStateFile, Description: "File runtime state is persisted in"},
+	{Name: "dhcpLeasesFile", Default: DefaultDHCPLeasesFile, Description: "dnsmasq lease database that active DHCP clients are read from"},
+	{Name: "config.strictKeys", Default: DefaultConfigStrictKeys, Description: "Refuse to start when the config file contains unknown keys"},
+
+	{Name: "alfred.mode", Default: DefaultAlfredMode, Description: "Alfred operating mode (primary or secondary)"},
+	{Name: "alfred.batInterface", Default: DefaultAlfredBatInterface, Description: "batman-adv mesh interface"},
+	{Name: "alfred.socketPath", Default: DefaultAlfredSocketPath, Description: "Path of the alfred socket"},
+	{Name: "alfred.callTimeout", Default: DefaultAlfredCallTimeout, Description: "Deadline of a single alfred set or request call", Positive: true},
+	{Name: "alfred.dataTypes.gateway", Default: DefaultAlfredDataTypeGateway, Description: "Exchange gateway records"},
+	{Name: "alfred.dataTypes.node", Default: DefaultAlfredDataTypeNode, Description: "Exchange node records"},
+	{Name: "alfred.dataTypes.position", Default: DefaultAlfredDataTypePosition, Description: "Exchange position records"},
+	{Name: "alfred.dataTypes.addressReservation", Default: DefaultAlfredDataTypeAddressReserv, Description: "Exchange address reservation records"},
+	{Name: "alfred.dataTypes.service", Default: DefaultAlfredDataTypeService, Description: "Exchange service announcements"},
+
+	{Name: "ptt.enable", Default: DefaultPTTEnable, Description: "Enable push-to-talk"},
+	{Name: "ptt.mcastAddr", Default: DefaultPTTMcastAddr, Description: "Multicast group push-to-talk audio is sent to"},
+	{Name: "ptt.mcastPort", Default: DefaultPTTMcastPort, Description: "Port of the push-to-talk multicast group", Positive: true, Max: 65535},
+	{Name: "ptt.mcastTTL", Default: DefaultPTTMcastTTL, Description: "Multicast TTL of push-to-talk audio, the number of routers it may cross plus one", Positive: true, Max: 255},
+	{Name: "ptt.pttKey", Default: DefaultPTTPttKey, Description: "Key that keys the transmitter, or any"},
+	{Name: "ptt.debug", Default: DefaultPTTDebug, Description: "Log push-to-talk debug messages"},
+	{Name: "ptt.loopback", Default: DefaultPTTLoopback, Description: "Play back our own transmissions, setting IP_MULTICAST_LOOP on the send socket"},
+	{Name: "ptt.pttDevice", Default: DefaultPTTPttDevice, Description: "Path of the push-to-talk input device"},
+	{Name: "ptt.pttDeviceName", Default: DefaultPTTPttDeviceName, Description: "Name of the push-to-talk input device"},
+	{Name: "ptt.txLog.path", Default: DefaultPTTTxLogPath, Description: "JSON-lines file completed transmissions are logged to"},
+	{Name: "ptt.txLog.maxSize", Default: int64(DefaultPTTTxLogMaxSize), Description: "Size in bytes at which the transmission log is rotated", Positive: true},
+	{Name: "ptt.txLog.maxBackups", Default: DefaultPTTTxLogMaxBackups, Description: "Number of rotated transmission logs kept", Positive: true},
+	{Name: "ptt.record.enable", Default: DefaultPTTRecordEnable, Description: "Record transmissions to disk"},
+	{Name: "ptt.record.dir", Default: DefaultPTTRecordDir, Description: "Directory recordings are written to"},
+	{Name: "ptt.record.maxTotalSize", Default: int64(DefaultPTTRecordMaxTotalSize), Description: "Total size in bytes recordings may take up", Positive: true},
+
+	{Name: "capacity.warnPct", Default: DefaultCapacityWarnPct, Description: "Address utilization percentage that triggers a capacity warning"},
+	{Name: "capacity.criticalPct", Default: DefaultCapacityCriticalPct, Description: "Address utilization percentage that is reported as critical"},
+
+	{Name: "reservation.pinnedIP", Default: DefaultReservationPinnedIP, Description: "Static IP this node is pinned to"},
+	{Name: "reservation.fallbackOnPinConflict", Default: DefaultFallbackOnPinConflict, Description: "What to do when the pinned IP is taken",
+		Enum: []string{"auto", "fail"}},
+	{Name: "reservation.ipAllocationStrategy", Default: DefaultIPAllocationStrategy, Description: "How a free static IP is picked",
+		Enum: []string{"sequential", "random", "mac-hash"}},
+
+	{Name: "gatewayProbe.enable", Default: DefaultGatewayProbeEnable, Description: "Verify the return path through the selected gateway"},
+	{Name: "gatewayProbe.protocol", Default: DefaultGatewayProbeProtocol, Description: "Protocol gateways are probed with",
+		Enum: []string{"icmp", "udp"}},
+	{Name: "gatewayProbe.port", Default: DefaultGatewayProbePort, Description: "UDP port of the gateway probe responder", Positive: true, Max: 65535},
+	{Name: "gatewayProbe.target", Default: DefaultGatewayProbeTarget, Description: "External address probed through the gateway"},
+	{Name: "gatewayProbe.timeout", Default: DefaultGatewayProbeTimeout, Description: "How long a gateway probe waits for a reply", Positive: true},
+
+	{Name: "addressWatchdog.checkEvery", Default: DefaultAddressCheckEvery, Description: "Receive ticks between mesh address checks", Positive: true},
+	{Name: "addressWatchdog.missThreshold", Default: DefaultAddressMissThreshold, Description: "Failed address checks that trigger the next remediation step", Positive: true},
+	{Name: "addressWatchdog.reprovision", Default: DefaultAddressReprovision, Description: "Reprovision a node that cannot recover its address"},
+
+	{Name: "poolAutosize.enable", Default: DefaultPoolAutosizeEnable, Description: "Resize DHCP pools based on observed usage"},
+	{Name: "poolAutosize.growAt", Default: DefaultPoolAutosizeGrowAt, Description: "Fraction of a DHCP pool in use at which it grows", Positive: true, Max: 1},
+	{Name: "poolAutosize.quietPeriod", Default: DefaultPoolAutosizeQuietPeriod, Description: "How long a DHCP pool must be quiet before it shrinks", Positive: true},
+	{Name: "poolAutosize.floor", Default: DefaultPoolAutosizeFloor, Description: "Smallest size a DHCP pool is shrunk to", Positive: true},
+	{Name: "poolAutosize.ceiling", Default: DefaultPoolAutosizeCeiling, Description: "Largest size a DHCP pool is grown to, at least the floor", Positive: true},
+
+	{Name: "mgmt.maxRecordsPerTick", Default: DefaultMaxRecordsPerTick, Description: "Alfred records of one data type processed per receive tick", Positive: true},
+	{Name: "mgmt.bootstrapGracePeriod", Default: DefaultBootstrapGracePeriod, Description: "How long an unconfigured node that has heard from no peer waits for the mesh to form before selecting an address", Positive: true},
+	{Name: "mgmt.ipAllocationMode", Default: DefaultIPAllocationMode, Description: "Whether unconfigured nodes pick an address themselves or request one from a gateway's block",
+		Enum: []string{"distributed", "delegated"}},
+	{Name: "mgmt.autoZone", Default: DefaultAutoZone, Description: "Firewall zone a new mesh network is added to when no zone covers it"},
+	{Name: "mgmt.dnsmasqInstance", Default: DefaultDnsmasqInstance, Description: "dnsmasq section the mesh DHCP pool is attached to, empty for the main instance"},
+	{Name: "mgmt.openServices", Default: DefaultOpenServices, Description: "Add firewall rules accepting DHCP, DNS and alfred from the zone of the mesh network"},
+	{Name: "mgmt.gatewayMasquerade", Default: DefaultGatewayMasquerade, Description: "Masquerade mesh traffic leaving through the uplink zone while the node is a gateway"},
+	{Name: "mgmt.uplinkZone", Default: DefaultUplinkZone, Description: "Firewall zone of a gateway's uplink"},
+
+	{Name: "delegation.fallbackTimeout", Default: DefaultDelegationFallbackTimeout, Description: "How long a node in delegated mode waits for an address offer before picking one itself", Positive: true},
+
+	{Name: "ubus.enable", Default: DefaultUbusEnable, Description: "Publish openmanetd state on ubus"},
+	{Name: "ubus.socketPath", Default: DefaultUbusSocketPath, Description: "Path of the ubusd socket, also used to reach netifd"},
+
+	{Name: "mesh.configCacheTTL", Default: DefaultMeshConfigCacheTTL, Description: "How long the batman-adv mesh configuration is shared between workers", Positive: true},
+	{Name: "mesh.subnet", Default: DefaultMeshSubnet, Description: "IPv4 subnet of the mesh, a /8 to /23; gateways take its first /24"},
+	{Name: "mesh.excludedRanges", Default: DefaultMeshExcludedRanges, Description: "Ranges of the mesh subnet never handed out as static addresses; set them along with the subnet"},
+	{Name: "mesh.vlans", Default: []MeshVLAN(nil), Description: "Desired batman-adv settings of the mesh VLANs"},
+
+	{Name: "guestIsolation.enable", Default: DefaultGuestIsolationEnable, Description: "Mark guest traffic for batman-adv AP isolation"},
+	{Name: "guestIsolation.section", Default: DefaultGuestIsolationSection, Description: "UCI network section of the guest network"},
+	{Name: "guestIsolation.mark", Default: uint32(DefaultGuestIsolationMark), Description: "Firewall mark that flags guest traffic as isolated"},
+	{Name: "guestIsolation.mask", Default: uint32(DefaultGuestIsolationMask), Description: "Mask of the isolation firewall mark"},
+
+	{Name: "meshHealth.liveWithin", Default: DefaultMeshHealthLiveWithin, Description: "How recently a neighbor must have been heard to count as live", Positive: true},
+	{Name: "meshHealth.sparseNeighbors", Default: DefaultMeshHealthSparseNeighbors, Description: "Live neighbor count below which the mesh is sparse", Positive: true},
+	{Name: "meshHealth.sparseOriginators", Default: DefaultMeshHealthSparseOriginators, Description: "Originator count below which the mesh is sparse", Positive: true},
+	{Name: "meshHealth.skipClaimWaitWhenIsolated", Default: DefaultMeshHealthSkipClaimWait, Description: "Claim an address right away when no neighbor is live"},
+	{Name: "meshHealth.shortGatewayHoldWhenSparse", Default: DefaultMeshHealthShortGatewayHold, Description: "Hold the selected gateway for a shorter time on a sparse mesh"},
+
+	{Name: "meshLog.enable", Default: DefaultMeshLogEnable, Description: "Tail the batman-adv debug log for diagnostics; needs a kernel built with batman-adv debug support"},
+	{Name: "meshLog.retention", Default: DefaultMeshLogRetention, Description: "Number of batman-adv debug log lines kept in memory", Positive: true},
+
+	{Name: "topology.publish", Default: DefaultTopologyPublish, Description: "Publish this node's direct neighbors and their link quality for the mesh topology graph"},
+
+	{Name: "services.publishDNS", Default: DefaultServicesPublishDNS, Description: "Publish announced services as DNS SRV records"},
+	{Name: "services.announce", Default: []Service(nil), Description: "Services this node announces to the mesh"},
+
+	{Name: "staticRoutes", Default: []StaticRoute(nil), Description: "Static routes kept installed across link flaps"},
+
+	{Name: "sourceRouting.priority", Default: DefaultSourceRoutingPriority, Description: "Priority of the first source routing rule; the rules take the priorities after it", Positive: true, Max: 32765},
+	{Name: "sourceRouting.uplinks", Default: []SourceRoutingUplink(nil), Description: "Uplinks of a gateway that the traffic of chosen mesh sources is routed out through"},
+}
+
+// lookupKey returns the registered key name.
+func lookupKey(name string) (key, bool) {
+	i := slices.IndexFunc(registry, func(k key) bool { return k.Name == name })
+	if i < 0 {
+		return key{}, false
+	}
+	return registry[i], true
+}
+
+// load returns the value of k in v, or its default if it is unset or not accepted.
+// problem describes why a value that is set was not accepted.
+func (k key) load(v *viper.Viper) (val any, problem string) {
+	if !v.IsSet(k.Name) {
+		return k.Default, ""
+	}
+
+	val, err := k.read(v)
+	if err != nil {
+		return k.Default, fmt.Sprintf("%s: %v, using the default", k.Name, err)
+	}
+	if s, ok := val.(string); ok && s == "" {
+		return k.Default, ""
+	}
+	if err := k.check(val); err != nil {
+		return k.Default, fmt.Sprintf("%s: %v, using the default %v", k.Name, err, k.Default)
+	}
+
+	return val, ""
+}
+
+// read returns the value of k in v converted to the type of its default.
+func (k key) read(v *viper.Viper) (any, error) {
+	switch k.Default.(type) {
+	case string:
+		return v.GetString(k.Name), nil
+	case bool:
+		return v.GetBool(k.Name), nil
+	case int:
+		return v.GetInt(k.Name), nil
+	case int64:
+		return v.GetInt64(k.Name), nil
+	case uint32:
+		return v.GetUint32(k.Name), nil
+	case float64:
+		return v.GetFloat64(k.Name), nil
+	case time.Duration:
+		return v.GetDuration(k.Name), nil
+	}
+
+	list := reflect.New(reflect.TypeOf(k.Default))
+	if err := v.UnmarshalKey(k.Name, list.Interface()); err != nil {
+		return nil, err
+	}
+	return list.Elem().Interface(), nil
+}
+
+// check returns an error if k does not accept val.
+func (k key) check(val any) error {
+	if s, ok := val.(string); ok {
+		if len(k.Enum) > 0 && !slices.Contains(k.Enum, s) {
+			return fmt.Errorf("%q is not one of %s", s, strings.Join(k.Enum, ", "))
+		}
+		return nil
+	}
+
+	n, ok := number(val)
+	if !ok {
+		return nil
+	}
+	if k.Positive && n <= 0 {
+		return fmt.Errorf("%v is not greater than 0", val)
+	}
+	if k.Max != 0 && n > k.Max {
+		return fmt.Errorf("%v is greater than %v", val, k.Max)
+	}
+
+	return nil
+}
+
+// number returns val as a float64 if it is a number.
+func number(val any) (float64, bool) {
+	switch n := val.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case float64:
+		return n, true
+	case time.Duration:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// unknownKeys returns the keys set in v that are not registered, sorted. viper
+// reports keys in lower case.
+func unknownKeys(v *viper.Viper) []string {
+	var unknown []string
+	for _, name := range v.AllKeys() {
+		if !isKnownKey(name) {
+			unknown = append(unknown, name)
+		}
+	}
+	slices.Sort(unknown)
+
+	return unknown
+}
+
+// isKnownKey reports whether the lower-cased key name is registered, lies inside a
+// registered list, or is a section containing registered keys.
+func isKnownKey(name string) bool {
+	for _, k := range registry {
+		known := strings.ToLower(k.Name)
+		if name == known || strings.HasPrefix(name, known+".") || strings.HasPrefix(known, name+".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,211 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// durationPattern matches the durations accepted by time.ParseDuration.
+const durationPattern = `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$`
+
+// JSONSchema returns a JSON Schema of the config file, generated from the registry.
+//
+// Returns:
+//   - The indented schema document
+//   - An error if it cannot be encoded
+//
+// Example:
+//
+//	schema, err := JSONSchema()
+//	if err == nil {
+//	    os.WriteFile("openmanetd.schema.json", schema, 0o644)
+//	}
+func JSONSchema() ([]byte, error) {
+	root := objectSchema()
+	root["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	root["title"] = "openmanetd configuration"
+
+	for _, k := range registry {
+		parts := strings.Split(k.Name, ".")
+
+		section := root
+		for _, part := range parts[:len(parts)-1] {
+			props := section["properties"].(map[string]any)
+			next, ok := props[part].(map[string]any)
+			if !ok {
+				next = objectSchema()
+				props[part] = next
+			}
+			section = next
+		}
+
+		section["properties"].(map[string]any)[parts[len(parts)-1]] = keySchema(k)
+	}
+
+	return json.MarshalIndent(root, "", "  ")
+}
+
+// objectSchema returns the schema of an object without properties yet.
+func objectSchema() map[string]any {
+	return map[string]any{
+		"type":                 "object",
+		"properties":           map[string]any{},
+		"additionalProperties": false,
+	}
+}
+
+// keySchema returns the schema of the value of k.
+func keySchema(k key) map[string]any {
+	schema := typeSchema(reflect.TypeOf(k.Default))
+	schema["description"] = k.Description
+
+	switch def := k.Default.(type) {
+	case time.Duration:
+		schema["default"] = def.String()
+	case []string:
+		schema["default"] = def
+	default:
+		if reflect.TypeOf(def).Kind() == reflect.Slice {
+			schema["default"] = []any{}
+		} else {
+			schema["default"] = def
+		}
+	}
+
+	if len(k.Enum) > 0 {
+		schema["enum"] = k.Enum
+	}
+	if k.Positive {
+		schema["exclusiveMinimum"] = 0
+	}
+	if k.Max != 0 {
+		schema["maximum"] = k.Max
+	}
+
+	return schema
+}
+
+// typeSchema returns the schema of values of type t. Slices are lists of strings, or
+// of objects described by the mapstructure tags of their element type.
+func typeSchema(t reflect.Type) map[string]any {
+	if t == reflect.TypeOf(time.Duration(0)) {
+		return map[string]any{"type": "string", "pattern": durationPattern}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Uint32:
+		return map[string]any{"type": "integer", "minimum": 0, "maximum": uint32(1<<32 - 1)}
+	case reflect.Int, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": typeSchema(t.Elem())}
+	}
+
+	item := objectSchema()
+	props := item["properties"].(map[string]any)
+	for _, field := range itemFields(t) {
+		props[field.Tag.Get("mapstructure")] = typeSchema(field.Type)
+	}
+	return item
+}
+
+// itemFields returns the fields of a list entry that are read from the config file.
+func itemFields(t reflect.Type) []reflect.StructField {
+	var fields []reflect.StructField
+	for i := range t.NumField() {
+		if field := t.Field(i); field.Tag.Get("mapstructure") != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// ExampleYAML returns an example config file that sets every registered key to its
+// default, each preceded by its description.
+func ExampleYAML() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("# openmanetd configuration\n")
+	buf.WriteString("# Generated by `openmanetd config example`; every key is set to its default.\n")
+
+	var previous []string
+	for _, k := range registry {
+		parts := strings.Split(k.Name, ".")
+
+		// Open the sections the key is in that the previous key was not
+		common := 0
+		for common < len(parts)-1 && common < len(previous)-1 && parts[common] == previous[common] {
+			common++
+		}
+		if common == 0 && len(previous) > 0 && (len(parts) > 1 || len(previous) > 1) {
+			buf.WriteString("\n")
+		}
+		for depth := common; depth < len(parts)-1; depth++ {
+			fmt.Fprintf(&buf, "%s%s:\n", indent(depth), parts[depth])
+		}
+
+		depth := len(parts) - 1
+		fmt.Fprintf(&buf, "%s# %s\n", indent(depth), exampleComment(k))
+		fmt.Fprintf(&buf, "%s%s: %s\n", indent(depth), parts[depth], yamlValue(k.Default))
+
+		previous = parts
+	}
+
+	return buf.Bytes()
+}
+
+// exampleComment describes k in the example config file.
+func exampleComment(k key) string {
+	comment := k.Description
+	if len(k.Enum) > 0 {
+		comment += " (" + strings.Join(k.Enum, ", ") + ")"
+	}
+
+	if t := reflect.TypeOf(k.Default); t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Struct {
+		var names []string
+		for _, field := range itemFields(t.Elem()) {
+			names = append(names, field.Tag.Get("mapstructure"))
+		}
+		comment += "; entries have the keys " + strings.Join(names, ", ")
+	}
+
+	return comment
+}
+
+// indent returns the indentation of a key depth levels deep.
+func indent(depth int) string {
+	return strings.Repeat("  ", depth)
+}
+
+// yamlValue formats a default value for the example config file.
+func yamlValue(val any) string {
+	switch v := val.(type) {
+	case string:
+		return strconv.Quote(v)
+	case time.Duration:
+		return v.String()
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []string:
+		quoted := make([]string, len(v))
+		for i, s := range v {
+			quoted[i] = strconv.Quote(s)
+		}
+		return "[" + strings.Join(quoted, ", ") + "]"
+	}
+
+	if reflect.TypeOf(val).Kind() == reflect.Slice {
+		return "[]"
+	}
+	return fmt.Sprint(val)
+}
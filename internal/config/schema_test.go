@@ -0,0 +1,80 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestExampleYAML(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	if err := v.ReadConfig(bytes.NewReader(ExampleYAML())); err != nil {
+		t.Fatalf("ReadConfig() error = %v\n%s", err, ExampleYAML())
+	}
+
+	cfg := New(v)
+	warnings, err := cfg.Validate()
+	if err != nil || len(warnings) > 0 {
+		t.Fatalf("Validate() = %q, %v; want no problems", warnings, err)
+	}
+
+	for _, k := range registry {
+		if !v.IsSet(k.Name) {
+			t.Errorf("example does not set %s", k.Name)
+			continue
+		}
+
+		got := cfg.values[k.Name]
+		if def := reflect.ValueOf(k.Default); def.Kind() == reflect.Slice {
+			if reflect.ValueOf(got).Len() != def.Len() || def.Len() > 0 && !reflect.DeepEqual(got, k.Default) {
+				t.Errorf("%s = %v, want the default %v", k.Name, got, k.Default)
+			}
+			continue
+		}
+		if got != k.Default {
+			t.Errorf("%s = %v, want the default %v", k.Name, got, k.Default)
+		}
+	}
+}
+
+func TestJSONSchema(t *testing.T) {
+	raw, err := JSONSchema()
+	if err != nil {
+		t.Fatalf("JSONSchema() error = %v", err)
+	}
+
+	var schema map[string]any
+	if err := json.Unmarshal(raw, &schema); err != nil {
+		t.Fatalf("JSONSchema() is not valid JSON: %v", err)
+	}
+
+	for _, k := range registry {
+		node := schema
+		for _, part := range strings.Split(k.Name, ".") {
+			props, _ := node["properties"].(map[string]any)
+			next, ok := props[part].(map[string]any)
+			if !ok {
+				t.Fatalf("schema has no property for %s", k.Name)
+			}
+			node = next
+		}
+
+		if node["description"] != k.Description {
+			t.Errorf("%s description = %v, want %q", k.Name, node["description"], k.Description)
+		}
+		if len(k.Enum) > 0 && len(node["enum"].([]any)) != len(k.Enum) {
+			t.Errorf("%s enum = %v, want %v", k.Name, node["enum"], k.Enum)
+		}
+	}
+
+	routes := schema["properties"].(map[string]any)["staticRoutes"].(map[string]any)
+	item := routes["items"].(map[string]any)["properties"].(map[string]any)
+	if _, ok := item["destination"]; !ok {
+		t.Errorf("staticRoutes items = %v, want a destination property", item)
+	}
+}
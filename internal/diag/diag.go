@@ -0,0 +1,156 @@
+// Package diag collects a troubleshooting bundle from a node.
+//
+// A bundle is a gzipped tarball holding one file per source plus a manifest.json
+// describing what was collected. Sources are independent: one that fails is recorded
+// in the manifest with its error and the rest are still collected, so a bundle from
+// a half broken node is still useful. Secrets are redacted from every file before it
+// is written.
+package diag
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ManifestName is the name of the manifest inside the bundle.
+const ManifestName string = "manifest.json"
+
+// Source is one piece of diagnostic data, written to the bundle under Name.
+type Source struct {
+	Name    string
+	Collect func(ctx context.Context) ([]byte, error)
+}
+
+// ManifestEntry records the outcome of collecting one source.
+type ManifestEntry struct {
+	Name     string `json:"name"`
+	Size     int    `json:"size"`
+	Redacted int    `json:"redacted,omitempty"`
+	Duration string `json:"duration"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Manifest describes the contents of a bundle.
+type Manifest struct {
+	Version   string          `json:"version"`
+	Hostname  string          `json:"hostname,omitempty"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Entries   []ManifestEntry `json:"entries"`
+}
+
+// Options controls how a bundle is written.
+type Options struct {
+	// Version is the openmanetd version recorded in the manifest.
+	Version string
+	// Hostname is recorded in the manifest.
+	Hostname string
+	// Redact lists the option and key names whose values are replaced.
+	Redact []string
+	// Now returns the bundle timestamp. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// WriteBundle collects every source and writes the bundle to w.
+//
+// A source that returns an error is recorded in the manifest and skipped; whatever
+// data it returned alongside the error is still written. Only failures to write the
+// bundle itself are returned.
+//
+// Parameters:
+//   - ctx: Passed to every source; collection stops early once it is done.
+//   - w: Destination for the gzipped tarball.
+//   - sources: The sources to collect, written in order.
+//   - opts: Manifest metadata and the redaction list.
+//
+// Returns:
+//   - The manifest written into the bundle
+//   - An error if the bundle could not be written
+//
+// Example:
+//
+//	f, _ := os.Create("bundle.tar.gz")
+//	defer f.Close()
+//	manifest, err := diag.WriteBundle(ctx, f, sources, diag.Options{Redact: diag.DefaultRedactions})
+func WriteBundle(ctx context.Context, w io.Writer, sources []Source, opts Options) (*Manifest, error) {
+	now := time.Now
+	if opts.Now != nil {
+		now = opts.Now
+	}
+
+	manifest := &Manifest{
+		Version:   opts.Version,
+		Hostname:  opts.Hostname,
+		CreatedAt: now().UTC(),
+		Entries:   make([]ManifestEntry, 0, len(sources)),
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	for _, src := range sources {
+		entry := ManifestEntry{Name: src.Name}
+
+		if err := ctx.Err(); err != nil {
+			entry.Error = err.Error()
+			manifest.Entries = append(manifest.Entries, entry)
+			continue
+		}
+
+		start := now()
+		data, err := src.Collect(ctx)
+		entry.Duration = now().Sub(start).String()
+		if err != nil {
+			entry.Error = err.Error()
+		}
+
+		if len(data) > 0 {
+			data, entry.Redacted = Redact(data, opts.Redact)
+			entry.Size = len(data)
+			if err := writeFile(tw, src.Name, data, manifest.CreatedAt); err != nil {
+				return nil, err
+			}
+		}
+
+		manifest.Entries = append(manifest.Entries, entry)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	if err := writeFile(tw, ManifestName, data, manifest.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close bundle archive: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close bundle compression: %w", err)
+	}
+
+	return manifest, nil
+}
+
+func writeFile(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0o600,
+		Size:    int64(len(data)),
+		ModTime: modTime,
+	}
+
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("failed to write %s to bundle: %w", name, err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("failed to write %s to bundle: %w", name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,241 @@
+package diag
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readBundle returns the files in a bundle keyed by name.
+func readBundle(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("gzip.NewReader() error = %v", err)
+	}
+	tr := tar.NewReader(gz)
+
+	files := make(map[string]string)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("tar Next() error = %v", err)
+		}
+		body, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("reading %s error = %v", hdr.Name, err)
+		}
+		files[hdr.Name] = string(body)
+	}
+
+	return files
+}
+
+func staticSource(name, data string) Source {
+	return Source{Name: name, Collect: func(context.Context) ([]byte, error) { return []byte(data), nil }}
+}
+
+func TestWriteBundle_Structure(t *testing.T) {
+	created := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	sources := []Source{
+		staticSource("version.json", `{"version": "1.2.3"}`),
+		staticSource("uci/network", "config interface 'ahwlan'\n\toption proto 'static'\n"),
+		staticSource("routes.txt", "default via 10.41.0.1 dev br-ahwlan\n"),
+	}
+
+	var buf bytes.Buffer
+	manifest, err := WriteBundle(context.Background(), &buf, sources, Options{
+		Version:  "1.2.3",
+		Hostname: "node1",
+		Now:      func() time.Time { return created },
+	})
+	if err != nil {
+		t.Fatalf("WriteBundle() error = %v", err)
+	}
+
+	files := readBundle(t, buf.Bytes())
+	if len(files) != len(sources)+1 {
+		t.Errorf("bundle has %d files, want %d", len(files), len(sources)+1)
+	}
+	for _, src := range sources {
+		if _, ok := files[src.Name]; !ok {
+			t.Errorf("bundle is missing %s", src.Name)
+		}
+	}
+	if got := files["routes.txt"]; got != "default via 10.41.0.1 dev br-ahwlan\n" {
+		t.Errorf("routes.txt = %q", got)
+	}
+
+	var written Manifest
+	if err := json.Unmarshal([]byte(files[ManifestName]), &written); err != nil {
+		t.Fatalf("manifest does not parse: %v", err)
+	}
+	if written.Version != "1.2.3" || written.Hostname != "node1" || !written.CreatedAt.Equal(created) {
+		t.Errorf("manifest header = %+v", written)
+	}
+	if len(written.Entries) != len(sources) {
+		t.Fatalf("manifest has %d entries, want %d", len(written.Entries), len(sources))
+	}
+	for i, entry := range written.Entries {
+		if entry.Name != sources[i].Name {
+			t.Errorf("entry %d name = %s, want %s", i, entry.Name, sources[i].Name)
+		}
+		if entry.Size != len(files[entry.Name]) {
+			t.Errorf("entry %s size = %d, want %d", entry.Name, entry.Size, len(files[entry.Name]))
+		}
+		if entry.Error != "" {
+			t.Errorf("entry %s error = %s", entry.Name, entry.Error)
+		}
+	}
+	if len(manifest.Entries) != len(written.Entries) {
+		t.Errorf("returned manifest has %d entries, written has %d", len(manifest.Entries), len(written.Entries))
+	}
+}
+
+func TestWriteBundle_Redaction(t *testing.T) {
+	wireless := `config wifi-iface 'mesh'
+	option mode 'mesh'
+	option encryption 'sae'
+	option key 'correct horse battery staple'
+	option mesh_id 'openmanet'
+`
+	config := "pttKey: KEY_F1\npassword: hunter2\n"
+
+	var buf bytes.Buffer
+	manifest, err := WriteBundle(context.Background(), &buf, []Source{
+		staticSource("uci/wireless", wireless),
+		staticSource("config/config.yml", config),
+	}, Options{Redact: DefaultRedactions})
+	if err != nil {
+		t.Fatalf("WriteBundle() error = %v", err)
+	}
+
+	files := readBundle(t, buf.Bytes())
+	for name, body := range files {
+		if strings.Contains(body, "correct horse") || strings.Contains(body, "hunter2") {
+			t.Errorf("%s leaks a secret:\n%s", name, body)
+		}
+	}
+	if !strings.Contains(files["uci/wireless"], "option key '"+Redacted+"'") {
+		t.Errorf("uci/wireless key not redacted:\n%s", files["uci/wireless"])
+	}
+	if !strings.Contains(files["uci/wireless"], "option mesh_id 'openmanet'") {
+		t.Errorf("uci/wireless lost a non-secret option:\n%s", files["uci/wireless"])
+	}
+	if !strings.Contains(files["config/config.yml"], "pttKey: KEY_F1") {
+		t.Errorf("config.yml redacted pttKey:\n%s", files["config/config.yml"])
+	}
+
+	if got := manifest.Entries[0].Redacted; got != 1 {
+		t.Errorf("uci/wireless redacted = %d, want 1", got)
+	}
+	if got := manifest.Entries[1].Redacted; got != 1 {
+		t.Errorf("config.yml redacted = %d, want 1", got)
+	}
+}
+
+func TestWriteBundle_PartialFailure(t *testing.T) {
+	var buf bytes.Buffer
+	manifest, err := WriteBundle(context.Background(), &buf, []Source{
+		staticSource("uci/network", "config interface 'ahwlan'\n"),
+		{Name: "batman/mesh.json", Collect: func(context.Context) ([]byte, error) {
+			return nil, errors.New("batctl: not found")
+		}},
+		{Name: "interfaces.txt", Collect: func(context.Context) ([]byte, error) {
+			return []byte("1: lo mtu 65536\n"), errors.New("wlan0: failed to list addresses")
+		}},
+		staticSource("routes.txt", "default via 10.41.0.1\n"),
+	}, Options{})
+	if err != nil {
+		t.Fatalf("WriteBundle() error = %v", err)
+	}
+
+	files := readBundle(t, buf.Bytes())
+	if _, ok := files["batman/mesh.json"]; ok {
+		t.Error("failed source without data was written to the bundle")
+	}
+	for _, name := range []string{"uci/network", "interfaces.txt", "routes.txt", ManifestName} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("bundle is missing %s", name)
+		}
+	}
+
+	errs := make(map[string]string)
+	for _, entry := range manifest.Entries {
+		errs[entry.Name] = entry.Error
+	}
+	if errs["batman/mesh.json"] != "batctl: not found" {
+		t.Errorf("batman/mesh.json error = %q", errs["batman/mesh.json"])
+	}
+	if errs["interfaces.txt"] == "" {
+		t.Error("interfaces.txt error was not recorded")
+	}
+	if errs["routes.txt"] != "" {
+		t.Errorf("routes.txt error = %q, want none", errs["routes.txt"])
+	}
+}
+
+func TestWriteBundle_CancelledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	called := false
+	var buf bytes.Buffer
+	manifest, err := WriteBundle(ctx, &buf, []Source{
+		{Name: "routes.txt", Collect: func(context.Context) ([]byte, error) {
+			called = true
+			return nil, nil
+		}},
+	}, Options{})
+	if err != nil {
+		t.Fatalf("WriteBundle() error = %v", err)
+	}
+
+	if called {
+		t.Error("source was collected after the context was done")
+	}
+	if manifest.Entries[0].Error == "" {
+		t.Error("skipped source was not recorded in the manifest")
+	}
+}
+
+func TestTailFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "openmanetd.log")
+	if err := os.WriteFile(path, []byte("line one\nline two\nline three\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		maxBytes int64
+		want     string
+	}{
+		{"whole file", 1024, "line one\nline two\nline three\n"},
+		{"tail only", 11, "line three\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tailFile(path, tt.maxBytes)(context.Background())
+			if err != nil {
+				t.Fatalf("tailFile() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("tailFile() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package diag
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces the value of every redacted option or key.
+const Redacted string = "<redacted>"
+
+// DefaultRedactions are the UCI options and config keys that hold secrets, such as
+// the mesh SAE key in the wireless config.
+var DefaultRedactions = []string{
+	"key",
+	"sae_password",
+	"password",
+	"psk",
+	"auth_secret",
+	"acct_secret",
+	"private_key",
+	"preshared_key",
+}
+
+// Redact replaces the values of the named options and keys in data.
+//
+// It understands the formats found in a bundle: UCI option and list lines,
+// "name": "value" pairs in JSON, and name: value lines in YAML. Names must match
+// exactly, so a list entry "key" does not redact "pttKey".
+//
+// Returns the redacted data and the number of values replaced.
+func Redact(data []byte, names []string) ([]byte, int) {
+	if len(names) == 0 {
+		return data, 0
+	}
+
+	quoted := make([]string, 0, len(names))
+	for _, name := range names {
+		if name != "" {
+			quoted = append(quoted, regexp.QuoteMeta(name))
+		}
+	}
+	if len(quoted) == 0 {
+		return data, 0
+	}
+	alt := strings.Join(quoted, "|")
+
+	patterns := []struct {
+		re   *regexp.Regexp
+		repl string
+	}{
+		// UCI: option key 'secret' / list key "secret"
+		{regexp.MustCompile(`(?m)^(\s*(?:option|list)\s+['"]?(?:` + alt + `)['"]?\s+).+$`), "${1}'" + Redacted + "'"},
+		// JSON: "key": "secret"
+		{regexp.MustCompile(`("(?:` + alt + `)"\s*:\s*)"(?:[^"\\]|\\.)*"`), `${1}"` + Redacted + `"`},
+		// YAML: key: secret
+		{regexp.MustCompile(`(?m)^(\s*(?:` + alt + `)\s*:\s+)[^\s#].*$`), "${1}" + Redacted},
+	}
+
+	count := 0
+	for _, p := range patterns {
+		count += len(p.re.FindAllIndex(data, -1))
+		data = p.re.ReplaceAll(data, []byte(p.repl))
+	}
+
+	return data, count
+}
@@ -0,0 +1,68 @@
+package diag
+
+import "testing"
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		names     []string
+		want      string
+		wantCount int
+	}{
+		{
+			name:      "uci option",
+			input:     "\toption key 'secret'\n\toption ssid 'mesh'\n",
+			names:     []string{"key"},
+			want:      "\toption key '<redacted>'\n\toption ssid 'mesh'\n",
+			wantCount: 1,
+		},
+		{
+			name:      "uci list and quoted name",
+			input:     "\tlist 'password' \"a b\"\n",
+			names:     []string{"password"},
+			want:      "\tlist 'password' '<redacted>'\n",
+			wantCount: 1,
+		},
+		{
+			name:      "json pair",
+			input:     `{"sae_password": "s\"ecret", "mode": "mesh"}`,
+			names:     []string{"sae_password"},
+			want:      `{"sae_password": "<redacted>", "mode": "mesh"}`,
+			wantCount: 1,
+		},
+		{
+			name:      "yaml key",
+			input:     "psk: secret\npttKey: KEY_F1\n",
+			names:     []string{"psk", "key"},
+			want:      "psk: <redacted>\npttKey: KEY_F1\n",
+			wantCount: 1,
+		},
+		{
+			name:      "option name containing a listed name",
+			input:     "\toption key_mgmt 'sae'\n",
+			names:     []string{"key"},
+			want:      "\toption key_mgmt 'sae'\n",
+			wantCount: 0,
+		},
+		{
+			name:      "empty list",
+			input:     "\toption key 'secret'\n",
+			names:     nil,
+			want:      "\toption key 'secret'\n",
+			wantCount: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, count := Redact([]byte(tt.input), tt.names)
+			if string(got) != tt.want {
+				t.Errorf("Redact() = %q, want %q", got, tt.want)
+			}
+			if count != tt.wantCount {
+				t.Errorf("Redact() count = %d, want %d", count, tt.wantCount)
+			}
+		})
+	}
+}
@@ -0,0 +1,286 @@
+package diag
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/digineo/go-uci/v2"
+	"github.com/openmanet/go-alfred"
+	proto "github.com/openmanet/openmanetd/internal/api/openmanet/v1"
+	batmanadv "github.com/openmanet/openmanetd/internal/batman-adv"
+	"github.com/openmanet/openmanetd/internal/config"
+	"github.com/openmanet/openmanetd/internal/mgmt"
+	"github.com/openmanet/openmanetd/internal/network"
+	"github.com/openmanet/openmanetd/internal/safemode"
+	"github.com/rs/zerolog"
+	"github.com/vishvananda/netlink"
+	"google.golang.org/protobuf/encoding/protojson"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+// DefaultLogMaxBytes caps the log excerpt taken from the end of the log file.
+const DefaultLogMaxBytes int64 = 1 << 20
+
+// DefaultUCIConfigs are the UCI configs copied into the bundle.
+var DefaultUCIConfigs = []string{"network", "dhcp", "openmanetd", "wireless"}
+
+// SourceConfig tells DefaultSources where to find the node's state.
+type SourceConfig struct {
+	Version          string
+	UCIDir           string
+	MeshInterface    string
+	AlfredSocketPath string
+	StatePath        string
+	ConfigFile       string
+	LogPath          string
+	LogMaxBytes      int64
+	// MeshLogWindow is how long the batman-adv debug log is tailed; zero leaves it out.
+	MeshLogWindow time.Duration
+}
+
+// DefaultSources returns the sources that make up a bundle for the node described by
+// cfg. Sources that need something cfg does not provide, such as a log path, are
+// left out.
+func DefaultSources(cfg SourceConfig) []Source {
+	sources := []Source{
+		{Name: "version.json", Collect: func(context.Context) ([]byte, error) { return versionInfo(cfg.Version) }},
+	}
+
+	for _, name := range DefaultUCIConfigs {
+		path := filepath.Join(cfg.UCIDir, name)
+		sources = append(sources, Source{Name: "uci/" + name, Collect: readFile(path)})
+	}
+	sources = append(sources, Source{Name: "uci/interfaces.json", Collect: jsonOf(func() (any, error) {
+		return network.GetAllUCINetworksWithReader(network.NewUCINetworkConfigReaderWithTree(uci.NewTree(cfg.UCIDir)))
+	})})
+
+	sources = append(sources,
+		Source{Name: "routes.txt", Collect: collectRoutes},
+		Source{Name: "rules.txt", Collect: collectRules},
+		Source{Name: "interfaces.txt", Collect: collectInterfaces},
+		Source{Name: "batman/mesh.json", Collect: jsonOf(func() (any, error) { return batmanadv.GetMeshConfig(cfg.MeshInterface) })},
+		Source{Name: "batman/gateways.json", Collect: jsonOf(func() (any, error) { return batmanadv.GetMeshGateways(cfg.MeshInterface) })},
+		Source{Name: "batman/originators.json", Collect: jsonOf(func() (any, error) { return batmanadv.GetMeshOriginators(cfg.MeshInterface) })},
+		Source{Name: "batman/neighbors.json", Collect: jsonOf(func() (any, error) { return batmanadv.GetMeshNeighbors(cfg.MeshInterface) })},
+		Source{Name: "alfred/reservations.json", Collect: alfredRecords(cfg.AlfredSocketPath, mgmt.AddressReservationDataType, func() protobuf.Message { return &proto.AddressReservation{} })},
+		Source{Name: "alfred/gateways.json", Collect: alfredRecords(cfg.AlfredSocketPath, mgmt.GatewayDataType, func() protobuf.Message { return &proto.Gateway{} })},
+		Source{Name: "alfred/nodes.json", Collect: alfredRecords(cfg.AlfredSocketPath, mgmt.NodeDataType, func() protobuf.Message { return &proto.Node{} })},
+		Source{Name: "alfred/services.json", Collect: alfredRecords(cfg.AlfredSocketPath, mgmt.ServiceDataType, func() protobuf.Message { return &proto.ServiceAnnouncements{} })},
+		Source{Name: "state.json", Collect: readFile(cfg.StatePath)},
+		Source{Name: "safemode.json", Collect: jsonOf(func() (any, error) {
+			on, err := safemode.ReadState(safemode.DefaultRunDir)
+			return map[string]bool{"enabled": on}, err
+		})},
+	)
+
+	if cfg.ConfigFile != "" {
+		sources = append(sources, Source{Name: "config/" + filepath.Base(cfg.ConfigFile), Collect: readFile(cfg.ConfigFile)})
+	}
+
+	if cfg.MeshLogWindow > 0 {
+		sources = append(sources, Source{Name: "batman/log.txt", Collect: meshLog(cfg.MeshInterface, cfg.MeshLogWindow)})
+	}
+
+	if cfg.LogPath != "" {
+		maxBytes := cfg.LogMaxBytes
+		if maxBytes <= 0 {
+			maxBytes = DefaultLogMaxBytes
+		}
+		sources = append(sources, Source{Name: "logs/" + filepath.Base(cfg.LogPath), Collect: tailFile(cfg.LogPath, maxBytes)})
+	}
+
+	return sources
+}
+
+// meshLog tails the batman-adv debug log of iface for window.
+func meshLog(iface string, window time.Duration) func(context.Context) ([]byte, error) {
+	return func(ctx context.Context) ([]byte, error) {
+		lines, err := batmanadv.ReadMeshLog(ctx, iface, window)
+		if err != nil {
+			return nil, err
+		}
+
+		var b strings.Builder
+		for _, line := range lines {
+			b.WriteString(line.String())
+			b.WriteByte('\n')
+		}
+		return []byte(b.String()), nil
+	}
+}
+
+func readFile(path string) func(context.Context) ([]byte, error) {
+	return func(context.Context) ([]byte, error) {
+		return os.ReadFile(path)
+	}
+}
+
+// tailFile reads at most maxBytes from the end of the file at path.
+func tailFile(path string, maxBytes int64) func(context.Context) ([]byte, error) {
+	return func(context.Context) ([]byte, error) {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		info, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+
+		if offset := info.Size() - maxBytes; offset > 0 {
+			if _, err := f.Seek(offset, io.SeekStart); err != nil {
+				return nil, err
+			}
+		}
+
+		return io.ReadAll(io.LimitReader(f, maxBytes))
+	}
+}
+
+func jsonOf(get func() (any, error)) func(context.Context) ([]byte, error) {
+	return func(context.Context) ([]byte, error) {
+		v, err := get()
+		if err != nil {
+			return nil, err
+		}
+		return json.MarshalIndent(v, "", "  ")
+	}
+}
+
+func versionInfo(version string) ([]byte, error) {
+	info := map[string]string{
+		"version":   version,
+		"goVersion": runtime.Version(),
+		"os":        runtime.GOOS,
+		"arch":      runtime.GOARCH,
+	}
+
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range build.Settings {
+			switch s.Key {
+			case "vcs.revision", "vcs.time", "vcs.modified":
+				info[s.Key] = s.Value
+			}
+		}
+	}
+
+	return json.MarshalIndent(info, "", "  ")
+}
+
+func collectRoutes(context.Context) ([]byte, error) {
+	routes, err := network.GetAllRoutes()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	for _, route := range routes {
+		fmt.Fprintf(&buf, "%s table %d proto %d scope %s\n", route, route.Table, route.Protocol, route.Scope)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func collectRules(context.Context) ([]byte, error) {
+	rules, err := network.GetRules()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	for _, rule := range rules {
+		fmt.Fprintln(&buf, rule.String())
+	}
+
+	return buf.Bytes(), nil
+}
+
+func collectInterfaces(context.Context) ([]byte, error) {
+	links, err := netlink.LinkList()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list interfaces: %w", err)
+	}
+
+	var (
+		buf  bytes.Buffer
+		errs []error
+	)
+	for _, link := range links {
+		attrs := link.Attrs()
+		fmt.Fprintf(&buf, "%d: %s mtu %d state %s flags %s mac %s\n", attrs.Index, attrs.Name, attrs.MTU, attrs.OperState, attrs.Flags, attrs.HardwareAddr)
+
+		addrs, err := netlink.AddrList(link, netlink.FAMILY_ALL)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: failed to list addresses: %w", attrs.Name, err))
+		}
+		for _, addr := range addrs {
+			fmt.Fprintf(&buf, "    %s %s\n", family(addr.IP), addr.IPNet)
+		}
+
+		if s := attrs.Statistics; s != nil {
+			fmt.Fprintf(&buf, "    rx bytes %d packets %d errors %d dropped %d\n", s.RxBytes, s.RxPackets, s.RxErrors, s.RxDropped)
+			fmt.Fprintf(&buf, "    tx bytes %d packets %d errors %d dropped %d\n", s.TxBytes, s.TxPackets, s.TxErrors, s.TxDropped)
+		}
+	}
+
+	return buf.Bytes(), errors.Join(errs...)
+}
+
+func family(ip net.IP) string {
+	if ip.To4() != nil {
+		return "inet"
+	}
+	return "inet6"
+}
+
+// alfredRecords fetches every record of dataType, including records from other
+// meshes, and decodes them with newMsg. Records that fail to decode are kept as
+// an error entry so the bundle shows they were there.
+func alfredRecords(socketPath string, dataType uint8, newMsg func() protobuf.Message) func(context.Context) ([]byte, error) {
+	return func(ctx context.Context) ([]byte, error) {
+		client, err := mgmt.NewAlfredClient(socketPath, config.DefaultAlfredCallTimeout, zerolog.Nop())
+		if err != nil {
+			return nil, err
+		}
+
+		records, err := client.RequestCtx(ctx, dataType)
+		if err != nil {
+			return nil, err
+		}
+
+		return decodeRecords(records, newMsg)
+	}
+}
+
+func decodeRecords(records []alfred.Record, newMsg func() protobuf.Message) ([]byte, error) {
+	entries := make([]json.RawMessage, 0, len(records))
+	for _, rec := range records {
+		msg := newMsg()
+		if err := protobuf.Unmarshal(rec.Data, msg); err != nil {
+			entry, _ := json.Marshal(map[string]string{"error": err.Error()})
+			entries = append(entries, entry)
+			continue
+		}
+
+		entry, err := protojson.Marshal(msg)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return json.MarshalIndent(entries, "", "  ")
+}
@@ -1,44 +1,178 @@
 package mgmt
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net"
 	"os"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/openmanet/go-alfred"
 	proto "github.com/openmanet/openmanetd/internal/api/openmanet/v1"
-	batmanadv "github.com/openmanet/openmanetd/internal/batman-adv"
 	"github.com/openmanet/openmanetd/internal/network"
+	"github.com/openmanet/openmanetd/internal/safemode"
 	"github.com/openmanet/openmanetd/internal/system"
 )
 
 const (
 	AddressReservationDataType        uint8 = uint8(proto.DataType_DATA_TYPE_ADDRESS_RESERVATION)
-	AddressReservationDataTypeVersion uint8 = 1
+	AddressReservationDataTypeVersion uint8 = 2
 )
 
 type AddressReservationWorker struct {
+	// Config holds the settings fixed at startup, Deps the shared runtime
+	// dependencies and Tunables the settings that may change between ticks.
 	Config       *ManagementConfig
-	Client       *alfred.Client
+	Deps         Deps
+	Tunables     TunablesProvider
 	ShutdownChan <-chan os.Signal
 
 	sendInterval time.Duration
 	recvInterval time.Duration
+
+	// recvTicks measures the receive ticks and keeps them from overlapping.
+	recvTicks *TickMonitor
+
+	// commits holds UCI commits deferred because the overlay was read-only.
+	commits *CommitQueue
+
+	// reservations holds the confirmed reservations advertised by peers.
+	reservations *ReservationTable
+	hostsPath    string
+	capacity     *CapacityMonitor
+
+	// records tracks the age of received reservations; conflicts and invalidHosts
+	// hold the reservation conflicts and invalid host entries already reported.
+	records      *RecordTracker
+	conflicts    map[ReservationConflict]bool
+	invalidHosts map[network.HostEntry]bool
+
+	// watchdog checks that the interface carries its address once configured.
+	watchdog *AddressWatchdog
+
+	// autosize is nil unless pool autosizing is enabled. state holds the pool usage
+	// history and the pending configuration.
+	autosize *PoolAutosizeConfig
+	state    *StateStore
+
+	// leasesPath is the dnsmasq lease database, read for pool autosizing and so that
+	// a newly selected address is not one a DHCP client holds.
+	leasesPath string
+
+	// bootstrap keeps an unconfigured node from selecting an address before it
+	// can see its peers.
+	bootstrap *BootstrapGate
+
+	// owner and request are nil unless addresses are delegated. owner answers the
+	// requests of other nodes while this node is a configured gateway; request asks a
+	// block owner for an address while this node is unconfigured.
+	owner   *BlockOwner
+	request *BlockRequest
+
+	// claimStarted is when this node first found itself unconfigured; it claims an
+	// address once the claim wait has passed since.
+	claimStarted time.Time
+
+	// wake triggers a receive pass ahead of the ticker, e.g. when safe mode is left.
+	wake chan struct{}
+	// republish triggers publishing our reservation ahead of the next request,
+	// e.g. after a rename.
+	republish chan struct{}
+
+	// advertised is the reservation this node last built for publication, published
+	// once more on shutdown. Nil until the node is configured.
+	advertised atomic.Pointer[proto.AddressReservation]
+
+	// lastTunables are the tunables of the most recent tick.
+	lastTunables atomic.Pointer[Tunables]
+}
+
+func NewAddressReservationWorker(config *ManagementConfig, client *AlfredClient, shutdownChan <-chan os.Signal) *AddressReservationWorker {
+	return NewAddressReservationWorkerWithDeps(config, config.deps.withClient(client), config, shutdownChan)
 }
 
-func NewAddressReservationWorker(config *ManagementConfig, client *alfred.Client, shutdownChan <-chan os.Signal) *AddressReservationWorker {
-	config.Log.Info().Msg("AddressReservationWorker initialized")
+// NewAddressReservationWorkerWithDeps creates an address reservation worker that uses
+// deps and takes a snapshot of tunables at the start of every tick.
+func NewAddressReservationWorkerWithDeps(config *ManagementConfig, deps Deps, tunables TunablesProvider, shutdownChan <-chan os.Signal) *AddressReservationWorker {
+	deps.Log.Info().Msg("AddressReservationWorker initialized")
 
-	return &AddressReservationWorker{
+	thresholds := CapacityThresholds{
+		WarnPct:     config.CapacityWarnPct,
+		CriticalPct: config.CapacityCriticalPct,
+	}
+	if thresholds.WarnPct <= 0 {
+		thresholds.WarnPct = DefaultCapacityWarnPct
+	}
+	if thresholds.CriticalPct <= 0 {
+		thresholds.CriticalPct = DefaultCapacityCriticalPct
+	}
+
+	arw := &AddressReservationWorker{
 		Config:       config,
-		Client:       client,
+		Deps:         deps,
+		Tunables:     tunables,
 		ShutdownChan: shutdownChan,
 
 		sendInterval: config.addressReservationWorkerSendInterval,
 		recvInterval: config.addressReservationWorkerRecvInterval,
+		recvTicks:    NewTickMonitor("address reservation receive", config.addressReservationWorkerRecvInterval, deps.Log),
+
+		commits:      NewCommitQueue(deps.Log),
+		reservations: NewReservationTable(DefaultReservationTTL),
+		hostsPath:    network.DefaultDnsmasqHostsPath,
+		capacity:     NewCapacityMonitor(thresholds),
+		leasesPath:   config.dhcpLeasesPath(),
+
+		records:      NewRecordTracker(DefaultReservationTTL),
+		conflicts:    make(map[ReservationConflict]bool),
+		invalidHosts: make(map[network.HostEntry]bool),
+
+		bootstrap: NewBootstrapGate(config.BootstrapGracePeriod),
+
+		wake:      make(chan struct{}, 1),
+		republish: make(chan struct{}, 1),
+	}
+	safemode.OnExit(arw.wakeUp)
+	arw.watchdog = NewAddressWatchdog(deps.Log, config.AddressCheckEvery, config.AddressMissThreshold, config.AddressReprovision, arw.remediateAddress)
+
+	if config.PoolAutosizeEnable {
+		arw.autosize = &PoolAutosizeConfig{
+			GrowAt:      config.PoolGrowAt,
+			QuietPeriod: config.PoolQuietPeriod,
+			Floor:       config.PoolFloor,
+			Ceiling:     config.PoolCeiling,
+		}
+		if arw.autosize.GrowAt <= 0 {
+			arw.autosize.GrowAt = DefaultPoolGrowAt
+		}
+		if arw.autosize.QuietPeriod <= 0 {
+			arw.autosize.QuietPeriod = DefaultPoolQuietPeriod
+		}
+		if arw.autosize.Floor <= 0 {
+			arw.autosize.Floor = network.DefaultDHCPAddressLimit
+		}
+		if arw.autosize.Ceiling < arw.autosize.Floor {
+			arw.autosize.Ceiling = max(DefaultPoolCeiling, arw.autosize.Floor)
+		}
+		// A larger pool cannot fit in the gateway /24
+		arw.autosize.Ceiling = min(arw.autosize.Ceiling, poolMaxOffset)
 	}
+
+	arw.state = deps.State
+	if arw.state == nil {
+		arw.state = OpenStateStore(config.StatePath, deps.Log)
+	}
+
+	if config.IPAllocationMode == IPAllocationDelegated {
+		arw.owner = NewBlockOwner(config.addressing(), network.SequentialAllocator{}, arw.state, deps.Log)
+		arw.request = NewBlockRequest(config.DelegationFallbackTimeout, deps.Log)
+	}
+
+	return arw
 }
 
 // Start begins the periodic sending of address reservation requests to the Alfred client.
@@ -46,46 +180,60 @@ func (arw *AddressReservationWorker) StartSend() {
 	ticker := time.NewTicker(arw.sendInterval)
 	defer ticker.Stop()
 
+	ctx, cancel := workerContext(arw.ShutdownChan)
+	defer cancel()
+
 	for {
 		select {
 		case <-arw.ShutdownChan:
 			return
+		case <-arw.republish:
+			arw.publishReservation(ctx)
 		case <-ticker.C:
 			var (
 				err error
+				t   = arw.tick()
 			)
 
-			configured, err := network.IsDHCPConfiguredWithReader(arw.Config.uciOpenMANETConfig)
+			configured, err := network.IsDHCPConfiguredWithReader(arw.Deps.UCIOpenMANET)
 			if err != nil {
-				arw.Config.Log.Error().Err(err).Msg("Error checking DHCP configuration")
+				arw.Deps.Log.Error().Err(err).Msg("Error checking DHCP configuration")
 				continue
 			}
 
 			// If DHCP is not configured, send address reservation request
 			if !configured {
-				arw.Config.Log.Debug().Msg("DHCP is not configured, sending address reservation request")
+				arw.Deps.Log.Debug().Msg("DHCP is not configured, sending address reservation request")
 
-				iface := network.GetInterfaceByName(arw.Config.IFace)
+				iface := network.GetInterfaceByName(t.IFace)
 
 				addrResData := proto.AddressReservation{
 					Mac:                   iface.MAC,
-					StaticIp:              iface.IP[0].IP.String(),
 					RequestingReservation: true,
+					Hostname:              arw.Deps.hostname(iface.MAC),
+					MeshId:                arw.Config.MeshID,
+					SchemaVersion:         ReservationSchemaVersion,
+				}
+				if arw.request != nil {
+					addrResData.TargetMac = arw.request.Target()
+				}
+				if addr, ok := iface.PrimaryIPv4(); ok {
+					addrResData.StaticIp = addr.IP.String()
 				}
 
 				var addrResDataBytes []byte
 				addrResDataBytes, err = addrResData.MarshalVT()
 				if err != nil {
-					arw.Config.Log.Error().Err(err).Msg("Error marshaling address reservation data")
+					arw.Deps.Log.Error().Err(err).Msg("Error marshaling address reservation data")
 					continue
 				}
 
-				err = arw.Client.Set(AddressReservationDataType, AddressReservationDataTypeVersion, addrResDataBytes)
+				err = arw.Deps.Client.SetCtx(ctx, AddressReservationDataType, AddressReservationDataTypeVersion, addrResDataBytes)
 				if err != nil {
-					arw.Config.Log.Error().Err(err).Msg("Error sending address reservation data")
+					arw.Deps.Log.Error().Err(err).Msg("Error sending address reservation data")
 				}
 
-				arw.Config.Log.Debug().Interface("addressRes", &addrResData).Msg("Address reservation request sent")
+				arw.Deps.Log.Debug().Interface("addressRes", &addrResData).Msg("Address reservation request sent")
 			}
 		}
 	}
@@ -96,148 +244,332 @@ func (arw *AddressReservationWorker) StartReceive() {
 	ticker := time.NewTicker(arw.recvInterval)
 	defer ticker.Stop()
 
+	ctx, cancel := workerContext(arw.ShutdownChan)
+	defer cancel()
+
+	// Finish a configuration interrupted by a crash before anything else happens
+	arw.recvTicks.Run(func() { arw.resumePending(ctx, arw.tick()) })
+
 	for {
 		select {
 		case <-arw.ShutdownChan:
 			return
 		case <-ticker.C:
-			var (
-				normalizedIface string
-				iface           = network.GetInterfaceByName(arw.Config.IFace)
-			)
+		case <-arw.wake:
+		}
 
-			// Get address reservation data from the Alfred client
-			records, err := arw.Client.Request(AddressReservationDataType)
-			if err != nil {
-				arw.Config.Log.Error().Err(err).Msg("Error receiving address reservation data")
-				continue
+		arw.recvTicks.Run(func() { arw.receiveTick(ctx) })
+	}
+}
+
+// RecvTickStats returns the durations and overruns of the receive ticks.
+func (arw *AddressReservationWorker) RecvTickStats() TickStats {
+	return arw.recvTicks.Stats()
+}
+
+// receiveTick processes the address reservation records once, configuring the node
+// on first contact and answering reservation requests afterwards.
+func (arw *AddressReservationWorker) receiveTick(ctx context.Context) {
+	var (
+		normalizedIface string
+		queued          bool
+		t               = arw.tick()
+		iface           = network.GetInterfaceByName(t.IFace)
+	)
+
+	// Retry commits deferred by a read-only filesystem before doing anything else.
+	// While they are still pending the on-disk config does not reflect the staged
+	// changes, so configuring again would only compound the problem.
+	if arw.commits.Pending() > 0 && !arw.commits.Flush() {
+		return
+	}
+
+	// A configuration started before a crash is completed with the address it
+	// chose rather than selecting a new one
+	if arw.resumePending(ctx, t) {
+		return
+	}
+
+	// Get address reservation data from the Alfred client
+	records, err := arw.Deps.Client.RequestCtx(ctx, AddressReservationDataType)
+	if err != nil {
+		arw.Deps.Log.Error().Err(err).Msg("Error receiving address reservation data")
+		return
+	}
+	records = arw.Deps.RecordLimits.Limit("reservation", records)
+	records = arw.Deps.MeshFilter.FilterReservations(arw.Deps.SchemaFilter.FilterReservations(records))
+
+	configured, err := network.IsDHCPConfiguredWithReader(arw.Deps.UCIOpenMANET)
+	if err != nil {
+		arw.Deps.Log.Error().Err(err).Msg("Error checking DHCP configuration")
+		return
+	}
+
+	// If DHCP is configured already, process records to see if there are any requests for reservations
+	if configured {
+		decoded, err := arw.records.DecodeReservationRecords(records)
+		if err != nil {
+			arw.Deps.Log.Error().Err(err).Msg("Error unmarshaling address reservation data")
+		}
+		arw.records.Prune()
+
+		decoded = freshestReservations(decoded)
+		arw.reportConflicts(decoded)
+
+		// Answer delegated requests first, so the responses below carry the offers
+		if arw.owner != nil {
+			if meshCfg, err := arw.Deps.meshConfig(ctx, t.BatInterface); err != nil {
+				arw.Deps.Log.Error().Err(err).Msg("Error getting mesh config")
+			} else {
+				arw.serveBlockRequests(iface.MAC, meshCfg.IsGatewayMode(), decoded)
 			}
+		}
 
-			configured, err := network.IsDHCPConfiguredWithReader(arw.Config.uciOpenMANETConfig)
-			if err != nil {
-				arw.Config.Log.Error().Err(err).Msg("Error checking DHCP configuration")
-				continue
+		for _, record := range decoded {
+			addrRes := record.Reservation
+
+			// Track confirmed reservations from peers for local name resolution
+			if addrRes.Mac != iface.MAC {
+				arw.reservations.Observe(addrRes)
 			}
 
-			// If DHCP is configured already, process records to see if there are any requests for reservations
-			if configured {
-				for _, record := range records {
-					var addrRes proto.AddressReservation
-					if err := addrRes.UnmarshalVT(record.Data); err != nil {
-						arw.Config.Log.Error().Err(err).Msg("Error unmarshaling address reservation data")
-						continue
-					}
-
-					// If there is a reservation request, process it
-					// only respond to requests not from ourselves
-					if addrRes.RequestingReservation && addrRes.Mac != iface.MAC {
-
-						arw.Config.Log.Debug().Interface("addressRes", &addrRes).Msg("Processing address reservation request")
-
-						// Create and send address reservation response
-						addrResDataBytes, err := arw.createAddressReservationResponse()
-						if err != nil {
-							arw.Config.Log.Error().Err(err).Msg("Error creating address reservation response")
-							continue
-						}
-
-						err = arw.Client.Set(AddressReservationDataType, AddressReservationDataTypeVersion, addrResDataBytes)
-						if err != nil {
-							arw.Config.Log.Error().Err(err).Msg("Error sending address reservation response")
-							continue
-						}
-
-						arw.Config.Log.Debug().Msg("Address reservation response sent")
-					}
+			// If there is a reservation request, process it
+			// only respond to requests not from ourselves
+			if addrRes.RequestingReservation && addrRes.Mac != iface.MAC {
+
+				arw.Deps.Log.Debug().Interface("addressRes", addrRes).Str("source", record.Source).Msg("Processing address reservation request")
+
+				// Create and send address reservation response
+				addrResDataBytes, err := arw.createAddressReservationResponse(t)
+				if err != nil {
+					arw.Deps.Log.Error().Err(err).Msg("Error creating address reservation response")
+					continue
 				}
 
-				// DHCP is already configured, skip further processing
-				continue
-			}
+				err = arw.Deps.Client.SetCtx(ctx, AddressReservationDataType, AddressReservationDataTypeVersion, addrResDataBytes)
+				if err != nil {
+					arw.Deps.Log.Error().Err(err).Msg("Error sending address reservation response")
+					continue
+				}
 
-			// DHCP and the Static IP are not configured, process received records to configure them
-			// If we are a mesh gateway, skip receiving
-			meshCfg, err := batmanadv.GetMeshConfig(arw.Config.BatInterface)
-			if err != nil {
-				arw.Config.Log.Error().Err(err).Msg("Error getting mesh config")
-				continue
+				arw.Deps.Log.Debug().Msg("Address reservation response sent")
 			}
+		}
 
-			// if arw.Config.IFace is prefixed with "br-", remove the prefix because dhcp and network config is tied to the physical interface
-			if after, ok := strings.CutPrefix(arw.Config.IFace, "br-"); ok {
-				normalizedIface = after
-			}
+		arw.updatePeerHosts()
+		arw.checkCapacity(t, iface)
+		arw.checkAddress(t)
+		arw.updateRARole(ctx, t)
+		arw.autosizePool(ctx, t, iface, records)
 
-			staticIP, err := network.SelectAvailableStaticIP(records, meshCfg.IsGatewayMode())
-			if err != nil {
-				arw.Config.Log.Error().Err(err).Msg("Error selecting available static IP")
-				continue
-			}
+		// DHCP is already configured, skip further processing
+		return
+	}
 
-			if err := network.SetNetworkConfigWithReader(normalizedIface, &network.UCINetwork{
-				Proto:          network.DefaultNetworkProto,
-				IPAddr:         staticIP,
-				NetMask:        network.DefaultNetworkMask,
-				IPV6Class:      network.DefaultIPv6Class,
-				IPV6IfaceID:    network.DefaultIPv6IfaceID,
-				IPV6Assignment: network.DefaultIPv6Assign,
-				Device:         arw.Config.IFace,
-				DNS:            "1.1.1.1",
-			}, arw.Config.uciNetworkConfig); err != nil {
-				arw.Config.Log.Error().Err(err).Msg("Error setting network config for address reservation")
-				continue
-			}
+	// Configuring the node only changes system state, so there is nothing to do
+	// in safe mode until it is left
+	if safemode.Enabled() {
+		arw.Deps.Log.Debug().Msg("Safe mode active, not configuring DHCP and static IP")
+		return
+	}
 
-			// Process received address reservation records
-			dhcpStart, err := network.CalculateAvailableDHCPStart(records, network.DefaultNetworkAddress, network.DefaultNetworkMask, network.DefaultDHCPAddressLimit)
-			if err != nil {
-				arw.Config.Log.Error().Err(err).Msg("Error calculating available DHCP start address")
-				continue
-			}
+	// DHCP and the Static IP are not configured, process received records to configure them
+	// If we are a mesh gateway, skip receiving
+	meshCfg, err := arw.Deps.meshConfig(ctx, t.BatInterface)
+	if err != nil {
+		arw.Deps.Log.Error().Err(err).Msg("Error getting mesh config")
+		return
+	}
 
-			dhcpConfig := &network.UCIDHCP{
-				Interface: normalizedIface,
-				Start:     strconv.Itoa(dhcpStart),
-				Limit:     strconv.Itoa(network.DefaultDHCPAddressLimit),
-				LeaseTime: network.DefaultDHCPLeaseTime,
-				Force:     "1",
-			}
+	// Wait until alfred and batman-adv can show us the addresses our peers hold
+	if !arw.bootstrapReady(t, records, iface.MAC, time.Now()) {
+		return
+	}
 
-			arw.Config.Log.Debug().Interface("dhcpConfig", dhcpConfig).Msg("Setting DHCP config")
+	// In delegated mode the address is requested from a block owner first. Gateways
+	// select theirs from the gateway pool, which is never delegated
+	staticIP, waiting := "", false
+	if !meshCfg.IsGatewayMode() {
+		if staticIP, waiting = arw.delegatedStaticIP(records, iface.MAC, time.Now()); waiting {
+			return
+		}
+	}
 
-			err = network.SetDHCPConfigWithReader(normalizedIface, dhcpConfig, arw.Config.uciDHCPConfig)
-			if err != nil {
-				arw.Config.Log.Error().Err(err).Msg("Error setting DHCP config")
-				continue
-			}
+	// Give peers time to answer our reservation request before claiming an address
+	if staticIP == "" && arw.claimPending(t, time.Now()) {
+		return
+	}
 
-			arw.Config.Log.Info().Msgf("Static IP %s and DHCP configured via address reservation", staticIP)
+	// if t.IFace is prefixed with "br-", remove the prefix because dhcp and network config is tied to the physical interface
+	if after, ok := strings.CutPrefix(t.IFace, "br-"); ok {
+		normalizedIface = after
+	}
 
-			// Mark DHCP as configured
-			err = network.SetDHCPConfiguredWithReader(arw.Config.uciOpenMANETConfig)
-			if err != nil {
-				arw.Config.Log.Error().Err(err).Msg("Error marking DHCP as configured")
-				continue
-			}
+	if staticIP == "" {
+		staticIP, err = arw.selectStaticIP(t, records, meshCfg.IsGatewayMode(), iface.MAC)
+		if err != nil {
+			arw.Deps.Log.Error().Err(err).Msg("Error selecting available static IP")
+			return
+		}
+	}
 
-			// Clean up interfaces or configs if needed.
-			// This will only happen on initial configuration. If users create things later
-			// we will not change them unless they re-request an address reservation.
-			err = arw.cleanUpInterfaces()
-			if err != nil {
-				arw.Config.Log.Error().Err(err).Msg("Error cleaning up interfaces")
-				continue
-			}
+	// Process received address reservation records
+	addressing := arw.Config.addressing()
+	dhcpStart, err := network.CalculateAvailableDHCPStart(records, addressing.NetworkAddress(), addressing.Netmask(), network.DefaultDHCPAddressLimit)
+	if err != nil {
+		arw.Deps.Log.Error().Err(err).Msg("Error calculating available DHCP start address")
+		return
+	}
 
-			// Restart the system to apply new network settings
-			arw.Config.Log.Info().Msg("Rebooting system to apply new network settings")
-			err = system.Reboot()
-			if err != nil {
-				arw.Config.Log.Error().Err(err).Msg("Error rebooting system")
-				continue
-			}
+	// Snapshot what is about to be written, so that a step failing after earlier
+	// ones were committed does not leave the node half-configured
+	snapshot := arw.snapshotConfiguration()
+
+	// Record what is about to be written, so that a crash before the node is marked
+	// as configured does not make it select a different address on restart
+	arw.beginConfiguration(&PendingConfiguration{
+		Section:   normalizedIface,
+		StaticIP:  staticIP,
+		DHCPStart: strconv.Itoa(dhcpStart),
+		DHCPLimit: strconv.Itoa(network.DefaultDHCPAddressLimit),
+		Started:   time.Now(),
+	})
+
+	if _, err := network.SetNetworkConfigContextWithReader(ctx, normalizedIface, &network.UCINetwork{
+		Proto:          network.DefaultNetworkProto,
+		IPAddr:         staticIP,
+		NetMask:        addressing.Netmask(),
+		IPV6Class:      network.DefaultIPv6Class,
+		IPV6IfaceID:    network.DefaultIPv6IfaceID,
+		IPV6Assignment: network.DefaultIPv6Assign,
+		Device:         t.IFace,
+		DNS:            []string{"1.1.1.1"},
+	}, arw.Deps.UCINetwork); err != nil {
+		if !arw.deferCommit("network", err, arw.Deps.UCINetwork.Commit) {
+			arw.Deps.Log.Error().Err(err).Msg("Error setting network config for address reservation")
+			arw.abortConfiguration(snapshot)
+			return
+		}
+		queued = true
+	}
+
+	dhcpConfig := &network.UCIDHCP{
+		Interface: normalizedIface,
+		Start:     strconv.Itoa(dhcpStart),
+		Limit:     strconv.Itoa(network.DefaultDHCPAddressLimit),
+		LeaseTime: network.DefaultDHCPLeaseTime,
+		Force:     "1",
+		Instance:  meshPoolInstance(arw.Config.DnsmasqInstance, arw.Deps.UCIDHCP, arw.Deps.Log),
+	}
+
+	arw.Deps.Log.Debug().Interface("dhcpConfig", dhcpConfig).Msg("Setting DHCP config")
+	conflictingMeshPools(normalizedIface, arw.Deps.UCIDHCP, arw.Deps.Log)
+
+	_, err = network.SetDHCPConfigWithReader(normalizedIface, dhcpConfig, arw.Deps.UCIDHCP)
+	if err != nil {
+		if !arw.deferCommit("dhcp", err, arw.Deps.UCIDHCP.Commit) {
+			arw.Deps.Log.Error().Err(err).Msg("Error setting DHCP config")
+			arw.abortConfiguration(snapshot)
+			return
+		}
+		queued = true
+	}
+
+	arw.Deps.Log.Info().Msgf("Static IP %s and DHCP configured via address reservation", staticIP)
+
+	arw.checkZoneCoverage(normalizedIface)
+
+	// Mark DHCP as configured
+	err = network.SetDHCPConfiguredWithReader(arw.Deps.UCIOpenMANET)
+	if err != nil {
+		if !arw.deferCommit("openmanetd", err, arw.Deps.UCIOpenMANET.Commit) {
+			arw.Deps.Log.Error().Err(err).Msg("Error marking DHCP as configured")
+			arw.abortConfiguration(snapshot)
+			return
 		}
+		queued = true
+	}
+
+	// If any commit was deferred, clean up and reboot only once everything has
+	// been written, otherwise the node would come back up unconfigured.
+	if queued {
+		arw.commits.Enqueue("finalize", func() error { return arw.finalizeConfiguration(ctx, t) })
+		return
+	}
+
+	if err := arw.finalizeConfiguration(ctx, t); err != nil {
+		arw.Deps.Log.Error().Err(err).Msg("Error finalizing address reservation configuration")
+		return
+	}
+}
+
+// bootstrapReady reports whether an unconfigured node may select an address, given
+// the reservation records alfred returned this tick. The gate state changes are logged.
+func (arw *AddressReservationWorker) bootstrapReady(t Tunables, records []alfred.Record, selfMAC string, now time.Time) bool {
+	if !arw.bootstrap.Observe(now, peerReservations(records, selfMAC), arw.Deps.meshHealth(t.BatInterface)) {
+		arw.Deps.Log.Debug().Msgf("Waiting up to %s for alfred and batman-adv to show the mesh before selecting an address", arw.bootstrap.Remaining(now))
+		return false
+	}
+
+	if status := arw.bootstrap.Status(); status.ReadyAt.Equal(now) {
+		arw.Deps.Log.Info().
+			Str("state", string(status.State)).
+			Dur("waited", now.Sub(status.Since)).
+			Msg("Ready to select an address")
+	}
+
+	return true
+}
+
+// claimPending reports whether an unconfigured node is still waiting for answers to
+// its reservation request. The wait is skipped when no neighbor could answer.
+func (arw *AddressReservationWorker) claimPending(t Tunables, now time.Time) bool {
+	if arw.claimStarted.IsZero() {
+		arw.claimStarted = now
+	}
+
+	wait := arw.Config.MeshHealthPolicy.ClaimWait(arw.Deps.meshHealth(t.BatInterface))
+	if elapsed := now.Sub(arw.claimStarted); elapsed < wait {
+		arw.Deps.Log.Debug().Msgf("Waiting %s for reservation answers before claiming an address", wait-elapsed)
+		return true
+	}
+
+	return false
+}
+
+// deferCommit queues commit for retry if err was caused by a read-only configuration
+// filesystem. It returns true if the commit was queued and the caller should carry on
+// as if the step succeeded, or false if err is some other failure.
+func (arw *AddressReservationWorker) deferCommit(name string, err error, commit func() error) bool {
+	if !errors.Is(err, network.ErrReadOnlyFS) {
+		return false
 	}
+
+	arw.commits.Enqueue(name, commit)
+
+	return true
+}
+
+// finalizeConfiguration cleans up the default interfaces and reboots the system to
+// apply the network settings written by the address reservation flow.
+func (arw *AddressReservationWorker) finalizeConfiguration(ctx context.Context, t Tunables) error {
+	// The node is marked as configured by now
+	arw.clearPending()
+
+	// Clean up interfaces or configs if needed.
+	// This will only happen on initial configuration. If users create things later
+	// we will not change them unless they re-request an address reservation.
+	if err := arw.cleanUpInterfaces(ctx, t); err != nil {
+		return fmt.Errorf("error cleaning up interfaces: %w", err)
+	}
+
+	// Restart the system to apply new network settings
+	arw.Deps.Log.Info().Msg("Rebooting system to apply new network settings")
+	if err := system.Reboot(); err != nil {
+		return fmt.Errorf("error rebooting system: %w", err)
+	}
+
+	return nil
 }
 
 // createAddressReservationResponse generates a serialized AddressReservation protobuf message
@@ -252,14 +584,14 @@ func (arw *AddressReservationWorker) StartReceive() {
 //   - The interface has no IP address
 //   - The interface has no valid IPv4 address (unspecified, loopback, or non-IPv4)
 //   - Marshaling the protobuf message fails
-func (arw *AddressReservationWorker) createAddressReservationResponse() ([]byte, error) {
+func (arw *AddressReservationWorker) createAddressReservationResponse(t Tunables) ([]byte, error) {
 	var (
 		dhcpiface string
 	)
-	iface := network.GetInterfaceByName(arw.Config.IFace)
+	iface := network.GetInterfaceByName(t.IFace)
 
-	// if arw.Config.IFace is prefixed with "br-", remove the prefix because dhcp config is tied to the physical interface
-	if after, ok := strings.CutPrefix(arw.Config.IFace, "br-"); ok {
+	// if t.IFace is prefixed with "br-", remove the prefix because dhcp config is tied to the physical interface
+	if after, ok := strings.CutPrefix(t.IFace, "br-"); ok {
 		dhcpiface = after
 	}
 
@@ -270,25 +602,32 @@ func (arw *AddressReservationWorker) createAddressReservationResponse() ([]byte,
 
 	// Verify that the interface has an IP address
 	if len(iface.IP) == 0 {
-		return nil, fmt.Errorf("interface %s has no IP address", arw.Config.IFace)
+		return nil, fmt.Errorf("interface %s has no IP address", t.IFace)
 	}
 
-	ip := iface.IP[0].IP
-
-	if ip == nil || ip.IsUnspecified() || ip.IsLoopback() || ip.To4() == nil {
-		arw.Config.Log.Warn().Msgf("Interface %s has no valid IPv4 address", arw.Config.IFace)
-		return nil, fmt.Errorf("interface %s has no valid IPv4 address", arw.Config.IFace)
+	// Never advertise a deprecated address, peers would route to it for its
+	// remaining valid lifetime only
+	addr, ok := iface.PrimaryIPv4()
+	if !ok {
+		arw.Deps.Log.Warn().Msgf("Interface %s has no valid IPv4 address", t.IFace)
+		return nil, fmt.Errorf("interface %s has no valid IPv4 address", t.IFace)
 	}
 
-	cidr := iface.GetCIDR()
+	cidr := (&net.IPNet{IP: addr.IP, Mask: addr.Netmask}).String()
 
 	addrResData := proto.AddressReservation{
 		Mac:                   iface.MAC,
-		StaticIp:              iface.IP[0].IP.String(),
-		ReservationCidr:       cidr[0],
+		StaticIp:              addr.IP.String(),
+		ReservationCidr:       cidr,
 		UciDhcpStart:          dhcp.Start,
 		UciDhcpLimit:          dhcp.Limit,
 		RequestingReservation: false,
+		Hostname:              arw.Deps.hostname(iface.MAC),
+		MeshId:                arw.Config.MeshID,
+		SchemaVersion:         ReservationSchemaVersion,
+	}
+	if arw.owner != nil {
+		arw.owner.Advertise(&addrResData)
 	}
 
 	var addrResDataBytes []byte
@@ -296,62 +635,429 @@ func (arw *AddressReservationWorker) createAddressReservationResponse() ([]byte,
 	if err != nil {
 		return nil, fmt.Errorf("error marshaling address reservation data: %w", err)
 	}
+	arw.advertised.Store(&addrResData)
 
 	return addrResDataBytes, nil
 }
 
-func (arw *AddressReservationWorker) cleanUpInterfaces() error {
-	meshCfg, err := batmanadv.GetMeshConfig(arw.Config.BatInterface)
+// Withdraw publishes this node's reservation one last time marked as shutting down,
+// with a refreshed timestamp so peers take it over the copies still in alfred. Peers
+// keep the reservation, so the address is not handed to another node while this one
+// is down. It does nothing if the node has not advertised a reservation.
+//
+// The call is bounded by ctx and the alfred call timeout.
+func (arw *AddressReservationWorker) Withdraw(ctx context.Context) error {
+	advertised := arw.advertised.Load()
+	if advertised == nil {
+		return nil
+	}
+
+	final := advertised.CloneVT()
+	final.ShuttingDown = true
+	final.RefreshedAt = time.Now().Unix()
+
+	data, err := final.MarshalVT()
+	if err != nil {
+		return fmt.Errorf("error marshaling address reservation data: %w", err)
+	}
+
+	return arw.Deps.Client.SetCtx(ctx, AddressReservationDataType, AddressReservationDataTypeVersion, data)
+}
+
+func (arw *AddressReservationWorker) cleanUpInterfaces(ctx context.Context, t Tunables) error {
+	meshCfg, err := arw.Deps.meshConfig(ctx, t.BatInterface)
 	if err != nil {
 		return fmt.Errorf("%w", err)
 	}
 
 	if meshCfg.IsGatewayMode() {
-		arw.Config.Log.Info().Msg("Mesh gateway mode enabled, skipping interface cleanup")
+		arw.Deps.Log.Info().Msg("Mesh gateway mode enabled, skipping interface cleanup")
 		return nil
 	}
 
-	// Clean up 'wan' and 'lan' network sections if they exist
-	if network.NetworkSectionExistsWithReader("wan", arw.Config.uciNetworkConfig) {
-		arw.Config.Log.Info().Msg("Removing 'wan' network section")
-		if err := network.DeleteNetworkConfigWithReader("wan", arw.Config.uciNetworkConfig); err != nil {
-			return fmt.Errorf("error deleting 'wan' network section: %w", err)
+	// Clean up 'wan' and 'lan' network sections if they exist, in one commit
+	_, err = network.RunTransaction("network", arw.Deps.UCINetwork, func(tx *network.Transaction) error {
+		for _, section := range []string{"wan", "lan"} {
+			if !network.NetworkSectionExistsWithReader(section, tx) {
+				continue
+			}
+			arw.Deps.Log.Info().Msgf("Removing '%s' network section", section)
+			if err := network.DeleteNetworkConfigWithReader(section, tx); err != nil {
+				return fmt.Errorf("error deleting '%s' network section: %w", section, err)
+			}
 		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Clean up DHCP sections if they exist, in one commit
+	_, err = network.RunTransaction("dhcp", arw.Deps.UCIDHCP, func(tx *network.Transaction) error {
+		for _, section := range []string{"wan", "lan"} {
+			if !network.DHCPSectionExistsWithReader(section, tx) {
+				continue
+			}
+			arw.Deps.Log.Info().Msgf("Removing '%s' DHCP section", section)
+			if err := network.DeleteDHCPConfigWithReader(section, tx); err != nil {
+				return fmt.Errorf("error deleting '%s' DHCP section: %w", section, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Reload network to apply changes
+	err = network.ReloadNetworkContext(ctx)
+	if err != nil {
+		return fmt.Errorf("error reloading network configuration: %w", err)
 	}
 
-	if network.NetworkSectionExistsWithReader("lan", arw.Config.uciNetworkConfig) {
-		arw.Config.Log.Info().Msg("Removing 'lan' network section")
-		if err := network.DeleteNetworkConfigWithReader("lan", arw.Config.uciNetworkConfig); err != nil {
-			return fmt.Errorf("error deleting 'lan' network section: %w", err)
+	return nil
+}
+
+// updatePeerHosts prunes the reservation table and rewrites the dnsmasq hosts file
+// so every active peer reservation resolves as <hostname>.<domain>. dnsmasq is only
+// reloaded, and hostname collisions only reported, when the file contents change.
+// Reservations whose hostname or address cannot be written to the file are left out
+// and reported once.
+func (arw *AddressReservationWorker) updatePeerHosts() {
+	arw.reservations.Prune()
+
+	domain := dnsmasqDomain(arw.Config.DnsmasqInstance, arw.Deps.UCIDHCP)
+
+	var entries []network.HostEntry
+	invalid := make(map[network.HostEntry]bool)
+	for _, entry := range arw.reservations.HostEntries() {
+		err := network.ValidateHostEntry(entry)
+		if err == nil {
+			entries = append(entries, entry)
+			continue
+		}
+		invalid[entry] = true
+		if !arw.invalidHosts[entry] {
+			arw.Deps.Log.Warn().Err(err).Str("mac", entry.MAC).Msg("Ignoring peer reservation with an invalid host entry")
 		}
 	}
+	arw.invalidHosts = invalid
+
+	data, collisions := network.GenerateHostsFile(entries, domain)
+
+	changed, err := network.WriteHostsFile(arw.hostsPath, data)
+	if err != nil {
+		arw.Deps.Log.Error().Err(err).Msg("Error writing peer hosts file")
+		return
+	}
+
+	if !changed {
+		return
+	}
+
+	for _, collision := range collisions {
+		arw.Deps.Log.Warn().
+			Str("hostname", collision.Hostname).
+			Strs("macs", collision.MACs).
+			Strs("names", collision.Names).
+			Msg("Multiple peers advertise the same hostname, disambiguating by MAC")
+	}
 
-	// Commit network changes
-	arw.Config.uciNetworkConfig.Commit()
+	if err := network.ReloadDnsmasq(); err != nil {
+		arw.Deps.Log.Error().Err(err).Msg("Error reloading dnsmasq")
+	}
+}
+
+// checkCapacity analyzes mesh address usage from the reservation table plus this
+// node's own reservation and logs when the capacity level changes.
+func (arw *AddressReservationWorker) checkCapacity(t Tunables, iface network.NetworkInterface) {
+	reservations := arw.reservations.Active()
 
-	// Clean up DHCP sections if they exist
-	if network.DHCPSectionExistsWithReader("wan", arw.Config.uciDHCPConfig) {
-		arw.Config.Log.Info().Msg("Removing 'wan' DHCP section")
-		if err := network.DeleteDHCPConfigWithReader("wan", arw.Config.uciDHCPConfig); err != nil {
-			return fmt.Errorf("error deleting 'wan' DHCP section: %w", err)
+	if addr, ok := iface.PrimaryIPv4(); ok {
+		self := Reservation{Mac: iface.MAC, StaticIP: addr.IP.String()}
+
+		dhcpIface := strings.TrimPrefix(t.IFace, "br-")
+		if dhcp, err := network.GetDHCPConfigWithReader(dhcpIface, arw.Deps.UCIDHCP); err == nil {
+			self.DHCPStart, _ = strconv.Atoi(dhcp.Start)
+			self.DHCPLimit, _ = strconv.Atoi(dhcp.Limit)
 		}
+
+		reservations = append(reservations, self)
 	}
 
-	if network.DHCPSectionExistsWithReader("lan", arw.Config.uciDHCPConfig) {
-		arw.Config.Log.Info().Msg("Removing 'lan' DHCP section")
-		if err := network.DeleteDHCPConfigWithReader("lan", arw.Config.uciDHCPConfig); err != nil {
-			return fmt.Errorf("error deleting 'lan' DHCP section: %w", err)
+	addressing := arw.Config.addressing()
+	report, err := AnalyzeCapacity(reservations, addressing.NetworkAddress(), addressing.Netmask())
+	if err != nil {
+		arw.Deps.Log.Error().Err(err).Msg("Error analyzing mesh address capacity")
+		return
+	}
+
+	level, changed := arw.capacity.Update(report)
+	if !changed {
+		return
+	}
+
+	event := arw.Deps.Log.Info()
+	if level != CapacityOK {
+		event = arw.Deps.Log.Warn()
+	}
+
+	event.
+		Str("level", level.String()).
+		Int("claimedIps", report.ClaimedIPs).
+		Int("usableHosts", report.UsableHosts).
+		Float64("ipPct", report.IPPct).
+		Int("dhcpAllocated", report.DHCPAllocated).
+		Float64("dhcpPct", report.DHCPPct).
+		Int("largestDhcpGap", report.LargestDHCPGap).
+		Msg("Mesh address capacity level changed")
+}
+
+// reportConflicts logs each static IP claimed by more than one node once, naming the
+// node that published the conflicting claim and the node that held the address first.
+func (arw *AddressReservationWorker) reportConflicts(records []ReservationRecord) {
+	current := make(map[ReservationConflict]bool)
+	for _, conflict := range findReservationConflicts(records) {
+		current[conflict] = true
+		if !arw.conflicts[conflict] {
+			arw.Deps.Log.Warn().
+				Str("ip", conflict.IP).
+				Str("source", conflict.Source).
+				Str("holder", conflict.Holder).
+				Msgf("Address conflict: %s", conflict)
 		}
 	}
 
-	// Commit DHCP changes
-	arw.Config.uciDHCPConfig.Commit()
+	arw.conflicts = current
+}
 
-	// Reload network to apply changes
-	err = network.ReloadNetwork()
+// checkAddress feeds the address watchdog the address UCI configures for the mesh
+// interface, so that a node netifd failed to configure does not stay addressless.
+func (arw *AddressReservationWorker) checkAddress(t Tunables) {
+	section := strings.TrimPrefix(t.IFace, "br-")
+
+	netCfg, err := network.GetUCINetworkByNameWithReader(section, arw.Deps.UCINetwork)
 	if err != nil {
-		return fmt.Errorf("error reloading network configuration: %w", err)
+		arw.Deps.Log.Error().Err(err).Msg("Error reading network config for address check")
+		return
 	}
 
-	return nil
+	expected := expectedAddress(netCfg)
+	if expected == nil {
+		return
+	}
+
+	arw.watchdog.Tick(t.IFace, expected)
+}
+
+// updateRARole keeps the default router announcement in this node's router
+// advertisements in line with its current gateway role, so that a node demoted to
+// client stops drawing IPv6 traffic and a promoted one starts.
+func (arw *AddressReservationWorker) updateRARole(ctx context.Context, t Tunables) {
+	meshCfg, err := arw.Deps.meshConfig(ctx, t.BatInterface)
+	if err != nil {
+		arw.Deps.Log.Error().Err(err).Msg("Error getting mesh config for router advertisement role")
+		return
+	}
+
+	section := strings.TrimPrefix(t.IFace, "br-")
+	changed, err := applyRARole(section, meshCfg.IsGatewayMode(), arw.Deps.UCIDHCP)
+	if err != nil {
+		arw.Deps.Log.Error().Err(err).Msg("Error updating router advertisement role")
+		return
+	}
+	if !changed {
+		return
+	}
+
+	arw.Deps.Log.Info().Str("role", currentRARole(section, arw.Deps.UCIDHCP)).Msg("Router advertisement role changed")
+
+	if err := network.ReloadDnsmasq(); err != nil {
+		arw.Deps.Log.Error().Err(err).Msg("Error reloading dnsmasq")
+	}
+}
+
+// remediateAddress carries out an address watchdog remediation step.
+func (arw *AddressReservationWorker) remediateAddress(remedy AddressRemedy, iface string, addr *net.IPNet) error {
+	switch remedy {
+	case RemedyReloadNetwork:
+		return network.ReloadNetwork()
+	case RemedyEnsureAddress:
+		return network.EnsureInterfaceAddress(iface, addr)
+	case RemedyReprovision:
+		return network.ClearDHCPConfiguredWithReader(arw.Deps.UCIOpenMANET)
+	default:
+		return nil
+	}
+}
+
+// autosizePool records how many leases this node's DHCP pool has handed out and
+// resizes the pool when the usage history calls for it. Growth needs a free range
+// and must keep mesh-wide usage below the critical capacity level. Every resize is
+// logged with its reason and published to peers right away.
+func (arw *AddressReservationWorker) autosizePool(ctx context.Context, t Tunables, iface network.NetworkInterface, records []alfred.Record) {
+	if arw.autosize == nil {
+		return
+	}
+
+	section := strings.TrimPrefix(t.IFace, "br-")
+	dhcp, err := network.GetDHCPConfigWithReader(section, arw.Deps.UCIDHCP)
+	if err != nil {
+		arw.Deps.Log.Error().Err(err).Msg("Error reading DHCP config for pool autosizing")
+		return
+	}
+
+	start, err1 := strconv.Atoi(dhcp.Start)
+	limit, err2 := strconv.Atoi(dhcp.Limit)
+	if err1 != nil || err2 != nil || limit <= 0 {
+		arw.Deps.Log.Warn().Str("start", dhcp.Start).Str("limit", dhcp.Limit).Msg("DHCP pool has no valid range, skipping pool autosizing")
+		return
+	}
+
+	leases, err := network.ReadDnsmasqLeases(arw.leasesPath)
+	if err != nil {
+		arw.Deps.Log.Error().Err(err).Msg("Error reading DHCP leases")
+		return
+	}
+
+	now := time.Now()
+	active, err := network.CountPoolLeases(leases, arw.Config.addressing().NetworkAddress(), start, limit, now)
+	if err != nil {
+		arw.Deps.Log.Error().Err(err).Msg("Error counting DHCP leases")
+		return
+	}
+
+	var history *PoolHistory
+	arw.state.Update(func(state *State) bool {
+		var ok bool
+		if history, ok = state.Pools[section]; !ok {
+			history = &PoolHistory{}
+			state.Pools[section] = history
+		}
+		return history.Observe(*arw.autosize, active, limit, now)
+	})
+
+	shrinkRequested, err := network.IsPoolShrinkRequestedWithReader(arw.Deps.UCIOpenMANET)
+	if err != nil {
+		arw.Deps.Log.Error().Err(err).Msg("Error checking for a pool shrink request")
+	}
+	if shrinkRequested {
+		if err := network.ClearPoolShrinkRequestWithReader(arw.Deps.UCIOpenMANET); err != nil {
+			arw.Deps.Log.Error().Err(err).Msg("Error clearing pool shrink request")
+		}
+	}
+
+	decision := arw.autosize.Decide(history, limit, shrinkRequested, now)
+	if decision.Action == PoolKeep {
+		if shrinkRequested {
+			arw.Deps.Log.Info().Str("reason", decision.Reason).Int("limit", limit).Msg("Pool shrink request not applied")
+		}
+		return
+	}
+
+	newStart := start
+	if decision.Action == PoolGrow {
+		newStart, err = growPoolStart(arw.Config.addressing(), records, iface.MAC, start, decision.Limit)
+		if errors.Is(err, network.ErrNoAvailableAddress) {
+			arw.Deps.Log.Warn().Int("limit", limit).Int("wanted", decision.Limit).Int("peak", history.Peak()).Msg("DHCP pool is busy but there is no space on the mesh to grow it")
+			return
+		}
+		if err != nil {
+			arw.Deps.Log.Error().Err(err).Msg("Error finding a range to grow the DHCP pool")
+			return
+		}
+
+		self := Reservation{Mac: iface.MAC, DHCPStart: newStart, DHCPLimit: decision.Limit}
+		if addr, ok := iface.PrimaryIPv4(); ok {
+			self.StaticIP = addr.IP.String()
+		}
+		allowed, report, err := poolGrowthAllowed(arw.Config.addressing(), arw.reservations.Active(), self, arw.capacity.thresholds)
+		if err != nil {
+			arw.Deps.Log.Error().Err(err).Msg("Error analyzing mesh address capacity for pool growth")
+			return
+		}
+		if !allowed {
+			arw.Deps.Log.Warn().Int("limit", limit).Int("wanted", decision.Limit).Float64("ipPct", report.IPPct).Float64("dhcpPct", report.DHCPPct).Msg("Not growing DHCP pool, mesh address capacity would become critical")
+			return
+		}
+	}
+
+	changed, err := network.SetDHCPRangeWithReader(section, strconv.Itoa(newStart), strconv.Itoa(decision.Limit), arw.Deps.UCIDHCP)
+	if err != nil {
+		arw.Deps.Log.Error().Err(err).Msg("Error applying resized DHCP pool")
+		return
+	}
+	if !changed {
+		return
+	}
+
+	arw.state.Update(func(*State) bool {
+		history.LastResize = now
+		return true
+	})
+
+	arw.Deps.Log.Warn().
+		Str("action", decision.Action.String()).
+		Str("reason", decision.Reason).
+		Int("fromStart", start).
+		Int("fromLimit", limit).
+		Int("toStart", newStart).
+		Int("toLimit", decision.Limit).
+		Int("peak", history.Peak()).
+		Msg("DHCP pool resized")
+
+	if err := network.ReloadDnsmasq(); err != nil {
+		arw.Deps.Log.Error().Err(err).Msg("Error reloading dnsmasq")
+	}
+
+	addrResDataBytes, err := arw.createAddressReservationResponse(t)
+	if err != nil {
+		arw.Deps.Log.Error().Err(err).Msg("Error creating address reservation for resized pool")
+		return
+	}
+
+	if err := arw.Deps.Client.SetCtx(ctx, AddressReservationDataType, AddressReservationDataTypeVersion, addrResDataBytes); err != nil {
+		arw.Deps.Log.Error().Err(err).Msg("Error publishing address reservation for resized pool")
+	}
+}
+
+// Republish publishes our reservation without waiting for the next request.
+func (arw *AddressReservationWorker) Republish() {
+	select {
+	case arw.republish <- struct{}{}:
+	default:
+	}
+}
+
+// publishReservation publishes our confirmed reservation. A node that is not
+// configured yet has nothing to publish; its next request carries the current name.
+func (arw *AddressReservationWorker) publishReservation(ctx context.Context) {
+	t := arw.tick()
+
+	configured, err := network.IsDHCPConfiguredWithReader(arw.Deps.UCIOpenMANET)
+	if err != nil {
+		arw.Deps.Log.Error().Err(err).Msg("Error checking DHCP configuration")
+		return
+	}
+	if !configured {
+		return
+	}
+
+	addrResDataBytes, err := arw.createAddressReservationResponse(t)
+	if err != nil {
+		arw.Deps.Log.Error().Err(err).Msg("Error creating address reservation")
+		return
+	}
+
+	if err := arw.Deps.Client.SetCtx(ctx, AddressReservationDataType, AddressReservationDataTypeVersion, addrResDataBytes); err != nil {
+		arw.Deps.Log.Error().Err(err).Msg("Error publishing address reservation")
+	}
+}
+
+// wakeUp runs a receive pass without waiting for the next tick.
+func (arw *AddressReservationWorker) wakeUp() {
+	select {
+	case arw.wake <- struct{}{}:
+	default:
+	}
 }
@@ -0,0 +1,154 @@
+package mgmt
+
+import (
+	"net"
+
+	"github.com/openmanet/openmanetd/internal/network"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// DefaultAddressCheckEvery is how many receive ticks pass between checks that the
+	// mesh interface carries its configured address.
+	DefaultAddressCheckEvery int = 6
+
+	// DefaultAddressMissThreshold is how many consecutive failed checks trigger the
+	// next remediation step.
+	DefaultAddressMissThreshold int = 3
+)
+
+// AddressRemedy is a remediation step for a mesh interface that is missing its
+// configured address. Steps are tried in the order declared.
+type AddressRemedy int
+
+const (
+	// RemedyReloadNetwork asks netifd to apply the UCI network config again.
+	RemedyReloadNetwork AddressRemedy = iota
+	// RemedyEnsureAddress assigns the address directly over netlink.
+	RemedyEnsureAddress
+	// RemedyReprovision clears dhcpconfigured so that the address reservation worker
+	// provisions the node from scratch. It is only used when enabled.
+	RemedyReprovision
+)
+
+func (r AddressRemedy) String() string {
+	switch r {
+	case RemedyReloadNetwork:
+		return "reload network"
+	case RemedyEnsureAddress:
+		return "assign address"
+	case RemedyReprovision:
+		return "reprovision"
+	default:
+		return "unknown"
+	}
+}
+
+// AddressWatchdog detects a mesh interface that has lost, or never received, the
+// address UCI says it should have. Once dhcpconfigured is set the reservation worker
+// skips provisioning, so without the watchdog such a node stays addressless.
+type AddressWatchdog struct {
+	log           zerolog.Logger
+	checkEvery    int
+	missThreshold int
+	remedies      []AddressRemedy
+
+	ticks  int
+	misses int
+	next   int
+
+	// iface looks up the interface; overridable for tests.
+	iface func(name string) network.NetworkInterface
+	// apply carries out a remediation step.
+	apply func(remedy AddressRemedy, iface string, addr *net.IPNet) error
+}
+
+// NewAddressWatchdog creates a watchdog that checks every checkEvery ticks and
+// escalates after missThreshold consecutive misses. RemedyReprovision is only
+// included when reprovision is true. Non-positive thresholds use the defaults.
+func NewAddressWatchdog(log zerolog.Logger, checkEvery, missThreshold int, reprovision bool, apply func(AddressRemedy, string, *net.IPNet) error) *AddressWatchdog {
+	if checkEvery <= 0 {
+		checkEvery = DefaultAddressCheckEvery
+	}
+	if missThreshold <= 0 {
+		missThreshold = DefaultAddressMissThreshold
+	}
+
+	remedies := []AddressRemedy{RemedyReloadNetwork, RemedyEnsureAddress}
+	if reprovision {
+		remedies = append(remedies, RemedyReprovision)
+	}
+
+	return &AddressWatchdog{
+		log:           log,
+		checkEvery:    checkEvery,
+		missThreshold: missThreshold,
+		remedies:      remedies,
+		iface:         network.GetInterfaceByName,
+		apply:         apply,
+	}
+}
+
+// Tick is called on every receive tick while the node is configured. Every
+// checkEvery ticks it checks that iface carries expected, and after missThreshold
+// consecutive misses applies the next remediation step. The miss count restarts
+// after each step so the step has time to take effect. A check that finds the
+// address resets the escalation.
+//
+// Returns the remediation step applied on this tick, if any.
+func (w *AddressWatchdog) Tick(iface string, expected *net.IPNet) (AddressRemedy, bool) {
+	w.ticks++
+	if w.ticks < w.checkEvery {
+		return 0, false
+	}
+	w.ticks = 0
+
+	current := w.iface(iface)
+	if addr, ok := current.Address(expected.IP); ok {
+		if w.misses > 0 || w.next > 0 {
+			w.log.Info().Str("iface", iface).Str("address", expected.String()).Msg("Mesh interface address recovered")
+		}
+		// Present but not the source address the node is reached at
+		if addr.Secondary || addr.Deprecated {
+			w.log.Debug().Str("iface", iface).Str("address", expected.String()).Bool("secondary", addr.Secondary).Bool("deprecated", addr.Deprecated).Msg("Mesh interface carries its configured address but not as the primary")
+		}
+		w.misses = 0
+		w.next = 0
+		return 0, false
+	}
+
+	w.misses++
+	w.log.Warn().Str("iface", iface).Str("address", expected.String()).Msgf("Mesh interface is missing its configured address (%d/%d)", w.misses, w.missThreshold)
+
+	if w.misses < w.missThreshold {
+		return 0, false
+	}
+	w.misses = 0
+
+	if w.next >= len(w.remedies) {
+		w.log.Error().Str("iface", iface).Str("address", expected.String()).Msg("Mesh interface is still missing its address and every remediation step has been tried")
+		return 0, false
+	}
+
+	remedy := w.remedies[w.next]
+	w.next++
+
+	w.log.Warn().Str("iface", iface).Str("address", expected.String()).Str("remedy", remedy.String()).Msg("Escalating address remediation")
+	if err := w.apply(remedy, iface, expected); err != nil {
+		w.log.Error().Err(err).Str("remedy", remedy.String()).Msg("Address remediation failed")
+	}
+
+	return remedy, true
+}
+
+// expectedAddress returns the address UCI configures for the network section, or
+// nil if the section has no valid static address.
+func expectedAddress(cfg *network.UCINetwork) *net.IPNet {
+	ip := net.ParseIP(cfg.IPAddr).To4()
+	mask := net.ParseIP(cfg.NetMask).To4()
+	if ip == nil || mask == nil {
+		return nil
+	}
+
+	return &net.IPNet{IP: ip, Mask: net.IPMask(mask)}
+}
@@ -0,0 +1,150 @@
+package mgmt
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/openmanet/openmanetd/internal/network"
+	"github.com/rs/zerolog"
+)
+
+// fakeAddressSource stands in for the mesh interface and records remediation steps.
+type fakeAddressSource struct {
+	present bool
+	applied []AddressRemedy
+	err     error
+}
+
+func (f *fakeAddressSource) iface(name string) network.NetworkInterface {
+	ni := network.NetworkInterface{Name: name}
+	if f.present {
+		ni.IP = []network.IPAddress{{IP: net.ParseIP("10.41.2.10"), Netmask: net.CIDRMask(16, 32)}}
+	}
+	return ni
+}
+
+func (f *fakeAddressSource) apply(remedy AddressRemedy, iface string, addr *net.IPNet) error {
+	f.applied = append(f.applied, remedy)
+	return f.err
+}
+
+func newTestAddressWatchdog(checkEvery, missThreshold int, reprovision bool) (*AddressWatchdog, *fakeAddressSource) {
+	src := &fakeAddressSource{}
+	w := NewAddressWatchdog(zerolog.Nop(), checkEvery, missThreshold, reprovision, src.apply)
+	w.iface = src.iface
+
+	return w, src
+}
+
+var watchdogAddr = &net.IPNet{IP: net.ParseIP("10.41.2.10").To4(), Mask: net.CIDRMask(16, 32)}
+
+func TestAddressWatchdog_Escalation(t *testing.T) {
+	tests := []struct {
+		name        string
+		reprovision bool
+		want        []AddressRemedy
+	}{
+		{
+			name: "reprovision disabled",
+			want: []AddressRemedy{RemedyReloadNetwork, RemedyEnsureAddress},
+		},
+		{
+			name:        "reprovision enabled",
+			reprovision: true,
+			want:        []AddressRemedy{RemedyReloadNetwork, RemedyEnsureAddress, RemedyReprovision},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, src := newTestAddressWatchdog(2, 3, tt.reprovision)
+
+			// Run well past the point where every step has been tried
+			for i := 0; i < 2*3*5; i++ {
+				remedy, ok := w.Tick("br-ahwlan", watchdogAddr)
+				if ok && remedy != src.applied[len(src.applied)-1] {
+					t.Errorf("Tick() = %v, last applied %v", remedy, src.applied[len(src.applied)-1])
+				}
+
+				// A step is only taken every checkEvery * missThreshold ticks
+				if wantSteps := min((i+1)/6, len(tt.want)); len(src.applied) != wantSteps {
+					t.Fatalf("tick %d: %d steps applied, want %d", i+1, len(src.applied), wantSteps)
+				}
+			}
+
+			if !reflect.DeepEqual(src.applied, tt.want) {
+				t.Errorf("applied %v, want %v", src.applied, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddressWatchdog_RecoveryStopsEscalation(t *testing.T) {
+	w, src := newTestAddressWatchdog(1, 2, true)
+
+	tick := func(n int) {
+		for i := 0; i < n; i++ {
+			w.Tick("br-ahwlan", watchdogAddr)
+		}
+	}
+
+	tick(2)
+	if want := []AddressRemedy{RemedyReloadNetwork}; !reflect.DeepEqual(src.applied, want) {
+		t.Fatalf("applied %v, want %v", src.applied, want)
+	}
+
+	// The address comes back after the reload: no further steps are taken
+	src.present = true
+	tick(10)
+	if len(src.applied) != 1 {
+		t.Fatalf("applied %v after recovery, want only the reload", src.applied)
+	}
+
+	// Losing it again starts over from the first step
+	src.present = false
+	tick(2)
+	if want := []AddressRemedy{RemedyReloadNetwork, RemedyReloadNetwork}; !reflect.DeepEqual(src.applied, want) {
+		t.Errorf("applied %v, want %v", src.applied, want)
+	}
+}
+
+func TestAddressWatchdog_FailedStepStillEscalates(t *testing.T) {
+	w, src := newTestAddressWatchdog(1, 1, false)
+	src.err = errors.New("reload failed")
+
+	w.Tick("br-ahwlan", watchdogAddr)
+	w.Tick("br-ahwlan", watchdogAddr)
+
+	if want := []AddressRemedy{RemedyReloadNetwork, RemedyEnsureAddress}; !reflect.DeepEqual(src.applied, want) {
+		t.Errorf("applied %v, want %v", src.applied, want)
+	}
+}
+
+func TestExpectedAddress(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  network.UCINetwork
+		want string
+	}{
+		{name: "static address", cfg: network.UCINetwork{IPAddr: "10.41.2.10", NetMask: "255.255.0.0"}, want: "10.41.2.10/16"},
+		{name: "no address", cfg: network.UCINetwork{NetMask: "255.255.0.0"}},
+		{name: "no netmask", cfg: network.UCINetwork{IPAddr: "10.41.2.10"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := expectedAddress(&tt.cfg)
+			if tt.want == "" {
+				if got != nil {
+					t.Errorf("expectedAddress() = %v, want nil", got)
+				}
+				return
+			}
+			if got == nil || got.String() != tt.want {
+				t.Errorf("expectedAddress() = %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
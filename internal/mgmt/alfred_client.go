@@ -0,0 +1,206 @@
+package mgmt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/openmanet/go-alfred"
+	"github.com/openmanet/openmanetd/internal/config"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// defaultAlfredMaxAbandoned is the number of timed-out calls that may still be
+	// blocked on the current client before it is replaced.
+	defaultAlfredMaxAbandoned int = 3
+
+	// defaultAlfredMaxOutstanding is the number of timed-out calls that may still be
+	// blocked across the current client and those it replaced. Past it new calls
+	// fail straight away rather than start another goroutine.
+	defaultAlfredMaxOutstanding int = 4 * defaultAlfredMaxAbandoned
+)
+
+// ErrAlfredTimeout is returned when an alfred call does not complete before its
+// deadline. The call is abandoned and may still complete in the background.
+var ErrAlfredTimeout = errors.New("alfred call timed out")
+
+// alfredTransport is the subset of the alfred client used by the workers.
+type alfredTransport interface {
+	Set(dataType uint8, version uint8, data []byte) error
+	Request(dataType uint8) ([]alfred.Record, error)
+}
+
+// alfredGeneration is one instance of the underlying client together with the
+// number of calls on it that timed out and have not returned yet.
+type alfredGeneration struct {
+	transport alfredTransport
+	abandoned int
+}
+
+// AlfredClient wraps the alfred client with context-aware calls. Each call runs in
+// its own goroutine and is abandoned when the context is done or the call timeout
+// expires, so a wedged alfred daemon cannot block a worker forever.
+//
+// Abandoned calls keep a goroutine blocked on the socket. Once maxAbandoned are
+// outstanding on the same client, the client is rebuilt so new calls get a fresh
+// connection. Rebuilding does not release the calls stuck on the old client, so once
+// maxOutstanding are blocked across all clients, new calls fail with
+// ErrAlfredTimeout without being started until some of them return.
+type AlfredClient struct {
+	log            zerolog.Logger
+	timeout        time.Duration
+	maxAbandoned   int
+	maxOutstanding int
+	newTransport   func() (alfredTransport, error)
+
+	mu      sync.Mutex
+	current *alfredGeneration
+	// outstanding is the number of abandoned calls that have not returned yet, on
+	// every client.
+	outstanding int
+}
+
+// NewAlfredClient creates an AlfredClient that connects to the alfred socket at
+// socketPath, bounding each call by timeout.
+func NewAlfredClient(socketPath string, timeout time.Duration, log zerolog.Logger) (*AlfredClient, error) {
+	return newAlfredClient(func() (alfredTransport, error) {
+		client, err := alfred.NewClient(alfred.WithSocketPath(socketPath))
+		if err != nil {
+			return nil, err
+		}
+		return client, nil
+	}, timeout, log)
+}
+
+// newAlfredClient creates an AlfredClient using newTransport to build, and rebuild,
+// the underlying client.
+func newAlfredClient(newTransport func() (alfredTransport, error), timeout time.Duration, log zerolog.Logger) (*AlfredClient, error) {
+	if timeout <= 0 {
+		timeout = config.DefaultAlfredCallTimeout
+	}
+
+	transport, err := newTransport()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create alfred client: %w", err)
+	}
+
+	return &AlfredClient{
+		log:            log,
+		timeout:        timeout,
+		maxAbandoned:   defaultAlfredMaxAbandoned,
+		maxOutstanding: defaultAlfredMaxOutstanding,
+		newTransport:   newTransport,
+		current:        &alfredGeneration{transport: transport},
+	}, nil
+}
+
+// SetCtx publishes data for dataType, returning ErrAlfredTimeout if the call does not
+// complete before ctx is done or the call timeout expires.
+func (c *AlfredClient) SetCtx(ctx context.Context, dataType uint8, version uint8, data []byte) error {
+	_, err := c.call(ctx, func(t alfredTransport) ([]alfred.Record, error) {
+		return nil, t.Set(dataType, version, data)
+	})
+
+	return err
+}
+
+// RequestCtx fetches all records for dataType, returning ErrAlfredTimeout if the call
+// does not complete before ctx is done or the call timeout expires.
+func (c *AlfredClient) RequestCtx(ctx context.Context, dataType uint8) ([]alfred.Record, error) {
+	return c.call(ctx, func(t alfredTransport) ([]alfred.Record, error) {
+		return t.Request(dataType)
+	})
+}
+
+type alfredResult struct {
+	records []alfred.Record
+	err     error
+}
+
+// call runs fn against the current client in a goroutine and waits for it, the
+// call timeout, or ctx, whichever comes first. It fails without calling fn while
+// maxOutstanding abandoned calls are still blocked.
+func (c *AlfredClient) call(ctx context.Context, fn func(alfredTransport) ([]alfred.Record, error)) ([]alfred.Record, error) {
+	c.mu.Lock()
+	gen := c.current
+	outstanding := c.outstanding
+	c.mu.Unlock()
+
+	if outstanding >= c.maxOutstanding {
+		return nil, fmt.Errorf("%w: %d earlier calls have not returned", ErrAlfredTimeout, outstanding)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	// Buffered so the goroutine can always deliver its result and exit, even after
+	// the call has been abandoned.
+	done := make(chan alfredResult, 1)
+	go func() {
+		records, err := fn(gen.transport)
+		done <- alfredResult{records: records, err: err}
+	}()
+
+	select {
+	case res := <-done:
+		return res.records, res.err
+	case <-ctx.Done():
+	}
+
+	c.abandon(gen, done)
+
+	return nil, fmt.Errorf("%w: %w", ErrAlfredTimeout, ctx.Err())
+}
+
+// abandon records a timed-out call on gen and rebuilds the client if too many calls
+// are stuck on it. The count is released when the abandoned call eventually returns.
+func (c *AlfredClient) abandon(gen *alfredGeneration, done <-chan alfredResult) {
+	c.mu.Lock()
+	gen.abandoned++
+	c.outstanding++
+	rebuild := gen == c.current && gen.abandoned >= c.maxAbandoned
+	c.mu.Unlock()
+
+	go func() {
+		<-done
+		c.mu.Lock()
+		gen.abandoned--
+		c.outstanding--
+		c.mu.Unlock()
+	}()
+
+	if rebuild {
+		c.rebuild(gen)
+	}
+}
+
+// rebuild replaces the client if gen is still current.
+func (c *AlfredClient) rebuild(gen *alfredGeneration) {
+	transport, err := c.newTransport()
+	if err != nil {
+		c.log.Error().Err(err).Msg("Failed to rebuild alfred client")
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.current != gen {
+		return
+	}
+
+	c.log.Warn().Int("abandoned", gen.abandoned).Msg("Alfred calls are not returning, rebuilding client")
+	c.current = &alfredGeneration{transport: transport}
+}
+
+// Abandoned returns the number of timed-out calls still blocked on the current client.
+// Calls blocked on the clients it replaced are not counted.
+func (c *AlfredClient) Abandoned() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.current.abandoned
+}
@@ -0,0 +1,260 @@
+package mgmt
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openmanet/go-alfred"
+	"github.com/rs/zerolog"
+)
+
+// fakeAlfred is an alfredTransport that returns canned records or blocks until
+// released, simulating a wedged alfred daemon.
+type fakeAlfred struct {
+	mu      sync.Mutex
+	records []alfred.Record
+	hang    bool
+	release chan struct{}
+	once    sync.Once
+	sets    int
+}
+
+func newFakeAlfred() *fakeAlfred {
+	return &fakeAlfred{release: make(chan struct{})}
+}
+
+// unblock releases every call blocked on the fake, now and in the future.
+func (f *fakeAlfred) unblock() {
+	f.once.Do(func() { close(f.release) })
+}
+
+func (f *fakeAlfred) wait() {
+	f.mu.Lock()
+	hang := f.hang
+	f.mu.Unlock()
+
+	if hang {
+		<-f.release
+	}
+}
+
+func (f *fakeAlfred) Set(dataType uint8, version uint8, data []byte) error {
+	f.wait()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sets++
+
+	return nil
+}
+
+func (f *fakeAlfred) Request(dataType uint8) ([]alfred.Record, error) {
+	f.wait()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.records, nil
+}
+
+// newTestAlfredClient returns a client whose transports are fakes. Every rebuild
+// creates a new fake, so the returned slice holds one entry per generation.
+func newTestAlfredClient(t *testing.T, timeout time.Duration, hang bool) (*AlfredClient, *[]*fakeAlfred) {
+	t.Helper()
+
+	var created []*fakeAlfred
+	client, err := newAlfredClient(func() (alfredTransport, error) {
+		fake := newFakeAlfred()
+		fake.hang = hang
+		created = append(created, fake)
+		return fake, nil
+	}, timeout, zerolog.Nop())
+	if err != nil {
+		t.Fatalf("newAlfredClient() error = %v", err)
+	}
+
+	t.Cleanup(func() {
+		for _, fake := range created {
+			fake.unblock()
+		}
+	})
+
+	return client, &created
+}
+
+func TestAlfredClient_Success(t *testing.T) {
+	client, created := newTestAlfredClient(t, time.Second, false)
+	(*created)[0].records = []alfred.Record{{Data: []byte("peer")}}
+
+	if err := client.SetCtx(context.Background(), NodeDataType, NodeDataTypeVersion, []byte("data")); err != nil {
+		t.Fatalf("SetCtx() error = %v", err)
+	}
+
+	records, err := client.RequestCtx(context.Background(), NodeDataType)
+	if err != nil {
+		t.Fatalf("RequestCtx() error = %v", err)
+	}
+	if len(records) != 1 || string(records[0].Data) != "peer" {
+		t.Errorf("RequestCtx() = %v, want one record with data %q", records, "peer")
+	}
+
+	if (*created)[0].sets != 1 {
+		t.Errorf("sets = %d, want 1", (*created)[0].sets)
+	}
+}
+
+func TestAlfredClient_Timeout(t *testing.T) {
+	client, _ := newTestAlfredClient(t, 20*time.Millisecond, true)
+
+	start := time.Now()
+	_, err := client.RequestCtx(context.Background(), NodeDataType)
+	if !errors.Is(err, ErrAlfredTimeout) {
+		t.Fatalf("RequestCtx() error = %v, want ErrAlfredTimeout", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("RequestCtx() error = %v, want it to wrap context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("RequestCtx() took %v, want it to return at the call timeout", elapsed)
+	}
+
+	err = client.SetCtx(context.Background(), NodeDataType, NodeDataTypeVersion, nil)
+	if !errors.Is(err, ErrAlfredTimeout) {
+		t.Fatalf("SetCtx() error = %v, want ErrAlfredTimeout", err)
+	}
+
+	if got := client.Abandoned(); got != 2 {
+		t.Errorf("Abandoned() = %d, want 2", got)
+	}
+}
+
+func TestAlfredClient_ContextCancelled(t *testing.T) {
+	client, _ := newTestAlfredClient(t, time.Minute, true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := client.RequestCtx(ctx, NodeDataType)
+	if !errors.Is(err, ErrAlfredTimeout) || !errors.Is(err, context.Canceled) {
+		t.Errorf("RequestCtx() error = %v, want ErrAlfredTimeout wrapping context.Canceled", err)
+	}
+}
+
+func TestAlfredClient_AbandonedCallReleased(t *testing.T) {
+	client, created := newTestAlfredClient(t, 10*time.Millisecond, true)
+	fake := (*created)[0]
+
+	if _, err := client.RequestCtx(context.Background(), NodeDataType); !errors.Is(err, ErrAlfredTimeout) {
+		t.Fatalf("RequestCtx() error = %v, want ErrAlfredTimeout", err)
+	}
+
+	fake.unblock()
+
+	deadline := time.Now().Add(time.Second)
+	for client.Abandoned() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Abandoned() = %d after the call returned, want 0", client.Abandoned())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := client.RequestCtx(context.Background(), NodeDataType); err != nil {
+		t.Errorf("RequestCtx() error = %v after the daemon recovered", err)
+	}
+}
+
+func TestAlfredClient_RebuildAfterThreshold(t *testing.T) {
+	client, created := newTestAlfredClient(t, 10*time.Millisecond, true)
+
+	for i := 0; i < defaultAlfredMaxAbandoned-1; i++ {
+		if _, err := client.RequestCtx(context.Background(), NodeDataType); !errors.Is(err, ErrAlfredTimeout) {
+			t.Fatalf("RequestCtx() error = %v, want ErrAlfredTimeout", err)
+		}
+	}
+
+	if len(*created) != 1 {
+		t.Fatalf("client rebuilt after %d abandoned calls, want no rebuild below the threshold", defaultAlfredMaxAbandoned-1)
+	}
+
+	if _, err := client.RequestCtx(context.Background(), NodeDataType); !errors.Is(err, ErrAlfredTimeout) {
+		t.Fatalf("RequestCtx() error = %v, want ErrAlfredTimeout", err)
+	}
+
+	if len(*created) != 2 {
+		t.Fatalf("transports created = %d, want 2 after reaching the threshold", len(*created))
+	}
+	if got := client.Abandoned(); got != 0 {
+		t.Errorf("Abandoned() = %d on the rebuilt client, want 0", got)
+	}
+
+	// The new transport responds, so calls succeed again
+	fresh := (*created)[1]
+	fresh.mu.Lock()
+	fresh.hang = false
+	fresh.mu.Unlock()
+
+	if err := client.SetCtx(context.Background(), NodeDataType, NodeDataTypeVersion, nil); err != nil {
+		t.Errorf("SetCtx() error = %v on the rebuilt client", err)
+	}
+	if fresh.sets != 1 {
+		t.Errorf("sets on rebuilt client = %d, want 1", fresh.sets)
+	}
+}
+
+func TestAlfredClient_OutstandingCap(t *testing.T) {
+	client, created := newTestAlfredClient(t, 10*time.Millisecond, true)
+
+	// Every rebuilt client hangs too, so abandoned calls pile up across clients
+	for i := 0; i < defaultAlfredMaxOutstanding; i++ {
+		if _, err := client.RequestCtx(context.Background(), NodeDataType); !errors.Is(err, ErrAlfredTimeout) {
+			t.Fatalf("RequestCtx() error = %v, want ErrAlfredTimeout", err)
+		}
+	}
+	rebuilt := len(*created)
+
+	start := time.Now()
+	_, err := client.RequestCtx(context.Background(), NodeDataType)
+	if !errors.Is(err, ErrAlfredTimeout) || errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("RequestCtx() error = %v, want ErrAlfredTimeout without waiting for the deadline", err)
+	}
+	if elapsed := time.Since(start); elapsed >= 10*time.Millisecond {
+		t.Errorf("RequestCtx() took %v past the cap, want it to fail straight away", elapsed)
+	}
+	if len(*created) != rebuilt {
+		t.Errorf("transports created = %d past the cap, want %d", len(*created), rebuilt)
+	}
+
+	// Once the stuck calls return, calls are made again
+	for _, fake := range *created {
+		fake.unblock()
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		client.mu.Lock()
+		outstanding := client.outstanding
+		client.mu.Unlock()
+		if outstanding == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d calls outstanding after they returned, want 0", outstanding)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := client.RequestCtx(context.Background(), NodeDataType); err != nil {
+		t.Errorf("RequestCtx() error = %v after the stuck calls returned", err)
+	}
+}
+
+func TestAlfredClient_CreateError(t *testing.T) {
+	wantErr := errors.New("no socket")
+	_, err := newAlfredClient(func() (alfredTransport, error) {
+		return nil, wantErr
+	}, time.Second, zerolog.Nop())
+	if !errors.Is(err, wantErr) {
+		t.Errorf("newAlfredClient() error = %v, want %v", err, wantErr)
+	}
+}
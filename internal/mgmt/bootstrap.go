@@ -0,0 +1,143 @@
+package mgmt
+
+import (
+	"sync"
+	"time"
+
+	"github.com/openmanet/go-alfred"
+	proto "github.com/openmanet/openmanetd/internal/api/openmanet/v1"
+	batmanadv "github.com/openmanet/openmanetd/internal/batman-adv"
+)
+
+// DefaultBootstrapGracePeriod is how long an unconfigured node that has heard from no
+// peer over alfred waits for the mesh to form before it selects an address.
+const DefaultBootstrapGracePeriod time.Duration = 60 * time.Second
+
+// BootstrapState tells whether an unconfigured node may select an address yet, and
+// why.
+type BootstrapState string
+
+const (
+	// BootstrapWaiting means neither alfred nor batman-adv showed the node its peers yet.
+	BootstrapWaiting BootstrapState = "waiting"
+	// BootstrapSynced means alfred returned reservation records from another node.
+	BootstrapSynced BootstrapState = "synced"
+	// BootstrapMeshJoined means the grace period passed with batman-adv reporting
+	// originators, though alfred returned no records from them.
+	BootstrapMeshJoined BootstrapState = "meshJoined"
+	// BootstrapAlone means batman-adv reported no originator for the whole grace
+	// period, so there is no one to collide with.
+	BootstrapAlone BootstrapState = "alone"
+	// BootstrapGraceElapsed means the grace period passed without the batman-adv
+	// tables ever being readable.
+	BootstrapGraceElapsed BootstrapState = "graceElapsed"
+)
+
+// BootstrapStatus is the state of a BootstrapGate for status queries.
+type BootstrapStatus struct {
+	State BootstrapState `json:"state"`
+	// Since is when the gate started waiting, ReadyAt when it opened. Both are zero
+	// before the node first tried to configure itself.
+	Since       time.Time     `json:"since"`
+	ReadyAt     time.Time     `json:"readyAt,omitzero"`
+	GracePeriod time.Duration `json:"gracePeriod"`
+}
+
+// BootstrapGate keeps an unconfigured node from selecting an address before it can
+// see the addresses its peers hold. On a cold boot openmanetd often starts before
+// alfred has synced and before batman-adv has found any neighbor, and an empty record
+// set would make every address look free.
+//
+// The gate opens when alfred returns reservation records from another node, or once
+// the grace period has passed. Once open it stays open.
+type BootstrapGate struct {
+	grace time.Duration
+
+	mu             sync.Mutex
+	state          BootstrapState
+	since          time.Time
+	readyAt        time.Time
+	sawOriginators bool
+	healthUnknown  bool
+}
+
+// NewBootstrapGate creates a closed gate. A grace period of zero or less uses
+// DefaultBootstrapGracePeriod.
+func NewBootstrapGate(grace time.Duration) *BootstrapGate {
+	if grace <= 0 {
+		grace = DefaultBootstrapGracePeriod
+	}
+
+	return &BootstrapGate{grace: grace, state: BootstrapWaiting}
+}
+
+// Observe records what one receive tick saw at now: the number of reservation
+// records from other nodes returned by alfred and the mesh health, nil if the
+// batman-adv tables could not be read. It returns whether the node may select an
+// address.
+func (g *BootstrapGate) Observe(now time.Time, peerRecords int, health *batmanadv.MeshHealth) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.state != BootstrapWaiting {
+		return true
+	}
+	if g.since.IsZero() {
+		g.since = now
+	}
+
+	if health == nil {
+		g.healthUnknown = true
+	} else if health.Originators > 0 {
+		g.sawOriginators = true
+	}
+
+	switch {
+	case peerRecords > 0:
+		g.state = BootstrapSynced
+	case now.Sub(g.since) < g.grace:
+		return false
+	case g.sawOriginators:
+		g.state = BootstrapMeshJoined
+	case !g.healthUnknown:
+		g.state = BootstrapAlone
+	default:
+		g.state = BootstrapGraceElapsed
+	}
+
+	g.readyAt = now
+	return true
+}
+
+// Remaining returns how much of the grace period is left at now.
+func (g *BootstrapGate) Remaining(now time.Time) time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.state != BootstrapWaiting || g.since.IsZero() {
+		return 0
+	}
+	return max(g.grace-now.Sub(g.since), 0)
+}
+
+// Status returns the state of the gate.
+func (g *BootstrapGate) Status() BootstrapStatus {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return BootstrapStatus{State: g.state, Since: g.since, ReadyAt: g.readyAt, GracePeriod: g.grace}
+}
+
+// peerReservations counts the reservation records not published by selfMAC.
+func peerReservations(records []alfred.Record, selfMAC string) int {
+	count := 0
+	for _, record := range records {
+		var addrRes proto.AddressReservation
+		if err := addrRes.UnmarshalVT(record.Data); err != nil || addrRes.Mac == selfMAC {
+			continue
+		}
+		count++
+	}
+
+	return count
+}
@@ -0,0 +1,181 @@
+package mgmt
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/openmanet/go-alfred"
+	proto "github.com/openmanet/openmanetd/internal/api/openmanet/v1"
+	batmanadv "github.com/openmanet/openmanetd/internal/batman-adv"
+	"github.com/rs/zerolog"
+)
+
+const bootstrapSelfMAC = "aa:bb:cc:dd:ee:01"
+
+// bootTick is what the reservation worker sees on one receive tick of a cold boot.
+type bootTick struct {
+	// originators is the batman-adv originator count; -1 makes the tables unreadable.
+	originators int
+	// peers are the MACs alfred returned reservation records from, ours included.
+	peers []string
+}
+
+func reservationRecords(t *testing.T, macs []string) []alfred.Record {
+	t.Helper()
+
+	records := make([]alfred.Record, 0, len(macs))
+	for _, mac := range macs {
+		data, err := (&proto.AddressReservation{Mac: mac}).MarshalVT()
+		if err != nil {
+			t.Fatalf("MarshalVT() error = %v", err)
+		}
+		records = append(records, alfred.Record{Data: data})
+	}
+
+	return records
+}
+
+// runColdBoot replays ticks every receive interval and returns when the worker was
+// first allowed to select an address, or -1 if it never was.
+func runColdBoot(t *testing.T, grace time.Duration, ticks []bootTick) (time.Duration, BootstrapState) {
+	t.Helper()
+
+	var current bootTick
+	monitor := NewMeshHealthMonitor(batmanadv.MeshHealthThresholds{}, zerolog.Nop())
+	monitor.refresh = 0
+	monitor.read = func(string, batmanadv.MeshHealthThresholds) (*batmanadv.MeshHealth, error) {
+		if current.originators < 0 {
+			return nil, errors.New("batctl not found")
+		}
+		return &batmanadv.MeshHealth{Originators: current.originators, Neighbors: min(current.originators, 1)}, nil
+	}
+
+	arw := &AddressReservationWorker{
+		Deps:      Deps{Log: zerolog.Nop(), MeshHealth: monitor},
+		bootstrap: NewBootstrapGate(grace),
+	}
+
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, tick := range ticks {
+		current = tick
+		elapsed := time.Duration(i) * addressReservationWorkerRecvInterval
+		if arw.bootstrapReady(Tunables{BatInterface: "bat0"}, reservationRecords(t, tick.peers), bootstrapSelfMAC, start.Add(elapsed)) {
+			return elapsed, arw.bootstrap.Status().State
+		}
+	}
+
+	return -1, arw.bootstrap.Status().State
+}
+
+// repeat returns n copies of tick.
+func repeat(tick bootTick, n int) []bootTick {
+	ticks := make([]bootTick, n)
+	for i := range ticks {
+		ticks[i] = tick
+	}
+	return ticks
+}
+
+func TestBootstrapGate_ColdBoot(t *testing.T) {
+	var (
+		empty    = bootTick{}
+		self     = bootTick{originators: 0, peers: []string{bootstrapSelfMAC}}
+		joined   = bootTick{originators: 3, peers: []string{bootstrapSelfMAC}}
+		synced   = bootTick{originators: 3, peers: []string{bootstrapSelfMAC, "aa:bb:cc:dd:ee:02"}}
+		noTables = bootTick{originators: -1}
+	)
+
+	tests := []struct {
+		name      string
+		ticks     []bootTick
+		wantAt    time.Duration
+		wantState BootstrapState
+	}{
+		{
+			name:      "records arriving late",
+			ticks:     append(append(repeat(empty, 2), joined), synced),
+			wantAt:    30 * time.Second,
+			wantState: BootstrapSynced,
+		},
+		{
+			name:      "alfred synced already",
+			ticks:     []bootTick{synced},
+			wantAt:    0,
+			wantState: BootstrapSynced,
+		},
+		{
+			name:      "genuinely alone",
+			ticks:     repeat(self, 10),
+			wantAt:    DefaultBootstrapGracePeriod,
+			wantState: BootstrapAlone,
+		},
+		{
+			name:      "alfred never syncs",
+			ticks:     append(repeat(empty, 3), repeat(joined, 10)...),
+			wantAt:    DefaultBootstrapGracePeriod,
+			wantState: BootstrapMeshJoined,
+		},
+		{
+			name:      "originators gone by the end of the grace period",
+			ticks:     append([]bootTick{joined}, repeat(empty, 10)...),
+			wantAt:    DefaultBootstrapGracePeriod,
+			wantState: BootstrapMeshJoined,
+		},
+		{
+			name:      "batman-adv tables unreadable",
+			ticks:     repeat(noTables, 10),
+			wantAt:    DefaultBootstrapGracePeriod,
+			wantState: BootstrapGraceElapsed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			at, state := runColdBoot(t, 0, tt.ticks)
+			if at != tt.wantAt || state != tt.wantState {
+				t.Errorf("ready after %v in state %q, want %v in state %q", at, state, tt.wantAt, tt.wantState)
+			}
+		})
+	}
+}
+
+func TestBootstrapGate_ConfiguredGracePeriod(t *testing.T) {
+	at, state := runColdBoot(t, 20*time.Second, repeat(bootTick{}, 5))
+	if at != 20*time.Second || state != BootstrapAlone {
+		t.Errorf("ready after %v in state %q, want 20s in state %q", at, state, BootstrapAlone)
+	}
+}
+
+func TestBootstrapGate_StaysOpen(t *testing.T) {
+	gate := NewBootstrapGate(time.Minute)
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	if !gate.Observe(now, 1, nil) {
+		t.Fatal("Observe() = false with a peer record, want true")
+	}
+	if !gate.Observe(now.Add(time.Second), 0, nil) {
+		t.Error("Observe() = false after the gate opened, want true")
+	}
+
+	status := gate.Status()
+	if status.State != BootstrapSynced || !status.ReadyAt.Equal(now) || !status.Since.Equal(now) {
+		t.Errorf("Status() = %+v", status)
+	}
+	if got := gate.Remaining(now); got != 0 {
+		t.Errorf("Remaining() = %v once open, want 0", got)
+	}
+}
+
+func TestBootstrapGate_Remaining(t *testing.T) {
+	gate := NewBootstrapGate(time.Minute)
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	gate.Observe(now, 0, nil)
+	if got := gate.Remaining(now.Add(15 * time.Second)); got != 45*time.Second {
+		t.Errorf("Remaining() = %v, want 45s", got)
+	}
+	if got := gate.Status().State; got != BootstrapWaiting {
+		t.Errorf("State = %q, want %q", got, BootstrapWaiting)
+	}
+}
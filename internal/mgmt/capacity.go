@@ -0,0 +1,236 @@
+package mgmt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sort"
+)
+
+const (
+	DefaultCapacityWarnPct     float64 = 80
+	DefaultCapacityCriticalPct float64 = 95
+)
+
+// CapacityLevel classifies how close the mesh is to exhausting its address space.
+type CapacityLevel int
+
+const (
+	CapacityOK CapacityLevel = iota
+	CapacityWarning
+	CapacityCritical
+)
+
+func (l CapacityLevel) String() string {
+	switch l {
+	case CapacityOK:
+		return "ok"
+	case CapacityWarning:
+		return "warning"
+	case CapacityCritical:
+		return "critical"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(l))
+	}
+}
+
+// CapacityThresholds are the utilization percentages at which capacity becomes a
+// warning or critical.
+type CapacityThresholds struct {
+	WarnPct     float64
+	CriticalPct float64
+}
+
+// SubnetUtilization is the static IP usage of a single /24 within the mesh subnet.
+type SubnetUtilization struct {
+	Subnet string  `json:"subnet"`
+	Used   int     `json:"used"`
+	Usable int     `json:"usable"`
+	Pct    float64 `json:"pct"`
+}
+
+// CapacityReport summarises mesh-wide address usage.
+type CapacityReport struct {
+	// ClaimedIPs is the number of distinct static IPs claimed inside the subnet.
+	ClaimedIPs int `json:"claimedIps"`
+	// UsableHosts is the number of host addresses in the subnet.
+	UsableHosts int     `json:"usableHosts"`
+	IPPct       float64 `json:"ipPct"`
+
+	// DHCPAllocated is the number of host offsets covered by at least one DHCP pool.
+	// Overlapping pools are only counted once.
+	DHCPAllocated int     `json:"dhcpAllocated"`
+	DHCPAvailable int     `json:"dhcpAvailable"`
+	DHCPPct       float64 `json:"dhcpPct"`
+
+	// LargestDHCPGap is the longest run of offsets not covered by any DHCP pool,
+	// i.e. the largest pool a new node could still be given.
+	LargestDHCPGap int `json:"largestDhcpGap"`
+
+	// Subnets lists the /24s that contain at least one claimed static IP.
+	Subnets []SubnetUtilization `json:"subnets"`
+}
+
+// Level returns the capacity level for the higher of static IP and DHCP utilization.
+func (r *CapacityReport) Level(th CapacityThresholds) CapacityLevel {
+	pct := max(r.IPPct, r.DHCPPct)
+
+	switch {
+	case pct >= th.CriticalPct:
+		return CapacityCritical
+	case pct >= th.WarnPct:
+		return CapacityWarning
+	default:
+		return CapacityOK
+	}
+}
+
+// AnalyzeCapacity computes address usage for the mesh subnet from a set of
+// reservations. It is a pure function of its inputs.
+//
+// Static IPs outside the subnet are ignored. DHCP pools are offsets from the network
+// address, as stored in UCI, and are clamped to the subnet's host range.
+//
+// Parameters:
+//   - reservations: the active reservations, including this node's own
+//   - networkAddr: the mesh network address (e.g., "10.41.0.0")
+//   - subnetMask: the mesh subnet mask (e.g., "255.255.0.0")
+//
+// Returns the capacity report or an error if the network address or mask is invalid.
+//
+// Example:
+//
+//	report, err := AnalyzeCapacity(table.Active(), network.DefaultNetworkAddress, network.DefaultNetworkMask)
+//	if err != nil {
+//	    log.Fatalf("Failed to analyze capacity: %v", err)
+//	}
+//	fmt.Printf("%d/%d static IPs claimed\n", report.ClaimedIPs, report.UsableHosts)
+func AnalyzeCapacity(reservations []Reservation, networkAddr, subnetMask string) (*CapacityReport, error) {
+	ip := net.ParseIP(networkAddr).To4()
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IPv4 network address: %s", networkAddr)
+	}
+
+	mask := net.ParseIP(subnetMask).To4()
+	if mask == nil {
+		return nil, fmt.Errorf("invalid IPv4 subnet mask: %s", subnetMask)
+	}
+
+	ones, bits := net.IPMask(mask).Size()
+	if bits != 32 || ones > 30 {
+		return nil, fmt.Errorf("invalid subnet mask: %s", subnetMask)
+	}
+
+	subnet := &net.IPNet{IP: ip.Mask(net.IPMask(mask)), Mask: net.IPMask(mask)}
+	base := binary.BigEndian.Uint32(subnet.IP)
+	usable := (1 << uint(bits-ones)) - 2
+
+	report := &CapacityReport{
+		UsableHosts: usable,
+	}
+
+	// Static IP usage, overall and per /24
+	claimed := make(map[uint32]bool)
+	perSubnet := make(map[uint32]int)
+	for _, res := range reservations {
+		resIP := net.ParseIP(res.StaticIP).To4()
+		if resIP == nil || !subnet.Contains(resIP) {
+			continue
+		}
+
+		addr := binary.BigEndian.Uint32(resIP)
+		offset := int(addr - base)
+		if offset < 1 || offset > usable || claimed[addr] {
+			continue
+		}
+
+		claimed[addr] = true
+		perSubnet[addr&^0xff]++
+	}
+
+	report.ClaimedIPs = len(claimed)
+	report.IPPct = percent(report.ClaimedIPs, usable)
+
+	// Report /24s in address order
+	blocks := make([]uint32, 0, len(perSubnet))
+	for block := range perSubnet {
+		blocks = append(blocks, block)
+	}
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i] < blocks[j] })
+
+	blockUsable := min(usable, 254)
+	for _, block := range blocks {
+		blockIP := make(net.IP, 4)
+		binary.BigEndian.PutUint32(blockIP, block)
+		report.Subnets = append(report.Subnets, SubnetUtilization{
+			Subnet: fmt.Sprintf("%s/24", blockIP),
+			Used:   perSubnet[block],
+			Usable: blockUsable,
+			Pct:    percent(perSubnet[block], blockUsable),
+		})
+	}
+
+	// DHCP pool usage, merging overlapping pools
+	var pools [][2]int
+	for _, res := range reservations {
+		if res.DHCPStart <= 0 || res.DHCPLimit <= 0 {
+			continue
+		}
+
+		start := res.DHCPStart
+		end := min(res.DHCPStart+res.DHCPLimit-1, usable)
+		if start > end {
+			continue
+		}
+		pools = append(pools, [2]int{start, end})
+	}
+
+	sort.Slice(pools, func(i, j int) bool { return pools[i][0] < pools[j][0] })
+
+	next := 1
+	for _, pool := range pools {
+		if pool[0] > next {
+			report.LargestDHCPGap = max(report.LargestDHCPGap, pool[0]-next)
+		}
+		if pool[1] >= next {
+			report.DHCPAllocated += pool[1] - max(pool[0], next) + 1
+			next = pool[1] + 1
+		}
+	}
+	report.LargestDHCPGap = max(report.LargestDHCPGap, usable-next+1)
+
+	report.DHCPAvailable = usable - report.DHCPAllocated
+	report.DHCPPct = percent(report.DHCPAllocated, usable)
+
+	return report, nil
+}
+
+// percent returns part as a percentage of whole, or 0 if whole is not positive.
+func percent(part, whole int) float64 {
+	if whole <= 0 {
+		return 0
+	}
+	return float64(part) * 100 / float64(whole)
+}
+
+// CapacityMonitor tracks the capacity level between checks so that warnings are only
+// emitted when the level changes rather than on every tick.
+type CapacityMonitor struct {
+	thresholds CapacityThresholds
+	level      CapacityLevel
+}
+
+// NewCapacityMonitor creates a CapacityMonitor starting at CapacityOK.
+func NewCapacityMonitor(thresholds CapacityThresholds) *CapacityMonitor {
+	return &CapacityMonitor{thresholds: thresholds}
+}
+
+// Update records the level of report and returns it along with whether it differs
+// from the previously recorded level.
+func (m *CapacityMonitor) Update(report *CapacityReport) (CapacityLevel, bool) {
+	level := report.Level(m.thresholds)
+	changed := level != m.level
+	m.level = level
+
+	return level, changed
+}
@@ -0,0 +1,265 @@
+package mgmt
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+// reservationsFilling returns n reservations with consecutive static IPs starting at
+// 10.41.1.1 and consecutive 16-address DHCP pools starting at offset 100.
+func reservationsFilling(n int) []Reservation {
+	var out []Reservation
+	for i := 0; i < n; i++ {
+		out = append(out, Reservation{
+			Mac:       fmt.Sprintf("aa:bb:cc:dd:%02x:%02x", i>>8, i&0xff),
+			StaticIP:  fmt.Sprintf("10.41.%d.%d", 1+i/254, 1+i%254),
+			DHCPStart: 100 + i*16,
+			DHCPLimit: 16,
+		})
+	}
+	return out
+}
+
+func TestAnalyzeCapacity_Empty(t *testing.T) {
+	report, err := AnalyzeCapacity(nil, "10.41.0.0", "255.255.0.0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if report.UsableHosts != 65534 {
+		t.Errorf("Expected 65534 usable hosts, got %d", report.UsableHosts)
+	}
+
+	if report.ClaimedIPs != 0 || report.DHCPAllocated != 0 {
+		t.Errorf("Expected no usage, got %+v", report)
+	}
+
+	if report.LargestDHCPGap != 65534 {
+		t.Errorf("Expected whole range as gap, got %d", report.LargestDHCPGap)
+	}
+
+	if report.Level(CapacityThresholds{WarnPct: 80, CriticalPct: 95}) != CapacityOK {
+		t.Error("Expected empty mesh to be OK")
+	}
+}
+
+func TestAnalyzeCapacity_InvalidInput(t *testing.T) {
+	tests := []struct {
+		name string
+		addr string
+		mask string
+	}{
+		{name: "invalid address", addr: "not-an-ip", mask: "255.255.0.0"},
+		{name: "IPv6 address", addr: "fd00::", mask: "255.255.0.0"},
+		{name: "invalid mask", addr: "10.41.0.0", mask: "garbage"},
+		{name: "non-contiguous mask", addr: "10.41.0.0", mask: "255.0.255.0"},
+		{name: "mask too small", addr: "10.41.0.0", mask: "255.255.255.255"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := AnalyzeCapacity(nil, tt.addr, tt.mask); err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestAnalyzeCapacity_FillLevels(t *testing.T) {
+	// A /24 has 254 usable hosts. 16-address pools starting at offset 100 fit
+	// (254-99)/16 = 9 whole pools before being clamped.
+	tests := []struct {
+		name        string
+		count       int
+		wantClaimed int
+		wantLevel   CapacityLevel
+	}{
+		{name: "quarter full", count: 64, wantClaimed: 64, wantLevel: CapacityOK},
+		{name: "warning", count: 210, wantClaimed: 210, wantLevel: CapacityWarning},
+		{name: "critical", count: 245, wantClaimed: 245, wantLevel: CapacityCritical},
+	}
+
+	th := CapacityThresholds{WarnPct: 80, CriticalPct: 95}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reservations []Reservation
+			for i := 0; i < tt.count; i++ {
+				reservations = append(reservations, Reservation{
+					Mac:      fmt.Sprintf("aa:bb:cc:dd:ee:%02x", i),
+					StaticIP: fmt.Sprintf("192.168.1.%d", i+1),
+				})
+			}
+
+			report, err := AnalyzeCapacity(reservations, "192.168.1.0", "255.255.255.0")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if report.ClaimedIPs != tt.wantClaimed {
+				t.Errorf("Expected %d claimed IPs, got %d", tt.wantClaimed, report.ClaimedIPs)
+			}
+
+			if got := report.Level(th); got != tt.wantLevel {
+				t.Errorf("Expected level %s at %.1f%%, got %s", tt.wantLevel, report.IPPct, got)
+			}
+		})
+	}
+}
+
+func TestAnalyzeCapacity_StaticIPs(t *testing.T) {
+	reservations := reservationsFilling(300)
+	reservations = append(reservations,
+		// Duplicate claim is counted once
+		Reservation{Mac: "ff:ff:ff:ff:ff:01", StaticIP: "10.41.1.1"},
+		// Outside the subnet and invalid addresses are ignored
+		Reservation{Mac: "ff:ff:ff:ff:ff:02", StaticIP: "192.168.1.1"},
+		Reservation{Mac: "ff:ff:ff:ff:ff:03", StaticIP: "bogus"},
+		// Network address is not a host
+		Reservation{Mac: "ff:ff:ff:ff:ff:04", StaticIP: "10.41.0.0"},
+	)
+
+	report, err := AnalyzeCapacity(reservations, "10.41.0.0", "255.255.0.0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if report.ClaimedIPs != 300 {
+		t.Errorf("Expected 300 claimed IPs, got %d", report.ClaimedIPs)
+	}
+
+	if len(report.Subnets) != 2 {
+		t.Fatalf("Expected 2 /24 subnets in use, got %d", len(report.Subnets))
+	}
+
+	if report.Subnets[0].Subnet != "10.41.1.0/24" || report.Subnets[0].Used != 254 {
+		t.Errorf("Unexpected first subnet: %+v", report.Subnets[0])
+	}
+
+	if report.Subnets[1].Subnet != "10.41.2.0/24" || report.Subnets[1].Used != 46 {
+		t.Errorf("Unexpected second subnet: %+v", report.Subnets[1])
+	}
+
+	if math.Abs(report.Subnets[0].Pct-100) > 0.001 {
+		t.Errorf("Expected full first subnet, got %.2f%%", report.Subnets[0].Pct)
+	}
+}
+
+func TestAnalyzeCapacity_DHCPPools(t *testing.T) {
+	tests := []struct {
+		name          string
+		pools         [][2]int // start, limit
+		wantAllocated int
+		wantGap       int
+	}{
+		{
+			name:          "single pool",
+			pools:         [][2]int{{100, 16}},
+			wantAllocated: 16,
+			wantGap:       65534 - 115,
+		},
+		{
+			name:          "overlapping pools counted once",
+			pools:         [][2]int{{100, 16}, {108, 16}, {102, 4}},
+			wantAllocated: 24,
+			wantGap:       65534 - 123,
+		},
+		{
+			name:          "pool past the end is clamped",
+			pools:         [][2]int{{65530, 16}},
+			wantAllocated: 5,
+			wantGap:       65529,
+		},
+		{
+			name:          "invalid pools ignored",
+			pools:         [][2]int{{0, 16}, {100, 0}, {-5, 10}},
+			wantAllocated: 0,
+			wantGap:       65534,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reservations []Reservation
+			for i, pool := range tt.pools {
+				reservations = append(reservations, Reservation{
+					Mac:       fmt.Sprintf("aa:bb:cc:dd:ee:%02x", i),
+					DHCPStart: pool[0],
+					DHCPLimit: pool[1],
+				})
+			}
+
+			report, err := AnalyzeCapacity(reservations, "10.41.0.0", "255.255.0.0")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if report.DHCPAllocated != tt.wantAllocated {
+				t.Errorf("Expected %d allocated, got %d", tt.wantAllocated, report.DHCPAllocated)
+			}
+
+			if report.DHCPAvailable != 65534-tt.wantAllocated {
+				t.Errorf("Expected %d available, got %d", 65534-tt.wantAllocated, report.DHCPAvailable)
+			}
+
+			if report.LargestDHCPGap != tt.wantGap {
+				t.Errorf("Expected largest gap %d, got %d", tt.wantGap, report.LargestDHCPGap)
+			}
+		})
+	}
+}
+
+func TestAnalyzeCapacity_FragmentedDHCP(t *testing.T) {
+	// 8-address pools every 10 offsets across a /24 leave 54 free addresses in total
+	// but no gap larger than 2 inside the pooled area.
+	var reservations []Reservation
+	for start := 1; start+7 <= 250; start += 10 {
+		reservations = append(reservations, Reservation{
+			Mac:       fmt.Sprintf("aa:bb:cc:dd:ee:%02x", start),
+			DHCPStart: start,
+			DHCPLimit: 8,
+		})
+	}
+
+	report, err := AnalyzeCapacity(reservations, "192.168.1.0", "255.255.255.0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if report.DHCPAllocated != 200 {
+		t.Errorf("Expected 200 allocated, got %d", report.DHCPAllocated)
+	}
+
+	// The trailing 249..254 run is the largest gap
+	if report.LargestDHCPGap != 6 {
+		t.Errorf("Expected largest gap 6, got %d", report.LargestDHCPGap)
+	}
+
+	if got := report.Level(CapacityThresholds{WarnPct: 75, CriticalPct: 95}); got != CapacityWarning {
+		t.Errorf("Expected warning for %.1f%% DHCP allocation, got %s", report.DHCPPct, got)
+	}
+}
+
+func TestCapacityMonitor_Update(t *testing.T) {
+	monitor := NewCapacityMonitor(CapacityThresholds{WarnPct: 80, CriticalPct: 95})
+
+	steps := []struct {
+		pct         float64
+		wantLevel   CapacityLevel
+		wantChanged bool
+	}{
+		{pct: 10, wantLevel: CapacityOK, wantChanged: false},
+		{pct: 85, wantLevel: CapacityWarning, wantChanged: true},
+		{pct: 90, wantLevel: CapacityWarning, wantChanged: false},
+		{pct: 96, wantLevel: CapacityCritical, wantChanged: true},
+		{pct: 50, wantLevel: CapacityOK, wantChanged: true},
+	}
+
+	for i, step := range steps {
+		level, changed := monitor.Update(&CapacityReport{IPPct: step.pct})
+		if level != step.wantLevel || changed != step.wantChanged {
+			t.Errorf("step %d: got (%s, %v), want (%s, %v)", i, level, changed, step.wantLevel, step.wantChanged)
+		}
+	}
+}
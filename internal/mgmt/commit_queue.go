@@ -0,0 +1,128 @@
+package mgmt
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	commitQueueInitialBackoff time.Duration = 5 * time.Second
+	commitQueueMaxBackoff     time.Duration = 5 * time.Minute
+)
+
+// pendingCommit is a deferred write step that failed because the configuration
+// filesystem was read-only.
+type pendingCommit struct {
+	name   string
+	commit func() error
+}
+
+// CommitQueue holds UCI commits that failed with network.ErrReadOnlyFS and retries
+// them in order with exponential backoff. The staged changes themselves live in the
+// UCI trees, so retrying a commit writes exactly what the original call staged.
+//
+// While commits are pending the queue is degraded: a single warning is logged when
+// the queue first becomes degraded and a single info message when it recovers, so
+// callers do not need to log every failed retry.
+type CommitQueue struct {
+	log zerolog.Logger
+
+	mu          sync.Mutex
+	pending     []pendingCommit
+	backoff     time.Duration
+	nextAttempt time.Time
+	degraded    bool
+
+	// now is overridable for tests.
+	now func() time.Time
+}
+
+// NewCommitQueue creates an empty CommitQueue that logs degraded and recovery
+// transitions to log.
+func NewCommitQueue(log zerolog.Logger) *CommitQueue {
+	return &CommitQueue{
+		log: log,
+		now: time.Now,
+	}
+}
+
+// Enqueue adds a commit step to the end of the queue and marks the queue degraded.
+// A step with the same name as one already pending is not added twice, as the
+// earlier entry will write the same staged changes.
+func (q *CommitQueue) Enqueue(name string, commit func() error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, p := range q.pending {
+		if p.name == name {
+			return
+		}
+	}
+
+	q.pending = append(q.pending, pendingCommit{name: name, commit: commit})
+
+	if !q.degraded {
+		q.degraded = true
+		q.backoff = commitQueueInitialBackoff
+		q.nextAttempt = q.now().Add(q.backoff)
+		q.log.Warn().Str("step", name).Msg("Configuration filesystem is read-only, queueing UCI commits for retry")
+	}
+}
+
+// Pending returns the number of queued commit steps.
+func (q *CommitQueue) Pending() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.pending)
+}
+
+// Degraded returns true while there are commits waiting to be applied.
+func (q *CommitQueue) Degraded() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.degraded
+}
+
+// Flush retries queued commits in order if the backoff period has elapsed.
+// Steps are removed as they succeed; the first failure stops the flush and doubles
+// the backoff (capped at commitQueueMaxBackoff). It returns true once the queue is
+// empty, which is also the case when there was nothing to flush.
+func (q *CommitQueue) Flush() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.pending) == 0 {
+		return true
+	}
+
+	now := q.now()
+	if now.Before(q.nextAttempt) {
+		return false
+	}
+
+	for len(q.pending) > 0 {
+		step := q.pending[0]
+		if err := step.commit(); err != nil {
+			q.backoff *= 2
+			if q.backoff > commitQueueMaxBackoff {
+				q.backoff = commitQueueMaxBackoff
+			}
+			q.nextAttempt = now.Add(q.backoff)
+			q.log.Debug().Err(err).Str("step", step.name).Dur("backoff", q.backoff).Msg("Queued UCI commit failed, backing off")
+
+			return false
+		}
+
+		q.pending = q.pending[1:]
+	}
+
+	q.degraded = false
+	q.backoff = 0
+	q.log.Info().Msg("Configuration filesystem writable again, queued UCI commits applied")
+
+	return true
+}
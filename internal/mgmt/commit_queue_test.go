@@ -0,0 +1,178 @@
+package mgmt
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/openmanet/openmanetd/internal/network"
+	"github.com/rs/zerolog"
+)
+
+// fakeClock is a manually advanced clock for the tests of the workers and tables
+// that read the time through a now func.
+type fakeClock struct {
+	t time.Time
+}
+
+// newFakeClock returns a clock stopped at the start of 2025.
+func newFakeClock() *fakeClock {
+	return &fakeClock{t: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time { return c.t }
+
+func (c *fakeClock) Advance(d time.Duration) { c.t = c.t.Add(d) }
+
+// slowTick returns a tick body that takes d.
+func (c *fakeClock) slowTick(d time.Duration) func() {
+	return func() { c.Advance(d) }
+}
+
+// readOnlyErr mimics the error a UCI reader returns when the overlay is read-only.
+func readOnlyErr() error {
+	return fmt.Errorf("%w: %w", network.ErrReadOnlyFS, &os.PathError{Op: "open", Path: "/etc/config/network", Err: syscall.EROFS})
+}
+
+func newTestCommitQueue() (*CommitQueue, *fakeClock) {
+	clock := newFakeClock()
+	q := NewCommitQueue(zerolog.Nop())
+	q.now = clock.Now
+
+	return q, clock
+}
+
+func TestCommitQueue_EmptyFlush(t *testing.T) {
+	q, _ := newTestCommitQueue()
+
+	if !q.Flush() {
+		t.Error("Expected Flush on empty queue to report success")
+	}
+
+	if q.Degraded() {
+		t.Error("Expected empty queue not to be degraded")
+	}
+}
+
+func TestCommitQueue_RetriesInOrderUntilWritable(t *testing.T) {
+	q, clock := newTestCommitQueue()
+
+	readOnly := true
+	var applied []string
+
+	step := func(name string) func() error {
+		return func() error {
+			if readOnly {
+				return readOnlyErr()
+			}
+			applied = append(applied, name)
+			return nil
+		}
+	}
+
+	q.Enqueue("network", step("network"))
+	q.Enqueue("dhcp", step("dhcp"))
+	q.Enqueue("network", step("network-duplicate"))
+	q.Enqueue("finalize", step("finalize"))
+
+	if got := q.Pending(); got != 3 {
+		t.Fatalf("Expected 3 pending commits, got %d", got)
+	}
+
+	if !q.Degraded() {
+		t.Fatal("Expected queue to be degraded after Enqueue")
+	}
+
+	// Before the initial backoff has elapsed nothing is attempted.
+	if q.Flush() {
+		t.Error("Expected Flush before backoff to report pending commits")
+	}
+
+	// First attempt fails, backoff doubles to 10s.
+	clock.Advance(commitQueueInitialBackoff)
+	if q.Flush() {
+		t.Error("Expected Flush on read-only filesystem to fail")
+	}
+
+	clock.Advance(9 * time.Second)
+	readOnly = false
+	if q.Flush() {
+		t.Error("Expected Flush to wait for the doubled backoff")
+	}
+	if len(applied) != 0 {
+		t.Errorf("Expected no commits applied yet, got %v", applied)
+	}
+
+	clock.Advance(time.Second)
+	if !q.Flush() {
+		t.Fatal("Expected Flush to succeed once filesystem is writable")
+	}
+
+	want := []string{"network", "dhcp", "finalize"}
+	if len(applied) != len(want) {
+		t.Fatalf("Expected applied %v, got %v", want, applied)
+	}
+	for i := range want {
+		if applied[i] != want[i] {
+			t.Errorf("applied[%d] = %q, want %q", i, applied[i], want[i])
+		}
+	}
+
+	if q.Degraded() {
+		t.Error("Expected queue to recover after all commits applied")
+	}
+
+	if got := q.Pending(); got != 0 {
+		t.Errorf("Expected no pending commits, got %d", got)
+	}
+}
+
+func TestCommitQueue_PartialFlushKeepsRemaining(t *testing.T) {
+	q, clock := newTestCommitQueue()
+
+	calls := 0
+	q.Enqueue("network", func() error { return nil })
+	q.Enqueue("dhcp", func() error {
+		calls++
+		if calls == 1 {
+			return readOnlyErr()
+		}
+		return nil
+	})
+
+	clock.Advance(commitQueueInitialBackoff)
+	if q.Flush() {
+		t.Fatal("Expected Flush to stop at failing commit")
+	}
+
+	if got := q.Pending(); got != 1 {
+		t.Errorf("Expected 1 pending commit after partial flush, got %d", got)
+	}
+
+	clock.Advance(2 * commitQueueInitialBackoff)
+	if !q.Flush() {
+		t.Error("Expected remaining commit to be applied")
+	}
+}
+
+func TestCommitQueue_BackoffCapped(t *testing.T) {
+	q, clock := newTestCommitQueue()
+
+	q.Enqueue("network", func() error { return errors.New("still read-only") })
+
+	for i := 0; i < 20; i++ {
+		clock.Advance(commitQueueMaxBackoff)
+		q.Flush()
+	}
+
+	if q.backoff != commitQueueMaxBackoff {
+		t.Errorf("Expected backoff capped at %v, got %v", commitQueueMaxBackoff, q.backoff)
+	}
+
+	if !q.Degraded() {
+		t.Error("Expected queue to remain degraded while commits fail")
+	}
+}
@@ -0,0 +1,175 @@
+package mgmt
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/openmanet/openmanetd/internal/network"
+	"github.com/rs/zerolog"
+)
+
+// DefaultConfigCheckInterval is how often the UCI config files are checked for
+// changes made outside openmanetd.
+const DefaultConfigCheckInterval time.Duration = 10 * time.Second
+
+// ConfigChange is a managed UCI section that was changed outside openmanetd, e.g.
+// in LuCI or with the uci command.
+type ConfigChange struct {
+	Config  string
+	Section string
+}
+
+// watchedReader is a UCI reader whose config the watcher reloads.
+type watchedReader interface {
+	network.DeviceConfigReader
+	network.ChangeReporter
+}
+
+// fileStamp identifies a version of a config file well enough to notice a write.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// watchedConfig is one UCI config file and the reader openmanetd changes it through.
+type watchedConfig struct {
+	name   string
+	reader watchedReader
+	// read returns a managed section as seen through reader.
+	read  func(section string, reader watchedReader) any
+	stamp fileStamp
+}
+
+// ConfigWatcher polls the UCI config files openmanetd writes and notices when
+// someone else changes them. The readers cache a config once loaded and a commit
+// writes the whole cached config back, so without a reload the next commit would
+// silently undo a manual change. On a change, the watcher reloads the reader of the
+// config and tells subscribers which managed sections now differ from what
+// openmanetd had seen.
+//
+// A config is only reloaded while its reader has no staged changes, so that a
+// change in progress is not dropped; it is checked again on the next tick.
+type ConfigWatcher struct {
+	log      zerolog.Logger
+	dir      string
+	configs  []*watchedConfig
+	sections func() []string
+
+	mu        sync.Mutex
+	listeners []func(ConfigChange)
+}
+
+// NewConfigWatcher creates a watcher for the network and dhcp configs in dir,
+// usually uci.DefaultTreePath, read through the readers of deps. sections returns
+// the sections openmanetd manages, e.g. the mesh interface and its DHCP pool.
+func NewConfigWatcher(dir string, deps Deps, sections func() []string, log zerolog.Logger) *ConfigWatcher {
+	w := &ConfigWatcher{log: log, dir: dir, sections: sections}
+
+	w.watch("network", deps.UCINetwork, func(section string, r watchedReader) any {
+		cfg, _ := network.GetUCINetworkByNameWithReader(section, r)
+		return cfg
+	})
+	w.watch("dhcp", deps.UCIDHCP, func(section string, r watchedReader) any {
+		cfg, _ := network.GetDHCPConfigWithReader(section, r)
+		return cfg
+	})
+
+	return w
+}
+
+// watch adds config to the watched configs, seeded with the current file.
+func (w *ConfigWatcher) watch(name string, reader watchedReader, read func(string, watchedReader) any) {
+	stamp, _ := w.stat(name)
+	w.configs = append(w.configs, &watchedConfig{name: name, reader: reader, read: read, stamp: stamp})
+}
+
+func (w *ConfigWatcher) stat(name string) (fileStamp, error) {
+	info, err := os.Stat(filepath.Join(w.dir, name))
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}, nil
+}
+
+// OnChange registers fn to be called for every managed section changed outside
+// openmanetd.
+func (w *ConfigWatcher) OnChange(fn func(ConfigChange)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.listeners = append(w.listeners, fn)
+}
+
+// Check looks at every watched config once. A config whose file changed is
+// reloaded and the listeners are told about the managed sections that changed.
+// Commits made by openmanetd itself change the file too, but leave the sections as
+// the reader had them and are not reported. Neither is a config the reader has not
+// loaded or has reverted, as it has no copy that could be written back.
+//
+// Returns the changed sections.
+func (w *ConfigWatcher) Check() []ConfigChange {
+	var changes []ConfigChange
+
+	for _, c := range w.configs {
+		stamp, err := w.stat(c.name)
+		if err != nil || stamp == c.stamp {
+			continue
+		}
+		if staged := c.reader.Changes(); len(staged) > 0 {
+			w.log.Debug().Str("config", c.name).Int("staged", len(staged)).Msg("Config file changed while changes are staged, checking again later")
+			continue
+		}
+
+		sections := w.sections()
+		before := make([]any, len(sections))
+		for i, section := range sections {
+			before[i] = c.read(section, c.reader)
+		}
+
+		if err := c.reader.ReloadConfig(); err != nil {
+			w.log.Error().Err(err).Str("config", c.name).Msg("Error reloading changed config")
+			continue
+		}
+		c.stamp = stamp
+
+		for i, section := range sections {
+			if !reflect.DeepEqual(before[i], c.read(section, c.reader)) {
+				changes = append(changes, ConfigChange{Config: c.name, Section: section})
+			}
+		}
+	}
+
+	if len(changes) == 0 {
+		return nil
+	}
+
+	w.mu.Lock()
+	listeners := append([]func(ConfigChange){}, w.listeners...)
+	w.mu.Unlock()
+
+	for _, change := range changes {
+		w.log.Warn().Bool("audit", true).Str("config", change.Config).Str("section", change.Section).Msg("Managed UCI section changed outside openmanetd")
+		for _, fn := range listeners {
+			fn(change)
+		}
+	}
+
+	return changes
+}
+
+// Run checks the configs every interval until shutdown is closed or signalled.
+func (w *ConfigWatcher) Run(interval time.Duration, shutdown <-chan os.Signal) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-shutdown:
+			return
+		case <-ticker.C:
+			w.Check()
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package mgmt
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/digineo/go-uci/v2"
+	"github.com/openmanet/openmanetd/internal/network"
+	"github.com/rs/zerolog"
+)
+
+const watcherNetworkConfig = `
+config interface 'ahwlan'
+	option proto 'static'
+	option ipaddr '10.41.1.5'
+	option netmask '255.255.0.0'
+
+config interface 'guest'
+	option proto 'static'
+	option ipaddr '10.42.0.1'
+`
+
+const watcherDHCPConfig = `
+config dhcp 'ahwlan'
+	option interface 'ahwlan'
+	option start '100'
+	option limit '150'
+`
+
+// writeConfig writes a config file and moves its modification time forward, so
+// that the write is seen even within the timestamp granularity of the filesystem.
+func writeConfig(t *testing.T, dir, name, content string) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	bumpModTime(t, path)
+}
+
+var modTimeBump = time.Now()
+
+func bumpModTime(t *testing.T, path string) {
+	t.Helper()
+	modTimeBump = modTimeBump.Add(time.Second)
+	if err := os.Chtimes(path, modTimeBump, modTimeBump); err != nil {
+		t.Fatalf("Chtimes() error = %v", err)
+	}
+}
+
+func TestConfigWatcher_Check(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, "network", watcherNetworkConfig)
+	writeConfig(t, dir, "dhcp", watcherDHCPConfig)
+
+	tree := uci.NewTree(dir)
+	deps := Deps{
+		UCINetwork: network.NewUCINetworkConfigReaderWithTree(tree),
+		UCIDHCP:    network.NewUCIDHCPConfigReaderWithTree(tree),
+	}
+	w := NewConfigWatcher(dir, deps, func() []string { return []string{"ahwlan"} }, zerolog.Nop())
+
+	var notified []ConfigChange
+	w.OnChange(func(c ConfigChange) { notified = append(notified, c) })
+
+	// The readers load the configs as openmanetd would
+	if cfg, _ := network.GetUCINetworkByNameWithReader("ahwlan", deps.UCINetwork); cfg.IPAddr != "10.41.1.5" {
+		t.Fatalf("ipaddr = %q", cfg.IPAddr)
+	}
+	if cfg, _ := network.GetDHCPConfigWithReader("ahwlan", deps.UCIDHCP); cfg.Limit != "150" {
+		t.Fatalf("limit = %q", cfg.Limit)
+	}
+
+	if got := w.Check(); got != nil {
+		t.Errorf("Check() without a change = %v", got)
+	}
+
+	// A commit of openmanetd is not reported
+	if err := network.SetNetworkIPAddrWithReader("ahwlan", "10.41.1.6", deps.UCINetwork); err != nil {
+		t.Fatalf("SetNetworkIPAddrWithReader() error = %v", err)
+	}
+	bumpModTime(t, filepath.Join(dir, "network"))
+	if got := w.Check(); got != nil {
+		t.Errorf("Check() after an own commit = %v", got)
+	}
+
+	// An edit of an unmanaged section is reloaded but not reported
+	writeConfig(t, dir, "network", `
+config interface 'ahwlan'
+	option proto 'static'
+	option ipaddr '10.41.1.6'
+	option netmask '255.255.0.0'
+
+config interface 'guest'
+	option proto 'static'
+	option ipaddr '10.42.0.2'
+`)
+	if got := w.Check(); got != nil {
+		t.Errorf("Check() after an unmanaged edit = %v", got)
+	}
+	if cfg, _ := network.GetUCINetworkByNameWithReader("guest", deps.UCINetwork); cfg.IPAddr != "10.42.0.2" {
+		t.Errorf("guest ipaddr after reload = %q, want 10.42.0.2", cfg.IPAddr)
+	}
+
+	// An edit of a managed section is reloaded and reported
+	writeConfig(t, dir, "dhcp", `
+config dhcp 'ahwlan'
+	option interface 'ahwlan'
+	option start '100'
+	option limit '50'
+`)
+	want := []ConfigChange{{Config: "dhcp", Section: "ahwlan"}}
+	if got := w.Check(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Check() after a managed edit = %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(notified, want) {
+		t.Errorf("listeners were told %v, want %v", notified, want)
+	}
+	if cfg, _ := network.GetDHCPConfigWithReader("ahwlan", deps.UCIDHCP); cfg.Limit != "50" {
+		t.Errorf("limit after reload = %q, want 50", cfg.Limit)
+	}
+}
+
+func TestConfigWatcher_StagedChanges(t *testing.T) {
+	dir := t.TempDir()
+	writeConfig(t, dir, "network", watcherNetworkConfig)
+	writeConfig(t, dir, "dhcp", watcherDHCPConfig)
+
+	tree := uci.NewTree(dir)
+	deps := Deps{
+		UCINetwork: network.NewUCINetworkConfigReaderWithTree(tree),
+		UCIDHCP:    network.NewUCIDHCPConfigReaderWithTree(tree),
+	}
+	w := NewConfigWatcher(dir, deps, func() []string { return []string{"ahwlan"} }, zerolog.Nop())
+
+	if err := deps.UCINetwork.SetType("network", "guest", "proto", uci.TypeOption, "dhcp"); err != nil {
+		t.Fatalf("SetType() error = %v", err)
+	}
+	writeConfig(t, dir, "network", `
+config interface 'ahwlan'
+	option proto 'static'
+	option ipaddr '10.41.1.9'
+	option netmask '255.255.0.0'
+`)
+
+	// The staged change is kept until it is committed or reverted
+	if got := w.Check(); got != nil {
+		t.Errorf("Check() with staged changes = %v", got)
+	}
+	if got := deps.UCINetwork.Changes(); len(got) != 1 {
+		t.Errorf("staged changes = %v, want the proto change kept", got)
+	}
+
+	deps.UCINetwork.Revert()
+	if got := w.Check(); got != nil {
+		t.Errorf("Check() after the revert = %v, want nothing as the reader had dropped its copy", got)
+	}
+	if cfg, _ := network.GetUCINetworkByNameWithReader("ahwlan", deps.UCINetwork); cfg.IPAddr != "10.41.1.9" {
+		t.Errorf("ipaddr after the revert = %q, want 10.41.1.9", cfg.IPAddr)
+	}
+}
@@ -0,0 +1,276 @@
+package mgmt
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/openmanet/go-alfred"
+	proto "github.com/openmanet/openmanetd/internal/api/openmanet/v1"
+	batmanadv "github.com/openmanet/openmanetd/internal/batman-adv"
+	"github.com/openmanet/openmanetd/internal/network"
+	"github.com/rs/zerolog"
+)
+
+// The benchmarks below time the decisions a receive tick makes, end to end, on
+// meshes of increasing size: what the reservation worker does with the records
+// alfred returned until it knows the address and DHCP pool to claim, and what the
+// gateway worker does until the default route is in place. alfred, batctl, UCI and
+// netlink are replaced by fixtures and fakes, so only the decision code is timed.
+//
+// To see whether a change makes them slower, run them before and after it and
+// compare the two runs with benchstat (golang.org/x/perf/cmd/benchstat):
+//
+//	go test ./internal/mgmt -run '^$' -bench 'Tick$' -benchmem -count 10 > old.txt
+//	# apply the change
+//	go test ./internal/mgmt -run '^$' -bench 'Tick$' -benchmem -count 10 > new.txt
+//	benchstat old.txt new.txt
+//
+// TestDecisionPath_WallTime runs the 1k node case once, also under -short, so that a
+// pathological slowdown fails the tests rather than only showing in benchmarks.
+
+const benchSelfMAC = "02:00:ff:ff:ff:ff"
+
+// decisionWallTimeBound is how long one decision on a 1k node mesh may take in
+// TestDecisionPath_WallTime. It is orders of magnitude above the benchmarked time,
+// so that only pathological regressions trip it on a loaded CI machine.
+const decisionWallTimeBound = 2 * time.Second
+
+// benchMAC returns the mesh MAC of the i-th fixture node.
+func benchMAC(i int) string {
+	return fmt.Sprintf("02:00:%02x:%02x:%02x:%02x", byte(i>>24), byte(i>>16), byte(i>>8), byte(i))
+}
+
+// benchReservationRecords returns the records of a mesh of n configured nodes, each
+// with a static IP in the node pool and a DHCP pool of the default size. Pools are
+// laid out back to back from the default offset and wrap around once the mesh
+// outgrows the network, as they would overlap on a mesh that size.
+func benchReservationRecords(tb testing.TB, n int) []alfred.Record {
+	tb.Helper()
+
+	thirds := nodePoolThirds(tb)
+	poolSlots := (65534 - network.DefaultDHCPStartOffset) / network.DefaultDHCPAddressLimit
+
+	records := make([]alfred.Record, n)
+	for i := range records {
+		res := &proto.AddressReservation{
+			Mac:             benchMAC(i),
+			StaticIp:        fmt.Sprintf("10.41.%d.%d", thirds[i/254%len(thirds)], 1+i%254),
+			ReservationCidr: network.DefaultNetworkAddress + "/16",
+			UciDhcpStart:    fmt.Sprint(network.DefaultDHCPStartOffset + i%poolSlots*network.DefaultDHCPAddressLimit),
+			UciDhcpLimit:    fmt.Sprint(network.DefaultDHCPAddressLimit),
+			Hostname:        fmt.Sprintf("node-%d", i),
+			MeshId:          "default",
+			SchemaVersion:   ReservationSchemaVersion,
+			RefreshedAt:     time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC).Unix(),
+		}
+		data, err := res.MarshalVT()
+		if err != nil {
+			tb.Fatalf("MarshalVT() error = %v", err)
+		}
+		records[i] = alfred.Record{Data: data}
+	}
+
+	return records
+}
+
+// nodePoolThirds returns the third octets of the /24 blocks of the node pool.
+func nodePoolThirds(tb testing.TB) []int {
+	tb.Helper()
+
+	var thirds []int
+	for _, block := range network.DefaultMeshAddressing().StaticIPPool(false).Blocks() {
+		var third int
+		if _, err := fmt.Sscanf(block, "10.41.%d.0/24", &third); err != nil {
+			tb.Fatalf("Sscanf(%q) error = %v", block, err)
+		}
+		thirds = append(thirds, third)
+	}
+	return thirds
+}
+
+// benchDeps returns the filters of a node on the default mesh, with the tick limit
+// raised to n so that every record reaches the stages after the limiter.
+func benchDeps(n int) Deps {
+	log := zerolog.Nop()
+	return Deps{
+		Log:          log,
+		MeshFilter:   NewMeshFilter("default", true, true, log),
+		SchemaFilter: NewSchemaFilter(log),
+		RecordLimits: NewRecordLimiter(RecordLimits{MaxRecords: n}, log),
+	}
+}
+
+// reservationDecision runs the decisions of an address reservation receive tick on
+// records: limit and filter, decode, pick the freshest record of every node and look
+// for conflicts, then select a static IP and a DHCP pool as an unconfigured node.
+func reservationDecision(deps Deps, tracker *RecordTracker, records []alfred.Record) (string, int, error) {
+	records = deps.RecordLimits.Limit("reservation", records)
+	records = deps.MeshFilter.FilterReservations(deps.SchemaFilter.FilterReservations(records))
+
+	decoded, err := tracker.DecodeReservationRecords(records)
+	if err != nil {
+		return "", 0, err
+	}
+	tracker.Prune()
+	_ = findReservationConflicts(freshestReservations(decoded))
+
+	staticIP, err := resolveStaticIP(network.DefaultMeshAddressing(), records, nil, "", PinConflictFail, network.IPAllocationSequential, false, benchSelfMAC, deps.Log)
+	if err != nil {
+		return "", 0, err
+	}
+
+	dhcpStart, err := network.CalculateAvailableDHCPStart(records, network.DefaultNetworkAddress, network.DefaultNetworkMask, network.DefaultDHCPAddressLimit)
+	if errors.Is(err, network.ErrNoAvailableAddress) {
+		// Past a few thousand nodes every pool slot is taken; the scan that found
+		// out is still part of the tick
+		err = nil
+	}
+
+	return staticIP, dhcpStart, err
+}
+
+func BenchmarkReservationTick(b *testing.B) {
+	for _, n := range []int{10, 1000, 10000} {
+		b.Run(fmt.Sprintf("records=%d", n), func(b *testing.B) {
+			records := benchReservationRecords(b, n)
+			deps := benchDeps(n)
+			tracker := NewRecordTracker(DefaultReservationTTL)
+
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, _, err := reservationDecision(deps, tracker, records); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// benchGateways returns the gateway records and batman-adv gateway list of a mesh
+// with n gateways. The last gateway is batman-adv's best.
+func benchGateways(tb testing.TB, n int) ([]alfred.Record, batmanadv.Gateways) {
+	tb.Helper()
+
+	records := make([]alfred.Record, n)
+	batGwys := make(batmanadv.Gateways, n)
+	for i := range n {
+		gw := &proto.Gateway{
+			Mac:      benchMAC(i),
+			Hostname: fmt.Sprintf("gateway-%d", i),
+			Ipaddr:   fmt.Sprintf("10.41.0.%d", 1+i),
+			MeshId:   "default",
+		}
+		data, err := gw.MarshalVT()
+		if err != nil {
+			tb.Fatalf("MarshalVT() error = %v", err)
+		}
+		records[i] = alfred.Record{Data: data}
+
+		batGwys[i] = batmanadv.Gateway{
+			HardIfindex:   3,
+			HardIfname:    "wlan0",
+			OrigAddress:   gw.Mac,
+			Best:          i == n-1,
+			Throughput:    1000 * (i + 1),
+			BandwidthUp:   10000,
+			BandwidthDown: 50000,
+			Router:        benchMAC(i),
+		}
+	}
+
+	return records, batGwys
+}
+
+// gatewayDecision runs the decisions of a gateway receive tick on records: limit
+// and filter, decode, match the freshest records against batman-adv's gateways,
+// apply the hold, and point the default route at the selected gateway.
+func gatewayDecision(gw *GatewayWorker, t Tunables, records []alfred.Record, batGwys batmanadv.Gateways, now time.Time) (*proto.Gateway, error) {
+	records = gw.Deps.MeshFilter.FilterGateways(gw.Deps.RecordLimits.Limit("gateway", records))
+
+	decoded, err := gw.records.DecodeGatewayRecords(records)
+	if err != nil {
+		return nil, err
+	}
+	gw.records.Prune()
+
+	byMAC := freshestGateways(decoded)
+	selected := preferGateway(batGwys, byMAC, gw.probes.IsSuspect)
+	if selected == nil {
+		return nil, errors.New("no gateway selected")
+	}
+
+	hold := gw.Config.MeshHealthPolicy.GatewayHold(nil)
+	selected = holdGateway(selected, currentGateway(batGwys, byMAC, gw.currentGateway), now.Sub(gw.selectedAt), hold, gw.probes.IsSuspect)
+
+	if err := gw.installDefaultRoute(t, net.ParseIP(selected.Ipaddr)); err != nil {
+		return nil, err
+	}
+	gw.currentGateway = selected.Mac
+	gw.selectedAt = now
+
+	return selected, nil
+}
+
+// newBenchGatewayWorker returns a gateway worker routing through a fake route table.
+func newBenchGatewayWorker(n int) *GatewayWorker {
+	return &GatewayWorker{
+		Config:  &ManagementConfig{Log: zerolog.Nop()},
+		Deps:    benchDeps(n),
+		probes:  NewGatewayProbeTracker(zerolog.Nop()),
+		records: NewRecordTracker(DefaultReservationTTL),
+		routes:  newFakeRouteTable(),
+	}
+}
+
+func BenchmarkGatewayTick(b *testing.B) {
+	t := Tunables{IFace: "br-ahwlan", BatInterface: "bat0"}
+
+	for _, n := range []int{1, 10, 50} {
+		b.Run(fmt.Sprintf("gateways=%d", n), func(b *testing.B) {
+			records, batGwys := benchGateways(b, n)
+			gw := newBenchGatewayWorker(n)
+			now := time.Now()
+
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := gatewayDecision(gw, t, records, batGwys, now); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestDecisionPath_WallTime(t *testing.T) {
+	records := benchReservationRecords(t, 1000)
+
+	start := time.Now()
+	staticIP, dhcpStart, err := reservationDecision(benchDeps(len(records)), NewRecordTracker(DefaultReservationTTL), records)
+	if elapsed := time.Since(start); elapsed > decisionWallTimeBound {
+		t.Errorf("reservation decision on 1k records took %s, want under %s", elapsed, decisionWallTimeBound)
+	}
+	if err != nil {
+		t.Fatalf("reservationDecision() error = %v", err)
+	}
+	if staticIP == "" || dhcpStart == 0 {
+		t.Errorf("reservationDecision() = %q, %d; want an address and a pool", staticIP, dhcpStart)
+	}
+
+	gwRecords, batGwys := benchGateways(t, 50)
+	gw := newBenchGatewayWorker(len(gwRecords))
+
+	start = time.Now()
+	selected, err := gatewayDecision(gw, Tunables{IFace: "br-ahwlan"}, gwRecords, batGwys, start)
+	if elapsed := time.Since(start); elapsed > decisionWallTimeBound {
+		t.Errorf("gateway decision on 50 gateways took %s, want under %s", elapsed, decisionWallTimeBound)
+	}
+	if err != nil {
+		t.Fatalf("gatewayDecision() error = %v", err)
+	}
+	if want := batGwys[len(batGwys)-1].OrigAddress; selected.Mac != want {
+		t.Errorf("gatewayDecision() selected %s, want best gateway %s", selected.Mac, want)
+	}
+}
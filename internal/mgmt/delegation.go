@@ -0,0 +1,490 @@
+package mgmt
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openmanet/go-alfred"
+	proto "github.com/openmanet/openmanetd/internal/api/openmanet/v1"
+	"github.com/openmanet/openmanetd/internal/network"
+	"github.com/rs/zerolog"
+)
+
+// IP allocation modes.
+const (
+	// IPAllocationDistributed has every unconfigured node select a free address from
+	// the reservations it sees.
+	IPAllocationDistributed string = "distributed"
+	// IPAllocationDelegated has gateways own /24 blocks of the node pool and hand out
+	// addresses from them to the nodes that request one. A node falls back to
+	// selecting an address itself if no block owner answers.
+	IPAllocationDelegated string = "delegated"
+)
+
+// DefaultDelegationFallbackTimeout is how long a node in delegated mode waits for an
+// offer from a block owner before it selects an address itself.
+const DefaultDelegationFallbackTimeout = 90 * time.Second
+
+// DelegationState is what a block owner persists: the blocks it owns and the
+// addresses it handed out from them, keyed by the MAC of the node they went to.
+type DelegationState struct {
+	Blocks      []string          `json:"blocks"`
+	Assignments map[string]string `json:"assignments,omitempty"`
+}
+
+// BlockOwner hands out addresses from the /24 blocks a gateway owns in delegated
+// mode. It claims the first block no other owner advertises, answers the requests
+// directed to it with an offer, or a refusal once its blocks are full, and persists
+// every address it handed out so that it is offered again after a restart.
+//
+// The blocks, free address count and offers are advertised in the owner's own
+// address reservation.
+type BlockOwner struct {
+	addressing network.MeshAddressing
+	allocator  network.IPAllocator
+	state      *StateStore
+	log        zerolog.Logger
+
+	mu     sync.Mutex
+	blocks []string
+	free   uint32
+	offers []*proto.BlockOffer
+}
+
+// NewBlockOwner creates an owner that claims blocks of the node pool of addressing,
+// picks addresses with allocator and persists its blocks and assignments in state.
+func NewBlockOwner(addressing network.MeshAddressing, allocator network.IPAllocator, state *StateStore, log zerolog.Logger) *BlockOwner {
+	return &BlockOwner{addressing: addressing, allocator: allocator, state: state, log: log}
+}
+
+// Serve answers the delegated requests directed to selfMAC in reservations, the
+// freshest reservation of every node. It returns whether the advertisement changed,
+// in which case the owner's reservation should be published again.
+func (o *BlockOwner) Serve(selfMAC string, reservations []*proto.AddressReservation) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var (
+		blocks []string
+		offers []*proto.BlockOffer
+		free   uint32
+	)
+
+	o.state.Update(func(state *State) bool {
+		if state.Delegation == nil {
+			state.Delegation = &DelegationState{}
+		}
+		if state.Delegation.Assignments == nil {
+			state.Delegation.Assignments = make(map[string]string)
+		}
+		d := state.Delegation
+
+		changed := o.claimBlocks(d, selfMAC, reservations)
+		changed = o.releaseAssignments(d, selfMAC, reservations) || changed
+
+		reserved := delegationReserved(d, selfMAC, reservations)
+		for _, res := range reservations {
+			if res.Mac == selfMAC || !res.RequestingReservation || res.TargetMac != selfMAC {
+				continue
+			}
+			if _, ok := d.Assignments[res.Mac]; ok {
+				continue
+			}
+
+			ip, err := o.allocate(d.Blocks, reserved)
+			if err != nil {
+				if _, refused := findOffer(o.offers, res.Mac); !refused {
+					o.log.Warn().Err(err).Str("node", res.Mac).Msg("Refusing delegated address request, the address blocks are full")
+				}
+				offers = append(offers, &proto.BlockOffer{TargetMac: res.Mac, Refused: true})
+				continue
+			}
+
+			d.Assignments[res.Mac] = ip
+			reserved[ip] = true
+			changed = true
+			o.log.Warn().Bool("audit", true).Str("node", res.Mac).Str("ip", ip).Msg("Offered address from the delegated blocks")
+		}
+
+		// Keep offering every address until its node publishes it, so no other node
+		// selects it in the meantime
+		holds := make(map[string]string, len(reservations))
+		for _, res := range reservations {
+			holds[res.Mac] = res.StaticIp
+		}
+		for mac, ip := range d.Assignments {
+			if holds[mac] != ip || reservationOf(reservations, mac).GetRequestingReservation() {
+				offers = append(offers, &proto.BlockOffer{TargetMac: mac, StaticIp: ip})
+			}
+		}
+		slices.SortFunc(offers, func(a, b *proto.BlockOffer) int { return strings.Compare(a.TargetMac, b.TargetMac) })
+
+		free = blockFree(o.addressing, d.Blocks, reserved)
+		blocks = slices.Clone(d.Blocks)
+
+		return changed
+	})
+
+	changed := !slices.Equal(blocks, o.blocks) || free != o.free ||
+		!slices.EqualFunc(offers, o.offers, func(a, b *proto.BlockOffer) bool { return a.EqualVT(b) })
+	o.blocks, o.free, o.offers = blocks, free, offers
+
+	return changed
+}
+
+// Advertise adds the owner's blocks, free address count and offers to res. It does
+// nothing before the owner claimed a block.
+func (o *BlockOwner) Advertise(res *proto.AddressReservation) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if len(o.blocks) == 0 {
+		return
+	}
+
+	res.DelegatedBlocks = slices.Clone(o.blocks)
+	res.BlockFree = o.free
+	res.Offers = make([]*proto.BlockOffer, len(o.offers))
+	for i, offer := range o.offers {
+		res.Offers[i] = offer.CloneVT()
+	}
+}
+
+// claimBlocks gives up the blocks another owner with a lower MAC advertises as well,
+// and claims the first free block of the node pool if none is left. It returns
+// whether d changed.
+func (o *BlockOwner) claimBlocks(d *DelegationState, selfMAC string, reservations []*proto.AddressReservation) bool {
+	owners := make(map[string]string)
+	for _, res := range reservations {
+		if res.Mac == selfMAC {
+			continue
+		}
+		for _, block := range res.DelegatedBlocks {
+			if owner, ok := owners[block]; !ok || res.Mac < owner {
+				owners[block] = res.Mac
+			}
+		}
+	}
+
+	changed := false
+	d.Blocks = slices.DeleteFunc(d.Blocks, func(block string) bool {
+		owner, ok := owners[block]
+		if ok && owner < selfMAC {
+			o.log.Warn().Bool("audit", true).Str("block", block).Str("owner", owner).Msg("Yielding address block claimed by another owner")
+			changed = true
+			return true
+		}
+		return false
+	})
+	if len(d.Blocks) > 0 {
+		return changed
+	}
+
+	for _, block := range o.addressing.StaticIPPool(false).Blocks() {
+		if _, taken := owners[block]; taken {
+			continue
+		}
+
+		d.Blocks = []string{block}
+		for mac, ip := range d.Assignments {
+			if pool, err := o.addressing.BlockPool(block); err != nil || !pool.Contains(ip) {
+				delete(d.Assignments, mac)
+			}
+		}
+		o.log.Warn().Bool("audit", true).Str("block", block).Msg("Claimed address block for delegation")
+		return true
+	}
+
+	o.log.Error().Msg("No address block left to claim for delegation")
+	return changed
+}
+
+// releaseAssignments forgets the addresses handed to nodes that hold another address
+// or requested one from another owner since. It returns whether d changed.
+func (o *BlockOwner) releaseAssignments(d *DelegationState, selfMAC string, reservations []*proto.AddressReservation) bool {
+	changed := false
+	for mac, ip := range d.Assignments {
+		res := reservationOf(reservations, mac)
+		switch {
+		case res == nil:
+			continue
+		case res.RequestingReservation && res.TargetMac != selfMAC,
+			!res.RequestingReservation && res.StaticIp != "" && res.StaticIp != ip:
+			o.log.Warn().Bool("audit", true).Str("node", mac).Str("ip", ip).Msg("Released delegated address")
+			delete(d.Assignments, mac)
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+// allocate returns a free address of blocks, or an error wrapping
+// network.ErrNoAvailableAddress once every block is full.
+func (o *BlockOwner) allocate(blocks []string, reserved map[string]bool) (string, error) {
+	var errs []error
+	for _, block := range blocks {
+		pool, err := o.addressing.BlockPool(block)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		ip, err := o.allocator.Allocate(pool, reserved)
+		if err == nil {
+			return ip, nil
+		}
+		errs = append(errs, err)
+	}
+
+	if len(errs) == 0 {
+		return "", network.ErrNoAvailableAddress
+	}
+	return "", errors.Join(errs...)
+}
+
+// delegationReserved returns the addresses that are not free: those held or offered
+// in reservations, and those handed out by this owner.
+func delegationReserved(d *DelegationState, selfMAC string, reservations []*proto.AddressReservation) map[string]bool {
+	reserved := make(map[string]bool)
+	for _, res := range reservations {
+		if res.StaticIp != "" {
+			reserved[res.StaticIp] = true
+		}
+		if res.Mac == selfMAC {
+			continue
+		}
+		for _, offer := range res.Offers {
+			if offer.StaticIp != "" {
+				reserved[offer.StaticIp] = true
+			}
+		}
+	}
+	for ip := range maps.Values(d.Assignments) {
+		reserved[ip] = true
+	}
+
+	return reserved
+}
+
+// blockFree counts the addresses of blocks of addressing not in reserved.
+func blockFree(addressing network.MeshAddressing, blocks []string, reserved map[string]bool) uint32 {
+	var free uint32
+	for _, block := range blocks {
+		pool, err := addressing.BlockPool(block)
+		if err != nil {
+			continue
+		}
+		for i := range pool.Size() {
+			if !reserved[pool.At(i)] {
+				free++
+			}
+		}
+	}
+
+	return free
+}
+
+// BlockRequestState is how far the delegated request of an unconfigured node got.
+type BlockRequestState string
+
+const (
+	// BlockRequestWaiting means no owner offered an address yet.
+	BlockRequestWaiting BlockRequestState = "waiting"
+	// BlockRequestOffered means an owner offered an address to the node.
+	BlockRequestOffered BlockRequestState = "offered"
+	// BlockRequestFallback means the node gave up on delegation and selects an
+	// address itself.
+	BlockRequestFallback BlockRequestState = "fallback"
+)
+
+// BlockRequest is the request of an unconfigured node in delegated mode for an
+// address from a block owner. It is directed to the owner with the most free
+// addresses and moves on to another owner if that one disappears or refuses. The node
+// falls back to selecting an address itself once every owner refused, or if no owner
+// offered an address within the timeout.
+type BlockRequest struct {
+	timeout time.Duration
+	log     zerolog.Logger
+
+	mu      sync.Mutex
+	state   BlockRequestState
+	target  string
+	started time.Time
+	refused map[string]bool
+}
+
+// NewBlockRequest creates a request that falls back after timeout, or after
+// DefaultDelegationFallbackTimeout if timeout is zero or less.
+func NewBlockRequest(timeout time.Duration, log zerolog.Logger) *BlockRequest {
+	if timeout <= 0 {
+		timeout = DefaultDelegationFallbackTimeout
+	}
+
+	return &BlockRequest{timeout: timeout, log: log, state: BlockRequestWaiting, refused: make(map[string]bool)}
+}
+
+// Target returns the MAC of the owner the request is directed to, empty if there is
+// none.
+func (r *BlockRequest) Target() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.target
+}
+
+// Observe looks for an answer to the request of selfMAC in reservations, the
+// freshest reservation of every node, at now. It returns the offered address once
+// the request is BlockRequestOffered.
+func (r *BlockRequest) Observe(now time.Time, selfMAC string, reservations []*proto.AddressReservation) (string, BlockRequestState) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.state == BlockRequestFallback {
+		return "", r.state
+	}
+	if r.started.IsZero() {
+		r.started = now
+	}
+
+	owners := make(map[string]*proto.AddressReservation)
+	for _, res := range reservations {
+		if res.Mac != selfMAC && len(res.DelegatedBlocks) > 0 && !res.ShuttingDown {
+			owners[res.Mac] = res
+		}
+	}
+
+	if r.target != "" {
+		owner, ok := owners[r.target]
+		offer, _ := findOffer(owner.GetOffers(), selfMAC)
+		switch {
+		case !ok:
+			r.log.Warn().Str("owner", r.target).Msg("Block owner disappeared, requesting an address from another owner")
+			r.target = ""
+			r.started = now
+		case offer == nil:
+		case offer.Refused:
+			r.log.Warn().Str("owner", r.target).Msg("Block owner refused the address request, its blocks are full")
+			r.refused[r.target] = true
+			r.target = ""
+		case offer.StaticIp != "":
+			r.state = BlockRequestOffered
+			r.log.Info().Str("owner", r.target).Str("ip", offer.StaticIp).Msg("Accepting address offered by block owner")
+			return offer.StaticIp, r.state
+		}
+	}
+
+	if r.target == "" {
+		var best *proto.AddressReservation
+		for _, owner := range owners {
+			if r.refused[owner.Mac] || owner.BlockFree == 0 {
+				continue
+			}
+			if best == nil || owner.BlockFree > best.BlockFree || (owner.BlockFree == best.BlockFree && owner.Mac < best.Mac) {
+				best = owner
+			}
+		}
+
+		switch {
+		case best != nil:
+			r.target = best.Mac
+			r.log.Info().Str("owner", best.Mac).Strs("blocks", best.DelegatedBlocks).Msg("Requesting an address from block owner")
+		case len(owners) > 0:
+			return "", r.fallBack("every block owner is full")
+		}
+	}
+
+	if now.Sub(r.started) >= r.timeout {
+		return "", r.fallBack("no block owner offered an address in time")
+	}
+
+	return "", r.state
+}
+
+func (r *BlockRequest) fallBack(reason string) BlockRequestState {
+	r.log.Warn().Str("reason", reason).Str("owner", r.target).Msg("Falling back to selecting an address without a block owner")
+	r.state = BlockRequestFallback
+	r.target = ""
+
+	return r.state
+}
+
+// findOffer returns the offer to mac, and whether it is a refusal.
+func findOffer(offers []*proto.BlockOffer, mac string) (*proto.BlockOffer, bool) {
+	for _, offer := range offers {
+		if offer.TargetMac == mac {
+			return offer, offer.Refused
+		}
+	}
+
+	return nil, false
+}
+
+// reservationOf returns the reservation of mac, or nil.
+func reservationOf(reservations []*proto.AddressReservation, mac string) *proto.AddressReservation {
+	for _, res := range reservations {
+		if res.Mac == mac {
+			return res
+		}
+	}
+
+	return nil
+}
+
+// latestReservations decodes records into the last reservation of every node.
+// Records that cannot be decoded are skipped.
+func latestReservations(records []alfred.Record) []*proto.AddressReservation {
+	var (
+		index        = make(map[string]int, len(records))
+		reservations = make([]*proto.AddressReservation, 0, len(records))
+	)
+
+	for _, record := range records {
+		var res proto.AddressReservation
+		if err := res.UnmarshalVT(record.Data); err != nil {
+			continue
+		}
+
+		if i, ok := index[res.Mac]; ok {
+			reservations[i] = &res
+			continue
+		}
+		index[res.Mac] = len(reservations)
+		reservations = append(reservations, &res)
+	}
+
+	return reservations
+}
+
+// serveBlockRequests answers the delegated requests in decoded if this node is a
+// gateway, and republishes its reservation when the answers changed.
+func (arw *AddressReservationWorker) serveBlockRequests(selfMAC string, gatewayMode bool, decoded []ReservationRecord) {
+	if arw.owner == nil || !gatewayMode {
+		return
+	}
+
+	reservations := make([]*proto.AddressReservation, len(decoded))
+	for i, record := range decoded {
+		reservations[i] = record.Reservation
+	}
+
+	if arw.owner.Serve(selfMAC, reservations) {
+		arw.Republish()
+	}
+}
+
+// delegatedStaticIP returns the address a block owner offered this unconfigured node,
+// or whether it is still waiting for an offer. It returns neither without delegation
+// or once the node fell back to selecting an address itself.
+func (arw *AddressReservationWorker) delegatedStaticIP(records []alfred.Record, selfMAC string, now time.Time) (string, bool) {
+	if arw.request == nil {
+		return "", false
+	}
+
+	ip, state := arw.request.Observe(now, selfMAC, latestReservations(records))
+	return ip, state == BlockRequestWaiting
+}
@@ -0,0 +1,336 @@
+package mgmt
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openmanet/go-alfred"
+	proto "github.com/openmanet/openmanetd/internal/api/openmanet/v1"
+	"github.com/openmanet/openmanetd/internal/network"
+	"github.com/rs/zerolog"
+)
+
+// alfredBus is a mesh of alfred daemons that are always in sync: every node sees
+// the last record each node published per data type.
+type alfredBus struct {
+	mu      sync.Mutex
+	records map[uint8]map[string][]byte
+}
+
+func newAlfredBus() *alfredBus {
+	return &alfredBus{records: make(map[uint8]map[string][]byte)}
+}
+
+// busTransport publishes on the bus as the node with MAC mac.
+type busTransport struct {
+	bus *alfredBus
+	mac string
+}
+
+func (b busTransport) Set(dataType uint8, version uint8, data []byte) error {
+	b.bus.mu.Lock()
+	defer b.bus.mu.Unlock()
+
+	if b.bus.records[dataType] == nil {
+		b.bus.records[dataType] = make(map[string][]byte)
+	}
+	b.bus.records[dataType][b.mac] = slices.Clone(data)
+
+	return nil
+}
+
+func (b busTransport) Request(dataType uint8) ([]alfred.Record, error) {
+	b.bus.mu.Lock()
+	defer b.bus.mu.Unlock()
+
+	records := make([]alfred.Record, 0, len(b.bus.records[dataType]))
+	for _, mac := range slices.Sorted(maps.Keys(b.bus.records[dataType])) {
+		records = append(records, alfred.Record{Data: b.bus.records[dataType][mac]})
+	}
+
+	return records, nil
+}
+
+// leave drops the records of mac, as alfred does once a node is gone for long enough.
+func (b *alfredBus) leave(mac string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, records := range b.records {
+		delete(records, mac)
+	}
+}
+
+// publish sets res on the bus as the node that published it.
+func (b *alfredBus) publish(t *testing.T, res *proto.AddressReservation) {
+	t.Helper()
+
+	data, err := res.MarshalVT()
+	if err != nil {
+		t.Fatalf("MarshalVT() error = %v", err)
+	}
+	_ = busTransport{bus: b, mac: res.Mac}.Set(AddressReservationDataType, AddressReservationDataTypeVersion, data)
+}
+
+// delegationNode is a reservation worker on the bus. ip is the address it holds,
+// empty until it is configured.
+type delegationNode struct {
+	t   *testing.T
+	bus *alfredBus
+	mac string
+	ip  string
+	arw *AddressReservationWorker
+}
+
+func (b *alfredBus) node(t *testing.T, mac, ip, statePath string) *delegationNode {
+	t.Helper()
+
+	client, err := newAlfredClient(func() (alfredTransport, error) {
+		return busTransport{bus: b, mac: mac}, nil
+	}, time.Second, zerolog.Nop())
+	if err != nil {
+		t.Fatalf("newAlfredClient() error = %v", err)
+	}
+
+	state := OpenStateStore(statePath, zerolog.Nop())
+	return &delegationNode{
+		t:   t,
+		bus: b,
+		mac: mac,
+		ip:  ip,
+		arw: &AddressReservationWorker{
+			Deps:      Deps{Log: zerolog.Nop(), Client: client},
+			records:   NewRecordTracker(DefaultReservationTTL),
+			republish: make(chan struct{}, 1),
+			state:     state,
+			owner:     NewBlockOwner(network.DefaultMeshAddressing(), network.SequentialAllocator{}, state, zerolog.Nop()),
+			request:   NewBlockRequest(time.Minute, zerolog.Nop()),
+		},
+	}
+}
+
+func (n *delegationNode) records() []alfred.Record {
+	n.t.Helper()
+
+	records, err := n.arw.Deps.Client.RequestCtx(context.Background(), AddressReservationDataType)
+	if err != nil {
+		n.t.Fatalf("RequestCtx() error = %v", err)
+	}
+	return records
+}
+
+// serve runs a receive tick of a configured gateway and publishes its reservation.
+func (n *delegationNode) serve() {
+	decoded, err := n.arw.records.DecodeReservationRecords(n.records())
+	if err != nil {
+		n.t.Fatalf("DecodeReservationRecords() error = %v", err)
+	}
+	n.arw.serveBlockRequests(n.mac, true, freshestReservations(decoded))
+
+	res := &proto.AddressReservation{Mac: n.mac, StaticIp: n.ip}
+	n.arw.owner.Advertise(res)
+	n.bus.publish(n.t, res)
+}
+
+// request runs a receive tick of an unconfigured node at now and publishes its
+// request, or its reservation once it accepted an offer. It returns the offered
+// address and whether the node is still waiting for one.
+func (n *delegationNode) request(now time.Time) (string, bool) {
+	ip, waiting := n.arw.delegatedStaticIP(n.records(), n.mac, now)
+
+	switch {
+	case ip != "":
+		n.ip = ip
+		n.bus.publish(n.t, &proto.AddressReservation{Mac: n.mac, StaticIp: ip})
+	case waiting:
+		n.bus.publish(n.t, &proto.AddressReservation{Mac: n.mac, RequestingReservation: true, TargetMac: n.arw.request.Target()})
+	}
+
+	return ip, waiting
+}
+
+// advertised returns the reservation mac last published on the bus.
+func (b *alfredBus) advertised(t *testing.T, mac string) *proto.AddressReservation {
+	t.Helper()
+
+	b.mu.Lock()
+	data := b.records[AddressReservationDataType][mac]
+	b.mu.Unlock()
+
+	var res proto.AddressReservation
+	if err := res.UnmarshalVT(data); err != nil {
+		t.Fatalf("UnmarshalVT() error = %v", err)
+	}
+	return &res
+}
+
+func TestDelegation_OfferAccept(t *testing.T) {
+	var (
+		bus       = newAlfredBus()
+		statePath = filepath.Join(t.TempDir(), "state.json")
+		owner     = bus.node(t, "aa:bb:cc:dd:ee:01", "10.41.0.1", statePath)
+		leaf      = bus.node(t, "aa:bb:cc:dd:ee:10", "", filepath.Join(t.TempDir(), "state.json"))
+		now       = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	)
+
+	owner.serve()
+	if res := bus.advertised(t, owner.mac); !slices.Equal(res.DelegatedBlocks, []string{"10.41.1.0/24"}) || res.BlockFree != 254 {
+		t.Fatalf("owner advertised blocks %v with %d free, want 10.41.1.0/24 with 254", res.DelegatedBlocks, res.BlockFree)
+	}
+
+	if _, waiting := leaf.request(now); !waiting {
+		t.Fatal("leaf not waiting for an offer")
+	}
+	if got := leaf.arw.request.Target(); got != owner.mac {
+		t.Fatalf("request directed to %q, want %q", got, owner.mac)
+	}
+
+	owner.serve()
+	ip, waiting := leaf.request(now.Add(10 * time.Second))
+	if ip != "10.41.1.1" || waiting {
+		t.Fatalf("leaf got %q (waiting %v), want 10.41.1.1", ip, waiting)
+	}
+
+	// The owner stops offering once the leaf publishes the address
+	owner.serve()
+	if res := bus.advertised(t, owner.mac); len(res.Offers) != 0 || res.BlockFree != 253 {
+		t.Errorf("owner advertised offers %v with %d free, want none with 253", res.Offers, res.BlockFree)
+	}
+
+	// The assignment survives a restart of the owner
+	state, err := LoadState(statePath)
+	if err != nil {
+		t.Fatalf("LoadState() error = %v", err)
+	}
+	if got := state.Delegation.Assignments[leaf.mac]; got != ip {
+		t.Errorf("persisted assignment = %q, want %q", got, ip)
+	}
+
+	restarted := bus.node(t, owner.mac, owner.ip, statePath)
+	bus.publish(t, &proto.AddressReservation{Mac: leaf.mac, RequestingReservation: true, TargetMac: owner.mac})
+	restarted.serve()
+	if offer, _ := findOffer(bus.advertised(t, owner.mac).Offers, leaf.mac); offer.GetStaticIp() != ip {
+		t.Errorf("restarted owner offered %v, want %s again", offer, ip)
+	}
+}
+
+func TestDelegation_OwnerFull(t *testing.T) {
+	var (
+		bus   = newAlfredBus()
+		owner = bus.node(t, "aa:bb:cc:dd:ee:01", "10.41.0.1", filepath.Join(t.TempDir(), "state.json"))
+		first = bus.node(t, "aa:bb:cc:dd:ee:10", "", filepath.Join(t.TempDir(), "state.json"))
+		late  = bus.node(t, "aa:bb:cc:dd:ee:11", "", filepath.Join(t.TempDir(), "state.json"))
+		now   = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	)
+
+	// Every address of the block but the last is held already
+	for i := 1; i < 254; i++ {
+		bus.publish(t, &proto.AddressReservation{Mac: fmt.Sprintf("aa:bb:cc:00:00:%02x", i), StaticIp: fmt.Sprintf("10.41.1.%d", i)})
+	}
+	owner.serve()
+	if res := bus.advertised(t, owner.mac); res.BlockFree != 1 {
+		t.Fatalf("owner advertised %d free, want 1", res.BlockFree)
+	}
+
+	first.request(now)
+	late.request(now)
+	owner.serve()
+
+	if ip, _ := first.request(now.Add(10 * time.Second)); ip != "10.41.1.254" {
+		t.Errorf("first leaf got %q, want 10.41.1.254", ip)
+	}
+	ip, waiting := late.request(now.Add(10 * time.Second))
+	if ip != "" || waiting {
+		t.Errorf("late leaf got %q (waiting %v), want a fallback", ip, waiting)
+	}
+
+	// A node arriving after the block filled up does not wait for the timeout
+	owner.serve()
+	latest := bus.node(t, "aa:bb:cc:dd:ee:12", "", filepath.Join(t.TempDir(), "state.json"))
+	if ip, waiting := latest.request(now.Add(20 * time.Second)); ip != "" || waiting {
+		t.Errorf("leaf got %q (waiting %v) from a full owner, want a fallback", ip, waiting)
+	}
+}
+
+func TestDelegation_OwnerDisappears(t *testing.T) {
+	var (
+		bus    = newAlfredBus()
+		first  = bus.node(t, "aa:bb:cc:dd:ee:01", "10.41.0.1", filepath.Join(t.TempDir(), "state.json"))
+		second = bus.node(t, "aa:bb:cc:dd:ee:02", "10.41.0.2", filepath.Join(t.TempDir(), "state.json"))
+		leaf   = bus.node(t, "aa:bb:cc:dd:ee:10", "", filepath.Join(t.TempDir(), "state.json"))
+		now    = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	)
+
+	first.serve()
+	second.serve()
+	if res := bus.advertised(t, second.mac); !slices.Equal(res.DelegatedBlocks, []string{"10.41.2.0/24"}) {
+		t.Fatalf("second owner claimed %v, want 10.41.2.0/24", res.DelegatedBlocks)
+	}
+
+	leaf.request(now)
+	if got := leaf.arw.request.Target(); got != first.mac {
+		t.Fatalf("request directed to %q, want %q", got, first.mac)
+	}
+
+	// The owner goes away before answering; the leaf asks the other one, which gets
+	// the whole fallback timeout to answer
+	bus.leave(first.mac)
+	if _, waiting := leaf.request(now.Add(50 * time.Second)); !waiting {
+		t.Fatal("leaf stopped waiting after the owner disappeared")
+	}
+	if got := leaf.arw.request.Target(); got != second.mac {
+		t.Fatalf("request directed to %q after the owner disappeared, want %q", got, second.mac)
+	}
+
+	second.serve()
+	if ip, _ := leaf.request(now.Add(100 * time.Second)); ip != "10.41.2.1" {
+		t.Errorf("leaf got %q, want 10.41.2.1 from the second owner", ip)
+	}
+}
+
+func TestDelegation_NoOwnerFallback(t *testing.T) {
+	var (
+		bus  = newAlfredBus()
+		leaf = bus.node(t, "aa:bb:cc:dd:ee:10", "", filepath.Join(t.TempDir(), "state.json"))
+		now  = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	)
+
+	for elapsed := time.Duration(0); elapsed < time.Minute; elapsed += 10 * time.Second {
+		if _, waiting := leaf.request(now.Add(elapsed)); !waiting {
+			t.Fatalf("leaf stopped waiting after %v, want a minute", elapsed)
+		}
+	}
+
+	if ip, waiting := leaf.request(now.Add(time.Minute)); ip != "" || waiting {
+		t.Errorf("leaf got %q (waiting %v) after the timeout, want a fallback", ip, waiting)
+	}
+}
+
+func TestBlockOwner_YieldsSharedBlock(t *testing.T) {
+	owner := NewBlockOwner(network.DefaultMeshAddressing(), network.SequentialAllocator{}, OpenStateStore(filepath.Join(t.TempDir(), "state.json"), zerolog.Nop()), zerolog.Nop())
+
+	owner.Serve("aa:bb:cc:dd:ee:02", nil)
+	other := &proto.AddressReservation{Mac: "aa:bb:cc:dd:ee:01", DelegatedBlocks: []string{"10.41.1.0/24"}}
+	if !owner.Serve("aa:bb:cc:dd:ee:02", []*proto.AddressReservation{other}) {
+		t.Fatal("Serve() = false after yielding the block")
+	}
+
+	var res proto.AddressReservation
+	owner.Advertise(&res)
+	if !slices.Equal(res.DelegatedBlocks, []string{"10.41.2.0/24"}) {
+		t.Errorf("DelegatedBlocks = %v, want 10.41.2.0/24", res.DelegatedBlocks)
+	}
+}
+
+func TestAddressReservationWorker_DistributedByDefault(t *testing.T) {
+	arw := &AddressReservationWorker{}
+	if ip, waiting := arw.delegatedStaticIP(nil, "aa:bb:cc:dd:ee:10", time.Now()); ip != "" || waiting {
+		t.Errorf("delegatedStaticIP() = %q, %v without delegation", ip, waiting)
+	}
+}
@@ -0,0 +1,238 @@
+package mgmt
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+
+	batmanadv "github.com/openmanet/openmanetd/internal/batman-adv"
+	"github.com/openmanet/openmanetd/internal/config"
+	"github.com/openmanet/openmanetd/internal/network"
+	"github.com/openmanet/openmanetd/internal/util/board"
+	"github.com/rs/zerolog"
+)
+
+// Deps are the runtime dependencies shared by the workers. They are created once and
+// stay the same for the lifetime of the process.
+type Deps struct {
+	Log    zerolog.Logger
+	Client *AlfredClient
+
+	UCIOpenMANET *network.UCIOpenMANETConfigReader
+	UCIDHCP      *network.UCIDHCPConfigReader
+	UCINetwork   *network.UCINetworkConfigReader
+	UCIFirewall  *network.UCIFirewallConfigReader
+
+	// UCIDir is the directory of the config files the UCI readers work on. The
+	// address reservation flow snapshots them there before writing; empty disables
+	// the snapshot.
+	UCIDir string
+
+	Board        *board.Board
+	MeshConfig   *batmanadv.MeshConfigCache
+	MeshHealth   *MeshHealthMonitor
+	MeshFilter   *MeshFilter
+	SchemaFilter *SchemaFilter
+	RecordLimits *RecordLimiter
+	Hostnames    *HostnameWatcher
+	State        *StateStore
+}
+
+// withClient returns a copy of d using client for alfred.
+func (d Deps) withClient(client *AlfredClient) Deps {
+	d.Client = client
+	return d
+}
+
+// meshConfig returns the batman-adv configuration of iface, shared through the cache
+// when there is one. batctl is killed when ctx is done.
+func (d Deps) meshConfig(ctx context.Context, iface string) (*batmanadv.MeshConfig, error) {
+	if d.MeshConfig != nil {
+		return d.MeshConfig.GetContext(ctx, iface)
+	}
+	return batmanadv.GetMeshConfigContext(ctx, iface)
+}
+
+// meshHealth returns the mesh health of iface, or nil if it is not monitored or the
+// batman-adv tables cannot be read.
+func (d Deps) meshHealth(iface string) *batmanadv.MeshHealth {
+	if d.MeshHealth == nil {
+		return nil
+	}
+
+	health, err := d.MeshHealth.Get(iface)
+	if err != nil {
+		d.Log.Debug().Err(err).Msg("Error reading mesh health")
+		return nil
+	}
+
+	return health
+}
+
+// hostname returns the name to advertise for this node, whose mesh MAC is mac.
+func (d Deps) hostname(mac string) string {
+	if d.Hostnames != nil {
+		return PublishedHostname(d.Hostnames.Current(), mac)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		d.Log.Error().Err(err).Msg("Error getting hostname")
+	}
+
+	return PublishedHostname(hostname, mac)
+}
+
+// Tunables are the settings that may change while openmanetd runs. Workers take one
+// snapshot at the start of every tick, so a tick never mixes old and new values and
+// every worker sees a change from its next tick on.
+type Tunables struct {
+	IFace                 string
+	BatInterface          string
+	PinnedIP              string
+	FallbackOnPinConflict string
+	IPAllocationStrategy  string
+}
+
+// TunablesProvider hands out the current tunables.
+type TunablesProvider interface {
+	Tunables() Tunables
+}
+
+// StaticTunables is a TunablesProvider whose tunables never change.
+type StaticTunables Tunables
+
+// Tunables returns t.
+func (t StaticTunables) Tunables() Tunables {
+	return Tunables(t)
+}
+
+// TunablesFromConfig returns the tunables currently set in cfg.
+func TunablesFromConfig(cfg *config.Config) Tunables {
+	return Tunables{
+		IFace:                 cfg.GetMeshNetInterface(),
+		BatInterface:          cfg.GetAlfredBatInterface(),
+		PinnedIP:              cfg.GetReservationPinnedIP(),
+		FallbackOnPinConflict: cfg.GetFallbackOnPinConflict(),
+		IPAllocationStrategy:  cfg.GetIPAllocationStrategy(),
+	}
+}
+
+// Tunables returns the tunables last passed to UpdateTunables, or the ones the
+// manager was created with.
+func (m *ManagementConfig) Tunables() Tunables {
+	if m.tunables != nil {
+		if t := m.tunables.Load(); t != nil {
+			return *t
+		}
+	}
+
+	return Tunables{
+		IFace:                 m.IFace,
+		BatInterface:          m.BatInterface,
+		PinnedIP:              m.PinnedIP,
+		FallbackOnPinConflict: m.FallbackOnPinConflict,
+		IPAllocationStrategy:  m.IPAllocationStrategy,
+	}
+}
+
+// UpdateTunables makes t the tunables of every worker from its next tick on. m must
+// have been created by NewManager.
+func (m *ManagementConfig) UpdateTunables(t Tunables) {
+	m.tunables.Store(&t)
+}
+
+// ReloadTunables makes the tunables set in cfg those of every worker from its next
+// tick on, and moves the route to the mesh subnet to the configured interface.
+func (m *ManagementConfig) ReloadTunables(cfg *config.Config) {
+	t := TunablesFromConfig(cfg)
+	m.UpdateTunables(t)
+	m.updateMeshRoutes(t)
+}
+
+// snapshotTunables returns the tunables for one tick of the named worker and records
+// them in last. A change of interface is logged so that it can be tied to the tick
+// that first used it.
+func snapshotTunables(provider TunablesProvider, last *atomic.Pointer[Tunables], worker string, log zerolog.Logger) Tunables {
+	t := provider.Tunables()
+
+	prev := last.Swap(&t)
+	if prev != nil && (prev.IFace != t.IFace || prev.BatInterface != t.BatInterface) {
+		log.Info().
+			Str("worker", worker).
+			Str("iface", t.IFace).
+			Str("batInterface", t.BatInterface).
+			Msg("Mesh interfaces changed")
+	}
+
+	return t
+}
+
+// tick returns the tunables for one tick, falling back to the manager's own.
+func (arw *AddressReservationWorker) tick() Tunables {
+	var provider TunablesProvider = arw.Config
+	if arw.Tunables != nil {
+		provider = arw.Tunables
+	}
+	return snapshotTunables(provider, &arw.lastTunables, "address reservation", arw.Deps.Log)
+}
+
+// LastTunables returns the tunables used by the most recent tick.
+func (arw *AddressReservationWorker) LastTunables() Tunables {
+	if t := arw.lastTunables.Load(); t != nil {
+		return *t
+	}
+	return Tunables{}
+}
+
+// tick returns the tunables for one tick, falling back to the manager's own.
+func (gw *GatewayWorker) tick() Tunables {
+	var provider TunablesProvider = gw.Config
+	if gw.Tunables != nil {
+		provider = gw.Tunables
+	}
+	return snapshotTunables(provider, &gw.lastTunables, "gateway", gw.Deps.Log)
+}
+
+// LastTunables returns the tunables used by the most recent tick.
+func (gw *GatewayWorker) LastTunables() Tunables {
+	if t := gw.lastTunables.Load(); t != nil {
+		return *t
+	}
+	return Tunables{}
+}
+
+// tick returns the tunables for one tick, falling back to the manager's own.
+func (ndw *NodeDataWorker) tick() Tunables {
+	var provider TunablesProvider = ndw.Config
+	if ndw.Tunables != nil {
+		provider = ndw.Tunables
+	}
+	return snapshotTunables(provider, &ndw.lastTunables, "node data", ndw.Deps.Log)
+}
+
+// LastTunables returns the tunables used by the most recent tick.
+func (ndw *NodeDataWorker) LastTunables() Tunables {
+	if t := ndw.lastTunables.Load(); t != nil {
+		return *t
+	}
+	return Tunables{}
+}
+
+// tick returns the tunables for one tick, falling back to the manager's own.
+func (sw *ServiceWorker) tick() Tunables {
+	var provider TunablesProvider = sw.Config
+	if sw.Tunables != nil {
+		provider = sw.Tunables
+	}
+	return snapshotTunables(provider, &sw.lastTunables, "service", sw.Deps.Log)
+}
+
+// tick returns the tunables for one tick, falling back to the manager's own.
+func (tw *TopologyWorker) tick() Tunables {
+	var provider TunablesProvider = tw.Config
+	if tw.Tunables != nil {
+		provider = tw.Tunables
+	}
+	return snapshotTunables(provider, &tw.lastTunables, "topology", tw.Deps.Log)
+}
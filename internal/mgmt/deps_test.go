@@ -0,0 +1,123 @@
+package mgmt
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/openmanet/openmanetd/internal/config"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+func writeTestConfig(t *testing.T, path, iface string) {
+	t.Helper()
+
+	data := "meshNetInterface: " + iface + "\nalfred:\n  batInterface: bat-openmanet-test\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+}
+
+func TestTunables_ReloadReachesAllWorkers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	writeTestConfig(t, path, "br-old")
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		t.Fatalf("ReadInConfig() error = %v", err)
+	}
+	cfg := config.New(v)
+
+	m := &ManagementConfig{tunables: new(atomic.Pointer[Tunables])}
+	m.ReloadTunables(cfg)
+
+	reloaded := make(chan struct{}, 1)
+	cfg.OnConfigChange(func(c *config.Config) {
+		m.ReloadTunables(c)
+		select {
+		case reloaded <- struct{}{}:
+		default:
+		}
+	})
+
+	client, _ := newTestAlfredClient(t, time.Minute, true)
+	deps := Deps{Log: zerolog.Nop(), Client: client, RecordLimits: NewRecordLimiter(RecordLimits{}, zerolog.Nop())}
+	arw := NewAddressReservationWorkerWithDeps(m, deps, m, nil)
+	gw := NewGatewayWorkerWithDeps(m, deps, m, nil)
+
+	// A cancelled context makes every alfred call fail, so the ticks stop right
+	// after taking their snapshot.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tick := func() {
+		arw.receiveTick(ctx)
+		gw.receiveTick(ctx)
+	}
+
+	tick()
+	if got := arw.LastTunables().IFace; got != "br-old" {
+		t.Fatalf("address reservation worker IFace = %q, want br-old", got)
+	}
+	if got := gw.LastTunables().IFace; got != "br-old" {
+		t.Fatalf("gateway worker IFace = %q, want br-old", got)
+	}
+
+	writeTestConfig(t, path, "br-new")
+	select {
+	case <-reloaded:
+	case <-time.After(5 * time.Second):
+		t.Fatal("config was not reloaded")
+	}
+
+	tick()
+	if got := arw.LastTunables().IFace; got != "br-new" {
+		t.Errorf("address reservation worker IFace = %q, want br-new", got)
+	}
+	if got := gw.LastTunables().IFace; got != "br-new" {
+		t.Errorf("gateway worker IFace = %q, want br-new", got)
+	}
+	if got := gw.LastTunables().BatInterface; got != "bat-openmanet-test" {
+		t.Errorf("gateway worker BatInterface = %q, want bat-openmanet-test", got)
+	}
+}
+
+func TestSnapshotTunables(t *testing.T) {
+	var (
+		buf  bytes.Buffer
+		log  = zerolog.New(&buf)
+		last atomic.Pointer[Tunables]
+	)
+
+	if got := snapshotTunables(StaticTunables{IFace: "br-ahwlan"}, &last, "test", log); got.IFace != "br-ahwlan" {
+		t.Errorf("snapshotTunables() IFace = %q, want br-ahwlan", got.IFace)
+	}
+	snapshotTunables(StaticTunables{IFace: "br-ahwlan", PinnedIP: "10.41.0.9"}, &last, "test", log)
+	if buf.Len() != 0 {
+		t.Errorf("unexpected log output without an interface change: %s", buf.String())
+	}
+
+	snapshotTunables(StaticTunables{IFace: "br-lan"}, &last, "test", log)
+	if !strings.Contains(buf.String(), "Mesh interfaces changed") {
+		t.Errorf("interface change was not logged: %s", buf.String())
+	}
+	if got := last.Load().IFace; got != "br-lan" {
+		t.Errorf("last IFace = %q, want br-lan", got)
+	}
+}
+
+func TestManagementConfig_TunablesDefault(t *testing.T) {
+	m := &ManagementConfig{IFace: "br-ahwlan", BatInterface: "bat0", IPAllocationStrategy: "random"}
+
+	want := Tunables{IFace: "br-ahwlan", BatInterface: "bat0", IPAllocationStrategy: "random"}
+	if got := m.Tunables(); got != want {
+		t.Errorf("Tunables() = %+v, want %+v", got, want)
+	}
+}
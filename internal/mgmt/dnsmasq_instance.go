@@ -0,0 +1,61 @@
+package mgmt
+
+import (
+	"github.com/openmanet/openmanetd/internal/network"
+	"github.com/rs/zerolog"
+)
+
+// meshPoolInstance returns the dnsmasq instance the mesh DHCP pool is attached to.
+// An empty instance, or one with no dnsmasq section of that name, selects the main
+// instance; the latter is reported, since a pool naming a missing instance is served
+// by none.
+func meshPoolInstance(instance string, reader network.DHCPConfigReader, log zerolog.Logger) string {
+	if instance == "" {
+		return ""
+	}
+
+	if _, err := network.GetDnsmasqConfigForInstance(instance, reader); err != nil {
+		log.Warn().Err(err).Str("instance", instance).Msg("Configured dnsmasq instance not found, attaching the mesh DHCP pool to the main instance (check mgmt.dnsmasqInstance)")
+		return ""
+	}
+
+	return instance
+}
+
+// dnsmasqDomain returns the local domain of the dnsmasq instance serving the mesh,
+// falling back to the main instance and then to network.DefaultDNSDomain.
+func dnsmasqDomain(instance string, reader network.DHCPConfigReader) string {
+	dnsmasq, err := network.GetDnsmasqConfigForInstance(instance, reader)
+	if err != nil {
+		dnsmasq, err = network.GetDnsmasqConfigWithReader(reader)
+	}
+	if err != nil || dnsmasq.Domain == "" {
+		return network.DefaultDNSDomain
+	}
+
+	return dnsmasq.Domain
+}
+
+// conflictingMeshPools returns the names of the DHCP pools other than section that
+// serve the mesh interface too, such as pools created by other tooling, and warns
+// about each: dnsmasq would hand out addresses from all of them.
+func conflictingMeshPools(section string, reader network.DHCPConfigReader, log zerolog.Logger) []string {
+	pools, err := network.GetAllDHCPConfigsWithReader(reader)
+	if err != nil {
+		log.Debug().Err(err).Msg("Could not list DHCP pools")
+		return nil
+	}
+
+	var names []string
+	for _, pool := range network.ConflictingDHCPPools(pools, section, section) {
+		log.Warn().
+			Str("section", pool.Name).
+			Str("interface", pool.Interface).
+			Str("start", pool.Start).
+			Str("limit", pool.Limit).
+			Msg("Another DHCP pool serves the mesh interface, set its ignore option or remove it")
+		names = append(names, pool.Name)
+	}
+
+	return names
+}
@@ -0,0 +1,113 @@
+package mgmt
+
+import (
+	"testing"
+
+	"github.com/openmanet/openmanetd/internal/network"
+	"github.com/rs/zerolog"
+)
+
+// mockInstanceReader is a dhcp configuration with a main and a guest dnsmasq
+// instance.
+type mockInstanceReader struct {
+	mockDHCPReader
+}
+
+func newMockInstanceReader() *mockInstanceReader {
+	r := &mockInstanceReader{mockDHCPReader: *newMockDHCPReader()}
+	r.options["@dnsmasq[0].domain"] = []string{"mesh"}
+	r.options["guest_dns.domain"] = []string{"guest"}
+	return r
+}
+
+func (m *mockInstanceReader) GetSections(config, secType string) ([]string, error) {
+	if secType != "dnsmasq" {
+		return nil, nil
+	}
+	return []string{"@dnsmasq[0]", "guest_dns"}, nil
+}
+
+func TestMeshPoolInstance(t *testing.T) {
+	reader := newMockInstanceReader()
+
+	tests := []struct {
+		name     string
+		instance string
+		want     string
+	}{
+		{name: "main instance", instance: "", want: ""},
+		{name: "configured instance", instance: "guest_dns", want: "guest_dns"},
+		{name: "missing instance falls back to main", instance: "missing", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := meshPoolInstance(tt.instance, reader, zerolog.Nop()); got != tt.want {
+				t.Errorf("meshPoolInstance(%q) = %q, want %q", tt.instance, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMeshPoolInstance_AttachesPool(t *testing.T) {
+	reader := newMockInstanceReader()
+
+	pool := &network.UCIDHCP{
+		Interface: "ahwlan",
+		Start:     "100",
+		Limit:     "16",
+		Instance:  meshPoolInstance("guest_dns", reader, zerolog.Nop()),
+	}
+	if _, err := network.SetDHCPConfigWithReader("ahwlan", pool, reader); err != nil {
+		t.Fatalf("SetDHCPConfigWithReader failed: %v", err)
+	}
+
+	if got := reader.options["ahwlan.instance"]; len(got) != 1 || got[0] != "guest_dns" {
+		t.Errorf("Expected the pool attached to guest_dns, got %v", got)
+	}
+}
+
+func TestDnsmasqDomain(t *testing.T) {
+	reader := newMockInstanceReader()
+
+	if got := dnsmasqDomain("", reader); got != "mesh" {
+		t.Errorf("dnsmasqDomain(\"\") = %q, want mesh", got)
+	}
+	if got := dnsmasqDomain("guest_dns", reader); got != "guest" {
+		t.Errorf("dnsmasqDomain(guest_dns) = %q, want guest", got)
+	}
+	if got := dnsmasqDomain("missing", reader); got != "mesh" {
+		t.Errorf("dnsmasqDomain(missing) = %q, want mesh", got)
+	}
+
+	if got := dnsmasqDomain("", newMockDHCPReader()); got != network.DefaultDNSDomain {
+		t.Errorf("dnsmasqDomain without a domain = %q, want %q", got, network.DefaultDNSDomain)
+	}
+}
+
+// mockPoolsReader is a dhcp configuration with the mesh pool, a second pool on the
+// mesh interface and an ignored one.
+type mockPoolsReader struct {
+	mockDHCPReader
+}
+
+func (m *mockPoolsReader) GetSections(config, secType string) ([]string, error) {
+	if secType != "dhcp" {
+		return nil, nil
+	}
+	return []string{"ahwlan", "@dhcp[1]", "old_mesh", "lan"}, nil
+}
+
+func TestConflictingMeshPools(t *testing.T) {
+	reader := &mockPoolsReader{mockDHCPReader: *newMockDHCPReader()}
+	reader.options["ahwlan.interface"] = []string{"ahwlan"}
+	reader.options["@dhcp[1].interface"] = []string{"ahwlan"}
+	reader.options["old_mesh.interface"] = []string{"ahwlan"}
+	reader.options["old_mesh.ignore"] = []string{"1"}
+	reader.options["lan.interface"] = []string{"lan"}
+
+	got := conflictingMeshPools("ahwlan", reader, zerolog.Nop())
+	if len(got) != 1 || got[0] != "@dhcp[1]" {
+		t.Errorf("conflictingMeshPools() = %v, want [@dhcp[1]]", got)
+	}
+}
@@ -0,0 +1,139 @@
+package mgmt
+
+import (
+	"strings"
+
+	"github.com/openmanet/openmanetd/internal/network"
+	"github.com/rs/zerolog"
+)
+
+// alfredPort is the UDP port alfred exchanges records on, over IPv6 link-local
+// multicast.
+const alfredPort = "16962"
+
+// meshServiceRule is a firewall rule section accepting a service nodes need from each
+// other.
+type meshServiceRule struct {
+	section string
+	rule    network.UCIFirewallRule
+}
+
+// meshServiceRules returns the rules accepting DHCP, DNS and alfred from zone. They
+// only matter if the zone rejects input, but are harmless otherwise.
+func meshServiceRules(zone string) []meshServiceRule {
+	return []meshServiceRule{
+		{"openmanet_dhcp", network.UCIFirewallRule{Name: "Allow-OpenMANET-DHCP", Src: zone, DestPort: "67", Proto: "udp", Family: "ipv4", Target: "ACCEPT"}},
+		{"openmanet_dns", network.UCIFirewallRule{Name: "Allow-OpenMANET-DNS", Src: zone, DestPort: "53", Proto: "tcp udp", Target: "ACCEPT"}},
+		{"openmanet_alfred", network.UCIFirewallRule{Name: "Allow-OpenMANET-alfred", Src: zone, DestPort: alfredPort, Proto: "udp", Family: "ipv6", Target: "ACCEPT"}},
+	}
+}
+
+// ensureMeshServiceRules makes sure the zone covering the network section accepts
+// DHCP, DNS and alfred. A section in no zone is left to ensureZoneCoverage, which
+// warns about it. Calling it again once the rules are in place changes nothing.
+//
+// Returns true if a rule was added or changed and the firewall needs a reload.
+func ensureMeshServiceRules(section string, reader network.FirewallConfigReader, log zerolog.Logger) (bool, error) {
+	covered, zone, err := network.VerifyZoneCoverageWithReader(section, reader)
+	if err != nil || !covered {
+		return false, err
+	}
+
+	changed := false
+	for _, r := range meshServiceRules(zone) {
+		set, err := network.SetFirewallRuleWithReader(r.section, &r.rule, reader)
+		if err != nil {
+			return changed, err
+		}
+		if set {
+			log.Warn().Bool("audit", true).Str("rule", r.section).Str("zone", zone).Msg("Updated firewall rule for mesh services")
+		}
+		changed = changed || set
+	}
+
+	return changed, nil
+}
+
+// ensureGatewayMasquerade makes sure traffic from the zone covering the network
+// section is forwarded to uplinkZone and masqueraded there, as a gateway needs to
+// give the mesh access to its uplink. Calling it again once this is in place changes
+// nothing.
+//
+// Returns true if the firewall configuration changed and needs a reload, and an
+// ErrSectionNotFound error if there is no zone named uplinkZone.
+func ensureGatewayMasquerade(section, uplinkZone string, reader network.FirewallConfigReader, log zerolog.Logger) (bool, error) {
+	zone, ok, err := meshZone(section, uplinkZone, reader, log)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	changed, err := network.EnableGatewayNATWithReader(zone, uplinkZone, reader)
+	if err != nil {
+		return changed, err
+	}
+	if changed {
+		log.Warn().Bool("audit", true).Str("src", zone).Str("dest", uplinkZone).Msg("Enabled masquerading from mesh zone to uplink zone")
+	}
+
+	return changed, nil
+}
+
+// removeGatewayMasquerade undoes ensureGatewayMasquerade once this node is no longer
+// a gateway. Calling it again, or on a node that never masqueraded, changes nothing.
+//
+// Returns true if the firewall configuration changed and needs a reload.
+func removeGatewayMasquerade(section, uplinkZone string, reader network.FirewallConfigReader, log zerolog.Logger) (bool, error) {
+	zone, ok, err := meshZone(section, uplinkZone, reader, log)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	changed, err := network.DisableGatewayNATWithReader(zone, uplinkZone, reader)
+	if err != nil {
+		return changed, err
+	}
+	if changed {
+		log.Warn().Bool("audit", true).Str("src", zone).Str("dest", uplinkZone).Msg("Disabled masquerading from mesh zone to uplink zone")
+	}
+
+	return changed, nil
+}
+
+// meshZone returns the zone covering the network section, or false if it has no
+// zone of its own to masquerade from.
+func meshZone(section, uplinkZone string, reader network.FirewallConfigReader, log zerolog.Logger) (string, bool, error) {
+	covered, zone, err := network.VerifyZoneCoverageWithReader(section, reader)
+	if err != nil {
+		return "", false, err
+	}
+	if !covered || zone == uplinkZone {
+		log.Debug().Str("network", section).Str("zone", zone).Msg("Mesh network has no zone of its own, not masquerading")
+		return "", false, nil
+	}
+	return zone, true, nil
+}
+
+// checkMasquerade makes sure the mesh is masqueraded to the uplink while this node
+// is a gateway, and no longer once it is not, reloading the firewall if that changed
+// its configuration.
+func (gw *GatewayWorker) checkMasquerade(t Tunables, gateway bool) {
+	section := strings.TrimPrefix(t.IFace, "br-")
+
+	update := removeGatewayMasquerade
+	if gateway {
+		update = ensureGatewayMasquerade
+	}
+
+	changed, err := update(section, gw.Config.UplinkZone, gw.Deps.UCIFirewall, gw.Deps.Log)
+	if err != nil {
+		gw.Deps.Log.Error().Err(err).Str("zone", gw.Config.UplinkZone).Msg("Error updating masquerading")
+		return
+	}
+	if !changed {
+		return
+	}
+
+	if err := network.ReloadFirewall(); err != nil {
+		gw.Deps.Log.Error().Err(err).Msg("Error reloading firewall")
+	}
+}
@@ -0,0 +1,126 @@
+package mgmt
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/openmanet/openmanetd/internal/network"
+	"github.com/rs/zerolog"
+)
+
+func TestEnsureMeshServiceRules(t *testing.T) {
+	reader := newMockFirewallReader()
+	var buf bytes.Buffer
+
+	changed, err := ensureMeshServiceRules("lan", reader, zerolog.New(&buf))
+	if err != nil || !changed {
+		t.Fatalf("ensureMeshServiceRules() = %v, %v; want true, nil", changed, err)
+	}
+	if want := []string{"openmanet_dhcp", "openmanet_dns", "openmanet_alfred"}; !reflect.DeepEqual(reader.added["rule"], want) {
+		t.Errorf("rules = %v, want %v", reader.added["rule"], want)
+	}
+	for _, section := range reader.added["rule"] {
+		rule, err := network.GetFirewallRuleWithReader(section, reader)
+		if err != nil || rule.Src != "lan" || rule.Target != "ACCEPT" {
+			t.Errorf("rule %s = %+v, %v; want it to accept from lan", section, rule, err)
+		}
+	}
+	if !strings.Contains(buf.String(), `"audit":true`) {
+		t.Errorf("log = %q, want audit entries", buf.String())
+	}
+
+	// A second pass finds everything in order and changes nothing
+	commits := reader.commits
+	if changed, err := ensureMeshServiceRules("lan", reader, zerolog.Nop()); err != nil || changed || reader.commits != commits {
+		t.Errorf("second ensureMeshServiceRules() = %v, %v with %d commits; want false, nil with %d", changed, err, reader.commits, commits)
+	}
+
+	// A network in no zone is left to ensureZoneCoverage
+	reader = newMockFirewallReader()
+	if changed, err := ensureMeshServiceRules("ahwlan", reader, zerolog.Nop()); err != nil || changed || reader.commits != 0 {
+		t.Errorf("uncovered ensureMeshServiceRules() = %v, %v with %d commits; want false, nil with 0", changed, err, reader.commits)
+	}
+}
+
+func TestEnsureGatewayMasquerade(t *testing.T) {
+	reader := newMockFirewallReader()
+
+	changed, err := ensureGatewayMasquerade("lan", "wan", reader, zerolog.Nop())
+	if err != nil || !changed {
+		t.Fatalf("ensureGatewayMasquerade() = %v, %v; want true, nil", changed, err)
+	}
+
+	wan, err := network.GetFirewallZoneWithReader("wan", reader)
+	if err != nil || wan.Masq != "1" || wan.MTUFix != "1" {
+		t.Errorf("wan zone = %+v, %v; want masq and mtu_fix on", wan, err)
+	}
+	forwardings, err := network.GetFirewallForwardingsWithReader(reader)
+	if want := []network.UCIFirewallForwarding{{Src: "lan", Dest: "wan"}}; err != nil || !reflect.DeepEqual(forwardings, want) {
+		t.Errorf("forwardings = %+v, %v; want %+v", forwardings, err, want)
+	}
+
+	commits := reader.commits
+	if changed, err := ensureGatewayMasquerade("lan", "wan", reader, zerolog.Nop()); err != nil || changed || reader.commits != commits {
+		t.Errorf("second ensureGatewayMasquerade() = %v, %v with %d commits; want false, nil with %d", changed, err, reader.commits, commits)
+	}
+}
+
+func TestRemoveGatewayMasquerade(t *testing.T) {
+	reader := newMockFirewallReader()
+
+	// A node that never masqueraded has nothing to undo
+	if changed, err := removeGatewayMasquerade("lan", "wan", reader, zerolog.Nop()); err != nil || changed || reader.commits != 0 {
+		t.Errorf("removeGatewayMasquerade() before = %v, %v with %d commits; want false, nil with 0", changed, err, reader.commits)
+	}
+
+	if _, err := ensureGatewayMasquerade("lan", "wan", reader, zerolog.Nop()); err != nil {
+		t.Fatalf("ensureGatewayMasquerade() error = %v", err)
+	}
+
+	var buf bytes.Buffer
+	changed, err := removeGatewayMasquerade("lan", "wan", reader, zerolog.New(&buf))
+	if err != nil || !changed {
+		t.Fatalf("removeGatewayMasquerade() = %v, %v; want true, nil", changed, err)
+	}
+	if !strings.Contains(buf.String(), `"audit":true`) {
+		t.Errorf("log = %q, want an audit entry", buf.String())
+	}
+
+	wan, err := network.GetFirewallZoneWithReader("wan", reader)
+	if err != nil || wan.Masq != "0" || wan.MTUFix != "0" {
+		t.Errorf("wan zone = %+v, %v; want masq and mtu_fix off", wan, err)
+	}
+	if forwardings, err := network.GetFirewallForwardingsWithReader(reader); err != nil || len(forwardings) != 0 {
+		t.Errorf("forwardings = %+v, %v; want none", forwardings, err)
+	}
+}
+
+func TestEnsureGatewayMasquerade_NothingToDo(t *testing.T) {
+	tests := []struct {
+		name       string
+		section    string
+		uplinkZone string
+		wantErr    error
+	}{
+		{name: "mesh network in no zone", section: "ahwlan", uplinkZone: "wan"},
+		{name: "mesh network in the uplink zone", section: "wan6", uplinkZone: "wan"},
+		{name: "missing uplink zone", section: "lan", uplinkZone: "wwan", wantErr: network.ErrSectionNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := newMockFirewallReader()
+
+			changed, err := ensureGatewayMasquerade(tt.section, tt.uplinkZone, reader, zerolog.Nop())
+			if changed || !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Errorf("ensureGatewayMasquerade() = %v, %v; want false, %v", changed, err, tt.wantErr)
+			}
+			if reader.commits != 0 {
+				t.Errorf("ensureGatewayMasquerade() committed %d times, want 0", reader.commits)
+			}
+		})
+	}
+}
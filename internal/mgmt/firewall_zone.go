@@ -0,0 +1,66 @@
+package mgmt
+
+import (
+	"github.com/openmanet/openmanetd/internal/network"
+	"github.com/rs/zerolog"
+)
+
+// ensureZoneCoverage checks that the network section is covered by a firewall zone.
+// A section in no zone falls under the default REJECT policies, so dnsmasq hands out
+// no leases on it. If autoZone is empty this is only reported; otherwise the section
+// is added to the zone of that name. Calling it again once the section is covered
+// changes nothing.
+//
+// Returns true if the section was added and the firewall needs a reload.
+func ensureZoneCoverage(section, autoZone string, reader network.FirewallConfigReader, log zerolog.Logger) (bool, error) {
+	covered, zone, err := network.VerifyZoneCoverageWithReader(section, reader)
+	if err != nil {
+		return false, err
+	}
+	if covered {
+		log.Debug().Str("network", section).Str("zone", zone).Msg("Network is covered by a firewall zone")
+		return false, nil
+	}
+
+	if autoZone == "" {
+		log.Warn().Str("network", section).Msg("Network is not in any firewall zone, DHCP clients will get no lease until it is added to one (or set mgmt.autoZone)")
+		return false, nil
+	}
+
+	added, err := network.AddNetworkToZoneWithReader(autoZone, section, reader)
+	if err != nil {
+		return false, err
+	}
+	if added {
+		log.Warn().Bool("audit", true).Str("network", section).Str("zone", autoZone).Msg("Added network to firewall zone")
+	}
+
+	return added, nil
+}
+
+// checkZoneCoverage makes sure the newly configured network section is covered by a
+// firewall zone and, if enabled, that the zone accepts the mesh services. The
+// firewall is reloaded if either changed its configuration.
+func (arw *AddressReservationWorker) checkZoneCoverage(section string) {
+	added, err := ensureZoneCoverage(section, arw.Config.AutoZone, arw.Deps.UCIFirewall, arw.Deps.Log)
+	if err != nil {
+		arw.Deps.Log.Error().Err(err).Str("network", section).Msg("Error checking firewall zone coverage")
+		return
+	}
+
+	opened := false
+	if arw.Config.OpenServices {
+		opened, err = ensureMeshServiceRules(section, arw.Deps.UCIFirewall, arw.Deps.Log)
+		if err != nil {
+			arw.Deps.Log.Error().Err(err).Str("network", section).Msg("Error adding firewall rules for mesh services")
+		}
+	}
+
+	if !added && !opened {
+		return
+	}
+
+	if err := network.ReloadFirewall(); err != nil {
+		arw.Deps.Log.Error().Err(err).Msg("Error reloading firewall")
+	}
+}
@@ -0,0 +1,129 @@
+package mgmt
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/digineo/go-uci/v2"
+	"github.com/rs/zerolog"
+)
+
+// mockFirewallReader is a minimal in-memory FirewallConfigReader holding zones and
+// the sections added to it.
+type mockFirewallReader struct {
+	zones   []string            // zone sections in order
+	added   map[string][]string // type -> sections added, in order
+	options map[string][]string // section.option -> values
+	commits int
+}
+
+// newMockFirewallReader returns a reader with a lan zone covering lan and a wan zone
+// covering wan and wan6.
+func newMockFirewallReader() *mockFirewallReader {
+	return &mockFirewallReader{
+		zones: []string{"@zone[0]", "@zone[1]"},
+		options: map[string][]string{
+			"@zone[0].name":    {"lan"},
+			"@zone[0].network": {"lan"},
+			"@zone[1].name":    {"wan"},
+			"@zone[1].network": {"wan", "wan6"},
+		},
+	}
+}
+
+func (m *mockFirewallReader) GetSections(config, secType string) ([]string, error) {
+	if secType == "zone" {
+		return append(slices.Clone(m.zones), m.added[secType]...), nil
+	}
+	return m.added[secType], nil
+}
+
+func (m *mockFirewallReader) Get(config, section, option string) ([]string, bool) {
+	values, ok := m.options[section+"."+option]
+	return values, ok
+}
+
+func (m *mockFirewallReader) SetType(config, section, option string, typ uci.OptionType, values ...string) error {
+	m.options[section+"."+option] = values
+	return nil
+}
+
+func (m *mockFirewallReader) AddSection(config, section, typ string) error {
+	if m.added == nil {
+		m.added = make(map[string][]string)
+	}
+	m.added[typ] = append(m.added[typ], section)
+	return nil
+}
+
+func (m *mockFirewallReader) DelSection(config, section string) error {
+	for typ, sections := range m.added {
+		m.added[typ] = slices.DeleteFunc(sections, func(s string) bool { return s == section })
+	}
+	for key := range m.options {
+		if strings.HasPrefix(key, section+".") {
+			delete(m.options, key)
+		}
+	}
+	return nil
+}
+
+func (m *mockFirewallReader) ReloadConfig() error { return nil }
+
+func (m *mockFirewallReader) Commit() error {
+	m.commits++
+	return nil
+}
+
+func TestEnsureZoneCoverage(t *testing.T) {
+	tests := []struct {
+		name        string
+		section     string
+		autoZone    string
+		wantAdded   bool
+		wantCommits int
+		wantLog     string
+	}{
+		{"covered", "lan", "", false, 0, ""},
+		{"covered with auto zone", "wan6", "lan", false, 0, ""},
+		{"uncovered, warn", "ahwlan", "", false, 0, "not in any firewall zone"},
+		{"uncovered, auto add", "ahwlan", "lan", true, 1, `"audit":true`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			reader := newMockFirewallReader()
+
+			added, err := ensureZoneCoverage(tt.section, tt.autoZone, reader, zerolog.New(&buf).Level(zerolog.InfoLevel))
+			if err != nil {
+				t.Fatalf("ensureZoneCoverage() error = %v", err)
+			}
+			if added != tt.wantAdded || reader.commits != tt.wantCommits {
+				t.Errorf("ensureZoneCoverage() = %v with %d commits, want %v with %d", added, reader.commits, tt.wantAdded, tt.wantCommits)
+			}
+			if tt.wantLog == "" && buf.Len() > 0 || !strings.Contains(buf.String(), tt.wantLog) {
+				t.Errorf("log = %q, want it to contain %q", buf.String(), tt.wantLog)
+			}
+
+			// A second pass finds everything in order and changes nothing
+			added, err = ensureZoneCoverage(tt.section, tt.autoZone, reader, zerolog.Nop())
+			if err != nil || added || reader.commits != tt.wantCommits {
+				t.Errorf("second ensureZoneCoverage() = %v, %v with %d commits; want false, nil with %d", added, err, reader.commits, tt.wantCommits)
+			}
+		})
+	}
+}
+
+func TestEnsureZoneCoverage_UnknownZone(t *testing.T) {
+	reader := newMockFirewallReader()
+
+	if _, err := ensureZoneCoverage("ahwlan", "mesh", reader, zerolog.Nop()); err == nil {
+		t.Error("ensureZoneCoverage() error = nil for a missing auto zone")
+	}
+	if reader.commits != 0 {
+		t.Errorf("ensureZoneCoverage() committed %d times, want 0", reader.commits)
+	}
+}
@@ -1,40 +1,144 @@
 package mgmt
 
 import (
+	"context"
+	"fmt"
 	"net"
 	"os"
+	"sync/atomic"
 	"time"
 
-	"github.com/openmanet/go-alfred"
 	proto "github.com/openmanet/openmanetd/internal/api/openmanet/v1"
 	batmanadv "github.com/openmanet/openmanetd/internal/batman-adv"
 	"github.com/openmanet/openmanetd/internal/network"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
 )
 
 const (
 	GatewayDataType        uint8 = uint8(proto.DataType_DATA_TYPE_GATEWAY)
 	GatewayDataTypeVersion uint8 = 1
+
+	// gatewayRouteMetric is the metric of the default route via the selected gateway.
+	gatewayRouteMetric int = 10
+
+	// gatewayRouteOwner is the name the default route via the selected gateway is
+	// managed under.
+	gatewayRouteOwner = "gateway"
 )
 
 type GatewayWorker struct {
+	// Config holds the settings fixed at startup, Deps the shared runtime
+	// dependencies and Tunables the settings that may change between ticks.
 	Config       *ManagementConfig
-	Client       *alfred.Client
+	Deps         Deps
+	Tunables     TunablesProvider
 	ShutdownChan <-chan os.Signal
 
 	sendInterval time.Duration
 	recvInterval time.Duration
+
+	// recvTicks measures the receive ticks and keeps them from overlapping.
+	recvTicks *TickMonitor
+
+	// republish triggers a send pass ahead of the ticker, e.g. after a rename.
+	republish chan struct{}
+
+	// Return-path verification of the selected gateway
+	probes        *GatewayProbeTracker
+	gatewayProber network.Prober
+	targetProber  network.Prober
+	// classify is overridable for tests.
+	classify       func(ip net.IP, meshIfaces []string, meshSubnets []*net.IPNet) (network.DestClass, *network.Route, error)
+	probeTarget    net.IP
+	currentGateway string
+	responderUp    bool
+
+	// selectedAt is when the current gateway was selected; it is kept for the gateway
+	// hold time unless it disappears or becomes suspect.
+	selectedAt time.Time
+
+	// selected is the gateway the default route points at, for status queries.
+	selected atomic.Pointer[proto.Gateway]
+
+	// published is the gateway record this node last announced, withdrawn again on
+	// shutdown. Nil if the node has not announced itself as a gateway.
+	published atomic.Pointer[proto.Gateway]
+
+	// records tracks the age of received gateway announcements.
+	records *RecordTracker
+
+	// state persists the selected gateway, so a restart can adopt the route.
+	state *StateStore
+	// meshGateways is overridable for tests.
+	meshGateways func(iface string) (*batmanadv.Gateways, error)
+
+	// routes is where the default route via the selected gateway is installed.
+	routes network.RouteTable
+	// subscribe is overridable for tests.
+	subscribe func(done <-chan struct{}) (<-chan network.NetEvent, error)
+	// legacyRoutesRemoved is set once untagged default routes installed by earlier
+	// versions have been removed from the mesh interface.
+	legacyRoutesRemoved bool
+	// managed, if set, puts the default route back between ticks when something
+	// else removes it; managedRoute is the route last handed to it.
+	managed      *ManagedRouteReconciler
+	managedRoute *network.Route
+
+	// lastTunables are the tunables of the most recent tick.
+	lastTunables atomic.Pointer[Tunables]
+}
+
+func NewGatewayWorker(config *ManagementConfig, client *AlfredClient, shutdownChan <-chan os.Signal) *GatewayWorker {
+	return NewGatewayWorkerWithDeps(config, config.deps.withClient(client), config, shutdownChan)
 }
 
-func NewGatewayWorker(config *ManagementConfig, client *alfred.Client, shutdownChan <-chan os.Signal) *GatewayWorker {
-	config.Log.Info().Msg("GatewayWorker initialized")
+// NewGatewayWorkerWithDeps creates a gateway worker that uses deps and takes a
+// snapshot of tunables at the start of every tick.
+func NewGatewayWorkerWithDeps(config *ManagementConfig, deps Deps, tunables TunablesProvider, shutdownChan <-chan os.Signal) *GatewayWorker {
+	deps.Log.Info().Msg("GatewayWorker initialized")
+
+	var gatewayProber network.Prober = &network.ICMPProber{Timeout: config.GatewayProbeTimeout}
+	if config.GatewayProbeProtocol == network.ProbeProtocolUDP {
+		gatewayProber = &network.UDPProber{Port: config.GatewayProbePort, Timeout: config.GatewayProbeTimeout}
+	}
+
+	var probeTarget net.IP
+	if config.GatewayProbeTarget != "" {
+		if probeTarget = net.ParseIP(config.GatewayProbeTarget).To4(); probeTarget == nil {
+			deps.Log.Warn().Msgf("Ignoring invalid gateway probe target %q", config.GatewayProbeTarget)
+		}
+	}
+
+	state := deps.State
+	if state == nil {
+		state = OpenStateStore(config.StatePath, deps.Log)
+	}
 
 	return &GatewayWorker{
 		Config:       config,
-		Client:       client,
+		Deps:         deps,
+		Tunables:     tunables,
 		ShutdownChan: shutdownChan,
 
 		sendInterval: config.gatewayWorkerSendInterval,
 		recvInterval: config.gatewayWorkerRecvInterval,
+		recvTicks:    NewTickMonitor("gateway receive", config.gatewayWorkerRecvInterval, deps.Log),
+		republish:    make(chan struct{}, 1),
+
+		probes:        NewGatewayProbeTracker(deps.Log),
+		gatewayProber: gatewayProber,
+		targetProber:  &network.ICMPProber{Timeout: config.GatewayProbeTimeout},
+		classify:      network.ClassifyDestinationOn,
+		probeTarget:   probeTarget,
+
+		records:      NewRecordTracker(DefaultReservationTTL),
+		state:        state,
+		meshGateways: batmanadv.GetMeshGateways,
+
+		routes:    network.KernelRouteTable{},
+		subscribe: network.Subscribe,
+		managed:   config.managedRoutes,
 	}
 }
 
@@ -43,176 +147,466 @@ func (gw *GatewayWorker) StartSend() {
 	ticker := time.NewTicker(gw.sendInterval)
 	defer ticker.Stop()
 
+	ctx, cancel := workerContext(gw.ShutdownChan)
+	defer cancel()
+
 	for {
 		select {
 		case <-gw.ShutdownChan:
 			return
 		case <-ticker.C:
-			configured, err := network.IsDHCPConfiguredWithReader(gw.Config.uciOpenMANETConfig)
-			if err != nil {
-				gw.Config.Log.Error().Err(err).Msg("Error checking DHCP configuration")
-				continue
-			}
+			gw.sendTick(ctx)
+		case <-gw.republish:
+			gw.sendTick(ctx)
+		}
+	}
+}
 
-			if !configured {
-				gw.Config.Log.Debug().Msg("Static Address & DHCP not configured, skipping gateway data send")
-				continue
-			}
+// Republish publishes the gateway record without waiting for the next tick.
+func (gw *GatewayWorker) Republish() {
+	select {
+	case gw.republish <- struct{}{}:
+	default:
+	}
+}
 
-			// Get mesh config from batman-adv to check if we are in gateway mode
-			meshCfg, err := batmanadv.GetMeshConfig(gw.Config.BatInterface)
-			if err != nil {
-				gw.Config.Log.Error().Err(err).Msg("Error getting mesh config")
-				continue
-			}
+// sendTick publishes this node's gateway record if it is a configured gateway.
+func (gw *GatewayWorker) sendTick(ctx context.Context) {
+	t := gw.tick()
 
-			// Only send gateway data if we are in gateway mode
-			if meshCfg.IsGatewayMode() {
-				iface := network.GetInterfaceByName(gw.Config.IFace)
-				hostname, err := os.Hostname()
-				if err != nil {
-					gw.Config.Log.Error().Err(err).Msg("Error getting hostname")
-					hostname = "unknown"
-				}
+	configured, err := network.IsDHCPConfiguredWithReader(gw.Deps.UCIOpenMANET)
+	if err != nil {
+		gw.Deps.Log.Error().Err(err).Msg("Error checking DHCP configuration")
+		return
+	}
 
-				// Verify that the interface has an IP address
-				if len(iface.IP) == 0 {
-					gw.Config.Log.Warn().Msgf("Interface %s has no IP address", gw.Config.IFace)
-					continue
-				}
+	if !configured {
+		gw.Deps.Log.Debug().Msg("Static Address & DHCP not configured, skipping gateway data send")
+		return
+	}
 
-				// Verify that the interface has a valid IPV4 address
-				if iface.IP[0].IP.To4() == nil {
-					gw.Config.Log.Warn().Msgf("Interface %s has no valid IPv4 address", gw.Config.IFace)
-					continue
-				}
+	// Get mesh config from batman-adv to check if we are in gateway mode
+	meshCfg, err := gw.Deps.meshConfig(ctx, t.BatInterface)
+	if err != nil {
+		gw.Deps.Log.Error().Err(err).Msg("Error getting mesh config")
+		return
+	}
 
-				// Prepare gateway data
-				gatewayData := proto.Gateway{
-					// We use the mesh interface MAC as the gateway identifier
-					// Not the br-awhlan MAC.  Batman-adv uses the mesh MAC to identify gateways.
-					Mac: meshCfg.HardAddress,
-					// Use the IP address of the br-awhlan interface
-					// This is to setup routing to the gateway correctly for layer 3
-					Ipaddr: iface.IP[0].IP.String(),
-					// Use the hostname of the gateway
-					Hostname: hostname,
-				}
+	if gw.Config.GatewayMasquerade {
+		gw.checkMasquerade(t, meshCfg.IsGatewayMode())
+	}
 
-				var gatewayDataBytes []byte
-				gatewayDataBytes, err = gatewayData.MarshalVT()
-				if err != nil {
-					gw.Config.Log.Error().Err(err).Msg("Error marshaling gateway data")
-					continue
-				}
+	// Only send gateway data if we are in gateway mode
+	if meshCfg.IsGatewayMode() {
+		gw.startProbeResponder(ctx, t)
 
-				err = gw.Client.Set(GatewayDataType, GatewayDataTypeVersion, gatewayDataBytes)
-				if err != nil {
-					gw.Config.Log.Error().Err(err).Msg("Error sending gateway data")
-				}
-			}
+		iface := network.GetInterfaceByName(t.IFace)
+
+		// Verify that the interface has an IP address
+		if len(iface.IP) == 0 {
+			gw.Deps.Log.Warn().Msgf("Interface %s has no IP address", t.IFace)
+			return
+		}
+
+		// Verify that the interface has a valid IPV4 address
+		addr, ok := iface.PrimaryIPv4()
+		if !ok {
+			gw.Deps.Log.Warn().Msgf("Interface %s has no valid IPv4 address", t.IFace)
+			return
+		}
+
+		// Prepare gateway data
+		gatewayData := proto.Gateway{
+			// We use the mesh interface MAC as the gateway identifier
+			// Not the br-awhlan MAC.  Batman-adv uses the mesh MAC to identify gateways.
+			Mac: meshCfg.HardAddress,
+			// Use the IP address of the br-awhlan interface
+			// This is to setup routing to the gateway correctly for layer 3
+			Ipaddr: addr.IP.String(),
+			// Use the hostname of the gateway
+			Hostname: gw.Deps.hostname(meshCfg.HardAddress),
+			MeshId:   gw.Config.MeshID,
+		}
+
+		var gatewayDataBytes []byte
+		gatewayDataBytes, err = gatewayData.MarshalVT()
+		if err != nil {
+			gw.Deps.Log.Error().Err(err).Msg("Error marshaling gateway data")
+			return
+		}
+
+		err = gw.Deps.Client.SetCtx(ctx, GatewayDataType, GatewayDataTypeVersion, gatewayDataBytes)
+		if err != nil {
+			gw.Deps.Log.Error().Err(err).Msg("Error sending gateway data")
+			return
 		}
+		gw.published.Store(&gatewayData)
+	}
+}
+
+// Withdraw replaces the gateway record this node announced with one marked
+// withdrawing, so that clients fail over now rather than when the record ages out
+// of alfred. It does nothing if the node has not announced itself as a gateway.
+//
+// The call is bounded by ctx and the alfred call timeout.
+func (gw *GatewayWorker) Withdraw(ctx context.Context) error {
+	published := gw.published.Load()
+	if published == nil {
+		return nil
+	}
+
+	final := published.CloneVT()
+	final.Withdrawing = true
+
+	data, err := final.MarshalVT()
+	if err != nil {
+		return fmt.Errorf("error marshaling gateway data: %w", err)
 	}
+
+	return gw.Deps.Client.SetCtx(ctx, GatewayDataType, GatewayDataTypeVersion, data)
 }
 
 // Start begins the periodic receiving of gateway data from the Alfred client.
 func (gw *GatewayWorker) StartReceive() {
+	// Adopt the route left by the previous run before waiting for the first tick
+	gw.restoreGateway(gw.tick(), time.Now())
+
 	ticker := time.NewTicker(gw.recvInterval)
 	defer ticker.Stop()
 
+	ctx, cancel := workerContext(gw.ShutdownChan)
+	defer cancel()
+
+	// The ticker stays the fallback; route events only bring the next tick forward
+	events := gw.watchRoutes(ctx.Done())
+
 	for {
 		select {
 		case <-gw.ShutdownChan:
 			return
 		case <-ticker.C:
-			// If we are not in gateway mode, process received gateway data
-			meshCfg, err := batmanadv.GetMeshConfig(gw.Config.BatInterface)
-			if err != nil {
-				gw.Config.Log.Error().Err(err).Msg("Error getting mesh config")
+			gw.recvTicks.Run(func() { gw.receiveTick(ctx) })
+		case event, ok := <-events:
+			if !ok {
+				if ctx.Err() != nil {
+					return
+				}
+				// The kernel ended the subscription and events may have been lost
+				events = gw.watchRoutes(ctx.Done())
+			} else if gw.lostDefaultRoute(event) {
+				gw.Deps.Log.Info().Msgf("Default route %s was removed, selecting a gateway", event.Route)
+			} else {
 				continue
 			}
+			gw.recvTicks.Run(func() { gw.receiveTick(ctx) })
+		}
+	}
+}
 
-			if meshCfg.IsGatewayMode() {
-				// Skip processing if we are in gateway mode
-				continue
-			}
+// watchRoutes subscribes to route and link changes until done is closed. Returns nil,
+// which never delivers, if the subscription cannot be opened.
+func (gw *GatewayWorker) watchRoutes(done <-chan struct{}) <-chan network.NetEvent {
+	if gw.subscribe == nil {
+		return nil
+	}
 
-			record, err := gw.Client.Request(GatewayDataType)
-			if err != nil {
-				gw.Config.Log.Error().Err(err).Msg("Error receiving gateway data")
-			} else {
-				// Get the gateway status from batman-adv
-				batGwys, err := batmanadv.GetMeshGateways(gw.Config.BatInterface)
-				if err != nil {
-					gw.Config.Log.Error().Err(err).Msg("Error getting mesh gateways")
-					continue
-				}
+	events, err := gw.subscribe(done)
+	if err != nil {
+		gw.Deps.Log.Error().Err(err).Msg("Failed to watch routes; a removed default route will only be restored on the next tick")
+		return nil
+	}
 
-				// If no gateways are present in batman-adv, skip processing
-				if len(*batGwys) == 0 {
-					gw.Config.Log.Debug().Msg("No gateways present in batman-adv")
-					continue
-				}
+	return events
+}
 
-				// If only one gateway is present from batman-adv, loop through the
-				// gateway records and match batman-adv original address MAC to the received gateway MAC
-				// This is to identify the active gateway in the mesh
-				if len(*batGwys) == 1 {
-					batGw := batGwys.GetBest()
-					for _, rec := range record {
-						var gatewayData proto.Gateway
-						err = gatewayData.UnmarshalVT(rec.Data)
-						if err != nil {
-							gw.Config.Log.Error().Err(err).Msg("Error unmarshaling gateway data")
-							continue
-						}
-
-						if gatewayData.Mac == batGw.OrigAddress {
-							// Replace default route with the matched gateway IP
-							ipString := net.ParseIP(gatewayData.Ipaddr)
-
-							if ipString != nil {
-								if err := network.ReplaceDefaultRoute(ipString, gw.Config.IFace); err != nil {
-									gw.Config.Log.Error().Err(err).Msgf("Failed to replace default route with gateway %s", gatewayData.Ipaddr)
-								}
-							}
-						}
-					}
-					// Skip further processing as we have already matched the single gateway
-					continue
-				}
+// lostDefaultRoute reports whether event is the removal of the IPv4 default route
+// this node installed via the selected gateway. Routes removed when the selection
+// moves to another gateway are ignored.
+func (gw *GatewayWorker) lostDefaultRoute(event network.NetEvent) bool {
+	if event.Type != network.EventRouteDeleted || !event.IsDefaultRoute() || !isIPv4Default(event.Route) ||
+		event.Route.Protocol != network.RouteProtocolOpenMANET {
+		return false
+	}
 
-				if len(*batGwys) > 1 {
-					// TODO: Handle multiple gateways in batman-adv
-					batGw := batGwys.GetBest()
-
-					gw.Config.Log.Debug().Msg("Multiple gateways present in batman-adv")
-					// Process received gateway records
-					for _, rec := range record {
-						// Unmarshal gateway data
-						var gatewayData proto.Gateway
-						err = gatewayData.UnmarshalVT(rec.Data)
-						if err != nil {
-							gw.Config.Log.Error().Err(err).Msg("Error unmarshaling gateway data")
-							continue
-						}
-
-						// TODO: Handle multiple gateways in batman-adv
-						if gatewayData.Mac == batGw.OrigAddress {
-							// Replace default route with the matched gateway IP
-							ipString := net.ParseIP(gatewayData.Ipaddr)
-
-							if ipString != nil {
-								if err := network.ReplaceDefaultRoute(ipString, gw.Config.IFace); err != nil {
-									gw.Config.Log.Error().Err(err).Msgf("Failed to replace default route with gateway %s", gatewayData.Ipaddr)
-								}
-							}
-
-							break
-						}
-					}
-				}
-			}
+	if selected := gw.selected.Load(); selected != nil {
+		return event.Route.Gateway.Equal(net.ParseIP(selected.Ipaddr))
+	}
+
+	return true
+}
+
+// RecvTickStats returns the durations and overruns of the receive ticks.
+func (gw *GatewayWorker) RecvTickStats() TickStats {
+	return gw.recvTicks.Stats()
+}
+
+// receiveTick selects the gateway for the default route from the current records.
+func (gw *GatewayWorker) receiveTick(ctx context.Context) {
+	t := gw.tick()
+
+	// If we are not in gateway mode, process received gateway data
+	meshCfg, err := gw.Deps.meshConfig(ctx, t.BatInterface)
+	if err != nil {
+		gw.Deps.Log.Error().Err(err).Msg("Error getting mesh config")
+		return
+	}
+
+	if meshCfg.IsGatewayMode() {
+		// Our uplink is the default route now, not a mesh gateway
+		gw.releaseDefaultRoute()
+		return
+	}
+
+	record, err := gw.Deps.Client.RequestCtx(ctx, GatewayDataType)
+	if err != nil {
+		gw.Deps.Log.Error().Err(err).Msg("Error receiving gateway data")
+		return
+	}
+	record = gw.Deps.MeshFilter.FilterGateways(gw.Deps.RecordLimits.Limit("gateway", record))
+
+	// Get the gateway status from batman-adv
+	batGwys, err := gw.meshGateways(t.BatInterface)
+	if err != nil {
+		gw.Deps.Log.Error().Err(err).Msg("Error getting mesh gateways")
+		return
+	}
+
+	// If no gateways are present in batman-adv, skip processing
+	if len(*batGwys) == 0 {
+		gw.Deps.Log.Debug().Msg("No gateways present in batman-adv")
+		gw.releaseDefaultRoute()
+		return
+	}
+
+	decoded, err := gw.records.DecodeGatewayRecords(record)
+	if err != nil {
+		gw.Deps.Log.Error().Err(err).Msg("Error unmarshaling gateway data")
+	}
+	gw.records.Prune()
+
+	// Index the received gateway records by mesh MAC so they can be matched
+	// against the batman-adv originator addresses. Stale alfred replicas can
+	// still serve a gateway's old address after it renumbers, so the freshest
+	// record wins.
+	records := freshestGateways(decoded)
+	if rec, ok := records[gw.currentGateway]; ok && rec.Withdrawing {
+		gw.Deps.Log.Info().Msgf("Gateway %s (%s) is shutting down, failing over", rec.Ipaddr, rec.Hostname)
+	}
+
+	// Prefer batman-adv's best gateway unless its return path is suspect
+	selected := preferGateway(*batGwys, records, gw.probes.IsSuspect)
+	if selected == nil {
+		gw.Deps.Log.Debug().Msg("No gateway record matches a batman-adv gateway")
+		gw.releaseDefaultRoute()
+		return
+	}
+
+	// Keep a recently selected gateway unless it is gone or suspect
+	now := time.Now()
+	hold := gw.Config.MeshHealthPolicy.GatewayHold(gw.Deps.meshHealth(t.BatInterface))
+	selected = holdGateway(selected, currentGateway(*batGwys, records, gw.currentGateway), now.Sub(gw.selectedAt), hold, gw.probes.IsSuspect)
+
+	// Replace default route with the selected gateway IP
+	if err := gw.installDefaultRoute(t, net.ParseIP(selected.Ipaddr)); err != nil {
+		gw.Deps.Log.Error().Err(err).Msgf("Failed to replace default route with gateway %s", selected.Ipaddr)
+		return
+	}
+
+	if selected.Mac != gw.currentGateway {
+		gw.Deps.Log.Info().Msgf("Default route via gateway %s (%s)", selected.Ipaddr, selected.Hostname)
+		gw.probes.RecordSelection(selected.Mac, selected.Ipaddr)
+		gw.currentGateway = selected.Mac
+		gw.selectedAt = now
+	}
+	gw.saveDecision(t, selected, now)
+	gw.selected.Store(selected)
+
+	gw.verifyReturnPath(ctx, t, selected)
+}
+
+// currentGateway returns the record of the gateway mac if batman-adv still lists it
+// and its record has a usable address and is not withdrawing, or nil otherwise.
+func currentGateway(batGwys batmanadv.Gateways, records map[string]*proto.Gateway, mac string) *proto.Gateway {
+	rec, ok := records[mac]
+	if !ok || rec.Withdrawing || net.ParseIP(rec.Ipaddr).To4() == nil {
+		return nil
+	}
+
+	for _, gw := range batGwys {
+		if gw.OrigAddress == mac {
+			return rec
 		}
 	}
+
+	return nil
+}
+
+// holdGateway returns current instead of preferred while current was selected less
+// than hold ago and its return path is not suspect.
+func holdGateway(preferred, current *proto.Gateway, selectedFor, hold time.Duration, suspect func(mac string) bool) *proto.Gateway {
+	if current == nil || current.Mac == preferred.Mac || selectedFor >= hold || suspect(current.Mac) {
+		return preferred
+	}
+
+	return current
+}
+
+// installDefaultRoute makes the default route via gateway the only default route
+// this node owns. Default routes added by netifd or an administrator are kept.
+func (gw *GatewayWorker) installDefaultRoute(t Tunables, gateway net.IP) error {
+	if !gw.legacyRoutesRemoved {
+		gw.removeLegacyDefaultRoutes(t)
+	}
+
+	route := &network.Route{
+		Gateway:   gateway,
+		Interface: t.IFace,
+		Metric:    gatewayRouteMetric,
+		Table:     unix.RT_TABLE_MAIN,
+		Scope:     netlink.SCOPE_UNIVERSE,
+	}
+	if err := network.ReplaceRouteByDestinationWithRouteTable(route, gw.routes); err != nil {
+		return err
+	}
+
+	gw.manageDefaultRoute(route)
+	return nil
+}
+
+// manageDefaultRoute hands route to the managed route reconciler as the default
+// route via the selected gateway, in place of the one handed to it before. The route
+// is already installed, so the reconciler adopts it; the previous one was replaced.
+func (gw *GatewayWorker) manageDefaultRoute(route *network.Route) {
+	if gw.managed == nil || (gw.managedRoute != nil && network.SameRoute(gw.managedRoute, route)) {
+		return
+	}
+
+	if err := gw.managed.SetRoutes(gatewayRouteOwner, []*network.Route{route}); err != nil {
+		gw.Deps.Log.Error().Err(err).Msgf("Failed to manage default route %s", route)
+		return
+	}
+	gw.managedRoute = route
+}
+
+// releaseDefaultRoute empties the set of the managed route reconciler holding the
+// default route via the selected gateway, so that it removes the route instead of
+// putting it back while no mesh gateway is selected.
+func (gw *GatewayWorker) releaseDefaultRoute() {
+	if gw.managed == nil || gw.managedRoute == nil {
+		return
+	}
+
+	if err := gw.managed.SetRoutes(gatewayRouteOwner, nil); err != nil {
+		gw.Deps.Log.Error().Err(err).Msgf("Failed to remove default route %s", gw.managedRoute)
+		return
+	}
+	gw.Deps.Log.Info().Msgf("Removed default route %s, no mesh gateway is selected", gw.managedRoute)
+	gw.managedRoute = nil
+}
+
+// removeLegacyDefaultRoutes deletes the IPv4 default routes on the mesh interface
+// that are not tagged as ours. Earlier versions installed the gateway route without
+// a tag; left in place it would shadow or block the tagged route.
+func (gw *GatewayWorker) removeLegacyDefaultRoutes(t Tunables) {
+	current, err := gw.routes.GetRoutes(unix.RT_TABLE_MAIN)
+	if err != nil {
+		gw.Deps.Log.Error().Err(err).Msg("Error listing routes to remove legacy default routes")
+		return
+	}
+
+	removed := true
+	for _, route := range current {
+		if route.Protocol == network.RouteProtocolOpenMANET || route.Interface != t.IFace || !isIPv4Default(route) {
+			continue
+		}
+		if err := gw.routes.DeleteRoute(route); err != nil {
+			gw.Deps.Log.Error().Err(err).Msgf("Error removing legacy default route %s", route)
+			removed = false
+			continue
+		}
+		gw.Deps.Log.Info().Msgf("Removed legacy default route %s", route)
+	}
+
+	gw.legacyRoutesRemoved = removed
+}
+
+// isIPv4Default reports whether route is an IPv4 default route.
+func isIPv4Default(route *network.Route) bool {
+	if route.Destination == nil {
+		return route.Gateway == nil || route.Gateway.To4() != nil
+	}
+	ones, _ := route.Destination.Mask.Size()
+	return ones == 0 && route.Destination.IP.To4() != nil
+}
+
+// verifyReturnPath checks that replies from the gateway, and from the external probe
+// target if one is configured, make it back to this node's mesh IP. Failures mark the
+// gateway suspect rather than removing the route, so the next selection prefers an
+// alternative if there is one.
+func (gw *GatewayWorker) verifyReturnPath(ctx context.Context, t Tunables, gateway *proto.Gateway) {
+	if !gw.Config.GatewayProbeEnable || !gw.probes.NeedsProbe(gateway.Mac) {
+		return
+	}
+
+	iface := network.GetInterfaceByName(t.IFace)
+	addr, ok := iface.PrimaryIPv4()
+	if !ok {
+		gw.Deps.Log.Debug().Msgf("Interface %s has no IPv4 address, skipping return path check", t.IFace)
+		return
+	}
+	src := addr.IP
+	dst := net.ParseIP(gateway.Ipaddr)
+
+	// A probe that leaves over the WAN says nothing about the return path over the mesh
+	if err := gw.checkMeshRoute(t, dst); err != nil {
+		gw.probes.Observe(gateway.Mac, gateway.Ipaddr, err)
+		return
+	}
+
+	err := gw.gatewayProber.Probe(ctx, src, dst)
+	if err == nil && gw.probeTarget != nil {
+		err = gw.targetProber.Probe(ctx, src, gw.probeTarget)
+	}
+
+	gw.probes.Observe(gateway.Mac, gateway.Ipaddr, err)
+}
+
+// checkMeshRoute returns an error if the kernel would not send traffic for dst over
+// the mesh. A route that cannot be looked up is not held against the gateway.
+func (gw *GatewayWorker) checkMeshRoute(t Tunables, dst net.IP) error {
+	ifaces, subnets := meshScope(t, gw.Config.addressing())
+	class, route, err := gw.classify(dst, ifaces, subnets)
+	if err != nil {
+		gw.Deps.Log.Debug().Err(err).Msgf("Could not classify the route to %s", dst)
+		return nil
+	}
+	if !class.ViaMesh() {
+		return fmt.Errorf("%s is %s, not reachable over the mesh (route %s)", dst, class, route)
+	}
+
+	return nil
+}
+
+// startProbeResponder starts the UDP probe responder on the mesh interface once, if
+// clients are configured to probe over UDP. It is retried on the next tick if the
+// interface is not ready yet.
+func (gw *GatewayWorker) startProbeResponder(ctx context.Context, t Tunables) {
+	if gw.responderUp || !gw.Config.GatewayProbeEnable || gw.Config.GatewayProbeProtocol != network.ProbeProtocolUDP {
+		return
+	}
+
+	responder, err := network.ListenProbeResponder(t.IFace, gw.Config.GatewayProbePort)
+	if err != nil {
+		gw.Deps.Log.Error().Err(err).Msg("Error starting gateway probe responder")
+		return
+	}
+
+	gw.responderUp = true
+	gw.Deps.Log.Info().Msgf("Gateway probe responder listening on %s %s", t.IFace, responder.Addr())
+
+	go func() {
+		if err := responder.Serve(ctx); err != nil {
+			gw.Deps.Log.Error().Err(err).Msg("Gateway probe responder stopped")
+		}
+	}()
 }
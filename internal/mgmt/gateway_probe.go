@@ -0,0 +1,262 @@
+package mgmt
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	proto "github.com/openmanet/openmanetd/internal/api/openmanet/v1"
+	batmanadv "github.com/openmanet/openmanetd/internal/batman-adv"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// gatewayProbeFailThreshold is the number of consecutive failed return-path
+	// checks after which a gateway is marked suspect.
+	gatewayProbeFailThreshold int = 2
+
+	// gatewaySuspectTTL is how long a gateway stays suspect before it is probed again.
+	gatewaySuspectTTL time.Duration = 5 * time.Minute
+
+	// gatewayReverifyInterval is how often a verified gateway is probed again.
+	gatewayReverifyInterval time.Duration = 5 * time.Minute
+
+	// gatewayHistorySize is the number of gateway events kept for inspection.
+	gatewayHistorySize int = 64
+)
+
+// GatewayProbeState is the return-path verification state of a gateway.
+type GatewayProbeState int
+
+const (
+	// GatewayUnverified gateways have not been probed since they were selected or
+	// since their suspect status expired.
+	GatewayUnverified GatewayProbeState = iota
+	// GatewayVerified gateways answered the last return-path check.
+	GatewayVerified
+	// GatewaySuspect gateways failed gatewayProbeFailThreshold checks in a row and
+	// are avoided when an alternative exists.
+	GatewaySuspect
+)
+
+func (s GatewayProbeState) String() string {
+	switch s {
+	case GatewayUnverified:
+		return "unverified"
+	case GatewayVerified:
+		return "verified"
+	case GatewaySuspect:
+		return "suspect"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText encodes the state by name.
+func (s GatewayProbeState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// GatewayEvent is an entry in the gateway failover history.
+type GatewayEvent struct {
+	Time   time.Time         `json:"time"`
+	Mac    string            `json:"mac"`
+	IP     string            `json:"ip"`
+	State  GatewayProbeState `json:"state"`
+	Detail string            `json:"detail,omitempty"`
+}
+
+type gatewayProbeEntry struct {
+	state     GatewayProbeState
+	failures  int
+	lastProbe time.Time
+}
+
+// GatewayProbeTracker runs the return-path state machine for each gateway, keyed by
+// the gateway's batman-adv originator MAC, and keeps a bounded history of state
+// changes.
+type GatewayProbeTracker struct {
+	log zerolog.Logger
+
+	mu      sync.Mutex
+	entries map[string]*gatewayProbeEntry
+	history []GatewayEvent
+
+	// now is overridable for tests.
+	now func() time.Time
+}
+
+// NewGatewayProbeTracker creates a tracker with every gateway unverified.
+func NewGatewayProbeTracker(log zerolog.Logger) *GatewayProbeTracker {
+	return &GatewayProbeTracker{
+		log:     log,
+		entries: make(map[string]*gatewayProbeEntry),
+		now:     time.Now,
+	}
+}
+
+// entry returns the entry for mac, expiring a stale suspect status. Callers must
+// hold t.mu.
+func (t *GatewayProbeTracker) entry(mac string) *gatewayProbeEntry {
+	e, ok := t.entries[mac]
+	if !ok {
+		e = &gatewayProbeEntry{}
+		t.entries[mac] = e
+	}
+
+	if e.state == GatewaySuspect && t.now().Sub(e.lastProbe) >= gatewaySuspectTTL {
+		e.state = GatewayUnverified
+		e.failures = 0
+		t.record(mac, "", GatewayUnverified, "suspect status expired")
+	}
+
+	return e
+}
+
+// State returns the current state of the gateway with the given MAC.
+func (t *GatewayProbeTracker) State(mac string) GatewayProbeState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.entry(mac).state
+}
+
+// IsSuspect reports whether the gateway with the given MAC is currently suspect.
+func (t *GatewayProbeTracker) IsSuspect(mac string) bool {
+	return t.State(mac) == GatewaySuspect
+}
+
+// NeedsProbe reports whether the return path through the gateway should be checked
+// now: unverified gateways are always probed, verified ones once the re-verify
+// interval has passed, and suspect ones not until their status expires.
+func (t *GatewayProbeTracker) NeedsProbe(mac string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	e := t.entry(mac)
+	switch e.state {
+	case GatewayUnverified:
+		return true
+	case GatewayVerified:
+		return t.now().Sub(e.lastProbe) >= gatewayReverifyInterval
+	default:
+		return false
+	}
+}
+
+// Observe records the result of a return-path check through the gateway and returns
+// its new state. A single failure only makes the gateway unverified so it is checked
+// again on the next tick; gatewayProbeFailThreshold failures in a row mark it suspect.
+func (t *GatewayProbeTracker) Observe(mac, ip string, err error) GatewayProbeState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	e := t.entry(mac)
+	e.lastProbe = t.now()
+	prev := e.state
+
+	if err == nil {
+		e.failures = 0
+		e.state = GatewayVerified
+		if prev != GatewayVerified {
+			t.record(mac, ip, GatewayVerified, "return path verified")
+		}
+		return e.state
+	}
+
+	e.failures++
+	if e.failures < gatewayProbeFailThreshold {
+		// Re-check on the next tick rather than waiting for the re-verify interval
+		e.state = GatewayUnverified
+		t.log.Debug().Err(err).Str("gateway", mac).Msgf("Return path check through %s failed (%d/%d)", ip, e.failures, gatewayProbeFailThreshold)
+		return e.state
+	}
+
+	e.state = GatewaySuspect
+	if prev != GatewaySuspect {
+		t.log.Warn().Err(err).Str("gateway", mac).Msgf("Gateway %s does not route back to us; marking suspect", ip)
+		t.record(mac, ip, GatewaySuspect, err.Error())
+	}
+
+	return e.state
+}
+
+// RecordSelection adds an entry to the history when the gateway with the given MAC
+// becomes the default route.
+func (t *GatewayProbeTracker) RecordSelection(mac, ip string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.record(mac, ip, t.entry(mac).state, "selected as default gateway")
+}
+
+// RecordRestore adds an entry to the history when the default route left by the
+// previous run is adopted for the gateway with the given MAC.
+func (t *GatewayProbeTracker) RecordRestore(mac, ip string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.record(mac, ip, t.entry(mac).state, "restored")
+}
+
+// History returns the recorded gateway events, oldest first.
+func (t *GatewayProbeTracker) History() []GatewayEvent {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]GatewayEvent(nil), t.history...)
+}
+
+// record appends an event to the history, dropping the oldest beyond
+// gatewayHistorySize. Callers must hold t.mu.
+func (t *GatewayProbeTracker) record(mac, ip string, state GatewayProbeState, detail string) {
+	t.history = append(t.history, GatewayEvent{
+		Time:   t.now(),
+		Mac:    mac,
+		IP:     ip,
+		State:  state,
+		Detail: detail,
+	})
+
+	if len(t.history) > gatewayHistorySize {
+		t.history = t.history[len(t.history)-gatewayHistorySize:]
+	}
+}
+
+// preferGateway chooses which advertised gateway to route through. Candidates are
+// the batman-adv gateways that have a matching alfred record with a valid IPv4
+// address and that are not withdrawing, ordered with batman-adv's best gateway first and the rest by throughput.
+// The first candidate that is not suspect is returned; if every candidate is suspect
+// the first is returned anyway, since a doubtful route beats none.
+//
+// Returns nil if no batman-adv gateway has a usable record.
+func preferGateway(batGwys batmanadv.Gateways, records map[string]*proto.Gateway, suspect func(mac string) bool) *proto.Gateway {
+	candidates := make(batmanadv.Gateways, 0, len(batGwys))
+	for _, gw := range batGwys {
+		rec, ok := records[gw.OrigAddress]
+		if !ok || rec.Withdrawing || net.ParseIP(rec.Ipaddr).To4() == nil {
+			continue
+		}
+		candidates = append(candidates, gw)
+	}
+
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Best != candidates[j].Best {
+			return candidates[i].Best
+		}
+		return candidates[i].Throughput > candidates[j].Throughput
+	})
+
+	for _, gw := range candidates {
+		if !suspect(gw.OrigAddress) {
+			return records[gw.OrigAddress]
+		}
+	}
+
+	return records[candidates[0].OrigAddress]
+}
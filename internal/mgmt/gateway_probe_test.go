@@ -0,0 +1,303 @@
+package mgmt
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	proto "github.com/openmanet/openmanetd/internal/api/openmanet/v1"
+	batmanadv "github.com/openmanet/openmanetd/internal/batman-adv"
+	"github.com/openmanet/openmanetd/internal/network"
+	"github.com/rs/zerolog"
+)
+
+// fakeProber answers probes from a scripted list of results, then repeats the last.
+type fakeProber struct {
+	results []error
+	calls   int
+}
+
+func (p *fakeProber) Probe(ctx context.Context, src, dst net.IP) error {
+	i := min(p.calls, len(p.results)-1)
+	p.calls++
+	return p.results[i]
+}
+
+var _ network.Prober = (*fakeProber)(nil)
+
+func newTestGatewayProbeTracker() (*GatewayProbeTracker, *fakeClock) {
+	clock := newFakeClock()
+	tracker := NewGatewayProbeTracker(zerolog.Nop())
+	tracker.now = clock.Now
+
+	return tracker, clock
+}
+
+// probeOnce runs one return-path check through the tracker if it asks for one.
+func probeOnce(tracker *GatewayProbeTracker, prober network.Prober, mac, ip string) bool {
+	if !tracker.NeedsProbe(mac) {
+		return false
+	}
+
+	err := prober.Probe(context.Background(), net.ParseIP("10.41.1.5"), net.ParseIP(ip))
+	tracker.Observe(mac, ip, err)
+
+	return true
+}
+
+func TestGatewayProbeTracker_StateMachine(t *testing.T) {
+	const mac, ip = "aa:bb:cc:dd:ee:01", "10.41.0.1"
+	unreachable := errors.New("probe timed out")
+
+	tests := []struct {
+		name    string
+		results []error
+		steps   int
+		want    GatewayProbeState
+	}{
+		{
+			name:    "replies verify the gateway",
+			results: []error{nil},
+			steps:   1,
+			want:    GatewayVerified,
+		},
+		{
+			name:    "single failure is tolerated",
+			results: []error{unreachable},
+			steps:   1,
+			want:    GatewayUnverified,
+		},
+		{
+			name:    "failure then success verifies",
+			results: []error{unreachable, nil},
+			steps:   2,
+			want:    GatewayVerified,
+		},
+		{
+			name:    "consecutive failures mark suspect",
+			results: []error{unreachable},
+			steps:   gatewayProbeFailThreshold,
+			want:    GatewaySuspect,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker, _ := newTestGatewayProbeTracker()
+			prober := &fakeProber{results: tt.results}
+
+			for i := 0; i < tt.steps; i++ {
+				if !probeOnce(tracker, prober, mac, ip) {
+					t.Fatalf("step %d: NeedsProbe() = false, want true", i)
+				}
+			}
+
+			if got := tracker.State(mac); got != tt.want {
+				t.Errorf("State() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGatewayProbeTracker_Reprobe(t *testing.T) {
+	const mac, ip = "aa:bb:cc:dd:ee:01", "10.41.0.1"
+	tracker, clock := newTestGatewayProbeTracker()
+
+	// Verified gateways are re-checked only after the re-verify interval
+	probeOnce(tracker, &fakeProber{results: []error{nil}}, mac, ip)
+	if tracker.NeedsProbe(mac) {
+		t.Error("NeedsProbe() = true right after verification")
+	}
+	clock.Advance(gatewayReverifyInterval)
+	if !tracker.NeedsProbe(mac) {
+		t.Error("NeedsProbe() = false after the re-verify interval")
+	}
+
+	// Suspect gateways are not probed until the suspect status expires
+	failing := &fakeProber{results: []error{errors.New("no reply")}}
+	for i := 0; i < gatewayProbeFailThreshold; i++ {
+		probeOnce(tracker, failing, mac, ip)
+	}
+	if !tracker.IsSuspect(mac) {
+		t.Fatalf("State() = %v, want suspect", tracker.State(mac))
+	}
+	if tracker.NeedsProbe(mac) {
+		t.Error("NeedsProbe() = true for a suspect gateway")
+	}
+
+	clock.Advance(gatewaySuspectTTL)
+	if tracker.IsSuspect(mac) {
+		t.Error("IsSuspect() = true after the suspect TTL")
+	}
+	if !tracker.NeedsProbe(mac) {
+		t.Error("NeedsProbe() = false after the suspect status expired")
+	}
+}
+
+func TestGatewayProbeTracker_History(t *testing.T) {
+	const mac, ip = "aa:bb:cc:dd:ee:01", "10.41.0.1"
+	tracker, clock := newTestGatewayProbeTracker()
+
+	tracker.RecordSelection(mac, ip)
+	failing := &fakeProber{results: []error{errors.New("no reply")}}
+	for i := 0; i < gatewayProbeFailThreshold; i++ {
+		probeOnce(tracker, failing, mac, ip)
+	}
+	clock.Advance(gatewaySuspectTTL)
+	probeOnce(tracker, &fakeProber{results: []error{nil}}, mac, ip)
+
+	want := []struct {
+		state  GatewayProbeState
+		detail string
+	}{
+		{GatewayUnverified, "selected as default gateway"},
+		{GatewaySuspect, "no reply"},
+		{GatewayUnverified, "suspect status expired"},
+		{GatewayVerified, "return path verified"},
+	}
+
+	history := tracker.History()
+	if len(history) != len(want) {
+		t.Fatalf("History() has %d events, want %d: %+v", len(history), len(want), history)
+	}
+	for i, w := range want {
+		if history[i].State != w.state || history[i].Detail != w.detail {
+			t.Errorf("History()[%d] = %v %q, want %v %q", i, history[i].State, history[i].Detail, w.state, w.detail)
+		}
+	}
+
+	// The history is bounded
+	for i := 0; i < gatewayHistorySize*2; i++ {
+		tracker.RecordSelection(mac, ip)
+	}
+	if got := len(tracker.History()); got != gatewayHistorySize {
+		t.Errorf("len(History()) = %d, want %d", got, gatewayHistorySize)
+	}
+}
+
+func TestPreferGateway(t *testing.T) {
+	batGwys := batmanadv.Gateways{
+		{OrigAddress: "aa:bb:cc:dd:ee:01", Throughput: 100},
+		{OrigAddress: "aa:bb:cc:dd:ee:02", Throughput: 500, Best: true},
+		{OrigAddress: "aa:bb:cc:dd:ee:03", Throughput: 300},
+		{OrigAddress: "aa:bb:cc:dd:ee:04", Throughput: 900},
+	}
+	records := map[string]*proto.Gateway{
+		"aa:bb:cc:dd:ee:01": {Mac: "aa:bb:cc:dd:ee:01", Ipaddr: "10.41.0.1"},
+		"aa:bb:cc:dd:ee:02": {Mac: "aa:bb:cc:dd:ee:02", Ipaddr: "10.41.0.2"},
+		"aa:bb:cc:dd:ee:03": {Mac: "aa:bb:cc:dd:ee:03", Ipaddr: "10.41.0.3"},
+		// Advertised without a usable address, so never selected
+		"aa:bb:cc:dd:ee:04": {Mac: "aa:bb:cc:dd:ee:04", Ipaddr: ""},
+	}
+
+	tests := []struct {
+		name    string
+		suspect []string
+		want    string
+	}{
+		{
+			name: "batman-adv best gateway",
+			want: "10.41.0.2",
+		},
+		{
+			name:    "best is suspect, next by throughput",
+			suspect: []string{"aa:bb:cc:dd:ee:02"},
+			want:    "10.41.0.3",
+		},
+		{
+			name:    "only the lowest throughput is trusted",
+			suspect: []string{"aa:bb:cc:dd:ee:02", "aa:bb:cc:dd:ee:03"},
+			want:    "10.41.0.1",
+		},
+		{
+			name:    "all suspect keeps the best",
+			suspect: []string{"aa:bb:cc:dd:ee:01", "aa:bb:cc:dd:ee:02", "aa:bb:cc:dd:ee:03"},
+			want:    "10.41.0.2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			suspect := make(map[string]bool)
+			for _, mac := range tt.suspect {
+				suspect[mac] = true
+			}
+
+			got := preferGateway(batGwys, records, func(mac string) bool { return suspect[mac] })
+			if got == nil {
+				t.Fatal("preferGateway() = nil")
+			}
+			if got.Ipaddr != tt.want {
+				t.Errorf("preferGateway() = %s, want %s", got.Ipaddr, tt.want)
+			}
+		})
+	}
+}
+
+func TestPreferGateway_NoMatch(t *testing.T) {
+	batGwys := batmanadv.Gateways{{OrigAddress: "aa:bb:cc:dd:ee:01", Best: true}}
+	records := map[string]*proto.Gateway{
+		"aa:bb:cc:dd:ee:09": {Mac: "aa:bb:cc:dd:ee:09", Ipaddr: "10.41.0.9"},
+	}
+
+	if got := preferGateway(batGwys, records, func(string) bool { return false }); got != nil {
+		t.Errorf("preferGateway() = %v, want nil", got)
+	}
+}
+
+func TestPreferGateway_Withdrawing(t *testing.T) {
+	batGwys := batmanadv.Gateways{
+		{OrigAddress: "aa:bb:cc:dd:ee:01", Throughput: 100},
+		{OrigAddress: "aa:bb:cc:dd:ee:02", Throughput: 500, Best: true},
+	}
+	records := map[string]*proto.Gateway{
+		"aa:bb:cc:dd:ee:01": {Mac: "aa:bb:cc:dd:ee:01", Ipaddr: "10.41.0.1"},
+		"aa:bb:cc:dd:ee:02": {Mac: "aa:bb:cc:dd:ee:02", Ipaddr: "10.41.0.2", Withdrawing: true},
+	}
+	trusted := func(string) bool { return false }
+
+	if got := preferGateway(batGwys, records, trusted); got == nil || got.Ipaddr != "10.41.0.1" {
+		t.Errorf("preferGateway() = %v, want 10.41.0.1 instead of the withdrawing best gateway", got)
+	}
+
+	// Unlike a suspect gateway, a withdrawing one is not kept as a last resort
+	records["aa:bb:cc:dd:ee:01"].Withdrawing = true
+	if got := preferGateway(batGwys, records, trusted); got != nil {
+		t.Errorf("preferGateway() = %v, want nil when every gateway is withdrawing", got)
+	}
+}
+
+func TestGatewayWorker_CheckMeshRoute(t *testing.T) {
+	tests := []struct {
+		name    string
+		class   network.DestClass
+		err     error
+		wantErr bool
+	}{
+		{"mesh local", network.MeshLocal, nil, false},
+		{"routed over the mesh", network.MeshRouted, nil, false},
+		{"routed over the WAN", network.WAN, nil, true},
+		{"unreachable", network.Unreachable, nil, true},
+		{"lookup failed", "", errors.New("netlink: permission denied"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotIfaces []string
+			gw := &GatewayWorker{Deps: Deps{Log: zerolog.Nop()}}
+			gw.classify = func(ip net.IP, ifaces []string, subnets []*net.IPNet) (network.DestClass, *network.Route, error) {
+				gotIfaces = ifaces
+				return tt.class, nil, tt.err
+			}
+
+			err := gw.checkMeshRoute(Tunables{IFace: "br-ahwlan", BatInterface: "bat0"}, net.ParseIP("10.41.0.1"))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkMeshRoute() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(gotIfaces) != 2 || gotIfaces[0] != "br-ahwlan" || gotIfaces[1] != "bat0" {
+				t.Errorf("classified against %v, want [br-ahwlan bat0]", gotIfaces)
+			}
+		})
+	}
+}
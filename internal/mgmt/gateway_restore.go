@@ -0,0 +1,130 @@
+package mgmt
+
+import (
+	"net"
+	"time"
+
+	proto "github.com/openmanet/openmanetd/internal/api/openmanet/v1"
+	"github.com/openmanet/openmanetd/internal/network"
+	"golang.org/x/sys/unix"
+)
+
+// GatewayDecision is the gateway the default route was last pointed at. It is
+// persisted so that after a restart the route left in the kernel can be adopted
+// rather than rebuilt.
+type GatewayDecision struct {
+	Mac       string    `json:"mac"`
+	IP        string    `json:"ip"`
+	Interface string    `json:"interface"`
+	Metric    int       `json:"metric"`
+	Applied   time.Time `json:"applied"`
+}
+
+// matches reports whether route is the default route installed for d.
+func (d *GatewayDecision) matches(route *network.Route) bool {
+	return route.Interface == d.Interface && route.Metric == d.Metric && route.Gateway.Equal(net.ParseIP(d.IP))
+}
+
+// saveDecision persists the selected gateway if it differs from the one persisted.
+func (gw *GatewayWorker) saveDecision(t Tunables, selected *proto.Gateway, now time.Time) {
+	decision := &GatewayDecision{
+		Mac:       selected.Mac,
+		IP:        selected.Ipaddr,
+		Interface: t.IFace,
+		Metric:    gatewayRouteMetric,
+		Applied:   now,
+	}
+
+	gw.state.Update(func(state *State) bool {
+		if prev := state.Gateway; prev != nil && prev.Mac == decision.Mac && prev.IP == decision.IP && prev.Interface == decision.Interface && prev.Metric == decision.Metric {
+			return false
+		}
+		state.Gateway = decision
+		return true
+	})
+}
+
+// restoreGateway adopts the default route left by the previous run if it still
+// points at the persisted gateway and batman-adv still lists that gateway, so that a
+// restart does not wait for alfred or churn the route. Otherwise the route is removed
+// and the persisted gateway forgotten, leaving the choice to the receive ticks. It
+// returns whether the route was adopted.
+func (gw *GatewayWorker) restoreGateway(t Tunables, now time.Time) bool {
+	var saved *GatewayDecision
+	gw.state.Read(func(state *State) {
+		if state.Gateway != nil {
+			decision := *state.Gateway
+			saved = &decision
+		}
+	})
+	if saved == nil {
+		return false
+	}
+
+	owned, err := gw.ownedDefaultRoute(t)
+	if err != nil {
+		gw.Deps.Log.Error().Err(err).Msg("Error listing routes to restore the gateway")
+		return false
+	}
+
+	reason := ""
+	switch {
+	case owned == nil:
+		reason = "no default route left by the previous run"
+	case saved.Interface != t.IFace || !saved.matches(owned):
+		reason = "default route differs from the persisted gateway"
+	default:
+		batGwys, err := gw.meshGateways(t.BatInterface)
+		if err != nil {
+			gw.Deps.Log.Error().Err(err).Msg("Error getting mesh gateways to restore the gateway")
+			return false
+		}
+		reason = "gateway no longer listed by batman-adv"
+		for _, batGw := range *batGwys {
+			if batGw.OrigAddress == saved.Mac {
+				reason = ""
+				break
+			}
+		}
+	}
+
+	if reason != "" {
+		gw.Deps.Log.Warn().Bool("audit", true).Str("gateway", saved.Mac).Str("ip", saved.IP).Str("reason", reason).Msg("Not restoring the persisted gateway")
+		if owned != nil {
+			if err := gw.routes.DeleteRoute(owned); err != nil {
+				gw.Deps.Log.Error().Err(err).Msgf("Error removing default route %s", owned)
+			}
+		}
+		gw.state.Update(func(state *State) bool {
+			state.Gateway = nil
+			return true
+		})
+		return false
+	}
+
+	gw.currentGateway = saved.Mac
+	gw.selectedAt = now
+	gw.selected.Store(&proto.Gateway{Mac: saved.Mac, Ipaddr: saved.IP})
+	gw.probes.RecordRestore(saved.Mac, saved.IP)
+	gw.manageDefaultRoute(owned)
+
+	gw.Deps.Log.Warn().Bool("audit", true).Str("gateway", saved.Mac).Str("ip", saved.IP).Time("applied", saved.Applied).Msg("Restored default route via the persisted gateway")
+	return true
+}
+
+// ownedDefaultRoute returns the IPv4 default route this node installed on the mesh
+// interface, or nil if there is none.
+func (gw *GatewayWorker) ownedDefaultRoute(t Tunables) (*network.Route, error) {
+	routes, err := gw.routes.GetRoutes(unix.RT_TABLE_MAIN)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, route := range routes {
+		if route.Protocol == network.RouteProtocolOpenMANET && route.Interface == t.IFace && isIPv4Default(route) {
+			return route, nil
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,200 @@
+package mgmt
+
+import (
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	proto "github.com/openmanet/openmanetd/internal/api/openmanet/v1"
+	batmanadv "github.com/openmanet/openmanetd/internal/batman-adv"
+	"github.com/openmanet/openmanetd/internal/network"
+	"github.com/rs/zerolog"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// restoreTest is a gateway worker after a restart, with the state left by the
+// previous run.
+type restoreTest struct {
+	gw     *GatewayWorker
+	kernel *fakeRouteTable
+	path   string
+}
+
+func newRestoreTest(t *testing.T, saved *GatewayDecision, batGwys batmanadv.Gateways, routes ...*network.Route) *restoreTest {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := (&State{Gateway: saved}).Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	kernel := newFakeRouteTable(routes...)
+	gw := &GatewayWorker{
+		Config: &ManagementConfig{Log: zerolog.Nop(), IFace: "br-ahwlan", BatInterface: "bat0"},
+		Deps:   Deps{Log: zerolog.Nop()},
+		probes: NewGatewayProbeTracker(zerolog.Nop()),
+		state:  OpenStateStore(path, zerolog.Nop()),
+		routes: kernel,
+		meshGateways: func(string) (*batmanadv.Gateways, error) {
+			if batGwys == nil {
+				return nil, errors.New("batctl not found")
+			}
+			return &batGwys, nil
+		},
+	}
+
+	return &restoreTest{gw: gw, kernel: kernel, path: path}
+}
+
+// persisted returns the gateway in the state file.
+func (rt *restoreTest) persisted(t *testing.T) *GatewayDecision {
+	t.Helper()
+
+	state, err := LoadState(rt.path)
+	if err != nil {
+		t.Fatalf("LoadState() error = %v", err)
+	}
+	return state.Gateway
+}
+
+func ownedDefaultRoute(gateway string) *network.Route {
+	_, dst, _ := net.ParseCIDR("0.0.0.0/0")
+	return &network.Route{
+		Destination: dst,
+		Gateway:     net.ParseIP(gateway),
+		Interface:   "br-ahwlan",
+		Metric:      gatewayRouteMetric,
+		Table:       unix.RT_TABLE_MAIN,
+		Scope:       netlink.SCOPE_UNIVERSE,
+		Protocol:    network.RouteProtocolOpenMANET,
+	}
+}
+
+var persistedGateway = &GatewayDecision{
+	Mac:       "aa:bb:cc:dd:ee:01",
+	IP:        "10.41.0.1",
+	Interface: "br-ahwlan",
+	Metric:    gatewayRouteMetric,
+	Applied:   time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+}
+
+func TestGatewayWorker_RestoreMatching(t *testing.T) {
+	route := ownedDefaultRoute("10.41.0.1")
+	rt := newRestoreTest(t, persistedGateway, batmanadv.Gateways{{OrigAddress: "aa:bb:cc:dd:ee:01"}}, route)
+	now := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	if !rt.gw.restoreGateway(rt.gw.tick(), now) {
+		t.Fatal("restoreGateway() = false, want the route adopted")
+	}
+
+	if rt.kernel.count(route) != 1 || rt.kernel.adds != 0 {
+		t.Errorf("routes = %v after %d adds, want the route left alone", rt.kernel.routes, rt.kernel.adds)
+	}
+	if rt.gw.currentGateway != "aa:bb:cc:dd:ee:01" || !rt.gw.selectedAt.Equal(now) {
+		t.Errorf("current gateway = %q selected at %v", rt.gw.currentGateway, rt.gw.selectedAt)
+	}
+	if selected := rt.gw.selected.Load(); selected == nil || selected.Ipaddr != "10.41.0.1" {
+		t.Errorf("selected = %v, want 10.41.0.1", selected)
+	}
+
+	history := rt.gw.probes.History()
+	if len(history) != 1 || history[0].Detail != "restored" || history[0].Mac != "aa:bb:cc:dd:ee:01" {
+		t.Errorf("History() = %+v, want one restored entry", history)
+	}
+
+	// Installing the adopted gateway again on the first tick leaves the route alone
+	if err := rt.gw.installDefaultRoute(rt.gw.tick(), net.ParseIP("10.41.0.1")); err != nil {
+		t.Fatalf("installDefaultRoute() error = %v", err)
+	}
+	if rt.kernel.adds != 0 {
+		t.Errorf("routes = %v, want the adopted route kept", rt.kernel.routes)
+	}
+}
+
+func TestGatewayWorker_RestoreStale(t *testing.T) {
+	tests := []struct {
+		name    string
+		batGwys batmanadv.Gateways
+		route   *network.Route
+	}{
+		{"gateway gone", batmanadv.Gateways{{OrigAddress: "aa:bb:cc:dd:ee:02"}}, ownedDefaultRoute("10.41.0.1")},
+		{"route via another gateway", batmanadv.Gateways{{OrigAddress: "aa:bb:cc:dd:ee:01"}}, ownedDefaultRoute("10.41.0.2")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := newRestoreTest(t, persistedGateway, tt.batGwys, tt.route)
+
+			if rt.gw.restoreGateway(rt.gw.tick(), time.Now()) {
+				t.Fatal("restoreGateway() = true, want the stale gateway not adopted")
+			}
+			if len(rt.kernel.routes) != 0 {
+				t.Errorf("routes = %v, want the stale route removed", rt.kernel.routes)
+			}
+			if rt.gw.currentGateway != "" || len(rt.gw.probes.History()) != 0 {
+				t.Errorf("current gateway = %q, history %v; want neither", rt.gw.currentGateway, rt.gw.probes.History())
+			}
+			if got := rt.persisted(t); got != nil {
+				t.Errorf("persisted gateway = %+v, want it forgotten", got)
+			}
+		})
+	}
+}
+
+func TestGatewayWorker_RestoreWithoutRoute(t *testing.T) {
+	wan := &network.Route{Gateway: net.ParseIP("192.168.1.1"), Interface: "wan", Table: unix.RT_TABLE_MAIN}
+	rt := newRestoreTest(t, persistedGateway, batmanadv.Gateways{{OrigAddress: "aa:bb:cc:dd:ee:01"}}, wan)
+
+	if rt.gw.restoreGateway(rt.gw.tick(), time.Now()) {
+		t.Fatal("restoreGateway() = true without a route to adopt")
+	}
+	if rt.kernel.count(wan) != 1 {
+		t.Error("a default route this node does not own was removed")
+	}
+}
+
+func TestGatewayWorker_RestoreNothingPersisted(t *testing.T) {
+	route := ownedDefaultRoute("10.41.0.1")
+	rt := newRestoreTest(t, nil, batmanadv.Gateways{{OrigAddress: "aa:bb:cc:dd:ee:01"}}, route)
+
+	if rt.gw.restoreGateway(rt.gw.tick(), time.Now()) {
+		t.Fatal("restoreGateway() = true with nothing persisted")
+	}
+	// The first tick decides what to do with the route
+	if rt.kernel.count(route) != 1 || rt.gw.currentGateway != "" {
+		t.Errorf("routes = %v, current gateway %q; want both untouched", rt.kernel.routes, rt.gw.currentGateway)
+	}
+}
+
+func TestGatewayWorker_RestoreBatctlFails(t *testing.T) {
+	route := ownedDefaultRoute("10.41.0.1")
+	rt := newRestoreTest(t, persistedGateway, nil, route)
+
+	if rt.gw.restoreGateway(rt.gw.tick(), time.Now()) {
+		t.Fatal("restoreGateway() = true without the batman-adv gateway list")
+	}
+	if rt.kernel.count(route) != 1 || rt.persisted(t) == nil {
+		t.Error("route or persisted gateway removed although batman-adv could not be read")
+	}
+}
+
+func TestGatewayWorker_SaveDecision(t *testing.T) {
+	rt := newRestoreTest(t, nil, nil)
+	selected := persistedGateway
+	now := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	rt.gw.saveDecision(rt.gw.tick(), &proto.Gateway{Mac: selected.Mac, Ipaddr: selected.IP}, now)
+	got := rt.persisted(t)
+	if got == nil || got.Mac != selected.Mac || got.IP != selected.IP || got.Interface != "br-ahwlan" || got.Metric != gatewayRouteMetric || !got.Applied.Equal(now) {
+		t.Fatalf("persisted gateway = %+v", got)
+	}
+
+	// The same gateway again keeps the time it was first applied
+	rt.gw.saveDecision(rt.gw.tick(), &proto.Gateway{Mac: selected.Mac, Ipaddr: selected.IP}, now.Add(time.Hour))
+	if got := rt.persisted(t); !got.Applied.Equal(now) {
+		t.Errorf("applied = %v, want %v", got.Applied, now)
+	}
+}
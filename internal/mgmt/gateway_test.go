@@ -0,0 +1,206 @@
+package mgmt
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	proto "github.com/openmanet/openmanetd/internal/api/openmanet/v1"
+	batmanadv "github.com/openmanet/openmanetd/internal/batman-adv"
+	"github.com/openmanet/openmanetd/internal/network"
+	"github.com/rs/zerolog"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+func TestGatewayWorker_InstallDefaultRoute(t *testing.T) {
+	_, defaultDst, _ := net.ParseCIDR("0.0.0.0/0")
+	route := func(gw, iface string, metric int, proto netlink.RouteProtocol) *network.Route {
+		return &network.Route{Destination: defaultDst, Gateway: net.ParseIP(gw), Interface: iface, Metric: metric, Table: unix.RT_TABLE_MAIN, Protocol: proto}
+	}
+
+	legacy := route("10.41.0.1", "br-ahwlan", 10, netlink.RouteProtocol(unix.RTPROT_BOOT))
+	ownedLow := route("10.41.0.2", "br-ahwlan", 10, network.RouteProtocolOpenMANET)
+	ownedHigh := route("10.41.0.3", "br-ahwlan", 20, network.RouteProtocolOpenMANET)
+	wan := route("192.168.1.1", "wan", 0, netlink.RouteProtocol(unix.RTPROT_BOOT))
+
+	kernel := newFakeRouteTable(legacy, ownedLow, ownedHigh, wan)
+	gw := &GatewayWorker{
+		Config: &ManagementConfig{Log: zerolog.Nop(), IFace: "br-ahwlan"},
+		routes: kernel,
+	}
+
+	selected := net.ParseIP("10.41.0.4")
+	if err := gw.installDefaultRoute(gw.tick(), selected); err != nil {
+		t.Fatalf("installDefaultRoute() error = %v", err)
+	}
+
+	want := &network.Route{Gateway: selected, Interface: "br-ahwlan", Metric: gatewayRouteMetric, Table: unix.RT_TABLE_MAIN}
+	for _, r := range []*network.Route{legacy, ownedLow, ownedHigh} {
+		if kernel.count(r) != 0 {
+			t.Errorf("%s was not removed", r)
+		}
+	}
+	if kernel.count(wan) != 1 {
+		t.Error("default route on another interface was removed")
+	}
+	if kernel.count(want) != 1 || len(kernel.routes) != 2 {
+		t.Errorf("routes = %v, want the wan route and the route via %s", kernel.routes, selected)
+	}
+
+	// Selecting the same gateway again changes nothing
+	adds := kernel.adds
+	if err := gw.installDefaultRoute(gw.tick(), selected); err != nil {
+		t.Fatalf("installDefaultRoute() error = %v", err)
+	}
+	if kernel.adds != adds || len(kernel.routes) != 2 {
+		t.Errorf("reinstalling the same gateway changed the routes: %v", kernel.routes)
+	}
+}
+
+func TestGatewayWorker_ManagedDefaultRoute(t *testing.T) {
+	kernel := newFakeRouteTable()
+	managed := newManagedRouteReconciler(kernel, zerolog.Nop())
+	gw := &GatewayWorker{
+		Config:  &ManagementConfig{Log: zerolog.Nop(), IFace: "br-ahwlan"},
+		routes:  kernel,
+		managed: managed,
+	}
+
+	first, second := net.ParseIP("10.41.0.4"), net.ParseIP("10.41.0.5")
+	viaFirst := &network.Route{Gateway: first, Interface: "br-ahwlan", Metric: gatewayRouteMetric, Table: unix.RT_TABLE_MAIN}
+	viaSecond := &network.Route{Gateway: second, Interface: "br-ahwlan", Metric: gatewayRouteMetric, Table: unix.RT_TABLE_MAIN}
+
+	if err := gw.installDefaultRoute(gw.tick(), first); err != nil {
+		t.Fatalf("installDefaultRoute() error = %v", err)
+	}
+
+	// Another process removes the route between ticks
+	if err := kernel.DeleteRoute(viaFirst); err != nil {
+		t.Fatal(err)
+	}
+	if err := managed.Reconcile(); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if kernel.count(viaFirst) != 1 {
+		t.Fatalf("routes = %v, want the default route put back", kernel.routes)
+	}
+
+	// The selection moves; the reconciler keeps the new route, not the old one
+	if err := gw.installDefaultRoute(gw.tick(), second); err != nil {
+		t.Fatalf("installDefaultRoute() error = %v", err)
+	}
+	if err := kernel.DeleteRoute(viaSecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := managed.Reconcile(); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if kernel.count(viaFirst) != 0 || kernel.count(viaSecond) != 1 {
+		t.Errorf("routes = %v, want only the route via %s", kernel.routes, second)
+	}
+	if got := managed.Stats().Corrections; got != 2 {
+		t.Errorf("Corrections = %d, want 2", got)
+	}
+}
+
+// gwModeRunner answers batctl mj with the gateway mode of a mesh interface.
+type gwModeRunner string
+
+func (r gwModeRunner) Run(args ...string) ([]byte, error) {
+	return []byte(`{"mesh_ifname": "bat0", "gw_mode": "` + string(r) + `"}`), nil
+}
+
+func TestGatewayWorker_ReleasesDefaultRoute(t *testing.T) {
+	tests := []struct {
+		name    string
+		gwMode  string
+		batGwys batmanadv.Gateways
+	}{
+		{"entering gateway mode", "server", nil},
+		{"no gateway in batman-adv", "client", nil},
+		{"no record for the batman-adv gateway", "client", batmanadv.Gateways{{OrigAddress: "aa:bb:cc:dd:ee:01", Best: true}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kernel := newFakeRouteTable()
+			managed := newManagedRouteReconciler(kernel, zerolog.Nop())
+			client, _ := newTestAlfredClient(t, time.Second, false)
+			gw := &GatewayWorker{
+				Config: &ManagementConfig{Log: zerolog.Nop(), IFace: "br-ahwlan", BatInterface: "bat0"},
+				Deps: Deps{
+					Log:          zerolog.Nop(),
+					Client:       client,
+					MeshConfig:   batmanadv.NewMeshConfigCacheWithRunner(gwModeRunner(tt.gwMode), time.Minute),
+					RecordLimits: NewRecordLimiter(RecordLimits{}, zerolog.Nop()),
+				},
+				probes:  NewGatewayProbeTracker(zerolog.Nop()),
+				records: NewRecordTracker(DefaultReservationTTL),
+				routes:  kernel,
+				managed: managed,
+				meshGateways: func(string) (*batmanadv.Gateways, error) {
+					return &tt.batGwys, nil
+				},
+			}
+
+			// The route via the gateway selected before
+			if err := gw.installDefaultRoute(gw.tick(), net.ParseIP("10.41.0.4")); err != nil {
+				t.Fatalf("installDefaultRoute() error = %v", err)
+			}
+			if len(kernel.routes) != 1 {
+				t.Fatalf("routes = %v, want the default route via the gateway", kernel.routes)
+			}
+
+			gw.receiveTick(context.Background())
+			if err := managed.Reconcile(); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+			if len(kernel.routes) != 0 || gw.managedRoute != nil {
+				t.Errorf("routes = %v, want the stale default route removed and not put back", kernel.routes)
+			}
+		})
+	}
+}
+
+func TestGatewayWorker_LostDefaultRoute(t *testing.T) {
+	_, defaultDst, _ := net.ParseCIDR("0.0.0.0/0")
+	_, defaultDst6, _ := net.ParseCIDR("::/0")
+	_, meshDst, _ := net.ParseCIDR("10.41.0.0/16")
+	deleted := func(dst *net.IPNet, gw string, table int, proto netlink.RouteProtocol) network.NetEvent {
+		return network.NetEvent{Type: network.EventRouteDeleted, Route: &network.Route{
+			Destination: dst, Gateway: net.ParseIP(gw), Interface: "br-ahwlan", Table: table, Protocol: proto,
+		}}
+	}
+	boot := netlink.RouteProtocol(unix.RTPROT_BOOT)
+
+	tests := []struct {
+		name     string
+		event    network.NetEvent
+		selected string
+		want     bool
+	}{
+		{"selected gateway", deleted(defaultDst, "10.41.0.1", unix.RT_TABLE_MAIN, network.RouteProtocolOpenMANET), "10.41.0.1", true},
+		{"nothing selected yet", deleted(nil, "10.41.0.1", unix.RT_TABLE_MAIN, network.RouteProtocolOpenMANET), "", true},
+		{"previous gateway", deleted(defaultDst, "10.41.0.2", unix.RT_TABLE_MAIN, network.RouteProtocolOpenMANET), "10.41.0.1", false},
+		{"not ours", deleted(defaultDst, "10.41.0.1", unix.RT_TABLE_MAIN, boot), "10.41.0.1", false},
+		{"other table", deleted(defaultDst, "10.41.0.1", 100, network.RouteProtocolOpenMANET), "10.41.0.1", false},
+		{"IPv6", deleted(defaultDst6, "fd00::1", unix.RT_TABLE_MAIN, network.RouteProtocolOpenMANET), "", false},
+		{"not a default route", deleted(meshDst, "10.41.0.1", unix.RT_TABLE_MAIN, network.RouteProtocolOpenMANET), "10.41.0.1", false},
+		{"added", network.NetEvent{Type: network.EventRouteAdded, Route: &network.Route{Gateway: net.ParseIP("10.41.0.1"), Table: unix.RT_TABLE_MAIN, Protocol: network.RouteProtocolOpenMANET}}, "10.41.0.1", false},
+		{"link down", network.NetEvent{Type: network.EventLinkDown, Link: "br-ahwlan"}, "10.41.0.1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := &GatewayWorker{}
+			if tt.selected != "" {
+				gw.selected.Store(&proto.Gateway{Ipaddr: tt.selected})
+			}
+			if got := gw.lostDefaultRoute(tt.event); got != tt.want {
+				t.Errorf("lostDefaultRoute() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
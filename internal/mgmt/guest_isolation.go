@@ -0,0 +1,99 @@
+package mgmt
+
+import (
+	"fmt"
+	"net"
+
+	batmanadv "github.com/openmanet/openmanetd/internal/batman-adv"
+	"github.com/openmanet/openmanetd/internal/network"
+	"github.com/rs/zerolog"
+)
+
+// GuestIsolationConfig is the desired isolation of a guest network across the mesh.
+// Traffic from the subnet of Section is marked by a firewall rule, and batman-adv
+// treats clients sending marked traffic as AP isolated, so guests cannot reach each
+// other through any node of the mesh.
+type GuestIsolationConfig struct {
+	Enable  bool
+	Section string
+	Mark    uint32
+	Mask    uint32
+}
+
+// guestSubnet returns the subnet of a network section in CIDR notation.
+func guestSubnet(cfg *network.UCINetwork) (string, error) {
+	addr := expectedAddress(cfg)
+	if addr == nil {
+		return "", fmt.Errorf("network has no static IPv4 address")
+	}
+
+	return (&net.IPNet{IP: addr.IP.Mask(addr.Mask), Mask: addr.Mask}).String(), nil
+}
+
+// applyGuestIsolation brings the batman-adv isolation mark and the firewall rule
+// marking guest traffic to the desired state. When disabled only the rule is
+// removed: without it no traffic carries the mark, so the isolation mark is left as
+// it is.
+//
+// Returns true if the firewall configuration changed and needs a reload.
+func applyGuestIsolation(gi GuestIsolationConfig, meshIface string, guest *network.UCINetwork, fw network.FirewallConfigReader, runner batmanadv.Runner, log zerolog.Logger) (bool, error) {
+	if gi.Section == "" {
+		return false, nil
+	}
+
+	if !gi.Enable {
+		removed, err := network.RemoveGuestMarkRuleWithReader(gi.Section, fw)
+		if removed {
+			log.Warn().Bool("audit", true).Str("network", gi.Section).Msg("Removed guest isolation firewall rule")
+		}
+		return removed, err
+	}
+
+	subnet, err := guestSubnet(guest)
+	if err != nil {
+		return false, fmt.Errorf("guest network %s: %w", gi.Section, err)
+	}
+
+	mark, mask, err := batmanadv.GetIsolationMarkWithRunner(runner, meshIface)
+	if err != nil {
+		return false, err
+	}
+	if mark != gi.Mark || mask != gi.Mask {
+		if err := batmanadv.SetIsolationMarkWithRunner(runner, meshIface, gi.Mark, gi.Mask); err != nil {
+			return false, err
+		}
+		log.Warn().Bool("audit", true).Str("iface", meshIface).Uint32("mark", gi.Mark).Uint32("mask", gi.Mask).Msg("Set batman-adv isolation mark")
+	}
+
+	changed, err := network.EnsureGuestMarkRuleWithReader(gi.Section, subnet, gi.Mark, gi.Mask, fw)
+	if err != nil {
+		return false, err
+	}
+	if changed {
+		log.Warn().Bool("audit", true).Str("network", gi.Section).Str("subnet", subnet).Msg("Updated guest isolation firewall rule")
+	}
+
+	return changed, nil
+}
+
+// ReconcileGuestIsolation applies the guest isolation configuration to the mesh
+// interface and the firewall, reloading the firewall if its rule changed.
+func ReconcileGuestIsolation(gi GuestIsolationConfig, meshIface string, log zerolog.Logger) error {
+	var guest *network.UCINetwork
+	if gi.Enable && gi.Section != "" {
+		var err error
+		if guest, err = network.GetUCINetworkByName(gi.Section); err != nil {
+			return fmt.Errorf("failed to read guest network %s: %w", gi.Section, err)
+		}
+	}
+
+	changed, err := applyGuestIsolation(gi, meshIface, guest, network.NewUCIFirewallConfigReader(), batmanadv.NewBatctlRunner(), log)
+	if err != nil {
+		return err
+	}
+	if !changed {
+		return nil
+	}
+
+	return network.ReloadFirewall()
+}
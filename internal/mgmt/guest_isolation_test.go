@@ -0,0 +1,95 @@
+package mgmt
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/openmanet/openmanetd/internal/network"
+	"github.com/rs/zerolog"
+)
+
+// fakeBatctl answers isolation_mark reads with the last value written.
+type fakeBatctl struct {
+	mark  string
+	calls []string
+}
+
+func (b *fakeBatctl) Run(args ...string) ([]byte, error) {
+	b.calls = append(b.calls, strings.Join(args, " "))
+	if len(args) == 4 && args[2] == "isolation_mark" {
+		b.mark = args[3]
+	}
+	return []byte(b.mark + "\n"), nil
+}
+
+var testGuestNetwork = &network.UCINetwork{Proto: "static", IPAddr: "10.42.0.1", NetMask: "255.255.255.0"}
+
+func TestApplyGuestIsolation(t *testing.T) {
+	gi := GuestIsolationConfig{Enable: true, Section: "guest", Mark: 0x10, Mask: 0xf0}
+	fw := newMockFirewallReader()
+	batctl := &fakeBatctl{mark: "0x00000000/0x00000000"}
+
+	changed, err := applyGuestIsolation(gi, "bat0", testGuestNetwork, fw, batctl, zerolog.Nop())
+	if err != nil || !changed {
+		t.Fatalf("applyGuestIsolation() = %v, %v; want true, nil", changed, err)
+	}
+
+	wantCalls := []string{"meshif bat0 isolation_mark", "meshif bat0 isolation_mark 0x00000010/0x000000f0"}
+	if !reflect.DeepEqual(batctl.calls, wantCalls) {
+		t.Errorf("batctl commands = %q, want %q", batctl.calls, wantCalls)
+	}
+	if got := fw.options["guest_mark_guest.src_ip"]; !reflect.DeepEqual(got, []string{"10.42.0.0/24"}) {
+		t.Errorf("src_ip = %v, want 10.42.0.0/24", got)
+	}
+	if got := fw.options["guest_mark_guest.set_mark"]; !reflect.DeepEqual(got, []string{"0x10/0xf0"}) {
+		t.Errorf("set_mark = %v, want 0x10/0xf0", got)
+	}
+
+	// A second pass finds everything in order and changes nothing
+	batctl.calls = nil
+	changed, err = applyGuestIsolation(gi, "bat0", testGuestNetwork, fw, batctl, zerolog.Nop())
+	if err != nil || changed || fw.commits != 1 {
+		t.Errorf("second applyGuestIsolation() = %v, %v with %d commits; want false, nil with 1", changed, err, fw.commits)
+	}
+	if want := []string{"meshif bat0 isolation_mark"}; !reflect.DeepEqual(batctl.calls, want) {
+		t.Errorf("second pass batctl commands = %q, want %q", batctl.calls, want)
+	}
+
+	// Disabling removes the rule, once
+	gi.Enable = false
+	if changed, err = applyGuestIsolation(gi, "bat0", nil, fw, batctl, zerolog.Nop()); err != nil || !changed {
+		t.Errorf("disabled applyGuestIsolation() = %v, %v; want true, nil", changed, err)
+	}
+	if _, ok := fw.options["guest_mark_guest.target"]; ok {
+		t.Error("guest mark rule still exists after disabling")
+	}
+	if changed, err = applyGuestIsolation(gi, "bat0", nil, fw, batctl, zerolog.Nop()); err != nil || changed {
+		t.Errorf("disabled again applyGuestIsolation() = %v, %v; want false, nil", changed, err)
+	}
+}
+
+func TestApplyGuestIsolation_Invalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		gi    GuestIsolationConfig
+		guest *network.UCINetwork
+	}{
+		{"mark outside mask", GuestIsolationConfig{Enable: true, Section: "guest", Mark: 0x11, Mask: 0xf0}, testGuestNetwork},
+		{"no static address", GuestIsolationConfig{Enable: true, Section: "guest", Mark: 0x10, Mask: 0xf0}, &network.UCINetwork{Proto: "dhcp"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fw := newMockFirewallReader()
+			batctl := &fakeBatctl{mark: "0x00000000/0x00000000"}
+
+			if _, err := applyGuestIsolation(tt.gi, "bat0", tt.guest, fw, batctl, zerolog.Nop()); err == nil {
+				t.Error("applyGuestIsolation() error = nil")
+			}
+			if fw.commits != 0 {
+				t.Errorf("applyGuestIsolation() committed %d times, want 0", fw.commits)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package mgmt
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// DefaultHostnameCheckInterval is how often the hostname is polled for changes.
+const DefaultHostnameCheckInterval time.Duration = time.Minute
+
+// placeholderHostnames are names a node carries before anyone has named it. Every
+// unconfigured node has them, so they are useless to peers.
+var placeholderHostnames = map[string]bool{
+	"":          true,
+	"openwrt":   true,
+	"(none)":    true,
+	"localhost": true,
+}
+
+// PublishedHostname returns the name to advertise for a node called hostname with
+// the given mesh MAC. Placeholder names are replaced with "node-" and the last three
+// bytes of the MAC so that peers can still tell unnamed nodes apart.
+func PublishedHostname(hostname, mac string) string {
+	hostname = strings.TrimSpace(hostname)
+	if !placeholderHostnames[strings.ToLower(hostname)] {
+		return hostname
+	}
+
+	hex := strings.ToLower(strings.NewReplacer(":", "", "-", "", ".", "").Replace(mac))
+	if hex == "" {
+		return "unknown"
+	}
+	if len(hex) > 6 {
+		hex = hex[len(hex)-6:]
+	}
+
+	return "node-" + hex
+}
+
+// HostnameWatcher polls the system hostname and tells subscribers when it changes,
+// so that a node renamed in the field republishes its records right away instead
+// of at the next send interval.
+type HostnameWatcher struct {
+	log  zerolog.Logger
+	read func() (string, error)
+
+	mu        sync.Mutex
+	current   string
+	listeners []func(old, new string)
+}
+
+// NewHostnameWatcher creates a watcher seeded with the current hostname.
+func NewHostnameWatcher(log zerolog.Logger) *HostnameWatcher {
+	return newHostnameWatcher(os.Hostname, log)
+}
+
+func newHostnameWatcher(read func() (string, error), log zerolog.Logger) *HostnameWatcher {
+	w := &HostnameWatcher{log: log, read: read}
+
+	current, err := read()
+	if err != nil {
+		log.Error().Err(err).Msg("Error getting hostname")
+	}
+	w.current = current
+
+	return w
+}
+
+// Current returns the hostname as of the last check.
+func (w *HostnameWatcher) Current() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.current
+}
+
+// OnChange registers fn to be called with the old and new hostname after a change.
+func (w *HostnameWatcher) OnChange(fn func(old, new string)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.listeners = append(w.listeners, fn)
+}
+
+// Check reads the hostname once and notifies the listeners if it changed. A failed
+// read keeps the previous name.
+//
+// Returns true if the hostname changed.
+func (w *HostnameWatcher) Check() bool {
+	hostname, err := w.read()
+	if err != nil {
+		w.log.Error().Err(err).Msg("Error getting hostname")
+		return false
+	}
+
+	w.mu.Lock()
+	old := w.current
+	if hostname == old {
+		w.mu.Unlock()
+		return false
+	}
+	w.current = hostname
+	listeners := append([]func(old, new string){}, w.listeners...)
+	w.mu.Unlock()
+
+	w.log.Info().Str("old", old).Str("new", hostname).Msg("Hostname changed, republishing records")
+
+	for _, fn := range listeners {
+		fn(old, hostname)
+	}
+
+	return true
+}
+
+// Run checks the hostname every interval until shutdown is closed or signalled.
+func (w *HostnameWatcher) Run(interval time.Duration, shutdown <-chan os.Signal) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-shutdown:
+			return
+		case <-ticker.C:
+			w.Check()
+		}
+	}
+}
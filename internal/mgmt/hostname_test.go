@@ -0,0 +1,115 @@
+package mgmt
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestPublishedHostname(t *testing.T) {
+	tests := []struct {
+		name     string
+		hostname string
+		mac      string
+		want     string
+	}{
+		{"named node", "radio-7", "aa:bb:cc:dd:ee:01", "radio-7"},
+		{"trims whitespace", " radio-7\n", "aa:bb:cc:dd:ee:01", "radio-7"},
+		{"empty", "", "aa:bb:cc:dd:ee:01", "node-ddee01"},
+		{"OpenWrt default", "OpenWrt", "AA:BB:CC:DD:EE:01", "node-ddee01"},
+		{"kernel placeholder", "(none)", "aa-bb-cc-dd-ee-01", "node-ddee01"},
+		{"localhost", "localhost", "aa:bb:cc:dd:ee:01", "node-ddee01"},
+		{"no MAC either", "OpenWrt", "", "unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PublishedHostname(tt.hostname, tt.mac); got != tt.want {
+				t.Errorf("PublishedHostname(%q, %q) = %q, want %q", tt.hostname, tt.mac, got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeHostname returns name or err on every read.
+type fakeHostname struct {
+	name string
+	err  error
+}
+
+func (f *fakeHostname) read() (string, error) { return f.name, f.err }
+
+func TestHostnameWatcher_Check(t *testing.T) {
+	src := &fakeHostname{name: "OpenWrt"}
+	w := newHostnameWatcher(src.read, zerolog.Nop())
+
+	type change struct{ old, new string }
+	var changes []change
+	w.OnChange(func(old, new string) { changes = append(changes, change{old, new}) })
+
+	if w.Check() {
+		t.Error("Check() reported a change without a rename")
+	}
+
+	src.name = "radio-7"
+	if !w.Check() {
+		t.Fatal("Check() missed the rename")
+	}
+	if w.Current() != "radio-7" {
+		t.Errorf("Current() = %q, want radio-7", w.Current())
+	}
+
+	// A failed read keeps the last known name and does not notify
+	src.err = errors.New("read failed")
+	if w.Check() {
+		t.Error("Check() reported a change on a failed read")
+	}
+	if w.Current() != "radio-7" {
+		t.Errorf("Current() = %q after a failed read, want radio-7", w.Current())
+	}
+
+	if len(changes) != 1 || changes[0] != (change{"OpenWrt", "radio-7"}) {
+		t.Errorf("listeners saw %+v, want one change OpenWrt -> radio-7", changes)
+	}
+}
+
+func TestHostnameWatcher_ForcesRepublish(t *testing.T) {
+	src := &fakeHostname{name: "OpenWrt"}
+	cfg := &ManagementConfig{Log: zerolog.Nop(), deps: Deps{Hostnames: newHostnameWatcher(src.read, zerolog.Nop())}}
+
+	gw := &GatewayWorker{Config: cfg, republish: make(chan struct{}, 1)}
+	ndw := &NodeDataWorker{Config: cfg, republish: make(chan struct{}, 1)}
+	arw := &AddressReservationWorker{Config: cfg, republish: make(chan struct{}, 1)}
+	cfg.deps.Hostnames.OnChange(func(_, _ string) { gw.Republish() })
+	cfg.deps.Hostnames.OnChange(func(_, _ string) { ndw.Republish() })
+	cfg.deps.Hostnames.OnChange(func(_, _ string) { arw.Republish() })
+
+	mac := "aa:bb:cc:dd:ee:01"
+	if got := cfg.deps.hostname(mac); got != "node-ddee01" {
+		t.Errorf("hostname() = %q before the rename, want the MAC fallback", got)
+	}
+
+	src.name = "radio-7"
+	cfg.deps.Hostnames.Check()
+	// Renaming twice before the workers run still queues a single pass each
+	src.name = "radio-8"
+	cfg.deps.Hostnames.Check()
+
+	for name, ch := range map[string]chan struct{}{"gateway": gw.republish, "node": ndw.republish, "reservation": arw.republish} {
+		select {
+		case <-ch:
+		default:
+			t.Errorf("%s worker was not asked to republish", name)
+		}
+		select {
+		case <-ch:
+			t.Errorf("%s worker was asked to republish more than once", name)
+		default:
+		}
+	}
+
+	if got := cfg.deps.hostname(mac); got != "radio-8" {
+		t.Errorf("hostname() = %q after the rename, want radio-8", got)
+	}
+}
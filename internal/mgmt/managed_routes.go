@@ -0,0 +1,317 @@
+package mgmt
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/openmanet/openmanetd/internal/network"
+	"github.com/rs/zerolog"
+)
+
+// DefaultManagedRouteInterval is how often a ManagedRouteReconciler checks its
+// routes when no route or link event brings the check forward.
+const DefaultManagedRouteInterval time.Duration = 30 * time.Second
+
+// ManagedRouteStats counts the work of a ManagedRouteReconciler since it was created.
+type ManagedRouteStats struct {
+	// Passes is the number of reconciliation passes run.
+	Passes uint64 `json:"passes"`
+	// Installed is the number of managed routes installed for the first time.
+	Installed uint64 `json:"installed"`
+	// Corrections is the number of managed routes reinstalled after something
+	// else removed them.
+	Corrections uint64 `json:"corrections"`
+	// Removed is the number of routes removed because they are no longer managed.
+	Removed uint64 `json:"removed"`
+	// Failures is the number of routes that could not be installed or removed.
+	Failures uint64 `json:"failures"`
+	// LastCorrection is when a managed route was last reinstalled; omitted before
+	// the first correction.
+	LastCorrection time.Time `json:"lastCorrection,omitzero"`
+}
+
+// ManagedRouteReconciler keeps sets of managed routes installed, e.g. the default
+// route via the mesh gateway, the routes to the mesh subnets and the configured
+// static routes, and puts them back when another process, netifd reloading an
+// interface or an administrator, removes them. Each set has an owner name, so the code that decides the routes of one set
+// replaces it without knowing the others.
+//
+// Routes it installs are tagged with network.RouteProtocolOpenMANET, and it only
+// ever removes routes it installed itself, so routes added by the kernel, netifd or
+// an administrator are left alone even when they overlap a managed route. The routes
+// it installed are persisted by owner, so that after a restart it also removes the
+// ones an owner no longer manages.
+type ManagedRouteReconciler struct {
+	log    zerolog.Logger
+	routes network.RouteTable
+	// subscribe and now are overridable for tests.
+	subscribe func(done <-chan struct{}) (<-chan network.NetEvent, error)
+	now       func() time.Time
+
+	mu   sync.Mutex
+	sets map[string][]*network.Route
+	// installed holds the routes this reconciler installed or adopted, so that a
+	// missing one counts as a correction and one no longer managed is removed.
+	installed []*network.Route
+	// restored holds the routes the previous run installed for owners that have not
+	// set their routes since; state persists them, or is nil.
+	restored map[string][]*network.Route
+	state    *StateStore
+	stats    ManagedRouteStats
+}
+
+// NewManagedRouteReconciler creates a reconciler with no managed routes that
+// persists the routes it installs in state. A nil state persists nothing.
+func NewManagedRouteReconciler(state *StateStore, log zerolog.Logger) *ManagedRouteReconciler {
+	r := newManagedRouteReconciler(network.KernelRouteTable{}, log)
+	r.restore(state)
+	return r
+}
+
+func newManagedRouteReconciler(routes network.RouteTable, log zerolog.Logger) *ManagedRouteReconciler {
+	return &ManagedRouteReconciler{
+		log:       log,
+		routes:    routes,
+		subscribe: network.Subscribe,
+		now:       time.Now,
+		sets:      make(map[string][]*network.Route),
+		restored:  make(map[string][]*network.Route),
+	}
+}
+
+// SetRoutes replaces the routes of the set owner and reconciles the routing tables
+// against every set. An empty list drops the set; routes only it managed are
+// removed, as are the routes owner had installed before a restart. Repeated
+// entries, within or across sets, are installed once.
+func (r *ManagedRouteReconciler) SetRoutes(owner string, routes []*network.Route) error {
+	if slices.Contains(routes, nil) {
+		return fmt.Errorf("managed routes of %s cannot be nil", owner)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.adoptRestored(owner)
+	if len(routes) == 0 {
+		delete(r.sets, owner)
+	} else {
+		set := make([]*network.Route, 0, len(routes))
+		for _, route := range routes {
+			tagged := *route
+			tagged.Protocol = network.RouteProtocolOpenMANET
+			set = append(set, &tagged)
+		}
+		r.sets[owner] = set
+	}
+
+	return r.reconcile()
+}
+
+// Reconcile installs managed routes that are missing and removes routes it
+// installed that are no longer managed. Routes that cannot be installed, for
+// example because their interface is down, are retried on the next call.
+func (r *ManagedRouteReconciler) Reconcile() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.reconcile()
+}
+
+// Stats returns the counts of the passes run so far.
+func (r *ManagedRouteReconciler) Stats() ManagedRouteStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.stats
+}
+
+// desired returns the routes of every set, each once, in owner order. Callers must
+// hold r.mu.
+func (r *ManagedRouteReconciler) desired() []*network.Route {
+	var desired []*network.Route
+	for _, owner := range slices.Sorted(maps.Keys(r.sets)) {
+		for _, route := range r.sets[owner] {
+			if !containsRoute(desired, route) {
+				desired = append(desired, route)
+			}
+		}
+	}
+	return desired
+}
+
+// reconcile does the work of Reconcile. Callers must hold r.mu.
+func (r *ManagedRouteReconciler) reconcile() error {
+	r.stats.Passes++
+	desired := r.desired()
+
+	var tables []int
+	for _, route := range slices.Concat(desired, r.installed) {
+		tables = append(tables, route.Table)
+	}
+	slices.Sort(tables)
+
+	current := make(map[int][]*network.Route)
+	var errs []error
+	for _, table := range slices.Compact(tables) {
+		routes, err := r.routes.GetRoutes(table)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("table %d: %w", table, err))
+			continue
+		}
+		current[table] = routes
+	}
+
+	installed := r.installed[:0]
+	for _, route := range r.installed {
+		routes, listed := current[route.Table]
+		if !listed || containsRoute(desired, route) {
+			installed = append(installed, route)
+			continue
+		}
+		if !containsOwnRoute(routes, route) {
+			continue
+		}
+
+		if err := r.routes.DeleteRoute(route); err != nil {
+			r.stats.Failures++
+			errs = append(errs, fmt.Errorf("remove %s: %w", route, err))
+			installed = append(installed, route)
+			continue
+		}
+		r.stats.Removed++
+		r.log.Info().Msgf("Removed managed route %s", route)
+	}
+	r.installed = installed
+
+	for _, route := range desired {
+		routes, listed := current[route.Table]
+		if !listed {
+			continue
+		}
+		wasInstalled := containsRoute(r.installed, route)
+
+		if i := slices.IndexFunc(routes, func(cur *network.Route) bool { return network.SameRoute(cur, route) }); i >= 0 {
+			// A route of ours left by an earlier run is adopted; an identical route
+			// that we do not own is left in place rather than duplicated.
+			if !wasInstalled && routes[i].Protocol == network.RouteProtocolOpenMANET {
+				r.installed = append(r.installed, route)
+			}
+			continue
+		}
+
+		if err := r.routes.AddRoute(route); err != nil {
+			r.stats.Failures++
+			errs = append(errs, fmt.Errorf("install %s: %w", route, err))
+			continue
+		}
+		if wasInstalled {
+			r.stats.Corrections++
+			r.stats.LastCorrection = r.now()
+			r.log.Warn().Msgf("Reinstalled managed route %s, it was removed", route)
+			continue
+		}
+		r.stats.Installed++
+		r.installed = append(r.installed, route)
+		r.log.Info().Msgf("Installed managed route %s", route)
+	}
+	r.save()
+
+	return errors.Join(errs...)
+}
+
+// affectedBy reports whether event may have taken away a managed route: the removal
+// of a route of ours in a table it manages, or an interface a managed route goes
+// out through coming up, since the kernel drops routes through an interface when it
+// goes down.
+func (r *ManagedRouteReconciler) affectedBy(event network.NetEvent) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	desired := r.desired()
+	switch event.Type {
+	case network.EventRouteDeleted:
+		if event.Route == nil || event.Route.Protocol != network.RouteProtocolOpenMANET {
+			return false
+		}
+		return slices.ContainsFunc(desired, func(route *network.Route) bool {
+			return route.Table == event.Route.Table
+		})
+	case network.EventLinkUp:
+		return slices.ContainsFunc(desired, func(route *network.Route) bool {
+			return route.Interface == event.Link
+		})
+	}
+
+	return false
+}
+
+// Run reconciles every interval, and right away when a route or link event may have
+// taken away a managed route, until shutdown is closed.
+func (r *ManagedRouteReconciler) Run(interval time.Duration, shutdown <-chan os.Signal) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	ctx, cancel := workerContext(shutdown)
+	defer cancel()
+
+	// The ticker stays the fallback; events only bring the next pass forward
+	events := r.watch(ctx.Done())
+
+	for {
+		select {
+		case <-shutdown:
+			return
+		case <-ticker.C:
+		case event, ok := <-events:
+			if !ok {
+				if ctx.Err() != nil {
+					return
+				}
+				// The kernel ended the subscription and events may have been lost
+				events = r.watch(ctx.Done())
+			} else if !r.affectedBy(event) {
+				continue
+			}
+		}
+
+		if err := r.Reconcile(); err != nil {
+			r.log.Error().Err(err).Msg("Failed to reconcile managed routes")
+		}
+	}
+}
+
+// watch subscribes to route and link changes until done is closed. Returns nil,
+// which never delivers, if the subscription cannot be opened.
+func (r *ManagedRouteReconciler) watch(done <-chan struct{}) <-chan network.NetEvent {
+	if r.subscribe == nil {
+		return nil
+	}
+
+	events, err := r.subscribe(done)
+	if err != nil {
+		r.log.Error().Err(err).Msg("Failed to watch routes; removed managed routes will only be restored on the next tick")
+		return nil
+	}
+
+	return events
+}
+
+// containsRoute reports whether routes holds a route equivalent to route.
+func containsRoute(routes []*network.Route, route *network.Route) bool {
+	return slices.ContainsFunc(routes, func(r *network.Route) bool {
+		return network.SameRoute(r, route)
+	})
+}
+
+// containsOwnRoute reports whether routes holds a route equivalent to route that is
+// tagged as ours.
+func containsOwnRoute(routes []*network.Route, route *network.Route) bool {
+	return slices.ContainsFunc(routes, func(r *network.Route) bool {
+		return r.Protocol == network.RouteProtocolOpenMANET && network.SameRoute(r, route)
+	})
+}
@@ -0,0 +1,146 @@
+package mgmt
+
+import (
+	"maps"
+	"net"
+	"slices"
+
+	"github.com/openmanet/openmanetd/internal/network"
+	"github.com/vishvananda/netlink"
+)
+
+// RouteRecord is a managed route as persisted in the state file.
+type RouteRecord struct {
+	Destination string `json:"destination"`
+	Gateway     string `json:"gateway,omitempty"`
+	Interface   string `json:"interface"`
+	Metric      int    `json:"metric"`
+	Table       int    `json:"table"`
+	Scope       int    `json:"scope,omitempty"`
+}
+
+// newRouteRecord returns the record persisted for route.
+func newRouteRecord(route *network.Route) RouteRecord {
+	record := RouteRecord{
+		Destination: route.Destination.String(),
+		Interface:   route.Interface,
+		Metric:      route.Metric,
+		Table:       route.Table,
+		Scope:       int(route.Scope),
+	}
+	if route.Gateway != nil {
+		record.Gateway = route.Gateway.String()
+	}
+	return record
+}
+
+// route returns the route tagged as ours that r describes, or nil if r cannot be
+// parsed.
+func (r RouteRecord) route() *network.Route {
+	_, dst, err := net.ParseCIDR(r.Destination)
+	if err != nil {
+		return nil
+	}
+
+	var gw net.IP
+	if r.Gateway != "" {
+		if gw = net.ParseIP(r.Gateway); gw == nil {
+			return nil
+		}
+	}
+
+	return &network.Route{
+		Destination: dst,
+		Gateway:     gw,
+		Interface:   r.Interface,
+		Metric:      r.Metric,
+		Table:       r.Table,
+		Scope:       netlink.Scope(r.Scope),
+		Protocol:    network.RouteProtocolOpenMANET,
+	}
+}
+
+// restore loads the routes the previous run installed from state and saves the
+// installed routes to it from now on. The routes of an owner are taken as installed
+// when the owner first sets its routes, so the ones it no longer manages are removed
+// then, while the routes of owners that have not started yet are left alone.
+func (r *ManagedRouteReconciler) restore(state *StateStore) {
+	r.state = state
+	if state == nil {
+		return
+	}
+
+	state.Read(func(s *State) {
+		for owner, records := range s.Routes {
+			for _, record := range records {
+				route := record.route()
+				if route == nil {
+					r.log.Warn().Str("owner", owner).Msgf("Ignoring invalid persisted route to %s", record.Destination)
+					continue
+				}
+				r.restored[owner] = append(r.restored[owner], route)
+			}
+		}
+	})
+}
+
+// adoptRestored takes the routes the previous run installed for owner as installed,
+// once. Callers must hold r.mu.
+func (r *ManagedRouteReconciler) adoptRestored(owner string) {
+	for _, route := range r.restored[owner] {
+		if !containsRoute(r.installed, route) {
+			r.installed = append(r.installed, route)
+		}
+	}
+	delete(r.restored, owner)
+}
+
+// save persists the installed routes by owner if they changed. A route that is no
+// longer in any set but could not be removed stays with the owner it was persisted
+// under, so the next run removes it. Callers must hold r.mu.
+func (r *ManagedRouteReconciler) save() {
+	if r.state == nil {
+		return
+	}
+
+	r.state.Update(func(s *State) bool {
+		routes := make(map[string][]RouteRecord)
+		for owner, restored := range r.restored {
+			for _, route := range restored {
+				routes[owner] = append(routes[owner], newRouteRecord(route))
+			}
+		}
+
+	installed:
+		for _, route := range r.installed {
+			record := newRouteRecord(route)
+			for _, owner := range slices.Sorted(maps.Keys(r.sets)) {
+				if containsRoute(r.sets[owner], route) {
+					routes[owner] = append(routes[owner], record)
+					continue installed
+				}
+			}
+			for _, owner := range slices.Sorted(maps.Keys(s.Routes)) {
+				if slices.ContainsFunc(s.Routes[owner], func(prev RouteRecord) bool { return sameRouteRecord(prev, route) }) {
+					routes[owner] = append(routes[owner], record)
+					continue installed
+				}
+			}
+		}
+
+		if maps.EqualFunc(routes, s.Routes, slices.Equal) {
+			return false
+		}
+		if len(routes) == 0 {
+			routes = nil
+		}
+		s.Routes = routes
+		return true
+	})
+}
+
+// sameRouteRecord reports whether record describes route.
+func sameRouteRecord(record RouteRecord, route *network.Route) bool {
+	prev := record.route()
+	return prev != nil && network.SameRoute(prev, route)
+}
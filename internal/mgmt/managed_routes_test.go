@@ -0,0 +1,583 @@
+package mgmt
+
+import (
+	"errors"
+	"maps"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/openmanet/openmanetd/internal/network"
+	"github.com/rs/zerolog"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// fakeRouteTable mimics the kernel routing tables: routes through a down interface
+// cannot be added and are flushed when the interface goes down.
+type fakeRouteTable struct {
+	routes []*network.Route
+	down   map[string]bool
+	adds   int
+}
+
+func newFakeRouteTable(routes ...*network.Route) *fakeRouteTable {
+	return &fakeRouteTable{routes: routes, down: make(map[string]bool)}
+}
+
+func (f *fakeRouteTable) GetRoutes(table int) ([]*network.Route, error) {
+	var routes []*network.Route
+	for _, r := range f.routes {
+		if r.Table == table {
+			routes = append(routes, r)
+		}
+	}
+	return routes, nil
+}
+
+func (f *fakeRouteTable) AddRoute(route *network.Route) error {
+	if f.down[route.Interface] {
+		return errors.New("network is down")
+	}
+	if containsRoute(f.routes, route) {
+		return errors.New("file exists")
+	}
+
+	f.adds++
+	f.routes = append(f.routes, route)
+	return nil
+}
+
+func (f *fakeRouteTable) DeleteRoute(route *network.Route) error {
+	for i, r := range f.routes {
+		if network.SameRoute(r, route) {
+			f.routes = append(f.routes[:i], f.routes[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("no such process")
+}
+
+func (f *fakeRouteTable) setDown(iface string) {
+	f.down[iface] = true
+
+	kept := f.routes[:0]
+	for _, r := range f.routes {
+		if r.Interface != iface {
+			kept = append(kept, r)
+		}
+	}
+	f.routes = kept
+}
+
+func (f *fakeRouteTable) count(route *network.Route) int {
+	n := 0
+	for _, r := range f.routes {
+		if network.SameRoute(r, route) {
+			n++
+		}
+	}
+	return n
+}
+
+func staticRoute(t *testing.T, dst, gw, iface string, table int) *network.Route {
+	t.Helper()
+
+	route, err := network.NewStaticRoute(dst, gw, iface, 10, table)
+	if err != nil {
+		t.Fatalf("NewStaticRoute() error = %v", err)
+	}
+	return route
+}
+
+func TestManagedRouteReconciler_Sets(t *testing.T) {
+	_, defaultDst, _ := net.ParseCIDR("0.0.0.0/0")
+	gateway := &network.Route{Destination: defaultDst, Gateway: net.ParseIP("10.41.0.1"), Interface: "br-ahwlan", Metric: 10, Table: unix.RT_TABLE_MAIN}
+	mesh := staticRoute(t, "10.42.0.0/16", "10.41.0.9", "br-ahwlan", 0)
+	lan := staticRoute(t, "192.168.50.0/24", "10.41.0.9", "br-ahwlan", 0)
+
+	// A route installed by someone else, in a table we manage
+	foreign := &network.Route{
+		Destination: defaultDst,
+		Gateway:     net.ParseIP("192.0.2.1"),
+		Interface:   "eth0",
+		Table:       unix.RT_TABLE_MAIN,
+		Protocol:    netlink.RouteProtocol(unix.RTPROT_BOOT),
+	}
+
+	kernel := newFakeRouteTable(foreign)
+	r := newManagedRouteReconciler(kernel, zerolog.Nop())
+
+	if err := r.SetRoutes("gateway", []*network.Route{gateway}); err != nil {
+		t.Fatalf("SetRoutes(gateway) error = %v", err)
+	}
+	if err := r.SetRoutes("mesh", []*network.Route{mesh, lan}); err != nil {
+		t.Fatalf("SetRoutes(mesh) error = %v", err)
+	}
+	for _, route := range []*network.Route{gateway, mesh, lan, foreign} {
+		if got := kernel.count(route); got != 1 {
+			t.Errorf("%s installed %d times, want 1", route, got)
+		}
+	}
+
+	// A route both sets manage stays while either does
+	if err := r.SetRoutes("gateway", []*network.Route{gateway, lan}); err != nil {
+		t.Fatalf("SetRoutes(gateway) error = %v", err)
+	}
+	if err := r.SetRoutes("mesh", []*network.Route{mesh}); err != nil {
+		t.Fatalf("SetRoutes(mesh) error = %v", err)
+	}
+	if kernel.count(lan) != 1 {
+		t.Errorf("%s removed while the gateway set still manages it", lan)
+	}
+
+	if err := r.SetRoutes("gateway", nil); err != nil {
+		t.Fatalf("SetRoutes(gateway) error = %v", err)
+	}
+	if kernel.count(gateway) != 0 || kernel.count(lan) != 0 || kernel.count(mesh) != 1 || kernel.count(foreign) != 1 {
+		t.Errorf("routes after dropping the gateway set = %v", kernel.routes)
+	}
+
+	want := ManagedRouteStats{Passes: 5, Installed: 3, Removed: 2}
+	if got := r.Stats(); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+}
+
+func TestManagedRouteReconciler_Corrections(t *testing.T) {
+	mesh := staticRoute(t, "10.42.0.0/16", "10.41.0.9", "br-ahwlan", 0)
+	kernel := newFakeRouteTable()
+	r := newManagedRouteReconciler(kernel, zerolog.Nop())
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return now }
+
+	if err := r.SetRoutes("mesh", []*network.Route{mesh}); err != nil {
+		t.Fatalf("SetRoutes() error = %v", err)
+	}
+	if err := r.Reconcile(); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if got := r.Stats(); got.Installed != 1 || got.Corrections != 0 {
+		t.Fatalf("Stats() = %+v, want one route installed and no corrections", got)
+	}
+
+	// Another process removes the route, then its interface is down for a pass
+	if err := kernel.DeleteRoute(mesh); err != nil {
+		t.Fatal(err)
+	}
+	kernel.down["br-ahwlan"] = true
+	if err := r.Reconcile(); err == nil {
+		t.Error("Reconcile() error = nil with a down interface")
+	}
+	delete(kernel.down, "br-ahwlan")
+	if err := r.Reconcile(); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	if kernel.count(mesh) != 1 {
+		t.Errorf("%s not reinstalled", mesh)
+	}
+	got := r.Stats()
+	if got.Installed != 1 || got.Corrections != 1 || got.Failures != 1 || !got.LastCorrection.Equal(now) {
+		t.Errorf("Stats() = %+v, want one correction at %s after one failure", got, now)
+	}
+}
+
+func TestManagedRouteReconciler_AdoptsAndLeavesForeign(t *testing.T) {
+	mesh := staticRoute(t, "10.42.0.0/16", "10.41.0.9", "br-ahwlan", 0)
+	lan := staticRoute(t, "192.168.50.0/24", "10.41.0.9", "br-ahwlan", 0)
+
+	// A tagged route left by the previous run and the same LAN route added by hand
+	manual := *lan
+	manual.Protocol = netlink.RouteProtocol(unix.RTPROT_STATIC)
+	kernel := newFakeRouteTable(mesh, &manual)
+	r := newManagedRouteReconciler(kernel, zerolog.Nop())
+
+	if err := r.SetRoutes("mesh", []*network.Route{mesh, lan}); err != nil {
+		t.Fatalf("SetRoutes() error = %v", err)
+	}
+	if kernel.adds != 0 {
+		t.Errorf("AddRoute called %d times, want 0", kernel.adds)
+	}
+
+	if err := r.SetRoutes("mesh", nil); err != nil {
+		t.Fatalf("SetRoutes() error = %v", err)
+	}
+	if kernel.count(mesh) != 0 {
+		t.Errorf("adopted route %s was not removed", mesh)
+	}
+	if kernel.count(lan) != 1 {
+		t.Error("manually added route was removed")
+	}
+}
+
+func TestManagedRouteReconciler_Run(t *testing.T) {
+	mesh := staticRoute(t, "10.42.0.0/16", "10.41.0.9", "br-ahwlan", 0)
+	kernel := newFakeRouteTable()
+	r := newManagedRouteReconciler(kernel, zerolog.Nop())
+
+	events := make(chan network.NetEvent)
+	subscribed := 0
+	r.subscribe = func(done <-chan struct{}) (<-chan network.NetEvent, error) {
+		subscribed++
+		if subscribed > 1 {
+			return nil, errors.New("socket closed")
+		}
+		return events, nil
+	}
+
+	if err := r.SetRoutes("mesh", []*network.Route{mesh}); err != nil {
+		t.Fatalf("SetRoutes() error = %v", err)
+	}
+	passes := r.Stats().Passes
+
+	done := make(chan os.Signal)
+	stopped := make(chan struct{})
+	go func() {
+		r.Run(time.Hour, done)
+		close(stopped)
+	}()
+
+	// Another process removes the route; the event brings the pass forward
+	removed := *mesh
+	if err := kernel.DeleteRoute(mesh); err != nil {
+		t.Fatal(err)
+	}
+	events <- network.NetEvent{Type: network.EventRouteDeleted, Route: &removed}
+
+	// Events that cannot affect a managed route do not trigger a pass. Run handles
+	// events in order, so each send also waits for the one before.
+	events <- network.NetEvent{Type: network.EventRouteDeleted, Route: &network.Route{Table: unix.RT_TABLE_MAIN}}
+	events <- network.NetEvent{Type: network.EventLinkUp, Link: "wlan0"}
+
+	// The kernel flushes the route when the interface goes down
+	kernel.setDown("br-ahwlan")
+	delete(kernel.down, "br-ahwlan")
+	events <- network.NetEvent{Type: network.EventLinkUp, Link: "br-ahwlan"}
+
+	// The subscription ends, which triggers a pass as events may have been lost
+	close(events)
+	close(done)
+	<-stopped
+
+	if kernel.count(mesh) != 1 {
+		t.Errorf("routes after removals = %v", kernel.routes)
+	}
+	got := r.Stats()
+	if got.Corrections != 2 {
+		t.Errorf("Corrections = %d, want 2", got.Corrections)
+	}
+	if got.Passes-passes > 3 {
+		t.Errorf("%d passes run, want at most 3", got.Passes-passes)
+	}
+}
+
+func TestManagedRouteReconciler_StaticConfigChanges(t *testing.T) {
+	lan := staticRoute(t, "192.168.50.0/24", "10.41.0.1", "br-ahwlan", 0)
+	vpn := staticRoute(t, "172.16.0.0/12", "10.41.0.2", "br-ahwlan", 100)
+	uplink := staticRoute(t, "10.99.0.0/16", "", "eth0", 0)
+
+	// A route installed by someone else, in a table we manage
+	_, defaultDst, _ := net.ParseCIDR("0.0.0.0/0")
+	foreign := &network.Route{
+		Destination: defaultDst,
+		Gateway:     net.ParseIP("10.41.0.1"),
+		Interface:   "br-ahwlan",
+		Table:       unix.RT_TABLE_MAIN,
+		Protocol:    netlink.RouteProtocol(unix.RTPROT_BOOT),
+	}
+
+	kernel := newFakeRouteTable(foreign)
+	r := newManagedRouteReconciler(kernel, zerolog.Nop())
+
+	steps := []struct {
+		name string
+		set  []*network.Route
+		want []*network.Route
+		gone []*network.Route
+	}{
+		{
+			name: "initial config",
+			set:  []*network.Route{lan, vpn},
+			want: []*network.Route{lan, vpn, foreign},
+		},
+		{
+			name: "route added",
+			set:  []*network.Route{lan, vpn, uplink},
+			want: []*network.Route{lan, vpn, uplink, foreign},
+		},
+		{
+			name: "routes removed, including the only one in a table",
+			set:  []*network.Route{uplink},
+			want: []*network.Route{uplink, foreign},
+			gone: []*network.Route{lan, vpn},
+		},
+		{
+			name: "all routes removed",
+			set:  nil,
+			want: []*network.Route{foreign},
+			gone: []*network.Route{uplink},
+		},
+	}
+
+	for _, step := range steps {
+		if err := r.SetRoutes(staticRouteOwner, step.set); err != nil {
+			t.Fatalf("%s: SetRoutes() error = %v", step.name, err)
+		}
+
+		for _, route := range step.want {
+			if got := kernel.count(route); got != 1 {
+				t.Errorf("%s: %s installed %d times, want 1", step.name, route, got)
+			}
+		}
+		for _, route := range step.gone {
+			if got := kernel.count(route); got != 0 {
+				t.Errorf("%s: %s still installed", step.name, route)
+			}
+		}
+	}
+}
+
+func TestManagedRouteReconciler_StaticNoDuplicates(t *testing.T) {
+	lan := staticRoute(t, "192.168.50.0/24", "10.41.0.1", "br-ahwlan", 0)
+	kernel := newFakeRouteTable()
+	r := newManagedRouteReconciler(kernel, zerolog.Nop())
+
+	if err := r.SetRoutes(staticRouteOwner, []*network.Route{lan}); err != nil {
+		t.Fatalf("SetRoutes() error = %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := r.Reconcile(); err != nil {
+			t.Fatalf("Reconcile() error = %v", err)
+		}
+	}
+
+	if kernel.adds != 1 {
+		t.Errorf("AddRoute called %d times, want 1", kernel.adds)
+	}
+}
+
+func TestManagedRouteReconciler_StaticLeavesForeignDuplicate(t *testing.T) {
+	lan := staticRoute(t, "192.168.50.0/24", "10.41.0.1", "br-ahwlan", 0)
+
+	// The administrator added the same route by hand
+	manual := *lan
+	manual.Protocol = netlink.RouteProtocol(unix.RTPROT_STATIC)
+	kernel := newFakeRouteTable(&manual)
+	r := newManagedRouteReconciler(kernel, zerolog.Nop())
+
+	if err := r.SetRoutes(staticRouteOwner, []*network.Route{lan}); err != nil {
+		t.Fatalf("SetRoutes() error = %v", err)
+	}
+	if kernel.adds != 0 {
+		t.Errorf("AddRoute called %d times, want 0", kernel.adds)
+	}
+
+	if err := r.SetRoutes(staticRouteOwner, nil); err != nil {
+		t.Fatalf("SetRoutes() error = %v", err)
+	}
+	if kernel.count(lan) != 1 {
+		t.Error("manually added route was removed")
+	}
+}
+
+func TestManagedRouteReconciler_LeavesReplacedRoute(t *testing.T) {
+	lan := staticRoute(t, "192.168.50.0/24", "10.41.0.1", "br-ahwlan", 0)
+	kernel := newFakeRouteTable()
+	r := newManagedRouteReconciler(kernel, zerolog.Nop())
+
+	if err := r.SetRoutes(staticRouteOwner, []*network.Route{lan}); err != nil {
+		t.Fatalf("SetRoutes() error = %v", err)
+	}
+
+	// The administrator replaces our route with an identical one of their own
+	manual := *lan
+	manual.Protocol = netlink.RouteProtocol(unix.RTPROT_STATIC)
+	kernel.routes = []*network.Route{&manual}
+
+	if err := r.SetRoutes(staticRouteOwner, nil); err != nil {
+		t.Fatalf("SetRoutes(nil) error = %v", err)
+	}
+	if kernel.count(lan) != 1 {
+		t.Error("manually added route was removed")
+	}
+}
+
+func TestManagedRouteReconciler_StaticLeavesOtherOwners(t *testing.T) {
+	_, defaultDst, _ := net.ParseCIDR("0.0.0.0/0")
+	lan := staticRoute(t, "192.168.50.0/24", "10.41.0.1", "br-ahwlan", 0)
+	vpn := staticRoute(t, "172.16.0.0/12", "10.41.0.2", "br-ahwlan", 0)
+	gateway := &network.Route{
+		Destination: defaultDst,
+		Gateway:     net.ParseIP("10.41.0.1"),
+		Interface:   "br-ahwlan",
+		Metric:      gatewayRouteMetric,
+		Table:       unix.RT_TABLE_MAIN,
+	}
+	mesh := staticRoute(t, "10.42.0.0/16", "10.41.0.9", "br-ahwlan", 0)
+
+	// A route left by an earlier run is adopted along with the configured routes
+	left := *vpn
+	left.Protocol = network.RouteProtocolOpenMANET
+	kernel := newFakeRouteTable(&left)
+	r := newManagedRouteReconciler(kernel, zerolog.Nop())
+
+	if err := r.SetRoutes(gatewayRouteOwner, []*network.Route{gateway}); err != nil {
+		t.Fatalf("SetRoutes(%s) error = %v", gatewayRouteOwner, err)
+	}
+	if err := r.SetRoutes(meshRouteOwner, []*network.Route{mesh}); err != nil {
+		t.Fatalf("SetRoutes(%s) error = %v", meshRouteOwner, err)
+	}
+
+	// The static config repeats the mesh route, which stays when it is dropped
+	if err := r.SetRoutes(staticRouteOwner, []*network.Route{lan, vpn, mesh}); err != nil {
+		t.Fatalf("SetRoutes() error = %v", err)
+	}
+	if err := r.SetRoutes(staticRouteOwner, nil); err != nil {
+		t.Fatalf("SetRoutes(nil) error = %v", err)
+	}
+	if err := r.Reconcile(); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	if kernel.count(gateway) != 1 || kernel.count(mesh) != 1 {
+		t.Errorf("routes of other owners removed, left %v", kernel.routes)
+	}
+	if kernel.count(lan) != 0 || kernel.count(vpn) != 0 {
+		t.Errorf("static routes not removed, left %v", kernel.routes)
+	}
+}
+
+func TestManagedRouteReconciler_StaticLinkFlap(t *testing.T) {
+	lan := staticRoute(t, "192.168.50.0/24", "10.41.0.1", "br-ahwlan", 0)
+	uplink := staticRoute(t, "10.99.0.0/16", "", "eth0", 0)
+
+	kernel := newFakeRouteTable()
+	kernel.down["eth0"] = true
+	r := newManagedRouteReconciler(kernel, zerolog.Nop())
+
+	events := make(chan network.NetEvent)
+	r.subscribe = func(done <-chan struct{}) (<-chan network.NetEvent, error) {
+		return events, nil
+	}
+
+	// eth0 is down at startup, so its route fails but the other is installed
+	if err := r.SetRoutes(staticRouteOwner, []*network.Route{lan, uplink}); err == nil {
+		t.Error("SetRoutes() error = nil with a down interface")
+	}
+	if kernel.count(lan) != 1 || kernel.count(uplink) != 0 {
+		t.Fatalf("routes after startup = %v", kernel.routes)
+	}
+
+	done := make(chan os.Signal)
+	stopped := make(chan struct{})
+	go func() {
+		r.Run(time.Hour, done)
+		close(stopped)
+	}()
+
+	delete(kernel.down, "eth0")
+	events <- network.NetEvent{Type: network.EventLinkUp, Link: "eth0"}
+
+	// Unrelated interfaces do not trigger a reconcile. Run handles events in order,
+	// so this send also waits for the eth0 reconcile to finish.
+	events <- network.NetEvent{Type: network.EventLinkUp, Link: "wlan0"}
+
+	// Flap br-ahwlan: the kernel flushes its route and it is restored on link up
+	kernel.setDown("br-ahwlan")
+	delete(kernel.down, "br-ahwlan")
+	events <- network.NetEvent{Type: network.EventLinkUp, Link: "br-ahwlan"}
+
+	// Wait for the br-ahwlan reconcile before stopping
+	events <- network.NetEvent{Type: network.EventLinkUp, Link: "wlan0"}
+	close(done)
+	<-stopped
+
+	if kernel.count(lan) != 1 || kernel.count(uplink) != 1 {
+		t.Errorf("routes after link flaps = %v", kernel.routes)
+	}
+	if kernel.adds != 3 {
+		t.Errorf("AddRoute called %d times, want 3", kernel.adds)
+	}
+}
+
+func TestManagedRouteReconciler_Restart(t *testing.T) {
+	lan := staticRoute(t, "192.168.50.0/24", "10.41.0.1", "br-ahwlan", 0)
+	vpn := staticRoute(t, "172.16.0.0/12", "10.41.0.2", "br-ahwlan", 100)
+	mesh := &network.Route{Destination: network.DefaultMeshAddressing().Subnet, Interface: "br-ahwlan", Table: unix.RT_TABLE_MAIN, Scope: netlink.SCOPE_LINK}
+	path := filepath.Join(t.TempDir(), "state.json")
+	kernel := newFakeRouteTable()
+
+	start := func() *ManagedRouteReconciler {
+		r := newManagedRouteReconciler(kernel, zerolog.Nop())
+		r.restore(OpenStateStore(path, zerolog.Nop()))
+		return r
+	}
+
+	r := start()
+	if err := r.SetRoutes(staticRouteOwner, []*network.Route{lan, vpn}); err != nil {
+		t.Fatalf("SetRoutes(%s) error = %v", staticRouteOwner, err)
+	}
+	if err := r.SetRoutes(meshRouteOwner, []*network.Route{mesh}); err != nil {
+		t.Fatalf("SetRoutes(%s) error = %v", meshRouteOwner, err)
+	}
+
+	// vpn is dropped from the config while openmanetd is down
+	r = start()
+	if err := r.SetRoutes(staticRouteOwner, []*network.Route{lan}); err != nil {
+		t.Fatalf("SetRoutes(%s) after restart error = %v", staticRouteOwner, err)
+	}
+	if kernel.count(vpn) != 0 || kernel.count(lan) != 1 {
+		t.Errorf("static routes after restart = %v, want only %s", kernel.routes, lan)
+	}
+	if kernel.count(mesh) != 1 {
+		t.Errorf("route %s of an owner that has not started yet was removed", mesh)
+	}
+
+	if err := r.SetRoutes(meshRouteOwner, []*network.Route{mesh}); err != nil {
+		t.Fatalf("SetRoutes(%s) after restart error = %v", meshRouteOwner, err)
+	}
+	if kernel.adds != 3 {
+		t.Errorf("AddRoute called %d times, want 3", kernel.adds)
+	}
+
+	// Every static route is dropped while the mesh owner has not started yet
+	r = start()
+	if err := r.SetRoutes(staticRouteOwner, nil); err != nil {
+		t.Fatalf("SetRoutes(%s, nil) after restart error = %v", staticRouteOwner, err)
+	}
+	if kernel.count(lan) != 0 || kernel.count(mesh) != 1 {
+		t.Errorf("routes after second restart = %v, want only %s", kernel.routes, mesh)
+	}
+
+	state, err := LoadState(path)
+	if err != nil {
+		t.Fatalf("LoadState() error = %v", err)
+	}
+	want := map[string][]RouteRecord{meshRouteOwner: {newRouteRecord(mesh)}}
+	if !maps.EqualFunc(state.Routes, want, slices.Equal) {
+		t.Errorf("persisted routes = %+v, want %+v", state.Routes, want)
+	}
+}
+
+func TestManagementConfig_MeshRoutes(t *testing.T) {
+	kernel := newFakeRouteTable()
+	m := &ManagementConfig{Log: zerolog.Nop(), managedRoutes: newManagedRouteReconciler(kernel, zerolog.Nop())}
+
+	m.updateMeshRoutes(Tunables{IFace: "br-ahwlan"})
+	old := &network.Route{Destination: network.DefaultMeshAddressing().Subnet, Interface: "br-ahwlan", Table: unix.RT_TABLE_MAIN}
+	if kernel.count(old) != 1 {
+		t.Fatalf("routes = %v, want the mesh subnet on br-ahwlan", kernel.routes)
+	}
+
+	// The mesh interface is renamed in the config
+	m.updateMeshRoutes(Tunables{IFace: "br-mesh"})
+	moved := *old
+	moved.Interface = "br-mesh"
+	if kernel.count(old) != 0 || kernel.count(&moved) != 1 {
+		t.Errorf("routes = %v, want the mesh subnet moved to br-mesh", kernel.routes)
+	}
+}
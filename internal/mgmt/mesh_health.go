@@ -0,0 +1,128 @@
+package mgmt
+
+import (
+	"sync"
+	"time"
+
+	batmanadv "github.com/openmanet/openmanetd/internal/batman-adv"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// DefaultMeshHealthRefresh is how long a mesh health summary is shared before the
+	// originator and neighbor tables are read again. It is half the receive tick
+	// interval, so every receive tick sees a fresh summary.
+	DefaultMeshHealthRefresh time.Duration = 5 * time.Second
+
+	// DefaultReservationClaimWait is how long an unconfigured node collects answers to
+	// its reservation request before it claims an address, so that it knows the
+	// addresses its peers hold.
+	DefaultReservationClaimWait time.Duration = 20 * time.Second
+
+	// DefaultGatewayHold is how long a newly selected gateway is kept before a better
+	// one may replace it, so that small throughput changes do not flap the route.
+	DefaultGatewayHold time.Duration = 2 * time.Minute
+	// SparseGatewayHold replaces DefaultGatewayHold on a sparse mesh, where there is
+	// rarely more than one candidate and a new one is worth switching to quickly.
+	SparseGatewayHold time.Duration = 20 * time.Second
+)
+
+// MeshHealthPolicy selects the behaviors that adapt to the mesh health.
+type MeshHealthPolicy struct {
+	// SkipClaimWaitWhenIsolated claims an address right away when no neighbor
+	// could answer the reservation request anyway.
+	SkipClaimWaitWhenIsolated bool
+	// ShortGatewayHoldWhenSparse holds the selected gateway for SparseGatewayHold
+	// rather than DefaultGatewayHold when the mesh is not healthy.
+	ShortGatewayHoldWhenSparse bool
+}
+
+// ClaimWait returns how long an unconfigured node waits before claiming an address.
+// A nil health, when the tables could not be read, waits the full time.
+func (p MeshHealthPolicy) ClaimWait(health *batmanadv.MeshHealth) time.Duration {
+	if p.SkipClaimWaitWhenIsolated && health != nil && health.State == batmanadv.MeshIsolated {
+		return 0
+	}
+
+	return DefaultReservationClaimWait
+}
+
+// GatewayHold returns how long the selected gateway is kept before a better one may
+// replace it. A nil health holds it for the full time.
+func (p MeshHealthPolicy) GatewayHold(health *batmanadv.MeshHealth) time.Duration {
+	if p.ShortGatewayHoldWhenSparse && health != nil && health.State != batmanadv.MeshHealthy {
+		return SparseGatewayHold
+	}
+
+	return DefaultGatewayHold
+}
+
+// MeshHealthMonitor shares the mesh health summary between the workers, so that one
+// pair of batctl runs per refresh interval serves all of them. Failed reads are not
+// cached. State changes are logged.
+type MeshHealthMonitor struct {
+	thresholds batmanadv.MeshHealthThresholds
+	refresh    time.Duration
+	log        zerolog.Logger
+
+	// read and now are overridable for tests.
+	read func(iface string, th batmanadv.MeshHealthThresholds) (*batmanadv.MeshHealth, error)
+	now  func() time.Time
+
+	mu      sync.Mutex
+	iface   string
+	last    *batmanadv.MeshHealth
+	fetched time.Time
+}
+
+// NewMeshHealthMonitor creates a monitor classifying the mesh with thresholds. Zero
+// thresholds are replaced by those of batmanadv.DefaultMeshHealthThresholds.
+func NewMeshHealthMonitor(thresholds batmanadv.MeshHealthThresholds, log zerolog.Logger) *MeshHealthMonitor {
+	if thresholds.LiveWithin <= 0 {
+		thresholds.LiveWithin = batmanadv.DefaultMeshHealthThresholds.LiveWithin
+	}
+	if thresholds.SparseNeighbors <= 0 {
+		thresholds.SparseNeighbors = batmanadv.DefaultMeshHealthThresholds.SparseNeighbors
+	}
+	if thresholds.SparseOriginators <= 0 {
+		thresholds.SparseOriginators = batmanadv.DefaultMeshHealthThresholds.SparseOriginators
+	}
+
+	return &MeshHealthMonitor{
+		thresholds: thresholds,
+		refresh:    DefaultMeshHealthRefresh,
+		log:        log,
+		read:       batmanadv.GetMeshHealth,
+		now:        time.Now,
+	}
+}
+
+// Get returns the mesh health of iface, reading the tables again if the summary is
+// older than the refresh interval. Each caller gets its own copy.
+func (m *MeshHealthMonitor) Get(iface string) (*batmanadv.MeshHealth, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.last != nil && m.iface == iface && m.now().Sub(m.fetched) < m.refresh {
+		health := *m.last
+		return &health, nil
+	}
+
+	health, err := m.read(iface, m.thresholds)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.last == nil || m.last.State != health.State {
+		m.log.Info().
+			Str("state", string(health.State)).
+			Int("neighbors", health.Neighbors).
+			Int("originators", health.Originators).
+			Msg("Mesh health changed")
+	}
+
+	m.iface, m.last, m.fetched = iface, health, m.now()
+
+	copied := *health
+	return &copied, nil
+}
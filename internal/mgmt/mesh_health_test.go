@@ -0,0 +1,206 @@
+package mgmt
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	proto "github.com/openmanet/openmanetd/internal/api/openmanet/v1"
+	batmanadv "github.com/openmanet/openmanetd/internal/batman-adv"
+	"github.com/rs/zerolog"
+)
+
+var (
+	isolatedMesh = &batmanadv.MeshHealth{State: batmanadv.MeshIsolated}
+	sparseMesh   = &batmanadv.MeshHealth{Neighbors: 1, Originators: 2, State: batmanadv.MeshSparse}
+	healthyMesh  = &batmanadv.MeshHealth{Neighbors: 4, Originators: 12, State: batmanadv.MeshHealthy}
+)
+
+func TestMeshHealthPolicy_ClaimWait(t *testing.T) {
+	adaptive := MeshHealthPolicy{SkipClaimWaitWhenIsolated: true}
+
+	tests := []struct {
+		name   string
+		policy MeshHealthPolicy
+		health *batmanadv.MeshHealth
+		want   time.Duration
+	}{
+		{"isolated skips the wait", adaptive, isolatedMesh, 0},
+		{"sparse waits", adaptive, sparseMesh, DefaultReservationClaimWait},
+		{"healthy waits", adaptive, healthyMesh, DefaultReservationClaimWait},
+		{"unknown health waits", adaptive, nil, DefaultReservationClaimWait},
+		{"disabled waits when isolated", MeshHealthPolicy{}, isolatedMesh, DefaultReservationClaimWait},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.ClaimWait(tt.health); got != tt.want {
+				t.Errorf("ClaimWait() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMeshHealthPolicy_GatewayHold(t *testing.T) {
+	adaptive := MeshHealthPolicy{ShortGatewayHoldWhenSparse: true}
+
+	tests := []struct {
+		name   string
+		policy MeshHealthPolicy
+		health *batmanadv.MeshHealth
+		want   time.Duration
+	}{
+		{"sparse holds briefly", adaptive, sparseMesh, SparseGatewayHold},
+		{"isolated holds briefly", adaptive, isolatedMesh, SparseGatewayHold},
+		{"healthy holds", adaptive, healthyMesh, DefaultGatewayHold},
+		{"unknown health holds", adaptive, nil, DefaultGatewayHold},
+		{"disabled holds when sparse", MeshHealthPolicy{}, sparseMesh, DefaultGatewayHold},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.GatewayHold(tt.health); got != tt.want {
+				t.Errorf("GatewayHold() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHoldGateway(t *testing.T) {
+	current := &proto.Gateway{Mac: "aa:bb:cc:dd:ee:01", Ipaddr: "10.41.0.1"}
+	preferred := &proto.Gateway{Mac: "aa:bb:cc:dd:ee:02", Ipaddr: "10.41.0.2"}
+	trusted := func(string) bool { return false }
+
+	tests := []struct {
+		name        string
+		current     *proto.Gateway
+		selectedFor time.Duration
+		hold        time.Duration
+		suspect     func(string) bool
+		want        *proto.Gateway
+	}{
+		{"held within the hold time", current, time.Minute, DefaultGatewayHold, trusted, current},
+		{"switches after the hold time", current, 3 * time.Minute, DefaultGatewayHold, trusted, preferred},
+		{"sparse hold switches sooner", current, time.Minute, SparseGatewayHold, trusted, preferred},
+		{"suspect is not held", current, time.Minute, DefaultGatewayHold, func(string) bool { return true }, preferred},
+		{"no current gateway", nil, 0, DefaultGatewayHold, trusted, preferred},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := holdGateway(preferred, tt.current, tt.selectedFor, tt.hold, tt.suspect); got != tt.want {
+				t.Errorf("holdGateway() = %s, want %s", got.GetMac(), tt.want.GetMac())
+			}
+		})
+	}
+}
+
+func TestCurrentGateway(t *testing.T) {
+	batGwys := batmanadv.Gateways{{OrigAddress: "aa:bb:cc:dd:ee:01"}}
+	records := map[string]*proto.Gateway{
+		"aa:bb:cc:dd:ee:01": {Mac: "aa:bb:cc:dd:ee:01", Ipaddr: "10.41.0.1"},
+		"aa:bb:cc:dd:ee:02": {Mac: "aa:bb:cc:dd:ee:02", Ipaddr: "10.41.0.2"},
+	}
+
+	if got := currentGateway(batGwys, records, "aa:bb:cc:dd:ee:01"); got == nil || got.Ipaddr != "10.41.0.1" {
+		t.Errorf("currentGateway() = %v, want 10.41.0.1", got)
+	}
+	// No longer a batman-adv gateway
+	if got := currentGateway(batGwys, records, "aa:bb:cc:dd:ee:02"); got != nil {
+		t.Errorf("currentGateway() = %v, want nil", got)
+	}
+	if got := currentGateway(batGwys, records, ""); got != nil {
+		t.Errorf("currentGateway() = %v, want nil", got)
+	}
+	// A withdrawing gateway is not held
+	records["aa:bb:cc:dd:ee:01"].Withdrawing = true
+	if got := currentGateway(batGwys, records, "aa:bb:cc:dd:ee:01"); got != nil {
+		t.Errorf("currentGateway() = %v, want nil for a withdrawing gateway", got)
+	}
+}
+
+// newTestMeshHealthMonitor returns a monitor that reports health and counts reads.
+func newTestMeshHealthMonitor(health *batmanadv.MeshHealth, reads *int) (*MeshHealthMonitor, *fakeClock) {
+	clock := newFakeClock()
+	monitor := NewMeshHealthMonitor(batmanadv.MeshHealthThresholds{}, zerolog.Nop())
+	monitor.now = clock.Now
+	monitor.read = func(string, batmanadv.MeshHealthThresholds) (*batmanadv.MeshHealth, error) {
+		*reads++
+		if health == nil {
+			return nil, errors.New("batctl not found")
+		}
+		copied := *health
+		return &copied, nil
+	}
+
+	return monitor, clock
+}
+
+func TestMeshHealthMonitor_Refresh(t *testing.T) {
+	var reads int
+	monitor, clock := newTestMeshHealthMonitor(sparseMesh, &reads)
+
+	for range 3 {
+		if health, err := monitor.Get("bat0"); err != nil || *health != *sparseMesh {
+			t.Fatalf("Get() = %v, %v; want %+v", health, err, *sparseMesh)
+		}
+	}
+	if reads != 1 {
+		t.Errorf("reads = %d within the refresh interval, want 1", reads)
+	}
+
+	clock.Advance(DefaultMeshHealthRefresh)
+	if _, err := monitor.Get("bat0"); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if reads != 2 {
+		t.Errorf("reads = %d after the refresh interval, want 2", reads)
+	}
+}
+
+func TestMeshHealthMonitor_ErrorNotCached(t *testing.T) {
+	var reads int
+	monitor, _ := newTestMeshHealthMonitor(nil, &reads)
+
+	for range 2 {
+		if _, err := monitor.Get("bat0"); err == nil {
+			t.Fatal("Get() error = nil, want an error")
+		}
+	}
+	if reads != 2 {
+		t.Errorf("reads = %d, want 2", reads)
+	}
+}
+
+func TestAddressReservationWorker_ClaimPending(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	policy := MeshHealthPolicy{SkipClaimWaitWhenIsolated: true}
+
+	tests := []struct {
+		name    string
+		health  *batmanadv.MeshHealth
+		elapsed time.Duration
+		want    bool
+	}{
+		{"isolated claims right away", isolatedMesh, 0, false},
+		{"healthy waits", healthyMesh, DefaultReservationClaimWait / 2, true},
+		{"healthy claims after the wait", healthyMesh, DefaultReservationClaimWait, false},
+		{"unreadable health waits", nil, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reads int
+			monitor, _ := newTestMeshHealthMonitor(tt.health, &reads)
+			arw := &AddressReservationWorker{
+				Config: &ManagementConfig{MeshHealthPolicy: policy},
+				Deps:   Deps{Log: zerolog.Nop(), MeshHealth: monitor},
+			}
+
+			arw.claimPending(Tunables{BatInterface: "bat0"}, start)
+			if got := arw.claimPending(Tunables{BatInterface: "bat0"}, start.Add(tt.elapsed)); got != tt.want {
+				t.Errorf("claimPending() after %v = %v, want %v", tt.elapsed, got, tt.want)
+			}
+		})
+	}
+}
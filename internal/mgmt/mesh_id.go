@@ -0,0 +1,143 @@
+package mgmt
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/openmanet/go-alfred"
+	proto "github.com/openmanet/openmanetd/internal/api/openmanet/v1"
+	"github.com/rs/zerolog"
+)
+
+// MeshFilter keeps records published by another mesh out of this node's decisions.
+//
+// Deployments that can hear each other's radios share alfred records, so every
+// record carries the publisher's mesh ID. A record whose ID differs from ours is
+// foreign: it is counted, logged once per source, and dropped in strict mode or
+// only flagged otherwise. Records published before the ID existed carry none and
+// are accepted as ours while AcceptLegacy is set.
+//
+// Filtering happens on the raw alfred records, before they are decoded for
+// reservation or gateway selection, so every consumer sees the same set.
+type MeshFilter struct {
+	ID           string
+	Strict       bool
+	AcceptLegacy bool
+
+	log     zerolog.Logger
+	foreign atomic.Uint64
+
+	mu     sync.Mutex
+	logged map[string]struct{}
+}
+
+// NewMeshFilter creates a filter for records of the mesh with the given ID.
+func NewMeshFilter(id string, strict, acceptLegacy bool, log zerolog.Logger) *MeshFilter {
+	return &MeshFilter{
+		ID:           id,
+		Strict:       strict,
+		AcceptLegacy: acceptLegacy,
+		log:          log,
+		logged:       make(map[string]struct{}),
+	}
+}
+
+// Matches reports whether a record carrying meshID belongs to this mesh.
+func (f *MeshFilter) Matches(meshID string) bool {
+	if meshID == "" {
+		return f.AcceptLegacy
+	}
+	return meshID == f.ID
+}
+
+// Foreign returns the number of foreign records seen since the filter was created.
+func (f *MeshFilter) Foreign() uint64 {
+	return f.foreign.Load()
+}
+
+// FilterReservations returns the address reservation records that belong to this mesh.
+func (f *MeshFilter) FilterReservations(records []alfred.Record) []alfred.Record {
+	return f.filter(records, "address reservation", func(data []byte) (string, string, error) {
+		var rec proto.AddressReservation
+		err := rec.UnmarshalVT(data)
+		return rec.Mac, rec.MeshId, err
+	})
+}
+
+// FilterGateways returns the gateway records that belong to this mesh.
+func (f *MeshFilter) FilterGateways(records []alfred.Record) []alfred.Record {
+	return f.filter(records, "gateway", func(data []byte) (string, string, error) {
+		var rec proto.Gateway
+		err := rec.UnmarshalVT(data)
+		return rec.Mac, rec.MeshId, err
+	})
+}
+
+// FilterNodes returns the node records that belong to this mesh.
+func (f *MeshFilter) FilterNodes(records []alfred.Record) []alfred.Record {
+	return f.filter(records, "node", func(data []byte) (string, string, error) {
+		var rec proto.Node
+		err := rec.UnmarshalVT(data)
+		return rec.Mac, rec.MeshId, err
+	})
+}
+
+// FilterServices returns the service announcement records that belong to this mesh.
+func (f *MeshFilter) FilterServices(records []alfred.Record) []alfred.Record {
+	return f.filter(records, "service", func(data []byte) (string, string, error) {
+		var rec proto.ServiceAnnouncements
+		err := rec.UnmarshalVT(data)
+		return rec.Mac, rec.MeshId, err
+	})
+}
+
+// FilterTopology returns the topology summary records that belong to this mesh.
+func (f *MeshFilter) FilterTopology(records []alfred.Record) []alfred.Record {
+	return f.filter(records, "topology", func(data []byte) (string, string, error) {
+		var rec proto.TopologySummary
+		err := rec.UnmarshalVT(data)
+		return rec.Mac, rec.MeshId, err
+	})
+}
+
+// filter drops or flags the foreign records. Records that fail to decode are kept so
+// that the decoder downstream reports them as before.
+func (f *MeshFilter) filter(records []alfred.Record, kind string, decode func([]byte) (source, meshID string, err error)) []alfred.Record {
+	kept := make([]alfred.Record, 0, len(records))
+
+	for _, rec := range records {
+		source, meshID, err := decode(rec.Data)
+		if err != nil || f.Matches(meshID) {
+			kept = append(kept, rec)
+			continue
+		}
+
+		f.foreign.Add(1)
+		f.logOnce(kind, source, meshID)
+
+		if !f.Strict {
+			kept = append(kept, rec)
+		}
+	}
+
+	return kept
+}
+
+func (f *MeshFilter) logOnce(kind, source, meshID string) {
+	key := kind + "/" + source
+
+	f.mu.Lock()
+	_, seen := f.logged[key]
+	f.logged[key] = struct{}{}
+	f.mu.Unlock()
+
+	if seen {
+		return
+	}
+
+	msg := "Ignoring records from another mesh"
+	if !f.Strict {
+		msg = "Using records from another mesh, meshIdStrict is off"
+	}
+	f.log.Warn().Str("kind", kind).Str("source", source).Str("meshId", meshID).Str("ourMeshId", f.ID).Msg(msg)
+}
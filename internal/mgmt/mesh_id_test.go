@@ -0,0 +1,122 @@
+package mgmt
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/openmanet/go-alfred"
+	proto "github.com/openmanet/openmanetd/internal/api/openmanet/v1"
+	"github.com/openmanet/openmanetd/internal/network"
+	"github.com/rs/zerolog"
+)
+
+func reservationAlfredRecord(t *testing.T, res *proto.AddressReservation) alfred.Record {
+	t.Helper()
+
+	data, err := res.MarshalVT()
+	if err != nil {
+		t.Fatalf("MarshalVT() error = %v", err)
+	}
+	return alfred.Record{Data: data}
+}
+
+// meshFilterModes are the filter settings the mixed-mesh tests run under, with the
+// sources each mode keeps from a set of one record per mesh ID: "ours", "theirs"
+// and "" (a legacy record).
+var meshFilterModes = []struct {
+	name         string
+	strict       bool
+	acceptLegacy bool
+	wantKept     []string
+	wantForeign  uint64
+}{
+	{"strict, accept legacy", true, true, []string{"ours", "legacy"}, 1},
+	{"strict, reject legacy", true, false, []string{"ours"}, 2},
+	{"flag only, accept legacy", false, true, []string{"ours", "theirs", "legacy"}, 1},
+	{"flag only, reject legacy", false, false, []string{"ours", "theirs", "legacy"}, 2},
+}
+
+func TestMeshFilter_Reservations(t *testing.T) {
+	records := []alfred.Record{
+		reservationAlfredRecord(t, &proto.AddressReservation{Mac: "ours", StaticIp: "10.41.1.1", UciDhcpStart: "200", UciDhcpLimit: "16", MeshId: "a"}),
+		reservationAlfredRecord(t, &proto.AddressReservation{Mac: "theirs", StaticIp: "10.41.1.2", UciDhcpStart: "100", UciDhcpLimit: "16", MeshId: "b"}),
+		reservationAlfredRecord(t, &proto.AddressReservation{Mac: "legacy", StaticIp: "10.41.1.3", UciDhcpStart: "300", UciDhcpLimit: "16"}),
+	}
+
+	for _, mode := range meshFilterModes {
+		t.Run(mode.name, func(t *testing.T) {
+			filter := NewMeshFilter("a", mode.strict, mode.acceptLegacy, zerolog.Nop())
+			kept := filter.FilterReservations(records)
+
+			tracker, _ := newTestRecordTracker()
+			decoded, err := tracker.DecodeReservationRecords(kept)
+			if err != nil {
+				t.Fatalf("DecodeReservationRecords() error = %v", err)
+			}
+
+			var got []string
+			for _, rec := range decoded {
+				got = append(got, rec.Source)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(mode.wantKept) {
+				t.Errorf("kept %v, want %v", got, mode.wantKept)
+			}
+			if filter.Foreign() != mode.wantForeign {
+				t.Errorf("Foreign() = %d, want %d", filter.Foreign(), mode.wantForeign)
+			}
+
+			// The foreign pool at offset 100 only blocks ours when it is kept
+			start, err := network.CalculateAvailableDHCPStart(kept, network.DefaultNetworkAddress, network.DefaultNetworkMask, network.DefaultDHCPAddressLimit)
+			if err != nil {
+				t.Fatalf("CalculateAvailableDHCPStart() error = %v", err)
+			}
+			if blocked := start != 100; blocked == mode.strict {
+				t.Errorf("DHCP start = %d with strict = %v", start, mode.strict)
+			}
+		})
+	}
+}
+
+func TestMeshFilter_Gateways(t *testing.T) {
+	gateway := func(mac, meshID string) alfred.Record {
+		data, err := (&proto.Gateway{Mac: mac, Ipaddr: "10.41.0.1", MeshId: meshID}).MarshalVT()
+		if err != nil {
+			t.Fatalf("MarshalVT() error = %v", err)
+		}
+		return alfred.Record{Data: data}
+	}
+	records := []alfred.Record{gateway("ours", "a"), gateway("theirs", "b"), gateway("legacy", "")}
+
+	for _, mode := range meshFilterModes {
+		t.Run(mode.name, func(t *testing.T) {
+			filter := NewMeshFilter("a", mode.strict, mode.acceptLegacy, zerolog.Nop())
+
+			tracker, _ := newTestRecordTracker()
+			decoded, err := tracker.DecodeGatewayRecords(filter.FilterGateways(records))
+			if err != nil {
+				t.Fatalf("DecodeGatewayRecords() error = %v", err)
+			}
+
+			gateways := freshestGateways(decoded)
+			for _, mac := range []string{"ours", "theirs", "legacy"} {
+				_, got := gateways[mac]
+				want := false
+				for _, kept := range mode.wantKept {
+					want = want || kept == mac
+				}
+				if got != want {
+					t.Errorf("gateway %s selectable = %v, want %v", mac, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestMeshFilter_KeepsUndecodable(t *testing.T) {
+	filter := NewMeshFilter("a", true, false, zerolog.Nop())
+	records := []alfred.Record{{Data: []byte{0xff, 0xff}}}
+
+	if kept := filter.FilterReservations(records); len(kept) != 1 {
+		t.Errorf("kept %d records, want the undecodable one passed on to the decoder", len(kept))
+	}
+}
@@ -1,13 +1,22 @@
 package mgmt
 
 import (
+	"context"
 	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/openmanet/go-alfred"
+	"github.com/digineo/go-uci/v2"
+	proto "github.com/openmanet/openmanetd/internal/api/openmanet/v1"
+	batmanadv "github.com/openmanet/openmanetd/internal/batman-adv"
 	"github.com/openmanet/openmanetd/internal/network"
+	"github.com/openmanet/openmanetd/internal/safemode"
 	"github.com/openmanet/openmanetd/internal/util/board"
 	"github.com/rs/zerolog"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
 )
 
 const (
@@ -18,6 +27,10 @@ const (
 
 	addressReservationWorkerSendInterval time.Duration = 4 * time.Second
 	addressReservationWorkerRecvInterval time.Duration = 10 * time.Second
+
+	// DefaultShutdownTimeout bounds the final alfred publications on shutdown. It
+	// stays below procd's default kill timeout of five seconds.
+	DefaultShutdownTimeout time.Duration = 3 * time.Second
 )
 
 type ManagementConfig struct {
@@ -32,6 +45,50 @@ type ManagementConfig struct {
 	PositionDataType           bool
 	AddressReservationDataType bool
 	InteruptChan               chan os.Signal
+	CapacityWarnPct            float64
+	CapacityCriticalPct        float64
+	AlfredCallTimeout          time.Duration
+	PinnedIP                   string
+	FallbackOnPinConflict      string
+	IPAllocationStrategy       string
+	GatewayProbeEnable         bool
+	GatewayProbeProtocol       string
+	GatewayProbePort           int
+	GatewayProbeTarget         string
+	GatewayProbeTimeout        time.Duration
+	StaticRoutes               []*network.Route
+	AddressCheckEvery          int
+	AddressMissThreshold       int
+	AddressReprovision         bool
+	PoolAutosizeEnable         bool
+	PoolGrowAt                 float64
+	PoolQuietPeriod            time.Duration
+	PoolFloor                  int
+	PoolCeiling                int
+	StatePath                  string
+	DHCPLeasesPath             string
+	MeshID                     string
+	MeshIDStrict               bool
+	MeshIDAcceptLegacy         bool
+	MaxRecordsPerTick          int
+	AutoZone                   string
+	DnsmasqInstance            string
+	OpenServices               bool
+	GatewayMasquerade          bool
+	UplinkZone                 string
+	MeshConfigCacheTTL         time.Duration
+	ServiceDataType            bool
+	LocalServices              []*proto.ServiceAnnouncement
+	PublishServiceDNS          bool
+	MeshHealthThresholds       batmanadv.MeshHealthThresholds
+	MeshHealthPolicy           MeshHealthPolicy
+	BootstrapGracePeriod       time.Duration
+	IPAllocationMode           string
+	DelegationFallbackTimeout  time.Duration
+	TopologyPublish            bool
+	// MeshAddressing is the IPv4 subnet addresses are reserved from; the zero value
+	// is network.DefaultMeshAddressing.
+	MeshAddressing network.MeshAddressing
 
 	gatewayWorkerSendInterval time.Duration
 	gatewayWorkerRecvInterval time.Duration
@@ -39,11 +96,27 @@ type ManagementConfig struct {
 	addressReservationWorkerSendInterval time.Duration
 	addressReservationWorkerRecvInterval time.Duration
 
-	uciOpenMANETConfig *network.UCIOpenMANETConfigReader
-	uciDHCPConfig      *network.UCIDHCPConfigReader
-	uciNetworkConfig   *network.UCINetworkConfigReader
+	// deps are shared by the workers; the alfred client is added in Start.
+	deps Deps
+
+	// tunables replaces IFace, BatInterface and the reservation policies once
+	// UpdateTunables has been called. Nil unless created by NewManager.
+	tunables *atomic.Pointer[Tunables]
+
+	// managedRoutes keeps the routes workers hand it installed.
+	managedRoutes *ManagedRouteReconciler
+
+	// stop is closed by Shutdown to stop the workers, once. Both are nil unless
+	// created by NewManager.
+	stop     chan os.Signal
+	stopOnce *sync.Once
 
-	boardConfigInfo *board.Board
+	// The running workers, for status queries. Nil if the worker is disabled.
+	addressReservationWorker *AddressReservationWorker
+	nodeDataWorker           *NodeDataWorker
+	gatewayWorker            *GatewayWorker
+	serviceWorker            *ServiceWorker
+	topologyWorker           *TopologyWorker
 }
 
 func NewManager(cfg ManagementConfig) *ManagementConfig {
@@ -53,6 +126,8 @@ func NewManager(cfg ManagementConfig) *ManagementConfig {
 		cfg.Log.Error().Err(err).Msg("Failed to load board configuration")
 	}
 
+	state := OpenStateStore(cfg.StatePath, cfg.Log)
+
 	return &ManagementConfig{
 		Log:                        cfg.Log,
 		AlfredMode:                 cfg.AlfredMode,
@@ -65,46 +140,263 @@ func NewManager(cfg ManagementConfig) *ManagementConfig {
 		AddressReservationDataType: cfg.AddressReservationDataType,
 		InteruptChan:               cfg.InteruptChan,
 		GatewayMode:                cfg.GatewayMode,
+		CapacityWarnPct:            cfg.CapacityWarnPct,
+		CapacityCriticalPct:        cfg.CapacityCriticalPct,
+		AlfredCallTimeout:          cfg.AlfredCallTimeout,
+		PinnedIP:                   cfg.PinnedIP,
+		FallbackOnPinConflict:      cfg.FallbackOnPinConflict,
+		IPAllocationStrategy:       cfg.IPAllocationStrategy,
+		GatewayProbeEnable:         cfg.GatewayProbeEnable,
+		GatewayProbeProtocol:       cfg.GatewayProbeProtocol,
+		GatewayProbePort:           cfg.GatewayProbePort,
+		GatewayProbeTarget:         cfg.GatewayProbeTarget,
+		GatewayProbeTimeout:        cfg.GatewayProbeTimeout,
+		StaticRoutes:               cfg.StaticRoutes,
+		AddressCheckEvery:          cfg.AddressCheckEvery,
+		AddressMissThreshold:       cfg.AddressMissThreshold,
+		AddressReprovision:         cfg.AddressReprovision,
+		PoolAutosizeEnable:         cfg.PoolAutosizeEnable,
+		PoolGrowAt:                 cfg.PoolGrowAt,
+		PoolQuietPeriod:            cfg.PoolQuietPeriod,
+		PoolFloor:                  cfg.PoolFloor,
+		PoolCeiling:                cfg.PoolCeiling,
+		StatePath:                  cfg.StatePath,
+		DHCPLeasesPath:             cfg.DHCPLeasesPath,
+		MeshID:                     cfg.MeshID,
+		MeshIDStrict:               cfg.MeshIDStrict,
+		MeshIDAcceptLegacy:         cfg.MeshIDAcceptLegacy,
+		MaxRecordsPerTick:          cfg.MaxRecordsPerTick,
+		AutoZone:                   cfg.AutoZone,
+		DnsmasqInstance:            cfg.DnsmasqInstance,
+		OpenServices:               cfg.OpenServices,
+		GatewayMasquerade:          cfg.GatewayMasquerade,
+		UplinkZone:                 cfg.UplinkZone,
+		MeshConfigCacheTTL:         cfg.MeshConfigCacheTTL,
+		ServiceDataType:            cfg.ServiceDataType,
+		LocalServices:              cfg.LocalServices,
+		PublishServiceDNS:          cfg.PublishServiceDNS,
+		MeshHealthThresholds:       cfg.MeshHealthThresholds,
+		MeshHealthPolicy:           cfg.MeshHealthPolicy,
+		BootstrapGracePeriod:       cfg.BootstrapGracePeriod,
+		IPAllocationMode:           cfg.IPAllocationMode,
+		DelegationFallbackTimeout:  cfg.DelegationFallbackTimeout,
+		TopologyPublish:            cfg.TopologyPublish,
+		MeshAddressing:             cfg.MeshAddressing,
 
 		gatewayWorkerSendInterval:            gatewayDataWorkerSendInterval,
 		gatewayWorkerRecvInterval:            gatewayDataWorkerRecvInterval,
 		addressReservationWorkerSendInterval: addressReservationWorkerSendInterval,
 		addressReservationWorkerRecvInterval: addressReservationWorkerRecvInterval,
 
-		uciOpenMANETConfig: network.NewUCIOpenMANETConfigReader(),
-		uciDHCPConfig:      network.NewUCIDHCPConfigReader(),
-		uciNetworkConfig:   network.NewUCINetworkConfigReader(),
+		tunables: new(atomic.Pointer[Tunables]),
+
+		deps: Deps{
+			Log:          cfg.Log,
+			UCIOpenMANET: network.NewUCIOpenMANETConfigReader(),
+			UCIDHCP:      network.NewUCIDHCPConfigReader(),
+			UCINetwork:   network.NewUCINetworkConfigReader(),
+			UCIFirewall:  network.NewUCIFirewallConfigReader(),
+			UCIDir:       uci.DefaultTreePath,
+			Board:        boardConfigInfo,
+			MeshConfig:   batmanadv.NewMeshConfigCache(cfg.MeshConfigCacheTTL),
+			MeshHealth:   NewMeshHealthMonitor(cfg.MeshHealthThresholds, cfg.Log),
+			MeshFilter:   NewMeshFilter(cfg.MeshID, cfg.MeshIDStrict, cfg.MeshIDAcceptLegacy, cfg.Log),
+			SchemaFilter: NewSchemaFilter(cfg.Log),
+			RecordLimits: NewRecordLimiter(RecordLimits{MaxRecords: cfg.MaxRecordsPerTick}, cfg.Log),
+			Hostnames:    NewHostnameWatcher(cfg.Log),
+			State:        state,
+		},
+
+		managedRoutes: NewManagedRouteReconciler(state, cfg.Log),
+
+		stop:     make(chan os.Signal),
+		stopOnce: new(sync.Once),
+	}
+}
+
+// addressing returns the configured mesh addressing, or the default one if m has
+// none, as in tests that build the config by hand.
+func (m *ManagementConfig) addressing() network.MeshAddressing {
+	if m == nil || m.MeshAddressing.Subnet == nil {
+		return network.DefaultMeshAddressing()
+	}
+	return m.MeshAddressing
+}
+
+// workerContext returns a context that is cancelled once shutdown is closed, so that
+// the batctl runs, reloads and alfred calls of a tick in progress give up rather than
+// hold up the shutdown. cancel must be called when the worker returns.
+func workerContext(shutdown <-chan os.Signal) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-shutdown:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
 
-		boardConfigInfo: boardConfigInfo,
+// dhcpLeasesPath returns the configured dnsmasq lease database, or the OpenWrt
+// default if m has none.
+func (m *ManagementConfig) dhcpLeasesPath() string {
+	if m == nil || m.DHCPLeasesPath == "" {
+		return network.DefaultDnsmasqLeasesPath
 	}
+	return m.DHCPLeasesPath
 }
 
 func (m *ManagementConfig) Start() {
-	client, err := alfred.NewClient(alfred.WithSocketPath(m.SocketPath))
+	client, err := NewAlfredClient(m.SocketPath, m.AlfredCallTimeout, m.Log)
 	if err != nil {
 		m.Log.Fatal().Err(err).Msg("Failed to create Alfred client")
 	}
 
 	m.Log.Info().Msg("Alfred Client Started")
 
+	deps := m.deps.withClient(client)
+
 	if m.AddressReservationDataType {
-		addressReservationWorker := NewAddressReservationWorker(m, client, m.InteruptChan)
+		addressReservationWorker := NewAddressReservationWorkerWithDeps(m, deps, m, m.stop)
 		go addressReservationWorker.StartSend()
 		go addressReservationWorker.StartReceive()
+		m.deps.Hostnames.OnChange(func(_, _ string) { addressReservationWorker.Republish() })
+		m.addressReservationWorker = addressReservationWorker
 	}
 
 	if m.NodeDataType {
 		// Start the node data worker
-		nodeDataWorker := NewNodeDataWorker(m, client, nodeDataWorkerInterval, m.InteruptChan)
+		nodeDataWorker := NewNodeDataWorkerWithDeps(m, deps, m, nodeDataWorkerInterval, m.stop)
 		go nodeDataWorker.StartSend()
 		go nodeDataWorker.StartReceive()
+		m.deps.Hostnames.OnChange(func(_, _ string) { nodeDataWorker.Republish() })
+		m.nodeDataWorker = nodeDataWorker
 
 	}
 
 	if m.GatewayDataType {
 		// Start the gateway worker
-		gatewayDataWorker := NewGatewayWorker(m, client, m.InteruptChan)
+		gatewayDataWorker := NewGatewayWorkerWithDeps(m, deps, m, m.stop)
 		go gatewayDataWorker.StartSend()
 		go gatewayDataWorker.StartReceive()
+		m.deps.Hostnames.OnChange(func(_, _ string) { gatewayDataWorker.Republish() })
+		m.gatewayWorker = gatewayDataWorker
+	}
+
+	if m.ServiceDataType {
+		// Start the service worker
+		serviceWorker := NewServiceWorkerWithDeps(m, deps, m, serviceWorkerInterval, m.stop)
+		go serviceWorker.StartSend()
+		go serviceWorker.StartReceive()
+		m.serviceWorker = serviceWorker
+	}
+
+	// Summaries from peers are collected even when this node does not publish its own
+	topologyWorker := NewTopologyWorkerWithDeps(m, deps, m, topologyWorkerInterval, m.stop)
+	go topologyWorker.StartSend()
+	go topologyWorker.StartReceive()
+	m.topologyWorker = topologyWorker
+
+	go m.deps.Hostnames.Run(DefaultHostnameCheckInterval, m.stop)
+
+	m.startManagedRoutes()
+	m.startConfigWatcher()
+}
+
+// Shutdown withdraws this node's records from alfred and then stops the workers, so
+// that the final records are not overwritten by a send tick. A gateway marks its
+// record withdrawing, which makes clients fail over right away; the reservation is
+// marked shutting down but stays valid. Publishing gives up when ctx is done, so an
+// alfred daemon that is already gone does not hold up the shutdown.
+func (m *ManagementConfig) Shutdown(ctx context.Context) {
+	if m.gatewayWorker != nil {
+		if err := m.gatewayWorker.Withdraw(ctx); err != nil {
+			m.Log.Warn().Err(err).Msg("Failed to withdraw gateway record")
+		}
+	}
+
+	if m.addressReservationWorker != nil {
+		if err := m.addressReservationWorker.Withdraw(ctx); err != nil {
+			m.Log.Warn().Err(err).Msg("Failed to publish final address reservation")
+		}
+	}
+
+	if m.stopOnce != nil {
+		m.stopOnce.Do(func() { close(m.stop) })
+	}
+}
+
+// staticRouteOwner is the name the configured static routes are managed under.
+const staticRouteOwner = "static"
+
+// meshRouteOwner is the name the route to the mesh subnet is managed under.
+const meshRouteOwner = "mesh"
+
+// startManagedRoutes keeps the managed routes, the configured static routes and the
+// route to the mesh subnet among them, installed until shutdown.
+func (m *ManagementConfig) startManagedRoutes() {
+	m.UpdateStaticRoutes(m.StaticRoutes)
+	m.updateMeshRoutes(m.Tunables())
+
+	safemode.OnExit(func() {
+		if err := m.managedRoutes.Reconcile(); err != nil {
+			m.Log.Error().Err(err).Msg("Failed to reconcile managed routes after leaving safe mode")
+		}
+	})
+
+	go m.managedRoutes.Run(DefaultManagedRouteInterval, m.stop)
+}
+
+// updateMeshRoutes makes the route to the IPv4 mesh subnet through the mesh
+// interface of t a managed route, so the mesh stays reachable when netifd or an
+// administrator flushes the routes of the interface. The kernel adds the same route
+// when the interface is addressed; it is left in place rather than duplicated.
+func (m *ManagementConfig) updateMeshRoutes(t Tunables) {
+	if m.managedRoutes == nil || t.IFace == "" {
+		return
+	}
+
+	route := &network.Route{
+		Destination: m.addressing().Subnet,
+		Interface:   t.IFace,
+		Table:       unix.RT_TABLE_MAIN,
+		Scope:       netlink.SCOPE_LINK,
+	}
+	if err := m.managedRoutes.SetRoutes(meshRouteOwner, []*network.Route{route}); err != nil {
+		m.Log.Error().Err(err).Msg("Failed to install the mesh subnet route")
+	}
+}
+
+// ManagedRoutes returns the reconciler that keeps managed routes installed, or nil
+// if m was not created by NewManager.
+func (m *ManagementConfig) ManagedRoutes() *ManagedRouteReconciler {
+	return m.managedRoutes
+}
+
+// startConfigWatcher reloads the network and dhcp configs when they are changed
+// outside openmanetd, so that the workers build on the manual change instead of
+// writing their cached copy over it. The reservation is republished when the mesh
+// interface or its DHCP pool changed, as both are part of it.
+func (m *ManagementConfig) startConfigWatcher() {
+	if m.deps.UCIDir == "" {
+		return
+	}
+
+	watcher := NewConfigWatcher(m.deps.UCIDir, m.deps, func() []string {
+		return []string{strings.TrimPrefix(m.Tunables().IFace, "br-")}
+	}, m.Log)
+
+	if arw := m.addressReservationWorker; arw != nil {
+		watcher.OnChange(func(ConfigChange) { arw.Republish() })
+	}
+
+	go watcher.Run(DefaultConfigCheckInterval, m.stop)
+}
+
+// UpdateStaticRoutes replaces the configured static routes after a config reload.
+func (m *ManagementConfig) UpdateStaticRoutes(routes []*network.Route) {
+	if err := m.managedRoutes.SetRoutes(staticRouteOwner, routes); err != nil {
+		m.Log.Error().Err(err).Msg("Failed to install static routes")
 	}
 }
@@ -1,10 +1,12 @@
 package mgmt
 
 import (
+	"context"
 	"os"
+	"strings"
+	"sync/atomic"
 	"time"
 
-	"github.com/openmanet/go-alfred"
 	proto "github.com/openmanet/openmanetd/internal/api/openmanet/v1"
 	"github.com/openmanet/openmanetd/internal/network"
 )
@@ -15,20 +17,42 @@ const (
 )
 
 type NodeDataWorker struct {
+	// Config holds the settings fixed at startup, Deps the shared runtime
+	// dependencies and Tunables the settings that may change between ticks.
 	Config       *ManagementConfig
-	Client       *alfred.Client
+	Deps         Deps
+	Tunables     TunablesProvider
 	Interval     time.Duration
 	ShutdownChan <-chan os.Signal
+
+	// republish triggers a send pass ahead of the ticker, e.g. after a rename.
+	republish chan struct{}
+
+	// peers holds the node records received from other nodes, for status queries.
+	peers *PeerTable
+
+	// lastTunables are the tunables of the most recent tick.
+	lastTunables atomic.Pointer[Tunables]
+}
+
+func NewNodeDataWorker(config *ManagementConfig, client *AlfredClient, interval time.Duration, shutdownChan <-chan os.Signal) *NodeDataWorker {
+	return NewNodeDataWorkerWithDeps(config, config.deps.withClient(client), config, interval, shutdownChan)
 }
 
-func NewNodeDataWorker(config *ManagementConfig, client *alfred.Client, interval time.Duration, shutdownChan <-chan os.Signal) *NodeDataWorker {
-	config.Log.Info().Msg("NodeDataWorker initialized")
+// NewNodeDataWorkerWithDeps creates a node data worker that uses deps and takes a
+// snapshot of tunables at the start of every tick.
+func NewNodeDataWorkerWithDeps(config *ManagementConfig, deps Deps, tunables TunablesProvider, interval time.Duration, shutdownChan <-chan os.Signal) *NodeDataWorker {
+	deps.Log.Info().Msg("NodeDataWorker initialized")
 
 	return &NodeDataWorker{
 		Config:       config,
-		Client:       client,
+		Deps:         deps,
+		Tunables:     tunables,
 		Interval:     interval,
 		ShutdownChan: shutdownChan,
+
+		republish: make(chan struct{}, 1),
+		peers:     NewPeerTable(DefaultPeerTTL),
 	}
 }
 
@@ -37,47 +61,71 @@ func (ndw *NodeDataWorker) StartSend() {
 	ticker := time.NewTicker(ndw.Interval)
 	defer ticker.Stop()
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	for {
 		select {
 		case <-ndw.ShutdownChan:
 			return
 		case <-ticker.C:
-			configured, err := network.IsDHCPConfiguredWithReader(ndw.Config.uciOpenMANETConfig)
-			if err != nil {
-				ndw.Config.Log.Error().Err(err).Msg("Error checking DHCP configuration")
-				continue
-			}
+			ndw.sendTick(ctx)
+		case <-ndw.republish:
+			ndw.sendTick(ctx)
+		}
+	}
+}
 
-			if !configured {
-				ndw.Config.Log.Debug().Msg("Static Address & DHCP not configured, skipping node data send")
-				continue
-			}
+// Republish publishes the node record without waiting for the next tick.
+func (ndw *NodeDataWorker) Republish() {
+	select {
+	case ndw.republish <- struct{}{}:
+	default:
+	}
+}
 
-			iface := network.GetInterfaceByName(ndw.Config.IFace)
-			hostname, err := os.Hostname()
-			if err != nil {
-				ndw.Config.Log.Error().Err(err).Msg("Error getting hostname")
-				hostname = "unknown"
-			}
+// sendTick publishes this node's record once its address is configured.
+func (ndw *NodeDataWorker) sendTick(ctx context.Context) {
+	t := ndw.tick()
 
-			nodeData := proto.Node{
-				Mac:      iface.MAC,
-				Hostname: hostname,
-				Ipaddr:   iface.IP[0].IP.String(),
-			}
+	configured, err := network.IsDHCPConfiguredWithReader(ndw.Deps.UCIOpenMANET)
+	if err != nil {
+		ndw.Deps.Log.Error().Err(err).Msg("Error checking DHCP configuration")
+		return
+	}
 
-			var nodeDataBytes []byte
-			nodeDataBytes, err = nodeData.MarshalVT()
-			if err != nil {
-				ndw.Config.Log.Error().Err(err).Msg("Error marshaling node data")
-				continue
-			}
+	if !configured {
+		ndw.Deps.Log.Debug().Msg("Static Address & DHCP not configured, skipping node data send")
+		return
+	}
 
-			err = ndw.Client.Set(NodeDataType, NodeDataTypeVersion, nodeDataBytes)
-			if err != nil {
-				ndw.Config.Log.Error().Err(err).Msg("Error sending node data")
-			}
-		}
+	iface := network.GetInterfaceByName(t.IFace)
+
+	nodeData := proto.Node{
+		Mac:      iface.MAC,
+		Hostname: ndw.Deps.hostname(iface.MAC),
+		RaRole:   currentRARole(strings.TrimPrefix(t.IFace, "br-"), ndw.Deps.UCIDHCP),
+		MeshId:   ndw.Config.MeshID,
+	}
+	if addr, ok := iface.PrimaryIPv4(); ok {
+		nodeData.Ipaddr = addr.IP.String()
+	}
+
+	if health := ndw.Deps.meshHealth(t.BatInterface); health != nil {
+		nodeData.NeighborCount = uint32(health.Neighbors)
+		nodeData.MeshHealth = string(health.State)
+	}
+
+	var nodeDataBytes []byte
+	nodeDataBytes, err = nodeData.MarshalVT()
+	if err != nil {
+		ndw.Deps.Log.Error().Err(err).Msg("Error marshaling node data")
+		return
+	}
+
+	err = ndw.Deps.Client.SetCtx(ctx, NodeDataType, NodeDataTypeVersion, nodeDataBytes)
+	if err != nil {
+		ndw.Deps.Log.Error().Err(err).Msg("Error sending node data")
 	}
 }
 
@@ -86,31 +134,35 @@ func (ndw *NodeDataWorker) StartReceive() {
 	ticker := time.NewTicker(ndw.Interval)
 	defer ticker.Stop()
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	for {
 		select {
 		case <-ndw.ShutdownChan:
 			return
 		case <-ticker.C:
-			record, err := ndw.Client.Request(NodeDataType)
+			t := ndw.tick()
+			record, err := ndw.Deps.Client.RequestCtx(ctx, NodeDataType)
 			if err != nil {
-				ndw.Config.Log.Error().Err(err).Msg("Error receiving node data")
+				ndw.Deps.Log.Error().Err(err).Msg("Error receiving node data")
 			} else {
-				for _, rec := range record {
+				iface := network.GetInterfaceByName(t.IFace)
+				record = ndw.Deps.RecordLimits.Limit("node", record)
+				for _, rec := range ndw.Deps.MeshFilter.FilterNodes(record) {
 					var nodeData proto.Node
 					err = nodeData.UnmarshalVT(rec.Data)
 					if err != nil {
-						ndw.Config.Log.Error().Err(err).Msg("Error unmarshaling node data")
+						ndw.Deps.Log.Error().Err(err).Msg("Error unmarshaling node data")
 					} else {
-						hostname, err := os.Hostname()
-						if err != nil {
-							ndw.Config.Log.Error().Err(err).Msg("Error getting hostname")
-						}
-						// ignore our own node data
-						if nodeData.Hostname == hostname {
+						// ignore our own node data; match on MAC, the hostname may
+						// have changed since the record was published
+						if nodeData.Mac == iface.MAC {
 							continue
 						}
 
-						ndw.Config.Log.Debug().Msgf("Received node data: %+v", &nodeData)
+						ndw.Deps.Log.Debug().Msgf("Received node data: %+v", &nodeData)
+						ndw.peers.Observe(&nodeData)
 					}
 				}
 			}
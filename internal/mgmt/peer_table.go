@@ -0,0 +1,92 @@
+package mgmt
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	proto "github.com/openmanet/openmanetd/internal/api/openmanet/v1"
+)
+
+// DefaultPeerTTL is how long a node stays listed without being seen again. It
+// matches the alfred data timeout, after which a peer's record is dropped.
+const DefaultPeerTTL time.Duration = 10 * time.Minute
+
+// Peer is another node's record as last seen over alfred.
+type Peer struct {
+	Mac      string    `json:"mac"`
+	Hostname string    `json:"hostname"`
+	IP       string    `json:"ip"`
+	RARole   string    `json:"raRole,omitempty"`
+	MeshID   string    `json:"meshId,omitempty"`
+	LastSeen time.Time `json:"lastSeen"`
+
+	// Neighbors and MeshHealth are the peer's own view of the mesh; older nodes
+	// do not publish them.
+	Neighbors  uint32 `json:"neighbors,omitempty"`
+	MeshHealth string `json:"meshHealth,omitempty"`
+}
+
+// PeerTable tracks the node records received from other nodes, keyed by MAC.
+type PeerTable struct {
+	mu      sync.RWMutex
+	entries map[string]*Peer
+	ttl     time.Duration
+
+	// now is overridable for tests.
+	now func() time.Time
+}
+
+// NewPeerTable creates an empty PeerTable whose entries expire after ttl.
+func NewPeerTable(ttl time.Duration) *PeerTable {
+	return &PeerTable{
+		entries: make(map[string]*Peer),
+		ttl:     ttl,
+		now:     time.Now,
+	}
+}
+
+// Observe records a node seen over alfred and refreshes its expiry. Records without
+// a MAC are ignored.
+func (t *PeerTable) Observe(node *proto.Node) {
+	if node.GetMac() == "" {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.entries[node.GetMac()] = &Peer{
+		Mac:      node.GetMac(),
+		Hostname: node.GetHostname(),
+		IP:       node.GetIpaddr(),
+		RARole:   node.GetRaRole(),
+		MeshID:   node.GetMeshId(),
+		LastSeen: t.now(),
+
+		Neighbors:  node.GetNeighborCount(),
+		MeshHealth: node.GetMeshHealth(),
+	}
+}
+
+// Active removes expired peers and returns copies of the rest, sorted by MAC.
+func (t *PeerTable) Active() []Peer {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	active := make([]Peer, 0, len(t.entries))
+	for mac, entry := range t.entries {
+		if now.Sub(entry.LastSeen) >= t.ttl {
+			delete(t.entries, mac)
+			continue
+		}
+		active = append(active, *entry)
+	}
+
+	sort.Slice(active, func(i, j int) bool {
+		return active[i].Mac < active[j].Mac
+	})
+
+	return active
+}
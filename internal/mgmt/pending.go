@@ -0,0 +1,251 @@
+package mgmt
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/openmanet/openmanetd/internal/network"
+	"github.com/openmanet/openmanetd/internal/safemode"
+)
+
+// configurationConfigs are the UCI configs the address reservation flow writes.
+var configurationConfigs = []string{"network", "dhcp", "openmanetd"}
+
+// DefaultPendingTimeout is how long a configuration that was started but is not in
+// UCI yet is waited for before it is rolled back. Commits deferred by a read-only
+// overlay land within this time once the overlay is writable again.
+const DefaultPendingTimeout = 10 * time.Minute
+
+// PendingConfiguration records a configuration the address reservation flow started
+// writing. It is persisted before the first UCI commit and cleared once the node is
+// marked as configured, so a crash or power loss in between is recognized on restart
+// and the flow is completed with the same address instead of selecting a new one.
+type PendingConfiguration struct {
+	Section   string    `json:"section"`
+	StaticIP  string    `json:"staticIp"`
+	DHCPStart string    `json:"dhcpStart"`
+	DHCPLimit string    `json:"dhcpLimit"`
+	Started   time.Time `json:"started"`
+
+	// The values the flow replaced, restored if it has to be rolled back.
+	PrevIPAddr    string `json:"prevIpAddr,omitempty"`
+	PrevDHCPStart string `json:"prevDhcpStart,omitempty"`
+	PrevDHCPLimit string `json:"prevDhcpLimit,omitempty"`
+}
+
+// pendingStatus is how far a pending configuration made it into UCI.
+type pendingStatus int
+
+const (
+	// pendingApplied means UCI holds the whole configuration; only marking the node
+	// as configured is missing.
+	pendingApplied pendingStatus = iota
+	// pendingInProgress means UCI does not hold it yet, but it may still get there.
+	pendingInProgress
+	// pendingStale means UCI does not hold it and it timed out.
+	pendingStale
+)
+
+// checkPending compares a pending configuration with what UCI holds.
+func checkPending(p *PendingConfiguration, netReader network.ConfigReader, dhcpReader network.DHCPConfigReader, now time.Time, timeout time.Duration) (pendingStatus, error) {
+	netCfg, err := network.GetUCINetworkByNameWithReader(p.Section, netReader)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read network %s: %w", p.Section, err)
+	}
+	dhcpCfg, err := network.GetDHCPConfigWithReader(p.Section, dhcpReader)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read DHCP pool %s: %w", p.Section, err)
+	}
+
+	if netCfg.IPAddr == p.StaticIP && dhcpCfg.Start == p.DHCPStart && dhcpCfg.Limit == p.DHCPLimit {
+		return pendingApplied, nil
+	}
+	if now.Sub(p.Started) < timeout {
+		return pendingInProgress, nil
+	}
+
+	return pendingStale, nil
+}
+
+// rollbackPending restores the address and DHCP range a pending configuration
+// replaced. Values that were not set before are left as they are; selection
+// overwrites them anyway.
+func rollbackPending(p *PendingConfiguration, netReader network.ConfigReader, dhcpReader network.DHCPConfigReader) error {
+	if p.PrevIPAddr != "" {
+		if err := network.SetNetworkIPAddrWithReader(p.Section, p.PrevIPAddr, netReader); err != nil {
+			return err
+		}
+	}
+
+	if p.PrevDHCPStart != "" && p.PrevDHCPLimit != "" {
+		if _, err := network.SetDHCPRangeWithReader(p.Section, p.PrevDHCPStart, p.PrevDHCPLimit, dhcpReader); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resolvePending brings UCI in line with a pending configuration: an applied one is
+// marked as configured, a stale one is rolled back and one in progress is left alone.
+func resolvePending(p *PendingConfiguration, netReader network.ConfigReader, dhcpReader network.DHCPConfigReader, omReader network.OpenMANETConfigReader, now time.Time, timeout time.Duration) (pendingStatus, error) {
+	status, err := checkPending(p, netReader, dhcpReader, now, timeout)
+	if err != nil {
+		return 0, err
+	}
+
+	switch status {
+	case pendingApplied:
+		err = network.SetDHCPConfiguredWithReader(omReader)
+	case pendingStale:
+		err = rollbackPending(p, netReader, dhcpReader)
+	}
+
+	return status, err
+}
+
+// beginConfiguration persists p before the first UCI write of the flow. A failure to
+// save is logged but does not stop the flow: the state file lives on the same overlay
+// as UCI, so the commits that follow are deferred as well.
+func (arw *AddressReservationWorker) beginConfiguration(p *PendingConfiguration) {
+	if prev, err := network.GetUCINetworkByNameWithReader(p.Section, arw.Deps.UCINetwork); err == nil {
+		p.PrevIPAddr = prev.IPAddr
+	}
+	if prev, err := network.GetDHCPConfigWithReader(p.Section, arw.Deps.UCIDHCP); err == nil {
+		p.PrevDHCPStart, p.PrevDHCPLimit = prev.Start, prev.Limit
+	}
+
+	arw.state.Update(func(state *State) bool {
+		state.Pending = p
+		return true
+	})
+}
+
+// snapshotConfiguration snapshots the configs the address reservation flow is about
+// to write. It returns nil if there is no UCI directory to snapshot or the snapshot
+// failed; the flow goes on without one.
+func (arw *AddressReservationWorker) snapshotConfiguration() *network.Snapshot {
+	if arw.Deps.UCIDir == "" {
+		return nil
+	}
+
+	snapshot, err := network.TakeSnapshot(arw.Deps.UCIDir, configurationConfigs...)
+	if err != nil {
+		arw.Deps.Log.Warn().Err(err).Msg("Error snapshotting UCI configuration, a failed configuration cannot be restored")
+		return nil
+	}
+
+	return snapshot
+}
+
+// abortConfiguration undoes a configuration that failed part way. The changes
+// staged in the readers are dropped and the configs committed by earlier steps are
+// restored from snapshot, after which the pending configuration is forgotten.
+// Without a snapshot, or if it cannot be restored, the pending configuration is
+// left for resumePending to roll back.
+func (arw *AddressReservationWorker) abortConfiguration(snapshot *network.Snapshot) {
+	readers := []network.Reverter{arw.Deps.UCINetwork, arw.Deps.UCIDHCP, arw.Deps.UCIOpenMANET}
+	arw.logDiscardedChanges()
+
+	if snapshot == nil {
+		for _, r := range readers {
+			r.Revert()
+		}
+		return
+	}
+
+	if err := snapshot.Restore(readers...); err != nil {
+		arw.Deps.Log.Error().Err(err).Msg("Error restoring UCI configuration after a failed configuration step")
+		return
+	}
+
+	arw.clearPending()
+	arw.Deps.Log.Warn().Bool("audit", true).Strs("configs", snapshot.Configs()).Msg("Restored UCI configuration after a failed configuration step")
+}
+
+// logDiscardedChanges logs the changes staged in the readers that a failed
+// configuration step leaves uncommitted, before they are reverted.
+func (arw *AddressReservationWorker) logDiscardedChanges() {
+	var changes []string
+	for _, r := range []network.ChangeReporter{arw.Deps.UCINetwork, arw.Deps.UCIDHCP, arw.Deps.UCIOpenMANET} {
+		for _, c := range r.Changes() {
+			changes = append(changes, c.String())
+		}
+	}
+	if len(changes) > 0 {
+		arw.Deps.Log.Warn().Strs("changes", changes).Msg("Discarding uncommitted UCI changes of a failed configuration step")
+	}
+}
+
+// clearPending forgets the pending configuration once the node is marked as configured.
+func (arw *AddressReservationWorker) clearPending() {
+	arw.state.Update(func(state *State) bool {
+		if state.Pending == nil {
+			return false
+		}
+		state.Pending = nil
+		return true
+	})
+}
+
+// resumePending finishes or rolls back a configuration interrupted by a crash or
+// power loss. It returns true if the receive tick must not go on to select an
+// address, either because the configuration was completed or because it is still
+// waiting for deferred commits.
+func (arw *AddressReservationWorker) resumePending(ctx context.Context, t Tunables) bool {
+	var p *PendingConfiguration
+	arw.state.Read(func(state *State) { p = state.Pending })
+	if p == nil {
+		return false
+	}
+
+	// Completing or rolling back writes UCI; wait until safe mode is left
+	if safemode.Enabled() {
+		arw.Deps.Log.Debug().Msg("Safe mode active, not resuming pending configuration")
+		return true
+	}
+
+	status, err := resolvePending(p, arw.Deps.UCINetwork, arw.Deps.UCIDHCP, arw.Deps.UCIOpenMANET, time.Now(), DefaultPendingTimeout)
+	if err != nil {
+		arw.Deps.Log.Error().Err(err).Str("ip", p.StaticIP).Msg("Error resuming pending configuration")
+		return true
+	}
+
+	switch status {
+	case pendingInProgress:
+		arw.Deps.Log.Debug().Str("ip", p.StaticIP).Msg("Configuration still pending, not selecting an address")
+		return true
+
+	case pendingStale:
+		arw.Deps.Log.Warn().Bool("audit", true).Str("ip", p.StaticIP).Time("started", p.Started).Msg("Rolled back configuration that never reached UCI")
+		arw.clearPending()
+		return false
+	}
+
+	arw.Deps.Log.Warn().Bool("audit", true).Str("ip", p.StaticIP).Time("started", p.Started).Msg("Completed configuration interrupted by a restart")
+
+	// After a power loss the node booted with the new address and only has to
+	// confirm it; after a crash the address is not applied yet and a reboot is due
+	if hasAddress(network.GetInterfaceByName(t.IFace), p.StaticIP) {
+		arw.clearPending()
+		arw.publishReservation(ctx)
+		return true
+	}
+
+	if err := arw.finalizeConfiguration(ctx, t); err != nil {
+		arw.Deps.Log.Error().Err(err).Msg("Error finalizing resumed configuration")
+	}
+
+	return true
+}
+
+// hasAddress reports whether iface carries ip.
+func hasAddress(iface network.NetworkInterface, ip string) bool {
+	for _, addr := range iface.IP {
+		if addr.IP.String() == ip {
+			return true
+		}
+	}
+	return false
+}
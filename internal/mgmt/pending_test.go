@@ -0,0 +1,237 @@
+package mgmt
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/digineo/go-uci/v2"
+	"github.com/openmanet/openmanetd/internal/network"
+	"github.com/rs/zerolog"
+)
+
+// crashedStateFile is a state file written by a node that crashed between starting
+// its configuration and marking itself as configured.
+const crashedStateFile = `{
+  "pending": {
+    "section": "ahwlan",
+    "staticIp": "10.41.0.7",
+    "dhcpStart": "300",
+    "dhcpLimit": "16",
+    "started": "2025-01-01T12:00:00Z",
+    "prevIpAddr": "10.41.254.1",
+    "prevDhcpStart": "100",
+    "prevDhcpLimit": "16"
+  }
+}`
+
+// loadCrashedState loads crashedStateFile through a state file on disk.
+func loadCrashedState(t *testing.T) *State {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, []byte(crashedStateFile), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	state, err := LoadState(path)
+	if err != nil {
+		t.Fatalf("LoadState() error = %v", err)
+	}
+	if state.Pending == nil {
+		t.Fatal("LoadState() lost the pending configuration")
+	}
+
+	return state
+}
+
+// newUCIFixture returns network and DHCP readers holding the given address and
+// DHCP start for ahwlan.
+func newUCIFixture(ipaddr, dhcpStart string) (*mockDHCPReader, *mockDHCPReader) {
+	netReader := newMockDHCPReader()
+	_ = netReader.SetType("network", "ahwlan", "proto", uci.TypeOption, "static")
+	_ = netReader.SetType("network", "ahwlan", "ipaddr", uci.TypeOption, ipaddr)
+
+	dhcpReader := newMockDHCPReader()
+	_ = dhcpReader.SetType("dhcp", "ahwlan", "start", uci.TypeOption, dhcpStart)
+	_ = dhcpReader.SetType("dhcp", "ahwlan", "limit", uci.TypeOption, "16")
+
+	return netReader, dhcpReader
+}
+
+func TestResolvePending(t *testing.T) {
+	started := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		ipaddr        string
+		dhcpStart     string
+		now           time.Time
+		wantStatus    pendingStatus
+		wantIP        string
+		wantStart     string
+		wantConfigure bool
+	}{
+		{"UCI matches", "10.41.0.7", "300", started.Add(time.Hour), pendingApplied, "10.41.0.7", "300", true},
+		{"only network written, recent", "10.41.0.7", "100", started.Add(time.Minute), pendingInProgress, "10.41.0.7", "100", false},
+		{"only network written, timed out", "10.41.0.7", "100", started.Add(time.Hour), pendingStale, "10.41.254.1", "100", false},
+		{"nothing written, timed out", "10.41.254.1", "100", started.Add(time.Hour), pendingStale, "10.41.254.1", "100", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := loadCrashedState(t)
+			netReader, dhcpReader := newUCIFixture(tt.ipaddr, tt.dhcpStart)
+			omReader := newMockDHCPReader()
+
+			status, err := resolvePending(state.Pending, netReader, dhcpReader, omReader, tt.now, DefaultPendingTimeout)
+			if err != nil {
+				t.Fatalf("resolvePending() error = %v", err)
+			}
+			if status != tt.wantStatus {
+				t.Errorf("resolvePending() = %v, want %v", status, tt.wantStatus)
+			}
+
+			if got := netReader.options["ahwlan.ipaddr"]; !reflect.DeepEqual(got, []string{tt.wantIP}) {
+				t.Errorf("ipaddr = %v, want %s", got, tt.wantIP)
+			}
+			if got := dhcpReader.options["ahwlan.start"]; !reflect.DeepEqual(got, []string{tt.wantStart}) {
+				t.Errorf("DHCP start = %v, want %s", got, tt.wantStart)
+			}
+
+			_, configured := omReader.options["config.dhcpconfigured"]
+			if configured != tt.wantConfigure {
+				t.Errorf("dhcpconfigured set = %v, want %v", configured, tt.wantConfigure)
+			}
+		})
+	}
+}
+
+func TestRollbackPending_NothingToRestore(t *testing.T) {
+	p := &PendingConfiguration{Section: "ahwlan", StaticIP: "10.41.0.7", DHCPStart: "300", DHCPLimit: "16"}
+	netReader, dhcpReader := newUCIFixture("10.41.0.7", "300")
+
+	if err := rollbackPending(p, netReader, dhcpReader); err != nil {
+		t.Fatalf("rollbackPending() error = %v", err)
+	}
+	if netReader.commits+dhcpReader.commits != 0 {
+		t.Errorf("rollbackPending() committed %d times, want 0", netReader.commits+dhcpReader.commits)
+	}
+}
+
+func TestState_PendingRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	want := loadCrashedState(t).Pending
+
+	if err := (&State{Pending: want}).Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	loaded, err := LoadState(path)
+	if err != nil {
+		t.Fatalf("LoadState() error = %v", err)
+	}
+	if !reflect.DeepEqual(loaded.Pending, want) {
+		t.Errorf("LoadState() pending = %+v, want %+v", loaded.Pending, want)
+	}
+
+	if err := (&State{}).Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if loaded, _ := LoadState(path); loaded.Pending != nil {
+		t.Errorf("LoadState() pending = %+v after clearing, want nil", loaded.Pending)
+	}
+}
+
+// newAbortFixture returns a worker whose UCI readers work on a temporary directory
+// holding the configuration of a node before the address reservation flow, with a
+// pending configuration recorded.
+func newAbortFixture(t *testing.T, uciDir bool) (*AddressReservationWorker, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"network": "\nconfig interface 'ahwlan'\n\toption proto 'static'\n\toption ipaddr '10.41.254.1'\n",
+		"dhcp":    "\nconfig dhcp 'ahwlan'\n\toption interface 'ahwlan'\n\toption start '100'\n\toption limit '16'\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+	}
+
+	deps := Deps{
+		Log:          zerolog.Nop(),
+		UCINetwork:   network.NewUCINetworkConfigReaderWithTree(uci.NewTree(dir)),
+		UCIDHCP:      network.NewUCIDHCPConfigReaderWithTree(uci.NewTree(dir)),
+		UCIOpenMANET: network.NewUCIOpenMANETConfigReaderWithTree(uci.NewTree(dir)),
+	}
+	if uciDir {
+		deps.UCIDir = dir
+	}
+
+	arw := &AddressReservationWorker{
+		Deps:  deps,
+		state: OpenStateStore(filepath.Join(t.TempDir(), "state.json"), zerolog.Nop()),
+	}
+	arw.state.Update(func(state *State) bool {
+		state.Pending = &PendingConfiguration{Section: "ahwlan", StaticIP: "10.41.0.7"}
+		return true
+	})
+
+	return arw, dir
+}
+
+func TestAbortConfiguration_RestoresSnapshot(t *testing.T) {
+	arw, dir := newAbortFixture(t, true)
+	snapshot := arw.snapshotConfiguration()
+	if snapshot == nil {
+		t.Fatal("snapshotConfiguration() = nil")
+	}
+
+	// The network step committed, the DHCP step failed with its change staged
+	if err := network.SetNetworkIPAddrWithReader("ahwlan", "10.41.0.7", arw.Deps.UCINetwork); err != nil {
+		t.Fatalf("SetNetworkIPAddrWithReader() error = %v", err)
+	}
+	_ = arw.Deps.UCIDHCP.SetType("dhcp", "ahwlan", "start", uci.TypeOption, "300")
+
+	arw.abortConfiguration(snapshot)
+
+	fresh := network.NewUCINetworkConfigReaderWithTree(uci.NewTree(dir))
+	if cfg, _ := network.GetUCINetworkByNameWithReader("ahwlan", fresh); cfg.IPAddr != "10.41.254.1" {
+		t.Errorf("ipaddr on disk = %q, want the address before the flow", cfg.IPAddr)
+	}
+	if cfg, _ := network.GetDHCPConfigWithReader("ahwlan", arw.Deps.UCIDHCP); cfg.Start != "100" {
+		t.Errorf("staged DHCP start = %q, want it dropped", cfg.Start)
+	}
+
+	var pending *PendingConfiguration
+	arw.state.Read(func(state *State) { pending = state.Pending })
+	if pending != nil {
+		t.Errorf("pending = %+v after a restore, want nil", pending)
+	}
+}
+
+func TestAbortConfiguration_NoSnapshot(t *testing.T) {
+	arw, _ := newAbortFixture(t, false)
+	if snapshot := arw.snapshotConfiguration(); snapshot != nil {
+		t.Fatalf("snapshotConfiguration() = %v without a UCI directory, want nil", snapshot)
+	}
+
+	_ = arw.Deps.UCIDHCP.SetType("dhcp", "ahwlan", "start", uci.TypeOption, "300")
+
+	arw.abortConfiguration(nil)
+
+	if cfg, _ := network.GetDHCPConfigWithReader("ahwlan", arw.Deps.UCIDHCP); cfg.Start != "100" {
+		t.Errorf("staged DHCP start = %q, want it dropped", cfg.Start)
+	}
+
+	// The pending configuration is left for resumePending to roll back
+	var pending *PendingConfiguration
+	arw.state.Read(func(state *State) { pending = state.Pending })
+	if pending == nil {
+		t.Error("pending = nil without a snapshot, want it kept")
+	}
+}
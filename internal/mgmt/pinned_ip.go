@@ -0,0 +1,99 @@
+package mgmt
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/openmanet/go-alfred"
+	"github.com/openmanet/openmanetd/internal/network"
+	"github.com/rs/zerolog"
+)
+
+// Policies for a pinned IP that is already reserved by a peer.
+const (
+	// PinConflictFail leaves the node unconfigured so that an operator notices the
+	// conflict. The pin is retried on every tick.
+	PinConflictFail string = "fail"
+	// PinConflictAuto falls back to selecting a free address as if no pin were set.
+	PinConflictAuto string = "auto"
+)
+
+// selectStaticIP picks the static IP for this node, honouring a pin from UCI or, if
+// none is set there, from the config file.
+func (arw *AddressReservationWorker) selectStaticIP(t Tunables, records []alfred.Record, gatewayMode bool, selfMAC string) (string, error) {
+	pin, err := network.GetPinnedIPWithReader(arw.Deps.UCIOpenMANET)
+	if err != nil {
+		arw.Deps.Log.Error().Err(err).Msg("Error reading pinned IP")
+	}
+
+	if pin == "" {
+		pin = t.PinnedIP
+	}
+
+	return resolveStaticIP(arw.Config.addressing(), records, arw.leasedIPs(), pin, t.FallbackOnPinConflict, t.IPAllocationStrategy, gatewayMode, selfMAC, arw.Deps.Log)
+}
+
+// leasedIPs returns the addresses of the DHCP leases that are active now. A node
+// that restarts unconfigured may still have clients holding addresses of its old
+// pool, which must not be selected as a static IP.
+func (arw *AddressReservationWorker) leasedIPs() []string {
+	leases, err := network.ReadDnsmasqLeases(arw.leasesPath)
+	if err != nil {
+		arw.Deps.Log.Error().Err(err).Msg("Error reading DHCP leases")
+		return nil
+	}
+
+	var ips []string
+	for _, lease := range network.ActiveLeases(leases, time.Now()) {
+		ips = append(ips, lease.IP.String())
+	}
+
+	return ips
+}
+
+// resolveStaticIP returns pin if it is valid and not reserved by a peer, otherwise
+// applies policy. Without a pin it selects a free address using strategy.
+//
+// Parameters:
+//   - addressing: the mesh subnet the address is selected from or pinned to
+//   - records: the address reservation records received over alfred
+//   - inUse: addresses held without a reservation, skipped when selecting a free
+//     address but not checked against a pin
+//   - pin: the pinned address, or "" for none
+//   - policy: PinConflictFail or PinConflictAuto; anything else is treated as fail
+//   - strategy: the network.IPAllocation* strategy used to select a free address
+//   - gatewayMode: selects from the gateway pool when selecting a free address
+//   - selfMAC: this node's MAC, so our own stale record is not a conflict and the
+//     mac-hash strategy has something to hash
+//
+// Returns the address to claim, or an error wrapping network.ErrPinConflict or
+// network.ErrValidation if the pin cannot be honoured and policy is fail.
+func resolveStaticIP(addressing network.MeshAddressing, records []alfred.Record, inUse []string, pin, policy, strategy string, gatewayMode bool, selfMAC string, log zerolog.Logger) (string, error) {
+	if pin == "" {
+		return addressing.SelectStaticIPExcluding(records, inUse, gatewayMode, strategy, selfMAC)
+	}
+
+	err := addressing.ValidatePinnedIP(pin)
+	if err == nil {
+		err = network.CheckPinnedIPAvailable(records, pin, selfMAC)
+	}
+
+	if err == nil {
+		log.Info().Msgf("Claiming pinned IP %s", pin)
+		return pin, nil
+	}
+
+	event := log.Warn().Err(err).Str("pinnedIP", pin).Str("policy", policy)
+	if errors.Is(err, network.ErrPinConflict) {
+		event.Msg("Pinned IP conflicts with a peer reservation")
+	} else {
+		event.Msg("Pinned IP is invalid")
+	}
+
+	if policy != PinConflictAuto {
+		return "", fmt.Errorf("cannot claim pinned IP: %w", err)
+	}
+
+	return addressing.SelectStaticIPExcluding(records, inUse, gatewayMode, strategy, selfMAC)
+}
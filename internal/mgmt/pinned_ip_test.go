@@ -0,0 +1,142 @@
+package mgmt
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/openmanet/go-alfred"
+	proto "github.com/openmanet/openmanetd/internal/api/openmanet/v1"
+	"github.com/openmanet/openmanetd/internal/network"
+	"github.com/rs/zerolog"
+)
+
+func reservationRecord(t *testing.T, mac, ip string) alfred.Record {
+	t.Helper()
+
+	data, err := (&proto.AddressReservation{Mac: mac, StaticIp: ip}).MarshalVT()
+	if err != nil {
+		t.Fatalf("MarshalVT() error = %v", err)
+	}
+
+	return alfred.Record{Data: data}
+}
+
+func TestResolveStaticIP(t *testing.T) {
+	const selfMAC = "aa:bb:cc:dd:ee:ff"
+
+	records := []alfred.Record{
+		reservationRecord(t, "aa:bb:cc:dd:ee:01", "10.41.2.10"),
+		reservationRecord(t, "aa:bb:cc:dd:ee:02", "10.41.2.11"),
+	}
+
+	tests := []struct {
+		name    string
+		pin     string
+		policy  string
+		selfMAC string
+		want    string
+		wantAny bool
+		wantErr error
+	}{
+		{
+			name:   "pin honoured",
+			pin:    "10.41.2.12",
+			policy: PinConflictFail,
+			want:   "10.41.2.12",
+		},
+		{
+			name:    "pin held by our own stale record",
+			pin:     "10.41.2.11",
+			policy:  PinConflictFail,
+			selfMAC: "aa:bb:cc:dd:ee:02",
+			want:    "10.41.2.11",
+		},
+		{
+			name:    "pin conflict with fail policy",
+			pin:     "10.41.2.10",
+			policy:  PinConflictFail,
+			wantErr: network.ErrPinConflict,
+		},
+		{
+			name:    "pin conflict with unknown policy fails",
+			pin:     "10.41.2.10",
+			policy:  "retry",
+			wantErr: network.ErrPinConflict,
+		},
+		{
+			name:    "pin conflict with auto policy",
+			pin:     "10.41.2.10",
+			policy:  PinConflictAuto,
+			wantAny: true,
+		},
+		{
+			name:    "pin outside subnet rejected",
+			pin:     "192.168.1.10",
+			policy:  PinConflictFail,
+			wantErr: network.ErrValidation,
+		},
+		{
+			name:    "pin in reserved range rejected",
+			pin:     "10.41.254.10",
+			policy:  PinConflictFail,
+			wantErr: network.ErrValidation,
+		},
+		{
+			name:    "no pin selects free address",
+			policy:  PinConflictFail,
+			wantAny: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mac := tt.selfMAC
+			if mac == "" {
+				mac = selfMAC
+			}
+
+			got, err := resolveStaticIP(network.DefaultMeshAddressing(), records, nil, tt.pin, tt.policy, network.IPAllocationSequential, false, mac, zerolog.Nop())
+
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("resolveStaticIP() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveStaticIP() unexpected error: %v", err)
+			}
+
+			if tt.wantAny {
+				if got == "10.41.2.10" || got == "10.41.2.11" || got == tt.pin {
+					t.Errorf("resolveStaticIP() = %s, want a free address other than the pin", got)
+				}
+				return
+			}
+			if got != tt.want {
+				t.Errorf("resolveStaticIP() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveStaticIP_SkipsLeasedAddresses(t *testing.T) {
+	const selfMAC = "aa:bb:cc:dd:ee:ff"
+
+	records := []alfred.Record{
+		reservationRecord(t, "aa:bb:cc:dd:ee:01", "10.41.0.1"),
+		reservationRecord(t, "aa:bb:cc:dd:ee:02", "10.41.0.2"),
+	}
+	inUse := []string{"10.41.0.3", "10.41.0.4"}
+
+	got, err := resolveStaticIP(network.DefaultMeshAddressing(), records, inUse, "", PinConflictFail, network.IPAllocationSequential, true, selfMAC, zerolog.Nop())
+	if err != nil || got != "10.41.0.5" {
+		t.Errorf("resolveStaticIP() = %s, %v, want 10.41.0.5", got, err)
+	}
+
+	// A pin is the operator's choice and is claimed even if a client holds it
+	got, err = resolveStaticIP(network.DefaultMeshAddressing(), records, inUse, "10.41.0.3", PinConflictFail, network.IPAllocationSequential, true, selfMAC, zerolog.Nop())
+	if err != nil || got != "10.41.0.3" {
+		t.Errorf("resolveStaticIP(pin) = %s, %v, want 10.41.0.3", got, err)
+	}
+}
@@ -0,0 +1,270 @@
+package mgmt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/openmanet/go-alfred"
+	proto "github.com/openmanet/openmanetd/internal/api/openmanet/v1"
+	"github.com/openmanet/openmanetd/internal/network"
+)
+
+const (
+	// DefaultPoolGrowAt is the fraction of the pool that peak concurrent leases must
+	// reach for the pool to grow.
+	DefaultPoolGrowAt float64 = 0.8
+
+	// DefaultPoolQuietPeriod is how long usage must stay low before a pool is shrunk
+	// without an operator asking for it.
+	DefaultPoolQuietPeriod time.Duration = 7 * 24 * time.Hour
+
+	// DefaultPoolCeiling is the largest pool autosizing grows to: a pool at the
+	// default start offset of 100 that ends at .254 of the gateway /24.
+	DefaultPoolCeiling int = poolMaxOffset - network.DefaultDHCPStartOffset + 1
+
+	// poolMaxOffset is the highest offset a DHCP pool may reach. Pools stay within
+	// the gateway /24, the first of the mesh subnet; the node static range starts at
+	// the /24 after it.
+	poolMaxOffset int = 254
+
+	// poolHistoryWindow is the sliding window over which peak usage is taken.
+	poolHistoryWindow time.Duration = 24 * time.Hour
+
+	// poolBucketSize is the granularity of the usage history. The state file is
+	// written at most once per bucket unless the pool is resized.
+	poolBucketSize time.Duration = time.Hour
+)
+
+// PoolAutosizeConfig holds the thresholds for adaptive DHCP pool sizing.
+type PoolAutosizeConfig struct {
+	GrowAt      float64
+	QuietPeriod time.Duration
+	// Floor and Ceiling bound the pool size. Pools are never shrunk below Floor.
+	Floor   int
+	Ceiling int
+}
+
+// PoolBucket is the peak number of concurrent leases seen during one bucket.
+type PoolBucket struct {
+	Start time.Time `json:"start"`
+	Peak  int       `json:"peak"`
+}
+
+// PoolHistory is the usage history of one DHCP pool.
+type PoolHistory struct {
+	Buckets []PoolBucket `json:"buckets"`
+	// LastBusy is the last time usage was high enough that a pool half the current
+	// size would have had to grow again.
+	LastBusy time.Time `json:"lastBusy"`
+	// LastResize is when the pool was last resized, or when tracking started.
+	LastResize time.Time `json:"lastResize"`
+}
+
+// PoolAction is the outcome of a pool sizing decision.
+type PoolAction int
+
+const (
+	PoolKeep PoolAction = iota
+	PoolGrow
+	PoolShrink
+)
+
+func (a PoolAction) String() string {
+	switch a {
+	case PoolKeep:
+		return "keep"
+	case PoolGrow:
+		return "grow"
+	case PoolShrink:
+		return "shrink"
+	default:
+		return "unknown"
+	}
+}
+
+// PoolDecision is a pool sizing decision and the new pool limit it calls for.
+type PoolDecision struct {
+	Action PoolAction
+	Limit  int
+	Reason string
+}
+
+// growThreshold is the number of concurrent leases at which a pool of limit grows.
+func (c PoolAutosizeConfig) growThreshold(limit int) int {
+	return max(1, int(math.Ceil(float64(limit)*c.GrowAt)))
+}
+
+// shrinkTarget is the size a pool of limit shrinks to after a quiet period.
+func (c PoolAutosizeConfig) shrinkTarget(limit int) int {
+	return max(c.Floor, limit/2)
+}
+
+// Observe records the current number of concurrent leases in a pool of limit
+// addresses and drops buckets that have left the window.
+//
+// Returns true when a new bucket was started, which is when the history is worth
+// persisting.
+func (h *PoolHistory) Observe(cfg PoolAutosizeConfig, leases, limit int, now time.Time) bool {
+	if h.LastResize.IsZero() {
+		h.LastResize = now
+	}
+
+	if leases >= cfg.growThreshold(cfg.shrinkTarget(limit)) {
+		h.LastBusy = now
+	}
+
+	bucket := now.Truncate(poolBucketSize)
+	started := false
+	if n := len(h.Buckets); n == 0 || !h.Buckets[n-1].Start.Equal(bucket) {
+		h.Buckets = append(h.Buckets, PoolBucket{Start: bucket})
+		started = true
+	}
+	last := &h.Buckets[len(h.Buckets)-1]
+	last.Peak = max(last.Peak, leases)
+
+	cutoff := now.Add(-poolHistoryWindow)
+	for len(h.Buckets) > 0 && !h.Buckets[0].Start.After(cutoff) {
+		h.Buckets = h.Buckets[1:]
+	}
+
+	return started
+}
+
+// Peak returns the peak number of concurrent leases within the window.
+func (h *PoolHistory) Peak() int {
+	peak := 0
+	for _, b := range h.Buckets {
+		peak = max(peak, b.Peak)
+	}
+	return peak
+}
+
+// Decide returns how a pool of limit addresses should be resized.
+//
+// A pool grows, doubling up to the ceiling, once peak usage within the window reaches
+// GrowAt of it. Shrinking is conservative: when an operator asks, the pool shrinks to
+// the smallest size that would not immediately grow again; otherwise it is halved
+// only after QuietPeriod without busy usage or resizes. Pools never shrink below
+// Floor.
+func (c PoolAutosizeConfig) Decide(h *PoolHistory, limit int, shrinkRequested bool, now time.Time) PoolDecision {
+	peak := h.Peak()
+
+	if peak >= c.growThreshold(limit) {
+		target := min(limit*2, c.Ceiling)
+		if target <= limit {
+			return PoolDecision{Action: PoolKeep, Limit: limit, Reason: "pool is at the ceiling"}
+		}
+		return PoolDecision{Action: PoolGrow, Limit: target, Reason: fmt.Sprintf("peak of %d leases reached %.0f%% of the pool", peak, c.GrowAt*100)}
+	}
+
+	if shrinkRequested {
+		target := max(c.Floor, int(float64(peak)/c.GrowAt)+1)
+		if target < limit {
+			return PoolDecision{Action: PoolShrink, Limit: target, Reason: "requested by operator"}
+		}
+		return PoolDecision{Action: PoolKeep, Limit: limit, Reason: "pool is already as small as its usage allows"}
+	}
+
+	quietSince := h.LastResize
+	if h.LastBusy.After(quietSince) {
+		quietSince = h.LastBusy
+	}
+
+	if target := c.shrinkTarget(limit); target < limit && now.Sub(quietSince) >= c.QuietPeriod {
+		return PoolDecision{Action: PoolShrink, Limit: target, Reason: fmt.Sprintf("quiet since %s", quietSince.Format(time.RFC3339))}
+	}
+
+	return PoolDecision{Action: PoolKeep, Limit: limit}
+}
+
+// growPoolStart returns the start offset for this node's pool grown to limit. The
+// pool grows in place when the addresses after it are free; otherwise the lowest free
+// range from network.DefaultDHCPStartOffset up is taken, then the highest below it.
+// A range is free when it stays within the gateway /24 and covers neither the pool
+// nor the static IP of a peer, our own static IP, or an address offered to a node.
+//
+// Returns an error wrapping network.ErrNoAvailableAddress if there is no room.
+func growPoolStart(addressing network.MeshAddressing, records []alfred.Record, selfMAC string, start, limit int) (int, error) {
+	if limit <= 0 || limit > poolMaxOffset {
+		return 0, fmt.Errorf("%w: a pool of %d addresses does not fit in the gateway /24", network.ErrNoAvailableAddress, limit)
+	}
+
+	base := binary.BigEndian.Uint32(addressing.Subnet.IP.To4())
+	offset := func(ip string) (int, bool) {
+		addr := net.ParseIP(ip).To4()
+		if addr == nil {
+			return 0, false
+		}
+		off := int64(binary.BigEndian.Uint32(addr)) - int64(base)
+		return int(off), off >= 1 && off <= int64(poolMaxOffset)
+	}
+
+	type span struct{ first, last int }
+	var taken []span
+	for _, record := range records {
+		var addrRes proto.AddressReservation
+		if err := addrRes.UnmarshalVT(record.Data); err != nil {
+			continue
+		}
+
+		if off, ok := offset(addrRes.StaticIp); ok {
+			taken = append(taken, span{off, off})
+		}
+		for _, offer := range addrRes.Offers {
+			if off, ok := offset(offer.GetStaticIp()); ok {
+				taken = append(taken, span{off, off})
+			}
+		}
+
+		if addrRes.Mac == selfMAC || addrRes.RequestingReservation {
+			continue
+		}
+		peerStart, err1 := strconv.Atoi(addrRes.UciDhcpStart)
+		peerLimit, err2 := strconv.Atoi(addrRes.UciDhcpLimit)
+		if err1 != nil || err2 != nil || peerStart <= 0 || peerLimit <= 0 {
+			continue
+		}
+		taken = append(taken, span{peerStart, peerStart + peerLimit - 1})
+	}
+
+	free := func(s int) bool {
+		if s < 1 || s+limit-1 > poolMaxOffset {
+			return false
+		}
+		return !slices.ContainsFunc(taken, func(t span) bool {
+			return s <= t.last && t.first <= s+limit-1
+		})
+	}
+
+	if free(start) {
+		return start, nil
+	}
+	for s := network.DefaultDHCPStartOffset; s+limit-1 <= poolMaxOffset; s++ {
+		if free(s) {
+			return s, nil
+		}
+	}
+	for s := min(network.DefaultDHCPStartOffset-1, poolMaxOffset-limit+1); s >= 1; s-- {
+		if free(s) {
+			return s, nil
+		}
+	}
+
+	return 0, fmt.Errorf("%w: no range of %d addresses left in the gateway /24 of %s", network.ErrNoAvailableAddress, limit, addressing.Subnet)
+}
+
+// poolGrowthAllowed reports whether giving this node the pool described by self keeps
+// mesh-wide address usage of the subnet of addressing below the critical threshold.
+func poolGrowthAllowed(addressing network.MeshAddressing, peers []Reservation, self Reservation, th CapacityThresholds) (bool, *CapacityReport, error) {
+	report, err := AnalyzeCapacity(append(peers, self), addressing.NetworkAddress(), addressing.Netmask())
+	if err != nil {
+		return false, nil, err
+	}
+
+	return report.Level(th) != CapacityCritical, report, nil
+}
@@ -0,0 +1,289 @@
+package mgmt
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/openmanet/go-alfred"
+	proto "github.com/openmanet/openmanetd/internal/api/openmanet/v1"
+	"github.com/openmanet/openmanetd/internal/network"
+)
+
+func poolRecord(t *testing.T, mac string, start, limit int) alfred.Record {
+	t.Helper()
+
+	data, err := (&proto.AddressReservation{
+		Mac:          mac,
+		UciDhcpStart: strconv.Itoa(start),
+		UciDhcpLimit: strconv.Itoa(limit),
+	}).MarshalVT()
+	if err != nil {
+		t.Fatalf("MarshalVT() error = %v", err)
+	}
+
+	return alfred.Record{Data: data}
+}
+
+func testAutosizeConfig() PoolAutosizeConfig {
+	return PoolAutosizeConfig{
+		GrowAt:      DefaultPoolGrowAt,
+		QuietPeriod: DefaultPoolQuietPeriod,
+		Floor:       16,
+		Ceiling:     DefaultPoolCeiling,
+	}
+}
+
+// observeHourly feeds the history one observation per hour for d, starting at from.
+func observeHourly(h *PoolHistory, cfg PoolAutosizeConfig, from time.Time, d time.Duration, leases, limit int) time.Time {
+	now := from
+	for ; now.Sub(from) < d; now = now.Add(time.Hour) {
+		h.Observe(cfg, leases, limit, now)
+	}
+	return now
+}
+
+func TestPoolHistory_Observe(t *testing.T) {
+	cfg := testAutosizeConfig()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	h := &PoolHistory{}
+
+	if !h.Observe(cfg, 5, 16, start) {
+		t.Error("Observe() = false for the first observation, want a new bucket")
+	}
+	if h.Observe(cfg, 9, 16, start.Add(10*time.Minute)) {
+		t.Error("Observe() = true within the same bucket")
+	}
+	if !h.LastResize.Equal(start) {
+		t.Errorf("LastResize = %v, want tracking start %v", h.LastResize, start)
+	}
+	if got := h.Peak(); got != 9 {
+		t.Errorf("Peak() = %d, want 9", got)
+	}
+
+	// The busy hour leaves the window after a day
+	observeHourly(h, cfg, start.Add(time.Hour), 25*time.Hour, 2, 16)
+	if got := h.Peak(); got != 2 {
+		t.Errorf("Peak() = %d after the window passed, want 2", got)
+	}
+	if len(h.Buckets) > 24 {
+		t.Errorf("len(Buckets) = %d, want at most 24", len(h.Buckets))
+	}
+}
+
+func TestPoolAutosize_Grow(t *testing.T) {
+	cfg := testAutosizeConfig()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		leases int
+		limit  int
+		action PoolAction
+		want   int
+	}{
+		{"below high-water mark", 12, 16, PoolKeep, 16},
+		{"at high-water mark", 13, 16, PoolGrow, 32},
+		{"doubling is capped at the ceiling", 100, 120, PoolGrow, DefaultPoolCeiling},
+		{"128 grows to the ceiling, not 256", 110, 128, PoolGrow, DefaultPoolCeiling},
+		{"at the ceiling", 150, DefaultPoolCeiling, PoolKeep, DefaultPoolCeiling},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &PoolHistory{}
+			h.Observe(cfg, tt.leases, tt.limit, now)
+
+			got := cfg.Decide(h, tt.limit, false, now)
+			if got.Action != tt.action || got.Limit != tt.want {
+				t.Errorf("Decide() = %v to %d, want %v to %d", got.Action, got.Limit, tt.action, tt.want)
+			}
+		})
+	}
+}
+
+func TestPoolAutosize_QuietShrink(t *testing.T) {
+	cfg := testAutosizeConfig()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("shrinks only after the quiet period", func(t *testing.T) {
+		h := &PoolHistory{}
+		now := observeHourly(h, cfg, start, cfg.QuietPeriod-time.Hour, 3, 64)
+
+		if got := cfg.Decide(h, 64, false, now); got.Action != PoolKeep {
+			t.Fatalf("Decide() = %v before the quiet period ended, want keep", got.Action)
+		}
+
+		now = observeHourly(h, cfg, now, time.Hour, 3, 64)
+		got := cfg.Decide(h, 64, false, now)
+		if got.Action != PoolShrink || got.Limit != 32 {
+			t.Errorf("Decide() = %v to %d, want shrink to 32", got.Action, got.Limit)
+		}
+	})
+
+	t.Run("busy usage restarts the quiet period", func(t *testing.T) {
+		h := &PoolHistory{}
+		now := observeHourly(h, cfg, start, 5*24*time.Hour, 3, 64)
+		// Not enough to grow 64, but a pool of 32 would have to grow again
+		now = observeHourly(h, cfg, now, time.Hour, 30, 64)
+		now = observeHourly(h, cfg, now, 3*24*time.Hour, 3, 64)
+
+		if got := cfg.Decide(h, 64, false, now); got.Action != PoolKeep {
+			t.Errorf("Decide() = %v three days after busy usage, want keep", got.Action)
+		}
+	})
+
+	t.Run("a resize restarts the quiet period", func(t *testing.T) {
+		h := &PoolHistory{}
+		now := observeHourly(h, cfg, start, 8*24*time.Hour, 3, 64)
+		h.LastResize = now.Add(-24 * time.Hour)
+
+		if got := cfg.Decide(h, 64, false, now); got.Action != PoolKeep {
+			t.Errorf("Decide() = %v a day after a resize, want keep", got.Action)
+		}
+	})
+
+	t.Run("never shrinks below the floor", func(t *testing.T) {
+		h := &PoolHistory{}
+		now := observeHourly(h, cfg, start, 30*24*time.Hour, 0, 16)
+
+		if got := cfg.Decide(h, 16, false, now); got.Action != PoolKeep {
+			t.Errorf("Decide() = %v at the floor, want keep", got.Action)
+		}
+
+		got := cfg.Decide(h, 24, false, now)
+		if got.Action != PoolShrink || got.Limit != 16 {
+			t.Errorf("Decide() = %v to %d, want shrink to the floor", got.Action, got.Limit)
+		}
+	})
+}
+
+func TestPoolAutosize_OperatorShrink(t *testing.T) {
+	cfg := testAutosizeConfig()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		peak   int
+		limit  int
+		action PoolAction
+		want   int
+	}{
+		{"shrinks to the floor when idle", 10, 128, PoolShrink, 16},
+		{"keeps headroom for the peak", 40, 128, PoolShrink, 51},
+		{"already minimal", 40, 51, PoolKeep, 51},
+		{"busy pool grows instead", 110, 128, PoolGrow, DefaultPoolCeiling},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &PoolHistory{}
+			h.Observe(cfg, tt.peak, tt.limit, now)
+
+			got := cfg.Decide(h, tt.limit, true, now)
+			if got.Action != tt.action || got.Limit != tt.want {
+				t.Fatalf("Decide() = %v to %d, want %v to %d", got.Action, got.Limit, tt.action, tt.want)
+			}
+			if got.Action == PoolShrink && tt.peak >= cfg.growThreshold(got.Limit) {
+				t.Errorf("shrunk pool of %d would grow again at peak %d", got.Limit, tt.peak)
+			}
+		})
+	}
+}
+
+func TestGrowPoolStart(t *testing.T) {
+	const selfMAC = "aa:bb:cc:dd:ee:ff"
+
+	t.Run("grows in place", func(t *testing.T) {
+		records := []alfred.Record{
+			poolRecord(t, selfMAC, 100, 16),
+			poolRecord(t, "aa:bb:cc:dd:ee:01", 200, 16),
+		}
+
+		got, err := growPoolStart(network.DefaultMeshAddressing(), records, selfMAC, 100, 32)
+		if err != nil || got != 100 {
+			t.Errorf("growPoolStart() = %d, %v; want 100", got, err)
+		}
+	})
+
+	t.Run("moves when a neighbour is in the way", func(t *testing.T) {
+		records := []alfred.Record{
+			poolRecord(t, selfMAC, 100, 16),
+			poolRecord(t, "aa:bb:cc:dd:ee:01", 116, 16),
+		}
+
+		got, err := growPoolStart(network.DefaultMeshAddressing(), records, selfMAC, 100, 32)
+		if err != nil {
+			t.Fatalf("growPoolStart() error = %v", err)
+		}
+		if got < 132 && got+32 > 116 {
+			t.Errorf("growPoolStart() = %d, overlaps the neighbour at 116-131", got)
+		}
+	})
+
+	t.Run("grows to the ceiling within the gateway /24", func(t *testing.T) {
+		records := []alfred.Record{poolRecord(t, selfMAC, 100, 128)}
+
+		got, err := growPoolStart(network.DefaultMeshAddressing(), records, selfMAC, 100, DefaultPoolCeiling)
+		if err != nil || got+DefaultPoolCeiling-1 != 254 {
+			t.Errorf("growPoolStart() = %d, %v; want a pool ending at .254", got, err)
+		}
+
+		// 256 addresses from 100 reach 10.41.1.99, into the node static range
+		if _, err := growPoolStart(network.DefaultMeshAddressing(), records, selfMAC, 100, 256); !errors.Is(err, network.ErrNoAvailableAddress) {
+			t.Errorf("growPoolStart() to 256 error = %v, want ErrNoAvailableAddress", err)
+		}
+	})
+
+	t.Run("moves off peer static IPs and offers", func(t *testing.T) {
+		peer, err := (&proto.AddressReservation{
+			Mac:      "aa:bb:cc:dd:ee:01",
+			StaticIp: "10.41.0.200",
+			Offers:   []*proto.BlockOffer{{TargetMac: "aa:bb:cc:dd:ee:02", StaticIp: "10.41.0.30"}},
+		}).MarshalVT()
+		if err != nil {
+			t.Fatal(err)
+		}
+		records := []alfred.Record{poolRecord(t, selfMAC, 100, 64), {Data: peer}}
+
+		got, err := growPoolStart(network.DefaultMeshAddressing(), records, selfMAC, 100, 128)
+		if err != nil {
+			t.Fatalf("growPoolStart() error = %v", err)
+		}
+		if end := got + 127; got <= 200 && end >= 200 || got <= 30 && end >= 30 || end > 254 {
+			t.Errorf("growPoolStart() = %d, want a range in the /24 covering neither .200 nor .30", got)
+		}
+	})
+
+	t.Run("no space to grow", func(t *testing.T) {
+		records := []alfred.Record{
+			poolRecord(t, selfMAC, 100, 16),
+			poolRecord(t, "aa:bb:cc:dd:ee:01", 1, 99),
+			poolRecord(t, "aa:bb:cc:dd:ee:02", 116, 65419),
+		}
+
+		_, err := growPoolStart(network.DefaultMeshAddressing(), records, selfMAC, 100, 32)
+		if !errors.Is(err, network.ErrNoAvailableAddress) {
+			t.Errorf("growPoolStart() error = %v, want ErrNoAvailableAddress", err)
+		}
+	})
+}
+
+func TestPoolGrowthAllowed(t *testing.T) {
+	th := CapacityThresholds{WarnPct: DefaultCapacityWarnPct, CriticalPct: DefaultCapacityCriticalPct}
+	peers := []Reservation{{Mac: "aa:bb:cc:dd:ee:01", StaticIP: "10.41.0.1", DHCPStart: 1000, DHCPLimit: 60000}}
+
+	allowed, _, err := poolGrowthAllowed(network.DefaultMeshAddressing(), peers, Reservation{Mac: "aa:bb:cc:dd:ee:ff", DHCPStart: 100, DHCPLimit: 256}, th)
+	if err != nil || !allowed {
+		t.Errorf("poolGrowthAllowed() = %v, %v; want growth allowed", allowed, err)
+	}
+
+	allowed, report, err := poolGrowthAllowed(network.DefaultMeshAddressing(), peers, Reservation{Mac: "aa:bb:cc:dd:ee:ff", DHCPStart: 61000, DHCPLimit: 4096}, th)
+	if err != nil || allowed {
+		t.Errorf("poolGrowthAllowed() = %v, %v; want growth refused", allowed, err)
+	}
+	if report == nil || report.DHCPPct < th.CriticalPct {
+		t.Errorf("report = %+v, want critical DHCP usage", report)
+	}
+}
@@ -0,0 +1,42 @@
+package mgmt
+
+import (
+	"github.com/openmanet/openmanetd/internal/network"
+)
+
+// Router advertisement roles reported in node data.
+const (
+	// RARoleGateway announces the node as an IPv6 default router to its clients.
+	RARoleGateway string = "gateway"
+	// RARoleClient advertises prefixes only, leaving default routing to gateways.
+	RARoleClient string = "client"
+)
+
+// applyRARole makes the router advertisements of the DHCP section match the node's
+// gateway role. Only gateways announce themselves as default router; a node without
+// an upstream that did so would draw dual-stack clients onto a dead IPv6 path. A
+// gateway that does not send router advertisements is left alone.
+//
+// Returns true if the configuration changed and dnsmasq needs a reload.
+func applyRARole(section string, gateway bool, reader network.DHCPConfigReader) (bool, error) {
+	if gateway {
+		mode, err := network.GetRAModeWithReader(section, reader)
+		if err != nil {
+			return false, err
+		}
+		if mode == "" || mode == "disabled" {
+			return false, nil
+		}
+	}
+
+	return network.SetRADefaultWithReader(section, gateway, reader)
+}
+
+// currentRARole returns the router advertisement role the DHCP section is configured for.
+func currentRARole(section string, reader network.DHCPConfigReader) string {
+	config, err := network.GetDHCPConfigWithReader(section, reader)
+	if err != nil || config.RaDefault == "" || config.RaDefault == "0" {
+		return RARoleClient
+	}
+	return RARoleGateway
+}
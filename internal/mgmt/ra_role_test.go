@@ -0,0 +1,98 @@
+package mgmt
+
+import (
+	"testing"
+
+	"github.com/digineo/go-uci/v2"
+)
+
+// mockDHCPReader is a minimal in-memory DHCPConfigReader for a single config.
+type mockDHCPReader struct {
+	options map[string][]string // section.option -> values
+	commits int
+}
+
+func newMockDHCPReader() *mockDHCPReader {
+	return &mockDHCPReader{options: make(map[string][]string)}
+}
+
+func (m *mockDHCPReader) GetSections(config, secType string) ([]string, error) {
+	return nil, nil
+}
+
+func (m *mockDHCPReader) Get(config, section, option string) ([]string, bool) {
+	values, ok := m.options[section+"."+option]
+	return values, ok
+}
+
+func (m *mockDHCPReader) SetType(config, section, option string, typ uci.OptionType, values ...string) error {
+	m.options[section+"."+option] = values
+	return nil
+}
+
+func (m *mockDHCPReader) Del(config, section, option string) error {
+	delete(m.options, section+"."+option)
+	return nil
+}
+
+func (m *mockDHCPReader) AddSection(config, section, typ string) error { return nil }
+func (m *mockDHCPReader) DelSection(config, section string) error      { return nil }
+func (m *mockDHCPReader) ReloadConfig() error                          { return nil }
+
+func (m *mockDHCPReader) Commit() error {
+	m.commits++
+	return nil
+}
+
+func TestApplyRARole_RoleChanges(t *testing.T) {
+	reader := newMockDHCPReader()
+	_ = reader.SetType("dhcp", "ahwlan", "ra", uci.TypeOption, "server")
+	_ = reader.SetType("dhcp", "ahwlan", "ra_default", uci.TypeOption, "1")
+
+	steps := []struct {
+		name        string
+		gateway     bool
+		wantChanged bool
+		wantRole    string
+	}{
+		{"gateway keeps its announcement", true, false, RARoleGateway},
+		{"demoted to client", false, true, RARoleClient},
+		{"client stays quiet", false, false, RARoleClient},
+		{"promoted to gateway", true, true, RARoleGateway},
+		{"demoted again", false, true, RARoleClient},
+	}
+
+	for _, step := range steps {
+		commits := reader.commits
+		changed, err := applyRARole("ahwlan", step.gateway, reader)
+		if err != nil {
+			t.Fatalf("%s: applyRARole() error = %v", step.name, err)
+		}
+		if changed != step.wantChanged {
+			t.Errorf("%s: changed = %v, want %v", step.name, changed, step.wantChanged)
+		}
+		if committed := reader.commits > commits; committed != step.wantChanged {
+			t.Errorf("%s: committed = %v, want %v", step.name, committed, step.wantChanged)
+		}
+		if role := currentRARole("ahwlan", reader); role != step.wantRole {
+			t.Errorf("%s: role = %q, want %q", step.name, role, step.wantRole)
+		}
+		// Clients drop the option entirely rather than setting it to 0
+		if _, ok := reader.Get("dhcp", "ahwlan", "ra_default"); !step.gateway && ok {
+			t.Errorf("%s: ra_default left in place on a client", step.name)
+		}
+	}
+}
+
+func TestApplyRARole_GatewayWithoutRA(t *testing.T) {
+	reader := newMockDHCPReader()
+	_ = reader.SetType("dhcp", "ahwlan", "ra", uci.TypeOption, "disabled")
+
+	changed, err := applyRARole("ahwlan", true, reader)
+	if err != nil || changed {
+		t.Fatalf("applyRARole() = %v, %v; want no change", changed, err)
+	}
+	if role := currentRARole("ahwlan", reader); role != RARoleClient {
+		t.Errorf("role = %q, want %q", role, RARoleClient)
+	}
+}
@@ -0,0 +1,35 @@
+package mgmt
+
+import (
+	"net"
+
+	"github.com/openmanet/openmanetd/internal/network"
+)
+
+// meshScope returns the interfaces and subnets that make up the mesh under t, with
+// the IPv4 subnet of addressing.
+func meshScope(t Tunables, addressing network.MeshAddressing) ([]string, []*net.IPNet) {
+	var ifaces []string
+	for _, name := range []string{t.IFace, t.BatInterface} {
+		if name != "" {
+			ifaces = append(ifaces, name)
+		}
+	}
+
+	return ifaces, []*net.IPNet{addressing.Subnet, network.MeshULASubnet()}
+}
+
+// ClassifyDestination returns how the kernel would reach ip, taking the configured
+// mesh interface and batman-adv interface as the mesh. See
+// network.ClassifyDestinationOn.
+func (m *ManagementConfig) ClassifyDestination(ip net.IP) (network.DestClass, *network.Route, error) {
+	ifaces, subnets := meshScope(m.Tunables(), m.addressing())
+	return network.ClassifyDestinationOn(ip, ifaces, subnets)
+}
+
+// IsReachableViaMesh reports whether the kernel would send traffic for ip over the
+// configured mesh interfaces. See network.IsReachableViaMesh.
+func (m *ManagementConfig) IsReachableViaMesh(ip net.IP) (bool, *network.Route, error) {
+	ifaces, subnets := meshScope(m.Tunables(), m.addressing())
+	return network.IsReachableViaMesh(ip, ifaces, subnets)
+}
@@ -0,0 +1,186 @@
+package mgmt
+
+import (
+	"sync"
+	"time"
+
+	"github.com/openmanet/go-alfred"
+	"github.com/rs/zerolog"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	// DefaultMaxRecordsPerTick is how many records of one data type are processed per
+	// receive tick. A mesh of a few hundred nodes publishes one record each.
+	DefaultMaxRecordsPerTick int = 1000
+	// DefaultMaxRecordSize is the largest record payload that is decoded. Our records
+	// are a few hundred bytes at most.
+	DefaultMaxRecordSize int = 4096
+	// DefaultMaxRecordsPerSource is how many records claiming the same publisher are
+	// processed per tick. Alfred keeps one record per publisher and data type, so
+	// more than a few means stale replicas at best and a flooder at worst.
+	DefaultMaxRecordsPerSource int = 8
+	// DefaultRecordLimitWarnInterval is the minimum time between warnings about
+	// dropped records for one data type.
+	DefaultRecordLimitWarnInterval time.Duration = 5 * time.Minute
+)
+
+// RecordLimits bounds the work one receive tick does for one data type.
+type RecordLimits struct {
+	MaxRecords   int
+	MaxSize      int
+	MaxPerSource int
+}
+
+// RecordLimitStats counts the records dropped by a RecordLimiter since it was created.
+type RecordLimitStats struct {
+	Oversized  uint64
+	OverSource uint64
+	OverTick   uint64
+}
+
+// RecordLimiter keeps a misbehaving node from making a receive tick allocate and
+// decode without bound. Records are dropped before they are decoded if they are too
+// large, if their publisher already used its share of the tick, or once the tick is
+// full. The per-publisher share is applied first, so a node flooding the mesh cannot
+// crowd out the records of other nodes.
+//
+// Publishers are identified by the MAC in field 1 of the payload, which every record
+// type carries, read without decoding the rest of the record.
+type RecordLimiter struct {
+	limits    RecordLimits
+	warnEvery time.Duration
+	log       zerolog.Logger
+	now       func() time.Time
+
+	mu       sync.Mutex
+	stats    RecordLimitStats
+	lastWarn map[string]time.Time
+	dropped  map[string]uint64
+}
+
+// NewRecordLimiter creates a limiter; limits that are not positive take their default.
+func NewRecordLimiter(limits RecordLimits, log zerolog.Logger) *RecordLimiter {
+	if limits.MaxRecords <= 0 {
+		limits.MaxRecords = DefaultMaxRecordsPerTick
+	}
+	if limits.MaxSize <= 0 {
+		limits.MaxSize = DefaultMaxRecordSize
+	}
+	if limits.MaxPerSource <= 0 {
+		limits.MaxPerSource = DefaultMaxRecordsPerSource
+	}
+
+	return &RecordLimiter{
+		limits:    limits,
+		warnEvery: DefaultRecordLimitWarnInterval,
+		log:       log,
+		now:       time.Now,
+		lastWarn:  make(map[string]time.Time),
+		dropped:   make(map[string]uint64),
+	}
+}
+
+// Limit returns the records of one receive tick that are within the limits, in their
+// original order. kind names the data type in logs.
+func (l *RecordLimiter) Limit(kind string, records []alfred.Record) []alfred.Record {
+	var (
+		stats   RecordLimitStats
+		kept    = make([]alfred.Record, 0, min(len(records), l.limits.MaxRecords))
+		sources = make(map[string]int)
+	)
+
+	for i, rec := range records {
+		if len(kept) >= l.limits.MaxRecords {
+			stats.OverTick += uint64(len(records) - i)
+			break
+		}
+
+		if len(rec.Data) > l.limits.MaxSize {
+			stats.Oversized++
+			continue
+		}
+
+		// Every source that gets here has a record kept, so the map stays within
+		// MaxRecords entries however many sources a flooder makes up
+		source := recordSource(rec.Data)
+		if sources[string(source)] >= l.limits.MaxPerSource {
+			stats.OverSource++
+			continue
+		}
+		sources[string(source)]++
+
+		kept = append(kept, rec)
+	}
+
+	l.record(kind, stats)
+
+	return kept
+}
+
+// Stats returns the number of records dropped so far.
+func (l *RecordLimiter) Stats() RecordLimitStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stats
+}
+
+func (l *RecordLimiter) record(kind string, tick RecordLimitStats) {
+	total := tick.Oversized + tick.OverSource + tick.OverTick
+	if total == 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.stats.Oversized += tick.Oversized
+	l.stats.OverSource += tick.OverSource
+	l.stats.OverTick += tick.OverTick
+	l.dropped[kind] += total
+
+	now := l.now()
+	if last, ok := l.lastWarn[kind]; ok && now.Sub(last) < l.warnEvery {
+		return
+	}
+
+	l.log.Warn().
+		Str("kind", kind).
+		Uint64("oversized", tick.Oversized).
+		Uint64("overSourceLimit", tick.OverSource).
+		Uint64("overTickLimit", tick.OverTick).
+		Uint64("droppedSinceLastWarning", l.dropped[kind]).
+		Int("maxRecordsPerTick", l.limits.MaxRecords).
+		Msg("Dropping alfred records over the receive limits")
+
+	l.lastWarn[kind] = now
+	l.dropped[kind] = 0
+}
+
+// recordSource returns the publisher MAC in field 1 of a record payload, or nil if
+// the payload has none or is malformed. The result aliases data.
+func recordSource(data []byte) []byte {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil
+		}
+		data = data[n:]
+
+		if num == 1 && typ == protowire.BytesType {
+			v, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return nil
+			}
+			return v
+		}
+
+		n = protowire.ConsumeFieldValue(num, typ, data)
+		if n < 0 {
+			return nil
+		}
+		data = data[n:]
+	}
+
+	return nil
+}
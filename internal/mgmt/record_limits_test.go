@@ -0,0 +1,191 @@
+package mgmt
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/openmanet/go-alfred"
+	proto "github.com/openmanet/openmanetd/internal/api/openmanet/v1"
+	"github.com/rs/zerolog"
+)
+
+func limitTestRecord(tb testing.TB, mac, ip string) alfred.Record {
+	tb.Helper()
+
+	data, err := (&proto.AddressReservation{Mac: mac, StaticIp: ip}).MarshalVT()
+	if err != nil {
+		tb.Fatalf("MarshalVT() error = %v", err)
+	}
+	return alfred.Record{Data: data}
+}
+
+// floodRecords returns n records claiming to come from mac.
+func floodRecords(tb testing.TB, mac string, n int) []alfred.Record {
+	tb.Helper()
+
+	records := make([]alfred.Record, n)
+	for i := range records {
+		records[i] = limitTestRecord(tb, mac, fmt.Sprintf("10.41.%d.%d", 1+i/254%250, 1+i%254))
+	}
+	return records
+}
+
+func TestRecordLimiter_Caps(t *testing.T) {
+	limiter := NewRecordLimiter(RecordLimits{MaxRecords: 3, MaxSize: 64, MaxPerSource: 2}, zerolog.Nop())
+
+	huge := limitTestRecord(t, "aa:bb:cc:dd:ee:09", "10.41.9.9")
+	huge.Data = append(huge.Data, make([]byte, 100)...)
+
+	records := []alfred.Record{
+		limitTestRecord(t, "aa:bb:cc:dd:ee:01", "10.41.1.1"),
+		huge,
+		limitTestRecord(t, "aa:bb:cc:dd:ee:01", "10.41.1.2"),
+		limitTestRecord(t, "aa:bb:cc:dd:ee:01", "10.41.1.3"),
+		limitTestRecord(t, "aa:bb:cc:dd:ee:02", "10.41.2.1"),
+		limitTestRecord(t, "aa:bb:cc:dd:ee:03", "10.41.3.1"),
+		limitTestRecord(t, "aa:bb:cc:dd:ee:04", "10.41.4.1"),
+	}
+
+	kept := limiter.Limit("reservation", records)
+
+	decoded, err := NewRecordTracker(DefaultReservationTTL).DecodeReservationRecords(kept)
+	if err != nil {
+		t.Fatalf("DecodeReservationRecords() error = %v", err)
+	}
+	var got []string
+	for _, rec := range decoded {
+		got = append(got, rec.Reservation.StaticIp)
+	}
+	want := []string{"10.41.1.1", "10.41.1.2", "10.41.2.1"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("kept %v, want %v", got, want)
+	}
+
+	stats := limiter.Stats()
+	if stats != (RecordLimitStats{Oversized: 1, OverSource: 1, OverTick: 2}) {
+		t.Errorf("Stats() = %+v, want 1 oversized, 1 over source, 2 over tick", stats)
+	}
+
+	// Counts accumulate across ticks
+	limiter.Limit("reservation", records)
+	if got := limiter.Stats().OverTick; got != 4 {
+		t.Errorf("Stats().OverTick = %d after two ticks, want 4", got)
+	}
+}
+
+func TestRecordLimiter_FloodDoesNotCrowdOut(t *testing.T) {
+	limiter := NewRecordLimiter(RecordLimits{}, zerolog.Nop())
+
+	// The flooder's records come first, as they would if its MAC sorts first
+	records := floodRecords(t, "aa:bb:cc:dd:ee:ff", 50000)
+	for i := range 20 {
+		records = append(records, limitTestRecord(t, fmt.Sprintf("aa:bb:cc:dd:ee:%02x", i), fmt.Sprintf("10.41.200.%d", i+1)))
+	}
+
+	kept := limiter.Limit("reservation", records)
+	if want := DefaultMaxRecordsPerSource + 20; len(kept) != want {
+		t.Fatalf("kept %d records, want %d", len(kept), want)
+	}
+
+	decoded, _ := NewRecordTracker(DefaultReservationTTL).DecodeReservationRecords(kept)
+	legitimate := 0
+	for _, rec := range decoded {
+		if rec.Source != "aa:bb:cc:dd:ee:ff" {
+			legitimate++
+		}
+	}
+	if legitimate != 20 {
+		t.Errorf("kept %d legitimate records, want 20", legitimate)
+	}
+
+	if got := limiter.Stats().OverSource; got != uint64(50000-DefaultMaxRecordsPerSource) {
+		t.Errorf("Stats().OverSource = %d, want %d", got, 50000-DefaultMaxRecordsPerSource)
+	}
+}
+
+func TestRecordLimiter_ManySources(t *testing.T) {
+	limiter := NewRecordLimiter(RecordLimits{MaxRecords: 100}, zerolog.Nop())
+
+	records := make([]alfred.Record, 5000)
+	for i := range records {
+		records[i] = limitTestRecord(t, fmt.Sprintf("02:00:00:00:%02x:%02x", i/256, i%256), "10.41.1.1")
+	}
+
+	if kept := limiter.Limit("reservation", records); len(kept) != 100 {
+		t.Errorf("kept %d records, want 100", len(kept))
+	}
+	if got := limiter.Stats().OverTick; got != 4900 {
+		t.Errorf("Stats().OverTick = %d, want 4900", got)
+	}
+}
+
+func TestRecordLimiter_BoundedAllocations(t *testing.T) {
+	small := floodRecords(t, "aa:bb:cc:dd:ee:ff", 5000)
+	large := floodRecords(t, "aa:bb:cc:dd:ee:ff", 50000)
+
+	limiter := NewRecordLimiter(RecordLimits{}, zerolog.Nop())
+	allocsSmall := testing.AllocsPerRun(10, func() { limiter.Limit("reservation", small) })
+	allocsLarge := testing.AllocsPerRun(10, func() { limiter.Limit("reservation", large) })
+
+	// Ten times the records must not cost more allocations
+	if allocsLarge > allocsSmall {
+		t.Errorf("Limit() allocated %.0f times for 50k records and %.0f for 5k", allocsLarge, allocsSmall)
+	}
+}
+
+func TestRecordLimiter_WarningThrottled(t *testing.T) {
+	var buf bytes.Buffer
+	clock := newFakeClock()
+	limiter := NewRecordLimiter(RecordLimits{MaxRecords: 1}, zerolog.New(&buf))
+	limiter.now = clock.Now
+
+	records := floodRecords(t, "aa:bb:cc:dd:ee:ff", 3)
+	limiter.Limit("reservation", records)
+	limiter.Limit("reservation", records)
+	limiter.Limit("gateway", records)
+	clock.Advance(DefaultRecordLimitWarnInterval)
+	limiter.Limit("reservation", records)
+
+	if got := strings.Count(buf.String(), "Dropping alfred records"); got != 3 {
+		t.Errorf("warnings = %d, want 3:\n%s", got, buf.String())
+	}
+	if !strings.Contains(buf.String(), `"droppedSinceLastWarning":4`) {
+		t.Errorf("last warning does not count the suppressed drops:\n%s", buf.String())
+	}
+}
+
+func TestRecordSource(t *testing.T) {
+	rec := limitTestRecord(t, "aa:bb:cc:dd:ee:01", "10.41.1.1")
+	if got := string(recordSource(rec.Data)); got != "aa:bb:cc:dd:ee:01" {
+		t.Errorf("recordSource() = %q", got)
+	}
+
+	// Field 1 after other fields
+	data, _ := (&proto.AddressReservation{StaticIp: "10.41.1.1", Hostname: "x"}).MarshalVT()
+	data = append(data, 0x0a, 0x01, 'm')
+	if got := string(recordSource(data)); got != "m" {
+		t.Errorf("recordSource() = %q, want m", got)
+	}
+
+	for _, data := range [][]byte{nil, {0xff}, {0x0a, 0x20, 'a'}} {
+		if got := recordSource(data); got != nil {
+			t.Errorf("recordSource(% x) = %q, want nil", data, got)
+		}
+	}
+}
+
+func BenchmarkRecordLimiter_Flood(b *testing.B) {
+	records := floodRecords(b, "aa:bb:cc:dd:ee:ff", 50000)
+	limiter := NewRecordLimiter(RecordLimits{}, zerolog.Nop())
+	tracker := NewRecordTracker(DefaultReservationTTL)
+
+	b.ReportAllocs()
+	for b.Loop() {
+		kept := limiter.Limit("reservation", records)
+		if _, err := tracker.DecodeReservationRecords(kept); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
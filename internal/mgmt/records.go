@@ -0,0 +1,256 @@
+package mgmt
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/openmanet/go-alfred"
+	proto "github.com/openmanet/openmanetd/internal/api/openmanet/v1"
+)
+
+// RecordMeta describes where a decoded alfred record came from and how old it is.
+//
+// The alfred client only hands us the record payload, so Source is the publisher MAC
+// carried in the payload and the timestamps are tracked locally by RecordTracker:
+// FirstSeen is when this exact payload from Source was first received and LastSeen
+// when it was most recently received.
+type RecordMeta struct {
+	Source    string
+	FirstSeen time.Time
+	LastSeen  time.Time
+}
+
+// GatewayRecord is a decoded gateway announcement.
+type GatewayRecord struct {
+	Gateway *proto.Gateway
+	RecordMeta
+}
+
+// ReservationRecord is a decoded address reservation.
+type ReservationRecord struct {
+	Reservation *proto.AddressReservation
+	RecordMeta
+}
+
+type recordKey struct {
+	source string
+	sum    [sha256.Size]byte
+}
+
+type recordSeen struct {
+	first time.Time
+	last  time.Time
+}
+
+// RecordTracker remembers when each distinct record payload was first and last seen,
+// keyed by publisher and payload hash. A publisher that changes its record gets a new
+// entry, so its newest payload has the latest FirstSeen even while stale alfred
+// replicas keep serving the old one.
+type RecordTracker struct {
+	mu   sync.Mutex
+	seen map[recordKey]*recordSeen
+	ttl  time.Duration
+
+	// now is overridable for tests.
+	now func() time.Time
+}
+
+// NewRecordTracker creates a tracker that forgets payloads not seen for ttl.
+func NewRecordTracker(ttl time.Duration) *RecordTracker {
+	return &RecordTracker{
+		seen: make(map[recordKey]*recordSeen),
+		ttl:  ttl,
+		now:  time.Now,
+	}
+}
+
+// touch records that data from source was received now and returns its metadata.
+func (t *RecordTracker) touch(source string, data []byte) RecordMeta {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	key := recordKey{source: source, sum: sha256.Sum256(data)}
+
+	entry, ok := t.seen[key]
+	if !ok || now.Sub(entry.last) >= t.ttl {
+		entry = &recordSeen{first: now}
+		t.seen[key] = entry
+	}
+	entry.last = now
+
+	return RecordMeta{Source: source, FirstSeen: entry.first, LastSeen: entry.last}
+}
+
+// Prune forgets payloads that have not been seen for the tracker's TTL.
+func (t *RecordTracker) Prune() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	for key, entry := range t.seen {
+		if now.Sub(entry.last) >= t.ttl {
+			delete(t.seen, key)
+		}
+	}
+}
+
+// DecodeGatewayRecords decodes gateway announcements and stamps them with their
+// source and age. Records that cannot be decoded are skipped and reported in the
+// returned error; the rest are still returned.
+func (t *RecordTracker) DecodeGatewayRecords(records []alfred.Record) ([]GatewayRecord, error) {
+	var (
+		decoded = make([]GatewayRecord, 0, len(records))
+		errs    []error
+	)
+
+	for _, rec := range records {
+		var gateway proto.Gateway
+		if err := gateway.UnmarshalVT(rec.Data); err != nil {
+			errs = append(errs, fmt.Errorf("gateway record: %w", err))
+			continue
+		}
+
+		decoded = append(decoded, GatewayRecord{
+			Gateway:    &gateway,
+			RecordMeta: t.touch(gateway.Mac, rec.Data),
+		})
+	}
+
+	return decoded, errors.Join(errs...)
+}
+
+// DecodeReservationRecords decodes address reservations, upgrades them to the current
+// schema and stamps them with their source and age. Records that cannot be decoded,
+// or whose schema is newer than this node understands, are skipped and reported in
+// the returned error; the rest are still returned.
+func (t *RecordTracker) DecodeReservationRecords(records []alfred.Record) ([]ReservationRecord, error) {
+	var (
+		decoded = make([]ReservationRecord, 0, len(records))
+		errs    []error
+	)
+
+	for _, rec := range records {
+		var addrRes proto.AddressReservation
+		if err := addrRes.UnmarshalVT(rec.Data); err != nil {
+			errs = append(errs, fmt.Errorf("address reservation record: %w", err))
+			continue
+		}
+		if err := upgradeReservation(&addrRes); err != nil {
+			errs = append(errs, fmt.Errorf("address reservation record from %s: %w", addrRes.Mac, err))
+			continue
+		}
+
+		decoded = append(decoded, ReservationRecord{
+			Reservation: &addrRes,
+			RecordMeta:  t.touch(addrRes.Mac, rec.Data),
+		})
+	}
+
+	return decoded, errors.Join(errs...)
+}
+
+// fresher reports whether a should be preferred over b when both come from the same
+// source: the payload first seen most recently is the current one.
+func fresher(a, b RecordMeta) bool {
+	if !a.FirstSeen.Equal(b.FirstSeen) {
+		return a.FirstSeen.After(b.FirstSeen)
+	}
+	return a.LastSeen.After(b.LastSeen)
+}
+
+// freshestGateways indexes gateway records by MAC, keeping the freshest record when
+// a gateway appears more than once.
+func freshestGateways(records []GatewayRecord) map[string]*proto.Gateway {
+	best := make(map[string]GatewayRecord, len(records))
+	for _, rec := range records {
+		if cur, ok := best[rec.Source]; !ok || fresher(rec.RecordMeta, cur.RecordMeta) {
+			best[rec.Source] = rec
+		}
+	}
+
+	gateways := make(map[string]*proto.Gateway, len(best))
+	for mac, rec := range best {
+		gateways[mac] = rec.Gateway
+	}
+
+	return gateways
+}
+
+// freshestReservations keeps only the freshest record from each source, preserving
+// the order in which sources first appear.
+func freshestReservations(records []ReservationRecord) []ReservationRecord {
+	index := make(map[string]int, len(records))
+	kept := make([]ReservationRecord, 0, len(records))
+
+	for _, rec := range records {
+		i, ok := index[rec.Source]
+		if !ok {
+			index[rec.Source] = len(kept)
+			kept = append(kept, rec)
+			continue
+		}
+		if fresher(rec.RecordMeta, kept[i].RecordMeta) {
+			kept[i] = rec
+		}
+	}
+
+	return kept
+}
+
+// ReservationConflict is a static IP claimed by more than one node. Holder is the
+// node whose claim was seen first, preferring nodes that are not shutting down;
+// Source published the conflicting claim.
+type ReservationConflict struct {
+	IP     string
+	Source string
+	Holder string
+}
+
+func (c ReservationConflict) String() string {
+	return fmt.Sprintf("reservation for %s published by %s conflicts with %s", c.IP, c.Source, c.Holder)
+}
+
+// findReservationConflicts returns the static IPs claimed by more than one source.
+// Records are expected to be deduplicated per source with freshestReservations.
+// Requests for a reservation carry no claim and are ignored.
+func findReservationConflicts(records []ReservationRecord) []ReservationConflict {
+	claims := make(map[string][]ReservationRecord)
+	for _, rec := range records {
+		if rec.Reservation.RequestingReservation || rec.Reservation.StaticIp == "" {
+			continue
+		}
+		claims[rec.Reservation.StaticIp] = append(claims[rec.Reservation.StaticIp], rec)
+	}
+
+	var conflicts []ReservationConflict
+	for ip, recs := range claims {
+		if len(recs) < 2 {
+			continue
+		}
+
+		sort.SliceStable(recs, func(i, j int) bool {
+			if recs[i].Reservation.ShuttingDown != recs[j].Reservation.ShuttingDown {
+				return !recs[i].Reservation.ShuttingDown
+			}
+			return recs[i].FirstSeen.Before(recs[j].FirstSeen)
+		})
+
+		for _, rec := range recs[1:] {
+			conflicts = append(conflicts, ReservationConflict{IP: ip, Source: rec.Source, Holder: recs[0].Source})
+		}
+	}
+
+	sort.Slice(conflicts, func(i, j int) bool {
+		if conflicts[i].IP != conflicts[j].IP {
+			return conflicts[i].IP < conflicts[j].IP
+		}
+		return conflicts[i].Source < conflicts[j].Source
+	})
+
+	return conflicts
+}
@@ -0,0 +1,161 @@
+package mgmt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/openmanet/go-alfred"
+	proto "github.com/openmanet/openmanetd/internal/api/openmanet/v1"
+)
+
+func gatewayAlfredRecord(t *testing.T, mac, ip string) alfred.Record {
+	t.Helper()
+
+	data, err := (&proto.Gateway{Mac: mac, Ipaddr: ip}).MarshalVT()
+	if err != nil {
+		t.Fatalf("MarshalVT() error = %v", err)
+	}
+	return alfred.Record{Data: data}
+}
+
+func newTestRecordTracker() (*RecordTracker, *fakeClock) {
+	clock := newFakeClock()
+	tracker := NewRecordTracker(DefaultReservationTTL)
+	tracker.now = clock.Now
+
+	return tracker, clock
+}
+
+func TestRecordTracker_Age(t *testing.T) {
+	tracker, clock := newTestRecordTracker()
+	start := clock.Now()
+	rec := gatewayAlfredRecord(t, "aa:bb:cc:dd:ee:01", "10.41.0.1")
+
+	tracker.DecodeGatewayRecords([]alfred.Record{rec})
+	clock.Advance(time.Minute)
+	decoded, err := tracker.DecodeGatewayRecords([]alfred.Record{rec})
+	if err != nil {
+		t.Fatalf("DecodeGatewayRecords() error = %v", err)
+	}
+
+	got := decoded[0].RecordMeta
+	if got.Source != "aa:bb:cc:dd:ee:01" {
+		t.Errorf("Source = %q, want aa:bb:cc:dd:ee:01", got.Source)
+	}
+	if !got.FirstSeen.Equal(start) || !got.LastSeen.Equal(start.Add(time.Minute)) {
+		t.Errorf("FirstSeen, LastSeen = %v, %v; want %v, %v", got.FirstSeen, got.LastSeen, start, start.Add(time.Minute))
+	}
+
+	// A payload unseen for the TTL is treated as new when it returns
+	clock.Advance(DefaultReservationTTL)
+	tracker.Prune()
+	decoded, _ = tracker.DecodeGatewayRecords([]alfred.Record{rec})
+	if !decoded[0].FirstSeen.Equal(clock.Now()) {
+		t.Errorf("FirstSeen = %v after expiry, want %v", decoded[0].FirstSeen, clock.Now())
+	}
+}
+
+func TestRecordTracker_DecodeErrors(t *testing.T) {
+	tracker, _ := newTestRecordTracker()
+	records := []alfred.Record{
+		gatewayAlfredRecord(t, "aa:bb:cc:dd:ee:01", "10.41.0.1"),
+		{Data: []byte{0xff, 0xff, 0xff}},
+	}
+
+	decoded, err := tracker.DecodeGatewayRecords(records)
+	if err == nil {
+		t.Error("DecodeGatewayRecords() error = nil with a corrupt record")
+	}
+	if len(decoded) != 1 {
+		t.Errorf("DecodeGatewayRecords() decoded %d records, want 1", len(decoded))
+	}
+}
+
+func TestFreshestGateways(t *testing.T) {
+	const mac = "aa:bb:cc:dd:ee:01"
+	tracker, clock := newTestRecordTracker()
+
+	oldRec := gatewayAlfredRecord(t, mac, "10.41.0.1")
+	newRec := gatewayAlfredRecord(t, mac, "10.41.0.9")
+	other := gatewayAlfredRecord(t, "aa:bb:cc:dd:ee:02", "10.41.0.2")
+
+	// The gateway renumbers; a stale replica keeps serving the old record, and it
+	// may come back in either order
+	tracker.DecodeGatewayRecords([]alfred.Record{oldRec, other})
+	clock.Advance(time.Minute)
+
+	for _, order := range [][]alfred.Record{
+		{oldRec, newRec, other},
+		{newRec, oldRec, other},
+	} {
+		decoded, err := tracker.DecodeGatewayRecords(order)
+		if err != nil {
+			t.Fatalf("DecodeGatewayRecords() error = %v", err)
+		}
+		clock.Advance(10 * time.Second)
+
+		got := freshestGateways(decoded)
+		if len(got) != 2 {
+			t.Fatalf("freshestGateways() = %d gateways, want 2", len(got))
+		}
+		if got[mac].Ipaddr != "10.41.0.9" {
+			t.Errorf("freshestGateways()[%s] = %s, want the renumbered 10.41.0.9", mac, got[mac].Ipaddr)
+		}
+	}
+}
+
+func TestReservationConflicts(t *testing.T) {
+	tracker, clock := newTestRecordTracker()
+
+	holder := reservationRecord(t, "aa:bb:cc:dd:ee:01", "10.41.3.4")
+	tracker.DecodeReservationRecords([]alfred.Record{holder})
+	clock.Advance(time.Minute)
+
+	records := []alfred.Record{
+		holder,
+		reservationRecord(t, "cc:dd:ee:ff:00:02", "10.41.3.4"),
+		reservationRecord(t, "cc:dd:ee:ff:00:03", "10.41.3.5"),
+		// A replica of the holder's record must not count as another claim
+		holder,
+	}
+
+	decoded, err := tracker.DecodeReservationRecords(records)
+	if err != nil {
+		t.Fatalf("DecodeReservationRecords() error = %v", err)
+	}
+
+	conflicts := findReservationConflicts(freshestReservations(decoded))
+	want := ReservationConflict{IP: "10.41.3.4", Source: "cc:dd:ee:ff:00:02", Holder: "aa:bb:cc:dd:ee:01"}
+	if len(conflicts) != 1 || conflicts[0] != want {
+		t.Fatalf("findReservationConflicts() = %v, want [%v]", conflicts, want)
+	}
+
+	wantMsg := "reservation for 10.41.3.4 published by cc:dd:ee:ff:00:02 conflicts with aa:bb:cc:dd:ee:01"
+	if got := conflicts[0].String(); got != wantMsg {
+		t.Errorf("String() = %q, want %q", got, wantMsg)
+	}
+}
+
+func TestReservationConflicts_ShuttingDown(t *testing.T) {
+	tracker, clock := newTestRecordTracker()
+
+	data, err := (&proto.AddressReservation{Mac: "aa:bb:cc:dd:ee:01", StaticIp: "10.41.3.4", ShuttingDown: true}).MarshalVT()
+	if err != nil {
+		t.Fatalf("MarshalVT() error = %v", err)
+	}
+	leaving := alfred.Record{Data: data}
+	tracker.DecodeReservationRecords([]alfred.Record{leaving})
+	clock.Advance(time.Minute)
+
+	decoded, err := tracker.DecodeReservationRecords([]alfred.Record{leaving, reservationRecord(t, "cc:dd:ee:ff:00:02", "10.41.3.4")})
+	if err != nil {
+		t.Fatalf("DecodeReservationRecords() error = %v", err)
+	}
+
+	// The node that is still up holds the address even though it claimed it later
+	conflicts := findReservationConflicts(freshestReservations(decoded))
+	want := ReservationConflict{IP: "10.41.3.4", Source: "aa:bb:cc:dd:ee:01", Holder: "cc:dd:ee:ff:00:02"}
+	if len(conflicts) != 1 || conflicts[0] != want {
+		t.Errorf("findReservationConflicts() = %v, want [%v]", conflicts, want)
+	}
+}
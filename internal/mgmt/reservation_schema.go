@@ -0,0 +1,133 @@
+package mgmt
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/openmanet/go-alfred"
+	proto "github.com/openmanet/openmanetd/internal/api/openmanet/v1"
+	"github.com/rs/zerolog"
+)
+
+// Address reservation records carry their schema twice: in the alfred version byte
+// (AddressReservationDataTypeVersion) and in the schema_version field of the message,
+// since not every tool that reads the payload gets to see the version byte. Both are
+// bumped together whenever the meaning of a record on the wire changes, so that a new
+// field never has its absence mistaken for a meaningful zero.
+//
+// Records of every schema a node understands are upgraded to the current one as they
+// are decoded, and the rest of the code only deals with that:
+//
+//   - v1 records were published before schema_version existed and decode as version
+//     0. They carry no lease information: the reservation holds for as long as the
+//     node keeps publishing it. A v1 record without a mesh ID keeps it empty, so it
+//     is ours or foreign by MeshFilter's legacy rules (meshIdAcceptLegacy).
+//   - v2 records carry schema_version and are otherwise the same as v1.
+//
+// The delegation fields (target_mac, delegated_blocks, block_free and offers) were
+// added without a bump: a node that does not set them takes no part in delegation,
+// which is exactly how their absence is read.
+//
+// Records of a newer schema than ReservationSchemaVersion may use fields in ways this
+// node would misread, so they are refused.
+const (
+	ReservationSchemaV1      uint32 = 1
+	ReservationSchemaVersion uint32 = 2
+)
+
+// ErrUnsupportedSchema is returned for a record published with a newer schema than
+// this node understands.
+var ErrUnsupportedSchema = errors.New("unsupported record schema version")
+
+// reservationSchema returns the schema version res was published with.
+func reservationSchema(res *proto.AddressReservation) uint32 {
+	if res.SchemaVersion == 0 {
+		return ReservationSchemaV1
+	}
+	return res.SchemaVersion
+}
+
+// upgradeReservation maps res from the schema it was published with to the current
+// one, filling in the defaults of the fields older schemas lack.
+//
+// Returns an error wrapping ErrUnsupportedSchema if res is newer than this node
+// understands.
+func upgradeReservation(res *proto.AddressReservation) error {
+	version := reservationSchema(res)
+	if version > ReservationSchemaVersion {
+		return fmt.Errorf("%w: %d, newest understood is %d", ErrUnsupportedSchema, version, ReservationSchemaVersion)
+	}
+
+	// v1 to v2 only added schema_version itself, there is nothing else to fill in
+	res.SchemaVersion = ReservationSchemaVersion
+
+	return nil
+}
+
+// SchemaFilter keeps records published with a schema newer than this node understands
+// out of its decisions. They are counted, logged once per source and dropped.
+//
+// Like MeshFilter, it works on the raw alfred records before anything decodes them for
+// reservation or pool selection, so every consumer sees the same set.
+type SchemaFilter struct {
+	log         zerolog.Logger
+	unsupported atomic.Uint64
+
+	mu     sync.Mutex
+	logged map[string]struct{}
+}
+
+// NewSchemaFilter creates a filter that logs refused records to log.
+func NewSchemaFilter(log zerolog.Logger) *SchemaFilter {
+	return &SchemaFilter{
+		log:    log,
+		logged: make(map[string]struct{}),
+	}
+}
+
+// Unsupported returns the number of records refused since the filter was created.
+func (f *SchemaFilter) Unsupported() uint64 {
+	return f.unsupported.Load()
+}
+
+// FilterReservations returns the address reservation records whose schema this node
+// understands. Records that fail to decode are kept so that the decoder downstream
+// reports them as before.
+func (f *SchemaFilter) FilterReservations(records []alfred.Record) []alfred.Record {
+	kept := make([]alfred.Record, 0, len(records))
+
+	for _, rec := range records {
+		var res proto.AddressReservation
+		if err := res.UnmarshalVT(rec.Data); err != nil || reservationSchema(&res) <= ReservationSchemaVersion {
+			kept = append(kept, rec)
+			continue
+		}
+
+		f.unsupported.Add(1)
+		f.logOnce("address reservation", res.Mac, reservationSchema(&res))
+	}
+
+	return kept
+}
+
+func (f *SchemaFilter) logOnce(kind, source string, version uint32) {
+	key := kind + "/" + source
+
+	f.mu.Lock()
+	_, seen := f.logged[key]
+	f.logged[key] = struct{}{}
+	f.mu.Unlock()
+
+	if seen {
+		return
+	}
+
+	f.log.Warn().
+		Str("kind", kind).
+		Str("source", source).
+		Uint32("schemaVersion", version).
+		Uint32("supportedSchemaVersion", ReservationSchemaVersion).
+		Msg("Ignoring records with a newer schema, this node needs an update to use them")
+}
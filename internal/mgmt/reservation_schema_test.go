@@ -0,0 +1,121 @@
+package mgmt
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/openmanet/go-alfred"
+	proto "github.com/openmanet/openmanetd/internal/api/openmanet/v1"
+	"github.com/rs/zerolog"
+)
+
+// v1Reservation is an address reservation as published by firmware from before
+// schema_version existed. It is encoded by hand so that the test keeps describing
+// those nodes whatever happens to the generated code.
+var v1Reservation = []byte("" +
+	"\x0a\x11aa:bb:cc:dd:ee:01" + // 1: mac
+	"\x12\x0910.41.1.1" + // 2: static_ip
+	"\x22\x03200" + // 4: uci_dhcp_start
+	"\x2a\x0216" + // 5: uci_dhcp_limit
+	"\x3a\x05node1") // 7: hostname
+
+// v3Reservation is an address reservation from a future schema, with a field this
+// node does not know.
+var v3Reservation = []byte("" +
+	"\x0a\x11aa:bb:cc:dd:ee:03" + // 1: mac
+	"\x12\x0910.41.1.3" + // 2: static_ip
+	"\x42\x01a" + // 8: mesh_id
+	"\x48\x03" + // 9: schema_version
+	"\x50\x00") // 10: unknown
+
+func TestDecodeReservationRecords_V1(t *testing.T) {
+	tracker, _ := newTestRecordTracker()
+
+	decoded, err := tracker.DecodeReservationRecords([]alfred.Record{{Data: v1Reservation}})
+	if err != nil {
+		t.Fatalf("DecodeReservationRecords() error = %v", err)
+	}
+	if len(decoded) != 1 {
+		t.Fatalf("DecodeReservationRecords() decoded %d records, want 1", len(decoded))
+	}
+
+	want := &proto.AddressReservation{
+		Mac:           "aa:bb:cc:dd:ee:01",
+		StaticIp:      "10.41.1.1",
+		UciDhcpStart:  "200",
+		UciDhcpLimit:  "16",
+		Hostname:      "node1",
+		SchemaVersion: ReservationSchemaVersion,
+	}
+	if got := decoded[0].Reservation; !got.EqualVT(want) {
+		t.Errorf("Reservation = %v, want %v", got, want)
+	}
+}
+
+func TestDecodeReservationRecords_RoundTrip(t *testing.T) {
+	tracker, _ := newTestRecordTracker()
+	want := &proto.AddressReservation{
+		Mac:             "aa:bb:cc:dd:ee:02",
+		StaticIp:        "10.41.1.2",
+		ReservationCidr: "10.41.0.0/16",
+		UciDhcpStart:    "300",
+		UciDhcpLimit:    "32",
+		Hostname:        "node2",
+		MeshId:          "a",
+		SchemaVersion:   ReservationSchemaVersion,
+	}
+
+	decoded, err := tracker.DecodeReservationRecords([]alfred.Record{reservationAlfredRecord(t, want)})
+	if err != nil {
+		t.Fatalf("DecodeReservationRecords() error = %v", err)
+	}
+	if len(decoded) != 1 || !decoded[0].Reservation.EqualVT(want) {
+		t.Errorf("DecodeReservationRecords() = %v, want %v", decoded, want)
+	}
+}
+
+func TestDecodeReservationRecords_NewerSchema(t *testing.T) {
+	tracker, _ := newTestRecordTracker()
+
+	decoded, err := tracker.DecodeReservationRecords([]alfred.Record{{Data: v1Reservation}, {Data: v3Reservation}})
+	if !errors.Is(err, ErrUnsupportedSchema) {
+		t.Errorf("DecodeReservationRecords() error = %v, want ErrUnsupportedSchema", err)
+	}
+	if len(decoded) != 1 || decoded[0].Source != "aa:bb:cc:dd:ee:01" {
+		t.Errorf("DecodeReservationRecords() = %v, want only the v1 record", decoded)
+	}
+}
+
+func TestSchemaFilter_Reservations(t *testing.T) {
+	var buf bytes.Buffer
+	filter := NewSchemaFilter(zerolog.New(&buf))
+	records := []alfred.Record{{Data: v1Reservation}, {Data: v3Reservation}, {Data: []byte{0xff, 0xff, 0xff}}}
+
+	for range 2 {
+		kept := filter.FilterReservations(records)
+		if len(kept) != 2 || !bytes.Equal(kept[0].Data, v1Reservation) {
+			t.Fatalf("FilterReservations() kept %v, want the v1 and the corrupt record", kept)
+		}
+	}
+
+	if got := filter.Unsupported(); got != 2 {
+		t.Errorf("Unsupported() = %d, want 2", got)
+	}
+	if got := strings.Count(buf.String(), "\n"); got != 1 {
+		t.Errorf("logged %d lines, want 1:\n%s", got, buf.String())
+	}
+}
+
+func TestSchemaFilter_LegacyMeshID(t *testing.T) {
+	// A v1 record carries no mesh ID, so whether it is ours is up to the legacy rules
+	records := NewSchemaFilter(zerolog.Nop()).FilterReservations([]alfred.Record{{Data: v1Reservation}})
+
+	if kept := NewMeshFilter("a", true, true, zerolog.Nop()).FilterReservations(records); len(kept) != 1 {
+		t.Errorf("accepting legacy records kept %d records, want 1", len(kept))
+	}
+	if kept := NewMeshFilter("a", true, false, zerolog.Nop()).FilterReservations(records); len(kept) != 0 {
+		t.Errorf("rejecting legacy records kept %d records, want 0", len(kept))
+	}
+}
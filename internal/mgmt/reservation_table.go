@@ -0,0 +1,157 @@
+package mgmt
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	proto "github.com/openmanet/openmanetd/internal/api/openmanet/v1"
+	"github.com/openmanet/openmanetd/internal/network"
+)
+
+// DefaultReservationTTL is how long a reservation stays active without being seen
+// again. It matches the alfred data timeout, after which a peer's record is dropped.
+const DefaultReservationTTL time.Duration = 10 * time.Minute
+
+// Reservation is a peer's confirmed address reservation as last seen over alfred.
+type Reservation struct {
+	Mac      string    `json:"mac"`
+	StaticIP string    `json:"staticIp"`
+	Hostname string    `json:"hostname"`
+	LastSeen time.Time `json:"lastSeen"`
+
+	// DHCPStart and DHCPLimit describe the peer's DHCP pool as an offset from the
+	// mesh network address. They are zero if the peer did not advertise a pool.
+	DHCPStart int `json:"dhcpStart"`
+	DHCPLimit int `json:"dhcpLimit"`
+
+	// ShuttingDown is set when the peer published its final record before a clean
+	// shutdown. The reservation stays valid so the address is not handed out, but
+	// a live node's claim wins over it.
+	ShuttingDown bool `json:"shuttingDown,omitempty"`
+
+	// Tombstoned reservations have been withdrawn and are kept only so that stale
+	// records still circulating in alfred do not bring them back before they expire.
+	Tombstoned bool `json:"-"`
+}
+
+// ReservationTable tracks the address reservations advertised by peers, keyed by MAC.
+type ReservationTable struct {
+	mu      sync.RWMutex
+	entries map[string]*Reservation
+	ttl     time.Duration
+
+	// now is overridable for tests.
+	now func() time.Time
+}
+
+// NewReservationTable creates an empty ReservationTable whose entries expire after ttl.
+func NewReservationTable(ttl time.Duration) *ReservationTable {
+	return &ReservationTable{
+		entries: make(map[string]*Reservation),
+		ttl:     ttl,
+		now:     time.Now,
+	}
+}
+
+// Observe records a reservation seen over alfred and refreshes its expiry. Requests
+// for a reservation and records without a MAC or IP are ignored, as are records for
+// tombstoned reservations until the tombstone itself expires.
+func (t *ReservationTable) Observe(addrRes *proto.AddressReservation) {
+	if addrRes.GetRequestingReservation() || addrRes.GetMac() == "" || addrRes.GetStaticIp() == "" {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+
+	if existing, ok := t.entries[addrRes.GetMac()]; ok && existing.Tombstoned && now.Sub(existing.LastSeen) < t.ttl {
+		return
+	}
+
+	// Invalid pool values are treated as no pool rather than rejecting the record
+	dhcpStart, _ := strconv.Atoi(addrRes.GetUciDhcpStart())
+	dhcpLimit, _ := strconv.Atoi(addrRes.GetUciDhcpLimit())
+
+	t.entries[addrRes.GetMac()] = &Reservation{
+		Mac:       addrRes.GetMac(),
+		StaticIP:  addrRes.GetStaticIp(),
+		Hostname:  addrRes.GetHostname(),
+		LastSeen:  now,
+		DHCPStart: dhcpStart,
+		DHCPLimit: dhcpLimit,
+
+		ShuttingDown: addrRes.GetShuttingDown(),
+	}
+}
+
+// Tombstone marks the reservation for mac as withdrawn. It is excluded from Active
+// immediately and removed by Prune once the TTL has passed.
+func (t *ReservationTable) Tombstone(mac string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry, ok := t.entries[mac]
+	if !ok {
+		return
+	}
+
+	entry.Tombstoned = true
+	entry.LastSeen = t.now()
+}
+
+// Prune removes expired reservations and tombstones from the table.
+func (t *ReservationTable) Prune() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	for mac, entry := range t.entries {
+		if now.Sub(entry.LastSeen) >= t.ttl {
+			delete(t.entries, mac)
+		}
+	}
+}
+
+// Active returns copies of the reservations that are neither expired nor tombstoned,
+// sorted by MAC.
+func (t *ReservationTable) Active() []Reservation {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	now := t.now()
+	active := make([]Reservation, 0, len(t.entries))
+	for _, entry := range t.entries {
+		if entry.Tombstoned || now.Sub(entry.LastSeen) >= t.ttl {
+			continue
+		}
+		active = append(active, *entry)
+	}
+
+	sort.Slice(active, func(i, j int) bool {
+		return active[i].Mac < active[j].Mac
+	})
+
+	return active
+}
+
+// HostEntries returns the active reservations that advertise a hostname as dnsmasq
+// host entries.
+func (t *ReservationTable) HostEntries() []network.HostEntry {
+	var entries []network.HostEntry
+	for _, res := range t.Active() {
+		if res.Hostname == "" {
+			continue
+		}
+		entries = append(entries, network.HostEntry{
+			Hostname: res.Hostname,
+			IP:       res.StaticIP,
+			MAC:      res.Mac,
+		})
+	}
+
+	return entries
+}
@@ -0,0 +1,152 @@
+package mgmt
+
+import (
+	"testing"
+	"time"
+
+	proto "github.com/openmanet/openmanetd/internal/api/openmanet/v1"
+	"github.com/openmanet/openmanetd/internal/network"
+)
+
+func newTestReservationTable() (*ReservationTable, *fakeClock) {
+	clock := newFakeClock()
+	table := NewReservationTable(DefaultReservationTTL)
+	table.now = clock.Now
+
+	return table, clock
+}
+
+func TestReservationTable_Observe(t *testing.T) {
+	table, _ := newTestReservationTable()
+
+	table.Observe(&proto.AddressReservation{Mac: "aa:bb:cc:dd:ee:01", StaticIp: "10.41.1.10", Hostname: "node-a"})
+	table.Observe(&proto.AddressReservation{Mac: "aa:bb:cc:dd:ee:02", StaticIp: "10.41.1.20", RequestingReservation: true})
+	table.Observe(&proto.AddressReservation{Mac: "", StaticIp: "10.41.1.30"})
+	table.Observe(&proto.AddressReservation{Mac: "aa:bb:cc:dd:ee:01", StaticIp: "10.41.1.11", Hostname: "node-a"})
+
+	active := table.Active()
+	if len(active) != 1 {
+		t.Fatalf("Expected 1 active reservation, got %d", len(active))
+	}
+
+	if active[0].StaticIP != "10.41.1.11" {
+		t.Errorf("Expected latest StaticIP 10.41.1.11, got %s", active[0].StaticIP)
+	}
+}
+
+func TestReservationTable_HostsFile(t *testing.T) {
+	table, clock := newTestReservationTable()
+
+	// node-a and the two "openmanet" peers are seen now, node-d is seen long enough
+	// ago that it expires, and node-e is withdrawn.
+	table.Observe(&proto.AddressReservation{Mac: "aa:bb:cc:dd:ee:04", StaticIp: "10.41.4.40", Hostname: "node-d"})
+	clock.Advance(DefaultReservationTTL / 2)
+
+	table.Observe(&proto.AddressReservation{Mac: "aa:bb:cc:dd:ee:01", StaticIp: "10.41.1.10", Hostname: "node-a"})
+	table.Observe(&proto.AddressReservation{Mac: "aa:bb:cc:dd:12:34", StaticIp: "10.41.2.20", Hostname: "openmanet"})
+	table.Observe(&proto.AddressReservation{Mac: "aa:bb:cc:dd:ab:cd", StaticIp: "10.41.3.30", Hostname: "OpenMANET"})
+	table.Observe(&proto.AddressReservation{Mac: "aa:bb:cc:dd:ee:05", StaticIp: "10.41.5.50", Hostname: "node-e"})
+	table.Observe(&proto.AddressReservation{Mac: "aa:bb:cc:dd:ee:06", StaticIp: "10.41.6.60"})
+	table.Tombstone("aa:bb:cc:dd:ee:05")
+
+	clock.Advance(DefaultReservationTTL / 2)
+	table.Prune()
+
+	data, collisions := network.GenerateHostsFile(table.HostEntries(), "lan")
+
+	expected := "10.41.1.10 node-a.lan node-a\n" +
+		"10.41.2.20 openmanet-1234.lan openmanet-1234\n" +
+		"10.41.3.30 openmanet-abcd.lan openmanet-abcd\n"
+	if string(data) != expected {
+		t.Errorf("Expected hosts file:\n%s\ngot:\n%s", expected, data)
+	}
+
+	if len(collisions) != 1 || collisions[0].Hostname != "openmanet" {
+		t.Errorf("Expected a single collision on 'openmanet', got %+v", collisions)
+	}
+}
+
+func TestReservationTable_Tombstone(t *testing.T) {
+	table, clock := newTestReservationTable()
+
+	res := &proto.AddressReservation{Mac: "aa:bb:cc:dd:ee:01", StaticIp: "10.41.1.10", Hostname: "node-a"}
+	table.Observe(res)
+	table.Tombstone(res.Mac)
+
+	if len(table.Active()) != 0 {
+		t.Fatal("Expected tombstoned reservation to be inactive")
+	}
+
+	// A stale record still circulating in alfred must not revive it.
+	clock.Advance(time.Minute)
+	table.Observe(res)
+	if len(table.Active()) != 0 {
+		t.Error("Expected tombstone to suppress stale records")
+	}
+
+	// Once the tombstone has expired the peer can be observed again.
+	clock.Advance(DefaultReservationTTL)
+	table.Prune()
+	table.Observe(res)
+	if len(table.Active()) != 1 {
+		t.Error("Expected reservation to be active again after tombstone expired")
+	}
+}
+
+func TestReservationTable_Expiry(t *testing.T) {
+	table, clock := newTestReservationTable()
+
+	table.Observe(&proto.AddressReservation{Mac: "aa:bb:cc:dd:ee:01", StaticIp: "10.41.1.10", Hostname: "node-a"})
+
+	clock.Advance(DefaultReservationTTL - time.Second)
+	if len(table.Active()) != 1 {
+		t.Fatal("Expected reservation to be active before TTL")
+	}
+
+	clock.Advance(time.Second)
+	if len(table.Active()) != 0 {
+		t.Error("Expected reservation to expire at TTL")
+	}
+
+	table.Prune()
+	if len(table.entries) != 0 {
+		t.Errorf("Expected Prune to remove expired reservation, %d left", len(table.entries))
+	}
+}
+
+func TestReservationTable_Rename(t *testing.T) {
+	table, clock := newTestReservationTable()
+
+	// An unnamed node advertises its MAC-derived name, then is named in the field.
+	mac := "aa:bb:cc:dd:ee:01"
+	table.Observe(&proto.AddressReservation{Mac: mac, StaticIp: "10.41.1.10", Hostname: PublishedHostname("OpenWrt", mac)})
+	clock.Advance(time.Minute)
+	table.Observe(&proto.AddressReservation{Mac: mac, StaticIp: "10.41.1.10", Hostname: PublishedHostname("radio-7", mac)})
+
+	data, collisions := network.GenerateHostsFile(table.HostEntries(), "lan")
+
+	expected := "10.41.1.10 radio-7.lan radio-7\n"
+	if string(data) != expected {
+		t.Errorf("Expected hosts file:\n%s\ngot:\n%s", expected, data)
+	}
+	if len(collisions) != 0 {
+		t.Errorf("Expected the rename not to collide with the old name, got %+v", collisions)
+	}
+}
+
+func TestReservationTable_ShuttingDown(t *testing.T) {
+	table, _ := newTestReservationTable()
+
+	table.Observe(&proto.AddressReservation{Mac: "aa:bb:cc:dd:ee:01", StaticIp: "10.41.1.10", ShuttingDown: true, RefreshedAt: 1735689600})
+
+	// Kept, so the address is not handed to another node while the peer is down
+	active := table.Active()
+	if len(active) != 1 || !active[0].ShuttingDown {
+		t.Fatalf("Active() = %+v, want the reservation marked shutting down", active)
+	}
+
+	table.Observe(&proto.AddressReservation{Mac: "aa:bb:cc:dd:ee:01", StaticIp: "10.41.1.10"})
+	if active := table.Active(); len(active) != 1 || active[0].ShuttingDown {
+		t.Errorf("Active() = %+v, want the flag cleared once the peer is back", active)
+	}
+}
@@ -0,0 +1,274 @@
+package mgmt
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"sync/atomic"
+	"time"
+
+	proto "github.com/openmanet/openmanetd/internal/api/openmanet/v1"
+	"github.com/openmanet/openmanetd/internal/network"
+)
+
+const (
+	ServiceDataType        uint8 = uint8(proto.DataType_DATA_TYPE_SERVICE)
+	ServiceDataTypeVersion uint8 = 1
+
+	serviceWorkerInterval time.Duration = 30 * time.Second
+
+	// ServiceAddressSelf announces a service at the announcing node's own address.
+	ServiceAddressSelf string = "self"
+
+	// DefaultServiceTTL is how long an announced service stays listed without being
+	// announced again, if the announcement does not say.
+	DefaultServiceTTL time.Duration = 5 * time.Minute
+	// MinServiceTTL and MaxServiceTTL bound the TTL of an announcement. Shorter TTLs
+	// expire between announcements, longer ones keep departed nodes listed for days.
+	MinServiceTTL time.Duration = time.Minute
+	MaxServiceTTL time.Duration = 24 * time.Hour
+
+	maxServiceDescription int = 256
+)
+
+// serviceName matches a DNS label, so service names can be published over DNS.
+var serviceName = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// ValidateService checks a service announcement: its name must be a lowercase DNS
+// label, proto tcp or udp, the port within 1-65535, the address "self" or an IP
+// address, and the TTL between MinServiceTTL and MaxServiceTTL.
+func ValidateService(svc *proto.ServiceAnnouncement) error {
+	if !serviceName.MatchString(svc.GetName()) {
+		return fmt.Errorf("invalid service name %q", svc.GetName())
+	}
+
+	if svc.GetProto() != "tcp" && svc.GetProto() != "udp" {
+		return fmt.Errorf("service %s: invalid protocol %q, want tcp or udp", svc.GetName(), svc.GetProto())
+	}
+
+	if svc.GetPort() < 1 || svc.GetPort() > 65535 {
+		return fmt.Errorf("service %s: port %d out of range", svc.GetName(), svc.GetPort())
+	}
+
+	if address := svc.GetAddress(); address != ServiceAddressSelf && net.ParseIP(address) == nil {
+		return fmt.Errorf("service %s: invalid address %q", svc.GetName(), address)
+	}
+
+	ttl := time.Duration(svc.GetTtlSeconds()) * time.Second
+	if ttl < MinServiceTTL || ttl > MaxServiceTTL {
+		return fmt.Errorf("service %s: TTL %s outside %s-%s", svc.GetName(), ttl, MinServiceTTL, MaxServiceTTL)
+	}
+
+	if len(svc.GetDescription()) > maxServiceDescription {
+		return fmt.Errorf("service %s: description longer than %d bytes", svc.GetName(), maxServiceDescription)
+	}
+
+	return nil
+}
+
+// NewServiceAnnouncement returns the announcement of a locally configured service,
+// filling in the defaults: proto tcp, address "self" and DefaultServiceTTL. The
+// result is validated.
+func NewServiceAnnouncement(name, protocol string, port int, address, description string, ttl time.Duration) (*proto.ServiceAnnouncement, error) {
+	if protocol == "" {
+		protocol = "tcp"
+	}
+	if address == "" {
+		address = ServiceAddressSelf
+	}
+	if ttl == 0 {
+		ttl = DefaultServiceTTL
+	}
+	if port < 1 || port > 65535 {
+		return nil, fmt.Errorf("service %s: port %d out of range", name, port)
+	}
+	if ttl < MinServiceTTL || ttl > MaxServiceTTL {
+		return nil, fmt.Errorf("service %s: TTL %s outside %s-%s", name, ttl, MinServiceTTL, MaxServiceTTL)
+	}
+
+	svc := &proto.ServiceAnnouncement{
+		Name:        name,
+		Proto:       protocol,
+		Port:        uint32(port),
+		Address:     address,
+		Description: description,
+		TtlSeconds:  uint32(ttl / time.Second),
+	}
+
+	if err := ValidateService(svc); err != nil {
+		return nil, err
+	}
+
+	return svc, nil
+}
+
+type ServiceWorker struct {
+	// Config holds the settings fixed at startup, Deps the shared runtime
+	// dependencies and Tunables the settings that may change between ticks.
+	Config       *ManagementConfig
+	Deps         Deps
+	Tunables     TunablesProvider
+	Interval     time.Duration
+	ShutdownChan <-chan os.Signal
+
+	// services holds the services announced over the mesh, ours included.
+	services *ServiceTable
+
+	// dnsPath is the dnsmasq config file written when PublishServiceDNS is set.
+	dnsPath string
+
+	// lastTunables are the tunables of the most recent tick.
+	lastTunables atomic.Pointer[Tunables]
+}
+
+func NewServiceWorker(config *ManagementConfig, client *AlfredClient, interval time.Duration, shutdownChan <-chan os.Signal) *ServiceWorker {
+	return NewServiceWorkerWithDeps(config, config.deps.withClient(client), config, interval, shutdownChan)
+}
+
+// NewServiceWorkerWithDeps creates a service worker that uses deps and takes a
+// snapshot of tunables at the start of every tick.
+func NewServiceWorkerWithDeps(config *ManagementConfig, deps Deps, tunables TunablesProvider, interval time.Duration, shutdownChan <-chan os.Signal) *ServiceWorker {
+	deps.Log.Info().Msg("ServiceWorker initialized")
+
+	return &ServiceWorker{
+		Config:       config,
+		Deps:         deps,
+		Tunables:     tunables,
+		Interval:     interval,
+		ShutdownChan: shutdownChan,
+
+		services: NewServiceTable(),
+		dnsPath:  network.DefaultDnsmasqServicesPath,
+	}
+}
+
+// StartSend begins the periodic announcement of our services.
+func (sw *ServiceWorker) StartSend() {
+	ticker := time.NewTicker(sw.Interval)
+	defer ticker.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for {
+		select {
+		case <-sw.ShutdownChan:
+			return
+		case <-ticker.C:
+			sw.sendTick(ctx)
+		}
+	}
+}
+
+// announcement returns the record announcing our services, or nil if we have none.
+func (sw *ServiceWorker) announcement(t Tunables) *proto.ServiceAnnouncements {
+	if len(sw.Config.LocalServices) == 0 {
+		return nil
+	}
+
+	iface := network.GetInterfaceByName(t.IFace)
+
+	rec := &proto.ServiceAnnouncements{
+		Mac:      iface.MAC,
+		Hostname: sw.Deps.hostname(iface.MAC),
+		MeshId:   sw.Config.MeshID,
+		Services: sw.Config.LocalServices,
+	}
+	if addr, ok := iface.PrimaryIPv4(); ok {
+		rec.Ipaddr = addr.IP.String()
+	}
+
+	return rec
+}
+
+// sendTick publishes our services.
+func (sw *ServiceWorker) sendTick(ctx context.Context) {
+	t := sw.tick()
+
+	rec := sw.announcement(t)
+	if rec == nil {
+		return
+	}
+
+	data, err := rec.MarshalVT()
+	if err != nil {
+		sw.Deps.Log.Error().Err(err).Msg("Error marshaling service announcements")
+		return
+	}
+
+	if err := sw.Deps.Client.SetCtx(ctx, ServiceDataType, ServiceDataTypeVersion, data); err != nil {
+		sw.Deps.Log.Error().Err(err).Msg("Error sending service announcements")
+	}
+}
+
+// StartReceive begins the periodic receiving of service announcements.
+func (sw *ServiceWorker) StartReceive() {
+	ticker := time.NewTicker(sw.Interval)
+	defer ticker.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for {
+		select {
+		case <-sw.ShutdownChan:
+			return
+		case <-ticker.C:
+			sw.receiveTick(ctx)
+		}
+	}
+}
+
+// receiveTick updates the service table from alfred and, if enabled, the services
+// published over DNS.
+func (sw *ServiceWorker) receiveTick(ctx context.Context) {
+	records, err := sw.Deps.Client.RequestCtx(ctx, ServiceDataType)
+	if err != nil {
+		sw.Deps.Log.Error().Err(err).Msg("Error receiving service announcements")
+		return
+	}
+
+	records = sw.Deps.MeshFilter.FilterServices(sw.Deps.RecordLimits.Limit("service", records))
+	for _, rec := range records {
+		var announcements proto.ServiceAnnouncements
+		if err := announcements.UnmarshalVT(rec.Data); err != nil {
+			sw.Deps.Log.Error().Err(err).Msg("Error unmarshaling service announcements")
+			continue
+		}
+
+		if dropped := sw.services.Observe(&announcements); dropped > 0 {
+			sw.Deps.Log.Debug().
+				Str("mac", announcements.GetMac()).
+				Int("dropped", dropped).
+				Msg("Ignoring invalid service announcements")
+		}
+	}
+
+	if sw.Config.PublishServiceDNS {
+		sw.updateServiceDNS()
+	}
+}
+
+// updateServiceDNS rewrites the dnsmasq services file from the service table and
+// restarts dnsmasq if the file changed.
+func (sw *ServiceWorker) updateServiceDNS() {
+	domain := dnsmasqDomain(sw.Config.DnsmasqInstance, sw.Deps.UCIDHCP)
+
+	data := network.GenerateServicesConf(sw.services.ServiceEntries(), domain)
+
+	changed, err := network.WriteHostsFile(sw.dnsPath, data)
+	if err != nil {
+		sw.Deps.Log.Error().Err(err).Msg("Error writing services DNS file")
+		return
+	}
+
+	if !changed {
+		return
+	}
+
+	if err := network.RestartDnsmasq(); err != nil {
+		sw.Deps.Log.Error().Err(err).Msg("Error restarting dnsmasq")
+	}
+}
@@ -0,0 +1,136 @@
+package mgmt
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	proto "github.com/openmanet/openmanetd/internal/api/openmanet/v1"
+	"github.com/openmanet/openmanetd/internal/network"
+)
+
+// Service is a service announced by a node, as last seen over alfred.
+type Service struct {
+	NodeMac     string    `json:"nodeMac"`
+	Hostname    string    `json:"hostname"`
+	Name        string    `json:"name"`
+	Proto       string    `json:"proto"`
+	Port        int       `json:"port"`
+	Address     string    `json:"address"`
+	Description string    `json:"description,omitempty"`
+	Expires     time.Time `json:"expires"`
+}
+
+// serviceKey identifies a service mesh-wide: a node announces each name once.
+type serviceKey struct {
+	mac  string
+	name string
+}
+
+// ServiceTable tracks the services announced over the mesh, keyed by node MAC and
+// service name. Each service expires after the TTL it was announced with unless the
+// node announces it again.
+type ServiceTable struct {
+	mu      sync.RWMutex
+	entries map[serviceKey]*Service
+
+	// now is overridable for tests.
+	now func() time.Time
+}
+
+// NewServiceTable creates an empty ServiceTable.
+func NewServiceTable() *ServiceTable {
+	return &ServiceTable{
+		entries: make(map[serviceKey]*Service),
+		now:     time.Now,
+	}
+}
+
+// Observe records the services of one node and refreshes their expiry. Services
+// announced at "self" resolve to the node's address. Invalid services, and records
+// whose MAC or address does not parse, are ignored; the number of services dropped
+// is returned.
+func (t *ServiceTable) Observe(rec *proto.ServiceAnnouncements) int {
+	// Both end up in the dnsmasq configuration, so a peer must not be able to
+	// smuggle anything else in through them
+	if _, err := net.ParseMAC(rec.GetMac()); err != nil || net.ParseIP(rec.GetIpaddr()) == nil {
+		return len(rec.GetServices())
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	dropped := 0
+	for _, svc := range rec.GetServices() {
+		if err := ValidateService(svc); err != nil {
+			dropped++
+			continue
+		}
+
+		address := svc.GetAddress()
+		if address == "" || address == ServiceAddressSelf {
+			address = rec.GetIpaddr()
+		}
+
+		t.entries[serviceKey{mac: rec.GetMac(), name: svc.GetName()}] = &Service{
+			NodeMac:     rec.GetMac(),
+			Hostname:    rec.GetHostname(),
+			Name:        svc.GetName(),
+			Proto:       svc.GetProto(),
+			Port:        int(svc.GetPort()),
+			Address:     address,
+			Description: svc.GetDescription(),
+			Expires:     now.Add(time.Duration(svc.GetTtlSeconds()) * time.Second),
+		}
+	}
+
+	return dropped
+}
+
+// Active removes expired services and returns copies of the rest, sorted by name
+// and then node MAC.
+func (t *ServiceTable) Active() []Service {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	active := make([]Service, 0, len(t.entries))
+	for key, entry := range t.entries {
+		if !now.Before(entry.Expires) {
+			delete(t.entries, key)
+			continue
+		}
+		active = append(active, *entry)
+	}
+
+	sort.Slice(active, func(i, j int) bool {
+		if active[i].Name != active[j].Name {
+			return active[i].Name < active[j].Name
+		}
+		return active[i].NodeMac < active[j].NodeMac
+	})
+
+	return active
+}
+
+// ServiceEntries returns the active services for the dnsmasq services file.
+// Services whose node address is unknown are skipped.
+func (t *ServiceTable) ServiceEntries() []network.ServiceEntry {
+	var entries []network.ServiceEntry
+	for _, svc := range t.Active() {
+		if svc.Address == "" {
+			continue
+		}
+		entries = append(entries, network.ServiceEntry{
+			Name:  svc.Name,
+			Proto: svc.Proto,
+			Port:  svc.Port,
+			IP:    svc.Address,
+			MAC:   svc.NodeMac,
+		})
+	}
+
+	return entries
+}
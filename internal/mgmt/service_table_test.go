@@ -0,0 +1,117 @@
+package mgmt
+
+import (
+	"testing"
+	"time"
+
+	proto "github.com/openmanet/openmanetd/internal/api/openmanet/v1"
+)
+
+func testAnnouncements(mac, ip string, services ...*proto.ServiceAnnouncement) *proto.ServiceAnnouncements {
+	rec := &proto.ServiceAnnouncements{Mac: mac, Ipaddr: ip, Services: services}
+	if mac != "" {
+		rec.Hostname = "node-" + mac[len(mac)-2:]
+	}
+	return rec
+}
+
+func testService(name string, port uint32, address string, ttl time.Duration) *proto.ServiceAnnouncement {
+	return &proto.ServiceAnnouncement{Name: name, Proto: "tcp", Port: port, Address: address, TtlSeconds: uint32(ttl / time.Second)}
+}
+
+func TestServiceTable_Observe(t *testing.T) {
+	table := NewServiceTable()
+
+	dropped := table.Observe(testAnnouncements("aa:bb:cc:dd:ee:01", "10.41.1.10",
+		testService("rtsp-cam", 554, ServiceAddressSelf, 5*time.Minute),
+		testService("nas", 445, "10.41.1.99", 5*time.Minute),
+		testService("bad", 0, ServiceAddressSelf, 5*time.Minute),
+	))
+	if dropped != 1 {
+		t.Errorf("Observe() dropped = %d, want 1", dropped)
+	}
+
+	active := table.Active()
+	if len(active) != 2 {
+		t.Fatalf("Active() = %+v, want 2 services", active)
+	}
+	if active[0].Name != "nas" || active[0].Address != "10.41.1.99" {
+		t.Errorf("Active()[0] = %+v, want nas at 10.41.1.99", active[0])
+	}
+	if active[1].Name != "rtsp-cam" || active[1].Address != "10.41.1.10" || active[1].Hostname != "node-01" {
+		t.Errorf("Active()[1] = %+v, want rtsp-cam at the node address", active[1])
+	}
+
+	if dropped := table.Observe(testAnnouncements("", "10.41.1.20", testService("web", 80, ServiceAddressSelf, time.Hour))); dropped != 1 {
+		t.Errorf("Observe() without MAC dropped = %d, want 1", dropped)
+	}
+}
+
+func TestServiceTable_KeyedByNodeAndName(t *testing.T) {
+	table := NewServiceTable()
+
+	table.Observe(testAnnouncements("aa:bb:cc:dd:ee:01", "10.41.1.10", testService("mqtt", 1883, ServiceAddressSelf, time.Hour)))
+	table.Observe(testAnnouncements("aa:bb:cc:dd:ee:02", "10.41.1.20", testService("mqtt", 1883, ServiceAddressSelf, time.Hour)))
+	table.Observe(testAnnouncements("aa:bb:cc:dd:ee:01", "10.41.1.10", testService("mqtt", 8883, ServiceAddressSelf, time.Hour)))
+
+	active := table.Active()
+	if len(active) != 2 {
+		t.Fatalf("Active() = %+v, want one service per node", active)
+	}
+	if active[0].NodeMac != "aa:bb:cc:dd:ee:01" || active[0].Port != 8883 {
+		t.Errorf("Active()[0] = %+v, want the refreshed announcement", active[0])
+	}
+}
+
+func TestServiceTable_Expiry(t *testing.T) {
+	clock := newFakeClock()
+	table := NewServiceTable()
+	table.now = clock.Now
+
+	table.Observe(testAnnouncements("aa:bb:cc:dd:ee:01", "10.41.1.10",
+		testService("short", 80, ServiceAddressSelf, time.Minute),
+		testService("long", 81, ServiceAddressSelf, 10*time.Minute),
+	))
+
+	clock.Advance(time.Minute)
+	active := table.Active()
+	if len(active) != 1 || active[0].Name != "long" {
+		t.Fatalf("Active() after 1m = %+v, want only long", active)
+	}
+
+	// A refresh extends the expiry from the time it is seen
+	clock.Advance(5 * time.Minute)
+	table.Observe(testAnnouncements("aa:bb:cc:dd:ee:01", "10.41.1.10", testService("long", 81, ServiceAddressSelf, 10*time.Minute)))
+	clock.Advance(9 * time.Minute)
+	if active := table.Active(); len(active) != 1 {
+		t.Fatalf("Active() after refresh = %+v, want long", active)
+	}
+
+	clock.Advance(time.Minute)
+	if active := table.Active(); len(active) != 0 {
+		t.Errorf("Active() after expiry = %+v, want none", active)
+	}
+	if len(table.entries) != 0 {
+		t.Errorf("expired entries were not removed: %d left", len(table.entries))
+	}
+}
+
+func TestServiceTable_HostileRecord(t *testing.T) {
+	table := NewServiceTable()
+
+	// A peer trying to add its own lines to the dnsmasq configuration
+	hostile := []*proto.ServiceAnnouncements{
+		testAnnouncements("aa:bb:cc:dd:ee:01", "10.41.1.10\ndhcp-script=/tmp/evil.sh", testService("web", 80, ServiceAddressSelf, time.Hour)),
+		testAnnouncements("aa:bb:cc:dd:ee:01\ndhcp-script=/tmp/evil.sh", "10.41.1.10", testService("web", 80, ServiceAddressSelf, time.Hour)),
+		testAnnouncements("aa:bb:cc:dd:ee:01", "", testService("web", 80, ServiceAddressSelf, time.Hour)),
+	}
+	for _, rec := range hostile {
+		if dropped := table.Observe(rec); dropped != 1 {
+			t.Errorf("Observe(%q, %q) dropped = %d, want 1", rec.GetMac(), rec.GetIpaddr(), dropped)
+		}
+	}
+
+	if active := table.Active(); len(active) != 0 {
+		t.Errorf("Active() = %+v, want no services from hostile records", active)
+	}
+}
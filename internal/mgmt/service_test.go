@@ -0,0 +1,105 @@
+package mgmt
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openmanet/go-alfred"
+	proto "github.com/openmanet/openmanetd/internal/api/openmanet/v1"
+	"github.com/rs/zerolog"
+)
+
+func TestValidateService(t *testing.T) {
+	valid := func() *proto.ServiceAnnouncement {
+		return &proto.ServiceAnnouncement{Name: "rtsp-cam", Proto: "tcp", Port: 554, Address: ServiceAddressSelf, TtlSeconds: 300}
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(*proto.ServiceAnnouncement)
+		wantErr bool
+	}{
+		{name: "valid", modify: func(*proto.ServiceAnnouncement) {}},
+		{name: "IP address", modify: func(s *proto.ServiceAnnouncement) { s.Address = "10.41.1.20" }},
+		{name: "udp", modify: func(s *proto.ServiceAnnouncement) { s.Proto = "udp" }},
+		{name: "highest port", modify: func(s *proto.ServiceAnnouncement) { s.Port = 65535 }},
+		{name: "port zero", modify: func(s *proto.ServiceAnnouncement) { s.Port = 0 }, wantErr: true},
+		{name: "port out of range", modify: func(s *proto.ServiceAnnouncement) { s.Port = 70000 }, wantErr: true},
+		{name: "TTL too short", modify: func(s *proto.ServiceAnnouncement) { s.TtlSeconds = 5 }, wantErr: true},
+		{name: "TTL absurd", modify: func(s *proto.ServiceAnnouncement) { s.TtlSeconds = 365 * 24 * 3600 }, wantErr: true},
+		{name: "unknown proto", modify: func(s *proto.ServiceAnnouncement) { s.Proto = "sctp" }, wantErr: true},
+		{name: "name not a DNS label", modify: func(s *proto.ServiceAnnouncement) { s.Name = "RTSP cam" }, wantErr: true},
+		{name: "empty name", modify: func(s *proto.ServiceAnnouncement) { s.Name = "" }, wantErr: true},
+		{name: "invalid address", modify: func(s *proto.ServiceAnnouncement) { s.Address = "camera.lan" }, wantErr: true},
+		{name: "long description", modify: func(s *proto.ServiceAnnouncement) { s.Description = strings.Repeat("x", 300) }, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := valid()
+			tt.modify(svc)
+
+			if err := ValidateService(svc); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateService() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewServiceAnnouncement(t *testing.T) {
+	svc, err := NewServiceAnnouncement("rtsp-cam", "", 554, "", "Camera", 0)
+	if err != nil {
+		t.Fatalf("NewServiceAnnouncement() error = %v", err)
+	}
+	if svc.Proto != "tcp" || svc.Address != ServiceAddressSelf || svc.TtlSeconds != uint32(DefaultServiceTTL/time.Second) {
+		t.Errorf("NewServiceAnnouncement() = %+v, want the defaults filled in", svc)
+	}
+
+	if _, err := NewServiceAnnouncement("rtsp-cam", "tcp", 70000, "", "", 0); err == nil {
+		t.Error("NewServiceAnnouncement() with port 70000 succeeded")
+	}
+	if _, err := NewServiceAnnouncement("rtsp-cam", "tcp", 554, "", "", 1000*time.Hour); err == nil {
+		t.Error("NewServiceAnnouncement() with a TTL of 1000h succeeded")
+	}
+}
+
+func TestServiceWorker_ReceiveRoundTrip(t *testing.T) {
+	client, created := newTestAlfredClient(t, time.Second, false)
+	deps := Deps{
+		Log:          zerolog.Nop(),
+		Client:       client,
+		MeshFilter:   NewMeshFilter("default", true, false, zerolog.Nop()),
+		RecordLimits: NewRecordLimiter(RecordLimits{}, zerolog.Nop()),
+	}
+	sw := NewServiceWorkerWithDeps(&ManagementConfig{}, deps, StaticTunables{}, time.Minute, nil)
+
+	record := func(rec *proto.ServiceAnnouncements) alfred.Record {
+		data, err := rec.MarshalVT()
+		if err != nil {
+			t.Fatalf("MarshalVT() error = %v", err)
+		}
+		return alfred.Record{Data: data}
+	}
+
+	ours := testAnnouncements("aa:bb:cc:dd:ee:01", "10.41.1.10", testService("rtsp-cam", 554, ServiceAddressSelf, 5*time.Minute))
+	ours.MeshId = "default"
+	foreign := testAnnouncements("aa:bb:cc:dd:ee:02", "10.41.1.20", testService("nas", 445, ServiceAddressSelf, 5*time.Minute))
+	foreign.MeshId = "other"
+
+	(*created)[0].records = []alfred.Record{record(ours), record(foreign), {Data: []byte{0xff}}}
+
+	sw.receiveTick(context.Background())
+
+	active := sw.services.Active()
+	if len(active) != 1 {
+		t.Fatalf("services = %+v, want only the service of this mesh", active)
+	}
+	want := Service{NodeMac: "aa:bb:cc:dd:ee:01", Hostname: "node-01", Name: "rtsp-cam", Proto: "tcp", Port: 554, Address: "10.41.1.10"}
+	got := active[0]
+	got.Expires = time.Time{}
+	if got != want {
+		t.Errorf("service = %+v, want %+v", got, want)
+	}
+}
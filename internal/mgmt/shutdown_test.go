@@ -0,0 +1,167 @@
+package mgmt
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openmanet/go-alfred"
+	proto "github.com/openmanet/openmanetd/internal/api/openmanet/v1"
+	"github.com/rs/zerolog"
+)
+
+// publishedRecord is a record set through recordingAlfred.
+type publishedRecord struct {
+	dataType uint8
+	data     []byte
+	// stopped is whether the workers had been told to stop when it was set.
+	stopped bool
+}
+
+// recordingAlfred is an alfredTransport that records what is published.
+type recordingAlfred struct {
+	mu      sync.Mutex
+	stop    <-chan os.Signal
+	records []publishedRecord
+}
+
+func (f *recordingAlfred) Set(dataType uint8, version uint8, data []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	stopped := false
+	select {
+	case <-f.stop:
+		stopped = true
+	default:
+	}
+	f.records = append(f.records, publishedRecord{dataType: dataType, data: data, stopped: stopped})
+
+	return nil
+}
+
+func (f *recordingAlfred) Request(dataType uint8) ([]alfred.Record, error) {
+	return nil, nil
+}
+
+// newShutdownManager returns a manager with a gateway and an address reservation
+// worker that have published their records through client.
+func newShutdownManager(client *AlfredClient) *ManagementConfig {
+	m := &ManagementConfig{
+		Log:      zerolog.Nop(),
+		stop:     make(chan os.Signal),
+		stopOnce: new(sync.Once),
+	}
+	deps := Deps{Log: zerolog.Nop(), Client: client}
+
+	m.gatewayWorker = &GatewayWorker{Deps: deps}
+	m.gatewayWorker.published.Store(&proto.Gateway{Mac: "aa:bb:cc:dd:ee:01", Ipaddr: "10.41.0.1"})
+
+	m.addressReservationWorker = &AddressReservationWorker{Deps: deps}
+	m.addressReservationWorker.advertised.Store(&proto.AddressReservation{Mac: "aa:bb:cc:dd:ee:01", StaticIp: "10.41.0.1", SchemaVersion: ReservationSchemaVersion})
+
+	return m
+}
+
+func TestShutdown_PublishesBeforeStopping(t *testing.T) {
+	fake := &recordingAlfred{}
+	client, err := newAlfredClient(func() (alfredTransport, error) { return fake, nil }, time.Second, zerolog.Nop())
+	if err != nil {
+		t.Fatalf("newAlfredClient() error = %v", err)
+	}
+	m := newShutdownManager(client)
+	fake.stop = m.stop
+
+	m.Shutdown(context.Background())
+
+	select {
+	case <-m.stop:
+	default:
+		t.Fatal("Shutdown() did not stop the workers")
+	}
+
+	if len(fake.records) != 2 {
+		t.Fatalf("published %d records, want 2", len(fake.records))
+	}
+	for _, rec := range fake.records {
+		if rec.stopped {
+			t.Errorf("record of type %d published after the workers were stopped", rec.dataType)
+		}
+	}
+
+	var gateway proto.Gateway
+	if fake.records[0].dataType != GatewayDataType || gateway.UnmarshalVT(fake.records[0].data) != nil || !gateway.Withdrawing {
+		t.Errorf("first record = %+v, want a withdrawing gateway record", fake.records[0])
+	}
+
+	var res proto.AddressReservation
+	if fake.records[1].dataType != AddressReservationDataType || res.UnmarshalVT(fake.records[1].data) != nil {
+		t.Fatalf("second record = %+v, want an address reservation", fake.records[1])
+	}
+	if !res.ShuttingDown || res.RefreshedAt == 0 || res.StaticIp != "10.41.0.1" {
+		t.Errorf("final reservation = %v, want the reservation marked shutting down and refreshed", &res)
+	}
+
+	// The published records themselves are left unchanged
+	if m.gatewayWorker.published.Load().Withdrawing || m.addressReservationWorker.advertised.Load().ShuttingDown {
+		t.Error("Shutdown() modified the records kept by the workers")
+	}
+}
+
+func TestShutdown_AlfredUnreachable(t *testing.T) {
+	client, _ := newTestAlfredClient(t, time.Minute, true)
+	m := newShutdownManager(client)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	m.Shutdown(ctx)
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Shutdown() took %v with alfred unreachable, want it bounded by the context", elapsed)
+	}
+	select {
+	case <-m.stop:
+	default:
+		t.Error("Shutdown() did not stop the workers when alfred was unreachable")
+	}
+}
+
+func TestShutdown_NothingPublished(t *testing.T) {
+	fake := &recordingAlfred{}
+	client, err := newAlfredClient(func() (alfredTransport, error) { return fake, nil }, time.Second, zerolog.Nop())
+	if err != nil {
+		t.Fatalf("newAlfredClient() error = %v", err)
+	}
+	m := newShutdownManager(client)
+	m.gatewayWorker.published.Store(nil)
+	m.addressReservationWorker = nil
+
+	m.Shutdown(context.Background())
+	m.Shutdown(context.Background())
+
+	if len(fake.records) != 0 {
+		t.Errorf("published %d records for a node that announced nothing", len(fake.records))
+	}
+}
+
+func TestWorkerContext(t *testing.T) {
+	shutdown := make(chan os.Signal)
+	ctx, cancel := workerContext(shutdown)
+	defer cancel()
+
+	if ctx.Err() != nil {
+		t.Fatal("worker context done before shutdown")
+	}
+
+	// A tick in progress sees the shutdown through its ctx
+	close(shutdown)
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Error("worker context not cancelled on shutdown")
+	}
+}
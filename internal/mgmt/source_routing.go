@@ -0,0 +1,37 @@
+package mgmt
+
+import (
+	"errors"
+
+	"github.com/openmanet/openmanetd/internal/network"
+)
+
+// sourceRoutingOwner is the name the uplink default routes are managed under.
+const sourceRoutingOwner = "sourceRouting"
+
+// applySourceRouting is overridable for tests.
+var applySourceRouting = network.ApplySourceRouting
+
+// UpdateSourceRouting applies the source routing of a gateway, the rules and uplink
+// tables that send the traffic of chosen mesh sources out through a given uplink,
+// and keeps the default routes of the uplinks installed, so that an LTE modem that
+// drops its link gets its route back when it reconnects. An empty list removes the
+// source routing.
+func (m *ManagementConfig) UpdateSourceRouting(uplinks []*network.Uplink, priority int) {
+	err := applySourceRouting(uplinks, priority)
+	if errors.Is(err, network.ErrValidation) {
+		m.Log.Error().Err(err).Msg("Ignoring invalid source routing")
+		return
+	}
+	if err != nil {
+		m.Log.Error().Err(err).Msg("Failed to apply source routing")
+	}
+
+	routes := make([]*network.Route, 0, len(uplinks))
+	for _, uplink := range uplinks {
+		routes = append(routes, uplink.Route())
+	}
+	if err := m.managedRoutes.SetRoutes(sourceRoutingOwner, routes); err != nil {
+		m.Log.Error().Err(err).Msg("Failed to install uplink routes")
+	}
+}
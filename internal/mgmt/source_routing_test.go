@@ -0,0 +1,69 @@
+package mgmt
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/openmanet/openmanetd/internal/network"
+	"github.com/rs/zerolog"
+)
+
+func stubApplySourceRouting(t *testing.T, err error) *[]*network.Uplink {
+	t.Helper()
+
+	old := applySourceRouting
+	t.Cleanup(func() { applySourceRouting = old })
+
+	applied := &[]*network.Uplink{}
+	applySourceRouting = func(uplinks []*network.Uplink, priority int) error {
+		*applied = uplinks
+		return err
+	}
+
+	return applied
+}
+
+func TestUpdateSourceRouting(t *testing.T) {
+	applied := stubApplySourceRouting(t, nil)
+
+	wan, _ := network.NewUplink("wan", "eth0", "192.0.2.1", 200, []string{"10.41.0.0/16"})
+	lte, _ := network.NewUplink("lte", "wwan0", "", 201, []string{"10.41.0.23"})
+	kernel := newFakeRouteTable()
+	m := &ManagementConfig{Log: zerolog.Nop(), managedRoutes: newManagedRouteReconciler(kernel, zerolog.Nop())}
+
+	m.UpdateSourceRouting([]*network.Uplink{wan, lte}, network.DefaultSourceRulePriority)
+	if len(*applied) != 2 {
+		t.Errorf("applied %v, want both uplinks", *applied)
+	}
+	if kernel.count(wan.Route()) != 1 || kernel.count(lte.Route()) != 1 {
+		t.Fatalf("routes = %v, want the default routes of both uplinks", kernel.routes)
+	}
+
+	// The LTE modem drops its link and the kernel flushes its route
+	kernel.setDown("wwan0")
+	delete(kernel.down, "wwan0")
+	if err := m.managedRoutes.Reconcile(); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if kernel.count(lte.Route()) != 1 {
+		t.Errorf("routes = %v, want the LTE route reinstalled", kernel.routes)
+	}
+
+	m.UpdateSourceRouting(nil, network.DefaultSourceRulePriority)
+	if len(kernel.routes) != 0 {
+		t.Errorf("routes = %v after removing the uplinks, want none", kernel.routes)
+	}
+}
+
+func TestUpdateSourceRouting_Invalid(t *testing.T) {
+	stubApplySourceRouting(t, fmt.Errorf("%w: uplinks wan and lte have the same table", network.ErrValidation))
+
+	wan, _ := network.NewUplink("wan", "eth0", "192.0.2.1", 200, []string{"10.41.0.0/16"})
+	kernel := newFakeRouteTable()
+	m := &ManagementConfig{Log: zerolog.Nop(), managedRoutes: newManagedRouteReconciler(kernel, zerolog.Nop())}
+
+	m.UpdateSourceRouting([]*network.Uplink{wan}, network.DefaultSourceRulePriority)
+	if len(kernel.routes) != 0 {
+		t.Errorf("routes = %v, want none for invalid source routing", kernel.routes)
+	}
+}
@@ -0,0 +1,149 @@
+package mgmt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+// DefaultStatePath is where runtime state that must survive a restart is kept. It
+// lives on the overlay next to the config file, so writes should be infrequent.
+const DefaultStatePath string = "/etc/openmanet/state.json"
+
+// State is runtime state persisted across restarts.
+type State struct {
+	// Pools holds the DHCP pool usage history, keyed by UCI dhcp section.
+	Pools map[string]*PoolHistory `json:"pools,omitempty"`
+
+	// Pending is the configuration the address reservation flow started writing but
+	// has not marked as configured yet, or nil.
+	Pending *PendingConfiguration `json:"pending,omitempty"`
+
+	// Gateway is the gateway the default route last pointed at, or nil.
+	Gateway *GatewayDecision `json:"gateway,omitempty"`
+
+	// Delegation holds the address blocks this node owns in delegated allocation
+	// mode and the addresses it handed out from them, or nil.
+	Delegation *DelegationState `json:"delegation,omitempty"`
+
+	// Routes holds the routes the managed route reconciler installed, keyed by the
+	// owner of their set.
+	Routes map[string][]RouteRecord `json:"routes,omitempty"`
+}
+
+// LoadState reads the state file at path. A missing file yields an empty state.
+//
+// Returns an error if the file exists but cannot be read or parsed.
+func LoadState(path string) (*State, error) {
+	state := &State{Pools: make(map[string]*PoolHistory)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file %s: %w", path, err)
+	}
+
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s: %w", path, err)
+	}
+
+	if state.Pools == nil {
+		state.Pools = make(map[string]*PoolHistory)
+	}
+
+	return state, nil
+}
+
+// Save writes the state to path atomically, so a crash or power loss leaves either
+// the old or the new state and never a truncated file.
+func (s *State) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".state-*")
+	if err != nil {
+		return fmt.Errorf("failed to create state file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync state file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close state file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace state file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// StateStore shares the state file between the workers. Every read and change of the
+// state holds its lock, and changes are saved right away, so a save by one worker
+// never drops or races with the changes of another.
+type StateStore struct {
+	path string
+	log  zerolog.Logger
+
+	mu    sync.Mutex
+	state *State
+}
+
+// OpenStateStore loads the state file at path, DefaultStatePath if empty. A file that
+// cannot be read or parsed is logged and replaced by an empty state.
+func OpenStateStore(path string, log zerolog.Logger) *StateStore {
+	if path == "" {
+		path = DefaultStatePath
+	}
+
+	state, err := LoadState(path)
+	if err != nil {
+		log.Error().Err(err).Msg("Error loading state, starting with empty state")
+		state = &State{Pools: make(map[string]*PoolHistory)}
+	}
+
+	return &StateStore{path: path, log: log, state: state}
+}
+
+// Read calls fn with the state. fn must not keep a reference to it.
+func (s *StateStore) Read(fn func(*State)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fn(s.state)
+}
+
+// Update calls fn with the state and saves it if fn returns true. A failure to save
+// is logged; the change is kept in memory and saved with the next one.
+func (s *StateStore) Update(fn func(*State) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !fn(s.state) {
+		return
+	}
+	if err := s.state.Save(s.path); err != nil {
+		s.log.Error().Err(err).Msg("Error saving state")
+	}
+}
@@ -0,0 +1,109 @@
+package mgmt
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestLoadState(t *testing.T) {
+	dir := t.TempDir()
+
+	state, err := LoadState(filepath.Join(dir, "missing.json"))
+	if err != nil {
+		t.Fatalf("LoadState(missing) error = %v", err)
+	}
+	if state.Pools == nil || len(state.Pools) != 0 {
+		t.Errorf("LoadState(missing) = %+v, want an empty state", state)
+	}
+
+	bad := filepath.Join(dir, "bad.json")
+	if err := os.WriteFile(bad, []byte("{"), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if _, err := LoadState(bad); err == nil {
+		t.Error("LoadState() error = nil for a corrupt file")
+	}
+}
+
+func TestState_SaveRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "openmanet", "state.json")
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	state := &State{Pools: map[string]*PoolHistory{
+		"ahwlan": {
+			Buckets:    []PoolBucket{{Start: now, Peak: 7}},
+			LastBusy:   now,
+			LastResize: now.Add(-time.Hour),
+		},
+	}}
+
+	if err := state.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	loaded, err := LoadState(path)
+	if err != nil {
+		t.Fatalf("LoadState() error = %v", err)
+	}
+
+	h := loaded.Pools["ahwlan"]
+	if h == nil || h.Peak() != 7 || !h.LastBusy.Equal(now) || !h.LastResize.Equal(now.Add(-time.Hour)) {
+		t.Errorf("LoadState() pool = %+v, want the saved history", h)
+	}
+
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("state directory has %d entries, want only the state file", len(entries))
+	}
+}
+
+func TestStateStore_SharedBetweenWorkers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	store := OpenStateStore(path, zerolog.Nop())
+
+	// The pool history of one worker and the gateway of another both survive
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for range 50 {
+			store.Update(func(state *State) bool {
+				state.Pools["ahwlan"] = &PoolHistory{LastBusy: time.Now()}
+				return true
+			})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for range 50 {
+			store.Update(func(state *State) bool {
+				state.Gateway = &GatewayDecision{Mac: "aa:bb:cc:dd:ee:01", IP: "10.41.0.1"}
+				return true
+			})
+		}
+	}()
+	wg.Wait()
+
+	loaded, err := LoadState(path)
+	if err != nil {
+		t.Fatalf("LoadState() error = %v", err)
+	}
+	if loaded.Pools["ahwlan"] == nil || loaded.Gateway == nil {
+		t.Errorf("LoadState() = %+v, want both the pool history and the gateway", loaded)
+	}
+}
+
+func TestStateStore_UpdateWithoutChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	store := OpenStateStore(path, zerolog.Nop())
+
+	store.Update(func(*State) bool { return false })
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("state file written for an update without changes: %v", err)
+	}
+}
@@ -0,0 +1,261 @@
+package mgmt
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	proto "github.com/openmanet/openmanetd/internal/api/openmanet/v1"
+	batmanadv "github.com/openmanet/openmanetd/internal/batman-adv"
+	"github.com/openmanet/openmanetd/internal/network"
+	"github.com/openmanet/openmanetd/internal/safemode"
+)
+
+// NodeStatus summarises this node for status queries.
+type NodeStatus struct {
+	Hostname           string `json:"hostname"`
+	Mac                string `json:"mac"`
+	IP                 string `json:"ip"`
+	MeshID             string `json:"meshId"`
+	GatewayMode        bool   `json:"gatewayMode"`
+	SafeMode           bool   `json:"safeMode"`
+	ForeignRecords     uint64 `json:"foreignRecords"`
+	UnsupportedRecords uint64 `json:"unsupportedRecords"`
+
+	// MeshHealth is nil if the batman-adv tables cannot be read.
+	MeshHealth *batmanadv.MeshHealth `json:"meshHealth"`
+	// Bootstrap is nil if the address reservation worker is not running.
+	Bootstrap *BootstrapStatus `json:"bootstrap"`
+	// ManagedRoutes counts the routes the managed route reconciler installed and
+	// put back. Nil unless the manager was created by NewManager.
+	ManagedRoutes *ManagedRouteStats `json:"managedRoutes"`
+}
+
+// SelectedGateway is the gateway this node's default route points at.
+type SelectedGateway struct {
+	Mac      string            `json:"mac"`
+	Hostname string            `json:"hostname"`
+	IP       string            `json:"ip"`
+	State    GatewayProbeState `json:"state"`
+}
+
+// GatewayStatus is the current gateway selection and the failover history.
+type GatewayStatus struct {
+	Selected *SelectedGateway `json:"selected"`
+	History  []GatewayEvent   `json:"history"`
+}
+
+// ReservationStatus lists the address reservations advertised by peers.
+type ReservationStatus struct {
+	Reservations []Reservation `json:"reservations"`
+}
+
+// ServicesStatus lists the services announced over the mesh, ours included.
+type ServicesStatus struct {
+	Services []Service `json:"services"`
+}
+
+// Client is a DHCP client of this node, one holding an active lease.
+type Client struct {
+	Mac      string `json:"mac"`
+	IP       string `json:"ip"`
+	Hostname string `json:"hostname,omitempty"`
+	// Expiry is omitted for a lease that never expires.
+	Expiry time.Time `json:"expiry,omitzero"`
+}
+
+// ClientsStatus lists the DHCP clients of this node.
+type ClientsStatus struct {
+	Clients []Client `json:"clients"`
+}
+
+// DeviceScan is what one wireless device heard in a scan. Error is set instead of
+// Results if the device could not scan.
+type DeviceScan struct {
+	Device  string                       `json:"device"`
+	Results []network.WirelessScanResult `json:"results"`
+	Error   string                       `json:"error,omitempty"`
+}
+
+// WirelessScanStatus lists the networks heard by each wireless device of this node,
+// for site surveys and channel selection.
+type WirelessScanStatus struct {
+	Devices []DeviceScan `json:"devices"`
+}
+
+// NodesStatus lists the other nodes seen over alfred.
+type NodesStatus struct {
+	Nodes []Peer `json:"nodes"`
+}
+
+// Status returns a summary of this node.
+func (m *ManagementConfig) Status() NodeStatus {
+	iface := network.GetInterfaceByName(m.Tunables().IFace)
+
+	status := NodeStatus{
+		Hostname:           m.deps.hostname(iface.MAC),
+		Mac:                iface.MAC,
+		MeshID:             m.MeshID,
+		GatewayMode:        m.GatewayMode,
+		SafeMode:           safemode.Enabled(),
+		ForeignRecords:     m.deps.MeshFilter.Foreign(),
+		UnsupportedRecords: m.deps.SchemaFilter.Unsupported(),
+		MeshHealth:         m.deps.meshHealth(m.Tunables().BatInterface),
+	}
+	if addr, ok := iface.PrimaryIPv4(); ok {
+		status.IP = addr.IP.String()
+	}
+	if m.addressReservationWorker != nil {
+		bootstrap := m.addressReservationWorker.bootstrap.Status()
+		status.Bootstrap = &bootstrap
+	}
+	if m.managedRoutes != nil {
+		stats := m.managedRoutes.Stats()
+		status.ManagedRoutes = &stats
+	}
+
+	return status
+}
+
+// Gateways returns the selected gateway and the failover history. Both are empty
+// if the gateway worker is not running.
+func (m *ManagementConfig) Gateways() GatewayStatus {
+	status := GatewayStatus{History: []GatewayEvent{}}
+	if m.gatewayWorker == nil {
+		return status
+	}
+
+	if history := m.gatewayWorker.probes.History(); history != nil {
+		status.History = history
+	}
+
+	if selected := m.gatewayWorker.selected.Load(); selected != nil {
+		status.Selected = &SelectedGateway{
+			Mac:      selected.GetMac(),
+			Hostname: selected.GetHostname(),
+			IP:       selected.GetIpaddr(),
+			State:    m.gatewayWorker.probes.State(selected.GetMac()),
+		}
+	}
+
+	return status
+}
+
+// Reservations returns the active address reservations advertised by peers.
+func (m *ManagementConfig) Reservations() ReservationStatus {
+	status := ReservationStatus{Reservations: []Reservation{}}
+	if m.addressReservationWorker != nil {
+		status.Reservations = m.addressReservationWorker.reservations.Active()
+	}
+
+	return status
+}
+
+// Nodes returns the other nodes seen over alfred.
+func (m *ManagementConfig) Nodes() NodesStatus {
+	status := NodesStatus{Nodes: []Peer{}}
+	if m.nodeDataWorker != nil {
+		status.Nodes = m.nodeDataWorker.peers.Active()
+	}
+
+	return status
+}
+
+// Clients returns the DHCP clients of this node, read from the dnsmasq lease
+// database, or an error if it cannot be read.
+func (m *ManagementConfig) Clients() (ClientsStatus, error) {
+	status := ClientsStatus{Clients: []Client{}}
+
+	leases, err := network.ReadDnsmasqLeases(m.dhcpLeasesPath())
+	if err != nil {
+		return status, err
+	}
+
+	for _, lease := range network.ActiveLeases(leases, time.Now()) {
+		status.Clients = append(status.Clients, Client{
+			Mac:      lease.MAC,
+			IP:       lease.IP.String(),
+			Hostname: lease.Hostname,
+			Expiry:   lease.Expiry,
+		})
+	}
+
+	return status, nil
+}
+
+// WirelessScan scans on every wireless device of this node in turn. A device that
+// cannot scan is reported with its error rather than failing the whole survey.
+//
+// Returns an error if the wireless devices cannot be listed.
+func (m *ManagementConfig) WirelessScan(ctx context.Context) (WirelessScanStatus, error) {
+	status := WirelessScanStatus{Devices: []DeviceScan{}}
+
+	devices, err := network.WirelessDevicesContext(ctx)
+	if err != nil {
+		return status, err
+	}
+
+	for _, device := range devices {
+		scan := DeviceScan{Device: device, Results: []network.WirelessScanResult{}}
+		if results, err := network.ScanWirelessContext(ctx, device); err != nil {
+			scan.Error = err.Error()
+		} else {
+			scan.Results = results
+		}
+		status.Devices = append(status.Devices, scan)
+	}
+
+	return status, nil
+}
+
+// Services returns the services announced over the mesh.
+func (m *ManagementConfig) Services() ServicesStatus {
+	status := ServicesStatus{Services: []Service{}}
+	if m.serviceWorker != nil {
+		status.Services = m.serviceWorker.services.Active()
+	}
+
+	return status
+}
+
+// MeshHealth returns the neighbor and originator counts and the state of the mesh as
+// seen by this node.
+func (m *ManagementConfig) MeshHealth() (*batmanadv.MeshHealth, error) {
+	if m.deps.MeshHealth == nil {
+		return nil, errors.New("mesh health is not monitored")
+	}
+
+	return m.deps.MeshHealth.Get(m.Tunables().BatInterface)
+}
+
+// Topology returns the mesh topology graph: the originator and neighbor tables of
+// this node merged with the summaries published by peers, with the nodes named from
+// the node records.
+func (m *ManagementConfig) Topology() (*batmanadv.Topology, error) {
+	t := m.Tunables()
+
+	read := batmanadv.BuildTopology
+	if m.topologyWorker != nil {
+		read = m.topologyWorker.read
+	}
+	topo, err := read(t.BatInterface)
+	if err != nil {
+		return nil, err
+	}
+
+	iface := network.GetInterfaceByName(t.IFace)
+	hostnames := map[string]string{iface.MAC: m.deps.hostname(iface.MAC)}
+	if m.nodeDataWorker != nil {
+		for _, peer := range m.nodeDataWorker.peers.Active() {
+			hostnames[peer.Mac] = peer.Hostname
+		}
+	}
+
+	var summaries []*proto.TopologySummary
+	if m.topologyWorker != nil {
+		summaries = m.topologyWorker.summaries.Active()
+	}
+
+	MergeTopology(topo, iface.MAC, summaries, hostnames)
+	return topo, nil
+}
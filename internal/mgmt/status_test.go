@@ -0,0 +1,133 @@
+package mgmt
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	proto "github.com/openmanet/openmanetd/internal/api/openmanet/v1"
+	"github.com/rs/zerolog"
+)
+
+func TestPeerTable(t *testing.T) {
+	clock := newFakeClock()
+	table := NewPeerTable(DefaultPeerTTL)
+	table.now = clock.Now
+
+	table.Observe(&proto.Node{Mac: "aa:bb:cc:dd:ee:02", Hostname: "node-b", Ipaddr: "10.41.1.20"})
+	table.Observe(&proto.Node{Mac: "", Hostname: "nameless"})
+	clock.Advance(DefaultPeerTTL / 2)
+	table.Observe(&proto.Node{Mac: "aa:bb:cc:dd:ee:01", Hostname: "node-a", Ipaddr: "10.41.1.10"})
+
+	active := table.Active()
+	if len(active) != 2 || active[0].Hostname != "node-a" || active[1].Hostname != "node-b" {
+		t.Fatalf("Active() = %+v, want node-a and node-b", active)
+	}
+
+	// node-b expires, node-a was seen later
+	clock.Advance(DefaultPeerTTL / 2)
+	active = table.Active()
+	if len(active) != 1 || active[0].Mac != "aa:bb:cc:dd:ee:01" {
+		t.Errorf("Active() = %+v, want only node-a", active)
+	}
+}
+
+func TestManagementConfig_StatusWithoutWorkers(t *testing.T) {
+	m := &ManagementConfig{Log: zerolog.Nop()}
+
+	// Disabled workers still produce empty lists rather than null
+	for name, v := range map[string]any{
+		"gateways":     m.Gateways(),
+		"reservations": m.Reservations(),
+		"nodes":        m.Nodes(),
+	} {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("%s: Marshal() error = %v", name, err)
+		}
+
+		var decoded map[string]any
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("%s: Unmarshal() error = %v", name, err)
+		}
+		for key, value := range decoded {
+			if value == nil && key != "selected" {
+				t.Errorf("%s: %s is null in %s", name, key, data)
+			}
+		}
+	}
+}
+
+func TestManagementConfig_Gateways(t *testing.T) {
+	gw := &GatewayWorker{probes: NewGatewayProbeTracker(zerolog.Nop())}
+	m := &ManagementConfig{Log: zerolog.Nop(), gatewayWorker: gw}
+
+	if got := m.Gateways(); got.Selected != nil {
+		t.Errorf("Selected = %+v before any selection", got.Selected)
+	}
+
+	gw.probes.RecordSelection("aa:bb:cc:dd:ee:01", "10.41.0.1")
+	gw.selected.Store(&proto.Gateway{Mac: "aa:bb:cc:dd:ee:01", Hostname: "gw1", Ipaddr: "10.41.0.1"})
+
+	data, err := json.Marshal(m.Gateways())
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	var decoded struct {
+		Selected struct {
+			Hostname string `json:"hostname"`
+			State    string `json:"state"`
+		} `json:"selected"`
+		History []struct {
+			Mac   string `json:"mac"`
+			State string `json:"state"`
+		} `json:"history"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	if decoded.Selected.Hostname != "gw1" || decoded.Selected.State != "unverified" {
+		t.Errorf("selected = %+v, want gw1 unverified", decoded.Selected)
+	}
+	if len(decoded.History) != 1 || decoded.History[0].State != "unverified" {
+		t.Errorf("history = %+v, want one unverified selection", decoded.History)
+	}
+}
+
+func TestManagementConfig_Clients(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dhcp.leases")
+	expiry := time.Now().Add(time.Hour).Unix()
+	leases := fmt.Sprintf(`%d aa:bb:cc:dd:ee:01 10.41.1.100 phone *
+0 aa:bb:cc:dd:ee:02 10.41.1.101 * *
+1 aa:bb:cc:dd:ee:03 10.41.1.102 expired *
+`, expiry)
+	if err := os.WriteFile(path, []byte(leases), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	m := &ManagementConfig{Log: zerolog.Nop(), DHCPLeasesPath: path}
+
+	status, err := m.Clients()
+	if err != nil {
+		t.Fatalf("Clients() error = %v", err)
+	}
+	want := []Client{
+		{Mac: "aa:bb:cc:dd:ee:01", IP: "10.41.1.100", Hostname: "phone", Expiry: time.Unix(expiry, 0)},
+		{Mac: "aa:bb:cc:dd:ee:02", IP: "10.41.1.101"},
+	}
+	if !reflect.DeepEqual(status.Clients, want) {
+		t.Errorf("Clients() = %+v, want %+v", status.Clients, want)
+	}
+
+	// No lease database yet means no clients rather than null
+	m.DHCPLeasesPath = filepath.Join(t.TempDir(), "missing")
+	status, err = m.Clients()
+	if err != nil || status.Clients == nil || len(status.Clients) != 0 {
+		t.Errorf("Clients() without leases = %+v, %v, want an empty list", status, err)
+	}
+}
@@ -0,0 +1,153 @@
+package mgmt
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// DefaultTickWarnInterval is the minimum time between tick overrun warnings.
+const DefaultTickWarnInterval time.Duration = 5 * time.Minute
+
+// tickBuckets are the upper bounds of the tick duration histogram as fractions of
+// the tick interval. The last histogram bucket counts ticks longer than the interval.
+var tickBuckets = []float64{0.1, 0.25, 0.5, 1}
+
+// TickStats is a snapshot of the ticks measured by a TickMonitor.
+type TickStats struct {
+	// Ticks is the number of tick bodies run.
+	Ticks uint64
+	// Overruns is the number of ticks that took longer than the interval.
+	Overruns uint64
+	// Missed is the number of ticker ticks dropped while overrunning ticks ran.
+	Missed uint64
+	// Reentered is the number of ticks skipped because one was still running.
+	Reentered uint64
+	// Last is the duration of the most recent tick.
+	Last time.Duration
+	// Max is the longest tick seen.
+	Max time.Duration
+	// Histogram counts ticks per tickBuckets bound, plus one bucket for overruns.
+	Histogram []uint64
+}
+
+// TickMonitor measures the ticks of a worker loop.
+//
+// A time.Ticker drops ticks while the receiver is busy, so a tick that takes longer
+// than the interval silently stretches the loop, and anything that assumes a peer had
+// one interval to react no longer holds. The monitor times every tick, counts the
+// overruns and the ticker ticks they cost, and logs a warning at most once per warn
+// interval while it happens.
+//
+// Tick bodies are also kept from overlapping: a tick started while another is still
+// running is skipped and counted, so work triggered from more than one place never
+// runs concurrently.
+type TickMonitor struct {
+	name      string
+	interval  time.Duration
+	warnEvery time.Duration
+	log       zerolog.Logger
+	now       func() time.Time
+
+	running atomic.Bool
+
+	mu               sync.Mutex
+	stats            TickStats
+	lastWarn         time.Time
+	overrunsSinceLog uint64
+}
+
+// NewTickMonitor creates a monitor for the ticks of the named loop, which runs every
+// interval.
+func NewTickMonitor(name string, interval time.Duration, log zerolog.Logger) *TickMonitor {
+	return &TickMonitor{
+		name:      name,
+		interval:  interval,
+		warnEvery: DefaultTickWarnInterval,
+		log:       log,
+		now:       time.Now,
+		stats:     TickStats{Histogram: make([]uint64, len(tickBuckets)+1)},
+	}
+}
+
+// Run runs body as one tick and records how long it took.
+//
+// Returns false without running body if the previous tick has not finished.
+func (m *TickMonitor) Run(body func()) bool {
+	if !m.running.CompareAndSwap(false, true) {
+		m.mu.Lock()
+		m.stats.Reentered++
+		m.mu.Unlock()
+		m.log.Debug().Str("loop", m.name).Msg("Skipping tick, previous tick still running")
+		return false
+	}
+	defer m.running.Store(false)
+
+	start := m.now()
+	body()
+	m.record(m.now().Sub(start))
+
+	return true
+}
+
+// Stats returns a snapshot of the measured ticks.
+func (m *TickMonitor) Stats() TickStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := m.stats
+	stats.Histogram = append([]uint64(nil), m.stats.Histogram...)
+
+	return stats
+}
+
+func (m *TickMonitor) record(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.stats.Ticks++
+	m.stats.Last = d
+	m.stats.Max = max(m.stats.Max, d)
+	m.stats.Histogram[m.bucket(d)]++
+
+	if m.interval <= 0 || d <= m.interval {
+		return
+	}
+
+	missed := uint64(d / m.interval)
+	m.stats.Overruns++
+	m.stats.Missed += missed
+	m.overrunsSinceLog++
+
+	now := m.now()
+	if !m.lastWarn.IsZero() && now.Sub(m.lastWarn) < m.warnEvery {
+		return
+	}
+
+	m.log.Warn().
+		Str("loop", m.name).
+		Dur("duration", d).
+		Dur("interval", m.interval).
+		Uint64("missedTicks", missed).
+		Uint64("overrunsSinceLastWarning", m.overrunsSinceLog).
+		Msg("Worker tick took longer than its interval")
+
+	m.lastWarn = now
+	m.overrunsSinceLog = 0
+}
+
+func (m *TickMonitor) bucket(d time.Duration) int {
+	if m.interval <= 0 {
+		return len(tickBuckets)
+	}
+
+	for i, frac := range tickBuckets {
+		if d <= time.Duration(frac*float64(m.interval)) {
+			return i
+		}
+	}
+
+	return len(tickBuckets)
+}
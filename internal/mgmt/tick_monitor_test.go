@@ -0,0 +1,107 @@
+package mgmt
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// newTestTickMonitor returns a monitor on a clock that only moves when a tick body
+// advances it.
+func newTestTickMonitor(interval time.Duration, log zerolog.Logger) (*TickMonitor, *fakeClock) {
+	clock := newFakeClock()
+	m := NewTickMonitor("test", interval, log)
+	m.now = clock.Now
+
+	return m, clock
+}
+
+func TestTickMonitor_Overruns(t *testing.T) {
+	m, clock := newTestTickMonitor(10*time.Second, zerolog.Nop())
+
+	for _, d := range []time.Duration{2 * time.Second, 10 * time.Second, 25 * time.Second, time.Second, 41 * time.Second} {
+		if !m.Run(clock.slowTick(d)) {
+			t.Fatalf("Run() skipped a tick of %s", d)
+		}
+	}
+
+	stats := m.Stats()
+	if stats.Ticks != 5 {
+		t.Errorf("Ticks = %d, want 5", stats.Ticks)
+	}
+	if stats.Overruns != 2 {
+		t.Errorf("Overruns = %d, want 2", stats.Overruns)
+	}
+	// 25s drops 2 ticker ticks, 41s drops 4
+	if stats.Missed != 6 {
+		t.Errorf("Missed = %d, want 6", stats.Missed)
+	}
+	if stats.Last != 41*time.Second {
+		t.Errorf("Last = %s, want 41s", stats.Last)
+	}
+	if stats.Max != 41*time.Second {
+		t.Errorf("Max = %s, want 41s", stats.Max)
+	}
+
+	want := []uint64{1, 1, 0, 1, 2}
+	for i := range want {
+		if stats.Histogram[i] != want[i] {
+			t.Errorf("Histogram = %v, want %v", stats.Histogram, want)
+			break
+		}
+	}
+}
+
+func TestTickMonitor_WarningThrottled(t *testing.T) {
+	var buf bytes.Buffer
+	m, clock := newTestTickMonitor(time.Second, zerolog.New(&buf))
+
+	for range 3 {
+		m.Run(clock.slowTick(2 * time.Second))
+	}
+	if got := strings.Count(buf.String(), "longer than its interval"); got != 1 {
+		t.Fatalf("warnings = %d, want 1 within the warn interval:\n%s", got, buf.String())
+	}
+
+	clock.Advance(DefaultTickWarnInterval)
+	m.Run(clock.slowTick(2 * time.Second))
+
+	if got := strings.Count(buf.String(), "longer than its interval"); got != 2 {
+		t.Fatalf("warnings = %d, want 2 after the warn interval:\n%s", got, buf.String())
+	}
+	if !strings.Contains(buf.String(), `"overrunsSinceLastWarning":3`) {
+		t.Errorf("second warning does not count the suppressed overruns:\n%s", buf.String())
+	}
+}
+
+func TestTickMonitor_NonReentrant(t *testing.T) {
+	m, clock := newTestTickMonitor(time.Second, zerolog.Nop())
+
+	var inner bool
+	ran := m.Run(func() {
+		inner = m.Run(clock.slowTick(time.Second))
+		clock.Advance(100 * time.Millisecond)
+	})
+
+	if !ran {
+		t.Fatal("outer Run() was skipped")
+	}
+	if inner {
+		t.Error("nested Run() ran while a tick was in progress")
+	}
+
+	stats := m.Stats()
+	if stats.Reentered != 1 {
+		t.Errorf("Reentered = %d, want 1", stats.Reentered)
+	}
+	if stats.Ticks != 1 {
+		t.Errorf("Ticks = %d, want 1", stats.Ticks)
+	}
+
+	if !m.Run(clock.slowTick(0)) {
+		t.Error("Run() skipped after the previous tick finished")
+	}
+}
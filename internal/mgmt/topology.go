@@ -0,0 +1,255 @@
+package mgmt
+
+import (
+	"context"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	proto "github.com/openmanet/openmanetd/internal/api/openmanet/v1"
+	batmanadv "github.com/openmanet/openmanetd/internal/batman-adv"
+	"github.com/openmanet/openmanetd/internal/network"
+)
+
+const (
+	TopologyDataType        uint8 = uint8(proto.DataType_DATA_TYPE_TOPOLOGY)
+	TopologyDataTypeVersion uint8 = 1
+
+	topologyWorkerInterval time.Duration = 60 * time.Second
+)
+
+// NewTopologySummary returns the record listing the direct neighbors of the local
+// node of topo, published under mac.
+func NewTopologySummary(mac, meshID string, topo *batmanadv.Topology) *proto.TopologySummary {
+	summary := &proto.TopologySummary{
+		Mac:        mac,
+		Originator: topo.Self,
+		MeshId:     meshID,
+	}
+	for _, e := range topo.LocalLinks() {
+		summary.Links = append(summary.Links, &proto.TopologyLink{
+			Neighbor:      e.To,
+			Tq:            uint32(e.TQ),
+			Throughput:    uint32(e.Throughput),
+			LastSeenMsecs: uint32(e.LastSeenMsecs),
+		})
+	}
+
+	return summary
+}
+
+// MergeTopology adds the links of the peer summaries to topo and names its nodes.
+// hostnames maps the MACs of node records to hostnames; a node is named if its
+// originator is such a MAC or a summary links the two. selfMAC is the MAC the local
+// node publishes its records under, and its own summary is skipped.
+func MergeTopology(topo *batmanadv.Topology, selfMAC string, summaries []*proto.TopologySummary, hostnames map[string]string) {
+	names := make(map[string]string, len(hostnames)+1)
+	for mac, name := range hostnames {
+		names[mac] = name
+	}
+	names[topo.Self] = hostnames[selfMAC]
+
+	for _, s := range summaries {
+		if s.GetMac() == selfMAC {
+			continue
+		}
+
+		links := make([]batmanadv.TopologyEdge, 0, len(s.GetLinks()))
+		for _, l := range s.GetLinks() {
+			links = append(links, batmanadv.TopologyEdge{
+				To:            l.GetNeighbor(),
+				TQ:            int(l.GetTq()),
+				Throughput:    int(l.GetThroughput()),
+				LastSeenMsecs: int(l.GetLastSeenMsecs()),
+			})
+		}
+		topo.AddLinks(s.GetOriginator(), links)
+
+		if name := hostnames[s.GetMac()]; name != "" {
+			names[s.GetOriginator()] = name
+		}
+	}
+
+	topo.SetHostnames(names)
+}
+
+// TopologyTable tracks the topology summaries received over alfred, keyed by
+// originator address.
+type TopologyTable struct {
+	mu      sync.Mutex
+	entries map[string]topologyEntry
+	ttl     time.Duration
+
+	// now is overridable for tests.
+	now func() time.Time
+}
+
+type topologyEntry struct {
+	summary  *proto.TopologySummary
+	lastSeen time.Time
+}
+
+// NewTopologyTable creates an empty TopologyTable whose entries expire after ttl.
+func NewTopologyTable(ttl time.Duration) *TopologyTable {
+	return &TopologyTable{
+		entries: make(map[string]topologyEntry),
+		ttl:     ttl,
+		now:     time.Now,
+	}
+}
+
+// Observe records a summary seen over alfred and refreshes its expiry. Summaries
+// without an originator are ignored.
+func (t *TopologyTable) Observe(summary *proto.TopologySummary) {
+	if summary.GetOriginator() == "" {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.entries[summary.GetOriginator()] = topologyEntry{summary: summary.CloneVT(), lastSeen: t.now()}
+}
+
+// Active removes expired summaries and returns the rest, sorted by originator.
+func (t *TopologyTable) Active() []*proto.TopologySummary {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	active := make([]*proto.TopologySummary, 0, len(t.entries))
+	for originator, entry := range t.entries {
+		if now.Sub(entry.lastSeen) >= t.ttl {
+			delete(t.entries, originator)
+			continue
+		}
+		active = append(active, entry.summary.CloneVT())
+	}
+
+	sort.Slice(active, func(i, j int) bool {
+		return active[i].GetOriginator() < active[j].GetOriginator()
+	})
+
+	return active
+}
+
+// TopologyWorker publishes this node's direct neighbors, if enabled, and collects
+// the summaries published by other nodes.
+type TopologyWorker struct {
+	// Config holds the settings fixed at startup, Deps the shared runtime
+	// dependencies and Tunables the settings that may change between ticks.
+	Config       *ManagementConfig
+	Deps         Deps
+	Tunables     TunablesProvider
+	Interval     time.Duration
+	ShutdownChan <-chan os.Signal
+
+	// summaries holds the summaries received over alfred; MergeTopology skips our own.
+	summaries *TopologyTable
+
+	// read is overridable for tests.
+	read func(meshIface string) (*batmanadv.Topology, error)
+
+	// lastTunables are the tunables of the most recent tick.
+	lastTunables atomic.Pointer[Tunables]
+}
+
+// NewTopologyWorkerWithDeps creates a topology worker that uses deps and takes a
+// snapshot of tunables at the start of every tick.
+func NewTopologyWorkerWithDeps(config *ManagementConfig, deps Deps, tunables TunablesProvider, interval time.Duration, shutdownChan <-chan os.Signal) *TopologyWorker {
+	deps.Log.Info().Msg("TopologyWorker initialized")
+
+	return &TopologyWorker{
+		Config:       config,
+		Deps:         deps,
+		Tunables:     tunables,
+		Interval:     interval,
+		ShutdownChan: shutdownChan,
+
+		summaries: NewTopologyTable(DefaultPeerTTL),
+		read:      batmanadv.BuildTopology,
+	}
+}
+
+// StartSend begins the periodic publication of this node's topology summary.
+func (tw *TopologyWorker) StartSend() {
+	ticker := time.NewTicker(tw.Interval)
+	defer ticker.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for {
+		select {
+		case <-tw.ShutdownChan:
+			return
+		case <-ticker.C:
+			tw.sendTick(ctx)
+		}
+	}
+}
+
+// sendTick publishes the direct neighbors of this node if publishing is enabled.
+func (tw *TopologyWorker) sendTick(ctx context.Context) {
+	if !tw.Config.TopologyPublish {
+		return
+	}
+
+	t := tw.tick()
+
+	topo, err := tw.read(t.BatInterface)
+	if err != nil {
+		tw.Deps.Log.Error().Err(err).Msg("Error reading mesh topology")
+		return
+	}
+
+	iface := network.GetInterfaceByName(t.IFace)
+	data, err := NewTopologySummary(iface.MAC, tw.Config.MeshID, topo).MarshalVT()
+	if err != nil {
+		tw.Deps.Log.Error().Err(err).Msg("Error marshaling topology summary")
+		return
+	}
+
+	if err := tw.Deps.Client.SetCtx(ctx, TopologyDataType, TopologyDataTypeVersion, data); err != nil {
+		tw.Deps.Log.Error().Err(err).Msg("Error sending topology summary")
+	}
+}
+
+// StartReceive begins the periodic receiving of topology summaries.
+func (tw *TopologyWorker) StartReceive() {
+	ticker := time.NewTicker(tw.Interval)
+	defer ticker.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for {
+		select {
+		case <-tw.ShutdownChan:
+			return
+		case <-ticker.C:
+			tw.receiveTick(ctx)
+		}
+	}
+}
+
+// receiveTick updates the summary table from alfred.
+func (tw *TopologyWorker) receiveTick(ctx context.Context) {
+	records, err := tw.Deps.Client.RequestCtx(ctx, TopologyDataType)
+	if err != nil {
+		tw.Deps.Log.Error().Err(err).Msg("Error receiving topology summaries")
+		return
+	}
+
+	records = tw.Deps.MeshFilter.FilterTopology(tw.Deps.RecordLimits.Limit("topology", records))
+	for _, rec := range records {
+		var summary proto.TopologySummary
+		if err := summary.UnmarshalVT(rec.Data); err != nil {
+			tw.Deps.Log.Error().Err(err).Msg("Error unmarshaling topology summary")
+			continue
+		}
+		tw.summaries.Observe(&summary)
+	}
+}
@@ -0,0 +1,143 @@
+package mgmt
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	proto "github.com/openmanet/openmanetd/internal/api/openmanet/v1"
+	batmanadv "github.com/openmanet/openmanetd/internal/batman-adv"
+	"github.com/rs/zerolog"
+)
+
+// localTopology is node 01's own view: direct links to 02 and 03, 04 behind 03.
+func localTopology() *batmanadv.Topology {
+	return batmanadv.AssembleTopology("aa:00:00:00:00:01",
+		batmanadv.Originators{
+			{OrigAddress: "aa:00:00:00:00:02", NeighAddress: "aa:00:00:00:00:02", TQ: 220, Best: true},
+			{OrigAddress: "aa:00:00:00:00:03", NeighAddress: "aa:00:00:00:00:03", TQ: 180, Best: true},
+			{OrigAddress: "aa:00:00:00:00:04", NeighAddress: "aa:00:00:00:00:03", TQ: 150, Best: true},
+		},
+		batmanadv.Neighbors{
+			{NeighAddress: "aa:00:00:00:00:02", LastSeenMsecs: 300},
+			{NeighAddress: "aa:00:00:00:00:03", LastSeenMsecs: 500},
+		})
+}
+
+func TestMergeTopology(t *testing.T) {
+	topo := localTopology()
+
+	// Node records are published under the bridge MAC, which differs from the
+	// originator address; the summaries link the two
+	summaries := []*proto.TopologySummary{
+		{Mac: "02:00:00:00:00:01", Originator: "aa:00:00:00:00:01", Links: []*proto.TopologyLink{{Neighbor: "aa:00:00:00:00:09", Tq: 1}}},
+		{Mac: "02:00:00:00:00:03", Originator: "aa:00:00:00:00:03", Links: []*proto.TopologyLink{
+			{Neighbor: "aa:00:00:00:00:01", Tq: 200, LastSeenMsecs: 400},
+			{Neighbor: "aa:00:00:00:00:04", Tq: 240, LastSeenMsecs: 200},
+		}},
+		{Mac: "02:00:00:00:00:04", Originator: "aa:00:00:00:00:04", Links: []*proto.TopologyLink{
+			{Neighbor: "aa:00:00:00:00:03", Throughput: 54000, LastSeenMsecs: 100},
+		}},
+	}
+	hostnames := map[string]string{
+		"02:00:00:00:00:01": "alpha",
+		"02:00:00:00:00:03": "charlie",
+		// 02 publishes no summary, but its originator is its node MAC
+		"aa:00:00:00:00:02": "bravo",
+	}
+
+	MergeTopology(topo, "02:00:00:00:00:01", summaries, hostnames)
+
+	wantEdges := []batmanadv.TopologyEdge{
+		{From: "aa:00:00:00:00:01", To: "aa:00:00:00:00:02", TQ: 220, LastSeenMsecs: 300},
+		{From: "aa:00:00:00:00:01", To: "aa:00:00:00:00:03", TQ: 180, LastSeenMsecs: 500},
+		{From: "aa:00:00:00:00:03", To: "aa:00:00:00:00:01", TQ: 200, LastSeenMsecs: 400},
+		{From: "aa:00:00:00:00:03", To: "aa:00:00:00:00:04", TQ: 240, LastSeenMsecs: 200},
+		{From: "aa:00:00:00:00:04", To: "aa:00:00:00:00:03", Throughput: 54000, LastSeenMsecs: 100},
+	}
+	if !reflect.DeepEqual(topo.Edges, wantEdges) {
+		t.Errorf("Edges = %+v, want %+v", topo.Edges, wantEdges)
+	}
+
+	names := make(map[string]string)
+	for _, n := range topo.Nodes {
+		names[n.Originator] = n.Hostname
+	}
+	wantNames := map[string]string{
+		"aa:00:00:00:00:01": "alpha",
+		"aa:00:00:00:00:02": "bravo",
+		"aa:00:00:00:00:03": "charlie",
+		"aa:00:00:00:00:04": "",
+	}
+	if !reflect.DeepEqual(names, wantNames) {
+		t.Errorf("hostnames = %v, want %v", names, wantNames)
+	}
+}
+
+func TestNewTopologySummary(t *testing.T) {
+	summary := NewTopologySummary("02:00:00:00:00:01", "default", localTopology())
+
+	want := &proto.TopologySummary{
+		Mac:        "02:00:00:00:00:01",
+		Originator: "aa:00:00:00:00:01",
+		MeshId:     "default",
+		Links: []*proto.TopologyLink{
+			{Neighbor: "aa:00:00:00:00:02", Tq: 220, LastSeenMsecs: 300},
+			{Neighbor: "aa:00:00:00:00:03", Tq: 180, LastSeenMsecs: 500},
+		},
+	}
+	if !summary.EqualVT(want) {
+		t.Errorf("NewTopologySummary() = %v, want %v", summary, want)
+	}
+}
+
+func TestTopologyTable_Expiry(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	table := NewTopologyTable(time.Minute)
+	table.now = func() time.Time { return now }
+
+	table.Observe(&proto.TopologySummary{Mac: "02:00:00:00:00:03", Originator: "aa:00:00:00:00:03"})
+	table.Observe(&proto.TopologySummary{Mac: "02:00:00:00:00:04"})
+
+	if got := table.Active(); len(got) != 1 || got[0].GetOriginator() != "aa:00:00:00:00:03" {
+		t.Fatalf("Active() = %v, want the summary with an originator", got)
+	}
+
+	now = now.Add(time.Minute)
+	if got := table.Active(); len(got) != 0 {
+		t.Errorf("Active() = %v after the TTL, want none", got)
+	}
+}
+
+func TestTopologyWorker_PublishGated(t *testing.T) {
+	for _, publish := range []bool{false, true} {
+		bus := newAlfredBus()
+		client, err := newAlfredClient(func() (alfredTransport, error) {
+			return busTransport{bus: bus, mac: "02:00:00:00:00:01"}, nil
+		}, time.Second, zerolog.Nop())
+		if err != nil {
+			t.Fatalf("newAlfredClient() error = %v", err)
+		}
+
+		config := &ManagementConfig{BatInterface: "bat0", TopologyPublish: publish}
+		tw := NewTopologyWorkerWithDeps(config, Deps{
+			Log:          zerolog.Nop(),
+			Client:       client,
+			MeshFilter:   NewMeshFilter("", false, true, zerolog.Nop()),
+			RecordLimits: NewRecordLimiter(RecordLimits{}, zerolog.Nop()),
+		}, config, time.Minute, nil)
+		tw.read = func(string) (*batmanadv.Topology, error) { return localTopology(), nil }
+
+		tw.sendTick(context.Background())
+		tw.receiveTick(context.Background())
+
+		summaries := tw.summaries.Active()
+		if publish != (len(summaries) == 1) {
+			t.Fatalf("publish = %v: received %d summaries", publish, len(summaries))
+		}
+		if publish && len(summaries[0].GetLinks()) != 2 {
+			t.Errorf("published links = %v, want 2", summaries[0].GetLinks())
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/openmanet/openmanetd/internal/safemode"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// bridgeLinkType is the link type the kernel reports for a bridge.
+const bridgeLinkType = "bridge"
+
+// lookupBridge looks up the interface name and checks that it is a bridge.
+func lookupBridge(name string) (netlink.Link, error) {
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		return nil, newInterfaceNotFoundError(name, err)
+	}
+	if link.Type() != bridgeLinkType {
+		return nil, newValidationError("interface %s is a %s, not a bridge", name, link.Type())
+	}
+
+	return link, nil
+}
+
+// CreateBridge creates the bridge name and sets it up, as 'ip link add name type
+// bridge' followed by 'ip link set name up' do. Creating a bridge that exists already
+// only sets it up.
+//
+// Returns an ErrValidation error if name is not a valid interface name or names an
+// interface that is not a bridge.
+//
+// Example:
+//
+//	// Assemble br-ahwlan once the HaLow adapter has appeared
+//	err := CreateBridge("br-ahwlan")
+//	if err == nil {
+//	    err = AddPortToBridge("br-ahwlan", "wlan0")
+//	}
+//
+// Note: This operation requires appropriate privileges (typically root/CAP_NET_ADMIN).
+// netifd is not told; a bridge that is not in its configuration is left alone until
+// the network service restarts, which removes it.
+func CreateBridge(name string) error {
+	if err := validateLinkName(name); err != nil {
+		return err
+	}
+
+	if err := safemode.Check(fmt.Sprintf("create bridge %s", name)); err != nil {
+		return err
+	}
+
+	link, err := lookupBridge(name)
+	if errors.Is(err, ErrInterfaceNotFound) {
+		link = &netlink.Bridge{LinkAttrs: netlink.LinkAttrs{Name: name}}
+		if err := netlink.LinkAdd(link); err != nil && !errors.Is(err, unix.EEXIST) {
+			return fmt.Errorf("failed to create bridge %s: %w", name, err)
+		}
+	} else if err != nil {
+		return err
+	}
+
+	if err := netlink.LinkSetUp(link); err != nil {
+		return fmt.Errorf("failed to set %s up: %w", name, err)
+	}
+
+	return nil
+}
+
+// DeleteBridge deletes the bridge name. Its ports are released, not deleted.
+//
+// Returns an ErrValidation error if name is not a bridge and an ErrInterfaceNotFound
+// error if there is no such interface.
+//
+// Note: This operation requires appropriate privileges (typically root/CAP_NET_ADMIN).
+func DeleteBridge(name string) error {
+	if name == "" {
+		return newValidationError("bridge name cannot be empty")
+	}
+
+	if err := safemode.Check(fmt.Sprintf("delete bridge %s", name)); err != nil {
+		return err
+	}
+
+	link, err := lookupBridge(name)
+	if err != nil {
+		return err
+	}
+
+	if err := netlink.LinkDel(link); err != nil {
+		return fmt.Errorf("failed to delete bridge %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// bridgeAndPort looks up the bridge and the interface port for change, as safe mode
+// reports it.
+func bridgeAndPort(bridge, port, change string) (netlink.Link, netlink.Link, error) {
+	if bridge == "" || port == "" {
+		return nil, nil, newValidationError("bridge and port names cannot be empty")
+	}
+	if bridge == port {
+		return nil, nil, newValidationError("bridge %s cannot be a port of itself", bridge)
+	}
+
+	if err := safemode.Check(change); err != nil {
+		return nil, nil, err
+	}
+
+	br, err := lookupBridge(bridge)
+	if err != nil {
+		return nil, nil, err
+	}
+	link, err := netlink.LinkByName(port)
+	if err != nil {
+		return nil, nil, newInterfaceNotFoundError(port, err)
+	}
+
+	return br, link, nil
+}
+
+// AddPortToBridge adds the interface port to the bridge, as 'ip link set port master
+// bridge' does, moving it out of the bridge it was a port of, if any. Adding a port
+// the bridge has already does nothing.
+//
+// Returns an ErrValidation error if bridge is not a bridge and an
+// ErrInterfaceNotFound error if either interface does not exist.
+//
+// Example:
+//
+//	err := AddPortToBridge("br-ahwlan", "bat0")
+//
+// Note: This operation requires appropriate privileges (typically root/CAP_NET_ADMIN).
+// A wireless interface in station or mesh point mode cannot be a port unless 4-address
+// mode is enabled on it.
+func AddPortToBridge(bridge, port string) error {
+	br, link, err := bridgeAndPort(bridge, port, fmt.Sprintf("add %s to bridge %s", port, bridge))
+	if err != nil {
+		return err
+	}
+	if link.Attrs().MasterIndex == br.Attrs().Index {
+		return nil
+	}
+
+	if err := netlink.LinkSetMaster(link, br); err != nil {
+		return fmt.Errorf("failed to add %s to bridge %s: %w", port, bridge, err)
+	}
+
+	return nil
+}
+
+// RemovePortFromBridge removes the interface port from the bridge, as 'ip link set
+// port nomaster' does. Removing an interface that is not a port of the bridge does
+// nothing, so a port that was moved to another bridge stays there.
+//
+// Returns an ErrValidation error if bridge is not a bridge and an
+// ErrInterfaceNotFound error if either interface does not exist.
+//
+// Note: This operation requires appropriate privileges (typically root/CAP_NET_ADMIN).
+func RemovePortFromBridge(bridge, port string) error {
+	br, link, err := bridgeAndPort(bridge, port, fmt.Sprintf("remove %s from bridge %s", port, bridge))
+	if err != nil {
+		return err
+	}
+	if link.Attrs().MasterIndex != br.Attrs().Index {
+		return nil
+	}
+
+	if err := netlink.LinkSetNoMaster(link); err != nil {
+		return fmt.Errorf("failed to remove %s from bridge %s: %w", port, bridge, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package network
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBridgeFunctions_Validation(t *testing.T) {
+	tests := []struct {
+		name string
+		op   func() error
+	}{
+		{"create without name", func() error { return CreateBridge("") }},
+		{"create long name", func() error { return CreateBridge("br-abcdefghijklm") }},
+		{"create slash", func() error { return CreateBridge("br/ahwlan") }},
+		{"create over loopback", func() error { return CreateBridge("lo") }},
+		{"delete without name", func() error { return DeleteBridge("") }},
+		{"delete loopback", func() error { return DeleteBridge("lo") }},
+		{"add without port", func() error { return AddPortToBridge("br-ahwlan", "") }},
+		{"add without bridge", func() error { return AddPortToBridge("", "bat0") }},
+		{"add to itself", func() error { return AddPortToBridge("br-ahwlan", "br-ahwlan") }},
+		{"add to loopback", func() error { return AddPortToBridge("lo", "lo0") }},
+		{"remove without port", func() error { return RemovePortFromBridge("br-ahwlan", "") }},
+		{"remove from loopback", func() error { return RemovePortFromBridge("lo", "bat0") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.op(); !errors.Is(err, ErrValidation) {
+				t.Errorf("error = %v, want ErrValidation", err)
+			}
+		})
+	}
+}
+
+func TestBridgeFunctions_InterfaceNotFound(t *testing.T) {
+	const missing = "omtest-missing"
+
+	tests := []struct {
+		name string
+		op   func() error
+	}{
+		{"delete", func() error { return DeleteBridge(missing) }},
+		{"add to missing bridge", func() error { return AddPortToBridge(missing, "lo") }},
+		{"remove from missing bridge", func() error { return RemovePortFromBridge(missing, "lo") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.op(); !errors.Is(err, ErrInterfaceNotFound) {
+				t.Errorf("error = %v, want ErrInterfaceNotFound", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package network
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/openmanet/openmanetd/internal/safemode"
+)
+
+const (
+	// DefaultDnsmasqHostsPath is the hosts file written for peer name resolution.
+	// OpenWrt's dnsmasq reads every file under /tmp/hosts as an additional hosts file,
+	// so no UCI change is needed for it to be picked up.
+	DefaultDnsmasqHostsPath string = "/tmp/hosts/openmanet"
+
+	// DefaultDNSDomain is used when the dnsmasq configuration does not set a domain.
+	DefaultDNSDomain string = "lan"
+)
+
+// HostEntry maps a peer hostname to its static IP address. MAC is used to
+// disambiguate peers that advertise the same hostname.
+type HostEntry struct {
+	Hostname string
+	IP       string
+	MAC      string
+}
+
+// HostnameCollision describes a hostname advertised by more than one peer and the
+// names each peer was given instead.
+type HostnameCollision struct {
+	Hostname string
+	MACs     []string
+	Names    []string
+}
+
+// ValidateHostEntry checks that entry can be written to a hosts file as it is: the
+// hostname must be a single DNS label, the IP an IP address and the MAC, if set, a
+// MAC address. Entries come from peers, so anything else could add host lines of its
+// own, e.g. one spoofing the name of the gateway.
+//
+// Returns an ErrValidation error describing the first invalid field.
+func ValidateHostEntry(entry HostEntry) error {
+	if reason := validateHostname(entry.Hostname); entry.Hostname == "" || reason != "" {
+		return newValidationError("invalid hostname %q: %s", entry.Hostname, cmp.Or(reason, "must not be empty"))
+	}
+	if net.ParseIP(entry.IP) == nil {
+		return newValidationError("hostname %s: invalid IP address %q", entry.Hostname, entry.IP)
+	}
+	if entry.MAC != "" {
+		if _, err := net.ParseMAC(entry.MAC); err != nil {
+			return newValidationError("hostname %s: invalid MAC address %q", entry.Hostname, entry.MAC)
+		}
+	}
+	return nil
+}
+
+// GenerateHostsFile renders entries as a dnsmasq hosts file, one line per peer of the
+// form "<ip> <hostname>.<domain> <hostname>". Hostnames are lowercased and entries
+// that ValidateHostEntry rejects are skipped.
+//
+// When several peers advertise the same hostname, every one of them is renamed to
+// <hostname>-<last 4 hex digits of MAC> so the result does not depend on which peer
+// was seen first. The collisions are returned so the caller can warn about them.
+//
+// Parameters:
+//   - entries: the peers to emit, in any order
+//   - domain: the DNS domain appended to each hostname; if empty only the bare
+//     hostname is emitted
+//
+// Returns:
+//   - The hosts file contents, sorted by hostname
+//   - The hostname collisions that were disambiguated, sorted by hostname
+//
+// Example:
+//
+//	data, collisions := GenerateHostsFile([]HostEntry{
+//	    {Hostname: "node-a", IP: "10.41.1.10", MAC: "aa:bb:cc:dd:ee:01"},
+//	}, "lan")
+//	// data == "10.41.1.10 node-a.lan node-a\n"
+func GenerateHostsFile(entries []HostEntry, domain string) ([]byte, []HostnameCollision) {
+	byName := make(map[string][]HostEntry)
+	for _, entry := range entries {
+		name := strings.ToLower(strings.TrimSpace(entry.Hostname))
+		entry.Hostname = name
+		if ValidateHostEntry(entry) != nil {
+			continue
+		}
+		byName[name] = append(byName[name], entry)
+	}
+
+	var (
+		resolved   []HostEntry
+		collisions []HostnameCollision
+	)
+
+	for name, group := range byName {
+		if len(group) == 1 {
+			resolved = append(resolved, group[0])
+			continue
+		}
+
+		sort.Slice(group, func(i, j int) bool {
+			return group[i].MAC < group[j].MAC
+		})
+
+		collision := HostnameCollision{Hostname: name}
+		for _, entry := range group {
+			entry.Hostname = fmt.Sprintf("%s-%s", name, macSuffix(entry.MAC))
+			collision.MACs = append(collision.MACs, entry.MAC)
+			collision.Names = append(collision.Names, entry.Hostname)
+			resolved = append(resolved, entry)
+		}
+		collisions = append(collisions, collision)
+	}
+
+	sort.Slice(resolved, func(i, j int) bool {
+		if resolved[i].Hostname != resolved[j].Hostname {
+			return resolved[i].Hostname < resolved[j].Hostname
+		}
+		return resolved[i].MAC < resolved[j].MAC
+	})
+	sort.Slice(collisions, func(i, j int) bool {
+		return collisions[i].Hostname < collisions[j].Hostname
+	})
+
+	var buf bytes.Buffer
+	for _, entry := range resolved {
+		if domain == "" {
+			fmt.Fprintf(&buf, "%s %s\n", entry.IP, entry.Hostname)
+			continue
+		}
+		fmt.Fprintf(&buf, "%s %s.%s %s\n", entry.IP, entry.Hostname, domain, entry.Hostname)
+	}
+
+	return buf.Bytes(), collisions
+}
+
+// macSuffix returns the last 4 hex digits of mac, lowercased and without separators.
+func macSuffix(mac string) string {
+	hex := strings.ToLower(strings.NewReplacer(":", "", "-", "", ".", "").Replace(mac))
+	if len(hex) > 4 {
+		return hex[len(hex)-4:]
+	}
+	return hex
+}
+
+// WriteHostsFile atomically replaces the hosts file at path with data. The file is
+// left untouched if it already has the same contents.
+//
+// Returns true if the file was changed, so the caller knows whether dnsmasq needs to
+// be reloaded, and an error if the file could not be written.
+func WriteHostsFile(path string, data []byte) (bool, error) {
+	if existing, err := os.ReadFile(path); err == nil && bytes.Equal(existing, data) {
+		return false, nil
+	}
+
+	if err := safemode.Check("write " + path); err != nil {
+		return false, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return false, fmt.Errorf("failed to create hosts directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return false, fmt.Errorf("failed to create temporary hosts file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return false, fmt.Errorf("failed to write hosts file: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return false, fmt.Errorf("failed to write hosts file: %w", err)
+	}
+
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return false, fmt.Errorf("failed to set hosts file permissions: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return false, fmt.Errorf("failed to replace hosts file: %w", err)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,178 @@
+package network
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGenerateHostsFile(t *testing.T) {
+	tests := []struct {
+		name               string
+		entries            []HostEntry
+		domain             string
+		expected           string
+		expectedCollisions int
+	}{
+		{
+			name:     "no entries",
+			entries:  nil,
+			domain:   "lan",
+			expected: "",
+		},
+		{
+			name: "sorted by hostname",
+			entries: []HostEntry{
+				{Hostname: "node-b", IP: "10.41.1.20", MAC: "aa:bb:cc:dd:ee:02"},
+				{Hostname: "Node-A", IP: "10.41.1.10", MAC: "aa:bb:cc:dd:ee:01"},
+			},
+			domain:   "lan",
+			expected: "10.41.1.10 node-a.lan node-a\n10.41.1.20 node-b.lan node-b\n",
+		},
+		{
+			name: "no domain",
+			entries: []HostEntry{
+				{Hostname: "node-a", IP: "10.41.1.10", MAC: "aa:bb:cc:dd:ee:01"},
+			},
+			domain:   "",
+			expected: "10.41.1.10 node-a\n",
+		},
+		{
+			name: "entries without hostname or IP skipped",
+			entries: []HostEntry{
+				{Hostname: "", IP: "10.41.1.10", MAC: "aa:bb:cc:dd:ee:01"},
+				{Hostname: "node-b", IP: "", MAC: "aa:bb:cc:dd:ee:02"},
+			},
+			domain:   "lan",
+			expected: "",
+		},
+		{
+			name: "entries that would add host lines skipped",
+			entries: []HostEntry{
+				{Hostname: "node-a\n10.41.66.6 gateway", IP: "10.41.1.10", MAC: "aa:bb:cc:dd:ee:01"},
+				{Hostname: "node-b gateway.lan gateway", IP: "10.41.1.20", MAC: "aa:bb:cc:dd:ee:02"},
+				{Hostname: "node-c", IP: "10.41.66.6 gateway.lan gateway\n10.41.1.30", MAC: "aa:bb:cc:dd:ee:03"},
+				{Hostname: "node-d", IP: "10.41.1.40", MAC: "aa:bb:cc:dd:ee:04\n10.41.66.6 gateway"},
+				{Hostname: "node-e", IP: "10.41.1.50", MAC: "aa:bb:cc:dd:ee:05"},
+			},
+			domain:   "lan",
+			expected: "10.41.1.50 node-e.lan node-e\n",
+		},
+		{
+			name: "collision disambiguated by MAC",
+			entries: []HostEntry{
+				{Hostname: "openmanet", IP: "10.41.2.20", MAC: "AA:BB:CC:DD:12:34"},
+				{Hostname: "openmanet", IP: "10.41.1.10", MAC: "aa:bb:cc:dd:ab:cd"},
+				{Hostname: "node-c", IP: "10.41.3.30", MAC: "aa:bb:cc:dd:ee:03"},
+			},
+			domain: "mesh",
+			expected: "10.41.3.30 node-c.mesh node-c\n" +
+				"10.41.2.20 openmanet-1234.mesh openmanet-1234\n" +
+				"10.41.1.10 openmanet-abcd.mesh openmanet-abcd\n",
+			expectedCollisions: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, collisions := GenerateHostsFile(tt.entries, tt.domain)
+
+			if string(data) != tt.expected {
+				t.Errorf("Expected hosts file:\n%q\ngot:\n%q", tt.expected, string(data))
+			}
+
+			if len(collisions) != tt.expectedCollisions {
+				t.Errorf("Expected %d collisions, got %d", tt.expectedCollisions, len(collisions))
+			}
+		})
+	}
+}
+
+func TestGenerateHostsFile_DeterministicOrder(t *testing.T) {
+	a := HostEntry{Hostname: "node", IP: "10.41.1.10", MAC: "aa:bb:cc:dd:00:01"}
+	b := HostEntry{Hostname: "node", IP: "10.41.1.20", MAC: "aa:bb:cc:dd:00:02"}
+
+	first, collisions := GenerateHostsFile([]HostEntry{a, b}, "lan")
+	second, _ := GenerateHostsFile([]HostEntry{b, a}, "lan")
+
+	if string(first) != string(second) {
+		t.Errorf("Expected output independent of input order, got:\n%s\nand:\n%s", first, second)
+	}
+
+	if len(collisions) != 1 {
+		t.Fatalf("Expected 1 collision, got %d", len(collisions))
+	}
+
+	if collisions[0].Hostname != "node" {
+		t.Errorf("Expected collision on 'node', got %q", collisions[0].Hostname)
+	}
+
+	expectedNames := []string{"node-0001", "node-0002"}
+	for i, name := range expectedNames {
+		if collisions[0].Names[i] != name {
+			t.Errorf("Expected name %q, got %q", name, collisions[0].Names[i])
+		}
+	}
+}
+
+func TestWriteHostsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts", "openmanet")
+	data := []byte("10.41.1.10 node-a.lan node-a\n")
+
+	changed, err := WriteHostsFile(path, data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !changed {
+		t.Error("Expected first write to report a change")
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read hosts file: %v", err)
+	}
+	if string(got) != string(data) {
+		t.Errorf("Expected %q, got %q", data, got)
+	}
+
+	changed, err = WriteHostsFile(path, data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if changed {
+		t.Error("Expected identical write to report no change")
+	}
+
+	changed, err = WriteHostsFile(path, []byte{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !changed {
+		t.Error("Expected emptying the file to report a change")
+	}
+}
+
+func TestValidateHostEntry(t *testing.T) {
+	if err := ValidateHostEntry(HostEntry{Hostname: "node-a", IP: "10.41.1.10", MAC: "aa:bb:cc:dd:ee:01"}); err != nil {
+		t.Errorf("ValidateHostEntry() error = %v", err)
+	}
+	if err := ValidateHostEntry(HostEntry{Hostname: "node-a", IP: "10.41.1.10"}); err != nil {
+		t.Errorf("ValidateHostEntry() without MAC error = %v", err)
+	}
+
+	invalid := []HostEntry{
+		{Hostname: "", IP: "10.41.1.10"},
+		{Hostname: "node-a.lan", IP: "10.41.1.10"},
+		{Hostname: "node a", IP: "10.41.1.10"},
+		{Hostname: "-node", IP: "10.41.1.10"},
+		{Hostname: "node-a", IP: ""},
+		{Hostname: "node-a", IP: "10.41.1.10\n10.41.66.6"},
+		{Hostname: "node-a", IP: "10.41.1.10", MAC: "aa:bb"},
+	}
+	for _, entry := range invalid {
+		if err := ValidateHostEntry(entry); !errors.Is(err, ErrValidation) {
+			t.Errorf("ValidateHostEntry(%+v) error = %v, want ErrValidation", entry, err)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package network
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultDnsmasqLeasesPath is where OpenWrt's dnsmasq keeps its lease database.
+const DefaultDnsmasqLeasesPath string = "/tmp/dhcp.leases"
+
+// DHCPLease is an entry of the dnsmasq lease database. A zero Expiry means the lease
+// never expires.
+type DHCPLease struct {
+	Expiry   time.Time
+	MAC      string
+	IP       net.IP
+	Hostname string
+	ClientID string
+}
+
+// Active reports whether the lease is still held at now.
+func (l DHCPLease) Active(now time.Time) bool {
+	return l.Expiry.IsZero() || l.Expiry.After(now)
+}
+
+// ParseDnsmasqLeases parses a dnsmasq lease database, one lease per line in the form
+// "<expiry> <mac> <ip> <hostname> <client-id>", where expiry is a Unix timestamp
+// (0 for infinite) and "*" marks an unknown hostname or client ID. IPv6 lines and
+// lines that cannot be parsed are skipped.
+//
+// Returns the leases in file order, or an error if reading fails.
+//
+// Example:
+//
+//	f, _ := os.Open(DefaultDnsmasqLeasesPath)
+//	leases, err := ParseDnsmasqLeases(f)
+//	if err != nil {
+//	    log.Fatalf("Failed to parse leases: %v", err)
+//	}
+//	fmt.Printf("%d leases\n", len(leases))
+func ParseDnsmasqLeases(r io.Reader) ([]DHCPLease, error) {
+	var leases []DHCPLease
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+
+		expiry, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		ip := net.ParseIP(fields[2]).To4()
+		if ip == nil {
+			continue
+		}
+
+		lease := DHCPLease{MAC: strings.ToLower(fields[1]), IP: ip}
+		if expiry > 0 {
+			lease.Expiry = time.Unix(expiry, 0)
+		}
+		if fields[3] != "*" {
+			lease.Hostname = fields[3]
+		}
+		if len(fields) > 4 && fields[4] != "*" {
+			lease.ClientID = fields[4]
+		}
+
+		leases = append(leases, lease)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read leases: %w", err)
+	}
+
+	return leases, nil
+}
+
+// ReadDnsmasqLeases reads and parses the dnsmasq lease database at path. A missing
+// file means dnsmasq has not handed out any leases yet and yields no leases.
+func ReadDnsmasqLeases(path string) ([]DHCPLease, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open leases file %s: %w", path, err)
+	}
+	defer f.Close()
+
+	return ParseDnsmasqLeases(f)
+}
+
+// ActiveLeases returns the leases that are active at now, in their original order.
+func ActiveLeases(leases []DHCPLease, now time.Time) []DHCPLease {
+	var active []DHCPLease
+	for _, lease := range leases {
+		if lease.Active(now) {
+			active = append(active, lease)
+		}
+	}
+
+	return active
+}
+
+// CountPoolLeases returns the number of leases that are active at now and fall inside
+// the DHCP pool of limit addresses starting at offset start from networkAddr.
+//
+// Returns an ErrValidation error if networkAddr is not an IPv4 address.
+func CountPoolLeases(leases []DHCPLease, networkAddr string, start, limit int, now time.Time) (int, error) {
+	base := net.ParseIP(networkAddr).To4()
+	if base == nil {
+		return 0, newValidationError("invalid network address: %s", networkAddr)
+	}
+	baseNum := int64(binary.BigEndian.Uint32(base))
+
+	count := 0
+	for _, lease := range leases {
+		if !lease.Active(now) {
+			continue
+		}
+
+		offset := int64(binary.BigEndian.Uint32(lease.IP.To4())) - baseNum
+		if offset >= int64(start) && offset < int64(start+limit) {
+			count++
+		}
+	}
+
+	return count, nil
+}
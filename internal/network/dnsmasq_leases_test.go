@@ -0,0 +1,97 @@
+package network
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testLeases = `1735693200 AA:BB:CC:DD:EE:01 10.41.0.100 phone 01:aa:bb:cc:dd:ee:01
+1735693200 aa:bb:cc:dd:ee:02 10.41.0.101 * *
+0 aa:bb:cc:dd:ee:03 10.41.0.115 printer *
+1735686000 aa:bb:cc:dd:ee:04 10.41.0.102 expired *
+1735693200 aa:bb:cc:dd:ee:05 10.41.0.116 outside *
+1735693200 aa:bb:cc:dd:ee:06 fd01::10 v6 *
+garbage line
+`
+
+func TestParseDnsmasqLeases(t *testing.T) {
+	leases, err := ParseDnsmasqLeases(strings.NewReader(testLeases))
+	if err != nil {
+		t.Fatalf("ParseDnsmasqLeases() error = %v", err)
+	}
+
+	if len(leases) != 5 {
+		t.Fatalf("ParseDnsmasqLeases() = %d leases, want 5", len(leases))
+	}
+
+	first := leases[0]
+	if first.MAC != "aa:bb:cc:dd:ee:01" || first.Hostname != "phone" || first.ClientID != "01:aa:bb:cc:dd:ee:01" {
+		t.Errorf("leases[0] = %+v", first)
+	}
+	if !first.Expiry.Equal(time.Unix(1735693200, 0)) {
+		t.Errorf("leases[0].Expiry = %v", first.Expiry)
+	}
+	if leases[1].Hostname != "" || leases[1].ClientID != "" {
+		t.Errorf("leases[1] = %+v, want no hostname or client ID", leases[1])
+	}
+	if !leases[2].Expiry.IsZero() {
+		t.Errorf("leases[2].Expiry = %v, want zero for an infinite lease", leases[2].Expiry)
+	}
+}
+
+func TestCountPoolLeases(t *testing.T) {
+	leases, _ := ParseDnsmasqLeases(strings.NewReader(testLeases))
+	now := time.Unix(1735689600, 0)
+
+	// Pool 100-115: three active leases, one expired, one just outside
+	got, err := CountPoolLeases(leases, DefaultNetworkAddress, 100, 16, now)
+	if err != nil {
+		t.Fatalf("CountPoolLeases() error = %v", err)
+	}
+	if got != 3 {
+		t.Errorf("CountPoolLeases() = %d, want 3", got)
+	}
+
+	if _, err := CountPoolLeases(leases, "invalid", 100, 16, now); err == nil {
+		t.Error("CountPoolLeases() error = nil for an invalid network address")
+	}
+}
+
+func TestReadDnsmasqLeases(t *testing.T) {
+	dir := t.TempDir()
+
+	leases, err := ReadDnsmasqLeases(filepath.Join(dir, "missing"))
+	if err != nil || leases != nil {
+		t.Errorf("ReadDnsmasqLeases(missing) = %v, %v; want no leases and no error", leases, err)
+	}
+
+	path := filepath.Join(dir, "dhcp.leases")
+	if err := os.WriteFile(path, []byte(testLeases), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	leases, err = ReadDnsmasqLeases(path)
+	if err != nil {
+		t.Fatalf("ReadDnsmasqLeases() error = %v", err)
+	}
+	if len(leases) != 5 {
+		t.Errorf("ReadDnsmasqLeases() = %d leases, want 5", len(leases))
+	}
+}
+
+func TestActiveLeases(t *testing.T) {
+	leases, _ := ParseDnsmasqLeases(strings.NewReader(testLeases))
+
+	active := ActiveLeases(leases, time.Unix(1735689600, 0))
+	var ips []string
+	for _, lease := range active {
+		ips = append(ips, lease.IP.String())
+	}
+	if want := []string{"10.41.0.100", "10.41.0.101", "10.41.0.115", "10.41.0.116"}; !slices.Equal(ips, want) {
+		t.Errorf("ActiveLeases() = %v, want %v", ips, want)
+	}
+}
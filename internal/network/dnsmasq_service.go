@@ -0,0 +1,77 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"time"
+
+	"github.com/openmanet/openmanetd/internal/safemode"
+	"github.com/openmanet/openmanetd/internal/ubus"
+)
+
+// initScriptTimeout bounds the ubus call that starts an init script.
+const initScriptTimeout = 30 * time.Second
+
+// runInitScript runs action of the OpenWrt init script of service, e.g. "reload" of
+// "dnsmasq". The script is started through the "rc" object of rpcd over ubus; without
+// ubusd or rpcd, /etc/init.d/<service> is run directly and its output is kept for
+// the error.
+//
+// The call is bounded by ctx and initScriptTimeout, and the script run directly is
+// killed when ctx is done.
+//
+// Returns an ErrReloadFailed if the script could not be run.
+func runInitScript(ctx context.Context, service, action string) error {
+	ctx, cancel := context.WithTimeout(ctx, initScriptTimeout)
+	defer cancel()
+
+	_, err := ubusCall(ctx, "rc", "init", map[string]any{"name": service, "action": action})
+	var statusErr *ubus.StatusError
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, ubus.ErrUnavailable):
+	case errors.As(err, &statusErr) && statusErr.Status == ubus.StatusNotFound:
+		// rpcd without the rc plugin, or an init script it does not know
+	default:
+		return &ErrReloadFailed{Service: service, Err: err}
+	}
+
+	cmd := exec.CommandContext(ctx, "/etc/init.d/"+service, action)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return newReloadError(service, output, err)
+	}
+
+	return nil
+}
+
+// ReloadDnsmasq applies DHCP and dnsmasq changes by reloading only the dnsmasq
+// service, so that a changed DHCP pool does not take the mesh interfaces down as a
+// network reload may. The init script regenerates the dnsmasq configuration from UCI
+// and signals the running instances to re-read their hosts files; an instance is
+// only restarted if its configuration changed.
+//
+// Returns an ErrReloadFailed if the reload could not be run.
+func ReloadDnsmasq() error {
+	if err := safemode.Check("reload dnsmasq"); err != nil {
+		return err
+	}
+
+	return runInitScript(context.Background(), "dnsmasq", "reload")
+}
+
+// RestartDnsmasq restarts only the dnsmasq service. Unlike a reload, a restart
+// re-reads the files in /tmp/dnsmasq.d.
+//
+// Returns an ErrReloadFailed if the restart could not be run.
+func RestartDnsmasq() error {
+	if err := safemode.Check("restart dnsmasq"); err != nil {
+		return err
+	}
+
+	return runInitScript(context.Background(), "dnsmasq", "restart")
+}
@@ -0,0 +1,47 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/openmanet/openmanetd/internal/ubus"
+)
+
+func TestReloadDnsmasq_Ubus(t *testing.T) {
+	var calls []map[string]any
+	orig := ubusCall
+	ubusCall = func(ctx context.Context, object, method string, args any) (map[string]any, error) {
+		if object != "rc" || method != "init" {
+			t.Errorf("called %s %s, want rc init", object, method)
+		}
+		calls = append(calls, args.(map[string]any))
+		return nil, nil
+	}
+	t.Cleanup(func() { ubusCall = orig })
+
+	if err := ReloadDnsmasq(); err != nil {
+		t.Fatalf("ReloadDnsmasq() error = %v", err)
+	}
+	if err := RestartDnsmasq(); err != nil {
+		t.Fatalf("RestartDnsmasq() error = %v", err)
+	}
+
+	want := []map[string]any{
+		{"name": "dnsmasq", "action": "reload"},
+		{"name": "dnsmasq", "action": "restart"},
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("rc init calls = %v, want %v", calls, want)
+	}
+}
+
+func TestReloadDnsmasq_Failed(t *testing.T) {
+	stubUbus(t, &ubus.StatusError{Object: "rc", Method: "init", Status: ubus.StatusInvalidArg})
+
+	var reloadErr *ErrReloadFailed
+	if err := ReloadDnsmasq(); !errors.As(err, &reloadErr) || reloadErr.Service != "dnsmasq" {
+		t.Errorf("ReloadDnsmasq() error = %v, want ErrReloadFailed for dnsmasq", err)
+	}
+}
@@ -0,0 +1,87 @@
+package network
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// DefaultDnsmasqServicesPath is the dnsmasq config file written for the services
+// announced over the mesh. OpenWrt's dnsmasq reads every file in /tmp/dnsmasq.d.
+const DefaultDnsmasqServicesPath string = "/tmp/dnsmasq.d/openmanet-services.conf"
+
+// ServiceEntry is a service offered at IP by the node with the given MAC.
+type ServiceEntry struct {
+	Name  string
+	Proto string
+	Port  int
+	IP    string
+	MAC   string
+}
+
+// GenerateServicesConf renders entries as dnsmasq configuration. Every service gets
+// an address record named <name>-<last 4 hex digits of MAC> and an SRV record
+// _<name>._<proto>.<domain> pointing at it, so several nodes offering the same
+// service each add a target to one SRV name.
+//
+// Parameters:
+//   - entries: the services to emit, in any order
+//   - domain: the DNS domain the names are created in; if empty the names are bare
+//
+// Entries with a field that could end a dnsmasq option or start another, i.e. one
+// holding whitespace, a comma or an equals sign, are skipped: services are announced
+// by peers and must not add configuration of their own.
+//
+// Returns:
+//   - The configuration, sorted by service name and then MAC
+//
+// Example:
+//
+//	data := GenerateServicesConf([]ServiceEntry{
+//	    {Name: "rtsp-cam", Proto: "tcp", Port: 554, IP: "10.41.1.10", MAC: "aa:bb:cc:dd:ee:01"},
+//	}, "lan")
+//	// data == "host-record=rtsp-cam-ee01.lan,10.41.1.10\n" +
+//	//         "srv-host=_rtsp-cam._tcp.lan,rtsp-cam-ee01.lan,554\n"
+func GenerateServicesConf(entries []ServiceEntry, domain string) []byte {
+	sorted := append([]ServiceEntry(nil), entries...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Name != sorted[j].Name {
+			return sorted[i].Name < sorted[j].Name
+		}
+		return sorted[i].MAC < sorted[j].MAC
+	})
+
+	qualify := func(name string) string {
+		if domain == "" {
+			return name
+		}
+		return name + "." + domain
+	}
+
+	var buf bytes.Buffer
+	for _, entry := range sorted {
+		if entry.Name == "" || entry.IP == "" {
+			continue
+		}
+		if slices.ContainsFunc([]string{entry.Name, entry.Proto, entry.IP, entry.MAC, domain}, unsafeConfValue) {
+			continue
+		}
+
+		target := qualify(fmt.Sprintf("%s-%s", entry.Name, macSuffix(entry.MAC)))
+		fmt.Fprintf(&buf, "host-record=%s,%s\n", target, entry.IP)
+		fmt.Fprintf(&buf, "srv-host=%s,%s,%d\n", qualify(fmt.Sprintf("_%s._%s", entry.Name, entry.Proto)), target, entry.Port)
+	}
+
+	return buf.Bytes()
+}
+
+// unsafeConfValue reports whether value could break out of the dnsmasq option it is
+// written into.
+func unsafeConfValue(value string) bool {
+	return strings.ContainsFunc(value, func(r rune) bool {
+		return unicode.IsSpace(r) || r == ',' || r == '='
+	})
+}
@@ -0,0 +1,83 @@
+package network
+
+import "testing"
+
+func TestGenerateServicesConf(t *testing.T) {
+	tests := []struct {
+		name     string
+		entries  []ServiceEntry
+		domain   string
+		expected string
+	}{
+		{
+			name:     "no entries",
+			entries:  nil,
+			domain:   "lan",
+			expected: "",
+		},
+		{
+			name: "one service",
+			entries: []ServiceEntry{
+				{Name: "rtsp-cam", Proto: "tcp", Port: 554, IP: "10.41.1.10", MAC: "aa:bb:cc:dd:ee:01"},
+			},
+			domain: "lan",
+			expected: "host-record=rtsp-cam-ee01.lan,10.41.1.10\n" +
+				"srv-host=_rtsp-cam._tcp.lan,rtsp-cam-ee01.lan,554\n",
+		},
+		{
+			name: "same service on two nodes sorted by MAC",
+			entries: []ServiceEntry{
+				{Name: "mqtt", Proto: "tcp", Port: 1883, IP: "10.41.2.20", MAC: "aa:bb:cc:dd:ee:02"},
+				{Name: "mqtt", Proto: "tcp", Port: 1883, IP: "10.41.1.10", MAC: "aa:bb:cc:dd:ee:01"},
+				{Name: "cot", Proto: "udp", Port: 4242, IP: "10.41.1.10", MAC: "aa:bb:cc:dd:ee:01"},
+			},
+			domain: "mesh",
+			expected: "host-record=cot-ee01.mesh,10.41.1.10\n" +
+				"srv-host=_cot._udp.mesh,cot-ee01.mesh,4242\n" +
+				"host-record=mqtt-ee01.mesh,10.41.1.10\n" +
+				"srv-host=_mqtt._tcp.mesh,mqtt-ee01.mesh,1883\n" +
+				"host-record=mqtt-ee02.mesh,10.41.2.20\n" +
+				"srv-host=_mqtt._tcp.mesh,mqtt-ee02.mesh,1883\n",
+		},
+		{
+			name: "no domain",
+			entries: []ServiceEntry{
+				{Name: "nas", Proto: "tcp", Port: 445, IP: "10.41.1.10", MAC: "aa:bb:cc:dd:ee:01"},
+			},
+			domain:   "",
+			expected: "host-record=nas-ee01,10.41.1.10\nsrv-host=_nas._tcp,nas-ee01,445\n",
+		},
+		{
+			name: "entries without name or IP skipped",
+			entries: []ServiceEntry{
+				{Name: "", Proto: "tcp", Port: 80, IP: "10.41.1.10", MAC: "aa:bb:cc:dd:ee:01"},
+				{Name: "web", Proto: "tcp", Port: 80, IP: "", MAC: "aa:bb:cc:dd:ee:02"},
+			},
+			domain:   "lan",
+			expected: "",
+		},
+		{
+			name: "entries that would add options skipped",
+			entries: []ServiceEntry{
+				{Name: "web", Proto: "tcp", Port: 80, IP: "10.41.1.10\ndhcp-script=/tmp/evil.sh", MAC: "aa:bb:cc:dd:ee:01"},
+				{Name: "web", Proto: "tcp", Port: 80, IP: "10.41.1.20", MAC: "aa:bb:cc:dd:ee:02\nconf-file=/tmp/evil.conf"},
+				{Name: "web,evil", Proto: "tcp", Port: 80, IP: "10.41.1.30", MAC: "aa:bb:cc:dd:ee:03"},
+				{Name: "web", Proto: "tcp x", Port: 80, IP: "10.41.1.40", MAC: "aa:bb:cc:dd:ee:04"},
+				{Name: "web", Proto: "tcp", Port: 80, IP: "10.41.1.50", MAC: "aa:bb:cc:dd:ee:05"},
+			},
+			domain: "lan",
+			expected: "host-record=web-ee05.lan,10.41.1.50\n" +
+				"srv-host=_web._tcp.lan,web-ee05.lan,80\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := GenerateServicesConf(tt.entries, tt.domain)
+
+			if string(data) != tt.expected {
+				t.Errorf("Expected services conf:\n%q\ngot:\n%q", tt.expected, string(data))
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+
+	"github.com/digineo/go-uci/v2"
+)
+
+var (
+	// ErrReadOnlyFS is returned when a UCI commit fails because the configuration
+	// directory cannot be written, typically because the overlay has been remounted
+	// read-only during sysupgrade or after a flash failure.
+	ErrReadOnlyFS = errors.New("configuration filesystem is read-only")
+
+	// ErrCommitFailed is returned when staged UCI changes cannot be written to disk.
+	ErrCommitFailed = errors.New("failed to commit config")
+
+	// ErrSectionNotFound is returned when a UCI section required by an operation
+	// does not exist.
+	ErrSectionNotFound = errors.New("section not found")
+
+	// ErrValidation is returned when arguments or configuration values are invalid.
+	// Nothing has been changed when it is returned.
+	ErrValidation = errors.New("validation failed")
+
+	// ErrInterfaceNotFound is returned when a network interface cannot be resolved.
+	ErrInterfaceNotFound = errors.New("interface not found")
+
+	// ErrNoAvailableAddress is returned when no free address or DHCP range is left
+	// in the mesh subnet.
+	ErrNoAvailableAddress = errors.New("no available address")
+
+	// ErrPinConflict is returned when the static IP a node is pinned to is already
+	// reserved by a peer.
+	ErrPinConflict = errors.New("pinned address already reserved")
+
+	// ErrTransactionDone is returned by a Transaction that has already been applied
+	// or discarded.
+	ErrTransactionDone = errors.New("transaction already applied or discarded")
+)
+
+// ErrSetOptionFailed is returned when a UCI option cannot be set or deleted.
+type ErrSetOptionFailed struct {
+	Config  string
+	Section string
+	Option  string
+	Err     error
+}
+
+func (e *ErrSetOptionFailed) Error() string {
+	return fmt.Sprintf("failed to set %s.%s.%s: %v", e.Config, e.Section, e.Option, e.Err)
+}
+
+func (e *ErrSetOptionFailed) Unwrap() error {
+	return e.Err
+}
+
+// ErrInvalidOption is returned when a value is refused before it is written to a
+// UCI option. It wraps ErrValidation, so nothing has been changed.
+type ErrInvalidOption struct {
+	Config  string
+	Section string
+	Option  string
+	Value   string
+	Reason  string
+}
+
+func (e *ErrInvalidOption) Error() string {
+	return fmt.Sprintf("%v: invalid %s.%s.%s %q: %s", ErrValidation, e.Config, e.Section, e.Option, e.Value, e.Reason)
+}
+
+func (e *ErrInvalidOption) Unwrap() error {
+	return ErrValidation
+}
+
+// ErrReloadFailed is returned when a service reload or restart command fails.
+// Output holds the combined output of the command, if any.
+type ErrReloadFailed struct {
+	Service string
+	Output  string
+	Err     error
+}
+
+func (e *ErrReloadFailed) Error() string {
+	if e.Output == "" {
+		return fmt.Sprintf("failed to reload %s: %v", e.Service, e.Err)
+	}
+	return fmt.Sprintf("failed to reload %s: %v: %s", e.Service, e.Err, e.Output)
+}
+
+func (e *ErrReloadFailed) Unwrap() error {
+	return e.Err
+}
+
+// ErrScanFailed is returned when a wireless scan cannot be run, e.g. because the
+// device does not exist or rpcd has no iwinfo plugin.
+type ErrScanFailed struct {
+	Device string
+	Err    error
+}
+
+func (e *ErrScanFailed) Error() string {
+	return fmt.Sprintf("failed to scan on %s: %v", e.Device, e.Err)
+}
+
+func (e *ErrScanFailed) Unwrap() error {
+	return e.Err
+}
+
+// classifyCommitError wraps commit failures caused by a read-only or otherwise
+// unwritable filesystem (EROFS, EACCES) with ErrReadOnlyFS so callers can detect
+// the condition with errors.Is and retry later instead of recomputing their changes.
+// The staged changes remain in the UCI tree, so a later Commit on the same reader
+// will write them out. Other errors, and nil, are returned unchanged.
+func classifyCommitError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, syscall.EROFS) || errors.Is(err, syscall.EACCES) {
+		return fmt.Errorf("%w: %w", ErrReadOnlyFS, err)
+	}
+
+	return err
+}
+
+// classifyUCIError wraps go-uci's section-not-found error with ErrSectionNotFound.
+func classifyUCIError(err error) error {
+	var notFound uci.ErrSectionNotFound
+	if errors.As(err, &notFound) {
+		return fmt.Errorf("%w: %w", ErrSectionNotFound, err)
+	}
+
+	return err
+}
+
+// newSetOptionError returns an ErrSetOptionFailed for config.section.option.
+func newSetOptionError(config, section, option string, err error) error {
+	return &ErrSetOptionFailed{
+		Config:  config,
+		Section: section,
+		Option:  option,
+		Err:     classifyUCIError(err),
+	}
+}
+
+// newCommitError wraps a failed commit of config with ErrCommitFailed.
+func newCommitError(config string, err error) error {
+	return fmt.Errorf("%w %s: %w", ErrCommitFailed, config, err)
+}
+
+// newSectionError wraps a failed section operation, marking it as
+// ErrSectionNotFound if go-uci reported the section missing.
+func newSectionError(action, config, section string, err error) error {
+	return fmt.Errorf("failed to %s %s.%s: %w", action, config, section, classifyUCIError(err))
+}
+
+// newInvalidOptionError returns an ErrInvalidOption for value of config.section.option.
+func newInvalidOptionError(config, section, option, value, reason string) error {
+	return &ErrInvalidOption{
+		Config:  config,
+		Section: section,
+		Option:  option,
+		Value:   value,
+		Reason:  reason,
+	}
+}
+
+// newValidationError returns an error wrapping ErrValidation.
+func newValidationError(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrValidation, fmt.Sprintf(format, args...))
+}
+
+// newInterfaceNotFoundError wraps a failed interface lookup with ErrInterfaceNotFound.
+func newInterfaceNotFoundError(name string, err error) error {
+	return fmt.Errorf("%w: %s: %w", ErrInterfaceNotFound, name, err)
+}
+
+// newReloadError returns an ErrReloadFailed for service with the trimmed command output.
+func newReloadError(service string, output []byte, err error) error {
+	return &ErrReloadFailed{
+		Service: service,
+		Output:  strings.TrimSpace(string(output)),
+		Err:     err,
+	}
+}
@@ -0,0 +1,137 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/digineo/go-uci/v2"
+)
+
+func TestClassifyCommitError(t *testing.T) {
+	otherErr := errors.New("disk on fire")
+
+	tests := []struct {
+		name       string
+		err        error
+		expectNil  bool
+		expectROFS bool
+	}{
+		{
+			name:      "nil error",
+			err:       nil,
+			expectNil: true,
+		},
+		{
+			name:       "EROFS from rename",
+			err:        &os.LinkError{Op: "rename", Old: "/etc/config/.network", New: "/etc/config/network", Err: syscall.EROFS},
+			expectROFS: true,
+		},
+		{
+			name:       "EACCES from open",
+			err:        &os.PathError{Op: "open", Path: "/etc/config/dhcp", Err: syscall.EACCES},
+			expectROFS: true,
+		},
+		{
+			name:       "wrapped EROFS",
+			err:        fmt.Errorf("commit failed: %w", syscall.EROFS),
+			expectROFS: true,
+		},
+		{
+			name: "unrelated error",
+			err:  otherErr,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := classifyCommitError(tt.err)
+
+			if tt.expectNil {
+				if got != nil {
+					t.Errorf("Expected nil, got %v", got)
+				}
+				return
+			}
+
+			if errors.Is(got, ErrReadOnlyFS) != tt.expectROFS {
+				t.Errorf("errors.Is(%v, ErrReadOnlyFS) = %v, want %v", got, !tt.expectROFS, tt.expectROFS)
+			}
+
+			if !errors.Is(got, tt.err) {
+				t.Errorf("Expected classified error to wrap original error %v", tt.err)
+			}
+		})
+	}
+}
+
+func TestNewSetOptionError(t *testing.T) {
+	err := newSetOptionError("network", "lan", "proto", uci.ErrSectionNotFound{Section: "lan"})
+
+	var setErr *ErrSetOptionFailed
+	if !errors.As(err, &setErr) {
+		t.Fatalf("Expected ErrSetOptionFailed, got %T", err)
+	}
+
+	if setErr.Config != "network" || setErr.Section != "lan" || setErr.Option != "proto" {
+		t.Errorf("Unexpected fields: %+v", setErr)
+	}
+
+	if !errors.Is(err, ErrSectionNotFound) {
+		t.Error("Expected missing section to be reported as ErrSectionNotFound")
+	}
+
+	other := errors.New("boom")
+	if err := newSetOptionError("network", "lan", "proto", other); errors.Is(err, ErrSectionNotFound) || !errors.Is(err, other) {
+		t.Errorf("Expected plain wrap of other errors, got %v", err)
+	}
+}
+
+func TestNewCommitError(t *testing.T) {
+	cause := classifyCommitError(&os.PathError{Op: "open", Path: "/etc/config/dhcp", Err: syscall.EROFS})
+	err := newCommitError(dhcpConfigName, cause)
+
+	if !errors.Is(err, ErrCommitFailed) {
+		t.Error("Expected ErrCommitFailed")
+	}
+
+	if !errors.Is(err, ErrReadOnlyFS) {
+		t.Error("Expected ErrReadOnlyFS to be preserved through the commit error")
+	}
+}
+
+func TestNewReloadError(t *testing.T) {
+	cause := errors.New("exit status 1")
+	err := newReloadError("network", []byte("  netifd not running\n"), cause)
+
+	var reloadErr *ErrReloadFailed
+	if !errors.As(err, &reloadErr) {
+		t.Fatalf("Expected ErrReloadFailed, got %T", err)
+	}
+
+	if reloadErr.Service != "network" {
+		t.Errorf("Expected service network, got %q", reloadErr.Service)
+	}
+
+	if reloadErr.Output != "netifd not running" {
+		t.Errorf("Expected trimmed output, got %q", reloadErr.Output)
+	}
+
+	if !errors.Is(err, cause) {
+		t.Error("Expected ErrReloadFailed to wrap the command error")
+	}
+}
+
+func TestSetDHCPRangeWithReader_Validation(t *testing.T) {
+	reader := newMockDHCPConfigReader()
+
+	if _, err := SetDHCPRangeWithReader("lan", "abc", "16", reader); !errors.Is(err, ErrValidation) {
+		t.Errorf("Expected ErrValidation for non-numeric start, got %v", err)
+	}
+
+	if _, err := SetDHCPRangeWithReader("lan", "100", "abc", reader); !errors.Is(err, ErrValidation) {
+		t.Errorf("Expected ErrValidation for non-numeric limit, got %v", err)
+	}
+}
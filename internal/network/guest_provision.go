@@ -0,0 +1,195 @@
+package network
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// maxGuestNameLength is the longest guest network name whose bridge, "br-" and the
+// name, is still a valid kernel device name.
+const maxGuestNameLength = maxInterfaceNameLength - len("br-")
+
+// guestBridgeName returns the bridge device of the guest network name.
+func guestBridgeName(name string) string {
+	return "br-" + name
+}
+
+// guestNetwork is a validated guest network: the node address and its subnet.
+type guestNetwork struct {
+	ip     net.IP
+	subnet *net.IPNet
+}
+
+// validateGuestNetwork checks the arguments of ProvisionGuestNetwork.
+func validateGuestNetwork(name, cidr string, dhcpRange DHCPRange, addressing MeshAddressing) (*guestNetwork, error) {
+	if name == "" {
+		return nil, newValidationError("guest network name cannot be empty")
+	}
+	if len(name) > maxGuestNameLength || deviceSectionName(name) != name {
+		return nil, newValidationError("invalid guest network name %q: must be at most %d letters, digits or underscores", name, maxGuestNameLength)
+	}
+
+	ip, subnet, err := net.ParseCIDR(cidr)
+	if err != nil || ip.To4() == nil {
+		return nil, newValidationError("guest network address must be an IPv4 address in CIDR notation, got %q", cidr)
+	}
+	ip = ip.To4()
+	ones, _ := subnet.Mask.Size()
+	if ones < 8 || ones > 30 {
+		return nil, newValidationError("guest network prefix must be from /8 to /30, got /%d", ones)
+	}
+	if mesh := addressing.Subnet; subnet.Contains(mesh.IP) || mesh.Contains(subnet.IP) {
+		return nil, newValidationError("guest network %s overlaps the mesh subnet %s", subnet, mesh)
+	}
+
+	// Offsets from the network address, as the start option of a dhcp section counts
+	hosts := 1<<(32-ones) - 2
+	offset := int(binary.BigEndian.Uint32(ip) - binary.BigEndian.Uint32(subnet.IP.To4()))
+	switch {
+	case offset == 0 || offset > hosts:
+		return nil, newValidationError("guest network address %s is not a host address of %s", ip, subnet)
+	case dhcpRange.Start < 1 || dhcpRange.End < dhcpRange.Start || dhcpRange.End > hosts:
+		return nil, newValidationError("DHCP range %d-%d must lie within the %d host addresses of %s", dhcpRange.Start, dhcpRange.End, hosts, subnet)
+	case offset >= dhcpRange.Start && offset <= dhcpRange.End:
+		return nil, newValidationError("DHCP range %d-%d holds the guest network address %s", dhcpRange.Start, dhcpRange.End, ip)
+	}
+
+	return &guestNetwork{ip: ip, subnet: subnet}, nil
+}
+
+// ProvisionGuestNetwork sets up a guest network named name in one call: a bridge
+// br-<name> that comes up without ports, a static interface on it at cidr, e.g.
+// "192.168.50.1/24", a DHCP pool handing out the offsets of dhcpRange, and a
+// firewall zone that rejects input and forwarding except for DHCP and DNS from the
+// guests. Guests reach nothing beyond the node until a forwarding is added, e.g.
+// AddFirewallForwarding(name, "wan"). An access point joins the network by naming
+// it as its network in the wireless config.
+//
+// Existing sections are updated in place, so provisioning again with the same
+// arguments changes nothing. The network and dhcp changes are only committed once
+// the firewall changes have been made.
+//
+// Returns true if anything changed. Returns an ErrValidation error if an argument
+// is invalid, if the subnet overlaps the mesh subnet of addressing, or if a network interface named name
+// exists on another device; such an interface is never taken over.
+//
+// Example:
+//
+//	changed, err := ProvisionGuestNetwork("guest", "192.168.50.1/24", DHCPRange{Start: 100, End: 199}, addressing)
+//	if err == nil && changed {
+//	    err = errors.Join(ReloadNetwork(), ReloadDnsmasq(), ReloadFirewall())
+//	}
+//
+// Note: This operation requires appropriate privileges and commits the
+// configuration. The network, dnsmasq and the firewall must be reloaded for it to
+// take effect.
+func ProvisionGuestNetwork(name, cidr string, dhcpRange DHCPRange, addressing MeshAddressing) (bool, error) {
+	return ProvisionGuestNetworkWithReaders(name, cidr, dhcpRange, addressing, NewUCINetworkConfigReader(), NewUCIDHCPConfigReader(), NewUCIFirewallConfigReader())
+}
+
+// ProvisionGuestNetworkWithReaders sets up a guest network using the provided
+// network, dhcp and firewall readers.
+func ProvisionGuestNetworkWithReaders(name, cidr string, dhcpRange DHCPRange, addressing MeshAddressing, networkReader DeviceConfigReader, dhcpReader DHCPConfigReader, firewallReader FirewallConfigReader) (bool, error) {
+	guest, err := validateGuestNetwork(name, cidr, dhcpRange, addressing)
+	if err != nil {
+		return false, err
+	}
+
+	bridge := guestBridgeName(name)
+	if NetworkSectionExistsWithReader(name, networkReader) {
+		if device := networkOption(networkReader, name, "device"); device != bridge {
+			return false, newValidationError("network interface %q exists on device %q, not %s", name, device, bridge)
+		}
+	}
+
+	netTx := NewTransaction(networkConfigName, networkReader)
+	dhcpTx := NewTransaction(dhcpConfigName, dhcpReader)
+	txs := []*Transaction{netTx, dhcpTx}
+
+	discard := func(err error) (bool, error) {
+		for _, tx := range txs {
+			_ = tx.Discard()
+		}
+		return false, err
+	}
+
+	if err := stageGuestNetwork(name, guest, dhcpRange, netTx, dhcpTx); err != nil {
+		return discard(err)
+	}
+
+	changed, err := setGuestFirewall(name, firewallReader)
+	if err != nil {
+		return discard(err)
+	}
+
+	for _, tx := range txs {
+		applied, err := tx.Apply()
+		if err != nil {
+			return changed, err
+		}
+		changed = changed || applied
+	}
+
+	return changed, nil
+}
+
+// stageGuestNetwork stages the bridge, interface and DHCP pool of the guest network
+// through the network and dhcp transactions.
+func stageGuestNetwork(name string, guest *guestNetwork, dhcpRange DHCPRange, netTx, dhcpTx *Transaction) error {
+	bridge := guestBridgeName(name)
+
+	if _, err := SetBridgeDeviceWithReader(&UCIDevice{Name: bridge, BridgeEmpty: "1"}, netTx); err != nil {
+		return err
+	}
+	if _, err := SetNetworkConfigWithReader(name, &UCINetwork{
+		Proto:   "static",
+		IPAddr:  guest.ip.String(),
+		NetMask: net.IP(guest.subnet.Mask).String(),
+		Device:  bridge,
+	}, netTx); err != nil {
+		return err
+	}
+
+	_, err := SetDHCPConfigWithReader(name, &UCIDHCP{
+		Interface: name,
+		Start:     strconv.Itoa(dhcpRange.Start),
+		Limit:     strconv.Itoa(dhcpRange.End - dhcpRange.Start + 1),
+	}, dhcpTx)
+	return err
+}
+
+// setGuestFirewall creates or updates the zone of the guest network name and the
+// rules accepting DHCP and DNS from it.
+//
+// Returns true if anything was committed.
+func setGuestFirewall(name string, reader FirewallConfigReader) (bool, error) {
+	changed, err := SetFirewallZoneWithReader(&UCIFirewallZone{
+		Name:    name,
+		Network: []string{name},
+		Input:   "REJECT",
+		Output:  "ACCEPT",
+		Forward: "REJECT",
+	}, reader)
+	if err != nil {
+		return false, err
+	}
+
+	rules := []struct {
+		section string
+		rule    UCIFirewallRule
+	}{
+		{name + "_dhcp", UCIFirewallRule{Name: fmt.Sprintf("Allow-%s-DHCP", name), Src: name, DestPort: "67", Proto: "udp", Family: "ipv4", Target: "ACCEPT"}},
+		{name + "_dns", UCIFirewallRule{Name: fmt.Sprintf("Allow-%s-DNS", name), Src: name, DestPort: "53", Proto: "tcp udp", Target: "ACCEPT"}},
+	}
+	for _, r := range rules {
+		set, err := SetFirewallRuleWithReader(r.section, &r.rule, reader)
+		if err != nil {
+			return changed, err
+		}
+		changed = changed || set
+	}
+
+	return changed, nil
+}
@@ -0,0 +1,157 @@
+package network
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/digineo/go-uci/v2"
+)
+
+const testGuestFirewallConfig = `
+config zone
+	option name 'lan'
+	list network 'lan'
+	option input 'ACCEPT'
+
+config zone
+	option name 'wan'
+	list network 'wan'
+	option input 'REJECT'
+`
+
+func newTestGuestReaders(t *testing.T) (*UCINetworkConfigReader, *UCIDHCPConfigReader, *UCIFirewallConfigReader, string) {
+	t.Helper()
+
+	dir := writeTestConfigs(t, map[string]string{
+		"network":  testNetworkAddrConfig,
+		"dhcp":     "\nconfig dnsmasq\n\toption domain 'mesh'\n",
+		"firewall": testGuestFirewallConfig,
+	})
+	return NewUCINetworkConfigReaderWithTree(uci.NewTree(dir)),
+		NewUCIDHCPConfigReaderWithTree(uci.NewTree(dir)),
+		NewUCIFirewallConfigReaderWithTree(uci.NewTree(dir)),
+		dir
+}
+
+func TestProvisionGuestNetworkWithReaders(t *testing.T) {
+	networkReader, dhcpReader, firewallReader, dir := newTestGuestReaders(t)
+
+	dhcpRange := DHCPRange{Start: 100, End: 199}
+	changed, err := ProvisionGuestNetworkWithReaders("visitors", "192.168.50.1/24", dhcpRange, DefaultMeshAddressing(), networkReader, dhcpReader, firewallReader)
+	if err != nil || !changed {
+		t.Fatalf("ProvisionGuestNetworkWithReaders() = %v, %v, want true, nil", changed, err)
+	}
+
+	// Read back what was committed
+	networkReader, dhcpReader, firewallReader = NewUCINetworkConfigReaderWithTree(uci.NewTree(dir)),
+		NewUCIDHCPConfigReaderWithTree(uci.NewTree(dir)),
+		NewUCIFirewallConfigReaderWithTree(uci.NewTree(dir))
+
+	bridge, err := GetNetworkDeviceWithReader("br-visitors", networkReader)
+	if err != nil || bridge.Type != "bridge" || bridge.BridgeEmpty != "1" {
+		t.Errorf("bridge = %+v, %v, want an empty bridge", bridge, err)
+	}
+	iface, err := GetUCINetworkByNameWithReader("visitors", networkReader)
+	if err != nil {
+		t.Fatalf("GetUCINetworkByNameWithReader() error = %v", err)
+	}
+	if iface.Proto != "static" || iface.IPAddr != "192.168.50.1" || iface.NetMask != "255.255.255.0" || iface.Device != "br-visitors" {
+		t.Errorf("interface = %+v", iface)
+	}
+
+	pool, err := GetDHCPConfigWithReader("visitors", dhcpReader)
+	if err != nil || pool.Interface != "visitors" || pool.Start != "100" || pool.Limit != "100" {
+		t.Errorf("dhcp pool = %+v, %v, want visitors 100+100", pool, err)
+	}
+
+	zone, err := GetFirewallZoneWithReader("visitors", firewallReader)
+	want := &UCIFirewallZone{Name: "visitors", Network: []string{"visitors"}, Input: "REJECT", Output: "ACCEPT", Forward: "REJECT"}
+	if err != nil || !reflect.DeepEqual(zone, want) {
+		t.Errorf("zone = %+v, %v, want %+v", zone, err, want)
+	}
+	for _, section := range []string{"visitors_dhcp", "visitors_dns"} {
+		if rule, err := GetFirewallRuleWithReader(section, firewallReader); err != nil || rule.Src != "visitors" || rule.Target != "ACCEPT" {
+			t.Errorf("rule %s = %+v, %v, want it to accept from visitors", section, rule, err)
+		}
+	}
+	if forwardings, _ := GetFirewallForwardingsWithReader(firewallReader); len(forwardings) != 0 {
+		t.Errorf("forwardings = %+v, want none", forwardings)
+	}
+
+	changed, err = ProvisionGuestNetworkWithReaders("visitors", "192.168.50.1/24", dhcpRange, DefaultMeshAddressing(), networkReader, dhcpReader, firewallReader)
+	if err != nil || changed {
+		t.Errorf("ProvisionGuestNetworkWithReaders() again = %v, %v, want false, nil", changed, err)
+	}
+}
+
+func TestProvisionGuestNetworkWithReaders_Invalid(t *testing.T) {
+	tests := []struct {
+		name      string
+		guest     string
+		cidr      string
+		dhcpRange DHCPRange
+	}{
+		{"no name", "", "192.168.50.1/24", DHCPRange{Start: 100, End: 199}},
+		{"long name", "visitors_wifi", "192.168.50.1/24", DHCPRange{Start: 100, End: 199}},
+		{"bad name", "guest-1", "192.168.50.1/24", DHCPRange{Start: 100, End: 199}},
+		{"no prefix", "guest", "192.168.50.1", DHCPRange{Start: 100, End: 199}},
+		{"ipv6", "guest", "fd00::1/64", DHCPRange{Start: 100, End: 199}},
+		{"prefix too long", "guest", "192.168.50.1/31", DHCPRange{Start: 1, End: 1}},
+		{"network address", "guest", "192.168.50.0/24", DHCPRange{Start: 100, End: 199}},
+		{"broadcast address", "guest", "192.168.50.255/24", DHCPRange{Start: 100, End: 199}},
+		{"mesh overlap", "guest", "10.41.200.1/24", DHCPRange{Start: 100, End: 199}},
+		{"empty range", "guest", "192.168.50.1/24", DHCPRange{Start: 100, End: 99}},
+		{"range too large", "guest", "192.168.50.1/24", DHCPRange{Start: 100, End: 255}},
+		{"range holds the node", "guest", "192.168.50.1/24", DHCPRange{Start: 1, End: 99}},
+		{"existing interface", "wan", "192.168.50.1/24", DHCPRange{Start: 100, End: 199}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			networkReader, dhcpReader, firewallReader, dir := newTestGuestReaders(t)
+
+			if _, err := ProvisionGuestNetworkWithReaders(tt.guest, tt.cidr, tt.dhcpRange, DefaultMeshAddressing(), networkReader, dhcpReader, firewallReader); !errors.Is(err, ErrValidation) {
+				t.Errorf("ProvisionGuestNetworkWithReaders() error = %v, want ErrValidation", err)
+			}
+			if got, _ := os.ReadFile(filepath.Join(dir, "firewall")); string(got) != testGuestFirewallConfig {
+				t.Errorf("firewall config was changed:\n%s", got)
+			}
+		})
+	}
+}
+
+func TestProvisionGuestNetworkWithReaders_ConfiguredMeshSubnet(t *testing.T) {
+	addressing, err := NewMeshAddressing("172.16.0.0/16", nil)
+	if err != nil {
+		t.Fatalf("NewMeshAddressing() error = %v", err)
+	}
+
+	// Only the configured mesh subnet is off limits, not the default one
+	networkReader, dhcpReader, firewallReader, _ := newTestGuestReaders(t)
+	if _, err := ProvisionGuestNetworkWithReaders("visitors", "172.16.50.1/24", DHCPRange{Start: 100, End: 199}, addressing, networkReader, dhcpReader, firewallReader); !errors.Is(err, ErrValidation) {
+		t.Errorf("overlapping guest network error = %v, want ErrValidation", err)
+	}
+	if _, err := ProvisionGuestNetworkWithReaders("visitors", "10.41.200.1/24", DHCPRange{Start: 100, End: 199}, addressing, networkReader, dhcpReader, firewallReader); err != nil {
+		t.Errorf("ProvisionGuestNetworkWithReaders() error = %v outside the configured mesh subnet", err)
+	}
+}
+
+func TestProvisionGuestNetworkWithReaders_FirewallFailureChangesNothing(t *testing.T) {
+	networkReader, dhcpReader, _, dir := newTestGuestReaders(t)
+	firewallReader := newMockFirewallConfigReader()
+	firewallReader.sectionsErr = errors.New("firewall config unreadable")
+
+	if _, err := ProvisionGuestNetworkWithReaders("visitors", "192.168.50.1/24", DHCPRange{Start: 100, End: 199}, DefaultMeshAddressing(), networkReader, dhcpReader, firewallReader); err == nil {
+		t.Fatal("ProvisionGuestNetworkWithReaders() error = nil, want the firewall error")
+	}
+
+	if got, _ := os.ReadFile(filepath.Join(dir, "network")); string(got) != testNetworkAddrConfig {
+		t.Errorf("network config was changed:\n%s", got)
+	}
+	if changes := append(networkReader.Changes(), dhcpReader.Changes()...); len(changes) != 0 {
+		t.Errorf("changes left staged: %v", changes)
+	}
+}
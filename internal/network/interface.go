@@ -1,8 +1,13 @@
 package network
 
 import (
+	"errors"
 	"fmt"
 	"net"
+
+	"github.com/openmanet/openmanetd/internal/safemode"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
 )
 
 const (
@@ -22,6 +27,35 @@ type IPAddress struct {
 	IP        net.IP
 	Netmask   net.IPMask
 	Broadcast net.IP
+
+	// Scope is the kernel's address scope, e.g. netlink.SCOPE_LINK for link-local
+	// addresses.
+	Scope netlink.Scope
+	// Secondary marks an IPv4 alias added after the primary address of its subnet.
+	Secondary bool
+	// Deprecated marks an address whose preferred lifetime has run out. It still
+	// receives traffic but must not be used for new connections.
+	Deprecated bool
+	// Temporary marks an IPv6 privacy address.
+	Temporary bool
+	// Permanent marks an address without a lifetime, i.e. one that was configured
+	// rather than learned from router advertisements.
+	Permanent bool
+}
+
+// IsLinkLocal reports whether the address is only valid on its link.
+func (a IPAddress) IsLinkLocal() bool {
+	return a.Scope == netlink.SCOPE_LINK
+}
+
+// listAddrs lists the addresses of iface with their flags; overridable for tests.
+var listAddrs = func(iface net.Interface) ([]netlink.Addr, error) {
+	link, err := netlink.LinkByIndex(iface.Index)
+	if err != nil {
+		return nil, err
+	}
+
+	return netlink.AddrList(link, netlink.FAMILY_ALL)
 }
 
 // GetInterfaceByName retrieves information about a network interface by its name.
@@ -57,7 +91,84 @@ func GetInterfaceByName(name string) NetworkInterface {
 	return NetworkInterface{}
 }
 
+// GetInterfaceByNameWithHandle looks up the interface name through the netlink
+// handle h, e.g. one opened in another network namespace. Unlike GetInterfaceByName
+// it reports a missing interface as an error wrapping ErrInterfaceNotFound.
+func GetInterfaceByNameWithHandle(h *netlink.Handle, name string) (NetworkInterface, error) {
+	link, err := h.LinkByName(name)
+	if err != nil {
+		return NetworkInterface{}, newInterfaceNotFoundError(name, err)
+	}
+
+	addrs, err := h.AddrList(link, netlink.FAMILY_ALL)
+	if err != nil {
+		return NetworkInterface{}, fmt.Errorf("failed to list addresses of %s: %w", name, err)
+	}
+
+	attrs := link.Attrs()
+	ni := NetworkInterface{
+		Name:  attrs.Name,
+		MTU:   attrs.MTU,
+		Flags: attrs.Flags,
+		MAC:   attrs.HardwareAddr.String(),
+		IP:    make([]IPAddress, 0, len(addrs)),
+	}
+	for _, addr := range addrs {
+		if addr.IPNet == nil {
+			continue
+		}
+		ni.IP = append(ni.IP, fromNetlinkAddr(addr))
+	}
+
+	return ni, nil
+}
+
+// getInterfaceIPAddresses lists the addresses of iface in kernel order, primary
+// addresses before their aliases. If netlink is unavailable the addresses are read
+// from the net package instead, without flags and with the scope guessed from the IP.
 func getInterfaceIPAddresses(iface net.Interface) []IPAddress {
+	addrs, err := listAddrs(iface)
+	if err != nil {
+		return getInterfaceIPAddressesFallback(iface)
+	}
+
+	ipAddresses := make([]IPAddress, 0, len(addrs))
+	for _, addr := range addrs {
+		if addr.IPNet == nil {
+			continue
+		}
+		ipAddresses = append(ipAddresses, fromNetlinkAddr(addr))
+	}
+
+	return ipAddresses
+}
+
+// fromNetlinkAddr converts addr, decoding its flags.
+func fromNetlinkAddr(addr netlink.Addr) IPAddress {
+	ipAddr := IPAddress{
+		IP:         addr.IP,
+		Netmask:    addr.Mask,
+		Broadcast:  addr.Broadcast,
+		Scope:      netlink.Scope(addr.Scope),
+		Deprecated: addr.Flags&unix.IFA_F_DEPRECATED != 0,
+		Permanent:  addr.Flags&unix.IFA_F_PERMANENT != 0,
+	}
+
+	// The kernel uses the same bit for IPv4 aliases and IPv6 privacy addresses
+	if addr.IP.To4() != nil {
+		ipAddr.Secondary = addr.Flags&unix.IFA_F_SECONDARY != 0
+	} else {
+		ipAddr.Temporary = addr.Flags&unix.IFA_F_TEMPORARY != 0
+	}
+
+	if ipAddr.Broadcast == nil {
+		ipAddr.Broadcast = calculateBroadcastAddress(addr.IPNet)
+	}
+
+	return ipAddr
+}
+
+func getInterfaceIPAddressesFallback(iface net.Interface) []IPAddress {
 	var ipAddresses []IPAddress
 
 	addrs, err := iface.Addrs()
@@ -86,12 +197,25 @@ func getInterfaceIPAddresses(iface net.Interface) []IPAddress {
 			IP:        ip,
 			Netmask:   netmask,
 			Broadcast: broadcast,
+			Scope:     guessScope(ip),
 		})
 	}
 
 	return ipAddresses
 }
 
+// guessScope derives the scope of ip from its prefix, for addresses read without
+// netlink.
+func guessScope(ip net.IP) netlink.Scope {
+	switch {
+	case ip.IsLoopback():
+		return netlink.SCOPE_HOST
+	case ip.IsLinkLocalUnicast():
+		return netlink.SCOPE_LINK
+	}
+	return netlink.SCOPE_UNIVERSE
+}
+
 func calculateBroadcastAddress(ipNet *net.IPNet) net.IP {
 	ip := ipNet.IP.To4()
 	if ip == nil {
@@ -138,3 +262,258 @@ func (ni *NetworkInterface) GetCIDR() []string {
 
 	return cidrs
 }
+
+// HasAddress reports whether the interface carries ip.
+func (ni *NetworkInterface) HasAddress(ip net.IP) bool {
+	_, ok := ni.Address(ip)
+	return ok
+}
+
+// Address returns the address entry of ip, with its flags, if the interface
+// carries it.
+func (ni *NetworkInterface) Address(ip net.IP) (IPAddress, bool) {
+	for _, ipAddr := range ni.IP {
+		if ipAddr.IP.Equal(ip) {
+			return ipAddr, true
+		}
+	}
+
+	return IPAddress{}, false
+}
+
+// AddrOption widens the addresses the selection helpers consider.
+type AddrOption func(*addrSelection)
+
+type addrSelection struct {
+	deprecated bool
+	temporary  bool
+}
+
+// IncludeDeprecated lets the selection helpers return deprecated addresses.
+func IncludeDeprecated(sel *addrSelection) { sel.deprecated = true }
+
+// IncludeTemporary lets the selection helpers return IPv6 privacy addresses.
+func IncludeTemporary(sel *addrSelection) { sel.temporary = true }
+
+// IPv4 returns the IPv4 addresses of the interface that may be advertised to
+// peers, primary addresses first. Deprecated addresses are skipped unless
+// IncludeDeprecated is given.
+//
+// Example:
+//
+//	iface := GetInterfaceByName("br-ahwlan")
+//	for _, addr := range iface.IPv4() {
+//	    fmt.Println(addr.IP, addr.Secondary)
+//	}
+func (ni *NetworkInterface) IPv4(opts ...AddrOption) []IPAddress {
+	var primary, secondary []IPAddress
+	for _, addr := range ni.selectAddrs(opts) {
+		if addr.IP.To4() == nil {
+			continue
+		}
+		if addr.Secondary {
+			secondary = append(secondary, addr)
+		} else {
+			primary = append(primary, addr)
+		}
+	}
+
+	return append(primary, secondary...)
+}
+
+// PrimaryIPv4 returns the address the node is reached at: the first usable IPv4
+// address that is not an alias, or the first alias if there is no such address.
+// The options are those of IPv4.
+//
+// Returns false if the interface has no usable IPv4 address.
+func (ni *NetworkInterface) PrimaryIPv4(opts ...AddrOption) (IPAddress, bool) {
+	for _, addr := range ni.IPv4(opts...) {
+		if !addr.IP.IsUnspecified() && !addr.IP.IsLoopback() {
+			return addr, true
+		}
+	}
+
+	return IPAddress{}, false
+}
+
+// IPv6 returns the IPv6 addresses of the interface. Deprecated and temporary
+// addresses are skipped unless IncludeDeprecated or IncludeTemporary is given.
+func (ni *NetworkInterface) IPv6(opts ...AddrOption) []IPAddress {
+	var addrs []IPAddress
+	for _, addr := range ni.selectAddrs(opts) {
+		if addr.IP != nil && addr.IP.To4() == nil {
+			addrs = append(addrs, addr)
+		}
+	}
+
+	return addrs
+}
+
+func (ni *NetworkInterface) selectAddrs(opts []AddrOption) []IPAddress {
+	var sel addrSelection
+	for _, opt := range opts {
+		opt(&sel)
+	}
+
+	var addrs []IPAddress
+	for _, addr := range ni.IP {
+		if (addr.Deprecated && !sel.deprecated) || (addr.Temporary && !sel.temporary) {
+			continue
+		}
+		addrs = append(addrs, addr)
+	}
+
+	return addrs
+}
+
+// EnsureInterfaceAddress assigns addr to the named interface directly over netlink,
+// bypassing netifd. It is idempotent: an address that is already present is left
+// as it is.
+//
+// Parameters:
+//   - name: The name of the network interface
+//   - addr: The address and prefix to assign
+//
+// Returns an error if addr is nil, the interface doesn't exist, or the address
+// cannot be assigned.
+//
+// Example:
+//
+//	addr := &net.IPNet{IP: net.ParseIP("10.41.2.10"), Mask: net.CIDRMask(16, 32)}
+//	if err := EnsureInterfaceAddress("br-ahwlan", addr); err != nil {
+//	    log.Fatalf("Failed to assign address: %v", err)
+//	}
+//
+// Note: This operation requires appropriate privileges (typically root/CAP_NET_ADMIN).
+// netifd is not told about the address and may remove it on its next reload.
+func EnsureInterfaceAddress(name string, addr *net.IPNet) error {
+	if addr == nil {
+		return newValidationError("address cannot be nil")
+	}
+
+	if err := safemode.Check(fmt.Sprintf("assign %s to %s", addr, name)); err != nil {
+		return err
+	}
+
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		return newInterfaceNotFoundError(name, err)
+	}
+
+	if err := netlink.AddrReplace(link, &netlink.Addr{IPNet: addr}); err != nil {
+		return fmt.Errorf("failed to assign %s to %s: %w", addr, name, err)
+	}
+
+	return nil
+}
+
+// ListAddresses returns the addresses of the interface iface with their flags, read
+// over netlink, primary addresses before their aliases. Unlike GetInterfaceByName it
+// reports a missing interface as an error wrapping ErrInterfaceNotFound, so that a
+// caller verifying an address it just assigned can tell the two apart.
+//
+// Example:
+//
+//	addrs, err := ListAddresses("br-ahwlan")
+//	for _, a := range addrs {
+//	    fmt.Printf("%s secondary=%v\n", &net.IPNet{IP: a.IP, Mask: a.Netmask}, a.Secondary)
+//	}
+func ListAddresses(iface string) ([]IPAddress, error) {
+	link, err := netlink.LinkByName(iface)
+	if err != nil {
+		return nil, newInterfaceNotFoundError(iface, err)
+	}
+
+	addrs, err := netlink.AddrList(link, netlink.FAMILY_ALL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list addresses of %s: %w", iface, err)
+	}
+
+	ipAddresses := make([]IPAddress, 0, len(addrs))
+	for _, addr := range addrs {
+		if addr.IPNet == nil {
+			continue
+		}
+		ipAddresses = append(ipAddresses, fromNetlinkAddr(addr))
+	}
+
+	return ipAddresses, nil
+}
+
+// validateAddress checks that addr is a host address with a prefix.
+func validateAddress(addr *net.IPNet) error {
+	if addr == nil || addr.IP == nil || addr.Mask == nil {
+		return newValidationError("address cannot be nil")
+	}
+	if _, bits := addr.Mask.Size(); bits == 0 || (addr.IP.To4() != nil) != (bits == 32) {
+		return newValidationError("address %s has an invalid prefix", addr)
+	}
+	return nil
+}
+
+// AddAddress adds addr, the address and its prefix, to the interface iface over
+// netlink, so that it is reachable at once instead of after netifd has reloaded the
+// network. Adding an address that iface already has with the same prefix does
+// nothing; unlike EnsureInterfaceAddress, its flags and lifetimes are left alone.
+//
+// Returns an ErrValidation error if addr is incomplete and an ErrInterfaceNotFound
+// error if there is no such interface.
+//
+// Example:
+//
+//	addr := &net.IPNet{IP: net.ParseIP("10.41.2.10"), Mask: net.CIDRMask(16, 32)}
+//	if err := AddAddress("br-ahwlan", addr); err != nil {
+//	    log.Fatalf("Failed to add address: %v", err)
+//	}
+//	addrs, err := ListAddresses("br-ahwlan")
+//	ni := NetworkInterface{Name: "br-ahwlan", IP: addrs}
+//	if err == nil && !ni.HasAddress(addr.IP) {
+//	    log.Printf("%s was not added", addr)
+//	}
+//
+// Note: This operation requires appropriate privileges (typically root/CAP_NET_ADMIN).
+// netifd is not told about the address and may remove it on its next reload, so the
+// address must also be in the UCI network config to last.
+func AddAddress(iface string, addr *net.IPNet) error {
+	if err := validateAddress(addr); err != nil {
+		return err
+	}
+
+	link, err := linkByName(iface, fmt.Sprintf("add %s to %s", addr, iface))
+	if err != nil {
+		return err
+	}
+
+	if err := netlink.AddrAdd(link, &netlink.Addr{IPNet: addr}); err != nil && !errors.Is(err, unix.EEXIST) {
+		return fmt.Errorf("failed to add %s to %s: %w", addr, iface, err)
+	}
+
+	return nil
+}
+
+// DeleteAddress removes addr, the address and its prefix, from the interface iface
+// over netlink, e.g. the previous address of a node that was renumbered. Deleting an
+// address that iface does not have does nothing. The kernel also removes the
+// routes that were added for the address, and deleting the primary address of a
+// subnet deletes its aliases unless the interface promotes them.
+//
+// Returns an ErrValidation error if addr is incomplete and an ErrInterfaceNotFound
+// error if there is no such interface.
+//
+// Note: This operation requires appropriate privileges (typically root/CAP_NET_ADMIN).
+func DeleteAddress(iface string, addr *net.IPNet) error {
+	if err := validateAddress(addr); err != nil {
+		return err
+	}
+
+	link, err := linkByName(iface, fmt.Sprintf("delete %s from %s", addr, iface))
+	if err != nil {
+		return err
+	}
+
+	if err := netlink.AddrDel(link, &netlink.Addr{IPNet: addr}); err != nil && !errors.Is(err, unix.EADDRNOTAVAIL) {
+		return fmt.Errorf("failed to delete %s from %s: %w", addr, iface, err)
+	}
+
+	return nil
+}
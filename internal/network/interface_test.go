@@ -1,8 +1,12 @@
 package network
 
 import (
+	"errors"
 	"net"
 	"testing"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
 )
 
 func TestGetInterfaceByName(t *testing.T) {
@@ -505,3 +509,211 @@ func TestNetworkInterface_GetCIDR_RealInterface(t *testing.T) {
 
 	t.Skip("No interface found with IP addresses")
 }
+
+func TestNetworkInterface_HasAddress(t *testing.T) {
+	ni := &NetworkInterface{
+		IP: []IPAddress{
+			{IP: net.ParseIP("10.41.2.10"), Netmask: net.CIDRMask(16, 32)},
+			{IP: net.ParseIP("fd00::1"), Netmask: net.CIDRMask(64, 128)},
+		},
+	}
+
+	if !ni.HasAddress(net.ParseIP("10.41.2.10")) {
+		t.Error("HasAddress(10.41.2.10) = false, want true")
+	}
+	if ni.HasAddress(net.ParseIP("10.41.2.11")) {
+		t.Error("HasAddress(10.41.2.11) = true, want false")
+	}
+	if (&NetworkInterface{}).HasAddress(net.ParseIP("10.41.2.10")) {
+		t.Error("HasAddress() = true on an interface without addresses")
+	}
+}
+
+func TestEnsureInterfaceAddress_Invalid(t *testing.T) {
+	if err := EnsureInterfaceAddress("lo", nil); !errors.Is(err, ErrValidation) {
+		t.Errorf("EnsureInterfaceAddress(nil) error = %v, want ErrValidation", err)
+	}
+
+	addr := &net.IPNet{IP: net.ParseIP("10.41.2.10"), Mask: net.CIDRMask(16, 32)}
+	if err := EnsureInterfaceAddress("nonexistent999", addr); !errors.Is(err, ErrInterfaceNotFound) {
+		t.Errorf("EnsureInterfaceAddress() error = %v, want ErrInterfaceNotFound", err)
+	}
+}
+
+// fakeAddrs replaces the netlink address source for the duration of the test.
+func fakeAddrs(t *testing.T, addrs []netlink.Addr, err error) {
+	t.Helper()
+	saved := listAddrs
+	listAddrs = func(net.Interface) ([]netlink.Addr, error) { return addrs, err }
+	t.Cleanup(func() { listAddrs = saved })
+}
+
+func nlAddr(t *testing.T, cidr string, scope netlink.Scope, flags int) netlink.Addr {
+	t.Helper()
+	ip, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ipNet.IP = ip
+	return netlink.Addr{IPNet: ipNet, Scope: int(scope), Flags: flags}
+}
+
+func TestGetInterfaceIPAddresses_Flags(t *testing.T) {
+	fakeAddrs(t, []netlink.Addr{
+		nlAddr(t, "10.41.2.10/16", netlink.SCOPE_UNIVERSE, unix.IFA_F_PERMANENT),
+		nlAddr(t, "10.41.9.9/16", netlink.SCOPE_UNIVERSE, unix.IFA_F_PERMANENT|unix.IFA_F_SECONDARY),
+		nlAddr(t, "fd00::10/64", netlink.SCOPE_UNIVERSE, unix.IFA_F_DEPRECATED),
+		nlAddr(t, "fd00::abcd/64", netlink.SCOPE_UNIVERSE, unix.IFA_F_TEMPORARY),
+		nlAddr(t, "fe80::1/64", netlink.SCOPE_LINK, unix.IFA_F_PERMANENT),
+	}, nil)
+
+	addrs := getInterfaceIPAddresses(net.Interface{Name: "br-ahwlan"})
+	if len(addrs) != 5 {
+		t.Fatalf("got %d addresses, want 5", len(addrs))
+	}
+
+	primary, alias, deprecated, temporary, linkLocal := addrs[0], addrs[1], addrs[2], addrs[3], addrs[4]
+	if primary.Secondary || !primary.Permanent || primary.Broadcast.String() != "10.41.255.255" {
+		t.Errorf("primary = %+v", primary)
+	}
+	if !alias.Secondary || alias.Temporary {
+		t.Errorf("alias = %+v, want Secondary only", alias)
+	}
+	if !deprecated.Deprecated || deprecated.Temporary || deprecated.Secondary {
+		t.Errorf("deprecated = %+v, want Deprecated only", deprecated)
+	}
+	if !temporary.Temporary || temporary.Secondary {
+		t.Errorf("temporary = %+v, want Temporary only", temporary)
+	}
+	if !linkLocal.IsLinkLocal() || primary.IsLinkLocal() {
+		t.Errorf("IsLinkLocal() = %v for fe80::1, %v for 10.41.2.10", linkLocal.IsLinkLocal(), primary.IsLinkLocal())
+	}
+}
+
+func TestGetInterfaceIPAddresses_Fallback(t *testing.T) {
+	fakeAddrs(t, nil, errors.New("netlink unavailable"))
+
+	for _, addr := range getInterfaceIPAddresses(net.Interface{Index: 1, Name: "lo"}) {
+		if addr.IP.IsLoopback() && addr.Scope != netlink.SCOPE_HOST {
+			t.Errorf("Scope of %s = %v, want host", addr.IP, addr.Scope)
+		}
+	}
+}
+
+func TestNetworkInterface_PrimaryIPv4(t *testing.T) {
+	ip := func(s string, mod func(*IPAddress)) IPAddress {
+		addr := IPAddress{IP: net.ParseIP(s), Netmask: net.CIDRMask(16, 32)}
+		if mod != nil {
+			mod(&addr)
+		}
+		return addr
+	}
+	secondary := func(a *IPAddress) { a.Secondary = true }
+	deprecated := func(a *IPAddress) { a.Deprecated = true }
+
+	tests := []struct {
+		name  string
+		addrs []IPAddress
+		opts  []AddrOption
+		want  string
+	}{
+		{"primary before an earlier alias", []IPAddress{ip("10.41.9.9", secondary), ip("10.41.2.10", nil)}, nil, "10.41.2.10"},
+		{"alias when there is no primary", []IPAddress{ip("fd00::1", nil), ip("10.41.9.9", secondary)}, nil, "10.41.9.9"},
+		{"deprecated skipped", []IPAddress{ip("10.41.2.10", deprecated), ip("10.41.9.9", secondary)}, nil, "10.41.9.9"},
+		{"deprecated included", []IPAddress{ip("10.41.2.10", deprecated), ip("10.41.9.9", secondary)}, []AddrOption{IncludeDeprecated}, "10.41.2.10"},
+		{"only deprecated", []IPAddress{ip("10.41.2.10", deprecated)}, nil, ""},
+		{"loopback skipped", []IPAddress{ip("127.0.0.1", nil)}, nil, ""},
+		{"no addresses", nil, nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ni := &NetworkInterface{IP: tt.addrs}
+			addr, ok := ni.PrimaryIPv4(tt.opts...)
+			if got := addr.IP.String(); (tt.want == "" && ok) || (tt.want != "" && got != tt.want) {
+				t.Errorf("PrimaryIPv4() = %s, %v; want %q", got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestNetworkInterface_IPv6(t *testing.T) {
+	ni := &NetworkInterface{IP: []IPAddress{
+		{IP: net.ParseIP("10.41.2.10")},
+		{IP: net.ParseIP("fd00::10"), Deprecated: true},
+		{IP: net.ParseIP("fd00::abcd"), Temporary: true},
+		{IP: net.ParseIP("fd00::1"), Permanent: true},
+	}}
+
+	count := func(opts ...AddrOption) int { return len(ni.IPv6(opts...)) }
+	if got := count(); got != 1 {
+		t.Errorf("IPv6() = %d addresses, want only the permanent one", got)
+	}
+	if got := count(IncludeTemporary); got != 2 {
+		t.Errorf("IPv6(IncludeTemporary) = %d addresses, want 2", got)
+	}
+	if got := count(IncludeDeprecated, IncludeTemporary); got != 3 {
+		t.Errorf("IPv6(IncludeDeprecated, IncludeTemporary) = %d addresses, want 3", got)
+	}
+}
+
+func TestNetworkInterface_Address(t *testing.T) {
+	ni := &NetworkInterface{IP: []IPAddress{
+		{IP: net.ParseIP("10.41.2.10")},
+		{IP: net.ParseIP("10.41.9.9"), Secondary: true},
+	}}
+
+	if addr, ok := ni.Address(net.ParseIP("10.41.9.9")); !ok || !addr.Secondary {
+		t.Errorf("Address(10.41.9.9) = %+v, %v; want the alias", addr, ok)
+	}
+	if _, ok := ni.Address(net.ParseIP("10.41.2.11")); ok {
+		t.Error("Address(10.41.2.11) found an address the interface does not carry")
+	}
+}
+
+func TestListAddresses(t *testing.T) {
+	if _, err := net.InterfaceByName("lo"); err != nil {
+		t.Skip("no loopback interface")
+	}
+
+	addrs, err := ListAddresses("lo")
+	if err != nil {
+		t.Fatalf("ListAddresses(lo) error = %v", err)
+	}
+	ni := NetworkInterface{Name: "lo", IP: addrs}
+	if !ni.HasAddress(net.ParseIP("127.0.0.1")) {
+		t.Errorf("ListAddresses(lo) = %v, want 127.0.0.1", addrs)
+	}
+
+	if _, err := ListAddresses("nonexistent999"); !errors.Is(err, ErrInterfaceNotFound) {
+		t.Errorf("ListAddresses() error = %v, want ErrInterfaceNotFound", err)
+	}
+}
+
+func TestAddDeleteAddress_Invalid(t *testing.T) {
+	valid := &net.IPNet{IP: net.ParseIP("10.41.2.10"), Mask: net.CIDRMask(16, 32)}
+	invalid := []*net.IPNet{
+		nil,
+		{IP: net.ParseIP("10.41.2.10")},
+		{Mask: net.CIDRMask(16, 32)},
+		{IP: net.ParseIP("10.41.2.10"), Mask: net.CIDRMask(64, 128)},
+		{IP: net.ParseIP("fd00::1"), Mask: net.CIDRMask(16, 32)},
+		{IP: net.ParseIP("10.41.2.10"), Mask: net.IPMask{255, 0, 255, 0}},
+	}
+
+	for _, addr := range invalid {
+		if err := AddAddress("lo", addr); !errors.Is(err, ErrValidation) {
+			t.Errorf("AddAddress(%v) error = %v, want ErrValidation", addr, err)
+		}
+		if err := DeleteAddress("lo", addr); !errors.Is(err, ErrValidation) {
+			t.Errorf("DeleteAddress(%v) error = %v, want ErrValidation", addr, err)
+		}
+	}
+
+	if err := AddAddress("nonexistent999", valid); !errors.Is(err, ErrInterfaceNotFound) {
+		t.Errorf("AddAddress() error = %v, want ErrInterfaceNotFound", err)
+	}
+	if err := DeleteAddress("nonexistent999", valid); !errors.Is(err, ErrInterfaceNotFound) {
+		t.Errorf("DeleteAddress() error = %v, want ErrInterfaceNotFound", err)
+	}
+}
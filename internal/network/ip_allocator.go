@@ -0,0 +1,197 @@
+package network
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/openmanet/go-alfred"
+	proto "github.com/openmanet/openmanetd/internal/api/openmanet/v1"
+)
+
+// Static IP allocation strategies.
+const (
+	// IPAllocationSequential hands out the lowest free address. A node that sees at
+	// most one reservation picks a random address first, as it always has.
+	IPAllocationSequential string = "sequential"
+	// IPAllocationRandom picks uniformly among the free addresses.
+	IPAllocationRandom string = "random"
+	// IPAllocationMACHash maps the node's MAC into the pool and probes upwards from
+	// there, so a node tends to get the same address every time it is provisioned.
+	IPAllocationMACHash string = "mac-hash"
+)
+
+// AddressPool is the ordered set of static IPs a node may claim, made of /24
+// blocks of the mesh subnet. See MeshAddressing for the blocks of the gateway and
+// node pools. Network and broadcast addresses of every /24 are never part of a pool.
+type AddressPool struct {
+	// blocks are the base addresses of the /24 blocks, in ascending order.
+	blocks []uint32
+	name   string
+}
+
+// Blocks returns the /24 blocks the pool is made of, in order.
+func (p AddressPool) Blocks() []string {
+	blocks := make([]string, len(p.blocks))
+	for i, base := range p.blocks {
+		blocks[i] = blockName(base)
+	}
+	return blocks
+}
+
+// Contains reports whether ip is an address of the pool.
+func (p AddressPool) Contains(ip string) bool {
+	addr := net.ParseIP(ip).To4()
+	if addr == nil || addr[3] == 0 || addr[3] == 255 {
+		return false
+	}
+	return p.hasBlock(ipToUint32(addr) &^ 0xff)
+}
+
+// Size returns the number of addresses in the pool.
+func (p AddressPool) Size() int {
+	return len(p.blocks) * 254
+}
+
+// At returns the i-th address of the pool, 0 <= i < Size.
+func (p AddressPool) At(i int) string {
+	return uint32ToIP(p.blocks[i/254] + uint32(i%254+1)).String()
+}
+
+// String returns the range the pool covers.
+func (p AddressPool) String() string {
+	return p.name
+}
+
+func (p AddressPool) exhausted() error {
+	return fmt.Errorf("%w: no IP addresses left in %s range", ErrNoAvailableAddress, p)
+}
+
+// IPAllocator picks a static IP from a pool.
+type IPAllocator interface {
+	// Allocate returns an address of pool that is not in reserved, or an error
+	// wrapping ErrNoAvailableAddress if every address is taken.
+	Allocate(pool AddressPool, reserved map[string]bool) (string, error)
+}
+
+// SequentialAllocator returns the lowest free address.
+type SequentialAllocator struct{}
+
+// Allocate implements IPAllocator.
+func (SequentialAllocator) Allocate(pool AddressPool, reserved map[string]bool) (string, error) {
+	for i := 0; i < pool.Size(); i++ {
+		if ip := pool.At(i); !reserved[ip] {
+			return ip, nil
+		}
+	}
+
+	return "", pool.exhausted()
+}
+
+// RandomAllocator returns a free address chosen uniformly at random.
+type RandomAllocator struct {
+	// Rand is the source of randomness. Nil uses a source seeded from the clock.
+	Rand *rand.Rand
+}
+
+// randomProbes is the number of random picks tried before the free addresses are
+// enumerated. Pools are mostly empty, so the first pick nearly always succeeds.
+const randomProbes = 64
+
+// Allocate implements IPAllocator.
+func (a RandomAllocator) Allocate(pool AddressPool, reserved map[string]bool) (string, error) {
+	rng := a.Rand
+	if rng == nil {
+		rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+
+	for range randomProbes {
+		if ip := pool.At(rng.Intn(pool.Size())); !reserved[ip] {
+			return ip, nil
+		}
+	}
+
+	// reserved may hold addresses outside the pool, so its size says nothing of how
+	// many are free
+	var free []int
+	for i := 0; i < pool.Size(); i++ {
+		if !reserved[pool.At(i)] {
+			free = append(free, i)
+		}
+	}
+	if len(free) == 0 {
+		return "", pool.exhausted()
+	}
+
+	return pool.At(free[rng.Intn(len(free))]), nil
+}
+
+// MACHashAllocator maps MAC to a starting address in the pool and returns the first
+// free address from there, wrapping around at the end of the pool.
+type MACHashAllocator struct {
+	MAC string
+}
+
+// Allocate implements IPAllocator.
+func (a MACHashAllocator) Allocate(pool AddressPool, reserved map[string]bool) (string, error) {
+	mac := strings.ToLower(strings.TrimSpace(a.MAC))
+	if mac == "" {
+		return "", newValidationError("mac-hash allocation needs the node MAC")
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(mac))
+	start := int(h.Sum64() % uint64(pool.Size()))
+
+	for n := 0; n < pool.Size(); n++ {
+		if ip := pool.At((start + n) % pool.Size()); !reserved[ip] {
+			return ip, nil
+		}
+	}
+
+	return "", pool.exhausted()
+}
+
+// NewIPAllocator returns the allocator for strategy. mac is only used by
+// IPAllocationMACHash.
+//
+// Returns an ErrValidation error for an unknown strategy.
+func NewIPAllocator(strategy, mac string) (IPAllocator, error) {
+	switch strategy {
+	case IPAllocationSequential, "":
+		return SequentialAllocator{}, nil
+	case IPAllocationRandom:
+		return RandomAllocator{}, nil
+	case IPAllocationMACHash:
+		return MACHashAllocator{MAC: mac}, nil
+	default:
+		return nil, newValidationError("unknown IP allocation strategy %q", strategy)
+	}
+}
+
+// reservedStaticIPs returns the static IPs claimed in the records, including those a
+// block owner offered to another node. Records that cannot be decoded are skipped.
+func reservedStaticIPs(records []alfred.Record) map[string]bool {
+	reserved := make(map[string]bool)
+
+	for _, record := range records {
+		var addrRes proto.AddressReservation
+		if err := addrRes.UnmarshalVT(record.Data); err != nil {
+			continue
+		}
+
+		if addrRes.StaticIp != "" {
+			reserved[addrRes.StaticIp] = true
+		}
+		for _, offer := range addrRes.Offers {
+			if offer.StaticIp != "" {
+				reserved[offer.StaticIp] = true
+			}
+		}
+	}
+
+	return reserved
+}
@@ -0,0 +1,243 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"testing"
+
+	"github.com/openmanet/go-alfred"
+	proto "github.com/openmanet/openmanetd/internal/api/openmanet/v1"
+)
+
+func TestStaticIPPool(t *testing.T) {
+	tests := []struct {
+		name        string
+		gatewayMode bool
+		wantSize    int
+		wantFirst   string
+		wantLast    string
+	}{
+		{"gateway", true, 254, "10.41.0.1", "10.41.0.254"},
+		{"node", false, 253 * 254, "10.41.1.1", "10.41.255.254"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := DefaultMeshAddressing().StaticIPPool(tt.gatewayMode)
+			if got := pool.Size(); got != tt.wantSize {
+				t.Errorf("Size() = %d, want %d", got, tt.wantSize)
+			}
+			if got := pool.At(0); got != tt.wantFirst {
+				t.Errorf("At(0) = %s, want %s", got, tt.wantFirst)
+			}
+			if got := pool.At(pool.Size() - 1); got != tt.wantLast {
+				t.Errorf("At(last) = %s, want %s", got, tt.wantLast)
+			}
+		})
+	}
+}
+
+func TestRandomAllocator_Spread(t *testing.T) {
+	allocator := RandomAllocator{Rand: rand.New(rand.NewSource(1))}
+	pool := DefaultMeshAddressing().StaticIPPool(false)
+
+	subnets := make(map[byte]bool)
+	for range 200 {
+		ip, err := allocator.Allocate(pool, nil)
+		if err != nil {
+			t.Fatalf("Allocate() error = %v", err)
+		}
+		subnets[net.ParseIP(ip).To4()[2]] = true
+	}
+
+	// 200 uniform picks over 253 /24s land in well over 100 of them
+	if len(subnets) < 100 {
+		t.Errorf("random allocation used %d /24s out of 200 picks, want at least 100", len(subnets))
+	}
+}
+
+func TestRandomAllocator_MoreReservedThanPool(t *testing.T) {
+	allocator := RandomAllocator{Rand: rand.New(rand.NewSource(1))}
+	pool := DefaultMeshAddressing().StaticIPPool(true)
+
+	// Leases and offers outside the pool are reserved along with the whole pool
+	reserved := make(map[string]bool)
+	for i := range pool.Size() {
+		reserved[pool.At(i)] = true
+	}
+	for fourth := 1; fourth <= 20; fourth++ {
+		reserved[fmt.Sprintf("10.41.1.%d", fourth)] = true
+	}
+	if len(reserved) <= pool.Size() {
+		t.Fatalf("%d reserved addresses, want more than the %d of the pool", len(reserved), pool.Size())
+	}
+
+	if _, err := allocator.Allocate(pool, reserved); !errors.Is(err, ErrNoAvailableAddress) {
+		t.Errorf("Allocate() error = %v, want ErrNoAvailableAddress", err)
+	}
+
+	// One address of the pool left free is still found
+	delete(reserved, "10.41.0.77")
+	if ip, err := allocator.Allocate(pool, reserved); err != nil || ip != "10.41.0.77" {
+		t.Errorf("Allocate() = %q, %v, want 10.41.0.77", ip, err)
+	}
+}
+
+func TestMACHashAllocator(t *testing.T) {
+	pool := DefaultMeshAddressing().StaticIPPool(false)
+
+	t.Run("same MAC gets the same address", func(t *testing.T) {
+		first, err := MACHashAllocator{MAC: "aa:bb:cc:dd:ee:01"}.Allocate(pool, nil)
+		if err != nil {
+			t.Fatalf("Allocate() error = %v", err)
+		}
+		again, _ := MACHashAllocator{MAC: "AA:BB:CC:DD:EE:01"}.Allocate(pool, nil)
+		if again != first {
+			t.Errorf("Allocate() = %s then %s for the same MAC", first, again)
+		}
+	})
+
+	t.Run("different MACs diverge", func(t *testing.T) {
+		seen := make(map[string]bool)
+		for i := range 50 {
+			ip, err := MACHashAllocator{MAC: fmt.Sprintf("aa:bb:cc:dd:ee:%02x", i)}.Allocate(pool, nil)
+			if err != nil {
+				t.Fatalf("Allocate() error = %v", err)
+			}
+			seen[ip] = true
+		}
+		if len(seen) < 48 {
+			t.Errorf("50 MACs mapped to %d addresses, want nearly all distinct", len(seen))
+		}
+	})
+
+	t.Run("probes past reserved addresses", func(t *testing.T) {
+		allocator := MACHashAllocator{MAC: "aa:bb:cc:dd:ee:01"}
+		home, _ := allocator.Allocate(pool, nil)
+
+		got, err := allocator.Allocate(pool, map[string]bool{home: true})
+		if err != nil {
+			t.Fatalf("Allocate() error = %v", err)
+		}
+		if got == home {
+			t.Fatalf("Allocate() returned the reserved address %s", home)
+		}
+		again, _ := allocator.Allocate(pool, map[string]bool{home: true})
+		if again != got {
+			t.Errorf("Allocate() = %s then %s with the same reservations", got, again)
+		}
+	})
+
+	t.Run("needs a MAC", func(t *testing.T) {
+		if _, err := (MACHashAllocator{}).Allocate(pool, nil); !errors.Is(err, ErrValidation) {
+			t.Errorf("Allocate() error = %v, want ErrValidation", err)
+		}
+	})
+}
+
+func TestSelectStaticIPWithStrategy(t *testing.T) {
+	// Reserve all of 10.41.1.0/24 to 10.41.200.0/24 so most picks have to avoid them
+	var records []alfred.Record
+	reserved := make(map[string]bool)
+	for third := 1; third <= 200; third++ {
+		for fourth := 1; fourth < 255; fourth++ {
+			ip := fmt.Sprintf("10.41.%d.%d", third, fourth)
+			reserved[ip] = true
+			records = append(records, alfred.Record{
+				Data: mustMarshalAddressReservation(&proto.AddressReservation{StaticIp: ip}),
+			})
+		}
+	}
+
+	for _, strategy := range []string{IPAllocationSequential, IPAllocationRandom, IPAllocationMACHash} {
+		t.Run(strategy, func(t *testing.T) {
+			for i := range 20 {
+				mac := fmt.Sprintf("aa:bb:cc:dd:ee:%02x", i)
+
+				ip, err := DefaultMeshAddressing().SelectStaticIPWithStrategy(records, false, strategy, mac)
+				if err != nil {
+					t.Fatalf("DefaultMeshAddressing().SelectStaticIPWithStrategy() error = %v", err)
+				}
+				if reserved[ip] {
+					t.Fatalf("DefaultMeshAddressing().SelectStaticIPWithStrategy() = %s, which is reserved", ip)
+				}
+				if err := DefaultMeshAddressing().ValidatePinnedIP(ip); err != nil {
+					t.Fatalf("DefaultMeshAddressing().SelectStaticIPWithStrategy() = %s, outside the node pool: %v", ip, err)
+				}
+
+				gw, err := DefaultMeshAddressing().SelectStaticIPWithStrategy(records, true, strategy, mac)
+				if err != nil {
+					t.Fatalf("DefaultMeshAddressing().SelectStaticIPWithStrategy() gateway error = %v", err)
+				}
+				if addr := net.ParseIP(gw).To4(); addr[2] != 0 || addr[3] == 0 || addr[3] == 255 {
+					t.Fatalf("DefaultMeshAddressing().SelectStaticIPWithStrategy() gateway = %s, outside 10.41.0.0/24", gw)
+				}
+			}
+		})
+	}
+}
+
+func TestSelectStaticIPWithStrategy_Exhausted(t *testing.T) {
+	var records []alfred.Record
+	for fourth := 1; fourth < 255; fourth++ {
+		records = append(records, alfred.Record{
+			Data: mustMarshalAddressReservation(&proto.AddressReservation{StaticIp: fmt.Sprintf("10.41.0.%d", fourth)}),
+		})
+	}
+
+	for _, strategy := range []string{IPAllocationSequential, IPAllocationRandom, IPAllocationMACHash} {
+		t.Run(strategy, func(t *testing.T) {
+			_, err := DefaultMeshAddressing().SelectStaticIPWithStrategy(records, true, strategy, "aa:bb:cc:dd:ee:01")
+			if !errors.Is(err, ErrNoAvailableAddress) {
+				t.Errorf("DefaultMeshAddressing().SelectStaticIPWithStrategy() error = %v, want ErrNoAvailableAddress", err)
+			}
+		})
+	}
+}
+
+func TestSelectStaticIPWithStrategy_Unknown(t *testing.T) {
+	_, err := DefaultMeshAddressing().SelectStaticIPWithStrategy(nil, false, "lowest", "aa:bb:cc:dd:ee:01")
+	if !errors.Is(err, ErrValidation) {
+		t.Errorf("DefaultMeshAddressing().SelectStaticIPWithStrategy() error = %v, want ErrValidation", err)
+	}
+}
+
+func TestBlockPool(t *testing.T) {
+	pool, err := DefaultMeshAddressing().BlockPool("10.41.5.0/24")
+	if err != nil {
+		t.Fatalf("DefaultMeshAddressing().BlockPool() error = %v", err)
+	}
+	if pool.Size() != 254 || pool.At(0) != "10.41.5.1" || pool.At(253) != "10.41.5.254" || pool.String() != "10.41.5.0/24" {
+		t.Errorf("DefaultMeshAddressing().BlockPool() = %s of %d addresses from %s to %s", pool, pool.Size(), pool.At(0), pool.At(253))
+	}
+	if !pool.Contains("10.41.5.17") || pool.Contains("10.41.6.17") || pool.Contains("10.41.5.0") || pool.Contains("10.41.5.255") {
+		t.Error("Contains() does not match the block")
+	}
+
+	for _, block := range []string{"10.41.0.0/24", "10.41.253.0/24", "10.41.5.0/23", "10.42.5.0/24", "10.41.5.0"} {
+		if _, err := DefaultMeshAddressing().BlockPool(block); !errors.Is(err, ErrValidation) {
+			t.Errorf("DefaultMeshAddressing().BlockPool(%q) error = %v, want ErrValidation", block, err)
+		}
+	}
+}
+
+func TestAddressPool_Blocks(t *testing.T) {
+	blocks := DefaultMeshAddressing().StaticIPPool(false).Blocks()
+	if len(blocks) != 253 || blocks[0] != "10.41.1.0/24" || blocks[len(blocks)-1] != "10.41.255.0/24" {
+		t.Errorf("Blocks() = %d blocks from %s to %s", len(blocks), blocks[0], blocks[len(blocks)-1])
+	}
+}
+
+func TestSelectStaticIPWithStrategy_SkipsOffers(t *testing.T) {
+	records := []alfred.Record{
+		{Data: mustMarshalAddressReservation(&proto.AddressReservation{StaticIp: "10.41.0.1", Offers: []*proto.BlockOffer{{TargetMac: "aa:bb:cc:dd:ee:02", StaticIp: "10.41.1.1"}}})},
+		{Data: mustMarshalAddressReservation(&proto.AddressReservation{StaticIp: "10.41.1.2"})},
+	}
+
+	ip, err := DefaultMeshAddressing().SelectStaticIPWithStrategy(records, false, IPAllocationSequential, "aa:bb:cc:dd:ee:03")
+	if err != nil || ip != "10.41.1.3" {
+		t.Errorf("DefaultMeshAddressing().SelectStaticIPWithStrategy() = %s, %v, want 10.41.1.3", ip, err)
+	}
+}
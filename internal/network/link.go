@@ -0,0 +1,197 @@
+package network
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/openmanet/openmanetd/internal/safemode"
+	"github.com/vishvananda/netlink"
+)
+
+const (
+	// minLinkMTU is the smallest MTU accepted, the minimum IPv4 requires.
+	minLinkMTU = 68
+	// maxLinkMTU is the largest MTU accepted. The driver may allow less.
+	maxLinkMTU = 65535
+)
+
+// linkByName looks up the interface name for change, as safe mode reports it.
+func linkByName(name, change string) (netlink.Link, error) {
+	if name == "" {
+		return nil, newValidationError("interface name cannot be empty")
+	}
+
+	if err := safemode.Check(change); err != nil {
+		return nil, err
+	}
+
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		return nil, newInterfaceNotFoundError(name, err)
+	}
+
+	return link, nil
+}
+
+// LinkUp sets the interface name administratively up, as 'ip link set name up'
+// does. Bringing up an interface that is up already does nothing.
+//
+// Returns an ErrInterfaceNotFound error if there is no such interface.
+//
+// Example:
+//
+//	if err := LinkDown("mesh0"); err == nil {
+//	    err = LinkUp("mesh0")
+//	}
+//
+// Note: This operation requires appropriate privileges (typically root/CAP_NET_ADMIN).
+// netifd is not told and sets the interface up or down again on its next reload.
+func LinkUp(name string) error {
+	link, err := linkByName(name, fmt.Sprintf("set %s up", name))
+	if err != nil {
+		return err
+	}
+
+	if err := netlink.LinkSetUp(link); err != nil {
+		return fmt.Errorf("failed to set %s up: %w", name, err)
+	}
+
+	return nil
+}
+
+// LinkDown sets the interface name administratively down, as 'ip link set name
+// down' does. The kernel removes the routes through the interface.
+//
+// Returns an ErrInterfaceNotFound error if there is no such interface.
+//
+// Note: This operation requires appropriate privileges (typically root/CAP_NET_ADMIN).
+func LinkDown(name string) error {
+	link, err := linkByName(name, fmt.Sprintf("set %s down", name))
+	if err != nil {
+		return err
+	}
+
+	if err := netlink.LinkSetDown(link); err != nil {
+		return fmt.Errorf("failed to set %s down: %w", name, err)
+	}
+
+	return nil
+}
+
+// SetMTU sets the MTU of the interface name. A bridge cannot take an MTU larger than
+// that of its smallest port.
+//
+// Returns an ErrValidation error if mtu is out of range and an ErrInterfaceNotFound
+// error if there is no such interface.
+//
+// Example:
+//
+//	// batman-adv adds its header to every frame it sends over the mesh interface
+//	err := SetMTU("mesh0", 1532)
+//
+// Note: This operation requires appropriate privileges (typically root/CAP_NET_ADMIN).
+// netifd is not told and may restore the configured MTU on its next reload.
+func SetMTU(name string, mtu int) error {
+	if mtu < minLinkMTU || mtu > maxLinkMTU {
+		return newValidationError("MTU must be from %d to %d, got %d", minLinkMTU, maxLinkMTU, mtu)
+	}
+
+	link, err := linkByName(name, fmt.Sprintf("set MTU of %s to %d", name, mtu))
+	if err != nil {
+		return err
+	}
+	if link.Attrs().MTU == mtu {
+		return nil
+	}
+
+	if err := netlink.LinkSetMTU(link, mtu); err != nil {
+		return fmt.Errorf("failed to set MTU of %s to %d: %w", name, mtu, err)
+	}
+
+	return nil
+}
+
+// SetMACAddress sets the MAC address of the interface name to mac, e.g.
+// "02:00:00:00:00:01". Most drivers only change the address of an interface that is
+// down.
+//
+// Returns an ErrValidation error if mac is not a unicast Ethernet address and an
+// ErrInterfaceNotFound error if there is no such interface.
+//
+// Note: This operation requires appropriate privileges (typically root/CAP_NET_ADMIN).
+// netifd is not told and may restore the configured address on its next reload.
+func SetMACAddress(name, mac string) error {
+	hwAddr, err := net.ParseMAC(mac)
+	if err != nil || len(hwAddr) != 6 {
+		return newValidationError("invalid MAC address %q", mac)
+	}
+	if hwAddr[0]&1 != 0 || bytes.Equal(hwAddr, make(net.HardwareAddr, 6)) {
+		return newValidationError("MAC address %s is not a unicast address", hwAddr)
+	}
+
+	link, err := linkByName(name, fmt.Sprintf("set MAC address of %s to %s", name, hwAddr))
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(link.Attrs().HardwareAddr, hwAddr) {
+		return nil
+	}
+
+	if err := netlink.LinkSetHardwareAddr(link, hwAddr); err != nil {
+		return fmt.Errorf("failed to set MAC address of %s to %s: %w", name, hwAddr, err)
+	}
+
+	return nil
+}
+
+// validateLinkName checks that name is a name the kernel accepts for an interface.
+func validateLinkName(name string) error {
+	switch {
+	case name == "":
+		return newValidationError("interface name cannot be empty")
+	case len(name) > maxInterfaceNameLength:
+		return newValidationError("interface name %q is longer than %d characters", name, maxInterfaceNameLength)
+	case name == "." || name == "..":
+		return newValidationError("invalid interface name %q", name)
+	case strings.ContainsAny(name, "/: \t\n"):
+		return newValidationError("interface name %q cannot contain '/', ':' or whitespace", name)
+	}
+	return nil
+}
+
+// SetLinkName renames the interface name to newName. The kernel only renames an
+// interface that is down, so call LinkDown first.
+//
+// Returns an ErrValidation error if newName is not a valid interface name and an
+// ErrInterfaceNotFound error if there is no such interface.
+//
+// Example:
+//
+//	err := LinkDown("wlan1")
+//	if err == nil {
+//	    err = SetLinkName("wlan1", "mesh0")
+//	}
+//
+// Note: This operation requires appropriate privileges (typically root/CAP_NET_ADMIN).
+// Configuration that names the interface, such as that of netifd, is not updated.
+func SetLinkName(name, newName string) error {
+	if err := validateLinkName(newName); err != nil {
+		return err
+	}
+
+	link, err := linkByName(name, fmt.Sprintf("rename %s to %s", name, newName))
+	if err != nil {
+		return err
+	}
+	if name == newName {
+		return nil
+	}
+
+	if err := netlink.LinkSetName(link, newName); err != nil {
+		return fmt.Errorf("failed to rename %s to %s: %w", name, newName, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package network
+
+import (
+	"fmt"
+
+	"github.com/vishvananda/netlink"
+)
+
+// LinkStatistics are the traffic counters of a network interface since it was
+// created, as 'ip -s link' shows them.
+//
+// Fields:
+//   - RxBytes, TxBytes: The bytes received and sent.
+//   - RxPackets, TxPackets: The packets received and sent.
+//   - RxErrors, TxErrors: The packets that could not be received or sent because of
+//     an error, e.g. a bad checksum or a carrier loss.
+//   - RxDropped, TxDropped: The packets that were dropped although they had no
+//     error, e.g. for lack of buffer space.
+type LinkStatistics struct {
+	RxBytes   uint64
+	RxPackets uint64
+	RxErrors  uint64
+	RxDropped uint64
+	TxBytes   uint64
+	TxPackets uint64
+	TxErrors  uint64
+	TxDropped uint64
+}
+
+// linkGet is overridable for tests.
+var linkGet = netlink.LinkByName
+
+// GetLinkStatistics returns the traffic counters of the interface iface, read over
+// netlink rather than parsed from /proc/net/dev. The counters are 64 bits wide and
+// only reset when the interface is recreated, so the rate between two calls is the
+// difference of their values.
+//
+// Returns an ErrInterfaceNotFound error if there is no such interface.
+//
+// Example:
+//
+//	before, _ := GetLinkStatistics("bat0")
+//	time.Sleep(10 * time.Second)
+//	after, err := GetLinkStatistics("bat0")
+//	if err == nil {
+//	    fmt.Printf("tx %d bytes/s\n", (after.TxBytes-before.TxBytes)/10)
+//	}
+func GetLinkStatistics(iface string) (*LinkStatistics, error) {
+	if iface == "" {
+		return nil, newValidationError("interface name cannot be empty")
+	}
+
+	link, err := linkGet(iface)
+	if err != nil {
+		return nil, newInterfaceNotFoundError(iface, err)
+	}
+
+	s := link.Attrs().Statistics
+	if s == nil {
+		return nil, fmt.Errorf("no statistics reported for %s", iface)
+	}
+
+	return &LinkStatistics{
+		RxBytes:   s.RxBytes,
+		RxPackets: s.RxPackets,
+		RxErrors:  s.RxErrors,
+		RxDropped: s.RxDropped,
+		TxBytes:   s.TxBytes,
+		TxPackets: s.TxPackets,
+		TxErrors:  s.TxErrors,
+		TxDropped: s.TxDropped,
+	}, nil
+}
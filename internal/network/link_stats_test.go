@@ -0,0 +1,45 @@
+package network
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+func TestGetLinkStatistics(t *testing.T) {
+	old := linkGet
+	t.Cleanup(func() { linkGet = old })
+
+	linkGet = func(name string) (netlink.Link, error) {
+		switch name {
+		case "bat0":
+			return &netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: name, Statistics: &netlink.LinkStatistics{
+				RxBytes: 1500, RxPackets: 3, RxErrors: 1, RxDropped: 2,
+				TxBytes: 3000, TxPackets: 5, TxErrors: 4, TxDropped: 6,
+			}}}, nil
+		case "nostats":
+			return &netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: name}}, nil
+		}
+		return nil, errors.New("Link not found")
+	}
+
+	stats, err := GetLinkStatistics("bat0")
+	if err != nil {
+		t.Fatalf("GetLinkStatistics() error = %v", err)
+	}
+	want := LinkStatistics{RxBytes: 1500, RxPackets: 3, RxErrors: 1, RxDropped: 2, TxBytes: 3000, TxPackets: 5, TxErrors: 4, TxDropped: 6}
+	if *stats != want {
+		t.Errorf("GetLinkStatistics() = %+v, want %+v", *stats, want)
+	}
+
+	if _, err := GetLinkStatistics("nostats"); err == nil {
+		t.Error("GetLinkStatistics() succeeded without statistics")
+	}
+	if _, err := GetLinkStatistics("mesh9"); !errors.Is(err, ErrInterfaceNotFound) {
+		t.Errorf("GetLinkStatistics() error = %v, want ErrInterfaceNotFound", err)
+	}
+	if _, err := GetLinkStatistics(""); !errors.Is(err, ErrValidation) {
+		t.Errorf("GetLinkStatistics(\"\") error = %v, want ErrValidation", err)
+	}
+}
@@ -0,0 +1,59 @@
+package network
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLinkFunctions_Validation(t *testing.T) {
+	tests := []struct {
+		name string
+		op   func() error
+	}{
+		{"up without name", func() error { return LinkUp("") }},
+		{"down without name", func() error { return LinkDown("") }},
+		{"MTU too small", func() error { return SetMTU("lo", 67) }},
+		{"MTU too large", func() error { return SetMTU("lo", 65536) }},
+		{"invalid MAC", func() error { return SetMACAddress("lo", "02:00:00:00:00") }},
+		{"EUI-64", func() error { return SetMACAddress("lo", "02:00:00:00:00:00:00:01") }},
+		{"multicast MAC", func() error { return SetMACAddress("lo", "01:00:5e:00:00:01") }},
+		{"zero MAC", func() error { return SetMACAddress("lo", "00:00:00:00:00:00") }},
+		{"empty new name", func() error { return SetLinkName("lo", "") }},
+		{"long new name", func() error { return SetLinkName("lo", "abcdefghijklmnop") }},
+		{"dot", func() error { return SetLinkName("lo", "..") }},
+		{"slash", func() error { return SetLinkName("lo", "mesh/0") }},
+		{"colon", func() error { return SetLinkName("lo", "mesh:0") }},
+		{"space", func() error { return SetLinkName("lo", "mesh 0") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.op(); !errors.Is(err, ErrValidation) {
+				t.Errorf("error = %v, want ErrValidation", err)
+			}
+		})
+	}
+}
+
+func TestLinkFunctions_InterfaceNotFound(t *testing.T) {
+	const missing = "omtest-missing"
+
+	tests := []struct {
+		name string
+		op   func() error
+	}{
+		{"up", func() error { return LinkUp(missing) }},
+		{"down", func() error { return LinkDown(missing) }},
+		{"MTU", func() error { return SetMTU(missing, 1500) }},
+		{"MAC", func() error { return SetMACAddress(missing, "02:00:00:00:00:01") }},
+		{"rename", func() error { return SetLinkName(missing, "mesh0") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.op(); !errors.Is(err, ErrInterfaceNotFound) {
+				t.Errorf("error = %v, want ErrInterfaceNotFound", err)
+			}
+		})
+	}
+}
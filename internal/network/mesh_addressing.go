@@ -0,0 +1,318 @@
+package network
+
+import (
+	"encoding/binary"
+	"net"
+	"slices"
+
+	"github.com/openmanet/go-alfred"
+)
+
+// DefaultMeshExcludedRanges are the ranges of the default mesh subnet that static
+// addresses are never selected from or pinned to.
+var DefaultMeshExcludedRanges = []string{"10.41.253.0/24", "10.41.254.0/24"}
+
+// Bounds of the mesh subnet prefix length. The subnet holds at least the gateway /24
+// and one /24 for the other nodes.
+const (
+	minMeshPrefixLen = 8
+	maxMeshPrefixLen = 23
+)
+
+// MeshAddressing is the IPv4 addressing plan of the mesh: the subnet addresses are
+// reserved from, and the ranges of it that are left to other uses.
+//
+// Gateways claim from the first /24 of the subnet. Other nodes claim from the
+// remaining /24 blocks, leaving out every block that overlaps an excluded range.
+// The zero value is not usable; see DefaultMeshAddressing and NewMeshAddressing.
+type MeshAddressing struct {
+	// Subnet is the mesh subnet, a /8 to /23 IPv4 network.
+	Subnet *net.IPNet
+	// Excluded are ranges of Subnet that are never handed out as static addresses.
+	Excluded []*net.IPNet
+}
+
+// DefaultMeshAddressing returns the addressing of a node with the default
+// configuration: 10.41.0.0/16, without 10.41.253.0/24 and 10.41.254.0/24.
+func DefaultMeshAddressing() MeshAddressing {
+	m, _ := NewMeshAddressing(DefaultNetworkAddress+"/16", DefaultMeshExcludedRanges)
+	return m
+}
+
+// NewMeshAddressing returns the addressing of the mesh subnet in CIDR notation, such
+// as "172.16.0.0/12", without the excluded ranges.
+//
+// Returns an ErrValidation error if subnet is not an IPv4 network address with a
+// prefix between /8 and /23, if an excluded range is not inside subnet or covers its
+// gateway range, or if no range is left for the other nodes.
+//
+// Example:
+//
+//	addressing, err := NewMeshAddressing("172.16.0.0/12", []string{"172.31.0.0/16"})
+func NewMeshAddressing(subnet string, excluded []string) (MeshAddressing, error) {
+	ip, ipNet, err := net.ParseCIDR(subnet)
+	if err != nil || ip.To4() == nil {
+		return MeshAddressing{}, newValidationError("mesh subnet %q is not an IPv4 CIDR", subnet)
+	}
+	if !ip.Equal(ipNet.IP) {
+		return MeshAddressing{}, newValidationError("mesh subnet %q is not a network address, did you mean %s?", subnet, ipNet)
+	}
+	ones, _ := ipNet.Mask.Size()
+	if ones < minMeshPrefixLen || ones > maxMeshPrefixLen {
+		return MeshAddressing{}, newValidationError("mesh subnet %s must be a /%d to /%d", ipNet, minMeshPrefixLen, maxMeshPrefixLen)
+	}
+
+	m := MeshAddressing{Subnet: &net.IPNet{IP: ipNet.IP.To4(), Mask: ipNet.Mask}}
+	for _, r := range excluded {
+		exIP, exNet, err := net.ParseCIDR(r)
+		if err != nil || exIP.To4() == nil {
+			return MeshAddressing{}, newValidationError("excluded range %q is not an IPv4 CIDR", r)
+		}
+		exOnes, _ := exNet.Mask.Size()
+		if exOnes < ones || !m.Subnet.Contains(exNet.IP) {
+			return MeshAddressing{}, newValidationError("excluded range %s is not inside the mesh subnet %s", exNet, m.Subnet)
+		}
+		exNet.IP = exNet.IP.To4()
+		m.Excluded = append(m.Excluded, exNet)
+	}
+
+	if m.excludes(m.firstBlock()) {
+		return MeshAddressing{}, newValidationError("excluded ranges cover the gateway range %s", m.StaticIPPool(true))
+	}
+	if m.StaticIPPool(false).Size() == 0 {
+		return MeshAddressing{}, newValidationError("excluded ranges leave no addresses for nodes in %s", m.Subnet)
+	}
+
+	return m, nil
+}
+
+// NetworkAddress returns the network address of the subnet, e.g. "10.41.0.0".
+func (m MeshAddressing) NetworkAddress() string {
+	return m.Subnet.IP.String()
+}
+
+// Netmask returns the dotted netmask of the subnet, e.g. "255.255.0.0".
+func (m MeshAddressing) Netmask() string {
+	return net.IP(m.Subnet.Mask).String()
+}
+
+// firstBlock returns the first /24 of the subnet, the gateway range.
+func (m MeshAddressing) firstBlock() uint32 {
+	return ipToUint32(m.Subnet.IP)
+}
+
+// blockCount returns the number of /24 blocks in the subnet.
+func (m MeshAddressing) blockCount() int {
+	ones, _ := m.Subnet.Mask.Size()
+	return 1 << (24 - ones)
+}
+
+// excludes reports whether the /24 block starting at base overlaps an excluded range.
+func (m MeshAddressing) excludes(base uint32) bool {
+	for _, r := range m.Excluded {
+		start := ipToUint32(r.IP)
+		ones, _ := r.Mask.Size()
+		end := start | (1<<(32-ones) - 1)
+		if start <= base|0xff && end >= base {
+			return true
+		}
+	}
+	return false
+}
+
+// StaticIPPool returns the pool for a gateway or a regular node.
+func (m MeshAddressing) StaticIPPool(gatewayMode bool) AddressPool {
+	first := m.firstBlock()
+	if gatewayMode {
+		return AddressPool{blocks: []uint32{first}, name: blockName(first)}
+	}
+
+	blocks := make([]uint32, 0, m.blockCount()-1)
+	for i := 1; i < m.blockCount(); i++ {
+		if base := first + uint32(i)<<8; !m.excludes(base) {
+			blocks = append(blocks, base)
+		}
+	}
+
+	return AddressPool{blocks: blocks, name: m.Subnet.String()}
+}
+
+// BlockPool returns the pool of one /24 block of the node pool, as handed out by a
+// block owner in delegated allocation mode.
+//
+// Returns an ErrValidation error if block is not a /24 of the node pool.
+func (m MeshAddressing) BlockPool(block string) (AddressPool, error) {
+	ip, subnet, err := net.ParseCIDR(block)
+	if err != nil {
+		return AddressPool{}, newValidationError("invalid address block %q", block)
+	}
+
+	ones, _ := subnet.Mask.Size()
+	addr := ip.To4()
+	if addr == nil || ones != 24 || !m.StaticIPPool(false).hasBlock(ipToUint32(addr)) {
+		return AddressPool{}, newValidationError("address block %q is not a /24 of the %s node pool", block, m.Subnet)
+	}
+
+	return AddressPool{blocks: []uint32{ipToUint32(addr)}, name: subnet.String()}, nil
+}
+
+// ValidatePinnedIP checks that ip can be used as a pinned static IP.
+//
+// The address must be an IPv4 host address inside the subnet and outside the
+// excluded ranges, which are never handed out by SelectAvailableStaticIP.
+//
+// Returns an ErrValidation error describing why the address was rejected, or nil.
+//
+// Example:
+//
+//	if err := addressing.ValidatePinnedIP("10.41.2.10"); err != nil {
+//	    log.Fatalf("Invalid pin: %v", err)
+//	}
+func (m MeshAddressing) ValidatePinnedIP(ip string) error {
+	addr := net.ParseIP(ip).To4()
+	if addr == nil {
+		return newValidationError("pinned IP %q is not an IPv4 address", ip)
+	}
+
+	if !m.Subnet.Contains(addr) {
+		return newValidationError("pinned IP %s is outside the mesh subnet %s", ip, m.Subnet)
+	}
+
+	ones, _ := m.Subnet.Mask.Size()
+	broadcast := m.firstBlock() | (1<<(32-ones) - 1)
+	if n := ipToUint32(addr); n == m.firstBlock() || n == broadcast {
+		return newValidationError("pinned IP %s is not a host address", ip)
+	}
+
+	for _, r := range m.Excluded {
+		if r.Contains(addr) {
+			return newValidationError("pinned IP %s is in the reserved range %s", ip, r)
+		}
+	}
+
+	return nil
+}
+
+// SelectAvailableStaticIP selects a static IP of the gateway or node pool that none
+// of the records reserve.
+//
+// Parameters:
+//   - records: Array of Alfred records containing address reservations
+//   - gatewayMode: If true, selects from the first /24 of the subnet only. If false
+//     (default), selects from the rest of the subnet
+//
+// Returns:
+//   - An available IP address from the specified pool
+//   - An error if no available IP can be found
+//
+// The function excludes:
+//   - Already reserved IP addresses (from StaticIp field in AddressReservation)
+//   - The first /24 of the subnet (when gatewayMode is false)
+//   - The excluded ranges (when gatewayMode is false)
+//   - The network and broadcast address of every /24
+//
+// Example:
+//
+//	records := []alfred.Record{ /* ... */ }
+//	ip, err := addressing.SelectAvailableStaticIP(records, false)
+//	if err != nil {
+//	    log.Fatalf("Failed to select IP: %v", err)
+//	}
+//	fmt.Printf("Selected IP: %s\n", ip)
+func (m MeshAddressing) SelectAvailableStaticIP(records []alfred.Record, gatewayMode bool) (string, error) {
+	return m.selectStaticIP(reservedStaticIPs(records), len(records), gatewayMode)
+}
+
+// selectStaticIP sequentially selects a static IP that is not reserved, or a random
+// one while there are too few records for the sequence to be agreed on.
+func (m MeshAddressing) selectStaticIP(reserved map[string]bool, records int, gatewayMode bool) (string, error) {
+	pool := m.StaticIPPool(gatewayMode)
+
+	// Normal mode: If there are 1 or fewer records, select a random IP to avoid conflicts
+	// when multiple nodes start simultaneously
+	if !gatewayMode && records <= 1 {
+		if ip, err := (RandomAllocator{}).Allocate(pool, reserved); err == nil {
+			return ip, nil
+		}
+	}
+
+	return SequentialAllocator{}.Allocate(pool, reserved)
+}
+
+// SelectStaticIPWithStrategy selects a static IP that none of the records reserve,
+// using the named allocation strategy.
+//
+// IPAllocationSequential behaves exactly like SelectAvailableStaticIP.
+//
+// Parameters:
+//   - records: Array of Alfred records containing address reservations
+//   - gatewayMode: Selects from the gateway pool instead of the node pool
+//   - strategy: One of IPAllocationSequential, IPAllocationRandom or IPAllocationMACHash
+//   - mac: This node's MAC, used by IPAllocationMACHash
+//
+// Returns:
+//   - An available IP address
+//   - An ErrValidation error for an unknown strategy, or an error wrapping
+//     ErrNoAvailableAddress if the pool is full
+//
+// Example:
+//
+//	ip, err := addressing.SelectStaticIPWithStrategy(records, false, IPAllocationMACHash, iface.MAC)
+func (m MeshAddressing) SelectStaticIPWithStrategy(records []alfred.Record, gatewayMode bool, strategy, mac string) (string, error) {
+	return m.SelectStaticIPExcluding(records, nil, gatewayMode, strategy, mac)
+}
+
+// SelectStaticIPExcluding selects a static IP that none of the records reserve and
+// that is not in inUse, using the named allocation strategy. inUse holds addresses
+// that are taken without a reservation, such as those of active DHCP leases.
+//
+// Example:
+//
+//	leases, _ := ReadDnsmasqLeases(DefaultDnsmasqLeasesPath)
+//	var inUse []string
+//	for _, lease := range ActiveLeases(leases, time.Now()) {
+//	    inUse = append(inUse, lease.IP.String())
+//	}
+//	ip, err := addressing.SelectStaticIPExcluding(records, inUse, false, IPAllocationSequential, mac)
+func (m MeshAddressing) SelectStaticIPExcluding(records []alfred.Record, inUse []string, gatewayMode bool, strategy, mac string) (string, error) {
+	reserved := reservedStaticIPs(records)
+	for _, ip := range inUse {
+		reserved[ip] = true
+	}
+
+	if strategy == "" || strategy == IPAllocationSequential {
+		return m.selectStaticIP(reserved, len(records), gatewayMode)
+	}
+
+	allocator, err := NewIPAllocator(strategy, mac)
+	if err != nil {
+		return "", err
+	}
+
+	return allocator.Allocate(m.StaticIPPool(gatewayMode), reserved)
+}
+
+// SelectStaticIPWithAllocator selects a static IP that none of the records reserve
+// using allocator.
+func (m MeshAddressing) SelectStaticIPWithAllocator(records []alfred.Record, gatewayMode bool, allocator IPAllocator) (string, error) {
+	return allocator.Allocate(m.StaticIPPool(gatewayMode), reservedStaticIPs(records))
+}
+
+// hasBlock reports whether the /24 block starting at base is part of the pool.
+func (p AddressPool) hasBlock(base uint32) bool {
+	_, found := slices.BinarySearch(p.blocks, base)
+	return found
+}
+
+func ipToUint32(ip net.IP) uint32 {
+	return binary.BigEndian.Uint32(ip.To4())
+}
+
+func uint32ToIP(n uint32) net.IP {
+	return binary.BigEndian.AppendUint32(nil, n)
+}
+
+// blockName returns the /24 block starting at base in CIDR notation.
+func blockName(base uint32) string {
+	return uint32ToIP(base).String() + "/24"
+}
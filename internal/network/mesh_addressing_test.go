@@ -0,0 +1,142 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/openmanet/go-alfred"
+	proto "github.com/openmanet/openmanetd/internal/api/openmanet/v1"
+)
+
+func TestNewMeshAddressing_Invalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		subnet   string
+		excluded []string
+	}{
+		{"no prefix", "10.41.0.0", nil},
+		{"IPv6", "fd01:ed20:ecb4::/48", nil},
+		{"host bits set", "10.41.1.0/16", nil},
+		{"prefix too short", "10.0.0.0/7", nil},
+		{"prefix too long", "10.41.0.0/24", nil},
+		{"excluded not a CIDR", "10.41.0.0/16", []string{"10.41.253.0"}},
+		{"excluded outside subnet", "10.41.0.0/16", []string{"10.42.253.0/24"}},
+		{"excluded larger than subnet", "10.41.0.0/16", []string{"10.40.0.0/15"}},
+		{"excluded gateway range", "10.41.0.0/16", []string{"10.41.0.128/25"}},
+		{"no node range left", "10.41.0.0/23", []string{"10.41.1.0/24"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewMeshAddressing(tt.subnet, tt.excluded); !errors.Is(err, ErrValidation) {
+				t.Errorf("NewMeshAddressing(%q, %v) error = %v, want ErrValidation", tt.subnet, tt.excluded, err)
+			}
+		})
+	}
+}
+
+func TestDefaultMeshAddressing(t *testing.T) {
+	m := DefaultMeshAddressing()
+	if m.NetworkAddress() != DefaultNetworkAddress || m.Netmask() != DefaultNetworkMask {
+		t.Errorf("DefaultMeshAddressing() = %s/%s, want %s/%s", m.NetworkAddress(), m.Netmask(), DefaultNetworkAddress, DefaultNetworkMask)
+	}
+	if m.Subnet.String() != MeshSubnet().String() {
+		t.Errorf("DefaultMeshAddressing().Subnet = %s, want %s", m.Subnet, MeshSubnet())
+	}
+}
+
+func TestMeshAddressing_OtherSubnet(t *testing.T) {
+	m, err := NewMeshAddressing("172.16.0.0/12", []string{"172.31.0.0/16"})
+	if err != nil {
+		t.Fatalf("NewMeshAddressing() error = %v", err)
+	}
+	if m.NetworkAddress() != "172.16.0.0" || m.Netmask() != "255.240.0.0" {
+		t.Errorf("subnet = %s/%s, want 172.16.0.0/255.240.0.0", m.NetworkAddress(), m.Netmask())
+	}
+
+	gateways := m.StaticIPPool(true)
+	if gateways.String() != "172.16.0.0/24" || gateways.Size() != 254 || gateways.At(0) != "172.16.0.1" {
+		t.Errorf("gateway pool = %s of %d addresses from %s", gateways, gateways.Size(), gateways.At(0))
+	}
+
+	nodes := m.StaticIPPool(false)
+	if want := (4096 - 1 - 256) * 254; nodes.Size() != want {
+		t.Errorf("node pool size = %d, want %d", nodes.Size(), want)
+	}
+	if first, last := nodes.At(0), nodes.At(nodes.Size()-1); first != "172.16.1.1" || last != "172.30.255.254" {
+		t.Errorf("node pool = %s to %s, want 172.16.1.1 to 172.30.255.254", first, last)
+	}
+	for ip, want := range map[string]bool{
+		"172.20.7.9":  true,
+		"172.16.0.9":  false,
+		"172.31.0.9":  false,
+		"172.20.7.0":  false,
+		"10.41.1.1":   false,
+		"172.32.0.10": false,
+	} {
+		if got := nodes.Contains(ip); got != want {
+			t.Errorf("node pool Contains(%s) = %v, want %v", ip, got, want)
+		}
+	}
+
+	if pool, err := m.BlockPool("172.20.3.0/24"); err != nil || pool.At(0) != "172.20.3.1" {
+		t.Errorf("BlockPool(172.20.3.0/24) = %s, %v", pool, err)
+	}
+	for _, block := range []string{"172.16.0.0/24", "172.31.3.0/24", "10.41.5.0/24"} {
+		if _, err := m.BlockPool(block); !errors.Is(err, ErrValidation) {
+			t.Errorf("BlockPool(%q) error = %v, want ErrValidation", block, err)
+		}
+	}
+
+	for ip, valid := range map[string]bool{
+		"172.20.1.1":     true,
+		"172.16.0.5":     true,
+		"172.16.0.0":     false,
+		"172.31.0.5":     false,
+		"172.31.255.255": false,
+		"10.41.2.10":     false,
+	} {
+		if err := m.ValidatePinnedIP(ip); (err == nil) != valid {
+			t.Errorf("ValidatePinnedIP(%s) error = %v, want valid %v", ip, err, valid)
+		}
+	}
+
+	records := []alfred.Record{
+		{Data: mustMarshalAddressReservation(&proto.AddressReservation{StaticIp: "172.16.0.1"})},
+		{Data: mustMarshalAddressReservation(&proto.AddressReservation{StaticIp: "172.16.1.1"})},
+	}
+	if ip, err := m.SelectAvailableStaticIP(records, false); err != nil || ip != "172.16.1.2" {
+		t.Errorf("SelectAvailableStaticIP() = %s, %v, want 172.16.1.2", ip, err)
+	}
+	if ip, err := m.SelectStaticIPWithStrategy(records, true, IPAllocationSequential, ""); err != nil || ip != "172.16.0.2" {
+		t.Errorf("SelectStaticIPWithStrategy(gateway) = %s, %v, want 172.16.0.2", ip, err)
+	}
+}
+
+func TestMeshAddressing_SelectStaticIPExcluding(t *testing.T) {
+	addressing := DefaultMeshAddressing()
+	records := []alfred.Record{
+		{Data: mustMarshalAddressReservation(&proto.AddressReservation{StaticIp: "10.41.0.1"})},
+		{Data: mustMarshalAddressReservation(&proto.AddressReservation{StaticIp: "10.41.0.2"})},
+	}
+
+	ip, err := addressing.SelectStaticIPExcluding(records, []string{"10.41.0.3", "10.41.0.5"}, true, IPAllocationSequential, "")
+	if err != nil || ip != "10.41.0.4" {
+		t.Errorf("SelectStaticIPExcluding() = %s, %v, want 10.41.0.4", ip, err)
+	}
+
+	// Leased addresses are skipped by every strategy
+	var inUse []string
+	for fourth := 1; fourth < 255; fourth++ {
+		if fourth != 200 {
+			inUse = append(inUse, fmt.Sprintf("10.41.0.%d", fourth))
+		}
+	}
+	for _, strategy := range []string{IPAllocationSequential, IPAllocationRandom, IPAllocationMACHash} {
+		ip, err := addressing.SelectStaticIPExcluding(nil, inUse, true, strategy, "aa:bb:cc:dd:ee:01")
+		if err != nil || ip != "10.41.0.200" {
+			t.Errorf("SelectStaticIPExcluding(%s) = %s, %v, want 10.41.0.200", strategy, ip, err)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package network
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/digineo/go-uci/v2"
+)
+
+/*
+config wifi-iface 'mesh0'
+	option device 'radio0'
+	option network 'mesh0'
+	option ifname 'mesh0'
+	option mode 'mesh'
+	option mesh_id 'openmanet'
+	option mesh_fwding '0'
+	option encryption 'sae'
+	option key 'secret'
+*/
+
+const (
+	// wifiIfaceSectionType is the type of the sections of the wireless config that
+	// define a wireless interface on a radio.
+	wifiIfaceSectionType string = "wifi-iface"
+
+	// meshWifiMode is the wifi-iface mode of an 802.11s mesh point.
+	meshWifiMode string = "mesh"
+
+	// maxMeshIDLength is the longest mesh ID 802.11s allows, in bytes.
+	maxMeshIDLength = 32
+
+	// maxInterfaceNameLength is the longest name the kernel gives a network device.
+	maxInterfaceNameLength = 15
+)
+
+// Defaults of ProvisionMeshRadio.
+const (
+	DefaultMeshInterface    string = "mesh0"
+	DefaultMeshBatInterface string = "bat0"
+)
+
+// MeshRadioConfig describes the 802.11s mesh point ProvisionMeshRadio sets up on a
+// radio.
+type MeshRadioConfig struct {
+	// Device is the wifi-device section of the radio, e.g. "radio0".
+	Device string
+	// MeshID is the 802.11s mesh ID every node of the mesh shares.
+	MeshID string
+	// Channel is a channel number or WirelessChannelAuto; empty leaves the channel
+	// of the radio as it is. Every node of the mesh must use the same channel.
+	Channel string
+	// Key is the SAE password of the mesh; empty makes an open mesh.
+	Key string
+	// Interface names the wifi-iface section, the network interface section that
+	// attaches it to batman-adv and the kernel device. Defaults to
+	// DefaultMeshInterface.
+	Interface string
+	// BatInterface is the batman-adv mesh interface, created if it does not exist.
+	// Defaults to DefaultMeshBatInterface.
+	BatInterface string
+	// Bridge, if set, is the bridge device the batman-adv mesh interface is added
+	// to as a port, e.g. "br-ahwlan". The bridge must exist.
+	Bridge string
+}
+
+// validateMeshRadioConfig checks config and fills in its defaults.
+func validateMeshRadioConfig(config *MeshRadioConfig) error {
+	if config.Interface == "" {
+		config.Interface = DefaultMeshInterface
+	}
+	if config.BatInterface == "" {
+		config.BatInterface = DefaultMeshBatInterface
+	}
+
+	switch {
+	case config.Device == "":
+		return newValidationError("wireless device cannot be empty")
+	case config.MeshID == "":
+		return newValidationError("mesh ID cannot be empty")
+	case len(config.MeshID) > maxMeshIDLength:
+		return newValidationError("mesh ID must be at most %d bytes, got %d", maxMeshIDLength, len(config.MeshID))
+	case config.Key != "" && (len(config.Key) < 8 || len(config.Key) > 63):
+		return newValidationError("mesh key must be 8 to 63 characters")
+	}
+
+	for _, name := range []string{config.Interface, config.BatInterface} {
+		if len(name) > maxInterfaceNameLength || deviceSectionName(name) != name {
+			return newValidationError("invalid interface name %q: must be at most %d letters, digits or underscores", name, maxInterfaceNameLength)
+		}
+	}
+	if config.Interface == config.BatInterface {
+		return newValidationError("mesh interface and batman-adv interface cannot both be %q", config.Interface)
+	}
+
+	return nil
+}
+
+// ProvisionMeshRadio sets up an 802.11s mesh point on a radio and attaches it to
+// batman-adv, so that a node booted from a factory image joins the mesh in one
+// call. In the wireless config it enables the radio, tunes it to config.Channel and
+// adds a mesh wifi-iface, with forwarding left to batman-adv. In the network config
+// it adds the batman-adv mesh interface, if missing, and the batadv_hardif interface
+// the wifi-iface belongs to, and adds the mesh interface to config.Bridge.
+//
+// Existing sections are updated in place, so provisioning again with the same
+// config changes nothing. Every change is staged before anything is committed, so a
+// config that cannot be applied changes nothing; each config is then committed
+// once.
+//
+// Returns true if anything changed. Returns an ErrSectionNotFound error if there is
+// no such radio or bridge, an ErrInvalidOption error if the channel is invalid, and
+// an ErrValidation error for other invalid values, or if a section of one of the
+// interfaces exists as something else; such a section is never converted.
+//
+// Example:
+//
+//	changed, err := ProvisionMeshRadio(&MeshRadioConfig{
+//	    Device:  "radio0",
+//	    MeshID:  "openmanet",
+//	    Channel: "36",
+//	    Key:     "correct horse battery",
+//	    Bridge:  "br-ahwlan",
+//	})
+//	if err == nil && changed {
+//	    err = ReloadNetwork()
+//	}
+//
+// Note: This operation requires appropriate privileges and commits the
+// configuration. The network must be reloaded for it to take effect.
+func ProvisionMeshRadio(config *MeshRadioConfig) (bool, error) {
+	return ProvisionMeshRadioWithReaders(config, NewUCINetworkConfigReader(), NewUCIWirelessConfigReader())
+}
+
+// ProvisionMeshRadioWithReaders sets up a mesh point using the provided network and
+// wireless readers.
+func ProvisionMeshRadioWithReaders(config *MeshRadioConfig, networkReader DeviceConfigReader, wirelessReader WirelessConfigReader) (bool, error) {
+	if config == nil {
+		return false, newValidationError("config cannot be nil")
+	}
+	cfg := *config
+	if err := validateMeshRadioConfig(&cfg); err != nil {
+		return false, err
+	}
+
+	netTx := NewTransaction(networkConfigName, networkReader)
+	wifiTx := NewTransaction(wirelessConfigName, wirelessReader)
+	txs := []*Transaction{netTx, wifiTx}
+
+	if err := stageMeshRadio(&cfg, netTx, wifiTx); err != nil {
+		for _, tx := range txs {
+			_ = tx.Discard()
+		}
+		return false, err
+	}
+
+	changed := false
+	for _, tx := range txs {
+		applied, err := tx.Apply()
+		if err != nil {
+			return changed, err
+		}
+		changed = changed || applied
+	}
+
+	return changed, nil
+}
+
+// stageMeshRadio stages the mesh point of config through the network and wireless
+// transactions.
+func stageMeshRadio(config *MeshRadioConfig, netTx, wifiTx *Transaction) error {
+	if _, err := SetBatadvInterfaceWithReader(config.BatInterface, &UCIBatadv{}, netTx); err != nil {
+		return err
+	}
+	if _, err := SetBatadvHardifWithReader(config.Interface, &UCIBatadvHardif{Master: config.BatInterface}, netTx); err != nil {
+		return err
+	}
+	if config.Bridge != "" {
+		if _, err := AddBridgePortWithReader(config.Bridge, config.BatInterface, netTx); err != nil {
+			return err
+		}
+	}
+
+	if _, err := setWifiDeviceOption(wifiTx, config.Device, "disabled", ""); err != nil {
+		return err
+	}
+	if config.Channel != "" {
+		if _, err := SetWirelessChannelWithReader(config.Device, config.Channel, wifiTx); err != nil {
+			return err
+		}
+	}
+
+	return stageMeshWifiIface(config, wifiTx)
+}
+
+// stageMeshWifiIface adds or updates the mesh wifi-iface of config.
+func stageMeshWifiIface(config *MeshRadioConfig, reader WirelessConfigReader) error {
+	section := config.Interface
+
+	sections, err := reader.GetSections(wirelessConfigName, wifiIfaceSectionType)
+	if err != nil {
+		return fmt.Errorf("failed to read wifi interfaces: %w", err)
+	}
+	if slices.Contains(sections, section) {
+		if mode := wirelessOption(reader, section, "mode"); mode != meshWifiMode {
+			return newValidationError("wifi interface %q is mode %s, not %s", section, mode, meshWifiMode)
+		}
+	} else if err := reader.AddSection(wirelessConfigName, section, wifiIfaceSectionType); err != nil {
+		return newSectionError("add", wirelessConfigName, section, err)
+	}
+
+	encryption := "sae"
+	if config.Key == "" {
+		encryption = "none"
+	}
+
+	if _, err := setOptionsIfChanged(reader, wirelessConfigName, section, []uciOption{
+		{name: "device", typ: uci.TypeOption, value: config.Device},
+		{name: "network", typ: uci.TypeOption, value: config.Interface},
+		{name: "ifname", typ: uci.TypeOption, value: config.Interface},
+		{name: "mode", typ: uci.TypeOption, value: meshWifiMode},
+		{name: "mesh_id", typ: uci.TypeOption, value: config.MeshID},
+		// batman-adv forwards the traffic of the mesh, not 802.11s
+		{name: "mesh_fwding", typ: uci.TypeOption, value: "0"},
+		{name: "encryption", typ: uci.TypeOption, value: encryption},
+		{name: "key", typ: uci.TypeOption, value: config.Key},
+	}); err != nil {
+		return err
+	}
+
+	if config.Key == "" && wirelessOption(reader, section, "key") != "" {
+		if err := reader.Del(wirelessConfigName, section, "key"); err != nil {
+			return newSetOptionError(wirelessConfigName, section, "key", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,190 @@
+package network
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/digineo/go-uci/v2"
+)
+
+const testProvisionNetworkConfig = `
+config device
+	option name 'br-ahwlan'
+	option type 'bridge'
+	list ports 'eth0'
+
+config interface 'ahwlan'
+	option device 'br-ahwlan'
+	option proto 'static'
+	option ipaddr '10.41.1.5'
+`
+
+const testProvisionWirelessConfig = `
+config wifi-device 'radio0'
+	option type 'mac80211'
+	option band '5g'
+	option channel '36'
+	option disabled '1'
+
+config wifi-iface 'default_radio0'
+	option device 'radio0'
+	option mode 'ap'
+	option ssid 'OpenWrt'
+`
+
+func newTestProvisionReaders(t *testing.T) (*UCINetworkConfigReader, *UCIWirelessConfigReader, string) {
+	t.Helper()
+
+	dir := writeTestConfigs(t, map[string]string{
+		"network":  testProvisionNetworkConfig,
+		"wireless": testProvisionWirelessConfig,
+	})
+	return NewUCINetworkConfigReaderWithTree(uci.NewTree(dir)), NewUCIWirelessConfigReaderWithTree(uci.NewTree(dir)), dir
+}
+
+func TestProvisionMeshRadioWithReaders(t *testing.T) {
+	networkReader, wirelessReader, dir := newTestProvisionReaders(t)
+
+	config := &MeshRadioConfig{
+		Device:  "radio0",
+		MeshID:  "openmanet",
+		Channel: "149",
+		Key:     "correct horse",
+		Bridge:  "br-ahwlan",
+	}
+	changed, err := ProvisionMeshRadioWithReaders(config, networkReader, wirelessReader)
+	if err != nil || !changed {
+		t.Fatalf("ProvisionMeshRadioWithReaders() = %v, %v, want true, nil", changed, err)
+	}
+	if config.Interface != "" {
+		t.Errorf("config.Interface = %q, the defaults must not be written back", config.Interface)
+	}
+
+	// Read back what was committed
+	networkReader = NewUCINetworkConfigReaderWithTree(uci.NewTree(dir))
+	wirelessReader = NewUCIWirelessConfigReaderWithTree(uci.NewTree(dir))
+
+	if _, err := GetBatadvInterfaceWithReader("bat0", networkReader); err != nil {
+		t.Errorf("GetBatadvInterfaceWithReader(bat0) error = %v", err)
+	}
+	hardif, err := GetBatadvHardifWithReader("mesh0", networkReader)
+	if err != nil {
+		t.Fatalf("GetBatadvHardifWithReader(mesh0) error = %v", err)
+	}
+	if hardif.Master != "bat0" {
+		t.Errorf("hardif master = %q, want bat0", hardif.Master)
+	}
+	if bridge, _ := GetNetworkDeviceWithReader("br-ahwlan", networkReader); !reflect.DeepEqual(bridge.Ports, []string{"eth0", "bat0"}) {
+		t.Errorf("bridge ports = %v, want [eth0 bat0]", bridge.Ports)
+	}
+
+	radio, err := GetWifiDeviceWithReader("radio0", wirelessReader)
+	if err != nil {
+		t.Fatalf("GetWifiDeviceWithReader() error = %v", err)
+	}
+	if radio.Channel != "149" || radio.Disabled != "" {
+		t.Errorf("radio = %+v, want channel 149 and enabled", radio)
+	}
+
+	want := map[string]string{
+		"device":      "radio0",
+		"network":     "mesh0",
+		"ifname":      "mesh0",
+		"mode":        "mesh",
+		"mesh_id":     "openmanet",
+		"mesh_fwding": "0",
+		"encryption":  "sae",
+		"key":         "correct horse",
+	}
+	for option, value := range want {
+		if got := wirelessOption(wirelessReader, "mesh0", option); got != value {
+			t.Errorf("wireless.mesh0.%s = %q, want %q", option, got, value)
+		}
+	}
+
+	changed, err = ProvisionMeshRadioWithReaders(config, networkReader, wirelessReader)
+	if err != nil || changed {
+		t.Errorf("ProvisionMeshRadioWithReaders() again = %v, %v, want false, nil", changed, err)
+	}
+
+	// Dropping the key opens the mesh
+	open := *config
+	open.Key = ""
+	if changed, err := ProvisionMeshRadioWithReaders(&open, networkReader, wirelessReader); err != nil || !changed {
+		t.Fatalf("ProvisionMeshRadioWithReaders(open) = %v, %v, want true, nil", changed, err)
+	}
+	if got := wirelessOption(wirelessReader, "mesh0", "encryption"); got != "none" {
+		t.Errorf("encryption = %q, want none", got)
+	}
+	if got := wirelessOption(wirelessReader, "mesh0", "key"); got != "" {
+		t.Errorf("key = %q, want it deleted", got)
+	}
+}
+
+func TestProvisionMeshRadioWithReaders_FailureChangesNothing(t *testing.T) {
+	tests := []struct {
+		name   string
+		config MeshRadioConfig
+		is     error
+	}{
+		{"unknown radio", MeshRadioConfig{Device: "radio9", MeshID: "openmanet"}, ErrSectionNotFound},
+		{"unknown bridge", MeshRadioConfig{Device: "radio0", MeshID: "openmanet", Bridge: "br-lan"}, ErrSectionNotFound},
+		{"not a mesh iface", MeshRadioConfig{Device: "radio0", MeshID: "openmanet", Interface: "default_radio0"}, ErrValidation},
+		{"not a batadv interface", MeshRadioConfig{Device: "radio0", MeshID: "openmanet", BatInterface: "ahwlan"}, ErrValidation},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			networkReader, wirelessReader, dir := newTestProvisionReaders(t)
+
+			if _, err := ProvisionMeshRadioWithReaders(&tt.config, networkReader, wirelessReader); !errors.Is(err, tt.is) {
+				t.Fatalf("ProvisionMeshRadioWithReaders() error = %v, want %v", err, tt.is)
+			}
+
+			for name, config := range map[string]string{
+				"network":  testProvisionNetworkConfig,
+				"wireless": testProvisionWirelessConfig,
+			} {
+				if got, _ := os.ReadFile(filepath.Join(dir, name)); string(got) != config {
+					t.Errorf("%s config was changed:\n%s", name, got)
+				}
+			}
+			if changes := networkReader.Changes(); len(changes) != 0 {
+				t.Errorf("network changes left staged: %v", changes)
+			}
+		})
+	}
+}
+
+func TestProvisionMeshRadioWithReaders_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *MeshRadioConfig
+	}{
+		{"nil config", nil},
+		{"no device", &MeshRadioConfig{MeshID: "openmanet"}},
+		{"no mesh id", &MeshRadioConfig{Device: "radio0"}},
+		{"long mesh id", &MeshRadioConfig{Device: "radio0", MeshID: "a-mesh-id-that-is-longer-than-32-bytes"}},
+		{"short key", &MeshRadioConfig{Device: "radio0", MeshID: "openmanet", Key: "secret"}},
+		{"interface name", &MeshRadioConfig{Device: "radio0", MeshID: "openmanet", Interface: "mesh-0"}},
+		{"same interfaces", &MeshRadioConfig{Device: "radio0", MeshID: "openmanet", Interface: "bat0"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ProvisionMeshRadioWithReaders(tt.config, newMockReader(), nil); !errors.Is(err, ErrValidation) {
+				t.Errorf("ProvisionMeshRadioWithReaders() error = %v, want ErrValidation", err)
+			}
+		})
+	}
+
+	networkReader, wirelessReader, _ := newTestProvisionReaders(t)
+	var invalid *ErrInvalidOption
+	config := &MeshRadioConfig{Device: "radio0", MeshID: "openmanet", Channel: "300"}
+	if _, err := ProvisionMeshRadioWithReaders(config, networkReader, wirelessReader); !errors.As(err, &invalid) {
+		t.Errorf("ProvisionMeshRadioWithReaders(channel 300) error = %v, want ErrInvalidOption", err)
+	}
+}
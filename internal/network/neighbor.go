@@ -0,0 +1,179 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// Neighbor is an entry of the kernel neighbor table, the ARP table for IPv4 and the
+// NDP table for IPv6, binding an IP address on an interface to a MAC address.
+//
+// Fields:
+//   - IP: The IP address of the neighbor.
+//   - MAC: The MAC address the IP address resolves to (e.g., "02:00:00:00:00:01").
+//     Empty while the address is being resolved or after resolution failed.
+//   - Interface: The name of the network interface the neighbor is reached on.
+//   - State: The NUD state of the entry (e.g., netlink.NUD_REACHABLE).
+type Neighbor struct {
+	IP        net.IP
+	MAC       string
+	Interface string
+	State     int
+}
+
+// resolvedStates are the NUD states of an entry whose MAC address can be used.
+const resolvedStates = netlink.NUD_REACHABLE | netlink.NUD_STALE | netlink.NUD_DELAY |
+	netlink.NUD_PROBE | netlink.NUD_PERMANENT | netlink.NUD_NOARP
+
+// Resolved reports whether the entry has a MAC address the kernel sends to. A stale
+// entry counts; the kernel confirms it when it is next used.
+func (n *Neighbor) Resolved() bool {
+	return n.State&resolvedStates != 0 && n.MAC != ""
+}
+
+// Permanent reports whether the entry was added by hand and never expires.
+func (n *Neighbor) Permanent() bool {
+	return n.State&netlink.NUD_PERMANENT != 0
+}
+
+// neighList, neighSet and neighDel are overridable for tests.
+var (
+	neighList = netlink.NeighList
+	neighSet  = netlink.NeighSet
+	neighDel  = netlink.NeighDel
+)
+
+// GetNeighbors returns the IPv4 and IPv6 neighbors of the interface iface, or of
+// every interface if iface is empty.
+//
+// Returns an ErrInterfaceNotFound error if there is no such interface.
+//
+// Example:
+//
+//	// Check the address a gateway announced over alfred before routing through it
+//	neighbors, err := GetNeighbors("br-ahwlan")
+//	for _, n := range neighbors {
+//	    if n.IP.Equal(gatewayIP) && n.Resolved() && n.MAC != gatewayMAC {
+//	        log.Printf("%s is at %s, not %s", n.IP, n.MAC, gatewayMAC)
+//	    }
+//	}
+func GetNeighbors(iface string) ([]Neighbor, error) {
+	index := 0
+	if iface != "" {
+		link, err := netlink.LinkByName(iface)
+		if err != nil {
+			return nil, newInterfaceNotFoundError(iface, err)
+		}
+		index = link.Attrs().Index
+	}
+
+	nlNeighs, err := neighList(index, netlink.FAMILY_ALL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list neighbors: %w", err)
+	}
+
+	neighbors := make([]Neighbor, 0, len(nlNeighs))
+	for _, n := range nlNeighs {
+		// Multicast and proxy entries have no address of their own
+		if n.IP == nil {
+			continue
+		}
+		name := iface
+		if name == "" {
+			if name, err = linkNameByIndex(n.LinkIndex); err != nil {
+				continue // Skip neighbors of interfaces that are gone
+			}
+		}
+
+		neighbor := Neighbor{IP: n.IP, Interface: name, State: n.State}
+		if len(n.HardwareAddr) > 0 {
+			neighbor.MAC = n.HardwareAddr.String()
+		}
+		neighbors = append(neighbors, neighbor)
+	}
+
+	return neighbors, nil
+}
+
+// AddNeighbor adds a permanent entry binding neighbor.IP to neighbor.MAC on
+// neighbor.Interface, replacing the entry the kernel learned, if any. State is
+// ignored. A permanent entry keeps traffic to the IP address from being sent to
+// another MAC address that answers ARP or NDP for it.
+//
+// Returns an ErrValidation error if the IP or MAC address is invalid and an
+// ErrInterfaceNotFound error if there is no such interface.
+//
+// Example:
+//
+//	err := AddNeighbor(Neighbor{
+//	    IP:        net.ParseIP("10.41.0.1"),
+//	    MAC:       "02:00:00:00:00:01",
+//	    Interface: "br-ahwlan",
+//	})
+//
+// Note: This operation requires appropriate privileges (typically root/CAP_NET_ADMIN).
+func AddNeighbor(neighbor Neighbor) error {
+	if neighbor.IP == nil || neighbor.IP.IsUnspecified() || neighbor.IP.IsMulticast() {
+		return newValidationError("neighbor IP %v must be a unicast address", neighbor.IP)
+	}
+	mac, err := net.ParseMAC(neighbor.MAC)
+	if err != nil || len(mac) != 6 {
+		return newValidationError("invalid neighbor MAC address %q", neighbor.MAC)
+	}
+
+	link, err := linkByName(neighbor.Interface, fmt.Sprintf("add neighbor %s lladdr %s dev %s", neighbor.IP, mac, neighbor.Interface))
+	if err != nil {
+		return err
+	}
+
+	family := netlink.FAMILY_V4
+	if neighbor.IP.To4() == nil {
+		family = netlink.FAMILY_V6
+	}
+
+	if err := neighSet(&netlink.Neigh{
+		LinkIndex:    link.Attrs().Index,
+		Family:       family,
+		State:        netlink.NUD_PERMANENT,
+		IP:           neighbor.IP,
+		HardwareAddr: mac,
+	}); err != nil {
+		return fmt.Errorf("failed to add neighbor %s on %s: %w", neighbor.IP, neighbor.Interface, err)
+	}
+
+	return nil
+}
+
+// DeleteNeighbor deletes the entry of ip on the interface iface, whether the kernel
+// learned it or it was added with AddNeighbor. Deleting an entry that does not exist
+// does nothing.
+//
+// Returns an ErrValidation error if ip is nil and an ErrInterfaceNotFound error if
+// there is no such interface.
+//
+// Note: This operation requires appropriate privileges (typically root/CAP_NET_ADMIN).
+func DeleteNeighbor(iface string, ip net.IP) error {
+	if ip == nil {
+		return newValidationError("neighbor IP cannot be nil")
+	}
+
+	link, err := linkByName(iface, fmt.Sprintf("delete neighbor %s dev %s", ip, iface))
+	if err != nil {
+		return err
+	}
+
+	family := netlink.FAMILY_V4
+	if ip.To4() == nil {
+		family = netlink.FAMILY_V6
+	}
+
+	if err := neighDel(&netlink.Neigh{LinkIndex: link.Attrs().Index, Family: family, IP: ip}); err != nil && !errors.Is(err, unix.ENOENT) {
+		return fmt.Errorf("failed to delete neighbor %s on %s: %w", ip, iface, err)
+	}
+
+	return nil
+}
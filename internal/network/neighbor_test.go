@@ -0,0 +1,102 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+func TestGetNeighbors(t *testing.T) {
+	oldList, oldName := neighList, linkNameByIndex
+	t.Cleanup(func() { neighList, linkNameByIndex = oldList, oldName })
+
+	mac, _ := net.ParseMAC("02:00:00:00:00:01")
+	neighList = func(index, family int) ([]netlink.Neigh, error) {
+		if index != 0 || family != netlink.FAMILY_ALL {
+			t.Errorf("NeighList(%d, %d), want every interface and family", index, family)
+		}
+		return []netlink.Neigh{
+			{LinkIndex: 2, IP: net.ParseIP("10.41.0.1"), HardwareAddr: mac, State: netlink.NUD_REACHABLE},
+			{LinkIndex: 2, IP: net.ParseIP("10.41.0.9"), State: netlink.NUD_FAILED},
+			{LinkIndex: 2, IP: net.ParseIP("fd00::1"), HardwareAddr: mac, State: netlink.NUD_PERMANENT},
+			{LinkIndex: 7, IP: net.ParseIP("10.41.0.2"), HardwareAddr: mac, State: netlink.NUD_STALE},
+			{LinkIndex: 2, HardwareAddr: mac},
+		}, nil
+	}
+	linkNameByIndex = func(index int) (string, error) {
+		if index == 2 {
+			return "br-ahwlan", nil
+		}
+		return "", fmt.Errorf("link %d not found", index)
+	}
+
+	neighbors, err := GetNeighbors("")
+	if err != nil {
+		t.Fatalf("GetNeighbors() error = %v", err)
+	}
+	if len(neighbors) != 3 {
+		t.Fatalf("got %d neighbors, want 3: %v", len(neighbors), neighbors)
+	}
+
+	reachable, failed, permanent := neighbors[0], neighbors[1], neighbors[2]
+	if reachable.MAC != "02:00:00:00:00:01" || reachable.Interface != "br-ahwlan" || !reachable.Resolved() || reachable.Permanent() {
+		t.Errorf("reachable neighbor = %+v", reachable)
+	}
+	if failed.MAC != "" || failed.Resolved() {
+		t.Errorf("failed neighbor = %+v, want unresolved without MAC", failed)
+	}
+	if !permanent.Resolved() || !permanent.Permanent() {
+		t.Errorf("permanent neighbor = %+v", permanent)
+	}
+
+	neighList = func(int, int) ([]netlink.Neigh, error) { return nil, errors.New("netlink unavailable") }
+	if _, err := GetNeighbors(""); err == nil {
+		t.Error("GetNeighbors() succeeded without a neighbor table")
+	}
+}
+
+func TestNeighbors_Invalid(t *testing.T) {
+	oldSet, oldDel := neighSet, neighDel
+	t.Cleanup(func() { neighSet, neighDel = oldSet, oldDel })
+	neighSet = func(*netlink.Neigh) error {
+		t.Error("invalid neighbor was added")
+		return nil
+	}
+	neighDel = func(*netlink.Neigh) error {
+		t.Error("invalid neighbor was deleted")
+		return nil
+	}
+
+	valid := Neighbor{IP: net.ParseIP("10.41.0.1"), MAC: "02:00:00:00:00:01", Interface: "lo"}
+	invalid := map[string]Neighbor{
+		"no IP":        {MAC: valid.MAC, Interface: "lo"},
+		"unspecified":  {IP: net.IPv4zero, MAC: valid.MAC, Interface: "lo"},
+		"multicast":    {IP: net.ParseIP("224.0.0.1"), MAC: valid.MAC, Interface: "lo"},
+		"no MAC":       {IP: valid.IP, Interface: "lo"},
+		"EUI-64 MAC":   {IP: valid.IP, MAC: "02:00:00:00:00:00:00:01", Interface: "lo"},
+		"no interface": {IP: valid.IP, MAC: valid.MAC},
+	}
+	for name, neighbor := range invalid {
+		if err := AddNeighbor(neighbor); !errors.Is(err, ErrValidation) {
+			t.Errorf("AddNeighbor(%s) error = %v, want ErrValidation", name, err)
+		}
+	}
+	if err := DeleteNeighbor("lo", nil); !errors.Is(err, ErrValidation) {
+		t.Errorf("DeleteNeighbor(nil) error = %v, want ErrValidation", err)
+	}
+
+	missing := valid
+	missing.Interface = "nonexistent999"
+	if err := AddNeighbor(missing); !errors.Is(err, ErrInterfaceNotFound) {
+		t.Errorf("AddNeighbor() error = %v, want ErrInterfaceNotFound", err)
+	}
+	if err := DeleteNeighbor("nonexistent999", valid.IP); !errors.Is(err, ErrInterfaceNotFound) {
+		t.Errorf("DeleteNeighbor() error = %v, want ErrInterfaceNotFound", err)
+	}
+	if _, err := GetNeighbors("nonexistent999"); !errors.Is(err, ErrInterfaceNotFound) {
+		t.Errorf("GetNeighbors() error = %v, want ErrInterfaceNotFound", err)
+	}
+}
@@ -0,0 +1,85 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"time"
+
+	"github.com/openmanet/openmanetd/internal/safemode"
+	"github.com/openmanet/openmanetd/internal/ubus"
+)
+
+// netifdTimeout bounds a ubus call to netifd. Reloads return once netifd has
+// scheduled the changes, well before interfaces are up.
+const netifdTimeout = 30 * time.Second
+
+// ubusSocketPath is the ubusd socket netifd is reached through.
+var ubusSocketPath = ubus.DefaultSocketPath
+
+// SetUbusSocketPath sets the ubusd socket that ReloadNetwork and the other netifd
+// calls use, ubus.DefaultSocketPath by default. It is meant to be called once at
+// startup, before any reload.
+func SetUbusSocketPath(path string) {
+	ubusSocketPath = path
+}
+
+// ubusCall calls a method on ubus. Tests replace it to stand in for netifd.
+var ubusCall = func(ctx context.Context, object, method string, args any) (map[string]any, error) {
+	return ubus.NewClient(ubusSocketPath).Call(ctx, object, method, args)
+}
+
+// callNetifd calls method on a netifd object, e.g. "reload" on "network". The call
+// is bounded by ctx and netifdTimeout.
+//
+// Returns false if ubusd cannot be reached, so that the caller can fall back to the
+// init scripts. A failed call is reported as an ErrReloadFailed carrying the
+// *ubus.StatusError.
+func callNetifd(ctx context.Context, object, method string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, netifdTimeout)
+	defer cancel()
+
+	if _, err := ubusCall(ctx, object, method, nil); err != nil {
+		if errors.Is(err, ubus.ErrUnavailable) {
+			return false, nil
+		}
+		return true, &ErrReloadFailed{Service: object, Err: err}
+	}
+
+	return true, nil
+}
+
+// RestartNetworkInterface takes one interface down and up again, so that it picks
+// up its changed configuration without touching the other interfaces, as ifup does.
+// netifd is asked over ubus; without ubusd, /sbin/ifup is run instead.
+//
+// Returns an ErrReloadFailed if the interface could not be restarted, e.g. because
+// netifd does not know it.
+//
+// Example:
+//
+//	err := RestartNetworkInterface("ahwlan")
+func RestartNetworkInterface(name string) error {
+	if err := safemode.Check("restart interface " + name); err != nil {
+		return err
+	}
+
+	object := "network.interface." + name
+	handled, err := callNetifd(context.Background(), object, "down")
+	if handled {
+		if err != nil {
+			return err
+		}
+		if handled, err = callNetifd(context.Background(), object, "up"); !handled {
+			return &ErrReloadFailed{Service: object, Err: ubus.ErrUnavailable}
+		}
+		return err
+	}
+
+	cmd := exec.Command("/sbin/ifup", name)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return newReloadError(object, output, err)
+	}
+
+	return nil
+}
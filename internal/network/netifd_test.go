@@ -0,0 +1,90 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/openmanet/openmanetd/internal/ubus"
+)
+
+// stubUbus replaces ubusCall for the test, answering every call with err.
+//
+// Returns the calls made, as "object method".
+func stubUbus(t *testing.T, err error) *[]string {
+	t.Helper()
+
+	var calls []string
+	orig := ubusCall
+	ubusCall = func(ctx context.Context, object, method string, args any) (map[string]any, error) {
+		calls = append(calls, object+" "+method)
+		return nil, err
+	}
+	t.Cleanup(func() { ubusCall = orig })
+
+	return &calls
+}
+
+func TestReloadNetwork_Ubus(t *testing.T) {
+	calls := stubUbus(t, nil)
+
+	if err := ReloadNetwork(); err != nil {
+		t.Fatalf("ReloadNetwork() error = %v", err)
+	}
+	if err := RestartNetwork(); err != nil {
+		t.Fatalf("RestartNetwork() error = %v", err)
+	}
+	if err := RestartNetworkInterface("ahwlan"); err != nil {
+		t.Fatalf("RestartNetworkInterface() error = %v", err)
+	}
+
+	want := []string{
+		"network reload",
+		"network restart",
+		"network.interface.ahwlan down",
+		"network.interface.ahwlan up",
+	}
+	if !slices.Equal(*calls, want) {
+		t.Errorf("ubus calls = %v, want %v", *calls, want)
+	}
+}
+
+func TestRestartNetworkInterface_Failed(t *testing.T) {
+	calls := stubUbus(t, &ubus.StatusError{Object: "network.interface.guest", Method: "down", Status: ubus.StatusNotFound})
+
+	err := RestartNetworkInterface("guest")
+
+	var reloadErr *ErrReloadFailed
+	var statusErr *ubus.StatusError
+	if !errors.As(err, &reloadErr) || reloadErr.Service != "network.interface.guest" || !errors.As(err, &statusErr) {
+		t.Fatalf("RestartNetworkInterface() error = %v, want ErrReloadFailed carrying a *ubus.StatusError", err)
+	}
+	if statusErr.Status != ubus.StatusNotFound {
+		t.Errorf("status = %d, want %d", statusErr.Status, ubus.StatusNotFound)
+	}
+	if want := []string{"network.interface.guest down"}; !slices.Equal(*calls, want) {
+		t.Errorf("ubus calls = %v, want %v", *calls, want)
+	}
+}
+
+func TestReloadNetworkContext_Cancelled(t *testing.T) {
+	orig := ubusCall
+	ubusCall = func(ctx context.Context, object, method string, args any) (map[string]any, error) {
+		// netifd never answers
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	t.Cleanup(func() { ubusCall = orig })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	err := ReloadNetworkContext(ctx)
+
+	var reloadErr *ErrReloadFailed
+	if !errors.As(err, &reloadErr) || !errors.Is(err, context.Canceled) {
+		t.Errorf("ReloadNetworkContext() error = %v, want an ErrReloadFailed wrapping context.Canceled", err)
+	}
+}
@@ -0,0 +1,208 @@
+package network
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// NetEventType says what changed in a NetEvent.
+type NetEventType string
+
+const (
+	// EventRouteAdded events report a route that was added or replaced.
+	EventRouteAdded NetEventType = "routeAdded"
+	// EventRouteDeleted events report a route that was removed, by an administrator
+	// or by the kernel when its interface went down.
+	EventRouteDeleted NetEventType = "routeDeleted"
+	// EventLinkUp events report an interface whose operational state changed to
+	// up.
+	EventLinkUp NetEventType = "linkUp"
+	// EventLinkDown events report an interface whose operational state changed
+	// from up.
+	EventLinkDown NetEventType = "linkDown"
+	// EventLinkDeleted events report an interface that was removed.
+	EventLinkDeleted NetEventType = "linkDeleted"
+)
+
+// NetEvent is a change of the kernel routing tables or interfaces.
+type NetEvent struct {
+	Type NetEventType
+	// Route is the added or deleted route of a route event. Its Interface is empty
+	// if the interface was already gone when the event was read.
+	Route *Route
+	// Link is the interface name of a link event.
+	Link string
+}
+
+// IsDefaultRoute reports whether e is a route event of an IPv4 or IPv6 default
+// route in the main table.
+func (e NetEvent) IsDefaultRoute() bool {
+	if e.Route == nil || e.Route.Table != unix.RT_TABLE_MAIN {
+		return false
+	}
+	if e.Route.Destination == nil {
+		return true
+	}
+	ones, _ := e.Route.Destination.Mask.Size()
+	return ones == 0
+}
+
+// routeSubscribe and linkSubscribe are overridable for tests.
+var (
+	routeSubscribe = netlink.RouteSubscribe
+	linkSubscribe  = netlink.LinkSubscribe
+)
+
+// Subscribe reports route and link changes until done is closed, so that a worker
+// can react when a route disappears instead of finding out on its next tick. Route
+// events cover every table; link events are only sent when the operational state of
+// an interface changes, as SubscribeLinkUp reports them.
+//
+// The channel is closed once done is closed, or when the kernel ends either
+// subscription, e.g. after the socket buffer overflowed and events were lost. A
+// caller that must not miss changes subscribes again and rereads the state it
+// tracks.
+//
+// Returns an error if a netlink subscription cannot be opened.
+//
+// Example:
+//
+//	events, err := Subscribe(done)
+//	for event := range events {
+//	    if event.Type == EventRouteDeleted && event.IsDefaultRoute() {
+//	        log.Printf("default route %s removed", event.Route)
+//	    }
+//	}
+func Subscribe(done <-chan struct{}) (<-chan NetEvent, error) {
+	stop := make(chan struct{})
+	var once sync.Once
+	unsubscribe := func() { once.Do(func() { close(stop) }) }
+
+	routes := make(chan netlink.RouteUpdate)
+	if err := routeSubscribe(routes, stop); err != nil {
+		unsubscribe()
+		return nil, fmt.Errorf("failed to subscribe to route updates: %w", err)
+	}
+	links := make(chan netlink.LinkUpdate)
+	if err := linkSubscribe(links, stop); err != nil {
+		unsubscribe()
+		return nil, fmt.Errorf("failed to subscribe to link updates: %w", err)
+	}
+
+	go func() {
+		select {
+		case <-done:
+		case <-stop:
+		}
+		unsubscribe()
+	}()
+
+	events := make(chan NetEvent)
+	go func() {
+		defer close(events)
+
+		// netlink closes the update channels once stop is closed; they are drained
+		// until then so that its readers do not block.
+		states := make(linkStates)
+		for routes != nil || links != nil {
+			var (
+				event NetEvent
+				ok    bool
+			)
+			select {
+			case update, open := <-routes:
+				if !open {
+					routes = nil
+					unsubscribe()
+					continue
+				}
+				event, ok = routeEvent(update)
+			case update, open := <-links:
+				if !open {
+					links = nil
+					unsubscribe()
+					continue
+				}
+				event, ok = states.update(update)
+			}
+			if !ok {
+				continue
+			}
+
+			select {
+			case events <- event:
+			case <-stop:
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+// routeEvent converts a netlink route update, returning false for updates that
+// neither add nor delete a route.
+func routeEvent(update netlink.RouteUpdate) (NetEvent, bool) {
+	var typ NetEventType
+	switch update.Type {
+	case unix.RTM_NEWROUTE:
+		typ = EventRouteAdded
+	case unix.RTM_DELROUTE:
+		typ = EventRouteDeleted
+	default:
+		return NetEvent{}, false
+	}
+
+	r := update.Route
+	route := &Route{
+		Destination: r.Dst,
+		Gateway:     r.Gw,
+		Metric:      r.Priority,
+		Table:       r.Table,
+		Scope:       r.Scope,
+		Protocol:    r.Protocol,
+	}
+	// The interface of a deleted route may be gone already
+	if r.LinkIndex > 0 {
+		if name, err := linkNameByIndex(r.LinkIndex); err == nil {
+			route.Interface = name
+		}
+	}
+	if len(r.MultiPath) > 0 {
+		if hops, err := fromNetlinkNextHops(r.MultiPath, linkNameByIndex); err == nil {
+			route.NextHops = hops
+		}
+	}
+
+	return NetEvent{Type: typ, Route: route}, true
+}
+
+// linkStates tracks whether each interface, by index, is operationally up.
+type linkStates map[int]bool
+
+// update records the state of the interface of a link update and returns the event
+// it amounts to, or false if its operational state did not change. An interface seen
+// for the first time counts as down before the update.
+func (s linkStates) update(update netlink.LinkUpdate) (NetEvent, bool) {
+	attrs := update.Link.Attrs()
+	if update.Header.Type == unix.RTM_DELLINK {
+		delete(s, attrs.Index)
+		return NetEvent{Type: EventLinkDeleted, Link: attrs.Name}, true
+	}
+
+	isUp := attrs.OperState == netlink.OperUp || (attrs.OperState == netlink.OperUnknown && attrs.Flags&net.FlagUp != 0)
+
+	wasUp := s[attrs.Index]
+	s[attrs.Index] = isUp
+	switch {
+	case isUp && !wasUp:
+		return NetEvent{Type: EventLinkUp, Link: attrs.Name}, true
+	case !isUp && wasUp:
+		return NetEvent{Type: EventLinkDown, Link: attrs.Name}, true
+	}
+
+	return NetEvent{}, false
+}
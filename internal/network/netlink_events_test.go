@@ -0,0 +1,180 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// stubSubscribe replaces the netlink subscriptions with ones that deliver the
+// updates sent on the returned channels, closing them once done is closed as netlink
+// does.
+func stubSubscribe(t *testing.T) (chan<- netlink.RouteUpdate, chan<- netlink.LinkUpdate) {
+	t.Helper()
+
+	oldRoute, oldLink, oldName := routeSubscribe, linkSubscribe, linkNameByIndex
+	t.Cleanup(func() { routeSubscribe, linkSubscribe, linkNameByIndex = oldRoute, oldLink, oldName })
+
+	linkNameByIndex = func(index int) (string, error) {
+		if index == 2 {
+			return "br-ahwlan", nil
+		}
+		return "", fmt.Errorf("link %d not found", index)
+	}
+
+	routes := make(chan netlink.RouteUpdate)
+	links := make(chan netlink.LinkUpdate)
+	routeSubscribe = func(ch chan<- netlink.RouteUpdate, done <-chan struct{}) error {
+		go forward(routes, ch, done)
+		return nil
+	}
+	linkSubscribe = func(ch chan<- netlink.LinkUpdate, done <-chan struct{}) error {
+		go forward(links, ch, done)
+		return nil
+	}
+
+	return routes, links
+}
+
+// forward sends the values of in to out until done is closed, then closes out.
+func forward[T any](in <-chan T, out chan<- T, done <-chan struct{}) {
+	defer close(out)
+	for {
+		select {
+		case v := <-in:
+			out <- v
+		case <-done:
+			return
+		}
+	}
+}
+
+func linkUpdate(typ uint16, index int, name string, state netlink.LinkOperState) netlink.LinkUpdate {
+	update := netlink.LinkUpdate{Link: &netlink.Dummy{LinkAttrs: netlink.LinkAttrs{Index: index, Name: name, OperState: state}}}
+	update.Header.Type = typ
+	return update
+}
+
+func receive(t *testing.T, events <-chan NetEvent) NetEvent {
+	t.Helper()
+	select {
+	case event, ok := <-events:
+		if !ok {
+			t.Fatal("events closed")
+		}
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("no event")
+	}
+	return NetEvent{}
+}
+
+func TestSubscribe(t *testing.T) {
+	routes, links := stubSubscribe(t)
+
+	done := make(chan struct{})
+	events, err := Subscribe(done)
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+
+	gw := net.ParseIP("10.41.0.1")
+	routes <- netlink.RouteUpdate{Type: unix.RTM_DELROUTE, Route: netlink.Route{LinkIndex: 2, Gw: gw, Table: unix.RT_TABLE_MAIN, Protocol: RouteProtocolOpenMANET}}
+	event := receive(t, events)
+	if event.Type != EventRouteDeleted || !event.Route.Gateway.Equal(gw) || event.Route.Interface != "br-ahwlan" || event.Route.Protocol != RouteProtocolOpenMANET {
+		t.Errorf("event = %+v, route %s, want the deleted default route via %s on br-ahwlan", event, event.Route, gw)
+	}
+	if !event.IsDefaultRoute() {
+		t.Error("IsDefaultRoute() = false for a route without destination")
+	}
+
+	// The interface of a deleted route may be gone
+	_, dst, _ := net.ParseCIDR("10.42.0.0/16")
+	routes <- netlink.RouteUpdate{Type: unix.RTM_NEWROUTE, Route: netlink.Route{LinkIndex: 7, Dst: dst, Table: unix.RT_TABLE_MAIN}}
+	event = receive(t, events)
+	if event.Type != EventRouteAdded || event.Route.Interface != "" || event.IsDefaultRoute() {
+		t.Errorf("event = %+v, want an added route without interface", event)
+	}
+
+	// Only changes of the operational state are reported
+	for _, step := range []struct {
+		updates []netlink.LinkUpdate
+		want    NetEventType
+	}{
+		{[]netlink.LinkUpdate{linkUpdate(unix.RTM_NEWLINK, 3, "mesh0", netlink.OperDown), linkUpdate(unix.RTM_NEWLINK, 3, "mesh0", netlink.OperUp)}, EventLinkUp},
+		{[]netlink.LinkUpdate{linkUpdate(unix.RTM_NEWLINK, 3, "mesh0", netlink.OperUp), linkUpdate(unix.RTM_NEWLINK, 3, "mesh0", netlink.OperDown)}, EventLinkDown},
+		{[]netlink.LinkUpdate{linkUpdate(unix.RTM_DELLINK, 3, "mesh0", netlink.OperDown)}, EventLinkDeleted},
+	} {
+		for _, update := range step.updates {
+			links <- update
+		}
+		if event := receive(t, events); event.Type != step.want || event.Link != "mesh0" {
+			t.Errorf("event = %+v, want %s of mesh0", event, step.want)
+		}
+	}
+
+	close(done)
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Error("event after done was closed")
+		}
+	case <-time.After(time.Second):
+		t.Error("events not closed after done was closed")
+	}
+}
+
+func TestSubscribe_Error(t *testing.T) {
+	stubSubscribe(t)
+
+	var routeDone <-chan struct{}
+	routeSubscribe = func(ch chan<- netlink.RouteUpdate, done <-chan struct{}) error {
+		routeDone = done
+		go func() { <-done; close(ch) }()
+		return nil
+	}
+	linkSubscribe = func(chan<- netlink.LinkUpdate, <-chan struct{}) error {
+		return errors.New("permission denied")
+	}
+
+	if _, err := Subscribe(nil); err == nil {
+		t.Fatal("Subscribe() succeeded without a link subscription")
+	}
+	select {
+	case <-routeDone:
+	case <-time.After(time.Second):
+		t.Error("route subscription left open")
+	}
+}
+
+func TestNetEvent_IsDefaultRoute(t *testing.T) {
+	_, v4, _ := net.ParseCIDR("0.0.0.0/0")
+	_, v6, _ := net.ParseCIDR("::/0")
+	_, host, _ := net.ParseCIDR("10.41.0.1/32")
+
+	tests := []struct {
+		name  string
+		event NetEvent
+		want  bool
+	}{
+		{"IPv4", NetEvent{Type: EventRouteDeleted, Route: &Route{Destination: v4, Table: unix.RT_TABLE_MAIN}}, true},
+		{"IPv6", NetEvent{Type: EventRouteDeleted, Route: &Route{Destination: v6, Table: unix.RT_TABLE_MAIN}}, true},
+		{"no destination", NetEvent{Type: EventRouteAdded, Route: &Route{Table: unix.RT_TABLE_MAIN}}, true},
+		{"other table", NetEvent{Type: EventRouteDeleted, Route: &Route{Destination: v4, Table: 100}}, false},
+		{"host route", NetEvent{Type: EventRouteDeleted, Route: &Route{Destination: host, Table: unix.RT_TABLE_MAIN}}, false},
+		{"link event", NetEvent{Type: EventLinkDown, Link: "mesh0"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.event.IsDefaultRoute(); got != tt.want {
+				t.Errorf("IsDefaultRoute() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package network
+
+import "github.com/vishvananda/netlink"
+
+// Netlinker defines the netlink calls the route functions make, so that they can be
+// run against a fake in tests instead of the kernel. *netlink.Handle implements it.
+type Netlinker interface {
+	LinkByName(name string) (netlink.Link, error)
+	LinkByIndex(index int) (netlink.Link, error)
+	RouteList(link netlink.Link, family int) ([]netlink.Route, error)
+	RouteListFiltered(family int, filter *netlink.Route, filterMask uint64) ([]netlink.Route, error)
+	RouteAdd(route *netlink.Route) error
+	RouteDel(route *netlink.Route) error
+	RouteReplace(route *netlink.Route) error
+}
+
+var _ Netlinker = (*netlink.Handle)(nil)
+
+// NewNetlinker returns a Netlinker for the current network namespace. It opens a
+// socket per request, as the package-level functions of the netlink package do.
+func NewNetlinker() Netlinker {
+	return &netlink.Handle{}
+}
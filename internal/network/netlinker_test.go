@@ -0,0 +1,256 @@
+package network
+
+import (
+	"errors"
+	"net"
+	"slices"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// mockNetlinker is a Netlinker backed by a list of links and routes. Changes are
+// applied to routes and recorded in added, deleted and replaced.
+type mockNetlinker struct {
+	links    []netlink.Link
+	routes   []netlink.Route
+	addErr   error
+	added    []netlink.Route
+	deleted  []netlink.Route
+	replaced []netlink.Route
+}
+
+func newMockNetlinker(names ...string) *mockNetlinker {
+	m := &mockNetlinker{}
+	for i, name := range names {
+		m.links = append(m.links, &netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: name, Index: i + 1}})
+	}
+	return m
+}
+
+func (m *mockNetlinker) LinkByName(name string) (netlink.Link, error) {
+	for _, link := range m.links {
+		if link.Attrs().Name == name {
+			return link, nil
+		}
+	}
+	return nil, netlink.LinkNotFoundError{}
+}
+
+func (m *mockNetlinker) LinkByIndex(index int) (netlink.Link, error) {
+	for _, link := range m.links {
+		if link.Attrs().Index == index {
+			return link, nil
+		}
+	}
+	return nil, netlink.LinkNotFoundError{}
+}
+
+func (m *mockNetlinker) RouteList(link netlink.Link, family int) ([]netlink.Route, error) {
+	if link == nil {
+		return slices.Clone(m.routes), nil
+	}
+	return m.RouteListFiltered(family, &netlink.Route{LinkIndex: link.Attrs().Index}, netlink.RT_FILTER_OIF)
+}
+
+func (m *mockNetlinker) RouteListFiltered(family int, filter *netlink.Route, filterMask uint64) ([]netlink.Route, error) {
+	var routes []netlink.Route
+	for _, route := range m.routes {
+		// As in the kernel, table 0 matches every table
+		if filterMask&netlink.RT_FILTER_TABLE != 0 && filter.Table != unix.RT_TABLE_UNSPEC && route.Table != filter.Table {
+			continue
+		}
+		if filterMask&netlink.RT_FILTER_OIF != 0 && route.LinkIndex != filter.LinkIndex {
+			continue
+		}
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+func (m *mockNetlinker) RouteAdd(route *netlink.Route) error {
+	if m.addErr != nil {
+		return m.addErr
+	}
+	m.added = append(m.added, *route)
+	m.routes = append(m.routes, *route)
+	return nil
+}
+
+func (m *mockNetlinker) RouteDel(route *netlink.Route) error {
+	i := slices.IndexFunc(m.routes, func(r netlink.Route) bool { return r.Equal(*route) })
+	if i < 0 {
+		return unix.ESRCH
+	}
+	m.deleted = append(m.deleted, *route)
+	m.routes = slices.Delete(m.routes, i, i+1)
+	return nil
+}
+
+func (m *mockNetlinker) RouteReplace(route *netlink.Route) error {
+	m.replaced = append(m.replaced, *route)
+	i := slices.IndexFunc(m.routes, func(r netlink.Route) bool {
+		return r.Table == route.Table && r.Priority == route.Priority && r.Dst.String() == route.Dst.String()
+	})
+	if i < 0 {
+		m.routes = append(m.routes, *route)
+		return nil
+	}
+	m.routes[i] = *route
+	return nil
+}
+
+func TestAddDefaultRouteWithNetlinker(t *testing.T) {
+	nl := newMockNetlinker("eth0", "br-ahwlan")
+	gw := net.ParseIP("10.41.0.1")
+
+	if err := AddDefaultRouteWithNetlinker(gw, "br-ahwlan", 10, nl); err != nil {
+		t.Fatalf("AddDefaultRouteWithNetlinker() error = %v", err)
+	}
+	if len(nl.added) != 1 {
+		t.Fatalf("added %v, want one route", nl.added)
+	}
+	if got := nl.added[0]; got.LinkIndex != 2 || !got.Gw.Equal(gw) || got.Priority != 10 || got.Table != unix.RT_TABLE_MAIN {
+		t.Errorf("added route = %v, want via %s dev br-ahwlan metric 10 in the main table", got, gw)
+	}
+
+	if err := AddDefaultRouteWithNetlinker(gw, "wlan9", 10, nl); !errors.Is(err, ErrInterfaceNotFound) {
+		t.Errorf("unknown interface error = %v, want ErrInterfaceNotFound", err)
+	}
+
+	nl.addErr = unix.EEXIST
+	if err := AddDefaultRouteWithNetlinker(gw, "br-ahwlan", 10, nl); !errors.Is(err, unix.EEXIST) {
+		t.Errorf("failed add error = %v, want EEXIST", err)
+	}
+}
+
+func TestGetDefaultRouteWithNetlinker(t *testing.T) {
+	defaultDst := createTestIPNet("0.0.0.0/0")
+	nl := newMockNetlinker("eth0", "br-ahwlan")
+
+	if _, err := GetDefaultRouteWithNetlinker(nl); !errors.Is(err, ErrNoDefaultRouteFound) {
+		t.Errorf("no routes error = %v, want ErrNoDefaultRouteFound", err)
+	}
+
+	nl.routes = []netlink.Route{
+		{Dst: createTestIPNet("192.168.50.0/24"), Gw: net.ParseIP("10.41.0.9"), LinkIndex: 2, Table: unix.RT_TABLE_MAIN},
+		{Dst: defaultDst, Gw: net.ParseIP("10.41.0.1"), LinkIndex: 2, Priority: 20, Table: unix.RT_TABLE_MAIN},
+		{Dst: defaultDst, Gw: net.ParseIP("192.0.2.1"), LinkIndex: 1, Priority: 10, Table: unix.RT_TABLE_MAIN},
+		{Dst: defaultDst, Gw: net.ParseIP("10.41.0.2"), LinkIndex: 2, Priority: 1, Table: 100},
+	}
+
+	route, err := GetDefaultRouteWithNetlinker(nl)
+	if err != nil {
+		t.Fatalf("GetDefaultRouteWithNetlinker() error = %v", err)
+	}
+	if !route.Gateway.Equal(net.ParseIP("192.0.2.1")) || route.Interface != "eth0" || route.Metric != 10 {
+		t.Errorf("default route = %v, want the lowest metric route of the main table", route)
+	}
+}
+
+func TestReplaceDefaultRouteWithNetlinker(t *testing.T) {
+	defaultDst := createTestIPNet("0.0.0.0/0")
+	gw := net.ParseIP("10.41.0.1")
+
+	t.Run("adds when there is none", func(t *testing.T) {
+		nl := newMockNetlinker("br-ahwlan")
+
+		if err := ReplaceDefaultRouteWithNetlinker(gw, "br-ahwlan", nl); err != nil {
+			t.Fatalf("ReplaceDefaultRouteWithNetlinker() error = %v", err)
+		}
+		if len(nl.added) != 1 || nl.added[0].Priority != 10 {
+			t.Errorf("added %v, want a default route at metric 10", nl.added)
+		}
+	})
+
+	t.Run("replaces another gateway", func(t *testing.T) {
+		nl := newMockNetlinker("br-ahwlan")
+		nl.routes = []netlink.Route{{Dst: defaultDst, Gw: gw, LinkIndex: 1, Priority: 20, Table: unix.RT_TABLE_MAIN}}
+
+		newGw := net.ParseIP("10.41.0.2")
+		if err := ReplaceDefaultRouteWithNetlinker(newGw, "br-ahwlan", nl); err != nil {
+			t.Fatalf("ReplaceDefaultRouteWithNetlinker() error = %v", err)
+		}
+		if len(nl.replaced) != 1 || !nl.replaced[0].Gw.Equal(newGw) || nl.replaced[0].Priority != 20 {
+			t.Errorf("replaced %v, want the new gateway at the old metric", nl.replaced)
+		}
+	})
+
+	t.Run("keeps the same gateway", func(t *testing.T) {
+		nl := newMockNetlinker("br-ahwlan")
+		nl.routes = []netlink.Route{{Dst: defaultDst, Gw: gw, LinkIndex: 1, Priority: 20, Table: unix.RT_TABLE_MAIN}}
+
+		if err := ReplaceDefaultRouteWithNetlinker(gw, "br-ahwlan", nl); err != nil {
+			t.Fatalf("ReplaceDefaultRouteWithNetlinker() error = %v", err)
+		}
+		if len(nl.added) != 0 || len(nl.replaced) != 0 {
+			t.Errorf("added %v and replaced %v, want nothing changed", nl.added, nl.replaced)
+		}
+	})
+}
+
+func TestFlushRoutesInTableWithNetlinker(t *testing.T) {
+	nl := newMockNetlinker("br-ahwlan")
+	mainRoute := netlink.Route{Dst: createTestIPNet("192.168.50.0/24"), LinkIndex: 1, Table: unix.RT_TABLE_MAIN}
+	nl.routes = []netlink.Route{
+		mainRoute,
+		{Dst: createTestIPNet("0.0.0.0/0"), Gw: net.ParseIP("10.41.0.1"), LinkIndex: 1, Table: 100},
+		{Dst: createTestIPNet("10.99.0.0/16"), LinkIndex: 1, Table: 100},
+	}
+
+	if err := FlushRoutesInTableWithNetlinker(100, nl); err != nil {
+		t.Fatalf("FlushRoutesInTableWithNetlinker() error = %v", err)
+	}
+	if len(nl.deleted) != 2 || len(nl.routes) != 1 || !nl.routes[0].Equal(mainRoute) {
+		t.Errorf("deleted %v leaving %v, want only the routes of table 100 deleted", nl.deleted, nl.routes)
+	}
+}
+
+func TestGetRoutesForInterfaceWithNetlinker(t *testing.T) {
+	nl := newMockNetlinker("eth0", "br-ahwlan")
+	nl.routes = []netlink.Route{
+		{Dst: createTestIPNet("192.0.2.0/24"), LinkIndex: 1, Table: unix.RT_TABLE_MAIN},
+		{Dst: createTestIPNet("10.41.0.0/16"), LinkIndex: 2, Table: unix.RT_TABLE_MAIN},
+	}
+
+	routes, err := GetRoutesForInterfaceWithNetlinker("br-ahwlan", nl)
+	if err != nil {
+		t.Fatalf("GetRoutesForInterfaceWithNetlinker() error = %v", err)
+	}
+	if len(routes) != 1 || routes[0].Interface != "br-ahwlan" || routes[0].Destination.String() != "10.41.0.0/16" {
+		t.Errorf("routes = %v, want the br-ahwlan route", routes)
+	}
+
+	if _, err := GetRoutesForInterfaceWithNetlinker("wlan9", nl); !errors.Is(err, ErrInterfaceNotFound) {
+		t.Errorf("unknown interface error = %v, want ErrInterfaceNotFound", err)
+	}
+}
+
+func TestKernelRouteTable_Netlinker(t *testing.T) {
+	nl := newMockNetlinker("br-ahwlan")
+	table := KernelRouteTable{Handle: nl}
+	route := &Route{Destination: createTestIPNet("192.168.50.0/24"), Gateway: net.ParseIP("10.41.0.9"), Interface: "br-ahwlan", Metric: 10, Table: 100}
+
+	if err := table.AddRoute(route); err != nil {
+		t.Fatalf("AddRoute() error = %v", err)
+	}
+	if len(nl.added) != 1 || nl.added[0].LinkIndex != 1 || nl.added[0].Table != 100 {
+		t.Errorf("added %v, want the route on br-ahwlan in table 100", nl.added)
+	}
+
+	routes, err := table.GetRoutes(100)
+	if err != nil {
+		t.Fatalf("GetRoutes() error = %v", err)
+	}
+	if len(routes) != 1 || !SameRoute(routes[0], route) {
+		t.Errorf("GetRoutes() = %v, want %v", routes, route)
+	}
+
+	if err := table.DeleteRoute(route); err != nil {
+		t.Fatalf("DeleteRoute() error = %v", err)
+	}
+	if len(nl.routes) != 0 {
+		t.Errorf("routes = %v after DeleteRoute(), want none", nl.routes)
+	}
+}
@@ -0,0 +1,239 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// DefaultProbePort is the UDP port gateway probe responders listen on.
+	DefaultProbePort int = 5010
+
+	// DefaultProbeTimeout is how long a probe waits for its reply.
+	DefaultProbeTimeout time.Duration = 2 * time.Second
+
+	// ProbeProtocolICMP probes with ICMP echo requests.
+	ProbeProtocolICMP string = "icmp"
+	// ProbeProtocolUDP probes a responder run by the gateway's GatewayWorker.
+	ProbeProtocolUDP string = "udp"
+)
+
+// probeMagic prefixes UDP probes so the responder ignores unrelated traffic.
+var probeMagic = []byte("OMPR")
+
+// probeNonceLen is the number of random bytes following probeMagic.
+const probeNonceLen int = 8
+
+// ErrProbeTimeout is returned when no reply to a probe arrives before the deadline.
+var ErrProbeTimeout = errors.New("probe timed out")
+
+// Prober checks that dst can be reached from src and that its reply comes back.
+type Prober interface {
+	Probe(ctx context.Context, src, dst net.IP) error
+}
+
+// ICMPProber probes with an ICMP echo request. It needs a raw socket, so the daemon
+// must run as root or with CAP_NET_RAW.
+type ICMPProber struct {
+	Timeout time.Duration
+}
+
+// Probe sends an ICMP echo request from src to dst and waits for the matching reply.
+func (p *ICMPProber) Probe(ctx context.Context, src, dst net.IP) error {
+	conn, err := icmp.ListenPacket("ip4:icmp", src.String())
+	if err != nil {
+		return fmt.Errorf("failed to open ICMP socket on %s: %w", src, err)
+	}
+	defer conn.Close()
+
+	id := os.Getpid() & 0xffff
+	seq := int(time.Now().UnixNano() & 0xffff)
+	msg := icmp.Message{
+		Type: ipv4.ICMPTypeEcho,
+		Body: &icmp.Echo{ID: id, Seq: seq, Data: probeMagic},
+	}
+
+	data, err := msg.Marshal(nil)
+	if err != nil {
+		return fmt.Errorf("failed to marshal ICMP echo: %w", err)
+	}
+
+	if err := conn.SetDeadline(probeDeadline(ctx, p.Timeout)); err != nil {
+		return err
+	}
+
+	if _, err := conn.WriteTo(data, &net.IPAddr{IP: dst}); err != nil {
+		return fmt.Errorf("failed to send ICMP echo to %s: %w", dst, err)
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			return probeReadError(dst, err)
+		}
+
+		if addr, ok := peer.(*net.IPAddr); !ok || !addr.IP.Equal(dst) {
+			continue
+		}
+
+		reply, err := icmp.ParseMessage(1, buf[:n])
+		if err != nil || reply.Type != ipv4.ICMPTypeEchoReply {
+			continue
+		}
+
+		if echo, ok := reply.Body.(*icmp.Echo); ok && echo.ID == id && echo.Seq == seq {
+			return nil
+		}
+	}
+}
+
+// UDPProber probes the UDP responder run on gateway nodes by ProbeResponder.
+type UDPProber struct {
+	Port    int
+	Timeout time.Duration
+}
+
+// Probe sends a UDP probe from src to the responder on dst and waits for the echo.
+func (p *UDPProber) Probe(ctx context.Context, src, dst net.IP) error {
+	port := p.Port
+	if port == 0 {
+		port = DefaultProbePort
+	}
+
+	conn, err := net.DialUDP("udp4", &net.UDPAddr{IP: src}, &net.UDPAddr{IP: dst, Port: port})
+	if err != nil {
+		return fmt.Errorf("failed to open UDP probe socket to %s: %w", dst, err)
+	}
+	defer conn.Close()
+
+	probe := make([]byte, len(probeMagic)+probeNonceLen)
+	copy(probe, probeMagic)
+	if _, err := rand.Read(probe[len(probeMagic):]); err != nil {
+		return fmt.Errorf("failed to generate probe nonce: %w", err)
+	}
+
+	if err := conn.SetDeadline(probeDeadline(ctx, p.Timeout)); err != nil {
+		return err
+	}
+
+	if _, err := conn.Write(probe); err != nil {
+		return fmt.Errorf("failed to send UDP probe to %s: %w", dst, err)
+	}
+
+	buf := make([]byte, 64)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return probeReadError(dst, err)
+		}
+
+		if bytes.Equal(buf[:n], probe) {
+			return nil
+		}
+	}
+}
+
+// ProbeResponder echoes UDP probes back to their sender. Gateways run it so that
+// clients can verify the return path with UDPProber.
+type ProbeResponder struct {
+	conn *net.UDPConn
+}
+
+// ListenProbeResponder opens a probe responder on port, bound to the named interface
+// so that it only answers probes arriving over the mesh.
+//
+// Returns an error if the socket cannot be opened or bound to the interface.
+//
+// Example:
+//
+//	responder, err := ListenProbeResponder("br-ahwlan", DefaultProbePort)
+//	if err != nil {
+//	    log.Fatalf("Failed to start probe responder: %v", err)
+//	}
+//	go responder.Serve(ctx)
+func ListenProbeResponder(iface string, port int) (*ProbeResponder, error) {
+	lc := net.ListenConfig{
+		Control: func(network, address string, c syscall.RawConn) error {
+			var sockErr error
+			if err := c.Control(func(fd uintptr) {
+				sockErr = unix.SetsockoptString(int(fd), unix.SOL_SOCKET, unix.SO_BINDTODEVICE, iface)
+			}); err != nil {
+				return err
+			}
+			return sockErr
+		},
+	}
+
+	pc, err := lc.ListenPacket(context.Background(), "udp4", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for probes on %s port %d: %w", iface, port, err)
+	}
+
+	return &ProbeResponder{conn: pc.(*net.UDPConn)}, nil
+}
+
+// Serve echoes probes until ctx is done. Packets without the probe prefix are ignored.
+func (r *ProbeResponder) Serve(ctx context.Context) error {
+	go func() {
+		<-ctx.Done()
+		r.conn.Close()
+	}()
+
+	buf := make([]byte, 64)
+	for {
+		n, peer, err := r.conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		if n != len(probeMagic)+probeNonceLen || !bytes.HasPrefix(buf[:n], probeMagic) {
+			continue
+		}
+
+		_, _ = r.conn.WriteToUDP(buf[:n], peer)
+	}
+}
+
+// Addr returns the address the responder is listening on.
+func (r *ProbeResponder) Addr() net.Addr {
+	return r.conn.LocalAddr()
+}
+
+// probeDeadline returns the earlier of ctx's deadline and now + timeout.
+func probeDeadline(ctx context.Context, timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		timeout = DefaultProbeTimeout
+	}
+
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		return d
+	}
+
+	return deadline
+}
+
+// probeReadError maps a read deadline to ErrProbeTimeout.
+func probeReadError(dst net.IP, err error) error {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return fmt.Errorf("%w: no reply from %s", ErrProbeTimeout, dst)
+	}
+
+	return fmt.Errorf("failed to read probe reply from %s: %w", dst, err)
+}
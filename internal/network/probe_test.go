@@ -0,0 +1,86 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestProbeResponder_UDPProbe(t *testing.T) {
+	responder, err := ListenProbeResponder("lo", 0)
+	if err != nil {
+		t.Skipf("cannot bind probe responder to lo: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- responder.Serve(ctx) }()
+
+	port := responder.Addr().(*net.UDPAddr).Port
+	prober := &UDPProber{Port: port, Timeout: time.Second}
+
+	loopback := net.ParseIP("127.0.0.1")
+	if err := prober.Probe(context.Background(), loopback, loopback); err != nil {
+		t.Errorf("Probe() error = %v", err)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Serve() error = %v after cancel", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Serve() did not return after cancel")
+	}
+}
+
+func TestUDPProbe_NoResponder(t *testing.T) {
+	// Find a port with nothing listening on it
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatalf("ListenUDP() error = %v", err)
+	}
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	conn.Close()
+
+	prober := &UDPProber{Port: port, Timeout: 100 * time.Millisecond}
+
+	loopback := net.ParseIP("127.0.0.1")
+	if err := prober.Probe(context.Background(), loopback, loopback); err == nil {
+		t.Error("Probe() error = nil, want an error without a responder")
+	}
+}
+
+func TestProbeDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if d := time.Until(probeDeadline(ctx, time.Minute)); d > time.Second {
+		t.Errorf("probeDeadline() = %v from now, want the earlier context deadline", d)
+	}
+
+	if d := time.Until(probeDeadline(context.Background(), 0)); d > DefaultProbeTimeout || d < DefaultProbeTimeout-time.Second {
+		t.Errorf("probeDeadline() = %v from now, want DefaultProbeTimeout", d)
+	}
+}
+
+func TestProbeReadError(t *testing.T) {
+	timeout := &net.OpError{Op: "read", Err: timeoutError{}}
+	if err := probeReadError(net.ParseIP("10.41.0.1"), timeout); !errors.Is(err, ErrProbeTimeout) {
+		t.Errorf("probeReadError() = %v, want ErrProbeTimeout", err)
+	}
+
+	refused := errors.New("connection refused")
+	if err := probeReadError(net.ParseIP("10.41.0.1"), refused); errors.Is(err, ErrProbeTimeout) || !errors.Is(err, refused) {
+		t.Errorf("probeReadError() = %v, want it to wrap the read error", err)
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
@@ -0,0 +1,150 @@
+package network
+
+import (
+	"errors"
+	"net"
+	"slices"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// DestClass says how the kernel would reach a destination, as seen from the mesh.
+type DestClass string
+
+const (
+	// MeshLocal destinations are on the mesh subnet, directly reachable over a
+	// mesh interface.
+	MeshLocal DestClass = "meshLocal"
+	// MeshRouted destinations are reached over a mesh interface, through a gateway
+	// or outside the mesh subnets, such as the LAN behind another node.
+	MeshRouted DestClass = "meshRouted"
+	// WAN destinations are reached over an interface that is not part of the mesh.
+	WAN DestClass = "wan"
+	// Unreachable destinations have no route, or a blackhole, unreachable or
+	// prohibit route.
+	Unreachable DestClass = "unreachable"
+	// Loopback destinations are this node itself.
+	Loopback DestClass = "loopback"
+)
+
+// ViaMesh reports whether traffic of class c leaves over a mesh interface.
+func (c DestClass) ViaMesh() bool {
+	return c == MeshLocal || c == MeshRouted
+}
+
+// DefaultMeshInterfaces are the interfaces that carry mesh traffic on a node with
+// the default configuration.
+var DefaultMeshInterfaces = []string{DefaultInterfaceName, "bat0"}
+
+// MeshSubnet returns the IPv4 subnet addresses are reserved from, 10.41.0.0/16.
+func MeshSubnet() *net.IPNet {
+	return &net.IPNet{
+		IP:   net.ParseIP(DefaultNetworkAddress).To4(),
+		Mask: net.IPMask(net.ParseIP(DefaultNetworkMask).To4()),
+	}
+}
+
+// MeshULASubnet returns the IPv6 ULA prefix of the mesh.
+func MeshULASubnet() *net.IPNet {
+	_, subnet, _ := net.ParseCIDR(DefaultULAPrefix)
+	return subnet
+}
+
+// DefaultMeshSubnets returns the subnets of the mesh on a node with the default
+// configuration.
+func DefaultMeshSubnets() []*net.IPNet {
+	return []*net.IPNet{MeshSubnet(), MeshULASubnet()}
+}
+
+// routeGet and linkNameByIndex are overridable for tests.
+var (
+	routeGet        = netlink.RouteGet
+	linkNameByIndex = func(index int) (string, error) {
+		link, err := netlink.LinkByIndex(index)
+		if err != nil {
+			return "", err
+		}
+		return link.Attrs().Name, nil
+	}
+)
+
+// unreachableErrnos are the errors a route lookup fails with when the destination
+// matches an unreachable, prohibit or blackhole route.
+var unreachableErrnos = []unix.Errno{unix.ENETUNREACH, unix.EHOSTUNREACH, unix.EACCES, unix.EINVAL}
+
+// ClassifyDestinationOn returns how the kernel would reach ip, with meshIfaces and
+// meshSubnets making up the mesh. It interprets the route of GetRouteToDestination.
+//
+// Parameters:
+//   - ip: The destination to classify
+//   - meshIfaces: The interfaces that carry mesh traffic, e.g. br-ahwlan and bat0
+//   - meshSubnets: The subnets whose addresses are directly reachable over the mesh
+//
+// Returns:
+//   - The class of the destination
+//   - The route the kernel selected, nil if there is none
+//   - An error if the route lookup failed for another reason than the destination
+//     being unreachable
+//
+// Example:
+//
+//	class, route, err := ClassifyDestinationOn(peer, []string{"br-ahwlan"}, DefaultMeshSubnets())
+//	if err == nil && class == WAN {
+//	    log.Printf("%s leaves the mesh through %s", peer, route.Interface)
+//	}
+func ClassifyDestinationOn(ip net.IP, meshIfaces []string, meshSubnets []*net.IPNet) (DestClass, *Route, error) {
+	if ip.IsLoopback() {
+		return Loopback, nil, nil
+	}
+
+	route, rtType, err := routeToDestination(ip)
+	if err != nil {
+		var errno unix.Errno
+		if errors.Is(err, ErrNoRouteFound) || (errors.As(err, &errno) && slices.Contains(unreachableErrnos, errno)) {
+			return Unreachable, nil, nil
+		}
+		return "", nil, err
+	}
+
+	switch rtType {
+	case unix.RTN_LOCAL:
+		return Loopback, route, nil
+	case unix.RTN_BLACKHOLE, unix.RTN_UNREACHABLE, unix.RTN_PROHIBIT:
+		return Unreachable, route, nil
+	}
+
+	if !slices.Contains(meshIfaces, route.Interface) {
+		return WAN, route, nil
+	}
+
+	inMesh := slices.ContainsFunc(meshSubnets, func(subnet *net.IPNet) bool { return subnet.Contains(ip) })
+	if route.Gateway == nil && inMesh {
+		return MeshLocal, route, nil
+	}
+	return MeshRouted, route, nil
+}
+
+// ClassifyDestination returns how the kernel would reach ip on a node with the
+// default mesh interfaces and subnets. See ClassifyDestinationOn.
+func ClassifyDestination(ip net.IP) (DestClass, *Route, error) {
+	return ClassifyDestinationOn(ip, DefaultMeshInterfaces, DefaultMeshSubnets())
+}
+
+// IsReachableViaMesh reports whether the kernel would send traffic for ip over one of
+// meshIfaces. The route is returned whenever the kernel selected one.
+//
+// Example:
+//
+//	ok, _, err := IsReachableViaMesh(peer, []string{"br-ahwlan", "bat0"}, DefaultMeshSubnets())
+//	if err == nil && !ok {
+//	    log.Printf("%s is not reachable over the mesh", peer)
+//	}
+func IsReachableViaMesh(ip net.IP, meshIfaces []string, meshSubnets []*net.IPNet) (bool, *Route, error) {
+	class, route, err := ClassifyDestinationOn(ip, meshIfaces, meshSubnets)
+	if err != nil {
+		return false, nil, err
+	}
+
+	return class.ViaMesh(), route, nil
+}
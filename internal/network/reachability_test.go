@@ -0,0 +1,184 @@
+package network
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// fakeRouteGet makes route lookups return routes, or fail with err.
+func fakeRouteGet(t *testing.T, routes []netlink.Route, err error) {
+	t.Helper()
+
+	oldGet, oldName := routeGet, linkNameByIndex
+	t.Cleanup(func() { routeGet, linkNameByIndex = oldGet, oldName })
+
+	routeGet = func(net.IP) ([]netlink.Route, error) { return routes, err }
+	linkNameByIndex = func(index int) (string, error) {
+		names := map[int]string{1: "lo", 2: "eth0", 3: "br-ahwlan", 4: "bat0"}
+		if name, ok := names[index]; ok {
+			return name, nil
+		}
+		return "", errors.New("link not found")
+	}
+}
+
+func TestClassifyDestination(t *testing.T) {
+	meshIfaces := []string{"br-ahwlan", "bat0"}
+
+	tests := []struct {
+		name      string
+		ip        string
+		routes    []netlink.Route
+		err       error
+		want      DestClass
+		wantIface string
+	}{
+		{
+			name:      "peer on the mesh subnet",
+			ip:        "10.41.3.7",
+			routes:    []netlink.Route{{LinkIndex: 3, Type: unix.RTN_UNICAST}},
+			want:      MeshLocal,
+			wantIface: "br-ahwlan",
+		},
+		{
+			name:      "ULA peer on bat0",
+			ip:        "fd01:ed20:ecb4::7",
+			routes:    []netlink.Route{{LinkIndex: 4, Type: unix.RTN_UNICAST}},
+			want:      MeshLocal,
+			wantIface: "bat0",
+		},
+		{
+			name:      "LAN behind a mesh gateway",
+			ip:        "192.168.50.10",
+			routes:    []netlink.Route{{LinkIndex: 3, Gw: net.ParseIP("10.41.0.1"), Type: unix.RTN_UNICAST}},
+			want:      MeshRouted,
+			wantIface: "br-ahwlan",
+		},
+		{
+			name:      "on-link outside the mesh subnets",
+			ip:        "192.168.50.10",
+			routes:    []netlink.Route{{LinkIndex: 3, Type: unix.RTN_UNICAST}},
+			want:      MeshRouted,
+			wantIface: "br-ahwlan",
+		},
+		{
+			name:      "mesh address routed over the WAN",
+			ip:        "10.41.3.7",
+			routes:    []netlink.Route{{LinkIndex: 2, Gw: net.ParseIP("192.168.1.1"), Type: unix.RTN_UNICAST}},
+			want:      WAN,
+			wantIface: "eth0",
+		},
+		{
+			name:      "internet via WAN",
+			ip:        "8.8.8.8",
+			routes:    []netlink.Route{{LinkIndex: 2, Gw: net.ParseIP("192.168.1.1"), Type: unix.RTN_UNICAST}},
+			want:      WAN,
+			wantIface: "eth0",
+		},
+		{
+			name:      "own address",
+			ip:        "10.41.3.1",
+			routes:    []netlink.Route{{LinkIndex: 1, Type: unix.RTN_LOCAL}},
+			want:      Loopback,
+			wantIface: "lo",
+		},
+		{
+			name: "loopback address",
+			ip:   "127.0.0.1",
+			want: Loopback,
+		},
+		{
+			name:   "blackhole route",
+			ip:     "10.99.0.1",
+			routes: []netlink.Route{{Type: unix.RTN_BLACKHOLE}},
+			want:   Unreachable,
+		},
+		{
+			name: "blackhole rejected by the kernel",
+			ip:   "10.99.0.1",
+			err:  unix.EINVAL,
+			want: Unreachable,
+		},
+		{
+			name: "no route to host",
+			ip:   "10.99.0.1",
+			err:  unix.EHOSTUNREACH,
+			want: Unreachable,
+		},
+		{
+			name: "network unreachable",
+			ip:   "10.99.0.1",
+			err:  unix.ENETUNREACH,
+			want: Unreachable,
+		},
+		{
+			name: "empty answer",
+			ip:   "10.99.0.1",
+			want: Unreachable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeRouteGet(t, tt.routes, tt.err)
+
+			class, route, err := ClassifyDestinationOn(net.ParseIP(tt.ip), meshIfaces, DefaultMeshSubnets())
+			if err != nil {
+				t.Fatalf("ClassifyDestinationOn() error = %v", err)
+			}
+			if class != tt.want {
+				t.Errorf("ClassifyDestinationOn() = %q, want %q", class, tt.want)
+			}
+			if tt.wantIface != "" && (route == nil || route.Interface != tt.wantIface) {
+				t.Errorf("route = %s, want one via %s", route, tt.wantIface)
+			}
+
+			ok, _, err := IsReachableViaMesh(net.ParseIP(tt.ip), meshIfaces, DefaultMeshSubnets())
+			if err != nil || ok != tt.want.ViaMesh() {
+				t.Errorf("IsReachableViaMesh() = %v, %v; want %v", ok, err, tt.want.ViaMesh())
+			}
+		})
+	}
+}
+
+func TestClassifyDestination_Errors(t *testing.T) {
+	fakeRouteGet(t, nil, unix.EPERM)
+	if _, _, err := ClassifyDestination(net.ParseIP("10.41.0.1")); !errors.Is(err, unix.EPERM) {
+		t.Errorf("ClassifyDestination() error = %v, want EPERM", err)
+	}
+
+	fakeRouteGet(t, []netlink.Route{{LinkIndex: 99}}, nil)
+	if _, _, err := ClassifyDestination(net.ParseIP("10.41.0.1")); !errors.Is(err, ErrInterfaceNotFound) {
+		t.Errorf("ClassifyDestination() error = %v, want ErrInterfaceNotFound", err)
+	}
+}
+
+func TestGetRouteToDestination_Fake(t *testing.T) {
+	fakeRouteGet(t, []netlink.Route{{LinkIndex: 3, Priority: 10, Table: unix.RT_TABLE_MAIN}}, nil)
+
+	route, err := GetRouteToDestination(net.ParseIP("10.41.0.1"))
+	if err != nil {
+		t.Fatalf("GetRouteToDestination() error = %v", err)
+	}
+	if route.Interface != "br-ahwlan" || route.Metric != 10 || route.Table != unix.RT_TABLE_MAIN {
+		t.Errorf("GetRouteToDestination() = %s", route)
+	}
+
+	fakeRouteGet(t, nil, nil)
+	if _, err := GetRouteToDestination(net.ParseIP("10.41.0.1")); !errors.Is(err, ErrNoRouteFound) {
+		t.Errorf("GetRouteToDestination() error = %v, want ErrNoRouteFound", err)
+	}
+}
+
+func TestMeshSubnet(t *testing.T) {
+	if got := MeshSubnet().String(); got != "10.41.0.0/16" {
+		t.Errorf("MeshSubnet() = %s, want 10.41.0.0/16", got)
+	}
+	if got := MeshULASubnet().String(); got != DefaultULAPrefix {
+		t.Errorf("MeshULASubnet() = %s, want %s", got, DefaultULAPrefix)
+	}
+}
@@ -1,10 +1,14 @@
 package network
 
 import (
+	"cmp"
 	"errors"
 	"fmt"
 	"net"
+	"slices"
+	"strings"
 
+	"github.com/openmanet/openmanetd/internal/safemode"
 	"github.com/vishvananda/netlink"
 	"golang.org/x/sys/unix"
 )
@@ -26,6 +30,8 @@ var (
 //   - Table: The routing table ID (e.g., unix.RT_TABLE_MAIN for the main table).
 //   - Scope: The scope of the route (e.g., netlink.SCOPE_UNIVERSE for global routes).
 //   - Protocol: The routing protocol that installed this route (e.g., RTPROT_BOOT, RTPROT_STATIC).
+//   - NextHops: The next hops of a multipath route, which the kernel balances traffic
+//     across. Gateway and Interface are empty when it is set.
 type Route struct {
 	Destination *net.IPNet
 	Gateway     net.IP
@@ -34,6 +40,61 @@ type Route struct {
 	Table       int
 	Scope       netlink.Scope
 	Protocol    netlink.RouteProtocol
+	NextHops    []NextHop
+}
+
+// RouteTable is the view of the kernel routing tables used to reconcile routes.
+// KernelRouteTable implements it with netlink; tests substitute their own.
+type RouteTable interface {
+	GetRoutes(table int) ([]*Route, error)
+	AddRoute(route *Route) error
+	DeleteRoute(route *Route) error
+}
+
+// KernelRouteTable is the RouteTable backed by the kernel routing tables.
+type KernelRouteTable struct {
+	// Handle is the netlink handle routes are read and written through, e.g. a
+	// *netlink.Handle opened in another network namespace, or a fake in tests. nil
+	// uses the current namespace, as the package-level functions do.
+	Handle Netlinker
+}
+
+// handle returns t.Handle, or NewNetlinker if it is nil.
+func (t KernelRouteTable) handle() Netlinker {
+	if t.Handle == nil {
+		return NewNetlinker()
+	}
+	return t.Handle
+}
+
+// toNetlinkRoute converts route, looking up its interface, or those of its next
+// hops, through h.
+func toNetlinkRoute(h Netlinker, route *Route) (*netlink.Route, error) {
+	nlRoute := &netlink.Route{
+		Dst:      route.Destination,
+		Gw:       route.Gateway,
+		Priority: route.Metric,
+		Table:    route.Table,
+		Scope:    route.Scope,
+		Protocol: route.Protocol,
+	}
+
+	if len(route.NextHops) > 0 {
+		multipath, err := toNetlinkNextHops(h, route.NextHops)
+		if err != nil {
+			return nil, err
+		}
+		nlRoute.MultiPath = multipath
+		return nlRoute, nil
+	}
+
+	link, err := h.LinkByName(route.Interface)
+	if err != nil {
+		return nil, newInterfaceNotFoundError(route.Interface, err)
+	}
+	nlRoute.LinkIndex = link.Attrs().Index
+
+	return nlRoute, nil
 }
 
 // AddRoute adds a new route to the kernel routing table.
@@ -53,26 +114,27 @@ type Route struct {
 //
 // Note: This operation requires appropriate privileges (typically root/CAP_NET_ADMIN).
 func AddRoute(route *Route) error {
+	return KernelRouteTable{}.AddRoute(route)
+}
+
+// AddRoute adds route to the kernel routing table through t's handle. See AddRoute.
+func (t KernelRouteTable) AddRoute(route *Route) error {
 	if route == nil {
-		return fmt.Errorf("route cannot be nil")
+		return newValidationError("route cannot be nil")
 	}
 
-	link, err := netlink.LinkByName(route.Interface)
-	if err != nil {
-		return fmt.Errorf("failed to get interface %s: %w", route.Interface, err)
+	if err := safemode.Check(fmt.Sprintf("add route %s", route)); err != nil {
+		return err
 	}
 
-	nlRoute := &netlink.Route{
-		LinkIndex: link.Attrs().Index,
-		Dst:       route.Destination,
-		Gw:        route.Gateway,
-		Priority:  route.Metric,
-		Table:     route.Table,
-		Scope:     route.Scope,
-		Protocol:  route.Protocol,
+	h := t.handle()
+
+	nlRoute, err := toNetlinkRoute(h, route)
+	if err != nil {
+		return err
 	}
 
-	if err := netlink.RouteAdd(nlRoute); err != nil {
+	if err := h.RouteAdd(nlRoute); err != nil {
 		return fmt.Errorf("failed to add route: %w", err)
 	}
 
@@ -99,26 +161,28 @@ func AddRoute(route *Route) error {
 //
 // Note: This operation requires appropriate privileges (typically root/CAP_NET_ADMIN).
 func DeleteRoute(route *Route) error {
+	return KernelRouteTable{}.DeleteRoute(route)
+}
+
+// DeleteRoute deletes route from the kernel routing table through t's handle. See
+// DeleteRoute.
+func (t KernelRouteTable) DeleteRoute(route *Route) error {
 	if route == nil {
-		return fmt.Errorf("route cannot be nil")
+		return newValidationError("route cannot be nil")
 	}
 
-	link, err := netlink.LinkByName(route.Interface)
-	if err != nil {
-		return fmt.Errorf("failed to get interface %s: %w", route.Interface, err)
+	if err := safemode.Check(fmt.Sprintf("delete route %s", route)); err != nil {
+		return err
 	}
 
-	nlRoute := &netlink.Route{
-		LinkIndex: link.Attrs().Index,
-		Dst:       route.Destination,
-		Gw:        route.Gateway,
-		Priority:  route.Metric,
-		Table:     route.Table,
-		Scope:     route.Scope,
-		Protocol:  route.Protocol,
+	h := t.handle()
+
+	nlRoute, err := toNetlinkRoute(h, route)
+	if err != nil {
+		return err
 	}
 
-	if err := netlink.RouteDel(nlRoute); err != nil {
+	if err := h.RouteDel(nlRoute); err != nil {
 		return fmt.Errorf("failed to delete route: %w", err)
 	}
 
@@ -126,14 +190,24 @@ func DeleteRoute(route *Route) error {
 }
 
 // ReplaceRoute replaces an existing route or adds it if it doesn't exist.
-// This is an atomic operation that either updates an existing matching route
-// or creates a new one if no match is found.
+//
+// Deprecated: ReplaceRoute is ReplaceRouteExact. Use ReplaceRouteExact when the
+// route to update has a known metric, or ReplaceRouteByDestination to end up with a
+// single route to the destination.
+func ReplaceRoute(route *Route) error {
+	return ReplaceRouteExact(route)
+}
+
+// ReplaceRouteExact replaces the route with the same destination, table and metric,
+// or adds the route if there is none. This is an atomic operation.
 //
 // It returns an error if the route is nil, the interface doesn't exist,
 // or the operation fails.
 //
-// This is useful when you want to ensure a route exists with specific parameters
-// without worrying about whether it already exists or not.
+// The kernel identifies the route to replace by destination, table and metric only.
+// A route to the same destination with a different metric is a different route, so
+// when the metric changes the old route is kept and a second one is added. Use
+// ReplaceRouteByDestination to replace every route we own to the destination.
 //
 // Example:
 //
@@ -144,17 +218,26 @@ func DeleteRoute(route *Route) error {
 //	    Metric:      100,
 //	    Table:       unix.RT_TABLE_MAIN,
 //	}
-//	err := ReplaceRoute(route)
+//	err := ReplaceRouteExact(route)
 //
 // Note: This operation requires appropriate privileges (typically root/CAP_NET_ADMIN).
-func ReplaceRoute(route *Route) error {
+func ReplaceRouteExact(route *Route) error {
+	return ReplaceRouteExactWithNetlinker(route, NewNetlinker())
+}
+
+// ReplaceRouteExactWithNetlinker replaces a route through the provided netlinker.
+func ReplaceRouteExactWithNetlinker(route *Route, nl Netlinker) error {
 	if route == nil {
-		return fmt.Errorf("route cannot be nil")
+		return newValidationError("route cannot be nil")
+	}
+
+	if err := safemode.Check(fmt.Sprintf("replace route %s", route)); err != nil {
+		return err
 	}
 
-	link, err := netlink.LinkByName(route.Interface)
+	link, err := nl.LinkByName(route.Interface)
 	if err != nil {
-		return fmt.Errorf("failed to get interface %s: %w", route.Interface, err)
+		return newInterfaceNotFoundError(route.Interface, err)
 	}
 
 	nlRoute := &netlink.Route{
@@ -167,13 +250,81 @@ func ReplaceRoute(route *Route) error {
 		Protocol:  route.Protocol,
 	}
 
-	if err := netlink.RouteReplace(nlRoute); err != nil {
+	if err := nl.RouteReplace(nlRoute); err != nil {
 		return fmt.Errorf("failed to replace route: %w", err)
 	}
 
 	return nil
 }
 
+// ReplaceRouteByDestination makes route the only route we own to its destination in
+// its table. Routes we own are those tagged with RouteProtocolOpenMANET; the new
+// route is installed with that tag. Every other owned route to the destination is
+// deleted first, whatever its metric or gateway, and an owned route identical to
+// the new one is kept rather than re-added. Routes to the destination added by the
+// kernel, netifd or an administrator are left alone.
+//
+// A nil destination is the default route of the gateway's address family.
+//
+// Returns an error if the route is nil, the table cannot be listed, or a route
+// cannot be deleted or added. Deletion failures do not stop the new route from
+// being added.
+//
+// Example:
+//
+//	err := ReplaceRouteByDestination(&Route{
+//	    Gateway:   net.ParseIP("10.41.0.1"),
+//	    Interface: "br-ahwlan",
+//	    Metric:    10,
+//	    Table:     unix.RT_TABLE_MAIN,
+//	})
+//
+// Note: This operation requires appropriate privileges (typically root/CAP_NET_ADMIN).
+func ReplaceRouteByDestination(route *Route) error {
+	return ReplaceRouteByDestinationWithRouteTable(route, KernelRouteTable{})
+}
+
+// ReplaceRouteByDestinationWithRouteTable replaces the owned routes to a destination
+// using the provided route table.
+func ReplaceRouteByDestinationWithRouteTable(route *Route, routes RouteTable) error {
+	if route == nil {
+		return newValidationError("route cannot be nil")
+	}
+
+	owned := *route
+	owned.Protocol = RouteProtocolOpenMANET
+
+	current, err := routes.GetRoutes(owned.Table)
+	if err != nil {
+		return err
+	}
+
+	var (
+		installed bool
+		errs      []error
+	)
+	for _, r := range current {
+		if r.Protocol != RouteProtocolOpenMANET || !sameDestination(r, &owned) {
+			continue
+		}
+		if !installed && SameRoute(r, &owned) {
+			installed = true
+			continue
+		}
+		if err := routes.DeleteRoute(r); err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete route %s: %w", r, err))
+		}
+	}
+
+	if !installed {
+		if err := routes.AddRoute(&owned); err != nil {
+			errs = append(errs, fmt.Errorf("failed to add route %s: %w", &owned, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
 // GetRoutes returns all routes from the specified routing table.
 // It queries the kernel for routes in the given table and returns them as a slice
 // of Route pointers. Routes for interfaces that cannot be found are silently skipped.
@@ -195,18 +346,47 @@ func ReplaceRoute(route *Route) error {
 //	    fmt.Println(route.String())
 //	}
 func GetRoutes(table int) ([]*Route, error) {
+	return KernelRouteTable{}.GetRoutes(table)
+}
+
+// GetRoutes returns the routes of table through t's handle. See GetRoutes.
+func (t KernelRouteTable) GetRoutes(table int) ([]*Route, error) {
+	h := t.handle()
+
 	filter := &netlink.Route{
 		Table: table,
 	}
 
-	nlRoutes, err := netlink.RouteListFiltered(netlink.FAMILY_ALL, filter, netlink.RT_FILTER_TABLE)
+	nlRoutes, err := h.RouteListFiltered(netlink.FAMILY_ALL, filter, netlink.RT_FILTER_TABLE)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list routes: %w", err)
 	}
 
 	routes := make([]*Route, 0, len(nlRoutes))
 	for _, nlRoute := range nlRoutes {
-		link, err := netlink.LinkByIndex(nlRoute.LinkIndex)
+		if len(nlRoute.MultiPath) > 0 {
+			nextHops, err := fromNetlinkNextHops(nlRoute.MultiPath, func(index int) (string, error) {
+				link, err := h.LinkByIndex(index)
+				if err != nil {
+					return "", err
+				}
+				return link.Attrs().Name, nil
+			})
+			if err != nil {
+				continue // Skip routes for interfaces we can't find
+			}
+			routes = append(routes, &Route{
+				Destination: nlRoute.Dst,
+				Metric:      nlRoute.Priority,
+				Table:       nlRoute.Table,
+				Scope:       nlRoute.Scope,
+				Protocol:    nlRoute.Protocol,
+				NextHops:    nextHops,
+			})
+			continue
+		}
+
+		link, err := h.LinkByIndex(nlRoute.LinkIndex)
 		if err != nil {
 			continue // Skip routes for interfaces we can't find
 		}
@@ -245,14 +425,20 @@ func GetRoutes(table int) ([]*Route, error) {
 // Note: This can return a large number of routes on systems with many interfaces
 // or complex routing configurations.
 func GetAllRoutes() ([]*Route, error) {
-	nlRoutes, err := netlink.RouteList(nil, netlink.FAMILY_ALL)
+	return GetAllRoutesWithNetlinker(NewNetlinker())
+}
+
+// GetAllRoutesWithNetlinker returns the routes of every table through the provided
+// netlinker.
+func GetAllRoutesWithNetlinker(nl Netlinker) ([]*Route, error) {
+	nlRoutes, err := nl.RouteList(nil, netlink.FAMILY_ALL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list routes: %w", err)
 	}
 
 	routes := make([]*Route, 0, len(nlRoutes))
 	for _, nlRoute := range nlRoutes {
-		link, err := netlink.LinkByIndex(nlRoute.LinkIndex)
+		link, err := nl.LinkByIndex(nlRoute.LinkIndex)
 		if err != nil {
 			continue // Skip routes for interfaces we can't find
 		}
@@ -272,6 +458,20 @@ func GetAllRoutes() ([]*Route, error) {
 	return routes, nil
 }
 
+// GetRules returns the policy routing rules of both address families.
+//
+// Returns:
+//   - The rules in the order the kernel evaluates them
+//   - An error if the kernel query fails
+func GetRules() ([]netlink.Rule, error) {
+	rules, err := netlink.RuleList(netlink.FAMILY_ALL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rules: %w", err)
+	}
+
+	return rules, nil
+}
+
 // GetDefaultRoute returns the default IPv4 route from the main routing table.
 // The default route is identified by having no destination (0.0.0.0/0) and a gateway.
 // If multiple default routes exist in the main table, the one with the lowest metric
@@ -293,11 +493,17 @@ func GetAllRoutes() ([]*Route, error) {
 // Note: This function only looks for IPv4 default routes in the main routing table.
 // For IPv6 or routes in other tables, separate functions would be needed.
 func GetDefaultRoute() (*Route, error) {
+	return GetDefaultRouteWithNetlinker(NewNetlinker())
+}
+
+// GetDefaultRouteWithNetlinker returns the default IPv4 route through the provided
+// netlinker.
+func GetDefaultRouteWithNetlinker(nl Netlinker) (*Route, error) {
 	filter := &netlink.Route{
 		Table: unix.RT_TABLE_MAIN,
 	}
 
-	routes, err := netlink.RouteListFiltered(netlink.FAMILY_V4, filter, netlink.RT_FILTER_TABLE)
+	routes, err := nl.RouteListFiltered(netlink.FAMILY_V4, filter, netlink.RT_FILTER_TABLE)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list routes: %w", err)
 	}
@@ -314,7 +520,7 @@ func GetDefaultRoute() (*Route, error) {
 	for _, nlRoute := range routes {
 		// Default route has no destination and must have a gateway
 		if nlRoute.Dst != nil && nlRoute.Dst.String() == defaultDest.String() && nlRoute.Gw != nil {
-			link, err := netlink.LinkByIndex(nlRoute.LinkIndex)
+			link, err := nl.LinkByIndex(nlRoute.LinkIndex)
 			if err != nil {
 				continue
 			}
@@ -342,6 +548,52 @@ func GetDefaultRoute() (*Route, error) {
 	return defaultRoute, nil
 }
 
+// GetDefaultRoutes returns every IPv4 default route (0.0.0.0/0) in every routing
+// table, ordered by metric and then table, so that the lowest metric comes first.
+// Unlike GetDefaultRoute it includes routes without a gateway, such as those of a
+// point-to-point WAN link, and the Protocol of each route tells who installed it,
+// e.g. one added by a DHCP client on the WAN next to the one we own through the
+// selected gateway.
+//
+// Returns:
+//   - The default routes, none if there are none
+//   - An error if the kernel query fails
+//
+// Example:
+//
+//	routes, err := GetDefaultRoutes()
+//	for _, r := range routes {
+//	    if r.Table == unix.RT_TABLE_MAIN && r.Protocol != RouteProtocolOpenMANET {
+//	        fmt.Printf("Competing default route %s (proto %d)\n", r, r.Protocol)
+//	    }
+//	}
+func GetDefaultRoutes() ([]*Route, error) {
+	return GetDefaultRoutesWithRouteTable(KernelRouteTable{})
+}
+
+// GetDefaultRoutesWithRouteTable returns the IPv4 default routes of the provided
+// route table.
+func GetDefaultRoutesWithRouteTable(routes RouteTable) ([]*Route, error) {
+	current, err := routes.GetRoutes(unix.RT_TABLE_UNSPEC)
+	if err != nil {
+		return nil, err
+	}
+
+	defaultRoute := &Route{Destination: &net.IPNet{IP: net.IPv4zero, Mask: net.CIDRMask(0, 32)}}
+
+	var defaults []*Route
+	for _, r := range current {
+		if sameDestination(r, defaultRoute) {
+			defaults = append(defaults, r)
+		}
+	}
+	slices.SortStableFunc(defaults, func(a, b *Route) int {
+		return cmp.Or(cmp.Compare(a.Metric, b.Metric), cmp.Compare(a.Table, b.Table))
+	})
+
+	return defaults, nil
+}
+
 // AddDefaultRoute adds a default route (0.0.0.0/0) via the specified gateway and interface.
 // The route is added to the main routing table (RT_TABLE_MAIN).
 //
@@ -361,9 +613,18 @@ func GetDefaultRoute() (*Route, error) {
 //
 // Note: This operation requires appropriate privileges (typically root/CAP_NET_ADMIN).
 func AddDefaultRoute(gateway net.IP, iface string, metric int) error {
-	link, err := netlink.LinkByName(iface)
+	return AddDefaultRouteWithNetlinker(gateway, iface, metric, NewNetlinker())
+}
+
+// AddDefaultRouteWithNetlinker adds a default route through the provided netlinker.
+func AddDefaultRouteWithNetlinker(gateway net.IP, iface string, metric int, nl Netlinker) error {
+	if err := safemode.Check(fmt.Sprintf("add default route via %s dev %s", gateway, iface)); err != nil {
+		return err
+	}
+
+	link, err := nl.LinkByName(iface)
 	if err != nil {
-		return fmt.Errorf("failed to get interface %s: %w", iface, err)
+		return newInterfaceNotFoundError(iface, err)
 	}
 
 	route := &netlink.Route{
@@ -373,7 +634,7 @@ func AddDefaultRoute(gateway net.IP, iface string, metric int) error {
 		Table:     unix.RT_TABLE_MAIN,
 	}
 
-	if err := netlink.RouteAdd(route); err != nil {
+	if err := nl.RouteAdd(route); err != nil {
 		return fmt.Errorf("failed to add default route: %w", err)
 	}
 
@@ -397,9 +658,18 @@ func AddDefaultRoute(gateway net.IP, iface string, metric int) error {
 //
 // Note: This operation requires appropriate privileges (typically root/CAP_NET_ADMIN).
 func DeleteDefaultRoute(gateway net.IP, iface string) error {
-	link, err := netlink.LinkByName(iface)
+	return DeleteDefaultRouteWithNetlinker(gateway, iface, NewNetlinker())
+}
+
+// DeleteDefaultRouteWithNetlinker deletes a default route through the provided netlinker.
+func DeleteDefaultRouteWithNetlinker(gateway net.IP, iface string, nl Netlinker) error {
+	if err := safemode.Check(fmt.Sprintf("delete default route via %s dev %s", gateway, iface)); err != nil {
+		return err
+	}
+
+	link, err := nl.LinkByName(iface)
 	if err != nil {
-		return fmt.Errorf("failed to get interface %s: %w", iface, err)
+		return newInterfaceNotFoundError(iface, err)
 	}
 
 	route := &netlink.Route{
@@ -407,7 +677,7 @@ func DeleteDefaultRoute(gateway net.IP, iface string) error {
 		Gw:        gateway,
 	}
 
-	if err := netlink.RouteDel(route); err != nil {
+	if err := nl.RouteDel(route); err != nil {
 		return fmt.Errorf("failed to delete default route: %w", err)
 	}
 
@@ -440,15 +710,25 @@ func DeleteDefaultRoute(gateway net.IP, iface string) error {
 // The function preserves the existing route's interface and metric while only changing
 // the gateway address.
 func ReplaceDefaultRoute(newGateway net.IP, iface string) error {
+	return ReplaceDefaultRouteWithNetlinker(newGateway, iface, NewNetlinker())
+}
+
+// ReplaceDefaultRouteWithNetlinker replaces the default route through the provided
+// netlinker.
+func ReplaceDefaultRouteWithNetlinker(newGateway net.IP, iface string, nl Netlinker) error {
+	if err := safemode.Check(fmt.Sprintf("replace default route via %s dev %s", newGateway, iface)); err != nil {
+		return err
+	}
+
 	// Get the current default route
-	currentRoute, err := GetDefaultRoute()
+	currentRoute, err := GetDefaultRouteWithNetlinker(nl)
 	if err != nil && !errors.Is(err, ErrNoDefaultRouteFound) {
 		return fmt.Errorf("failed to get current default route: %w", err)
 	}
 
 	// If no default route exists, add a new one with the specified gateway
 	if errors.Is(err, ErrNoDefaultRouteFound) {
-		return AddDefaultRoute(newGateway, iface, 10)
+		return AddDefaultRouteWithNetlinker(newGateway, iface, 10, nl)
 	}
 
 	// If the current route's gateway matches the new gateway, no action is needed
@@ -457,9 +737,9 @@ func ReplaceDefaultRoute(newGateway net.IP, iface string) error {
 	}
 
 	// Get the interface
-	link, err := netlink.LinkByName(currentRoute.Interface)
+	link, err := nl.LinkByName(currentRoute.Interface)
 	if err != nil {
-		return fmt.Errorf("failed to get interface %s: %w", currentRoute.Interface, err)
+		return newInterfaceNotFoundError(currentRoute.Interface, err)
 	}
 
 	// Create the new default route with the new gateway
@@ -473,7 +753,7 @@ func ReplaceDefaultRoute(newGateway net.IP, iface string) error {
 	}
 
 	// Replace the route atomically
-	if err := netlink.RouteReplace(route); err != nil {
+	if err := nl.RouteReplace(route); err != nil {
 		return fmt.Errorf("failed to replace default route: %w", err)
 	}
 
@@ -500,18 +780,28 @@ func ReplaceDefaultRoute(newGateway net.IP, iface string) error {
 // Warning: This is a destructive operation that will remove ALL routes for the interface.
 // Note: This operation requires appropriate privileges (typically root/CAP_NET_ADMIN).
 func FlushRoutes(iface string) error {
-	link, err := netlink.LinkByName(iface)
+	return FlushRoutesWithNetlinker(iface, NewNetlinker())
+}
+
+// FlushRoutesWithNetlinker removes the routes of an interface through the provided
+// netlinker.
+func FlushRoutesWithNetlinker(iface string, nl Netlinker) error {
+	if err := safemode.Check("flush routes dev " + iface); err != nil {
+		return err
+	}
+
+	link, err := nl.LinkByName(iface)
 	if err != nil {
-		return fmt.Errorf("failed to get interface %s: %w", iface, err)
+		return newInterfaceNotFoundError(iface, err)
 	}
 
-	routes, err := netlink.RouteList(link, netlink.FAMILY_ALL)
+	routes, err := nl.RouteList(link, netlink.FAMILY_ALL)
 	if err != nil {
 		return fmt.Errorf("failed to list routes: %w", err)
 	}
 
 	for _, route := range routes {
-		if err := netlink.RouteDel(&route); err != nil {
+		if err := nl.RouteDel(&route); err != nil {
 			// Continue even if some routes fail to delete
 			continue
 		}
@@ -541,17 +831,27 @@ func FlushRoutes(iface string) error {
 // Be especially careful when flushing RT_TABLE_MAIN as it contains the system's main routes.
 // Note: This operation requires appropriate privileges (typically root/CAP_NET_ADMIN).
 func FlushRoutesInTable(table int) error {
+	return FlushRoutesInTableWithNetlinker(table, NewNetlinker())
+}
+
+// FlushRoutesInTableWithNetlinker removes the routes of a table through the provided
+// netlinker.
+func FlushRoutesInTableWithNetlinker(table int, nl Netlinker) error {
+	if err := safemode.Check(fmt.Sprintf("flush routes table %d", table)); err != nil {
+		return err
+	}
+
 	filter := &netlink.Route{
 		Table: table,
 	}
 
-	routes, err := netlink.RouteListFiltered(netlink.FAMILY_ALL, filter, netlink.RT_FILTER_TABLE)
+	routes, err := nl.RouteListFiltered(netlink.FAMILY_ALL, filter, netlink.RT_FILTER_TABLE)
 	if err != nil {
 		return fmt.Errorf("failed to list routes: %w", err)
 	}
 
 	for _, route := range routes {
-		if err := netlink.RouteDel(&route); err != nil {
+		if err := nl.RouteDel(&route); err != nil {
 			// Continue even if some routes fail to delete
 			continue
 		}
@@ -581,30 +881,62 @@ func FlushRoutesInTable(table int) error {
 //
 // Note: This does not add or modify any routes, it only queries the kernel's routing decision.
 func GetRouteToDestination(destination net.IP) (*Route, error) {
-	nlRoute, err := netlink.RouteGet(destination)
+	route, _, err := routeToDestination(destination)
+	return route, err
+}
+
+// routeToDestination looks up the route to destination like GetRouteToDestination and
+// also returns its kernel route type, such as unix.RTN_UNICAST or unix.RTN_LOCAL.
+func routeToDestination(destination net.IP) (*Route, int, error) {
+	nlRoute, err := routeGet(destination)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get route to %s: %w", destination, err)
+		return nil, 0, fmt.Errorf("failed to get route to %s: %w", destination, err)
 	}
 
 	if len(nlRoute) == 0 {
-		return nil, ErrNoRouteFound
+		return nil, 0, ErrNoRouteFound
 	}
 
 	r := nlRoute[0]
-	link, err := netlink.LinkByIndex(r.LinkIndex)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get interface for route: %w", err)
-	}
-
-	return &Route{
+	route := &Route{
 		Destination: r.Dst,
 		Gateway:     r.Gw,
-		Interface:   link.Attrs().Name,
 		Metric:      r.Priority,
 		Table:       r.Table,
 		Scope:       r.Scope,
 		Protocol:    r.Protocol,
-	}, nil
+	}
+
+	// Blackhole and unreachable routes have no interface
+	if r.LinkIndex > 0 {
+		name, err := linkNameByIndex(r.LinkIndex)
+		if err != nil {
+			return nil, 0, newInterfaceNotFoundError(fmt.Sprintf("index %d", r.LinkIndex), err)
+		}
+		route.Interface = name
+	}
+
+	return route, r.Type, nil
+}
+
+// MatchOptions relax the comparison of routes in RouteExists and FindRoutes.
+type MatchOptions struct {
+	// IgnoreMetric matches routes regardless of their metric.
+	IgnoreMetric bool
+	// IgnoreGateway matches routes regardless of their gateway.
+	IgnoreGateway bool
+	// AnyTable matches routes in every routing table instead of only the table of
+	// the route searched for. A route with table 0 (unix.RT_TABLE_UNSPEC) matches
+	// routes in every table too.
+	AnyTable bool
+}
+
+// table returns the table to search for route, unix.RT_TABLE_UNSPEC for every table.
+func (o MatchOptions) table(route *Route) int {
+	if o.AnyTable {
+		return unix.RT_TABLE_UNSPEC
+	}
+	return route.Table
 }
 
 // RouteExists checks if a specific route exists in the routing table.
@@ -613,6 +945,7 @@ func GetRouteToDestination(destination net.IP) (*Route, error) {
 //
 // Parameters:
 //   - route: The route to search for (must not be nil)
+//   - opts: Fields to leave out of the comparison; the zero value compares all of them
 //
 // Returns:
 //   - true if a matching route exists, false otherwise
@@ -627,30 +960,72 @@ func GetRouteToDestination(destination net.IP) (*Route, error) {
 //	    Metric:      100,
 //	    Table:       unix.RT_TABLE_MAIN,
 //	}
-//	exists, err := RouteExists(route)
+//	exists, err := RouteExists(route, MatchOptions{IgnoreMetric: true})
 //	if err != nil {
 //	    log.Fatal(err)
 //	}
 //	if exists {
 //	    fmt.Println("Route already exists")
 //	}
-func RouteExists(route *Route) (bool, error) {
+func RouteExists(route *Route, opts MatchOptions) (bool, error) {
+	return RouteExistsWithRouteTable(route, opts, KernelRouteTable{})
+}
+
+// RouteExistsWithRouteTable checks if a route exists using the provided route table.
+func RouteExistsWithRouteTable(route *Route, opts MatchOptions, routes RouteTable) (bool, error) {
+	found, err := FindRoutesWithRouteTable(route, opts, routes)
+	if err != nil {
+		return false, err
+	}
+
+	return len(found) > 0, nil
+}
+
+// FindRoutes returns the routes that match route, comparing the fields opts does not
+// leave out, in the order the kernel lists them.
+//
+// Parameters:
+//   - route: The route to search for (must not be nil)
+//   - opts: Fields to leave out of the comparison; the zero value compares all of them
+//
+// Returns:
+//   - The matching routes, none if there is no match
+//   - An error if the route is nil or the routing table cannot be queried
+//
+// Example:
+//
+//	// Is there any route to the mesh through br-ahwlan, whatever its gateway, metric or table?
+//	routes, err := FindRoutes(&Route{
+//	    Destination: parseIPNet("10.41.0.0/16"),
+//	    Interface:   "br-ahwlan",
+//	}, MatchOptions{IgnoreMetric: true, IgnoreGateway: true, AnyTable: true})
+//	for _, r := range routes {
+//	    fmt.Printf("%s (table %d)\n", r, r.Table)
+//	}
+func FindRoutes(route *Route, opts MatchOptions) ([]*Route, error) {
+	return FindRoutesWithRouteTable(route, opts, KernelRouteTable{})
+}
+
+// FindRoutesWithRouteTable returns the routes that match route using the provided
+// route table.
+func FindRoutesWithRouteTable(route *Route, opts MatchOptions, routes RouteTable) ([]*Route, error) {
 	if route == nil {
-		return false, fmt.Errorf("route cannot be nil")
+		return nil, newValidationError("route cannot be nil")
 	}
 
-	routes, err := GetRoutes(route.Table)
+	current, err := routes.GetRoutes(opts.table(route))
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
-	for _, r := range routes {
-		if routesMatch(r, route) {
-			return true, nil
+	var found []*Route
+	for _, r := range current {
+		if routesMatchWith(r, route, opts) {
+			found = append(found, r)
 		}
 	}
 
-	return false, nil
+	return found, nil
 }
 
 // routesMatch checks if two routes are equivalent by comparing their key fields.
@@ -669,33 +1044,58 @@ func RouteExists(route *Route) (bool, error) {
 //   - Interface name
 //   - Metric value
 //
-// Note: nil routes or routes with only one nil field component will not match.
+// Note: nil routes or routes with only one nil field component will not match. A nil
+// destination matches the default destination (0.0.0.0/0 or ::/0) of its family.
 func routesMatch(r1, r2 *Route) bool {
+	return routesMatchWith(r1, r2, MatchOptions{})
+}
+
+// routesMatchWith is routesMatch leaving out the fields selected in opts.
+func routesMatchWith(r1, r2 *Route, opts MatchOptions) bool {
 	if r1 == nil || r2 == nil {
 		return false
 	}
 
-	// Compare destinations
-	if (r1.Destination == nil) != (r2.Destination == nil) {
+	if !sameDestination(r1, r2) {
 		return false
 	}
-	if r1.Destination != nil && r2.Destination != nil {
-		if !r1.Destination.IP.Equal(r2.Destination.IP) ||
-			r1.Destination.Mask.String() != r2.Destination.Mask.String() {
+
+	// Compare gateways
+	if !opts.IgnoreGateway {
+		if (r1.Gateway == nil) != (r2.Gateway == nil) {
+			return false
+		}
+		if r1.Gateway != nil && r2.Gateway != nil && !r1.Gateway.Equal(r2.Gateway) {
 			return false
 		}
 	}
 
-	// Compare gateways
-	if (r1.Gateway == nil) != (r2.Gateway == nil) {
-		return false
+	// Compare next hops, interface and metric
+	return sameNextHops(r1.NextHops, r2.NextHops, opts.IgnoreGateway) &&
+		r1.Interface == r2.Interface && (opts.IgnoreMetric || r1.Metric == r2.Metric)
+}
+
+// sameDestination reports whether two routes go to the same destination network.
+func sameDestination(r1, r2 *Route) bool {
+	d1, d2 := routeDestination(r1), routeDestination(r2)
+	return d1.IP.Equal(d2.IP) && d1.Mask.String() == d2.Mask.String()
+}
+
+// routeDestination returns the destination of a route, spelling out the default
+// destination of the gateway's family for a route with a nil destination. The
+// kernel reports default routes with an explicit 0.0.0.0/0 or ::/0.
+func routeDestination(r *Route) *net.IPNet {
+	if r.Destination != nil {
+		return r.Destination
 	}
-	if r1.Gateway != nil && r2.Gateway != nil && !r1.Gateway.Equal(r2.Gateway) {
-		return false
+	gateway := r.Gateway
+	if gateway == nil && len(r.NextHops) > 0 {
+		gateway = r.NextHops[0].Gateway
 	}
-
-	// Compare interface and metric
-	return r1.Interface == r2.Interface && r1.Metric == r2.Metric
+	if gateway != nil && gateway.To4() == nil {
+		return &net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(0, 128)}
+	}
+	return &net.IPNet{IP: net.IPv4zero, Mask: net.CIDRMask(0, 32)}
 }
 
 // AddHostRoute adds a route for a specific host IP address (/32 route).
@@ -722,7 +1122,7 @@ func routesMatch(r1, r2 *Route) bool {
 func AddHostRoute(hostIP net.IP, gateway net.IP, iface string, metric int) error {
 	_, ipNet, err := net.ParseCIDR(hostIP.String() + "/32")
 	if err != nil {
-		return fmt.Errorf("failed to parse host IP: %w", err)
+		return newValidationError("failed to parse host IP: %v", err)
 	}
 
 	route := &Route{
@@ -821,12 +1221,18 @@ func DeleteNetworkRoute(network *net.IPNet, gateway net.IP, iface string) error
 //	    fmt.Println(route.String())
 //	}
 func GetRoutesForInterface(iface string) ([]*Route, error) {
-	link, err := netlink.LinkByName(iface)
+	return GetRoutesForInterfaceWithNetlinker(iface, NewNetlinker())
+}
+
+// GetRoutesForInterfaceWithNetlinker returns the routes of an interface through the
+// provided netlinker.
+func GetRoutesForInterfaceWithNetlinker(iface string, nl Netlinker) ([]*Route, error) {
+	link, err := nl.LinkByName(iface)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get interface %s: %w", iface, err)
+		return nil, newInterfaceNotFoundError(iface, err)
 	}
 
-	nlRoutes, err := netlink.RouteList(link, netlink.FAMILY_ALL)
+	nlRoutes, err := nl.RouteList(link, netlink.FAMILY_ALL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list routes: %w", err)
 	}
@@ -866,6 +1272,7 @@ func GetRoutesForInterface(iface string) ([]*Route, error) {
 //	"192.168.1.0/24 via 10.0.0.1 dev eth0 metric 100 table 254"
 //	"default via 192.168.1.1 dev eth0 metric 0 table 254"
 //	"172.16.0.0/16 via none dev bat0 metric 10 table 254"
+//	"default metric 10 table 254 nexthop via 10.41.0.1 dev bat0 weight 1 nexthop via 10.41.0.2 dev bat0 weight 1"
 func (r *Route) String() string {
 	if r == nil {
 		return "<nil>"
@@ -876,6 +1283,15 @@ func (r *Route) String() string {
 		dest = r.Destination.String()
 	}
 
+	if len(r.NextHops) > 0 {
+		var b strings.Builder
+		fmt.Fprintf(&b, "%s metric %d table %d", dest, r.Metric, r.Table)
+		for _, hop := range r.NextHops {
+			fmt.Fprintf(&b, " nexthop %s", hop)
+		}
+		return b.String()
+	}
+
 	gw := "none"
 	if r.Gateway != nil {
 		gw = r.Gateway.String()
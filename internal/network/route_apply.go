@@ -0,0 +1,334 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+
+	"github.com/openmanet/openmanetd/internal/safemode"
+	"golang.org/x/sys/unix"
+)
+
+// ApplyOptions select the routes ApplyRoutes reconciles. The zero value reconciles
+// every route we own in the tables of the desired routes.
+type ApplyOptions struct {
+	// Tables are the routing tables reconciled. Empty selects the tables of the
+	// desired routes, or the main table if there are none.
+	Tables []int
+	// Destinations, if set, limits the reconciliation to routes to these networks,
+	// e.g. 0.0.0.0/0 to switch the default routes while the static routes we own in
+	// the same table are left alone.
+	Destinations []*net.IPNet
+}
+
+// tables returns the tables to reconcile for desired, in ascending order.
+func (o ApplyOptions) tables(desired []*Route) []int {
+	tables := slices.Clone(o.Tables)
+	if len(tables) == 0 {
+		for _, route := range desired {
+			tables = append(tables, route.Table)
+		}
+	}
+	if len(tables) == 0 {
+		tables = append(tables, unix.RT_TABLE_MAIN)
+	}
+	slices.Sort(tables)
+
+	return slices.Compact(tables)
+}
+
+// covers reports whether route is one of the routes o reconciles.
+func (o ApplyOptions) covers(route *Route, tables []int) bool {
+	if !slices.Contains(tables, route.Table) {
+		return false
+	}
+	if len(o.Destinations) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(o.Destinations, func(dst *net.IPNet) bool {
+		return sameDestination(&Route{Destination: dst}, route)
+	})
+}
+
+// sameRouteKey reports whether two routes occupy the same slot of a routing table,
+// the destination, table and metric the kernel identifies a route by, so that adding
+// one while the other is installed fails.
+func sameRouteKey(r1, r2 *Route) bool {
+	return sameDestination(r1, r2) && r1.Table == r2.Table && r1.Metric == r2.Metric
+}
+
+// routeReplacer is a RouteTable that can swap a route for another in the same slot
+// in one step. A RouteTable without it has the old route deleted before the new one
+// is added.
+type routeReplacer interface {
+	ReplaceRoute(route *Route) error
+}
+
+// ReplaceRoute replaces the route in the slot of route, as ReplaceRouteExact does,
+// through t's handle.
+func (t KernelRouteTable) ReplaceRoute(route *Route) error {
+	if route == nil {
+		return newValidationError("route cannot be nil")
+	}
+
+	if err := safemode.Check(fmt.Sprintf("replace route %s", route)); err != nil {
+		return err
+	}
+
+	h := t.handle()
+
+	nlRoute, err := toNetlinkRoute(h, route)
+	if err != nil {
+		return err
+	}
+
+	if err := h.RouteReplace(nlRoute); err != nil {
+		return fmt.Errorf("failed to replace route: %w", err)
+	}
+
+	return nil
+}
+
+// replaceRoute installs route in place of old, which is in the same slot.
+func replaceRoute(routes RouteTable, old, route *Route) error {
+	if replacer, ok := routes.(routeReplacer); ok {
+		return replacer.ReplaceRoute(route)
+	}
+
+	if err := routes.DeleteRoute(old); err != nil {
+		return err
+	}
+	if err := routes.AddRoute(route); err != nil {
+		if restoreErr := routes.AddRoute(old); restoreErr != nil {
+			return errors.Join(err, fmt.Errorf("failed to restore route %s: %w", old, restoreErr))
+		}
+		return err
+	}
+
+	return nil
+}
+
+// routeOp is a change ApplyRoutes makes to a routing table. old is nil for an
+// added route and route is nil for a deleted one.
+type routeOp struct {
+	old, route *Route
+}
+
+// apply makes the change, returning false if there was nothing to change.
+func (op routeOp) apply(routes RouteTable) (bool, error) {
+	switch {
+	case op.old == nil:
+		if err := routes.AddRoute(op.route); err != nil {
+			return false, fmt.Errorf("failed to add route %s: %w", op.route, err)
+		}
+	case op.route == nil:
+		err := routes.DeleteRoute(op.old)
+		// The kernel drops the routes of an interface that went down
+		if errors.Is(err, unix.ESRCH) {
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to delete route %s: %w", op.old, err)
+		}
+	default:
+		if err := replaceRoute(routes, op.old, op.route); err != nil {
+			return false, fmt.Errorf("failed to replace route %s with %s: %w", op.old, op.route, err)
+		}
+	}
+
+	return true, nil
+}
+
+// undo returns the change that reverts op.
+func (op routeOp) undo() routeOp {
+	return routeOp{old: op.route, route: op.old}
+}
+
+// ApplyRoutes makes desired the set of routes we own in the routing tables opts
+// selects. Routes we own are those tagged with RouteProtocolOpenMANET; desired
+// routes are installed with that tag. Each desired route that is missing is added,
+// or replaces the owned route in its slot, the route with the same destination,
+// table and metric; owned routes that are not desired are deleted. Routes that are
+// already installed, and routes added by the kernel, netifd or an administrator, are
+// left alone.
+//
+// Routes are added and replaced before any is deleted, so switching the default
+// route from one gateway to another never leaves the node without one. If a change
+// fails, the changes made so far are reverted in reverse order and the routing
+// tables are left as they were.
+//
+// Returns an ErrValidation error if a desired route is nil, is outside the tables or
+// destinations opts selects, or takes the slot of another desired route, and an
+// error if a table cannot be listed or a change fails. The error of a failed change
+// includes any error reverting the changes before it.
+//
+// Example:
+//
+//	// Switch the default route to the new gateway
+//	_, defaultDst, _ := net.ParseCIDR("0.0.0.0/0")
+//	err := ApplyRoutes([]*Route{{
+//	    Destination: defaultDst,
+//	    Gateway:     net.ParseIP("10.41.0.2"),
+//	    Interface:   "br-ahwlan",
+//	    Metric:      10,
+//	    Table:       unix.RT_TABLE_MAIN,
+//	}}, ApplyOptions{Destinations: []*net.IPNet{defaultDst}})
+//
+// Note: This operation requires appropriate privileges (typically root/CAP_NET_ADMIN).
+func ApplyRoutes(desired []*Route, opts ApplyOptions) error {
+	return ApplyRoutesWithRouteTable(desired, opts, KernelRouteTable{})
+}
+
+// ApplyRoutesWithRouteTable applies a route set using the provided route table.
+func ApplyRoutesWithRouteTable(desired []*Route, opts ApplyOptions, routes RouteTable) error {
+	if slices.Contains(desired, nil) {
+		return newValidationError("route cannot be nil")
+	}
+	tables := opts.tables(desired)
+
+	owned := make([]*Route, 0, len(desired))
+	for _, route := range desired {
+		r := *route
+		r.Protocol = RouteProtocolOpenMANET
+		if !opts.covers(&r, tables) {
+			return newValidationError("route %s is outside the tables and destinations applied", &r)
+		}
+		if slices.ContainsFunc(owned, func(other *Route) bool { return sameRouteKey(other, &r) }) {
+			return newValidationError("route %s takes the slot of another desired route", &r)
+		}
+		owned = append(owned, &r)
+	}
+
+	var current []*Route
+	for _, table := range tables {
+		routesInTable, err := routes.GetRoutes(table)
+		if err != nil {
+			return err
+		}
+		for _, r := range routesInTable {
+			if r.Protocol == RouteProtocolOpenMANET && opts.covers(r, tables) {
+				current = append(current, r)
+			}
+		}
+	}
+
+	// Leave out the desired routes that are installed already
+	var missing []*Route
+	for _, route := range owned {
+		i := slices.IndexFunc(current, func(r *Route) bool { return SameRoute(r, route) })
+		if i < 0 {
+			missing = append(missing, route)
+			continue
+		}
+		current = slices.Delete(current, i, i+1)
+	}
+
+	var ops []routeOp
+	for _, route := range missing {
+		op := routeOp{route: route}
+		if i := slices.IndexFunc(current, func(r *Route) bool { return sameRouteKey(r, route) }); i >= 0 {
+			op.old = current[i]
+			current = slices.Delete(current, i, i+1)
+		}
+		ops = append(ops, op)
+	}
+	for _, r := range current {
+		ops = append(ops, routeOp{old: r})
+	}
+
+	var applied []routeOp
+	for _, op := range ops {
+		changed, err := op.apply(routes)
+		if changed {
+			applied = append(applied, op)
+		}
+		if err == nil {
+			continue
+		}
+
+		errs := []error{err}
+		for _, done := range slices.Backward(applied) {
+			if _, undoErr := done.undo().apply(routes); undoErr != nil {
+				errs = append(errs, fmt.Errorf("rollback: %w", undoErr))
+			}
+		}
+		return errors.Join(errs...)
+	}
+
+	return nil
+}
+
+// UpdateRouteMetric moves the installed route that matches route to newMetric, e.g.
+// to demote the default route through a degraded gateway below that of a better one
+// without taking it away. The kernel identifies a route by its metric, so the route
+// is added at the new metric before the old one is deleted; traffic keeps flowing
+// through one of the two throughout. Updating a route to the metric it has does
+// nothing.
+//
+// Returns an ErrValidation error if route is nil or newMetric is negative, an
+// ErrNoRouteFound error if no route matches route, and an error if the route cannot
+// be added or deleted. If the old route cannot be deleted, the new one is deleted
+// again.
+//
+// Example:
+//
+//	// Demote the route through a gateway that lost its uplink
+//	err := UpdateRouteMetric(&Route{
+//	    Gateway:   net.ParseIP("10.41.0.1"),
+//	    Interface: "br-ahwlan",
+//	    Metric:    10,
+//	    Table:     unix.RT_TABLE_MAIN,
+//	}, 100)
+//
+// Note: This operation requires appropriate privileges (typically root/CAP_NET_ADMIN).
+func UpdateRouteMetric(route *Route, newMetric int) error {
+	return UpdateRouteMetricWithRouteTable(route, newMetric, KernelRouteTable{})
+}
+
+// UpdateRouteMetricWithRouteTable moves a route to a new metric using the provided
+// route table.
+func UpdateRouteMetricWithRouteTable(route *Route, newMetric int, routes RouteTable) error {
+	if route == nil {
+		return newValidationError("route cannot be nil")
+	}
+	if newMetric < 0 {
+		return newValidationError("route metric cannot be negative, got %d", newMetric)
+	}
+	if route.Metric == newMetric {
+		return nil
+	}
+
+	current, err := routes.GetRoutes(route.Table)
+	if err != nil {
+		return err
+	}
+
+	i := slices.IndexFunc(current, func(r *Route) bool { return SameRoute(r, route) })
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrNoRouteFound, route)
+	}
+	old := current[i]
+
+	updated := *old
+	updated.Metric = newMetric
+	installed := slices.ContainsFunc(current, func(r *Route) bool { return SameRoute(r, &updated) })
+
+	if !installed {
+		if err := routes.AddRoute(&updated); err != nil {
+			return fmt.Errorf("failed to add route %s: %w", &updated, err)
+		}
+	}
+
+	if err := routes.DeleteRoute(old); err != nil {
+		err = fmt.Errorf("failed to delete route %s: %w", old, err)
+		if !installed {
+			if undoErr := routes.DeleteRoute(&updated); undoErr != nil {
+				err = errors.Join(err, fmt.Errorf("rollback: %w", undoErr))
+			}
+		}
+		return err
+	}
+
+	return nil
+}
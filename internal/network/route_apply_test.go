@@ -0,0 +1,229 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// recordingRouteTable is a fakeRouteTable that can replace routes, logs every change
+// in order and fails the changes fail returns an error for.
+type recordingRouteTable struct {
+	*fakeRouteTable
+	log  []string
+	fail func(change string, route *Route) error
+}
+
+func (r *recordingRouteTable) change(change string, route *Route, apply func() error) error {
+	if r.fail != nil {
+		if err := r.fail(change, route); err != nil {
+			return err
+		}
+	}
+	r.log = append(r.log, fmt.Sprintf("%s %s metric %d", change, route.Gateway, route.Metric))
+	return apply()
+}
+
+func (r *recordingRouteTable) AddRoute(route *Route) error {
+	return r.change("add", route, func() error { return r.fakeRouteTable.AddRoute(route) })
+}
+
+func (r *recordingRouteTable) DeleteRoute(route *Route) error {
+	return r.change("delete", route, func() error { return r.fakeRouteTable.DeleteRoute(route) })
+}
+
+func (r *recordingRouteTable) ReplaceRoute(route *Route) error {
+	return r.change("replace", route, func() error {
+		i := slices.IndexFunc(r.routes, func(old *Route) bool { return sameRouteKey(old, route) })
+		if i < 0 {
+			return errors.New("no such process")
+		}
+		r.routes[i] = route
+		return nil
+	})
+}
+
+func TestApplyRoutesWithRouteTable(t *testing.T) {
+	defaultDst := createTestIPNet("0.0.0.0/0")
+	route := func(dst *net.IPNet, gw string, metric int, proto netlink.RouteProtocol) *Route {
+		return &Route{Destination: dst, Gateway: net.ParseIP(gw), Interface: "br-ahwlan", Metric: metric, Table: unix.RT_TABLE_MAIN, Protocol: proto}
+	}
+	static := route(createTestIPNet("192.168.50.0/24"), "10.41.0.9", 10, RouteProtocolOpenMANET)
+	netifd := route(defaultDst, "10.41.0.254", 0, netlink.RouteProtocol(unix.RTPROT_BOOT))
+	defaults := ApplyOptions{Destinations: []*net.IPNet{defaultDst}}
+
+	t.Run("replaces the route in the same slot", func(t *testing.T) {
+		old := route(defaultDst, "10.41.0.1", 10, RouteProtocolOpenMANET)
+		table := &recordingRouteTable{fakeRouteTable: &fakeRouteTable{routes: []*Route{static, netifd, old}}}
+
+		if err := ApplyRoutesWithRouteTable([]*Route{route(defaultDst, "10.41.0.2", 10, 0)}, defaults, table); err != nil {
+			t.Fatalf("ApplyRoutesWithRouteTable() error = %v", err)
+		}
+		if want := []string{"replace 10.41.0.2 metric 10"}; !slices.Equal(table.log, want) {
+			t.Errorf("changes = %v, want %v", table.log, want)
+		}
+		if got := table.routes[2]; got.Protocol != RouteProtocolOpenMANET || !got.Gateway.Equal(net.ParseIP("10.41.0.2")) {
+			t.Errorf("installed route = %v, want the new gateway tagged as ours", got)
+		}
+	})
+
+	t.Run("adds before deleting", func(t *testing.T) {
+		old := route(defaultDst, "10.41.0.1", 20, RouteProtocolOpenMANET)
+		table := &recordingRouteTable{fakeRouteTable: &fakeRouteTable{routes: []*Route{static, netifd, old}}}
+
+		if err := ApplyRoutesWithRouteTable([]*Route{route(defaultDst, "10.41.0.2", 10, 0)}, defaults, table); err != nil {
+			t.Fatalf("ApplyRoutesWithRouteTable() error = %v", err)
+		}
+		want := []string{"add 10.41.0.2 metric 10", "delete 10.41.0.1 metric 20"}
+		if !slices.Equal(table.log, want) {
+			t.Errorf("changes = %v, want %v", table.log, want)
+		}
+		if !slices.Contains(table.routes, static) || !slices.Contains(table.routes, netifd) {
+			t.Errorf("routes = %v, want the static and netifd routes kept", table.routes)
+		}
+	})
+
+	t.Run("keeps installed routes", func(t *testing.T) {
+		old := route(defaultDst, "10.41.0.1", 10, RouteProtocolOpenMANET)
+		table := &recordingRouteTable{fakeRouteTable: &fakeRouteTable{routes: []*Route{static, old}}}
+
+		desired := []*Route{route(defaultDst, "10.41.0.1", 10, 0), route(createTestIPNet("192.168.50.0/24"), "10.41.0.9", 10, 0)}
+		if err := ApplyRoutesWithRouteTable(desired, ApplyOptions{}, table); err != nil {
+			t.Fatalf("ApplyRoutesWithRouteTable() error = %v", err)
+		}
+		if len(table.log) != 0 {
+			t.Errorf("changes = %v, want none", table.log)
+		}
+	})
+
+	t.Run("rolls back on failure", func(t *testing.T) {
+		old := route(defaultDst, "10.41.0.1", 10, RouteProtocolOpenMANET)
+		extra := route(defaultDst, "10.41.0.3", 30, RouteProtocolOpenMANET)
+		before := []*Route{static, old, extra}
+		table := &recordingRouteTable{fakeRouteTable: &fakeRouteTable{routes: slices.Clone(before)}}
+		table.fail = func(change string, r *Route) error {
+			if change == "add" && r.Metric == 20 {
+				return errors.New("network is unreachable")
+			}
+			return nil
+		}
+
+		desired := []*Route{route(defaultDst, "10.41.0.2", 10, 0), route(defaultDst, "10.41.0.2", 20, 0)}
+		err := ApplyRoutesWithRouteTable(desired, defaults, table)
+		if err == nil {
+			t.Fatal("ApplyRoutesWithRouteTable() succeeded, want the failed add")
+		}
+		want := []string{"replace 10.41.0.2 metric 10", "replace 10.41.0.1 metric 10"}
+		if !slices.Equal(table.log, want) {
+			t.Errorf("changes = %v, want %v", table.log, want)
+		}
+		if !slices.ContainsFunc(table.routes, func(r *Route) bool { return SameRoute(r, old) }) || !slices.Contains(table.routes, extra) {
+			t.Errorf("routes = %v, want %v restored", table.routes, before)
+		}
+	})
+
+	t.Run("deletes and adds without replace", func(t *testing.T) {
+		old := route(defaultDst, "10.41.0.1", 10, RouteProtocolOpenMANET)
+		table := &fakeRouteTable{routes: []*Route{static, old}}
+
+		if err := ApplyRoutesWithRouteTable([]*Route{route(defaultDst, "10.41.0.2", 10, 0)}, defaults, table); err != nil {
+			t.Fatalf("ApplyRoutesWithRouteTable() error = %v", err)
+		}
+		if len(table.deleted) != 1 || table.deleted[0] != old || len(table.added) != 1 {
+			t.Errorf("added %v and deleted %v, want the old route swapped for the new one", table.added, table.deleted)
+		}
+	})
+}
+
+func TestApplyRoutesWithRouteTable_Invalid(t *testing.T) {
+	defaultDst := createTestIPNet("0.0.0.0/0")
+	gw := net.ParseIP("10.41.0.1")
+	table := &fakeRouteTable{}
+
+	tests := []struct {
+		name    string
+		desired []*Route
+		opts    ApplyOptions
+	}{
+		{"nil route", []*Route{nil}, ApplyOptions{}},
+		{"outside destinations", []*Route{{Destination: createTestIPNet("192.168.50.0/24"), Gateway: gw, Interface: "br-ahwlan"}}, ApplyOptions{Destinations: []*net.IPNet{defaultDst}}},
+		{"outside tables", []*Route{{Gateway: gw, Interface: "br-ahwlan", Table: 100}}, ApplyOptions{Tables: []int{unix.RT_TABLE_MAIN}}},
+		{"same slot", []*Route{
+			{Gateway: gw, Interface: "br-ahwlan", Table: unix.RT_TABLE_MAIN},
+			{Destination: defaultDst, Gateway: net.ParseIP("10.41.0.2"), Interface: "br-ahwlan", Table: unix.RT_TABLE_MAIN},
+		}, ApplyOptions{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ApplyRoutesWithRouteTable(tt.desired, tt.opts, table); !errors.Is(err, ErrValidation) {
+				t.Errorf("error = %v, want ErrValidation", err)
+			}
+		})
+	}
+	if len(table.added) != 0 {
+		t.Errorf("added %v after invalid route sets", table.added)
+	}
+}
+
+func TestUpdateRouteMetricWithRouteTable(t *testing.T) {
+	gw := net.ParseIP("10.41.0.1")
+	installed := &Route{Destination: createTestIPNet("0.0.0.0/0"), Gateway: gw, Interface: "br-ahwlan", Metric: 10, Table: unix.RT_TABLE_MAIN, Protocol: RouteProtocolOpenMANET}
+	query := &Route{Gateway: gw, Interface: "br-ahwlan", Metric: 10, Table: unix.RT_TABLE_MAIN}
+
+	t.Run("adds before deleting", func(t *testing.T) {
+		table := &recordingRouteTable{fakeRouteTable: &fakeRouteTable{routes: []*Route{installed}}}
+
+		if err := UpdateRouteMetricWithRouteTable(query, 100, table); err != nil {
+			t.Fatalf("UpdateRouteMetricWithRouteTable() error = %v", err)
+		}
+		want := []string{"add 10.41.0.1 metric 100", "delete 10.41.0.1 metric 10"}
+		if !slices.Equal(table.log, want) {
+			t.Errorf("changes = %v, want %v", table.log, want)
+		}
+		if len(table.routes) != 1 || table.routes[0].Protocol != RouteProtocolOpenMANET {
+			t.Errorf("routes = %v, want the route at metric 100 keeping its protocol", table.routes)
+		}
+	})
+
+	t.Run("rolls back when the old route stays", func(t *testing.T) {
+		table := &recordingRouteTable{fakeRouteTable: &fakeRouteTable{routes: []*Route{installed}}}
+		table.fail = func(change string, r *Route) error {
+			if change == "delete" && r.Metric == 10 {
+				return errors.New("operation not permitted")
+			}
+			return nil
+		}
+
+		if err := UpdateRouteMetricWithRouteTable(query, 100, table); err == nil {
+			t.Fatal("UpdateRouteMetricWithRouteTable() succeeded, want the failed delete")
+		}
+		if len(table.routes) != 1 || table.routes[0] != installed {
+			t.Errorf("routes = %v, want only the original route", table.routes)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		table := &fakeRouteTable{routes: []*Route{installed}}
+
+		if err := UpdateRouteMetricWithRouteTable(nil, 100, table); !errors.Is(err, ErrValidation) {
+			t.Errorf("nil route error = %v, want ErrValidation", err)
+		}
+		if err := UpdateRouteMetricWithRouteTable(query, -1, table); !errors.Is(err, ErrValidation) {
+			t.Errorf("negative metric error = %v, want ErrValidation", err)
+		}
+		missing := *query
+		missing.Metric = 20
+		if err := UpdateRouteMetricWithRouteTable(&missing, 100, table); !errors.Is(err, ErrNoRouteFound) {
+			t.Errorf("missing route error = %v, want ErrNoRouteFound", err)
+		}
+		if err := UpdateRouteMetricWithRouteTable(query, 10, table); err != nil || len(table.added) != 0 {
+			t.Errorf("unchanged metric error = %v, added %v, want nothing done", err, table.added)
+		}
+	})
+}
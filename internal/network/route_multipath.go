@@ -0,0 +1,149 @@
+package network
+
+import (
+	"fmt"
+	"net"
+	"slices"
+
+	"github.com/vishvananda/netlink"
+)
+
+// maxNextHopWeight is the largest weight the kernel gives a next hop.
+const maxNextHopWeight = 256
+
+// NextHop is one of the paths of a multipath route.
+//
+// Fields:
+//   - Gateway: The gateway IP address of the path. nil for a directly connected path.
+//   - Interface: The name of the network interface of the path.
+//   - Weight: The share of the flows the path carries relative to the other paths,
+//     from 1 to 256. 0 counts as 1.
+type NextHop struct {
+	Gateway   net.IP
+	Interface string
+	Weight    int
+}
+
+// weight returns the weight of the next hop, 1 if it is unset.
+func (n NextHop) weight() int {
+	return max(n.Weight, 1)
+}
+
+// String returns the next hop the way 'ip route' prints it.
+func (n NextHop) String() string {
+	gw := "none"
+	if n.Gateway != nil {
+		gw = n.Gateway.String()
+	}
+	return fmt.Sprintf("via %s dev %s weight %d", gw, n.Interface, n.weight())
+}
+
+// sameNextHops reports whether two routes have the same next hops in the same order,
+// comparing only their interfaces and weights if ignoreGateway is set.
+func sameNextHops(a, b []NextHop, ignoreGateway bool) bool {
+	return slices.EqualFunc(a, b, func(x, y NextHop) bool {
+		return x.Interface == y.Interface && x.weight() == y.weight() &&
+			(ignoreGateway || x.Gateway.Equal(y.Gateway))
+	})
+}
+
+// toNetlinkNextHops converts next hops, looking up their interfaces through h.
+func toNetlinkNextHops(h Netlinker, hops []NextHop) ([]*netlink.NexthopInfo, error) {
+	multipath := make([]*netlink.NexthopInfo, 0, len(hops))
+	for _, hop := range hops {
+		link, err := h.LinkByName(hop.Interface)
+		if err != nil {
+			return nil, newInterfaceNotFoundError(hop.Interface, err)
+		}
+		multipath = append(multipath, &netlink.NexthopInfo{
+			LinkIndex: link.Attrs().Index,
+			Gw:        hop.Gateway,
+			// The kernel counts the weight from 0
+			Hops: hop.weight() - 1,
+		})
+	}
+	return multipath, nil
+}
+
+// fromNetlinkNextHops converts the next hops of a multipath route, naming their
+// interfaces with linkName.
+func fromNetlinkNextHops(multipath []*netlink.NexthopInfo, linkName func(index int) (string, error)) ([]NextHop, error) {
+	hops := make([]NextHop, 0, len(multipath))
+	for _, nh := range multipath {
+		name, err := linkName(nh.LinkIndex)
+		if err != nil {
+			return nil, newInterfaceNotFoundError(fmt.Sprintf("index %d", nh.LinkIndex), err)
+		}
+		hops = append(hops, NextHop{Gateway: nh.Gw, Interface: name, Weight: nh.Hops + 1})
+	}
+	return hops, nil
+}
+
+// validateMultipathRoute checks that route is a multipath route the kernel accepts.
+func validateMultipathRoute(route *Route) error {
+	if route == nil {
+		return newValidationError("route cannot be nil")
+	}
+	if len(route.NextHops) < 2 {
+		return newValidationError("multipath route needs at least 2 next hops, got %d", len(route.NextHops))
+	}
+	if route.Gateway != nil || route.Interface != "" {
+		return newValidationError("multipath route sets its gateway and interface per next hop")
+	}
+
+	ipv4 := routeDestination(route).IP.To4() != nil
+	for i, hop := range route.NextHops {
+		if hop.Interface == "" {
+			return newValidationError("next hop %d has no interface", i+1)
+		}
+		if hop.Weight < 0 || hop.Weight > maxNextHopWeight {
+			return newValidationError("weight of next hop %d must be from 1 to %d, got %d", i+1, maxNextHopWeight, hop.Weight)
+		}
+		if hop.Gateway != nil && (hop.Gateway.To4() != nil) != ipv4 {
+			return newValidationError("gateway %s of next hop %d does not match the family of %s", hop.Gateway, i+1, routeDestination(route))
+		}
+		for _, other := range route.NextHops[:i] {
+			if other.Interface == hop.Interface && other.Gateway.Equal(hop.Gateway) {
+				return newValidationError("next hop %s is listed twice", hop)
+			}
+		}
+	}
+
+	return nil
+}
+
+// AddMultipathRoute adds a route that balances traffic across several next hops,
+// e.g. a default route through two batman-adv gateways that are equally good. The
+// kernel spreads flows across the next hops by weight, keeping each flow on one
+// path. The route is identified by its destination, table and metric like any other
+// route, so ReplaceRouteByDestination can swap it for a single-path route and back.
+//
+// Returns an ErrValidation error if the route has fewer than two next hops, sets a
+// gateway or interface of its own, or has an invalid next hop, and an
+// ErrInterfaceNotFound error if the interface of a next hop does not exist.
+//
+// Example:
+//
+//	err := AddMultipathRoute(&Route{
+//	    Metric: 10,
+//	    Table:  unix.RT_TABLE_MAIN,
+//	    NextHops: []NextHop{
+//	        {Gateway: net.ParseIP("10.41.0.1"), Interface: "br-ahwlan"},
+//	        {Gateway: net.ParseIP("10.41.0.2"), Interface: "br-ahwlan"},
+//	    },
+//	})
+//
+// Note: This operation requires appropriate privileges (typically root/CAP_NET_ADMIN).
+func AddMultipathRoute(route *Route) error {
+	return AddMultipathRouteWithRouteTable(route, KernelRouteTable{})
+}
+
+// AddMultipathRouteWithRouteTable adds a multipath route to the provided route
+// table.
+func AddMultipathRouteWithRouteTable(route *Route, routes RouteTable) error {
+	if err := validateMultipathRoute(route); err != nil {
+		return err
+	}
+
+	return routes.AddRoute(route)
+}
@@ -0,0 +1,156 @@
+package network
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+func multipathRoute(gateways ...string) *Route {
+	route := &Route{Metric: 10, Table: unix.RT_TABLE_MAIN}
+	for _, gw := range gateways {
+		route.NextHops = append(route.NextHops, NextHop{Gateway: net.ParseIP(gw), Interface: "br-ahwlan"})
+	}
+	return route
+}
+
+func TestAddMultipathRoute(t *testing.T) {
+	table := &fakeRouteTable{}
+	route := multipathRoute("10.41.0.1", "10.41.0.2")
+	if err := AddMultipathRouteWithRouteTable(route, table); err != nil {
+		t.Fatalf("AddMultipathRouteWithRouteTable() error = %v", err)
+	}
+	if len(table.added) != 1 || table.added[0] != route {
+		t.Errorf("added = %v, want the multipath route", table.added)
+	}
+}
+
+func TestAddMultipathRoute_Invalid(t *testing.T) {
+	single := multipathRoute("10.41.0.1")
+	withGateway := multipathRoute("10.41.0.1", "10.41.0.2")
+	withGateway.Gateway = net.ParseIP("10.41.0.3")
+	noInterface := multipathRoute("10.41.0.1", "10.41.0.2")
+	noInterface.NextHops[1].Interface = ""
+	heavy := multipathRoute("10.41.0.1", "10.41.0.2")
+	heavy.NextHops[0].Weight = 257
+	mixed := multipathRoute("10.41.0.1", "fd00::2")
+	duplicate := multipathRoute("10.41.0.1", "10.41.0.1")
+
+	tests := []struct {
+		name  string
+		route *Route
+	}{
+		{"nil", nil},
+		{"single next hop", single},
+		{"own gateway", withGateway},
+		{"next hop without interface", noInterface},
+		{"weight too large", heavy},
+		{"mixed families", mixed},
+		{"duplicate next hop", duplicate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := &fakeRouteTable{}
+			if err := AddMultipathRouteWithRouteTable(tt.route, table); !errors.Is(err, ErrValidation) {
+				t.Errorf("error = %v, want ErrValidation", err)
+			}
+			if len(table.added) != 0 {
+				t.Errorf("invalid route was added: %v", table.added)
+			}
+		})
+	}
+}
+
+func TestMultipathRoute_Match(t *testing.T) {
+	route := multipathRoute("10.41.0.1", "10.41.0.2")
+
+	// The kernel reports the default destination and the weight explicitly
+	listed := multipathRoute("10.41.0.1", "10.41.0.2")
+	listed.Destination = createTestIPNet("0.0.0.0/0")
+	listed.NextHops[0].Weight = 1
+	if !SameRoute(route, listed) {
+		t.Errorf("SameRoute(%s, %s) = false", route, listed)
+	}
+
+	other := multipathRoute("10.41.0.1", "10.41.0.3")
+	if SameRoute(route, other) {
+		t.Errorf("SameRoute(%s, %s) = true", route, other)
+	}
+	if !routesMatchWith(route, other, MatchOptions{IgnoreGateway: true}) {
+		t.Error("routes with other gateways do not match with IgnoreGateway")
+	}
+
+	weighted := multipathRoute("10.41.0.1", "10.41.0.2")
+	weighted.NextHops[1].Weight = 2
+	if SameRoute(route, weighted) {
+		t.Error("routes with other weights match")
+	}
+
+	single := &Route{Gateway: net.ParseIP("10.41.0.1"), Interface: "br-ahwlan", Metric: 10, Table: unix.RT_TABLE_MAIN}
+	if SameRoute(route, single) {
+		t.Error("multipath route matches a single-path route")
+	}
+
+	// The family of a default multipath route follows its gateways
+	if got := routeDestination(multipathRoute("fd00::1", "fd00::2")).String(); got != "::/0" {
+		t.Errorf("routeDestination() = %s, want ::/0", got)
+	}
+}
+
+func TestReplaceRouteByDestination_Multipath(t *testing.T) {
+	old := &Route{Gateway: net.ParseIP("10.41.0.1"), Interface: "br-ahwlan", Metric: 10, Table: unix.RT_TABLE_MAIN, Protocol: RouteProtocolOpenMANET}
+	table := &fakeRouteTable{routes: []*Route{old}}
+
+	if err := ReplaceRouteByDestinationWithRouteTable(multipathRoute("10.41.0.1", "10.41.0.2"), table); err != nil {
+		t.Fatalf("ReplaceRouteByDestinationWithRouteTable() error = %v", err)
+	}
+	if len(table.deleted) != 1 || table.deleted[0] != old || len(table.routes) != 1 || len(table.routes[0].NextHops) != 2 {
+		t.Fatalf("routes = %v, want only the multipath route", table.routes)
+	}
+
+	// Installing it again changes nothing
+	if err := ReplaceRouteByDestinationWithRouteTable(multipathRoute("10.41.0.1", "10.41.0.2"), table); err != nil {
+		t.Fatalf("ReplaceRouteByDestinationWithRouteTable() error = %v", err)
+	}
+	if len(table.added) != 1 {
+		t.Errorf("multipath route was added %d times, want once", len(table.added))
+	}
+}
+
+func TestMultipathRoute_String(t *testing.T) {
+	route := multipathRoute("10.41.0.1", "10.41.0.2")
+	route.NextHops[1].Weight = 3
+
+	want := "default metric 10 table 254 nexthop via 10.41.0.1 dev br-ahwlan weight 1 nexthop via 10.41.0.2 dev br-ahwlan weight 3"
+	if got := route.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestFromNetlinkNextHops(t *testing.T) {
+	names := func(index int) (string, error) {
+		if index == 2 {
+			return "br-ahwlan", nil
+		}
+		return "", errors.New("no such device")
+	}
+
+	hops, err := fromNetlinkNextHops([]*netlink.NexthopInfo{
+		{LinkIndex: 2, Gw: net.ParseIP("10.41.0.1")},
+		{LinkIndex: 2, Gw: net.ParseIP("10.41.0.2"), Hops: 2},
+	}, names)
+	if err != nil {
+		t.Fatalf("fromNetlinkNextHops() error = %v", err)
+	}
+	if len(hops) != 2 || hops[0].Weight != 1 || hops[1].Weight != 3 || hops[1].Interface != "br-ahwlan" || !hops[1].Gateway.Equal(net.ParseIP("10.41.0.2")) {
+		t.Errorf("next hops = %v", hops)
+	}
+
+	if _, err := fromNetlinkNextHops([]*netlink.NexthopInfo{{LinkIndex: 9}}, names); !errors.Is(err, ErrInterfaceNotFound) {
+		t.Errorf("error = %v, want ErrInterfaceNotFound", err)
+	}
+}
@@ -3,6 +3,7 @@ package network
 import (
 	"errors"
 	"net"
+	"slices"
 	"testing"
 
 	"github.com/vishvananda/netlink"
@@ -282,8 +283,8 @@ func TestAddRoute_NilRoute(t *testing.T) {
 	if err == nil {
 		t.Error("AddRoute(nil) expected error, got nil")
 	}
-	if err.Error() != "route cannot be nil" {
-		t.Errorf("AddRoute(nil) error = %v, want 'route cannot be nil'", err)
+	if !errors.Is(err, ErrValidation) {
+		t.Errorf("AddRoute(nil) error = %v, want ErrValidation", err)
 	}
 }
 
@@ -292,8 +293,8 @@ func TestDeleteRoute_NilRoute(t *testing.T) {
 	if err == nil {
 		t.Error("DeleteRoute(nil) expected error, got nil")
 	}
-	if err.Error() != "route cannot be nil" {
-		t.Errorf("DeleteRoute(nil) error = %v, want 'route cannot be nil'", err)
+	if !errors.Is(err, ErrValidation) {
+		t.Errorf("DeleteRoute(nil) error = %v, want ErrValidation", err)
 	}
 }
 
@@ -302,13 +303,13 @@ func TestReplaceRoute_NilRoute(t *testing.T) {
 	if err == nil {
 		t.Error("ReplaceRoute(nil) expected error, got nil")
 	}
-	if err.Error() != "route cannot be nil" {
-		t.Errorf("ReplaceRoute(nil) error = %v, want 'route cannot be nil'", err)
+	if !errors.Is(err, ErrValidation) {
+		t.Errorf("ReplaceRoute(nil) error = %v, want ErrValidation", err)
 	}
 }
 
 func TestRouteExists_NilRoute(t *testing.T) {
-	exists, err := RouteExists(nil)
+	exists, err := RouteExists(nil, MatchOptions{})
 	if err == nil {
 		t.Error("RouteExists(nil) expected error, got nil")
 	}
@@ -685,3 +686,190 @@ func TestCreateTestDefaultRoute(t *testing.T) {
 		t.Error("createTestDefaultRoute() Interface is empty")
 	}
 }
+
+// fakeRouteTable is an in-memory RouteTable that records what was added and deleted.
+type fakeRouteTable struct {
+	routes  []*Route
+	added   []*Route
+	deleted []*Route
+}
+
+func (f *fakeRouteTable) GetRoutes(table int) ([]*Route, error) {
+	var routes []*Route
+	for _, r := range f.routes {
+		if table == unix.RT_TABLE_UNSPEC || r.Table == table {
+			routes = append(routes, r)
+		}
+	}
+	return routes, nil
+}
+
+func (f *fakeRouteTable) AddRoute(route *Route) error {
+	f.added = append(f.added, route)
+	f.routes = append(f.routes, route)
+	return nil
+}
+
+func (f *fakeRouteTable) DeleteRoute(route *Route) error {
+	for i, r := range f.routes {
+		if r == route {
+			f.deleted = append(f.deleted, route)
+			f.routes = append(f.routes[:i], f.routes[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("no such process")
+}
+
+func TestReplaceRouteByDestination(t *testing.T) {
+	defaultDst := createTestIPNet("0.0.0.0/0")
+	route := func(dst *net.IPNet, gw string, metric int, proto netlink.RouteProtocol) *Route {
+		return &Route{Destination: dst, Gateway: net.ParseIP(gw), Interface: "br-ahwlan", Metric: metric, Table: unix.RT_TABLE_MAIN, Protocol: proto}
+	}
+
+	oldLow := route(defaultDst, "10.41.0.1", 10, RouteProtocolOpenMANET)
+	oldHigh := route(defaultDst, "10.41.0.2", 20, RouteProtocolOpenMANET)
+	netifd := route(defaultDst, "10.41.0.3", 0, netlink.RouteProtocol(unix.RTPROT_BOOT))
+	other := route(createTestIPNet("192.168.50.0/24"), "10.41.0.1", 10, RouteProtocolOpenMANET)
+
+	t.Run("replaces every owned route to the destination", func(t *testing.T) {
+		table := &fakeRouteTable{routes: []*Route{oldLow, oldHigh, netifd, other}}
+
+		err := ReplaceRouteByDestinationWithRouteTable(route(nil, "10.41.0.4", 10, 0), table)
+		if err != nil {
+			t.Fatalf("ReplaceRouteByDestinationWithRouteTable() error = %v", err)
+		}
+
+		if len(table.deleted) != 2 || table.deleted[0] != oldLow || table.deleted[1] != oldHigh {
+			t.Errorf("deleted %v, want both owned default routes", table.deleted)
+		}
+		if len(table.added) != 1 || !table.added[0].Gateway.Equal(net.ParseIP("10.41.0.4")) {
+			t.Fatalf("added %v, want the new default route", table.added)
+		}
+		if table.added[0].Protocol != RouteProtocolOpenMANET {
+			t.Errorf("new route protocol = %d, want %d", table.added[0].Protocol, RouteProtocolOpenMANET)
+		}
+		if len(table.routes) != 3 {
+			t.Errorf("table holds %v, want the netifd route, the other destination and the new route", table.routes)
+		}
+	})
+
+	t.Run("keeps an identical owned route", func(t *testing.T) {
+		table := &fakeRouteTable{routes: []*Route{oldLow, oldHigh, netifd}}
+
+		err := ReplaceRouteByDestinationWithRouteTable(route(nil, "10.41.0.1", 10, 0), table)
+		if err != nil {
+			t.Fatalf("ReplaceRouteByDestinationWithRouteTable() error = %v", err)
+		}
+
+		if len(table.added) != 0 {
+			t.Errorf("added %v, want the existing route kept", table.added)
+		}
+		if len(table.deleted) != 1 || table.deleted[0] != oldHigh {
+			t.Errorf("deleted %v, want only the higher metric duplicate", table.deleted)
+		}
+	})
+
+	t.Run("nil route", func(t *testing.T) {
+		if err := ReplaceRouteByDestinationWithRouteTable(nil, &fakeRouteTable{}); !errors.Is(err, ErrValidation) {
+			t.Errorf("error = %v, want ErrValidation", err)
+		}
+	})
+}
+
+func TestRouteExistsWithRouteTable(t *testing.T) {
+	existing := createTestRoute()
+	table := &fakeRouteTable{routes: []*Route{existing}}
+
+	nearDuplicate := *existing
+	nearDuplicate.Metric = 200
+	nearDuplicate.Gateway = net.ParseIP("10.0.0.2")
+
+	tests := []struct {
+		name string
+		opts MatchOptions
+		want bool
+	}{
+		{"strict", MatchOptions{}, false},
+		{"ignore metric", MatchOptions{IgnoreMetric: true}, false},
+		{"ignore gateway", MatchOptions{IgnoreGateway: true}, false},
+		{"ignore both", MatchOptions{IgnoreMetric: true, IgnoreGateway: true}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RouteExistsWithRouteTable(&nearDuplicate, tt.opts, table)
+			if err != nil {
+				t.Fatalf("RouteExistsWithRouteTable() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("RouteExistsWithRouteTable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindRoutesWithRouteTable(t *testing.T) {
+	mesh := createTestIPNet("10.41.0.0/16")
+	main := &Route{Destination: mesh, Gateway: net.ParseIP("10.41.0.1"), Interface: "br-ahwlan", Metric: 10, Table: unix.RT_TABLE_MAIN}
+	policy := &Route{Destination: mesh, Interface: "br-ahwlan", Metric: 20, Table: 100}
+	other := &Route{Destination: mesh, Gateway: net.ParseIP("192.168.1.1"), Interface: "eth0", Metric: 10, Table: unix.RT_TABLE_MAIN}
+	table := &fakeRouteTable{routes: []*Route{main, policy, other}}
+
+	query := &Route{Destination: mesh, Interface: "br-ahwlan", Table: unix.RT_TABLE_MAIN}
+	tests := []struct {
+		name string
+		opts MatchOptions
+		want []*Route
+	}{
+		{"strict", MatchOptions{}, nil},
+		{"ignore metric and gateway", MatchOptions{IgnoreMetric: true, IgnoreGateway: true}, []*Route{main}},
+		{"any table", MatchOptions{IgnoreMetric: true, IgnoreGateway: true, AnyTable: true}, []*Route{main, policy}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FindRoutesWithRouteTable(query, tt.opts, table)
+			if err != nil {
+				t.Fatalf("FindRoutesWithRouteTable() error = %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("FindRoutesWithRouteTable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := FindRoutesWithRouteTable(nil, MatchOptions{}, table); !errors.Is(err, ErrValidation) {
+		t.Errorf("FindRoutesWithRouteTable(nil) error = %v, want ErrValidation", err)
+	}
+}
+
+func TestGetDefaultRoutesWithRouteTable(t *testing.T) {
+	dhcp := &Route{Destination: createTestIPNet("0.0.0.0/0"), Gateway: net.ParseIP("192.168.1.1"), Interface: "eth0", Table: unix.RT_TABLE_MAIN, Protocol: netlink.RouteProtocol(unix.RTPROT_DHCP)}
+	ours := &Route{Gateway: net.ParseIP("10.41.0.1"), Interface: "br-ahwlan", Metric: 10, Table: unix.RT_TABLE_MAIN, Protocol: RouteProtocolOpenMANET}
+	policy := &Route{Destination: createTestIPNet("0.0.0.0/0"), Interface: "wwan0", Metric: 10, Table: 100}
+	v6 := &Route{Destination: createTestIPNet("::/0"), Gateway: net.ParseIP("fe80::1"), Interface: "eth0", Table: unix.RT_TABLE_MAIN}
+	mesh := &Route{Destination: createTestIPNet("10.41.0.0/16"), Interface: "br-ahwlan", Table: unix.RT_TABLE_MAIN}
+	table := &fakeRouteTable{routes: []*Route{policy, ours, v6, mesh, dhcp}}
+
+	got, err := GetDefaultRoutesWithRouteTable(table)
+	if err != nil {
+		t.Fatalf("GetDefaultRoutesWithRouteTable() error = %v", err)
+	}
+	if want := []*Route{dhcp, policy, ours}; !slices.Equal(got, want) {
+		t.Errorf("GetDefaultRoutesWithRouteTable() = %v, want %v", got, want)
+	}
+}
+
+func TestRoutesMatch_DefaultDestination(t *testing.T) {
+	kernel := &Route{Destination: createTestIPNet("0.0.0.0/0"), Gateway: net.ParseIP("10.41.0.1"), Interface: "br-ahwlan"}
+	ours := &Route{Gateway: net.ParseIP("10.41.0.1"), Interface: "br-ahwlan"}
+	v6 := &Route{Destination: createTestIPNet("::/0"), Gateway: net.ParseIP("10.41.0.1"), Interface: "br-ahwlan"}
+
+	if !routesMatch(kernel, ours) {
+		t.Error("nil destination does not match 0.0.0.0/0")
+	}
+	if routesMatch(v6, ours) {
+		t.Error("IPv4 default route matches ::/0")
+	}
+}
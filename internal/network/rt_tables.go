@@ -0,0 +1,259 @@
+package network
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/openmanet/openmanetd/internal/safemode"
+)
+
+const (
+	// DefaultRouteTablesPath is the file iproute2 reads table names from, so that
+	// 'ip route show table openmanet' works. OpenWrt only ships it with ip-full.
+	DefaultRouteTablesPath string = "/etc/iproute2/rt_tables"
+
+	// OpenMANETRouteTableName is the name of the table mesh routes are installed in,
+	// apart from the main table routes of netifd, DHCP clients and mwan3.
+	OpenMANETRouteTableName string = "openmanet"
+
+	// maxAllocatedRouteTable is the highest table ID AllocateRouteTable hands out.
+	// IDs are handed out downward from it because mwan3 numbers its tables upward
+	// from 1; 253 to 255 are the default, main and local tables.
+	maxAllocatedRouteTable = 252
+)
+
+// ErrRouteTableNotFound is returned when a routing table name is not registered.
+var ErrRouteTableNotFound = errors.New("routing table not found")
+
+// NamedRouteTable is a routing table ID and the name iproute2 shows for it.
+type NamedRouteTable struct {
+	ID   int
+	Name string
+}
+
+// builtinRouteTables are the tables iproute2 knows by name without an rt_tables
+// file.
+var builtinRouteTables = []NamedRouteTable{
+	{ID: 255, Name: "local"},
+	{ID: 254, Name: "main"},
+	{ID: 253, Name: "default"},
+	{ID: 0, Name: "unspec"},
+}
+
+// parseRouteTables parses an rt_tables file, one "<id> <name>" entry per line.
+// Comments, blank lines and malformed lines are skipped, as iproute2 does.
+func parseRouteTables(data []byte) []NamedRouteTable {
+	var tables []NamedRouteTable
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		id, err := strconv.ParseUint(fields[0], 0, 32)
+		if err != nil {
+			continue
+		}
+		tables = append(tables, NamedRouteTable{ID: int(id), Name: fields[1]})
+	}
+
+	return tables
+}
+
+// validateRouteTableName checks that name is a table name iproute2 can read back.
+func validateRouteTableName(name string) error {
+	switch {
+	case name == "":
+		return newValidationError("routing table name cannot be empty")
+	case name[0] >= '0' && name[0] <= '9':
+		return newValidationError("routing table name %q cannot start with a digit", name)
+	case strings.ContainsAny(name, "# \t\n"):
+		return newValidationError("routing table name %q cannot contain '#' or whitespace", name)
+	}
+	return nil
+}
+
+// ReadRouteTables returns the named routing tables of the rt_tables file at path,
+// followed by the built-in local, main, default and unspec tables the file does not
+// name. A missing file names only the built-in tables.
+//
+// Example:
+//
+//	tables, err := ReadRouteTables(DefaultRouteTablesPath)
+//	for _, t := range tables {
+//	    fmt.Printf("%d\t%s\n", t.ID, t.Name)
+//	}
+func ReadRouteTables(path string) ([]NamedRouteTable, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read routing tables: %w", err)
+	}
+
+	tables := parseRouteTables(data)
+	for _, builtin := range builtinRouteTables {
+		if !slices.ContainsFunc(tables, func(t NamedRouteTable) bool { return t.Name == builtin.Name }) {
+			tables = append(tables, builtin)
+		}
+	}
+
+	return tables, nil
+}
+
+// LookupRouteTable returns the ID of the routing table name in the rt_tables file at
+// path. The first entry wins if the name is listed twice, as in iproute2.
+//
+// Returns an ErrRouteTableNotFound error if the name is not registered.
+func LookupRouteTable(path, name string) (int, error) {
+	tables, err := ReadRouteTables(path)
+	if err != nil {
+		return 0, err
+	}
+
+	i := slices.IndexFunc(tables, func(t NamedRouteTable) bool { return t.Name == name })
+	if i < 0 {
+		return 0, fmt.Errorf("%w: %s", ErrRouteTableNotFound, name)
+	}
+
+	return tables[i].ID, nil
+}
+
+// AllocateRouteTable returns the ID of the routing table name in the rt_tables file
+// at path, registering it with a free ID if it is not listed yet. IDs are taken from
+// 252 downward so that they stay clear of the tables mwan3 numbers from 1. The file
+// is created if it does not exist.
+//
+// Returns an ErrValidation error if name is not a valid table name, and an error if
+// every ID from 1 to 252 is taken or the file cannot be read or written.
+//
+// Example:
+//
+//	table, err := AllocateRouteTable(DefaultRouteTablesPath, "openmanet")
+//	if err == nil {
+//	    err = AddRoute(&Route{Gateway: gw, Interface: "br-ahwlan", Table: table})
+//	}
+func AllocateRouteTable(path, name string) (int, error) {
+	if err := validateRouteTableName(name); err != nil {
+		return 0, err
+	}
+
+	tables, err := ReadRouteTables(path)
+	if err != nil {
+		return 0, err
+	}
+	if i := slices.IndexFunc(tables, func(t NamedRouteTable) bool { return t.Name == name }); i >= 0 {
+		return tables[i].ID, nil
+	}
+
+	id := maxAllocatedRouteTable
+	for ; id > 0; id-- {
+		if !slices.ContainsFunc(tables, func(t NamedRouteTable) bool { return t.ID == id }) {
+			break
+		}
+	}
+	if id == 0 {
+		return 0, fmt.Errorf("no free routing table ID for %s", name)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return 0, fmt.Errorf("failed to read routing tables: %w", err)
+	}
+	if len(data) > 0 && !bytes.HasSuffix(data, []byte("\n")) {
+		data = append(data, '\n')
+	}
+	data = fmt.Appendf(data, "%d\t%s\n", id, name)
+
+	if err := writeRouteTables(path, data); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// RemoveRouteTable removes every entry naming the routing table name from the
+// rt_tables file at path. Routes in the table are not touched.
+//
+// Returns true if the file was changed, and an error if it cannot be read or
+// written.
+func RemoveRouteTable(path, name string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read routing tables: %w", err)
+	}
+
+	var kept bytes.Buffer
+	removed := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if entries := parseRouteTables([]byte(line)); len(entries) == 1 && entries[0].Name == name {
+			removed = true
+			continue
+		}
+		kept.WriteString(line)
+		kept.WriteByte('\n')
+	}
+	if !removed {
+		return false, nil
+	}
+
+	if err := writeRouteTables(path, kept.Bytes()); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// OpenMANETRouteTable returns the ID of the openmanet routing table, registering it
+// in DefaultRouteTablesPath on first use.
+func OpenMANETRouteTable() (int, error) {
+	return AllocateRouteTable(DefaultRouteTablesPath, OpenMANETRouteTableName)
+}
+
+// writeRouteTables atomically replaces the rt_tables file at path with data.
+func writeRouteTables(path string, data []byte) error {
+	if err := safemode.Check("write " + path); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create routing tables directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary routing tables file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write routing tables: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write routing tables: %w", err)
+	}
+
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return fmt.Errorf("failed to set routing tables permissions: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace routing tables: %w", err)
+	}
+
+	return nil
+}
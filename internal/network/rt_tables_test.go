@@ -0,0 +1,96 @@
+package network
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+const testRouteTables = `#
+# reserved values
+#
+255	local
+254	main
+253	default
+0	unspec
+#
+# local
+#
+1	wan # mwan3
+252	vpn
+`
+
+func TestReadRouteTables(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rt_tables")
+
+	tables, err := ReadRouteTables(path)
+	if err != nil {
+		t.Fatalf("ReadRouteTables() of a missing file error = %v", err)
+	}
+	if !slices.Equal(tables, builtinRouteTables) {
+		t.Errorf("ReadRouteTables() of a missing file = %v, want the built-in tables", tables)
+	}
+
+	if err := os.WriteFile(path, []byte(testRouteTables+"garbage\n0x64 hex\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if id, err := LookupRouteTable(path, "wan"); err != nil || id != 1 {
+		t.Errorf("LookupRouteTable(wan) = %d, %v, want 1", id, err)
+	}
+	if id, err := LookupRouteTable(path, "hex"); err != nil || id != 100 {
+		t.Errorf("LookupRouteTable(hex) = %d, %v, want 100", id, err)
+	}
+	if _, err := LookupRouteTable(path, "garbage"); !errors.Is(err, ErrRouteTableNotFound) {
+		t.Errorf("LookupRouteTable(garbage) error = %v, want ErrRouteTableNotFound", err)
+	}
+}
+
+func TestAllocateRouteTable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rt_tables")
+	if err := os.WriteFile(path, []byte(testRouteTables), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := AllocateRouteTable(path, OpenMANETRouteTableName)
+	if err != nil {
+		t.Fatalf("AllocateRouteTable() error = %v", err)
+	}
+	if id != 251 {
+		t.Errorf("AllocateRouteTable() = %d, want 251, the highest free ID", id)
+	}
+	if again, err := AllocateRouteTable(path, OpenMANETRouteTableName); err != nil || again != id {
+		t.Errorf("AllocateRouteTable() again = %d, %v, want %d", again, err, id)
+	}
+
+	data, _ := os.ReadFile(path)
+	if want := testRouteTables + "251\topenmanet\n"; string(data) != want {
+		t.Errorf("rt_tables = %q, want %q", data, want)
+	}
+
+	removed, err := RemoveRouteTable(path, OpenMANETRouteTableName)
+	if err != nil || !removed {
+		t.Fatalf("RemoveRouteTable() = %v, %v, want true", removed, err)
+	}
+	data, _ = os.ReadFile(path)
+	if string(data) != testRouteTables {
+		t.Errorf("rt_tables after removal = %q, want the original file", data)
+	}
+	if removed, err := RemoveRouteTable(path, OpenMANETRouteTableName); err != nil || removed {
+		t.Errorf("RemoveRouteTable() again = %v, %v, want false", removed, err)
+	}
+}
+
+func TestAllocateRouteTable_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rt_tables")
+
+	for _, name := range []string{"", "100", "open manet", "mesh#1"} {
+		if _, err := AllocateRouteTable(path, name); !errors.Is(err, ErrValidation) {
+			t.Errorf("AllocateRouteTable(%q) error = %v, want ErrValidation", name, err)
+		}
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("rt_tables was written for invalid names: %v", err)
+	}
+}
@@ -0,0 +1,250 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/openmanet/openmanetd/internal/safemode"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// minRulePriority and maxRulePriority bound the priorities AddRule accepts. The
+	// kernel puts the local table rule at 0 and the main and default table rules at
+	// 32766 and 32767.
+	minRulePriority = 1
+	maxRulePriority = 32765
+)
+
+// Rule represents a policy routing rule, as 'ip rule' lists them. A packet that
+// matches every selector that is set is looked up in Table.
+//
+// Fields:
+//   - Priority: The order of the rule; lower values are consulted first.
+//   - Table: The routing table the rule looks up (e.g., unix.RT_TABLE_MAIN).
+//   - Mark: Matches packets whose firewall mark, masked with Mask, equals Mark. 0
+//     matches any packet unless Mask is set.
+//   - Mask: The bits of the mark that are compared; 0 compares all of them.
+//   - Source: Matches packets from this network. nil matches any source.
+//   - Family: The address family, unix.AF_INET or unix.AF_INET6. 0 takes the family
+//     of Source, or IPv4 without one.
+//   - Protocol: Who installed the rule, as for routes (e.g., RouteProtocolOpenMANET).
+//   - SuppressDefault: Ignores the default routes of Table, so that the lookup only
+//     succeeds on a more specific route and falls through to the next rule otherwise,
+//     as 'suppress_prefixlength 0' does.
+type Rule struct {
+	Priority        int
+	Table           int
+	Mark            uint32
+	Mask            uint32
+	Source          *net.IPNet
+	Family          int
+	Protocol        netlink.RouteProtocol
+	SuppressDefault bool
+}
+
+// String returns the rule the way 'ip rule' prints it.
+func (r *Rule) String() string {
+	if r == nil {
+		return "<nil>"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d:", r.Priority)
+	if r.Source != nil {
+		fmt.Fprintf(&b, " from %s", r.Source)
+	} else {
+		b.WriteString(" from all")
+	}
+	if r.Mark != 0 || r.Mask != 0 {
+		fmt.Fprintf(&b, " fwmark 0x%x", r.Mark)
+		if r.Mask != 0 {
+			fmt.Fprintf(&b, "/0x%x", r.Mask)
+		}
+	}
+	fmt.Fprintf(&b, " lookup %d", r.Table)
+	if r.SuppressDefault {
+		b.WriteString(" suppress_prefixlength 0")
+	}
+
+	return b.String()
+}
+
+// family returns the address family of the rule.
+func (r *Rule) family() int {
+	switch {
+	case r.Family != 0:
+		return r.Family
+	case r.Source != nil && r.Source.IP.To4() == nil:
+		return unix.AF_INET6
+	default:
+		return unix.AF_INET
+	}
+}
+
+// validate checks that the rule can be added or deleted.
+func (r *Rule) validate() error {
+	if r.Priority < minRulePriority || r.Priority > maxRulePriority {
+		return newValidationError("rule priority must be from %d to %d, got %d", minRulePriority, maxRulePriority, r.Priority)
+	}
+	if r.Table <= 0 {
+		return newValidationError("rule table must be positive, got %d", r.Table)
+	}
+	if r.Mask != 0 && r.Mark&^r.Mask != 0 {
+		return newValidationError("mark 0x%x does not fit within mask 0x%x", r.Mark, r.Mask)
+	}
+
+	family := r.family()
+	if family != unix.AF_INET && family != unix.AF_INET6 {
+		return newValidationError("rule family must be AF_INET or AF_INET6, got %d", family)
+	}
+	if r.Source != nil {
+		if r.Source.IP == nil || r.Source.Mask == nil {
+			return newValidationError("rule source must have an address and a prefix")
+		}
+		if (r.Source.IP.To4() != nil) != (family == unix.AF_INET) {
+			return newValidationError("rule source %s does not match the rule family", r.Source)
+		}
+	}
+
+	return nil
+}
+
+// toNetlink converts the rule for the netlink package.
+func (r *Rule) toNetlink() *netlink.Rule {
+	rule := netlink.NewRule()
+	rule.Priority = r.Priority
+	rule.Table = r.Table
+	rule.Family = r.family()
+	rule.Src = r.Source
+	rule.Mark = r.Mark
+	if r.Mask != 0 {
+		mask := r.Mask
+		rule.Mask = &mask
+	}
+	rule.Protocol = uint8(r.Protocol)
+	if r.SuppressDefault {
+		rule.SuppressPrefixlen = 0
+	}
+
+	return rule
+}
+
+// fromNetlinkRule converts a rule listed by the netlink package.
+func fromNetlinkRule(r netlink.Rule) *Rule {
+	rule := &Rule{
+		Priority: r.Priority,
+		Table:    r.Table,
+		Mark:     r.Mark,
+		Source:   r.Src,
+		Family:   r.Family,
+		Protocol: netlink.RouteProtocol(r.Protocol),
+		// The kernel reports no suppression as -1
+		SuppressDefault: r.SuppressPrefixlen == 0,
+	}
+	if r.Mask != nil {
+		rule.Mask = *r.Mask
+	}
+
+	return rule
+}
+
+// ruleList, ruleAdd and ruleDel are overridable for tests.
+var (
+	ruleList = netlink.RuleList
+	ruleAdd  = netlink.RuleAdd
+	ruleDel  = netlink.RuleDel
+)
+
+// AddRule adds a policy routing rule, e.g. to send the traffic of the clients of the
+// mesh, marked by the firewall, through the table of the selected gateway while
+// management traffic keeps using the main table. Adding a rule that exists already
+// does nothing.
+//
+// Returns an ErrValidation error if the rule is nil or invalid.
+//
+// Example:
+//
+//	err := AddRule(&Rule{
+//	    Priority: 1000,
+//	    Mark:     0x10,
+//	    Mask:     0xf0,
+//	    Table:    100,
+//	    Protocol: RouteProtocolOpenMANET,
+//	})
+//
+// Note: This operation requires appropriate privileges (typically root/CAP_NET_ADMIN).
+func AddRule(rule *Rule) error {
+	if rule == nil {
+		return newValidationError("rule cannot be nil")
+	}
+	if err := rule.validate(); err != nil {
+		return err
+	}
+
+	if err := safemode.Check(fmt.Sprintf("add rule %s", rule)); err != nil {
+		return err
+	}
+
+	if err := ruleAdd(rule.toNetlink()); err != nil && !errors.Is(err, unix.EEXIST) {
+		return fmt.Errorf("failed to add rule %s: %w", rule, err)
+	}
+
+	return nil
+}
+
+// DeleteRule deletes the policy routing rule that matches rule in every field.
+// Deleting a rule that does not exist does nothing.
+//
+// Returns an ErrValidation error if the rule is nil or invalid.
+//
+// Note: This operation requires appropriate privileges (typically root/CAP_NET_ADMIN).
+func DeleteRule(rule *Rule) error {
+	if rule == nil {
+		return newValidationError("rule cannot be nil")
+	}
+	if err := rule.validate(); err != nil {
+		return err
+	}
+
+	if err := safemode.Check(fmt.Sprintf("delete rule %s", rule)); err != nil {
+		return err
+	}
+
+	if err := ruleDel(rule.toNetlink()); err != nil && !errors.Is(err, unix.ENOENT) {
+		return fmt.Errorf("failed to delete rule %s: %w", rule, err)
+	}
+
+	return nil
+}
+
+// ListRules returns the policy routing rules of family, unix.AF_INET or
+// unix.AF_INET6, in priority order, including those of the kernel for the local,
+// main and default tables.
+//
+// Example:
+//
+//	rules, err := ListRules(unix.AF_INET)
+//	for _, r := range rules {
+//	    fmt.Println(r)
+//	}
+func ListRules(family int) ([]*Rule, error) {
+	if family != unix.AF_INET && family != unix.AF_INET6 {
+		return nil, newValidationError("rule family must be AF_INET or AF_INET6, got %d", family)
+	}
+
+	nlRules, err := ruleList(family)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rules: %w", err)
+	}
+
+	rules := make([]*Rule, 0, len(nlRules))
+	for _, r := range nlRules {
+		rules = append(rules, fromNetlinkRule(r))
+	}
+
+	return rules, nil
+}
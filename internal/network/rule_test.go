@@ -0,0 +1,187 @@
+package network
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// stubRules replaces the netlink rule calls, recording the rules added and deleted.
+func stubRules(t *testing.T, err error) (added, deleted *[]*netlink.Rule) {
+	t.Helper()
+
+	oldList, oldAdd, oldDel := ruleList, ruleAdd, ruleDel
+	t.Cleanup(func() { ruleList, ruleAdd, ruleDel = oldList, oldAdd, oldDel })
+
+	added, deleted = &[]*netlink.Rule{}, &[]*netlink.Rule{}
+	ruleAdd = func(r *netlink.Rule) error {
+		*added = append(*added, r)
+		return err
+	}
+	ruleDel = func(r *netlink.Rule) error {
+		*deleted = append(*deleted, r)
+		return err
+	}
+
+	return added, deleted
+}
+
+func TestAddRule(t *testing.T) {
+	added, _ := stubRules(t, nil)
+
+	_, src, _ := net.ParseCIDR("10.41.0.0/16")
+	rule := &Rule{Priority: 1000, Table: 100, Mark: 0x10, Mask: 0xf0, Source: src, Protocol: RouteProtocolOpenMANET}
+	if err := AddRule(rule); err != nil {
+		t.Fatalf("AddRule() error = %v", err)
+	}
+
+	if len(*added) != 1 {
+		t.Fatalf("added %d rules, want 1", len(*added))
+	}
+	got := (*added)[0]
+	if got.Priority != 1000 || got.Table != 100 || got.Family != unix.AF_INET || got.Src != src ||
+		got.Mark != 0x10 || got.Mask == nil || *got.Mask != 0xf0 || got.Protocol != uint8(RouteProtocolOpenMANET) {
+		t.Errorf("netlink rule = %+v", got)
+	}
+	// Selectors that are not set must stay unset
+	if got.Goto != -1 || got.Flow != -1 || got.SuppressPrefixlen != -1 {
+		t.Errorf("netlink rule sets unrequested selectors: %+v", got)
+	}
+
+	// Without a mask the mark is compared whole
+	if err := AddRule(&Rule{Priority: 1001, Table: 100, Mark: 0x1}); err != nil {
+		t.Fatalf("AddRule() error = %v", err)
+	}
+	if got := (*added)[1]; got.Mask != nil {
+		t.Errorf("netlink rule mask = %v, want unset", *got.Mask)
+	}
+
+	// IPv6 follows the source
+	_, src6, _ := net.ParseCIDR("fd00::/64")
+	if err := AddRule(&Rule{Priority: 1002, Table: 100, Source: src6}); err != nil {
+		t.Fatalf("AddRule() error = %v", err)
+	}
+	if got := (*added)[2]; got.Family != unix.AF_INET6 {
+		t.Errorf("netlink rule family = %d, want AF_INET6", got.Family)
+	}
+}
+
+func TestAddRule_Invalid(t *testing.T) {
+	added, _ := stubRules(t, nil)
+
+	_, src, _ := net.ParseCIDR("10.41.0.0/16")
+	tests := []struct {
+		name string
+		rule *Rule
+	}{
+		{"nil", nil},
+		{"local priority", &Rule{Priority: 0, Table: 100}},
+		{"main priority", &Rule{Priority: 32766, Table: 100}},
+		{"no table", &Rule{Priority: 1000}},
+		{"mark outside mask", &Rule{Priority: 1000, Table: 100, Mark: 0x101, Mask: 0xff}},
+		{"family mismatch", &Rule{Priority: 1000, Table: 100, Source: src, Family: unix.AF_INET6}},
+		{"unknown family", &Rule{Priority: 1000, Table: 100, Family: unix.AF_UNIX}},
+		{"source without prefix", &Rule{Priority: 1000, Table: 100, Source: &net.IPNet{IP: net.ParseIP("10.41.0.1")}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := AddRule(tt.rule); !errors.Is(err, ErrValidation) {
+				t.Errorf("AddRule() error = %v, want ErrValidation", err)
+			}
+			if err := DeleteRule(tt.rule); !errors.Is(err, ErrValidation) {
+				t.Errorf("DeleteRule() error = %v, want ErrValidation", err)
+			}
+		})
+	}
+
+	if len(*added) != 0 {
+		t.Errorf("invalid rules were added: %v", *added)
+	}
+}
+
+func TestAddDeleteRule_Idempotent(t *testing.T) {
+	rule := &Rule{Priority: 1000, Table: 100}
+
+	stubRules(t, unix.EEXIST)
+	if err := AddRule(rule); err != nil {
+		t.Errorf("AddRule() of an existing rule error = %v", err)
+	}
+
+	_, deleted := stubRules(t, unix.ENOENT)
+	if err := DeleteRule(rule); err != nil {
+		t.Errorf("DeleteRule() of a missing rule error = %v", err)
+	}
+	if len(*deleted) != 1 || (*deleted)[0].Priority != 1000 {
+		t.Errorf("deleted = %v, want the rule at 1000", *deleted)
+	}
+
+	stubRules(t, unix.EPERM)
+	if err := AddRule(rule); !errors.Is(err, unix.EPERM) {
+		t.Errorf("AddRule() error = %v, want EPERM", err)
+	}
+	if err := DeleteRule(rule); !errors.Is(err, unix.EPERM) {
+		t.Errorf("DeleteRule() error = %v, want EPERM", err)
+	}
+}
+
+func TestAddRule_SuppressDefault(t *testing.T) {
+	added, _ := stubRules(t, nil)
+
+	rule := &Rule{Priority: 10000, Table: unix.RT_TABLE_MAIN, SuppressDefault: true}
+	if err := AddRule(rule); err != nil {
+		t.Fatalf("AddRule() error = %v", err)
+	}
+	if got := (*added)[0]; got.SuppressPrefixlen != 0 {
+		t.Errorf("netlink rule suppress_prefixlength = %d, want 0", got.SuppressPrefixlen)
+	}
+	if got, want := rule.String(), "10000: from all lookup 254 suppress_prefixlength 0"; got != want {
+		t.Errorf("rule = %q, want %q", got, want)
+	}
+	if back := fromNetlinkRule(*(*added)[0]); !back.SuppressDefault {
+		t.Errorf("listed rule = %v, want the default routes suppressed", back)
+	}
+}
+
+func TestListRules(t *testing.T) {
+	stubRules(t, nil)
+
+	_, src, _ := net.ParseCIDR("10.41.0.0/16")
+	mask := uint32(0xf0)
+	ruleList = func(family int) ([]netlink.Rule, error) {
+		if family != unix.AF_INET {
+			t.Errorf("family = %d, want AF_INET", family)
+		}
+		// The netlink package reports unset selectors as -1, as NewRule sets them
+		return []netlink.Rule{
+			{Priority: 0, Table: unix.RT_TABLE_LOCAL, Family: unix.AF_INET, SuppressPrefixlen: -1},
+			{Priority: 1000, Table: 100, Family: unix.AF_INET, Src: src, Mark: 0x10, Mask: &mask, Protocol: uint8(RouteProtocolOpenMANET), SuppressPrefixlen: -1},
+			{Priority: 32766, Table: unix.RT_TABLE_MAIN, Family: unix.AF_INET, SuppressPrefixlen: -1},
+		}, nil
+	}
+
+	rules, err := ListRules(unix.AF_INET)
+	if err != nil {
+		t.Fatalf("ListRules() error = %v", err)
+	}
+	if len(rules) != 3 {
+		t.Fatalf("got %d rules, want 3", len(rules))
+	}
+
+	if got, want := rules[1].String(), "1000: from 10.41.0.0/16 fwmark 0x10/0xf0 lookup 100"; got != want {
+		t.Errorf("rule = %q, want %q", got, want)
+	}
+	if rules[1].Protocol != RouteProtocolOpenMANET {
+		t.Errorf("Protocol = %d, want %d", rules[1].Protocol, RouteProtocolOpenMANET)
+	}
+	if got, want := rules[2].String(), "32766: from all lookup 254"; got != want {
+		t.Errorf("rule = %q, want %q", got, want)
+	}
+
+	if _, err := ListRules(unix.AF_UNIX); !errors.Is(err, ErrValidation) {
+		t.Errorf("ListRules(AF_UNIX) error = %v, want ErrValidation", err)
+	}
+}
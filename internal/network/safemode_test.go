@@ -0,0 +1,65 @@
+package network
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/digineo/go-uci/v2"
+	"github.com/openmanet/openmanetd/internal/safemode"
+)
+
+func TestSafeMode_SuppressesChanges(t *testing.T) {
+	safemode.Set(true, "test")
+	defer safemode.Set(false, "test")
+
+	dir := t.TempDir()
+	dhcp := "config dhcp 'lan'\n\toption interface 'lan'\n\toption start '100'\n\toption limit '150'\n"
+	if err := os.WriteFile(filepath.Join(dir, "dhcp"), []byte(dhcp), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	reader := &UCIDHCPConfigReader{tree: uci.NewTree(dir)}
+
+	_, dst, _ := net.ParseCIDR("10.99.0.0/24")
+
+	tests := []struct {
+		name string
+		op   func() error
+	}{
+		{"uci", func() error {
+			_, err := SetDHCPRangeWithReader("lan", "10", "20", reader)
+			return err
+		}},
+		{"route", func() error { return AddRoute(&Route{Destination: dst, Interface: "lo"}) }},
+		{"link down", func() error { return LinkDown("lo") }},
+		{"rule", func() error { return AddRule(&Rule{Priority: 1000, Table: 100}) }},
+		{"neighbor", func() error { return DeleteNeighbor("lo", net.ParseIP("10.99.0.1")) }},
+		{"address", func() error { return AddAddress("lo", &net.IPNet{IP: net.ParseIP("10.99.0.1"), Mask: dst.Mask}) }},
+		{"link MTU", func() error { return SetMTU("lo", 1500) }},
+		{"bridge", func() error { return CreateBridge("br-omtest") }},
+		{"wireguard", func() error { return DeleteWireGuard("wg-omtest") }},
+		{"tunnel", func() error { return DeleteTunnel("vx-omtest") }},
+		{"network reload", ReloadNetwork},
+		{"interface restart", func() error { return RestartNetworkInterface("ahwlan") }},
+		{"dnsmasq reload", ReloadDnsmasq},
+		{"dnsmasq restart", RestartDnsmasq},
+		{"system reload", ReloadSystem},
+		{"mwan3 restart", RestartMwan3},
+		{"sqm restart", RestartSQM},
+		{"wifi reload", ReloadWifi},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.op(); !errors.Is(err, safemode.ErrSuppressed) {
+				t.Errorf("error = %v, want ErrSuppressed", err)
+			}
+		})
+	}
+
+	if got, _ := os.ReadFile(filepath.Join(dir, "dhcp")); string(got) != dhcp {
+		t.Errorf("dhcp config was changed in safe mode:\n%s", got)
+	}
+}
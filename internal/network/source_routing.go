@@ -0,0 +1,267 @@
+package network
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// DefaultSourceRulePriority is the priority of the first source routing rule,
+	// ahead of the main table rule at 32766 so that the table of an uplink is looked
+	// up first. A lookup in a table without a route falls through to the next rule.
+	DefaultSourceRulePriority = 10000
+
+	// maxSourceRules is the number of priorities, from the first, that the source
+	// routing rules take up. Rules we own in that range are replaced as a whole.
+	maxSourceRules = 256
+)
+
+// Uplink is an uplink of a gateway node and the mesh traffic sent out through it,
+// e.g. a wired WAN and an LTE modem, each with a routing table of its own holding
+// its default route.
+//
+// Fields:
+//   - Name: The name of the uplink, e.g. "wan" or "lte".
+//   - Interface: The uplink interface, e.g. "eth0" or "wwan0".
+//   - Gateway: The next hop on the uplink. nil for a point-to-point link, such as an
+//     LTE modem in raw IP mode.
+//   - Table: The routing table of the uplink; not the local, main or default table.
+//   - Sources: The IPv4 networks whose traffic is sent out through the uplink, e.g.
+//     the mesh subnet, or the address of one node as a /32.
+type Uplink struct {
+	Name      string
+	Interface string
+	Gateway   net.IP
+	Table     int
+	Sources   []*net.IPNet
+}
+
+// NewUplink builds a validated uplink from its configuration.
+//
+// Returns an ErrValidation error if the gateway or a source does not parse or any
+// field is invalid.
+//
+// Example:
+//
+//	lte, err := NewUplink("lte", "wwan0", "", 201, []string{"10.41.0.23/32"})
+func NewUplink(name, iface, gateway string, table int, sources []string) (*Uplink, error) {
+	uplink := &Uplink{Name: name, Interface: iface, Table: table}
+
+	if gateway != "" {
+		if uplink.Gateway = net.ParseIP(gateway); uplink.Gateway == nil {
+			return nil, newValidationError("uplink %s gateway %q is not an IP address", name, gateway)
+		}
+	}
+	for _, source := range sources {
+		_, ipNet, err := net.ParseCIDR(source)
+		if err != nil {
+			// A bare address stands for that host
+			ip := net.ParseIP(source).To4()
+			if ip == nil {
+				return nil, newValidationError("uplink %s source %q is not an IPv4 network or address", name, source)
+			}
+			ipNet = &net.IPNet{IP: ip, Mask: net.CIDRMask(32, 32)}
+		}
+		uplink.Sources = append(uplink.Sources, ipNet)
+	}
+
+	if err := uplink.validate(); err != nil {
+		return nil, err
+	}
+
+	return uplink, nil
+}
+
+// validate checks that the uplink can be routed through.
+func (u *Uplink) validate() error {
+	switch {
+	case u.Name == "":
+		return newValidationError("uplink name cannot be empty")
+	case u.Interface == "":
+		return newValidationError("uplink %s interface cannot be empty", u.Name)
+	case u.Gateway != nil && u.Gateway.To4() == nil:
+		return newValidationError("uplink %s gateway %s is not an IPv4 address", u.Name, u.Gateway)
+	case u.Table <= 0 || (u.Table >= unix.RT_TABLE_DEFAULT && u.Table <= unix.RT_TABLE_LOCAL):
+		return newValidationError("uplink %s table must be positive and not the default, main or local table, got %d", u.Name, u.Table)
+	case len(u.Sources) == 0:
+		return newValidationError("uplink %s has no sources", u.Name)
+	}
+
+	for _, source := range u.Sources {
+		if source == nil || source.IP.To4() == nil {
+			return newValidationError("uplink %s source %v is not an IPv4 network", u.Name, source)
+		}
+	}
+
+	return nil
+}
+
+// Route returns the default route of the uplink, in its table.
+func (u *Uplink) Route() *Route {
+	return &Route{
+		Destination: &net.IPNet{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 32)},
+		Gateway:     u.Gateway,
+		Interface:   u.Interface,
+		Table:       u.Table,
+		Scope:       netlink.SCOPE_UNIVERSE,
+		Protocol:    RouteProtocolOpenMANET,
+	}
+}
+
+// SourceRules returns the rules that send the traffic of the sources of each uplink
+// to its table, numbered upward from priority. More specific sources come first, so
+// one node sent out through LTE is picked out of a mesh subnet sent out through the
+// WAN whatever the order of the uplinks.
+//
+// The first rule looks up the main table without its default routes, so that
+// traffic from a source to the mesh, the LAN or anything else the main table has a
+// route to stays off the uplinks. No rules are returned for no uplinks.
+//
+// Returns an ErrValidation error if an uplink is invalid, two uplinks have the same
+// name or table, a source is listed twice, or the rules do not fit between priority
+// and the main table rule.
+func SourceRules(uplinks []*Uplink, priority int) ([]*Rule, error) {
+	if priority < minRulePriority || priority > maxRulePriority {
+		return nil, newValidationError("source rule priority must be from %d to %d, got %d", minRulePriority, maxRulePriority, priority)
+	}
+
+	var rules []*Rule
+	for i, uplink := range uplinks {
+		if uplink == nil {
+			return nil, newValidationError("uplink cannot be nil")
+		}
+		if err := uplink.validate(); err != nil {
+			return nil, err
+		}
+		for _, other := range uplinks[:i] {
+			if other.Name == uplink.Name || other.Table == uplink.Table {
+				return nil, newValidationError("uplinks %s and %s have the same name or table", other.Name, uplink.Name)
+			}
+		}
+
+		for _, source := range uplink.Sources {
+			if slices.ContainsFunc(rules, func(r *Rule) bool { return r.Source.String() == source.String() }) {
+				return nil, newValidationError("source %s is listed for more than one uplink", source)
+			}
+			rules = append(rules, &Rule{Table: uplink.Table, Source: source, Family: unix.AF_INET, Protocol: RouteProtocolOpenMANET})
+		}
+	}
+
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	slices.SortStableFunc(rules, func(a, b *Rule) int {
+		onesA, _ := a.Source.Mask.Size()
+		onesB, _ := b.Source.Mask.Size()
+		return cmp.Compare(onesB, onesA)
+	})
+	rules = slices.Insert(rules, 0, &Rule{Table: unix.RT_TABLE_MAIN, Family: unix.AF_INET, Protocol: RouteProtocolOpenMANET, SuppressDefault: true})
+
+	if len(rules) > maxSourceRules || priority+len(rules)-1 > maxRulePriority {
+		return nil, newValidationError("%d source rules do not fit from priority %d", len(rules), priority)
+	}
+	for i, rule := range rules {
+		rule.Priority = priority + i
+	}
+
+	return rules, nil
+}
+
+// sameRule reports whether two rules select the same packets into the same table at
+// the same priority.
+func sameRule(r1, r2 *Rule) bool {
+	return r1.Priority == r2.Priority && r1.Table == r2.Table && r1.Mark == r2.Mark && r1.Mask == r2.Mask &&
+		r1.Source.String() == r2.Source.String() && r1.SuppressDefault == r2.SuppressDefault
+}
+
+// ApplySourceRouting makes uplinks the source routing of a gateway node: the default
+// route of each uplink is installed in its table and the traffic of its sources is
+// sent there with a rule from priority upward, so that a gateway with both a WAN and
+// an LTE uplink can send the traffic of chosen mesh nodes out through either.
+// Traffic from other sources keeps using the main table. Routes and rules we own for
+// uplinks no longer listed are removed, so an empty list undoes it all.
+//
+// A default route that cannot be installed, e.g. because the LTE modem is down,
+// leaves the table of its uplink empty; the traffic of its sources then falls
+// through to the main table. The other uplinks are applied all the same.
+//
+// Returns an ErrValidation error if SourceRules rejects the uplinks, and an error
+// joining every route and rule that could not be changed.
+//
+// Example:
+//
+//	wan, _ := NewUplink("wan", "eth0", "192.0.2.1", 200, []string{"10.41.0.0/16"})
+//	lte, _ := NewUplink("lte", "wwan0", "", 201, []string{"10.41.0.23"})
+//	err := ApplySourceRouting([]*Uplink{wan, lte}, DefaultSourceRulePriority)
+//
+// Note: This operation requires appropriate privileges (typically root/CAP_NET_ADMIN).
+// Replies to traffic from the mesh come back through the masquerading of the uplink
+// zone, which must cover every uplink interface.
+func ApplySourceRouting(uplinks []*Uplink, priority int) error {
+	return ApplySourceRoutingWithRouteTable(uplinks, priority, KernelRouteTable{})
+}
+
+// ApplySourceRoutingWithRouteTable applies source routing using the provided route
+// table.
+func ApplySourceRoutingWithRouteTable(uplinks []*Uplink, priority int, routes RouteTable) error {
+	desired, err := SourceRules(uplinks, priority)
+	if err != nil {
+		return err
+	}
+
+	installed, err := ListRules(unix.AF_INET)
+	if err != nil {
+		return err
+	}
+	current := slices.DeleteFunc(installed, func(r *Rule) bool {
+		return r.Protocol != RouteProtocolOpenMANET || r.Priority < priority || r.Priority >= priority+maxSourceRules
+	})
+
+	// The tables of stale rules are emptied along with those still in use
+	var tables []int
+	for _, uplink := range uplinks {
+		tables = append(tables, uplink.Table)
+	}
+	for _, rule := range current {
+		tables = append(tables, rule.Table)
+	}
+	slices.Sort(tables)
+
+	var errs []error
+	defaultDst := []*net.IPNet{{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 32)}}
+	for _, table := range slices.Compact(tables) {
+		var tableRoutes []*Route
+		if i := slices.IndexFunc(uplinks, func(u *Uplink) bool { return u.Table == table }); i >= 0 {
+			tableRoutes = append(tableRoutes, uplinks[i].Route())
+		}
+		if err := ApplyRoutesWithRouteTable(tableRoutes, ApplyOptions{Tables: []int{table}, Destinations: defaultDst}, routes); err != nil {
+			errs = append(errs, fmt.Errorf("table %d: %w", table, err))
+		}
+	}
+
+	for _, rule := range desired {
+		if slices.ContainsFunc(current, func(r *Rule) bool { return sameRule(r, rule) }) {
+			continue
+		}
+		if err := AddRule(rule); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, rule := range current {
+		if slices.ContainsFunc(desired, func(r *Rule) bool { return sameRule(r, rule) }) {
+			continue
+		}
+		if err := DeleteRule(rule); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,173 @@
+package network
+
+import (
+	"errors"
+	"net"
+	"slices"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+func TestNewUplink(t *testing.T) {
+	uplink, err := NewUplink("lte", "wwan0", "", 201, []string{"10.41.0.0/16", "10.41.0.23"})
+	if err != nil {
+		t.Fatalf("NewUplink() error = %v", err)
+	}
+	if uplink.Gateway != nil || len(uplink.Sources) != 2 || uplink.Sources[1].String() != "10.41.0.23/32" {
+		t.Errorf("NewUplink() = %+v, want no gateway and a bare address as a /32", uplink)
+	}
+
+	route := uplink.Route()
+	if route.Interface != "wwan0" || route.Table != 201 || route.Protocol != RouteProtocolOpenMANET || route.Destination.String() != "0.0.0.0/0" {
+		t.Errorf("Route() = %v, want the default route of table 201 tagged as ours", route)
+	}
+
+	tests := []struct {
+		name    string
+		iface   string
+		gateway string
+		table   int
+		sources []string
+	}{
+		{"no interface", "", "192.0.2.1", 200, []string{"10.41.0.0/16"}},
+		{"bad gateway", "eth0", "192.0.2", 200, []string{"10.41.0.0/16"}},
+		{"IPv6 gateway", "eth0", "fe80::1", 200, []string{"10.41.0.0/16"}},
+		{"no table", "eth0", "192.0.2.1", 0, []string{"10.41.0.0/16"}},
+		{"main table", "eth0", "192.0.2.1", unix.RT_TABLE_MAIN, []string{"10.41.0.0/16"}},
+		{"no sources", "eth0", "192.0.2.1", 200, nil},
+		{"bad source", "eth0", "192.0.2.1", 200, []string{"10.41.0.0/33"}},
+		{"IPv6 source", "eth0", "192.0.2.1", 200, []string{"fd00::/64"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewUplink("wan", tt.iface, tt.gateway, tt.table, tt.sources); !errors.Is(err, ErrValidation) {
+				t.Errorf("error = %v, want ErrValidation", err)
+			}
+		})
+	}
+}
+
+func TestSourceRules(t *testing.T) {
+	wan, _ := NewUplink("wan", "eth0", "192.0.2.1", 200, []string{"10.41.0.0/16"})
+	lte, _ := NewUplink("lte", "wwan0", "", 201, []string{"10.41.0.23", "10.41.5.0/24"})
+
+	rules, err := SourceRules([]*Uplink{wan, lte}, 10000)
+	if err != nil {
+		t.Fatalf("SourceRules() error = %v", err)
+	}
+
+	var got []string
+	for _, rule := range rules {
+		got = append(got, rule.String())
+	}
+	want := []string{
+		"10000: from all lookup 254 suppress_prefixlength 0",
+		"10001: from 10.41.0.23/32 lookup 201",
+		"10002: from 10.41.5.0/24 lookup 201",
+		"10003: from 10.41.0.0/16 lookup 200",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("SourceRules() = %q, want %q", got, want)
+	}
+
+	if rules, err := SourceRules(nil, 10000); err != nil || rules != nil {
+		t.Errorf("SourceRules(nil) = %v, %v, want no rules", rules, err)
+	}
+
+	sameTable := *lte
+	sameTable.Name = "lte2"
+	sameTable.Table = 200
+	sameSource, _ := NewUplink("lte2", "wwan1", "", 202, []string{"10.41.0.0/16"})
+
+	invalid := []struct {
+		name     string
+		uplinks  []*Uplink
+		priority int
+	}{
+		{"nil uplink", []*Uplink{nil}, 10000},
+		{"same table", []*Uplink{wan, &sameTable}, 10000},
+		{"same name", []*Uplink{wan, wan}, 10000},
+		{"same source", []*Uplink{wan, sameSource}, 10000},
+		{"priority out of range", []*Uplink{wan}, 0},
+		{"rules past the main table rule", []*Uplink{wan, lte}, maxRulePriority - 1},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := SourceRules(tt.uplinks, tt.priority); !errors.Is(err, ErrValidation) {
+				t.Errorf("error = %v, want ErrValidation", err)
+			}
+		})
+	}
+}
+
+func TestApplySourceRoutingWithRouteTable(t *testing.T) {
+	added, deleted := stubRules(t, nil)
+
+	wan, _ := NewUplink("wan", "eth0", "192.0.2.1", 200, []string{"10.41.0.0/16"})
+	lte, _ := NewUplink("lte", "wwan0", "", 201, []string{"10.41.0.23"})
+
+	// The rules of an earlier run, which sent the mesh out through a third uplink,
+	// and those of others around them
+	_, mesh, _ := net.ParseCIDR("10.41.0.0/16")
+	ours := uint8(RouteProtocolOpenMANET)
+	ruleList = func(family int) ([]netlink.Rule, error) {
+		return []netlink.Rule{
+			{Priority: 0, Table: unix.RT_TABLE_LOCAL, Family: unix.AF_INET, SuppressPrefixlen: -1},
+			{Priority: 1000, Table: 100, Family: unix.AF_INET, Protocol: ours, Mark: 0x10, SuppressPrefixlen: -1},
+			{Priority: 10000, Table: unix.RT_TABLE_MAIN, Family: unix.AF_INET, Protocol: ours, SuppressPrefixlen: 0},
+			{Priority: 10001, Table: 202, Family: unix.AF_INET, Protocol: ours, Src: mesh, SuppressPrefixlen: -1},
+			{Priority: 10002, Table: 150, Family: unix.AF_INET, Protocol: unix.RTPROT_STATIC, SuppressPrefixlen: -1},
+			{Priority: 32766, Table: unix.RT_TABLE_MAIN, Family: unix.AF_INET, SuppressPrefixlen: -1},
+		}, nil
+	}
+
+	stale := &Route{Destination: createTestIPNet("0.0.0.0/0"), Gateway: net.ParseIP("198.51.100.1"), Interface: "eth1", Table: 202, Protocol: RouteProtocolOpenMANET}
+	foreign := &Route{Destination: createTestIPNet("0.0.0.0/0"), Gateway: net.ParseIP("192.0.2.254"), Interface: "eth0", Table: unix.RT_TABLE_MAIN}
+	table := &fakeRouteTable{routes: []*Route{stale, foreign}}
+
+	if err := ApplySourceRoutingWithRouteTable([]*Uplink{wan, lte}, DefaultSourceRulePriority, table); err != nil {
+		t.Fatalf("ApplySourceRoutingWithRouteTable() error = %v", err)
+	}
+
+	if len(table.added) != 2 || table.added[0].Table != 200 || table.added[1].Table != 201 || !table.added[0].Gateway.Equal(wan.Gateway) {
+		t.Errorf("added routes %v, want the default routes of tables 200 and 201", table.added)
+	}
+	if len(table.deleted) != 1 || table.deleted[0] != stale {
+		t.Errorf("deleted routes %v, want the route of the stale table", table.deleted)
+	}
+
+	// The suppressing rule is kept; the uplink rules are added after it
+	var addedPriorities []int
+	for _, rule := range *added {
+		addedPriorities = append(addedPriorities, rule.Priority)
+	}
+	if want := []int{10001, 10002}; !slices.Equal(addedPriorities, want) {
+		t.Errorf("added rules at %v, want %v", addedPriorities, want)
+	}
+	if len(*deleted) != 1 || (*deleted)[0].Table != 202 {
+		t.Errorf("deleted rules %v, want only the stale rule of table 202", *deleted)
+	}
+}
+
+func TestApplySourceRoutingWithRouteTable_Removes(t *testing.T) {
+	_, deleted := stubRules(t, nil)
+
+	ruleList = func(family int) ([]netlink.Rule, error) {
+		return []netlink.Rule{
+			{Priority: 10000, Table: unix.RT_TABLE_MAIN, Family: unix.AF_INET, Protocol: uint8(RouteProtocolOpenMANET), SuppressPrefixlen: 0},
+			{Priority: 10001, Table: 200, Family: unix.AF_INET, Protocol: uint8(RouteProtocolOpenMANET), Src: createTestIPNet("10.41.0.0/16"), SuppressPrefixlen: -1},
+		}, nil
+	}
+	route := &Route{Destination: createTestIPNet("0.0.0.0/0"), Gateway: net.ParseIP("192.0.2.1"), Interface: "eth0", Table: 200, Protocol: RouteProtocolOpenMANET}
+	table := &fakeRouteTable{routes: []*Route{route}}
+
+	if err := ApplySourceRoutingWithRouteTable(nil, DefaultSourceRulePriority, table); err != nil {
+		t.Fatalf("ApplySourceRoutingWithRouteTable() error = %v", err)
+	}
+	if len(*deleted) != 2 || len(table.routes) != 0 {
+		t.Errorf("deleted rules %v leaving routes %v, want everything removed", *deleted, table.routes)
+	}
+}
@@ -0,0 +1,129 @@
+package network
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestNewStaticRoute(t *testing.T) {
+	tests := []struct {
+		name        string
+		destination string
+		gateway     string
+		iface       string
+		metric      int
+		table       int
+		wantErr     bool
+		wantDst     string
+		wantTable   int
+	}{
+		{
+			name:        "gateway route in main table",
+			destination: "192.168.50.0/24",
+			gateway:     "10.41.0.1",
+			iface:       "br-ahwlan",
+			metric:      10,
+			wantDst:     "192.168.50.0/24",
+			wantTable:   unix.RT_TABLE_MAIN,
+		},
+		{
+			name:        "host bits are cleared",
+			destination: "192.168.50.7/24",
+			iface:       "br-ahwlan",
+			wantDst:     "192.168.50.0/24",
+			wantTable:   unix.RT_TABLE_MAIN,
+		},
+		{
+			name:        "custom table",
+			destination: "172.16.0.0/12",
+			gateway:     "10.41.0.1",
+			iface:       "br-ahwlan",
+			table:       100,
+			wantDst:     "172.16.0.0/12",
+			wantTable:   100,
+		},
+		{
+			name:        "destination without prefix",
+			destination: "192.168.50.0",
+			iface:       "br-ahwlan",
+			wantErr:     true,
+		},
+		{
+			name:        "invalid gateway",
+			destination: "192.168.50.0/24",
+			gateway:     "10.41.0",
+			iface:       "br-ahwlan",
+			wantErr:     true,
+		},
+		{
+			name:        "mixed address families",
+			destination: "fd00::/64",
+			gateway:     "10.41.0.1",
+			iface:       "br-ahwlan",
+			wantErr:     true,
+		},
+		{
+			name:        "missing interface",
+			destination: "192.168.50.0/24",
+			wantErr:     true,
+		},
+		{
+			name:        "negative metric",
+			destination: "192.168.50.0/24",
+			iface:       "br-ahwlan",
+			metric:      -1,
+			wantErr:     true,
+		},
+		{
+			name:        "local table",
+			destination: "192.168.50.0/24",
+			iface:       "br-ahwlan",
+			table:       unix.RT_TABLE_LOCAL,
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewStaticRoute(tt.destination, tt.gateway, tt.iface, tt.metric, tt.table)
+			if tt.wantErr {
+				if !errors.Is(err, ErrValidation) {
+					t.Errorf("NewStaticRoute() error = %v, want ErrValidation", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewStaticRoute() error = %v", err)
+			}
+
+			if got.Destination.String() != tt.wantDst {
+				t.Errorf("Destination = %s, want %s", got.Destination, tt.wantDst)
+			}
+			if got.Table != tt.wantTable {
+				t.Errorf("Table = %d, want %d", got.Table, tt.wantTable)
+			}
+			if got.Protocol != RouteProtocolOpenMANET {
+				t.Errorf("Protocol = %d, want RouteProtocolOpenMANET", got.Protocol)
+			}
+		})
+	}
+}
+
+func TestSameRoute(t *testing.T) {
+	r1 := createTestRoute()
+	r2 := createTestRoute()
+	if !SameRoute(r1, r2) {
+		t.Error("SameRoute() = false for identical routes")
+	}
+
+	r2.Table = 100
+	if SameRoute(r1, r2) {
+		t.Error("SameRoute() = true for routes in different tables")
+	}
+
+	if SameRoute(r1, nil) {
+		t.Error("SameRoute() = true with a nil route")
+	}
+}
@@ -0,0 +1,320 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"slices"
+
+	"github.com/openmanet/openmanetd/internal/safemode"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// maxVXLANID is the largest VXLAN network identifier, 24 bits wide.
+	maxVXLANID = 1<<24 - 1
+	// defaultVXLANPort is the IANA port of VXLAN. The kernel defaults to the older
+	// Linux port 8472 when none is given.
+	defaultVXLANPort = 4789
+	// batadvLinkType is the link type the kernel reports for a batman-adv mesh
+	// interface.
+	batadvLinkType = "batadv"
+)
+
+// TunnelType is the encapsulation of an overlay tunnel. Both carry Ethernet frames,
+// so a tunnel can be a batman-adv hard interface or a bridge port.
+type TunnelType string
+
+const (
+	// TunnelGRE is Ethernet over GRE, the gretap or ip6gretap link type.
+	TunnelGRE TunnelType = "gre"
+	// TunnelVXLAN is Ethernet over UDP, the vxlan link type.
+	TunnelVXLAN TunnelType = "vxlan"
+)
+
+// tunnelLinkTypes are the link types the kernel reports for the tunnels
+// CreateTunnel creates.
+var tunnelLinkTypes = []string{"gretap", "ip6gretap", "vxlan"}
+
+// TunnelConfig is the configuration of a point-to-point overlay tunnel.
+//
+// Fields:
+//   - Type: The encapsulation, TunnelGRE or TunnelVXLAN.
+//   - Remote: The underlay address of the other end of the tunnel.
+//   - Local: The underlay address packets are sent from. nil lets the kernel pick
+//     it by route.
+//   - ID: The VXLAN network identifier, from 0 to 16777215, or the GRE key, 0 for
+//     none. Both ends must use the same ID.
+//   - Port: The VXLAN UDP port. 0 uses 4789. Ignored for GRE.
+//   - Underlay: The interface the tunnel is bound to, e.g. "eth0". Empty follows
+//     the route to Remote.
+//   - MTU: The MTU of the tunnel. 0 takes that of the underlay less the
+//     encapsulation overhead.
+type TunnelConfig struct {
+	Type     TunnelType
+	Remote   net.IP
+	Local    net.IP
+	ID       int
+	Port     int
+	Underlay string
+	MTU      int
+}
+
+// validate checks that the configuration describes a tunnel the kernel accepts.
+func (c *TunnelConfig) validate() error {
+	if c.Type != TunnelGRE && c.Type != TunnelVXLAN {
+		return newValidationError("tunnel type must be %q or %q, got %q", TunnelGRE, TunnelVXLAN, c.Type)
+	}
+	if c.Remote == nil || c.Remote.IsUnspecified() || c.Remote.IsMulticast() {
+		return newValidationError("tunnel remote %v must be a unicast address", c.Remote)
+	}
+	if c.Local != nil && (c.Local.To4() != nil) != (c.Remote.To4() != nil) {
+		return newValidationError("tunnel local %s and remote %s are different address families", c.Local, c.Remote)
+	}
+	switch {
+	case c.Type == TunnelVXLAN && (c.ID < 0 || c.ID > maxVXLANID):
+		return newValidationError("VXLAN ID must be from 0 to %d, got %d", maxVXLANID, c.ID)
+	case c.Type == TunnelGRE && (c.ID < 0 || int64(c.ID) > math.MaxUint32):
+		return newValidationError("GRE key must be from 0 to %d, got %d", uint32(math.MaxUint32), c.ID)
+	}
+	if c.Port < 0 || c.Port > 65535 {
+		return newValidationError("tunnel port must be from 0 to 65535, got %d", c.Port)
+	}
+	if c.MTU != 0 && (c.MTU < minLinkMTU || c.MTU > maxLinkMTU) {
+		return newValidationError("MTU must be from %d to %d, got %d", minLinkMTU, maxLinkMTU, c.MTU)
+	}
+
+	return nil
+}
+
+// toNetlink returns the link of the tunnel name, bound to the underlay interface
+// with index underlay, 0 for none.
+func (c *TunnelConfig) toNetlink(name string, underlay int) netlink.Link {
+	attrs := netlink.LinkAttrs{Name: name, MTU: c.MTU}
+
+	if c.Type == TunnelVXLAN {
+		port := c.Port
+		if port == 0 {
+			port = defaultVXLANPort
+		}
+		return &netlink.Vxlan{
+			LinkAttrs:    attrs,
+			VxlanId:      c.ID,
+			VtepDevIndex: underlay,
+			SrcAddr:      c.Local,
+			// The kernel takes a unicast group as the remote end
+			Group:    c.Remote,
+			Port:     port,
+			Learning: true,
+		}
+	}
+
+	// The netlink package picks gretap or ip6gretap by the family of the local
+	// address
+	local := c.Local
+	if local == nil {
+		local = net.IPv4zero
+		if c.Remote.To4() == nil {
+			local = net.IPv6zero
+		}
+	}
+	return &netlink.Gretap{
+		LinkAttrs: attrs,
+		Local:     local,
+		Remote:    c.Remote,
+		IKey:      uint32(c.ID),
+		OKey:      uint32(c.ID),
+		PMtuDisc:  1,
+		Link:      uint32(underlay),
+	}
+}
+
+// CreateTunnel creates the overlay tunnel name and sets it up, e.g. to join two
+// batman-adv clouds over an IP link between them with AttachToBatman. Creating a
+// tunnel that exists already only sets it up; delete it first to change its
+// configuration.
+//
+// Returns an ErrValidation error if name or config is invalid or name is an
+// interface that is not a tunnel, and an ErrInterfaceNotFound error if the underlay
+// interface does not exist.
+//
+// Example:
+//
+//	err := CreateTunnel("vx-site2", &TunnelConfig{
+//	    Type:   TunnelVXLAN,
+//	    Remote: net.ParseIP("203.0.113.7"),
+//	    ID:     41,
+//	    MTU:    1532,
+//	})
+//	if err == nil {
+//	    err = AttachToBatman("vx-site2", "bat0")
+//	}
+//
+// Note: This operation requires appropriate privileges (typically root/CAP_NET_ADMIN).
+// batman-adv wants an MTU of at least 1532 on its hard interfaces, which needs an
+// underlay MTU of 1582 for VXLAN or 1574 for GRE with a key over IPv4; with less,
+// batman-adv fragments.
+func CreateTunnel(name string, config *TunnelConfig) error {
+	if err := validateLinkName(name); err != nil {
+		return err
+	}
+	if config == nil {
+		return newValidationError("tunnel configuration cannot be nil")
+	}
+	if err := config.validate(); err != nil {
+		return err
+	}
+
+	if err := safemode.Check(fmt.Sprintf("create %s tunnel %s to %s", config.Type, name, config.Remote)); err != nil {
+		return err
+	}
+
+	link, err := lookupTunnel(name)
+	if errors.Is(err, ErrInterfaceNotFound) {
+		underlay := 0
+		if config.Underlay != "" {
+			underlayLink, err := netlink.LinkByName(config.Underlay)
+			if err != nil {
+				return newInterfaceNotFoundError(config.Underlay, err)
+			}
+			underlay = underlayLink.Attrs().Index
+		}
+
+		link = config.toNetlink(name, underlay)
+		if err := netlink.LinkAdd(link); err != nil && !errors.Is(err, unix.EEXIST) {
+			return fmt.Errorf("failed to create %s tunnel %s: %w", config.Type, name, err)
+		}
+	} else if err != nil {
+		return err
+	}
+
+	if err := netlink.LinkSetUp(link); err != nil {
+		return fmt.Errorf("failed to set %s up: %w", name, err)
+	}
+
+	return nil
+}
+
+// lookupTunnel looks up the interface name and checks that it is a tunnel
+// CreateTunnel could have created.
+func lookupTunnel(name string) (netlink.Link, error) {
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		return nil, newInterfaceNotFoundError(name, err)
+	}
+	if !slices.Contains(tunnelLinkTypes, link.Type()) {
+		return nil, newValidationError("interface %s is a %s, not a GRE or VXLAN tunnel", name, link.Type())
+	}
+
+	return link, nil
+}
+
+// DeleteTunnel deletes the overlay tunnel name. batman-adv drops it as a hard
+// interface.
+//
+// Returns an ErrValidation error if name is not a GRE or VXLAN tunnel and an
+// ErrInterfaceNotFound error if there is no such interface.
+//
+// Note: This operation requires appropriate privileges (typically root/CAP_NET_ADMIN).
+func DeleteTunnel(name string) error {
+	if name == "" {
+		return newValidationError("interface name cannot be empty")
+	}
+
+	if err := safemode.Check(fmt.Sprintf("delete tunnel %s", name)); err != nil {
+		return err
+	}
+
+	link, err := lookupTunnel(name)
+	if err != nil {
+		return err
+	}
+
+	if err := netlink.LinkDel(link); err != nil {
+		return fmt.Errorf("failed to delete tunnel %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// AttachToBatman adds the interface iface to the batman-adv mesh interface batIface
+// as a hard interface, as 'batctl meshif batIface interface add iface' does, so
+// that batman-adv sends OGMs and mesh traffic over it. Attaching an interface that
+// is attached already does nothing.
+//
+// Returns an ErrValidation error if batIface is not a batman-adv interface and an
+// ErrInterfaceNotFound error if either interface does not exist.
+//
+// Note: This operation requires appropriate privileges (typically root/CAP_NET_ADMIN).
+// The batman-adv UCI configuration is not updated, so netifd does not attach the
+// interface again after a network restart.
+func AttachToBatman(iface, batIface string) error {
+	bat, link, err := batmanAndHardif(iface, batIface, fmt.Sprintf("attach %s to %s", iface, batIface))
+	if err != nil {
+		return err
+	}
+	if link.Attrs().MasterIndex == bat.Attrs().Index {
+		return nil
+	}
+
+	if err := netlink.LinkSetMaster(link, bat); err != nil {
+		return fmt.Errorf("failed to attach %s to %s: %w", iface, batIface, err)
+	}
+
+	return nil
+}
+
+// DetachFromBatman removes the hard interface iface from the batman-adv mesh
+// interface batIface. Detaching an interface that is not attached to batIface does
+// nothing.
+//
+// Returns an ErrValidation error if batIface is not a batman-adv interface and an
+// ErrInterfaceNotFound error if either interface does not exist.
+//
+// Note: This operation requires appropriate privileges (typically root/CAP_NET_ADMIN).
+func DetachFromBatman(iface, batIface string) error {
+	bat, link, err := batmanAndHardif(iface, batIface, fmt.Sprintf("detach %s from %s", iface, batIface))
+	if err != nil {
+		return err
+	}
+	if link.Attrs().MasterIndex != bat.Attrs().Index {
+		return nil
+	}
+
+	if err := netlink.LinkSetNoMaster(link); err != nil {
+		return fmt.Errorf("failed to detach %s from %s: %w", iface, batIface, err)
+	}
+
+	return nil
+}
+
+// batmanAndHardif looks up the batman-adv interface batIface and the interface
+// iface for change, as safe mode reports it.
+func batmanAndHardif(iface, batIface, change string) (netlink.Link, netlink.Link, error) {
+	if iface == "" || batIface == "" {
+		return nil, nil, newValidationError("interface names cannot be empty")
+	}
+	if iface == batIface {
+		return nil, nil, newValidationError("%s cannot be a hard interface of itself", batIface)
+	}
+
+	if err := safemode.Check(change); err != nil {
+		return nil, nil, err
+	}
+
+	bat, err := netlink.LinkByName(batIface)
+	if err != nil {
+		return nil, nil, newInterfaceNotFoundError(batIface, err)
+	}
+	if bat.Type() != batadvLinkType {
+		return nil, nil, newValidationError("interface %s is a %s, not a batman-adv interface", batIface, bat.Type())
+	}
+	link, err := netlink.LinkByName(iface)
+	if err != nil {
+		return nil, nil, newInterfaceNotFoundError(iface, err)
+	}
+
+	return bat, link, nil
+}
@@ -0,0 +1,111 @@
+package network
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+func TestTunnelConfig_ToNetlink(t *testing.T) {
+	vxlan := (&TunnelConfig{Type: TunnelVXLAN, Remote: net.ParseIP("203.0.113.7"), ID: 41}).toNetlink("vx0", 3)
+	v, ok := vxlan.(*netlink.Vxlan)
+	if !ok {
+		t.Fatalf("VXLAN link = %T", vxlan)
+	}
+	if v.VxlanId != 41 || !v.Group.Equal(net.ParseIP("203.0.113.7")) || v.Port != defaultVXLANPort || v.VtepDevIndex != 3 || v.Name != "vx0" {
+		t.Errorf("VXLAN link = %+v", v)
+	}
+
+	for _, tt := range []struct {
+		remote, linkType string
+	}{
+		{"203.0.113.7", "gretap"},
+		{"2001:db8::7", "ip6gretap"},
+	} {
+		gre := (&TunnelConfig{Type: TunnelGRE, Remote: net.ParseIP(tt.remote), ID: 7}).toNetlink("gre0", 0)
+		if gre.Type() != tt.linkType {
+			t.Errorf("GRE link to %s is a %s, want %s", tt.remote, gre.Type(), tt.linkType)
+		}
+		if g := gre.(*netlink.Gretap); g.IKey != 7 || g.OKey != 7 || !g.Remote.Equal(net.ParseIP(tt.remote)) {
+			t.Errorf("GRE link = %+v", g)
+		}
+	}
+}
+
+func TestTunnelFunctions_Validation(t *testing.T) {
+	remote := net.ParseIP("203.0.113.7")
+	config := func(typ TunnelType, change func(c *TunnelConfig)) *TunnelConfig {
+		c := &TunnelConfig{Type: typ, Remote: remote}
+		if change != nil {
+			change(c)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name string
+		op   func() error
+	}{
+		{"no name", func() error { return CreateTunnel("", config(TunnelVXLAN, nil)) }},
+		{"nil config", func() error { return CreateTunnel("vx0", nil) }},
+		{"type", func() error { return CreateTunnel("vx0", config("ipip", nil)) }},
+		{"no remote", func() error {
+			return CreateTunnel("vx0", config(TunnelVXLAN, func(c *TunnelConfig) { c.Remote = nil }))
+		}},
+		{"multicast remote", func() error {
+			return CreateTunnel("vx0", config(TunnelVXLAN, func(c *TunnelConfig) { c.Remote = net.ParseIP("239.1.1.1") }))
+		}},
+		{"mixed families", func() error {
+			return CreateTunnel("gre0", config(TunnelGRE, func(c *TunnelConfig) { c.Local = net.ParseIP("2001:db8::1") }))
+		}},
+		{"VXLAN ID", func() error {
+			return CreateTunnel("vx0", config(TunnelVXLAN, func(c *TunnelConfig) { c.ID = 1 << 24 }))
+		}},
+		{"GRE key", func() error { return CreateTunnel("gre0", config(TunnelGRE, func(c *TunnelConfig) { c.ID = -1 })) }},
+		{"port", func() error {
+			return CreateTunnel("vx0", config(TunnelVXLAN, func(c *TunnelConfig) { c.Port = 65536 }))
+		}},
+		{"MTU", func() error { return CreateTunnel("vx0", config(TunnelVXLAN, func(c *TunnelConfig) { c.MTU = 10 })) }},
+		{"over loopback", func() error { return CreateTunnel("lo", config(TunnelVXLAN, nil)) }},
+		{"delete without name", func() error { return DeleteTunnel("") }},
+		{"delete loopback", func() error { return DeleteTunnel("lo") }},
+		{"attach without name", func() error { return AttachToBatman("", "bat0") }},
+		{"attach to itself", func() error { return AttachToBatman("bat0", "bat0") }},
+		{"attach to loopback", func() error { return AttachToBatman("vx0", "lo") }},
+		{"detach from loopback", func() error { return DetachFromBatman("vx0", "lo") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.op(); !errors.Is(err, ErrValidation) {
+				t.Errorf("error = %v, want ErrValidation", err)
+			}
+		})
+	}
+}
+
+func TestTunnelFunctions_InterfaceNotFound(t *testing.T) {
+	const missing = "omtest-missing"
+
+	tests := []struct {
+		name string
+		op   func() error
+	}{
+		{"underlay", func() error {
+			return CreateTunnel("omtest-vx", &TunnelConfig{Type: TunnelVXLAN, Remote: net.ParseIP("203.0.113.7"), Underlay: missing})
+		}},
+		{"delete", func() error { return DeleteTunnel(missing) }},
+		{"attach to missing mesh", func() error { return AttachToBatman("lo", missing) }},
+		{"detach from missing mesh", func() error { return DetachFromBatman("lo", missing) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.op(); !errors.Is(err, ErrInterfaceNotFound) {
+				t.Errorf("error = %v, want ErrInterfaceNotFound", err)
+			}
+		})
+	}
+}
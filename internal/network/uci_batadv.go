@@ -0,0 +1,263 @@
+package network
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/digineo/go-uci/v2"
+)
+
+const (
+	// batadvProto is the netifd protocol of a batman-adv mesh interface.
+	batadvProto string = "batadv"
+
+	// batadvHardifProto is the netifd protocol of an interface that carries a
+	// batman-adv mesh interface, e.g. the 802.11s or ad-hoc wifi interface.
+	batadvHardifProto string = "batadv_hardif"
+)
+
+// batadvGatewayModes are the gw_mode values batman-adv accepts.
+var batadvGatewayModes = []string{"off", "client", "server"}
+
+// batadvRoutingAlgorithms are the routing_algo values batman-adv accepts.
+var batadvRoutingAlgorithms = []string{"BATMAN_IV", "BATMAN_V"}
+
+// UCIBatadv represents a "proto batadv" interface section, the batman-adv mesh
+// interface (e.g. bat0) itself.
+type UCIBatadv struct {
+	GatewayMode  string `uci:"option gw_mode"`
+	RoutingAlgo  string `uci:"option routing_algo"`
+	HopPenalty   string `uci:"option hop_penalty"`
+	OrigInterval string `uci:"option orig_interval"`
+}
+
+// UCIBatadvHardif represents a "proto batadv_hardif" interface section, an
+// interface attached to the batman-adv mesh interface named by Master.
+type UCIBatadvHardif struct {
+	Master     string `uci:"option master"`
+	Device     string `uci:"option device"`
+	HopPenalty string `uci:"option hop_penalty"`
+}
+
+// networkOption returns the first value of option in section, or "".
+func networkOption(reader ConfigReader, section, option string) string {
+	if values, ok := reader.Get(networkConfigName, section, option); ok && len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// checkNetworkProto returns an ErrSectionNotFound error if section does not exist,
+// and an ErrValidation error if it is not of protocol want.
+func checkNetworkProto(reader ConfigReader, section, want string) error {
+	proto := networkOption(reader, section, "proto")
+	if proto == "" {
+		return fmt.Errorf("%w: network interface %q", ErrSectionNotFound, section)
+	}
+	if proto != want {
+		return newValidationError("network interface %q is proto %s, not %s", section, proto, want)
+	}
+	return nil
+}
+
+// validateHopPenalty checks that value, if set, is a batman-adv hop penalty.
+func validateHopPenalty(value string) error {
+	if value == "" {
+		return nil
+	}
+	if n, err := strconv.Atoi(value); err != nil || n < 0 || n > 255 {
+		return newValidationError("hop_penalty must be between 0 and 255, got %q", value)
+	}
+	return nil
+}
+
+// GetBatadvInterface loads and returns the batman-adv mesh interface section.
+//
+// Returns an ErrSectionNotFound error if there is no such section, and an
+// ErrValidation error if it is not a batadv interface.
+//
+// Example:
+//
+//	bat0, err := GetBatadvInterface("bat0")
+//	if err != nil {
+//	    log.Fatalf("Failed to get batman-adv config: %v", err)
+//	}
+//	fmt.Printf("Gateway mode: %s\n", bat0.GatewayMode)
+func GetBatadvInterface(section string) (*UCIBatadv, error) {
+	return GetBatadvInterfaceWithReader(section, NewUCINetworkConfigReader())
+}
+
+// GetBatadvInterfaceWithReader loads and returns the batman-adv mesh interface
+// section using the provided reader.
+func GetBatadvInterfaceWithReader(section string, reader ConfigReader) (*UCIBatadv, error) {
+	if err := checkNetworkProto(reader, section, batadvProto); err != nil {
+		return nil, err
+	}
+
+	return &UCIBatadv{
+		GatewayMode:  networkOption(reader, section, "gw_mode"),
+		RoutingAlgo:  networkOption(reader, section, "routing_algo"),
+		HopPenalty:   networkOption(reader, section, "hop_penalty"),
+		OrigInterval: networkOption(reader, section, "orig_interval"),
+	}, nil
+}
+
+// SetBatadvInterface creates or updates the batman-adv mesh interface section, so
+// that the mesh can be provisioned on a node whose network configuration lacks
+// it. Empty fields are left as they are.
+//
+// Returns true if any option changed and the configuration was committed. Returns
+// an ErrValidation error if a value is out of range, or if section exists with a
+// protocol other than batadv; such a section is never converted.
+//
+// Example:
+//
+//	changed, err := SetBatadvInterface("bat0", &UCIBatadv{
+//	    GatewayMode:  "client",
+//	    RoutingAlgo:  "BATMAN_IV",
+//	    HopPenalty:   "15",
+//	    OrigInterval: "1000",
+//	})
+//
+// Note: This operation requires appropriate privileges and commits the configuration.
+// The network must be reloaded for it to take effect.
+func SetBatadvInterface(section string, config *UCIBatadv) (bool, error) {
+	return SetBatadvInterfaceWithReader(section, config, NewUCINetworkConfigReader())
+}
+
+// SetBatadvInterfaceWithReader creates or updates the batman-adv mesh interface
+// section using the provided reader.
+func SetBatadvInterfaceWithReader(section string, config *UCIBatadv, reader ConfigReader) (bool, error) {
+	if config == nil {
+		return false, newValidationError("config cannot be nil")
+	}
+	if config.GatewayMode != "" && !slices.Contains(batadvGatewayModes, config.GatewayMode) {
+		return false, newValidationError("gw_mode must be one of %v, got %q", batadvGatewayModes, config.GatewayMode)
+	}
+	if config.RoutingAlgo != "" && !slices.Contains(batadvRoutingAlgorithms, config.RoutingAlgo) {
+		return false, newValidationError("routing_algo must be one of %v, got %q", batadvRoutingAlgorithms, config.RoutingAlgo)
+	}
+	if err := validateHopPenalty(config.HopPenalty); err != nil {
+		return false, err
+	}
+	if config.OrigInterval != "" {
+		if n, err := strconv.Atoi(config.OrigInterval); err != nil || n <= 0 {
+			return false, newValidationError("orig_interval must be a positive number of milliseconds, got %q", config.OrigInterval)
+		}
+	}
+
+	if proto := networkOption(reader, section, "proto"); proto != "" && proto != batadvProto {
+		return false, newValidationError("network interface %q is proto %s, not %s", section, proto, batadvProto)
+	}
+
+	// Add section if it doesn't exist (this will fail silently if it exists)
+	_ = reader.AddSection(networkConfigName, section, "interface")
+
+	changed, err := setOptionsIfChanged(reader, networkConfigName, section, []uciOption{
+		{name: "proto", typ: uci.TypeOption, value: batadvProto},
+		{name: "gw_mode", typ: uci.TypeOption, value: config.GatewayMode},
+		{name: "routing_algo", typ: uci.TypeOption, value: config.RoutingAlgo},
+		{name: "hop_penalty", typ: uci.TypeOption, value: config.HopPenalty},
+		{name: "orig_interval", typ: uci.TypeOption, value: config.OrigInterval},
+	})
+	if err != nil || !changed {
+		return false, err
+	}
+
+	if err := reader.Commit(); err != nil {
+		return false, newCommitError(networkConfigName, err)
+	}
+
+	return true, nil
+}
+
+// GetBatadvHardif loads and returns an interface section attached to a batman-adv
+// mesh interface.
+//
+// Returns an ErrSectionNotFound error if there is no such section, and an
+// ErrValidation error if it is not a batadv_hardif interface.
+//
+// Example:
+//
+//	hardif, err := GetBatadvHardif("mesh0")
+//	// hardif.Master == "bat0"
+func GetBatadvHardif(section string) (*UCIBatadvHardif, error) {
+	return GetBatadvHardifWithReader(section, NewUCINetworkConfigReader())
+}
+
+// GetBatadvHardifWithReader loads and returns a batman-adv hard interface section
+// using the provided reader.
+func GetBatadvHardifWithReader(section string, reader ConfigReader) (*UCIBatadvHardif, error) {
+	if err := checkNetworkProto(reader, section, batadvHardifProto); err != nil {
+		return nil, err
+	}
+
+	return &UCIBatadvHardif{
+		Master:     networkOption(reader, section, "master"),
+		Device:     networkOption(reader, section, "device"),
+		HopPenalty: networkOption(reader, section, "hop_penalty"),
+	}, nil
+}
+
+// SetBatadvHardif creates or updates an interface section attached to the
+// batman-adv mesh interface config.Master. Empty fields other than Master are
+// left as they are.
+//
+// Returns true if any option changed and the configuration was committed. Returns
+// an ErrValidation error if Master is not a batadv interface, if a value is out of
+// range, or if section exists with a protocol other than batadv_hardif. The mesh
+// interface is provisioned first with SetBatadvInterface.
+//
+// Example:
+//
+//	changed, err := SetBatadvHardif("mesh0", &UCIBatadvHardif{
+//	    Master: "bat0",
+//	    Device: "mesh0",
+//	})
+//
+// Note: This operation requires appropriate privileges and commits the configuration.
+// The network must be reloaded for it to take effect.
+func SetBatadvHardif(section string, config *UCIBatadvHardif) (bool, error) {
+	return SetBatadvHardifWithReader(section, config, NewUCINetworkConfigReader())
+}
+
+// SetBatadvHardifWithReader creates or updates a batman-adv hard interface section
+// using the provided reader.
+func SetBatadvHardifWithReader(section string, config *UCIBatadvHardif, reader ConfigReader) (bool, error) {
+	if config == nil {
+		return false, newValidationError("config cannot be nil")
+	}
+	if config.Master == "" {
+		return false, newValidationError("master cannot be empty")
+	}
+	if proto := networkOption(reader, config.Master, "proto"); proto != batadvProto {
+		return false, newValidationError("master %q is not a %s interface", config.Master, batadvProto)
+	}
+	if err := validateHopPenalty(config.HopPenalty); err != nil {
+		return false, err
+	}
+
+	if proto := networkOption(reader, section, "proto"); proto != "" && proto != batadvHardifProto {
+		return false, newValidationError("network interface %q is proto %s, not %s", section, proto, batadvHardifProto)
+	}
+
+	// Add section if it doesn't exist (this will fail silently if it exists)
+	_ = reader.AddSection(networkConfigName, section, "interface")
+
+	changed, err := setOptionsIfChanged(reader, networkConfigName, section, []uciOption{
+		{name: "proto", typ: uci.TypeOption, value: batadvHardifProto},
+		{name: "master", typ: uci.TypeOption, value: config.Master},
+		{name: "device", typ: uci.TypeOption, value: config.Device},
+		{name: "hop_penalty", typ: uci.TypeOption, value: config.HopPenalty},
+	})
+	if err != nil || !changed {
+		return false, err
+	}
+
+	if err := reader.Commit(); err != nil {
+		return false, newCommitError(networkConfigName, err)
+	}
+
+	return true, nil
+}
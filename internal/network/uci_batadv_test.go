@@ -0,0 +1,152 @@
+package network
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/digineo/go-uci/v2"
+)
+
+func TestGetBatadvInterfaceWithReader(t *testing.T) {
+	reader := newMockReader()
+	reader.data["network"]["bat0"]["gw_mode"] = []string{"client"}
+	reader.data["network"]["bat0"]["routing_algo"] = []string{"BATMAN_IV"}
+
+	got, err := GetBatadvInterfaceWithReader("bat0", reader)
+	if err != nil {
+		t.Fatalf("GetBatadvInterfaceWithReader() error = %v", err)
+	}
+	if want := (UCIBatadv{GatewayMode: "client", RoutingAlgo: "BATMAN_IV"}); *got != want {
+		t.Errorf("GetBatadvInterfaceWithReader() = %+v, want %+v", *got, want)
+	}
+
+	if _, err := GetBatadvInterfaceWithReader("bat1", reader); !errors.Is(err, ErrSectionNotFound) {
+		t.Errorf("missing section: error = %v, want ErrSectionNotFound", err)
+	}
+	if _, err := GetBatadvInterfaceWithReader("lan", reader); !errors.Is(err, ErrValidation) {
+		t.Errorf("static section: error = %v, want ErrValidation", err)
+	}
+}
+
+func TestSetBatadvInterfaceWithReader(t *testing.T) {
+	t.Run("creates_section", func(t *testing.T) {
+		reader := newMockReader()
+
+		changed, err := SetBatadvInterfaceWithReader("bat1", &UCIBatadv{GatewayMode: "server", HopPenalty: "30"}, reader)
+		if err != nil || !changed {
+			t.Fatalf("SetBatadvInterfaceWithReader() = %v, %v, want true, nil", changed, err)
+		}
+		if reader.addSectionCall != "network.bat1.interface" {
+			t.Errorf("addSectionCall = %q, want network.bat1.interface", reader.addSectionCall)
+		}
+		if !reader.commitCalled {
+			t.Error("Expected Commit to be called")
+		}
+
+		got, err := GetBatadvInterfaceWithReader("bat1", reader)
+		if err != nil {
+			t.Fatalf("GetBatadvInterfaceWithReader() error = %v", err)
+		}
+		if want := (UCIBatadv{GatewayMode: "server", HopPenalty: "30"}); *got != want {
+			t.Errorf("GetBatadvInterfaceWithReader() = %+v, want %+v", *got, want)
+		}
+	})
+
+	t.Run("unchanged", func(t *testing.T) {
+		reader := newMockReader()
+
+		changed, err := SetBatadvInterfaceWithReader("bat0", &UCIBatadv{}, reader)
+		if err != nil || changed {
+			t.Errorf("SetBatadvInterfaceWithReader() = %v, %v, want false, nil", changed, err)
+		}
+		if reader.commitCalled {
+			t.Error("Expected no commit when nothing changed")
+		}
+	})
+
+	invalid := []struct {
+		name    string
+		section string
+		config  *UCIBatadv
+	}{
+		{"nil_config", "bat0", nil},
+		{"gw_mode", "bat0", &UCIBatadv{GatewayMode: "on"}},
+		{"routing_algo", "bat0", &UCIBatadv{RoutingAlgo: "BATMAN_III"}},
+		{"hop_penalty", "bat0", &UCIBatadv{HopPenalty: "256"}},
+		{"orig_interval", "bat0", &UCIBatadv{OrigInterval: "0"}},
+		{"other_proto", "lan", &UCIBatadv{GatewayMode: "client"}},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := newMockReader()
+
+			if _, err := SetBatadvInterfaceWithReader(tt.section, tt.config, reader); !errors.Is(err, ErrValidation) {
+				t.Errorf("SetBatadvInterfaceWithReader() error = %v, want ErrValidation", err)
+			}
+			if len(reader.setTypeCalls) != 0 {
+				t.Errorf("Expected nothing written, got %+v", reader.setTypeCalls)
+			}
+		})
+	}
+}
+
+func TestSetBatadvHardifWithReader(t *testing.T) {
+	reader := newMockReader()
+
+	changed, err := SetBatadvHardifWithReader("mesh0", &UCIBatadvHardif{Master: "bat0", Device: "mesh0"}, reader)
+	if err != nil || !changed {
+		t.Fatalf("SetBatadvHardifWithReader() = %v, %v, want true, nil", changed, err)
+	}
+
+	got, err := GetBatadvHardifWithReader("mesh0", reader)
+	if err != nil {
+		t.Fatalf("GetBatadvHardifWithReader() error = %v", err)
+	}
+	if want := (UCIBatadvHardif{Master: "bat0", Device: "mesh0"}); *got != want {
+		t.Errorf("GetBatadvHardifWithReader() = %+v, want %+v", *got, want)
+	}
+
+	if _, err := GetBatadvHardifWithReader("bat0", reader); !errors.Is(err, ErrValidation) {
+		t.Errorf("mesh interface read as hardif: error = %v, want ErrValidation", err)
+	}
+
+	invalid := []struct {
+		name    string
+		section string
+		config  *UCIBatadvHardif
+	}{
+		{"nil_config", "mesh0", nil},
+		{"no_master", "mesh0", &UCIBatadvHardif{Device: "mesh0"}},
+		{"master_not_batadv", "mesh0", &UCIBatadvHardif{Master: "lan"}},
+		{"master_missing", "mesh0", &UCIBatadvHardif{Master: "bat1"}},
+		{"hop_penalty", "mesh0", &UCIBatadvHardif{Master: "bat0", HopPenalty: "-1"}},
+		{"other_proto", "wan", &UCIBatadvHardif{Master: "bat0"}},
+	}
+	for _, tt := range invalid {
+		if _, err := SetBatadvHardifWithReader(tt.section, tt.config, reader); !errors.Is(err, ErrValidation) {
+			t.Errorf("%s: SetBatadvHardifWithReader() error = %v, want ErrValidation", tt.name, err)
+		}
+	}
+}
+
+func TestSetBatadvWithReader_Tree(t *testing.T) {
+	dir := writeTestConfig(t, "network", "\nconfig interface 'lan'\n\toption proto 'static'\n")
+	reader := &UCINetworkConfigReader{tree: uci.NewTree(dir)}
+
+	if _, err := SetBatadvInterfaceWithReader("bat0", &UCIBatadv{GatewayMode: "client", RoutingAlgo: "BATMAN_V"}, reader); err != nil {
+		t.Fatalf("SetBatadvInterfaceWithReader() error = %v", err)
+	}
+	if _, err := SetBatadvHardifWithReader("mesh0", &UCIBatadvHardif{Master: "bat0", Device: "mesh0"}, reader); err != nil {
+		t.Fatalf("SetBatadvHardifWithReader() error = %v", err)
+	}
+
+	fresh := &UCINetworkConfigReader{tree: uci.NewTree(dir)}
+	bat0, err := GetBatadvInterfaceWithReader("bat0", fresh)
+	if err != nil || bat0.GatewayMode != "client" || bat0.RoutingAlgo != "BATMAN_V" {
+		t.Errorf("bat0 after reload = %+v, %v", bat0, err)
+	}
+	mesh0, err := GetBatadvHardifWithReader("mesh0", fresh)
+	if err != nil || mesh0.Master != "bat0" || mesh0.Device != "mesh0" {
+		t.Errorf("mesh0 after reload = %+v, %v", mesh0, err)
+	}
+}
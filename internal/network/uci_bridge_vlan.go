@@ -0,0 +1,341 @@
+package network
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/digineo/go-uci/v2"
+)
+
+// bridgeVLANSectionType is the type of the sections that configure the VLANs of a
+// VLAN filtering bridge.
+const bridgeVLANSectionType string = "bridge-vlan"
+
+// BridgeVLANPort is the membership of a port in a bridge VLAN, written to the
+// ports list of a bridge-vlan section as "lan1:t" for tagged or "lan1:u*" for
+// untagged and primary (PVID).
+type BridgeVLANPort struct {
+	Name   string `json:"name"`
+	Tagged bool   `json:"tagged,omitempty"`
+	// PVID makes the VLAN the one untagged frames arriving on the port are
+	// assigned to. A port can have one primary VLAN per bridge.
+	PVID bool `json:"pvid,omitempty"`
+}
+
+// String returns the membership as written in the ports list.
+func (p BridgeVLANPort) String() string {
+	s := p.Name + ":u"
+	if p.Tagged {
+		s = p.Name + ":t"
+	}
+	if p.PVID {
+		s += "*"
+	}
+	return s
+}
+
+// parseBridgeVLANPort parses an entry of the ports list. A port without a suffix
+// is an untagged member.
+func parseBridgeVLANPort(s string) BridgeVLANPort {
+	name, flags, _ := strings.Cut(s, ":")
+	return BridgeVLANPort{
+		Name:   name,
+		Tagged: strings.Contains(flags, "t"),
+		PVID:   strings.Contains(flags, "*"),
+	}
+}
+
+// UCIBridgeVLAN represents a bridge-vlan section of the network config: one VLAN of
+// a bridge and the ports that are members of it, e.g. VLAN 10 on br-ahwlan to keep
+// guest traffic apart from mesh management traffic.
+type UCIBridgeVLAN struct {
+	Device string           `uci:"option device" json:"device"`
+	VLAN   int              `uci:"option vlan" json:"vlan"`
+	Ports  []BridgeVLANPort `uci:"list ports" json:"ports,omitempty"`
+}
+
+// bridgeVLANSectionName returns the section name a new VLAN of device gets, e.g.
+// "br_ahwlan_vlan10".
+func bridgeVLANSectionName(device string, vlan int) string {
+	return fmt.Sprintf("%s_vlan%d", deviceSectionName(device), vlan)
+}
+
+// validateBridgeVLANID checks that vlan is a usable 802.1Q VLAN ID.
+func validateBridgeVLANID(vlan int) error {
+	if vlan < 1 || vlan > 4094 {
+		return newValidationError("VLAN ID must be between 1 and 4094, got %d", vlan)
+	}
+	return nil
+}
+
+// readBridgeVLAN reads the options of the bridge-vlan section.
+func readBridgeVLAN(reader DeviceConfigReader, section string) UCIBridgeVLAN {
+	vlan, _ := strconv.Atoi(networkOption(reader, section, "vlan"))
+	entries, _ := reader.Get(networkConfigName, section, "ports")
+
+	ports := make([]BridgeVLANPort, 0, len(entries))
+	for _, entry := range entries {
+		ports = append(ports, parseBridgeVLANPort(entry))
+	}
+
+	return UCIBridgeVLAN{
+		Device: networkOption(reader, section, "device"),
+		VLAN:   vlan,
+		Ports:  ports,
+	}
+}
+
+// bridgeVLANSections returns the bridge-vlan sections of device in file order.
+func bridgeVLANSections(reader DeviceConfigReader, device string) ([]string, error) {
+	sections, err := reader.GetSections(networkConfigName, bridgeVLANSectionType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bridge VLANs: %w", err)
+	}
+
+	return slices.DeleteFunc(sections, func(section string) bool {
+		return networkOption(reader, section, "device") != device
+	}), nil
+}
+
+// findBridgeVLAN returns the section of VLAN vlan on device, or "" if there is none.
+func findBridgeVLAN(reader DeviceConfigReader, device string, vlan int) (string, error) {
+	sections, err := bridgeVLANSections(reader, device)
+	if err != nil {
+		return "", err
+	}
+
+	id := strconv.Itoa(vlan)
+	for _, section := range sections {
+		if networkOption(reader, section, "vlan") == id {
+			return section, nil
+		}
+	}
+
+	return "", nil
+}
+
+// GetBridgeVLANs loads and returns the VLANs of the bridge named device, in file
+// order.
+//
+// Example:
+//
+//	vlans, err := GetBridgeVLANs("br-ahwlan")
+//	for _, vlan := range vlans {
+//	    fmt.Printf("VLAN %d: %v\n", vlan.VLAN, vlan.Ports)
+//	}
+func GetBridgeVLANs(device string) ([]UCIBridgeVLAN, error) {
+	return GetBridgeVLANsWithReader(device, NewUCINetworkConfigReader())
+}
+
+// GetBridgeVLANsWithReader loads and returns the VLANs of a bridge using the
+// provided reader.
+func GetBridgeVLANsWithReader(device string, reader DeviceConfigReader) ([]UCIBridgeVLAN, error) {
+	sections, err := bridgeVLANSections(reader, device)
+	if err != nil {
+		return nil, err
+	}
+
+	vlans := make([]UCIBridgeVLAN, 0, len(sections))
+	for _, section := range sections {
+		vlans = append(vlans, readBridgeVLAN(reader, section))
+	}
+
+	return vlans, nil
+}
+
+// GetBridgeVLAN loads and returns VLAN vlan of the bridge named device.
+//
+// Returns an ErrSectionNotFound error if the bridge has no such VLAN.
+func GetBridgeVLAN(device string, vlan int) (*UCIBridgeVLAN, error) {
+	return GetBridgeVLANWithReader(device, vlan, NewUCINetworkConfigReader())
+}
+
+// GetBridgeVLANWithReader loads and returns a bridge VLAN using the provided reader.
+func GetBridgeVLANWithReader(device string, vlan int, reader DeviceConfigReader) (*UCIBridgeVLAN, error) {
+	section, err := findBridgeVLAN(reader, device, vlan)
+	if err != nil {
+		return nil, err
+	}
+	if section == "" {
+		return nil, fmt.Errorf("%w: VLAN %d of %q", ErrSectionNotFound, vlan, device)
+	}
+
+	v := readBridgeVLAN(reader, section)
+	return &v, nil
+}
+
+// SetBridgeVLANPort makes port a member of VLAN vlan of the bridge named device,
+// replacing any membership it had in that VLAN. The VLAN is created if the bridge
+// does not have it yet; netifd turns on VLAN filtering for a bridge that has VLANs.
+//
+// Returns true if anything changed and the configuration was committed. Returns an
+// ErrSectionNotFound error if there is no device of that name, and an ErrValidation
+// error if the device is not a bridge, the VLAN ID is out of range, or port is
+// primary while already primary in another VLAN of the bridge.
+//
+// Example:
+//
+//	// Carry guest traffic tagged on the uplink and untagged on the guest port.
+//	_, err := SetBridgeVLANPort("br-ahwlan", 10, BridgeVLANPort{Name: "eth0", Tagged: true})
+//	_, err = SetBridgeVLANPort("br-ahwlan", 10, BridgeVLANPort{Name: "eth1", PVID: true})
+//
+// Note: This operation requires appropriate privileges and commits the configuration.
+// The network must be reloaded for it to take effect.
+func SetBridgeVLANPort(device string, vlan int, port BridgeVLANPort) (bool, error) {
+	return SetBridgeVLANPortWithReader(device, vlan, port, NewUCINetworkConfigReader())
+}
+
+// SetBridgeVLANPortWithReader sets the membership of a port in a bridge VLAN using
+// the provided reader.
+func SetBridgeVLANPortWithReader(device string, vlan int, port BridgeVLANPort, reader DeviceConfigReader) (bool, error) {
+	if err := validateBridgeVLANID(vlan); err != nil {
+		return false, err
+	}
+	if port.Name == "" || strings.ContainsAny(port.Name, ": ") {
+		return false, newValidationError("invalid port name %q", port.Name)
+	}
+
+	bridge, err := GetNetworkDeviceWithReader(device, reader)
+	if err != nil {
+		return false, err
+	}
+	if bridge.Type != bridgeDeviceType {
+		return false, newValidationError("device %q is not a %s", device, bridgeDeviceType)
+	}
+
+	if port.PVID {
+		vlans, err := GetBridgeVLANsWithReader(device, reader)
+		if err != nil {
+			return false, err
+		}
+		for _, other := range vlans {
+			if other.VLAN == vlan {
+				continue
+			}
+			for _, p := range other.Ports {
+				if p.Name == port.Name && p.PVID {
+					return false, newValidationError("port %s is already primary in VLAN %d of %q", port.Name, other.VLAN, device)
+				}
+			}
+		}
+	}
+
+	section, err := findBridgeVLAN(reader, device, vlan)
+	if err != nil {
+		return false, err
+	}
+
+	var entries []string
+	if section == "" {
+		section = bridgeVLANSectionName(device, vlan)
+		if err := reader.AddSection(networkConfigName, section, bridgeVLANSectionType); err != nil {
+			return false, newSectionError("add", networkConfigName, section, err)
+		}
+		if _, err := setOptionsIfChanged(reader, networkConfigName, section, []uciOption{
+			{name: "device", typ: uci.TypeOption, value: device},
+			{name: "vlan", typ: uci.TypeOption, value: strconv.Itoa(vlan)},
+		}); err != nil {
+			return false, err
+		}
+	} else {
+		current, _ := reader.Get(networkConfigName, section, "ports")
+		entries = slices.Clone(current)
+	}
+
+	updated := slices.DeleteFunc(slices.Clone(entries), func(entry string) bool {
+		return parseBridgeVLANPort(entry).Name == port.Name
+	})
+	updated = append(updated, port.String())
+	if len(entries) > 0 && slices.Equal(updated, entries) {
+		return false, nil
+	}
+
+	if err := reader.SetType(networkConfigName, section, "ports", uci.TypeList, updated...); err != nil {
+		return false, newSetOptionError(networkConfigName, section, "ports", err)
+	}
+
+	if err := reader.Commit(); err != nil {
+		return false, newCommitError(networkConfigName, err)
+	}
+
+	return true, nil
+}
+
+// RemoveBridgeVLANPort removes port from VLAN vlan of the bridge named device. The
+// VLAN itself is kept even when its last port is removed.
+//
+// Returns true if the port was removed and the configuration was committed, false
+// if it was not a member. Returns an ErrSectionNotFound error if the bridge has no
+// such VLAN.
+func RemoveBridgeVLANPort(device string, vlan int, port string) (bool, error) {
+	return RemoveBridgeVLANPortWithReader(device, vlan, port, NewUCINetworkConfigReader())
+}
+
+// RemoveBridgeVLANPortWithReader removes a port from a bridge VLAN using the
+// provided reader.
+func RemoveBridgeVLANPortWithReader(device string, vlan int, port string, reader DeviceConfigReader) (bool, error) {
+	section, err := findBridgeVLAN(reader, device, vlan)
+	if err != nil {
+		return false, err
+	}
+	if section == "" {
+		return false, fmt.Errorf("%w: VLAN %d of %q", ErrSectionNotFound, vlan, device)
+	}
+
+	current, _ := reader.Get(networkConfigName, section, "ports")
+	entries := slices.DeleteFunc(slices.Clone(current), func(entry string) bool {
+		return parseBridgeVLANPort(entry).Name == port
+	})
+	if len(entries) == len(current) {
+		return false, nil
+	}
+
+	if len(entries) == 0 {
+		if err := reader.Del(networkConfigName, section, "ports"); err != nil {
+			return false, newSetOptionError(networkConfigName, section, "ports", err)
+		}
+	} else if err := reader.SetType(networkConfigName, section, "ports", uci.TypeList, entries...); err != nil {
+		return false, newSetOptionError(networkConfigName, section, "ports", err)
+	}
+
+	if err := reader.Commit(); err != nil {
+		return false, newCommitError(networkConfigName, err)
+	}
+
+	return true, nil
+}
+
+// DeleteBridgeVLAN removes VLAN vlan of the bridge named device.
+//
+// Returns true if the VLAN was deleted and the configuration was committed, false
+// if there was none. Returns an ErrValidation error if the VLAN is an anonymous
+// section; only named sections, such as those SetBridgeVLANPort creates, can be
+// deleted.
+//
+// Note: This operation requires appropriate privileges and commits the configuration.
+func DeleteBridgeVLAN(device string, vlan int) (bool, error) {
+	return DeleteBridgeVLANWithReader(device, vlan, NewUCINetworkConfigReader())
+}
+
+// DeleteBridgeVLANWithReader removes a bridge VLAN using the provided reader.
+func DeleteBridgeVLANWithReader(device string, vlan int, reader DeviceConfigReader) (bool, error) {
+	section, err := findBridgeVLAN(reader, device, vlan)
+	if err != nil || section == "" {
+		return false, err
+	}
+	if strings.HasPrefix(section, "@") {
+		return false, newValidationError("VLAN %d of %q is an anonymous section and cannot be deleted", vlan, device)
+	}
+
+	if err := reader.DelSection(networkConfigName, section); err != nil {
+		return false, newSectionError("delete", networkConfigName, section, err)
+	}
+
+	if err := reader.Commit(); err != nil {
+		return false, newCommitError(networkConfigName, err)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,145 @@
+package network
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/digineo/go-uci/v2"
+)
+
+const testBridgeVLANConfig = testDeviceConfig + `
+config bridge-vlan
+	option device 'br-lan'
+	option vlan '1'
+	list ports 'lan1:u*'
+	list ports 'lan2'
+`
+
+func TestBridgeVLANPort(t *testing.T) {
+	tests := []struct {
+		entry string
+		port  BridgeVLANPort
+		out   string
+	}{
+		{"lan1", BridgeVLANPort{Name: "lan1"}, "lan1:u"},
+		{"lan1:u*", BridgeVLANPort{Name: "lan1", PVID: true}, "lan1:u*"},
+		{"lan1:t", BridgeVLANPort{Name: "lan1", Tagged: true}, "lan1:t"},
+		{"lan1:t*", BridgeVLANPort{Name: "lan1", Tagged: true, PVID: true}, "lan1:t*"},
+	}
+	for _, tt := range tests {
+		got := parseBridgeVLANPort(tt.entry)
+		if got != tt.port {
+			t.Errorf("parseBridgeVLANPort(%q) = %+v, want %+v", tt.entry, got, tt.port)
+		}
+		if s := got.String(); s != tt.out {
+			t.Errorf("BridgeVLANPort(%+v).String() = %q, want %q", got, s, tt.out)
+		}
+	}
+}
+
+func TestGetBridgeVLANsWithReader(t *testing.T) {
+	reader := NewUCINetworkConfigReaderWithTree(uci.NewTree(writeTestConfig(t, "network", testBridgeVLANConfig)))
+
+	vlans, err := GetBridgeVLANsWithReader("br-lan", reader)
+	if err != nil {
+		t.Fatalf("GetBridgeVLANsWithReader() error = %v", err)
+	}
+	want := []BridgeVLANPort{{Name: "lan1", PVID: true}, {Name: "lan2"}}
+	if len(vlans) != 1 || vlans[0].VLAN != 1 || !slices.Equal(vlans[0].Ports, want) {
+		t.Errorf("GetBridgeVLANsWithReader() = %+v", vlans)
+	}
+
+	if vlans, err := GetBridgeVLANsWithReader("br-ahwlan", reader); err != nil || len(vlans) != 0 {
+		t.Errorf("GetBridgeVLANsWithReader(br-ahwlan) = %+v, %v, want none", vlans, err)
+	}
+	if _, err := GetBridgeVLANWithReader("br-lan", 10, reader); !errors.Is(err, ErrSectionNotFound) {
+		t.Errorf("GetBridgeVLANWithReader(10) error = %v, want ErrSectionNotFound", err)
+	}
+}
+
+func TestSetBridgeVLANPortWithReader(t *testing.T) {
+	dir := writeTestConfig(t, "network", testBridgeVLANConfig)
+	reader := NewUCINetworkConfigReaderWithTree(uci.NewTree(dir))
+
+	changed, err := SetBridgeVLANPortWithReader("br-lan", 10, BridgeVLANPort{Name: "lan2", Tagged: true}, reader)
+	if err != nil || !changed {
+		t.Fatalf("SetBridgeVLANPortWithReader(new VLAN) = %v, %v, want true, nil", changed, err)
+	}
+	if changed, err := SetBridgeVLANPortWithReader("br-lan", 10, BridgeVLANPort{Name: "lan2", Tagged: true}, reader); err != nil || changed {
+		t.Errorf("SetBridgeVLANPortWithReader(same) = %v, %v, want false, nil", changed, err)
+	}
+	if changed, err := SetBridgeVLANPortWithReader("br-lan", 1, BridgeVLANPort{Name: "lan2", Tagged: true}, reader); err != nil || !changed {
+		t.Errorf("SetBridgeVLANPortWithReader(retag) = %v, %v, want true, nil", changed, err)
+	}
+
+	fresh := &UCINetworkConfigReader{tree: uci.NewTree(dir)}
+	guest, err := GetBridgeVLANWithReader("br-lan", 10, fresh)
+	if err != nil {
+		t.Fatalf("GetBridgeVLANWithReader() after reload error = %v", err)
+	}
+	if guest.Device != "br-lan" || !slices.Equal(guest.Ports, []BridgeVLANPort{{Name: "lan2", Tagged: true}}) {
+		t.Errorf("VLAN 10 after reload = %+v", guest)
+	}
+	mgmt, err := GetBridgeVLANWithReader("br-lan", 1, fresh)
+	if err != nil {
+		t.Fatalf("GetBridgeVLANWithReader() after reload error = %v", err)
+	}
+	if want := []BridgeVLANPort{{Name: "lan1", PVID: true}, {Name: "lan2", Tagged: true}}; !slices.Equal(mgmt.Ports, want) {
+		t.Errorf("VLAN 1 ports after reload = %+v, want %+v", mgmt.Ports, want)
+	}
+
+	invalid := []struct {
+		name   string
+		device string
+		vlan   int
+		port   BridgeVLANPort
+	}{
+		{"vlan_zero", "br-lan", 0, BridgeVLANPort{Name: "lan1"}},
+		{"vlan_too_high", "br-lan", 4095, BridgeVLANPort{Name: "lan1"}},
+		{"empty_port", "br-lan", 10, BridgeVLANPort{}},
+		{"port_with_flags", "br-lan", 10, BridgeVLANPort{Name: "lan1:t"}},
+		{"not_a_bridge", "eth0", 10, BridgeVLANPort{Name: "lan1"}},
+		{"second_pvid", "br-lan", 10, BridgeVLANPort{Name: "lan1", PVID: true}},
+	}
+	for _, tt := range invalid {
+		if _, err := SetBridgeVLANPortWithReader(tt.device, tt.vlan, tt.port, reader); !errors.Is(err, ErrValidation) {
+			t.Errorf("%s: SetBridgeVLANPortWithReader() error = %v, want ErrValidation", tt.name, err)
+		}
+	}
+	if _, err := SetBridgeVLANPortWithReader("br-ahwlan", 10, BridgeVLANPort{Name: "lan1"}, reader); !errors.Is(err, ErrSectionNotFound) {
+		t.Errorf("missing bridge: error = %v, want ErrSectionNotFound", err)
+	}
+}
+
+func TestRemoveAndDeleteBridgeVLANWithReader(t *testing.T) {
+	reader := NewUCINetworkConfigReaderWithTree(uci.NewTree(writeTestConfig(t, "network", testBridgeVLANConfig)))
+
+	if _, err := SetBridgeVLANPortWithReader("br-lan", 10, BridgeVLANPort{Name: "lan2", Tagged: true}, reader); err != nil {
+		t.Fatalf("SetBridgeVLANPortWithReader() error = %v", err)
+	}
+
+	if removed, err := RemoveBridgeVLANPortWithReader("br-lan", 10, "lan2", reader); err != nil || !removed {
+		t.Fatalf("RemoveBridgeVLANPortWithReader() = %v, %v, want true, nil", removed, err)
+	}
+	if removed, err := RemoveBridgeVLANPortWithReader("br-lan", 10, "lan2", reader); err != nil || removed {
+		t.Errorf("RemoveBridgeVLANPortWithReader() again = %v, %v, want false, nil", removed, err)
+	}
+	if guest, err := GetBridgeVLANWithReader("br-lan", 10, reader); err != nil || len(guest.Ports) != 0 {
+		t.Errorf("VLAN 10 after removing its last port = %+v, %v, want no ports", guest, err)
+	}
+
+	if deleted, err := DeleteBridgeVLANWithReader("br-lan", 10, reader); err != nil || !deleted {
+		t.Fatalf("DeleteBridgeVLANWithReader() = %v, %v, want true, nil", deleted, err)
+	}
+	if _, err := GetBridgeVLANWithReader("br-lan", 10, reader); !errors.Is(err, ErrSectionNotFound) {
+		t.Errorf("GetBridgeVLANWithReader() after delete error = %v, want ErrSectionNotFound", err)
+	}
+	if deleted, err := DeleteBridgeVLANWithReader("br-lan", 10, reader); err != nil || deleted {
+		t.Errorf("DeleteBridgeVLANWithReader() again = %v, %v, want false, nil", deleted, err)
+	}
+
+	if _, err := DeleteBridgeVLANWithReader("br-lan", 1, reader); !errors.Is(err, ErrValidation) {
+		t.Errorf("anonymous VLAN: error = %v, want ErrValidation", err)
+	}
+}
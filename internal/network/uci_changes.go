@@ -0,0 +1,332 @@
+package network
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/digineo/go-uci/v2"
+)
+
+// UCIChangeAction is the kind of a staged UCI change.
+type UCIChangeAction string
+
+const (
+	// UCIChangeSet sets an option, creating it if it did not exist.
+	UCIChangeSet UCIChangeAction = "set"
+	// UCIChangeDelete deletes an option.
+	UCIChangeDelete UCIChangeAction = "delete"
+	// UCIChangeAddSection adds a section.
+	UCIChangeAddSection UCIChangeAction = "add-section"
+	// UCIChangeDeleteSection deletes a section and its options.
+	UCIChangeDeleteSection UCIChangeAction = "delete-section"
+)
+
+// UCIChange is a change staged through a config reader that has not been committed
+// yet. Repeated changes to one option are folded into one, from the value the
+// option had before the first of them to the value it has now.
+type UCIChange struct {
+	Action  UCIChangeAction `json:"action"`
+	Config  string          `json:"config"`
+	Section string          `json:"section"`
+	// Option is empty for the section changes.
+	Option string `json:"option,omitempty"`
+	// Type is the type of an added section, e.g. "interface".
+	Type string `json:"type,omitempty"`
+	// Old is the value of the option before the change, nil if it did not exist.
+	Old []string `json:"old,omitempty"`
+	// New is the value of the option after the change, nil if it was deleted.
+	New []string `json:"new,omitempty"`
+}
+
+// String formats the change in the dotted notation of uci, e.g.
+// "network.ahwlan.ipaddr: '10.41.1.5' -> '10.41.1.6'".
+func (c UCIChange) String() string {
+	switch c.Action {
+	case UCIChangeAddSection:
+		return fmt.Sprintf("%s.%s: added %s section", c.Config, c.Section, c.Type)
+	case UCIChangeDeleteSection:
+		return fmt.Sprintf("%s.%s: deleted section", c.Config, c.Section)
+	}
+	return fmt.Sprintf("%s.%s.%s: %s -> %s", c.Config, c.Section, c.Option, formatUCIValues(c.Old), formatUCIValues(c.New))
+}
+
+// formatUCIValues quotes the values of an option as uci show does, or returns
+// "(unset)" if there are none.
+func formatUCIValues(values []string) string {
+	if len(values) == 0 {
+		return "(unset)"
+	}
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = "'" + v + "'"
+	}
+	return strings.Join(quoted, " ")
+}
+
+// ChangeReporter is implemented by the UCI config readers of this package. It
+// reports the changes a reader has staged but not committed, so that they can be
+// shown or logged before Commit writes them.
+type ChangeReporter interface {
+	Changes() []UCIChange
+	Diff() string
+}
+
+// changeLog records the changes staged through a reader. The readers embed it, so
+// its Changes and Diff methods are theirs.
+type changeLog struct {
+	mu      sync.Mutex
+	changes []UCIChange
+	// types are the option types of the pending set changes, keyed by
+	// optionKey, so that restage can set them again.
+	types map[string]uci.OptionType
+}
+
+// optionKey returns the key of an option in changeLog.types.
+func optionKey(config, section, option string) string {
+	return config + "." + section + "." + option
+}
+
+// Changes returns the changes staged through the reader since its last commit,
+// revert or reload, in the order they were first made.
+func (l *changeLog) Changes() []UCIChange {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	changes := make([]UCIChange, len(l.changes))
+	for i, c := range l.changes {
+		c.Old = slices.Clone(c.Old)
+		c.New = slices.Clone(c.New)
+		changes[i] = c
+	}
+	return changes
+}
+
+// Diff returns the staged changes one per line, or an empty string if there are
+// none.
+//
+// Example:
+//
+//	network.ahwlan.ipaddr: '10.41.1.5' -> '10.41.1.6'
+//	network.ahwlan.gateway: '10.41.0.1' -> (unset)
+func (l *changeLog) Diff() string {
+	var b strings.Builder
+	for _, c := range l.Changes() {
+		b.WriteString(c.String())
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// indexOption returns the index of the pending change of an option, or -1.
+func (l *changeLog) indexOption(config, section, option string) int {
+	return slices.IndexFunc(l.changes, func(c UCIChange) bool {
+		return c.Option != "" && c.Config == config && c.Section == section && c.Option == option
+	})
+}
+
+// recordOption records that an option changed from old, its value before the
+// change, to values. A change that brings an option back to the value it had before
+// the first pending change of it is dropped.
+func (l *changeLog) recordOption(config, section, option string, old, values []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	action := UCIChangeSet
+	if len(values) == 0 {
+		action = UCIChangeDelete
+	}
+
+	i := l.indexOption(config, section, option)
+	if i < 0 {
+		if slices.Equal(old, values) {
+			return
+		}
+		l.changes = append(l.changes, UCIChange{
+			Action:  action,
+			Config:  config,
+			Section: section,
+			Option:  option,
+			Old:     slices.Clone(old),
+			New:     slices.Clone(values),
+		})
+		return
+	}
+
+	if slices.Equal(l.changes[i].Old, values) {
+		l.changes = slices.Delete(l.changes, i, i+1)
+		return
+	}
+	l.changes[i].Action = action
+	l.changes[i].New = slices.Clone(values)
+}
+
+// recordAddSection records that a section of typ was added.
+func (l *changeLog) recordAddSection(config, section, typ string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.changes = append(l.changes, UCIChange{
+		Action:  UCIChangeAddSection,
+		Config:  config,
+		Section: section,
+		Type:    typ,
+	})
+}
+
+// recordDelSection records that a section was deleted. The pending changes of its
+// options are dropped with it, and a section that was added since the last commit
+// leaves no change behind.
+func (l *changeLog) recordDelSection(config, section string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	added := false
+	l.changes = slices.DeleteFunc(l.changes, func(c UCIChange) bool {
+		if c.Config != config || c.Section != section {
+			return false
+		}
+		if c.Action == UCIChangeAddSection {
+			added = true
+		}
+		return true
+	})
+	if added {
+		return
+	}
+
+	l.changes = append(l.changes, UCIChange{
+		Action:  UCIChangeDeleteSection,
+		Config:  config,
+		Section: section,
+	})
+}
+
+// reset forgets the pending changes of config, or of every config if config is
+// empty.
+func (l *changeLog) reset(config string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.changes = slices.DeleteFunc(l.changes, func(c UCIChange) bool {
+		return config == "" || c.Config == config
+	})
+	for key := range l.types {
+		if config == "" || strings.HasPrefix(key, config+".") {
+			delete(l.types, key)
+		}
+	}
+}
+
+// get reads an option from tree. go-uci reads a config from disk again when it is
+// asked for a section it does not hold, which drops the changes staged on it; they
+// are staged again from the log, so that looking up a missing section, as the
+// setters do to find out whether to add it, does not lose them.
+func (l *changeLog) get(tree uci.Tree, config, section, option string) ([]string, bool) {
+	if l.deletedSection(config, section) {
+		return nil, false
+	}
+
+	values, ok := tree.Get(config, section, option)
+	if !ok {
+		l.restage(tree, config)
+	}
+	return values, ok
+}
+
+// deletedSection reports whether the deletion of section is pending.
+func (l *changeLog) deletedSection(config, section string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return slices.ContainsFunc(l.changes, func(c UCIChange) bool {
+		return c.Action == UCIChangeDeleteSection && c.Config == config && c.Section == section
+	})
+}
+
+// restage applies the pending changes of config to tree again. Each change sets
+// the state it records, so applying it to a tree that still holds it changes
+// nothing.
+func (l *changeLog) restage(tree uci.Tree, config string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, c := range l.changes {
+		if c.Config != config {
+			continue
+		}
+		switch c.Action {
+		case UCIChangeAddSection:
+			_ = tree.AddSection(c.Config, c.Section, c.Type)
+		case UCIChangeDeleteSection:
+			_ = tree.DelSection(c.Config, c.Section)
+		case UCIChangeSet:
+			_ = tree.SetType(c.Config, c.Section, c.Option, l.types[optionKey(c.Config, c.Section, c.Option)], c.New...)
+		case UCIChangeDelete:
+			_ = tree.Del(c.Config, c.Section, c.Option)
+		}
+	}
+}
+
+// setType sets an option on tree and records the change.
+func (l *changeLog) setType(tree uci.Tree, config, section, option string, typ uci.OptionType, values ...string) error {
+	old, _ := l.get(tree, config, section, option)
+	old = slices.Clone(old)
+	if err := tree.SetType(config, section, option, typ, values...); err != nil {
+		return err
+	}
+	l.recordOption(config, section, option, old, values)
+
+	l.mu.Lock()
+	if l.types == nil {
+		l.types = make(map[string]uci.OptionType)
+	}
+	l.types[optionKey(config, section, option)] = typ
+	l.mu.Unlock()
+
+	return nil
+}
+
+// del deletes an option from tree and records the change.
+func (l *changeLog) del(tree uci.Tree, config, section, option string) error {
+	old, _ := l.get(tree, config, section, option)
+	old = slices.Clone(old)
+	if err := tree.Del(config, section, option); err != nil {
+		return err
+	}
+	l.recordOption(config, section, option, old, nil)
+	return nil
+}
+
+// addSection adds a section to tree and records the change. Adding a section that
+// exists changes nothing and is not recorded.
+func (l *changeLog) addSection(tree uci.Tree, config, section, typ string) error {
+	sections, _ := tree.GetSections(config, typ)
+	exists := slices.Contains(sections, section)
+	if err := tree.AddSection(config, section, typ); err != nil {
+		return err
+	}
+	if !exists {
+		l.recordAddSection(config, section, typ)
+	}
+	return nil
+}
+
+// delSection deletes a section from tree and records the change.
+func (l *changeLog) delSection(tree uci.Tree, config, section string) error {
+	if err := tree.DelSection(config, section); err != nil {
+		return err
+	}
+	l.recordDelSection(config, section)
+	return nil
+}
+
+// commit commits tree and forgets the pending changes if it succeeded.
+func (l *changeLog) commit(tree uci.Tree) error {
+	if err := tree.Commit(); err != nil {
+		return err
+	}
+	l.reset("")
+	return nil
+}
@@ -0,0 +1,128 @@
+package network
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/digineo/go-uci/v2"
+)
+
+func TestUCINetworkConfigReader_Changes(t *testing.T) {
+	reader := NewUCINetworkConfigReaderWithTree(uci.NewTree(writeTestConfig(t, "network", testNetworkAddrConfig)))
+
+	steps := []func() error{
+		func() error { return reader.SetType("network", "ahwlan", "ipaddr", uci.TypeOption, "10.41.1.6") },
+		func() error { return reader.SetType("network", "ahwlan", "ipaddr", uci.TypeOption, "10.41.1.7") },
+		func() error { return reader.SetType("network", "ahwlan", "gateway", uci.TypeOption, "10.41.0.1") },
+		func() error { return reader.Del("network", "ahwlan", "netmask") },
+		func() error { return reader.SetType("network", "wan", "proto", uci.TypeOption, "static") },
+		func() error { return reader.SetType("network", "wan", "proto", uci.TypeOption, "dhcp") },
+		func() error { return reader.Del("network", "wan", "gateway") },
+		func() error { return reader.AddSection("network", "mgmt", "interface") },
+		func() error { return reader.SetType("network", "mgmt", "proto", uci.TypeOption, "static") },
+		func() error { return reader.AddSection("network", "guest", "interface") },
+		func() error { return reader.DelSection("network", "guest") },
+		func() error { return reader.AddSection("network", "tmp", "interface") },
+		func() error { return reader.SetType("network", "tmp", "proto", uci.TypeOption, "none") },
+		func() error { return reader.DelSection("network", "tmp") },
+	}
+	for i, step := range steps {
+		if err := step(); err != nil {
+			t.Fatalf("step %d: error = %v", i, err)
+		}
+	}
+
+	want := []UCIChange{
+		{Action: UCIChangeSet, Config: "network", Section: "ahwlan", Option: "ipaddr", Old: []string{"10.41.1.5"}, New: []string{"10.41.1.7"}},
+		{Action: UCIChangeSet, Config: "network", Section: "ahwlan", Option: "gateway", New: []string{"10.41.0.1"}},
+		{Action: UCIChangeDelete, Config: "network", Section: "ahwlan", Option: "netmask", Old: []string{"255.255.0.0"}},
+		{Action: UCIChangeAddSection, Config: "network", Section: "mgmt", Type: "interface"},
+		{Action: UCIChangeSet, Config: "network", Section: "mgmt", Option: "proto", New: []string{"static"}},
+		{Action: UCIChangeDeleteSection, Config: "network", Section: "guest"},
+	}
+	if got := reader.Changes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Changes() =\n%+v\nwant\n%+v", got, want)
+	}
+
+	wantDiff := `network.ahwlan.ipaddr: '10.41.1.5' -> '10.41.1.7'
+network.ahwlan.gateway: (unset) -> '10.41.0.1'
+network.ahwlan.netmask: '255.255.0.0' -> (unset)
+network.mgmt: added interface section
+network.mgmt.proto: (unset) -> 'static'
+network.guest: deleted section
+`
+	if got := reader.Diff(); got != wantDiff {
+		t.Errorf("Diff() =\n%s\nwant\n%s", got, wantDiff)
+	}
+
+	if err := reader.Commit(); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	if got := reader.Changes(); len(got) != 0 {
+		t.Errorf("Changes() after Commit = %+v, want none", got)
+	}
+	if got := reader.Diff(); got != "" {
+		t.Errorf("Diff() after Commit = %q, want empty", got)
+	}
+}
+
+func TestUCINetworkConfigReader_ChangesRevert(t *testing.T) {
+	reader := NewUCINetworkConfigReaderWithTree(uci.NewTree(writeTestConfig(t, "network", testNetworkAddrConfig)))
+
+	if err := reader.SetType("network", "guest", "ipaddr", uci.TypeList, "10.42.0.1/24"); err != nil {
+		t.Fatalf("SetType() error = %v", err)
+	}
+	want := []UCIChange{{Action: UCIChangeSet, Config: "network", Section: "guest", Option: "ipaddr", Old: []string{"10.42.0.1/24", "10.42.1.1/24"}, New: []string{"10.42.0.1/24"}}}
+	if got := reader.Changes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Changes() = %+v, want %+v", got, want)
+	}
+
+	tx := NewTransaction(networkConfigName, reader)
+	if got := tx.Changes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Transaction.Changes() = %+v, want %+v", got, want)
+	}
+
+	reader.Revert()
+	if got := reader.Changes(); len(got) != 0 {
+		t.Errorf("Changes() after Revert = %+v, want none", got)
+	}
+}
+
+func TestUCINetworkConfigReader_GetMissingSectionKeepsChanges(t *testing.T) {
+	reader := NewUCINetworkConfigReaderWithTree(uci.NewTree(writeTestConfig(t, "network", testNetworkAddrConfig)))
+
+	steps := []func() error{
+		func() error { return reader.AddSection("network", "bat0", "interface") },
+		func() error { return reader.SetType("network", "bat0", "proto", uci.TypeOption, "batadv") },
+		func() error { return reader.SetType("network", "ahwlan", "dns", uci.TypeList, "10.41.0.1") },
+		func() error { return reader.Del("network", "ahwlan", "netmask") },
+		func() error { return reader.DelSection("network", "wan") },
+	}
+	for i, step := range steps {
+		if err := step(); err != nil {
+			t.Fatalf("step %d: error = %v", i, err)
+		}
+	}
+	want := reader.Changes()
+
+	// go-uci reads the config from disk again on a missing section
+	if _, ok := reader.Get("network", "mesh0", "proto"); ok {
+		t.Fatal("Get(mesh0) found a section that does not exist")
+	}
+
+	if got, _ := reader.Get("network", "bat0", "proto"); !reflect.DeepEqual(got, []string{"batadv"}) {
+		t.Errorf("bat0 proto = %v, want [batadv]", got)
+	}
+	if got, _ := reader.Get("network", "ahwlan", "dns"); !reflect.DeepEqual(got, []string{"10.41.0.1"}) {
+		t.Errorf("ahwlan dns = %v, want [10.41.0.1]", got)
+	}
+	if got, _ := reader.Get("network", "ahwlan", "netmask"); len(got) != 0 {
+		t.Errorf("ahwlan netmask = %v, want it deleted", got)
+	}
+	if _, ok := reader.Get("network", "wan", "proto"); ok {
+		t.Error("deleted section wan is back")
+	}
+	if got := reader.Changes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Changes() =\n%+v\nwant\n%+v", got, want)
+	}
+}
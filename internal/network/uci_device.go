@@ -0,0 +1,306 @@
+package network
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/digineo/go-uci/v2"
+)
+
+// bridgeDeviceType is the type option of a bridge device section.
+const bridgeDeviceType string = "bridge"
+
+// UCIDevice represents a "config device" section of the network config, e.g. the
+// bridge br-ahwlan that the mesh interface section uses as its device. Ethernet
+// ports are attached by listing them in Ports; wireless interfaces attach
+// themselves to the bridge of the network named in their wireless config.
+type UCIDevice struct {
+	Name        string   `uci:"option name" json:"name,omitempty"`
+	Type        string   `uci:"option type" json:"type,omitempty"`
+	Ports       []string `uci:"list ports" json:"ports,omitempty"`
+	BridgeEmpty string   `uci:"option bridge_empty" json:"bridge_empty,omitempty"`
+	STP         string   `uci:"option stp" json:"stp,omitempty"`
+}
+
+// DeviceConfigReader is a ConfigReader that can list sections. Device sections are
+// usually anonymous, so they are found by listing them and matching their name.
+type DeviceConfigReader interface {
+	ConfigReader
+	GetSections(config, secType string) ([]string, error)
+}
+
+// deviceSectionName returns the section name a new device named name gets, e.g.
+// "br_ahwlan" for br-ahwlan, as section names cannot hold dashes.
+func deviceSectionName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// readDevice reads the options of the device section.
+func readDevice(reader DeviceConfigReader, section string) UCIDevice {
+	ports, _ := reader.Get(networkConfigName, section, "ports")
+
+	return UCIDevice{
+		Name:        networkOption(reader, section, "name"),
+		Type:        networkOption(reader, section, "type"),
+		Ports:       slices.Clone(ports),
+		BridgeEmpty: networkOption(reader, section, "bridge_empty"),
+		STP:         networkOption(reader, section, "stp"),
+	}
+}
+
+// findDevice returns the section of the device named name, or "" if there is none.
+func findDevice(reader DeviceConfigReader, name string) (string, error) {
+	sections, err := reader.GetSections(networkConfigName, "device")
+	if err != nil {
+		return "", fmt.Errorf("failed to read network devices: %w", err)
+	}
+
+	for _, section := range sections {
+		if networkOption(reader, section, "name") == name {
+			return section, nil
+		}
+	}
+
+	return "", nil
+}
+
+// GetNetworkDevices loads and returns the device sections in file order.
+func GetNetworkDevices() ([]UCIDevice, error) {
+	return GetNetworkDevicesWithReader(NewUCINetworkConfigReader())
+}
+
+// GetNetworkDevicesWithReader loads and returns the device sections using the provided reader.
+func GetNetworkDevicesWithReader(reader DeviceConfigReader) ([]UCIDevice, error) {
+	sections, err := reader.GetSections(networkConfigName, "device")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read network devices: %w", err)
+	}
+
+	devices := make([]UCIDevice, 0, len(sections))
+	for _, section := range sections {
+		devices = append(devices, readDevice(reader, section))
+	}
+
+	return devices, nil
+}
+
+// GetNetworkDevice loads and returns the device named name, as in its name option.
+//
+// Returns an ErrSectionNotFound error if there is no device of that name.
+//
+// Example:
+//
+//	bridge, err := GetNetworkDevice("br-ahwlan")
+//	if err == nil {
+//	    fmt.Printf("Ports: %v\n", bridge.Ports)
+//	}
+func GetNetworkDevice(name string) (*UCIDevice, error) {
+	return GetNetworkDeviceWithReader(name, NewUCINetworkConfigReader())
+}
+
+// GetNetworkDeviceWithReader loads and returns a device using the provided reader.
+func GetNetworkDeviceWithReader(name string, reader DeviceConfigReader) (*UCIDevice, error) {
+	section, err := findDevice(reader, name)
+	if err != nil {
+		return nil, err
+	}
+	if section == "" {
+		return nil, fmt.Errorf("%w: network device %q", ErrSectionNotFound, name)
+	}
+
+	device := readDevice(reader, section)
+	return &device, nil
+}
+
+// SetBridgeDevice creates or updates the bridge named bridge.Name. An existing
+// device is updated in place, whatever its section is called; a new one gets a
+// section named after it. Ports, if set, replaces the port list; other empty
+// fields are left as they are.
+//
+// Returns true if any option changed and the configuration was committed. Returns
+// an ErrValidation error if the name is empty or names a device that is not a
+// bridge.
+//
+// Example:
+//
+//	changed, err := SetBridgeDevice(&UCIDevice{
+//	    Name:        "br-ahwlan",
+//	    Ports:       []string{"eth0"},
+//	    BridgeEmpty: "1",
+//	})
+//
+// Note: This operation requires appropriate privileges and commits the configuration.
+// The network must be reloaded for it to take effect.
+func SetBridgeDevice(bridge *UCIDevice) (bool, error) {
+	return SetBridgeDeviceWithReader(bridge, NewUCINetworkConfigReader())
+}
+
+// SetBridgeDeviceWithReader creates or updates a bridge using the provided reader.
+func SetBridgeDeviceWithReader(bridge *UCIDevice, reader DeviceConfigReader) (bool, error) {
+	if bridge == nil || bridge.Name == "" {
+		return false, newValidationError("bridge must have a name")
+	}
+	if bridge.Type != "" && bridge.Type != bridgeDeviceType {
+		return false, newValidationError("device %q must be of type %s, got %q", bridge.Name, bridgeDeviceType, bridge.Type)
+	}
+
+	section, err := findDevice(reader, bridge.Name)
+	if err != nil {
+		return false, err
+	}
+
+	exists := section != ""
+	if exists {
+		// A device without a type configures a port, e.g. its MAC address.
+		if typ := networkOption(reader, section, "type"); typ != bridgeDeviceType {
+			return false, newValidationError("device %q is not a %s", bridge.Name, bridgeDeviceType)
+		}
+	} else {
+		section = deviceSectionName(bridge.Name)
+		if err := reader.AddSection(networkConfigName, section, "device"); err != nil {
+			return false, newSectionError("add", networkConfigName, section, err)
+		}
+	}
+
+	set, err := setOptionsIfChanged(reader, networkConfigName, section, []uciOption{
+		{name: "name", typ: uci.TypeOption, value: bridge.Name},
+		{name: "type", typ: uci.TypeOption, value: bridgeDeviceType},
+		{name: "bridge_empty", typ: uci.TypeOption, value: bridge.BridgeEmpty},
+		{name: "stp", typ: uci.TypeOption, value: bridge.STP},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if len(bridge.Ports) > 0 {
+		listSet, err := setOptionIfChanged(reader, networkConfigName, section, "ports", uci.TypeList, bridge.Ports...)
+		if err != nil {
+			return false, err
+		}
+		set = set || listSet
+	}
+
+	if exists && !set {
+		return false, nil
+	}
+
+	if err := reader.Commit(); err != nil {
+		return false, newCommitError(networkConfigName, err)
+	}
+
+	return true, nil
+}
+
+// AddBridgePort attaches the ethernet port to the bridge named bridge.
+//
+// Returns true if the port was added and the configuration was committed, false if
+// it was attached already. Returns an ErrSectionNotFound error if there is no
+// device of that name.
+//
+// Example:
+//
+//	changed, err := AddBridgePort("br-ahwlan", "eth1")
+func AddBridgePort(bridge, port string) (bool, error) {
+	return AddBridgePortWithReader(bridge, port, NewUCINetworkConfigReader())
+}
+
+// AddBridgePortWithReader attaches a port to a bridge using the provided reader.
+func AddBridgePortWithReader(bridge, port string, reader DeviceConfigReader) (bool, error) {
+	return updateBridgePorts(bridge, port, reader, func(ports []string) []string {
+		if slices.Contains(ports, port) {
+			return ports
+		}
+		return append(ports, port)
+	})
+}
+
+// RemoveBridgePort detaches the ethernet port from the bridge named bridge.
+//
+// Returns true if the port was removed and the configuration was committed, false
+// if it was not attached. Returns an ErrSectionNotFound error if there is no
+// device of that name.
+func RemoveBridgePort(bridge, port string) (bool, error) {
+	return RemoveBridgePortWithReader(bridge, port, NewUCINetworkConfigReader())
+}
+
+// RemoveBridgePortWithReader detaches a port from a bridge using the provided reader.
+func RemoveBridgePortWithReader(bridge, port string, reader DeviceConfigReader) (bool, error) {
+	return updateBridgePorts(bridge, port, reader, func(ports []string) []string {
+		return slices.DeleteFunc(ports, func(p string) bool { return p == port })
+	})
+}
+
+// updateBridgePorts replaces the port list of the bridge with update applied to it
+// and commits if it changed.
+func updateBridgePorts(bridge, port string, reader DeviceConfigReader, update func([]string) []string) (bool, error) {
+	if port == "" {
+		return false, newValidationError("port cannot be empty")
+	}
+
+	section, err := findDevice(reader, bridge)
+	if err != nil {
+		return false, err
+	}
+	if section == "" {
+		return false, fmt.Errorf("%w: network device %q", ErrSectionNotFound, bridge)
+	}
+
+	current, _ := reader.Get(networkConfigName, section, "ports")
+	ports := update(slices.Clone(current))
+	if slices.Equal(ports, current) {
+		return false, nil
+	}
+
+	if len(ports) == 0 {
+		if err := reader.Del(networkConfigName, section, "ports"); err != nil {
+			return false, newSetOptionError(networkConfigName, section, "ports", err)
+		}
+	} else if err := reader.SetType(networkConfigName, section, "ports", uci.TypeList, ports...); err != nil {
+		return false, newSetOptionError(networkConfigName, section, "ports", err)
+	}
+
+	if err := reader.Commit(); err != nil {
+		return false, newCommitError(networkConfigName, err)
+	}
+
+	return true, nil
+}
+
+// DeleteNetworkDevice removes the device named name.
+//
+// Returns true if the device was deleted and the configuration was committed,
+// false if there was none. Returns an ErrValidation error if the device is an
+// anonymous section, as the devices an image ships with usually are; only named
+// sections, such as those SetBridgeDevice creates, can be deleted.
+//
+// Note: This operation requires appropriate privileges and commits the configuration.
+func DeleteNetworkDevice(name string) (bool, error) {
+	return DeleteNetworkDeviceWithReader(name, NewUCINetworkConfigReader())
+}
+
+// DeleteNetworkDeviceWithReader removes a device using the provided reader.
+func DeleteNetworkDeviceWithReader(name string, reader DeviceConfigReader) (bool, error) {
+	section, err := findDevice(reader, name)
+	if err != nil || section == "" {
+		return false, err
+	}
+	if strings.HasPrefix(section, "@") {
+		return false, newValidationError("device %q is an anonymous section and cannot be deleted", name)
+	}
+
+	if err := reader.DelSection(networkConfigName, section); err != nil {
+		return false, newSectionError("delete", networkConfigName, section, err)
+	}
+
+	if err := reader.Commit(); err != nil {
+		return false, newCommitError(networkConfigName, err)
+	}
+
+	return true, nil
+}
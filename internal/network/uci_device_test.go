@@ -0,0 +1,158 @@
+package network
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/digineo/go-uci/v2"
+)
+
+const testDeviceConfig = `
+config device
+	option name 'br-lan'
+	option type 'bridge'
+	list ports 'lan1'
+	list ports 'lan2'
+
+config device
+	option name 'eth0'
+	option macaddr '02:00:00:00:00:01'
+
+config interface 'lan'
+	option device 'br-lan'
+	option proto 'static'
+`
+
+func TestGetNetworkDevicesWithReader(t *testing.T) {
+	reader := NewUCINetworkConfigReaderWithTree(uci.NewTree(writeTestConfig(t, "network", testDeviceConfig)))
+
+	devices, err := GetNetworkDevicesWithReader(reader)
+	if err != nil {
+		t.Fatalf("GetNetworkDevicesWithReader() error = %v", err)
+	}
+	if len(devices) != 2 || devices[0].Name != "br-lan" || devices[1].Name != "eth0" {
+		t.Fatalf("GetNetworkDevicesWithReader() = %+v, want br-lan and eth0", devices)
+	}
+
+	bridge, err := GetNetworkDeviceWithReader("br-lan", reader)
+	if err != nil {
+		t.Fatalf("GetNetworkDeviceWithReader() error = %v", err)
+	}
+	if bridge.Type != "bridge" || !slices.Equal(bridge.Ports, []string{"lan1", "lan2"}) {
+		t.Errorf("GetNetworkDeviceWithReader(br-lan) = %+v", bridge)
+	}
+
+	if _, err := GetNetworkDeviceWithReader("br-ahwlan", reader); !errors.Is(err, ErrSectionNotFound) {
+		t.Errorf("GetNetworkDeviceWithReader(missing) error = %v, want ErrSectionNotFound", err)
+	}
+}
+
+func TestSetBridgeDeviceWithReader(t *testing.T) {
+	dir := writeTestConfig(t, "network", testDeviceConfig)
+	reader := NewUCINetworkConfigReaderWithTree(uci.NewTree(dir))
+
+	changed, err := SetBridgeDeviceWithReader(&UCIDevice{Name: "br-ahwlan", Ports: []string{"lan3"}, BridgeEmpty: "1", STP: "0"}, reader)
+	if err != nil || !changed {
+		t.Fatalf("SetBridgeDeviceWithReader() = %v, %v, want true, nil", changed, err)
+	}
+
+	fresh := &UCINetworkConfigReader{tree: uci.NewTree(dir)}
+	bridge, err := GetNetworkDeviceWithReader("br-ahwlan", fresh)
+	if err != nil {
+		t.Fatalf("GetNetworkDeviceWithReader() error = %v", err)
+	}
+	want := UCIDevice{Name: "br-ahwlan", Type: "bridge", Ports: []string{"lan3"}, BridgeEmpty: "1", STP: "0"}
+	if bridge.Name != want.Name || bridge.Type != want.Type || !slices.Equal(bridge.Ports, want.Ports) || bridge.BridgeEmpty != want.BridgeEmpty || bridge.STP != want.STP {
+		t.Errorf("bridge = %+v, want %+v", *bridge, want)
+	}
+	if sections, _ := fresh.GetSections("network", "device"); !slices.Contains(sections, "br_ahwlan") {
+		t.Errorf("device sections = %v, want a br_ahwlan section", sections)
+	}
+
+	// The same bridge again changes nothing
+	if changed, err := SetBridgeDeviceWithReader(&want, fresh); err != nil || changed {
+		t.Errorf("SetBridgeDeviceWithReader() again = %v, %v, want false, nil", changed, err)
+	}
+
+	// An anonymous bridge is updated in place
+	if _, err := SetBridgeDeviceWithReader(&UCIDevice{Name: "br-lan", STP: "1"}, fresh); err != nil {
+		t.Fatalf("SetBridgeDeviceWithReader(br-lan) error = %v", err)
+	}
+	if devices, _ := GetNetworkDevicesWithReader(fresh); len(devices) != 3 || devices[0].STP != "1" || !slices.Equal(devices[0].Ports, []string{"lan1", "lan2"}) {
+		t.Errorf("devices = %+v, want br-lan updated in place with its ports kept", devices)
+	}
+
+	invalid := []*UCIDevice{
+		nil,
+		{},
+		{Name: "br-x", Type: "8021q"},
+		{Name: "eth0"},
+	}
+	for _, dev := range invalid {
+		if _, err := SetBridgeDeviceWithReader(dev, fresh); !errors.Is(err, ErrValidation) {
+			t.Errorf("SetBridgeDeviceWithReader(%+v) error = %v, want ErrValidation", dev, err)
+		}
+	}
+}
+
+func TestBridgePortsWithReader(t *testing.T) {
+	reader := NewUCINetworkConfigReaderWithTree(uci.NewTree(writeTestConfig(t, "network", testDeviceConfig)))
+
+	if changed, err := AddBridgePortWithReader("br-lan", "lan3", reader); err != nil || !changed {
+		t.Fatalf("AddBridgePortWithReader() = %v, %v, want true, nil", changed, err)
+	}
+	if changed, err := AddBridgePortWithReader("br-lan", "lan3", reader); err != nil || changed {
+		t.Errorf("AddBridgePortWithReader() again = %v, %v, want false, nil", changed, err)
+	}
+	if changed, err := RemoveBridgePortWithReader("br-lan", "lan1", reader); err != nil || !changed {
+		t.Fatalf("RemoveBridgePortWithReader() = %v, %v, want true, nil", changed, err)
+	}
+	if changed, err := RemoveBridgePortWithReader("br-lan", "lan9", reader); err != nil || changed {
+		t.Errorf("RemoveBridgePortWithReader(unattached) = %v, %v, want false, nil", changed, err)
+	}
+
+	bridge, _ := GetNetworkDeviceWithReader("br-lan", reader)
+	if !slices.Equal(bridge.Ports, []string{"lan2", "lan3"}) {
+		t.Errorf("ports = %v, want [lan2 lan3]", bridge.Ports)
+	}
+
+	// Removing the last port drops the list
+	_, _ = RemoveBridgePortWithReader("br-lan", "lan2", reader)
+	_, _ = RemoveBridgePortWithReader("br-lan", "lan3", reader)
+	if bridge, _ := GetNetworkDeviceWithReader("br-lan", reader); len(bridge.Ports) != 0 {
+		t.Errorf("ports = %v, want none", bridge.Ports)
+	}
+
+	if _, err := AddBridgePortWithReader("br-ahwlan", "lan1", reader); !errors.Is(err, ErrSectionNotFound) {
+		t.Errorf("AddBridgePortWithReader(missing bridge) error = %v, want ErrSectionNotFound", err)
+	}
+	if _, err := AddBridgePortWithReader("br-lan", "", reader); !errors.Is(err, ErrValidation) {
+		t.Errorf("AddBridgePortWithReader(empty port) error = %v, want ErrValidation", err)
+	}
+}
+
+func TestDeleteNetworkDeviceWithReader(t *testing.T) {
+	reader := NewUCINetworkConfigReaderWithTree(uci.NewTree(writeTestConfig(t, "network", testDeviceConfig)))
+
+	if _, err := SetBridgeDeviceWithReader(&UCIDevice{Name: "br-ahwlan"}, reader); err != nil {
+		t.Fatalf("SetBridgeDeviceWithReader() error = %v", err)
+	}
+
+	if deleted, err := DeleteNetworkDeviceWithReader("br-ahwlan", reader); err != nil || !deleted {
+		t.Fatalf("DeleteNetworkDeviceWithReader() = %v, %v, want true, nil", deleted, err)
+	}
+	if _, err := GetNetworkDeviceWithReader("br-ahwlan", reader); !errors.Is(err, ErrSectionNotFound) {
+		t.Errorf("GetNetworkDeviceWithReader() after delete error = %v, want ErrSectionNotFound", err)
+	}
+	if deleted, err := DeleteNetworkDeviceWithReader("br-ahwlan", reader); err != nil || deleted {
+		t.Errorf("DeleteNetworkDeviceWithReader() again = %v, %v, want false, nil", deleted, err)
+	}
+
+	if _, err := DeleteNetworkDeviceWithReader("br-lan", reader); !errors.Is(err, ErrValidation) {
+		t.Errorf("anonymous device: error = %v, want ErrValidation", err)
+	}
+	if _, err := GetNetworkDeviceWithReader("br-lan", reader); err != nil {
+		t.Errorf("anonymous device after refused delete: error = %v", err)
+	}
+}
@@ -1,25 +1,54 @@
 package network
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"net"
+	"slices"
 	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/digineo/go-uci/v2"
 	"github.com/openmanet/go-alfred"
 	proto "github.com/openmanet/openmanetd/internal/api/openmanet/v1"
+	"github.com/openmanet/openmanetd/internal/safemode"
 )
 
 const (
 	dhcpConfigName string = "dhcp"
 
-	DefaultDHCPAddressLimit int    = 16
-	DefaultDHCPLeaseTime    string = "12h"
+	// dnsmasqSectionName is the name of the main dnsmasq instance, which pools
+	// without an instance option are served by.
+	dnsmasqSectionName string = "dnsmasq"
 )
 
-// UCIDnsmasq represents the dnsmasq global configuration section.
+// Defaults for the DHCP pool each node serves on the mesh. Pool start and limit are
+// host offsets from DefaultNetworkAddress, as in the UCI dhcp start and limit
+// options, and are advertised to peers in address reservations, so changing them
+// only affects nodes provisioned afterwards.
+const (
+	// DefaultDHCPAddressLimit is the number of addresses in a node's pool. Every
+	// node takes a pool of this size, so the mesh holds at most the host space of
+	// DefaultNetworkMask divided by the limit, less the ranges static addresses
+	// are selected from.
+	DefaultDHCPAddressLimit int = 16
+
+	// DefaultDHCPLeaseTime is the lease time of a node's pool, in dnsmasq syntax.
+	DefaultDHCPLeaseTime string = "12h"
+
+	// DefaultDHCPStartOffset is the offset CalculateAvailableDHCPStart tries first
+	// and scans forward from. It keeps pools clear of the gateway addresses that
+	// SelectAvailableStaticIP hands out upwards from 10.41.0.1, and the first pools
+	// fall in 10.41.0.0/24, which non-gateway static address selection never uses.
+	DefaultDHCPStartOffset int = 100
+)
+
+// UCIDnsmasq represents a dnsmasq instance configuration section.
 type UCIDnsmasq struct {
+	// Name is the UCI section name of the instance. It is not an option.
+	Name            string
 	DomainNeeded    string `uci:"option domainneeded"`
 	LocaliseQueries string `uci:"option localise_queries"`
 	RebindLocalhost string `uci:"option rebind_localhost"`
@@ -31,23 +60,44 @@ type UCIDnsmasq struct {
 	ReadEthers      string `uci:"option readethers"`
 	LocalService    string `uci:"option localservice"`
 	EdnsPacketMax   string `uci:"option ednspacket_max"`
+	LocalUse        string `uci:"option localuse"`
+	// Servers are the upstream resolvers, in dnsmasq server syntax, e.g. "1.1.1.1",
+	// "10.41.0.1#53" or "/mesh/10.41.0.1".
+	Servers []string `uci:"list server"`
 }
 
 // UCIDHCP represents a DHCP pool configuration.
 type UCIDHCP struct {
-	Interface  string `uci:"option interface"`
-	Start      string `uci:"option start"`
-	Limit      string `uci:"option limit"`
-	LeaseTime  string `uci:"option leasetime"`
-	Ignore     string `uci:"option ignore"`
-	DHCPOption string `uci:"list dhcp_option"`
-	Ra         string `uci:"option ra"`
-	RaDefault  string `uci:"option ra_default"`
-	Force      string `uci:"option force"`
+	Interface string `uci:"option interface" json:"interface,omitempty"`
+	Start     string `uci:"option start" json:"start,omitempty"`
+	Limit     string `uci:"option limit" json:"limit,omitempty"`
+	LeaseTime string `uci:"option leasetime" json:"leasetime,omitempty"`
+	Ignore    string `uci:"option ignore" json:"ignore,omitempty"`
+	// DHCPOptions are sent to every client of the pool, e.g. "3,10.41.0.1" for the
+	// router; options for one class of clients go in a tag section.
+	DHCPOptions []string `uci:"list dhcp_option" json:"dhcp_option,omitempty"`
+	Ra          string   `uci:"option ra" json:"ra,omitempty"`
+	RaDefault   string   `uci:"option ra_default" json:"ra_default,omitempty"`
+	Force       string   `uci:"option force" json:"force,omitempty"`
+	// Instance names the dnsmasq section serving the pool; empty for the main instance.
+	Instance string `uci:"option instance" json:"instance,omitempty"`
+
+	// The IPv6 options are served by odhcpd for the prefix the network interface
+	// assigns with ip6assign.
+	DHCPv6  string   `uci:"option dhcpv6" json:"dhcpv6,omitempty"`
+	RaFlags []string `uci:"list ra_flags" json:"ra_flags,omitempty"`
+	NDP     string   `uci:"option ndp" json:"ndp,omitempty"`
+	DNS     []string `uci:"list dns" json:"dns,omitempty"`
+	// DHCPv6PD enables prefix delegation to downstream routers ("1" or "0").
+	DHCPv6PD       string `uci:"option dhcpv6_pd" json:"dhcpv6_pd,omitempty"`
+	DHCPv6PDMinLen string `uci:"option dhcpv6_pd_min_len" json:"dhcpv6_pd_min_len,omitempty"`
 }
 
 // DHCPConfigReader defines an interface for reading DHCP UCI configuration values.
+// dnsmasq instances may be anonymous sections, so they are listed by type with
+// GetSections.
 type DHCPConfigReader interface {
+	GetSections(config, secType string) ([]string, error)
 	Get(config, section, option string) ([]string, bool)
 	SetType(config, section, option string, typ uci.OptionType, values ...string) error
 	Del(config, section, option string) error
@@ -60,88 +110,533 @@ type DHCPConfigReader interface {
 // UCIDHCPConfigReader wraps the UCI functions for DHCP configuration.
 type UCIDHCPConfigReader struct {
 	tree uci.Tree
+	changeLog
 }
 
 // NewUCIDHCPConfigReader creates a new UCI DHCP config reader with the default tree.
 func NewUCIDHCPConfigReader() *UCIDHCPConfigReader {
+	return NewUCIDHCPConfigReaderWithTree(uci.NewTree(uci.DefaultTreePath))
+}
+
+// NewUCIDHCPConfigReaderWithTree creates a UCI DHCP config reader on tree, so that
+// several readers can share one tree or read a tree outside the default path.
+func NewUCIDHCPConfigReaderWithTree(tree uci.Tree) *UCIDHCPConfigReader {
 	return &UCIDHCPConfigReader{
-		tree: uci.NewTree(uci.DefaultTreePath),
+		tree: tree,
 	}
 }
 
+func (r *UCIDHCPConfigReader) GetSections(config, secType string) ([]string, error) {
+	return r.tree.GetSections(config, secType)
+}
+
 func (r *UCIDHCPConfigReader) Get(config, section, option string) ([]string, bool) {
-	return r.tree.Get(config, section, option)
+	return r.get(r.tree, config, section, option)
 }
 
 func (r *UCIDHCPConfigReader) SetType(config, section, option string, typ uci.OptionType, values ...string) error {
-	return r.tree.SetType(config, section, option, typ, values...)
+	if err := safemode.Check(fmt.Sprintf("uci set %s.%s.%s", config, section, option)); err != nil {
+		return err
+	}
+	return r.setType(r.tree, config, section, option, typ, values...)
 }
 
 func (r *UCIDHCPConfigReader) Del(config, section, option string) error {
-	return r.tree.Del(config, section, option)
+	if err := safemode.Check(fmt.Sprintf("uci delete %s.%s.%s", config, section, option)); err != nil {
+		return err
+	}
+	return r.del(r.tree, config, section, option)
 }
 
 func (r *UCIDHCPConfigReader) AddSection(config, section, typ string) error {
-	return r.tree.AddSection(config, section, typ)
+	if err := safemode.Check(fmt.Sprintf("uci add %s.%s", config, section)); err != nil {
+		return err
+	}
+	return r.addSection(r.tree, config, section, typ)
 }
 
 func (r *UCIDHCPConfigReader) DelSection(config, section string) error {
-	return r.tree.DelSection(config, section)
+	if err := safemode.Check(fmt.Sprintf("uci delete %s.%s", config, section)); err != nil {
+		return err
+	}
+	return r.delSection(r.tree, config, section)
 }
 
-// Commit commits the current configuration changes to UCI.
+// Commit commits the current configuration changes to UCI. Failures caused by a
+// read-only filesystem are reported as ErrReadOnlyFS.
 func (r *UCIDHCPConfigReader) Commit() error {
-	return r.tree.Commit()
+	if err := safemode.Check("uci commit"); err != nil {
+		return err
+	}
+	return classifyCommitError(r.commit(r.tree))
 }
 
 func (r *UCIDHCPConfigReader) ReloadConfig() error {
-	return r.tree.LoadConfig(dhcpConfigName, true)
+	if err := r.tree.LoadConfig(dhcpConfigName, true); err != nil {
+		return err
+	}
+	r.reset(dhcpConfigName)
+	return nil
+}
+
+// Revert discards the dhcp changes staged since the last commit. The config is
+// read from disk again on next use.
+func (r *UCIDHCPConfigReader) Revert() {
+	r.tree.Revert(dhcpConfigName)
+	r.reset(dhcpConfigName)
 }
 
-// GetDnsmasqConfig loads and returns the dnsmasq global configuration.
+// GetDnsmasqConfig loads and returns the configuration of the main dnsmasq instance.
 func GetDnsmasqConfig() (*UCIDnsmasq, error) {
 	return GetDnsmasqConfigWithReader(NewUCIDHCPConfigReader())
 }
 
-// GetDnsmasqConfigWithReader loads and returns the dnsmasq configuration using the provided reader.
+// GetDnsmasqConfigWithReader loads and returns the configuration of the main dnsmasq
+// instance using the provided reader. The main instance is the section named
+// "dnsmasq"; if there is none, as when every instance is anonymous or named after
+// its role, the first dnsmasq section is read instead.
 func GetDnsmasqConfigWithReader(reader DHCPConfigReader) (*UCIDnsmasq, error) {
-	var config UCIDnsmasq
+	return readDnsmasqSection(mainDnsmasqSection(reader), reader), nil
+}
+
+// mainDnsmasqSection returns the section of the main dnsmasq instance, as read by
+// GetDnsmasqConfigWithReader.
+func mainDnsmasqSection(reader DHCPConfigReader) string {
+	section := dnsmasqSectionName
+
+	// A reader that cannot list sections still gets the canonical section.
+	if instances, err := ListDnsmasqInstances(reader); err == nil && len(instances) > 0 && !slices.Contains(instances, section) {
+		section = instances[0]
+	}
+
+	return section
+}
+
+// dnsmasqInstanceSection returns the section of the dnsmasq instance name, or of
+// the main instance if name is empty. It returns an ErrSectionNotFound error if
+// there is no dnsmasq section of that name.
+func dnsmasqInstanceSection(name string, reader DHCPConfigReader) (string, error) {
+	if name == "" {
+		return mainDnsmasqSection(reader), nil
+	}
+
+	instances, err := ListDnsmasqInstances(reader)
+	if err != nil {
+		return "", err
+	}
+	if !slices.Contains(instances, name) {
+		return "", fmt.Errorf("%w: dnsmasq instance %q", ErrSectionNotFound, name)
+	}
+
+	return name, nil
+}
+
+// ListDnsmasqInstances returns the names of the dnsmasq sections in the dhcp
+// configuration, in file order. Anonymous sections are named as "@dnsmasq[0]".
+//
+// Example:
+//
+//	instances, err := ListDnsmasqInstances(NewUCIDHCPConfigReader())
+//	// e.g. ["dnsmasq", "guest"]
+func ListDnsmasqInstances(reader DHCPConfigReader) ([]string, error) {
+	instances, err := reader.GetSections(dhcpConfigName, "dnsmasq")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dnsmasq instances: %w", err)
+	}
+	return instances, nil
+}
+
+// GetDnsmasqConfigForInstance loads and returns the configuration of the named
+// dnsmasq instance. An empty name selects the main instance, as for
+// GetDnsmasqConfigWithReader.
+//
+// Returns an ErrSectionNotFound error if there is no dnsmasq section of that name.
+func GetDnsmasqConfigForInstance(name string, reader DHCPConfigReader) (*UCIDnsmasq, error) {
+	section, err := dnsmasqInstanceSection(name, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return readDnsmasqSection(section, reader), nil
+}
+
+// SetDnsmasqConfig creates or updates a dnsmasq instance. config.Name selects the
+// instance; an empty name selects the main instance, as for GetDnsmasqConfig.
+//
+// Returns true if any option changed and the configuration was committed. Empty
+// fields are left as they are, and nothing is committed when no option changed.
+//
+// Example:
+//
+//	changed, err := SetDnsmasqConfig(&UCIDnsmasq{
+//	    Domain:    "mesh",
+//	    Local:     "/mesh/",
+//	    CacheSize: "1000",
+//	})
+//
+// Note: This operation requires appropriate privileges and commits the configuration.
+func SetDnsmasqConfig(config *UCIDnsmasq) (bool, error) {
+	return SetDnsmasqConfigWithReader(config, NewUCIDHCPConfigReader())
+}
+
+// SetDnsmasqConfigWithReader creates or updates a dnsmasq instance using the
+// provided reader. Servers, if set, replaces the server list. A named instance that does not exist is added, unless the name
+// refers to an anonymous section, which cannot be created by name.
+func SetDnsmasqConfigWithReader(config *UCIDnsmasq, reader DHCPConfigReader) (bool, error) {
+	if config == nil {
+		return false, newValidationError("config cannot be nil")
+	}
+
+	section, err := dnsmasqInstanceSection(config.Name, reader)
+	if errors.Is(err, ErrSectionNotFound) && !strings.HasPrefix(config.Name, "@") {
+		section = config.Name
+		if err := reader.AddSection(dhcpConfigName, section, "dnsmasq"); err != nil {
+			return false, newSectionError("add", dhcpConfigName, section, err)
+		}
+	} else if err != nil {
+		return false, err
+	}
+
+	changed, err := setOptionsIfChanged(reader, dhcpConfigName, section, []uciOption{
+		{name: "domainneeded", typ: uci.TypeOption, value: config.DomainNeeded},
+		{name: "localise_queries", typ: uci.TypeOption, value: config.LocaliseQueries},
+		{name: "rebind_localhost", typ: uci.TypeOption, value: config.RebindLocalhost},
+		{name: "local", typ: uci.TypeOption, value: config.Local},
+		{name: "domain", typ: uci.TypeOption, value: config.Domain},
+		{name: "expandhosts", typ: uci.TypeOption, value: config.ExpandHosts},
+		{name: "cachesize", typ: uci.TypeOption, value: config.CacheSize},
+		{name: "authoritative", typ: uci.TypeOption, value: config.Authoritative},
+		{name: "readethers", typ: uci.TypeOption, value: config.ReadEthers},
+		{name: "localservice", typ: uci.TypeOption, value: config.LocalService},
+		{name: "ednspacket_max", typ: uci.TypeOption, value: config.EdnsPacketMax},
+		{name: "localuse", typ: uci.TypeOption, value: config.LocalUse},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if len(config.Servers) > 0 {
+		if err := validateDnsmasqServers(config.Servers); err != nil {
+			return false, err
+		}
+		set, err := setOptionIfChanged(reader, dhcpConfigName, section, "server", uci.TypeList, config.Servers...)
+		if err != nil {
+			return false, err
+		}
+		changed = changed || set
+	}
+
+	if !changed {
+		return false, nil
+	}
+
+	if err := reader.Commit(); err != nil {
+		return false, newCommitError(dhcpConfigName, err)
+	}
+
+	return true, nil
+}
+
+// setDnsmasqOption sets option of the dnsmasq instance name to value and commits
+// it if it changed.
+func setDnsmasqOption(name, option, value string, reader DHCPConfigReader) (bool, error) {
+	section, err := dnsmasqInstanceSection(name, reader)
+	if err != nil {
+		return false, err
+	}
+
+	changed, err := setOptionIfChanged(reader, dhcpConfigName, section, option, uci.TypeOption, value)
+	if err != nil || !changed {
+		return false, err
+	}
+
+	if err := reader.Commit(); err != nil {
+		return false, newCommitError(dhcpConfigName, err)
+	}
+
+	return true, nil
+}
+
+// SetDnsmasqDomain sets the local domain of the dnsmasq instance name, or of the
+// main instance if name is empty.
+//
+// Returns true if the domain changed and the configuration was committed. Returns
+// an ErrSectionNotFound error if there is no instance of that name.
+//
+// Example:
+//
+//	changed, err := SetDnsmasqDomain("", "mesh")
+func SetDnsmasqDomain(name, domain string) (bool, error) {
+	return SetDnsmasqDomainWithReader(name, domain, NewUCIDHCPConfigReader())
+}
+
+// SetDnsmasqDomainWithReader sets the local domain using the provided reader.
+func SetDnsmasqDomainWithReader(name, domain string, reader DHCPConfigReader) (bool, error) {
+	if domain == "" || strings.ContainsAny(domain, "/ ") {
+		return false, newValidationError("invalid domain %q", domain)
+	}
+	return setDnsmasqOption(name, "domain", domain, reader)
+}
+
+// SetDnsmasqLocal sets the domains the dnsmasq instance name answers from its own
+// data only, in dnsmasq syntax (e.g. "/mesh/"), or of the main instance if name is
+// empty.
+//
+// Returns true if the option changed and the configuration was committed. Returns
+// an ErrSectionNotFound error if there is no instance of that name.
+//
+// Example:
+//
+//	changed, err := SetDnsmasqLocal("", "/mesh/")
+func SetDnsmasqLocal(name, local string) (bool, error) {
+	return SetDnsmasqLocalWithReader(name, local, NewUCIDHCPConfigReader())
+}
+
+// SetDnsmasqLocalWithReader sets the local domains using the provided reader.
+func SetDnsmasqLocalWithReader(name, local string, reader DHCPConfigReader) (bool, error) {
+	if len(local) < 2 || !strings.HasPrefix(local, "/") || !strings.HasSuffix(local, "/") {
+		return false, newValidationError("local must be of the form /domain/, got %q", local)
+	}
+	return setDnsmasqOption(name, "local", local, reader)
+}
+
+// SetDnsmasqCacheSize sets the number of names the dnsmasq instance name caches,
+// or the main instance if name is empty. Zero disables the cache.
+//
+// Returns true if the option changed and the configuration was committed. Returns
+// an ErrSectionNotFound error if there is no instance of that name.
+//
+// Example:
+//
+//	changed, err := SetDnsmasqCacheSize("", 1000)
+func SetDnsmasqCacheSize(name string, size int) (bool, error) {
+	return SetDnsmasqCacheSizeWithReader(name, size, NewUCIDHCPConfigReader())
+}
+
+// SetDnsmasqCacheSizeWithReader sets the cache size using the provided reader.
+func SetDnsmasqCacheSizeWithReader(name string, size int, reader DHCPConfigReader) (bool, error) {
+	if size < 0 {
+		return false, newValidationError("cache size must not be negative, got %d", size)
+	}
+	return setDnsmasqOption(name, "cachesize", strconv.Itoa(size), reader)
+}
+
+// SetDnsmasqAuthoritative sets whether the dnsmasq instance name, or the main
+// instance if name is empty, is the only DHCP server on its networks. An
+// authoritative server answers requests for unknown leases at once instead of
+// ignoring them.
+//
+// Returns true if the option changed and the configuration was committed. Returns
+// an ErrSectionNotFound error if there is no instance of that name.
+//
+// Example:
+//
+//	changed, err := SetDnsmasqAuthoritative("", true)
+func SetDnsmasqAuthoritative(name string, enable bool) (bool, error) {
+	return SetDnsmasqAuthoritativeWithReader(name, enable, NewUCIDHCPConfigReader())
+}
+
+// SetDnsmasqAuthoritativeWithReader sets the authoritative option using the
+// provided reader.
+func SetDnsmasqAuthoritativeWithReader(name string, enable bool, reader DHCPConfigReader) (bool, error) {
+	value := "0"
+	if enable {
+		value = "1"
+	}
+	return setDnsmasqOption(name, "authoritative", value, reader)
+}
+
+// validateDnsmasqServer checks that server is in dnsmasq server syntax: an optional
+// "/domain/" prefix, then an IP address with an optional "#port" and "@source".
+// A bare "/domain/" makes the domain local-only.
+func validateDnsmasqServer(server string) error {
+	addr := server
+	if strings.HasPrefix(addr, "/") {
+		i := strings.LastIndex(addr, "/")
+		if i == 0 {
+			return newValidationError("invalid dnsmasq server %q", server)
+		}
+		addr = addr[i+1:]
+		if addr == "" {
+			return nil
+		}
+	}
+
+	addr, _, _ = strings.Cut(addr, "@")
+	addr, port, hasPort := strings.Cut(addr, "#")
+	if net.ParseIP(addr) == nil {
+		return newValidationError("invalid dnsmasq server %q", server)
+	}
+	if hasPort {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return newValidationError("invalid port in dnsmasq server %q", server)
+		}
+	}
+
+	return nil
+}
+
+// validateDnsmasqServers checks every entry of servers.
+func validateDnsmasqServers(servers []string) error {
+	for _, server := range servers {
+		if err := validateDnsmasqServer(server); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateDnsmasqServers replaces the server list of the dnsmasq instance name with
+// update applied to it and commits if it changed. An empty list removes the option.
+func updateDnsmasqServers(name string, reader DHCPConfigReader, update func([]string) []string) (bool, error) {
+	section, err := dnsmasqInstanceSection(name, reader)
+	if err != nil {
+		return false, err
+	}
+
+	current, _ := reader.Get(dhcpConfigName, section, "server")
+	servers := update(slices.Clone(current))
+	if slices.Equal(servers, current) {
+		return false, nil
+	}
+
+	if len(servers) == 0 {
+		if err := reader.Del(dhcpConfigName, section, "server"); err != nil {
+			return false, newSetOptionError(dhcpConfigName, section, "server", err)
+		}
+	} else if err := reader.SetType(dhcpConfigName, section, "server", uci.TypeList, servers...); err != nil {
+		return false, newSetOptionError(dhcpConfigName, section, "server", err)
+	}
+
+	if err := reader.Commit(); err != nil {
+		return false, newCommitError(dhcpConfigName, err)
+	}
 
-	if values, ok := reader.Get(dhcpConfigName, "dnsmasq", "domainneeded"); ok && len(values) > 0 {
+	return true, nil
+}
+
+// AddDnsmasqServer appends server to the upstream resolvers of the dnsmasq
+// instance name, or of the main instance if name is empty.
+//
+// Returns true if the server was added and the configuration was committed, false
+// if it was listed already. Returns an ErrSectionNotFound error if there is no
+// instance of that name, and an ErrValidation error if server is not in dnsmasq
+// server syntax.
+//
+// Example:
+//
+//	// Resolve the mesh domain through the gateway.
+//	changed, err := AddDnsmasqServer("", "/mesh/10.41.0.1")
+func AddDnsmasqServer(name, server string) (bool, error) {
+	return AddDnsmasqServerWithReader(name, server, NewUCIDHCPConfigReader())
+}
+
+// AddDnsmasqServerWithReader appends an upstream resolver using the provided reader.
+func AddDnsmasqServerWithReader(name, server string, reader DHCPConfigReader) (bool, error) {
+	if err := validateDnsmasqServer(server); err != nil {
+		return false, err
+	}
+	return updateDnsmasqServers(name, reader, func(servers []string) []string {
+		if slices.Contains(servers, server) {
+			return servers
+		}
+		return append(servers, server)
+	})
+}
+
+// RemoveDnsmasqServer removes server from the upstream resolvers of the dnsmasq
+// instance name, or of the main instance if name is empty.
+//
+// Returns true if the server was removed and the configuration was committed, false
+// if it was not listed. Returns an ErrSectionNotFound error if there is no instance
+// of that name.
+func RemoveDnsmasqServer(name, server string) (bool, error) {
+	return RemoveDnsmasqServerWithReader(name, server, NewUCIDHCPConfigReader())
+}
+
+// RemoveDnsmasqServerWithReader removes an upstream resolver using the provided
+// reader.
+func RemoveDnsmasqServerWithReader(name, server string, reader DHCPConfigReader) (bool, error) {
+	return updateDnsmasqServers(name, reader, func(servers []string) []string {
+		return slices.DeleteFunc(servers, func(s string) bool { return s == server })
+	})
+}
+
+// ReplaceDnsmasqServers replaces the upstream resolvers of the dnsmasq instance
+// name, or of the main instance if name is empty, with servers, in order. An empty
+// list removes them, so dnsmasq falls back to the resolvers of resolv.conf.
+//
+// Returns true if the list changed and the configuration was committed. Returns an
+// ErrSectionNotFound error if there is no instance of that name, and an
+// ErrValidation error if an entry is not in dnsmasq server syntax.
+//
+// Example:
+//
+//	// Point a node without an uplink at the gateway.
+//	changed, err := ReplaceDnsmasqServers("", []string{gatewayIP})
+//
+// Note: This operation requires appropriate privileges and commits the configuration.
+// dnsmasq must be reloaded for it to take effect.
+func ReplaceDnsmasqServers(name string, servers []string) (bool, error) {
+	return ReplaceDnsmasqServersWithReader(name, servers, NewUCIDHCPConfigReader())
+}
+
+// ReplaceDnsmasqServersWithReader replaces the upstream resolvers using the
+// provided reader.
+func ReplaceDnsmasqServersWithReader(name string, servers []string, reader DHCPConfigReader) (bool, error) {
+	if err := validateDnsmasqServers(servers); err != nil {
+		return false, err
+	}
+	return updateDnsmasqServers(name, reader, func([]string) []string {
+		return slices.Clone(servers)
+	})
+}
+
+// readDnsmasqSection reads the options of the dnsmasq section.
+func readDnsmasqSection(section string, reader DHCPConfigReader) *UCIDnsmasq {
+	config := UCIDnsmasq{Name: section}
+
+	if values, ok := reader.Get(dhcpConfigName, section, "domainneeded"); ok && len(values) > 0 {
 		config.DomainNeeded = values[0]
 	}
-	if values, ok := reader.Get(dhcpConfigName, "dnsmasq", "localise_queries"); ok && len(values) > 0 {
+	if values, ok := reader.Get(dhcpConfigName, section, "localise_queries"); ok && len(values) > 0 {
 		config.LocaliseQueries = values[0]
 	}
-	if values, ok := reader.Get(dhcpConfigName, "dnsmasq", "rebind_localhost"); ok && len(values) > 0 {
+	if values, ok := reader.Get(dhcpConfigName, section, "rebind_localhost"); ok && len(values) > 0 {
 		config.RebindLocalhost = values[0]
 	}
-	if values, ok := reader.Get(dhcpConfigName, "dnsmasq", "local"); ok && len(values) > 0 {
+	if values, ok := reader.Get(dhcpConfigName, section, "local"); ok && len(values) > 0 {
 		config.Local = values[0]
 	}
-	if values, ok := reader.Get(dhcpConfigName, "dnsmasq", "domain"); ok && len(values) > 0 {
+	if values, ok := reader.Get(dhcpConfigName, section, "domain"); ok && len(values) > 0 {
 		config.Domain = values[0]
 	}
-	if values, ok := reader.Get(dhcpConfigName, "dnsmasq", "expandhosts"); ok && len(values) > 0 {
+	if values, ok := reader.Get(dhcpConfigName, section, "expandhosts"); ok && len(values) > 0 {
 		config.ExpandHosts = values[0]
 	}
-	if values, ok := reader.Get(dhcpConfigName, "dnsmasq", "cachesize"); ok && len(values) > 0 {
+	if values, ok := reader.Get(dhcpConfigName, section, "cachesize"); ok && len(values) > 0 {
 		config.CacheSize = values[0]
 	}
-	if values, ok := reader.Get(dhcpConfigName, "dnsmasq", "authoritative"); ok && len(values) > 0 {
+	if values, ok := reader.Get(dhcpConfigName, section, "authoritative"); ok && len(values) > 0 {
 		config.Authoritative = values[0]
 	}
-	if values, ok := reader.Get(dhcpConfigName, "dnsmasq", "readethers"); ok && len(values) > 0 {
+	if values, ok := reader.Get(dhcpConfigName, section, "readethers"); ok && len(values) > 0 {
 		config.ReadEthers = values[0]
 	}
-	if values, ok := reader.Get(dhcpConfigName, "dnsmasq", "localservice"); ok && len(values) > 0 {
+	if values, ok := reader.Get(dhcpConfigName, section, "localservice"); ok && len(values) > 0 {
 		config.LocalService = values[0]
 	}
-	if values, ok := reader.Get(dhcpConfigName, "dnsmasq", "ednspacket_max"); ok && len(values) > 0 {
+	if values, ok := reader.Get(dhcpConfigName, section, "ednspacket_max"); ok && len(values) > 0 {
 		config.EdnsPacketMax = values[0]
 	}
+	if values, ok := reader.Get(dhcpConfigName, section, "localuse"); ok && len(values) > 0 {
+		config.LocalUse = values[0]
+	}
+	if values, ok := reader.Get(dhcpConfigName, section, "server"); ok && len(values) > 0 {
+		config.Servers = slices.Clone(values)
+	}
 
-	return &config, nil
+	return &config
 }
 
 // GetDHCPConfig loads and returns the DHCP pool configuration by section name.
@@ -169,7 +664,7 @@ func GetDHCPConfigWithReader(section string, reader DHCPConfigReader) (*UCIDHCP,
 		config.Ignore = values[0]
 	}
 	if values, ok := reader.Get(dhcpConfigName, section, "dhcp_option"); ok && len(values) > 0 {
-		config.DHCPOption = values[0]
+		config.DHCPOptions = slices.Clone(values)
 	}
 	if values, ok := reader.Get(dhcpConfigName, section, "ra"); ok && len(values) > 0 {
 		config.Ra = values[0]
@@ -180,17 +675,102 @@ func GetDHCPConfigWithReader(section string, reader DHCPConfigReader) (*UCIDHCP,
 	if values, ok := reader.Get(dhcpConfigName, section, "force"); ok && len(values) > 0 {
 		config.Force = values[0]
 	}
+	if values, ok := reader.Get(dhcpConfigName, section, "instance"); ok && len(values) > 0 {
+		config.Instance = values[0]
+	}
+	if values, ok := reader.Get(dhcpConfigName, section, "dhcpv6"); ok && len(values) > 0 {
+		config.DHCPv6 = values[0]
+	}
+	if values, ok := reader.Get(dhcpConfigName, section, "ra_flags"); ok && len(values) > 0 {
+		config.RaFlags = slices.Clone(values)
+	}
+	if values, ok := reader.Get(dhcpConfigName, section, "ndp"); ok && len(values) > 0 {
+		config.NDP = values[0]
+	}
+	if values, ok := reader.Get(dhcpConfigName, section, "dns"); ok && len(values) > 0 {
+		config.DNS = slices.Clone(values)
+	}
+	if values, ok := reader.Get(dhcpConfigName, section, "dhcpv6_pd"); ok && len(values) > 0 {
+		config.DHCPv6PD = values[0]
+	}
+	if values, ok := reader.Get(dhcpConfigName, section, "dhcpv6_pd_min_len"); ok && len(values) > 0 {
+		config.DHCPv6PDMinLen = values[0]
+	}
 
 	return &config, nil
 }
 
+// UCIDHCPSection is a dhcp section of the dhcp config with its name.
+type UCIDHCPSection struct {
+	// Name is the UCI section name, e.g. "ahwlan"; anonymous sections are named as
+	// "@dhcp[0]". It is not an option.
+	Name string `json:"name"`
+	UCIDHCP
+}
+
+// GetAllDHCPConfigs loads and returns every dhcp section of the dhcp config in file
+// order, including pools created by other tooling.
+//
+// Example:
+//
+//	pools, err := GetAllDHCPConfigs()
+//	for _, p := range pools {
+//	    fmt.Printf("%s: %s start %s limit %s\n", p.Name, p.Interface, p.Start, p.Limit)
+//	}
+func GetAllDHCPConfigs() ([]UCIDHCPSection, error) {
+	return GetAllDHCPConfigsWithReader(NewUCIDHCPConfigReader())
+}
+
+// GetAllDHCPConfigsWithReader loads and returns every dhcp section using the
+// provided reader.
+func GetAllDHCPConfigsWithReader(reader DHCPConfigReader) ([]UCIDHCPSection, error) {
+	sections, err := reader.GetSections(dhcpConfigName, "dhcp")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dhcp pools: %w", err)
+	}
+
+	pools := make([]UCIDHCPSection, 0, len(sections))
+	for _, section := range sections {
+		config, err := GetDHCPConfigWithReader(section, reader)
+		if err != nil {
+			return nil, err
+		}
+		pools = append(pools, UCIDHCPSection{Name: section, UCIDHCP: *config})
+	}
+
+	return pools, nil
+}
+
+// ConflictingDHCPPools returns the pools other than section that serve iface, i.e.
+// that dnsmasq would also attach to the interface unless they are ignored.
+//
+// Example:
+//
+//	pools, _ := GetAllDHCPConfigs()
+//	for _, p := range ConflictingDHCPPools(pools, "ahwlan", "ahwlan") {
+//	    log.Printf("pool %s also serves ahwlan", p.Name)
+//	}
+func ConflictingDHCPPools(pools []UCIDHCPSection, section, iface string) []UCIDHCPSection {
+	var conflicts []UCIDHCPSection
+	for _, pool := range pools {
+		if pool.Name == section || pool.Interface != iface || pool.Ignore == "1" {
+			continue
+		}
+		conflicts = append(conflicts, pool)
+	}
+	return conflicts
+}
+
 // SetDHCPConfig creates or updates a DHCP pool configuration.
 //
 // Parameters:
 //   - section: The UCI section name (e.g., "lan", "wan", "ahwlan")
 //   - config: The DHCP configuration to set
 //
-// Returns an error if the configuration cannot be saved.
+// Returns true if any option changed and the configuration was committed. Options
+// that already hold the requested value are not written, and nothing is committed
+// when no option changed. Returns an ErrValidation error if an IPv6 option holds a
+// value odhcpd does not accept.
 //
 // Example:
 //
@@ -200,73 +780,79 @@ func GetDHCPConfigWithReader(section string, reader DHCPConfigReader) (*UCIDHCP,
 //	    Limit:     "150",
 //	    LeaseTime: "12h",
 //	}
-//	err := SetDHCPConfig("lan", dhcpConfig)
+//	changed, err := SetDHCPConfig("lan", dhcpConfig)
 //
 // Note: This operation requires appropriate privileges and commits the configuration.
-func SetDHCPConfig(section string, config *UCIDHCP) error {
+func SetDHCPConfig(section string, config *UCIDHCP) (bool, error) {
 	return SetDHCPConfigWithReader(section, config, NewUCIDHCPConfigReader())
 }
 
 // SetDHCPConfigWithReader creates or updates a DHCP pool configuration using the provided reader.
-func SetDHCPConfigWithReader(section string, config *UCIDHCP, reader DHCPConfigReader) error {
+func SetDHCPConfigWithReader(section string, config *UCIDHCP, reader DHCPConfigReader) (bool, error) {
 	if config == nil {
-		return fmt.Errorf("config cannot be nil")
+		return false, newValidationError("config cannot be nil")
 	}
-
-	// Add section if it doesn't exist (this will fail silently if it exists)
-	_ = reader.AddSection(dhcpConfigName, section, "dhcp")
-
-	if config.Interface != "" {
-		if err := reader.SetType(dhcpConfigName, section, "interface", uci.TypeOption, config.Interface); err != nil {
-			return fmt.Errorf("failed to set interface: %w", err)
-		}
-	}
-	if config.Start != "" {
-		if err := reader.SetType(dhcpConfigName, section, "start", uci.TypeOption, config.Start); err != nil {
-			return fmt.Errorf("failed to set start: %w", err)
-		}
+	if err := validateDHCPv6Options(config); err != nil {
+		return false, err
 	}
-	if config.Limit != "" {
-		if err := reader.SetType(dhcpConfigName, section, "limit", uci.TypeOption, config.Limit); err != nil {
-			return fmt.Errorf("failed to set limit: %w", err)
-		}
+	if err := validateDHCPOptions(config.DHCPOptions); err != nil {
+		return false, err
 	}
 	if config.LeaseTime != "" {
-		if err := reader.SetType(dhcpConfigName, section, "leasetime", uci.TypeOption, config.LeaseTime); err != nil {
-			return fmt.Errorf("failed to set leasetime: %w", err)
-		}
-	}
-	if config.Ignore != "" {
-		if err := reader.SetType(dhcpConfigName, section, "ignore", uci.TypeOption, config.Ignore); err != nil {
-			return fmt.Errorf("failed to set ignore: %w", err)
+		if reason := validateLeaseTime(config.LeaseTime); reason != "" {
+			return false, newInvalidOptionError(dhcpConfigName, section, "leasetime", config.LeaseTime, reason)
 		}
 	}
-	if config.DHCPOption != "" {
-		if err := reader.SetType(dhcpConfigName, section, "dhcp_option", uci.TypeOption, config.DHCPOption); err != nil {
-			return fmt.Errorf("failed to set dhcp_option: %w", err)
-		}
+
+	// Add section if it doesn't exist (this will fail silently if it exists)
+	_ = reader.AddSection(dhcpConfigName, section, "dhcp")
+
+	changed, err := setOptionsIfChanged(reader, dhcpConfigName, section, []uciOption{
+		{name: "interface", typ: uci.TypeOption, value: config.Interface},
+		{name: "start", typ: uci.TypeOption, value: config.Start},
+		{name: "limit", typ: uci.TypeOption, value: config.Limit},
+		{name: "leasetime", typ: uci.TypeOption, value: config.LeaseTime},
+		{name: "ignore", typ: uci.TypeOption, value: config.Ignore},
+		{name: "ra", typ: uci.TypeOption, value: config.Ra},
+		{name: "ra_default", typ: uci.TypeOption, value: config.RaDefault},
+		{name: "force", typ: uci.TypeOption, value: config.Force},
+		{name: "instance", typ: uci.TypeOption, value: config.Instance},
+		{name: "dhcpv6", typ: uci.TypeOption, value: config.DHCPv6},
+		{name: "ndp", typ: uci.TypeOption, value: config.NDP},
+		{name: "dhcpv6_pd", typ: uci.TypeOption, value: config.DHCPv6PD},
+		{name: "dhcpv6_pd_min_len", typ: uci.TypeOption, value: config.DHCPv6PDMinLen},
+	})
+	if err != nil {
+		return false, err
 	}
-	if config.Ra != "" {
-		if err := reader.SetType(dhcpConfigName, section, "ra", uci.TypeOption, config.Ra); err != nil {
-			return fmt.Errorf("failed to set ra: %w", err)
+
+	for _, list := range []struct {
+		name   string
+		values []string
+	}{
+		{"dhcp_option", config.DHCPOptions},
+		{"ra_flags", config.RaFlags},
+		{"dns", config.DNS},
+	} {
+		if len(list.values) == 0 {
+			continue
 		}
-	}
-	if config.RaDefault != "" {
-		if err := reader.SetType(dhcpConfigName, section, "ra_default", uci.TypeOption, config.RaDefault); err != nil {
-			return fmt.Errorf("failed to set ra_default: %w", err)
+		set, err := setOptionIfChanged(reader, dhcpConfigName, section, list.name, uci.TypeList, list.values...)
+		if err != nil {
+			return false, err
 		}
+		changed = changed || set
 	}
-	if config.Force != "" {
-		if err := reader.SetType(dhcpConfigName, section, "force", uci.TypeOption, config.Force); err != nil {
-			return fmt.Errorf("failed to set force: %w", err)
-		}
+
+	if !changed {
+		return false, nil
 	}
 
 	if err := reader.Commit(); err != nil {
-		return fmt.Errorf("failed to commit DHCP config: %w", err)
+		return false, newCommitError(dhcpConfigName, err)
 	}
 
-	return nil
+	return true, nil
 }
 
 // DeleteDHCPConfig removes a DHCP pool configuration section.
@@ -291,11 +877,11 @@ func DeleteDHCPConfig(section string) error {
 // DeleteDHCPConfigWithReader removes a DHCP pool configuration section using the provided reader.
 func DeleteDHCPConfigWithReader(section string, reader DHCPConfigReader) error {
 	if err := reader.DelSection(dhcpConfigName, section); err != nil {
-		return fmt.Errorf("failed to delete DHCP section: %w", err)
+		return newSectionError("delete", dhcpConfigName, section, err)
 	}
 
 	if err := reader.Commit(); err != nil {
-		return fmt.Errorf("failed to commit DHCP config: %w", err)
+		return newCommitError(dhcpConfigName, err)
 	}
 
 	return nil
@@ -338,12 +924,13 @@ func EnableDHCP(section string) error {
 
 // EnableDHCPWithReader enables DHCP using the provided reader.
 func EnableDHCPWithReader(section string, reader DHCPConfigReader) error {
-	if err := reader.SetType(dhcpConfigName, section, "ignore", uci.TypeOption, "0"); err != nil {
-		return fmt.Errorf("failed to enable DHCP: %w", err)
+	changed, err := setOptionIfChanged(reader, dhcpConfigName, section, "ignore", uci.TypeOption, "0")
+	if err != nil || !changed {
+		return err
 	}
 
 	if err := reader.Commit(); err != nil {
-		return fmt.Errorf("failed to commit DHCP config: %w", err)
+		return newCommitError(dhcpConfigName, err)
 	}
 
 	return nil
@@ -361,12 +948,13 @@ func DisableDHCP(section string) error {
 
 // DisableDHCPWithReader disables DHCP using the provided reader.
 func DisableDHCPWithReader(section string, reader DHCPConfigReader) error {
-	if err := reader.SetType(dhcpConfigName, section, "ignore", uci.TypeOption, "1"); err != nil {
-		return fmt.Errorf("failed to disable DHCP: %w", err)
+	changed, err := setOptionIfChanged(reader, dhcpConfigName, section, "ignore", uci.TypeOption, "1")
+	if err != nil || !changed {
+		return err
 	}
 
 	if err := reader.Commit(); err != nil {
-		return fmt.Errorf("failed to commit DHCP config: %w", err)
+		return newCommitError(dhcpConfigName, err)
 	}
 
 	return nil
@@ -402,36 +990,39 @@ func IsDHCPEnabledWithReader(section string, reader DHCPConfigReader) (bool, err
 //   - start: The starting address offset (e.g., "100")
 //   - limit: The maximum number of addresses to assign (e.g., "150")
 //
+// Returns true if the range changed and the configuration was committed.
+//
 // Example:
 //
-//	err := SetDHCPRange("lan", "100", "150")
+//	changed, err := SetDHCPRange("lan", "100", "150")
 //	// This will assign addresses from .100 to .249 (100 + 150 - 1)
-func SetDHCPRange(section, start, limit string) error {
+func SetDHCPRange(section, start, limit string) (bool, error) {
 	return SetDHCPRangeWithReader(section, start, limit, NewUCIDHCPConfigReader())
 }
 
 // SetDHCPRangeWithReader sets the DHCP range using the provided reader.
-func SetDHCPRangeWithReader(section, start, limit string, reader DHCPConfigReader) error {
+func SetDHCPRangeWithReader(section, start, limit string, reader DHCPConfigReader) (bool, error) {
 	// Validate that start and limit are numeric
 	if _, err := strconv.Atoi(start); err != nil {
-		return fmt.Errorf("start must be a number: %w", err)
+		return false, newValidationError("start must be a number: %v", err)
 	}
 	if _, err := strconv.Atoi(limit); err != nil {
-		return fmt.Errorf("limit must be a number: %w", err)
+		return false, newValidationError("limit must be a number: %v", err)
 	}
 
-	if err := reader.SetType(dhcpConfigName, section, "start", uci.TypeOption, start); err != nil {
-		return fmt.Errorf("failed to set start: %w", err)
-	}
-	if err := reader.SetType(dhcpConfigName, section, "limit", uci.TypeOption, limit); err != nil {
-		return fmt.Errorf("failed to set limit: %w", err)
+	changed, err := setOptionsIfChanged(reader, dhcpConfigName, section, []uciOption{
+		{name: "start", typ: uci.TypeOption, value: start},
+		{name: "limit", typ: uci.TypeOption, value: limit},
+	})
+	if err != nil || !changed {
+		return false, err
 	}
 
 	if err := reader.Commit(); err != nil {
-		return fmt.Errorf("failed to commit DHCP config: %w", err)
+		return false, newCommitError(dhcpConfigName, err)
 	}
 
-	return nil
+	return true, nil
 }
 
 // SetDHCPLeaseTime sets the lease time for DHCP addresses.
@@ -440,6 +1031,8 @@ func SetDHCPRangeWithReader(section, start, limit string, reader DHCPConfigReade
 //   - section: The UCI section name (e.g., "lan")
 //   - leasetime: The lease time (e.g., "12h", "3600", "infinite")
 //
+// Returns an *ErrInvalidOption error if leasetime is malformed.
+//
 // Example:
 //
 //	err := SetDHCPLeaseTime("lan", "12h")
@@ -449,17 +1042,334 @@ func SetDHCPLeaseTime(section, leasetime string) error {
 
 // SetDHCPLeaseTimeWithReader sets the lease time using the provided reader.
 func SetDHCPLeaseTimeWithReader(section, leasetime string, reader DHCPConfigReader) error {
-	if err := reader.SetType(dhcpConfigName, section, "leasetime", uci.TypeOption, leasetime); err != nil {
-		return fmt.Errorf("failed to set leasetime: %w", err)
+	if reason := validateLeaseTime(leasetime); reason != "" {
+		return newInvalidOptionError(dhcpConfigName, section, "leasetime", leasetime, reason)
+	}
+
+	changed, err := setOptionIfChanged(reader, dhcpConfigName, section, "leasetime", uci.TypeOption, leasetime)
+	if err != nil || !changed {
+		return err
 	}
 
 	if err := reader.Commit(); err != nil {
-		return fmt.Errorf("failed to commit DHCP config: %w", err)
+		return newCommitError(dhcpConfigName, err)
 	}
 
 	return nil
 }
 
+// GetRAMode returns the router advertisement mode of the specified section.
+//
+// Parameters:
+//   - section: The UCI section name (e.g., "lan")
+//
+// Returns:
+//   - The 'ra' option ("server", "relay", "hybrid", "disabled"), or "" if unset
+//   - An error if the configuration cannot be read
+func GetRAMode(section string) (string, error) {
+	return GetRAModeWithReader(section, NewUCIDHCPConfigReader())
+}
+
+// GetRAModeWithReader returns the router advertisement mode using the provided reader.
+func GetRAModeWithReader(section string, reader DHCPConfigReader) (string, error) {
+	config, err := GetDHCPConfigWithReader(section, reader)
+	if err != nil {
+		return "", err
+	}
+
+	return config.Ra, nil
+}
+
+// SetRADefault sets whether router advertisements on the specified section announce
+// this node as a default router.
+//
+// Parameters:
+//   - section: The UCI section name (e.g., "lan")
+//   - enable: true to set 'ra_default' to '1', false to remove the option
+//
+// Returns:
+//   - true if the configuration changed and the RA service needs a reload
+//   - An error if the configuration cannot be saved
+//
+// Disabling removes 'ra_default' rather than setting it to '0'. Without the option
+// the default applies, which only announces a default route while the node itself
+// has one, whereas any value left in place is still passed on to the RA service.
+//
+// Example:
+//
+//	changed, err := SetRADefault("lan", meshCfg.IsGatewayMode())
+func SetRADefault(section string, enable bool) (bool, error) {
+	return SetRADefaultWithReader(section, enable, NewUCIDHCPConfigReader())
+}
+
+// SetRADefaultWithReader sets the 'ra_default' option using the provided reader.
+func SetRADefaultWithReader(section string, enable bool, reader DHCPConfigReader) (bool, error) {
+	values, exists := reader.Get(dhcpConfigName, section, "ra_default")
+
+	if enable {
+		if exists && len(values) == 1 && values[0] == "1" {
+			return false, nil
+		}
+		if err := reader.SetType(dhcpConfigName, section, "ra_default", uci.TypeOption, "1"); err != nil {
+			return false, newSetOptionError(dhcpConfigName, section, "ra_default", err)
+		}
+	} else {
+		if !exists {
+			return false, nil
+		}
+		if err := reader.Del(dhcpConfigName, section, "ra_default"); err != nil {
+			return false, newSetOptionError(dhcpConfigName, section, "ra_default", err)
+		}
+	}
+
+	if err := reader.Commit(); err != nil {
+		return false, newCommitError(dhcpConfigName, err)
+	}
+
+	return true, nil
+}
+
+// UCIDHCPHost represents a static lease, a host section pinning a client to an
+// address.
+type UCIDHCPHost struct {
+	// Section is the UCI section name of the host. It is not an option.
+	Section   string `json:"-"`
+	MAC       string `uci:"option mac" json:"mac,omitempty"`
+	IP        string `uci:"option ip" json:"ip,omitempty"`
+	Name      string `uci:"option name" json:"name,omitempty"`
+	LeaseTime string `uci:"option leasetime" json:"leasetime,omitempty"`
+	// Tag names the tag section whose options the client receives.
+	Tag string `uci:"option tag" json:"tag,omitempty"`
+}
+
+// dhcpHostSectionName returns the section name AddDHCPHost gives a new host with mac.
+func dhcpHostSectionName(mac net.HardwareAddr) string {
+	return "host_" + strings.ReplaceAll(mac.String(), ":", "")
+}
+
+// dhcpOption returns the first value of option in section, or "".
+func dhcpOption(reader DHCPConfigReader, section, option string) string {
+	if values, ok := reader.Get(dhcpConfigName, section, option); ok && len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// readDHCPHost reads the options of the host section.
+func readDHCPHost(reader DHCPConfigReader, section string) UCIDHCPHost {
+	return UCIDHCPHost{
+		Section:   section,
+		MAC:       dhcpOption(reader, section, "mac"),
+		IP:        dhcpOption(reader, section, "ip"),
+		Name:      dhcpOption(reader, section, "name"),
+		LeaseTime: dhcpOption(reader, section, "leasetime"),
+		Tag:       dhcpOption(reader, section, "tag"),
+	}
+}
+
+// hostHasMAC reports whether the mac option of host lists mac. dnsmasq accepts
+// several space separated addresses in one host section.
+func hostHasMAC(host UCIDHCPHost, mac net.HardwareAddr) bool {
+	for _, field := range strings.Fields(host.MAC) {
+		if hw, err := net.ParseMAC(field); err == nil && bytes.Equal(hw, mac) {
+			return true
+		}
+	}
+	return false
+}
+
+// findDHCPHost returns the host section listing mac, or nil if there is none.
+func findDHCPHost(reader DHCPConfigReader, mac net.HardwareAddr) (*UCIDHCPHost, error) {
+	hosts, err := ListDHCPHostsWithReader(reader)
+	if err != nil {
+		return nil, err
+	}
+	for _, host := range hosts {
+		if hostHasMAC(host, mac) {
+			return &host, nil
+		}
+	}
+	return nil, nil
+}
+
+// ListDHCPHosts returns the static leases of the dhcp configuration, in file order.
+func ListDHCPHosts() ([]UCIDHCPHost, error) {
+	return ListDHCPHostsWithReader(NewUCIDHCPConfigReader())
+}
+
+// ListDHCPHostsWithReader returns the static leases using the provided reader.
+func ListDHCPHostsWithReader(reader DHCPConfigReader) ([]UCIDHCPHost, error) {
+	sections, err := reader.GetSections(dhcpConfigName, "host")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s host sections: %w", dhcpConfigName, err)
+	}
+
+	hosts := make([]UCIDHCPHost, 0, len(sections))
+	for _, section := range sections {
+		hosts = append(hosts, readDHCPHost(reader, section))
+	}
+	return hosts, nil
+}
+
+// GetDHCPHost returns the static lease of the client with the MAC address mac,
+// whatever its section is called.
+//
+// Returns an ErrSectionNotFound error if no host section lists mac.
+func GetDHCPHost(mac string) (*UCIDHCPHost, error) {
+	return GetDHCPHostWithReader(mac, NewUCIDHCPConfigReader())
+}
+
+// GetDHCPHostWithReader returns the static lease of mac using the provided reader.
+func GetDHCPHostWithReader(mac string, reader DHCPConfigReader) (*UCIDHCPHost, error) {
+	hw, err := net.ParseMAC(mac)
+	if err != nil {
+		return nil, newValidationError("invalid MAC address %q", mac)
+	}
+
+	host, err := findDHCPHost(reader, hw)
+	if err != nil {
+		return nil, err
+	}
+	if host == nil {
+		return nil, fmt.Errorf("%w: dhcp host %s", ErrSectionNotFound, hw)
+	}
+	return host, nil
+}
+
+// AddDHCPHost pins the client host.MAC to host.IP. A host section already listing
+// the MAC address is updated in place; otherwise a section named after the address
+// is added. Empty Name, LeaseTime and Tag are left as they are. host.Section is
+// ignored.
+//
+// Returns true if any option changed and the configuration was committed. Returns
+// an ErrValidation error if the MAC or IP address or the tag name is invalid, or if
+// another host section already holds the IP address.
+//
+// Example:
+//
+//	changed, err := AddDHCPHost(&UCIDHCPHost{
+//	    MAC:  "02:00:00:00:00:01",
+//	    IP:   "10.41.1.10",
+//	    Name: "node1",
+//	})
+//
+// Note: This operation requires appropriate privileges and commits the configuration.
+func AddDHCPHost(host *UCIDHCPHost) (bool, error) {
+	return AddDHCPHostWithReader(host, NewUCIDHCPConfigReader())
+}
+
+// AddDHCPHostWithReader adds or updates a static lease using the provided reader.
+func AddDHCPHostWithReader(host *UCIDHCPHost, reader DHCPConfigReader) (bool, error) {
+	if host == nil {
+		return false, newValidationError("host cannot be nil")
+	}
+	hw, err := net.ParseMAC(host.MAC)
+	if err != nil {
+		return false, newValidationError("invalid MAC address %q", host.MAC)
+	}
+	ip := net.ParseIP(host.IP)
+	if ip == nil || ip.To4() == nil {
+		return false, newValidationError("invalid IPv4 address %q", host.IP)
+	}
+	if host.Tag != "" {
+		if err := validateDHCPTagName(host.Tag); err != nil {
+			return false, err
+		}
+	}
+	if host.LeaseTime != "" {
+		if reason := validateLeaseTime(host.LeaseTime); reason != "" {
+			return false, newValidationError("invalid lease time %q for %s: %s", host.LeaseTime, hw, reason)
+		}
+	}
+
+	hosts, err := ListDHCPHostsWithReader(reader)
+	if err != nil {
+		return false, err
+	}
+
+	section := ""
+	for _, existing := range hosts {
+		if hostHasMAC(existing, hw) {
+			section = existing.Section
+			continue
+		}
+		if other := net.ParseIP(existing.IP); other != nil && other.Equal(ip) {
+			return false, newValidationError("%s is already leased to %s", ip, existing.MAC)
+		}
+	}
+
+	// A section found by MAC keeps its mac option, which may list further addresses.
+	options := []uciOption{
+		{name: "ip", typ: uci.TypeOption, value: ip.String()},
+		{name: "name", typ: uci.TypeOption, value: host.Name},
+		{name: "leasetime", typ: uci.TypeOption, value: host.LeaseTime},
+		{name: "tag", typ: uci.TypeOption, value: host.Tag},
+	}
+	if section == "" {
+		section = dhcpHostSectionName(hw)
+		if err := reader.AddSection(dhcpConfigName, section, "host"); err != nil {
+			return false, newSectionError("add", dhcpConfigName, section, err)
+		}
+		options = append(options, uciOption{name: "mac", typ: uci.TypeOption, value: hw.String()})
+	}
+
+	changed, err := setOptionsIfChanged(reader, dhcpConfigName, section, options)
+	if err != nil || !changed {
+		return false, err
+	}
+
+	if err := reader.Commit(); err != nil {
+		return false, newCommitError(dhcpConfigName, err)
+	}
+
+	return true, nil
+}
+
+// DeleteDHCPHost removes the static lease of the client with the MAC address mac.
+// A host section listing further addresses loses only mac.
+//
+// Returns true if a lease was removed and the configuration was committed, false if
+// there was none.
+//
+// Note: This operation requires appropriate privileges and commits the configuration.
+func DeleteDHCPHost(mac string) (bool, error) {
+	return DeleteDHCPHostWithReader(mac, NewUCIDHCPConfigReader())
+}
+
+// DeleteDHCPHostWithReader removes the static lease of mac using the provided reader.
+func DeleteDHCPHostWithReader(mac string, reader DHCPConfigReader) (bool, error) {
+	hw, err := net.ParseMAC(mac)
+	if err != nil {
+		return false, newValidationError("invalid MAC address %q", mac)
+	}
+
+	host, err := findDHCPHost(reader, hw)
+	if err != nil || host == nil {
+		return false, err
+	}
+
+	var rest []string
+	for _, field := range strings.Fields(host.MAC) {
+		if other, err := net.ParseMAC(field); err != nil || !bytes.Equal(other, hw) {
+			rest = append(rest, field)
+		}
+	}
+
+	if len(rest) == 0 {
+		if err := reader.DelSection(dhcpConfigName, host.Section); err != nil {
+			return false, newSectionError("delete", dhcpConfigName, host.Section, err)
+		}
+	} else if err := reader.SetType(dhcpConfigName, host.Section, "mac", uci.TypeOption, strings.Join(rest, " ")); err != nil {
+		return false, newSetOptionError(dhcpConfigName, host.Section, "mac", err)
+	}
+
+	if err := reader.Commit(); err != nil {
+		return false, newCommitError(dhcpConfigName, err)
+	}
+
+	return true, nil
+}
+
 // DHCPRange represents an allocated DHCP address range.
 type DHCPRange struct {
 	Start int // Starting offset
@@ -493,38 +1403,38 @@ type DHCPRange struct {
 // the desired limit without overlapping with existing ranges.
 func CalculateAvailableDHCPStart(records []alfred.Record, networkAddr, subnetMask string, desiredLimit int) (int, error) {
 	if desiredLimit <= 0 {
-		return 0, fmt.Errorf("desiredLimit must be greater than 0")
+		return 0, newValidationError("desiredLimit must be greater than 0")
 	}
 
 	// Parse network address and subnet mask
 	ip := net.ParseIP(networkAddr)
 	if ip == nil {
-		return 0, fmt.Errorf("invalid network address: %s", networkAddr)
+		return 0, newValidationError("invalid network address: %s", networkAddr)
 	}
 	ip = ip.To4()
 	if ip == nil {
-		return 0, fmt.Errorf("network address must be IPv4: %s", networkAddr)
+		return 0, newValidationError("network address must be IPv4: %s", networkAddr)
 	}
 
 	mask := net.ParseIP(subnetMask)
 	if mask == nil {
-		return 0, fmt.Errorf("invalid subnet mask: %s", subnetMask)
+		return 0, newValidationError("invalid subnet mask: %s", subnetMask)
 	}
 	mask = mask.To4()
 	if mask == nil {
-		return 0, fmt.Errorf("subnet mask must be IPv4: %s", subnetMask)
+		return 0, newValidationError("subnet mask must be IPv4: %s", subnetMask)
 	}
 
 	// Calculate network size (number of available host addresses)
 	// This calculates the total number of addresses in the subnet
 	ones, bits := net.IPMask(mask).Size()
 	if bits != 32 {
-		return 0, fmt.Errorf("invalid subnet mask")
+		return 0, newValidationError("invalid subnet mask")
 	}
 	networkSize := (1 << uint(bits-ones)) - 2 // Subtract network and broadcast addresses
 
 	if networkSize <= 0 {
-		return 0, fmt.Errorf("network size too small")
+		return 0, newValidationError("network size too small")
 	}
 
 	// Collect existing DHCP ranges from records
@@ -573,8 +1483,8 @@ func CalculateAvailableDHCPStart(records []alfred.Record, networkAddr, subnetMas
 	})
 
 	// Find the first available gap that can fit our desired range
-	// Strategy: Prefer offset 100 if available, otherwise find the first gap starting from 100 going forward,
-	// and only if nothing found after 100, search before 100
+	// Strategy: Prefer DefaultDHCPStartOffset if available, otherwise find the first gap after it,
+	// and only if nothing is found after it, search before it
 
 	// Helper function to check if a candidate range is available
 	checkCandidate := func(start int) bool {
@@ -590,13 +1500,13 @@ func CalculateAvailableDHCPStart(records []alfred.Record, networkAddr, subnetMas
 		return true
 	}
 
-	// First, try offset 100 (preferred default)
-	if checkCandidate(100) {
-		return 100, nil
+	// First, try the preferred default offset
+	if checkCandidate(DefaultDHCPStartOffset) {
+		return DefaultDHCPStartOffset, nil
 	}
 
-	// If 100 doesn't work, scan from 100 forward to find the first available gap
-	candidate := 100
+	// If that doesn't work, scan forward from it to find the first available gap
+	candidate := DefaultDHCPStartOffset
 	for candidate+desiredLimit-1 <= networkSize {
 		if checkCandidate(candidate) {
 			return candidate, nil
@@ -618,9 +1528,9 @@ func CalculateAvailableDHCPStart(records []alfred.Record, networkAddr, subnetMas
 		}
 	}
 
-	// If no space found after 100, search from offset 1 to 99
+	// If no space found after the default offset, search from offset 1 up to it
 	candidate = 1
-	for candidate < 100 && candidate+desiredLimit-1 <= networkSize {
+	for candidate < DefaultDHCPStartOffset && candidate+desiredLimit-1 <= networkSize {
 		if checkCandidate(candidate) {
 			return candidate, nil
 		}
@@ -641,7 +1551,7 @@ func CalculateAvailableDHCPStart(records []alfred.Record, networkAddr, subnetMas
 		}
 	}
 
-	return 0, fmt.Errorf("no available DHCP range found for limit %d within network size %d", desiredLimit, networkSize)
+	return 0, fmt.Errorf("%w: no DHCP range found for limit %d within network size %d", ErrNoAvailableAddress, desiredLimit, networkSize)
 }
 
 // rangesOverlap checks if two ranges overlap.
@@ -0,0 +1,190 @@
+package network
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/digineo/go-uci/v2"
+)
+
+/*
+config hostrecord 'hostrecord_gw_mesh'
+	option name 'gw.mesh'
+	option ip '10.41.0.1'
+*/
+
+// dhcpHostRecordSectionType is the type of the sections that OpenWrt turns into
+// dnsmasq host-record lines.
+const dhcpHostRecordSectionType string = "hostrecord"
+
+// UCIDnsmasqHostRecord represents a hostrecord section of the dhcp config: a name
+// that dnsmasq answers with IP, and the reverse lookup of IP.
+//
+// Peers learned over alfred are resolved through the hosts file written by
+// WriteHostsFile, which every node regenerates from the mesh and which is gone after
+// a reboot. Host records are for names that are configured on the node itself and
+// must survive a reboot, e.g. a service address the mesh should reach by name.
+type UCIDnsmasqHostRecord struct {
+	// Section is the UCI section name; anonymous sections are named as
+	// "@hostrecord[0]". It is not an option.
+	Section string `json:"section"`
+	Name    string `uci:"option name" json:"name"`
+	IP      string `uci:"option ip" json:"ip"`
+}
+
+// hostRecordSectionName returns the name of the section created for a host record
+// of name, e.g. "hostrecord_gw_mesh" for "gw.mesh".
+func hostRecordSectionName(name string) string {
+	return "hostrecord_" + strings.NewReplacer(".", "_", "-", "_").Replace(strings.ToLower(name))
+}
+
+// validateHostRecord checks that name is a host name whose labels validateHostname
+// accepts and that ip is an IP address.
+func validateHostRecord(name, ip string) error {
+	if name == "" {
+		return newValidationError("host record name cannot be empty")
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" {
+			return newValidationError("invalid host record name %q: empty label", name)
+		}
+		if reason := validateHostname(label); reason != "" {
+			return newValidationError("invalid host record name %q: %s", name, reason)
+		}
+	}
+	if net.ParseIP(ip) == nil {
+		return newValidationError("invalid host record address %q for %s", ip, name)
+	}
+	return nil
+}
+
+// ListDnsmasqHostRecords loads and returns the hostrecord sections of the dhcp
+// config in file order.
+func ListDnsmasqHostRecords() ([]UCIDnsmasqHostRecord, error) {
+	return ListDnsmasqHostRecordsWithReader(NewUCIDHCPConfigReader())
+}
+
+// ListDnsmasqHostRecordsWithReader loads and returns the hostrecord sections using
+// the provided reader.
+func ListDnsmasqHostRecordsWithReader(reader DHCPConfigReader) ([]UCIDnsmasqHostRecord, error) {
+	sections, err := reader.GetSections(dhcpConfigName, dhcpHostRecordSectionType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dhcp host records: %w", err)
+	}
+
+	records := make([]UCIDnsmasqHostRecord, 0, len(sections))
+	for _, section := range sections {
+		records = append(records, UCIDnsmasqHostRecord{
+			Section: section,
+			Name:    dhcpOption(reader, section, "name"),
+			IP:      dhcpOption(reader, section, "ip"),
+		})
+	}
+
+	return records, nil
+}
+
+// findDnsmasqHostRecord returns the section of the host record for name, matched
+// case-insensitively, or "" if there is none.
+func findDnsmasqHostRecord(reader DHCPConfigReader, name string) (string, error) {
+	records, err := ListDnsmasqHostRecordsWithReader(reader)
+	if err != nil {
+		return "", err
+	}
+
+	for _, record := range records {
+		if strings.EqualFold(record.Name, name) {
+			return record.Section, nil
+		}
+	}
+
+	return "", nil
+}
+
+// SetDnsmasqHostRecord makes dnsmasq answer name with ip. An existing record for
+// name is updated in place, whatever its section is called; a new record gets a
+// section named after it.
+//
+// Returns true if the record was created or changed and the configuration was
+// committed, or an ErrValidation error if name is not a host name or ip not an IP
+// address. Call ReloadDnsmasq to apply it.
+//
+// Example:
+//
+//	changed, err := SetDnsmasqHostRecord("gw.mesh", "10.41.0.1")
+//	if err == nil && changed {
+//	    err = ReloadDnsmasq()
+//	}
+func SetDnsmasqHostRecord(name, ip string) (bool, error) {
+	return SetDnsmasqHostRecordWithReader(name, ip, NewUCIDHCPConfigReader())
+}
+
+// SetDnsmasqHostRecordWithReader creates or updates a host record using the
+// provided reader.
+func SetDnsmasqHostRecordWithReader(name, ip string, reader DHCPConfigReader) (bool, error) {
+	if err := validateHostRecord(name, ip); err != nil {
+		return false, err
+	}
+
+	section, err := findDnsmasqHostRecord(reader, name)
+	if err != nil {
+		return false, err
+	}
+
+	exists := section != ""
+	if !exists {
+		section = hostRecordSectionName(name)
+		if err := reader.AddSection(dhcpConfigName, section, dhcpHostRecordSectionType); err != nil {
+			return false, newSectionError("add", dhcpConfigName, section, err)
+		}
+	}
+
+	changed, err := setOptionsIfChanged(reader, dhcpConfigName, section, []uciOption{
+		{name: "name", typ: uci.TypeOption, value: name},
+		{name: "ip", typ: uci.TypeOption, value: ip},
+	})
+	if err != nil {
+		return false, err
+	}
+	if exists && !changed {
+		return false, nil
+	}
+
+	if err := reader.Commit(); err != nil {
+		return false, newCommitError(dhcpConfigName, err)
+	}
+
+	return true, nil
+}
+
+// DeleteDnsmasqHostRecord removes the host record for name.
+//
+// Returns true if the record was deleted and the configuration was committed, false
+// if there was none. Returns an ErrValidation error if the record is an anonymous
+// section; only named sections, such as those SetDnsmasqHostRecord creates, can be
+// deleted.
+func DeleteDnsmasqHostRecord(name string) (bool, error) {
+	return DeleteDnsmasqHostRecordWithReader(name, NewUCIDHCPConfigReader())
+}
+
+// DeleteDnsmasqHostRecordWithReader removes a host record using the provided reader.
+func DeleteDnsmasqHostRecordWithReader(name string, reader DHCPConfigReader) (bool, error) {
+	section, err := findDnsmasqHostRecord(reader, name)
+	if err != nil || section == "" {
+		return false, err
+	}
+	if strings.HasPrefix(section, "@") {
+		return false, newValidationError("host record %q is an anonymous section and cannot be deleted", name)
+	}
+
+	if err := reader.DelSection(dhcpConfigName, section); err != nil {
+		return false, newSectionError("delete", dhcpConfigName, section, err)
+	}
+
+	if err := reader.Commit(); err != nil {
+		return false, newCommitError(dhcpConfigName, err)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,88 @@
+package network
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/digineo/go-uci/v2"
+)
+
+const testHostRecordConfig = `
+config dnsmasq
+	option domain 'mesh'
+
+config hostrecord
+	option name 'nas.mesh'
+	option ip '10.41.3.20'
+`
+
+func TestSetDnsmasqHostRecordWithReader(t *testing.T) {
+	dir := writeTestConfig(t, "dhcp", testHostRecordConfig)
+	reader := NewUCIDHCPConfigReaderWithTree(uci.NewTree(dir))
+
+	// A new record gets a named section
+	changed, err := SetDnsmasqHostRecordWithReader("gw.mesh", "10.41.0.1", reader)
+	if err != nil || !changed {
+		t.Fatalf("SetDnsmasqHostRecordWithReader(gw.mesh) = %v, %v, want true, nil", changed, err)
+	}
+
+	// An existing anonymous record is updated in place
+	changed, err = SetDnsmasqHostRecordWithReader("NAS.mesh", "10.41.3.21", reader)
+	if err != nil || !changed {
+		t.Fatalf("SetDnsmasqHostRecordWithReader(NAS.mesh) = %v, %v, want true, nil", changed, err)
+	}
+
+	changed, err = SetDnsmasqHostRecordWithReader("gw.mesh", "10.41.0.1", reader)
+	if err != nil || changed {
+		t.Errorf("SetDnsmasqHostRecordWithReader() again = %v, %v, want false, nil", changed, err)
+	}
+
+	got, err := ListDnsmasqHostRecordsWithReader(NewUCIDHCPConfigReaderWithTree(uci.NewTree(dir)))
+	if err != nil {
+		t.Fatalf("ListDnsmasqHostRecordsWithReader() error = %v", err)
+	}
+	want := []UCIDnsmasqHostRecord{
+		{Section: "@hostrecord[0]", Name: "NAS.mesh", IP: "10.41.3.21"},
+		{Section: "hostrecord_gw_mesh", Name: "gw.mesh", IP: "10.41.0.1"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("host records = %+v, want %+v", got, want)
+	}
+
+	// Only named records can be deleted
+	if _, err := DeleteDnsmasqHostRecordWithReader("nas.mesh", reader); !errors.Is(err, ErrValidation) {
+		t.Errorf("DeleteDnsmasqHostRecordWithReader(nas.mesh) error = %v, want ErrValidation", err)
+	}
+	if deleted, err := DeleteDnsmasqHostRecordWithReader("gw.mesh", reader); err != nil || !deleted {
+		t.Errorf("DeleteDnsmasqHostRecordWithReader(gw.mesh) = %v, %v, want true, nil", deleted, err)
+	}
+	if deleted, err := DeleteDnsmasqHostRecordWithReader("gw.mesh", reader); err != nil || deleted {
+		t.Errorf("DeleteDnsmasqHostRecordWithReader(gw.mesh) again = %v, %v, want false, nil", deleted, err)
+	}
+	if got, _ := ListDnsmasqHostRecordsWithReader(reader); len(got) != 1 || got[0].Name != "NAS.mesh" {
+		t.Errorf("host records after delete = %+v", got)
+	}
+}
+
+func TestSetDnsmasqHostRecordWithReader_Invalid(t *testing.T) {
+	mock := newMockDHCPConfigReader()
+
+	tests := []struct {
+		name string
+		ip   string
+	}{
+		{"", "10.41.0.1"},
+		{"gw..mesh", "10.41.0.1"},
+		{"gw_1.mesh", "10.41.0.1"},
+		{"-gw.mesh", "10.41.0.1"},
+		{"gw.mesh", "10.41.0"},
+		{"gw.mesh", ""},
+	}
+
+	for _, tt := range tests {
+		if _, err := SetDnsmasqHostRecordWithReader(tt.name, tt.ip, mock); !errors.Is(err, ErrValidation) {
+			t.Errorf("SetDnsmasqHostRecordWithReader(%q, %q) error = %v, want ErrValidation", tt.name, tt.ip, err)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package network
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/digineo/go-uci/v2"
+)
+
+// dhcpTagSectionType is the type of the sections that hold the DHCP options of a
+// class of clients.
+const dhcpTagSectionType string = "tag"
+
+// UCIDHCPTag represents a tag section: DHCP options that only the clients carrying
+// the tag receive, e.g. a different gateway and DNS server for guest clients.
+// Clients get the tag from their host section.
+type UCIDHCPTag struct {
+	// Name is the UCI section name, which is also the tag. It is not an option.
+	Name        string   `json:"name"`
+	DHCPOptions []string `uci:"list dhcp_option" json:"dhcp_option,omitempty"`
+	// Force sends the options even to clients that did not ask for them ("1").
+	Force string `uci:"option force" json:"force,omitempty"`
+}
+
+// validateDHCPTagName checks that name can be used as a tag and a section name.
+func validateDHCPTagName(name string) error {
+	if name == "" {
+		return newValidationError("tag name cannot be empty")
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_') {
+			return newValidationError("invalid tag name %q, only letters, digits and _ are allowed", name)
+		}
+	}
+	return nil
+}
+
+// validateDHCPOption checks that option is in dnsmasq dhcp-option syntax: an option
+// number or "option:name", optionally preceded by "tag:name," prefixes, then a
+// comma and the value, e.g. "3,10.41.0.1" or "option:dns-server,10.41.0.1".
+func validateDHCPOption(option string) error {
+	rest := option
+	for strings.HasPrefix(rest, "tag:") {
+		_, after, ok := strings.Cut(rest, ",")
+		if !ok {
+			return newValidationError("invalid DHCP option %q", option)
+		}
+		rest = after
+	}
+
+	code, _, ok := strings.Cut(rest, ",")
+	if !ok {
+		return newValidationError("DHCP option %q has no value", option)
+	}
+	if name, found := strings.CutPrefix(code, "option:"); found {
+		if name == "" {
+			return newValidationError("invalid DHCP option %q", option)
+		}
+		return nil
+	}
+	if n, err := strconv.Atoi(code); err != nil || n < 1 || n > 254 {
+		return newValidationError("invalid DHCP option %q, the code must be between 1 and 254", option)
+	}
+	return nil
+}
+
+// validateDHCPOptions checks every entry of options.
+func validateDHCPOptions(options []string) error {
+	for _, option := range options {
+		if err := validateDHCPOption(option); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readDHCPTag reads the options of the tag section.
+func readDHCPTag(reader DHCPConfigReader, section string) UCIDHCPTag {
+	options, _ := reader.Get(dhcpConfigName, section, "dhcp_option")
+
+	return UCIDHCPTag{
+		Name:        section,
+		DHCPOptions: slices.Clone(options),
+		Force:       dhcpOption(reader, section, "force"),
+	}
+}
+
+// ListDHCPTags loads and returns the tag sections in file order.
+func ListDHCPTags() ([]UCIDHCPTag, error) {
+	return ListDHCPTagsWithReader(NewUCIDHCPConfigReader())
+}
+
+// ListDHCPTagsWithReader loads and returns the tag sections using the provided reader.
+func ListDHCPTagsWithReader(reader DHCPConfigReader) ([]UCIDHCPTag, error) {
+	sections, err := reader.GetSections(dhcpConfigName, dhcpTagSectionType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dhcp tags: %w", err)
+	}
+
+	tags := make([]UCIDHCPTag, 0, len(sections))
+	for _, section := range sections {
+		tags = append(tags, readDHCPTag(reader, section))
+	}
+
+	return tags, nil
+}
+
+// dhcpTagExists reports whether there is a tag section named name.
+func dhcpTagExists(reader DHCPConfigReader, name string) (bool, error) {
+	sections, err := reader.GetSections(dhcpConfigName, dhcpTagSectionType)
+	if err != nil {
+		return false, fmt.Errorf("failed to read dhcp tags: %w", err)
+	}
+	return slices.Contains(sections, name), nil
+}
+
+// GetDHCPTag loads and returns the tag section named name.
+//
+// Returns an ErrSectionNotFound error if there is no tag of that name.
+func GetDHCPTag(name string) (*UCIDHCPTag, error) {
+	return GetDHCPTagWithReader(name, NewUCIDHCPConfigReader())
+}
+
+// GetDHCPTagWithReader loads and returns a tag section using the provided reader.
+func GetDHCPTagWithReader(name string, reader DHCPConfigReader) (*UCIDHCPTag, error) {
+	exists, err := dhcpTagExists(reader, name)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("%w: dhcp tag %q", ErrSectionNotFound, name)
+	}
+
+	tag := readDHCPTag(reader, name)
+	return &tag, nil
+}
+
+// SetDHCPTag creates or updates the tag section tag.Name. DHCPOptions, if set,
+// replaces the option list; an empty Force is left as it is.
+//
+// Returns true if anything changed and the configuration was committed. Returns an
+// ErrValidation error if the name or an option is invalid.
+//
+// Example:
+//
+//	// Guest clients use the guest gateway for routing and DNS.
+//	changed, err := SetDHCPTag(&UCIDHCPTag{
+//	    Name:        "guest",
+//	    DHCPOptions: []string{"3,10.41.8.1", "6,10.41.8.1"},
+//	})
+//
+// Note: This operation requires appropriate privileges and commits the configuration.
+func SetDHCPTag(tag *UCIDHCPTag) (bool, error) {
+	return SetDHCPTagWithReader(tag, NewUCIDHCPConfigReader())
+}
+
+// SetDHCPTagWithReader creates or updates a tag section using the provided reader.
+func SetDHCPTagWithReader(tag *UCIDHCPTag, reader DHCPConfigReader) (bool, error) {
+	if tag == nil {
+		return false, newValidationError("tag cannot be nil")
+	}
+	if err := validateDHCPTagName(tag.Name); err != nil {
+		return false, err
+	}
+	if err := validateDHCPOptions(tag.DHCPOptions); err != nil {
+		return false, err
+	}
+
+	exists, err := dhcpTagExists(reader, tag.Name)
+	if err != nil {
+		return false, err
+	}
+	if !exists {
+		if err := reader.AddSection(dhcpConfigName, tag.Name, dhcpTagSectionType); err != nil {
+			return false, newSectionError("add", dhcpConfigName, tag.Name, err)
+		}
+	}
+
+	changed, err := setOptionsIfChanged(reader, dhcpConfigName, tag.Name, []uciOption{
+		{name: "force", typ: uci.TypeOption, value: tag.Force},
+	})
+	if err != nil {
+		return false, err
+	}
+	if len(tag.DHCPOptions) > 0 {
+		set, err := setOptionIfChanged(reader, dhcpConfigName, tag.Name, "dhcp_option", uci.TypeList, tag.DHCPOptions...)
+		if err != nil {
+			return false, err
+		}
+		changed = changed || set
+	}
+
+	if exists && !changed {
+		return false, nil
+	}
+
+	if err := reader.Commit(); err != nil {
+		return false, newCommitError(dhcpConfigName, err)
+	}
+
+	return true, nil
+}
+
+// DeleteDHCPTag removes the tag section named name. Host sections that carry the
+// tag keep it; their clients then get no tag-specific options.
+//
+// Returns true if the tag was deleted and the configuration was committed, false
+// if there was none.
+//
+// Note: This operation requires appropriate privileges and commits the configuration.
+func DeleteDHCPTag(name string) (bool, error) {
+	return DeleteDHCPTagWithReader(name, NewUCIDHCPConfigReader())
+}
+
+// DeleteDHCPTagWithReader removes a tag section using the provided reader.
+func DeleteDHCPTagWithReader(name string, reader DHCPConfigReader) (bool, error) {
+	exists, err := dhcpTagExists(reader, name)
+	if err != nil || !exists {
+		return false, err
+	}
+
+	if err := reader.DelSection(dhcpConfigName, name); err != nil {
+		return false, newSectionError("delete", dhcpConfigName, name, err)
+	}
+
+	if err := reader.Commit(); err != nil {
+		return false, newCommitError(dhcpConfigName, err)
+	}
+
+	return true, nil
+}
+
+// AddDHCPOption appends option to the dhcp_option list of section, which may be a
+// pool such as "ahwlan" or a tag section.
+//
+// Returns true if the option was added and the configuration was committed, false
+// if it was listed already. Returns an ErrValidation error if option is not in
+// dnsmasq dhcp-option syntax.
+//
+// Example:
+//
+//	changed, err := AddDHCPOption("ahwlan", "option:ntp-server,10.41.0.1")
+func AddDHCPOption(section, option string) (bool, error) {
+	return AddDHCPOptionWithReader(section, option, NewUCIDHCPConfigReader())
+}
+
+// AddDHCPOptionWithReader appends a DHCP option using the provided reader.
+func AddDHCPOptionWithReader(section, option string, reader DHCPConfigReader) (bool, error) {
+	if err := validateDHCPOption(option); err != nil {
+		return false, err
+	}
+
+	current, _ := reader.Get(dhcpConfigName, section, "dhcp_option")
+	if slices.Contains(current, option) {
+		return false, nil
+	}
+
+	if err := reader.SetType(dhcpConfigName, section, "dhcp_option", uci.TypeList, append(slices.Clone(current), option)...); err != nil {
+		return false, newSetOptionError(dhcpConfigName, section, "dhcp_option", err)
+	}
+
+	if err := reader.Commit(); err != nil {
+		return false, newCommitError(dhcpConfigName, err)
+	}
+
+	return true, nil
+}
+
+// RemoveDHCPOption removes option from the dhcp_option list of section.
+//
+// Returns true if the option was removed and the configuration was committed, false
+// if it was not listed.
+func RemoveDHCPOption(section, option string) (bool, error) {
+	return RemoveDHCPOptionWithReader(section, option, NewUCIDHCPConfigReader())
+}
+
+// RemoveDHCPOptionWithReader removes a DHCP option using the provided reader.
+func RemoveDHCPOptionWithReader(section, option string, reader DHCPConfigReader) (bool, error) {
+	current, _ := reader.Get(dhcpConfigName, section, "dhcp_option")
+	options := slices.DeleteFunc(slices.Clone(current), func(o string) bool { return o == option })
+	if len(options) == len(current) {
+		return false, nil
+	}
+
+	if len(options) == 0 {
+		if err := reader.Del(dhcpConfigName, section, "dhcp_option"); err != nil {
+			return false, newSetOptionError(dhcpConfigName, section, "dhcp_option", err)
+		}
+	} else if err := reader.SetType(dhcpConfigName, section, "dhcp_option", uci.TypeList, options...); err != nil {
+		return false, newSetOptionError(dhcpConfigName, section, "dhcp_option", err)
+	}
+
+	if err := reader.Commit(); err != nil {
+		return false, newCommitError(dhcpConfigName, err)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,123 @@
+package network
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestValidateDHCPOption(t *testing.T) {
+	valid := []string{"3,10.41.0.1", "6,10.41.0.1,10.41.0.2", "option:dns-server,10.41.0.1", "tag:guest,3,10.41.8.1"}
+	for _, option := range valid {
+		if err := validateDHCPOption(option); err != nil {
+			t.Errorf("validateDHCPOption(%q) = %v, want nil", option, err)
+		}
+	}
+
+	invalid := []string{"", "3", "router,10.41.0.1", "0,x", "255,x", "option:,x", "tag:guest"}
+	for _, option := range invalid {
+		if err := validateDHCPOption(option); !errors.Is(err, ErrValidation) {
+			t.Errorf("validateDHCPOption(%q) = %v, want ErrValidation", option, err)
+		}
+	}
+}
+
+func TestSetDHCPTagWithReader(t *testing.T) {
+	mock := newMockDHCPConfigReader()
+	setupMockDHCPData(mock)
+
+	guest := &UCIDHCPTag{Name: "guest", DHCPOptions: []string{"3,10.41.8.1", "6,10.41.8.1"}}
+	if changed, err := SetDHCPTagWithReader(guest, mock); err != nil || !changed {
+		t.Fatalf("SetDHCPTagWithReader() = %v, %v, want true, nil", changed, err)
+	}
+	if changed, err := SetDHCPTagWithReader(&UCIDHCPTag{Name: "guest", DHCPOptions: []string{"6,10.41.8.1", "3,10.41.8.1"}}, mock); err != nil || changed {
+		t.Errorf("SetDHCPTagWithReader(same options) = %v, %v, want false, nil", changed, err)
+	}
+
+	got, err := GetDHCPTagWithReader("guest", mock)
+	if err != nil {
+		t.Fatalf("GetDHCPTagWithReader() error = %v", err)
+	}
+	if !slices.Equal(got.DHCPOptions, guest.DHCPOptions) {
+		t.Errorf("DHCPOptions = %v, want %v", got.DHCPOptions, guest.DHCPOptions)
+	}
+	if tags, err := ListDHCPTagsWithReader(mock); err != nil || len(tags) != 1 || tags[0].Name != "guest" {
+		t.Errorf("ListDHCPTagsWithReader() = %+v, %v", tags, err)
+	}
+
+	invalid := []*UCIDHCPTag{
+		nil,
+		{},
+		{Name: "guest-net"},
+		{Name: "guest", DHCPOptions: []string{"router"}},
+	}
+	for _, tag := range invalid {
+		if _, err := SetDHCPTagWithReader(tag, mock); !errors.Is(err, ErrValidation) {
+			t.Errorf("SetDHCPTagWithReader(%+v) error = %v, want ErrValidation", tag, err)
+		}
+	}
+
+	if deleted, err := DeleteDHCPTagWithReader("guest", mock); err != nil || !deleted {
+		t.Fatalf("DeleteDHCPTagWithReader() = %v, %v, want true, nil", deleted, err)
+	}
+	if _, err := GetDHCPTagWithReader("guest", mock); !errors.Is(err, ErrSectionNotFound) {
+		t.Errorf("GetDHCPTagWithReader() after delete error = %v, want ErrSectionNotFound", err)
+	}
+	if deleted, err := DeleteDHCPTagWithReader("guest", mock); err != nil || deleted {
+		t.Errorf("DeleteDHCPTagWithReader() again = %v, %v, want false, nil", deleted, err)
+	}
+}
+
+func TestDHCPOptionListWithReader(t *testing.T) {
+	mock := newMockDHCPConfigReader()
+	setupMockDHCPData(mock)
+
+	if changed, err := SetDHCPConfigWithReader("lan", &UCIDHCP{DHCPOptions: []string{"3,192.168.1.1"}}, mock); err != nil || !changed {
+		t.Fatalf("SetDHCPConfigWithReader() = %v, %v, want true, nil", changed, err)
+	}
+	if changed, err := AddDHCPOptionWithReader("lan", "6,192.168.1.1", mock); err != nil || !changed {
+		t.Errorf("AddDHCPOptionWithReader() = %v, %v, want true, nil", changed, err)
+	}
+	if changed, err := AddDHCPOptionWithReader("lan", "6,192.168.1.1", mock); err != nil || changed {
+		t.Errorf("AddDHCPOptionWithReader(listed) = %v, %v, want false, nil", changed, err)
+	}
+
+	config, _ := GetDHCPConfigWithReader("lan", mock)
+	if want := []string{"3,192.168.1.1", "6,192.168.1.1"}; !slices.Equal(config.DHCPOptions, want) {
+		t.Errorf("DHCPOptions = %v, want %v", config.DHCPOptions, want)
+	}
+
+	if changed, err := RemoveDHCPOptionWithReader("lan", "3,192.168.1.1", mock); err != nil || !changed {
+		t.Errorf("RemoveDHCPOptionWithReader() = %v, %v, want true, nil", changed, err)
+	}
+	if changed, err := RemoveDHCPOptionWithReader("lan", "6,192.168.1.1", mock); err != nil || !changed {
+		t.Errorf("RemoveDHCPOptionWithReader(last) = %v, %v, want true, nil", changed, err)
+	}
+	if _, ok := mock.Get("dhcp", "lan", "dhcp_option"); ok {
+		t.Error("Expected dhcp_option removed with its last entry")
+	}
+	if changed, err := RemoveDHCPOptionWithReader("lan", "6,192.168.1.1", mock); err != nil || changed {
+		t.Errorf("RemoveDHCPOptionWithReader(unlisted) = %v, %v, want false, nil", changed, err)
+	}
+
+	if _, err := AddDHCPOptionWithReader("lan", "gateway", mock); !errors.Is(err, ErrValidation) {
+		t.Errorf("AddDHCPOptionWithReader(invalid) error = %v, want ErrValidation", err)
+	}
+}
+
+func TestAddDHCPHostWithReader_Tag(t *testing.T) {
+	mock := newMockDHCPConfigReader()
+	setupMockDHCPData(mock)
+
+	if _, err := AddDHCPHostWithReader(&UCIDHCPHost{MAC: "02:00:00:00:00:01", IP: "10.41.2.20", Tag: "cameras"}, mock); err != nil {
+		t.Fatalf("AddDHCPHostWithReader() error = %v", err)
+	}
+	host, err := GetDHCPHostWithReader("02:00:00:00:00:01", mock)
+	if err != nil || host.Tag != "cameras" {
+		t.Errorf("GetDHCPHostWithReader() = %+v, %v, want tag cameras", host, err)
+	}
+
+	if _, err := AddDHCPHostWithReader(&UCIDHCPHost{MAC: "02:00:00:00:00:02", IP: "10.41.2.21", Tag: "no tags"}, mock); !errors.Is(err, ErrValidation) {
+		t.Errorf("AddDHCPHostWithReader(invalid tag) error = %v, want ErrValidation", err)
+	}
+}
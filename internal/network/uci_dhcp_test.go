@@ -3,8 +3,12 @@ package network
 import (
 	"errors"
 	"fmt"
+	"net"
+	"reflect"
+	"slices"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/digineo/go-uci/v2"
 	"github.com/openmanet/go-alfred"
@@ -15,6 +19,7 @@ import (
 type mockDHCPConfigReader struct {
 	data     map[string]map[string]map[string][]string // config -> section -> option -> values
 	sections map[string]map[string]string              // config -> section -> type
+	order    map[string][]string                       // config -> sections in the order added
 }
 
 // Commit is a no-op for the mock, simulating a successful commit.
@@ -31,9 +36,20 @@ func newMockDHCPConfigReader() *mockDHCPConfigReader {
 	return &mockDHCPConfigReader{
 		data:     make(map[string]map[string]map[string][]string),
 		sections: make(map[string]map[string]string),
+		order:    make(map[string][]string),
 	}
 }
 
+func (m *mockDHCPConfigReader) GetSections(config, secType string) ([]string, error) {
+	var names []string
+	for _, section := range m.order[config] {
+		if m.sections[config][section] == secType {
+			names = append(names, section)
+		}
+	}
+	return names, nil
+}
+
 func (m *mockDHCPConfigReader) Get(config, section, option string) ([]string, bool) {
 	if m.data[config] == nil {
 		return nil, false
@@ -67,6 +83,9 @@ func (m *mockDHCPConfigReader) AddSection(config, section, typ string) error {
 	if m.sections[config] == nil {
 		m.sections[config] = make(map[string]string)
 	}
+	if _, exists := m.sections[config][section]; !exists {
+		m.order[config] = append(m.order[config], section)
+	}
 	m.sections[config][section] = typ
 	if m.data[config] == nil {
 		m.data[config] = make(map[string]map[string][]string)
@@ -84,6 +103,7 @@ func (m *mockDHCPConfigReader) DelSection(config, section string) error {
 	if m.sections[config] != nil {
 		delete(m.sections[config], section)
 	}
+	m.order[config] = slices.DeleteFunc(m.order[config], func(s string) bool { return s == section })
 	return nil
 }
 
@@ -151,6 +171,282 @@ func TestGetDnsmasqConfigWithReader(t *testing.T) {
 	}
 }
 
+// setupMockMultiInstanceData initializes the mock with two anonymous dnsmasq
+// instances, the second a guest resolver, and a pool attached to each.
+func setupMockMultiInstanceData(m *mockDHCPConfigReader) {
+	_ = m.AddSection("dhcp", "@dnsmasq[0]", "dnsmasq")
+	_ = m.SetType("dhcp", "@dnsmasq[0]", "domain", uci.TypeOption, "mesh")
+	_ = m.SetType("dhcp", "@dnsmasq[0]", "localuse", uci.TypeOption, "1")
+	_ = m.AddSection("dhcp", "lan", "dhcp")
+	_ = m.SetType("dhcp", "lan", "interface", uci.TypeOption, "lan")
+	_ = m.AddSection("dhcp", "guest_dns", "dnsmasq")
+	_ = m.SetType("dhcp", "guest_dns", "domain", uci.TypeOption, "guest")
+	_ = m.SetType("dhcp", "guest_dns", "localuse", uci.TypeOption, "0")
+	_ = m.AddSection("dhcp", "guest", "dhcp")
+	_ = m.SetType("dhcp", "guest", "interface", uci.TypeOption, "guest")
+	_ = m.SetType("dhcp", "guest", "instance", uci.TypeOption, "guest_dns")
+}
+
+func TestListDnsmasqInstances(t *testing.T) {
+	mock := newMockDHCPConfigReader()
+	setupMockMultiInstanceData(mock)
+
+	instances, err := ListDnsmasqInstances(mock)
+	if err != nil {
+		t.Fatalf("ListDnsmasqInstances failed: %v", err)
+	}
+	if want := []string{"@dnsmasq[0]", "guest_dns"}; !slices.Equal(instances, want) {
+		t.Errorf("Expected instances %v, got %v", want, instances)
+	}
+
+	if _, err := ListDnsmasqInstances(&mockDHCPConfigReaderWithErrors{}); err == nil {
+		t.Error("Expected an error when the sections cannot be listed")
+	}
+}
+
+func TestGetDnsmasqConfigWithReader_FallsBackToFirstInstance(t *testing.T) {
+	mock := newMockDHCPConfigReader()
+	setupMockMultiInstanceData(mock)
+
+	config, err := GetDnsmasqConfigWithReader(mock)
+	if err != nil {
+		t.Fatalf("GetDnsmasqConfigWithReader failed: %v", err)
+	}
+	if config.Name != "@dnsmasq[0]" || config.Domain != "mesh" || config.LocalUse != "1" {
+		t.Errorf("Expected the first instance, got %+v", config)
+	}
+
+	// The canonical section wins over earlier instances once it exists
+	_ = mock.AddSection("dhcp", "dnsmasq", "dnsmasq")
+	_ = mock.SetType("dhcp", "dnsmasq", "domain", uci.TypeOption, "lan")
+
+	config, err = GetDnsmasqConfigWithReader(mock)
+	if err != nil {
+		t.Fatalf("GetDnsmasqConfigWithReader failed: %v", err)
+	}
+	if config.Name != "dnsmasq" || config.Domain != "lan" {
+		t.Errorf("Expected the canonical instance, got %+v", config)
+	}
+}
+
+func TestGetDnsmasqConfigForInstance(t *testing.T) {
+	mock := newMockDHCPConfigReader()
+	setupMockMultiInstanceData(mock)
+
+	config, err := GetDnsmasqConfigForInstance("guest_dns", mock)
+	if err != nil {
+		t.Fatalf("GetDnsmasqConfigForInstance(guest_dns) failed: %v", err)
+	}
+	if config.Domain != "guest" || config.LocalUse != "0" {
+		t.Errorf("Expected the guest instance, got %+v", config)
+	}
+
+	config, err = GetDnsmasqConfigForInstance("", mock)
+	if err != nil {
+		t.Fatalf("GetDnsmasqConfigForInstance(\"\") failed: %v", err)
+	}
+	if config.Domain != "mesh" {
+		t.Errorf("Expected the main instance for an empty name, got %+v", config)
+	}
+
+	if _, err := GetDnsmasqConfigForInstance("missing", mock); !errors.Is(err, ErrSectionNotFound) {
+		t.Errorf("Expected ErrSectionNotFound for a missing instance, got %v", err)
+	}
+}
+
+func TestSetDnsmasqConfigWithReader(t *testing.T) {
+	t.Run("main_instance", func(t *testing.T) {
+		mock := newMockDHCPConfigReader()
+		setupMockMultiInstanceData(mock)
+
+		changed, err := SetDnsmasqConfigWithReader(&UCIDnsmasq{Domain: "mesh", Local: "/mesh/", CacheSize: "500"}, mock)
+		if err != nil || !changed {
+			t.Fatalf("SetDnsmasqConfigWithReader() = %v, %v, want true, nil", changed, err)
+		}
+
+		config, _ := GetDnsmasqConfigWithReader(mock)
+		if config.Name != "@dnsmasq[0]" || config.Local != "/mesh/" || config.CacheSize != "500" || config.LocalUse != "1" {
+			t.Errorf("Expected the main instance updated and other options kept, got %+v", config)
+		}
+
+		changed, err = SetDnsmasqConfigWithReader(&UCIDnsmasq{Domain: "mesh", CacheSize: "500"}, mock)
+		if err != nil || changed {
+			t.Errorf("SetDnsmasqConfigWithReader() unchanged = %v, %v, want false, nil", changed, err)
+		}
+	})
+
+	t.Run("named_instance", func(t *testing.T) {
+		mock := newMockDHCPConfigReader()
+		setupMockMultiInstanceData(mock)
+
+		if _, err := SetDnsmasqConfigWithReader(&UCIDnsmasq{Name: "guest_dns", Authoritative: "1"}, mock); err != nil {
+			t.Fatalf("SetDnsmasqConfigWithReader(guest_dns) failed: %v", err)
+		}
+		config, _ := GetDnsmasqConfigForInstance("guest_dns", mock)
+		if config.Authoritative != "1" || config.Domain != "guest" {
+			t.Errorf("Expected the guest instance updated, got %+v", config)
+		}
+	})
+
+	t.Run("adds_missing_instance", func(t *testing.T) {
+		mock := newMockDHCPConfigReader()
+		setupMockMultiInstanceData(mock)
+
+		if _, err := SetDnsmasqConfigWithReader(&UCIDnsmasq{Name: "iot_dns", Domain: "iot"}, mock); err != nil {
+			t.Fatalf("SetDnsmasqConfigWithReader(iot_dns) failed: %v", err)
+		}
+		config, err := GetDnsmasqConfigForInstance("iot_dns", mock)
+		if err != nil || config.Domain != "iot" {
+			t.Errorf("Expected the new instance, got %+v, %v", config, err)
+		}
+	})
+
+	t.Run("missing_anonymous_instance", func(t *testing.T) {
+		mock := newMockDHCPConfigReader()
+		setupMockMultiInstanceData(mock)
+
+		if _, err := SetDnsmasqConfigWithReader(&UCIDnsmasq{Name: "@dnsmasq[5]", Domain: "x"}, mock); !errors.Is(err, ErrSectionNotFound) {
+			t.Errorf("Expected ErrSectionNotFound, got %v", err)
+		}
+	})
+
+	if _, err := SetDnsmasqConfigWithReader(nil, newMockDHCPConfigReader()); !errors.Is(err, ErrValidation) {
+		t.Errorf("Expected ErrValidation for a nil config, got %v", err)
+	}
+}
+
+func TestSetDnsmasqOptionsWithReader(t *testing.T) {
+	mock := newMockDHCPConfigReader()
+	setupMockMultiInstanceData(mock)
+
+	steps := []struct {
+		name string
+		set  func() (bool, error)
+	}{
+		{"domain", func() (bool, error) { return SetDnsmasqDomainWithReader("", "manet", mock) }},
+		{"local", func() (bool, error) { return SetDnsmasqLocalWithReader("", "/manet/", mock) }},
+		{"cachesize", func() (bool, error) { return SetDnsmasqCacheSizeWithReader("", 0, mock) }},
+		{"authoritative", func() (bool, error) { return SetDnsmasqAuthoritativeWithReader("", true, mock) }},
+	}
+	for _, step := range steps {
+		if changed, err := step.set(); err != nil || !changed {
+			t.Errorf("set %s = %v, %v, want true, nil", step.name, changed, err)
+		}
+		if changed, err := step.set(); err != nil || changed {
+			t.Errorf("set %s again = %v, %v, want false, nil", step.name, changed, err)
+		}
+	}
+
+	config, _ := GetDnsmasqConfigWithReader(mock)
+	want := UCIDnsmasq{Name: "@dnsmasq[0]", Domain: "manet", Local: "/manet/", CacheSize: "0", Authoritative: "1", LocalUse: "1"}
+	if !reflect.DeepEqual(*config, want) {
+		t.Errorf("config = %+v, want %+v", *config, want)
+	}
+
+	if changed, err := SetDnsmasqAuthoritativeWithReader("guest_dns", false, mock); err != nil || !changed {
+		t.Errorf("SetDnsmasqAuthoritativeWithReader(guest_dns) = %v, %v, want true, nil", changed, err)
+	}
+	if guest, _ := GetDnsmasqConfigForInstance("guest_dns", mock); guest.Authoritative != "0" {
+		t.Errorf("Expected the guest instance non-authoritative, got %+v", guest)
+	}
+
+	invalid := []struct {
+		name string
+		set  func() (bool, error)
+		want error
+	}{
+		{"empty_domain", func() (bool, error) { return SetDnsmasqDomainWithReader("", "", mock) }, ErrValidation},
+		{"slashed_domain", func() (bool, error) { return SetDnsmasqDomainWithReader("", "/mesh/", mock) }, ErrValidation},
+		{"bare_local", func() (bool, error) { return SetDnsmasqLocalWithReader("", "mesh", mock) }, ErrValidation},
+		{"negative_cachesize", func() (bool, error) { return SetDnsmasqCacheSizeWithReader("", -1, mock) }, ErrValidation},
+		{"missing_instance", func() (bool, error) { return SetDnsmasqDomainWithReader("missing", "mesh", mock) }, ErrSectionNotFound},
+	}
+	for _, tt := range invalid {
+		if _, err := tt.set(); !errors.Is(err, tt.want) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestDnsmasqServersWithReader(t *testing.T) {
+	mock := newMockDHCPConfigReader()
+	setupMockMultiInstanceData(mock)
+
+	if changed, err := ReplaceDnsmasqServersWithReader("", []string{"1.1.1.1", "9.9.9.9#53"}, mock); err != nil || !changed {
+		t.Fatalf("ReplaceDnsmasqServersWithReader() = %v, %v, want true, nil", changed, err)
+	}
+	if changed, err := AddDnsmasqServerWithReader("", "/mesh/10.41.0.1", mock); err != nil || !changed {
+		t.Errorf("AddDnsmasqServerWithReader() = %v, %v, want true, nil", changed, err)
+	}
+	if changed, err := AddDnsmasqServerWithReader("", "1.1.1.1", mock); err != nil || changed {
+		t.Errorf("AddDnsmasqServerWithReader(listed) = %v, %v, want false, nil", changed, err)
+	}
+	if changed, err := RemoveDnsmasqServerWithReader("", "9.9.9.9#53", mock); err != nil || !changed {
+		t.Errorf("RemoveDnsmasqServerWithReader() = %v, %v, want true, nil", changed, err)
+	}
+	if changed, err := RemoveDnsmasqServerWithReader("", "9.9.9.9#53", mock); err != nil || changed {
+		t.Errorf("RemoveDnsmasqServerWithReader(unlisted) = %v, %v, want false, nil", changed, err)
+	}
+
+	config, _ := GetDnsmasqConfigWithReader(mock)
+	if want := []string{"1.1.1.1", "/mesh/10.41.0.1"}; !slices.Equal(config.Servers, want) {
+		t.Errorf("Servers = %v, want %v", config.Servers, want)
+	}
+	if guest, _ := GetDnsmasqConfigForInstance("guest_dns", mock); len(guest.Servers) != 0 {
+		t.Errorf("Expected the guest instance untouched, got servers %v", guest.Servers)
+	}
+
+	if changed, err := ReplaceDnsmasqServersWithReader("", nil, mock); err != nil || !changed {
+		t.Errorf("ReplaceDnsmasqServersWithReader(nil) = %v, %v, want true, nil", changed, err)
+	}
+	if _, ok := mock.Get("dhcp", "@dnsmasq[0]", "server"); ok {
+		t.Error("Expected the server option removed when the list is emptied")
+	}
+
+	for _, server := range []string{"", "resolver", "1.1.1.1#0", "1.1.1.1#dns", "/", "/mesh/resolver"} {
+		if _, err := AddDnsmasqServerWithReader("", server, mock); !errors.Is(err, ErrValidation) {
+			t.Errorf("AddDnsmasqServerWithReader(%q) error = %v, want ErrValidation", server, err)
+		}
+	}
+	for _, server := range []string{"/mesh/", "/a/b/fd00::1", "10.0.0.1@eth0", "10.0.0.1#5353@10.0.0.2"} {
+		if err := validateDnsmasqServer(server); err != nil {
+			t.Errorf("validateDnsmasqServer(%q) = %v, want nil", server, err)
+		}
+	}
+	if _, err := ReplaceDnsmasqServersWithReader("missing", []string{"1.1.1.1"}, mock); !errors.Is(err, ErrSectionNotFound) {
+		t.Errorf("missing instance: error = %v, want ErrSectionNotFound", err)
+	}
+}
+
+func TestSetDHCPConfigWithReader_Instance(t *testing.T) {
+	mock := newMockDHCPConfigReader()
+	setupMockMultiInstanceData(mock)
+
+	guest, err := GetDHCPConfigWithReader("guest", mock)
+	if err != nil {
+		t.Fatalf("GetDHCPConfigWithReader(guest) failed: %v", err)
+	}
+	if guest.Instance != "guest_dns" {
+		t.Errorf("Expected Instance=guest_dns, got %q", guest.Instance)
+	}
+
+	changed, err := SetDHCPConfigWithReader("ahwlan", &UCIDHCP{Interface: "ahwlan", Start: "100", Limit: "16", Instance: "guest_dns"}, mock)
+	if err != nil || !changed {
+		t.Fatalf("SetDHCPConfigWithReader = %v, %v; want true, nil", changed, err)
+	}
+	if values, _ := mock.Get("dhcp", "ahwlan", "instance"); !slices.Equal(values, []string{"guest_dns"}) {
+		t.Errorf("Expected option instance guest_dns, got %v", values)
+	}
+
+	// Pools of the main instance get no instance option
+	if _, err := SetDHCPConfigWithReader("lan", &UCIDHCP{Interface: "lan"}, mock); err != nil {
+		t.Fatalf("SetDHCPConfigWithReader(lan) failed: %v", err)
+	}
+	if _, exists := mock.Get("dhcp", "lan", "instance"); exists {
+		t.Error("Expected no instance option on the lan pool")
+	}
+}
+
 func TestGetDHCPConfigWithReader(t *testing.T) {
 	mock := newMockDHCPConfigReader()
 	setupMockDHCPData(mock)
@@ -216,7 +512,7 @@ func TestSetDHCPConfigWithReader(t *testing.T) {
 		Force:     "1",
 	}
 
-	err := SetDHCPConfigWithReader("guest", config, mock)
+	_, err := SetDHCPConfigWithReader("guest", config, mock)
 	if err != nil {
 		t.Fatalf("SetDHCPConfigWithReader failed: %v", err)
 	}
@@ -247,12 +543,81 @@ func TestSetDHCPConfigWithReader(t *testing.T) {
 func TestSetDHCPConfigWithReader_NilConfig(t *testing.T) {
 	mock := newMockDHCPConfigReader()
 
-	err := SetDHCPConfigWithReader("test", nil, mock)
+	_, err := SetDHCPConfigWithReader("test", nil, mock)
 	if err == nil {
 		t.Error("Expected error for nil config, got nil")
 	}
 }
 
+func TestSetDHCPConfigWithReader_Unchanged(t *testing.T) {
+	reader := &mockConfigReader{
+		data: map[string]map[string]map[string][]string{
+			"dhcp": {
+				"ahwlan": {
+					"interface": {"ahwlan"},
+					"start":     {"100"},
+					"limit":     {"150"},
+					"leasetime": {"12h"},
+					"force":     {"1"},
+				},
+			},
+		},
+	}
+
+	changed, err := SetDHCPConfigWithReader("ahwlan", &UCIDHCP{
+		Interface: "ahwlan",
+		Start:     "100",
+		Limit:     "150",
+		LeaseTime: "12h",
+		Force:     "1",
+	}, reader)
+	if err != nil {
+		t.Fatalf("SetDHCPConfigWithReader failed: %v", err)
+	}
+	if changed {
+		t.Error("Expected changed=false for an already-correct config")
+	}
+	if len(reader.setTypeCalls) != 0 {
+		t.Errorf("Expected no SetType calls, got %+v", reader.setTypeCalls)
+	}
+	if reader.commitCalled {
+		t.Error("Expected Commit not to be called")
+	}
+}
+
+func TestSetDHCPConfigWithReader_PartiallyChanged(t *testing.T) {
+	reader := &mockConfigReader{
+		data: map[string]map[string]map[string][]string{
+			"dhcp": {
+				"ahwlan": {
+					"interface": {"ahwlan"},
+					"start":     {"100"},
+					"limit":     {"150"},
+				},
+			},
+		},
+	}
+
+	changed, err := SetDHCPConfigWithReader("ahwlan", &UCIDHCP{
+		Interface: "ahwlan",
+		Start:     "120",
+		Limit:     "150",
+		LeaseTime: "12h",
+	}, reader)
+	if err != nil {
+		t.Fatalf("SetDHCPConfigWithReader failed: %v", err)
+	}
+	if !changed {
+		t.Error("Expected changed=true")
+	}
+	if !reader.commitCalled {
+		t.Error("Expected Commit to be called")
+	}
+	if len(reader.setTypeCalls) != 2 || reader.setTypeCalls[0].option != "start" || reader.setTypeCalls[1].option != "leasetime" {
+		t.Errorf("Expected only start and leasetime to be written, got %+v", reader.setTypeCalls)
+	}
+}
+
 func TestDeleteDHCPConfigWithReader(t *testing.T) {
 	mock := newMockDHCPConfigReader()
 	setupMockDHCPData(mock)
@@ -399,7 +764,7 @@ func TestSetDHCPRangeWithReader(t *testing.T) {
 	mock := newMockDHCPConfigReader()
 	_ = mock.AddSection("dhcp", "test", "dhcp")
 
-	err := SetDHCPRangeWithReader("test", "200", "50", mock)
+	_, err := SetDHCPRangeWithReader("test", "200", "50", mock)
 	if err != nil {
 		t.Fatalf("SetDHCPRangeWithReader failed: %v", err)
 	}
@@ -418,7 +783,7 @@ func TestSetDHCPRangeWithReader(t *testing.T) {
 func TestSetDHCPRangeWithReader_InvalidStart(t *testing.T) {
 	mock := newMockDHCPConfigReader()
 
-	err := SetDHCPRangeWithReader("test", "invalid", "50", mock)
+	_, err := SetDHCPRangeWithReader("test", "invalid", "50", mock)
 	if err == nil {
 		t.Error("Expected error for invalid start value")
 	}
@@ -427,7 +792,7 @@ func TestSetDHCPRangeWithReader_InvalidStart(t *testing.T) {
 func TestSetDHCPRangeWithReader_InvalidLimit(t *testing.T) {
 	mock := newMockDHCPConfigReader()
 
-	err := SetDHCPRangeWithReader("test", "100", "invalid", mock)
+	_, err := SetDHCPRangeWithReader("test", "100", "invalid", mock)
 	if err == nil {
 		t.Error("Expected error for invalid limit value")
 	}
@@ -448,6 +813,74 @@ func TestSetDHCPLeaseTimeWithReader(t *testing.T) {
 	}
 }
 
+func TestGetRAModeWithReader(t *testing.T) {
+	mock := newMockDHCPConfigReader()
+	setupMockDHCPData(mock)
+
+	mode, err := GetRAModeWithReader("lan", mock)
+	if err != nil {
+		t.Fatalf("GetRAModeWithReader failed: %v", err)
+	}
+	if mode != "server" {
+		t.Errorf("Expected ra=server, got %q", mode)
+	}
+
+	mode, _ = GetRAModeWithReader("wan", mock)
+	if mode != "" {
+		t.Errorf("Expected no ra mode for wan, got %q", mode)
+	}
+}
+
+func TestSetRADefaultWithReader(t *testing.T) {
+	mock := newMockDHCPConfigReader()
+	setupMockDHCPData(mock)
+
+	steps := []struct {
+		name        string
+		enable      bool
+		wantChanged bool
+		wantOption  bool
+	}{
+		{"already a gateway", true, false, true},
+		{"demoted", false, true, false},
+		{"still a client", false, false, false},
+		{"promoted", true, true, true},
+	}
+
+	for _, step := range steps {
+		changed, err := SetRADefaultWithReader("lan", step.enable, mock)
+		if err != nil {
+			t.Fatalf("%s: SetRADefaultWithReader failed: %v", step.name, err)
+		}
+		if changed != step.wantChanged {
+			t.Errorf("%s: changed = %v, want %v", step.name, changed, step.wantChanged)
+		}
+
+		values, ok := mock.Get("dhcp", "lan", "ra_default")
+		if ok != step.wantOption {
+			t.Errorf("%s: ra_default present = %v (%v), want %v", step.name, ok, values, step.wantOption)
+		}
+		if ok && (len(values) != 1 || values[0] != "1") {
+			t.Errorf("%s: Expected ra_default=1, got %v", step.name, values)
+		}
+	}
+}
+
+func TestSetRADefaultWithReader_ReplacesZero(t *testing.T) {
+	mock := newMockDHCPConfigReader()
+	_ = mock.AddSection("dhcp", "test", "dhcp")
+	_ = mock.SetType("dhcp", "test", "ra_default", uci.TypeOption, "0")
+
+	// An explicit 0 is removed on demotion rather than left in place
+	changed, err := SetRADefaultWithReader("test", false, mock)
+	if err != nil || !changed {
+		t.Fatalf("SetRADefaultWithReader = %v, %v; want a change", changed, err)
+	}
+	if _, ok := mock.Get("dhcp", "test", "ra_default"); ok {
+		t.Error("Expected ra_default to be removed")
+	}
+}
+
 // mockDHCPConfigReaderWithErrors is a mock that returns errors for testing error paths.
 type mockDHCPConfigReaderWithErrors struct{}
 
@@ -461,6 +894,10 @@ func (m *mockDHCPConfigReaderWithErrors) ReloadConfig() error {
 	return errors.New("mock error")
 }
 
+func (m *mockDHCPConfigReaderWithErrors) GetSections(config, secType string) ([]string, error) {
+	return nil, errors.New("mock error")
+}
+
 func (m *mockDHCPConfigReaderWithErrors) Get(config, section, option string) ([]string, bool) {
 	return nil, false
 }
@@ -488,7 +925,7 @@ func TestSetDHCPConfigWithReader_ErrorHandling(t *testing.T) {
 		Interface: "test",
 	}
 
-	err := SetDHCPConfigWithReader("test", config, mock)
+	_, err := SetDHCPConfigWithReader("test", config, mock)
 	if err == nil {
 		t.Error("Expected error from SetDHCPConfigWithReader")
 	}
@@ -538,12 +975,20 @@ func TestDisableDHCPWithReader_ErrorHandling(t *testing.T) {
 func TestSetDHCPRangeWithReader_ErrorHandling(t *testing.T) {
 	mock := &mockDHCPConfigReaderWithErrors{}
 
-	err := SetDHCPRangeWithReader("test", "100", "50", mock)
+	_, err := SetDHCPRangeWithReader("test", "100", "50", mock)
 	if err == nil {
 		t.Error("Expected error from SetDHCPRangeWithReader")
 	}
 }
 
+func TestSetRADefaultWithReader_ErrorHandling(t *testing.T) {
+	mock := &mockDHCPConfigReaderWithErrors{}
+
+	if _, err := SetRADefaultWithReader("test", true, mock); err == nil {
+		t.Error("Expected error from SetRADefaultWithReader")
+	}
+}
+
 func TestSetDHCPLeaseTimeWithReader_ErrorHandling(t *testing.T) {
 	mock := &mockDHCPConfigReaderWithErrors{}
 
@@ -553,6 +998,187 @@ func TestSetDHCPLeaseTimeWithReader_ErrorHandling(t *testing.T) {
 	}
 }
 
+func setupMockDHCPHosts(m *mockDHCPConfigReader) {
+	_ = m.AddSection("dhcp", "cfg01fe3c", "host")
+	_ = m.SetType("dhcp", "cfg01fe3c", "mac", uci.TypeOption, "02:00:00:00:00:01 02:00:00:00:00:02")
+	_ = m.SetType("dhcp", "cfg01fe3c", "ip", uci.TypeOption, "10.41.1.10")
+	_ = m.SetType("dhcp", "cfg01fe3c", "name", uci.TypeOption, "node1")
+	_ = m.AddSection("dhcp", "host_020000000003", "host")
+	_ = m.SetType("dhcp", "host_020000000003", "mac", uci.TypeOption, "02:00:00:00:00:03")
+	_ = m.SetType("dhcp", "host_020000000003", "ip", uci.TypeOption, "10.41.1.11")
+	_ = m.SetType("dhcp", "host_020000000003", "leasetime", uci.TypeOption, "infinite")
+}
+
+func TestListDHCPHostsWithReader(t *testing.T) {
+	mock := newMockDHCPConfigReader()
+	setupMockDHCPData(mock)
+	setupMockDHCPHosts(mock)
+
+	hosts, err := ListDHCPHostsWithReader(mock)
+	if err != nil {
+		t.Fatalf("ListDHCPHostsWithReader() error = %v", err)
+	}
+
+	want := []UCIDHCPHost{
+		{Section: "cfg01fe3c", MAC: "02:00:00:00:00:01 02:00:00:00:00:02", IP: "10.41.1.10", Name: "node1"},
+		{Section: "host_020000000003", MAC: "02:00:00:00:00:03", IP: "10.41.1.11", LeaseTime: "infinite"},
+	}
+	if !slices.Equal(hosts, want) {
+		t.Errorf("ListDHCPHostsWithReader() = %+v, want %+v", hosts, want)
+	}
+}
+
+func TestGetDHCPHostWithReader(t *testing.T) {
+	mock := newMockDHCPConfigReader()
+	setupMockDHCPHosts(mock)
+
+	tests := []struct {
+		name        string
+		mac         string
+		wantSection string
+		wantErr     error
+	}{
+		{name: "own_section", mac: "02:00:00:00:00:03", wantSection: "host_020000000003"},
+		{name: "second_of_several", mac: "02:00:00:00:00:02", wantSection: "cfg01fe3c"},
+		{name: "first_of_several", mac: "02:00:00:00:00:01", wantSection: "cfg01fe3c"},
+		{name: "hyphenated", mac: "02-00-00-00-00-03", wantSection: "host_020000000003"},
+		{name: "unknown", mac: "02:00:00:00:00:09", wantErr: ErrSectionNotFound},
+		{name: "invalid", mac: "node1", wantErr: ErrValidation},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host, err := GetDHCPHostWithReader(tt.mac, mock)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("GetDHCPHostWithReader(%q) error = %v, want %v", tt.mac, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetDHCPHostWithReader(%q) error = %v", tt.mac, err)
+			}
+			if host.Section != tt.wantSection {
+				t.Errorf("GetDHCPHostWithReader(%q).Section = %q, want %q", tt.mac, host.Section, tt.wantSection)
+			}
+		})
+	}
+}
+
+func TestAddDHCPHostWithReader(t *testing.T) {
+	t.Run("new_host", func(t *testing.T) {
+		mock := newMockDHCPConfigReader()
+		setupMockDHCPHosts(mock)
+
+		changed, err := AddDHCPHostWithReader(&UCIDHCPHost{MAC: "02:00:00:00:00:0A", IP: "10.41.1.12", Name: "node4"}, mock)
+		if err != nil || !changed {
+			t.Fatalf("AddDHCPHostWithReader() = %v, %v, want true, nil", changed, err)
+		}
+
+		host, err := GetDHCPHostWithReader("02:00:00:00:00:0a", mock)
+		if err != nil {
+			t.Fatalf("GetDHCPHostWithReader() error = %v", err)
+		}
+		want := UCIDHCPHost{Section: "host_02000000000a", MAC: "02:00:00:00:00:0a", IP: "10.41.1.12", Name: "node4"}
+		if *host != want {
+			t.Errorf("host = %+v, want %+v", *host, want)
+		}
+	})
+
+	t.Run("updates_in_place", func(t *testing.T) {
+		mock := newMockDHCPConfigReader()
+		setupMockDHCPHosts(mock)
+
+		changed, err := AddDHCPHostWithReader(&UCIDHCPHost{MAC: "02:00:00:00:00:02", IP: "10.41.1.20"}, mock)
+		if err != nil || !changed {
+			t.Fatalf("AddDHCPHostWithReader() = %v, %v, want true, nil", changed, err)
+		}
+
+		hosts, _ := ListDHCPHostsWithReader(mock)
+		if len(hosts) != 2 {
+			t.Fatalf("hosts = %+v, want the two existing sections", hosts)
+		}
+		want := UCIDHCPHost{Section: "cfg01fe3c", MAC: "02:00:00:00:00:01 02:00:00:00:00:02", IP: "10.41.1.20", Name: "node1"}
+		if hosts[0] != want {
+			t.Errorf("host = %+v, want %+v", hosts[0], want)
+		}
+	})
+
+	t.Run("unchanged", func(t *testing.T) {
+		mock := newMockDHCPConfigReader()
+		setupMockDHCPHosts(mock)
+
+		changed, err := AddDHCPHostWithReader(&UCIDHCPHost{MAC: "02:00:00:00:00:03", IP: "10.41.1.11"}, mock)
+		if err != nil || changed {
+			t.Errorf("AddDHCPHostWithReader() = %v, %v, want false, nil", changed, err)
+		}
+	})
+
+	t.Run("address_taken", func(t *testing.T) {
+		mock := newMockDHCPConfigReader()
+		setupMockDHCPHosts(mock)
+
+		_, err := AddDHCPHostWithReader(&UCIDHCPHost{MAC: "02:00:00:00:00:03", IP: "10.41.1.10"}, mock)
+		if !errors.Is(err, ErrValidation) {
+			t.Errorf("AddDHCPHostWithReader() error = %v, want ErrValidation", err)
+		}
+	})
+
+	invalid := []*UCIDHCPHost{
+		nil,
+		{MAC: "node1", IP: "10.41.1.12"},
+		{MAC: "02:00:00:00:00:0a", IP: "node1"},
+		{MAC: "02:00:00:00:00:0a", IP: "fd00::1"},
+	}
+	for _, host := range invalid {
+		if _, err := AddDHCPHostWithReader(host, newMockDHCPConfigReader()); !errors.Is(err, ErrValidation) {
+			t.Errorf("AddDHCPHostWithReader(%+v) error = %v, want ErrValidation", host, err)
+		}
+	}
+}
+
+func TestDeleteDHCPHostWithReader(t *testing.T) {
+	mock := newMockDHCPConfigReader()
+	setupMockDHCPHosts(mock)
+
+	if deleted, err := DeleteDHCPHostWithReader("02:00:00:00:00:03", mock); err != nil || !deleted {
+		t.Fatalf("DeleteDHCPHostWithReader() = %v, %v, want true, nil", deleted, err)
+	}
+	if _, err := GetDHCPHostWithReader("02:00:00:00:00:03", mock); !errors.Is(err, ErrSectionNotFound) {
+		t.Errorf("GetDHCPHostWithReader() after delete error = %v, want ErrSectionNotFound", err)
+	}
+
+	// A section listing several addresses keeps the others.
+	if deleted, err := DeleteDHCPHostWithReader("02:00:00:00:00:01", mock); err != nil || !deleted {
+		t.Fatalf("DeleteDHCPHostWithReader() = %v, %v, want true, nil", deleted, err)
+	}
+	host, err := GetDHCPHostWithReader("02:00:00:00:00:02", mock)
+	if err != nil {
+		t.Fatalf("GetDHCPHostWithReader() error = %v", err)
+	}
+	if host.MAC != "02:00:00:00:00:02" || host.IP != "10.41.1.10" {
+		t.Errorf("host = %+v, want the remaining address", *host)
+	}
+
+	if deleted, err := DeleteDHCPHostWithReader("02:00:00:00:00:09", mock); err != nil || deleted {
+		t.Errorf("DeleteDHCPHostWithReader(unknown) = %v, %v, want false, nil", deleted, err)
+	}
+}
+
+func TestDHCPHostWithReader_ErrorHandling(t *testing.T) {
+	mock := &mockDHCPConfigReaderWithErrors{}
+
+	if _, err := ListDHCPHostsWithReader(mock); err == nil {
+		t.Error("Expected error from ListDHCPHostsWithReader")
+	}
+	if _, err := AddDHCPHostWithReader(&UCIDHCPHost{MAC: "02:00:00:00:00:01", IP: "10.41.1.10"}, mock); err == nil {
+		t.Error("Expected error from AddDHCPHostWithReader")
+	}
+	if _, err := DeleteDHCPHostWithReader("02:00:00:00:00:01", mock); err == nil {
+		t.Error("Expected error from DeleteDHCPHostWithReader")
+	}
+}
+
 func TestCalculateAvailableDHCPStart(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -1035,3 +1661,68 @@ func mustMarshalAddressReservation(ar *proto.AddressReservation) []byte {
 	}
 	return data
 }
+
+func TestDHCPDefaultsConsistent(t *testing.T) {
+	ones, bits := net.IPMask(net.ParseIP(DefaultNetworkMask).To4()).Size()
+	hostSpace := (1 << uint(bits-ones)) - 2
+	poolEnd := DefaultDHCPStartOffset + DefaultDHCPAddressLimit - 1
+
+	if DefaultDHCPAddressLimit <= 0 || DefaultDHCPStartOffset <= 0 {
+		t.Fatalf("DefaultDHCPAddressLimit = %d, DefaultDHCPStartOffset = %d, want both positive", DefaultDHCPAddressLimit, DefaultDHCPStartOffset)
+	}
+	if poolEnd > hostSpace {
+		t.Errorf("default pool ends at offset %d, beyond the %d hosts of %s", poolEnd, hostSpace, DefaultNetworkMask)
+	}
+
+	// The first pool stays inside 10.41.0.0/24, which non-gateway static address
+	// selection never uses, and short of its broadcast address
+	if poolEnd >= 255 {
+		t.Errorf("default pool ends at offset %d, outside 10.41.0.0/24", poolEnd)
+	}
+
+	// With no peers the default offset is chosen
+	start, err := CalculateAvailableDHCPStart(nil, DefaultNetworkAddress, DefaultNetworkMask, DefaultDHCPAddressLimit)
+	if err != nil {
+		t.Fatalf("CalculateAvailableDHCPStart() error = %v", err)
+	}
+	if start != DefaultDHCPStartOffset {
+		t.Errorf("CalculateAvailableDHCPStart() = %d, want DefaultDHCPStartOffset", start)
+	}
+
+	if _, err := time.ParseDuration(DefaultDHCPLeaseTime); err != nil {
+		t.Errorf("DefaultDHCPLeaseTime %q is not a valid lease time: %v", DefaultDHCPLeaseTime, err)
+	}
+}
+
+func TestGetAllDHCPConfigsWithReader(t *testing.T) {
+	reader := newMockDHCPConfigReader()
+	setupMockDHCPData(reader)
+	_ = reader.AddSection("dhcp", "stale", "dhcp")
+	_ = reader.SetType("dhcp", "stale", "interface", uci.TypeOption, "lan")
+	_ = reader.SetType("dhcp", "stale", "start", uci.TypeOption, "50")
+
+	pools, err := GetAllDHCPConfigsWithReader(reader)
+	if err != nil {
+		t.Fatalf("GetAllDHCPConfigsWithReader() error = %v", err)
+	}
+
+	names := make([]string, len(pools))
+	for i, pool := range pools {
+		names[i] = pool.Name
+	}
+	if want := []string{"lan", "wan", "ahwlan", "stale"}; !slices.Equal(names, want) {
+		t.Fatalf("GetAllDHCPConfigsWithReader() = %v, want %v", names, want)
+	}
+	if stale := pools[len(pools)-1]; stale.Interface != "lan" || stale.Start != "50" {
+		t.Errorf("stale pool = %+v", stale)
+	}
+
+	conflicts := ConflictingDHCPPools(pools, "lan", "lan")
+	if len(conflicts) != 1 || conflicts[0].Name != "stale" {
+		t.Errorf("ConflictingDHCPPools(lan) = %+v, want the stale pool", conflicts)
+	}
+	pools[len(pools)-1].Ignore = "1"
+	if conflicts := ConflictingDHCPPools(pools, "lan", "lan"); len(conflicts) != 0 {
+		t.Errorf("ConflictingDHCPPools(lan) = %+v, want an ignored pool left out", conflicts)
+	}
+}
@@ -0,0 +1,90 @@
+package network
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestSetDHCPConfigWithReader_IPv6(t *testing.T) {
+	mock := newMockDHCPConfigReader()
+	setupMockDHCPData(mock)
+
+	changed, err := SetDHCPConfigWithReader("lan", &UCIDHCP{
+		DHCPv6:         "server",
+		RaFlags:        []string{RAFlagManaged, RAFlagOther},
+		NDP:            "relay",
+		DNS:            []string{"fd00::1"},
+		DHCPv6PD:       "1",
+		DHCPv6PDMinLen: "62",
+	}, mock)
+	if err != nil || !changed {
+		t.Fatalf("SetDHCPConfigWithReader() = %v, %v, want true, nil", changed, err)
+	}
+
+	got, err := GetDHCPConfigWithReader("lan", mock)
+	if err != nil {
+		t.Fatalf("GetDHCPConfigWithReader() error = %v", err)
+	}
+	if got.DHCPv6 != "server" || got.NDP != "relay" || got.DHCPv6PD != "1" || got.DHCPv6PDMinLen != "62" ||
+		!slices.Equal(got.RaFlags, []string{RAFlagManaged, RAFlagOther}) || !slices.Equal(got.DNS, []string{"fd00::1"}) {
+		t.Errorf("GetDHCPConfigWithReader() = %+v", got)
+	}
+	if got.Start != "100" {
+		t.Errorf("Start = %q, want the existing value kept", got.Start)
+	}
+
+	// The flags are a set, so the same flags in another order change nothing.
+	changed, err = SetDHCPConfigWithReader("lan", &UCIDHCP{RaFlags: []string{RAFlagOther, RAFlagManaged}}, mock)
+	if err != nil || changed {
+		t.Errorf("SetDHCPConfigWithReader(same flags) = %v, %v, want false, nil", changed, err)
+	}
+
+	invalid := []*UCIDHCP{
+		{DHCPv6: "stateful"},
+		{NDP: "server"},
+		{RaFlags: []string{"managed"}},
+		{DNS: []string{"10.0.0.1"}},
+		{DHCPv6PD: "yes"},
+		{DHCPv6PDMinLen: "65"},
+	}
+	for _, config := range invalid {
+		if _, err := SetDHCPConfigWithReader("lan", config, mock); !errors.Is(err, ErrValidation) {
+			t.Errorf("SetDHCPConfigWithReader(%+v) error = %v, want ErrValidation", config, err)
+		}
+	}
+}
+
+func TestStatefulDHCPv6WithReader(t *testing.T) {
+	mock := newMockDHCPConfigReader()
+	setupMockDHCPData(mock)
+
+	if enabled, err := IsStatefulDHCPv6EnabledWithReader("lan", mock); err != nil || enabled {
+		t.Fatalf("IsStatefulDHCPv6EnabledWithReader() = %v, %v, want false, nil", enabled, err)
+	}
+
+	if changed, err := EnableStatefulDHCPv6WithReader("lan", mock); err != nil || !changed {
+		t.Fatalf("EnableStatefulDHCPv6WithReader() = %v, %v, want true, nil", changed, err)
+	}
+	if enabled, err := IsStatefulDHCPv6EnabledWithReader("lan", mock); err != nil || !enabled {
+		t.Errorf("IsStatefulDHCPv6EnabledWithReader() after enable = %v, %v, want true, nil", enabled, err)
+	}
+	if changed, err := EnableStatefulDHCPv6WithReader("lan", mock); err != nil || changed {
+		t.Errorf("EnableStatefulDHCPv6WithReader() again = %v, %v, want false, nil", changed, err)
+	}
+
+	if changed, err := DisableStatefulDHCPv6WithReader("lan", mock); err != nil || !changed {
+		t.Fatalf("DisableStatefulDHCPv6WithReader() = %v, %v, want true, nil", changed, err)
+	}
+	got, _ := GetDHCPConfigWithReader("lan", mock)
+	if got.DHCPv6 != "server" || !slices.Equal(got.RaFlags, []string{RAFlagOther}) {
+		t.Errorf("after disable: dhcpv6 = %q, ra_flags = %v, want server and [other-config]", got.DHCPv6, got.RaFlags)
+	}
+	if enabled, err := IsStatefulDHCPv6EnabledWithReader("lan", mock); err != nil || enabled {
+		t.Errorf("IsStatefulDHCPv6EnabledWithReader() after disable = %v, %v, want false, nil", enabled, err)
+	}
+
+	if _, err := EnableStatefulDHCPv6WithReader("guest", mock); !errors.Is(err, ErrSectionNotFound) {
+		t.Errorf("missing section: error = %v, want ErrSectionNotFound", err)
+	}
+}
@@ -0,0 +1,199 @@
+package network
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// ConfigExportVersion is the version of the ConfigExport format written by
+// ExportConfig. ImportConfig refuses other versions.
+const ConfigExportVersion = 1
+
+// ConfigExport is the UCI configuration openmanetd manages on a node: the network
+// interface and DHCP pool of the mesh section, the static leases, the DHCP tags and
+// the openmanetd section. ExportConfig serializes it to JSON and ImportConfig applies it, to back
+// a node up or to clone it to a replacement device.
+type ConfigExport struct {
+	Version int `json:"version"`
+	// Section is the UCI section of the mesh interface in the network and dhcp
+	// configs, e.g. "ahwlan".
+	Section   string        `json:"section"`
+	Network   *UCINetwork   `json:"network"`
+	DHCP      *UCIDHCP      `json:"dhcp,omitempty"`
+	Hosts     []UCIDHCPHost `json:"hosts,omitempty"`
+	Tags      []UCIDHCPTag  `json:"tags,omitempty"`
+	OpenMANET *UCIOpenMANET `json:"openmanetd,omitempty"`
+}
+
+// ConfigReaders are the readers ExportConfigWithReaders and ImportConfigWithReaders
+// work through.
+type ConfigReaders struct {
+	Network   ConfigReader
+	DHCP      DHCPConfigReader
+	OpenMANET OpenMANETConfigReader
+}
+
+// defaultConfigReaders returns readers on the default tree.
+func defaultConfigReaders() ConfigReaders {
+	return ConfigReaders{
+		Network:   NewUCINetworkConfigReader(),
+		DHCP:      NewUCIDHCPConfigReader(),
+		OpenMANET: NewUCIOpenMANETConfigReader(),
+	}
+}
+
+// ExportConfig serializes the configuration openmanetd manages for the mesh
+// section, e.g. "ahwlan", to JSON.
+//
+// Returns an ErrSectionNotFound error if there is no network interface section of
+// that name.
+//
+// Example:
+//
+//	blob, err := ExportConfig("ahwlan")
+//	if err != nil {
+//	    log.Fatalf("Failed to export config: %v", err)
+//	}
+//	os.WriteFile("node.json", blob, 0o600)
+func ExportConfig(section string) ([]byte, error) {
+	return ExportConfigWithReaders(section, defaultConfigReaders())
+}
+
+// ExportConfigWithReaders serializes the managed configuration using the provided
+// readers.
+func ExportConfigWithReaders(section string, readers ConfigReaders) ([]byte, error) {
+	if !NetworkSectionExistsWithReader(section, readers.Network) {
+		return nil, fmt.Errorf("%w: network interface %q", ErrSectionNotFound, section)
+	}
+
+	export := ConfigExport{Version: ConfigExportVersion, Section: section}
+
+	var err error
+	if export.Network, err = GetUCINetworkByNameWithReader(section, readers.Network); err != nil {
+		return nil, err
+	}
+	if DHCPSectionExistsWithReader(section, readers.DHCP) {
+		if export.DHCP, err = GetDHCPConfigWithReader(section, readers.DHCP); err != nil {
+			return nil, err
+		}
+	}
+	if export.Hosts, err = ListDHCPHostsWithReader(readers.DHCP); err != nil {
+		return nil, err
+	}
+	if export.Tags, err = ListDHCPTagsWithReader(readers.DHCP); err != nil {
+		return nil, err
+	}
+	if export.OpenMANET, err = GetOpenMANETConfigWithReader(readers.OpenMANET); err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode config export: %w", err)
+	}
+	return data, nil
+}
+
+// ImportConfig applies a configuration serialized by ExportConfig. Sections that do
+// not exist are created, options the export leaves empty are left as they are, and
+// static leases and tags are added alongside the existing ones.
+//
+// Every change is staged before anything is committed, so an export that cannot be
+// applied changes nothing. Each config is then committed once.
+//
+// Returns true if anything changed. Returns an ErrValidation error if data is not
+// an export of a supported version.
+//
+// Note: This operation requires appropriate privileges and commits the
+// configuration. The network must be reloaded, or the node rebooted, for it to take
+// effect.
+func ImportConfig(data []byte) (bool, error) {
+	return ImportConfigWithReaders(data, defaultConfigReaders())
+}
+
+// ImportConfigWithReaders applies a serialized configuration using the provided
+// readers.
+func ImportConfigWithReaders(data []byte, readers ConfigReaders) (bool, error) {
+	export, err := decodeConfigExport(data)
+	if err != nil {
+		return false, err
+	}
+
+	txs := []*Transaction{
+		NewTransaction(networkConfigName, readers.Network),
+		NewTransaction(dhcpConfigName, readers.DHCP),
+		NewTransaction(openmanetdConfigName, readers.OpenMANET),
+	}
+	if err := stageConfigExport(export, txs[0], txs[1], txs[2]); err != nil {
+		for _, tx := range txs {
+			_ = tx.Discard()
+		}
+		return false, err
+	}
+
+	changed := false
+	for _, tx := range txs {
+		applied, err := tx.Apply()
+		if err != nil {
+			return changed, err
+		}
+		changed = changed || applied
+	}
+
+	return changed, nil
+}
+
+// decodeConfigExport decodes and checks a serialized ConfigExport.
+func decodeConfigExport(data []byte) (*ConfigExport, error) {
+	var export ConfigExport
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&export); err != nil {
+		return nil, newValidationError("invalid config export: %v", err)
+	}
+
+	switch {
+	case export.Version != ConfigExportVersion:
+		return nil, newValidationError("unsupported config export version %d, want %d", export.Version, ConfigExportVersion)
+	case export.Section == "":
+		return nil, newValidationError("config export has no section")
+	case export.Network == nil:
+		return nil, newValidationError("config export has no network interface")
+	}
+
+	return &export, nil
+}
+
+// stageConfigExport stages export through the network, dhcp and openmanetd
+// transactions.
+func stageConfigExport(export *ConfigExport, netTx, dhcpTx, omTx *Transaction) error {
+	if _, err := SetNetworkConfigWithReader(export.Section, export.Network, netTx); err != nil {
+		return err
+	}
+
+	if export.DHCP != nil {
+		if _, err := SetDHCPConfigWithReader(export.Section, export.DHCP, dhcpTx); err != nil {
+			return err
+		}
+	}
+	for i := range export.Tags {
+		if _, err := SetDHCPTagWithReader(&export.Tags[i], dhcpTx); err != nil {
+			return err
+		}
+	}
+	for i := range export.Hosts {
+		if _, err := AddDHCPHostWithReader(&export.Hosts[i], dhcpTx); err != nil {
+			return err
+		}
+	}
+
+	if export.OpenMANET != nil {
+		if _, err := SetOpenMANETConfigWithReader(export.OpenMANET, omTx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
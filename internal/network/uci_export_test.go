@@ -0,0 +1,189 @@
+package network
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/digineo/go-uci/v2"
+)
+
+const (
+	exportNetworkConfig = `
+config interface 'ahwlan'
+	option proto 'static'
+	option ipaddr '10.41.2.10'
+	option netmask '255.255.0.0'
+	option device 'br-ahwlan'
+	list ip6class 'local'
+`
+	exportDHCPConfig = `
+config dnsmasq
+	option domain 'lan'
+
+config dhcp 'ahwlan'
+	option interface 'ahwlan'
+	option start '300'
+	option limit '16'
+	option leasetime '12h'
+	option force '1'
+	list dhcp_option '6,10.41.2.10'
+
+config tag 'cameras'
+	list dhcp_option '3,10.41.2.1'
+	list dhcp_option '42,10.41.2.1'
+
+config host 'host_020000000001'
+	option mac '02:00:00:00:00:01'
+	option ip '10.41.2.20'
+	option name 'camera'
+	option tag 'cameras'
+`
+	exportOpenMANETConfig = `
+config openmanet 'config'
+	option dhcpconfigured '1'
+	option pinned_ip '10.41.2.10'
+`
+)
+
+// newExportFixture writes the given network, dhcp and openmanetd configs to a
+// temporary UCI directory and returns readers on it.
+func newExportFixture(t *testing.T, networkCfg, dhcpCfg, openmanetCfg string) (string, ConfigReaders) {
+	t.Helper()
+
+	dir := writeTestConfigs(t, map[string]string{"network": networkCfg, "dhcp": dhcpCfg, "openmanetd": openmanetCfg})
+	tree := uci.NewTree(dir)
+	return dir, ConfigReaders{
+		Network:   NewUCINetworkConfigReaderWithTree(tree),
+		DHCP:      NewUCIDHCPConfigReaderWithTree(tree),
+		OpenMANET: NewUCIOpenMANETConfigReaderWithTree(tree),
+	}
+}
+
+func TestExportConfigWithReaders(t *testing.T) {
+	_, readers := newExportFixture(t, exportNetworkConfig, exportDHCPConfig, exportOpenMANETConfig)
+
+	data, err := ExportConfigWithReaders("ahwlan", readers)
+	if err != nil {
+		t.Fatalf("ExportConfigWithReaders() error = %v", err)
+	}
+
+	var export ConfigExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if export.Version != ConfigExportVersion || export.Section != "ahwlan" {
+		t.Errorf("export header = %d %q", export.Version, export.Section)
+	}
+	if export.Network.IPAddr != "10.41.2.10" || export.Network.IPV6Class != "local" {
+		t.Errorf("export network = %+v", export.Network)
+	}
+	if export.DHCP == nil || export.DHCP.Start != "300" || export.DHCP.Force != "1" {
+		t.Errorf("export dhcp = %+v", export.DHCP)
+	}
+	if len(export.Hosts) != 1 || export.Hosts[0].Name != "camera" || export.Hosts[0].Tag != "cameras" {
+		t.Errorf("export hosts = %+v", export.Hosts)
+	}
+	if len(export.Tags) != 1 || export.Tags[0].Name != "cameras" || len(export.Tags[0].DHCPOptions) != 2 {
+		t.Errorf("export tags = %+v", export.Tags)
+	}
+	if export.OpenMANET == nil || export.OpenMANET.PinnedIP != "10.41.2.10" {
+		t.Errorf("export openmanetd = %+v", export.OpenMANET)
+	}
+
+	// Options are keyed by their UCI names
+	if !strings.Contains(string(data), `"ipaddr": "10.41.2.10"`) {
+		t.Errorf("export does not use UCI option names:\n%s", data)
+	}
+
+	if _, err := ExportConfigWithReaders("missing", readers); !errors.Is(err, ErrSectionNotFound) {
+		t.Errorf("ExportConfigWithReaders(missing) error = %v, want ErrSectionNotFound", err)
+	}
+}
+
+func TestImportConfigWithReaders_Clone(t *testing.T) {
+	_, source := newExportFixture(t, exportNetworkConfig, exportDHCPConfig, exportOpenMANETConfig)
+	data, err := ExportConfigWithReaders("ahwlan", source)
+	if err != nil {
+		t.Fatalf("ExportConfigWithReaders() error = %v", err)
+	}
+
+	// A replacement device fresh from flashing
+	dir, target := newExportFixture(t, "\nconfig interface 'lan'\n\toption proto 'static'\n", "\nconfig dnsmasq\n", "")
+
+	changed, err := ImportConfigWithReaders(data, target)
+	if err != nil || !changed {
+		t.Fatalf("ImportConfigWithReaders() = %v, %v, want true, nil", changed, err)
+	}
+
+	tree := uci.NewTree(dir)
+	fresh := ConfigReaders{
+		Network:   NewUCINetworkConfigReaderWithTree(tree),
+		DHCP:      NewUCIDHCPConfigReaderWithTree(tree),
+		OpenMANET: NewUCIOpenMANETConfigReaderWithTree(tree),
+	}
+	cloned, err := ExportConfigWithReaders("ahwlan", fresh)
+	if err != nil {
+		t.Fatalf("ExportConfigWithReaders() of the clone error = %v", err)
+	}
+	if string(cloned) != string(data) {
+		t.Errorf("clone exports\n%s\nwant\n%s", cloned, data)
+	}
+	if lan, _ := GetUCINetworkByNameWithReader("lan", fresh.Network); lan.Proto != "static" {
+		t.Errorf("Expected unrelated sections kept, lan = %+v", lan)
+	}
+
+	// Importing the same export again changes nothing
+	if changed, err := ImportConfigWithReaders(data, fresh); err != nil || changed {
+		t.Errorf("second ImportConfigWithReaders() = %v, %v, want false, nil", changed, err)
+	}
+}
+
+func TestImportConfigWithReaders_FailureChangesNothing(t *testing.T) {
+	_, source := newExportFixture(t, exportNetworkConfig, exportDHCPConfig, exportOpenMANETConfig)
+	data, err := ExportConfigWithReaders("ahwlan", source)
+	if err != nil {
+		t.Fatalf("ExportConfigWithReaders() error = %v", err)
+	}
+
+	// The target leases the static address of the export to another client
+	targetDHCP := "\nconfig host 'other'\n\toption mac '02:00:00:00:00:09'\n\toption ip '10.41.2.20'\n"
+	dir, target := newExportFixture(t, "\nconfig interface 'lan'\n\toption proto 'static'\n", targetDHCP, "")
+
+	if _, err := ImportConfigWithReaders(data, target); !errors.Is(err, ErrValidation) {
+		t.Fatalf("ImportConfigWithReaders() error = %v, want ErrValidation", err)
+	}
+
+	if got, _ := os.ReadFile(filepath.Join(dir, "network")); strings.Contains(string(got), "ahwlan") {
+		t.Errorf("network was written by a failed import:\n%s", got)
+	}
+	if NetworkSectionExistsWithReader("ahwlan", target.Network) {
+		t.Error("Expected the staged network section discarded")
+	}
+}
+
+func TestImportConfigWithReaders_Invalid(t *testing.T) {
+	_, readers := newExportFixture(t, "", "", "")
+
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"not_json", "network"},
+		{"unknown_field", `{"version":1,"section":"ahwlan","network":{},"firewall":{}}`},
+		{"version", `{"version":2,"section":"ahwlan","network":{}}`},
+		{"no_section", `{"version":1,"network":{}}`},
+		{"no_network", `{"version":1,"section":"ahwlan"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ImportConfigWithReaders([]byte(tt.data), readers); !errors.Is(err, ErrValidation) {
+				t.Errorf("ImportConfigWithReaders() error = %v, want ErrValidation", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package network
+
+import (
+	"fmt"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/digineo/go-uci/v2"
+	"github.com/openmanet/openmanetd/internal/safemode"
+)
+
+const (
+	firewallConfigName string = "firewall"
+)
+
+// FirewallConfigReader defines an interface for reading firewall UCI configuration values.
+// Zones are anonymous sections, so they are looked up by type with GetSections.
+type FirewallConfigReader interface {
+	GetSections(config, secType string) ([]string, error)
+	Get(config, section, option string) ([]string, bool)
+	SetType(config, section, option string, typ uci.OptionType, values ...string) error
+	AddSection(config, section, typ string) error
+	DelSection(config, section string) error
+	Commit() error
+	ReloadConfig() error
+}
+
+// UCIFirewallConfigReader wraps the UCI functions for firewall configuration.
+type UCIFirewallConfigReader struct {
+	tree uci.Tree
+	changeLog
+}
+
+// NewUCIFirewallConfigReader creates a new UCI firewall config reader with the default tree.
+func NewUCIFirewallConfigReader() *UCIFirewallConfigReader {
+	return NewUCIFirewallConfigReaderWithTree(uci.NewTree(uci.DefaultTreePath))
+}
+
+// NewUCIFirewallConfigReaderWithTree creates a UCI firewall config reader on tree, so that
+// several readers can share one tree or read a tree outside the default path.
+func NewUCIFirewallConfigReaderWithTree(tree uci.Tree) *UCIFirewallConfigReader {
+	return &UCIFirewallConfigReader{
+		tree: tree,
+	}
+}
+
+func (r *UCIFirewallConfigReader) GetSections(config, secType string) ([]string, error) {
+	return r.tree.GetSections(config, secType)
+}
+
+func (r *UCIFirewallConfigReader) Get(config, section, option string) ([]string, bool) {
+	return r.get(r.tree, config, section, option)
+}
+
+func (r *UCIFirewallConfigReader) SetType(config, section, option string, typ uci.OptionType, values ...string) error {
+	if err := safemode.Check(fmt.Sprintf("uci set %s.%s.%s", config, section, option)); err != nil {
+		return err
+	}
+	return r.setType(r.tree, config, section, option, typ, values...)
+}
+
+func (r *UCIFirewallConfigReader) AddSection(config, section, typ string) error {
+	if err := safemode.Check(fmt.Sprintf("uci add %s.%s", config, section)); err != nil {
+		return err
+	}
+	return r.addSection(r.tree, config, section, typ)
+}
+
+func (r *UCIFirewallConfigReader) DelSection(config, section string) error {
+	if err := safemode.Check(fmt.Sprintf("uci delete %s.%s", config, section)); err != nil {
+		return err
+	}
+	return r.delSection(r.tree, config, section)
+}
+
+// Commit commits the current configuration changes to UCI. Failures caused by a
+// read-only filesystem are reported as ErrReadOnlyFS.
+func (r *UCIFirewallConfigReader) Commit() error {
+	if err := safemode.Check("uci commit"); err != nil {
+		return err
+	}
+	return classifyCommitError(r.commit(r.tree))
+}
+
+func (r *UCIFirewallConfigReader) ReloadConfig() error {
+	if err := r.tree.LoadConfig(firewallConfigName, true); err != nil {
+		return err
+	}
+	r.reset(firewallConfigName)
+	return nil
+}
+
+// Revert discards the firewall changes staged since the last commit. The config is
+// read from disk again on next use.
+func (r *UCIFirewallConfigReader) Revert() {
+	r.tree.Revert(firewallConfigName)
+	r.reset(firewallConfigName)
+}
+
+// zoneNetworks returns the networks covered by a zone section. fw3 accepts the
+// network option both as a list and as a single space-separated option.
+func zoneNetworks(reader FirewallConfigReader, zone string) []string {
+	values, _ := reader.Get(firewallConfigName, zone, "network")
+
+	var networks []string
+	for _, value := range values {
+		networks = append(networks, strings.Fields(value)...)
+	}
+
+	return networks
+}
+
+// zoneName returns the name of a zone section, or "" if it has none.
+func zoneName(reader FirewallConfigReader, zone string) string {
+	values, ok := reader.Get(firewallConfigName, zone, "name")
+	if !ok || len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// VerifyZoneCoverage checks whether a network section is covered by a firewall zone.
+//
+// A network that is in no zone falls under the default policies, which on OpenWrt
+// reject input and forwarding, so DHCP replies and client traffic on it are dropped.
+// Only the network list of the zones is considered, not zones matching on devices
+// or subnets.
+//
+// Parameters:
+//   - section: The UCI network section name (e.g., "ahwlan")
+//
+// Returns:
+//   - true and the name of the first zone that lists the section, or false and ""
+//   - An error if the firewall configuration cannot be read
+//
+// Example:
+//
+//	covered, zone, err := VerifyZoneCoverage("ahwlan")
+//	if err == nil && !covered {
+//	    log.Printf("ahwlan is not in any firewall zone")
+//	}
+func VerifyZoneCoverage(section string) (bool, string, error) {
+	return VerifyZoneCoverageWithReader(section, NewUCIFirewallConfigReader())
+}
+
+// VerifyZoneCoverageWithReader checks zone coverage using the provided reader.
+func VerifyZoneCoverageWithReader(section string, reader FirewallConfigReader) (bool, string, error) {
+	zones, err := reader.GetSections(firewallConfigName, "zone")
+	if err != nil {
+		return false, "", fmt.Errorf("failed to read firewall zones: %w", err)
+	}
+
+	for _, zone := range zones {
+		if slices.Contains(zoneNetworks(reader, zone), section) {
+			return true, zoneName(reader, zone), nil
+		}
+	}
+
+	return false, "", nil
+}
+
+// AddNetworkToZone adds a network section to the network list of a firewall zone.
+// Nothing is written if the zone already lists the section.
+//
+// Parameters:
+//   - zone: The name of the zone (e.g., "lan"), as in its name option
+//   - section: The UCI network section name (e.g., "ahwlan")
+//
+// Returns true if the section was added and the configuration committed, and an
+// ErrSectionNotFound error if there is no zone of that name.
+//
+// Example:
+//
+//	added, err := AddNetworkToZone("lan", "ahwlan")
+//	if err == nil && added {
+//	    err = ReloadFirewall()
+//	}
+func AddNetworkToZone(zone, section string) (bool, error) {
+	return AddNetworkToZoneWithReader(zone, section, NewUCIFirewallConfigReader())
+}
+
+// AddNetworkToZoneWithReader adds a network section to a zone using the provided reader.
+func AddNetworkToZoneWithReader(zone, section string, reader FirewallConfigReader) (bool, error) {
+	zones, err := reader.GetSections(firewallConfigName, "zone")
+	if err != nil {
+		return false, fmt.Errorf("failed to read firewall zones: %w", err)
+	}
+
+	for _, z := range zones {
+		if zoneName(reader, z) != zone {
+			continue
+		}
+
+		networks := zoneNetworks(reader, z)
+		if slices.Contains(networks, section) {
+			return false, nil
+		}
+
+		// Written as a list, which also normalizes a space-separated option
+		if err := reader.SetType(firewallConfigName, z, "network", uci.TypeList, append(networks, section)...); err != nil {
+			return false, newSetOptionError(firewallConfigName, z, "network", err)
+		}
+
+		if err := reader.Commit(); err != nil {
+			return false, newCommitError(firewallConfigName, err)
+		}
+
+		return true, nil
+	}
+
+	return false, fmt.Errorf("%w: firewall zone %q", ErrSectionNotFound, zone)
+}
+
+// ReloadFirewall reloads the firewall configuration using the firewall init script.
+//
+// Returns an ErrReloadFailed carrying the command output if the reload command fails
+// to execute or returns a non-zero exit code.
+func ReloadFirewall() error {
+	if err := safemode.Check("reload firewall"); err != nil {
+		return err
+	}
+
+	cmd := exec.Command("/etc/init.d/firewall", "reload")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return newReloadError("firewall", output, err)
+	}
+
+	return nil
+}
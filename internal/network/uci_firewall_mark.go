@@ -0,0 +1,121 @@
+package network
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/digineo/go-uci/v2"
+)
+
+// The guest mark rule is a UCI firewall rule rather than an nftables rule of our own,
+// so that it survives firewall reloads and shows up in LuCI next to the zones it
+// belongs to. fw4 turns a rule with target MARK into a mangle prerouting rule that
+// sets the mark on every packet from the source subnet.
+
+// guestMarkRuleName returns the name of the firewall rule section that marks the
+// traffic of a guest network section.
+func guestMarkRuleName(section string) string {
+	return "guest_mark_" + section
+}
+
+// EnsureGuestMarkRule makes sure traffic from a guest subnet is marked with the
+// batman-adv isolation mark, so clients of the guest network are isolated across the
+// mesh. The rule is a named firewall rule section; it is created if missing and only
+// the options that differ are written.
+//
+// Parameters:
+//   - section: The UCI network section of the guest network (e.g., "guest")
+//   - subnet: The subnet of the guest network in CIDR notation (e.g., "10.42.0.0/24")
+//   - mark: The mark value, e.g. 0x10
+//   - mask: The bits of the packet mark that are set, e.g. 0xf0
+//
+// Returns true if the rule was created or changed and the configuration committed,
+// and an ErrValidation error if the subnet is invalid or mark has bits outside mask.
+//
+// Example:
+//
+//	changed, err := EnsureGuestMarkRule("guest", "10.42.0.0/24", 0x10, 0xf0)
+//	if err == nil && changed {
+//	    err = ReloadFirewall()
+//	}
+func EnsureGuestMarkRule(section, subnet string, mark, mask uint32) (bool, error) {
+	return EnsureGuestMarkRuleWithReader(section, subnet, mark, mask, NewUCIFirewallConfigReader())
+}
+
+// EnsureGuestMarkRuleWithReader makes sure the guest mark rule exists using the
+// provided reader.
+func EnsureGuestMarkRuleWithReader(section, subnet string, mark, mask uint32, reader FirewallConfigReader) (bool, error) {
+	if _, _, err := net.ParseCIDR(subnet); err != nil {
+		return false, newValidationError("invalid guest subnet %q", subnet)
+	}
+	if mark&^mask != 0 {
+		return false, newValidationError("mark 0x%x does not fit within mask 0x%x", mark, mask)
+	}
+
+	name := guestMarkRuleName(section)
+	changed := false
+
+	if _, exists := reader.Get(firewallConfigName, name, "target"); !exists {
+		if err := reader.AddSection(firewallConfigName, name, "rule"); err != nil {
+			return false, newSectionError("add", firewallConfigName, name, err)
+		}
+		changed = true
+	}
+
+	set, err := setOptionsIfChanged(reader, firewallConfigName, name, []uciOption{
+		{name: "name", typ: uci.TypeOption, value: "Mark guest traffic of " + section},
+		{name: "src", typ: uci.TypeOption, value: "*"},
+		{name: "src_ip", typ: uci.TypeOption, value: subnet},
+		{name: "proto", typ: uci.TypeOption, value: "all"},
+		{name: "target", typ: uci.TypeOption, value: "MARK"},
+		{name: "set_mark", typ: uci.TypeOption, value: fmt.Sprintf("0x%x/0x%x", mark, mask)},
+	})
+	if err != nil {
+		return false, err
+	}
+	if !changed && !set {
+		return false, nil
+	}
+
+	if err := reader.Commit(); err != nil {
+		return false, newCommitError(firewallConfigName, err)
+	}
+
+	return true, nil
+}
+
+// RemoveGuestMarkRule removes the rule marking the traffic of a guest network
+// section. Nothing is written if there is no such rule.
+//
+// Parameters:
+//   - section: The UCI network section of the guest network (e.g., "guest")
+//
+// Returns true if the rule was removed and the configuration committed.
+//
+// Example:
+//
+//	removed, err := RemoveGuestMarkRule("guest")
+//	if err == nil && removed {
+//	    err = ReloadFirewall()
+//	}
+func RemoveGuestMarkRule(section string) (bool, error) {
+	return RemoveGuestMarkRuleWithReader(section, NewUCIFirewallConfigReader())
+}
+
+// RemoveGuestMarkRuleWithReader removes the guest mark rule using the provided reader.
+func RemoveGuestMarkRuleWithReader(section string, reader FirewallConfigReader) (bool, error) {
+	name := guestMarkRuleName(section)
+	if _, exists := reader.Get(firewallConfigName, name, "target"); !exists {
+		return false, nil
+	}
+
+	if err := reader.DelSection(firewallConfigName, name); err != nil {
+		return false, newSectionError("delete", firewallConfigName, name, err)
+	}
+
+	if err := reader.Commit(); err != nil {
+		return false, newCommitError(firewallConfigName, err)
+	}
+
+	return true, nil
+}
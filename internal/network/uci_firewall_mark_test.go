@@ -0,0 +1,95 @@
+package network
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/digineo/go-uci/v2"
+)
+
+func TestEnsureGuestMarkRuleWithReader(t *testing.T) {
+	dir := writeTestConfig(t, "firewall", testFirewallConfig)
+	reader := NewUCIFirewallConfigReaderWithTree(uci.NewTree(dir))
+
+	changed, err := EnsureGuestMarkRuleWithReader("guest", "10.42.0.0/24", 0x10, 0xf0, reader)
+	if err != nil {
+		t.Fatalf("EnsureGuestMarkRuleWithReader() error = %v", err)
+	}
+	if !changed {
+		t.Error("EnsureGuestMarkRuleWithReader() = false, want true")
+	}
+
+	// The rule is committed: a fresh tree sees it
+	fresh := &UCIFirewallConfigReader{tree: uci.NewTree(dir)}
+	for option, want := range map[string]string{
+		"src":      "*",
+		"src_ip":   "10.42.0.0/24",
+		"target":   "MARK",
+		"set_mark": "0x10/0xf0",
+	} {
+		if got, _ := fresh.Get("firewall", "guest_mark_guest", option); !reflect.DeepEqual(got, []string{want}) {
+			t.Errorf("%s = %v, want %q", option, got, want)
+		}
+	}
+
+	changed, err = EnsureGuestMarkRuleWithReader("guest", "10.42.0.0/24", 0x10, 0xf0, fresh)
+	if err != nil || changed {
+		t.Errorf("ensuring again = %v, %v; want false, nil", changed, err)
+	}
+
+	changed, err = EnsureGuestMarkRuleWithReader("guest", "10.42.1.0/24", 0x10, 0xf0, fresh)
+	if err != nil || !changed {
+		t.Errorf("ensuring a new subnet = %v, %v; want true, nil", changed, err)
+	}
+}
+
+func TestEnsureGuestMarkRuleWithReader_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		subnet string
+		mark   uint32
+		mask   uint32
+	}{
+		{"invalid subnet", "10.42.0.0", 0x10, 0xf0},
+		{"mark outside mask", "10.42.0.0/24", 0x11, 0xf0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := NewUCIFirewallConfigReaderWithTree(uci.NewTree(writeTestConfig(t, "firewall", testFirewallConfig)))
+
+			_, err := EnsureGuestMarkRuleWithReader("guest", tt.subnet, tt.mark, tt.mask, reader)
+			if !errors.Is(err, ErrValidation) {
+				t.Errorf("EnsureGuestMarkRuleWithReader() error = %v, want ErrValidation", err)
+			}
+			if _, exists := reader.Get("firewall", "guest_mark_guest", "target"); exists {
+				t.Error("EnsureGuestMarkRuleWithReader() created the rule")
+			}
+		})
+	}
+}
+
+func TestRemoveGuestMarkRuleWithReader(t *testing.T) {
+	dir := writeTestConfig(t, "firewall", testFirewallConfig)
+	reader := NewUCIFirewallConfigReaderWithTree(uci.NewTree(dir))
+
+	removed, err := RemoveGuestMarkRuleWithReader("guest", reader)
+	if err != nil || removed {
+		t.Errorf("removing a missing rule = %v, %v; want false, nil", removed, err)
+	}
+
+	if _, err := EnsureGuestMarkRuleWithReader("guest", "10.42.0.0/24", 0x10, 0xf0, reader); err != nil {
+		t.Fatalf("EnsureGuestMarkRuleWithReader() error = %v", err)
+	}
+
+	removed, err = RemoveGuestMarkRuleWithReader("guest", reader)
+	if err != nil || !removed {
+		t.Errorf("RemoveGuestMarkRuleWithReader() = %v, %v; want true, nil", removed, err)
+	}
+
+	fresh := &UCIFirewallConfigReader{tree: uci.NewTree(dir)}
+	if _, exists := fresh.Get("firewall", "guest_mark_guest", "target"); exists {
+		t.Error("rule still exists after removal")
+	}
+}
@@ -0,0 +1,103 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// EnableGatewayNAT gives the mesh zone access to the uplink of a gateway: traffic
+// from meshZone is forwarded to uplinkZone, which masquerades it and clamps its MSS.
+// The forwarding is added as a section named after the two zones unless one between
+// them exists already; DisableGatewayNAT only removes that section.
+//
+// Returns true if anything changed and the configuration was committed, an
+// ErrSectionNotFound error if either zone does not exist, and an ErrValidation error
+// if the zones are empty or the same.
+//
+// Example:
+//
+//	changed, err := EnableGatewayNAT("mesh", "wan")
+//	if err == nil && changed {
+//	    err = ReloadFirewall()
+//	}
+func EnableGatewayNAT(meshZone, uplinkZone string) (bool, error) {
+	return EnableGatewayNATWithReader(meshZone, uplinkZone, NewUCIFirewallConfigReader())
+}
+
+// EnableGatewayNATWithReader gives the mesh zone access to the uplink using the
+// provided reader.
+func EnableGatewayNATWithReader(meshZone, uplinkZone string, reader FirewallConfigReader) (bool, error) {
+	if err := validateGatewayNATZones(meshZone, uplinkZone); err != nil {
+		return false, err
+	}
+
+	section, err := findFirewallZone(reader, meshZone)
+	if err != nil {
+		return false, err
+	}
+	if section == "" {
+		return false, fmt.Errorf("%w: firewall zone %q", ErrSectionNotFound, meshZone)
+	}
+
+	masq, err := SetZoneMasqueradeWithReader(uplinkZone, true, reader)
+	if err != nil {
+		return false, err
+	}
+
+	forward, err := AddFirewallForwardingWithReader(meshZone, uplinkZone, reader)
+	if err != nil {
+		return masq, err
+	}
+
+	return masq || forward, nil
+}
+
+// DisableGatewayNAT undoes EnableGatewayNAT when a node stops being a gateway: the
+// forwarding from meshZone to uplinkZone that EnableGatewayNAT added is removed, and
+// masquerading of uplinkZone is turned off unless another zone still forwards to
+// it, as the LAN of a stock image does. A forwarding EnableGatewayNAT did not add is
+// left alone, and so is the masquerading that comes with it.
+//
+// Returns true if anything changed and the configuration was committed, false if
+// there was nothing to undo.
+func DisableGatewayNAT(meshZone, uplinkZone string) (bool, error) {
+	return DisableGatewayNATWithReader(meshZone, uplinkZone, NewUCIFirewallConfigReader())
+}
+
+// DisableGatewayNATWithReader undoes EnableGatewayNAT using the provided reader.
+func DisableGatewayNATWithReader(meshZone, uplinkZone string, reader FirewallConfigReader) (bool, error) {
+	if err := validateGatewayNATZones(meshZone, uplinkZone); err != nil {
+		return false, err
+	}
+
+	removed, err := deleteFirewallSection(reader, "forwarding", forwardingName(meshZone, uplinkZone))
+	if err != nil || !removed {
+		return false, err
+	}
+
+	forwardings, err := GetFirewallForwardingsWithReader(reader)
+	if err != nil {
+		return true, err
+	}
+	if slices.ContainsFunc(forwardings, func(f UCIFirewallForwarding) bool { return f.Dest == uplinkZone }) {
+		return true, nil
+	}
+
+	if _, err := SetZoneMasqueradeWithReader(uplinkZone, false, reader); err != nil && !errors.Is(err, ErrSectionNotFound) {
+		return true, err
+	}
+
+	return true, nil
+}
+
+// validateGatewayNATZones checks that the mesh and uplink zones are set and differ.
+func validateGatewayNATZones(meshZone, uplinkZone string) error {
+	if meshZone == "" || uplinkZone == "" {
+		return newValidationError("gateway NAT needs a mesh and an uplink zone")
+	}
+	if meshZone == uplinkZone {
+		return newValidationError("mesh zone and uplink zone cannot both be %q", meshZone)
+	}
+	return nil
+}
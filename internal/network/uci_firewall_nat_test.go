@@ -0,0 +1,100 @@
+package network
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestGatewayNATWithReader(t *testing.T) {
+	reader := newMockFirewallConfigReader()
+	if _, err := SetFirewallZoneWithReader(&UCIFirewallZone{Name: "mesh", Network: []string{"ahwlan"}}, reader); err != nil {
+		t.Fatalf("SetFirewallZoneWithReader() error = %v", err)
+	}
+
+	changed, err := EnableGatewayNATWithReader("mesh", "wan", reader)
+	if err != nil || !changed {
+		t.Fatalf("EnableGatewayNATWithReader() = %v, %v, want true, nil", changed, err)
+	}
+	if wan, _ := GetFirewallZoneWithReader("wan", reader); wan.Masq != "1" || wan.MTUFix != "1" {
+		t.Errorf("wan zone = %+v, want masq and mtu_fix on", wan)
+	}
+	want := []UCIFirewallForwarding{{Src: "lan", Dest: "wan"}, {Src: "mesh", Dest: "wan"}}
+	if got, _ := GetFirewallForwardingsWithReader(reader); !reflect.DeepEqual(got, want) {
+		t.Errorf("forwardings = %+v, want %+v", got, want)
+	}
+
+	commits := reader.commits
+	if changed, err := EnableGatewayNATWithReader("mesh", "wan", reader); err != nil || changed || reader.commits != commits {
+		t.Errorf("EnableGatewayNATWithReader() again = %v, %v with %d commits, want false, nil with %d", changed, err, reader.commits, commits)
+	}
+
+	// The lan zone still forwards to wan, so wan keeps masquerading
+	changed, err = DisableGatewayNATWithReader("mesh", "wan", reader)
+	if err != nil || !changed {
+		t.Fatalf("DisableGatewayNATWithReader() = %v, %v, want true, nil", changed, err)
+	}
+	if got, _ := GetFirewallForwardingsWithReader(reader); !reflect.DeepEqual(got, want[:1]) {
+		t.Errorf("forwardings after disable = %+v, want %+v", got, want[:1])
+	}
+	if wan, _ := GetFirewallZoneWithReader("wan", reader); wan.Masq != "1" {
+		t.Errorf("wan masq = %q after disable, want it kept for lan", wan.Masq)
+	}
+
+	if changed, err := DisableGatewayNATWithReader("mesh", "wan", reader); err != nil || changed {
+		t.Errorf("DisableGatewayNATWithReader() again = %v, %v, want false, nil", changed, err)
+	}
+
+	// A forwarding openmanetd did not add is left alone
+	if changed, err := DisableGatewayNATWithReader("lan", "wan", reader); err != nil || changed {
+		t.Errorf("DisableGatewayNATWithReader(lan) = %v, %v, want false, nil", changed, err)
+	}
+}
+
+func TestDisableGatewayNATWithReader_Masquerade(t *testing.T) {
+	reader := newMockFirewallConfigReader()
+	if err := reader.DelSection(firewallConfigName, "@forwarding[0]"); err != nil {
+		t.Fatalf("DelSection() error = %v", err)
+	}
+
+	if _, err := EnableGatewayNATWithReader("lan", "wan", reader); err != nil {
+		t.Fatalf("EnableGatewayNATWithReader() error = %v", err)
+	}
+	if changed, err := DisableGatewayNATWithReader("lan", "wan", reader); err != nil || !changed {
+		t.Fatalf("DisableGatewayNATWithReader() = %v, %v, want true, nil", changed, err)
+	}
+
+	if wan, _ := GetFirewallZoneWithReader("wan", reader); wan.Masq != "0" || wan.MTUFix != "0" {
+		t.Errorf("wan zone = %+v, want masq and mtu_fix off", wan)
+	}
+	if got, _ := GetFirewallForwardingsWithReader(reader); len(got) != 0 {
+		t.Errorf("forwardings = %+v, want none", got)
+	}
+}
+
+func TestEnableGatewayNATWithReader_Invalid(t *testing.T) {
+	tests := []struct {
+		name       string
+		meshZone   string
+		uplinkZone string
+		want       error
+	}{
+		{"no mesh zone", "", "wan", ErrValidation},
+		{"same zones", "wan", "wan", ErrValidation},
+		{"unknown mesh zone", "mesh", "wan", ErrSectionNotFound},
+		{"unknown uplink zone", "lan", "wwan", ErrSectionNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := newMockFirewallConfigReader()
+
+			if _, err := EnableGatewayNATWithReader(tt.meshZone, tt.uplinkZone, reader); !errors.Is(err, tt.want) {
+				t.Errorf("EnableGatewayNATWithReader() error = %v, want %v", err, tt.want)
+			}
+			if reader.commits != 0 {
+				t.Errorf("EnableGatewayNATWithReader() committed %d times, want 0", reader.commits)
+			}
+		})
+	}
+}
@@ -0,0 +1,548 @@
+package network
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/digineo/go-uci/v2"
+)
+
+// UCIFirewallZone represents a firewall zone section.
+type UCIFirewallZone struct {
+	Name    string   `uci:"option name"`
+	Network []string `uci:"list network"`
+	Input   string   `uci:"option input"`
+	Output  string   `uci:"option output"`
+	Forward string   `uci:"option forward"`
+	Masq    string   `uci:"option masq"`
+	MTUFix  string   `uci:"option mtu_fix"`
+}
+
+// UCIFirewallForwarding represents a firewall forwarding section, which allows
+// traffic from the zone Src to the zone Dest.
+type UCIFirewallForwarding struct {
+	Src  string `uci:"option src"`
+	Dest string `uci:"option dest"`
+}
+
+// UCIFirewallRule represents a firewall rule section.
+type UCIFirewallRule struct {
+	Name     string `uci:"option name"`
+	Src      string `uci:"option src"`
+	SrcIP    string `uci:"option src_ip"`
+	Dest     string `uci:"option dest"`
+	DestIP   string `uci:"option dest_ip"`
+	DestPort string `uci:"option dest_port"`
+	Proto    string `uci:"option proto"`
+	Family   string `uci:"option family"`
+	Target   string `uci:"option target"`
+	SetMark  string `uci:"option set_mark"`
+}
+
+// UCIFirewallRedirect represents a firewall redirect section, e.g. a port forward.
+type UCIFirewallRedirect struct {
+	Name     string `uci:"option name"`
+	Src      string `uci:"option src"`
+	SrcDPort string `uci:"option src_dport"`
+	Dest     string `uci:"option dest"`
+	DestIP   string `uci:"option dest_ip"`
+	DestPort string `uci:"option dest_port"`
+	Proto    string `uci:"option proto"`
+	Target   string `uci:"option target"`
+}
+
+// firewallOption returns the first value of an option of a firewall section, or ""
+// if it is not set.
+func firewallOption(reader FirewallConfigReader, section, option string) string {
+	values, ok := reader.Get(firewallConfigName, section, option)
+	if !ok || len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// firewallSectionExists reports whether the firewall config has a section of type
+// secType named section.
+func firewallSectionExists(reader FirewallConfigReader, secType, section string) (bool, error) {
+	sections, err := reader.GetSections(firewallConfigName, secType)
+	if err != nil {
+		return false, fmt.Errorf("failed to read firewall %s sections: %w", secType, err)
+	}
+	return slices.Contains(sections, section), nil
+}
+
+// setFirewallSection creates the section of type secType if it is missing, stages
+// the options that differ and commits.
+//
+// Returns true if anything was written.
+func setFirewallSection(reader FirewallConfigReader, secType, section string, options []uciOption) (bool, error) {
+	exists, err := firewallSectionExists(reader, secType, section)
+	if err != nil {
+		return false, err
+	}
+
+	if !exists {
+		if err := reader.AddSection(firewallConfigName, section, secType); err != nil {
+			return false, newSectionError("add", firewallConfigName, section, err)
+		}
+	}
+
+	set, err := setOptionsIfChanged(reader, firewallConfigName, section, options)
+	if err != nil {
+		return false, err
+	}
+	if exists && !set {
+		return false, nil
+	}
+
+	if err := reader.Commit(); err != nil {
+		return false, newCommitError(firewallConfigName, err)
+	}
+
+	return true, nil
+}
+
+// deleteFirewallSection deletes the section of type secType and commits. Nothing is
+// written if there is no such section.
+//
+// Returns true if the section was deleted.
+func deleteFirewallSection(reader FirewallConfigReader, secType, section string) (bool, error) {
+	exists, err := firewallSectionExists(reader, secType, section)
+	if err != nil || !exists {
+		return false, err
+	}
+
+	if err := reader.DelSection(firewallConfigName, section); err != nil {
+		return false, newSectionError("delete", firewallConfigName, section, err)
+	}
+
+	if err := reader.Commit(); err != nil {
+		return false, newCommitError(firewallConfigName, err)
+	}
+
+	return true, nil
+}
+
+// readFirewallZone reads the options of the zone section.
+func readFirewallZone(reader FirewallConfigReader, section string) UCIFirewallZone {
+	return UCIFirewallZone{
+		Name:    zoneName(reader, section),
+		Network: zoneNetworks(reader, section),
+		Input:   firewallOption(reader, section, "input"),
+		Output:  firewallOption(reader, section, "output"),
+		Forward: firewallOption(reader, section, "forward"),
+		Masq:    firewallOption(reader, section, "masq"),
+		MTUFix:  firewallOption(reader, section, "mtu_fix"),
+	}
+}
+
+// findFirewallZone returns the section of the zone named name, or "" if there is
+// none.
+func findFirewallZone(reader FirewallConfigReader, name string) (string, error) {
+	zones, err := reader.GetSections(firewallConfigName, "zone")
+	if err != nil {
+		return "", fmt.Errorf("failed to read firewall zones: %w", err)
+	}
+
+	for _, zone := range zones {
+		if zoneName(reader, zone) == name {
+			return zone, nil
+		}
+	}
+
+	return "", nil
+}
+
+// GetFirewallZones loads and returns the firewall zones in file order.
+func GetFirewallZones() ([]UCIFirewallZone, error) {
+	return GetFirewallZonesWithReader(NewUCIFirewallConfigReader())
+}
+
+// GetFirewallZonesWithReader loads and returns the firewall zones using the provided reader.
+func GetFirewallZonesWithReader(reader FirewallConfigReader) ([]UCIFirewallZone, error) {
+	sections, err := reader.GetSections(firewallConfigName, "zone")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read firewall zones: %w", err)
+	}
+
+	zones := make([]UCIFirewallZone, 0, len(sections))
+	for _, section := range sections {
+		zones = append(zones, readFirewallZone(reader, section))
+	}
+
+	return zones, nil
+}
+
+// GetFirewallZone loads and returns the firewall zone named name, as in its name
+// option.
+//
+// Returns an ErrSectionNotFound error if there is no zone of that name.
+//
+// Example:
+//
+//	zone, err := GetFirewallZone("wan")
+//	if err == nil && zone.Masq != "1" {
+//	    log.Printf("wan is not masqueraded")
+//	}
+func GetFirewallZone(name string) (*UCIFirewallZone, error) {
+	return GetFirewallZoneWithReader(name, NewUCIFirewallConfigReader())
+}
+
+// GetFirewallZoneWithReader loads and returns a firewall zone using the provided reader.
+func GetFirewallZoneWithReader(name string, reader FirewallConfigReader) (*UCIFirewallZone, error) {
+	section, err := findFirewallZone(reader, name)
+	if err != nil {
+		return nil, err
+	}
+	if section == "" {
+		return nil, fmt.Errorf("%w: firewall zone %q", ErrSectionNotFound, name)
+	}
+
+	zone := readFirewallZone(reader, section)
+	return &zone, nil
+}
+
+// SetFirewallZone creates or updates the firewall zone named zone.Name. An existing
+// zone is updated in place, whatever its section is called; a new zone gets a
+// section named after it. Empty fields are left as they are.
+//
+// Returns true if any option changed and the configuration was committed.
+//
+// Example:
+//
+//	changed, err := SetFirewallZone(&UCIFirewallZone{
+//	    Name:    "mesh",
+//	    Network: []string{"ahwlan"},
+//	    Input:   "ACCEPT",
+//	    Output:  "ACCEPT",
+//	    Forward: "ACCEPT",
+//	})
+//	if err == nil && changed {
+//	    err = ReloadFirewall()
+//	}
+//
+// Note: This operation requires appropriate privileges and commits the configuration.
+func SetFirewallZone(zone *UCIFirewallZone) (bool, error) {
+	return SetFirewallZoneWithReader(zone, NewUCIFirewallConfigReader())
+}
+
+// SetFirewallZoneWithReader creates or updates a firewall zone using the provided reader.
+func SetFirewallZoneWithReader(zone *UCIFirewallZone, reader FirewallConfigReader) (bool, error) {
+	if zone == nil || zone.Name == "" {
+		return false, newValidationError("zone must have a name")
+	}
+
+	section, err := findFirewallZone(reader, zone.Name)
+	if err != nil {
+		return false, err
+	}
+
+	exists := section != ""
+	if !exists {
+		section = zone.Name
+		if err := reader.AddSection(firewallConfigName, section, "zone"); err != nil {
+			return false, newSectionError("add", firewallConfigName, section, err)
+		}
+	}
+
+	set, err := setOptionsIfChanged(reader, firewallConfigName, section, []uciOption{
+		{name: "name", typ: uci.TypeOption, value: zone.Name},
+		{name: "input", typ: uci.TypeOption, value: zone.Input},
+		{name: "output", typ: uci.TypeOption, value: zone.Output},
+		{name: "forward", typ: uci.TypeOption, value: zone.Forward},
+		{name: "masq", typ: uci.TypeOption, value: zone.Masq},
+		{name: "mtu_fix", typ: uci.TypeOption, value: zone.MTUFix},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	// Written as a list, which also normalizes a space-separated option
+	if len(zone.Network) > 0 {
+		listSet, err := setOptionIfChanged(reader, firewallConfigName, section, "network", uci.TypeList, zone.Network...)
+		if err != nil {
+			return false, err
+		}
+		set = set || listSet
+	}
+
+	if exists && !set {
+		return false, nil
+	}
+
+	if err := reader.Commit(); err != nil {
+		return false, newCommitError(firewallConfigName, err)
+	}
+
+	return true, nil
+}
+
+// SetZoneMasquerade turns masquerading and MSS clamping of a firewall zone on or
+// off, as needed on the uplink zone of a gateway.
+//
+// Returns true if the zone changed and the configuration was committed, and an
+// ErrSectionNotFound error if there is no zone of that name.
+//
+// Example:
+//
+//	changed, err := SetZoneMasquerade("wan", true)
+//	if err == nil && changed {
+//	    err = ReloadFirewall()
+//	}
+func SetZoneMasquerade(zone string, enabled bool) (bool, error) {
+	return SetZoneMasqueradeWithReader(zone, enabled, NewUCIFirewallConfigReader())
+}
+
+// SetZoneMasqueradeWithReader turns masquerading of a zone on or off using the provided reader.
+func SetZoneMasqueradeWithReader(zone string, enabled bool, reader FirewallConfigReader) (bool, error) {
+	section, err := findFirewallZone(reader, zone)
+	if err != nil {
+		return false, err
+	}
+	if section == "" {
+		return false, fmt.Errorf("%w: firewall zone %q", ErrSectionNotFound, zone)
+	}
+
+	value := "0"
+	if enabled {
+		value = "1"
+	}
+
+	return setFirewallSection(reader, "zone", section, []uciOption{
+		{name: "masq", typ: uci.TypeOption, value: value},
+		{name: "mtu_fix", typ: uci.TypeOption, value: value},
+	})
+}
+
+// GetFirewallForwardings loads and returns the firewall forwardings in file order.
+func GetFirewallForwardings() ([]UCIFirewallForwarding, error) {
+	return GetFirewallForwardingsWithReader(NewUCIFirewallConfigReader())
+}
+
+// GetFirewallForwardingsWithReader loads and returns the firewall forwardings using the provided reader.
+func GetFirewallForwardingsWithReader(reader FirewallConfigReader) ([]UCIFirewallForwarding, error) {
+	sections, err := reader.GetSections(firewallConfigName, "forwarding")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read firewall forwardings: %w", err)
+	}
+
+	forwardings := make([]UCIFirewallForwarding, 0, len(sections))
+	for _, section := range sections {
+		forwardings = append(forwardings, UCIFirewallForwarding{
+			Src:  firewallOption(reader, section, "src"),
+			Dest: firewallOption(reader, section, "dest"),
+		})
+	}
+
+	return forwardings, nil
+}
+
+// forwardingName returns the name of the section AddFirewallForwarding creates for
+// the forwarding from src to dest.
+func forwardingName(src, dest string) string {
+	return "forward_" + src + "_" + dest
+}
+
+// AddFirewallForwarding allows traffic from the zone src to the zone dest. Nothing is
+// written if a forwarding between the two zones exists, whatever its section is
+// called.
+//
+// Returns true if the forwarding was added and the configuration committed.
+//
+// Example:
+//
+//	added, err := AddFirewallForwarding("lan", "wan")
+//	if err == nil && added {
+//	    err = ReloadFirewall()
+//	}
+func AddFirewallForwarding(src, dest string) (bool, error) {
+	return AddFirewallForwardingWithReader(src, dest, NewUCIFirewallConfigReader())
+}
+
+// AddFirewallForwardingWithReader adds a forwarding between two zones using the provided reader.
+func AddFirewallForwardingWithReader(src, dest string, reader FirewallConfigReader) (bool, error) {
+	if src == "" || dest == "" {
+		return false, newValidationError("forwarding needs a source and a destination zone")
+	}
+
+	forwardings, err := GetFirewallForwardingsWithReader(reader)
+	if err != nil {
+		return false, err
+	}
+	if slices.Contains(forwardings, UCIFirewallForwarding{Src: src, Dest: dest}) {
+		return false, nil
+	}
+
+	return setFirewallSection(reader, "forwarding", forwardingName(src, dest), []uciOption{
+		{name: "src", typ: uci.TypeOption, value: src},
+		{name: "dest", typ: uci.TypeOption, value: dest},
+	})
+}
+
+// GetFirewallRule loads and returns the firewall rule section.
+//
+// Returns an ErrSectionNotFound error if there is no rule section of that name.
+func GetFirewallRule(section string) (*UCIFirewallRule, error) {
+	return GetFirewallRuleWithReader(section, NewUCIFirewallConfigReader())
+}
+
+// GetFirewallRuleWithReader loads and returns a firewall rule using the provided reader.
+func GetFirewallRuleWithReader(section string, reader FirewallConfigReader) (*UCIFirewallRule, error) {
+	exists, err := firewallSectionExists(reader, "rule", section)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("%w: firewall rule %q", ErrSectionNotFound, section)
+	}
+
+	return &UCIFirewallRule{
+		Name:     firewallOption(reader, section, "name"),
+		Src:      firewallOption(reader, section, "src"),
+		SrcIP:    firewallOption(reader, section, "src_ip"),
+		Dest:     firewallOption(reader, section, "dest"),
+		DestIP:   firewallOption(reader, section, "dest_ip"),
+		DestPort: firewallOption(reader, section, "dest_port"),
+		Proto:    firewallOption(reader, section, "proto"),
+		Family:   firewallOption(reader, section, "family"),
+		Target:   firewallOption(reader, section, "target"),
+		SetMark:  firewallOption(reader, section, "set_mark"),
+	}, nil
+}
+
+// SetFirewallRule creates or updates the named firewall rule section. Empty fields
+// are left as they are.
+//
+// Parameters:
+//   - section: The UCI section name of the rule (e.g., "openmanet_dhcp")
+//   - rule: The options of the rule
+//
+// Returns true if the rule was created or changed and the configuration committed.
+//
+// Example:
+//
+//	changed, err := SetFirewallRule("openmanet_dns", &UCIFirewallRule{
+//	    Name:     "Allow DNS from the mesh",
+//	    Src:      "lan",
+//	    DestPort: "53",
+//	    Proto:    "tcp udp",
+//	    Target:   "ACCEPT",
+//	})
+//
+// Note: This operation requires appropriate privileges and commits the configuration.
+func SetFirewallRule(section string, rule *UCIFirewallRule) (bool, error) {
+	return SetFirewallRuleWithReader(section, rule, NewUCIFirewallConfigReader())
+}
+
+// SetFirewallRuleWithReader creates or updates a firewall rule using the provided reader.
+func SetFirewallRuleWithReader(section string, rule *UCIFirewallRule, reader FirewallConfigReader) (bool, error) {
+	if rule == nil || rule.Target == "" {
+		return false, newValidationError("rule must have a target")
+	}
+
+	return setFirewallSection(reader, "rule", section, []uciOption{
+		{name: "name", typ: uci.TypeOption, value: rule.Name},
+		{name: "src", typ: uci.TypeOption, value: rule.Src},
+		{name: "src_ip", typ: uci.TypeOption, value: rule.SrcIP},
+		{name: "dest", typ: uci.TypeOption, value: rule.Dest},
+		{name: "dest_ip", typ: uci.TypeOption, value: rule.DestIP},
+		{name: "dest_port", typ: uci.TypeOption, value: rule.DestPort},
+		{name: "proto", typ: uci.TypeOption, value: rule.Proto},
+		{name: "family", typ: uci.TypeOption, value: rule.Family},
+		{name: "target", typ: uci.TypeOption, value: rule.Target},
+		{name: "set_mark", typ: uci.TypeOption, value: rule.SetMark},
+	})
+}
+
+// DeleteFirewallRule removes the named firewall rule section. Nothing is written if
+// there is no such rule.
+//
+// Returns true if the rule was removed and the configuration committed.
+func DeleteFirewallRule(section string) (bool, error) {
+	return DeleteFirewallRuleWithReader(section, NewUCIFirewallConfigReader())
+}
+
+// DeleteFirewallRuleWithReader removes a firewall rule using the provided reader.
+func DeleteFirewallRuleWithReader(section string, reader FirewallConfigReader) (bool, error) {
+	return deleteFirewallSection(reader, "rule", section)
+}
+
+// GetFirewallRedirect loads and returns the firewall redirect section.
+//
+// Returns an ErrSectionNotFound error if there is no redirect section of that name.
+func GetFirewallRedirect(section string) (*UCIFirewallRedirect, error) {
+	return GetFirewallRedirectWithReader(section, NewUCIFirewallConfigReader())
+}
+
+// GetFirewallRedirectWithReader loads and returns a firewall redirect using the provided reader.
+func GetFirewallRedirectWithReader(section string, reader FirewallConfigReader) (*UCIFirewallRedirect, error) {
+	exists, err := firewallSectionExists(reader, "redirect", section)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("%w: firewall redirect %q", ErrSectionNotFound, section)
+	}
+
+	return &UCIFirewallRedirect{
+		Name:     firewallOption(reader, section, "name"),
+		Src:      firewallOption(reader, section, "src"),
+		SrcDPort: firewallOption(reader, section, "src_dport"),
+		Dest:     firewallOption(reader, section, "dest"),
+		DestIP:   firewallOption(reader, section, "dest_ip"),
+		DestPort: firewallOption(reader, section, "dest_port"),
+		Proto:    firewallOption(reader, section, "proto"),
+		Target:   firewallOption(reader, section, "target"),
+	}, nil
+}
+
+// SetFirewallRedirect creates or updates the named firewall redirect section. Empty
+// fields are left as they are.
+//
+// Example:
+//
+//	changed, err := SetFirewallRedirect("forward_ssh", &UCIFirewallRedirect{
+//	    Src:      "wan",
+//	    SrcDPort: "2222",
+//	    Dest:     "lan",
+//	    DestIP:   "10.41.1.7",
+//	    DestPort: "22",
+//	    Proto:    "tcp",
+//	    Target:   "DNAT",
+//	})
+//
+// Note: This operation requires appropriate privileges and commits the configuration.
+func SetFirewallRedirect(section string, redirect *UCIFirewallRedirect) (bool, error) {
+	return SetFirewallRedirectWithReader(section, redirect, NewUCIFirewallConfigReader())
+}
+
+// SetFirewallRedirectWithReader creates or updates a firewall redirect using the provided reader.
+func SetFirewallRedirectWithReader(section string, redirect *UCIFirewallRedirect, reader FirewallConfigReader) (bool, error) {
+	if redirect == nil || redirect.Src == "" {
+		return false, newValidationError("redirect must have a source zone")
+	}
+
+	return setFirewallSection(reader, "redirect", section, []uciOption{
+		{name: "name", typ: uci.TypeOption, value: redirect.Name},
+		{name: "src", typ: uci.TypeOption, value: redirect.Src},
+		{name: "src_dport", typ: uci.TypeOption, value: redirect.SrcDPort},
+		{name: "dest", typ: uci.TypeOption, value: redirect.Dest},
+		{name: "dest_ip", typ: uci.TypeOption, value: redirect.DestIP},
+		{name: "dest_port", typ: uci.TypeOption, value: redirect.DestPort},
+		{name: "proto", typ: uci.TypeOption, value: redirect.Proto},
+		{name: "target", typ: uci.TypeOption, value: redirect.Target},
+	})
+}
+
+// DeleteFirewallRedirect removes the named firewall redirect section. Nothing is
+// written if there is no such redirect.
+//
+// Returns true if the redirect was removed and the configuration committed.
+func DeleteFirewallRedirect(section string) (bool, error) {
+	return DeleteFirewallRedirectWithReader(section, NewUCIFirewallConfigReader())
+}
+
+// DeleteFirewallRedirectWithReader removes a firewall redirect using the provided reader.
+func DeleteFirewallRedirectWithReader(section string, reader FirewallConfigReader) (bool, error) {
+	return deleteFirewallSection(reader, "redirect", section)
+}
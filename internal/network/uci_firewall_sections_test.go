@@ -0,0 +1,309 @@
+package network
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/digineo/go-uci/v2"
+)
+
+// mockFirewallConfigReader is an in-memory FirewallConfigReader that keeps sections
+// in order and by type.
+type mockFirewallConfigReader struct {
+	sections []mockSection
+	options  map[string][]string // section.option -> values
+	commits  int
+
+	sectionsErr error
+}
+
+type mockSection struct {
+	name string
+	typ  string
+}
+
+// newMockFirewallConfigReader returns a reader holding the zones of
+// testFirewallConfig as anonymous sections and a lan to wan forwarding.
+func newMockFirewallConfigReader() *mockFirewallConfigReader {
+	return &mockFirewallConfigReader{
+		sections: []mockSection{
+			{"@zone[0]", "zone"},
+			{"@zone[1]", "zone"},
+			{"@forwarding[0]", "forwarding"},
+		},
+		options: map[string][]string{
+			"@zone[0].name":       {"lan"},
+			"@zone[0].network":    {"lan"},
+			"@zone[0].input":      {"ACCEPT"},
+			"@zone[1].name":       {"wan"},
+			"@zone[1].network":    {"wan wan6"},
+			"@zone[1].input":      {"REJECT"},
+			"@forwarding[0].src":  {"lan"},
+			"@forwarding[0].dest": {"wan"},
+		},
+	}
+}
+
+func (m *mockFirewallConfigReader) GetSections(config, secType string) ([]string, error) {
+	if m.sectionsErr != nil {
+		return nil, m.sectionsErr
+	}
+
+	var names []string
+	for _, s := range m.sections {
+		if s.typ == secType {
+			names = append(names, s.name)
+		}
+	}
+	return names, nil
+}
+
+func (m *mockFirewallConfigReader) Get(config, section, option string) ([]string, bool) {
+	values, ok := m.options[section+"."+option]
+	return values, ok
+}
+
+func (m *mockFirewallConfigReader) SetType(config, section, option string, typ uci.OptionType, values ...string) error {
+	m.options[section+"."+option] = values
+	return nil
+}
+
+func (m *mockFirewallConfigReader) AddSection(config, section, typ string) error {
+	m.sections = append(m.sections, mockSection{section, typ})
+	return nil
+}
+
+func (m *mockFirewallConfigReader) DelSection(config, section string) error {
+	m.sections = slices.DeleteFunc(m.sections, func(s mockSection) bool { return s.name == section })
+	for key := range m.options {
+		if strings.HasPrefix(key, section+".") {
+			delete(m.options, key)
+		}
+	}
+	return nil
+}
+
+func (m *mockFirewallConfigReader) Commit() error {
+	m.commits++
+	return nil
+}
+
+func (m *mockFirewallConfigReader) ReloadConfig() error { return nil }
+
+func TestGetFirewallZonesWithReader(t *testing.T) {
+	zones, err := GetFirewallZonesWithReader(newMockFirewallConfigReader())
+	if err != nil {
+		t.Fatalf("GetFirewallZonesWithReader() error = %v", err)
+	}
+
+	want := []UCIFirewallZone{
+		{Name: "lan", Network: []string{"lan"}, Input: "ACCEPT"},
+		{Name: "wan", Network: []string{"wan", "wan6"}, Input: "REJECT"},
+	}
+	if !reflect.DeepEqual(zones, want) {
+		t.Errorf("GetFirewallZonesWithReader() = %+v, want %+v", zones, want)
+	}
+}
+
+func TestGetFirewallZoneWithReader(t *testing.T) {
+	reader := newMockFirewallConfigReader()
+
+	zone, err := GetFirewallZoneWithReader("wan", reader)
+	if err != nil || zone.Input != "REJECT" {
+		t.Errorf("GetFirewallZoneWithReader(wan) = %+v, %v", zone, err)
+	}
+
+	if _, err := GetFirewallZoneWithReader("mesh", reader); !errors.Is(err, ErrSectionNotFound) {
+		t.Errorf("GetFirewallZoneWithReader(mesh) error = %v, want ErrSectionNotFound", err)
+	}
+}
+
+func TestSetFirewallZoneWithReader(t *testing.T) {
+	reader := newMockFirewallConfigReader()
+
+	// A new zone gets a section named after it
+	mesh := &UCIFirewallZone{Name: "mesh", Network: []string{"ahwlan"}, Input: "ACCEPT", Output: "ACCEPT", Forward: "ACCEPT"}
+	changed, err := SetFirewallZoneWithReader(mesh, reader)
+	if err != nil || !changed || reader.commits != 1 {
+		t.Fatalf("SetFirewallZoneWithReader(new) = %v, %v with %d commits; want true, nil with 1", changed, err, reader.commits)
+	}
+	got, err := GetFirewallZoneWithReader("mesh", reader)
+	if err != nil || !reflect.DeepEqual(got, mesh) {
+		t.Errorf("zone after create = %+v, %v; want %+v", got, err, mesh)
+	}
+	if _, ok := reader.options["mesh.name"]; !ok {
+		t.Error("new zone was not written to a section named mesh")
+	}
+
+	// Unchanged, nothing is committed
+	if changed, err := SetFirewallZoneWithReader(mesh, reader); err != nil || changed || reader.commits != 1 {
+		t.Errorf("SetFirewallZoneWithReader(same) = %v, %v with %d commits; want false, nil with 1", changed, err, reader.commits)
+	}
+
+	// An anonymous zone is updated in place, and only the fields given are written
+	changed, err = SetFirewallZoneWithReader(&UCIFirewallZone{Name: "wan", Network: []string{"wan", "wan6", "wwan"}}, reader)
+	if err != nil || !changed {
+		t.Fatalf("SetFirewallZoneWithReader(wan) = %v, %v", changed, err)
+	}
+	if got := reader.options["@zone[1].network"]; !reflect.DeepEqual(got, []string{"wan", "wan6", "wwan"}) {
+		t.Errorf("wan network = %v", got)
+	}
+	if got := reader.options["@zone[1].input"]; !reflect.DeepEqual(got, []string{"REJECT"}) {
+		t.Errorf("wan input = %v, want it left as REJECT", got)
+	}
+
+	if _, err := SetFirewallZoneWithReader(&UCIFirewallZone{}, reader); !errors.Is(err, ErrValidation) {
+		t.Errorf("SetFirewallZoneWithReader(unnamed) error = %v, want ErrValidation", err)
+	}
+}
+
+func TestSetZoneMasqueradeWithReader(t *testing.T) {
+	reader := newMockFirewallConfigReader()
+
+	changed, err := SetZoneMasqueradeWithReader("wan", true, reader)
+	if err != nil || !changed {
+		t.Fatalf("SetZoneMasqueradeWithReader(on) = %v, %v", changed, err)
+	}
+	zone, _ := GetFirewallZoneWithReader("wan", reader)
+	if zone.Masq != "1" || zone.MTUFix != "1" {
+		t.Errorf("wan masq = %q, mtu_fix = %q; want 1", zone.Masq, zone.MTUFix)
+	}
+
+	if changed, err := SetZoneMasqueradeWithReader("wan", true, reader); err != nil || changed || reader.commits != 1 {
+		t.Errorf("SetZoneMasqueradeWithReader(on again) = %v, %v with %d commits", changed, err, reader.commits)
+	}
+
+	if changed, err := SetZoneMasqueradeWithReader("wan", false, reader); err != nil || !changed {
+		t.Errorf("SetZoneMasqueradeWithReader(off) = %v, %v", changed, err)
+	}
+
+	if _, err := SetZoneMasqueradeWithReader("wwan", true, reader); !errors.Is(err, ErrSectionNotFound) {
+		t.Errorf("SetZoneMasqueradeWithReader(missing) error = %v, want ErrSectionNotFound", err)
+	}
+}
+
+func TestAddFirewallForwardingWithReader(t *testing.T) {
+	reader := newMockFirewallConfigReader()
+
+	// lan to wan exists as an anonymous section
+	if added, err := AddFirewallForwardingWithReader("lan", "wan", reader); err != nil || added || reader.commits != 0 {
+		t.Errorf("AddFirewallForwardingWithReader(existing) = %v, %v with %d commits", added, err, reader.commits)
+	}
+
+	added, err := AddFirewallForwardingWithReader("mesh", "wan", reader)
+	if err != nil || !added {
+		t.Fatalf("AddFirewallForwardingWithReader(new) = %v, %v", added, err)
+	}
+
+	forwardings, err := GetFirewallForwardingsWithReader(reader)
+	want := []UCIFirewallForwarding{{Src: "lan", Dest: "wan"}, {Src: "mesh", Dest: "wan"}}
+	if err != nil || !reflect.DeepEqual(forwardings, want) {
+		t.Errorf("forwardings = %+v, %v; want %+v", forwardings, err, want)
+	}
+
+	if added, err := AddFirewallForwardingWithReader("mesh", "wan", reader); err != nil || added {
+		t.Errorf("AddFirewallForwardingWithReader(again) = %v, %v; want false, nil", added, err)
+	}
+	if _, err := AddFirewallForwardingWithReader("", "wan", reader); !errors.Is(err, ErrValidation) {
+		t.Errorf("AddFirewallForwardingWithReader(no source) error = %v, want ErrValidation", err)
+	}
+}
+
+func TestFirewallRuleLifecycle(t *testing.T) {
+	reader := newMockFirewallConfigReader()
+	rule := &UCIFirewallRule{Name: "Allow DNS", Src: "lan", DestPort: "53", Proto: "tcp udp", Target: "ACCEPT"}
+
+	if _, err := GetFirewallRuleWithReader("openmanet_dns", reader); !errors.Is(err, ErrSectionNotFound) {
+		t.Errorf("GetFirewallRuleWithReader(missing) error = %v, want ErrSectionNotFound", err)
+	}
+
+	if changed, err := SetFirewallRuleWithReader("openmanet_dns", rule, reader); err != nil || !changed {
+		t.Fatalf("SetFirewallRuleWithReader(new) = %v, %v", changed, err)
+	}
+	if got, err := GetFirewallRuleWithReader("openmanet_dns", reader); err != nil || !reflect.DeepEqual(got, rule) {
+		t.Errorf("GetFirewallRuleWithReader() = %+v, %v; want %+v", got, err, rule)
+	}
+	if changed, err := SetFirewallRuleWithReader("openmanet_dns", rule, reader); err != nil || changed || reader.commits != 1 {
+		t.Errorf("SetFirewallRuleWithReader(same) = %v, %v with %d commits", changed, err, reader.commits)
+	}
+
+	if removed, err := DeleteFirewallRuleWithReader("openmanet_dns", reader); err != nil || !removed {
+		t.Errorf("DeleteFirewallRuleWithReader() = %v, %v; want true, nil", removed, err)
+	}
+	if removed, err := DeleteFirewallRuleWithReader("openmanet_dns", reader); err != nil || removed {
+		t.Errorf("DeleteFirewallRuleWithReader(again) = %v, %v; want false, nil", removed, err)
+	}
+
+	if _, err := SetFirewallRuleWithReader("openmanet_dns", &UCIFirewallRule{Src: "lan"}, reader); !errors.Is(err, ErrValidation) {
+		t.Errorf("SetFirewallRuleWithReader(no target) error = %v, want ErrValidation", err)
+	}
+}
+
+func TestFirewallRedirectLifecycle(t *testing.T) {
+	reader := newMockFirewallConfigReader()
+	redirect := &UCIFirewallRedirect{Src: "wan", SrcDPort: "2222", Dest: "lan", DestIP: "10.41.1.7", DestPort: "22", Proto: "tcp", Target: "DNAT"}
+
+	if changed, err := SetFirewallRedirectWithReader("forward_ssh", redirect, reader); err != nil || !changed {
+		t.Fatalf("SetFirewallRedirectWithReader(new) = %v, %v", changed, err)
+	}
+	if got, err := GetFirewallRedirectWithReader("forward_ssh", reader); err != nil || !reflect.DeepEqual(got, redirect) {
+		t.Errorf("GetFirewallRedirectWithReader() = %+v, %v; want %+v", got, err, redirect)
+	}
+
+	// A rule of the same name is not a redirect
+	if _, err := GetFirewallRuleWithReader("forward_ssh", reader); !errors.Is(err, ErrSectionNotFound) {
+		t.Errorf("GetFirewallRuleWithReader(redirect section) error = %v, want ErrSectionNotFound", err)
+	}
+
+	if removed, err := DeleteFirewallRedirectWithReader("forward_ssh", reader); err != nil || !removed {
+		t.Errorf("DeleteFirewallRedirectWithReader() = %v, %v; want true, nil", removed, err)
+	}
+	if _, err := SetFirewallRedirectWithReader("forward_ssh", &UCIFirewallRedirect{Target: "DNAT"}, reader); !errors.Is(err, ErrValidation) {
+		t.Errorf("SetFirewallRedirectWithReader(no source) error = %v, want ErrValidation", err)
+	}
+}
+
+func TestFirewallSections_ReadError(t *testing.T) {
+	reader := newMockFirewallConfigReader()
+	reader.sectionsErr = errors.New("parse error")
+
+	if _, err := GetFirewallZonesWithReader(reader); err == nil {
+		t.Error("GetFirewallZonesWithReader() error = nil")
+	}
+	if _, err := SetFirewallRuleWithReader("r", &UCIFirewallRule{Target: "ACCEPT"}, reader); err == nil {
+		t.Error("SetFirewallRuleWithReader() error = nil")
+	}
+	if reader.commits != 0 {
+		t.Errorf("committed %d times after read errors", reader.commits)
+	}
+}
+
+func TestFirewallSections_Tree(t *testing.T) {
+	dir := writeTestConfig(t, "firewall", testFirewallConfig)
+	reader := NewUCIFirewallConfigReaderWithTree(uci.NewTree(dir))
+
+	if _, err := SetZoneMasqueradeWithReader("wan", true, reader); err != nil {
+		t.Fatalf("SetZoneMasqueradeWithReader() error = %v", err)
+	}
+	if _, err := AddFirewallForwardingWithReader("lan", "wan", reader); err != nil {
+		t.Fatalf("AddFirewallForwardingWithReader() error = %v", err)
+	}
+	if _, err := SetFirewallRuleWithReader("openmanet_dhcp", &UCIFirewallRule{Src: "lan", DestPort: "67", Proto: "udp", Target: "ACCEPT"}, reader); err != nil {
+		t.Fatalf("SetFirewallRuleWithReader() error = %v", err)
+	}
+
+	// A fresh reader sees what was committed
+	fresh := &UCIFirewallConfigReader{tree: uci.NewTree(dir)}
+	if zone, err := GetFirewallZoneWithReader("wan", fresh); err != nil || zone.Masq != "1" {
+		t.Errorf("committed wan zone = %+v, %v", zone, err)
+	}
+	if forwardings, err := GetFirewallForwardingsWithReader(fresh); err != nil || len(forwardings) != 1 {
+		t.Errorf("committed forwardings = %+v, %v", forwardings, err)
+	}
+	if rule, err := GetFirewallRuleWithReader("openmanet_dhcp", fresh); err != nil || rule.DestPort != "67" {
+		t.Errorf("committed rule = %+v, %v", rule, err)
+	}
+}
@@ -0,0 +1,102 @@
+package network
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/digineo/go-uci/v2"
+)
+
+// testFirewallConfig is a trimmed OpenWrt default firewall with the network of the
+// wan zone given as a single space-separated option, as older configs do.
+const testFirewallConfig = `config defaults
+	option input 'REJECT'
+	option output 'ACCEPT'
+	option forward 'REJECT'
+
+config zone
+	option name 'lan'
+	list network 'lan'
+	option input 'ACCEPT'
+	option output 'ACCEPT'
+	option forward 'ACCEPT'
+
+config zone
+	option name 'wan'
+	option network 'wan wan6'
+	option input 'REJECT'
+	option output 'ACCEPT'
+	option forward 'REJECT'
+`
+
+func TestVerifyZoneCoverageWithReader(t *testing.T) {
+	reader := NewUCIFirewallConfigReaderWithTree(uci.NewTree(writeTestConfig(t, "firewall", testFirewallConfig)))
+
+	tests := []struct {
+		section     string
+		wantCovered bool
+		wantZone    string
+	}{
+		{"lan", true, "lan"},
+		{"wan6", true, "wan"},
+		{"ahwlan", false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.section, func(t *testing.T) {
+			covered, zone, err := VerifyZoneCoverageWithReader(tt.section, reader)
+			if err != nil {
+				t.Fatalf("VerifyZoneCoverageWithReader() error = %v", err)
+			}
+			if covered != tt.wantCovered || zone != tt.wantZone {
+				t.Errorf("VerifyZoneCoverageWithReader() = %v, %q; want %v, %q", covered, zone, tt.wantCovered, tt.wantZone)
+			}
+		})
+	}
+}
+
+func TestAddNetworkToZoneWithReader(t *testing.T) {
+	dir := writeTestConfig(t, "firewall", testFirewallConfig)
+	reader := NewUCIFirewallConfigReaderWithTree(uci.NewTree(dir))
+
+	added, err := AddNetworkToZoneWithReader("lan", "ahwlan", reader)
+	if err != nil {
+		t.Fatalf("AddNetworkToZoneWithReader() error = %v", err)
+	}
+	if !added {
+		t.Error("AddNetworkToZoneWithReader() = false, want true")
+	}
+
+	// The change is committed: a fresh tree sees it
+	fresh := &UCIFirewallConfigReader{tree: uci.NewTree(dir)}
+	if covered, zone, _ := VerifyZoneCoverageWithReader("ahwlan", fresh); !covered || zone != "lan" {
+		t.Errorf("after adding, coverage = %v, %q; want true, lan", covered, zone)
+	}
+
+	added, err = AddNetworkToZoneWithReader("lan", "ahwlan", fresh)
+	if err != nil || added {
+		t.Errorf("adding again = %v, %v; want false, nil", added, err)
+	}
+}
+
+func TestAddNetworkToZoneWithReader_SpaceSeparated(t *testing.T) {
+	reader := NewUCIFirewallConfigReaderWithTree(uci.NewTree(writeTestConfig(t, "firewall", testFirewallConfig)))
+
+	if _, err := AddNetworkToZoneWithReader("wan", "ahwlan", reader); err != nil {
+		t.Fatalf("AddNetworkToZoneWithReader() error = %v", err)
+	}
+
+	got, _ := reader.Get("firewall", "@zone[1]", "network")
+	if want := []string{"wan", "wan6", "ahwlan"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("network = %v, want %v", got, want)
+	}
+}
+
+func TestAddNetworkToZoneWithReader_UnknownZone(t *testing.T) {
+	reader := NewUCIFirewallConfigReaderWithTree(uci.NewTree(writeTestConfig(t, "firewall", testFirewallConfig)))
+
+	if _, err := AddNetworkToZoneWithReader("mesh", "ahwlan", reader); !errors.Is(err, ErrSectionNotFound) {
+		t.Errorf("AddNetworkToZoneWithReader() error = %v, want ErrSectionNotFound", err)
+	}
+}
@@ -0,0 +1,707 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+
+	"github.com/digineo/go-uci/v2"
+	"github.com/openmanet/openmanetd/internal/safemode"
+)
+
+/*
+config interface 'wan'
+	option enabled '1'
+	option family 'ipv4'
+	list track_ip '1.1.1.1'
+	option reliability '1'
+
+config member 'wan_m1_w1'
+	option interface 'wan'
+	option metric '1'
+	option weight '1'
+
+config policy 'failover'
+	list use_member 'wan_m1_w1'
+	list use_member 'lte_m2_w1'
+	option last_resort 'unreachable'
+
+config rule 'default_rule_v4'
+	option dest_ip '0.0.0.0/0'
+	option family 'ipv4'
+	option use_policy 'failover'
+*/
+
+// mwan3 steers the traffic a gateway routes upstream across its uplinks, e.g. an
+// Ethernet WAN with LTE as backup. It only acts on traffic that leaves through the
+// uplinks: traffic to connected networks, the mesh among them, is left alone, so
+// batman-adv gateway mode keeps announcing the node whichever uplink is in use.
+
+const (
+	mwan3ConfigName string = "mwan3"
+
+	// mwan3DefaultRule is the rule of the stock mwan3 config that matches all IPv4
+	// traffic.
+	mwan3DefaultRule = "default_rule_v4"
+)
+
+// UCIMwan3Interface represents an mwan3 interface section. Name is the section name,
+// which is the name of the network interface of the uplink.
+type UCIMwan3Interface struct {
+	Name        string   `json:"name"`
+	Enabled     string   `uci:"option enabled" json:"enabled,omitempty"`
+	Family      string   `uci:"option family" json:"family,omitempty"`
+	TrackIP     []string `uci:"list track_ip" json:"track_ip,omitempty"`
+	Reliability string   `uci:"option reliability" json:"reliability,omitempty"`
+	// Interval is the number of seconds between tracking probes; Down and Up are
+	// the number of failed or answered probes before the uplink changes state.
+	Interval string `uci:"option interval" json:"interval,omitempty"`
+	Down     string `uci:"option down" json:"down,omitempty"`
+	Up       string `uci:"option up" json:"up,omitempty"`
+}
+
+// UCIMwan3Member represents an mwan3 member section, an interface with the metric
+// and weight it has in the policies that use the member. Members of the lowest metric
+// are used first; within a metric, traffic is balanced by weight.
+type UCIMwan3Member struct {
+	Name      string `json:"name"`
+	Interface string `uci:"option interface" json:"interface,omitempty"`
+	Metric    string `uci:"option metric" json:"metric,omitempty"`
+	Weight    string `uci:"option weight" json:"weight,omitempty"`
+}
+
+// UCIMwan3Policy represents an mwan3 policy section.
+type UCIMwan3Policy struct {
+	Name      string   `json:"name"`
+	UseMember []string `uci:"list use_member" json:"use_member,omitempty"`
+	// LastResort is what happens to traffic when no member is online:
+	// "unreachable", "blackhole" or "default" to use the main routing table.
+	LastResort string `uci:"option last_resort" json:"last_resort,omitempty"`
+}
+
+// UCIMwan3Rule represents an mwan3 rule section, which sends matching traffic to a
+// policy. Rules are matched in file order.
+type UCIMwan3Rule struct {
+	Name      string `json:"name"`
+	SrcIP     string `uci:"option src_ip" json:"src_ip,omitempty"`
+	DestIP    string `uci:"option dest_ip" json:"dest_ip,omitempty"`
+	DestPort  string `uci:"option dest_port" json:"dest_port,omitempty"`
+	Proto     string `uci:"option proto" json:"proto,omitempty"`
+	Family    string `uci:"option family" json:"family,omitempty"`
+	Sticky    string `uci:"option sticky" json:"sticky,omitempty"`
+	UsePolicy string `uci:"option use_policy" json:"use_policy,omitempty"`
+}
+
+// Mwan3ConfigReader defines an interface for reading mwan3 UCI configuration values.
+type Mwan3ConfigReader interface {
+	GetSections(config, secType string) ([]string, error)
+	Get(config, section, option string) ([]string, bool)
+	SetType(config, section, option string, typ uci.OptionType, values ...string) error
+	Del(config, section, option string) error
+	AddSection(config, section, typ string) error
+	DelSection(config, section string) error
+	Commit() error
+	ReloadConfig() error
+}
+
+// UCIMwan3ConfigReader wraps the UCI functions for mwan3 configuration.
+type UCIMwan3ConfigReader struct {
+	tree uci.Tree
+	changeLog
+}
+
+// NewUCIMwan3ConfigReader creates a new UCI mwan3 config reader with the default tree.
+func NewUCIMwan3ConfigReader() *UCIMwan3ConfigReader {
+	return NewUCIMwan3ConfigReaderWithTree(uci.NewTree(uci.DefaultTreePath))
+}
+
+// NewUCIMwan3ConfigReaderWithTree creates a UCI mwan3 config reader on tree, so that
+// several readers can share one tree or read a tree outside the default path.
+func NewUCIMwan3ConfigReaderWithTree(tree uci.Tree) *UCIMwan3ConfigReader {
+	return &UCIMwan3ConfigReader{
+		tree: tree,
+	}
+}
+
+func (r *UCIMwan3ConfigReader) GetSections(config, secType string) ([]string, error) {
+	return r.tree.GetSections(config, secType)
+}
+
+func (r *UCIMwan3ConfigReader) Get(config, section, option string) ([]string, bool) {
+	return r.get(r.tree, config, section, option)
+}
+
+func (r *UCIMwan3ConfigReader) SetType(config, section, option string, typ uci.OptionType, values ...string) error {
+	if err := safemode.Check(fmt.Sprintf("uci set %s.%s.%s", config, section, option)); err != nil {
+		return err
+	}
+	return r.setType(r.tree, config, section, option, typ, values...)
+}
+
+func (r *UCIMwan3ConfigReader) Del(config, section, option string) error {
+	if err := safemode.Check(fmt.Sprintf("uci delete %s.%s.%s", config, section, option)); err != nil {
+		return err
+	}
+	return r.del(r.tree, config, section, option)
+}
+
+func (r *UCIMwan3ConfigReader) AddSection(config, section, typ string) error {
+	if err := safemode.Check(fmt.Sprintf("uci add %s.%s", config, section)); err != nil {
+		return err
+	}
+	return r.addSection(r.tree, config, section, typ)
+}
+
+func (r *UCIMwan3ConfigReader) DelSection(config, section string) error {
+	if err := safemode.Check(fmt.Sprintf("uci delete %s.%s", config, section)); err != nil {
+		return err
+	}
+	return r.delSection(r.tree, config, section)
+}
+
+// Commit writes staged changes to disk. Failures caused by a read-only
+// filesystem are reported as ErrReadOnlyFS.
+func (r *UCIMwan3ConfigReader) Commit() error {
+	if err := safemode.Check("uci commit"); err != nil {
+		return err
+	}
+	return classifyCommitError(r.commit(r.tree))
+}
+
+func (r *UCIMwan3ConfigReader) ReloadConfig() error {
+	if err := r.tree.LoadConfig(mwan3ConfigName, true); err != nil {
+		return err
+	}
+	r.reset(mwan3ConfigName)
+	return nil
+}
+
+// Revert discards the mwan3 changes staged since the last commit. The config is read
+// from disk again on next use.
+func (r *UCIMwan3ConfigReader) Revert() {
+	r.tree.Revert(mwan3ConfigName)
+	r.reset(mwan3ConfigName)
+}
+
+// mwan3Option returns the first value of an option of an mwan3 section, or "" if it
+// is not set.
+func mwan3Option(reader Mwan3ConfigReader, section, option string) string {
+	values, ok := reader.Get(mwan3ConfigName, section, option)
+	if !ok || len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// mwan3List returns the values of a list of an mwan3 section.
+func mwan3List(reader Mwan3ConfigReader, section, option string) []string {
+	values, _ := reader.Get(mwan3ConfigName, section, option)
+	return values
+}
+
+// mwan3Sections returns the sections of type secType in file order.
+func mwan3Sections(reader Mwan3ConfigReader, secType string) ([]string, error) {
+	sections, err := reader.GetSections(mwan3ConfigName, secType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mwan3 %s sections: %w", secType, err)
+	}
+	return sections, nil
+}
+
+// validateMwan3Section checks that name can be used as an mwan3 section name.
+func validateMwan3Section(secType, name string) error {
+	if name == "" {
+		return newValidationError("mwan3 %s must have a name", secType)
+	}
+	for _, c := range name {
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') && c != '_' {
+			return newValidationError("invalid mwan3 %s name %q: must contain only letters, digits and underscores", secType, name)
+		}
+	}
+	return nil
+}
+
+// validateMwan3Number checks that value, if set, is a number from min to max.
+func validateMwan3Number(section, option, value string, min, max int) error {
+	if value == "" {
+		return nil
+	}
+	if n, err := strconv.Atoi(value); err != nil || n < min || n > max {
+		return newInvalidOptionError(mwan3ConfigName, section, option, value, fmt.Sprintf("must be a number from %d to %d", min, max))
+	}
+	return nil
+}
+
+// stageMwan3Section creates the section name of type secType if it is missing and
+// stages the options and lists that differ. Empty options and lists are left as they
+// are.
+//
+// Returns true if anything was staged.
+func stageMwan3Section(reader Mwan3ConfigReader, secType, name string, options []uciOption, lists map[string][]string) (bool, error) {
+	sections, err := mwan3Sections(reader, secType)
+	if err != nil {
+		return false, err
+	}
+
+	changed := false
+	if !slices.Contains(sections, name) {
+		if err := reader.AddSection(mwan3ConfigName, name, secType); err != nil {
+			return false, newSectionError("add", mwan3ConfigName, name, err)
+		}
+		changed = true
+	}
+
+	set, err := setOptionsIfChanged(reader, mwan3ConfigName, name, options)
+	if err != nil {
+		return false, err
+	}
+	changed = changed || set
+
+	for _, option := range slices.Sorted(maps.Keys(lists)) {
+		if len(lists[option]) == 0 {
+			continue
+		}
+		set, err := setOptionIfChanged(reader, mwan3ConfigName, name, option, uci.TypeList, lists[option]...)
+		if err != nil {
+			return false, err
+		}
+		changed = changed || set
+	}
+
+	return changed, nil
+}
+
+// setMwan3Section stages the section through stageMwan3Section and commits.
+//
+// Returns true if anything was written.
+func setMwan3Section(reader Mwan3ConfigReader, secType, name string, options []uciOption, lists map[string][]string) (bool, error) {
+	changed, err := stageMwan3Section(reader, secType, name, options, lists)
+	if err != nil || !changed {
+		return false, err
+	}
+
+	if err := reader.Commit(); err != nil {
+		return false, newCommitError(mwan3ConfigName, err)
+	}
+
+	return true, nil
+}
+
+// mwan3InterfaceOptions returns the options and lists of an interface section.
+func mwan3InterfaceOptions(iface *UCIMwan3Interface) ([]uciOption, map[string][]string) {
+	return []uciOption{
+		{name: "enabled", typ: uci.TypeOption, value: iface.Enabled},
+		{name: "family", typ: uci.TypeOption, value: iface.Family},
+		{name: "reliability", typ: uci.TypeOption, value: iface.Reliability},
+		{name: "interval", typ: uci.TypeOption, value: iface.Interval},
+		{name: "down", typ: uci.TypeOption, value: iface.Down},
+		{name: "up", typ: uci.TypeOption, value: iface.Up},
+	}, map[string][]string{
+		"track_ip": iface.TrackIP,
+	}
+}
+
+// mwan3MemberOptions returns the options of a member section.
+func mwan3MemberOptions(member *UCIMwan3Member) []uciOption {
+	return []uciOption{
+		{name: "interface", typ: uci.TypeOption, value: member.Interface},
+		{name: "metric", typ: uci.TypeOption, value: member.Metric},
+		{name: "weight", typ: uci.TypeOption, value: member.Weight},
+	}
+}
+
+// validateMwan3Member checks the name, metric and weight of member.
+func validateMwan3Member(member *UCIMwan3Member) error {
+	if err := validateMwan3Section("member", member.Name); err != nil {
+		return err
+	}
+	if err := validateMwan3Number(member.Name, "metric", member.Metric, 1, 256); err != nil {
+		return err
+	}
+	return validateMwan3Number(member.Name, "weight", member.Weight, 1, 1000)
+}
+
+// GetMwan3Interfaces loads and returns the mwan3 interfaces in file order.
+func GetMwan3Interfaces() ([]UCIMwan3Interface, error) {
+	return GetMwan3InterfacesWithReader(NewUCIMwan3ConfigReader())
+}
+
+// GetMwan3InterfacesWithReader loads and returns the mwan3 interfaces using the provided reader.
+func GetMwan3InterfacesWithReader(reader Mwan3ConfigReader) ([]UCIMwan3Interface, error) {
+	sections, err := mwan3Sections(reader, "interface")
+	if err != nil {
+		return nil, err
+	}
+
+	ifaces := make([]UCIMwan3Interface, 0, len(sections))
+	for _, section := range sections {
+		ifaces = append(ifaces, UCIMwan3Interface{
+			Name:        section,
+			Enabled:     mwan3Option(reader, section, "enabled"),
+			Family:      mwan3Option(reader, section, "family"),
+			TrackIP:     mwan3List(reader, section, "track_ip"),
+			Reliability: mwan3Option(reader, section, "reliability"),
+			Interval:    mwan3Option(reader, section, "interval"),
+			Down:        mwan3Option(reader, section, "down"),
+			Up:          mwan3Option(reader, section, "up"),
+		})
+	}
+
+	return ifaces, nil
+}
+
+// GetMwan3Members loads and returns the mwan3 members in file order.
+func GetMwan3Members() ([]UCIMwan3Member, error) {
+	return GetMwan3MembersWithReader(NewUCIMwan3ConfigReader())
+}
+
+// GetMwan3MembersWithReader loads and returns the mwan3 members using the provided reader.
+func GetMwan3MembersWithReader(reader Mwan3ConfigReader) ([]UCIMwan3Member, error) {
+	sections, err := mwan3Sections(reader, "member")
+	if err != nil {
+		return nil, err
+	}
+
+	members := make([]UCIMwan3Member, 0, len(sections))
+	for _, section := range sections {
+		members = append(members, UCIMwan3Member{
+			Name:      section,
+			Interface: mwan3Option(reader, section, "interface"),
+			Metric:    mwan3Option(reader, section, "metric"),
+			Weight:    mwan3Option(reader, section, "weight"),
+		})
+	}
+
+	return members, nil
+}
+
+// GetMwan3Policies loads and returns the mwan3 policies in file order.
+func GetMwan3Policies() ([]UCIMwan3Policy, error) {
+	return GetMwan3PoliciesWithReader(NewUCIMwan3ConfigReader())
+}
+
+// GetMwan3PoliciesWithReader loads and returns the mwan3 policies using the provided reader.
+func GetMwan3PoliciesWithReader(reader Mwan3ConfigReader) ([]UCIMwan3Policy, error) {
+	sections, err := mwan3Sections(reader, "policy")
+	if err != nil {
+		return nil, err
+	}
+
+	policies := make([]UCIMwan3Policy, 0, len(sections))
+	for _, section := range sections {
+		policies = append(policies, UCIMwan3Policy{
+			Name:       section,
+			UseMember:  mwan3List(reader, section, "use_member"),
+			LastResort: mwan3Option(reader, section, "last_resort"),
+		})
+	}
+
+	return policies, nil
+}
+
+// GetMwan3Rules loads and returns the mwan3 rules in the order they are matched.
+func GetMwan3Rules() ([]UCIMwan3Rule, error) {
+	return GetMwan3RulesWithReader(NewUCIMwan3ConfigReader())
+}
+
+// GetMwan3RulesWithReader loads and returns the mwan3 rules using the provided reader.
+func GetMwan3RulesWithReader(reader Mwan3ConfigReader) ([]UCIMwan3Rule, error) {
+	sections, err := mwan3Sections(reader, "rule")
+	if err != nil {
+		return nil, err
+	}
+
+	rules := make([]UCIMwan3Rule, 0, len(sections))
+	for _, section := range sections {
+		rules = append(rules, UCIMwan3Rule{
+			Name:      section,
+			SrcIP:     mwan3Option(reader, section, "src_ip"),
+			DestIP:    mwan3Option(reader, section, "dest_ip"),
+			DestPort:  mwan3Option(reader, section, "dest_port"),
+			Proto:     mwan3Option(reader, section, "proto"),
+			Family:    mwan3Option(reader, section, "family"),
+			Sticky:    mwan3Option(reader, section, "sticky"),
+			UsePolicy: mwan3Option(reader, section, "use_policy"),
+		})
+	}
+
+	return rules, nil
+}
+
+// SetMwan3Interface creates or updates the mwan3 interface iface.Name. Empty fields
+// are left as they are.
+//
+// Returns true if any option changed and the configuration was committed.
+//
+// Example:
+//
+//	changed, err := SetMwan3Interface(&UCIMwan3Interface{
+//	    Name:        "wan",
+//	    Enabled:     "1",
+//	    TrackIP:     []string{"1.1.1.1", "8.8.8.8"},
+//	    Reliability: "1",
+//	})
+func SetMwan3Interface(iface *UCIMwan3Interface) (bool, error) {
+	return SetMwan3InterfaceWithReader(iface, NewUCIMwan3ConfigReader())
+}
+
+// SetMwan3InterfaceWithReader creates or updates an mwan3 interface using the provided reader.
+func SetMwan3InterfaceWithReader(iface *UCIMwan3Interface, reader Mwan3ConfigReader) (bool, error) {
+	if iface == nil {
+		return false, newValidationError("interface cannot be nil")
+	}
+	if err := validateMwan3Section("interface", iface.Name); err != nil {
+		return false, err
+	}
+
+	options, lists := mwan3InterfaceOptions(iface)
+	return setMwan3Section(reader, "interface", iface.Name, options, lists)
+}
+
+// SetMwan3Member creates or updates the mwan3 member member.Name. Empty fields are
+// left as they are.
+//
+// Returns true if any option changed and the configuration was committed, or an
+// ErrInvalidOption error if the metric is not from 1 to 256 or the weight not from
+// 1 to 1000.
+func SetMwan3Member(member *UCIMwan3Member) (bool, error) {
+	return SetMwan3MemberWithReader(member, NewUCIMwan3ConfigReader())
+}
+
+// SetMwan3MemberWithReader creates or updates an mwan3 member using the provided reader.
+func SetMwan3MemberWithReader(member *UCIMwan3Member, reader Mwan3ConfigReader) (bool, error) {
+	if member == nil {
+		return false, newValidationError("member cannot be nil")
+	}
+	if err := validateMwan3Member(member); err != nil {
+		return false, err
+	}
+
+	return setMwan3Section(reader, "member", member.Name, mwan3MemberOptions(member), nil)
+}
+
+// SetMwan3Policy creates or updates the mwan3 policy policy.Name. Empty fields are
+// left as they are.
+//
+// Returns true if any option changed and the configuration was committed.
+func SetMwan3Policy(policy *UCIMwan3Policy) (bool, error) {
+	return SetMwan3PolicyWithReader(policy, NewUCIMwan3ConfigReader())
+}
+
+// SetMwan3PolicyWithReader creates or updates an mwan3 policy using the provided reader.
+func SetMwan3PolicyWithReader(policy *UCIMwan3Policy, reader Mwan3ConfigReader) (bool, error) {
+	if policy == nil {
+		return false, newValidationError("policy cannot be nil")
+	}
+	if err := validateMwan3Section("policy", policy.Name); err != nil {
+		return false, err
+	}
+
+	return setMwan3Section(reader, "policy", policy.Name, []uciOption{
+		{name: "last_resort", typ: uci.TypeOption, value: policy.LastResort},
+	}, map[string][]string{
+		"use_member": policy.UseMember,
+	})
+}
+
+// SetMwan3Rule creates or updates the mwan3 rule rule.Name. Empty fields are left as
+// they are. A new rule is appended, after the rules already in the config.
+//
+// Returns true if any option changed and the configuration was committed.
+func SetMwan3Rule(rule *UCIMwan3Rule) (bool, error) {
+	return SetMwan3RuleWithReader(rule, NewUCIMwan3ConfigReader())
+}
+
+// SetMwan3RuleWithReader creates or updates an mwan3 rule using the provided reader.
+func SetMwan3RuleWithReader(rule *UCIMwan3Rule, reader Mwan3ConfigReader) (bool, error) {
+	if rule == nil {
+		return false, newValidationError("rule cannot be nil")
+	}
+	if err := validateMwan3Section("rule", rule.Name); err != nil {
+		return false, err
+	}
+
+	return setMwan3Section(reader, "rule", rule.Name, []uciOption{
+		{name: "src_ip", typ: uci.TypeOption, value: rule.SrcIP},
+		{name: "dest_ip", typ: uci.TypeOption, value: rule.DestIP},
+		{name: "dest_port", typ: uci.TypeOption, value: rule.DestPort},
+		{name: "proto", typ: uci.TypeOption, value: rule.Proto},
+		{name: "family", typ: uci.TypeOption, value: rule.Family},
+		{name: "sticky", typ: uci.TypeOption, value: rule.Sticky},
+		{name: "use_policy", typ: uci.TypeOption, value: rule.UsePolicy},
+	}, nil)
+}
+
+// DeleteMwan3Section deletes the mwan3 section name of type secType, e.g. a member
+// no policy uses any more, and commits. Nothing is written if there is no such
+// section.
+//
+// Returns true if the section was deleted.
+func DeleteMwan3Section(secType, name string) (bool, error) {
+	return DeleteMwan3SectionWithReader(secType, name, NewUCIMwan3ConfigReader())
+}
+
+// DeleteMwan3SectionWithReader deletes an mwan3 section using the provided reader.
+func DeleteMwan3SectionWithReader(secType, name string, reader Mwan3ConfigReader) (bool, error) {
+	sections, err := mwan3Sections(reader, secType)
+	if err != nil || !slices.Contains(sections, name) {
+		return false, err
+	}
+
+	if err := reader.DelSection(mwan3ConfigName, name); err != nil {
+		return false, newSectionError("delete", mwan3ConfigName, name, err)
+	}
+
+	if err := reader.Commit(); err != nil {
+		return false, newCommitError(mwan3ConfigName, err)
+	}
+
+	return true, nil
+}
+
+// Mwan3Uplink is an uplink of a gateway for ConfigureMwan3Failover.
+type Mwan3Uplink struct {
+	// Interface is the network interface of the uplink, e.g. "wan" or "lte".
+	Interface string
+	// Metric orders the uplinks: the online uplink of the lowest metric carries the
+	// traffic. Zero uses the position in the list, starting at 1.
+	Metric int
+	// Weight balances the traffic between uplinks of the same metric. Zero means 1.
+	Weight int
+	// TrackIP are the hosts pinged through the uplink to tell whether it is online.
+	// Without them mwan3 only follows the link state.
+	TrackIP []string
+}
+
+// mwan3MemberName returns the member section of an uplink, named as LuCI names them.
+func mwan3MemberName(iface string, metric, weight int) string {
+	return fmt.Sprintf("%s_m%d_w%d", iface, metric, weight)
+}
+
+// ConfigureMwan3Failover sets up mwan3 so that the traffic a gateway routes upstream
+// fails over between uplinks. Every uplink gets an interface and a member, policy
+// lists the members, and the stock IPv4 default rule is pointed at policy. Sections
+// the uplinks do not need are left alone, and everything is committed at once.
+//
+// Parameters:
+//   - policy: The name of the policy, e.g. "failover"
+//   - uplinks: The uplinks, in order of preference unless they set a metric
+//
+// Returns true if anything changed and the configuration was committed. Call
+// RestartMwan3 to apply it.
+//
+// Example:
+//
+//	changed, err := ConfigureMwan3Failover("failover", []Mwan3Uplink{
+//	    {Interface: "wan", TrackIP: []string{"1.1.1.1", "8.8.8.8"}},
+//	    {Interface: "lte", TrackIP: []string{"1.1.1.1", "8.8.8.8"}},
+//	})
+//	if err == nil && changed {
+//	    err = RestartMwan3()
+//	}
+func ConfigureMwan3Failover(policy string, uplinks []Mwan3Uplink) (bool, error) {
+	return ConfigureMwan3FailoverWithReader(policy, uplinks, NewUCIMwan3ConfigReader())
+}
+
+// ConfigureMwan3FailoverWithReader sets up mwan3 failover using the provided reader.
+func ConfigureMwan3FailoverWithReader(policy string, uplinks []Mwan3Uplink, reader Mwan3ConfigReader) (bool, error) {
+	if err := validateMwan3Section("policy", policy); err != nil {
+		return false, err
+	}
+	if len(uplinks) == 0 {
+		return false, newValidationError("mwan3 failover needs at least one uplink")
+	}
+
+	members := make([]UCIMwan3Member, 0, len(uplinks))
+	seen := make(map[string]bool, len(uplinks))
+	for i, uplink := range uplinks {
+		if err := validateMwan3Section("interface", uplink.Interface); err != nil {
+			return false, err
+		}
+		if seen[uplink.Interface] {
+			return false, newValidationError("uplink %q is listed twice", uplink.Interface)
+		}
+		seen[uplink.Interface] = true
+
+		metric, weight := uplink.Metric, uplink.Weight
+		if metric == 0 {
+			metric = i + 1
+		}
+		if weight == 0 {
+			weight = 1
+		}
+		member := UCIMwan3Member{
+			Name:      mwan3MemberName(uplink.Interface, metric, weight),
+			Interface: uplink.Interface,
+			Metric:    strconv.Itoa(metric),
+			Weight:    strconv.Itoa(weight),
+		}
+		if err := validateMwan3Member(&member); err != nil {
+			return false, err
+		}
+		members = append(members, member)
+	}
+
+	changed := false
+	stage := func(secType, name string, options []uciOption, lists map[string][]string) error {
+		set, err := stageMwan3Section(reader, secType, name, options, lists)
+		changed = changed || set
+		return err
+	}
+
+	useMember := make([]string, 0, len(members))
+	for i, uplink := range uplinks {
+		iface := UCIMwan3Interface{Name: uplink.Interface, Enabled: "1", Family: "ipv4", TrackIP: uplink.TrackIP}
+		if len(uplink.TrackIP) > 0 {
+			iface.Reliability = "1"
+		}
+		options, lists := mwan3InterfaceOptions(&iface)
+		if err := stage("interface", iface.Name, options, lists); err != nil {
+			return false, err
+		}
+		if err := stage("member", members[i].Name, mwan3MemberOptions(&members[i]), nil); err != nil {
+			return false, err
+		}
+		useMember = append(useMember, members[i].Name)
+	}
+
+	if err := stage("policy", policy, []uciOption{
+		{name: "last_resort", typ: uci.TypeOption, value: "unreachable"},
+	}, map[string][]string{
+		"use_member": useMember,
+	}); err != nil {
+		return false, err
+	}
+
+	if err := stage("rule", mwan3DefaultRule, []uciOption{
+		{name: "dest_ip", typ: uci.TypeOption, value: "0.0.0.0/0"},
+		{name: "family", typ: uci.TypeOption, value: "ipv4"},
+		{name: "use_policy", typ: uci.TypeOption, value: policy},
+	}, nil); err != nil {
+		return false, err
+	}
+
+	if !changed {
+		return false, nil
+	}
+
+	if err := reader.Commit(); err != nil {
+		return false, newCommitError(mwan3ConfigName, err)
+	}
+
+	return true, nil
+}
+
+// RestartMwan3 applies the mwan3 configuration by restarting the mwan3 service,
+// which rebuilds its routing tables and rules and restarts interface tracking.
+//
+// Returns an ErrReloadFailed if the restart could not be run.
+func RestartMwan3() error {
+	if err := safemode.Check("restart mwan3"); err != nil {
+		return err
+	}
+
+	return runInitScript(context.Background(), "mwan3", "restart")
+}
@@ -0,0 +1,187 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/digineo/go-uci/v2"
+)
+
+const testMwan3Config = `
+config globals 'globals'
+	option mmx_mask '0x3F00'
+
+config interface 'wan'
+	option enabled '1'
+	option family 'ipv4'
+	list track_ip '8.8.8.8'
+	option reliability '1'
+
+config member 'wan_m1_w3'
+	option interface 'wan'
+	option metric '1'
+	option weight '3'
+
+config policy 'wan_only'
+	list use_member 'wan_m1_w3'
+
+config rule 'https'
+	option sticky '1'
+	option dest_port '443'
+	option proto 'tcp'
+	option use_policy 'wan_only'
+
+config rule 'default_rule_v4'
+	option dest_ip '0.0.0.0/0'
+	option use_policy 'wan_only'
+	option family 'ipv4'
+`
+
+func TestGetMwan3WithReader(t *testing.T) {
+	reader := NewUCIMwan3ConfigReaderWithTree(uci.NewTree(writeTestConfig(t, "mwan3", testMwan3Config)))
+
+	ifaces, err := GetMwan3InterfacesWithReader(reader)
+	if err != nil {
+		t.Fatalf("GetMwan3InterfacesWithReader() error = %v", err)
+	}
+	wantIfaces := []UCIMwan3Interface{{Name: "wan", Enabled: "1", Family: "ipv4", TrackIP: []string{"8.8.8.8"}, Reliability: "1"}}
+	if !reflect.DeepEqual(ifaces, wantIfaces) {
+		t.Errorf("interfaces = %+v, want %+v", ifaces, wantIfaces)
+	}
+
+	members, _ := GetMwan3MembersWithReader(reader)
+	wantMembers := []UCIMwan3Member{{Name: "wan_m1_w3", Interface: "wan", Metric: "1", Weight: "3"}}
+	if !reflect.DeepEqual(members, wantMembers) {
+		t.Errorf("members = %+v, want %+v", members, wantMembers)
+	}
+
+	policies, _ := GetMwan3PoliciesWithReader(reader)
+	wantPolicies := []UCIMwan3Policy{{Name: "wan_only", UseMember: []string{"wan_m1_w3"}}}
+	if !reflect.DeepEqual(policies, wantPolicies) {
+		t.Errorf("policies = %+v, want %+v", policies, wantPolicies)
+	}
+
+	rules, _ := GetMwan3RulesWithReader(reader)
+	if len(rules) != 2 || rules[0].Name != "https" || rules[0].DestPort != "443" || rules[1].Name != mwan3DefaultRule {
+		t.Errorf("rules = %+v, want https then %s", rules, mwan3DefaultRule)
+	}
+}
+
+func TestConfigureMwan3FailoverWithReader(t *testing.T) {
+	dir := writeTestConfig(t, "mwan3", testMwan3Config)
+	reader := NewUCIMwan3ConfigReaderWithTree(uci.NewTree(dir))
+	uplinks := []Mwan3Uplink{
+		{Interface: "wan", TrackIP: []string{"1.1.1.1", "8.8.8.8"}},
+		{Interface: "lte", TrackIP: []string{"1.1.1.1"}},
+	}
+
+	changed, err := ConfigureMwan3FailoverWithReader("failover", uplinks, reader)
+	if err != nil {
+		t.Fatalf("ConfigureMwan3FailoverWithReader() error = %v", err)
+	}
+	if !changed {
+		t.Error("ConfigureMwan3FailoverWithReader() changed = false, want true")
+	}
+
+	fresh := NewUCIMwan3ConfigReaderWithTree(uci.NewTree(dir))
+
+	ifaces, _ := GetMwan3InterfacesWithReader(fresh)
+	wantIfaces := []UCIMwan3Interface{
+		{Name: "wan", Enabled: "1", Family: "ipv4", TrackIP: []string{"1.1.1.1", "8.8.8.8"}, Reliability: "1"},
+		{Name: "lte", Enabled: "1", Family: "ipv4", TrackIP: []string{"1.1.1.1"}, Reliability: "1"},
+	}
+	if !reflect.DeepEqual(ifaces, wantIfaces) {
+		t.Errorf("interfaces = %+v, want %+v", ifaces, wantIfaces)
+	}
+
+	members, _ := GetMwan3MembersWithReader(fresh)
+	var names []string
+	for _, m := range members {
+		names = append(names, m.Name)
+	}
+	// The existing member is left alone
+	if want := []string{"wan_m1_w3", "wan_m1_w1", "lte_m2_w1"}; !slices.Equal(names, want) {
+		t.Errorf("members = %v, want %v", names, want)
+	}
+
+	policies, _ := GetMwan3PoliciesWithReader(fresh)
+	want := UCIMwan3Policy{Name: "failover", UseMember: []string{"wan_m1_w1", "lte_m2_w1"}, LastResort: "unreachable"}
+	if len(policies) != 2 || !reflect.DeepEqual(policies[1], want) {
+		t.Errorf("policies = %+v, want wan_only and %+v", policies, want)
+	}
+
+	rules, _ := GetMwan3RulesWithReader(fresh)
+	if len(rules) != 2 || rules[0].UsePolicy != "wan_only" || rules[1].UsePolicy != "failover" {
+		t.Errorf("rules = %+v, want only the default rule moved to failover", rules)
+	}
+
+	changed, err = ConfigureMwan3FailoverWithReader("failover", uplinks, reader)
+	if err != nil || changed {
+		t.Errorf("ConfigureMwan3FailoverWithReader() again = %v, %v, want false, nil", changed, err)
+	}
+}
+
+func TestConfigureMwan3FailoverWithReader_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  string
+		uplinks []Mwan3Uplink
+	}{
+		{"no uplinks", "failover", nil},
+		{"bad policy name", "fail-over", []Mwan3Uplink{{Interface: "wan"}}},
+		{"no interface", "failover", []Mwan3Uplink{{Metric: 1}}},
+		{"duplicate", "failover", []Mwan3Uplink{{Interface: "wan"}, {Interface: "wan"}}},
+		{"metric", "failover", []Mwan3Uplink{{Interface: "wan", Metric: 300}}},
+		{"weight", "failover", []Mwan3Uplink{{Interface: "wan", Weight: -1}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := NewUCIMwan3ConfigReaderWithTree(uci.NewTree(writeTestConfig(t, "mwan3", testMwan3Config)))
+
+			if _, err := ConfigureMwan3FailoverWithReader(tt.policy, tt.uplinks, reader); !errors.Is(err, ErrValidation) {
+				t.Errorf("ConfigureMwan3FailoverWithReader() error = %v, want ErrValidation", err)
+			}
+			if got := reader.Changes(); len(got) != 0 {
+				t.Errorf("staged changes = %v, want none", got)
+			}
+		})
+	}
+}
+
+func TestDeleteMwan3SectionWithReader(t *testing.T) {
+	reader := NewUCIMwan3ConfigReaderWithTree(uci.NewTree(writeTestConfig(t, "mwan3", testMwan3Config)))
+
+	// A section of another type is not deleted
+	if deleted, err := DeleteMwan3SectionWithReader("rule", "wan_m1_w3", reader); err != nil || deleted {
+		t.Errorf("DeleteMwan3SectionWithReader(rule) = %v, %v, want false, nil", deleted, err)
+	}
+
+	deleted, err := DeleteMwan3SectionWithReader("member", "wan_m1_w3", reader)
+	if err != nil || !deleted {
+		t.Fatalf("DeleteMwan3SectionWithReader() = %v, %v, want true, nil", deleted, err)
+	}
+	if members, _ := GetMwan3MembersWithReader(reader); len(members) != 0 {
+		t.Errorf("members after delete = %+v", members)
+	}
+}
+
+func TestRestartMwan3_Ubus(t *testing.T) {
+	var args any
+	orig := ubusCall
+	ubusCall = func(ctx context.Context, object, method string, a any) (map[string]any, error) {
+		args = a
+		return nil, nil
+	}
+	t.Cleanup(func() { ubusCall = orig })
+
+	if err := RestartMwan3(); err != nil {
+		t.Fatalf("RestartMwan3() error = %v", err)
+	}
+	if want := map[string]any{"name": "mwan3", "action": "restart"}; !reflect.DeepEqual(args, want) {
+		t.Errorf("rc init args = %v, want %v", args, want)
+	}
+}
@@ -1,15 +1,17 @@
 package network
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"math/rand"
-	"net"
 	"os/exec"
-	"time"
+	"slices"
+	"strings"
 
 	"github.com/digineo/go-uci/v2"
 	"github.com/openmanet/go-alfred"
 	proto "github.com/openmanet/openmanetd/internal/api/openmanet/v1"
+	"github.com/openmanet/openmanetd/internal/safemode"
 )
 
 const (
@@ -26,15 +28,20 @@ const (
 
 // UCINetworkConfig represents the UCI network configuration.
 type UCINetwork struct {
-	Proto          string `uci:"option proto"`
-	NetMask        string `uci:"option netmask"`
-	IPAddr         string `uci:"option ipaddr"`
-	Gateway        string `uci:"option gateway"`
-	DNS            string `uci:"option dns"`
-	Device         string `uci:"option device"`
-	IPV6Assignment string `uci:"option ip6assign"`
-	IPV6IfaceID    string `uci:"option ip6ifaceid"`
-	IPV6Class      string `uci:"list ip6class"`
+	Proto   string `uci:"option proto" json:"proto,omitempty"`
+	NetMask string `uci:"option netmask" json:"netmask,omitempty"`
+	IPAddr  string `uci:"option ipaddr" json:"ipaddr,omitempty"`
+	Gateway string `uci:"option gateway" json:"gateway,omitempty"`
+	// DNS are the DNS servers in order of preference. netifd also takes them
+	// space separated in a single option, which is read as the same list.
+	DNS            []string `uci:"list dns" json:"dns,omitempty"`
+	Device         string   `uci:"option device" json:"device,omitempty"`
+	IPV6Assignment string   `uci:"option ip6assign" json:"ip6assign,omitempty"`
+	IPV6IfaceID    string   `uci:"option ip6ifaceid" json:"ip6ifaceid,omitempty"`
+	IPV6Class      string   `uci:"list ip6class" json:"ip6class,omitempty"`
+	// SecondaryIPAddrs are the addresses after IPAddr when ipaddr is a list, in CIDR
+	// notation, e.g. "10.41.254.1/24".
+	SecondaryIPAddrs []string `uci:"list ipaddr" json:"secondary_ipaddrs,omitempty"`
 }
 
 // ConfigReader defines an interface for reading UCI configuration values.
@@ -51,41 +58,80 @@ type ConfigReader interface {
 // UCINetworkConfigReader wraps the UCI functions for network configuration.
 type UCINetworkConfigReader struct {
 	tree uci.Tree
+	changeLog
 }
 
 // NewUCINetworkConfigReader creates a new UCI network config reader with the default tree.
 func NewUCINetworkConfigReader() *UCINetworkConfigReader {
+	return NewUCINetworkConfigReaderWithTree(uci.NewTree(uci.DefaultTreePath))
+}
+
+// NewUCINetworkConfigReaderWithTree creates a UCI network config reader on tree, so that
+// several readers can share one tree or read a tree outside the default path.
+func NewUCINetworkConfigReaderWithTree(tree uci.Tree) *UCINetworkConfigReader {
 	return &UCINetworkConfigReader{
-		tree: uci.NewTree(uci.DefaultTreePath),
+		tree: tree,
 	}
 }
 
+func (r *UCINetworkConfigReader) GetSections(config, secType string) ([]string, error) {
+	return r.tree.GetSections(config, secType)
+}
+
 func (r *UCINetworkConfigReader) Get(config, section, option string) ([]string, bool) {
-	return r.tree.Get(config, section, option)
+	return r.get(r.tree, config, section, option)
 }
 
 func (r *UCINetworkConfigReader) SetType(config, section, option string, typ uci.OptionType, values ...string) error {
-	return r.tree.SetType(config, section, option, typ, values...)
+	if err := safemode.Check(fmt.Sprintf("uci set %s.%s.%s", config, section, option)); err != nil {
+		return err
+	}
+	return r.setType(r.tree, config, section, option, typ, values...)
 }
 
 func (r *UCINetworkConfigReader) Del(config, section, option string) error {
-	return r.tree.Del(config, section, option)
+	if err := safemode.Check(fmt.Sprintf("uci delete %s.%s.%s", config, section, option)); err != nil {
+		return err
+	}
+	return r.del(r.tree, config, section, option)
 }
 
 func (r *UCINetworkConfigReader) AddSection(config, section, typ string) error {
-	return r.tree.AddSection(config, section, typ)
+	if err := safemode.Check(fmt.Sprintf("uci add %s.%s", config, section)); err != nil {
+		return err
+	}
+	return r.addSection(r.tree, config, section, typ)
 }
 
 func (r *UCINetworkConfigReader) DelSection(config, section string) error {
-	return r.tree.DelSection(config, section)
+	if err := safemode.Check(fmt.Sprintf("uci delete %s.%s", config, section)); err != nil {
+		return err
+	}
+	return r.delSection(r.tree, config, section)
 }
 
+// Commit writes staged changes to disk. Failures caused by a read-only
+// filesystem are reported as ErrReadOnlyFS.
 func (r *UCINetworkConfigReader) Commit() error {
-	return r.tree.Commit()
+	if err := safemode.Check("uci commit"); err != nil {
+		return err
+	}
+	return classifyCommitError(r.commit(r.tree))
 }
 
 func (r *UCINetworkConfigReader) ReloadConfig() error {
-	return r.tree.LoadConfig(networkConfigName, true)
+	if err := r.tree.LoadConfig(networkConfigName, true); err != nil {
+		return err
+	}
+	r.reset(networkConfigName)
+	return nil
+}
+
+// Revert discards the network changes staged since the last commit. The config is
+// read from disk again on next use.
+func (r *UCINetworkConfigReader) Revert() {
+	r.tree.Revert(networkConfigName)
+	r.reset(networkConfigName)
 }
 
 // GetUCINetworkByName loads and returns the UCI network configuration by name.
@@ -118,12 +164,15 @@ func GetUCINetworkByNameWithReader(name string, reader ConfigReader) (*UCINetwor
 	}
 	if values, ok := reader.Get(networkConfigName, name, "ipaddr"); ok && len(values) > 0 {
 		config.IPAddr = values[0]
+		if len(values) > 1 {
+			config.SecondaryIPAddrs = slices.Clone(values[1:])
+		}
 	}
 	if values, ok := reader.Get(networkConfigName, name, "gateway"); ok && len(values) > 0 {
 		config.Gateway = values[0]
 	}
 	if values, ok := reader.Get(networkConfigName, name, "dns"); ok && len(values) > 0 {
-		config.DNS = values[0]
+		config.DNS = dnsServers(values)
 	}
 	if values, ok := reader.Get(networkConfigName, name, "device"); ok && len(values) > 0 {
 		config.Device = values[0]
@@ -141,13 +190,59 @@ func GetUCINetworkByNameWithReader(name string, reader ConfigReader) (*UCINetwor
 	return &config, nil
 }
 
+// UCINetworkSection is an interface section of the network config with its name.
+type UCINetworkSection struct {
+	// Name is the UCI section name, e.g. "lan"; anonymous sections are named as
+	// "@interface[0]". It is not an option.
+	Name string `json:"name"`
+	UCINetwork
+}
+
+// GetAllUCINetworks loads and returns every interface section of the network
+// config in file order, so that callers need not know the section names.
+//
+// Example:
+//
+//	networks, err := GetAllUCINetworks()
+//	for _, n := range networks {
+//	    fmt.Printf("%s: %s %s\n", n.Name, n.Proto, n.IPAddr)
+//	}
+func GetAllUCINetworks() ([]UCINetworkSection, error) {
+	return GetAllUCINetworksWithReader(NewUCINetworkConfigReader())
+}
+
+// GetAllUCINetworksWithReader loads and returns every interface section using the
+// provided reader.
+func GetAllUCINetworksWithReader(reader DeviceConfigReader) ([]UCINetworkSection, error) {
+	sections, err := reader.GetSections(networkConfigName, "interface")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read network interfaces: %w", err)
+	}
+
+	networks := make([]UCINetworkSection, 0, len(sections))
+	for _, section := range sections {
+		config, err := GetUCINetworkByNameWithReader(section, reader)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, UCINetworkSection{Name: section, UCINetwork: *config})
+	}
+
+	return networks, nil
+}
+
 // SetNetworkConfig creates or updates a network interface configuration.
 //
 // Parameters:
 //   - section: The UCI section name (e.g., "lan", "wan", "ahwlan")
 //   - config: The network configuration to set
 //
-// Returns an error if the configuration cannot be saved.
+// Returns true if any option changed and the configuration was committed. Options
+// that already hold the requested value are not written, and nothing is committed
+// when no option changed. Every field that is set is checked first, as by the
+// single-option setters; a malformed one is reported as an *ErrInvalidOption,
+// which wraps ErrValidation, and nothing is written. Secondary addresses the
+// section holds are kept unless SecondaryIPAddrs is set, which replaces them.
 //
 // Example:
 //
@@ -156,73 +251,125 @@ func GetUCINetworkByNameWithReader(name string, reader ConfigReader) (*UCINetwor
 //	    IPAddr:  "192.168.1.1",
 //	    NetMask: "255.255.255.0",
 //	}
-//	err := SetNetworkConfig("lan", netConfig)
+//	changed, err := SetNetworkConfig("lan", netConfig)
 //
 // Note: This operation requires appropriate privileges and commits the configuration.
-func SetNetworkConfig(section string, config *UCINetwork) error {
+func SetNetworkConfig(section string, config *UCINetwork) (bool, error) {
 	return SetNetworkConfigWithReader(section, config, NewUCINetworkConfigReader())
 }
 
 // SetNetworkConfigWithReader creates or updates a network interface configuration using the provided reader.
-func SetNetworkConfigWithReader(section string, config *UCINetwork, reader ConfigReader) error {
+func SetNetworkConfigWithReader(section string, config *UCINetwork, reader ConfigReader) (bool, error) {
 	if config == nil {
-		return fmt.Errorf("config cannot be nil")
+		return false, newValidationError("config cannot be nil")
+	}
+	if err := validateUCINetwork(section, config); err != nil {
+		return false, err
+	}
+	for _, addr := range config.SecondaryIPAddrs {
+		if err := validateSecondaryIPAddr(section, addr); err != nil {
+			return false, err
+		}
+	}
+	if len(config.SecondaryIPAddrs) > 0 && config.IPAddr == "" && len(networkIPAddrs(reader, section)) == 0 {
+		return false, newValidationError("secondary addresses of network section %q need a primary address", section)
 	}
 
 	// Add section if it doesn't exist (this will fail silently if it exists)
 	_ = reader.AddSection(networkConfigName, section, "interface")
 
-	if config.Proto != "" {
-		if err := reader.SetType(networkConfigName, section, "proto", uci.TypeOption, config.Proto); err != nil {
-			return fmt.Errorf("failed to set proto: %w", err)
-		}
+	changed, err := setOptionsIfChanged(reader, networkConfigName, section, []uciOption{
+		{name: "proto", typ: uci.TypeOption, value: config.Proto},
+		{name: "netmask", typ: uci.TypeOption, value: config.NetMask},
+	})
+	if err != nil {
+		return false, err
 	}
-	if config.NetMask != "" {
-		if err := reader.SetType(networkConfigName, section, "netmask", uci.TypeOption, config.NetMask); err != nil {
-			return fmt.Errorf("failed to set netmask: %w", err)
+
+	if config.IPAddr != "" || len(config.SecondaryIPAddrs) > 0 {
+		addrs := networkIPAddrs(reader, section)
+		if config.IPAddr != "" {
+			addrs = replacePrimaryIPAddr(addrs, config.IPAddr)
 		}
-	}
-	if config.IPAddr != "" {
-		if err := reader.SetType(networkConfigName, section, "ipaddr", uci.TypeOption, config.IPAddr); err != nil {
-			return fmt.Errorf("failed to set ipaddr: %w", err)
+		if len(config.SecondaryIPAddrs) > 0 {
+			addrs = append(addrs[:1], config.SecondaryIPAddrs...)
 		}
-	}
-	if config.Gateway != "" {
-		if err := reader.SetType(networkConfigName, section, "gateway", uci.TypeOption, config.Gateway); err != nil {
-			return fmt.Errorf("failed to set gateway: %w", err)
+		set, err := setNetworkIPAddrs(reader, section, addrs)
+		if err != nil {
+			return false, err
 		}
+		changed = changed || set
 	}
-	if config.DNS != "" {
-		if err := reader.SetType(networkConfigName, section, "dns", uci.TypeOption, config.DNS); err != nil {
-			return fmt.Errorf("failed to set dns: %w", err)
-		}
+
+	set, err := setOptionsIfChanged(reader, networkConfigName, section, []uciOption{
+		{name: "gateway", typ: uci.TypeOption, value: config.Gateway},
+		{name: "device", typ: uci.TypeOption, value: config.Device},
+		{name: "ip6assign", typ: uci.TypeOption, value: config.IPV6Assignment},
+		{name: "ip6ifaceid", typ: uci.TypeOption, value: config.IPV6IfaceID},
+		{name: "ip6class", typ: uci.TypeList, value: config.IPV6Class},
+	})
+	if err != nil {
+		return false, err
 	}
-	if config.Device != "" {
-		if err := reader.SetType(networkConfigName, section, "device", uci.TypeOption, config.Device); err != nil {
-			return fmt.Errorf("failed to set device: %w", err)
+	changed = changed || set
+
+	if len(config.DNS) > 0 {
+		set, err := setNetworkDNSServers(reader, section, config.DNS)
+		if err != nil {
+			return false, err
 		}
+		changed = changed || set
 	}
-	if config.IPV6Assignment != "" {
-		if err := reader.SetType(networkConfigName, section, "ip6assign", uci.TypeOption, config.IPV6Assignment); err != nil {
-			return fmt.Errorf("failed to set ip6assign: %w", err)
-		}
+
+	if !changed {
+		return false, nil
 	}
-	if config.IPV6IfaceID != "" {
-		if err := reader.SetType(networkConfigName, section, "ip6ifaceid", uci.TypeOption, config.IPV6IfaceID); err != nil {
-			return fmt.Errorf("failed to set ip6ifaceid: %w", err)
-		}
+
+	if err := reader.Commit(); err != nil {
+		return false, newCommitError(networkConfigName, err)
 	}
-	if config.IPV6Class != "" {
-		if err := reader.SetType(networkConfigName, section, "ip6class", uci.TypeList, config.IPV6Class); err != nil {
-			return fmt.Errorf("failed to set ip6class: %w", err)
-		}
+
+	return true, nil
+}
+
+// SetNetworkConfigContext is SetNetworkConfig that gives up when ctx is done. ctx is
+// checked before anything is staged and again before the commit; changes staged by
+// then are dropped rather than left for the next commit of the tree.
+//
+// Returns the error of ctx if it is done.
+//
+// Example:
+//
+//	changed, err := SetNetworkConfigContext(ctx, "lan", netConfig)
+//	if errors.Is(err, context.Canceled) {
+//	    return
+//	}
+func SetNetworkConfigContext(ctx context.Context, section string, config *UCINetwork) (bool, error) {
+	return SetNetworkConfigContextWithReader(ctx, section, config, NewUCINetworkConfigReader())
+}
+
+// SetNetworkConfigContextWithReader creates or updates a network interface
+// configuration using the provided reader, giving up when ctx is done.
+func SetNetworkConfigContextWithReader(ctx context.Context, section string, config *UCINetwork, reader ConfigReader) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
 	}
 
-	if err := reader.Commit(); err != nil {
-		return fmt.Errorf("failed to commit network config: %w", err)
+	tx := NewTransaction(networkConfigName, reader)
+	if _, err := SetNetworkConfigWithReader(section, config, tx); err != nil {
+		return false, err
 	}
 
-	return nil
+	if err := ctx.Err(); err != nil {
+		if tx.Staged() {
+			if discardErr := tx.Discard(); discardErr != nil {
+				return false, errors.Join(err, discardErr)
+			}
+		}
+		return false, err
+	}
+
+	return tx.Apply()
 }
 
 // DeleteNetworkConfig removes a network interface configuration section.
@@ -247,11 +394,11 @@ func DeleteNetworkConfig(section string) error {
 // DeleteNetworkConfigWithReader removes a network interface configuration section using the provided reader.
 func DeleteNetworkConfigWithReader(section string, reader ConfigReader) error {
 	if err := reader.DelSection(networkConfigName, section); err != nil {
-		return fmt.Errorf("failed to delete network section: %w", err)
+		return newSectionError("delete", networkConfigName, section, err)
 	}
 
 	if err := reader.Commit(); err != nil {
-		return fmt.Errorf("failed to commit network config: %w", err)
+		return newCommitError(networkConfigName, err)
 	}
 
 	return nil
@@ -297,18 +444,24 @@ func SetNetworkProto(section, proto string) error {
 
 // SetNetworkProtoWithReader sets the protocol using the provided reader.
 func SetNetworkProtoWithReader(section, proto string, reader ConfigReader) error {
-	if err := reader.SetType(networkConfigName, section, "proto", uci.TypeOption, proto); err != nil {
-		return fmt.Errorf("failed to set proto: %w", err)
+	if err := validateNetworkOption(section, "proto", proto); err != nil {
+		return err
+	}
+
+	changed, err := setOptionIfChanged(reader, networkConfigName, section, "proto", uci.TypeOption, proto)
+	if err != nil || !changed {
+		return err
 	}
 
 	if err := reader.Commit(); err != nil {
-		return fmt.Errorf("failed to commit network config: %w", err)
+		return newCommitError(networkConfigName, err)
 	}
 
 	return nil
 }
 
-// SetNetworkIPAddr sets the IP address for a network interface.
+// SetNetworkIPAddr sets the primary IP address for a network interface. Secondary
+// addresses of an ipaddr list are kept.
 //
 // Parameters:
 //   - section: The UCI section name (e.g., "lan", "wan")
@@ -323,12 +476,17 @@ func SetNetworkIPAddr(section, ipaddr string) error {
 
 // SetNetworkIPAddrWithReader sets the IP address using the provided reader.
 func SetNetworkIPAddrWithReader(section, ipaddr string, reader ConfigReader) error {
-	if err := reader.SetType(networkConfigName, section, "ipaddr", uci.TypeOption, ipaddr); err != nil {
-		return fmt.Errorf("failed to set ipaddr: %w", err)
+	if err := validateNetworkOption(section, "ipaddr", ipaddr); err != nil {
+		return err
+	}
+
+	changed, err := setNetworkIPAddrs(reader, section, replacePrimaryIPAddr(networkIPAddrs(reader, section), ipaddr))
+	if err != nil || !changed {
+		return err
 	}
 
 	if err := reader.Commit(); err != nil {
-		return fmt.Errorf("failed to commit network config: %w", err)
+		return newCommitError(networkConfigName, err)
 	}
 
 	return nil
@@ -349,12 +507,17 @@ func SetNetworkNetmask(section, netmask string) error {
 
 // SetNetworkNetmaskWithReader sets the netmask using the provided reader.
 func SetNetworkNetmaskWithReader(section, netmask string, reader ConfigReader) error {
-	if err := reader.SetType(networkConfigName, section, "netmask", uci.TypeOption, netmask); err != nil {
-		return fmt.Errorf("failed to set netmask: %w", err)
+	if err := validateNetworkOption(section, "netmask", netmask); err != nil {
+		return err
+	}
+
+	changed, err := setOptionIfChanged(reader, networkConfigName, section, "netmask", uci.TypeOption, netmask)
+	if err != nil || !changed {
+		return err
 	}
 
 	if err := reader.Commit(); err != nil {
-		return fmt.Errorf("failed to commit network config: %w", err)
+		return newCommitError(networkConfigName, err)
 	}
 
 	return nil
@@ -375,12 +538,17 @@ func SetNetworkGateway(section, gateway string) error {
 
 // SetNetworkGatewayWithReader sets the gateway using the provided reader.
 func SetNetworkGatewayWithReader(section, gateway string, reader ConfigReader) error {
-	if err := reader.SetType(networkConfigName, section, "gateway", uci.TypeOption, gateway); err != nil {
-		return fmt.Errorf("failed to set gateway: %w", err)
+	if err := validateNetworkOption(section, "gateway", gateway); err != nil {
+		return err
+	}
+
+	changed, err := setOptionIfChanged(reader, networkConfigName, section, "gateway", uci.TypeOption, gateway)
+	if err != nil || !changed {
+		return err
 	}
 
 	if err := reader.Commit(); err != nil {
-		return fmt.Errorf("failed to commit network config: %w", err)
+		return newCommitError(networkConfigName, err)
 	}
 
 	return nil
@@ -408,11 +576,11 @@ func DeleteNetworkGateway(section string) error {
 // DeleteNetworkGatewayWithReader removes the gateway configuration using the provided reader.
 func DeleteNetworkGatewayWithReader(section string, reader ConfigReader) error {
 	if err := reader.Del(networkConfigName, section, "gateway"); err != nil {
-		return fmt.Errorf("failed to delete gateway: %w", err)
+		return newSetOptionError(networkConfigName, section, "gateway", err)
 	}
 
 	if err := reader.Commit(); err != nil {
-		return fmt.Errorf("failed to commit network config: %w", err)
+		return newCommitError(networkConfigName, err)
 	}
 
 	return nil
@@ -422,7 +590,8 @@ func DeleteNetworkGatewayWithReader(section string, reader ConfigReader) error {
 //
 // Parameters:
 //   - section: The UCI section name (e.g., "lan", "wan")
-//   - dns: The DNS server IP address (e.g., "1.1.1.1")
+//   - dns: The DNS server IP address (e.g., "1.1.1.1"), or several separated by
+//     spaces
 //
 // Example:
 //
@@ -433,17 +602,76 @@ func SetNetworkDNS(section, dns string) error {
 
 // SetNetworkDNSWithReader sets the DNS server using the provided reader.
 func SetNetworkDNSWithReader(section, dns string, reader ConfigReader) error {
-	if err := reader.SetType(networkConfigName, section, "dns", uci.TypeOption, dns); err != nil {
-		return fmt.Errorf("failed to set dns: %w", err)
+	if err := validateNetworkOption(section, "dns", dns); err != nil {
+		return err
+	}
+
+	return SetNetworkDNSServersWithReader(section, strings.Fields(dns), reader)
+}
+
+// SetNetworkDNSServers sets the DNS servers of a network interface, in order of
+// preference. They are written as a list, which replaces a dns option.
+//
+// Returns an ErrInvalidOption error if a server is not an IP address. Nothing is
+// committed when the interface already has these servers in this order.
+//
+// Example:
+//
+//	err := SetNetworkDNSServers("ahwlan", []string{"10.41.0.1", "1.1.1.1"})
+func SetNetworkDNSServers(section string, servers []string) error {
+	return SetNetworkDNSServersWithReader(section, servers, NewUCINetworkConfigReader())
+}
+
+// SetNetworkDNSServersWithReader sets the DNS servers using the provided reader.
+func SetNetworkDNSServersWithReader(section string, servers []string, reader ConfigReader) error {
+	if err := validateNetworkOption(section, "dns", strings.Join(servers, " ")); err != nil {
+		return err
+	}
+
+	changed, err := setNetworkDNSServers(reader, section, servers)
+	if err != nil || !changed {
+		return err
 	}
 
 	if err := reader.Commit(); err != nil {
-		return fmt.Errorf("failed to commit network config: %w", err)
+		return newCommitError(networkConfigName, err)
 	}
 
 	return nil
 }
 
+// dnsServers returns the DNS servers of a dns option or list, splitting entries
+// that hold several servers separated by spaces.
+func dnsServers(values []string) []string {
+	var servers []string
+	for _, value := range values {
+		servers = append(servers, strings.Fields(value)...)
+	}
+	return servers
+}
+
+// setNetworkDNSServers stages servers as the dns list of section. Unlike other
+// lists, the order of DNS servers matters, so a list with the same servers in
+// another order is rewritten. go-uci keeps the type of an option that exists, so
+// the entry is deleted first to turn a dns option into a list.
+//
+// Returns true if the servers were staged, false if section already held them.
+func setNetworkDNSServers(reader ConfigReader, section string, servers []string) (bool, error) {
+	current, _ := reader.Get(networkConfigName, section, "dns")
+	if slices.Equal(dnsServers(current), servers) {
+		return false, nil
+	}
+
+	if err := reader.Del(networkConfigName, section, "dns"); err != nil {
+		return false, newSetOptionError(networkConfigName, section, "dns", err)
+	}
+	if err := reader.SetType(networkConfigName, section, "dns", uci.TypeList, servers...); err != nil {
+		return false, newSetOptionError(networkConfigName, section, "dns", err)
+	}
+
+	return true, nil
+}
+
 // SetNetworkDevice sets the device for a network interface.
 //
 // Parameters:
@@ -459,12 +687,17 @@ func SetNetworkDevice(section, device string) error {
 
 // SetNetworkDeviceWithReader sets the device using the provided reader.
 func SetNetworkDeviceWithReader(section, device string, reader ConfigReader) error {
-	if err := reader.SetType(networkConfigName, section, "device", uci.TypeOption, device); err != nil {
-		return fmt.Errorf("failed to set device: %w", err)
+	if err := validateNetworkOption(section, "device", device); err != nil {
+		return err
+	}
+
+	changed, err := setOptionIfChanged(reader, networkConfigName, section, "device", uci.TypeOption, device)
+	if err != nil || !changed {
+		return err
 	}
 
 	if err := reader.Commit(); err != nil {
-		return fmt.Errorf("failed to commit network config: %w", err)
+		return newCommitError(networkConfigName, err)
 	}
 
 	return nil
@@ -485,12 +718,17 @@ func SetNetworkIPV6Assignment(section, ip6assign string) error {
 
 // SetNetworkIPV6AssignmentWithReader sets the IPv6 assignment using the provided reader.
 func SetNetworkIPV6AssignmentWithReader(section, ip6assign string, reader ConfigReader) error {
-	if err := reader.SetType(networkConfigName, section, "ip6assign", uci.TypeOption, ip6assign); err != nil {
-		return fmt.Errorf("failed to set ip6assign: %w", err)
+	if err := validateNetworkOption(section, "ip6assign", ip6assign); err != nil {
+		return err
+	}
+
+	changed, err := setOptionIfChanged(reader, networkConfigName, section, "ip6assign", uci.TypeOption, ip6assign)
+	if err != nil || !changed {
+		return err
 	}
 
 	if err := reader.Commit(); err != nil {
-		return fmt.Errorf("failed to commit network config: %w", err)
+		return newCommitError(networkConfigName, err)
 	}
 
 	return nil
@@ -511,12 +749,17 @@ func SetNetworkIPV6IfaceID(section, ip6ifaceid string) error {
 
 // SetNetworkIPV6IfaceIDWithReader sets the IPv6 interface ID using the provided reader.
 func SetNetworkIPV6IfaceIDWithReader(section, ip6ifaceid string, reader ConfigReader) error {
-	if err := reader.SetType(networkConfigName, section, "ip6ifaceid", uci.TypeOption, ip6ifaceid); err != nil {
-		return fmt.Errorf("failed to set ip6ifaceid: %w", err)
+	if err := validateNetworkOption(section, "ip6ifaceid", ip6ifaceid); err != nil {
+		return err
+	}
+
+	changed, err := setOptionIfChanged(reader, networkConfigName, section, "ip6ifaceid", uci.TypeOption, ip6ifaceid)
+	if err != nil || !changed {
+		return err
 	}
 
 	if err := reader.Commit(); err != nil {
-		return fmt.Errorf("failed to commit network config: %w", err)
+		return newCommitError(networkConfigName, err)
 	}
 
 	return nil
@@ -537,47 +780,39 @@ func SetNetworkIPV6Class(section, ip6class string) error {
 
 // SetNetworkIPV6ClassWithReader sets the IPv6 class using the provided reader.
 func SetNetworkIPV6ClassWithReader(section, ip6class string, reader ConfigReader) error {
-	if err := reader.SetType(networkConfigName, section, "ip6class", uci.TypeList, ip6class); err != nil {
-		return fmt.Errorf("failed to set ip6class: %w", err)
+	if err := validateNetworkOption(section, "ip6class", ip6class); err != nil {
+		return err
+	}
+
+	changed, err := setOptionIfChanged(reader, networkConfigName, section, "ip6class", uci.TypeList, ip6class)
+	if err != nil || !changed {
+		return err
 	}
 
 	if err := reader.Commit(); err != nil {
-		return fmt.Errorf("failed to commit network config: %w", err)
+		return newCommitError(networkConfigName, err)
 	}
 
 	return nil
 }
 
-// SelectAvailableStaticIP selects an available static IP address from the 10.41.0.0/16 network.
+// CheckPinnedIPAvailable checks that no peer other than selfMAC has reserved the
+// pinned IP in the given address reservation records.
 //
 // Parameters:
 //   - records: Array of Alfred records containing address reservations
-//   - gatewayMode: If true, selects from 10.41.0.0/24 range only. If false (default), selects from entire 10.41.0.0/16 range
-//
-// Returns:
-//   - An available IP address from the specified range
-//   - An error if no available IP can be found
+//   - ip: The pinned address
+//   - selfMAC: This node's MAC, so a stale record of our own reservation is not
+//     treated as a conflict
 //
-// The function excludes:
-//   - Already reserved IP addresses (from StaticIp field in AddressReservation)
-//   - The 10.41.0.0/24 range (when gatewayMode is false)
-//   - The 10.41.253.0/24 range (when gatewayMode is false)
-//   - The 10.41.254.0/24 range (when gatewayMode is false)
-//   - Network address (10.41.0.0)
-//   - Broadcast address (10.41.255.255 or 10.41.0.255)
+// Returns an ErrPinConflict error naming the holder if the address is taken, or nil.
 //
 // Example:
 //
-//	records := []alfred.Record{ /* ... */ }
-//	ip, err := SelectAvailableStaticIP(records, false)
-//	if err != nil {
-//	    log.Fatalf("Failed to select IP: %v", err)
+//	if err := CheckPinnedIPAvailable(records, "10.41.2.10", iface.MAC); err != nil {
+//	    log.Printf("Pin conflict: %v", err)
 //	}
-//	fmt.Printf("Selected IP: %s\n", ip)
-func SelectAvailableStaticIP(records []alfred.Record, gatewayMode bool) (string, error) {
-	// Collect all reserved IP addresses
-	reservedIPs := make(map[string]bool)
-
+func CheckPinnedIPAvailable(records []alfred.Record, ip, selfMAC string) error {
 	for _, record := range records {
 		var addrRes proto.AddressReservation
 		if err := addrRes.UnmarshalVT(record.Data); err != nil {
@@ -585,112 +820,74 @@ func SelectAvailableStaticIP(records []alfred.Record, gatewayMode bool) (string,
 			continue
 		}
 
-		if addrRes.StaticIp != "" {
-			reservedIPs[addrRes.StaticIp] = true
+		if addrRes.StaticIp == ip && addrRes.Mac != selfMAC {
+			return fmt.Errorf("%w: %s is held by %s", ErrPinConflict, ip, addrRes.Mac)
 		}
 	}
 
-	// Define the base network: 10.41.0.0/16
-	baseIP := net.ParseIP(DefaultNetworkAddress)
-	if baseIP == nil {
-		return "", fmt.Errorf("failed to parse base IP")
-	}
-	baseIP = baseIP.To4()
-
-	if gatewayMode {
-		// Gateway mode: only search in 10.41.0.0/24 range
-		for fourthOctet := 1; fourthOctet < 255; fourthOctet++ {
-			candidateIP := fmt.Sprintf("10.41.0.%d", fourthOctet)
+	return nil
+}
 
-			// Check if this IP is already reserved
-			if reservedIPs[candidateIP] {
-				// IP is reserved, continue to next candidate
-				continue
-			}
+// ReloadNetwork reloads the network configuration. netifd is asked to reload over
+// ubus, which only restarts the interfaces whose configuration changed; without
+// ubusd, the '/etc/init.d/network reload' command is run instead.
+//
+// Returns an ErrReloadFailed carrying the *ubus.StatusError of a failed call, or the
+// output of a failed command.
+func ReloadNetwork() error {
+	return ReloadNetworkContext(context.Background())
+}
 
-			// IP is available, return it
-			return candidateIP, nil
-		}
-		return "", fmt.Errorf("no available IP addresses in 10.41.0.0/24 range")
+// ReloadNetworkContext is ReloadNetwork with the ubus call abandoned, or the init
+// script killed, when ctx is done, so that a worker reloading the network does not
+// hold up a shutdown.
+//
+// Example:
+//
+//	if err := ReloadNetworkContext(ctx); errors.Is(err, context.Canceled) {
+//	    return
+//	}
+func ReloadNetworkContext(ctx context.Context) error {
+	if err := safemode.Check("reload network"); err != nil {
+		return err
 	}
 
-	// Normal mode: If there are 1 or fewer records, select a random IP to avoid conflicts
-	// when multiple nodes start simultaneously
-	if len(records) <= 1 {
-		// Initialize random seed
-		rng := rand.New(rand.NewSource(time.Now().UnixNano()))
-
-		// Try to find a random available IP (max 1000 attempts to avoid infinite loop)
-		for attempt := 0; attempt < 1000; attempt++ {
-			// Generate random third octet (1-252, excluding 0, 253, 254, 255)
-			thirdOctet := rng.Intn(252) + 1 // Generates 1-252
-			if thirdOctet == 253 {
-				thirdOctet = 252 // Avoid 253
-			}
-
-			// Generate random fourth octet (1-254)
-			fourthOctet := rng.Intn(254) + 1 // Generates 1-254
-
-			candidateIP := fmt.Sprintf("10.41.%d.%d", thirdOctet, fourthOctet)
-
-			// Check if this IP is already reserved
-			if !reservedIPs[candidateIP] {
-				// IP is available, return it
-				return candidateIP, nil
-			}
-		}
-		// If random selection didn't find an IP, fall through to sequential search
+	if handled, err := callNetifd(ctx, "network", "reload"); handled {
+		return err
 	}
 
-	// Normal mode: iterate through the 10.41.0.0/16 range
-	// We have 256 * 256 = 65536 addresses total
-	// Start from 10.41.1.1 (skip network address and 10.41.0.0/24)
-	for thirdOctet := 1; thirdOctet < 256; thirdOctet++ {
-		// Skip the restricted ranges: 10.41.253.0/24 and 10.41.254.0/24
-		if thirdOctet == 253 || thirdOctet == 254 {
-			continue
-		}
-
-		for fourthOctet := 1; fourthOctet < 255; fourthOctet++ {
-			// Skip broadcast address within each /24 subnet
-			if fourthOctet == 255 {
-				continue
-			}
-
-			candidateIP := fmt.Sprintf("10.41.%d.%d", thirdOctet, fourthOctet)
-
-			// Check if this IP is already reserved
-			if reservedIPs[candidateIP] {
-				// IP is reserved, continue to next candidate
-				continue
-			}
-
-			// IP is available, return it
-			return candidateIP, nil
+	cmd := exec.CommandContext(ctx, "/etc/init.d/network", "reload")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
 		}
+		return newReloadError("network", output, err)
 	}
 
-	return "", fmt.Errorf("no available IP addresses in %s/16 range", DefaultNetworkAddress)
-}
-
-// ReloadNetwork reloads the network configuration by executing the OpenWrt network init script.
-// It calls the '/etc/init.d/network reload' command to apply network configuration changes
-// without restarting the entire network subsystem.
-//
-// Returns an error if the reload command fails to execute or returns a non-zero exit code.
-func ReloadNetwork() error {
-	cmd := exec.Command("/etc/init.d/network", "reload")
-	return cmd.Run()
+	return nil
 }
 
-// RestartNetwork hard restarts the network service by executing the network init script.
-// It runs the '/etc/init.d/network restart' command and returns an error if the
-// command execution fails.
+// RestartNetwork hard restarts the network service, taking every interface down and
+// up again. netifd is asked to restart over ubus; without ubusd, the
+// '/etc/init.d/network restart' command is run instead. Prefer ReloadNetwork, or
+// RestartNetworkInterface when only one interface changed.
 //
 // Returns:
-//   - error: nil if the network restart command succeeds, otherwise returns the error
-//     from command execution
+//   - error: nil if the network restarted, otherwise an ErrReloadFailed carrying the
+//     *ubus.StatusError of a failed call or the output of a failed command
 func RestartNetwork() error {
+	if err := safemode.Check("restart network"); err != nil {
+		return err
+	}
+
+	if handled, err := callNetifd(context.Background(), "network", "restart"); handled {
+		return err
+	}
+
 	cmd := exec.Command("/etc/init.d/network", "restart")
-	return cmd.Run()
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return newReloadError("network", output, err)
+	}
+
+	return nil
 }
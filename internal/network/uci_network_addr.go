@@ -0,0 +1,168 @@
+package network
+
+import (
+	"fmt"
+	"net"
+	"slices"
+
+	"github.com/digineo/go-uci/v2"
+)
+
+// networkIPAddrs returns the ipaddr entries of section in file order: the primary
+// address, then the secondary ones of a list.
+func networkIPAddrs(reader ConfigReader, section string) []string {
+	values, _ := reader.Get(networkConfigName, section, "ipaddr")
+	return slices.Clone(values)
+}
+
+// replacePrimaryIPAddr returns addrs with its first entry, the primary address,
+// replaced by primary.
+func replacePrimaryIPAddr(addrs []string, primary string) []string {
+	if len(addrs) == 0 {
+		return []string{primary}
+	}
+	return append([]string{primary}, addrs[1:]...)
+}
+
+// validateSecondaryIPAddr checks that addr is an IPv4 address in CIDR notation, as
+// netifd requires for the entries of an ipaddr list that netmask does not cover.
+func validateSecondaryIPAddr(section, addr string) error {
+	ip, _, err := net.ParseCIDR(addr)
+	if err != nil || ip.To4() == nil {
+		return newInvalidOptionError(networkConfigName, section, "ipaddr", addr, "not an IPv4 address in CIDR notation")
+	}
+	return nil
+}
+
+// setNetworkIPAddrs stages addrs as the ipaddr of section: a single address as an
+// option, several as a list. go-uci keeps the type of an option that exists, so it
+// is deleted first when the type changes.
+//
+// Returns true if the entries were staged, false if section already held them.
+func setNetworkIPAddrs(reader ConfigReader, section string, addrs []string) (bool, error) {
+	current, _ := reader.Get(networkConfigName, section, "ipaddr")
+	if slices.Equal(current, addrs) {
+		return false, nil
+	}
+
+	typ := uci.TypeOption
+	if len(addrs) > 1 {
+		typ = uci.TypeList
+	}
+	if (len(current) > 1) != (len(addrs) > 1) {
+		if err := reader.Del(networkConfigName, section, "ipaddr"); err != nil {
+			return false, newSetOptionError(networkConfigName, section, "ipaddr", err)
+		}
+	}
+	if err := reader.SetType(networkConfigName, section, "ipaddr", typ, addrs...); err != nil {
+		return false, newSetOptionError(networkConfigName, section, "ipaddr", err)
+	}
+
+	return true, nil
+}
+
+// GetNetworkIPAddrs returns every IPv4 address of the interface section: the
+// primary address first, then the secondary addresses of an ipaddr list.
+//
+// Returns an ErrSectionNotFound error if there is no interface section of that name.
+//
+// Example:
+//
+//	addrs, err := GetNetworkIPAddrs("ahwlan")
+//	// ["10.41.1.5", "10.41.254.1/24"]
+func GetNetworkIPAddrs(section string) ([]string, error) {
+	return GetNetworkIPAddrsWithReader(section, NewUCINetworkConfigReader())
+}
+
+// GetNetworkIPAddrsWithReader returns the IPv4 addresses of an interface section
+// using the provided reader.
+func GetNetworkIPAddrsWithReader(section string, reader ConfigReader) ([]string, error) {
+	if !NetworkSectionExistsWithReader(section, reader) {
+		return nil, fmt.Errorf("%w: network section %q", ErrSectionNotFound, section)
+	}
+	return networkIPAddrs(reader, section), nil
+}
+
+// AddNetworkIPAddr adds a secondary IPv4 address, in CIDR notation, to the interface
+// section. The ipaddr option becomes a list with the primary address first.
+//
+// Returns true if the address was added and the configuration was committed, false
+// if the section holds it already. Returns an *ErrInvalidOption error if addr is not
+// in CIDR notation, and an ErrSectionNotFound error if there is no interface section
+// of that name or it has no primary address to add to.
+//
+// Example:
+//
+//	changed, err := AddNetworkIPAddr("ahwlan", "10.41.254.1/24")
+//
+// Note: This operation requires appropriate privileges and commits the configuration.
+func AddNetworkIPAddr(section, addr string) (bool, error) {
+	return AddNetworkIPAddrWithReader(section, addr, NewUCINetworkConfigReader())
+}
+
+// AddNetworkIPAddrWithReader adds a secondary IPv4 address using the provided reader.
+func AddNetworkIPAddrWithReader(section, addr string, reader ConfigReader) (bool, error) {
+	if err := validateSecondaryIPAddr(section, addr); err != nil {
+		return false, err
+	}
+
+	addrs, err := GetNetworkIPAddrsWithReader(section, reader)
+	if err != nil {
+		return false, err
+	}
+	if len(addrs) == 0 {
+		return false, fmt.Errorf("%w: network section %q has no primary address", ErrSectionNotFound, section)
+	}
+	if slices.Contains(addrs, addr) {
+		return false, nil
+	}
+
+	if _, err := setNetworkIPAddrs(reader, section, append(addrs, addr)); err != nil {
+		return false, err
+	}
+
+	if err := reader.Commit(); err != nil {
+		return false, newCommitError(networkConfigName, err)
+	}
+
+	return true, nil
+}
+
+// RemoveNetworkIPAddr removes a secondary IPv4 address from the interface section.
+// When only the primary address is left, ipaddr becomes a plain option again.
+//
+// Returns true if the address was removed and the configuration was committed,
+// false if the section does not hold it. Returns an ErrValidation error for the
+// primary address, which is changed with SetNetworkIPAddr instead.
+//
+// Note: This operation requires appropriate privileges and commits the configuration.
+func RemoveNetworkIPAddr(section, addr string) (bool, error) {
+	return RemoveNetworkIPAddrWithReader(section, addr, NewUCINetworkConfigReader())
+}
+
+// RemoveNetworkIPAddrWithReader removes a secondary IPv4 address using the provided
+// reader.
+func RemoveNetworkIPAddrWithReader(section, addr string, reader ConfigReader) (bool, error) {
+	addrs, err := GetNetworkIPAddrsWithReader(section, reader)
+	if err != nil {
+		return false, err
+	}
+
+	i := slices.Index(addrs, addr)
+	switch {
+	case i < 0:
+		return false, nil
+	case i == 0:
+		return false, newValidationError("%s is the primary address of network section %q", addr, section)
+	}
+
+	if _, err := setNetworkIPAddrs(reader, section, slices.Delete(addrs, i, i+1)); err != nil {
+		return false, err
+	}
+
+	if err := reader.Commit(); err != nil {
+		return false, newCommitError(networkConfigName, err)
+	}
+
+	return true, nil
+}
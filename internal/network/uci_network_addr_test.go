@@ -0,0 +1,145 @@
+package network
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/digineo/go-uci/v2"
+)
+
+const testNetworkAddrConfig = `
+config interface 'ahwlan'
+	option proto 'static'
+	option ipaddr '10.41.1.5'
+	option netmask '255.255.0.0'
+
+config interface 'guest'
+	option proto 'static'
+	list ipaddr '10.42.0.1/24'
+	list ipaddr '10.42.1.1/24'
+
+config interface 'wan'
+	option proto 'dhcp'
+`
+
+func TestGetNetworkIPAddrsWithReader(t *testing.T) {
+	reader := NewUCINetworkConfigReaderWithTree(uci.NewTree(writeTestConfig(t, "network", testNetworkAddrConfig)))
+
+	tests := []struct {
+		section string
+		want    []string
+	}{
+		{"ahwlan", []string{"10.41.1.5"}},
+		{"guest", []string{"10.42.0.1/24", "10.42.1.1/24"}},
+		{"wan", nil},
+	}
+	for _, tt := range tests {
+		if got, err := GetNetworkIPAddrsWithReader(tt.section, reader); err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("GetNetworkIPAddrsWithReader(%s) = %v, %v, want %v", tt.section, got, err, tt.want)
+		}
+	}
+	if _, err := GetNetworkIPAddrsWithReader("lan", reader); !errors.Is(err, ErrSectionNotFound) {
+		t.Errorf("GetNetworkIPAddrsWithReader(lan) error = %v, want ErrSectionNotFound", err)
+	}
+
+	config, err := GetUCINetworkByNameWithReader("guest", reader)
+	if err != nil || config.IPAddr != "10.42.0.1/24" || !slices.Equal(config.SecondaryIPAddrs, []string{"10.42.1.1/24"}) {
+		t.Errorf("GetUCINetworkByNameWithReader(guest) = %+v, %v", config, err)
+	}
+}
+
+func TestAddAndRemoveNetworkIPAddrWithReader(t *testing.T) {
+	dir := writeTestConfig(t, "network", testNetworkAddrConfig)
+	reader := NewUCINetworkConfigReaderWithTree(uci.NewTree(dir))
+
+	if added, err := AddNetworkIPAddrWithReader("ahwlan", "10.41.254.1/24", reader); err != nil || !added {
+		t.Fatalf("AddNetworkIPAddrWithReader() = %v, %v, want true, nil", added, err)
+	}
+	if added, err := AddNetworkIPAddrWithReader("ahwlan", "10.41.254.1/24", reader); err != nil || added {
+		t.Errorf("AddNetworkIPAddrWithReader() again = %v, %v, want false, nil", added, err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "network"))
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if !strings.Contains(string(data), "list ipaddr '10.41.1.5'") || !strings.Contains(string(data), "list ipaddr '10.41.254.1/24'") {
+		t.Errorf("ipaddr was not written as a list:\n%s", data)
+	}
+
+	fresh := &UCINetworkConfigReader{tree: uci.NewTree(dir)}
+	if got, _ := GetNetworkIPAddrsWithReader("ahwlan", fresh); !slices.Equal(got, []string{"10.41.1.5", "10.41.254.1/24"}) {
+		t.Errorf("addresses after reload = %v", got)
+	}
+
+	// Setting the primary address keeps the secondary ones
+	if err := SetNetworkIPAddrWithReader("ahwlan", "10.41.1.6", fresh); err != nil {
+		t.Fatalf("SetNetworkIPAddrWithReader() error = %v", err)
+	}
+	if got, _ := GetNetworkIPAddrsWithReader("ahwlan", fresh); !slices.Equal(got, []string{"10.41.1.6", "10.41.254.1/24"}) {
+		t.Errorf("addresses after setting the primary = %v", got)
+	}
+
+	if _, err := RemoveNetworkIPAddrWithReader("ahwlan", "10.41.1.6", fresh); !errors.Is(err, ErrValidation) {
+		t.Errorf("RemoveNetworkIPAddrWithReader(primary) error = %v, want ErrValidation", err)
+	}
+	if removed, err := RemoveNetworkIPAddrWithReader("ahwlan", "10.41.254.1/24", fresh); err != nil || !removed {
+		t.Fatalf("RemoveNetworkIPAddrWithReader() = %v, %v, want true, nil", removed, err)
+	}
+	if removed, err := RemoveNetworkIPAddrWithReader("ahwlan", "10.41.254.1/24", fresh); err != nil || removed {
+		t.Errorf("RemoveNetworkIPAddrWithReader() again = %v, %v, want false, nil", removed, err)
+	}
+
+	data, _ = os.ReadFile(filepath.Join(dir, "network"))
+	if !strings.Contains(string(data), "option ipaddr '10.41.1.6'") {
+		t.Errorf("ipaddr was not written back as an option:\n%s", data)
+	}
+}
+
+func TestAddNetworkIPAddrWithReader_Invalid(t *testing.T) {
+	reader := NewUCINetworkConfigReaderWithTree(uci.NewTree(writeTestConfig(t, "network", testNetworkAddrConfig)))
+
+	for _, addr := range []string{"10.41.254.1", "fd00::1/64", "10.41.254.1/33"} {
+		var invalid *ErrInvalidOption
+		if _, err := AddNetworkIPAddrWithReader("ahwlan", addr, reader); !errors.As(err, &invalid) {
+			t.Errorf("AddNetworkIPAddrWithReader(%q) error = %v, want *ErrInvalidOption", addr, err)
+		}
+	}
+	if _, err := AddNetworkIPAddrWithReader("lan", "10.41.254.1/24", reader); !errors.Is(err, ErrSectionNotFound) {
+		t.Errorf("missing section: error = %v, want ErrSectionNotFound", err)
+	}
+	if _, err := AddNetworkIPAddrWithReader("wan", "10.41.254.1/24", reader); !errors.Is(err, ErrSectionNotFound) {
+		t.Errorf("no primary address: error = %v, want ErrSectionNotFound", err)
+	}
+}
+
+func TestSetNetworkConfigWithReader_SecondaryIPAddrs(t *testing.T) {
+	reader := NewUCINetworkConfigReaderWithTree(uci.NewTree(writeTestConfig(t, "network", testNetworkAddrConfig)))
+
+	// Without SecondaryIPAddrs the secondary addresses are kept
+	if _, err := SetNetworkConfigWithReader("guest", &UCINetwork{IPAddr: "10.42.0.2/24"}, reader); err != nil {
+		t.Fatalf("SetNetworkConfigWithReader() error = %v", err)
+	}
+	if got, _ := GetNetworkIPAddrsWithReader("guest", reader); !slices.Equal(got, []string{"10.42.0.2/24", "10.42.1.1/24"}) {
+		t.Errorf("addresses = %v, want the secondary address kept", got)
+	}
+
+	changed, err := SetNetworkConfigWithReader("guest", &UCINetwork{SecondaryIPAddrs: []string{"10.42.2.1/24", "10.42.3.1/24"}}, reader)
+	if err != nil || !changed {
+		t.Fatalf("SetNetworkConfigWithReader(secondary) = %v, %v, want true, nil", changed, err)
+	}
+	if got, _ := GetNetworkIPAddrsWithReader("guest", reader); !slices.Equal(got, []string{"10.42.0.2/24", "10.42.2.1/24", "10.42.3.1/24"}) {
+		t.Errorf("addresses = %v, want the secondary addresses replaced", got)
+	}
+
+	if _, err := SetNetworkConfigWithReader("guest", &UCINetwork{SecondaryIPAddrs: []string{"10.42.2.1"}}, reader); !errors.Is(err, ErrValidation) {
+		t.Errorf("secondary without prefix: error = %v, want ErrValidation", err)
+	}
+	if _, err := SetNetworkConfigWithReader("wan", &UCINetwork{SecondaryIPAddrs: []string{"10.42.2.1/24"}}, reader); !errors.Is(err, ErrValidation) {
+		t.Errorf("secondary without primary: error = %v, want ErrValidation", err)
+	}
+}
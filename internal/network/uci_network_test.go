@@ -1,9 +1,15 @@
 package network
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
+	"os"
+	"path/filepath"
 	"reflect"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/digineo/go-uci/v2"
@@ -35,6 +41,10 @@ type setTypeCall struct {
 	values  []string
 }
 
+func (m *mockConfigReader) GetSections(config, secType string) ([]string, error) {
+	return nil, nil
+}
+
 func (m *mockConfigReader) Get(config, section, option string) ([]string, bool) {
 	if configData, ok := m.data[config]; ok {
 		if sectionData, ok := configData[section]; ok {
@@ -142,6 +152,29 @@ func newMockReader() *mockConfigReader {
 	}
 }
 
+// writeTestConfig writes body as the UCI config name in a temporary directory and
+// returns the directory, for use as the root of a uci.Tree.
+func writeTestConfig(t *testing.T, name, body string) string {
+	t.Helper()
+
+	return writeTestConfigs(t, map[string]string{name: body})
+}
+
+// writeTestConfigs writes each body as the UCI config of its name in one temporary
+// directory and returns the directory, for use as the root of a uci.Tree.
+func writeTestConfigs(t *testing.T, configs map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, body := range configs {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0o644); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+	}
+
+	return dir
+}
+
 func TestGetUCINetworkByNameWithReader_Loopback(t *testing.T) {
 	reader := newMockReader()
 
@@ -168,7 +201,7 @@ func TestGetUCINetworkByNameWithReader_LAN(t *testing.T) {
 		Proto:   "static",
 		NetMask: "255.255.255.0",
 		IPAddr:  "10.42.0.1",
-		DNS:     "1.1.1.1",
+		DNS:     []string{"1.1.1.1"},
 	}
 
 	got, err := GetUCINetworkByNameWithReader("lan", reader)
@@ -204,7 +237,7 @@ func TestGetUCINetworkByNameWithReader_AHWLAN(t *testing.T) {
 		NetMask: "255.255.0.0",
 		IPAddr:  "10.41.237.1",
 		Gateway: "10.41.1.1",
-		DNS:     "1.1.1.1",
+		DNS:     []string{"1.1.1.1"},
 		Device:  "br-ahwlan",
 	}
 
@@ -249,11 +282,11 @@ func TestGetUCINetworkByNameWithReader_Bat0(t *testing.T) {
 
 func TestSetNetworkConfigWithReader(t *testing.T) {
 	tests := []struct {
-		name        string
-		section     string
-		config      *UCINetwork
-		wantErr     bool
-		errContains string
+		name    string
+		section string
+		config  *UCINetwork
+		wantErr bool
+		errIs   error
 	}{
 		{
 			name:    "set_complete_config",
@@ -263,7 +296,7 @@ func TestSetNetworkConfigWithReader(t *testing.T) {
 				IPAddr:  "192.168.1.1",
 				NetMask: "255.255.255.0",
 				Gateway: "192.168.1.254",
-				DNS:     "1.1.1.1",
+				DNS:     []string{"1.1.1.1"},
 				Device:  "br-lan",
 			},
 			wantErr: false,
@@ -277,11 +310,11 @@ func TestSetNetworkConfigWithReader(t *testing.T) {
 			wantErr: false,
 		},
 		{
-			name:        "nil_config",
-			section:     "lan",
-			config:      nil,
-			wantErr:     true,
-			errContains: "config cannot be nil",
+			name:    "nil_config",
+			section: "lan",
+			config:  nil,
+			wantErr: true,
+			errIs:   ErrValidation,
 		},
 	}
 
@@ -291,13 +324,13 @@ func TestSetNetworkConfigWithReader(t *testing.T) {
 				data: make(map[string]map[string]map[string][]string),
 			}
 
-			err := SetNetworkConfigWithReader(tt.section, tt.config, reader)
+			_, err := SetNetworkConfigWithReader(tt.section, tt.config, reader)
 
 			if tt.wantErr {
 				if err == nil {
-					t.Errorf("expected error containing %q, got nil", tt.errContains)
-				} else if tt.errContains != "" && !contains(err.Error(), tt.errContains) {
-					t.Errorf("expected error containing %q, got %q", tt.errContains, err.Error())
+					t.Errorf("expected error %v, got nil", tt.errIs)
+				} else if tt.errIs != nil && !errors.Is(err, tt.errIs) {
+					t.Errorf("expected error %v, got %v", tt.errIs, err)
 				}
 				return
 			}
@@ -337,12 +370,13 @@ func TestSetNetworkConfigWithReader_SetTypeError(t *testing.T) {
 		Proto: "static",
 	}
 
-	err := SetNetworkConfigWithReader("lan", config, reader)
+	_, err := SetNetworkConfigWithReader("lan", config, reader)
 	if err == nil {
 		t.Fatal("expected error, got nil")
 	}
-	if !contains(err.Error(), "failed to set proto") {
-		t.Errorf("expected error about proto, got: %v", err)
+	var setErr *ErrSetOptionFailed
+	if !errors.As(err, &setErr) || setErr.Option != "proto" {
+		t.Errorf("expected ErrSetOptionFailed for proto, got: %v", err)
 	}
 }
 
@@ -356,12 +390,98 @@ func TestSetNetworkConfigWithReader_CommitError(t *testing.T) {
 		Proto: "static",
 	}
 
-	err := SetNetworkConfigWithReader("lan", config, reader)
+	_, err := SetNetworkConfigWithReader("lan", config, reader)
 	if err == nil {
 		t.Fatal("expected error, got nil")
 	}
-	if !contains(err.Error(), "failed to commit network config") {
-		t.Errorf("expected error about commit, got: %v", err)
+	if !errors.Is(err, ErrCommitFailed) || !errors.Is(err, reader.commitError) {
+		t.Errorf("expected ErrCommitFailed wrapping the commit error, got: %v", err)
+	}
+}
+
+func TestSetNetworkConfigContextWithReader(t *testing.T) {
+	config := &UCINetwork{Proto: "static", IPAddr: "10.41.1.1", NetMask: "255.255.0.0"}
+
+	reader := newMockReader()
+	changed, err := SetNetworkConfigContextWithReader(context.Background(), "ahwlan", config, reader)
+	if err != nil || !changed || !reader.commitCalled {
+		t.Fatalf("SetNetworkConfigContextWithReader() = %v, %v, committed %v; want true, nil, committed", changed, err, reader.commitCalled)
+	}
+
+	// Nothing is staged once ctx is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	reader = newMockReader()
+	if _, err := SetNetworkConfigContextWithReader(ctx, "ahwlan", config, reader); !errors.Is(err, context.Canceled) {
+		t.Errorf("SetNetworkConfigContextWithReader() error = %v, want context.Canceled", err)
+	}
+	if len(reader.setTypeCalls) != 0 || reader.commitCalled {
+		t.Errorf("staged %v, committed %v after cancel; want nothing", reader.setTypeCalls, reader.commitCalled)
+	}
+}
+
+func TestSetNetworkConfigWithReader_Unchanged(t *testing.T) {
+	reader := newMockReader()
+
+	changed, err := SetNetworkConfigWithReader("loopback", &UCINetwork{
+		Proto:   "static",
+		IPAddr:  "127.0.0.1",
+		NetMask: "255.0.0.0",
+		Device:  "lo",
+	}, reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if changed {
+		t.Error("expected changed to be false for an already-correct config")
+	}
+	if len(reader.setTypeCalls) != 0 {
+		t.Errorf("expected no SetType calls, got %+v", reader.setTypeCalls)
+	}
+	if reader.commitCalled {
+		t.Error("expected Commit not to be called")
+	}
+}
+
+func TestSetNetworkConfigWithReader_PartiallyChanged(t *testing.T) {
+	reader := newMockReader()
+
+	changed, err := SetNetworkConfigWithReader("loopback", &UCINetwork{
+		Proto:   "static",
+		IPAddr:  "127.0.0.2",
+		NetMask: "255.0.0.0",
+		DNS:     []string{"1.1.1.1"},
+	}, reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !changed {
+		t.Error("expected changed to be true")
+	}
+	if !reader.commitCalled {
+		t.Error("expected Commit to be called")
+	}
+
+	var written []string
+	for _, call := range reader.setTypeCalls {
+		written = append(written, call.option)
+	}
+	if want := []string{"ipaddr", "dns"}; !reflect.DeepEqual(written, want) {
+		t.Errorf("written options = %v, want %v", written, want)
+	}
+}
+
+func TestSetNetworkProtoWithReader_Unchanged(t *testing.T) {
+	reader := newMockReader()
+
+	if err := SetNetworkProtoWithReader("loopback", "static", reader); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(reader.setTypeCalls) != 0 {
+		t.Errorf("expected no SetType calls, got %+v", reader.setTypeCalls)
+	}
+	if reader.commitCalled {
+		t.Error("expected Commit not to be called")
 	}
 }
 
@@ -418,8 +538,8 @@ func TestDeleteNetworkConfigWithReader_DelSectionError(t *testing.T) {
 	if err == nil {
 		t.Fatal("expected error, got nil")
 	}
-	if !contains(err.Error(), "failed to delete network section") {
-		t.Errorf("expected error about delete section, got: %v", err)
+	if !errors.Is(err, reader.delSectionErr) {
+		t.Errorf("expected error wrapping the DelSection error, got: %v", err)
 	}
 }
 
@@ -433,8 +553,8 @@ func TestDeleteNetworkConfigWithReader_CommitError(t *testing.T) {
 	if err == nil {
 		t.Fatal("expected error, got nil")
 	}
-	if !contains(err.Error(), "failed to commit network config") {
-		t.Errorf("expected error about commit, got: %v", err)
+	if !errors.Is(err, ErrCommitFailed) || !errors.Is(err, reader.commitError) {
+		t.Errorf("expected ErrCommitFailed wrapping the commit error, got: %v", err)
 	}
 }
 
@@ -678,8 +798,9 @@ func TestDeleteNetworkGatewayWithReader_DelError(t *testing.T) {
 		t.Fatal("expected error from Del")
 	}
 
-	if !contains(err.Error(), "failed to delete gateway") {
-		t.Errorf("expected error about deleting gateway, got: %v", err)
+	var setErr *ErrSetOptionFailed
+	if !errors.As(err, &setErr) || setErr.Option != "gateway" {
+		t.Errorf("expected ErrSetOptionFailed for gateway, got: %v", err)
 	}
 }
 
@@ -700,8 +821,8 @@ func TestDeleteNetworkGatewayWithReader_CommitError(t *testing.T) {
 		t.Fatal("expected error from Commit")
 	}
 
-	if !contains(err.Error(), "failed to commit network config") {
-		t.Errorf("expected error about committing config, got: %v", err)
+	if !errors.Is(err, ErrCommitFailed) || !errors.Is(err, reader.commitError) {
+		t.Errorf("expected ErrCommitFailed wrapping the commit error, got: %v", err)
 	}
 }
 
@@ -728,6 +849,52 @@ func TestSetNetworkDNSWithReader(t *testing.T) {
 	}
 }
 
+func TestSetNetworkDNSServersWithReader(t *testing.T) {
+	dir := writeTestConfig(t, "network", `
+config interface 'ahwlan'
+	option proto 'static'
+	option dns '1.1.1.1 8.8.8.8'
+`)
+	reader := NewUCINetworkConfigReaderWithTree(uci.NewTree(dir))
+
+	// A space separated option is read as a list
+	cfg, _ := GetUCINetworkByNameWithReader("ahwlan", reader)
+	if want := []string{"1.1.1.1", "8.8.8.8"}; !slices.Equal(cfg.DNS, want) {
+		t.Fatalf("DNS = %v, want %v", cfg.DNS, want)
+	}
+
+	// The same servers are not rewritten
+	if err := SetNetworkDNSServersWithReader("ahwlan", []string{"1.1.1.1", "8.8.8.8"}, reader); err != nil {
+		t.Fatalf("SetNetworkDNSServersWithReader() error = %v", err)
+	}
+	if got := reader.Changes(); len(got) != 0 {
+		t.Errorf("staged changes = %v, want none", got)
+	}
+
+	// A new order is written, as a list
+	if err := SetNetworkDNSServersWithReader("ahwlan", []string{"8.8.8.8", "1.1.1.1"}, reader); err != nil {
+		t.Fatalf("SetNetworkDNSServersWithReader() error = %v", err)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "network"))
+	if !strings.Contains(string(data), "list dns '8.8.8.8'\n\tlist dns '1.1.1.1'") || strings.Contains(string(data), "option dns") {
+		t.Errorf("network config after set:\n%s", data)
+	}
+
+	fresh := &UCINetworkConfigReader{tree: uci.NewTree(dir)}
+	cfg, _ = GetUCINetworkByNameWithReader("ahwlan", fresh)
+	if want := []string{"8.8.8.8", "1.1.1.1"}; !slices.Equal(cfg.DNS, want) {
+		t.Errorf("DNS read back = %v, want %v", cfg.DNS, want)
+	}
+
+	var invalid *ErrInvalidOption
+	if err := SetNetworkDNSServersWithReader("ahwlan", []string{"1.1.1.1", "dns.example"}, reader); !errors.As(err, &invalid) {
+		t.Errorf("SetNetworkDNSServersWithReader() with a name error = %v, want ErrInvalidOption", err)
+	}
+	if err := SetNetworkDNSServersWithReader("ahwlan", nil, reader); !errors.Is(err, ErrValidation) {
+		t.Errorf("SetNetworkDNSServersWithReader(nil) error = %v, want ErrValidation", err)
+	}
+}
+
 func TestSetNetworkDeviceWithReader(t *testing.T) {
 	reader := &mockConfigReader{
 		data: make(map[string]map[string]map[string][]string),
@@ -761,8 +928,9 @@ func TestSetNetworkProtoWithReader_SetTypeError(t *testing.T) {
 	if err == nil {
 		t.Fatal("expected error, got nil")
 	}
-	if !contains(err.Error(), "failed to set proto") {
-		t.Errorf("expected error about proto, got: %v", err)
+	var setErr *ErrSetOptionFailed
+	if !errors.As(err, &setErr) || setErr.Option != "proto" {
+		t.Errorf("expected ErrSetOptionFailed for proto, got: %v", err)
 	}
 }
 
@@ -776,8 +944,8 @@ func TestSetNetworkProtoWithReader_CommitError(t *testing.T) {
 	if err == nil {
 		t.Fatal("expected error, got nil")
 	}
-	if !contains(err.Error(), "failed to commit network config") {
-		t.Errorf("expected error about commit, got: %v", err)
+	if !errors.Is(err, ErrCommitFailed) || !errors.Is(err, reader.commitError) {
+		t.Errorf("expected ErrCommitFailed wrapping the commit error, got: %v", err)
 	}
 }
 
@@ -940,7 +1108,7 @@ func TestSetNetworkConfigWithReader_IPv6Fields(t *testing.T) {
 				data: make(map[string]map[string]map[string][]string),
 			}
 
-			err := SetNetworkConfigWithReader("lan", tt.config, reader)
+			_, err := SetNetworkConfigWithReader("lan", tt.config, reader)
 
 			if (err != nil) != tt.wantErr {
 				t.Errorf("expected error: %v, got: %v", tt.wantErr, err)
@@ -1039,8 +1207,8 @@ func TestSetNetworkIPV6AssignmentWithReader_CommitError(t *testing.T) {
 	if err == nil {
 		t.Fatal("expected error, got nil")
 	}
-	if !contains(err.Error(), "failed to commit network config") {
-		t.Errorf("expected error about commit, got: %v", err)
+	if !errors.Is(err, ErrCommitFailed) || !errors.Is(err, reader.commitError) {
+		t.Errorf("expected ErrCommitFailed wrapping the commit error, got: %v", err)
 	}
 }
 
@@ -1054,8 +1222,9 @@ func TestSetNetworkIPV6IfaceIDWithReader_SetTypeError(t *testing.T) {
 	if err == nil {
 		t.Fatal("expected error, got nil")
 	}
-	if !contains(err.Error(), "failed to set ip6ifaceid") {
-		t.Errorf("expected error about ip6ifaceid, got: %v", err)
+	var setErr *ErrSetOptionFailed
+	if !errors.As(err, &setErr) || setErr.Option != "ip6ifaceid" {
+		t.Errorf("expected ErrSetOptionFailed for ip6ifaceid, got: %v", err)
 	}
 }
 
@@ -1069,26 +1238,12 @@ func TestSetNetworkIPV6ClassWithReader_SetTypeError(t *testing.T) {
 	if err == nil {
 		t.Fatal("expected error, got nil")
 	}
-	if !contains(err.Error(), "failed to set ip6class") {
-		t.Errorf("expected error about ip6class, got: %v", err)
+	var setErr *ErrSetOptionFailed
+	if !errors.As(err, &setErr) || setErr.Option != "ip6class" {
+		t.Errorf("expected ErrSetOptionFailed for ip6class, got: %v", err)
 	}
 }
 
-// Helper function to check if a string contains a substring
-func contains(s, substr string) bool {
-	return len(s) >= len(substr) && (s == substr || len(substr) == 0 ||
-		(len(s) > 0 && len(substr) > 0 && stringContains(s, substr)))
-}
-
-func stringContains(s, substr string) bool {
-	for i := 0; i <= len(s)-len(substr); i++ {
-		if s[i:i+len(substr)] == substr {
-			return true
-		}
-	}
-	return false
-}
-
 func TestSelectAvailableStaticIP(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -1184,10 +1339,10 @@ func TestSelectAvailableStaticIP(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := SelectAvailableStaticIP(tt.records, false)
+			got, err := DefaultMeshAddressing().SelectAvailableStaticIP(tt.records, false)
 
 			if (err != nil) != tt.wantErr {
-				t.Errorf("SelectAvailableStaticIP() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("DefaultMeshAddressing().SelectAvailableStaticIP() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 
@@ -1197,26 +1352,26 @@ func TestSelectAvailableStaticIP(t *testing.T) {
 
 			// Verify the returned IP starts with the expected prefix
 			if len(got) < len(tt.wantPrefix) || got[:len(tt.wantPrefix)] != tt.wantPrefix {
-				t.Errorf("SelectAvailableStaticIP() = %v, want prefix %v", got, tt.wantPrefix)
+				t.Errorf("DefaultMeshAddressing().SelectAvailableStaticIP() = %v, want prefix %v", got, tt.wantPrefix)
 			}
 
 			// Verify the returned IP is not in the avoid list
 			for _, avoidIP := range tt.shouldAvoid {
 				if got == avoidIP {
-					t.Errorf("SelectAvailableStaticIP() = %v, should not return reserved IP %v", got, avoidIP)
+					t.Errorf("DefaultMeshAddressing().SelectAvailableStaticIP() = %v, should not return reserved IP %v", got, avoidIP)
 				}
 			}
 
 			// Verify the IP is not in restricted ranges
 			if len(got) >= 9 {
 				if got[:9] == "10.41.253" || got[:9] == "10.41.254" {
-					t.Errorf("SelectAvailableStaticIP() = %v, should not return IP in restricted range", got)
+					t.Errorf("DefaultMeshAddressing().SelectAvailableStaticIP() = %v, should not return IP in restricted range", got)
 				}
 			}
 
 			// Verify it's a valid IP
 			if ip := net.ParseIP(got); ip == nil {
-				t.Errorf("SelectAvailableStaticIP() = %v, not a valid IP address", got)
+				t.Errorf("DefaultMeshAddressing().SelectAvailableStaticIP() = %v, not a valid IP address", got)
 			}
 		})
 	}
@@ -1233,7 +1388,7 @@ func TestSelectAvailableStaticIP_RestrictedRanges(t *testing.T) {
 		})
 	}
 
-	got, err := SelectAvailableStaticIP(records, false)
+	got, err := DefaultMeshAddressing().SelectAvailableStaticIP(records, false)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -1241,12 +1396,12 @@ func TestSelectAvailableStaticIP_RestrictedRanges(t *testing.T) {
 	// Should select from a different subnet (10.41.1.x since 10.41.0.x is excluded in normal mode)
 	// and not from 253 or 254
 	if len(got) >= 9 && (got[:9] == "10.41.253" || got[:9] == "10.41.254" || got[:9] == "10.41.0.") {
-		t.Errorf("SelectAvailableStaticIP() = %v, should not select from restricted ranges", got)
+		t.Errorf("DefaultMeshAddressing().SelectAvailableStaticIP() = %v, should not select from restricted ranges", got)
 	}
 
 	// Should still be in 10.41.x.x range
 	if len(got) < 6 || got[:6] != "10.41." {
-		t.Errorf("SelectAvailableStaticIP() = %v, should be in 10.41.0.0/16 range", got)
+		t.Errorf("DefaultMeshAddressing().SelectAvailableStaticIP() = %v, should be in 10.41.0.0/16 range", got)
 	}
 }
 
@@ -1255,24 +1410,24 @@ func TestSelectAvailableStaticIP_SelectionOrder(t *testing.T) {
 	// (not deterministic anymore due to randomization when records <= 1)
 	records := []alfred.Record{}
 
-	got, err := SelectAvailableStaticIP(records, false)
+	got, err := DefaultMeshAddressing().SelectAvailableStaticIP(records, false)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
 	// Verify the IP is in the correct range
 	if len(got) < 6 || got[:6] != "10.41." {
-		t.Errorf("SelectAvailableStaticIP() = %v, should be in 10.41.0.0/16 range", got)
+		t.Errorf("DefaultMeshAddressing().SelectAvailableStaticIP() = %v, should be in 10.41.0.0/16 range", got)
 	}
 
 	// Verify it's not in restricted ranges (0, 253, 254)
 	if len(got) >= 9 && (got[:9] == "10.41.0." || got[:9] == "10.41.253" || got[:9] == "10.41.254") {
-		t.Errorf("SelectAvailableStaticIP() = %v, should not be in restricted ranges", got)
+		t.Errorf("DefaultMeshAddressing().SelectAvailableStaticIP() = %v, should not be in restricted ranges", got)
 	}
 
 	// Verify it's a valid IP
 	if ip := net.ParseIP(got); ip == nil {
-		t.Errorf("SelectAvailableStaticIP() = %v, not a valid IP address", got)
+		t.Errorf("DefaultMeshAddressing().SelectAvailableStaticIP() = %v, not a valid IP address", got)
 	}
 }
 
@@ -1293,14 +1448,14 @@ func TestSelectAvailableStaticIP_ExhaustRange(t *testing.T) {
 	}
 
 	// Should still find an IP in 10.41.1.x range
-	got, err := SelectAvailableStaticIP(records, false)
+	got, err := DefaultMeshAddressing().SelectAvailableStaticIP(records, false)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
 	// Verify it's from a different subnet
 	if len(got) >= 8 && got[:8] == "10.41.0." {
-		t.Errorf("SelectAvailableStaticIP() = %v, should select from different subnet", got)
+		t.Errorf("DefaultMeshAddressing().SelectAvailableStaticIP() = %v, should select from different subnet", got)
 	}
 }
 
@@ -1332,24 +1487,24 @@ func TestSelectAvailableStaticIP_Boundaries(t *testing.T) {
 				},
 			}
 
-			got, err := SelectAvailableStaticIP(records, false)
+			got, err := DefaultMeshAddressing().SelectAvailableStaticIP(records, false)
 			if err != nil {
 				t.Fatalf("unexpected error: %v", err)
 			}
 
 			// Verify it's a valid IP in the range
 			if ip := net.ParseIP(got); ip == nil {
-				t.Errorf("SelectAvailableStaticIP() = %v, not a valid IP", got)
+				t.Errorf("DefaultMeshAddressing().SelectAvailableStaticIP() = %v, not a valid IP", got)
 			}
 
 			// Verify it's not the reserved IP
 			if got == tt.reservedIP {
-				t.Errorf("SelectAvailableStaticIP() = %v, should not return reserved IP", got)
+				t.Errorf("DefaultMeshAddressing().SelectAvailableStaticIP() = %v, should not return reserved IP", got)
 			}
 
 			// Verify it's in the correct range
 			if len(got) < 6 || got[:6] != "10.41." {
-				t.Errorf("SelectAvailableStaticIP() = %v, should be in 10.41.0.0/16", got)
+				t.Errorf("DefaultMeshAddressing().SelectAvailableStaticIP() = %v, should be in 10.41.0.0/16", got)
 			}
 		})
 	}
@@ -1399,10 +1554,10 @@ func TestSelectAvailableStaticIP_GatewayMode(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := SelectAvailableStaticIP(tt.records, tt.gatewayMode)
+			got, err := DefaultMeshAddressing().SelectAvailableStaticIP(tt.records, tt.gatewayMode)
 
 			if (err != nil) != tt.wantErr {
-				t.Errorf("SelectAvailableStaticIP() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("DefaultMeshAddressing().SelectAvailableStaticIP() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 
@@ -1412,19 +1567,19 @@ func TestSelectAvailableStaticIP_GatewayMode(t *testing.T) {
 
 			// Verify the returned IP starts with the expected prefix
 			if len(got) < len(tt.wantPrefix) || got[:len(tt.wantPrefix)] != tt.wantPrefix {
-				t.Errorf("SelectAvailableStaticIP() = %v, want prefix %v", got, tt.wantPrefix)
+				t.Errorf("DefaultMeshAddressing().SelectAvailableStaticIP() = %v, want prefix %v", got, tt.wantPrefix)
 			}
 
 			// For gateway mode, verify it's specifically in 10.41.0.0/24
 			if tt.gatewayMode {
 				if len(got) < 8 || got[:8] != "10.41.0." {
-					t.Errorf("SelectAvailableStaticIP() with gatewayMode = %v, should be in 10.41.0.0/24", got)
+					t.Errorf("DefaultMeshAddressing().SelectAvailableStaticIP() with gatewayMode = %v, should be in 10.41.0.0/24", got)
 				}
 			}
 
 			// Verify it's a valid IP
 			if ip := net.ParseIP(got); ip == nil {
-				t.Errorf("SelectAvailableStaticIP() = %v, not a valid IP address", got)
+				t.Errorf("DefaultMeshAddressing().SelectAvailableStaticIP() = %v, not a valid IP address", got)
 			}
 		})
 	}
@@ -1434,13 +1589,13 @@ func TestSelectAvailableStaticIP_GatewayMode_FirstSelection(t *testing.T) {
 	// With no reservations in gateway mode, should select 10.41.0.1
 	records := []alfred.Record{}
 
-	got, err := SelectAvailableStaticIP(records, true)
+	got, err := DefaultMeshAddressing().SelectAvailableStaticIP(records, true)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
 	if got != "10.41.0.1" {
-		t.Errorf("SelectAvailableStaticIP() with gatewayMode = %v, want 10.41.0.1 as first selection", got)
+		t.Errorf("DefaultMeshAddressing().SelectAvailableStaticIP() with gatewayMode = %v, want 10.41.0.1 as first selection", got)
 	}
 }
 
@@ -1457,13 +1612,13 @@ func TestSelectAvailableStaticIP_GatewayMode_ExhaustRange(t *testing.T) {
 	}
 
 	// Should select the last available IP
-	got, err := SelectAvailableStaticIP(records, true)
+	got, err := DefaultMeshAddressing().SelectAvailableStaticIP(records, true)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
 	if got != "10.41.0.254" {
-		t.Errorf("SelectAvailableStaticIP() with gatewayMode = %v, want 10.41.0.254", got)
+		t.Errorf("DefaultMeshAddressing().SelectAvailableStaticIP() with gatewayMode = %v, want 10.41.0.254", got)
 	}
 }
 
@@ -1480,13 +1635,13 @@ func TestSelectAvailableStaticIP_GatewayMode_NoAvailableIPs(t *testing.T) {
 	}
 
 	// Should return an error
-	_, err := SelectAvailableStaticIP(records, true)
+	_, err := DefaultMeshAddressing().SelectAvailableStaticIP(records, true)
 	if err == nil {
 		t.Fatal("expected error when all IPs are reserved, got nil")
 	}
 
-	if !contains(err.Error(), "no available IP addresses in 10.41.0.0/24") {
-		t.Errorf("expected error about 10.41.0.0/24 range, got: %v", err)
+	if !errors.Is(err, ErrNoAvailableAddress) {
+		t.Errorf("expected ErrNoAvailableAddress, got: %v", err)
 	}
 }
 
@@ -1510,13 +1665,106 @@ func TestSelectAvailableStaticIP_GatewayMode_IgnoresOtherSubnets(t *testing.T) {
 		},
 	}
 
-	got, err := SelectAvailableStaticIP(records, true)
+	got, err := DefaultMeshAddressing().SelectAvailableStaticIP(records, true)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
 	// Should select 10.41.0.1 since nothing is reserved in that subnet
 	if got != "10.41.0.1" {
-		t.Errorf("SelectAvailableStaticIP() with gatewayMode = %v, want 10.41.0.1", got)
+		t.Errorf("DefaultMeshAddressing().SelectAvailableStaticIP() with gatewayMode = %v, want 10.41.0.1", got)
+	}
+}
+
+func TestValidatePinnedIP(t *testing.T) {
+	tests := []struct {
+		name    string
+		ip      string
+		wantErr bool
+	}{
+		{name: "host in mesh subnet", ip: "10.41.2.10"},
+		{name: "gateway range", ip: "10.41.0.5"},
+		{name: "not an address", ip: "node-a", wantErr: true},
+		{name: "IPv6", ip: "fd01:ed20:ecb4::1", wantErr: true},
+		{name: "outside mesh subnet", ip: "10.42.2.10", wantErr: true},
+		{name: "network address", ip: "10.41.0.0", wantErr: true},
+		{name: "broadcast address", ip: "10.41.255.255", wantErr: true},
+		{name: "reserved 253 range", ip: "10.41.253.10", wantErr: true},
+		{name: "reserved 254 range", ip: "10.41.254.10", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := DefaultMeshAddressing().ValidatePinnedIP(tt.ip)
+			if tt.wantErr {
+				if !errors.Is(err, ErrValidation) {
+					t.Errorf("DefaultMeshAddressing().ValidatePinnedIP(%q) error = %v, want ErrValidation", tt.ip, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("DefaultMeshAddressing().ValidatePinnedIP(%q) unexpected error: %v", tt.ip, err)
+			}
+		})
+	}
+}
+
+func TestCheckPinnedIPAvailable(t *testing.T) {
+	records := []alfred.Record{
+		{Data: mustMarshalAddressReservation(&proto.AddressReservation{Mac: "aa:bb:cc:dd:ee:01", StaticIp: "10.41.2.10"})},
+		{Data: mustMarshalAddressReservation(&proto.AddressReservation{Mac: "aa:bb:cc:dd:ee:02", StaticIp: "10.41.2.11"})},
+		{Data: []byte("not a reservation")},
+	}
+
+	tests := []struct {
+		name     string
+		ip       string
+		selfMAC  string
+		conflict bool
+	}{
+		{name: "free address", ip: "10.41.2.12", selfMAC: "aa:bb:cc:dd:ee:ff"},
+		{name: "held by peer", ip: "10.41.2.10", selfMAC: "aa:bb:cc:dd:ee:ff", conflict: true},
+		{name: "held by ourselves", ip: "10.41.2.11", selfMAC: "aa:bb:cc:dd:ee:02"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckPinnedIPAvailable(records, tt.ip, tt.selfMAC)
+			if tt.conflict {
+				if !errors.Is(err, ErrPinConflict) {
+					t.Errorf("CheckPinnedIPAvailable() error = %v, want ErrPinConflict", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("CheckPinnedIPAvailable() unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestGetAllUCINetworksWithReader(t *testing.T) {
+	dir := writeTestConfig(t, "network", testDeviceConfig+`
+config interface 'wan'
+	option device 'eth0'
+	option proto 'dhcp'
+
+config interface
+	option proto 'none'
+`)
+	reader := NewUCINetworkConfigReaderWithTree(uci.NewTree(dir))
+
+	networks, err := GetAllUCINetworksWithReader(reader)
+	if err != nil {
+		t.Fatalf("GetAllUCINetworksWithReader() error = %v", err)
+	}
+
+	want := []UCINetworkSection{
+		{Name: "lan", UCINetwork: UCINetwork{Proto: "static", Device: "br-lan"}},
+		{Name: "wan", UCINetwork: UCINetwork{Proto: "dhcp", Device: "eth0"}},
+		{Name: "@interface[2]", UCINetwork: UCINetwork{Proto: "none"}},
+	}
+	if !reflect.DeepEqual(networks, want) {
+		t.Errorf("GetAllUCINetworksWithReader() = %+v, want %+v", networks, want)
 	}
 }
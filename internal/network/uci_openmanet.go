@@ -5,12 +5,15 @@ import (
 	"strconv"
 
 	"github.com/digineo/go-uci/v2"
+	"github.com/openmanet/openmanetd/internal/safemode"
 )
 
 /*
 config openmanet 'config'
 	option dhcpconfigured '0'
 	option config '/etc/openmanet/config.yml'
+	option pinned_ip '10.41.2.10'
+	option pool_shrink '1'
 */
 
 const (
@@ -19,8 +22,9 @@ const (
 
 // UCIOpenMANET represents the OpenMANET UCI configuration.
 type UCIOpenMANET struct {
-	DHCPConfigured string `uci:"option dhcpconfigured"`
-	Config         string `uci:"option config"`
+	DHCPConfigured string `uci:"option dhcpconfigured" json:"dhcpconfigured,omitempty"`
+	Config         string `uci:"option config" json:"config,omitempty"`
+	PinnedIP       string `uci:"option pinned_ip" json:"pinned_ip,omitempty"`
 }
 
 // OpenMANETConfigReader defines an interface for reading OpenMANET UCI configuration values.
@@ -37,41 +41,76 @@ type OpenMANETConfigReader interface {
 // UCIOpenMANETConfigReader wraps the UCI functions for OpenMANET configuration.
 type UCIOpenMANETConfigReader struct {
 	tree uci.Tree
+	changeLog
 }
 
 // NewUCIOpenMANETConfigReader creates a new UCI OpenMANET config reader with the default tree.
 func NewUCIOpenMANETConfigReader() *UCIOpenMANETConfigReader {
+	return NewUCIOpenMANETConfigReaderWithTree(uci.NewTree(uci.DefaultTreePath))
+}
+
+// NewUCIOpenMANETConfigReaderWithTree creates a UCI OpenMANET config reader on tree, so that
+// several readers can share one tree or read a tree outside the default path.
+func NewUCIOpenMANETConfigReaderWithTree(tree uci.Tree) *UCIOpenMANETConfigReader {
 	return &UCIOpenMANETConfigReader{
-		tree: uci.NewTree(uci.DefaultTreePath),
+		tree: tree,
 	}
 }
 
 func (r *UCIOpenMANETConfigReader) Get(config, section, option string) ([]string, bool) {
-	return r.tree.Get(config, section, option)
+	return r.get(r.tree, config, section, option)
 }
 
 func (r *UCIOpenMANETConfigReader) SetType(config, section, option string, typ uci.OptionType, values ...string) error {
-	return r.tree.SetType(config, section, option, typ, values...)
+	if err := safemode.Check(fmt.Sprintf("uci set %s.%s.%s", config, section, option)); err != nil {
+		return err
+	}
+	return r.setType(r.tree, config, section, option, typ, values...)
 }
 
 func (r *UCIOpenMANETConfigReader) Del(config, section, option string) error {
-	return r.tree.Del(config, section, option)
+	if err := safemode.Check(fmt.Sprintf("uci delete %s.%s.%s", config, section, option)); err != nil {
+		return err
+	}
+	return r.del(r.tree, config, section, option)
 }
 
 func (r *UCIOpenMANETConfigReader) AddSection(config, section, typ string) error {
-	return r.tree.AddSection(config, section, typ)
+	if err := safemode.Check(fmt.Sprintf("uci add %s.%s", config, section)); err != nil {
+		return err
+	}
+	return r.addSection(r.tree, config, section, typ)
 }
 
 func (r *UCIOpenMANETConfigReader) DelSection(config, section string) error {
-	return r.tree.DelSection(config, section)
+	if err := safemode.Check(fmt.Sprintf("uci delete %s.%s", config, section)); err != nil {
+		return err
+	}
+	return r.delSection(r.tree, config, section)
 }
 
+// Commit writes staged changes to disk. Failures caused by a read-only
+// filesystem are reported as ErrReadOnlyFS.
 func (r *UCIOpenMANETConfigReader) Commit() error {
-	return r.tree.Commit()
+	if err := safemode.Check("uci commit"); err != nil {
+		return err
+	}
+	return classifyCommitError(r.commit(r.tree))
 }
 
 func (r *UCIOpenMANETConfigReader) ReloadConfig() error {
-	return r.tree.LoadConfig(openmanetdConfigName, true)
+	if err := r.tree.LoadConfig(openmanetdConfigName, true); err != nil {
+		return err
+	}
+	r.reset(openmanetdConfigName)
+	return nil
+}
+
+// Revert discards the openmanetd changes staged since the last commit. The config is
+// read from disk again on next use.
+func (r *UCIOpenMANETConfigReader) Revert() {
+	r.tree.Revert(openmanetdConfigName)
+	r.reset(openmanetdConfigName)
 }
 
 // GetOpenMANETConfig loads and returns the OpenMANET configuration.
@@ -99,6 +138,9 @@ func GetOpenMANETConfigWithReader(reader OpenMANETConfigReader) (*UCIOpenMANET,
 	if values, ok := reader.Get(openmanetdConfigName, "config", "config"); ok && len(values) > 0 {
 		config.Config = values[0]
 	}
+	if values, ok := reader.Get(openmanetdConfigName, "config", "pinned_ip"); ok && len(values) > 0 {
+		config.PinnedIP = values[0]
+	}
 
 	return &config, nil
 }
@@ -108,7 +150,9 @@ func GetOpenMANETConfigWithReader(reader OpenMANETConfigReader) (*UCIOpenMANET,
 // Parameters:
 //   - config: The OpenMANET configuration to set
 //
-// Returns an error if the configuration cannot be saved.
+// Returns true if any option changed and the configuration was committed. Options
+// that already hold the requested value are not written, and nothing is committed
+// when no option changed.
 //
 // Example:
 //
@@ -116,38 +160,36 @@ func GetOpenMANETConfigWithReader(reader OpenMANETConfigReader) (*UCIOpenMANET,
 //	    DHCPConfigured: "1",
 //	    Config:         "/etc/openmanet/config.yml",
 //	}
-//	err := SetOpenMANETConfig(config)
+//	changed, err := SetOpenMANETConfig(config)
 //
 // Note: This operation requires appropriate privileges and commits the configuration.
-func SetOpenMANETConfig(config *UCIOpenMANET) error {
+func SetOpenMANETConfig(config *UCIOpenMANET) (bool, error) {
 	return SetOpenMANETConfigWithReader(config, NewUCIOpenMANETConfigReader())
 }
 
 // SetOpenMANETConfigWithReader creates or updates the OpenMANET configuration using the provided reader.
-func SetOpenMANETConfigWithReader(config *UCIOpenMANET, reader OpenMANETConfigReader) error {
+func SetOpenMANETConfigWithReader(config *UCIOpenMANET, reader OpenMANETConfigReader) (bool, error) {
 	if config == nil {
-		return fmt.Errorf("config cannot be nil")
+		return false, newValidationError("config cannot be nil")
 	}
 
 	// Add section if it doesn't exist (this will fail silently if it exists)
 	_ = reader.AddSection(openmanetdConfigName, "config", "openmanet")
 
-	if config.DHCPConfigured != "" {
-		if err := reader.SetType(openmanetdConfigName, "config", "dhcpconfigured", uci.TypeOption, config.DHCPConfigured); err != nil {
-			return fmt.Errorf("failed to set dhcpconfigured: %w", err)
-		}
-	}
-	if config.Config != "" {
-		if err := reader.SetType(openmanetdConfigName, "config", "config", uci.TypeOption, config.Config); err != nil {
-			return fmt.Errorf("failed to set config: %w", err)
-		}
+	changed, err := setOptionsIfChanged(reader, openmanetdConfigName, "config", []uciOption{
+		{name: "dhcpconfigured", typ: uci.TypeOption, value: config.DHCPConfigured},
+		{name: "config", typ: uci.TypeOption, value: config.Config},
+		{name: "pinned_ip", typ: uci.TypeOption, value: config.PinnedIP},
+	})
+	if err != nil || !changed {
+		return false, err
 	}
 
 	if err := reader.Commit(); err != nil {
-		return fmt.Errorf("failed to commit OpenMANET config: %w", err)
+		return false, newCommitError(openmanetdConfigName, err)
 	}
 
-	return nil
+	return true, nil
 }
 
 // IsDHCPConfigured checks if DHCP has been configured.
@@ -183,7 +225,7 @@ func IsDHCPConfiguredWithReader(reader OpenMANETConfigReader) (bool, error) {
 
 	configured, err := strconv.Atoi(config.DHCPConfigured)
 	if err != nil {
-		return false, fmt.Errorf("invalid dhcpconfigured value: %w", err)
+		return false, newValidationError("invalid dhcpconfigured value: %v", err)
 	}
 
 	return configured == 1, nil
@@ -208,12 +250,13 @@ func SetDHCPConfiguredWithReader(reader OpenMANETConfigReader) error {
 	// Ensure the section exists
 	_ = reader.AddSection(openmanetdConfigName, "config", "openmanet")
 
-	if err := reader.SetType(openmanetdConfigName, "config", "dhcpconfigured", uci.TypeOption, "1"); err != nil {
-		return fmt.Errorf("failed to set dhcpconfigured: %w", err)
+	changed, err := setOptionIfChanged(reader, openmanetdConfigName, "config", "dhcpconfigured", uci.TypeOption, "1")
+	if err != nil || !changed {
+		return err
 	}
 
 	if err := reader.Commit(); err != nil {
-		return fmt.Errorf("failed to commit OpenMANET config: %w", err)
+		return newCommitError(openmanetdConfigName, err)
 	}
 
 	return nil
@@ -238,12 +281,13 @@ func ClearDHCPConfiguredWithReader(reader OpenMANETConfigReader) error {
 	// Ensure the section exists
 	_ = reader.AddSection(openmanetdConfigName, "config", "openmanet")
 
-	if err := reader.SetType(openmanetdConfigName, "config", "dhcpconfigured", uci.TypeOption, "0"); err != nil {
-		return fmt.Errorf("failed to clear dhcpconfigured: %w", err)
+	changed, err := setOptionIfChanged(reader, openmanetdConfigName, "config", "dhcpconfigured", uci.TypeOption, "0")
+	if err != nil || !changed {
+		return err
 	}
 
 	if err := reader.Commit(); err != nil {
-		return fmt.Errorf("failed to commit OpenMANET config: %w", err)
+		return newCommitError(openmanetdConfigName, err)
 	}
 
 	return nil
@@ -298,14 +342,185 @@ func SetConfigPath(path string) error {
 // SetConfigPathWithReader sets the path to the OpenMANET configuration file using the provided reader.
 func SetConfigPathWithReader(path string, reader OpenMANETConfigReader) error {
 	if path == "" {
-		return fmt.Errorf("config path cannot be empty")
+		return newValidationError("config path cannot be empty")
 	}
 
 	// Ensure the section exists
 	_ = reader.AddSection(openmanetdConfigName, "config", "openmanet")
 
 	if err := reader.SetType(openmanetdConfigName, "config", "config", uci.TypeOption, path); err != nil {
-		return fmt.Errorf("failed to set config path: %w", err)
+		return newSetOptionError(openmanetdConfigName, "config", "config", err)
+	}
+	return nil
+}
+
+// GetPinnedIP returns the static IP this node is pinned to, or an empty string if no
+// pin is set.
+//
+// Example:
+//
+//	pin, err := GetPinnedIP()
+//	if err != nil {
+//	    log.Fatalf("Failed to get pinned IP: %v", err)
+//	}
+//	if pin != "" {
+//	    fmt.Printf("Pinned to %s\n", pin)
+//	}
+func GetPinnedIP() (string, error) {
+	return GetPinnedIPWithReader(NewUCIOpenMANETConfigReader())
+}
+
+// GetPinnedIPWithReader returns the pinned static IP using the provided reader.
+func GetPinnedIPWithReader(reader OpenMANETConfigReader) (string, error) {
+	config, err := GetOpenMANETConfigWithReader(reader)
+	if err != nil {
+		return "", err
+	}
+
+	return config.PinnedIP, nil
+}
+
+// SetPinnedIP pins this node to a specific static IP. The address reservation worker
+// claims it instead of selecting a free address, provided no peer holds it.
+//
+// Parameters:
+//   - ip: The address to pin, which must pass addressing.ValidatePinnedIP
+//   - addressing: The configured mesh subnet and excluded ranges
+//
+// Returns an ErrValidation error if the address is not usable, or an error if the
+// configuration cannot be saved.
+//
+// Example:
+//
+//	addressing, _ := NewMeshAddressing(cfg.GetMeshSubnet(), cfg.GetMeshExcludedRanges())
+//	err := SetPinnedIP("10.41.2.10", addressing)
+//	if err != nil {
+//	    log.Fatalf("Failed to pin IP: %v", err)
+//	}
+func SetPinnedIP(ip string, addressing MeshAddressing) error {
+	return SetPinnedIPWithReader(ip, addressing, NewUCIOpenMANETConfigReader())
+}
+
+// SetPinnedIPWithReader pins this node to a specific static IP using the provided reader.
+func SetPinnedIPWithReader(ip string, addressing MeshAddressing, reader OpenMANETConfigReader) error {
+	if err := addressing.ValidatePinnedIP(ip); err != nil {
+		return err
+	}
+
+	// Ensure the section exists
+	_ = reader.AddSection(openmanetdConfigName, "config", "openmanet")
+
+	changed, err := setOptionIfChanged(reader, openmanetdConfigName, "config", "pinned_ip", uci.TypeOption, ip)
+	if err != nil || !changed {
+		return err
+	}
+
+	if err := reader.Commit(); err != nil {
+		return newCommitError(openmanetdConfigName, err)
+	}
+
+	return nil
+}
+
+// ClearPinnedIP removes the static IP pin so the address reservation worker selects
+// an address itself.
+//
+// Example:
+//
+//	err := ClearPinnedIP()
+//	if err != nil {
+//	    log.Fatalf("Failed to clear pinned IP: %v", err)
+//	}
+func ClearPinnedIP() error {
+	return ClearPinnedIPWithReader(NewUCIOpenMANETConfigReader())
+}
+
+// ClearPinnedIPWithReader removes the static IP pin using the provided reader.
+func ClearPinnedIPWithReader(reader OpenMANETConfigReader) error {
+	if _, ok := reader.Get(openmanetdConfigName, "config", "pinned_ip"); !ok {
+		return nil
+	}
+
+	if err := reader.Del(openmanetdConfigName, "config", "pinned_ip"); err != nil {
+		return newSetOptionError(openmanetdConfigName, "config", "pinned_ip", err)
+	}
+
+	if err := reader.Commit(); err != nil {
+		return newCommitError(openmanetdConfigName, err)
 	}
+
+	return nil
+}
+
+// RequestPoolShrink asks the running daemon to shrink this node's DHCP pool to the
+// smallest size that still serves its recent peak, without waiting for the quiet
+// period. The request is cleared once it has been handled.
+//
+// Example:
+//
+//	err := RequestPoolShrink()
+//	if err != nil {
+//	    log.Fatalf("Failed to request pool shrink: %v", err)
+//	}
+func RequestPoolShrink() error {
+	return RequestPoolShrinkWithReader(NewUCIOpenMANETConfigReader())
+}
+
+// RequestPoolShrinkWithReader records a DHCP pool shrink request using the provided reader.
+func RequestPoolShrinkWithReader(reader OpenMANETConfigReader) error {
+	// Ensure the section exists
+	_ = reader.AddSection(openmanetdConfigName, "config", "openmanet")
+
+	changed, err := setOptionIfChanged(reader, openmanetdConfigName, "config", "pool_shrink", uci.TypeOption, "1")
+	if err != nil || !changed {
+		return err
+	}
+
+	if err := reader.Commit(); err != nil {
+		return newCommitError(openmanetdConfigName, err)
+	}
+
+	return nil
+}
+
+// IsPoolShrinkRequested reports whether an operator has requested a DHCP pool shrink.
+func IsPoolShrinkRequested() (bool, error) {
+	return IsPoolShrinkRequestedWithReader(NewUCIOpenMANETConfigReader())
+}
+
+// IsPoolShrinkRequestedWithReader reports whether a DHCP pool shrink is requested using the provided reader.
+func IsPoolShrinkRequestedWithReader(reader OpenMANETConfigReader) (bool, error) {
+	values, ok := reader.Get(openmanetdConfigName, "config", "pool_shrink")
+	if !ok || len(values) == 0 {
+		return false, nil
+	}
+
+	requested, err := strconv.ParseBool(values[0])
+	if err != nil {
+		return false, newValidationError("invalid pool_shrink value %q", values[0])
+	}
+
+	return requested, nil
+}
+
+// ClearPoolShrinkRequest removes a pending DHCP pool shrink request.
+func ClearPoolShrinkRequest() error {
+	return ClearPoolShrinkRequestWithReader(NewUCIOpenMANETConfigReader())
+}
+
+// ClearPoolShrinkRequestWithReader removes a pending DHCP pool shrink request using the provided reader.
+func ClearPoolShrinkRequestWithReader(reader OpenMANETConfigReader) error {
+	if _, ok := reader.Get(openmanetdConfigName, "config", "pool_shrink"); !ok {
+		return nil
+	}
+
+	if err := reader.Del(openmanetdConfigName, "config", "pool_shrink"); err != nil {
+		return newSetOptionError(openmanetdConfigName, "config", "pool_shrink", err)
+	}
+
+	if err := reader.Commit(); err != nil {
+		return newCommitError(openmanetdConfigName, err)
+	}
+
 	return nil
 }
@@ -131,7 +131,7 @@ func TestSetOpenMANETConfigWithReader(t *testing.T) {
 		Config:         "/custom/path/config.yml",
 	}
 
-	err := SetOpenMANETConfigWithReader(config, mock)
+	_, err := SetOpenMANETConfigWithReader(config, mock)
 	if err != nil {
 		t.Fatalf("SetOpenMANETConfigWithReader failed: %v", err)
 	}
@@ -153,7 +153,7 @@ func TestSetOpenMANETConfigWithReader(t *testing.T) {
 func TestSetOpenMANETConfigWithReader_NilConfig(t *testing.T) {
 	mock := newMockOpenMANETConfigReader()
 
-	err := SetOpenMANETConfigWithReader(nil, mock)
+	_, err := SetOpenMANETConfigWithReader(nil, mock)
 	if err == nil {
 		t.Error("Expected error for nil config, got nil")
 	}
@@ -167,7 +167,7 @@ func TestSetOpenMANETConfigWithReader_PartialConfig(t *testing.T) {
 		DHCPConfigured: "1",
 	}
 
-	err := SetOpenMANETConfigWithReader(config, mock)
+	_, err := SetOpenMANETConfigWithReader(config, mock)
 	if err != nil {
 		t.Fatalf("SetOpenMANETConfigWithReader failed: %v", err)
 	}
@@ -405,7 +405,7 @@ func TestSetOpenMANETConfigWithReader_ErrorHandling(t *testing.T) {
 		DHCPConfigured: "1",
 	}
 
-	err := SetOpenMANETConfigWithReader(config, mock)
+	_, err := SetOpenMANETConfigWithReader(config, mock)
 	if err == nil {
 		t.Error("Expected error from SetOpenMANETConfigWithReader")
 	}
@@ -496,7 +496,7 @@ func TestCompleteWorkflow(t *testing.T) {
 		Config:         "/etc/openmanet/config.yml",
 	}
 
-	err := SetOpenMANETConfigWithReader(config, mock)
+	_, err := SetOpenMANETConfigWithReader(config, mock)
 	if err != nil {
 		t.Fatalf("Failed to set initial config: %v", err)
 	}
@@ -553,3 +553,110 @@ func TestCompleteWorkflow(t *testing.T) {
 		t.Errorf("Expected Config=%s, got %s", newPath, finalConfig.Config)
 	}
 }
+
+func TestPinnedIPWithReader(t *testing.T) {
+	mock := newMockOpenMANETConfigReader()
+
+	pin, err := GetPinnedIPWithReader(mock)
+	if err != nil {
+		t.Fatalf("GetPinnedIPWithReader failed: %v", err)
+	}
+	if pin != "" {
+		t.Errorf("Expected no pin, got %s", pin)
+	}
+
+	if err := SetPinnedIPWithReader("10.41.2.10", DefaultMeshAddressing(), mock); err != nil {
+		t.Fatalf("SetPinnedIPWithReader failed: %v", err)
+	}
+
+	pin, err = GetPinnedIPWithReader(mock)
+	if err != nil {
+		t.Fatalf("GetPinnedIPWithReader failed: %v", err)
+	}
+	if pin != "10.41.2.10" {
+		t.Errorf("Expected pin 10.41.2.10, got %s", pin)
+	}
+
+	if err := ClearPinnedIPWithReader(mock); err != nil {
+		t.Fatalf("ClearPinnedIPWithReader failed: %v", err)
+	}
+
+	if _, ok := mock.Get("openmanetd", "config", "pinned_ip"); ok {
+		t.Error("Expected pinned_ip to be removed")
+	}
+
+	// Clearing again is a no-op
+	if err := ClearPinnedIPWithReader(mock); err != nil {
+		t.Errorf("ClearPinnedIPWithReader without a pin failed: %v", err)
+	}
+}
+
+func TestSetPinnedIPWithReader_Invalid(t *testing.T) {
+	mock := newMockOpenMANETConfigReader()
+
+	err := SetPinnedIPWithReader("192.168.1.10", DefaultMeshAddressing(), mock)
+	if !errors.Is(err, ErrValidation) {
+		t.Fatalf("Expected ErrValidation, got %v", err)
+	}
+
+	if _, ok := mock.Get("openmanetd", "config", "pinned_ip"); ok {
+		t.Error("Expected no pin to be stored for an invalid address")
+	}
+}
+
+func TestSetPinnedIPWithReader_ConfiguredSubnet(t *testing.T) {
+	mock := newMockOpenMANETConfigReader()
+	addressing, err := NewMeshAddressing("172.16.0.0/16", nil)
+	if err != nil {
+		t.Fatalf("NewMeshAddressing failed: %v", err)
+	}
+
+	// A pin of the default subnet is outside the configured one
+	if err := SetPinnedIPWithReader("10.41.2.10", addressing, mock); !errors.Is(err, ErrValidation) {
+		t.Fatalf("Expected ErrValidation for a pin outside the configured subnet, got %v", err)
+	}
+
+	if err := SetPinnedIPWithReader("172.16.2.10", addressing, mock); err != nil {
+		t.Fatalf("SetPinnedIPWithReader failed: %v", err)
+	}
+	if pin, _ := GetPinnedIPWithReader(mock); pin != "172.16.2.10" {
+		t.Errorf("Expected pin 172.16.2.10, got %s", pin)
+	}
+}
+
+func TestPoolShrinkRequestWithReader(t *testing.T) {
+	mock := newMockOpenMANETConfigReader()
+
+	requested, err := IsPoolShrinkRequestedWithReader(mock)
+	if err != nil {
+		t.Fatalf("IsPoolShrinkRequestedWithReader failed: %v", err)
+	}
+	if requested {
+		t.Error("Expected no shrink request")
+	}
+
+	if err := RequestPoolShrinkWithReader(mock); err != nil {
+		t.Fatalf("RequestPoolShrinkWithReader failed: %v", err)
+	}
+
+	requested, err = IsPoolShrinkRequestedWithReader(mock)
+	if err != nil {
+		t.Fatalf("IsPoolShrinkRequestedWithReader failed: %v", err)
+	}
+	if !requested {
+		t.Error("Expected a shrink request")
+	}
+
+	if err := ClearPoolShrinkRequestWithReader(mock); err != nil {
+		t.Fatalf("ClearPoolShrinkRequestWithReader failed: %v", err)
+	}
+
+	if _, ok := mock.Get("openmanetd", "config", "pool_shrink"); ok {
+		t.Error("Expected pool_shrink to be removed")
+	}
+
+	// Clearing again is a no-op
+	if err := ClearPoolShrinkRequestWithReader(mock); err != nil {
+		t.Errorf("ClearPoolShrinkRequestWithReader without a request failed: %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package network
+
+import (
+	"github.com/digineo/go-uci/v2"
+)
+
+// optionWriter is the part of the UCI config readers needed to change an option.
+type optionWriter interface {
+	Get(config, section, option string) ([]string, bool)
+	SetType(config, section, option string, typ uci.OptionType, values ...string) error
+}
+
+// uciOption is one option of a section written by a composite setter.
+type uciOption struct {
+	name  string
+	typ   uci.OptionType
+	value string
+}
+
+// setOptionIfChanged stages values for config.section.option unless the option
+// already holds them, so that callers only commit and reload when something changed.
+// Options compare string-equal and lists set-equal.
+//
+// Returns true if the option was staged, and an error if it could not be.
+func setOptionIfChanged(w optionWriter, config, section, option string, typ uci.OptionType, values ...string) (bool, error) {
+	if current, ok := w.Get(config, section, option); ok && sameOptionValues(typ, current, values) {
+		return false, nil
+	}
+
+	if err := w.SetType(config, section, option, typ, values...); err != nil {
+		return false, newSetOptionError(config, section, option, err)
+	}
+
+	return true, nil
+}
+
+// setOptionsIfChanged stages every option with a non-empty value through
+// setOptionIfChanged.
+//
+// Returns true if any option was staged.
+func setOptionsIfChanged(w optionWriter, config, section string, options []uciOption) (bool, error) {
+	changed := false
+	for _, opt := range options {
+		if opt.value == "" {
+			continue
+		}
+
+		set, err := setOptionIfChanged(w, config, section, opt.name, opt.typ, opt.value)
+		if err != nil {
+			return false, err
+		}
+		changed = changed || set
+	}
+
+	return changed, nil
+}
+
+// sameOptionValues reports whether current already holds want.
+func sameOptionValues(typ uci.OptionType, current, want []string) bool {
+	if typ != uci.TypeList {
+		return len(current) == 1 && len(want) == 1 && current[0] == want[0]
+	}
+
+	have := make(map[string]bool, len(current))
+	for _, v := range current {
+		have[v] = true
+	}
+	wanted := make(map[string]bool, len(want))
+	for _, v := range want {
+		if !have[v] {
+			return false
+		}
+		wanted[v] = true
+	}
+
+	return len(have) == len(wanted)
+}
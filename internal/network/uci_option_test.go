@@ -0,0 +1,33 @@
+package network
+
+import (
+	"testing"
+
+	"github.com/digineo/go-uci/v2"
+)
+
+func TestSameOptionValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		typ     uci.OptionType
+		current []string
+		want    []string
+		same    bool
+	}{
+		{"option equal", uci.TypeOption, []string{"static"}, []string{"static"}, true},
+		{"option differs", uci.TypeOption, []string{"static"}, []string{"dhcp"}, false},
+		{"option missing", uci.TypeOption, nil, []string{"static"}, false},
+		{"list same order", uci.TypeList, []string{"local", "wan6"}, []string{"local", "wan6"}, true},
+		{"list reordered", uci.TypeList, []string{"wan6", "local"}, []string{"local", "wan6"}, true},
+		{"list extra value", uci.TypeList, []string{"local", "wan6"}, []string{"local"}, false},
+		{"list missing value", uci.TypeList, []string{"local"}, []string{"local", "wan6"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sameOptionValues(tt.typ, tt.current, tt.want); got != tt.same {
+				t.Errorf("sameOptionValues(%v, %v) = %v, want %v", tt.current, tt.want, got, tt.same)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package network
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/openmanet/openmanetd/internal/safemode"
+)
+
+// Reverter is implemented by the UCI config readers of this package. Revert
+// discards the changes a reader has staged but not committed.
+type Reverter interface {
+	Revert()
+}
+
+// snapshotFile is the committed content of one config file. A nil content records
+// that the file did not exist.
+type snapshotFile struct {
+	config  string
+	content []byte
+	mode    fs.FileMode
+}
+
+// Snapshot is the committed state of a set of UCI config files, taken before a
+// multi-step change so that the files can be restored if a later step fails after
+// earlier ones were committed.
+type Snapshot struct {
+	dir   string
+	files []snapshotFile
+}
+
+// TakeSnapshot reads the config files named configs, e.g. "network" and "dhcp",
+// from the UCI directory dir, usually uci.DefaultTreePath. Only committed state is
+// captured; changes staged in a reader are not on disk yet.
+//
+// Example:
+//
+//	snapshot, err := TakeSnapshot(uci.DefaultTreePath, "network", "dhcp")
+//	if err != nil {
+//	    return err
+//	}
+//	if err := provision(); err != nil {
+//	    return errors.Join(err, snapshot.Restore(netReader, dhcpReader))
+//	}
+func TakeSnapshot(dir string, configs ...string) (*Snapshot, error) {
+	s := &Snapshot{dir: dir}
+
+	for _, config := range configs {
+		path := filepath.Join(dir, config)
+
+		info, err := os.Stat(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			s.files = append(s.files, snapshotFile{config: config})
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to snapshot %s: %w", config, err)
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to snapshot %s: %w", config, err)
+		}
+		if content == nil {
+			content = []byte{}
+		}
+
+		s.files = append(s.files, snapshotFile{config: config, content: content, mode: info.Mode().Perm()})
+	}
+
+	return s, nil
+}
+
+// Configs returns the names of the configs in the snapshot.
+func (s *Snapshot) Configs() []string {
+	configs := make([]string, 0, len(s.files))
+	for _, f := range s.files {
+		configs = append(configs, f.config)
+	}
+	return configs
+}
+
+// Restore writes the config files back to their state in the snapshot and reverts
+// readers, so that none of them commits a stale staged change over the restored
+// files or keeps serving its in-memory copy. Files that did not exist are removed;
+// files that have not changed are not written.
+//
+// Every file is attempted; the errors of those that could not be restored are
+// joined. A file that cannot be written because the filesystem is read-only is
+// reported as ErrReadOnlyFS.
+func (s *Snapshot) Restore(readers ...Reverter) error {
+	var errs []error
+	for _, f := range s.files {
+		if err := s.restoreFile(f); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for _, r := range readers {
+		r.Revert()
+	}
+
+	return errors.Join(errs...)
+}
+
+// restoreFile writes f back unless the file on disk already matches it.
+func (s *Snapshot) restoreFile(f snapshotFile) error {
+	path := filepath.Join(s.dir, f.config)
+
+	current, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		if f.content == nil {
+			return nil
+		}
+	case err != nil:
+		return fmt.Errorf("failed to restore %s: %w", f.config, err)
+	case f.content != nil && bytes.Equal(current, f.content):
+		return nil
+	}
+
+	if err := safemode.Check(fmt.Sprintf("uci restore %s", f.config)); err != nil {
+		return err
+	}
+
+	if f.content == nil {
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", f.config, classifyCommitError(err))
+		}
+		return nil
+	}
+
+	// Write through a temporary file so that a failure never leaves the config
+	// truncated.
+	tmp, err := os.CreateTemp(s.dir, "."+f.config+"-restore-*")
+	if err != nil {
+		return fmt.Errorf("failed to restore %s: %w", f.config, classifyCommitError(err))
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(f.content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to restore %s: %w", f.config, classifyCommitError(err))
+	}
+	if err := tmp.Chmod(f.mode); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to restore %s: %w", f.config, classifyCommitError(err))
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to restore %s: %w", f.config, classifyCommitError(err))
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to restore %s: %w", f.config, classifyCommitError(err))
+	}
+
+	return nil
+}
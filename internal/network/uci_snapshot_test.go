@@ -0,0 +1,121 @@
+package network
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/digineo/go-uci/v2"
+	"github.com/openmanet/openmanetd/internal/safemode"
+)
+
+const (
+	snapshotNetworkConfig = "\nconfig interface 'ahwlan'\n\toption proto 'static'\n\toption ipaddr '10.41.254.1'\n"
+	snapshotDHCPConfig    = "\nconfig dhcp 'ahwlan'\n\toption interface 'ahwlan'\n\toption start '100'\n\toption limit '16'\n"
+)
+
+// newSnapshotFixture writes network and dhcp configs to a temporary UCI directory
+// and returns readers on it.
+func newSnapshotFixture(t *testing.T) (string, *UCINetworkConfigReader, *UCIDHCPConfigReader) {
+	t.Helper()
+
+	dir := writeTestConfigs(t, map[string]string{"network": snapshotNetworkConfig, "dhcp": snapshotDHCPConfig})
+	return dir, &UCINetworkConfigReader{tree: uci.NewTree(dir)}, &UCIDHCPConfigReader{tree: uci.NewTree(dir)}
+}
+
+func TestReaderRevert(t *testing.T) {
+	_, netReader, dhcpReader := newSnapshotFixture(t)
+
+	if err := netReader.SetType("network", "ahwlan", "ipaddr", uci.TypeOption, "10.41.0.7"); err != nil {
+		t.Fatalf("SetType() error = %v", err)
+	}
+	netReader.Revert()
+	if values, _ := netReader.Get("network", "ahwlan", "ipaddr"); !slices.Equal(values, []string{"10.41.254.1"}) {
+		t.Errorf("ipaddr after Revert = %v, want the committed value", values)
+	}
+
+	// A transaction on a reverter is discarded by reverting it.
+	tx := NewTransaction(dhcpConfigName, dhcpReader)
+	if _, err := SetDHCPRangeWithReader("ahwlan", "300", "16", tx); err != nil {
+		t.Fatalf("SetDHCPRangeWithReader() error = %v", err)
+	}
+	if err := tx.Discard(); err != nil {
+		t.Fatalf("Discard() error = %v", err)
+	}
+	if config, _ := GetDHCPConfigWithReader("ahwlan", dhcpReader); config.Start != "100" {
+		t.Errorf("start after Discard = %q, want 100", config.Start)
+	}
+}
+
+func TestSnapshot_Restore(t *testing.T) {
+	dir, netReader, dhcpReader := newSnapshotFixture(t)
+
+	snapshot, err := TakeSnapshot(dir, "network", "dhcp", "openmanetd")
+	if err != nil {
+		t.Fatalf("TakeSnapshot() error = %v", err)
+	}
+	if want := []string{"network", "dhcp", "openmanetd"}; !slices.Equal(snapshot.Configs(), want) {
+		t.Errorf("Configs() = %v, want %v", snapshot.Configs(), want)
+	}
+
+	// The network step is committed, the DHCP step only staged, and a config that
+	// did not exist is created.
+	if err := SetNetworkIPAddrWithReader("ahwlan", "10.41.0.7", netReader); err != nil {
+		t.Fatalf("SetNetworkIPAddrWithReader() error = %v", err)
+	}
+	if err := dhcpReader.SetType("dhcp", "ahwlan", "start", uci.TypeOption, "300"); err != nil {
+		t.Fatalf("SetType() error = %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "openmanetd"), []byte("\nconfig openmanetd 'openmanetd'\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	if err := snapshot.Restore(netReader, dhcpReader); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+
+	if got, _ := os.ReadFile(filepath.Join(dir, "network")); string(got) != snapshotNetworkConfig {
+		t.Errorf("network after Restore:\n%s\nwant:\n%s", got, snapshotNetworkConfig)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "openmanetd")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected openmanetd removed, stat error = %v", err)
+	}
+	if config, _ := GetUCINetworkByNameWithReader("ahwlan", netReader); config.IPAddr != "10.41.254.1" {
+		t.Errorf("reader ipaddr after Restore = %q, want 10.41.254.1", config.IPAddr)
+	}
+	if config, _ := GetDHCPConfigWithReader("ahwlan", dhcpReader); config.Start != "100" {
+		t.Errorf("reader start after Restore = %q, want 100", config.Start)
+	}
+
+	// Nothing is left behind for a later commit to write.
+	if err := dhcpReader.Commit(); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "dhcp")); string(got) != snapshotDHCPConfig {
+		t.Errorf("dhcp after Restore and Commit:\n%s\nwant:\n%s", got, snapshotDHCPConfig)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("Expected only network and dhcp left in %s, got %v", dir, entries)
+	}
+}
+
+func TestSnapshot_RestoreSafeMode(t *testing.T) {
+	dir, netReader, _ := newSnapshotFixture(t)
+
+	snapshot, err := TakeSnapshot(dir, "network")
+	if err != nil {
+		t.Fatalf("TakeSnapshot() error = %v", err)
+	}
+	if err := SetNetworkIPAddrWithReader("ahwlan", "10.41.0.7", netReader); err != nil {
+		t.Fatalf("SetNetworkIPAddrWithReader() error = %v", err)
+	}
+
+	safemode.Set(true, "test")
+	defer safemode.Set(false, "test")
+
+	if err := snapshot.Restore(netReader); !errors.Is(err, safemode.ErrSuppressed) {
+		t.Errorf("Restore() error = %v, want ErrSuppressed", err)
+	}
+}
@@ -0,0 +1,383 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/digineo/go-uci/v2"
+	"github.com/openmanet/openmanetd/internal/safemode"
+)
+
+/*
+config queue 'wan'
+	option enabled '1'
+	option interface 'eth1'
+	option download '85000'
+	option upload '10000'
+	option qdisc 'cake'
+	option script 'piece_of_cake.qos'
+	option linklayer 'none'
+*/
+
+const (
+	sqmConfigName string = "sqm"
+)
+
+// UCISQMQueue represents a queue section of the sqm config, which shapes the traffic
+// of one interface. Name is the section name.
+//
+// Download and Upload are in kbit/s, as the gw_bandwidth a gateway announces in
+// batman-adv, so that a gateway can shape its uplink to the bandwidth it promises the
+// mesh. Zero disables shaping in that direction.
+type UCISQMQueue struct {
+	Name      string `json:"name"`
+	Enabled   string `uci:"option enabled" json:"enabled,omitempty"`
+	Interface string `uci:"option interface" json:"interface,omitempty"`
+	Download  string `uci:"option download" json:"download,omitempty"`
+	Upload    string `uci:"option upload" json:"upload,omitempty"`
+	// Qdisc is the queue discipline, e.g. "cake" or "fq_codel", and Script the sqm
+	// script that sets it up, e.g. "piece_of_cake.qos" or "simple.qos".
+	Qdisc     string `uci:"option qdisc" json:"qdisc,omitempty"`
+	Script    string `uci:"option script" json:"script,omitempty"`
+	LinkLayer string `uci:"option linklayer" json:"linklayer,omitempty"`
+	Overhead  string `uci:"option overhead" json:"overhead,omitempty"`
+}
+
+// SQMConfigReader defines an interface for reading sqm UCI configuration values.
+type SQMConfigReader interface {
+	GetSections(config, secType string) ([]string, error)
+	Get(config, section, option string) ([]string, bool)
+	SetType(config, section, option string, typ uci.OptionType, values ...string) error
+	Del(config, section, option string) error
+	AddSection(config, section, typ string) error
+	DelSection(config, section string) error
+	Commit() error
+	ReloadConfig() error
+}
+
+// UCISQMConfigReader wraps the UCI functions for sqm configuration.
+type UCISQMConfigReader struct {
+	tree uci.Tree
+	changeLog
+}
+
+// NewUCISQMConfigReader creates a new UCI sqm config reader with the default tree.
+func NewUCISQMConfigReader() *UCISQMConfigReader {
+	return NewUCISQMConfigReaderWithTree(uci.NewTree(uci.DefaultTreePath))
+}
+
+// NewUCISQMConfigReaderWithTree creates a UCI sqm config reader on tree, so that
+// several readers can share one tree or read a tree outside the default path.
+func NewUCISQMConfigReaderWithTree(tree uci.Tree) *UCISQMConfigReader {
+	return &UCISQMConfigReader{
+		tree: tree,
+	}
+}
+
+func (r *UCISQMConfigReader) GetSections(config, secType string) ([]string, error) {
+	return r.tree.GetSections(config, secType)
+}
+
+func (r *UCISQMConfigReader) Get(config, section, option string) ([]string, bool) {
+	return r.get(r.tree, config, section, option)
+}
+
+func (r *UCISQMConfigReader) SetType(config, section, option string, typ uci.OptionType, values ...string) error {
+	if err := safemode.Check(fmt.Sprintf("uci set %s.%s.%s", config, section, option)); err != nil {
+		return err
+	}
+	return r.setType(r.tree, config, section, option, typ, values...)
+}
+
+func (r *UCISQMConfigReader) Del(config, section, option string) error {
+	if err := safemode.Check(fmt.Sprintf("uci delete %s.%s.%s", config, section, option)); err != nil {
+		return err
+	}
+	return r.del(r.tree, config, section, option)
+}
+
+func (r *UCISQMConfigReader) AddSection(config, section, typ string) error {
+	if err := safemode.Check(fmt.Sprintf("uci add %s.%s", config, section)); err != nil {
+		return err
+	}
+	return r.addSection(r.tree, config, section, typ)
+}
+
+func (r *UCISQMConfigReader) DelSection(config, section string) error {
+	if err := safemode.Check(fmt.Sprintf("uci delete %s.%s", config, section)); err != nil {
+		return err
+	}
+	return r.delSection(r.tree, config, section)
+}
+
+// Commit writes staged changes to disk. Failures caused by a read-only
+// filesystem are reported as ErrReadOnlyFS.
+func (r *UCISQMConfigReader) Commit() error {
+	if err := safemode.Check("uci commit"); err != nil {
+		return err
+	}
+	return classifyCommitError(r.commit(r.tree))
+}
+
+func (r *UCISQMConfigReader) ReloadConfig() error {
+	if err := r.tree.LoadConfig(sqmConfigName, true); err != nil {
+		return err
+	}
+	r.reset(sqmConfigName)
+	return nil
+}
+
+// Revert discards the sqm changes staged since the last commit. The config is read
+// from disk again on next use.
+func (r *UCISQMConfigReader) Revert() {
+	r.tree.Revert(sqmConfigName)
+	r.reset(sqmConfigName)
+}
+
+// sqmOption returns the first value of an option of an sqm section, or "" if it is
+// not set.
+func sqmOption(reader SQMConfigReader, section, option string) string {
+	values, ok := reader.Get(sqmConfigName, section, option)
+	if !ok || len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// sqmQueueSections returns the queue sections in file order.
+func sqmQueueSections(reader SQMConfigReader) ([]string, error) {
+	sections, err := reader.GetSections(sqmConfigName, "queue")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sqm queues: %w", err)
+	}
+	return sections, nil
+}
+
+// readSQMQueue reads the options of the queue section.
+func readSQMQueue(reader SQMConfigReader, section string) UCISQMQueue {
+	return UCISQMQueue{
+		Name:      section,
+		Enabled:   sqmOption(reader, section, "enabled"),
+		Interface: sqmOption(reader, section, "interface"),
+		Download:  sqmOption(reader, section, "download"),
+		Upload:    sqmOption(reader, section, "upload"),
+		Qdisc:     sqmOption(reader, section, "qdisc"),
+		Script:    sqmOption(reader, section, "script"),
+		LinkLayer: sqmOption(reader, section, "linklayer"),
+		Overhead:  sqmOption(reader, section, "overhead"),
+	}
+}
+
+// validateSQMRate checks that value, if set, is a rate in kbit/s.
+func validateSQMRate(section, option, value string) error {
+	if value == "" {
+		return nil
+	}
+	if n, err := strconv.Atoi(value); err != nil || n < 0 {
+		return newInvalidOptionError(sqmConfigName, section, option, value, "must be a non-negative number of kbit/s")
+	}
+	return nil
+}
+
+// GetSQMQueues loads and returns the sqm queues in file order.
+func GetSQMQueues() ([]UCISQMQueue, error) {
+	return GetSQMQueuesWithReader(NewUCISQMConfigReader())
+}
+
+// GetSQMQueuesWithReader loads and returns the sqm queues using the provided reader.
+func GetSQMQueuesWithReader(reader SQMConfigReader) ([]UCISQMQueue, error) {
+	sections, err := sqmQueueSections(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	queues := make([]UCISQMQueue, 0, len(sections))
+	for _, section := range sections {
+		queues = append(queues, readSQMQueue(reader, section))
+	}
+
+	return queues, nil
+}
+
+// GetSQMQueue loads and returns the sqm queue section name.
+//
+// Returns an ErrSectionNotFound error if there is no queue of that name.
+//
+// Example:
+//
+//	queue, err := GetSQMQueue("wan")
+//	if err == nil {
+//	    fmt.Printf("Shaping %s to %s/%s kbit/s\n", queue.Interface, queue.Download, queue.Upload)
+//	}
+func GetSQMQueue(name string) (*UCISQMQueue, error) {
+	return GetSQMQueueWithReader(name, NewUCISQMConfigReader())
+}
+
+// GetSQMQueueWithReader loads and returns an sqm queue using the provided reader.
+func GetSQMQueueWithReader(name string, reader SQMConfigReader) (*UCISQMQueue, error) {
+	sections, err := sqmQueueSections(reader)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(sections, name) {
+		return nil, fmt.Errorf("%w: sqm queue %q", ErrSectionNotFound, name)
+	}
+
+	queue := readSQMQueue(reader, name)
+	return &queue, nil
+}
+
+// SetSQMQueue creates or updates the sqm queue queue.Name. Empty fields are left as
+// they are; a new queue needs an interface.
+//
+// Returns true if any option changed and the configuration was committed, or an
+// ErrInvalidOption error if a rate is not a number of kbit/s. Call RestartSQM to
+// apply it.
+//
+// Example:
+//
+//	changed, err := SetSQMQueue(&UCISQMQueue{
+//	    Name:      "wan",
+//	    Enabled:   "1",
+//	    Interface: "eth1",
+//	    Download:  "85000",
+//	    Upload:    "10000",
+//	    Qdisc:     "cake",
+//	    Script:    "piece_of_cake.qos",
+//	})
+//	if err == nil && changed {
+//	    err = RestartSQM()
+//	}
+func SetSQMQueue(queue *UCISQMQueue) (bool, error) {
+	return SetSQMQueueWithReader(queue, NewUCISQMConfigReader())
+}
+
+// SetSQMQueueWithReader creates or updates an sqm queue using the provided reader.
+func SetSQMQueueWithReader(queue *UCISQMQueue, reader SQMConfigReader) (bool, error) {
+	if queue == nil || queue.Name == "" {
+		return false, newValidationError("queue must have a name")
+	}
+	if err := validateSQMRate(queue.Name, "download", queue.Download); err != nil {
+		return false, err
+	}
+	if err := validateSQMRate(queue.Name, "upload", queue.Upload); err != nil {
+		return false, err
+	}
+	if queue.Enabled != "" && queue.Enabled != "0" && queue.Enabled != "1" {
+		return false, newInvalidOptionError(sqmConfigName, queue.Name, "enabled", queue.Enabled, "must be 0 or 1")
+	}
+
+	sections, err := sqmQueueSections(reader)
+	if err != nil {
+		return false, err
+	}
+
+	exists := slices.Contains(sections, queue.Name)
+	if !exists {
+		if queue.Interface == "" {
+			return false, newValidationError("new sqm queue %q must have an interface", queue.Name)
+		}
+		if err := reader.AddSection(sqmConfigName, queue.Name, "queue"); err != nil {
+			return false, newSectionError("add", sqmConfigName, queue.Name, err)
+		}
+	}
+
+	set, err := setOptionsIfChanged(reader, sqmConfigName, queue.Name, []uciOption{
+		{name: "enabled", typ: uci.TypeOption, value: queue.Enabled},
+		{name: "interface", typ: uci.TypeOption, value: queue.Interface},
+		{name: "download", typ: uci.TypeOption, value: queue.Download},
+		{name: "upload", typ: uci.TypeOption, value: queue.Upload},
+		{name: "qdisc", typ: uci.TypeOption, value: queue.Qdisc},
+		{name: "script", typ: uci.TypeOption, value: queue.Script},
+		{name: "linklayer", typ: uci.TypeOption, value: queue.LinkLayer},
+		{name: "overhead", typ: uci.TypeOption, value: queue.Overhead},
+	})
+	if err != nil {
+		return false, err
+	}
+	if exists && !set {
+		return false, nil
+	}
+
+	if err := reader.Commit(); err != nil {
+		return false, newCommitError(sqmConfigName, err)
+	}
+
+	return true, nil
+}
+
+// SetSQMBandwidth sets the shaping rates of an existing sqm queue, e.g. to the
+// gw_bandwidth the gateway announces in batman-adv, so that the uplink is not
+// promised more than it is shaped to.
+//
+// Parameters:
+//   - name: The sqm queue section
+//   - down: The download rate in kbit/s, zero for no shaping
+//   - up: The upload rate in kbit/s, zero for no shaping
+//
+// Returns true if a rate changed and the configuration was committed, and an
+// ErrSectionNotFound error if there is no queue of that name.
+//
+// Example:
+//
+//	changed, err := SetSQMBandwidth("wan", 85000, 10000)
+func SetSQMBandwidth(name string, down, up int) (bool, error) {
+	return SetSQMBandwidthWithReader(name, down, up, NewUCISQMConfigReader())
+}
+
+// SetSQMBandwidthWithReader sets the shaping rates of an sqm queue using the provided
+// reader.
+func SetSQMBandwidthWithReader(name string, down, up int, reader SQMConfigReader) (bool, error) {
+	if down < 0 || up < 0 {
+		return false, newValidationError("sqm rates must not be negative, got %d/%d", down, up)
+	}
+	if _, err := GetSQMQueueWithReader(name, reader); err != nil {
+		return false, err
+	}
+
+	return SetSQMQueueWithReader(&UCISQMQueue{
+		Name:     name,
+		Download: strconv.Itoa(down),
+		Upload:   strconv.Itoa(up),
+	}, reader)
+}
+
+// DeleteSQMQueue deletes the sqm queue name and commits. Nothing is written if there
+// is no such queue.
+//
+// Returns true if the queue was deleted.
+func DeleteSQMQueue(name string) (bool, error) {
+	return DeleteSQMQueueWithReader(name, NewUCISQMConfigReader())
+}
+
+// DeleteSQMQueueWithReader deletes an sqm queue using the provided reader.
+func DeleteSQMQueueWithReader(name string, reader SQMConfigReader) (bool, error) {
+	sections, err := sqmQueueSections(reader)
+	if err != nil || !slices.Contains(sections, name) {
+		return false, err
+	}
+
+	if err := reader.DelSection(sqmConfigName, name); err != nil {
+		return false, newSectionError("delete", sqmConfigName, name, err)
+	}
+
+	if err := reader.Commit(); err != nil {
+		return false, newCommitError(sqmConfigName, err)
+	}
+
+	return true, nil
+}
+
+// RestartSQM applies the sqm configuration by restarting the sqm service, which
+// tears down and sets up the shaping of every enabled queue.
+//
+// Returns an ErrReloadFailed if the restart could not be run.
+func RestartSQM() error {
+	if err := safemode.Check("restart sqm"); err != nil {
+		return err
+	}
+
+	return runInitScript(context.Background(), "sqm", "restart")
+}
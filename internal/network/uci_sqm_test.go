@@ -0,0 +1,162 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/digineo/go-uci/v2"
+)
+
+const testSQMConfig = `
+config queue 'eth1'
+	option enabled '0'
+	option interface 'eth1'
+	option download '85000'
+	option upload '10000'
+	option qdisc 'fq_codel'
+	option script 'simple.qos'
+	option linklayer 'none'
+`
+
+func TestGetSQMQueueWithReader(t *testing.T) {
+	reader := NewUCISQMConfigReaderWithTree(uci.NewTree(writeTestConfig(t, "sqm", testSQMConfig)))
+
+	got, err := GetSQMQueueWithReader("eth1", reader)
+	if err != nil {
+		t.Fatalf("GetSQMQueueWithReader() error = %v", err)
+	}
+	want := &UCISQMQueue{
+		Name:      "eth1",
+		Enabled:   "0",
+		Interface: "eth1",
+		Download:  "85000",
+		Upload:    "10000",
+		Qdisc:     "fq_codel",
+		Script:    "simple.qos",
+		LinkLayer: "none",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetSQMQueueWithReader() = %+v, want %+v", got, want)
+	}
+
+	if _, err := GetSQMQueueWithReader("lte", reader); !errors.Is(err, ErrSectionNotFound) {
+		t.Errorf("GetSQMQueueWithReader(lte) error = %v, want ErrSectionNotFound", err)
+	}
+}
+
+func TestSetSQMQueueWithReader(t *testing.T) {
+	dir := writeTestConfig(t, "sqm", testSQMConfig)
+	reader := NewUCISQMConfigReaderWithTree(uci.NewTree(dir))
+
+	changed, err := SetSQMQueueWithReader(&UCISQMQueue{
+		Name:      "lte",
+		Enabled:   "1",
+		Interface: "wwan0",
+		Download:  "20000",
+		Upload:    "5000",
+		Qdisc:     "cake",
+		Script:    "piece_of_cake.qos",
+	}, reader)
+	if err != nil || !changed {
+		t.Fatalf("SetSQMQueueWithReader() = %v, %v, want true, nil", changed, err)
+	}
+
+	// Only the given fields of an existing queue are written
+	changed, err = SetSQMQueueWithReader(&UCISQMQueue{Name: "eth1", Enabled: "1"}, reader)
+	if err != nil || !changed {
+		t.Fatalf("SetSQMQueueWithReader(eth1) = %v, %v, want true, nil", changed, err)
+	}
+
+	queues, _ := GetSQMQueuesWithReader(NewUCISQMConfigReaderWithTree(uci.NewTree(dir)))
+	if len(queues) != 2 {
+		t.Fatalf("queues = %+v, want eth1 and lte", queues)
+	}
+	if queues[0].Enabled != "1" || queues[0].Qdisc != "fq_codel" {
+		t.Errorf("eth1 = %+v, want enabled with its qdisc kept", queues[0])
+	}
+	if queues[1].Interface != "wwan0" || queues[1].Script != "piece_of_cake.qos" {
+		t.Errorf("lte = %+v", queues[1])
+	}
+
+	changed, err = SetSQMQueueWithReader(&UCISQMQueue{Name: "eth1", Enabled: "1"}, reader)
+	if err != nil || changed {
+		t.Errorf("SetSQMQueueWithReader() again = %v, %v, want false, nil", changed, err)
+	}
+}
+
+func TestSetSQMQueueWithReader_Invalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		queue *UCISQMQueue
+	}{
+		{"nil", nil},
+		{"no name", &UCISQMQueue{Interface: "eth1"}},
+		{"new without interface", &UCISQMQueue{Name: "lte", Download: "1000"}},
+		{"rate", &UCISQMQueue{Name: "eth1", Download: "85mbit"}},
+		{"negative rate", &UCISQMQueue{Name: "eth1", Upload: "-1"}},
+		{"enabled", &UCISQMQueue{Name: "eth1", Enabled: "yes"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := NewUCISQMConfigReaderWithTree(uci.NewTree(writeTestConfig(t, "sqm", testSQMConfig)))
+
+			if _, err := SetSQMQueueWithReader(tt.queue, reader); !errors.Is(err, ErrValidation) {
+				t.Errorf("SetSQMQueueWithReader() error = %v, want ErrValidation", err)
+			}
+			if got := reader.Changes(); len(got) != 0 {
+				t.Errorf("staged changes = %v, want none", got)
+			}
+		})
+	}
+}
+
+func TestSetSQMBandwidthWithReader(t *testing.T) {
+	reader := NewUCISQMConfigReaderWithTree(uci.NewTree(writeTestConfig(t, "sqm", testSQMConfig)))
+
+	changed, err := SetSQMBandwidthWithReader("eth1", 50000, 0, reader)
+	if err != nil || !changed {
+		t.Fatalf("SetSQMBandwidthWithReader() = %v, %v, want true, nil", changed, err)
+	}
+	queue, _ := GetSQMQueueWithReader("eth1", reader)
+	if queue.Download != "50000" || queue.Upload != "0" {
+		t.Errorf("rates = %s/%s, want 50000/0", queue.Download, queue.Upload)
+	}
+
+	if _, err := SetSQMBandwidthWithReader("lte", 1000, 1000, reader); !errors.Is(err, ErrSectionNotFound) {
+		t.Errorf("SetSQMBandwidthWithReader(lte) error = %v, want ErrSectionNotFound", err)
+	}
+}
+
+func TestDeleteSQMQueueWithReader(t *testing.T) {
+	reader := NewUCISQMConfigReaderWithTree(uci.NewTree(writeTestConfig(t, "sqm", testSQMConfig)))
+
+	if deleted, err := DeleteSQMQueueWithReader("lte", reader); err != nil || deleted {
+		t.Errorf("DeleteSQMQueueWithReader(lte) = %v, %v, want false, nil", deleted, err)
+	}
+	if deleted, err := DeleteSQMQueueWithReader("eth1", reader); err != nil || !deleted {
+		t.Errorf("DeleteSQMQueueWithReader(eth1) = %v, %v, want true, nil", deleted, err)
+	}
+	if queues, _ := GetSQMQueuesWithReader(reader); len(queues) != 0 {
+		t.Errorf("queues after delete = %+v", queues)
+	}
+}
+
+func TestRestartSQM_Ubus(t *testing.T) {
+	var args any
+	orig := ubusCall
+	ubusCall = func(ctx context.Context, object, method string, a any) (map[string]any, error) {
+		args = a
+		return nil, nil
+	}
+	t.Cleanup(func() { ubusCall = orig })
+
+	if err := RestartSQM(); err != nil {
+		t.Fatalf("RestartSQM() error = %v", err)
+	}
+	if want := map[string]any{"name": "sqm", "action": "restart"}; !reflect.DeepEqual(args, want) {
+		t.Errorf("rc init args = %v, want %v", args, want)
+	}
+}
@@ -0,0 +1,322 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/digineo/go-uci/v2"
+	"github.com/openmanet/openmanetd/internal/safemode"
+)
+
+/*
+config system
+	option hostname 'OpenWrt'
+	option timezone 'UTC'
+	option zonename 'UTC'
+	option log_size '64'
+	option conloglevel '8'
+	option cronloglevel '5'
+*/
+
+const (
+	systemConfigName string = "system"
+)
+
+// UCISystem represents the system section of the system UCI configuration.
+type UCISystem struct {
+	Hostname string `uci:"option hostname" json:"hostname,omitempty"`
+	// Timezone is the POSIX TZ string, e.g. "CET-1CEST,M3.5.0,M10.5.0/3".
+	Timezone string `uci:"option timezone" json:"timezone,omitempty"`
+	// Zonename is the zoneinfo name LuCI shows, e.g. "Europe/Berlin".
+	Zonename string `uci:"option zonename" json:"zonename,omitempty"`
+	// LogSize is the size of the in-memory log buffer in KiB.
+	LogSize string `uci:"option log_size" json:"log_size,omitempty"`
+	// LogIP, LogPort and LogProto send the log to a remote syslog server.
+	LogIP        string `uci:"option log_ip" json:"log_ip,omitempty"`
+	LogPort      string `uci:"option log_port" json:"log_port,omitempty"`
+	LogProto     string `uci:"option log_proto" json:"log_proto,omitempty"`
+	ConLogLevel  string `uci:"option conloglevel" json:"conloglevel,omitempty"`
+	CronLogLevel string `uci:"option cronloglevel" json:"cronloglevel,omitempty"`
+}
+
+// SystemConfigReader defines an interface for reading system UCI configuration values.
+// The system section is usually anonymous, so it is found by type with GetSections.
+type SystemConfigReader interface {
+	GetSections(config, secType string) ([]string, error)
+	Get(config, section, option string) ([]string, bool)
+	SetType(config, section, option string, typ uci.OptionType, values ...string) error
+	Del(config, section, option string) error
+	AddSection(config, section, typ string) error
+	DelSection(config, section string) error
+	Commit() error
+	ReloadConfig() error
+}
+
+// UCISystemConfigReader wraps the UCI functions for system configuration.
+type UCISystemConfigReader struct {
+	tree uci.Tree
+	changeLog
+}
+
+// NewUCISystemConfigReader creates a new UCI system config reader with the default tree.
+func NewUCISystemConfigReader() *UCISystemConfigReader {
+	return NewUCISystemConfigReaderWithTree(uci.NewTree(uci.DefaultTreePath))
+}
+
+// NewUCISystemConfigReaderWithTree creates a UCI system config reader on tree, so that
+// several readers can share one tree or read a tree outside the default path.
+func NewUCISystemConfigReaderWithTree(tree uci.Tree) *UCISystemConfigReader {
+	return &UCISystemConfigReader{
+		tree: tree,
+	}
+}
+
+func (r *UCISystemConfigReader) GetSections(config, secType string) ([]string, error) {
+	return r.tree.GetSections(config, secType)
+}
+
+func (r *UCISystemConfigReader) Get(config, section, option string) ([]string, bool) {
+	return r.get(r.tree, config, section, option)
+}
+
+func (r *UCISystemConfigReader) SetType(config, section, option string, typ uci.OptionType, values ...string) error {
+	if err := safemode.Check(fmt.Sprintf("uci set %s.%s.%s", config, section, option)); err != nil {
+		return err
+	}
+	return r.setType(r.tree, config, section, option, typ, values...)
+}
+
+func (r *UCISystemConfigReader) Del(config, section, option string) error {
+	if err := safemode.Check(fmt.Sprintf("uci delete %s.%s.%s", config, section, option)); err != nil {
+		return err
+	}
+	return r.del(r.tree, config, section, option)
+}
+
+func (r *UCISystemConfigReader) AddSection(config, section, typ string) error {
+	if err := safemode.Check(fmt.Sprintf("uci add %s.%s", config, section)); err != nil {
+		return err
+	}
+	return r.addSection(r.tree, config, section, typ)
+}
+
+func (r *UCISystemConfigReader) DelSection(config, section string) error {
+	if err := safemode.Check(fmt.Sprintf("uci delete %s.%s", config, section)); err != nil {
+		return err
+	}
+	return r.delSection(r.tree, config, section)
+}
+
+// Commit writes staged changes to disk. Failures caused by a read-only
+// filesystem are reported as ErrReadOnlyFS.
+func (r *UCISystemConfigReader) Commit() error {
+	if err := safemode.Check("uci commit"); err != nil {
+		return err
+	}
+	return classifyCommitError(r.commit(r.tree))
+}
+
+func (r *UCISystemConfigReader) ReloadConfig() error {
+	if err := r.tree.LoadConfig(systemConfigName, true); err != nil {
+		return err
+	}
+	r.reset(systemConfigName)
+	return nil
+}
+
+// Revert discards the system changes staged since the last commit. The config is
+// read from disk again on next use.
+func (r *UCISystemConfigReader) Revert() {
+	r.tree.Revert(systemConfigName)
+	r.reset(systemConfigName)
+}
+
+// systemSection returns the section holding the system options, the first section
+// of type "system", which OpenWrt leaves anonymous as "@system[0]".
+//
+// Returns an ErrSectionNotFound error if the config has no system section.
+func systemSection(reader SystemConfigReader) (string, error) {
+	sections, err := reader.GetSections(systemConfigName, "system")
+	if err != nil {
+		return "", fmt.Errorf("failed to read system sections: %w", err)
+	}
+	if len(sections) == 0 {
+		return "", fmt.Errorf("%w: no system section in %s", ErrSectionNotFound, systemConfigName)
+	}
+	return sections[0], nil
+}
+
+// GetSystemConfig loads and returns the system configuration.
+//
+// Returns an ErrSectionNotFound error if the config has no system section.
+//
+// Example:
+//
+//	config, err := GetSystemConfig()
+//	if err != nil {
+//	    log.Fatalf("Failed to get system config: %v", err)
+//	}
+//	fmt.Printf("Hostname: %s\n", config.Hostname)
+func GetSystemConfig() (*UCISystem, error) {
+	return GetSystemConfigWithReader(NewUCISystemConfigReader())
+}
+
+// GetSystemConfigWithReader loads and returns the system configuration using the provided reader.
+func GetSystemConfigWithReader(reader SystemConfigReader) (*UCISystem, error) {
+	section, err := systemSection(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	var config UCISystem
+	for _, opt := range []struct {
+		name  string
+		field *string
+	}{
+		{"hostname", &config.Hostname},
+		{"timezone", &config.Timezone},
+		{"zonename", &config.Zonename},
+		{"log_size", &config.LogSize},
+		{"log_ip", &config.LogIP},
+		{"log_port", &config.LogPort},
+		{"log_proto", &config.LogProto},
+		{"conloglevel", &config.ConLogLevel},
+		{"cronloglevel", &config.CronLogLevel},
+	} {
+		if values, ok := reader.Get(systemConfigName, section, opt.name); ok && len(values) > 0 {
+			*opt.field = values[0]
+		}
+	}
+
+	return &config, nil
+}
+
+// SetSystemConfig updates the system configuration. The new settings only take
+// effect once ReloadSystem has run.
+//
+// Returns true if any option changed and the configuration was committed. Empty
+// fields are left as they are, and nothing is committed when no option changed.
+// Returns an ErrInvalidOption error if the hostname is not a valid host name.
+//
+// Example:
+//
+//	changed, err := SetSystemConfig(&UCISystem{
+//	    Timezone: "UTC",
+//	    Zonename: "UTC",
+//	})
+func SetSystemConfig(config *UCISystem) (bool, error) {
+	return SetSystemConfigWithReader(config, NewUCISystemConfigReader())
+}
+
+// SetSystemConfigWithReader updates the system configuration using the provided reader.
+func SetSystemConfigWithReader(config *UCISystem, reader SystemConfigReader) (bool, error) {
+	if config == nil {
+		return false, newValidationError("config cannot be nil")
+	}
+
+	section, err := systemSection(reader)
+	if err != nil {
+		return false, err
+	}
+	if config.Hostname != "" {
+		if reason := validateHostname(config.Hostname); reason != "" {
+			return false, newInvalidOptionError(systemConfigName, section, "hostname", config.Hostname, reason)
+		}
+	}
+
+	changed, err := setOptionsIfChanged(reader, systemConfigName, section, []uciOption{
+		{name: "hostname", typ: uci.TypeOption, value: config.Hostname},
+		{name: "timezone", typ: uci.TypeOption, value: config.Timezone},
+		{name: "zonename", typ: uci.TypeOption, value: config.Zonename},
+		{name: "log_size", typ: uci.TypeOption, value: config.LogSize},
+		{name: "log_ip", typ: uci.TypeOption, value: config.LogIP},
+		{name: "log_port", typ: uci.TypeOption, value: config.LogPort},
+		{name: "log_proto", typ: uci.TypeOption, value: config.LogProto},
+		{name: "conloglevel", typ: uci.TypeOption, value: config.ConLogLevel},
+		{name: "cronloglevel", typ: uci.TypeOption, value: config.CronLogLevel},
+	})
+	if err != nil || !changed {
+		return false, err
+	}
+
+	if err := reader.Commit(); err != nil {
+		return false, newCommitError(systemConfigName, err)
+	}
+
+	return true, nil
+}
+
+// GetSystemHostname returns the hostname set in the system configuration, which may
+// differ from the running hostname until the system service is reloaded.
+//
+// Example:
+//
+//	hostname, err := GetSystemHostname()
+func GetSystemHostname() (string, error) {
+	return GetSystemHostnameWithReader(NewUCISystemConfigReader())
+}
+
+// GetSystemHostnameWithReader returns the configured hostname using the provided reader.
+func GetSystemHostnameWithReader(reader SystemConfigReader) (string, error) {
+	config, err := GetSystemConfigWithReader(reader)
+	if err != nil {
+		return "", err
+	}
+
+	return config.Hostname, nil
+}
+
+// SetSystemHostname sets the hostname in the system configuration, e.g. to a name
+// derived from the mesh MAC. Call ReloadSystem to apply it to the running system.
+//
+// Returns true if the hostname changed and the configuration was committed, or an
+// ErrInvalidOption error if hostname is not a valid host name.
+//
+// Example:
+//
+//	changed, err := SetSystemHostname("node-a1b2c3")
+//	if err == nil && changed {
+//	    err = ReloadSystem()
+//	}
+func SetSystemHostname(hostname string) (bool, error) {
+	return SetSystemHostnameWithReader(hostname, NewUCISystemConfigReader())
+}
+
+// SetSystemHostnameWithReader sets the configured hostname using the provided reader.
+func SetSystemHostnameWithReader(hostname string, reader SystemConfigReader) (bool, error) {
+	if hostname == "" {
+		return false, newValidationError("hostname cannot be empty")
+	}
+
+	return SetSystemConfigWithReader(&UCISystem{Hostname: hostname}, reader)
+}
+
+// validateHostname checks that hostname is a single DNS label as RFC 1123 allows,
+// so that it can also be resolved as <hostname>.<domain> on the mesh.
+func validateHostname(hostname string) string {
+	if len(hostname) > 63 {
+		return "must be at most 63 characters"
+	}
+	if strings.HasPrefix(hostname, "-") || strings.HasSuffix(hostname, "-") {
+		return "must not start or end with a hyphen"
+	}
+	for _, c := range hostname {
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') && c != '-' {
+			return "must contain only letters, digits and hyphens"
+		}
+	}
+	return ""
+}
+
+// ReloadSystem applies the system configuration by reloading the system service,
+// which sets the hostname, timezone and log daemon settings from UCI.
+//
+// Returns an ErrReloadFailed if the reload could not be run.
+func ReloadSystem() error {
+	if err := safemode.Check("reload system"); err != nil {
+		return err
+	}
+
+	return runInitScript(context.Background(), "system", "reload")
+}
@@ -0,0 +1,138 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/digineo/go-uci/v2"
+)
+
+const testSystemConfig = `
+config system
+	option hostname 'OpenWrt'
+	option timezone 'UTC'
+	option zonename 'UTC'
+	option log_size '64'
+	option conloglevel '8'
+	option cronloglevel '5'
+
+config timeserver 'ntp'
+	list server '0.openwrt.pool.ntp.org'
+`
+
+func TestGetSystemConfigWithReader(t *testing.T) {
+	reader := NewUCISystemConfigReaderWithTree(uci.NewTree(writeTestConfig(t, "system", testSystemConfig)))
+
+	got, err := GetSystemConfigWithReader(reader)
+	if err != nil {
+		t.Fatalf("GetSystemConfigWithReader() error = %v", err)
+	}
+
+	want := &UCISystem{
+		Hostname:     "OpenWrt",
+		Timezone:     "UTC",
+		Zonename:     "UTC",
+		LogSize:      "64",
+		ConLogLevel:  "8",
+		CronLogLevel: "5",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetSystemConfigWithReader() = %+v, want %+v", got, want)
+	}
+}
+
+func TestGetSystemConfigWithReader_NoSection(t *testing.T) {
+	reader := NewUCISystemConfigReaderWithTree(uci.NewTree(writeTestConfig(t, "system", "config timeserver 'ntp'\n\tlist server '0.openwrt.pool.ntp.org'\n")))
+
+	if _, err := GetSystemHostnameWithReader(reader); !errors.Is(err, ErrSectionNotFound) {
+		t.Errorf("GetSystemHostnameWithReader() error = %v, want ErrSectionNotFound", err)
+	}
+}
+
+func TestSetSystemHostnameWithReader(t *testing.T) {
+	dir := writeTestConfig(t, "system", testSystemConfig)
+	reader := NewUCISystemConfigReaderWithTree(uci.NewTree(dir))
+
+	changed, err := SetSystemHostnameWithReader("node-a1b2c3", reader)
+	if err != nil {
+		t.Fatalf("SetSystemHostnameWithReader() error = %v", err)
+	}
+	if !changed {
+		t.Error("SetSystemHostnameWithReader() changed = false, want true")
+	}
+
+	// The anonymous section is written back in place
+	data, _ := os.ReadFile(filepath.Join(dir, "system"))
+	if !strings.Contains(string(data), "option hostname 'node-a1b2c3'") || strings.Contains(string(data), "OpenWrt") {
+		t.Errorf("system config after set:\n%s", data)
+	}
+
+	fresh := NewUCISystemConfigReaderWithTree(uci.NewTree(dir))
+	if got, _ := GetSystemHostnameWithReader(fresh); got != "node-a1b2c3" {
+		t.Errorf("hostname read back = %q, want node-a1b2c3", got)
+	}
+	if got, _ := GetSystemConfigWithReader(fresh); got.Timezone != "UTC" {
+		t.Errorf("timezone = %q, want it kept", got.Timezone)
+	}
+
+	changed, err = SetSystemHostnameWithReader("node-a1b2c3", reader)
+	if err != nil || changed {
+		t.Errorf("SetSystemHostnameWithReader() with the same name = %v, %v, want false, nil", changed, err)
+	}
+}
+
+func TestSetSystemHostnameWithReader_Invalid(t *testing.T) {
+	tests := []string{
+		"node_1",
+		"-node",
+		"node-",
+		"node.mesh",
+		strings.Repeat("a", 64),
+	}
+
+	for _, hostname := range tests {
+		t.Run(hostname, func(t *testing.T) {
+			reader := NewUCISystemConfigReaderWithTree(uci.NewTree(writeTestConfig(t, "system", testSystemConfig)))
+
+			_, err := SetSystemHostnameWithReader(hostname, reader)
+
+			var invalid *ErrInvalidOption
+			if !errors.As(err, &invalid) || invalid.Option != "hostname" {
+				t.Fatalf("SetSystemHostnameWithReader(%q) error = %v, want ErrInvalidOption for hostname", hostname, err)
+			}
+			if got := reader.Changes(); len(got) != 0 {
+				t.Errorf("staged changes = %v, want none", got)
+			}
+		})
+	}
+
+	reader := NewUCISystemConfigReaderWithTree(uci.NewTree(writeTestConfig(t, "system", testSystemConfig)))
+	if _, err := SetSystemHostnameWithReader("", reader); !errors.Is(err, ErrValidation) {
+		t.Errorf("SetSystemHostnameWithReader(\"\") error = %v, want ErrValidation", err)
+	}
+}
+
+func TestReloadSystem_Ubus(t *testing.T) {
+	var args any
+	orig := ubusCall
+	ubusCall = func(ctx context.Context, object, method string, a any) (map[string]any, error) {
+		if object != "rc" || method != "init" {
+			t.Errorf("called %s %s, want rc init", object, method)
+		}
+		args = a
+		return nil, nil
+	}
+	t.Cleanup(func() { ubusCall = orig })
+
+	if err := ReloadSystem(); err != nil {
+		t.Fatalf("ReloadSystem() error = %v", err)
+	}
+	if want := map[string]any{"name": "system", "action": "reload"}; !reflect.DeepEqual(args, want) {
+		t.Errorf("rc init args = %v, want %v", args, want)
+	}
+}
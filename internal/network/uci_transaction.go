@@ -0,0 +1,230 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/digineo/go-uci/v2"
+)
+
+// Transaction batches changes to one UCI config into a single commit. It wraps the
+// reader of the config and is itself a reader, so the setters of this package can
+// be handed a Transaction in place of their reader: their changes are staged as
+// usual, but the commit each of them would make is deferred until Apply.
+//
+// Example:
+//
+//	tx := NewTransaction(networkConfigName, NewUCINetworkConfigReader())
+//	tx.OnApply(ReloadNetwork)
+//	if err := SetNetworkProtoWithReader("ahwlan", "static", tx); err != nil {
+//	    _ = tx.Discard()
+//	    return err
+//	}
+//	if err := SetNetworkIPAddrWithReader("ahwlan", "10.41.1.1", tx); err != nil {
+//	    _ = tx.Discard()
+//	    return err
+//	}
+//	changed, err := tx.Apply()
+//
+// A Transaction is not safe for concurrent use.
+type Transaction struct {
+	reader ConfigReader
+	config string
+	reload func() error
+
+	// staged is set once a change has been staged or a setter asked to commit.
+	staged bool
+	done   bool
+}
+
+// A Transaction can be handed to the setters of every config in place of its reader.
+var (
+	_ ConfigReader          = (*Transaction)(nil)
+	_ DeviceConfigReader    = (*Transaction)(nil)
+	_ DHCPConfigReader      = (*Transaction)(nil)
+	_ FirewallConfigReader  = (*Transaction)(nil)
+	_ OpenMANETConfigReader = (*Transaction)(nil)
+	_ SystemConfigReader    = (*Transaction)(nil)
+	_ Mwan3ConfigReader     = (*Transaction)(nil)
+	_ SQMConfigReader       = (*Transaction)(nil)
+	_ WirelessConfigReader  = (*Transaction)(nil)
+)
+
+// NewTransaction starts a transaction on config through reader, e.g. "network" and
+// a UCINetworkConfigReader. The tree of reader should not be committed by anyone
+// else until the transaction is applied or discarded.
+func NewTransaction(config string, reader ConfigReader) *Transaction {
+	return &Transaction{
+		reader: reader,
+		config: config,
+	}
+}
+
+// OnApply makes Apply call reload after a successful commit, e.g. ReloadNetwork.
+// It is not called when nothing was staged.
+func (tx *Transaction) OnApply(reload func() error) {
+	tx.reload = reload
+}
+
+// Staged reports whether any change has been staged.
+func (tx *Transaction) Staged() bool {
+	return tx.staged
+}
+
+// Changes returns the changes staged so far if the wrapped reader reports them, as
+// the readers of this package do.
+func (tx *Transaction) Changes() []UCIChange {
+	if r, ok := tx.reader.(ChangeReporter); ok {
+		return r.Changes()
+	}
+	return nil
+}
+
+// GetSections lists the sections of secType if the wrapped reader can list
+// sections, as DHCPConfigReader can.
+func (tx *Transaction) GetSections(config, secType string) ([]string, error) {
+	lister, ok := tx.reader.(interface {
+		GetSections(config, secType string) ([]string, error)
+	})
+	if !ok {
+		return nil, errors.New("reader cannot list sections")
+	}
+	return lister.GetSections(config, secType)
+}
+
+// Get reads an option, including the changes staged so far.
+func (tx *Transaction) Get(config, section, option string) ([]string, bool) {
+	return tx.reader.Get(config, section, option)
+}
+
+// SetType stages an option.
+func (tx *Transaction) SetType(config, section, option string, typ uci.OptionType, values ...string) error {
+	if tx.done {
+		return ErrTransactionDone
+	}
+	if err := tx.reader.SetType(config, section, option, typ, values...); err != nil {
+		return err
+	}
+	tx.staged = true
+	return nil
+}
+
+// Del stages the deletion of an option.
+func (tx *Transaction) Del(config, section, option string) error {
+	if tx.done {
+		return ErrTransactionDone
+	}
+	if err := tx.reader.Del(config, section, option); err != nil {
+		return err
+	}
+	tx.staged = true
+	return nil
+}
+
+// AddSection stages a new section. Adding a section that exists succeeds without
+// changing anything, so it does not count as a staged change by itself; the setters
+// that add sections also set their options.
+func (tx *Transaction) AddSection(config, section, typ string) error {
+	if tx.done {
+		return ErrTransactionDone
+	}
+	return tx.reader.AddSection(config, section, typ)
+}
+
+// DelSection stages the deletion of a section.
+func (tx *Transaction) DelSection(config, section string) error {
+	if tx.done {
+		return ErrTransactionDone
+	}
+	if err := tx.reader.DelSection(config, section); err != nil {
+		return err
+	}
+	tx.staged = true
+	return nil
+}
+
+// Commit defers the commit a setter makes to Apply. It never writes anything.
+func (tx *Transaction) Commit() error {
+	if tx.done {
+		return ErrTransactionDone
+	}
+	tx.staged = true
+	return nil
+}
+
+// ReloadConfig reloads the config from disk, dropping the changes staged so far.
+func (tx *Transaction) ReloadConfig() error {
+	return tx.reader.ReloadConfig()
+}
+
+// Apply commits the staged changes in one commit and runs the OnApply reload.
+//
+// Returns true if anything was committed. Nothing is committed when nothing was
+// staged. A commit that fails on a read-only filesystem is reported as
+// ErrReadOnlyFS and leaves the changes staged, so Apply can be retried; any other
+// use of the transaction after Apply returns ErrTransactionDone.
+func (tx *Transaction) Apply() (bool, error) {
+	if tx.done {
+		return false, ErrTransactionDone
+	}
+	if !tx.staged {
+		tx.done = true
+		return false, nil
+	}
+
+	if err := tx.reader.Commit(); err != nil {
+		return false, newCommitError(tx.config, err)
+	}
+	tx.done = true
+
+	if tx.reload != nil {
+		if err := tx.reload(); err != nil {
+			return true, err
+		}
+	}
+
+	return true, nil
+}
+
+// Discard drops the staged changes, so that a later commit of the same tree does
+// not write a half-made change. Readers that implement Reverter are reverted;
+// others reload the config from disk.
+func (tx *Transaction) Discard() error {
+	if tx.done {
+		return ErrTransactionDone
+	}
+	tx.done = true
+
+	if r, ok := tx.reader.(Reverter); ok {
+		r.Revert()
+		return nil
+	}
+	if err := tx.reader.ReloadConfig(); err != nil {
+		return fmt.Errorf("failed to discard %s changes: %w", tx.config, err)
+	}
+	return nil
+}
+
+// RunTransaction runs fn in a transaction on config through reader and applies it
+// if fn succeeds, or discards it if fn fails.
+//
+// Returns true if anything was committed.
+//
+// Example:
+//
+//	changed, err := RunTransaction(dhcpConfigName, NewUCIDHCPConfigReader(), func(tx *Transaction) error {
+//	    if _, err := SetDHCPRangeWithReader("ahwlan", "100", "16", tx); err != nil {
+//	        return err
+//	    }
+//	    return SetDHCPLeaseTimeWithReader("ahwlan", "12h", tx)
+//	})
+func RunTransaction(config string, reader ConfigReader, fn func(tx *Transaction) error) (bool, error) {
+	tx := NewTransaction(config, reader)
+	if err := fn(tx); err != nil {
+		if discardErr := tx.Discard(); discardErr != nil {
+			return false, errors.Join(err, discardErr)
+		}
+		return false, err
+	}
+	return tx.Apply()
+}
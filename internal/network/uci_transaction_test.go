@@ -0,0 +1,214 @@
+package network
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/digineo/go-uci/v2"
+)
+
+func TestTransaction_SingleCommit(t *testing.T) {
+	reader := newMockReader()
+	tx := NewTransaction(networkConfigName, reader)
+
+	reloads := 0
+	tx.OnApply(func() error {
+		reloads++
+		return nil
+	})
+
+	if err := SetNetworkProtoWithReader("ahwlan", "dhcp", tx); err != nil {
+		t.Fatalf("SetNetworkProtoWithReader() error = %v", err)
+	}
+	if err := SetNetworkIPAddrWithReader("ahwlan", "10.41.2.1", tx); err != nil {
+		t.Fatalf("SetNetworkIPAddrWithReader() error = %v", err)
+	}
+	if err := SetNetworkDNSWithReader("ahwlan", "9.9.9.9", tx); err != nil {
+		t.Fatalf("SetNetworkDNSWithReader() error = %v", err)
+	}
+
+	if reader.commitCalled {
+		t.Fatal("Expected no commit before Apply")
+	}
+	if !tx.Staged() {
+		t.Error("Expected changes staged")
+	}
+
+	changed, err := tx.Apply()
+	if err != nil || !changed {
+		t.Fatalf("Apply() = %v, %v, want true, nil", changed, err)
+	}
+	if !reader.commitCalled {
+		t.Error("Expected Apply to commit")
+	}
+	if reloads != 1 {
+		t.Errorf("reloads = %d, want 1", reloads)
+	}
+
+	if err := SetNetworkDNSWithReader("ahwlan", "1.1.1.1", tx); !errors.Is(err, ErrTransactionDone) {
+		t.Errorf("setter after Apply: error = %v, want ErrTransactionDone", err)
+	}
+	if _, err := tx.Apply(); !errors.Is(err, ErrTransactionDone) {
+		t.Errorf("second Apply() error = %v, want ErrTransactionDone", err)
+	}
+}
+
+func TestTransaction_NothingStaged(t *testing.T) {
+	reader := newMockReader()
+	tx := NewTransaction(networkConfigName, reader)
+	tx.OnApply(func() error {
+		t.Error("Expected no reload when nothing was staged")
+		return nil
+	})
+
+	changed, err := tx.Apply()
+	if err != nil || changed {
+		t.Errorf("Apply() = %v, %v, want false, nil", changed, err)
+	}
+	if reader.commitCalled {
+		t.Error("Expected no commit when nothing was staged")
+	}
+}
+
+func TestTransaction_CommitError(t *testing.T) {
+	reader := newMockReader()
+	reader.commitError = errors.New("commit failed")
+	tx := NewTransaction(networkConfigName, reader)
+
+	if err := SetNetworkProtoWithReader("lan", "dhcp", tx); err != nil {
+		t.Fatalf("SetNetworkProtoWithReader() error = %v", err)
+	}
+
+	if _, err := tx.Apply(); !errors.Is(err, ErrCommitFailed) {
+		t.Errorf("Apply() error = %v, want ErrCommitFailed", err)
+	}
+
+	// A failed commit keeps the transaction open for a retry.
+	reader.commitError = nil
+	if changed, err := tx.Apply(); err != nil || !changed {
+		t.Errorf("Apply() retry = %v, %v, want true, nil", changed, err)
+	}
+}
+
+func TestRunTransaction(t *testing.T) {
+	t.Run("applies", func(t *testing.T) {
+		mock := newMockDHCPConfigReader()
+		setupMockDHCPData(mock)
+
+		changed, err := RunTransaction(dhcpConfigName, mock, func(tx *Transaction) error {
+			if _, err := SetDHCPRangeWithReader("lan", "120", "16", tx); err != nil {
+				return err
+			}
+			return SetDHCPLeaseTimeWithReader("lan", "1h", tx)
+		})
+		if err != nil || !changed {
+			t.Fatalf("RunTransaction() = %v, %v, want true, nil", changed, err)
+		}
+
+		config, _ := GetDHCPConfigWithReader("lan", mock)
+		if config.Start != "120" || config.Limit != "16" || config.LeaseTime != "1h" {
+			t.Errorf("config = %+v, want the new range and lease time", config)
+		}
+	})
+
+	t.Run("discards_on_error", func(t *testing.T) {
+		reader := newMockReader()
+		failure := errors.New("step failed")
+
+		_, err := RunTransaction(networkConfigName, reader, func(tx *Transaction) error {
+			if err := SetNetworkProtoWithReader("lan", "dhcp", tx); err != nil {
+				return err
+			}
+			return failure
+		})
+		if !errors.Is(err, failure) {
+			t.Errorf("RunTransaction() error = %v, want %v", err, failure)
+		}
+		if reader.commitCalled {
+			t.Error("Expected no commit after a failed step")
+		}
+		if !reader.reloadCalled {
+			t.Error("Expected the staged changes to be discarded")
+		}
+	})
+}
+
+func TestTransaction_Tree(t *testing.T) {
+	dir := writeTestConfig(t, "network", "\nconfig interface 'ahwlan'\n\toption proto 'static'\n")
+	reader := &UCINetworkConfigReader{tree: uci.NewTree(dir)}
+
+	tx := NewTransaction(networkConfigName, reader)
+	if err := SetNetworkIPAddrWithReader("ahwlan", "10.41.3.1", tx); err != nil {
+		t.Fatalf("SetNetworkIPAddrWithReader() error = %v", err)
+	}
+	if err := SetNetworkNetmaskWithReader("ahwlan", "255.255.0.0", tx); err != nil {
+		t.Fatalf("SetNetworkNetmaskWithReader() error = %v", err)
+	}
+
+	fresh := &UCINetworkConfigReader{tree: uci.NewTree(dir)}
+	if config, _ := GetUCINetworkByNameWithReader("ahwlan", fresh); config.IPAddr != "" {
+		t.Fatalf("Expected nothing written before Apply, got %+v", config)
+	}
+
+	if _, err := tx.Apply(); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+
+	fresh = &UCINetworkConfigReader{tree: uci.NewTree(dir)}
+	config, _ := GetUCINetworkByNameWithReader("ahwlan", fresh)
+	if config.IPAddr != "10.41.3.1" || config.NetMask != "255.255.0.0" {
+		t.Errorf("config after Apply = %+v", config)
+	}
+
+	// Discarding drops staged changes from the shared tree.
+	tx = NewTransaction(networkConfigName, reader)
+	if err := SetNetworkIPAddrWithReader("ahwlan", "10.41.4.1", tx); err != nil {
+		t.Fatalf("SetNetworkIPAddrWithReader() error = %v", err)
+	}
+	if err := tx.Discard(); err != nil {
+		t.Fatalf("Discard() error = %v", err)
+	}
+	if values, _ := reader.Get(networkConfigName, "ahwlan", "ipaddr"); len(values) != 1 || values[0] != "10.41.3.1" {
+		t.Errorf("ipaddr after Discard = %v, want 10.41.3.1", values)
+	}
+}
+
+func TestTransaction_DeleteSections(t *testing.T) {
+	config := `
+config dhcp 'lan'
+	option interface 'lan'
+
+config dhcp 'wan'
+	option interface 'wan'
+
+config dhcp 'ahwlan'
+	option interface 'ahwlan'
+`
+	dir := writeTestConfig(t, "dhcp", config)
+	path := filepath.Join(dir, "dhcp")
+	reader := NewUCIDHCPConfigReaderWithTree(uci.NewTree(dir))
+
+	changed, err := RunTransaction(dhcpConfigName, reader, func(tx *Transaction) error {
+		for _, section := range []string{"wan", "lan"} {
+			if err := DeleteDHCPConfigWithReader(section, tx); err != nil {
+				return err
+			}
+			// Nothing is written until both are deleted
+			if data, _ := os.ReadFile(path); string(data) != config {
+				t.Errorf("dhcp config written before Apply:\n%s", data)
+			}
+		}
+		return nil
+	})
+	if err != nil || !changed {
+		t.Fatalf("RunTransaction() = %v, %v, want true, nil", changed, err)
+	}
+
+	fresh := NewUCIDHCPConfigReaderWithTree(uci.NewTree(dir))
+	sections, _ := fresh.GetSections(dhcpConfigName, "dhcp")
+	if len(sections) != 1 || sections[0] != "ahwlan" {
+		t.Errorf("sections after Apply = %v, want [ahwlan]", sections)
+	}
+}
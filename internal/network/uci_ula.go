@@ -0,0 +1,135 @@
+package network
+
+import (
+	"encoding/binary"
+	"net"
+
+	"github.com/digineo/go-uci/v2"
+)
+
+/*
+config globals 'globals'
+	option ula_prefix 'fd01:ed20:ecb4::/48'
+*/
+
+const (
+	// globalsSection is the section of the network config that holds settings
+	// shared by all interfaces.
+	globalsSection string = "globals"
+
+	// ulaSubnetLen is the length of the ULA subnet of a node, the size SLAAC needs.
+	ulaSubnetLen = 64
+)
+
+// ulaRange is fc00::/7, the unique local address range.
+var ulaRange = &net.IPNet{IP: net.ParseIP("fc00::"), Mask: net.CIDRMask(7, 128)}
+
+// parseULAPrefix parses prefix as a ULA network address that leaves room for /64
+// subnets.
+func parseULAPrefix(prefix string) (*net.IPNet, string) {
+	ip, ipNet, err := net.ParseCIDR(prefix)
+	if err != nil || ip.To4() != nil {
+		return nil, "not an IPv6 prefix"
+	}
+	if !ulaRange.Contains(ip) {
+		return nil, "not inside fc00::/7"
+	}
+	if !ip.Equal(ipNet.IP) {
+		return nil, "not a network address"
+	}
+	if ones, _ := ipNet.Mask.Size(); ones > ulaSubnetLen-1 {
+		return nil, "must be shorter than /64"
+	}
+	return ipNet, ""
+}
+
+// GetULAPrefix returns the ULA prefix of the node, the ula_prefix of the network
+// globals section, or "" if none is set.
+//
+// Example:
+//
+//	prefix, err := GetULAPrefix()
+//	// e.g. "fd01:ed20:ecb4::/48"
+func GetULAPrefix() (string, error) {
+	return GetULAPrefixWithReader(NewUCINetworkConfigReader())
+}
+
+// GetULAPrefixWithReader returns the ULA prefix using the provided reader.
+func GetULAPrefixWithReader(reader ConfigReader) (string, error) {
+	return networkOption(reader, globalsSection, "ula_prefix"), nil
+}
+
+// SetULAPrefix sets the ULA prefix of the node in the network globals section,
+// creating the section if needed. OpenWrt generates a random prefix on first boot;
+// mesh nodes need a shared one, such as DefaultULAPrefix, so that their subnets come
+// from the same range.
+//
+// Returns true if the prefix changed and the configuration was committed, or an
+// ErrInvalidOption error if prefix is not a ULA network address shorter than /64.
+//
+// Example:
+//
+//	changed, err := SetULAPrefix(DefaultULAPrefix)
+//	if err == nil && changed {
+//	    err = ReloadNetwork()
+//	}
+func SetULAPrefix(prefix string) (bool, error) {
+	return SetULAPrefixWithReader(prefix, NewUCINetworkConfigReader())
+}
+
+// SetULAPrefixWithReader sets the ULA prefix using the provided reader.
+func SetULAPrefixWithReader(prefix string, reader ConfigReader) (bool, error) {
+	if _, reason := parseULAPrefix(prefix); reason != "" {
+		return false, newInvalidOptionError(networkConfigName, globalsSection, "ula_prefix", prefix, reason)
+	}
+
+	// Add section if it doesn't exist (this will fail silently if it exists)
+	_ = reader.AddSection(networkConfigName, globalsSection, "globals")
+
+	changed, err := setOptionIfChanged(reader, networkConfigName, globalsSection, "ula_prefix", uci.TypeOption, prefix)
+	if err != nil || !changed {
+		return false, err
+	}
+
+	if err := reader.Commit(); err != nil {
+		return false, newCommitError(networkConfigName, err)
+	}
+
+	return true, nil
+}
+
+// NodeULASubnet returns the /64 of the ULA prefix that belongs to the node holding
+// the mesh address ip. The subnet ID is the offset of ip in the mesh subnet, so the
+// /64s are as unique as the reserved IPv4 addresses and need no coordination of
+// their own.
+//
+// Returns an ErrValidation error if prefix is not a ULA prefix, if ip is not in the
+// mesh subnet, or if the mesh subnet holds more addresses than prefix holds /64s.
+//
+// Example:
+//
+//	subnet, err := DefaultMeshAddressing().NodeULASubnet(DefaultULAPrefix, "10.41.1.5")
+//	// fd01:ed20:ecb4:105::/64
+func (m MeshAddressing) NodeULASubnet(prefix, ip string) (*net.IPNet, error) {
+	ula, reason := parseULAPrefix(prefix)
+	if reason != "" {
+		return nil, newValidationError("invalid ULA prefix %q: %s", prefix, reason)
+	}
+
+	addr := net.ParseIP(ip).To4()
+	if addr == nil || !m.Subnet.Contains(addr) {
+		return nil, newValidationError("%q is not an address of the mesh subnet %s", ip, m.Subnet)
+	}
+
+	meshOnes, _ := m.Subnet.Mask.Size()
+	ulaOnes, _ := ula.Mask.Size()
+	if 32-meshOnes > ulaSubnetLen-ulaOnes {
+		return nil, newValidationError("ULA prefix %s has fewer /64s than the mesh subnet %s has addresses", ula, m.Subnet)
+	}
+
+	offset := ipToUint32(addr) - ipToUint32(m.Subnet.IP)
+	subnet := make(net.IP, net.IPv6len)
+	binary.BigEndian.PutUint64(subnet, binary.BigEndian.Uint64(ula.IP.To16())|uint64(offset))
+
+	return &net.IPNet{IP: subnet, Mask: net.CIDRMask(ulaSubnetLen, 128)}, nil
+}
@@ -0,0 +1,115 @@
+package network
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/digineo/go-uci/v2"
+)
+
+func TestSetULAPrefixWithReader(t *testing.T) {
+	dir := writeTestConfig(t, "network", `
+config interface 'loopback'
+	option device 'lo'
+	option proto 'static'
+`)
+	reader := NewUCINetworkConfigReaderWithTree(uci.NewTree(dir))
+
+	if prefix, err := GetULAPrefixWithReader(reader); err != nil || prefix != "" {
+		t.Fatalf("GetULAPrefixWithReader() without globals = %q, %v", prefix, err)
+	}
+
+	changed, err := SetULAPrefixWithReader(DefaultULAPrefix, reader)
+	if err != nil || !changed {
+		t.Fatalf("SetULAPrefixWithReader() = %v, %v, want true, nil", changed, err)
+	}
+	if prefix, _ := GetULAPrefixWithReader(reader); prefix != DefaultULAPrefix {
+		t.Errorf("GetULAPrefixWithReader() = %q, want %q", prefix, DefaultULAPrefix)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "network"))
+	if !strings.Contains(string(data), "config globals 'globals'") {
+		t.Errorf("network config has no globals section:\n%s", data)
+	}
+
+	changed, err = SetULAPrefixWithReader(DefaultULAPrefix, reader)
+	if err != nil || changed {
+		t.Errorf("SetULAPrefixWithReader() again = %v, %v, want false, nil", changed, err)
+	}
+}
+
+func TestSetULAPrefixWithReader_Invalid(t *testing.T) {
+	tests := []string{
+		"",
+		"10.41.0.0/16",
+		"2001:db8::/48",
+		"fd01:ed20:ecb4::1/48",
+		"fd01:ed20:ecb4:1::/64",
+	}
+
+	for _, prefix := range tests {
+		t.Run(prefix, func(t *testing.T) {
+			reader := NewUCINetworkConfigReaderWithTree(uci.NewTree(writeTestConfig(t, "network", "")))
+
+			var invalid *ErrInvalidOption
+			if _, err := SetULAPrefixWithReader(prefix, reader); !errors.As(err, &invalid) {
+				t.Errorf("SetULAPrefixWithReader(%q) error = %v, want ErrInvalidOption", prefix, err)
+			}
+		})
+	}
+}
+
+func TestMeshAddressing_NodeULASubnet(t *testing.T) {
+	addressing := DefaultMeshAddressing()
+
+	tests := []struct {
+		prefix string
+		ip     string
+		want   string
+	}{
+		{DefaultULAPrefix, "10.41.1.5", "fd01:ed20:ecb4:105::/64"},
+		{DefaultULAPrefix, "10.41.0.1", "fd01:ed20:ecb4:1::/64"},
+		{DefaultULAPrefix, "10.41.255.254", "fd01:ed20:ecb4:fffe::/64"},
+		{"fd00:1::/32", "10.41.1.5", "fd00:1:0:105::/64"},
+	}
+
+	for _, tt := range tests {
+		got, err := addressing.NodeULASubnet(tt.prefix, tt.ip)
+		if err != nil {
+			t.Errorf("NodeULASubnet(%q, %q) error = %v", tt.prefix, tt.ip, err)
+			continue
+		}
+		if got.String() != tt.want {
+			t.Errorf("NodeULASubnet(%q, %q) = %s, want %s", tt.prefix, tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestMeshAddressing_NodeULASubnet_Invalid(t *testing.T) {
+	wide, err := NewMeshAddressing("10.0.0.0/8", nil)
+	if err != nil {
+		t.Fatalf("NewMeshAddressing() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		addressing MeshAddressing
+		prefix     string
+		ip         string
+	}{
+		{"not ula", DefaultMeshAddressing(), "2001:db8::/48", "10.41.1.5"},
+		{"outside mesh", DefaultMeshAddressing(), DefaultULAPrefix, "192.168.1.1"},
+		{"not an address", DefaultMeshAddressing(), DefaultULAPrefix, "node"},
+		{"too few subnets", wide, DefaultULAPrefix, "10.41.1.5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.addressing.NodeULASubnet(tt.prefix, tt.ip); !errors.Is(err, ErrValidation) {
+				t.Errorf("NodeULASubnet() error = %v, want ErrValidation", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package network
+
+import (
+	"net"
+	"strconv"
+	"strings"
+)
+
+// networkOptionValidators check the values of the options of an interface section
+// that the setters of this package write. Each returns the reason a value is
+// refused, or "" if it is valid.
+var networkOptionValidators = map[string]func(string) string{
+	"proto":      validateProto,
+	"ipaddr":     validateIPv4AddrOrCIDR,
+	"netmask":    validateNetmask,
+	"gateway":    validateIPAddr,
+	"dns":        validateDNSServers,
+	"device":     validateDeviceName,
+	"ip6assign":  validateIPv6Assign,
+	"ip6ifaceid": validateIPv6IfaceID,
+	"ip6class":   validateIPv6Class,
+}
+
+// validateNetworkOption checks value for option of the interface section, e.g. a
+// record received from alfred, before it is written.
+func validateNetworkOption(section, option, value string) error {
+	validate, ok := networkOptionValidators[option]
+	if !ok {
+		return nil
+	}
+	if reason := validate(value); reason != "" {
+		return newInvalidOptionError(networkConfigName, section, option, value, reason)
+	}
+	return nil
+}
+
+// validateUCINetwork checks every field of config that is set.
+func validateUCINetwork(section string, config *UCINetwork) error {
+	for _, opt := range []struct {
+		name  string
+		value string
+	}{
+		{"proto", config.Proto},
+		{"ipaddr", config.IPAddr},
+		{"netmask", config.NetMask},
+		{"gateway", config.Gateway},
+		{"dns", strings.Join(config.DNS, " ")},
+		{"device", config.Device},
+		{"ip6assign", config.IPV6Assignment},
+		{"ip6ifaceid", config.IPV6IfaceID},
+		{"ip6class", config.IPV6Class},
+	} {
+		if opt.value == "" {
+			continue
+		}
+		if err := validateNetworkOption(section, opt.name, opt.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateProto(value string) string {
+	if value == "" {
+		return "protocol cannot be empty"
+	}
+	for _, r := range value {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_') {
+			return "not a protocol name"
+		}
+	}
+	return ""
+}
+
+// validateIPv4AddrOrCIDR accepts an IPv4 address, or one in CIDR notation as
+// netifd also accepts for ipaddr.
+func validateIPv4AddrOrCIDR(value string) string {
+	if strings.Contains(value, "/") {
+		ip, _, err := net.ParseCIDR(value)
+		if err != nil || ip.To4() == nil {
+			return "not an IPv4 address or CIDR"
+		}
+		return ""
+	}
+	if ip := net.ParseIP(value); ip == nil || ip.To4() == nil {
+		return "not an IPv4 address"
+	}
+	return ""
+}
+
+// validateNetmask accepts a dotted IPv4 netmask whose ones are contiguous.
+func validateNetmask(value string) string {
+	ip := net.ParseIP(value).To4()
+	if ip == nil {
+		return "not a dotted IPv4 netmask"
+	}
+	if ones, bits := net.IPMask(ip).Size(); ones == 0 && bits == 0 {
+		return "netmask bits are not contiguous"
+	}
+	return ""
+}
+
+func validateIPAddr(value string) string {
+	if net.ParseIP(value) == nil {
+		return "not an IP address"
+	}
+	return ""
+}
+
+// validateDNSServers accepts one or more space separated IP addresses.
+func validateDNSServers(value string) string {
+	servers := strings.Fields(value)
+	if len(servers) == 0 {
+		return "no DNS server"
+	}
+	for _, server := range servers {
+		if net.ParseIP(server) == nil {
+			return "not a list of IP addresses"
+		}
+	}
+	return ""
+}
+
+// validateDeviceName accepts a Linux interface name, or an alias such as "@wan".
+func validateDeviceName(value string) string {
+	name := strings.TrimPrefix(value, "@")
+	if name == "" || len(name) > 15 || strings.ContainsAny(name, "/: \t") {
+		return "not a device name"
+	}
+	return ""
+}
+
+func validateIPv6Assign(value string) string {
+	if n, err := strconv.Atoi(value); err != nil || n < 0 || n > 64 {
+		return "not a prefix length between 0 and 64"
+	}
+	return ""
+}
+
+// validateIPv6IfaceID accepts "eui64", "random" or an IPv6 interface ID such as
+// "::1".
+func validateIPv6IfaceID(value string) string {
+	if value == "eui64" || value == "random" {
+		return ""
+	}
+	if ip := net.ParseIP(value); ip == nil || ip.To4() != nil || !strings.Contains(value, ":") {
+		return `not "eui64", "random" or an IPv6 interface ID`
+	}
+	return ""
+}
+
+func validateIPv6Class(value string) string {
+	if strings.ContainsAny(value, " \t") {
+		return "not an interface class"
+	}
+	return ""
+}
+
+// validateLeaseTime accepts a dnsmasq lease time: "infinite", or a number of
+// seconds with an optional s, m, h, d or w unit, e.g. "12h".
+func validateLeaseTime(value string) string {
+	if value == "infinite" {
+		return ""
+	}
+	digits := strings.TrimRight(value, "smhdw")
+	if len(value)-len(digits) > 1 || digits == "" || strings.Trim(digits, "0123456789") != "" {
+		return "not a lease time"
+	}
+	if n, err := strconv.Atoi(digits); err != nil || n == 0 {
+		return "not a lease time"
+	}
+	return ""
+}
@@ -0,0 +1,102 @@
+package network
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateNetworkOption(t *testing.T) {
+	tests := []struct {
+		option string
+		valid  []string
+		bad    []string
+	}{
+		{"proto", []string{"static", "batadv_hardif"}, []string{"", "static ", "Static"}},
+		{"ipaddr", []string{"10.41.1.1", "10.41.1.1/16"}, []string{"10.41.1", "fd00::1", "10.41.1.1/33", "10.41.1.1 "}},
+		{"netmask", []string{"255.255.0.0", "255.255.255.252"}, []string{"255.0.255.0", "16", "ffff::"}},
+		{"gateway", []string{"10.41.0.1", "fe80::1"}, []string{"gateway", "10.41.0.256"}},
+		{"dns", []string{"1.1.1.1", "1.1.1.1 9.9.9.9"}, []string{"", "1.1.1.1,9.9.9.9"}},
+		{"device", []string{"br-ahwlan", "@wan", "bat0.10"}, []string{"", "@", "br ahwlan", "a-very-long-device0"}},
+		{"ip6assign", []string{"0", "64"}, []string{"65", "-1", "/64"}},
+		{"ip6ifaceid", []string{"eui64", "random", "::1"}, []string{"1", "10.0.0.1"}},
+		{"ip6class", []string{"local"}, []string{"local wan6"}},
+	}
+
+	for _, tt := range tests {
+		for _, value := range tt.valid {
+			if err := validateNetworkOption("ahwlan", tt.option, value); err != nil {
+				t.Errorf("%s %q: error = %v, want nil", tt.option, value, err)
+			}
+		}
+		for _, value := range tt.bad {
+			err := validateNetworkOption("ahwlan", tt.option, value)
+			var invalid *ErrInvalidOption
+			if !errors.As(err, &invalid) || !errors.Is(err, ErrValidation) {
+				t.Errorf("%s %q: error = %v, want *ErrInvalidOption wrapping ErrValidation", tt.option, value, err)
+				continue
+			}
+			if invalid.Option != tt.option || invalid.Value != value {
+				t.Errorf("%s %q: ErrInvalidOption = %+v", tt.option, value, invalid)
+			}
+		}
+	}
+}
+
+func TestValidateLeaseTime(t *testing.T) {
+	for _, value := range []string{"12h", "3600", "90s", "1w", "infinite"} {
+		if reason := validateLeaseTime(value); reason != "" {
+			t.Errorf("validateLeaseTime(%q) = %q, want valid", value, reason)
+		}
+	}
+	for _, value := range []string{"", "h", "0h", "12hh", "-5m", "+5m", "12 h", "forever"} {
+		if reason := validateLeaseTime(value); reason == "" {
+			t.Errorf("validateLeaseTime(%q) accepted, want refused", value)
+		}
+	}
+}
+
+func TestNetworkSetters_RefuseInvalidValues(t *testing.T) {
+	setters := []struct {
+		name string
+		set  func(reader ConfigReader) error
+	}{
+		{"ipaddr", func(r ConfigReader) error { return SetNetworkIPAddrWithReader("lan", "10.41.1.300", r) }},
+		{"netmask", func(r ConfigReader) error { return SetNetworkNetmaskWithReader("lan", "255.0.255.0", r) }},
+		{"gateway", func(r ConfigReader) error { return SetNetworkGatewayWithReader("lan", "none", r) }},
+		{"config", func(r ConfigReader) error {
+			_, err := SetNetworkConfigWithReader("lan", &UCINetwork{Proto: "static", IPAddr: "10.41.1.1", NetMask: "255.255.0"}, r)
+			return err
+		}},
+	}
+
+	for _, tt := range setters {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := newMockReader()
+			if err := tt.set(reader); !errors.Is(err, ErrValidation) {
+				t.Fatalf("error = %v, want ErrValidation", err)
+			}
+			if len(reader.setTypeCalls) != 0 || reader.commitCalled {
+				t.Errorf("Expected nothing written, got %+v", reader.setTypeCalls)
+			}
+		})
+	}
+}
+
+func TestDHCPSetters_RefuseInvalidLeaseTime(t *testing.T) {
+	mock := newMockDHCPConfigReader()
+	setupMockDHCPData(mock)
+
+	if err := SetDHCPLeaseTimeWithReader("lan", "12 hours", mock); !errors.Is(err, ErrValidation) {
+		t.Errorf("SetDHCPLeaseTimeWithReader() error = %v, want ErrValidation", err)
+	}
+	if _, err := SetDHCPConfigWithReader("lan", &UCIDHCP{LeaseTime: "soon"}, mock); !errors.Is(err, ErrValidation) {
+		t.Errorf("SetDHCPConfigWithReader() error = %v, want ErrValidation", err)
+	}
+	if _, err := AddDHCPHostWithReader(&UCIDHCPHost{MAC: "02:00:00:00:00:01", IP: "10.41.2.20", LeaseTime: "1x"}, mock); !errors.Is(err, ErrValidation) {
+		t.Errorf("AddDHCPHostWithReader() error = %v, want ErrValidation", err)
+	}
+
+	if config, _ := GetDHCPConfigWithReader("lan", mock); config.LeaseTime != "12h" {
+		t.Errorf("LeaseTime = %q, want the existing 12h kept", config.LeaseTime)
+	}
+}
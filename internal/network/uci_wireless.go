@@ -0,0 +1,339 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strconv"
+
+	"github.com/digineo/go-uci/v2"
+	"github.com/openmanet/openmanetd/internal/safemode"
+)
+
+/*
+config wifi-device 'radio0'
+	option type 'mac80211'
+	option path 'platform/soc/a000000.wifi'
+	option band '2g'
+	option channel '6'
+	option htmode 'HT20'
+	option txpower '20'
+	option country 'US'
+*/
+
+const (
+	wirelessConfigName string = "wireless"
+
+	// maxWirelessChannel is the highest channel number of any band, that of the 6 GHz
+	// band. HaLow channels are numbered lower.
+	maxWirelessChannel = 233
+
+	// maxWirelessTxPower is the highest transmit power, in dBm, that is accepted.
+	// The driver still caps it to what the regulatory domain allows.
+	maxWirelessTxPower = 36
+)
+
+// WirelessChannelAuto lets the driver pick the channel of a radio.
+const WirelessChannelAuto string = "auto"
+
+// UCIWifiDevice represents a wifi-device section of the wireless config, one radio.
+// Name is the section name, e.g. "radio0".
+type UCIWifiDevice struct {
+	Name    string `json:"name"`
+	Type    string `uci:"option type" json:"type,omitempty"`
+	Path    string `uci:"option path" json:"path,omitempty"`
+	Band    string `uci:"option band" json:"band,omitempty"`
+	Channel string `uci:"option channel" json:"channel,omitempty"`
+	HTMode  string `uci:"option htmode" json:"htmode,omitempty"`
+	// TxPower is in dBm; empty leaves it to the driver.
+	TxPower  string `uci:"option txpower" json:"txpower,omitempty"`
+	Country  string `uci:"option country" json:"country,omitempty"`
+	Disabled string `uci:"option disabled" json:"disabled,omitempty"`
+}
+
+// WirelessConfigReader defines an interface for reading wireless UCI configuration
+// values.
+type WirelessConfigReader interface {
+	GetSections(config, secType string) ([]string, error)
+	Get(config, section, option string) ([]string, bool)
+	SetType(config, section, option string, typ uci.OptionType, values ...string) error
+	Del(config, section, option string) error
+	AddSection(config, section, typ string) error
+	DelSection(config, section string) error
+	Commit() error
+	ReloadConfig() error
+}
+
+// UCIWirelessConfigReader wraps the UCI functions for wireless configuration.
+type UCIWirelessConfigReader struct {
+	tree uci.Tree
+	changeLog
+}
+
+// NewUCIWirelessConfigReader creates a new UCI wireless config reader with the
+// default tree.
+func NewUCIWirelessConfigReader() *UCIWirelessConfigReader {
+	return NewUCIWirelessConfigReaderWithTree(uci.NewTree(uci.DefaultTreePath))
+}
+
+// NewUCIWirelessConfigReaderWithTree creates a UCI wireless config reader on tree, so
+// that several readers can share one tree or read a tree outside the default path.
+func NewUCIWirelessConfigReaderWithTree(tree uci.Tree) *UCIWirelessConfigReader {
+	return &UCIWirelessConfigReader{
+		tree: tree,
+	}
+}
+
+func (r *UCIWirelessConfigReader) GetSections(config, secType string) ([]string, error) {
+	return r.tree.GetSections(config, secType)
+}
+
+func (r *UCIWirelessConfigReader) Get(config, section, option string) ([]string, bool) {
+	return r.get(r.tree, config, section, option)
+}
+
+func (r *UCIWirelessConfigReader) SetType(config, section, option string, typ uci.OptionType, values ...string) error {
+	if err := safemode.Check(fmt.Sprintf("uci set %s.%s.%s", config, section, option)); err != nil {
+		return err
+	}
+	return r.setType(r.tree, config, section, option, typ, values...)
+}
+
+func (r *UCIWirelessConfigReader) Del(config, section, option string) error {
+	if err := safemode.Check(fmt.Sprintf("uci delete %s.%s.%s", config, section, option)); err != nil {
+		return err
+	}
+	return r.del(r.tree, config, section, option)
+}
+
+func (r *UCIWirelessConfigReader) AddSection(config, section, typ string) error {
+	if err := safemode.Check(fmt.Sprintf("uci add %s.%s", config, section)); err != nil {
+		return err
+	}
+	return r.addSection(r.tree, config, section, typ)
+}
+
+func (r *UCIWirelessConfigReader) DelSection(config, section string) error {
+	if err := safemode.Check(fmt.Sprintf("uci delete %s.%s", config, section)); err != nil {
+		return err
+	}
+	return r.delSection(r.tree, config, section)
+}
+
+// Commit writes staged changes to disk. Failures caused by a read-only
+// filesystem are reported as ErrReadOnlyFS.
+func (r *UCIWirelessConfigReader) Commit() error {
+	if err := safemode.Check("uci commit"); err != nil {
+		return err
+	}
+	return classifyCommitError(r.commit(r.tree))
+}
+
+func (r *UCIWirelessConfigReader) ReloadConfig() error {
+	if err := r.tree.LoadConfig(wirelessConfigName, true); err != nil {
+		return err
+	}
+	r.reset(wirelessConfigName)
+	return nil
+}
+
+// Revert discards the wireless changes staged since the last commit. The config is
+// read from disk again on next use.
+func (r *UCIWirelessConfigReader) Revert() {
+	r.tree.Revert(wirelessConfigName)
+	r.reset(wirelessConfigName)
+}
+
+// wirelessOption returns the first value of an option of a wireless section, or ""
+// if it is not set.
+func wirelessOption(reader WirelessConfigReader, section, option string) string {
+	values, ok := reader.Get(wirelessConfigName, section, option)
+	if !ok || len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// wifiDeviceSections returns the wifi-device sections in file order.
+func wifiDeviceSections(reader WirelessConfigReader) ([]string, error) {
+	sections, err := reader.GetSections(wirelessConfigName, "wifi-device")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read wifi devices: %w", err)
+	}
+	return sections, nil
+}
+
+// readWifiDevice reads the options of the wifi-device section.
+func readWifiDevice(reader WirelessConfigReader, section string) UCIWifiDevice {
+	return UCIWifiDevice{
+		Name:     section,
+		Type:     wirelessOption(reader, section, "type"),
+		Path:     wirelessOption(reader, section, "path"),
+		Band:     wirelessOption(reader, section, "band"),
+		Channel:  wirelessOption(reader, section, "channel"),
+		HTMode:   wirelessOption(reader, section, "htmode"),
+		TxPower:  wirelessOption(reader, section, "txpower"),
+		Country:  wirelessOption(reader, section, "country"),
+		Disabled: wirelessOption(reader, section, "disabled"),
+	}
+}
+
+// GetWifiDevices loads and returns the radios of the wireless config in file order.
+func GetWifiDevices() ([]UCIWifiDevice, error) {
+	return GetWifiDevicesWithReader(NewUCIWirelessConfigReader())
+}
+
+// GetWifiDevicesWithReader loads and returns the radios using the provided reader.
+func GetWifiDevicesWithReader(reader WirelessConfigReader) ([]UCIWifiDevice, error) {
+	sections, err := wifiDeviceSections(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	devices := make([]UCIWifiDevice, 0, len(sections))
+	for _, section := range sections {
+		devices = append(devices, readWifiDevice(reader, section))
+	}
+
+	return devices, nil
+}
+
+// GetWifiDevice loads and returns the radio of the wifi-device section name.
+//
+// Returns an ErrSectionNotFound error if there is no radio of that name.
+//
+// Example:
+//
+//	radio, err := GetWifiDevice("radio0")
+//	if err == nil {
+//	    fmt.Printf("%s on channel %s at %s dBm\n", radio.Name, radio.Channel, radio.TxPower)
+//	}
+func GetWifiDevice(name string) (*UCIWifiDevice, error) {
+	return GetWifiDeviceWithReader(name, NewUCIWirelessConfigReader())
+}
+
+// GetWifiDeviceWithReader loads and returns a radio using the provided reader.
+func GetWifiDeviceWithReader(name string, reader WirelessConfigReader) (*UCIWifiDevice, error) {
+	sections, err := wifiDeviceSections(reader)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(sections, name) {
+		return nil, fmt.Errorf("%w: wifi device %q", ErrSectionNotFound, name)
+	}
+
+	device := readWifiDevice(reader, name)
+	return &device, nil
+}
+
+// setWifiDeviceOption sets option of the existing radio device and commits if it
+// changed. An empty value deletes the option.
+func setWifiDeviceOption(reader WirelessConfigReader, device, option, value string) (bool, error) {
+	if _, err := GetWifiDeviceWithReader(device, reader); err != nil {
+		return false, err
+	}
+
+	if value == "" {
+		if wirelessOption(reader, device, option) == "" {
+			return false, nil
+		}
+		if err := reader.Del(wirelessConfigName, device, option); err != nil {
+			return false, newSetOptionError(wirelessConfigName, device, option, err)
+		}
+	} else {
+		changed, err := setOptionIfChanged(reader, wirelessConfigName, device, option, uci.TypeOption, value)
+		if err != nil || !changed {
+			return false, err
+		}
+	}
+
+	if err := reader.Commit(); err != nil {
+		return false, newCommitError(wirelessConfigName, err)
+	}
+
+	return true, nil
+}
+
+// SetWirelessChannel sets the channel of the radio device, e.g. "radio0", to a
+// channel number or WirelessChannelAuto.
+//
+// Returns true if the channel changed and the configuration was committed, an
+// ErrSectionNotFound error if there is no such radio, or an ErrInvalidOption error if
+// channel is neither. Call ReloadWifi to retune the radio.
+//
+// Example:
+//
+//	changed, err := SetWirelessChannel("radio0", "11")
+//	if err == nil && changed {
+//	    err = ReloadWifi()
+//	}
+func SetWirelessChannel(device, channel string) (bool, error) {
+	return SetWirelessChannelWithReader(device, channel, NewUCIWirelessConfigReader())
+}
+
+// SetWirelessChannelWithReader sets the channel of a radio using the provided reader.
+func SetWirelessChannelWithReader(device, channel string, reader WirelessConfigReader) (bool, error) {
+	if channel != WirelessChannelAuto {
+		if n, err := strconv.Atoi(channel); err != nil || n < 1 || n > maxWirelessChannel {
+			return false, newInvalidOptionError(wirelessConfigName, device, "channel", channel,
+				fmt.Sprintf("must be %q or a channel from 1 to %d", WirelessChannelAuto, maxWirelessChannel))
+		}
+	}
+
+	return setWifiDeviceOption(reader, device, "channel", channel)
+}
+
+// SetWirelessTxPower sets the transmit power of the radio device, e.g. "radio0", in
+// dBm. Zero removes the setting, leaving the power to the driver. The driver caps the
+// power to what the regulatory domain of the radio allows.
+//
+// Returns true if the power changed and the configuration was committed, an
+// ErrSectionNotFound error if there is no such radio, or an ErrInvalidOption error if
+// dBm is out of range. Call ReloadWifi to apply it.
+//
+// Example:
+//
+//	changed, err := SetWirelessTxPower("radio0", 17)
+func SetWirelessTxPower(device string, dBm int) (bool, error) {
+	return SetWirelessTxPowerWithReader(device, dBm, NewUCIWirelessConfigReader())
+}
+
+// SetWirelessTxPowerWithReader sets the transmit power of a radio using the provided
+// reader.
+func SetWirelessTxPowerWithReader(device string, dBm int, reader WirelessConfigReader) (bool, error) {
+	if dBm < 0 || dBm > maxWirelessTxPower {
+		return false, newInvalidOptionError(wirelessConfigName, device, "txpower", strconv.Itoa(dBm),
+			fmt.Sprintf("must be from 0 to %d dBm", maxWirelessTxPower))
+	}
+
+	value := ""
+	if dBm > 0 {
+		value = strconv.Itoa(dBm)
+	}
+
+	return setWifiDeviceOption(reader, device, "txpower", value)
+}
+
+// ReloadWifi applies wireless changes, as 'wifi reload' does: netifd is asked to
+// reload over ubus, which only reconfigures the radios and interfaces whose
+// configuration changed. Without ubusd, '/sbin/wifi reload' is run instead.
+//
+// Returns an ErrReloadFailed carrying the *ubus.StatusError of a failed call, or the
+// output of a failed command.
+func ReloadWifi() error {
+	if err := safemode.Check("reload wifi"); err != nil {
+		return err
+	}
+
+	if handled, err := callNetifd(context.Background(), "network", "reload"); handled {
+		return err
+	}
+
+	cmd := exec.Command("/sbin/wifi", "reload")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return newReloadError("wifi", output, err)
+	}
+
+	return nil
+}
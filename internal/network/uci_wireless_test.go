@@ -0,0 +1,118 @@
+package network
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/digineo/go-uci/v2"
+)
+
+const testWirelessConfig = `
+config wifi-device 'radio0'
+	option type 'mac80211'
+	option path 'platform/soc/a000000.wifi'
+	option band '2g'
+	option channel '1'
+	option htmode 'HT20'
+	option txpower '20'
+	option country 'US'
+
+config wifi-device 'radio1'
+	option type 'morse'
+	option band 's1g'
+	option channel 'auto'
+
+config wifi-iface 'mesh0'
+	option device 'radio1'
+	option mode 'mesh'
+`
+
+func TestGetWifiDevicesWithReader(t *testing.T) {
+	reader := NewUCIWirelessConfigReaderWithTree(uci.NewTree(writeTestConfig(t, "wireless", testWirelessConfig)))
+
+	got, err := GetWifiDevicesWithReader(reader)
+	if err != nil {
+		t.Fatalf("GetWifiDevicesWithReader() error = %v", err)
+	}
+	want := []UCIWifiDevice{
+		{Name: "radio0", Type: "mac80211", Path: "platform/soc/a000000.wifi", Band: "2g", Channel: "1", HTMode: "HT20", TxPower: "20", Country: "US"},
+		{Name: "radio1", Type: "morse", Band: "s1g", Channel: WirelessChannelAuto},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetWifiDevicesWithReader() = %+v, want %+v", got, want)
+	}
+
+	if _, err := GetWifiDeviceWithReader("mesh0", reader); !errors.Is(err, ErrSectionNotFound) {
+		t.Errorf("GetWifiDeviceWithReader(mesh0) error = %v, want ErrSectionNotFound", err)
+	}
+}
+
+func TestSetWirelessChannelWithReader(t *testing.T) {
+	dir := writeTestConfig(t, "wireless", testWirelessConfig)
+	reader := NewUCIWirelessConfigReaderWithTree(uci.NewTree(dir))
+
+	changed, err := SetWirelessChannelWithReader("radio0", "11", reader)
+	if err != nil || !changed {
+		t.Fatalf("SetWirelessChannelWithReader() = %v, %v, want true, nil", changed, err)
+	}
+	changed, err = SetWirelessChannelWithReader("radio0", "11", reader)
+	if err != nil || changed {
+		t.Errorf("SetWirelessChannelWithReader() again = %v, %v, want false, nil", changed, err)
+	}
+	if device, _ := GetWifiDeviceWithReader("radio0", NewUCIWirelessConfigReaderWithTree(uci.NewTree(dir))); device.Channel != "11" {
+		t.Errorf("channel on disk = %q, want 11", device.Channel)
+	}
+
+	for _, channel := range []string{"", "0", "234", "six", "-1"} {
+		var invalid *ErrInvalidOption
+		if _, err := SetWirelessChannelWithReader("radio0", channel, reader); !errors.As(err, &invalid) {
+			t.Errorf("SetWirelessChannelWithReader(%q) error = %v, want ErrInvalidOption", channel, err)
+		}
+	}
+	if _, err := SetWirelessChannelWithReader("radio9", "6", reader); !errors.Is(err, ErrSectionNotFound) {
+		t.Errorf("SetWirelessChannelWithReader(radio9) error = %v, want ErrSectionNotFound", err)
+	}
+}
+
+func TestSetWirelessTxPowerWithReader(t *testing.T) {
+	reader := NewUCIWirelessConfigReaderWithTree(uci.NewTree(writeTestConfig(t, "wireless", testWirelessConfig)))
+
+	changed, err := SetWirelessTxPowerWithReader("radio1", 17, reader)
+	if err != nil || !changed {
+		t.Fatalf("SetWirelessTxPowerWithReader() = %v, %v, want true, nil", changed, err)
+	}
+	if device, _ := GetWifiDeviceWithReader("radio1", reader); device.TxPower != "17" {
+		t.Errorf("txpower = %q, want 17", device.TxPower)
+	}
+
+	// Zero hands the power back to the driver
+	changed, err = SetWirelessTxPowerWithReader("radio0", 0, reader)
+	if err != nil || !changed {
+		t.Fatalf("SetWirelessTxPowerWithReader(0) = %v, %v, want true, nil", changed, err)
+	}
+	if device, _ := GetWifiDeviceWithReader("radio0", reader); device.TxPower != "" {
+		t.Error("txpower still set after setting 0")
+	}
+	changed, err = SetWirelessTxPowerWithReader("radio0", 0, reader)
+	if err != nil || changed {
+		t.Errorf("SetWirelessTxPowerWithReader(0) again = %v, %v, want false, nil", changed, err)
+	}
+
+	for _, dBm := range []int{-1, 37} {
+		if _, err := SetWirelessTxPowerWithReader("radio0", dBm, reader); !errors.Is(err, ErrValidation) {
+			t.Errorf("SetWirelessTxPowerWithReader(%d) error = %v, want ErrValidation", dBm, err)
+		}
+	}
+}
+
+func TestReloadWifi_Ubus(t *testing.T) {
+	calls := stubUbus(t, nil)
+
+	if err := ReloadWifi(); err != nil {
+		t.Fatalf("ReloadWifi() error = %v", err)
+	}
+	if want := []string{"network reload"}; !reflect.DeepEqual(*calls, want) {
+		t.Errorf("ubus calls = %v, want %v", *calls, want)
+	}
+}
@@ -0,0 +1,400 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/openmanet/openmanetd/internal/safemode"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// wireGuardLinkType is the link type the kernel reports for a WireGuard
+	// interface.
+	wireGuardLinkType = "wireguard"
+
+	// wireGuardKeyLength is the length of WireGuard keys, Curve25519 keys in bytes.
+	wireGuardKeyLength = 32
+
+	// wgTimeout bounds a run of the wg tool.
+	wgTimeout = 10 * time.Second
+)
+
+// WireGuardPeer is the other end of a WireGuard tunnel.
+//
+// Fields:
+//   - PublicKey: The base64 public key of the peer.
+//   - Endpoint: The "host:port" the peer is reached at. Empty for a peer that
+//     connects to us, e.g. a gateway node seen from the central site.
+//   - AllowedIPs: The networks routed to the peer through the tunnel, and accepted
+//     from it, e.g. 0.0.0.0/0 for the central site of a gateway node.
+//   - PersistentKeepalive: How often to send a keepalive so that the NAT mapping of
+//     a node behind NAT stays open. 0 sends none.
+type WireGuardPeer struct {
+	PublicKey           string
+	Endpoint            string
+	AllowedIPs          []*net.IPNet
+	PersistentKeepalive time.Duration
+}
+
+// WireGuardConfig is the configuration of a WireGuard interface.
+//
+// Fields:
+//   - PrivateKey: The base64 private key of the interface.
+//   - ListenPort: The UDP port to listen on. 0 picks a random port, enough for a
+//     node that only connects out.
+//   - Addresses: The addresses of the interface on the tunnel, with their prefixes.
+//   - MTU: The MTU of the interface. 0 keeps the kernel default of 1420.
+//   - Peers: The peers of the interface. Peers not listed are removed.
+type WireGuardConfig struct {
+	PrivateKey string
+	ListenPort int
+	Addresses  []*net.IPNet
+	MTU        int
+	Peers      []WireGuardPeer
+}
+
+// GenerateWireGuardKey returns a new base64 private key and its public key, as 'wg
+// genkey' and 'wg pubkey' do.
+func GenerateWireGuardKey() (privateKey, publicKey string, err error) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate WireGuard key: %w", err)
+	}
+
+	return base64.StdEncoding.EncodeToString(key.Bytes()), base64.StdEncoding.EncodeToString(key.PublicKey().Bytes()), nil
+}
+
+// WireGuardPublicKey returns the base64 public key of the base64 private key
+// privateKey, so that it can be handed to the peers.
+//
+// Returns an ErrValidation error if privateKey is not a WireGuard key.
+func WireGuardPublicKey(privateKey string) (string, error) {
+	raw, err := parseWireGuardKey("private key", privateKey)
+	if err != nil {
+		return "", err
+	}
+
+	key, err := ecdh.X25519().NewPrivateKey(raw)
+	if err != nil {
+		return "", newValidationError("invalid WireGuard private key: %v", err)
+	}
+
+	return base64.StdEncoding.EncodeToString(key.PublicKey().Bytes()), nil
+}
+
+// parseWireGuardKey decodes the base64 WireGuard key of kind.
+func parseWireGuardKey(kind, key string) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(raw) != wireGuardKeyLength {
+		return nil, newValidationError("WireGuard %s must be %d bytes in base64", kind, wireGuardKeyLength)
+	}
+	return raw, nil
+}
+
+// validate checks that the configuration can be applied.
+func (c *WireGuardConfig) validate() error {
+	if _, err := parseWireGuardKey("private key", c.PrivateKey); err != nil {
+		return err
+	}
+	if c.ListenPort < 0 || c.ListenPort > 65535 {
+		return newValidationError("WireGuard listen port must be from 0 to 65535, got %d", c.ListenPort)
+	}
+	if c.MTU != 0 && (c.MTU < minLinkMTU || c.MTU > maxLinkMTU) {
+		return newValidationError("MTU must be from %d to %d, got %d", minLinkMTU, maxLinkMTU, c.MTU)
+	}
+	for _, addr := range c.Addresses {
+		if err := validateAddress(addr); err != nil {
+			return err
+		}
+	}
+
+	for i, peer := range c.Peers {
+		if _, err := parseWireGuardKey(fmt.Sprintf("public key of peer %d", i+1), peer.PublicKey); err != nil {
+			return err
+		}
+		for _, other := range c.Peers[:i] {
+			if other.PublicKey == peer.PublicKey {
+				return newValidationError("WireGuard peer %s is listed twice", peer.PublicKey)
+			}
+		}
+		if peer.Endpoint != "" {
+			if _, _, err := net.SplitHostPort(peer.Endpoint); err != nil {
+				return newValidationError("endpoint %q of WireGuard peer %d must be host:port", peer.Endpoint, i+1)
+			}
+		}
+		for _, allowed := range peer.AllowedIPs {
+			if allowed == nil || allowed.IP == nil || allowed.Mask == nil {
+				return newValidationError("allowed IPs of WireGuard peer %d must be networks", i+1)
+			}
+		}
+		if peer.PersistentKeepalive < 0 || peer.PersistentKeepalive > 65535*time.Second {
+			return newValidationError("keepalive of WireGuard peer %d must be from 0 to 65535s, got %s", i+1, peer.PersistentKeepalive)
+		}
+	}
+
+	return nil
+}
+
+// String returns the configuration in the format of 'wg setconf', which carries
+// the keys, port and peers but not the addresses or MTU.
+func (c *WireGuardConfig) String() string {
+	var b strings.Builder
+	b.WriteString("[Interface]\n")
+	fmt.Fprintf(&b, "PrivateKey = %s\n", c.PrivateKey)
+	if c.ListenPort != 0 {
+		fmt.Fprintf(&b, "ListenPort = %d\n", c.ListenPort)
+	}
+
+	for _, peer := range c.Peers {
+		b.WriteString("\n[Peer]\n")
+		fmt.Fprintf(&b, "PublicKey = %s\n", peer.PublicKey)
+		if peer.Endpoint != "" {
+			fmt.Fprintf(&b, "Endpoint = %s\n", peer.Endpoint)
+		}
+		if len(peer.AllowedIPs) > 0 {
+			allowed := make([]string, 0, len(peer.AllowedIPs))
+			for _, allowedNet := range peer.AllowedIPs {
+				allowed = append(allowed, allowedNet.String())
+			}
+			fmt.Fprintf(&b, "AllowedIPs = %s\n", strings.Join(allowed, ", "))
+		}
+		if peer.PersistentKeepalive > 0 {
+			fmt.Fprintf(&b, "PersistentKeepalive = %d\n", int(peer.PersistentKeepalive.Seconds()))
+		}
+	}
+
+	return b.String()
+}
+
+// Routes returns a route through the WireGuard interface iface to every allowed
+// network of every peer, tagged with RouteProtocolOpenMANET, for ApplyRoutes or
+// AddRoute. WireGuard picks the peer of a packet by its allowed IPs, so the routes
+// need no gateway.
+func (c *WireGuardConfig) Routes(iface string, metric, table int) []*Route {
+	var routes []*Route
+	for _, peer := range c.Peers {
+		for _, allowed := range peer.AllowedIPs {
+			routes = append(routes, &Route{
+				Destination: allowed,
+				Interface:   iface,
+				Metric:      metric,
+				Table:       table,
+				Scope:       netlink.SCOPE_LINK,
+				Protocol:    RouteProtocolOpenMANET,
+			})
+		}
+	}
+	return routes
+}
+
+// runWG runs the wg tool with args and input on its standard input. It is
+// overridable for tests.
+var runWG = func(ctx context.Context, input []byte, args ...string) error {
+	cmd := exec.CommandContext(ctx, "wg", args...)
+	cmd.Stdin = bytes.NewReader(input)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return fmt.Errorf("wg %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// lookupWireGuard looks up the interface name and checks that it is a WireGuard
+// interface.
+func lookupWireGuard(name string) (netlink.Link, error) {
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		return nil, newInterfaceNotFoundError(name, err)
+	}
+	if link.Type() != wireGuardLinkType {
+		return nil, newValidationError("interface %s is a %s, not a WireGuard interface", name, link.Type())
+	}
+
+	return link, nil
+}
+
+// configureWireGuard applies the keys, port and peers of config to the WireGuard
+// interface name. The private key is passed on standard input so that it does not
+// show up in the process list.
+func configureWireGuard(name string, config *WireGuardConfig) error {
+	ctx, cancel := context.WithTimeout(context.Background(), wgTimeout)
+	defer cancel()
+
+	if err := runWG(ctx, []byte(config.String()), "syncconf", name, "/dev/stdin"); err != nil {
+		return fmt.Errorf("failed to configure %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// CreateWireGuard creates the WireGuard interface name, configures it and sets it
+// up, e.g. to back-haul the traffic of a gateway node to a central site. Creating
+// an interface that exists already updates its configuration, as
+// ConfigureWireGuard does. The keys and peers are applied with the wg tool.
+//
+// Routes through the tunnel are not added; pass config.Routes to ApplyRoutes or
+// AddRoute for those.
+//
+// Returns an ErrValidation error if name or config is invalid or name is an
+// interface that is not a WireGuard interface, and an error if the interface cannot
+// be created or configured. An interface created by the call is deleted again if
+// it cannot be configured.
+//
+// Example:
+//
+//	priv, pub, _ := GenerateWireGuardKey()
+//	log.Printf("public key of wg0: %s", pub)
+//	_, central, _ := net.ParseCIDR("0.0.0.0/0")
+//	config := &WireGuardConfig{
+//	    PrivateKey: priv,
+//	    Addresses:  []*net.IPNet{{IP: net.ParseIP("172.16.0.2"), Mask: net.CIDRMask(24, 32)}},
+//	    Peers: []WireGuardPeer{{
+//	        PublicKey:           centralKey,
+//	        Endpoint:            "hq.example.org:51820",
+//	        AllowedIPs:          []*net.IPNet{central},
+//	        PersistentKeepalive: 25 * time.Second,
+//	    }},
+//	}
+//	if err := CreateWireGuard("wg0", config); err == nil {
+//	    err = ApplyRoutes(config.Routes("wg0", 100, table), ApplyOptions{Tables: []int{table}})
+//	}
+//
+// Note: This operation requires appropriate privileges (typically root/CAP_NET_ADMIN)
+// and the wireguard-tools package for the wg tool. netifd is not told about the
+// interface.
+func CreateWireGuard(name string, config *WireGuardConfig) error {
+	if err := validateLinkName(name); err != nil {
+		return err
+	}
+	if config == nil {
+		return newValidationError("WireGuard configuration cannot be nil")
+	}
+	if err := config.validate(); err != nil {
+		return err
+	}
+
+	if err := safemode.Check(fmt.Sprintf("create WireGuard interface %s", name)); err != nil {
+		return err
+	}
+
+	link, err := lookupWireGuard(name)
+	created := false
+	if errors.Is(err, ErrInterfaceNotFound) {
+		link = &netlink.Wireguard{LinkAttrs: netlink.LinkAttrs{Name: name, MTU: config.MTU}}
+		if err := netlink.LinkAdd(link); err != nil && !errors.Is(err, unix.EEXIST) {
+			return fmt.Errorf("failed to create WireGuard interface %s: %w", name, err)
+		}
+		created = true
+	} else if err != nil {
+		return err
+	}
+
+	if err := setUpWireGuard(link, name, config); err != nil {
+		if created {
+			if delErr := netlink.LinkDel(link); delErr != nil {
+				err = errors.Join(err, fmt.Errorf("failed to delete %s: %w", name, delErr))
+			}
+		}
+		return err
+	}
+
+	return nil
+}
+
+// setUpWireGuard configures the WireGuard interface link and sets it up.
+func setUpWireGuard(link netlink.Link, name string, config *WireGuardConfig) error {
+	if err := configureWireGuard(name, config); err != nil {
+		return err
+	}
+
+	if config.MTU != 0 && link.Attrs().MTU != config.MTU {
+		if err := netlink.LinkSetMTU(link, config.MTU); err != nil {
+			return fmt.Errorf("failed to set MTU of %s to %d: %w", name, config.MTU, err)
+		}
+	}
+
+	for _, addr := range config.Addresses {
+		if err := netlink.AddrAdd(link, &netlink.Addr{IPNet: addr}); err != nil && !errors.Is(err, unix.EEXIST) {
+			return fmt.Errorf("failed to add %s to %s: %w", addr, name, err)
+		}
+	}
+
+	if err := netlink.LinkSetUp(link); err != nil {
+		return fmt.Errorf("failed to set %s up: %w", name, err)
+	}
+
+	return nil
+}
+
+// ConfigureWireGuard replaces the keys, listen port and peers of the WireGuard
+// interface name with those of config. Peers that are not in config are removed;
+// the sessions of peers that did not change are kept. Addresses and the MTU are
+// left alone; use AddAddress and SetMTU for those.
+//
+// Returns an ErrValidation error if config is invalid or name is not a WireGuard
+// interface, and an ErrInterfaceNotFound error if there is no such interface.
+//
+// Note: This operation requires appropriate privileges (typically root/CAP_NET_ADMIN)
+// and the wireguard-tools package for the wg tool.
+func ConfigureWireGuard(name string, config *WireGuardConfig) error {
+	if name == "" {
+		return newValidationError("interface name cannot be empty")
+	}
+	if config == nil {
+		return newValidationError("WireGuard configuration cannot be nil")
+	}
+	if err := config.validate(); err != nil {
+		return err
+	}
+
+	if err := safemode.Check(fmt.Sprintf("configure WireGuard interface %s", name)); err != nil {
+		return err
+	}
+
+	if _, err := lookupWireGuard(name); err != nil {
+		return err
+	}
+
+	return configureWireGuard(name, config)
+}
+
+// DeleteWireGuard deletes the WireGuard interface name. The kernel removes the
+// routes through it.
+//
+// Returns an ErrValidation error if name is not a WireGuard interface and an
+// ErrInterfaceNotFound error if there is no such interface.
+//
+// Note: This operation requires appropriate privileges (typically root/CAP_NET_ADMIN).
+func DeleteWireGuard(name string) error {
+	if name == "" {
+		return newValidationError("interface name cannot be empty")
+	}
+
+	if err := safemode.Check(fmt.Sprintf("delete WireGuard interface %s", name)); err != nil {
+		return err
+	}
+
+	link, err := lookupWireGuard(name)
+	if err != nil {
+		return err
+	}
+
+	if err := netlink.LinkDel(link); err != nil {
+		return fmt.Errorf("failed to delete WireGuard interface %s: %w", name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,189 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/vishvananda/netlink"
+)
+
+func TestWireGuardKeys(t *testing.T) {
+	priv, pub, err := GenerateWireGuardKey()
+	if err != nil {
+		t.Fatalf("GenerateWireGuardKey() error = %v", err)
+	}
+	if got, err := WireGuardPublicKey(priv); err != nil || got != pub {
+		t.Errorf("WireGuardPublicKey() = %q, %v, want %q", got, err, pub)
+	}
+
+	// Test vector of RFC 7748, section 6.1
+	const alicePriv = "dwdtCnMYpX08FsFyUbJmRd9ML4frwJkqsXf7pR25LCo="
+	const alicePub = "hSDwCYkwp1R0i33ctD73Wg2/Og0mOBr066SpjqqbTmo="
+	if got, err := WireGuardPublicKey(alicePriv); err != nil || got != alicePub {
+		t.Errorf("WireGuardPublicKey() = %q, %v, want %q", got, err, alicePub)
+	}
+
+	for _, key := range []string{"", "not base64!", "AAAA"} {
+		if _, err := WireGuardPublicKey(key); !errors.Is(err, ErrValidation) {
+			t.Errorf("WireGuardPublicKey(%q) error = %v, want ErrValidation", key, err)
+		}
+	}
+}
+
+func testWireGuardConfig(t *testing.T) *WireGuardConfig {
+	t.Helper()
+
+	priv, _, err := GenerateWireGuardKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, peerPub, err := GenerateWireGuardKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, all, _ := net.ParseCIDR("0.0.0.0/0")
+	_, site, _ := net.ParseCIDR("172.16.0.0/24")
+
+	return &WireGuardConfig{
+		PrivateKey: priv,
+		ListenPort: 51820,
+		Addresses:  []*net.IPNet{{IP: net.ParseIP("172.16.0.2"), Mask: net.CIDRMask(24, 32)}},
+		Peers: []WireGuardPeer{{
+			PublicKey:           peerPub,
+			Endpoint:            "hq.example.org:51820",
+			AllowedIPs:          []*net.IPNet{site, all},
+			PersistentKeepalive: 25 * time.Second,
+		}},
+	}
+}
+
+func TestWireGuardConfig_String(t *testing.T) {
+	config := testWireGuardConfig(t)
+
+	want := "[Interface]\n" +
+		"PrivateKey = " + config.PrivateKey + "\n" +
+		"ListenPort = 51820\n" +
+		"\n[Peer]\n" +
+		"PublicKey = " + config.Peers[0].PublicKey + "\n" +
+		"Endpoint = hq.example.org:51820\n" +
+		"AllowedIPs = 172.16.0.0/24, 0.0.0.0/0\n" +
+		"PersistentKeepalive = 25\n"
+	if got := config.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestWireGuardConfig_Routes(t *testing.T) {
+	config := testWireGuardConfig(t)
+
+	routes := config.Routes("wg0", 100, 200)
+	if len(routes) != 2 {
+		t.Fatalf("Routes() = %v, want one route per allowed network", routes)
+	}
+	for i, route := range routes {
+		if route.Destination != config.Peers[0].AllowedIPs[i] || route.Interface != "wg0" || route.Gateway != nil ||
+			route.Metric != 100 || route.Table != 200 || route.Scope != netlink.SCOPE_LINK || route.Protocol != RouteProtocolOpenMANET {
+			t.Errorf("route %d = %+v", i, route)
+		}
+	}
+}
+
+func TestWireGuard_Invalid(t *testing.T) {
+	valid := testWireGuardConfig(t)
+	invalid := func(change func(c *WireGuardConfig)) *WireGuardConfig {
+		c := *valid
+		c.Peers = []WireGuardPeer{valid.Peers[0]}
+		change(&c)
+		return &c
+	}
+
+	tests := []struct {
+		name string
+		op   func() error
+	}{
+		{"no name", func() error { return CreateWireGuard("", valid) }},
+		{"long name", func() error { return CreateWireGuard("wg-abcdefghijklm", valid) }},
+		{"nil config", func() error { return CreateWireGuard("wg0", nil) }},
+		{"no private key", func() error { return CreateWireGuard("wg0", invalid(func(c *WireGuardConfig) { c.PrivateKey = "" })) }},
+		{"port", func() error {
+			return CreateWireGuard("wg0", invalid(func(c *WireGuardConfig) { c.ListenPort = 65536 }))
+		}},
+		{"MTU", func() error { return CreateWireGuard("wg0", invalid(func(c *WireGuardConfig) { c.MTU = 10 })) }},
+		{"address", func() error {
+			return CreateWireGuard("wg0", invalid(func(c *WireGuardConfig) { c.Addresses = []*net.IPNet{{IP: net.ParseIP("172.16.0.2")}} }))
+		}},
+		{"peer key", func() error {
+			return ConfigureWireGuard("wg0", invalid(func(c *WireGuardConfig) { c.Peers[0].PublicKey = "AAAA" }))
+		}},
+		{"duplicate peer", func() error {
+			return ConfigureWireGuard("wg0", invalid(func(c *WireGuardConfig) { c.Peers = append(c.Peers, c.Peers[0]) }))
+		}},
+		{"endpoint", func() error {
+			return ConfigureWireGuard("wg0", invalid(func(c *WireGuardConfig) { c.Peers[0].Endpoint = "hq.example.org" }))
+		}},
+		{"allowed IPs", func() error {
+			return ConfigureWireGuard("wg0", invalid(func(c *WireGuardConfig) { c.Peers[0].AllowedIPs = []*net.IPNet{nil} }))
+		}},
+		{"keepalive", func() error {
+			return ConfigureWireGuard("wg0", invalid(func(c *WireGuardConfig) { c.Peers[0].PersistentKeepalive = -time.Second }))
+		}},
+		{"configure without name", func() error { return ConfigureWireGuard("", valid) }},
+		{"configure loopback", func() error { return ConfigureWireGuard("lo", valid) }},
+		{"delete without name", func() error { return DeleteWireGuard("") }},
+		{"delete loopback", func() error { return DeleteWireGuard("lo") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.op(); !errors.Is(err, ErrValidation) {
+				t.Errorf("error = %v, want ErrValidation", err)
+			}
+		})
+	}
+}
+
+func TestWireGuard_InterfaceNotFound(t *testing.T) {
+	const missing = "omtest-missing"
+	config := testWireGuardConfig(t)
+
+	if err := ConfigureWireGuard(missing, config); !errors.Is(err, ErrInterfaceNotFound) {
+		t.Errorf("ConfigureWireGuard() error = %v, want ErrInterfaceNotFound", err)
+	}
+	if err := DeleteWireGuard(missing); !errors.Is(err, ErrInterfaceNotFound) {
+		t.Errorf("DeleteWireGuard() error = %v, want ErrInterfaceNotFound", err)
+	}
+}
+
+func TestConfigureWireGuard_RunsWG(t *testing.T) {
+	old := runWG
+	t.Cleanup(func() { runWG = old })
+
+	config := testWireGuardConfig(t)
+	var gotInput []byte
+	var gotArgs []string
+	runWG = func(_ context.Context, input []byte, args ...string) error {
+		gotInput, gotArgs = input, args
+		return nil
+	}
+
+	if err := configureWireGuard("wg0", config); err != nil {
+		t.Fatalf("configureWireGuard() error = %v", err)
+	}
+	if want := []string{"syncconf", "wg0", "/dev/stdin"}; !slices.Equal(gotArgs, want) {
+		t.Errorf("wg args = %v, want %v", gotArgs, want)
+	}
+	if string(gotInput) != config.String() {
+		t.Errorf("wg input = %q, want the configuration", gotInput)
+	}
+
+	runWG = func(context.Context, []byte, ...string) error {
+		return errors.New("Unable to modify interface: Protocol not supported")
+	}
+	if err := configureWireGuard("wg0", config); err == nil {
+		t.Error("configureWireGuard() succeeded although wg failed")
+	}
+}
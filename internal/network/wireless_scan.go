@@ -0,0 +1,173 @@
+package network
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+)
+
+// wirelessScanTimeout bounds a scan through iwinfo. A full scan of every channel of
+// a dual-band radio takes a few seconds; a HaLow radio can take much longer.
+const wirelessScanTimeout = 60 * time.Second
+
+// Modes of a scanned network, as iwinfo reports them.
+const (
+	WirelessModeAP    string = "Master"
+	WirelessModeMesh  string = "Mesh Point"
+	WirelessModeAdHoc string = "Ad-Hoc"
+)
+
+// WirelessScanResult is a network heard by a wireless scan: an access point, or a
+// mesh or ad-hoc network, whose SSID is then the mesh ID.
+type WirelessScanResult struct {
+	SSID    string `json:"ssid"`
+	BSSID   string `json:"bssid"`
+	Mode    string `json:"mode"`
+	Channel int    `json:"channel"`
+	// Signal is the received signal strength in dBm.
+	Signal     int `json:"signal"`
+	Quality    int `json:"quality"`
+	QualityMax int `json:"qualityMax"`
+	// Encrypted is false for an open network. Authentication lists the key
+	// management suites of an encrypted one, e.g. "psk" or "sae".
+	Encrypted      bool     `json:"encrypted"`
+	Authentication []string `json:"authentication,omitempty"`
+}
+
+// iwinfoScanReply is the reply of the scan method of the rpcd iwinfo object.
+type iwinfoScanReply struct {
+	Results []struct {
+		SSID       string `json:"ssid"`
+		BSSID      string `json:"bssid"`
+		Mode       string `json:"mode"`
+		Channel    int    `json:"channel"`
+		Signal     int    `json:"signal"`
+		Quality    int    `json:"quality"`
+		QualityMax int    `json:"quality_max"`
+		Encryption struct {
+			Enabled        bool     `json:"enabled"`
+			Authentication []string `json:"authentication"`
+		} `json:"encryption"`
+	} `json:"results"`
+}
+
+// decodeUbusReply decodes the reply of a ubus call into out, a struct with JSON tags.
+func decodeUbusReply(reply map[string]any, out any) error {
+	data, err := json.Marshal(reply)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// ScanWireless scans for the networks that the radio of device, e.g. "wlan0", can
+// hear, through the iwinfo object of rpcd on ubus. The scan interrupts the traffic
+// of the radio while it runs.
+//
+// Returns the networks by descending signal strength, or an ErrScanFailed if the scan
+// could not be run.
+//
+// Example:
+//
+//	results, err := ScanWireless("wlan0")
+//	for _, r := range results {
+//	    fmt.Printf("%s %s ch %d %d dBm\n", r.BSSID, r.SSID, r.Channel, r.Signal)
+//	}
+func ScanWireless(device string) ([]WirelessScanResult, error) {
+	return ScanWirelessContext(context.Background(), device)
+}
+
+// ScanWirelessContext is ScanWireless that gives up when ctx is done.
+func ScanWirelessContext(ctx context.Context, device string) ([]WirelessScanResult, error) {
+	if device == "" {
+		return nil, newValidationError("wireless device cannot be empty")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, wirelessScanTimeout)
+	defer cancel()
+
+	reply, err := ubusCall(ctx, "iwinfo", "scan", map[string]any{"device": device})
+	if err != nil {
+		return nil, &ErrScanFailed{Device: device, Err: err}
+	}
+
+	var decoded iwinfoScanReply
+	if err := decodeUbusReply(reply, &decoded); err != nil {
+		return nil, &ErrScanFailed{Device: device, Err: fmt.Errorf("invalid scan reply: %w", err)}
+	}
+
+	results := make([]WirelessScanResult, 0, len(decoded.Results))
+	for _, r := range decoded.Results {
+		results = append(results, WirelessScanResult{
+			SSID:           r.SSID,
+			BSSID:          r.BSSID,
+			Mode:           r.Mode,
+			Channel:        r.Channel,
+			Signal:         r.Signal,
+			Quality:        r.Quality,
+			QualityMax:     r.QualityMax,
+			Encrypted:      r.Encryption.Enabled,
+			Authentication: r.Encryption.Authentication,
+		})
+	}
+
+	slices.SortStableFunc(results, func(a, b WirelessScanResult) int {
+		return b.Signal - a.Signal
+	})
+
+	return results, nil
+}
+
+// WirelessDevices returns the wireless devices iwinfo knows, e.g. "wlan0" and
+// "phy0-mesh0".
+func WirelessDevices() ([]string, error) {
+	return WirelessDevicesContext(context.Background())
+}
+
+// WirelessDevicesContext is WirelessDevices that gives up when ctx is done.
+func WirelessDevicesContext(ctx context.Context) ([]string, error) {
+	reply, err := ubusCall(ctx, "iwinfo", "devices", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list wireless devices: %w", err)
+	}
+
+	var decoded struct {
+		Devices []string `json:"devices"`
+	}
+	if err := decodeUbusReply(reply, &decoded); err != nil {
+		return nil, fmt.Errorf("invalid wireless devices reply: %w", err)
+	}
+
+	return decoded.Devices, nil
+}
+
+// QuietestChannel returns the channel of candidates that the scanned networks use
+// least, weighing each network by its received power so that a distant network
+// counts for less than a close one. Ties go to the earlier candidate.
+//
+// Returns 0 if there are no candidates.
+//
+// Example:
+//
+//	results, _ := ScanWireless("wlan0")
+//	channel := QuietestChannel(results, []int{1, 6, 11})
+func QuietestChannel(results []WirelessScanResult, candidates []int) int {
+	best, bestLoad := 0, math.Inf(1)
+	for _, channel := range candidates {
+		load := 0.0
+		for _, r := range results {
+			if r.Channel == channel {
+				// dBm to mW
+				load += math.Pow(10, float64(r.Signal)/10)
+			}
+		}
+		if load < bestLoad {
+			best, bestLoad = channel, load
+		}
+	}
+
+	return best
+}
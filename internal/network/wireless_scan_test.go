@@ -0,0 +1,88 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/openmanet/openmanetd/internal/ubus"
+)
+
+func TestScanWireless(t *testing.T) {
+	var args any
+	orig := ubusCall
+	ubusCall = func(ctx context.Context, object, method string, a any) (map[string]any, error) {
+		args = a
+		// As decoded from blobmsg: integers are int64, arrays []any
+		return map[string]any{"results": []any{
+			map[string]any{
+				"ssid": "guest", "bssid": "AA:BB:CC:DD:EE:01", "mode": "Master",
+				"channel": int64(6), "signal": int64(-71), "quality": int64(39), "quality_max": int64(70),
+				"encryption": map[string]any{"enabled": false},
+			},
+			map[string]any{
+				"ssid": "openmanet", "bssid": "AA:BB:CC:DD:EE:02", "mode": "Mesh Point",
+				"channel": int64(11), "signal": int64(-48), "quality": int64(62), "quality_max": int64(70),
+				"encryption": map[string]any{"enabled": true, "authentication": []any{"sae"}},
+			},
+		}}, nil
+	}
+	t.Cleanup(func() { ubusCall = orig })
+
+	got, err := ScanWireless("wlan0")
+	if err != nil {
+		t.Fatalf("ScanWireless() error = %v", err)
+	}
+	if want := map[string]any{"device": "wlan0"}; !reflect.DeepEqual(args, want) {
+		t.Errorf("iwinfo scan args = %v, want %v", args, want)
+	}
+
+	want := []WirelessScanResult{
+		{SSID: "openmanet", BSSID: "AA:BB:CC:DD:EE:02", Mode: WirelessModeMesh, Channel: 11, Signal: -48, Quality: 62, QualityMax: 70, Encrypted: true, Authentication: []string{"sae"}},
+		{SSID: "guest", BSSID: "AA:BB:CC:DD:EE:01", Mode: WirelessModeAP, Channel: 6, Signal: -71, Quality: 39, QualityMax: 70},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ScanWireless() = %+v, want %+v", got, want)
+	}
+}
+
+func TestScanWireless_Failed(t *testing.T) {
+	stubUbus(t, &ubus.StatusError{Object: "iwinfo", Method: "scan", Status: ubus.StatusNotFound})
+
+	var scanErr *ErrScanFailed
+	var statusErr *ubus.StatusError
+	if _, err := ScanWireless("wlan9"); !errors.As(err, &scanErr) || scanErr.Device != "wlan9" || !errors.As(err, &statusErr) {
+		t.Errorf("ScanWireless() error = %v, want an ErrScanFailed carrying the ubus status", err)
+	}
+
+	if _, err := ScanWireless(""); !errors.Is(err, ErrValidation) {
+		t.Errorf("ScanWireless(\"\") error = %v, want ErrValidation", err)
+	}
+}
+
+func TestQuietestChannel(t *testing.T) {
+	results := []WirelessScanResult{
+		{Channel: 1, Signal: -85},
+		{Channel: 1, Signal: -88},
+		{Channel: 6, Signal: -45},
+		{Channel: 11, Signal: -60},
+	}
+
+	tests := []struct {
+		candidates []int
+		want       int
+	}{
+		// Two distant networks are quieter than one close one
+		{[]int{1, 6, 11}, 1},
+		{[]int{6, 11}, 11},
+		{[]int{3, 1}, 3},
+		{nil, 0},
+	}
+
+	for _, tt := range tests {
+		if got := QuietestChannel(results, tt.candidates); got != tt.want {
+			t.Errorf("QuietestChannel(%v) = %d, want %d", tt.candidates, got, tt.want)
+		}
+	}
+}
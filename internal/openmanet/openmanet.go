@@ -5,13 +5,19 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/common-nighthawk/go-figure"
+	proto "github.com/openmanet/openmanetd/internal/api/openmanet/v1"
 	batmanadv "github.com/openmanet/openmanetd/internal/batman-adv"
 	"github.com/openmanet/openmanetd/internal/config"
 	"github.com/openmanet/openmanetd/internal/mgmt"
+	"github.com/openmanet/openmanetd/internal/network"
 	"github.com/openmanet/openmanetd/internal/ptt"
+	"github.com/openmanet/openmanetd/internal/safemode"
+	"github.com/openmanet/openmanetd/internal/ubus"
 	"github.com/openmanet/openmanetd/internal/util/logger"
+	"github.com/rs/zerolog"
 )
 
 func Start() {
@@ -25,6 +31,18 @@ func Start() {
 
 	banner.Print()
 
+	if err := reportConfigProblems(cfg, log); err != nil {
+		log.Fatal().Err(err).Msg("Invalid config file")
+	}
+
+	// Safe mode must be in effect before any worker can change the system
+	if err := safemode.Configure(logger.GetLogger("safemode"), safemode.DefaultRunDir); err != nil {
+		log.Error().Err(err).Msg("Failed to record safe mode state")
+	}
+	safemode.Set(cfg.GetSafeMode(), "config")
+	go handleSafeModeSignal()
+	network.SetUbusSocketPath(cfg.GetUbusSocketPath())
+
 	ptt := ptt.NewPTT(ptt.PTTConfig{
 		Interupt:      c,
 		Log:           logger.GetLogger("ptt"),
@@ -32,16 +50,25 @@ func Start() {
 		Iface:         cfg.GetMeshNetInterface(),
 		McastAddr:     cfg.GetPTTMcastAddr(),
 		McastPort:     cfg.GetPTTMcastPort(),
+		McastTTL:      cfg.GetPTTMcastTTL(),
 		PttKey:        cfg.GetPTTPttKey(),
 		Debug:         cfg.GetPTTDebug(),
 		Loopback:      cfg.GetPTTLoopback(),
 		PttDevice:     cfg.GetPTTPttDevice(),
 		PttDeviceName: cfg.GetPTTPttDeviceName(),
+		BatInterface:  cfg.GetAlfredBatInterface(),
+
+		TxLogPath:          cfg.GetPTTTxLogPath(),
+		TxLogMaxSize:       cfg.GetPTTTxLogMaxSize(),
+		TxLogMaxBackups:    cfg.GetPTTTxLogMaxBackups(),
+		RecordEnable:       cfg.GetPTTRecordEnable(),
+		RecordDir:          cfg.GetPTTRecordDir(),
+		RecordMaxTotalSize: cfg.GetPTTRecordMaxTotalSize(),
 	})
 
 	ptt.Start()
 
-	mgmt := mgmt.NewManager(mgmt.ManagementConfig{
+	manager := mgmt.NewManager(mgmt.ManagementConfig{
 		InteruptChan:               c,
 		Log:                        logger.GetLogger("mgmt"),
 		GatewayMode:                cfg.GetGatewayMode(),
@@ -53,9 +80,83 @@ func Start() {
 		NodeDataType:               cfg.GetAlfredDataTypeNode(),
 		PositionDataType:           cfg.GetAlfredDataTypePosition(),
 		AddressReservationDataType: cfg.GetAlfredDataTypeAddressReservation(),
+		CapacityWarnPct:            cfg.GetCapacityWarnPct(),
+		CapacityCriticalPct:        cfg.GetCapacityCriticalPct(),
+		AlfredCallTimeout:          cfg.GetAlfredCallTimeout(),
+		PinnedIP:                   cfg.GetReservationPinnedIP(),
+		FallbackOnPinConflict:      cfg.GetFallbackOnPinConflict(),
+		IPAllocationStrategy:       cfg.GetIPAllocationStrategy(),
+		GatewayProbeEnable:         cfg.GetGatewayProbeEnable(),
+		GatewayProbeProtocol:       cfg.GetGatewayProbeProtocol(),
+		GatewayProbePort:           cfg.GetGatewayProbePort(),
+		GatewayProbeTarget:         cfg.GetGatewayProbeTarget(),
+		GatewayProbeTimeout:        cfg.GetGatewayProbeTimeout(),
+		StaticRoutes:               staticRoutes(cfg, log),
+		AddressCheckEvery:          cfg.GetAddressCheckEvery(),
+		AddressMissThreshold:       cfg.GetAddressMissThreshold(),
+		AddressReprovision:         cfg.GetAddressReprovision(),
+		PoolAutosizeEnable:         cfg.GetPoolAutosizeEnable(),
+		PoolGrowAt:                 cfg.GetPoolAutosizeGrowAt(),
+		PoolQuietPeriod:            cfg.GetPoolAutosizeQuietPeriod(),
+		PoolFloor:                  cfg.GetPoolAutosizeFloor(),
+		PoolCeiling:                cfg.GetPoolAutosizeCeiling(),
+		StatePath:                  cfg.GetStateFile(),
+		DHCPLeasesPath:             cfg.GetDHCPLeasesFile(),
+		MeshID:                     cfg.GetMeshID(),
+		MeshIDStrict:               cfg.GetMeshIDStrict(),
+		MeshIDAcceptLegacy:         cfg.GetMeshIDAcceptLegacy(),
+		MaxRecordsPerTick:          cfg.GetMaxRecordsPerTick(),
+		AutoZone:                   cfg.GetAutoZone(),
+		DnsmasqInstance:            cfg.GetDnsmasqInstance(),
+		OpenServices:               cfg.GetOpenServices(),
+		GatewayMasquerade:          cfg.GetGatewayMasquerade(),
+		UplinkZone:                 cfg.GetUplinkZone(),
+		MeshConfigCacheTTL:         cfg.GetMeshConfigCacheTTL(),
+		ServiceDataType:            cfg.GetAlfredDataTypeService(),
+		LocalServices:              services(cfg, log),
+		PublishServiceDNS:          cfg.GetServicesPublishDNS(),
+		MeshHealthThresholds: batmanadv.MeshHealthThresholds{
+			LiveWithin:        cfg.GetMeshHealthLiveWithin(),
+			SparseNeighbors:   cfg.GetMeshHealthSparseNeighbors(),
+			SparseOriginators: cfg.GetMeshHealthSparseOriginators(),
+		},
+		MeshHealthPolicy: mgmt.MeshHealthPolicy{
+			SkipClaimWaitWhenIsolated:  cfg.GetMeshHealthSkipClaimWait(),
+			ShortGatewayHoldWhenSparse: cfg.GetMeshHealthShortGatewayHold(),
+		},
+		BootstrapGracePeriod:      cfg.GetBootstrapGracePeriod(),
+		IPAllocationMode:          cfg.GetIPAllocationMode(),
+		DelegationFallbackTimeout: cfg.GetDelegationFallbackTimeout(),
+		TopologyPublish:           cfg.GetTopologyPublish(),
+		MeshAddressing:            meshAddressing(cfg, log),
 	})
 
-	mgmt.Start()
+	manager.Start()
+	manager.UpdateSourceRouting(sourceRoutingUplinks(cfg, log), cfg.GetSourceRoutingPriority())
+	reconcileVLANs(cfg, log)
+	reconcileGuestIsolation(cfg, log)
+
+	startMeshLog(ctx, cfg, log)
+	ubusDone := startUbus(ctx, cfg, manager)
+
+	safeModeCfg := cfg.GetSafeMode()
+	cfg.OnConfigChange(func(c *config.Config) {
+		// Only follow edits to safeMode so a reload does not undo a runtime switch
+		if on := c.GetSafeMode(); on != safeModeCfg {
+			safeModeCfg = on
+			safemode.Set(on, "config change")
+		}
+
+		// The new settings are in effect already, strict or not
+		if err := reportConfigProblems(c, log); err != nil {
+			log.Error().Err(err).Msg("Invalid config file")
+		}
+		manager.UpdateStaticRoutes(staticRoutes(c, log))
+		manager.UpdateSourceRouting(sourceRoutingUplinks(c, log), c.GetSourceRoutingPriority())
+		manager.ReloadTunables(c)
+		reconcileVLANs(c, log)
+		reconcileGuestIsolation(c, log)
+	})
 
 	// Clear the batman-adv hosts file on startup
 	// to remove any stale entries
@@ -70,4 +171,211 @@ func Start() {
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	<-c
 	log.Info().Msg("Exiting OpenMANETd")
+
+	// Tell peers we are going before the workers stop
+	shutdownCtx, cancel := context.WithTimeout(ctx, mgmt.DefaultShutdownTimeout)
+	manager.Shutdown(shutdownCtx)
+	cancel()
+
+	ubusDone()
+}
+
+// startUbus publishes the read-only "openmanet" object on ubus if enabled.
+//
+// Returns a function that removes the object and waits briefly for that to finish.
+func startUbus(ctx context.Context, cfg *config.Config, m *mgmt.ManagementConfig) func() {
+	if !cfg.GetUbusEnable() {
+		return func() {}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	srv := ubus.NewServer(cfg.GetUbusSocketPath(), "openmanet", map[string]ubus.Handler{
+		"status":       func(context.Context) (any, error) { return m.Status(), nil },
+		"gateways":     func(context.Context) (any, error) { return m.Gateways(), nil },
+		"reservations": func(context.Context) (any, error) { return m.Reservations(), nil },
+		"nodes":        func(context.Context) (any, error) { return m.Nodes(), nil },
+		"services":     func(context.Context) (any, error) { return m.Services(), nil },
+		"clients":      func(context.Context) (any, error) { return m.Clients() },
+		"wirelessScan": func(ctx context.Context) (any, error) { return m.WirelessScan(ctx) },
+		"meshHealth":   func(context.Context) (any, error) { return m.MeshHealth() },
+		"meshLog":      func(context.Context) (any, error) { return batmanadv.GetRecentMeshLog(), nil },
+		"topology":     func(context.Context) (any, error) { return m.Topology() },
+	}, logger.GetLogger("ubus"))
+
+	done := make(chan struct{})
+	go func() {
+		srv.Run(ctx)
+		close(done)
+	}()
+
+	return func() {
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+// startMeshLog tails the batman-adv debug log into the ring read by the meshLog ubus
+// method if enabled. Log lines are passed on at trace level.
+func startMeshLog(ctx context.Context, cfg *config.Config, log zerolog.Logger) {
+	if !cfg.GetMeshLogEnable() {
+		return
+	}
+
+	batmanadv.SetMeshLogRetention(cfg.GetMeshLogRetention())
+	lines, err := batmanadv.StreamMeshLog(ctx, cfg.GetAlfredBatInterface())
+	if err != nil {
+		log.Warn().Err(err).Msg("Not tailing the batman-adv debug log")
+		return
+	}
+
+	go func() {
+		for line := range lines {
+			log.Trace().Str("subsystem", line.Subsystem).Msg(line.Message)
+		}
+	}()
+}
+
+// reportConfigProblems logs the values of the config file that were replaced by their
+// default and, unless config.strictKeys is set, its unknown keys.
+//
+// Returns the error of Validate if the config file has unknown keys in strict mode.
+func reportConfigProblems(cfg *config.Config, log zerolog.Logger) error {
+	warnings, err := cfg.Validate()
+	for _, warning := range warnings {
+		log.Warn().Msgf("Config: %s", warning)
+	}
+
+	return err
+}
+
+// staticRoutes converts the configured static routes into kernel routes. Invalid
+// entries are logged and skipped so that one typo does not drop every route.
+func staticRoutes(cfg *config.Config, log zerolog.Logger) []*network.Route {
+	var routes []*network.Route
+	for _, r := range cfg.GetStaticRoutes() {
+		route, err := network.NewStaticRoute(r.Destination, r.Gateway, r.Interface, r.Metric, r.Table)
+		if err != nil {
+			log.Error().Err(err).Msg("Ignoring invalid static route")
+			continue
+		}
+		routes = append(routes, route)
+	}
+
+	return routes
+}
+
+// sourceRoutingUplinks converts the configured uplinks of a gateway, or none if this
+// node is not a gateway. An uplink without a table gets the table registered as
+// openmanet-<name> in rt_tables. Invalid entries are logged and skipped so that one
+// typo does not take down the source routing of the other uplinks.
+func sourceRoutingUplinks(cfg *config.Config, log zerolog.Logger) []*network.Uplink {
+	if !cfg.GetGatewayMode() {
+		return nil
+	}
+
+	var uplinks []*network.Uplink
+	for _, u := range cfg.GetSourceRoutingUplinks() {
+		if u.Name == "" {
+			log.Error().Msgf("Ignoring uplink on %q without a name", u.Interface)
+			continue
+		}
+
+		table := u.Table
+		if table == 0 {
+			var err error
+			table, err = network.AllocateRouteTable(network.DefaultRouteTablesPath, network.OpenMANETRouteTableName+"-"+u.Name)
+			if err != nil {
+				log.Error().Err(err).Msgf("Ignoring uplink %s without a routing table", u.Name)
+				continue
+			}
+		}
+
+		uplink, err := network.NewUplink(u.Name, u.Interface, u.Gateway, table, u.Sources)
+		if err != nil {
+			log.Error().Err(err).Msg("Ignoring invalid uplink")
+			continue
+		}
+		uplinks = append(uplinks, uplink)
+	}
+
+	return uplinks
+}
+
+// meshAddressing returns the configured mesh subnet and excluded ranges. An invalid
+// combination is logged and the default subnet is used, as every node of the mesh
+// must agree on it.
+func meshAddressing(cfg *config.Config, log zerolog.Logger) network.MeshAddressing {
+	addressing, err := network.NewMeshAddressing(cfg.GetMeshSubnet(), cfg.GetMeshExcludedRanges())
+	if err != nil {
+		log.Error().Err(err).Msg("Ignoring invalid mesh subnet, using the default")
+		return network.DefaultMeshAddressing()
+	}
+
+	return addressing
+}
+
+// services converts the configured services into announcements. Invalid entries are
+// logged and skipped so that one typo does not withdraw every service.
+func services(cfg *config.Config, log zerolog.Logger) []*proto.ServiceAnnouncement {
+	var announcements []*proto.ServiceAnnouncement
+	for _, s := range cfg.GetServices() {
+		svc, err := mgmt.NewServiceAnnouncement(s.Name, s.Proto, s.Port, s.Address, s.Description, s.TTL)
+		if err != nil {
+			log.Error().Err(err).Msg("Ignoring invalid service")
+			continue
+		}
+		announcements = append(announcements, svc)
+	}
+
+	return announcements
+}
+
+// reconcileVLANs applies the configured per-VLAN settings to the batman-adv mesh
+// interface. Failures are logged; VLANs missing at startup are retried on the next
+// config change.
+func reconcileVLANs(cfg *config.Config, log zerolog.Logger) {
+	vlans := cfg.GetMeshVLANs()
+	if len(vlans) == 0 {
+		return
+	}
+
+	desired := make([]batmanadv.MeshVLANConfig, 0, len(vlans))
+	for _, v := range vlans {
+		desired = append(desired, batmanadv.MeshVLANConfig{VID: v.VID, APIsolation: v.APIsolation})
+	}
+
+	if err := batmanadv.ReconcileVLANs(cfg.GetAlfredBatInterface(), desired); err != nil {
+		log.Error().Err(err).Msg("Error reconciling mesh VLANs")
+	}
+}
+
+// reconcileGuestIsolation marks guest traffic for batman-adv AP isolation, or removes
+// the marking rule when guest isolation is disabled. Failures are logged and retried
+// on the next config change.
+func reconcileGuestIsolation(cfg *config.Config, log zerolog.Logger) {
+	mark, mask := cfg.GetGuestIsolationMark()
+	gi := mgmt.GuestIsolationConfig{
+		Enable:  cfg.GetGuestIsolationEnable(),
+		Section: cfg.GetGuestIsolationSection(),
+		Mark:    mark,
+		Mask:    mask,
+	}
+
+	if err := mgmt.ReconcileGuestIsolation(gi, cfg.GetAlfredBatInterface(), log); err != nil {
+		log.Error().Err(err).Msg("Error reconciling guest isolation")
+	}
+}
+
+// handleSafeModeSignal switches safe mode on SIGUSR2, as requested by the safemode
+// command or toggling it if there is no request.
+func handleSafeModeSignal() {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGUSR2)
+
+	for range sig {
+		safemode.HandleSignal(safemode.DefaultRunDir)
+	}
 }
@@ -0,0 +1,200 @@
+package ptt
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// ifaceAddrPollInterval is how often the PTT interface is checked for a new IPv4
+// address. There is no address event source in the daemon, so polling is used.
+const ifaceAddrPollInterval time.Duration = 5 * time.Second
+
+// addrChange is a new IPv4 address on the PTT interface.
+type addrChange struct {
+	IP    string
+	Iface *net.Interface
+}
+
+// sendConn is the part of the UDP send socket used by PTT.
+type sendConn interface {
+	Write(b []byte) (int, error)
+	Close() error
+}
+
+// pttSockets holds the PTT send socket and the address it is bound to, so that both
+// can be rebuilt when the interface address changes. The receive socket listens on
+// all addresses and only needs its multicast membership renewed.
+type pttSockets struct {
+	log   zerolog.Logger
+	group *net.UDPAddr
+
+	// dial opens a send socket from src to the multicast group.
+	dial func(src, dst *net.UDPAddr) (sendConn, error)
+	// join (re)joins the multicast group on ifi for the receive socket.
+	join func(ifi *net.Interface, group net.IP) error
+	// idle reports whether no transmission is in progress.
+	idle func() bool
+
+	mu      sync.Mutex
+	localIP string
+	send    sendConn
+	pending *addrChange
+}
+
+// newPTTSockets creates pttSockets for the multicast group at group.
+func newPTTSockets(log zerolog.Logger, group *net.UDPAddr, dial func(src, dst *net.UDPAddr) (sendConn, error), join func(*net.Interface, net.IP) error, idle func() bool) *pttSockets {
+	return &pttSockets{
+		log:   log,
+		group: group,
+		dial:  dial,
+		join:  join,
+		idle:  idle,
+	}
+}
+
+// Write sends b on the current send socket.
+func (s *pttSockets) Write(b []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.send == nil {
+		return 0, errors.New("ptt send socket not bound")
+	}
+
+	return s.send.Write(b)
+}
+
+// LocalIP returns the address the send socket is bound to.
+func (s *pttSockets) LocalIP() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.localIP
+}
+
+// handle applies change immediately if PTT is idle, or queues it until the current
+// transmission ends. Only the most recent queued change is kept.
+func (s *pttSockets) handle(change addrChange) {
+	if !s.idle() {
+		s.mu.Lock()
+		s.pending = &change
+		s.mu.Unlock()
+
+		s.log.Info().Msgf("Interface address changed to %s during transmission; rebinding when idle", change.IP)
+
+		// The transmission may have ended before the change was queued
+		if s.idle() {
+			s.flushPending()
+		}
+		return
+	}
+
+	if err := s.rebind(change); err != nil {
+		s.log.Error().Err(err).Msgf("Failed to rebind PTT to %s", change.IP)
+	}
+}
+
+// flushPending applies a change queued by handle. It is called when a transmission
+// ends.
+func (s *pttSockets) flushPending() {
+	s.mu.Lock()
+	change := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+
+	if change == nil {
+		return
+	}
+
+	if err := s.rebind(*change); err != nil {
+		s.log.Error().Err(err).Msgf("Failed to rebind PTT to %s", change.IP)
+	}
+}
+
+// rebind moves PTT to the address in change. The new send socket is opened and the
+// multicast group re-joined before the old socket is closed, so a failed rebind
+// leaves PTT on the previous address.
+func (s *pttSockets) rebind(change addrChange) error {
+	s.mu.Lock()
+	oldIP := s.localIP
+	unchanged := s.send != nil && oldIP == change.IP
+	s.mu.Unlock()
+
+	if unchanged {
+		return nil
+	}
+
+	src := &net.UDPAddr{IP: net.ParseIP(change.IP), Port: 0}
+	conn, err := s.dial(src, s.group)
+	if err != nil {
+		return err
+	}
+
+	if err := s.join(change.Iface, s.group.IP); err != nil {
+		conn.Close()
+		return err
+	}
+
+	s.mu.Lock()
+	old := s.send
+	s.send = conn
+	s.localIP = change.IP
+	s.mu.Unlock()
+
+	if old != nil {
+		if err := old.Close(); err != nil {
+			s.log.Warn().Err(err).Msg("Failed to close previous PTT send socket")
+		}
+		s.log.Info().Msgf("PTT rebound from %s to %s -> %s", oldIP, change.IP, s.group)
+	}
+
+	return nil
+}
+
+// watch applies address changes from events until it is closed.
+func (s *pttSockets) watch(events <-chan addrChange) {
+	for change := range events {
+		s.handle(change)
+	}
+}
+
+// pollIfaceAddr checks the IPv4 address of the named interface every interval and
+// emits a change whenever it differs from the last address seen, starting from
+// initial. Lookup errors, such as the interface having no address yet, are skipped.
+// The returned channel is closed when done is closed.
+func pollIfaceAddr(name, initial string, interval time.Duration, lookup func(string) (string, *net.Interface, error), done <-chan struct{}) <-chan addrChange {
+	events := make(chan addrChange)
+
+	go func() {
+		defer close(events)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		last := initial
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				ip, ifi, err := lookup(name)
+				if err != nil || ip == last {
+					continue
+				}
+				last = ip
+
+				select {
+				case events <- addrChange{IP: ip, Iface: ifi}:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+
+	return events
+}
@@ -0,0 +1,297 @@
+package ptt
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// socketRecorder records the socket lifecycle calls made by pttSockets so tests can
+// assert on their order.
+type socketRecorder struct {
+	mu      sync.Mutex
+	calls   []string
+	dialErr error
+	joinErr error
+	busy    bool
+}
+
+func (r *socketRecorder) record(call string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, call)
+}
+
+func (r *socketRecorder) Calls() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.calls...)
+}
+
+func (r *socketRecorder) setBusy(busy bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.busy = busy
+}
+
+type fakeSendConn struct {
+	ip  string
+	rec *socketRecorder
+}
+
+func (c *fakeSendConn) Write(b []byte) (int, error) {
+	c.rec.record("write " + c.ip)
+	return len(b), nil
+}
+
+func (c *fakeSendConn) Close() error {
+	c.rec.record("close " + c.ip)
+	return nil
+}
+
+func newTestSockets(rec *socketRecorder) *pttSockets {
+	group := &net.UDPAddr{IP: net.ParseIP("224.0.0.1"), Port: 5007}
+
+	return newPTTSockets(zerolog.Nop(), group,
+		func(src, dst *net.UDPAddr) (sendConn, error) {
+			if rec.dialErr != nil {
+				return nil, rec.dialErr
+			}
+			rec.record("dial " + src.IP.String())
+			return &fakeSendConn{ip: src.IP.String(), rec: rec}, nil
+		},
+		func(ifi *net.Interface, group net.IP) error {
+			if rec.joinErr != nil {
+				return rec.joinErr
+			}
+			rec.record("join " + ifi.Name)
+			return nil
+		},
+		func() bool {
+			rec.mu.Lock()
+			defer rec.mu.Unlock()
+			return !rec.busy
+		},
+	)
+}
+
+var testIface = &net.Interface{Index: 1, Name: "br-ahwlan"}
+
+func TestPTTSockets_RebindOrder(t *testing.T) {
+	rec := &socketRecorder{}
+	s := newTestSockets(rec)
+
+	if err := s.rebind(addrChange{IP: "10.41.0.5", Iface: testIface}); err != nil {
+		t.Fatalf("rebind() error = %v", err)
+	}
+	if err := s.rebind(addrChange{IP: "10.41.1.5", Iface: testIface}); err != nil {
+		t.Fatalf("rebind() error = %v", err)
+	}
+	if _, err := s.Write([]byte("audio")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	want := []string{
+		"dial 10.41.0.5",
+		"join br-ahwlan",
+		// the new socket is ready before the old one is closed
+		"dial 10.41.1.5",
+		"join br-ahwlan",
+		"close 10.41.0.5",
+		"write 10.41.1.5",
+	}
+	if got := rec.Calls(); !reflect.DeepEqual(got, want) {
+		t.Errorf("calls = %v, want %v", got, want)
+	}
+
+	if got := s.LocalIP(); got != "10.41.1.5" {
+		t.Errorf("LocalIP() = %s, want 10.41.1.5", got)
+	}
+}
+
+func TestPTTSockets_RebindSameAddress(t *testing.T) {
+	rec := &socketRecorder{}
+	s := newTestSockets(rec)
+
+	for i := 0; i < 2; i++ {
+		if err := s.rebind(addrChange{IP: "10.41.0.5", Iface: testIface}); err != nil {
+			t.Fatalf("rebind() error = %v", err)
+		}
+	}
+
+	want := []string{"dial 10.41.0.5", "join br-ahwlan"}
+	if got := rec.Calls(); !reflect.DeepEqual(got, want) {
+		t.Errorf("calls = %v, want %v", got, want)
+	}
+}
+
+func TestPTTSockets_RebindFailureKeepsSocket(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialErr error
+		joinErr error
+		want    []string
+	}{
+		{
+			name:    "dial fails",
+			dialErr: errors.New("cannot assign requested address"),
+			want:    []string{"write 10.41.0.5"},
+		},
+		{
+			name:    "join fails",
+			joinErr: errors.New("no such device"),
+			want:    []string{"dial 10.41.1.5", "close 10.41.1.5", "write 10.41.0.5"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &socketRecorder{}
+			s := newTestSockets(rec)
+
+			if err := s.rebind(addrChange{IP: "10.41.0.5", Iface: testIface}); err != nil {
+				t.Fatalf("rebind() error = %v", err)
+			}
+			rec.calls = nil
+			rec.dialErr = tt.dialErr
+			rec.joinErr = tt.joinErr
+
+			if err := s.rebind(addrChange{IP: "10.41.1.5", Iface: testIface}); err == nil {
+				t.Fatal("rebind() error = nil, want error")
+			}
+			if _, err := s.Write([]byte("audio")); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+
+			if got := rec.Calls(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("calls = %v, want %v", got, tt.want)
+			}
+			if got := s.LocalIP(); got != "10.41.0.5" {
+				t.Errorf("LocalIP() = %s, want 10.41.0.5", got)
+			}
+		})
+	}
+}
+
+func TestPTTSockets_WriteUnbound(t *testing.T) {
+	s := newTestSockets(&socketRecorder{})
+
+	if _, err := s.Write([]byte("audio")); err == nil {
+		t.Error("Write() error = nil, want error before the socket is bound")
+	}
+}
+
+func TestPTTSockets_DeferredUntilIdle(t *testing.T) {
+	rec := &socketRecorder{}
+	s := newTestSockets(rec)
+
+	if err := s.rebind(addrChange{IP: "10.41.0.5", Iface: testIface}); err != nil {
+		t.Fatalf("rebind() error = %v", err)
+	}
+	rec.calls = nil
+
+	// Changes during a transmission are queued and only the latest is applied
+	rec.setBusy(true)
+	s.handle(addrChange{IP: "10.41.1.5", Iface: testIface})
+	s.handle(addrChange{IP: "10.41.2.5", Iface: testIface})
+
+	if _, err := s.Write([]byte("audio")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if got := rec.Calls(); !reflect.DeepEqual(got, []string{"write 10.41.0.5"}) {
+		t.Fatalf("calls during transmission = %v, want only writes on the old socket", got)
+	}
+
+	rec.setBusy(false)
+	s.flushPending()
+
+	want := []string{
+		"write 10.41.0.5",
+		"dial 10.41.2.5",
+		"join br-ahwlan",
+		"close 10.41.0.5",
+	}
+	if got := rec.Calls(); !reflect.DeepEqual(got, want) {
+		t.Errorf("calls = %v, want %v", got, want)
+	}
+
+	// Nothing left to apply
+	s.flushPending()
+	if got := rec.Calls(); len(got) != len(want) {
+		t.Errorf("calls after second flush = %v, want %v", got, want)
+	}
+}
+
+func TestPTTSockets_Watch(t *testing.T) {
+	rec := &socketRecorder{}
+	s := newTestSockets(rec)
+
+	events := make(chan addrChange)
+	done := make(chan struct{})
+	go func() {
+		s.watch(events)
+		close(done)
+	}()
+
+	events <- addrChange{IP: "10.41.0.5", Iface: testIface}
+	events <- addrChange{IP: "10.41.1.5", Iface: testIface}
+	close(events)
+	<-done
+
+	want := []string{
+		"dial 10.41.0.5",
+		"join br-ahwlan",
+		"dial 10.41.1.5",
+		"join br-ahwlan",
+		"close 10.41.0.5",
+	}
+	if got := rec.Calls(); !reflect.DeepEqual(got, want) {
+		t.Errorf("calls = %v, want %v", got, want)
+	}
+}
+
+func TestPollIfaceAddr(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		lookups = []string{"10.41.0.5", "", "10.41.0.5", "10.41.1.5"}
+	)
+	lookup := func(name string) (string, *net.Interface, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if len(lookups) == 0 {
+			return "10.41.1.5", testIface, nil
+		}
+		ip := lookups[0]
+		lookups = lookups[1:]
+		if ip == "" {
+			return "", testIface, errors.New("no IPv4 on iface br-ahwlan")
+		}
+		return ip, testIface, nil
+	}
+
+	done := make(chan struct{})
+	events := pollIfaceAddr("br-ahwlan", "", time.Millisecond, lookup, done)
+
+	// The first lookup differs from the initial address; the error and the repeat
+	// are skipped
+	for _, want := range []string{"10.41.0.5", "10.41.1.5"} {
+		select {
+		case change := <-events:
+			if change.IP != want {
+				t.Errorf("change.IP = %s, want %s", change.IP, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for change to %s", want)
+		}
+	}
+
+	close(done)
+	for range events {
+	}
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/gordonklaus/portaudio"
 	evdev "github.com/gvalkov/golang-evdev"
+	"github.com/openmanet/openmanetd/internal/network"
 )
 
 func (ptt *PTTConfig) receiveLoop(udpConn *net.UDPConn) {
@@ -19,13 +20,18 @@ func (ptt *PTTConfig) receiveLoop(udpConn *net.UDPConn) {
 		}
 
 		ptt.Log.Debug().Msgf("Received %d bytes from %s", n, src.IP.String())
-		if !loopbackAudio && (src.IP.IsLoopback() || src.IP.String() == localIP) {
+		if !loopbackAudio && (src.IP.IsLoopback() || src.IP.String() == ptt.sockets.LocalIP()) {
 			continue
 		}
 
 		frame := make([]byte, n)
 		copy(frame, buf[:n])
 
+		// Looped back audio of our own transmissions is already tracked as sent
+		if src.IP.String() != ptt.sockets.LocalIP() {
+			ptt.observeFrame(src.IP.String(), false, frame)
+		}
+
 		pcm := make([]int16, frameSize)
 		n, err = decoder.Decode(frame, pcm)
 		if err != nil {
@@ -146,4 +152,115 @@ func (ptt *PTTConfig) endTransmission(bcastStream *portaudio.Stream) {
 	recordMutex.Lock()
 	broadcasting = false
 	recordMutex.Unlock()
+
+	// apply an address change that arrived mid-transmission
+	ptt.sockets.flushPending()
+}
+
+// startTransmissionLog sets up the transmission log and, when enabled, the recorder,
+// and follows transmissions until done is closed. Failing to set up either only
+// disables it; audio is never held up by logging or recording.
+func (ptt *PTTConfig) startTransmissionLog(done <-chan struct{}) {
+	if ptt.TxLogPath != "" {
+		l, err := newTxLog(ptt.TxLogPath, ptt.TxLogMaxSize, ptt.TxLogMaxBackups)
+		if err != nil {
+			ptt.Log.Error().Err(err).Msg("Failed to open transmission log, transmissions will not be logged")
+		} else {
+			ptt.txLog = l
+		}
+	}
+
+	if ptt.RecordEnable {
+		r := newRecorder(ptt.Log, ptt.RecordDir, ptt.RecordMaxTotalSize)
+		if err := r.Start(); err != nil {
+			ptt.Log.Error().Err(err).Msg("Failed to start recorder, transmissions will not be recorded")
+		} else {
+			ptt.recorder = r
+			ptt.Log.Info().Str("dir", ptt.RecordDir).Msg("Recording transmissions")
+		}
+	}
+
+	ptt.transmissions = newTxTracker(txGap)
+	go ptt.watchTransmissions(done)
+}
+
+// observeFrame attributes an encoded frame to the current transmission of talker and
+// hands it to the recorder. It is called from the audio path and must not block.
+func (ptt *PTTConfig) observeFrame(talker string, local bool, frame []byte) {
+	if ptt.transmissions == nil {
+		return
+	}
+
+	tx, started := ptt.transmissions.Frame(talker, local, time.Now())
+
+	if ptt.recorder != nil {
+		if started {
+			ptt.recorder.Begin(tx.ID, tx.Talker, tx.Start)
+		}
+		ptt.recorder.Frame(tx.ID, frame)
+	}
+}
+
+// watchTransmissions completes transmissions once their talker falls silent.
+func (ptt *PTTConfig) watchTransmissions(done <-chan struct{}) {
+	ticker := time.NewTicker(txGap / 5)
+	defer ticker.Stop()
+
+	var lastDropped uint64
+	for {
+		select {
+		case <-done:
+			if ptt.recorder != nil {
+				ptt.recorder.Close()
+			}
+			if ptt.txLog != nil {
+				_ = ptt.txLog.Close()
+			}
+			return
+		case now := <-ticker.C:
+			for _, tx := range ptt.transmissions.Expire(now) {
+				ptt.completeTransmission(tx)
+			}
+
+			if ptt.recorder != nil {
+				if dropped := ptt.recorder.Dropped(); dropped != lastDropped {
+					ptt.Log.Warn().Uint64("dropped", dropped-lastDropped).Uint64("total", dropped).Msg("Recorder could not keep up, frames were dropped")
+					lastDropped = dropped
+				}
+			}
+		}
+	}
+}
+
+// completeTransmission logs a completed transmission and finishes its recording.
+func (ptt *PTTConfig) completeTransmission(tx activeTx) {
+	rec := newTxRecord(tx)
+	if tx.Local {
+		rec.Hostname, rec.MAC = localTalker(ifaceName)
+	} else {
+		rec.Hostname, rec.MAC = lookupTalker(network.DefaultDnsmasqHostsPath, arpTablePath, tx.Talker)
+	}
+
+	if ptt.recorder != nil {
+		ptt.recorder.End(tx.ID)
+		rec.Recording = ptt.recorder.recordingPath(tx.Talker, tx.Start)
+	}
+
+	ptt.Log.Info().
+		Str("direction", rec.Direction).
+		Str("talkerIp", rec.TalkerIP).
+		Str("hostname", rec.Hostname).
+		Str("mac", rec.MAC).
+		Time("start", rec.Start).
+		Int64("durationMs", rec.DurationMs).
+		Int("frames", rec.Frames).
+		Float64("frameLossPct", rec.FrameLossPct).
+		Str("recording", rec.Recording).
+		Msg("Transmission complete")
+
+	if ptt.txLog != nil {
+		if err := ptt.txLog.Append(rec); err != nil {
+			ptt.Log.Error().Err(err).Msg("Failed to write transmission log")
+		}
+	}
 }
@@ -84,3 +84,12 @@ func (ptt *PTTConfig) joinMulticastGroup(iface *net.Interface, conn *net.UDPConn
 
 	return p.JoinGroup(iface, &net.UDPAddr{IP: group})
 }
+
+// rejoinMulticastGroup drops any existing membership of group on iface before joining
+// it again, so the membership follows a change of the interface address.
+func (ptt *PTTConfig) rejoinMulticastGroup(iface *net.Interface, conn *net.UDPConn, group net.IP) error {
+	p := ipv4.NewPacketConn(conn)
+	_ = p.LeaveGroup(iface, &net.UDPAddr{IP: group})
+
+	return p.JoinGroup(iface, &net.UDPAddr{IP: group})
+}
@@ -0,0 +1,144 @@
+package ptt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	oggHeaderTypeBOS byte = 0x02
+	oggHeaderTypeEOS byte = 0x04
+
+	// opusPreSkip is the encoder lookahead in samples at 48 kHz that players discard.
+	opusPreSkip uint16 = 312
+)
+
+// oggCRCTable is the lookup table for the Ogg page checksum: CRC-32 with polynomial
+// 0x04c11db7, no reflection and a zero initial value.
+var oggCRCTable = func() [256]uint32 {
+	var table [256]uint32
+	for i := range table {
+		crc := uint32(i) << 24
+		for range 8 {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}()
+
+func oggCRC(data []byte) uint32 {
+	var crc uint32
+	for _, b := range data {
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^b]
+	}
+	return crc
+}
+
+// oggOpusWriter writes Opus packets to an Ogg Opus stream (RFC 7845), one packet per
+// page. The last packet is held back so that its page can carry the end-of-stream
+// flag when the writer is closed.
+type oggOpusWriter struct {
+	w       io.Writer
+	serial  uint32
+	seq     uint32
+	granule uint64
+	pending []byte
+}
+
+// newOggOpusWriter writes the Opus identification and comment headers to w and
+// returns a writer for the audio packets. comments are added as user comments, e.g.
+// "TALKER=10.41.1.10".
+func newOggOpusWriter(w io.Writer, serial uint32, comments ...string) (*oggOpusWriter, error) {
+	ow := &oggOpusWriter{w: w, serial: serial}
+
+	head := make([]byte, 19)
+	copy(head, "OpusHead")
+	head[8] = 1 // version
+	head[9] = byte(channels)
+	binary.LittleEndian.PutUint16(head[10:], opusPreSkip)
+	binary.LittleEndian.PutUint32(head[12:], uint32(sampleRate))
+	// output gain and channel mapping family are zero
+	if err := ow.writePage(head, oggHeaderTypeBOS, 0); err != nil {
+		return nil, err
+	}
+
+	vendor := "openmanetd"
+	tags := make([]byte, 0, 64)
+	tags = append(tags, "OpusTags"...)
+	tags = binary.LittleEndian.AppendUint32(tags, uint32(len(vendor)))
+	tags = append(tags, vendor...)
+	tags = binary.LittleEndian.AppendUint32(tags, uint32(len(comments)))
+	for _, c := range comments {
+		tags = binary.LittleEndian.AppendUint32(tags, uint32(len(c)))
+		tags = append(tags, c...)
+	}
+	if err := ow.writePage(tags, 0, 0); err != nil {
+		return nil, err
+	}
+
+	return ow, nil
+}
+
+// WritePacket adds one Opus packet of frameSize samples to the stream.
+func (ow *oggOpusWriter) WritePacket(packet []byte) error {
+	if ow.pending != nil {
+		if err := ow.writePage(ow.pending, 0, ow.granule); err != nil {
+			return err
+		}
+	}
+
+	ow.pending = packet
+	ow.granule += uint64(frameSize)
+	return nil
+}
+
+// Close writes the held back packet with the end-of-stream flag. It does not close
+// the underlying writer.
+func (ow *oggOpusWriter) Close() error {
+	packet := ow.pending
+	if packet == nil {
+		packet = []byte{}
+	}
+	ow.pending = nil
+
+	return ow.writePage(packet, oggHeaderTypeEOS, ow.granule)
+}
+
+func (ow *oggOpusWriter) writePage(packet []byte, headerType byte, granule uint64) error {
+	// Lacing: a run of 255s and a final value below 255 that ends the packet
+	segments := make([]byte, 0, len(packet)/255+1)
+	for n := len(packet); ; n -= 255 {
+		if n < 255 {
+			segments = append(segments, byte(n))
+			break
+		}
+		segments = append(segments, 255)
+	}
+	if len(segments) > 255 {
+		return fmt.Errorf("opus packet of %d bytes does not fit an ogg page", len(packet))
+	}
+
+	page := make([]byte, 27, 27+len(segments)+len(packet))
+	copy(page, "OggS")
+	page[5] = headerType
+	binary.LittleEndian.PutUint64(page[6:], granule)
+	binary.LittleEndian.PutUint32(page[14:], ow.serial)
+	binary.LittleEndian.PutUint32(page[18:], ow.seq)
+	page[26] = byte(len(segments))
+	page = append(page, segments...)
+	page = append(page, packet...)
+	binary.LittleEndian.PutUint32(page[22:], oggCRC(page))
+
+	ow.seq++
+
+	if _, err := ow.w.Write(page); err != nil {
+		return fmt.Errorf("failed to write ogg page: %w", err)
+	}
+	return nil
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/gordonklaus/portaudio"
 	"github.com/hraban/opus"
+	batmanadv "github.com/openmanet/openmanetd/internal/batman-adv"
 	"github.com/rs/zerolog"
 )
 
@@ -35,9 +36,6 @@ var (
 	// codec/network
 	encoder         *opus.Encoder
 	decoder         *opus.Decoder
-	udpSendConn     *net.UDPConn
-	udpRecvConn     *net.UDPConn
-	localIP         string
 	playbackBuffer  = make(chan []float32, 2)
 	beepBufferStart = make([]float32, frameSize)
 	beepBufferStop  = make([]float32, frameSize)
@@ -63,11 +61,38 @@ type PTTConfig struct {
 	Iface         string
 	McastAddr     string
 	McastPort     int
+	McastTTL      int
 	PttKey        string
 	Debug         bool
 	Loopback      bool
 	PttDevice     string
 	PttDeviceName string
+
+	// BatInterface is the batman-adv interface whose multicast settings are checked
+	// at start.
+	BatInterface string
+
+	// TxLogPath is the JSON-lines file completed transmissions are logged to; empty
+	// disables the log. It is rotated once it exceeds TxLogMaxSize bytes, keeping
+	// TxLogMaxBackups old files.
+	TxLogPath       string
+	TxLogMaxSize    int64
+	TxLogMaxBackups int
+
+	// RecordEnable writes the audio of every transmission to an Ogg Opus file in
+	// RecordDir, deleting the oldest once they exceed RecordMaxTotalSize bytes.
+	RecordEnable       bool
+	RecordDir          string
+	RecordMaxTotalSize int64
+
+	// sockets is created in Start and rebound when the interface address changes.
+	sockets *pttSockets
+
+	// transmissions splits sent and received audio into transmissions for the
+	// transmission log and recorder, which are nil when disabled.
+	transmissions *txTracker
+	txLog         *txLog
+	recorder      *recorder
 }
 
 func NewPTT(cfg PTTConfig) *PTTConfig {
@@ -78,11 +103,20 @@ func NewPTT(cfg PTTConfig) *PTTConfig {
 		Iface:         cfg.Iface,
 		McastAddr:     cfg.McastAddr,
 		McastPort:     cfg.McastPort,
+		McastTTL:      cfg.McastTTL,
 		PttKey:        cfg.PttKey,
 		Debug:         cfg.Debug,
 		Loopback:      cfg.Loopback,
 		PttDevice:     cfg.PttDevice,
 		PttDeviceName: cfg.PttDeviceName,
+		BatInterface:  cfg.BatInterface,
+
+		TxLogPath:          cfg.TxLogPath,
+		TxLogMaxSize:       cfg.TxLogMaxSize,
+		TxLogMaxBackups:    cfg.TxLogMaxBackups,
+		RecordEnable:       cfg.RecordEnable,
+		RecordDir:          cfg.RecordDir,
+		RecordMaxTotalSize: cfg.RecordMaxTotalSize,
 	}
 }
 
@@ -123,9 +157,26 @@ func (ptt *PTTConfig) Start() {
 		pttDeviceName = ptt.PttDeviceName
 	}
 
-	ptt.Log.Info().Msgf("Starting PTT on iface=%s mcast=%s:%d key=%s debug=%t loopback=%t ptt_device=%s", ifaceName, mcastAddr, mcastPort, pttKey, debugEnabled, loopbackAudio, pttDeviceName)
+	mcastTTL := checkMcastTTL(ptt.McastTTL)
+
+	groupIP, warning, err := checkMcastGroup(mcastAddr)
+	if err != nil {
+		ptt.Log.Fatal().Err(err).Msg("Invalid PTT multicast group")
+	}
+	if warning != "" {
+		ptt.Log.Warn().Msg(warning)
+	}
+
+	ptt.Log.Info().Msgf("Starting PTT on iface=%s mcast=%s:%d ttl=%d key=%s debug=%t loopback=%t ptt_device=%s", ifaceName, mcastAddr, mcastPort, mcastTTL, pttKey, debugEnabled, loopbackAudio, pttDeviceName)
+
+	if ptt.BatInterface != "" {
+		if meshCfg, err := batmanadv.GetMeshConfig(ptt.BatInterface); err != nil {
+			ptt.Log.Debug().Err(err).Msg("Unable to read batman-adv multicast settings")
+		} else {
+			logMeshHint(ptt.Log, meshCfg)
+		}
+	}
 
-	var err error
 	encoder, err = opus.NewEncoder(sampleRate, channels, opus.AppVoIP)
 	if err != nil {
 		ptt.Log.Fatal().Err(err).Msg("Failed to create Opus encoder")
@@ -211,7 +262,8 @@ func (ptt *PTTConfig) Start() {
 
 		buf := make([]byte, 4000)
 		if n, err := encoder.Encode(pcm, buf); err == nil {
-			_, _ = udpSendConn.Write(buf[:n])
+			_, _ = ptt.sockets.Write(buf[:n])
+			ptt.observeFrame(ptt.sockets.LocalIP(), true, buf[:n])
 			ptt.Log.Debug().Msgf("Encoded %d bytes from mic callback", n)
 		}
 	})
@@ -233,21 +285,10 @@ func (ptt *PTTConfig) Start() {
 		ptt.Log.Fatal().Err(err).Msg("Failed to get interface IPv4")
 	}
 
-	localIP = ifIP
 	ptt.Log.Debug().Msgf("Using interface %s with IP %s", ifaceName, ifIP)
 
-	// sender bound to iface IP so traffic egresses that iface
-	dst := &net.UDPAddr{IP: net.ParseIP(mcastAddr), Port: mcastPort}
-	src := &net.UDPAddr{IP: net.ParseIP(ifIP), Port: 0}
-
-	udpSendConn, err = net.DialUDP("udp4", src, dst)
-	if err != nil {
-		ptt.Log.Fatal().Err(err).Msg("Failed to dial UDP")
-	}
-	ptt.Log.Debug().Msgf("Sender bound to %s -> %s:%d", src.IP.String(), mcastAddr, mcastPort)
-
-	// receiver on all, then join group on iface
-	udpRecvConn, err = net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4zero, Port: mcastPort})
+	// receiver on all; the group is joined on iface when the sockets are bound
+	udpRecvConn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4zero, Port: mcastPort})
 	if err != nil {
 		ptt.Log.Fatal().Err(err).Msg("Failed to listen on UDP")
 	}
@@ -256,11 +297,30 @@ func (ptt *PTTConfig) Start() {
 		ptt.Log.Fatal().Err(err).Msg("Failed to set UDP read buffer")
 	}
 
-	if err := ptt.joinMulticastGroup(ifi, udpRecvConn, net.ParseIP(mcastAddr)); err != nil {
-		ptt.Log.Fatal().Err(err).Msg("Failed to join multicast group")
+	// sender bound to iface IP so traffic egresses that iface
+	group := &net.UDPAddr{IP: groupIP, Port: mcastPort}
+	ptt.sockets = newPTTSockets(ptt.Log, group, mcastDialer(mcastTTL, loopbackAudio),
+		func(ifi *net.Interface, group net.IP) error {
+			return ptt.rejoinMulticastGroup(ifi, udpRecvConn, group)
+		},
+		func() bool {
+			return !isBroadcasting()
+		},
+	)
+
+	if err := ptt.sockets.rebind(addrChange{IP: ifIP, Iface: ifi}); err != nil {
+		ptt.Log.Fatal().Err(err).Msg("Failed to bind PTT sockets")
 	}
+	ptt.Log.Debug().Msgf("Sender bound to %s -> %s:%d", ifIP, mcastAddr, mcastPort)
 	ptt.Log.Debug().Msgf("Joined multicast group %s:%d", mcastAddr, mcastPort)
 
+	// follow address changes on iface, e.g. when the reservation worker configures it
+	done := make(chan struct{})
+	defer close(done)
+	go ptt.sockets.watch(pollIfaceAddr(ifaceName, ifIP, ifaceAddrPollInterval, ptt.getIfaceIPv4, done))
+
+	ptt.startTransmissionLog(done)
+
 	go ptt.receiveLoop(udpRecvConn)
 
 	// PTT input (kept as-is for now)
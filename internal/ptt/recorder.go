@@ -0,0 +1,301 @@
+package ptt
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	// defaultRecordMaxTotalSize is the recording directory size limit used when none
+	// is configured.
+	defaultRecordMaxTotalSize int64 = 64 << 20
+
+	// recorderQueueSize is how many frames may wait for the disk before new ones are
+	// dropped. At 50 frames a second this covers about five seconds of a slow write.
+	recorderQueueSize int = 256
+
+	// recordingIdleTimeout closes a recording that stopped receiving frames without
+	// being ended, e.g. because its end was dropped from a full queue.
+	recordingIdleTimeout time.Duration = 10 * time.Second
+
+	recordingExt string = ".opus"
+)
+
+type recOpKind int
+
+const (
+	recBegin recOpKind = iota
+	recFrame
+	recEnd
+)
+
+type recOp struct {
+	kind   recOpKind
+	id     string
+	talker string
+	start  time.Time
+	data   []byte
+}
+
+// openRecording is a recording being written.
+type openRecording struct {
+	path string
+	f    io.WriteCloser
+	buf  *bufio.Writer
+	ogg  *oggOpusWriter
+	last time.Time
+}
+
+// recorder writes the Opus frames of each transmission to its own Ogg Opus file and
+// keeps the recording directory below maxTotal bytes by deleting the oldest
+// recordings. All disk access happens on the recorder's goroutine: Begin, Frame and
+// End never block and drop the operation, counting it, when the queue is full.
+type recorder struct {
+	log      zerolog.Logger
+	dir      string
+	maxTotal int64
+
+	ops     chan recOp
+	done    chan struct{}
+	dropped atomic.Uint64
+
+	// create opens a recording file; overridable for tests.
+	create func(path string) (io.WriteCloser, error)
+	now    func() time.Time
+}
+
+// newRecorder creates a recorder writing to dir. A non-positive maxTotal uses the
+// default limit.
+func newRecorder(log zerolog.Logger, dir string, maxTotal int64) *recorder {
+	if maxTotal <= 0 {
+		maxTotal = defaultRecordMaxTotalSize
+	}
+
+	return &recorder{
+		log:      log,
+		dir:      dir,
+		maxTotal: maxTotal,
+		ops:      make(chan recOp, recorderQueueSize),
+		done:     make(chan struct{}),
+		create: func(path string) (io.WriteCloser, error) {
+			return os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+		},
+		now: time.Now,
+	}
+}
+
+// Start creates the recording directory and starts the writer goroutine.
+func (r *recorder) Start() error {
+	if err := os.MkdirAll(r.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create recording directory: %w", err)
+	}
+
+	go r.run()
+	return nil
+}
+
+// Close ends all open recordings and waits for the writer goroutine to finish.
+func (r *recorder) Close() {
+	close(r.ops)
+	<-r.done
+}
+
+// Begin starts the recording of transmission id from talker.
+func (r *recorder) Begin(id, talker string, start time.Time) {
+	r.enqueue(recOp{kind: recBegin, id: id, talker: talker, start: start})
+}
+
+// Frame adds an Opus frame to the recording of transmission id.
+func (r *recorder) Frame(id string, data []byte) {
+	r.enqueue(recOp{kind: recFrame, id: id, data: data})
+}
+
+// End finishes the recording of transmission id.
+func (r *recorder) End(id string) {
+	r.enqueue(recOp{kind: recEnd, id: id})
+}
+
+// Dropped returns the number of operations dropped because the queue was full.
+func (r *recorder) Dropped() uint64 {
+	return r.dropped.Load()
+}
+
+func (r *recorder) enqueue(op recOp) {
+	select {
+	case r.ops <- op:
+	default:
+		r.dropped.Add(1)
+	}
+}
+
+// recordingPath returns the file a transmission from talker starting at start is
+// recorded to.
+func (r *recorder) recordingPath(talker string, start time.Time) string {
+	name := fmt.Sprintf("%s_%s%s", start.UTC().Format("20060102T150405.000Z"), strings.ReplaceAll(talker, ":", "-"), recordingExt)
+	return filepath.Join(r.dir, name)
+}
+
+func (r *recorder) run() {
+	defer close(r.done)
+
+	open := make(map[string]*openRecording)
+	ticker := time.NewTicker(recordingIdleTimeout)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case op, ok := <-r.ops:
+			if !ok {
+				for id, rec := range open {
+					r.finish(rec)
+					delete(open, id)
+				}
+				r.enforceRetention()
+				return
+			}
+
+			switch op.kind {
+			case recBegin:
+				rec, err := r.begin(op)
+				if err != nil {
+					r.log.Error().Err(err).Str("talker", op.talker).Msg("Failed to start recording")
+					continue
+				}
+				open[op.id] = rec
+
+			case recFrame:
+				rec, ok := open[op.id]
+				if !ok {
+					continue
+				}
+				if err := rec.ogg.WritePacket(op.data); err != nil {
+					r.log.Error().Err(err).Str("path", rec.path).Msg("Failed to write recording")
+				}
+				rec.last = r.now()
+
+			case recEnd:
+				if rec, ok := open[op.id]; ok {
+					r.finish(rec)
+					delete(open, op.id)
+					r.enforceRetention()
+				}
+			}
+
+		case <-ticker.C:
+			for id, rec := range open {
+				if r.now().Sub(rec.last) >= recordingIdleTimeout {
+					r.finish(rec)
+					delete(open, id)
+				}
+			}
+		}
+	}
+}
+
+func (r *recorder) begin(op recOp) (*openRecording, error) {
+	path := r.recordingPath(op.talker, op.start)
+
+	f, err := r.create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recording %s: %w", path, err)
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(op.id))
+
+	buf := bufio.NewWriter(f)
+	ogg, err := newOggOpusWriter(buf, h.Sum32(), "TALKER="+op.talker, "START="+op.start.UTC().Format(time.RFC3339Nano))
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &openRecording{path: path, f: f, buf: buf, ogg: ogg, last: r.now()}, nil
+}
+
+func (r *recorder) finish(rec *openRecording) {
+	err := errors.Join(rec.ogg.Close(), rec.buf.Flush(), rec.f.Close())
+	if err != nil {
+		r.log.Error().Err(err).Str("path", rec.path).Msg("Failed to finish recording")
+	}
+}
+
+func (r *recorder) enforceRetention() {
+	removed, err := enforceRecordingRetention(r.dir, r.maxTotal)
+	if err != nil {
+		r.log.Error().Err(err).Msg("Failed to enforce recording retention")
+	}
+	for _, path := range removed {
+		r.log.Info().Str("path", path).Msg("Deleted recording to stay within the size limit")
+	}
+}
+
+// enforceRecordingRetention deletes the oldest recordings in dir until the recordings
+// left take up at most maxTotal bytes.
+//
+// Returns the deleted paths and any errors encountered.
+func enforceRecordingRetention(dir string, maxTotal int64) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recordings: %w", err)
+	}
+
+	type recording struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+
+	var (
+		recordings []recording
+		total      int64
+	)
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != recordingExt {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		recordings = append(recordings, recording{filepath.Join(dir, entry.Name()), info.Size(), info.ModTime()})
+		total += info.Size()
+	}
+
+	// Names start with the UTC start time, so they break modification time ties
+	sort.Slice(recordings, func(i, j int) bool {
+		if !recordings[i].modTime.Equal(recordings[j].modTime) {
+			return recordings[i].modTime.Before(recordings[j].modTime)
+		}
+		return recordings[i].path < recordings[j].path
+	})
+
+	var (
+		removed []string
+		errs    []error
+	)
+	for _, rec := range recordings {
+		if total <= maxTotal {
+			break
+		}
+		if err := os.Remove(rec.path); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		total -= rec.size
+		removed = append(removed, rec.path)
+	}
+
+	return removed, errors.Join(errs...)
+}
@@ -0,0 +1,186 @@
+package ptt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// oggPages splits an Ogg stream into pages, verifying each checksum.
+func oggPages(t *testing.T, data []byte) [][]byte {
+	t.Helper()
+
+	var pages [][]byte
+	for len(data) > 0 {
+		if len(data) < 27 || string(data[:4]) != "OggS" {
+			t.Fatalf("page %d has no capture pattern", len(pages))
+		}
+		n := 27 + int(data[26])
+		for _, seg := range data[27:n] {
+			n += int(seg)
+		}
+		page := append([]byte(nil), data[:n]...)
+
+		want := binary.LittleEndian.Uint32(page[22:])
+		binary.LittleEndian.PutUint32(page[22:], 0)
+		if got := oggCRC(page); got != want {
+			t.Fatalf("page %d checksum = %08x, want %08x", len(pages), got, want)
+		}
+		binary.LittleEndian.PutUint32(page[22:], want)
+
+		pages = append(pages, page)
+		data = data[n:]
+	}
+	return pages
+}
+
+func TestOggOpusWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := newOggOpusWriter(&buf, 42, "TALKER=10.41.1.10")
+	if err != nil {
+		t.Fatalf("newOggOpusWriter() error = %v", err)
+	}
+	for _, size := range []int{30, 300} {
+		if err := w.WritePacket(make([]byte, size)); err != nil {
+			t.Fatalf("WritePacket() error = %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	pages := oggPages(t, buf.Bytes())
+	if len(pages) != 4 {
+		t.Fatalf("wrote %d pages, want 4", len(pages))
+	}
+	if pages[0][5] != oggHeaderTypeBOS || string(pages[0][28:36]) != "OpusHead" {
+		t.Error("first page is not an OpusHead beginning of stream")
+	}
+	if !bytes.Contains(pages[1], []byte("TALKER=10.41.1.10")) {
+		t.Error("comment header is missing the talker")
+	}
+	for i, page := range pages {
+		if seq := binary.LittleEndian.Uint32(page[18:]); seq != uint32(i) {
+			t.Errorf("page %d sequence = %d", i, seq)
+		}
+	}
+
+	last := pages[3]
+	if last[5] != oggHeaderTypeEOS {
+		t.Error("last page does not end the stream")
+	}
+	if granule := binary.LittleEndian.Uint64(last[6:]); granule != uint64(2*frameSize) {
+		t.Errorf("final granule position = %d, want %d", granule, 2*frameSize)
+	}
+	// A 300 byte packet is laced as 255 + 45
+	if last[26] != 2 || last[27] != 255 || last[28] != 45 {
+		t.Errorf("lacing = %v, want [255 45]", last[27:27+last[26]])
+	}
+}
+
+func TestEnforceRecordingRetention(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	names := []string{"c.opus", "a.opus", "b.opus", "d.opus"}
+	for i, name := range names {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, make([]byte, 100), 0o644); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+		_ = os.Chtimes(path, base.Add(time.Duration(i)*time.Minute), base.Add(time.Duration(i)*time.Minute))
+	}
+	// Other files are neither counted nor deleted
+	_ = os.WriteFile(filepath.Join(dir, "notes.txt"), make([]byte, 1000), 0o644)
+
+	removed, err := enforceRecordingRetention(dir, 250)
+	if err != nil {
+		t.Fatalf("enforceRecordingRetention() error = %v", err)
+	}
+
+	want := []string{filepath.Join(dir, "c.opus"), filepath.Join(dir, "a.opus")}
+	if len(removed) != 2 || removed[0] != want[0] || removed[1] != want[1] {
+		t.Errorf("removed = %v, want the two oldest %v", removed, want)
+	}
+	for _, name := range []string{"b.opus", "d.opus", "notes.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s was deleted", name)
+		}
+	}
+}
+
+// slowFile blocks every write until release is closed.
+type slowFile struct {
+	release chan struct{}
+	buf     bytes.Buffer
+}
+
+func (f *slowFile) Write(p []byte) (int, error) {
+	<-f.release
+	return f.buf.Write(p)
+}
+
+func (f *slowFile) Close() error { return nil }
+
+func TestRecorder_NonBlockingOnSlowDisk(t *testing.T) {
+	dir := t.TempDir()
+	r := newRecorder(zerolog.Nop(), dir, 0)
+
+	file := &slowFile{release: make(chan struct{})}
+	r.create = func(string) (io.WriteCloser, error) { return file, nil }
+	if err := r.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	start := time.Now()
+	r.Begin("tx1", "10.41.1.10", start)
+	// Far more frames than the queue holds while the disk is stuck
+	for range recorderQueueSize * 4 {
+		r.Frame("tx1", make([]byte, 60))
+	}
+	r.End("tx1")
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("queueing took %v while the disk was blocked", elapsed)
+	}
+	if r.Dropped() == 0 {
+		t.Error("Dropped() = 0, want frames dropped while the disk was blocked")
+	}
+
+	close(file.release)
+	r.Close()
+
+	if file.buf.Len() == 0 {
+		t.Error("nothing was written once the disk caught up")
+	}
+}
+
+func TestRecorder_WritesRecording(t *testing.T) {
+	dir := t.TempDir()
+	r := newRecorder(zerolog.Nop(), dir, 0)
+	if err := r.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	r.Begin("tx1", "10.41.1.10", start)
+	for range 10 {
+		r.Frame("tx1", make([]byte, 40))
+	}
+	r.End("tx1")
+	r.Close()
+
+	data, err := os.ReadFile(r.recordingPath("10.41.1.10", start))
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if pages := oggPages(t, data); len(pages) != 12 {
+		t.Errorf("recording has %d pages, want 2 headers and 10 audio pages", len(pages))
+	}
+}
@@ -0,0 +1,136 @@
+package ptt
+
+import (
+	"fmt"
+	"net"
+
+	batmanadv "github.com/openmanet/openmanetd/internal/batman-adv"
+	"github.com/rs/zerolog"
+	"golang.org/x/net/ipv4"
+)
+
+// How far PTT audio travels is decided in two places. Within a mesh segment
+// batman-adv carries the frames at layer 2, so the multicast TTL does not apply and
+// every node that batman-adv considers a listener hears them. Past a router, such as
+// a gateway joining two sites, the group's scope and the TTL decide: routers never
+// forward link-local groups (224.0.0.0/24), and forward other groups only while the
+// TTL lasts and the group is not administratively scoped at the site boundary
+// (239.0.0.0/8, RFC 2365). A talk group meant for one site should therefore use a
+// group in 239.0.0.0/8 and a TTL just large enough to cross the routers inside it.
+//
+// With multicast_forceflood off, batman-adv only forwards a group to the nodes that
+// announced a listener for it. Nodes whose listeners sit behind a bridge are only
+// known through IGMP, so without a querier those nodes ask for all multicast
+// (WantsAllMulticast), and a node that asks for nothing hears nothing. logMeshHint
+// reports this at start, as a hint for when remote listeners stay silent.
+
+// defaultMcastTTL is the TTL of PTT frames when none is configured. It is the
+// kernel default, keeping frames on the local mesh segment.
+const defaultMcastTTL int = 1
+
+// mcastScope is the scope of an IPv4 multicast group.
+type mcastScope int
+
+const (
+	// mcastScopeLinkLocal groups (224.0.0.0/24) are never forwarded by routers.
+	mcastScopeLinkLocal mcastScope = iota
+	// mcastScopeAdmin groups (239.0.0.0/8) are administratively scoped, and kept
+	// within a site by its boundary routers.
+	mcastScopeAdmin
+	// mcastScopeGlobal groups are all other multicast groups, which routers forward
+	// as far as the TTL allows.
+	mcastScopeGlobal
+)
+
+var (
+	linkLocalMcast = &net.IPNet{IP: net.IPv4(224, 0, 0, 0).To4(), Mask: net.CIDRMask(24, 32)}
+	adminMcast     = &net.IPNet{IP: net.IPv4(239, 0, 0, 0).To4(), Mask: net.CIDRMask(8, 32)}
+)
+
+// scopeOf returns the scope of the IPv4 multicast group ip.
+func scopeOf(ip net.IP) mcastScope {
+	switch {
+	case linkLocalMcast.Contains(ip):
+		return mcastScopeLinkLocal
+	case adminMcast.Contains(ip):
+		return mcastScopeAdmin
+	default:
+		return mcastScopeGlobal
+	}
+}
+
+// checkMcastGroup parses the PTT multicast group addr.
+//
+// Returns the group, a warning if its scope does not suit a talk group scoped to a
+// site, and an error if addr is not an IPv4 multicast address.
+func checkMcastGroup(addr string) (net.IP, string, error) {
+	ip := net.ParseIP(addr).To4()
+	if ip == nil || !ip.IsMulticast() {
+		return nil, "", fmt.Errorf("ptt multicast group %q is not an IPv4 multicast address", addr)
+	}
+
+	switch scopeOf(ip) {
+	case mcastScopeLinkLocal:
+		return ip, fmt.Sprintf("ptt multicast group %s is link-local and is never routed: it reaches only the local mesh segment whatever ptt.mcastTTL is; use a group in %s to reach other sites", ip, adminMcast), nil
+	case mcastScopeGlobal:
+		return ip, fmt.Sprintf("ptt multicast group %s is not administratively scoped: routers may forward it beyond the site for up to ptt.mcastTTL hops; use a group in %s to keep talk groups within a site", ip, adminMcast), nil
+	}
+
+	return ip, "", nil
+}
+
+// checkMcastTTL returns ttl, or defaultMcastTTL if it is not a valid TTL.
+func checkMcastTTL(ttl int) int {
+	if ttl < 1 || ttl > 255 {
+		return defaultMcastTTL
+	}
+	return ttl
+}
+
+// setMcastOptions sets the multicast TTL and loopback of the send socket conn
+// explicitly, rather than leaving them to kernel defaults. With loop off the kernel
+// does not deliver our own frames back to the receive socket.
+func setMcastOptions(conn net.PacketConn, ttl int, loop bool) error {
+	p := ipv4.NewPacketConn(conn)
+
+	if err := p.SetMulticastTTL(ttl); err != nil {
+		return fmt.Errorf("failed to set multicast TTL %d: %w", ttl, err)
+	}
+	if err := p.SetMulticastLoopback(loop); err != nil {
+		return fmt.Errorf("failed to set multicast loopback: %w", err)
+	}
+
+	return nil
+}
+
+// mcastDialer returns a dial function for pttSockets that opens a UDP socket bound
+// to src and connected to dst, with the multicast TTL and loopback applied.
+func mcastDialer(ttl int, loop bool) func(src, dst *net.UDPAddr) (sendConn, error) {
+	return func(src, dst *net.UDPAddr) (sendConn, error) {
+		conn, err := net.DialUDP("udp4", src, dst)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := setMcastOptions(conn, ttl, loop); err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		return conn, nil
+	}
+}
+
+// logMeshHint logs how batman-adv will carry PTT frames if its multicast
+// optimization may keep them from remote listeners: forceflood is off and there is
+// no IPv4 querier, so only nodes that want all multicast are sure to get them.
+func logMeshHint(log zerolog.Logger, cfg *batmanadv.MeshConfig) {
+	if cfg.IsMulticastForcefloodEnabled() || cfg.HasIPv4Querier() {
+		return
+	}
+
+	log.Info().
+		Bool("wantsAllMulticast", cfg.WantsAllMulticast()).
+		Bool("bridged", cfg.IsBridged()).
+		Msg("batman-adv multicast optimization is on and there is no IPv4 querier; PTT frames only reach nodes that announce a listener or want all multicast. Enable multicast_forceflood or run an IGMP querier if remote listeners hear nothing")
+}
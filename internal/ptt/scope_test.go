@@ -0,0 +1,128 @@
+package ptt
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+
+	batmanadv "github.com/openmanet/openmanetd/internal/batman-adv"
+	"github.com/rs/zerolog"
+	"golang.org/x/net/ipv4"
+)
+
+func TestCheckMcastGroup(t *testing.T) {
+	tests := []struct {
+		name        string
+		addr        string
+		wantErr     bool
+		wantWarning string
+	}{
+		{name: "administratively scoped", addr: "239.192.0.10"},
+		{name: "link-local", addr: "224.0.0.1", wantWarning: "link-local"},
+		{name: "link-local upper bound", addr: "224.0.0.255", wantWarning: "link-local"},
+		{name: "global scope", addr: "224.0.1.20", wantWarning: "not administratively scoped"},
+		{name: "global scope below admin range", addr: "238.255.255.255", wantWarning: "not administratively scoped"},
+		{name: "unicast", addr: "10.41.0.1", wantErr: true},
+		{name: "IPv6 multicast", addr: "ff02::1", wantErr: true},
+		{name: "garbage", addr: "talkgroup", wantErr: true},
+		{name: "empty", addr: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ip, warning, err := checkMcastGroup(tt.addr)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("checkMcastGroup(%q) = %v, want an error", tt.addr, ip)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("checkMcastGroup(%q) error = %v", tt.addr, err)
+			}
+			if !ip.Equal(net.ParseIP(tt.addr)) {
+				t.Errorf("checkMcastGroup(%q) = %v", tt.addr, ip)
+			}
+
+			if tt.wantWarning == "" && warning != "" {
+				t.Errorf("checkMcastGroup(%q) warning = %q, want none", tt.addr, warning)
+			}
+			if !strings.Contains(warning, tt.wantWarning) {
+				t.Errorf("checkMcastGroup(%q) warning = %q, want it to mention %q", tt.addr, warning, tt.wantWarning)
+			}
+		})
+	}
+}
+
+func TestCheckMcastTTL(t *testing.T) {
+	for ttl, want := range map[int]int{0: defaultMcastTTL, -1: defaultMcastTTL, 1: 1, 8: 8, 255: 255, 256: defaultMcastTTL} {
+		if got := checkMcastTTL(ttl); got != want {
+			t.Errorf("checkMcastTTL(%d) = %d, want %d", ttl, got, want)
+		}
+	}
+}
+
+func TestMcastDialer_SetsSocketOptions(t *testing.T) {
+	src := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}
+	dst := &net.UDPAddr{IP: net.ParseIP("239.192.0.10"), Port: 5007}
+
+	for _, tt := range []struct {
+		ttl  int
+		loop bool
+	}{
+		{ttl: 1, loop: false},
+		{ttl: 4, loop: true},
+	} {
+		conn, err := mcastDialer(tt.ttl, tt.loop)(src, dst)
+		if err != nil {
+			t.Fatalf("dial error = %v", err)
+		}
+
+		p := ipv4.NewPacketConn(conn.(*net.UDPConn))
+		if got, err := p.MulticastTTL(); err != nil || got != tt.ttl {
+			t.Errorf("MulticastTTL() = %d, %v; want %d", got, err, tt.ttl)
+		}
+		if got, err := p.MulticastLoopback(); err != nil || got != tt.loop {
+			t.Errorf("MulticastLoopback() = %t, %v; want %t", got, err, tt.loop)
+		}
+
+		conn.Close()
+	}
+}
+
+func TestLogMeshHint(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      batmanadv.MeshConfig
+		wantHint bool
+	}{
+		{
+			name:     "optimized without querier",
+			cfg:      batmanadv.MeshConfig{McastFlags: batmanadv.McastFlags{WantAllIpv4: true}, McastFlagsPriv: batmanadv.McastFlagsPriv{Bridged: true}},
+			wantHint: true,
+		},
+		{
+			name: "forceflood",
+			cfg:  batmanadv.MeshConfig{MulticastForcefloodEnabled: true},
+		},
+		{
+			name: "querier present",
+			cfg:  batmanadv.MeshConfig{McastFlagsPriv: batmanadv.McastFlagsPriv{QuerierIpv4Exists: true}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logMeshHint(zerolog.New(&buf), &tt.cfg)
+
+			if got := buf.Len() > 0; got != tt.wantHint {
+				t.Fatalf("logged %q, want hint %t", buf.String(), tt.wantHint)
+			}
+			if tt.wantHint && !strings.Contains(buf.String(), `"wantsAllMulticast":true`) {
+				t.Errorf("hint %q does not report wantsAllMulticast", buf.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,283 @@
+package ptt
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// txGap is how long a talker must be silent for its transmission to be considered
+	// complete. Frames are sent every opusFrameDuration while transmitting.
+	txGap time.Duration = 500 * time.Millisecond
+
+	// opusFrameDuration is the audio carried by one encoded frame.
+	opusFrameDuration time.Duration = time.Duration(frameSize) * time.Second / time.Duration(sampleRate)
+
+	// defaultTxLogMaxSize and defaultTxLogMaxBackups apply when the transmission log
+	// rotation limits are not configured.
+	defaultTxLogMaxSize    int64 = 1 << 20
+	defaultTxLogMaxBackups int   = 3
+
+	// arpTablePath is the kernel ARP table used to find the MAC address of a talker.
+	arpTablePath string = "/proc/net/arp"
+)
+
+// TxRecord is the log record of one completed transmission.
+type TxRecord struct {
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	DurationMs int64     `json:"durationMs"`
+	// Direction is "tx" for transmissions made by this node and "rx" for received ones.
+	Direction string `json:"direction"`
+	TalkerIP  string `json:"talkerIp"`
+	Hostname  string `json:"hostname,omitempty"`
+	MAC       string `json:"mac,omitempty"`
+	Frames    int    `json:"frames"`
+	// FrameLossPct is the share of frames expected over the duration of the
+	// transmission that never arrived.
+	FrameLossPct float64 `json:"frameLossPct"`
+	Recording    string  `json:"recording,omitempty"`
+}
+
+// newTxRecord builds the record of a completed transmission. The expected frame count
+// is derived from the time between its first and last frame.
+func newTxRecord(tx activeTx) TxRecord {
+	duration := tx.Last.Sub(tx.Start) + opusFrameDuration
+	expected := max(int(duration/opusFrameDuration), tx.Frames)
+
+	direction := "rx"
+	if tx.Local {
+		direction = "tx"
+	}
+
+	return TxRecord{
+		Start:        tx.Start,
+		End:          tx.Last.Add(opusFrameDuration),
+		DurationMs:   duration.Milliseconds(),
+		Direction:    direction,
+		TalkerIP:     tx.Talker,
+		Frames:       tx.Frames,
+		FrameLossPct: float64(expected-tx.Frames) / float64(expected) * 100,
+	}
+}
+
+// activeTx is a transmission in progress.
+type activeTx struct {
+	ID     string
+	Talker string
+	Local  bool
+	Start  time.Time
+	Last   time.Time
+	Frames int
+}
+
+// txTracker splits the frames received from each talker into transmissions. There is
+// no start or end marker in the audio stream, so a transmission ends once its talker
+// has been silent for gap.
+type txTracker struct {
+	gap time.Duration
+
+	mu     sync.Mutex
+	active map[string]*activeTx
+}
+
+// newTxTracker creates a txTracker that ends transmissions after gap of silence.
+func newTxTracker(gap time.Duration) *txTracker {
+	return &txTracker{gap: gap, active: make(map[string]*activeTx)}
+}
+
+// Frame records a frame from talker received at now.
+//
+// Returns a copy of the transmission the frame belongs to and whether the frame
+// started it.
+func (t *txTracker) Frame(talker string, local bool, now time.Time) (activeTx, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tx, ok := t.active[talker]
+	if !ok {
+		tx = &activeTx{
+			ID:     fmt.Sprintf("%s-%d", talker, now.UnixNano()),
+			Talker: talker,
+			Local:  local,
+			Start:  now,
+		}
+		t.active[talker] = tx
+	}
+	tx.Last = now
+	tx.Frames++
+
+	return *tx, !ok
+}
+
+// Expire ends the transmissions whose talker has been silent for the gap.
+//
+// Returns the ended transmissions ordered by start time.
+func (t *txTracker) Expire(now time.Time) []activeTx {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var ended []activeTx
+	for talker, tx := range t.active {
+		if now.Sub(tx.Last) >= t.gap {
+			ended = append(ended, *tx)
+			delete(t.active, talker)
+		}
+	}
+
+	sort.Slice(ended, func(i, j int) bool {
+		return ended[i].Start.Before(ended[j].Start)
+	})
+
+	return ended
+}
+
+// txLog appends transmission records to a JSON-lines file. The file is rotated to
+// path.1 .. path.<maxBackups> once it would grow beyond maxSize.
+type txLog struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+// newTxLog opens, creating if needed, the transmission log at path. Non-positive
+// limits use the defaults.
+func newTxLog(path string, maxSize int64, maxBackups int) (*txLog, error) {
+	if maxSize <= 0 {
+		maxSize = defaultTxLogMaxSize
+	}
+	if maxBackups <= 0 {
+		maxBackups = defaultTxLogMaxBackups
+	}
+
+	l := &txLog{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func (l *txLog) open() error {
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create transmission log directory: %w", err)
+	}
+
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open transmission log %s: %w", l.path, err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to stat transmission log %s: %w", l.path, err)
+	}
+
+	l.f = f
+	l.size = info.Size()
+	return nil
+}
+
+// Append writes rec as one line, rotating the file first if needed.
+func (l *txLog) Append(rec TxRecord) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to marshal transmission record: %w", err)
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.size > 0 && l.size+int64(len(line)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := l.f.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write transmission log: %w", err)
+	}
+
+	return nil
+}
+
+// rotate shifts the backups up by one, dropping the oldest, and starts a new file.
+func (l *txLog) rotate() error {
+	if err := l.f.Close(); err != nil {
+		return fmt.Errorf("failed to close transmission log: %w", err)
+	}
+
+	for i := l.maxBackups - 1; i >= 1; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", l.path, i), fmt.Sprintf("%s.%d", l.path, i+1))
+	}
+	if err := os.Rename(l.path, l.path+".1"); err != nil {
+		return fmt.Errorf("failed to rotate transmission log: %w", err)
+	}
+
+	return l.open()
+}
+
+// Close closes the log file.
+func (l *txLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Close()
+}
+
+// lookupTalker returns the hostname and MAC address of the peer at ip, taken from the
+// peer hosts file written by the address reservation worker and the ARP table. Either
+// is empty if it is unknown.
+func lookupTalker(hostsPath, arpPath, ip string) (hostname, mac string) {
+	if f, err := os.Open(hostsPath); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) >= 2 && fields[0] == ip {
+				// The bare hostname is last; earlier names carry the domain
+				hostname = fields[len(fields)-1]
+				break
+			}
+		}
+		f.Close()
+	}
+
+	if f, err := os.Open(arpPath); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			// IP address, HW type, Flags, HW address, Mask, Device
+			fields := strings.Fields(scanner.Text())
+			if len(fields) >= 4 && fields[0] == ip && fields[3] != "00:00:00:00:00:00" {
+				mac = strings.ToLower(fields[3])
+				break
+			}
+		}
+		f.Close()
+	}
+
+	return hostname, mac
+}
+
+// localTalker returns this node's hostname and the MAC address of iface.
+func localTalker(iface string) (hostname, mac string) {
+	hostname, _ = os.Hostname()
+	if ifi, err := net.InterfaceByName(iface); err == nil {
+		mac = ifi.HardwareAddr.String()
+	}
+	return hostname, mac
+}
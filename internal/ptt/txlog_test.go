@@ -0,0 +1,180 @@
+package ptt
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewTxRecord(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		tx       activeTx
+		wantMs   int64
+		wantLoss float64
+	}{
+		{
+			name:     "no loss",
+			tx:       activeTx{Talker: "10.41.1.10", Start: start, Last: start.Add(99 * opusFrameDuration), Frames: 100},
+			wantMs:   2000,
+			wantLoss: 0,
+		},
+		{
+			name:     "a quarter of the frames lost",
+			tx:       activeTx{Talker: "10.41.1.10", Start: start, Last: start.Add(99 * opusFrameDuration), Frames: 75},
+			wantMs:   2000,
+			wantLoss: 25,
+		},
+		{
+			name:     "duplicate frames never yield negative loss",
+			tx:       activeTx{Talker: "10.41.1.10", Start: start, Last: start.Add(9 * opusFrameDuration), Frames: 12},
+			wantMs:   200,
+			wantLoss: 0,
+		},
+		{
+			name:     "single frame",
+			tx:       activeTx{Talker: "10.41.1.10", Local: true, Start: start, Last: start, Frames: 1},
+			wantMs:   20,
+			wantLoss: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := newTxRecord(tt.tx)
+
+			if got.DurationMs != tt.wantMs {
+				t.Errorf("DurationMs = %d, want %d", got.DurationMs, tt.wantMs)
+			}
+			if got.FrameLossPct != tt.wantLoss {
+				t.Errorf("FrameLossPct = %v, want %v", got.FrameLossPct, tt.wantLoss)
+			}
+			if !got.Start.Equal(start) || got.End.Sub(got.Start).Milliseconds() != tt.wantMs {
+				t.Errorf("Start, End = %v, %v; want %dms apart from %v", got.Start, got.End, tt.wantMs, start)
+			}
+			wantDir := "rx"
+			if tt.tx.Local {
+				wantDir = "tx"
+			}
+			if got.Direction != wantDir || got.TalkerIP != tt.tx.Talker {
+				t.Errorf("Direction, TalkerIP = %q, %q", got.Direction, got.TalkerIP)
+			}
+		})
+	}
+}
+
+func TestTxTracker(t *testing.T) {
+	tracker := newTxTracker(txGap)
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	first, started := tracker.Frame("10.41.1.10", false, start)
+	if !started {
+		t.Fatal("Frame() did not start a transmission for the first frame")
+	}
+	other, _ := tracker.Frame("10.41.1.11", false, start.Add(10*time.Millisecond))
+
+	now := start
+	for range 49 {
+		now = now.Add(opusFrameDuration)
+		if tx, started := tracker.Frame("10.41.1.10", false, now); started || tx.ID != first.ID {
+			t.Fatalf("Frame() started a new transmission mid-stream")
+		}
+	}
+
+	if ended := tracker.Expire(now.Add(txGap - time.Millisecond)); len(ended) != 1 || ended[0].ID != other.ID {
+		t.Fatalf("Expire() = %+v, want only the silent talker", ended)
+	}
+
+	ended := tracker.Expire(now.Add(txGap))
+	if len(ended) != 1 || ended[0].ID != first.ID || ended[0].Frames != 50 {
+		t.Fatalf("Expire() = %+v, want the first transmission with 50 frames", ended)
+	}
+
+	// The next frame from the same talker starts a new transmission
+	if tx, started := tracker.Frame("10.41.1.10", false, now.Add(time.Second)); !started || tx.ID == first.ID {
+		t.Error("Frame() after the gap continued the old transmission")
+	}
+}
+
+func TestTxLogRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tx.jsonl")
+
+	rec := TxRecord{Direction: "rx", TalkerIP: "10.41.1.10", Frames: 50}
+	line, _ := json.Marshal(rec)
+	// Room for three records per file
+	l, err := newTxLog(path, int64(3*(len(line)+1)), 2)
+	if err != nil {
+		t.Fatalf("newTxLog() error = %v", err)
+	}
+	defer l.Close()
+
+	for i := range 10 {
+		rec.Frames = i
+		if err := l.Append(rec); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+	}
+
+	frames := func(path string) []int {
+		t.Helper()
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatalf("Open(%s) error = %v", path, err)
+		}
+		defer f.Close()
+
+		var got []int
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var rec TxRecord
+			if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+				t.Fatalf("line %q is not a record: %v", scanner.Text(), err)
+			}
+			got = append(got, rec.Frames)
+		}
+		return got
+	}
+
+	for file, want := range map[string][]int{
+		path:        {9},
+		path + ".1": {6, 7, 8},
+		path + ".2": {3, 4, 5},
+	} {
+		if got := frames(file); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%s holds %v, want %v", filepath.Base(file), got, want)
+		}
+	}
+
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("found a third backup, want at most 2")
+	}
+}
+
+func TestLookupTalker(t *testing.T) {
+	dir := t.TempDir()
+	hosts := filepath.Join(dir, "hosts")
+	arp := filepath.Join(dir, "arp")
+
+	_ = os.WriteFile(hosts, []byte("10.41.1.10 node-a.lan node-a\n10.41.1.11 node-b.lan node-b\n"), 0o644)
+	_ = os.WriteFile(arp, []byte(`IP address       HW type     Flags       HW address            Mask     Device
+10.41.1.10       0x1         0x2         AA:BB:CC:DD:EE:01     *        br-ahwlan
+10.41.1.12       0x1         0x0         00:00:00:00:00:00     *        br-ahwlan
+`), 0o644)
+
+	if host, mac := lookupTalker(hosts, arp, "10.41.1.10"); host != "node-a" || mac != "aa:bb:cc:dd:ee:01" {
+		t.Errorf("lookupTalker(10.41.1.10) = %q, %q", host, mac)
+	}
+	if host, mac := lookupTalker(hosts, arp, "10.41.1.12"); host != "" || mac != "" {
+		t.Errorf("lookupTalker(10.41.1.12) = %q, %q; want nothing for an incomplete entry", host, mac)
+	}
+	if host, mac := lookupTalker(filepath.Join(dir, "missing"), filepath.Join(dir, "missing"), "10.41.1.10"); host != "" || mac != "" {
+		t.Errorf("lookupTalker() with missing files = %q, %q", host, mac)
+	}
+}
@@ -0,0 +1,194 @@
+// Package safemode implements a process-wide switch that stops openmanetd from
+// changing the system while it keeps observing and publishing.
+//
+// Every wrapper that changes system state (UCI writes and commits, kernel routes and
+// addresses, service reloads, generated files) calls Check first. While safe mode is
+// active Check logs and counts the suppressed operation and returns an error wrapping
+// ErrSuppressed, so the wrapper returns before touching anything. Read paths never
+// consult it.
+package safemode
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	// DefaultRunDir holds the files used to control safe mode from the command line.
+	DefaultRunDir string = "/var/run/openmanetd"
+
+	// stateFile records whether safe mode is active, for the CLI to report.
+	stateFile string = "safemode"
+	// requestFile holds the state the CLI asks for on the next SIGUSR2.
+	requestFile string = "safemode.request"
+)
+
+// ErrSuppressed is returned by mutating operations skipped because safe mode is active.
+var ErrSuppressed = errors.New("suppressed by safe mode")
+
+var (
+	enabled    atomic.Bool
+	suppressed atomic.Uint64
+
+	mu     sync.Mutex
+	log    = zerolog.Nop()
+	runDir string
+	onExit []func()
+)
+
+// Configure sets the logger for safe mode changes and suppressed operations, and the
+// directory the current state is written to. An empty dir disables the state file.
+//
+// Returns an error if the current state cannot be recorded.
+func Configure(l zerolog.Logger, dir string) error {
+	mu.Lock()
+	defer mu.Unlock()
+	log = l
+	runDir = dir
+
+	if dir == "" {
+		return nil
+	}
+	return writeState(dir, enabled.Load())
+}
+
+// Enabled reports whether safe mode is active.
+func Enabled() bool {
+	return enabled.Load()
+}
+
+// Suppressed returns the number of operations suppressed since the process started.
+func Suppressed() uint64 {
+	return suppressed.Load()
+}
+
+// OnExit registers fn to run when safe mode is left, so that the state that drifted
+// while changes were suppressed is reconciled right away. Callbacks run in
+// registration order on the goroutine that leaves safe mode.
+func OnExit(fn func()) {
+	mu.Lock()
+	defer mu.Unlock()
+	onExit = append(onExit, fn)
+}
+
+// Set enters or leaves safe mode. reason is recorded in the audit log line.
+//
+// Returns true if the state changed.
+func Set(on bool, reason string) bool {
+	mu.Lock()
+	if enabled.Load() == on {
+		mu.Unlock()
+		return false
+	}
+	enabled.Store(on)
+
+	l, dir := log, runDir
+	callbacks := append([]func(){}, onExit...)
+	mu.Unlock()
+
+	if on {
+		l.Warn().Bool("audit", true).Str("reason", reason).Msg("Safe mode entered, system changes are suppressed")
+	} else {
+		l.Warn().Bool("audit", true).Str("reason", reason).Uint64("suppressed", Suppressed()).Msg("Safe mode left, reconciling")
+	}
+
+	if dir != "" {
+		if err := writeState(dir, on); err != nil {
+			l.Error().Err(err).Msg("Failed to record safe mode state")
+		}
+	}
+
+	if !on {
+		for _, fn := range callbacks {
+			fn()
+		}
+	}
+
+	return true
+}
+
+// Check returns nil if op may go ahead. While safe mode is active it logs and counts
+// op and returns an error wrapping ErrSuppressed.
+func Check(op string) error {
+	if !enabled.Load() {
+		return nil
+	}
+
+	n := suppressed.Add(1)
+
+	mu.Lock()
+	l := log
+	mu.Unlock()
+	l.Warn().Bool("audit", true).Str("op", op).Uint64("suppressed", n).Msg("Suppressed by safe mode")
+
+	return fmt.Errorf("%s: %w", op, ErrSuppressed)
+}
+
+// HandleSignal applies the state requested with RequestState, or toggles safe mode
+// if there is no pending request. It is called on SIGUSR2.
+//
+// Returns whether safe mode is active afterwards.
+func HandleSignal(dir string) bool {
+	data, err := os.ReadFile(filepath.Join(dir, requestFile))
+	if err != nil {
+		Set(!Enabled(), "SIGUSR2")
+		return Enabled()
+	}
+	_ = os.Remove(filepath.Join(dir, requestFile))
+
+	switch strings.TrimSpace(string(data)) {
+	case "on":
+		Set(true, "requested from command line")
+	case "off":
+		Set(false, "requested from command line")
+	}
+
+	return Enabled()
+}
+
+// RequestState records the state the next SIGUSR2 should put the daemon in.
+func RequestState(dir string, on bool) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create run directory: %w", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, requestFile), []byte(stateString(on)+"\n"), 0o644); err != nil {
+		return fmt.Errorf("failed to write safe mode request: %w", err)
+	}
+
+	return nil
+}
+
+// ReadState returns the safe mode state last recorded by the daemon.
+//
+// Returns an error if the daemon has not recorded a state.
+func ReadState(dir string) (bool, error) {
+	data, err := os.ReadFile(filepath.Join(dir, stateFile))
+	if err != nil {
+		return false, fmt.Errorf("failed to read safe mode state: %w", err)
+	}
+
+	return strings.TrimSpace(string(data)) == "on", nil
+}
+
+func writeState(dir string, on bool) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create run directory: %w", err)
+	}
+
+	return os.WriteFile(filepath.Join(dir, stateFile), []byte(stateString(on)+"\n"), 0o644)
+}
+
+func stateString(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
@@ -0,0 +1,108 @@
+package safemode
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+// reset leaves safe mode and drops callbacks and the state directory registered by a test.
+func reset(t *testing.T) {
+	t.Helper()
+	t.Cleanup(func() {
+		Set(false, "test")
+		mu.Lock()
+		onExit = nil
+		runDir = ""
+		mu.Unlock()
+	})
+}
+
+func TestCheck(t *testing.T) {
+	reset(t)
+
+	if err := Check("op"); err != nil {
+		t.Fatalf("Check() outside safe mode = %v, want nil", err)
+	}
+
+	before := Suppressed()
+	Set(true, "test")
+
+	err := Check("uci commit")
+	if !errors.Is(err, ErrSuppressed) {
+		t.Fatalf("Check() in safe mode = %v, want ErrSuppressed", err)
+	}
+	if got := Suppressed() - before; got != 1 {
+		t.Errorf("Suppressed() grew by %d, want 1", got)
+	}
+}
+
+func TestSet_OnExit(t *testing.T) {
+	reset(t)
+
+	calls := 0
+	OnExit(func() { calls++ })
+
+	if !Set(true, "test") {
+		t.Fatal("Set(true) reported no change")
+	}
+	if calls != 0 {
+		t.Errorf("entering safe mode ran %d callbacks", calls)
+	}
+	if Set(true, "test") {
+		t.Error("Set(true) while enabled reported a change")
+	}
+	if !Set(false, "test") {
+		t.Fatal("Set(false) reported no change")
+	}
+	if calls != 1 {
+		t.Errorf("leaving safe mode ran %d callbacks, want 1", calls)
+	}
+	if Set(false, "test") || calls != 1 {
+		t.Error("Set(false) while disabled reported a change or ran callbacks")
+	}
+}
+
+func TestHandleSignal(t *testing.T) {
+	reset(t)
+	dir := t.TempDir()
+	if err := Configure(zerolog.Nop(), dir); err != nil {
+		t.Fatalf("Configure() error = %v", err)
+	}
+
+	if on, err := ReadState(dir); err != nil || on {
+		t.Fatalf("ReadState() = %v, %v; want off", on, err)
+	}
+
+	// Without a request the signal toggles
+	if !HandleSignal(dir) {
+		t.Fatal("HandleSignal() without a request did not enter safe mode")
+	}
+	if on, _ := ReadState(dir); !on {
+		t.Error("state file was not updated to on")
+	}
+
+	// A request is applied as is and then removed
+	if err := RequestState(dir, true); err != nil {
+		t.Fatalf("RequestState() error = %v", err)
+	}
+	if !HandleSignal(dir) {
+		t.Error("HandleSignal() with an on request left safe mode")
+	}
+	if _, err := os.Stat(filepath.Join(dir, requestFile)); !os.IsNotExist(err) {
+		t.Error("request file was not removed")
+	}
+
+	if err := RequestState(dir, false); err != nil {
+		t.Fatalf("RequestState() error = %v", err)
+	}
+	if HandleSignal(dir) {
+		t.Error("HandleSignal() with an off request stayed in safe mode")
+	}
+	if on, _ := ReadState(dir); on {
+		t.Error("state file was not updated to off")
+	}
+}
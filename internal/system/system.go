@@ -1,9 +1,18 @@
 package system
 
-import "os/exec"
+import (
+	"os/exec"
 
-// Reboot initiates a system reboot by executing the "reboot" command.
+	"github.com/openmanet/openmanetd/internal/safemode"
+)
+
+// Reboot initiates a system reboot by executing the "reboot" command. It is
+// suppressed while safe mode is active.
 func Reboot() error {
+	if err := safemode.Check("reboot"); err != nil {
+		return err
+	}
+
 	cmd := exec.Command("reboot")
 	return cmd.Run()
 }
@@ -0,0 +1,290 @@
+package ubus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Blob attributes are a 32-bit big-endian header holding an extended flag, a 7-bit
+// ID and a 24-bit length that includes the header, followed by the payload padded to
+// four bytes. Containers hold their children back to back, padding included.
+//
+// blobmsg attributes are extended blob attributes whose payload starts with a name:
+// a 16-bit length, the name and a NUL, padded to four bytes.
+const (
+	blobAttrExtended uint32 = 0x80000000
+	blobAttrIDMask   uint32 = 0x7f000000
+	blobAttrIDShift         = 24
+	blobAttrLenMask  uint32 = 0x00ffffff
+	blobAttrHdrLen          = 4
+)
+
+// blobmsg types.
+const (
+	blobmsgUnspec = 0
+	blobmsgArray  = 1
+	blobmsgTable  = 2
+	blobmsgString = 3
+	blobmsgInt64  = 4
+	blobmsgInt32  = 5
+	blobmsgInt16  = 6
+	blobmsgBool   = 7
+	blobmsgDouble = 8
+)
+
+var errBlobTruncated = errors.New("truncated blob attribute")
+
+func blobAlign(n int) int {
+	return (n + 3) &^ 3
+}
+
+// blobAttr encodes one blob attribute with its padding.
+func blobAttr(id uint8, extended bool, payload []byte) []byte {
+	length := blobAttrHdrLen + len(payload)
+	hdr := uint32(id)<<blobAttrIDShift&blobAttrIDMask | uint32(length)&blobAttrLenMask
+	if extended {
+		hdr |= blobAttrExtended
+	}
+
+	out := make([]byte, blobAlign(length))
+	binary.BigEndian.PutUint32(out, hdr)
+	copy(out[blobAttrHdrLen:], payload)
+
+	return out
+}
+
+func blobString(id uint8, s string) []byte {
+	return blobAttr(id, false, append([]byte(s), 0))
+}
+
+func blobUint32(id uint8, v uint32) []byte {
+	return blobAttr(id, false, binary.BigEndian.AppendUint32(nil, v))
+}
+
+// attr is a decoded blob attribute.
+type attr struct {
+	id       uint8
+	extended bool
+	payload  []byte
+}
+
+// parseBlobAttrs splits data into consecutive blob attributes.
+func parseBlobAttrs(data []byte) ([]attr, error) {
+	var attrs []attr
+
+	for len(data) > 0 {
+		if len(data) < blobAttrHdrLen {
+			return nil, errBlobTruncated
+		}
+
+		hdr := binary.BigEndian.Uint32(data)
+		length := int(hdr & blobAttrLenMask)
+		if length < blobAttrHdrLen || length > len(data) {
+			return nil, errBlobTruncated
+		}
+
+		attrs = append(attrs, attr{
+			id:       uint8((hdr & blobAttrIDMask) >> blobAttrIDShift),
+			extended: hdr&blobAttrExtended != 0,
+			payload:  data[blobAttrHdrLen:length],
+		})
+
+		data = data[min(blobAlign(length), len(data)):]
+	}
+
+	return attrs, nil
+}
+
+func blobmsgAttr(typ uint8, name string, data []byte) []byte {
+	hdrLen := blobAlign(2 + len(name) + 1)
+	payload := make([]byte, hdrLen, hdrLen+len(data))
+	binary.BigEndian.PutUint16(payload, uint16(len(name)))
+	copy(payload[2:], name)
+	payload = append(payload, data...)
+
+	return blobAttr(typ, true, payload)
+}
+
+// encodeBlobmsgTable encodes the fields of v, which must marshal to a JSON object,
+// as the blobmsg attributes of a table.
+func encodeBlobmsgTable(v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal reply: %w", err)
+	}
+
+	var generic map[string]any
+	if err := unmarshalJSON(data, &generic); err != nil {
+		return nil, fmt.Errorf("reply is not a JSON object: %w", err)
+	}
+
+	return encodeBlobmsgFields(generic)
+}
+
+func unmarshalJSON(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+func encodeBlobmsgFields(fields map[string]any) ([]byte, error) {
+	// Sorted so replies are stable
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var out []byte
+	for _, name := range names {
+		enc, err := encodeBlobmsg(name, fields[name])
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, enc...)
+	}
+
+	return out, nil
+}
+
+// encodeBlobmsg encodes a value decoded from JSON as a named blobmsg attribute.
+func encodeBlobmsg(name string, v any) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return blobmsgAttr(blobmsgUnspec, name, nil), nil
+
+	case bool:
+		var b byte
+		if v {
+			b = 1
+		}
+		return blobmsgAttr(blobmsgBool, name, []byte{b}), nil
+
+	case string:
+		return blobmsgAttr(blobmsgString, name, append([]byte(v), 0)), nil
+
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return blobmsgAttr(blobmsgInt64, name, binary.BigEndian.AppendUint64(nil, uint64(i))), nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %w", name, err)
+		}
+		return blobmsgAttr(blobmsgDouble, name, binary.BigEndian.AppendUint64(nil, math.Float64bits(f))), nil
+
+	case map[string]any:
+		data, err := encodeBlobmsgFields(v)
+		if err != nil {
+			return nil, err
+		}
+		return blobmsgAttr(blobmsgTable, name, data), nil
+
+	case []any:
+		var data []byte
+		for _, elem := range v {
+			enc, err := encodeBlobmsg("", elem)
+			if err != nil {
+				return nil, err
+			}
+			data = append(data, enc...)
+		}
+		return blobmsgAttr(blobmsgArray, name, data), nil
+
+	default:
+		return nil, fmt.Errorf("field %q: unsupported type %T", name, v)
+	}
+}
+
+// decodeBlobmsgTable decodes the blobmsg attributes of a table into a map, the
+// reverse of encodeBlobmsgTable. Integers decode as int64.
+func decodeBlobmsgTable(data []byte) (map[string]any, error) {
+	attrs, err := parseBlobAttrs(data)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]any, len(attrs))
+	for _, a := range attrs {
+		name, v, err := decodeBlobmsg(a)
+		if err != nil {
+			return nil, err
+		}
+		out[name] = v
+	}
+
+	return out, nil
+}
+
+func decodeBlobmsg(a attr) (string, any, error) {
+	if !a.extended || len(a.payload) < 2 {
+		return "", nil, errors.New("not a blobmsg attribute")
+	}
+
+	nameLen := int(binary.BigEndian.Uint16(a.payload))
+	hdrLen := blobAlign(2 + nameLen + 1)
+	if hdrLen > len(a.payload) {
+		return "", nil, errBlobTruncated
+	}
+	name := string(a.payload[2 : 2+nameLen])
+	data := a.payload[hdrLen:]
+
+	switch a.id {
+	case blobmsgUnspec:
+		return name, nil, nil
+	case blobmsgBool:
+		if len(data) < 1 {
+			return "", nil, errBlobTruncated
+		}
+		return name, data[0] != 0, nil
+	case blobmsgString:
+		if n := len(data); n > 0 && data[n-1] == 0 {
+			data = data[:n-1]
+		}
+		return name, string(data), nil
+	case blobmsgInt16:
+		if len(data) < 2 {
+			return "", nil, errBlobTruncated
+		}
+		return name, int64(int16(binary.BigEndian.Uint16(data))), nil
+	case blobmsgInt32:
+		if len(data) < 4 {
+			return "", nil, errBlobTruncated
+		}
+		return name, int64(int32(binary.BigEndian.Uint32(data))), nil
+	case blobmsgInt64:
+		if len(data) < 8 {
+			return "", nil, errBlobTruncated
+		}
+		return name, int64(binary.BigEndian.Uint64(data)), nil
+	case blobmsgDouble:
+		if len(data) < 8 {
+			return "", nil, errBlobTruncated
+		}
+		return name, math.Float64frombits(binary.BigEndian.Uint64(data)), nil
+	case blobmsgTable:
+		v, err := decodeBlobmsgTable(data)
+		return name, v, err
+	case blobmsgArray:
+		attrs, err := parseBlobAttrs(data)
+		if err != nil {
+			return "", nil, err
+		}
+		elems := make([]any, 0, len(attrs))
+		for _, elem := range attrs {
+			_, v, err := decodeBlobmsg(elem)
+			if err != nil {
+				return "", nil, err
+			}
+			elems = append(elems, v)
+		}
+		return name, elems, nil
+	default:
+		return "", nil, fmt.Errorf("unknown blobmsg type %d", a.id)
+	}
+}
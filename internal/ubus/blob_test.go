@@ -0,0 +1,115 @@
+package ubus
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestBlobmsgAttr_Layout(t *testing.T) {
+	// "a": "b" is an extended string attribute of length 10, padded to 12
+	want := []byte{0x83, 0x00, 0x00, 0x0a, 0x00, 0x01, 'a', 0x00, 'b', 0x00, 0x00, 0x00}
+
+	got := blobmsgAttr(blobmsgString, "a", []byte("b\x00"))
+	if !bytes.Equal(got, want) {
+		t.Errorf("blobmsgAttr() = % x, want % x", got, want)
+	}
+}
+
+func TestBlobmsgTable_RoundTrip(t *testing.T) {
+	type gateway struct {
+		Hostname string  `json:"hostname"`
+		Selected bool    `json:"selected"`
+		Latency  float64 `json:"latency"`
+	}
+
+	in := struct {
+		Hostname string    `json:"hostname"`
+		Count    int       `json:"count"`
+		Negative int       `json:"negative"`
+		Missing  *string   `json:"missing"`
+		Gateways []gateway `json:"gateways"`
+		Tags     []string  `json:"tags"`
+		Empty    []string  `json:"empty"`
+		Nested   any       `json:"nested"`
+	}{
+		Hostname: "node-a",
+		Count:    3,
+		Negative: -7,
+		Gateways: []gateway{
+			{Hostname: "gw1", Selected: true, Latency: 12.5},
+			{Hostname: "gw2", Latency: 40},
+		},
+		Tags:   []string{"x", "yz"},
+		Empty:  []string{},
+		Nested: map[string]any{"deeper": map[string]any{"n": 1}},
+	}
+
+	enc, err := encodeBlobmsgTable(in)
+	if err != nil {
+		t.Fatalf("encodeBlobmsgTable() error = %v", err)
+	}
+	if len(enc)%4 != 0 {
+		t.Errorf("encoded length %d is not padded to 4 bytes", len(enc))
+	}
+
+	got, err := decodeBlobmsgTable(enc)
+	if err != nil {
+		t.Fatalf("decodeBlobmsgTable() error = %v", err)
+	}
+
+	want := map[string]any{
+		"hostname": "node-a",
+		"count":    int64(3),
+		"negative": int64(-7),
+		"missing":  nil,
+		"gateways": []any{
+			map[string]any{"hostname": "gw1", "selected": true, "latency": 12.5},
+			map[string]any{"hostname": "gw2", "selected": false, "latency": int64(40)},
+		},
+		"tags":   []any{"x", "yz"},
+		"empty":  []any{},
+		"nested": map[string]any{"deeper": map[string]any{"n": int64(1)}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip = %#v, want %#v", got, want)
+	}
+}
+
+func TestEncodeBlobmsgTable_NotObject(t *testing.T) {
+	if _, err := encodeBlobmsgTable([]string{"a"}); err == nil {
+		t.Error("encodeBlobmsgTable() of an array should fail")
+	}
+}
+
+func TestParseBlobAttrs_Truncated(t *testing.T) {
+	attr := blobString(attrObjPath, "openmanet")
+
+	for _, n := range []int{2, 6, len(attr) - 4} {
+		if _, err := parseBlobAttrs(attr[:n]); err == nil {
+			t.Errorf("parseBlobAttrs() of %d bytes should fail", n)
+		}
+	}
+}
+
+func TestMessage_RoundTrip(t *testing.T) {
+	enc := encodeMessage(msgInvoke, 513, 0x01020304,
+		blobUint32(attrObjID, 42),
+		blobString(attrMethod, "status"),
+	)
+
+	msg, err := readMessage(bytes.NewReader(enc))
+	if err != nil {
+		t.Fatalf("readMessage() error = %v", err)
+	}
+
+	if msg.typ != msgInvoke || msg.seq != 513 || msg.peer != 0x01020304 {
+		t.Errorf("header = type %d seq %d peer %#x", msg.typ, msg.seq, msg.peer)
+	}
+	if id, ok := msg.uint32Attr(attrObjID); !ok || id != 42 {
+		t.Errorf("object ID = %d, %v, want 42", id, ok)
+	}
+	if got := msg.stringAttr(attrMethod); got != "status" {
+		t.Errorf("method = %q, want status", got)
+	}
+}
@@ -0,0 +1,182 @@
+package ubus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// ErrUnavailable is returned by Client.Call when ubusd cannot be reached, e.g. on a
+// host without ubus. Callers can fall back to other means with errors.Is.
+var ErrUnavailable = errors.New("ubusd unavailable")
+
+// callTimeout bounds a call whose context has no deadline.
+const callTimeout = 30 * time.Second
+
+// StatusError is returned when ubusd or the called object answers with a status
+// other than StatusOK.
+type StatusError struct {
+	Object string
+	Method string
+	Status uint32
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("ubus call %s %s: %s", e.Object, e.Method, statusText(e.Status))
+}
+
+// statusText returns the message "ubus call" prints for status.
+func statusText(status uint32) string {
+	switch status {
+	case StatusInvalidCommand:
+		return "invalid command"
+	case StatusInvalidArg:
+		return "invalid argument"
+	case StatusMethodNotFound:
+		return "method not found"
+	case StatusNotFound:
+		return "not found"
+	case StatusNoData:
+		return "no response"
+	default:
+		return fmt.Sprintf("status %d", status)
+	}
+}
+
+// Client calls methods of the objects published on ubus, as "ubus call" does. Each
+// call uses its own connection, so a Client is safe for concurrent use.
+type Client struct {
+	dial func(ctx context.Context) (net.Conn, error)
+}
+
+// NewClient creates a client connecting to the ubusd socket at socketPath, usually
+// DefaultSocketPath.
+//
+// Example:
+//
+//	_, err := ubus.NewClient(ubus.DefaultSocketPath).Call(ctx, "network", "reload", nil)
+func NewClient(socketPath string) *Client {
+	return newClient(func(ctx context.Context) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", socketPath)
+	})
+}
+
+func newClient(dial func(ctx context.Context) (net.Conn, error)) *Client {
+	return &Client{dial: dial}
+}
+
+// Call invokes method of object with args, which must marshal to a JSON object or
+// be nil, and returns the reply table, which is empty for methods that send none.
+//
+// Returns an ErrUnavailable error if ubusd cannot be reached, and a *StatusError if
+// the object does not exist or the call fails.
+func (c *Client) Call(ctx context.Context, object, method string, args any) (map[string]any, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, callTimeout)
+		defer cancel()
+	}
+
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	defer conn.Close()
+
+	deadline, _ := ctx.Deadline()
+	_ = conn.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	// ubusd greets every client before anything else
+	hello, err := readMessage(conn)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read hello: %w", ErrUnavailable, err)
+	}
+	if hello.typ != msgHello {
+		return nil, fmt.Errorf("expected hello, got message type %d", hello.typ)
+	}
+
+	objID, err := c.lookup(conn, object, method)
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	if args != nil {
+		if data, err = encodeBlobmsgTable(args); err != nil {
+			return nil, err
+		}
+	}
+
+	req := encodeMessage(msgInvoke, 2, objID,
+		blobUint32(attrObjID, objID),
+		blobString(attrMethod, method),
+		blobAttr(attrData, false, data),
+	)
+	if _, err := conn.Write(req); err != nil {
+		return nil, fmt.Errorf("failed to call %s %s: %w", object, method, err)
+	}
+
+	reply := map[string]any{}
+	for {
+		msg, err := readMessage(conn)
+		if err != nil {
+			return nil, fmt.Errorf("failed to call %s %s: %w", object, method, err)
+		}
+		if msg.seq != 2 {
+			continue
+		}
+
+		switch msg.typ {
+		case msgData:
+			if reply, err = decodeBlobmsgTable(msg.attrs[attrData]); err != nil {
+				return nil, fmt.Errorf("invalid reply from %s %s: %w", object, method, err)
+			}
+		case msgStatus:
+			if status, _ := msg.uint32Attr(attrStatus); status != StatusOK {
+				return nil, &StatusError{Object: object, Method: method, Status: status}
+			}
+			return reply, nil
+		}
+	}
+}
+
+// lookup resolves the ID of object. method is only used in the error.
+func (c *Client) lookup(conn net.Conn, object, method string) (uint32, error) {
+	req := encodeMessage(msgLookup, 1, 0, blobString(attrObjPath, object))
+	if _, err := conn.Write(req); err != nil {
+		return 0, fmt.Errorf("failed to look up %s: %w", object, err)
+	}
+
+	var (
+		objID uint32
+		found bool
+	)
+	for {
+		msg, err := readMessage(conn)
+		if err != nil {
+			return 0, fmt.Errorf("failed to look up %s: %w", object, err)
+		}
+		if msg.seq != 1 {
+			continue
+		}
+
+		switch msg.typ {
+		case msgData:
+			objID, found = msg.uint32Attr(attrObjID)
+		case msgStatus:
+			status, _ := msg.uint32Attr(attrStatus)
+			if status == StatusOK && !found {
+				status = StatusNotFound
+			}
+			if status != StatusOK {
+				return 0, &StatusError{Object: object, Method: method, Status: status}
+			}
+			return objID, nil
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package ubus
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+)
+
+// serveCall answers one call on a fake ubusd connection: the lookup of object with
+// objID, or status if objID is 0, then the invoke with reply and status.
+//
+// Returns the called method and its arguments.
+func (f *fakeUbusd) serveCall(object string, objID uint32, reply map[string]any, status uint32) (string, map[string]any) {
+	f.t.Helper()
+	f.send(msgHello, 0, 0x100)
+
+	lookup := f.read()
+	if lookup.typ != msgLookup || lookup.stringAttr(attrObjPath) != object {
+		f.t.Fatalf("expected lookup of %s, got type %d for %q", object, lookup.typ, lookup.stringAttr(attrObjPath))
+	}
+	if objID == 0 {
+		f.send(msgStatus, lookup.seq, 0, blobUint32(attrStatus, StatusNotFound))
+		return "", nil
+	}
+	f.send(msgData, lookup.seq, 0, blobString(attrObjPath, object), blobUint32(attrObjID, objID))
+	f.send(msgStatus, lookup.seq, 0, blobUint32(attrStatus, StatusOK))
+
+	invoke := f.read()
+	if invoke.typ != msgInvoke {
+		f.t.Fatalf("expected invoke, got type %d", invoke.typ)
+	}
+	if id, _ := invoke.uint32Attr(attrObjID); id != objID || invoke.peer != objID {
+		f.t.Errorf("invoke of object %d peer %d, want %d", id, invoke.peer, objID)
+	}
+	args, err := decodeBlobmsgTable(invoke.attrs[attrData])
+	if err != nil {
+		f.t.Fatalf("decode arguments: %v", err)
+	}
+
+	if reply != nil {
+		data, err := encodeBlobmsgTable(reply)
+		if err != nil {
+			f.t.Fatalf("encode reply: %v", err)
+		}
+		f.send(msgData, invoke.seq, objID, blobUint32(attrObjID, objID), blobAttr(attrData, false, data))
+	}
+	f.send(msgStatus, invoke.seq, objID, blobUint32(attrStatus, status))
+
+	return invoke.stringAttr(attrMethod), args
+}
+
+func TestClient_Call(t *testing.T) {
+	dial, conns := pipeDialer()
+	client := newClient(dial)
+
+	type result struct {
+		reply map[string]any
+		err   error
+	}
+	results := make(chan result, 1)
+	go func() {
+		reply, err := client.Call(context.Background(), "network.interface.ahwlan", "status", map[string]any{"verbose": true})
+		results <- result{reply, err}
+	}()
+
+	ubusd := &fakeUbusd{t: t, conn: <-conns}
+	method, args := ubusd.serveCall("network.interface.ahwlan", 17, map[string]any{"up": true, "device": "br-ahwlan"}, StatusOK)
+	if method != "status" || args["verbose"] != true {
+		t.Errorf("called %q with %v", method, args)
+	}
+
+	res := <-results
+	if res.err != nil {
+		t.Fatalf("Call() error = %v", res.err)
+	}
+	if res.reply["up"] != true || res.reply["device"] != "br-ahwlan" {
+		t.Errorf("Call() reply = %v", res.reply)
+	}
+}
+
+func TestClient_CallStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		objID  uint32
+		status uint32
+	}{
+		{"object not found", 0, StatusNotFound},
+		{"method fails", 3, StatusInvalidArg},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dial, conns := pipeDialer()
+			client := newClient(dial)
+
+			errc := make(chan error, 1)
+			go func() {
+				_, err := client.Call(context.Background(), "network", "reload", nil)
+				errc <- err
+			}()
+
+			ubusd := &fakeUbusd{t: t, conn: <-conns}
+			ubusd.serveCall("network", tt.objID, nil, tt.status)
+
+			var statusErr *StatusError
+			err := <-errc
+			if !errors.As(err, &statusErr) || statusErr.Status != tt.status || statusErr.Object != "network" || statusErr.Method != "reload" {
+				t.Errorf("Call() error = %v, want *StatusError with status %d", err, tt.status)
+			}
+		})
+	}
+}
+
+func TestClient_Unavailable(t *testing.T) {
+	client := newClient(func(ctx context.Context) (net.Conn, error) {
+		return nil, errors.New("connection refused")
+	})
+
+	if _, err := client.Call(context.Background(), "network", "reload", nil); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Call() error = %v, want ErrUnavailable", err)
+	}
+	if _, err := NewClient("/nonexistent/ubus.sock").Call(context.Background(), "network", "reload", nil); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Call() on a missing socket error = %v, want ErrUnavailable", err)
+	}
+}
@@ -0,0 +1,53 @@
+//go:build ubus_integration
+
+package ubus
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// TestServer_Ubusd registers against a real ubusd and calls the object with the
+// ubus CLI. Run with: go test -tags ubus_integration ./internal/ubus/
+func TestServer_Ubusd(t *testing.T) {
+	if _, err := os.Stat(DefaultSocketPath); err != nil {
+		t.Skipf("ubusd not running: %v", err)
+	}
+	if _, err := exec.LookPath("ubus"); err != nil {
+		t.Skip("ubus CLI not installed")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := NewServer(DefaultSocketPath, "openmanet-test", testMethods(), zerolog.Nop())
+	go srv.Run(ctx)
+
+	var out []byte
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var err error
+		out, err = exec.Command("ubus", "call", "openmanet-test", "status").Output()
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("ubus call failed: %v", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	var reply map[string]any
+	if err := json.Unmarshal(out, &reply); err != nil {
+		t.Fatalf("invalid reply %q: %v", out, err)
+	}
+	if reply["hostname"] != "node-a" {
+		t.Errorf("reply = %v", reply)
+	}
+}
@@ -0,0 +1,123 @@
+package ubus
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// ubus message types.
+const (
+	msgHello        uint8 = 0
+	msgStatus       uint8 = 1
+	msgData         uint8 = 2
+	msgPing         uint8 = 3
+	msgLookup       uint8 = 4
+	msgInvoke       uint8 = 5
+	msgAddObject    uint8 = 6
+	msgRemoveObject uint8 = 7
+)
+
+// ubus message attributes.
+const (
+	attrStatus    uint8 = 1
+	attrObjPath   uint8 = 2
+	attrObjID     uint8 = 3
+	attrMethod    uint8 = 4
+	attrObjType   uint8 = 5
+	attrSignature uint8 = 6
+	attrData      uint8 = 7
+)
+
+// ubus status codes.
+const (
+	StatusOK             uint32 = 0
+	StatusInvalidCommand uint32 = 1
+	StatusInvalidArg     uint32 = 2
+	StatusMethodNotFound uint32 = 3
+	StatusNotFound       uint32 = 4
+	StatusNoData         uint32 = 5
+	StatusUnknownError   uint32 = 9
+)
+
+const (
+	msgHdrLen = 8
+	// maxMsgLen matches UBUS_MAX_MSGLEN.
+	maxMsgLen = 1 << 20
+)
+
+// message is one ubus message: an 8-byte header followed by a blob holding the
+// message attributes.
+type message struct {
+	typ   uint8
+	seq   uint16
+	peer  uint32
+	attrs map[uint8][]byte
+}
+
+func (m *message) uint32Attr(id uint8) (uint32, bool) {
+	v, ok := m.attrs[id]
+	if !ok || len(v) < 4 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(v), true
+}
+
+func (m *message) stringAttr(id uint8) string {
+	v := m.attrs[id]
+	if n := len(v); n > 0 && v[n-1] == 0 {
+		v = v[:n-1]
+	}
+	return string(v)
+}
+
+// encodeMessage frames attrs, which must already be encoded blob attributes, as a
+// ubus message.
+func encodeMessage(typ uint8, seq uint16, peer uint32, attrs ...[]byte) []byte {
+	var payload []byte
+	for _, a := range attrs {
+		payload = append(payload, a...)
+	}
+
+	out := make([]byte, msgHdrLen, msgHdrLen+blobAttrHdrLen+len(payload))
+	out[1] = typ
+	binary.BigEndian.PutUint16(out[2:], seq)
+	binary.BigEndian.PutUint32(out[4:], peer)
+
+	return append(out, blobAttr(0, false, payload)...)
+}
+
+// readMessage reads one ubus message from r.
+func readMessage(r io.Reader) (*message, error) {
+	var hdr [msgHdrLen + blobAttrHdrLen]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+
+	length := int(binary.BigEndian.Uint32(hdr[msgHdrLen:]) & blobAttrLenMask)
+	if length < blobAttrHdrLen || length > maxMsgLen {
+		return nil, fmt.Errorf("invalid ubus message length %d", length)
+	}
+
+	body := make([]byte, blobAlign(length)-blobAttrHdrLen)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+
+	attrs, err := parseBlobAttrs(body[:length-blobAttrHdrLen])
+	if err != nil {
+		return nil, fmt.Errorf("invalid ubus message: %w", err)
+	}
+
+	msg := &message{
+		typ:   hdr[1],
+		seq:   binary.BigEndian.Uint16(hdr[2:]),
+		peer:  binary.BigEndian.Uint32(hdr[4:]),
+		attrs: make(map[uint8][]byte, len(attrs)),
+	}
+	for _, a := range attrs {
+		msg.attrs[a.id] = a.payload
+	}
+
+	return msg, nil
+}
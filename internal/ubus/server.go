@@ -0,0 +1,259 @@
+// Package ubus exposes openmanetd state on the OpenWrt ubus bus so that LuCI and
+// shell scripts can read it with "ubus call", and calls the objects of other
+// services such as netifd. Only the parts of the ubus protocol needed to publish an
+// object with argument-less methods and to call methods are implemented.
+package ubus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// DefaultSocketPath is where ubusd listens on OpenWrt.
+const DefaultSocketPath string = "/var/run/ubus/ubus.sock"
+
+const (
+	// reconnectMin and reconnectMax bound the backoff between attempts to reach
+	// ubusd after it went away or was never there.
+	reconnectMin = time.Second
+	reconnectMax = 30 * time.Second
+	// registerTimeout bounds the wait for ubusd to accept the object.
+	registerTimeout = 5 * time.Second
+)
+
+// Handler produces the reply to a method call. The result must marshal to a JSON
+// object; it is sent to the caller as a blobmsg table.
+type Handler func(ctx context.Context) (any, error)
+
+// Server publishes one object on ubus and answers calls to its methods.
+type Server struct {
+	object  string
+	methods map[string]Handler
+	log     zerolog.Logger
+	dial    func(ctx context.Context) (net.Conn, error)
+}
+
+// NewServer creates a server for object with the given methods, connecting to the
+// ubusd socket at socketPath.
+//
+// Parameters:
+//   - socketPath: the ubusd socket, usually DefaultSocketPath
+//   - object: the object path callers use, for example "openmanet"
+//   - methods: the method handlers by name
+//   - log: logger for connection state and failed calls
+//
+// Example:
+//
+//	srv := ubus.NewServer(ubus.DefaultSocketPath, "openmanet", map[string]ubus.Handler{
+//		"status": func(ctx context.Context) (any, error) { return status(), nil },
+//	}, log)
+//	go srv.Run(ctx)
+func NewServer(socketPath, object string, methods map[string]Handler, log zerolog.Logger) *Server {
+	return newServer(object, methods, log, func(ctx context.Context) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", socketPath)
+	})
+}
+
+func newServer(object string, methods map[string]Handler, log zerolog.Logger, dial func(ctx context.Context) (net.Conn, error)) *Server {
+	return &Server{object: object, methods: methods, log: log, dial: dial}
+}
+
+// Run keeps the object registered until ctx is cancelled, reconnecting with backoff
+// whenever ubusd restarts. The object is removed from ubus before Run returns.
+func (s *Server) Run(ctx context.Context) {
+	backoff := reconnectMin
+
+	for {
+		registered, err := s.session(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if registered {
+			backoff = reconnectMin
+		}
+		s.log.Warn().Err(err).Dur("retry", backoff).Msg("ubus connection lost")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, reconnectMax)
+	}
+}
+
+// session connects, registers the object and serves calls until the connection
+// fails or ctx is cancelled.
+//
+// Returns whether the object was registered, and the error that ended the session.
+func (s *Server) session(ctx context.Context) (bool, error) {
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to ubusd: %w", err)
+	}
+	defer conn.Close()
+
+	// ubusd greets every client before anything else
+	_ = conn.SetReadDeadline(time.Now().Add(registerTimeout))
+	hello, err := readMessage(conn)
+	if err != nil {
+		return false, fmt.Errorf("failed to read hello: %w", err)
+	}
+	if hello.typ != msgHello {
+		return false, fmt.Errorf("expected hello, got message type %d", hello.typ)
+	}
+
+	objID, err := s.register(conn)
+	if err != nil {
+		return false, err
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+	s.log.Info().Str("object", s.object).Uint32("id", objID).Msg("Registered ubus object")
+
+	msgs := make(chan *message)
+	readErr := make(chan error, 1)
+	go func() {
+		for {
+			msg, err := readMessage(conn)
+			if err != nil {
+				readErr <- err
+				return
+			}
+			select {
+			case msgs <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.unregister(conn, objID)
+			return true, ctx.Err()
+		case err := <-readErr:
+			return true, err
+		case msg := <-msgs:
+			if msg.typ != msgInvoke {
+				continue
+			}
+			if err := s.invoke(ctx, conn, objID, msg); err != nil {
+				return true, err
+			}
+		}
+	}
+}
+
+// register adds the object and waits for ubusd to assign its ID.
+func (s *Server) register(conn net.Conn) (uint32, error) {
+	names := make([]string, 0, len(s.methods))
+	for name := range s.methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Each method is an empty table: none of them take arguments
+	var signature []byte
+	for _, name := range names {
+		signature = append(signature, blobmsgAttr(blobmsgTable, name, nil)...)
+	}
+
+	req := encodeMessage(msgAddObject, 1, 0,
+		blobString(attrObjPath, s.object),
+		blobAttr(attrSignature, false, signature),
+	)
+	if _, err := conn.Write(req); err != nil {
+		return 0, fmt.Errorf("failed to register object: %w", err)
+	}
+
+	var (
+		objID uint32
+		found bool
+	)
+	for {
+		msg, err := readMessage(conn)
+		if err != nil {
+			return 0, fmt.Errorf("failed to register object: %w", err)
+		}
+		if msg.seq != 1 {
+			continue
+		}
+
+		switch msg.typ {
+		case msgData:
+			objID, found = msg.uint32Attr(attrObjID)
+		case msgStatus:
+			status, _ := msg.uint32Attr(attrStatus)
+			if status != StatusOK {
+				return 0, fmt.Errorf("ubusd rejected object %q with status %d", s.object, status)
+			}
+			if !found {
+				return 0, errors.New("ubusd did not assign an object ID")
+			}
+			return objID, nil
+		}
+	}
+}
+
+// invoke runs the called method and sends the reply and status back to the caller.
+func (s *Server) invoke(ctx context.Context, conn net.Conn, objID uint32, msg *message) error {
+	method := msg.stringAttr(attrMethod)
+	status := StatusOK
+
+	var reply []byte
+	handler, ok := s.methods[method]
+	if !ok {
+		status = StatusMethodNotFound
+	} else {
+		result, err := handler(ctx)
+		if err == nil {
+			reply, err = encodeBlobmsgTable(result)
+		}
+		if err != nil {
+			s.log.Error().Err(err).Str("method", method).Msg("ubus call failed")
+			status = StatusUnknownError
+		}
+	}
+
+	if status == StatusOK {
+		data := encodeMessage(msgData, msg.seq, msg.peer,
+			blobUint32(attrObjID, objID),
+			blobAttr(attrData, false, reply),
+		)
+		if _, err := conn.Write(data); err != nil {
+			return fmt.Errorf("failed to send reply: %w", err)
+		}
+	}
+
+	done := encodeMessage(msgStatus, msg.seq, msg.peer,
+		blobUint32(attrStatus, status),
+		blobUint32(attrObjID, objID),
+	)
+	if _, err := conn.Write(done); err != nil {
+		return fmt.Errorf("failed to send status: %w", err)
+	}
+
+	return nil
+}
+
+// unregister removes the object so callers see it disappear right away rather than
+// when ubusd notices the closed socket.
+func (s *Server) unregister(conn net.Conn, objID uint32) {
+	_ = conn.SetWriteDeadline(time.Now().Add(time.Second))
+
+	req := encodeMessage(msgRemoveObject, 2, 0, blobUint32(attrObjID, objID))
+	if _, err := conn.Write(req); err != nil {
+		s.log.Warn().Err(err).Msg("Failed to unregister ubus object")
+		return
+	}
+
+	s.log.Info().Str("object", s.object).Msg("Unregistered ubus object")
+}
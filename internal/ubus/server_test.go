@@ -0,0 +1,221 @@
+package ubus
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// fakeUbusd plays the ubusd side of one connection.
+type fakeUbusd struct {
+	t    *testing.T
+	conn net.Conn
+}
+
+func (f *fakeUbusd) send(typ uint8, seq uint16, peer uint32, attrs ...[]byte) {
+	f.t.Helper()
+	if _, err := f.conn.Write(encodeMessage(typ, seq, peer, attrs...)); err != nil {
+		f.t.Fatalf("fake ubusd write: %v", err)
+	}
+}
+
+func (f *fakeUbusd) read() *message {
+	f.t.Helper()
+	_ = f.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	msg, err := readMessage(f.conn)
+	if err != nil {
+		f.t.Fatalf("fake ubusd read: %v", err)
+	}
+	return msg
+}
+
+// accept greets the client and accepts its object as objID.
+//
+// Returns the registered object path and method names.
+func (f *fakeUbusd) accept(objID uint32) (string, []string) {
+	f.t.Helper()
+	f.send(msgHello, 0, 0x100)
+
+	add := f.read()
+	if add.typ != msgAddObject {
+		f.t.Fatalf("expected add object, got type %d", add.typ)
+	}
+
+	sig, err := decodeBlobmsgTable(add.attrs[attrSignature])
+	if err != nil {
+		f.t.Fatalf("decode signature: %v", err)
+	}
+	var methods []string
+	for name := range sig {
+		methods = append(methods, name)
+	}
+	sort.Strings(methods)
+
+	f.send(msgData, add.seq, add.peer, blobUint32(attrObjID, objID), blobUint32(attrObjType, 7))
+	f.send(msgStatus, add.seq, add.peer, blobUint32(attrStatus, StatusOK))
+
+	return add.stringAttr(attrObjPath), methods
+}
+
+// call invokes method and returns the reply and status.
+func (f *fakeUbusd) call(objID uint32, method string) (map[string]any, uint32) {
+	f.t.Helper()
+	f.send(msgInvoke, 9, 0x200,
+		blobUint32(attrObjID, objID),
+		blobString(attrMethod, method),
+		blobAttr(attrData, false, nil),
+	)
+
+	var reply map[string]any
+	for {
+		msg := f.read()
+		if msg.seq != 9 || msg.peer != 0x200 {
+			f.t.Fatalf("reply to seq %d peer %#x, want seq 9 peer 0x200", msg.seq, msg.peer)
+		}
+
+		switch msg.typ {
+		case msgData:
+			var err error
+			if reply, err = decodeBlobmsgTable(msg.attrs[attrData]); err != nil {
+				f.t.Fatalf("decode reply: %v", err)
+			}
+		case msgStatus:
+			status, _ := msg.uint32Attr(attrStatus)
+			return reply, status
+		default:
+			f.t.Fatalf("unexpected message type %d", msg.typ)
+		}
+	}
+}
+
+func testMethods() map[string]Handler {
+	return map[string]Handler{
+		"status": func(ctx context.Context) (any, error) {
+			return map[string]any{"hostname": "node-a", "gatewayMode": true}, nil
+		},
+		"broken": func(ctx context.Context) (any, error) {
+			return nil, errors.New("no data")
+		},
+	}
+}
+
+// pipeDialer hands out one end of a new pipe per dial and the other end on conns.
+func pipeDialer() (func(ctx context.Context) (net.Conn, error), chan net.Conn) {
+	conns := make(chan net.Conn, 4)
+	return func(ctx context.Context) (net.Conn, error) {
+		client, server := net.Pipe()
+		conns <- server
+		return client, nil
+	}, conns
+}
+
+func TestServer_Dispatch(t *testing.T) {
+	dial, conns := pipeDialer()
+	srv := newServer("openmanet", testMethods(), zerolog.Nop(), dial)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		srv.Run(ctx)
+		close(done)
+	}()
+
+	ubusd := &fakeUbusd{t: t, conn: <-conns}
+	path, methods := ubusd.accept(42)
+	if path != "openmanet" {
+		t.Errorf("object path = %q, want openmanet", path)
+	}
+	if want := []string{"broken", "status"}; len(methods) != 2 || methods[0] != want[0] || methods[1] != want[1] {
+		t.Errorf("methods = %v, want %v", methods, want)
+	}
+
+	reply, status := ubusd.call(42, "status")
+	if status != StatusOK {
+		t.Fatalf("status call returned status %d", status)
+	}
+	if reply["hostname"] != "node-a" || reply["gatewayMode"] != true {
+		t.Errorf("status reply = %v", reply)
+	}
+
+	if _, status := ubusd.call(42, "missing"); status != StatusMethodNotFound {
+		t.Errorf("unknown method returned status %d, want %d", status, StatusMethodNotFound)
+	}
+	if reply, status := ubusd.call(42, "broken"); status != StatusUnknownError || reply != nil {
+		t.Errorf("failing method returned status %d and reply %v", status, reply)
+	}
+
+	// Shutdown removes the object
+	cancel()
+	remove := ubusd.read()
+	if remove.typ != msgRemoveObject {
+		t.Fatalf("expected remove object on shutdown, got type %d", remove.typ)
+	}
+	if id, _ := remove.uint32Attr(attrObjID); id != 42 {
+		t.Errorf("removed object %d, want 42", id)
+	}
+	ubusd.conn.Close()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+}
+
+func TestServer_Reconnect(t *testing.T) {
+	dial, conns := pipeDialer()
+	srv := newServer("openmanet", testMethods(), zerolog.Nop(), dial)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.Run(ctx)
+
+	first := &fakeUbusd{t: t, conn: <-conns}
+	first.accept(1)
+
+	// ubusd restarts: the old socket goes away and the object is registered again
+	first.conn.Close()
+
+	var second *fakeUbusd
+	select {
+	case conn := <-conns:
+		second = &fakeUbusd{t: t, conn: conn}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not reconnect")
+	}
+	defer second.conn.Close()
+
+	second.accept(2)
+	if _, status := second.call(2, "status"); status != StatusOK {
+		t.Errorf("status call after reconnect returned status %d", status)
+	}
+}
+
+func TestServer_Rejected(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	srv := newServer("openmanet", testMethods(), zerolog.Nop(), func(ctx context.Context) (net.Conn, error) {
+		return client, nil
+	})
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := srv.session(context.Background())
+		errc <- err
+	}()
+
+	ubusd := &fakeUbusd{t: t, conn: server}
+	ubusd.send(msgHello, 0, 0x100)
+	add := ubusd.read()
+	ubusd.send(msgStatus, add.seq, add.peer, blobUint32(attrStatus, StatusInvalidArg))
+
+	if err := <-errc; err == nil {
+		t.Error("session() should fail when ubusd rejects the object")
+	}
+}
@@ -0,0 +1,145 @@
+package pkg
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var updateAPI = flag.Bool("update", false, "rewrite testdata/api.txt")
+
+// libraryPackages are the packages whose API TestAPI records.
+var libraryPackages = []string{"batman", "netif", "route", "uci"}
+
+// exportedAPI returns the exported declarations of the package in dir, one per
+// line and sorted, with function bodies and comments left out. It fails t if the
+// package declares an exported variable other than an error, as package-level
+// mutable state would be shared by every user of the package.
+func exportedAPI(t *testing.T, dir string) []string {
+	t.Helper()
+
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		t.Fatalf("ParseDir(%s) error = %v", dir, err)
+	}
+
+	print := func(node any) string {
+		var buf bytes.Buffer
+		if err := printer.Fprint(&buf, fset, node); err != nil {
+			t.Fatalf("printer.Fprint() error = %v", err)
+		}
+		return strings.Join(strings.Fields(buf.String()), " ")
+	}
+
+	var api []string
+	for name, p := range pkgs {
+		for _, f := range p.Files {
+			for _, decl := range f.Decls {
+				switch d := decl.(type) {
+				case *ast.FuncDecl:
+					if !d.Name.IsExported() || (d.Recv != nil && !exportedRecv(d.Recv)) {
+						continue
+					}
+					d.Body, d.Doc = nil, nil
+					api = append(api, name+": "+print(d))
+				case *ast.GenDecl:
+					for _, spec := range d.Specs {
+						api = append(api, specAPI(t, name, d.Tok, spec, print)...)
+					}
+				}
+			}
+		}
+	}
+
+	sort.Strings(api)
+	return api
+}
+
+// exportedRecv reports whether the receiver type of a method is exported.
+func exportedRecv(recv *ast.FieldList) bool {
+	typ := recv.List[0].Type
+	if star, ok := typ.(*ast.StarExpr); ok {
+		typ = star.X
+	}
+	ident, ok := typ.(*ast.Ident)
+	return ok && ident.IsExported()
+}
+
+// specAPI returns the exported names declared by spec. Struct types list only
+// their exported fields.
+func specAPI(t *testing.T, pkg string, tok token.Token, spec ast.Spec, print func(any) string) []string {
+	t.Helper()
+
+	switch s := spec.(type) {
+	case *ast.TypeSpec:
+		if !s.Name.IsExported() {
+			return nil
+		}
+		st, ok := s.Type.(*ast.StructType)
+		if !ok {
+			s.Doc, s.Comment = nil, nil
+			return []string{pkg + ": type " + print(s)}
+		}
+		api := []string{fmt.Sprintf("%s: type %s struct", pkg, s.Name)}
+		for _, field := range st.Fields.List {
+			for _, n := range field.Names {
+				if n.IsExported() {
+					api = append(api, fmt.Sprintf("%s: type %s struct, %s %s", pkg, s.Name, n, print(field.Type)))
+				}
+			}
+		}
+		return api
+	case *ast.ValueSpec:
+		var api []string
+		for i, n := range s.Names {
+			if !n.IsExported() {
+				continue
+			}
+			if tok == token.VAR && !strings.HasPrefix(n.Name, "Err") {
+				t.Errorf("%s: exported variable %s: only errors may be package-level variables", pkg, n)
+			}
+			decl := fmt.Sprintf("%s: %s %s", pkg, tok, n)
+			if i < len(s.Values) {
+				decl += " = " + print(s.Values[i])
+			}
+			api = append(api, decl)
+		}
+		return api
+	}
+	return nil
+}
+
+func TestAPI(t *testing.T) {
+	var api []string
+	for _, dir := range libraryPackages {
+		api = append(api, exportedAPI(t, dir)...)
+	}
+	got := strings.Join(api, "\n") + "\n"
+
+	golden := filepath.Join("testdata", "api.txt")
+	if *updateAPI {
+		if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+	}
+
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if got != string(want) {
+		t.Errorf("the API of pkg/ differs from %s; if the change is meant, rerun with -update and review the diff:\n%s", golden, got)
+	}
+}
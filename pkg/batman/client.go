@@ -0,0 +1,183 @@
+// Package batman reads the state of a batman-adv mesh through batctl: its
+// configuration, originator, neighbor and gateway tables, and the topology and
+// health derived from them.
+//
+// Stability: batman is part of the supported library surface under pkg/. Its
+// exported identifiers are kept backwards compatible within a major version of the
+// module; new options and methods may be added. The types it aliases from openmanetd
+// are covered by the same promise. The JSON fields of those types follow batctl and
+// may gain fields as batctl does.
+package batman
+
+import (
+	batmanadv "github.com/openmanet/openmanetd/internal/batman-adv"
+	"github.com/rs/zerolog"
+)
+
+// DefaultMeshInterface is the mesh interface a Client reads unless configured
+// otherwise.
+const DefaultMeshInterface = "bat0"
+
+// MeshConfig is the configuration of a mesh interface, as reported by batctl mj.
+type MeshConfig = batmanadv.MeshConfig
+
+// Originator is an entry of the originator table.
+type Originator = batmanadv.Originator
+
+// Neighbor is an entry of the single hop neighbor table.
+type Neighbor = batmanadv.Neighbor
+
+// Gateway is an entry of the gateway table.
+type Gateway = batmanadv.Gateway
+
+// Topology is the mesh as seen from the local node.
+type Topology = batmanadv.Topology
+
+// MeshHealth summarises the originator and neighbor tables.
+type MeshHealth = batmanadv.MeshHealth
+
+// MeshHealthThresholds are the link qualities MeshHealth is judged by.
+type MeshHealthThresholds = batmanadv.MeshHealthThresholds
+
+// DefaultMeshHealthThresholds returns the thresholds openmanetd judges mesh health
+// by when none are configured.
+func DefaultMeshHealthThresholds() MeshHealthThresholds {
+	return batmanadv.DefaultMeshHealthThresholds
+}
+
+// Runner runs batctl with args and returns its standard output. Tests supply their
+// own with WithRunner to return canned output.
+type Runner = batmanadv.Runner
+
+// Option configures a Client.
+type Option func(*options)
+
+type options struct {
+	batctlPath string
+	runner     Runner
+	iface      string
+	log        zerolog.Logger
+}
+
+// WithBatctlPath runs the batctl binary at path instead of the one found in PATH.
+func WithBatctlPath(path string) Option {
+	return func(o *options) {
+		o.batctlPath = path
+	}
+}
+
+// WithRunner runs batctl through runner. It takes precedence over WithBatctlPath.
+func WithRunner(runner Runner) Option {
+	return func(o *options) {
+		o.runner = runner
+	}
+}
+
+// WithMeshInterface reads the mesh interface iface instead of DefaultMeshInterface.
+func WithMeshInterface(iface string) Option {
+	return func(o *options) {
+		o.iface = iface
+	}
+}
+
+// WithLogger logs the batctl commands the Client runs, and their failures, to log.
+// By default nothing is logged.
+func WithLogger(log zerolog.Logger) Option {
+	return func(o *options) {
+		o.log = log
+	}
+}
+
+// Client reads one batman-adv mesh interface. Every call runs batctl, nothing is
+// cached. It is safe for concurrent use if its Runner is.
+type Client struct {
+	runner Runner
+	iface  string
+}
+
+// NewClient creates a Client for DefaultMeshInterface, running the batctl found in
+// PATH unless configured otherwise.
+func NewClient(opts ...Option) *Client {
+	o := options{
+		iface: DefaultMeshInterface,
+		log:   zerolog.Nop(),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	runner := o.runner
+	if runner == nil {
+		runner = &batmanadv.BatctlRunner{Path: o.batctlPath}
+	}
+
+	return &Client{
+		runner: loggingRunner{runner: runner, log: o.log},
+		iface:  o.iface,
+	}
+}
+
+// MeshInterface returns the mesh interface the Client reads.
+func (c *Client) MeshInterface() string {
+	return c.iface
+}
+
+// MeshConfig returns the configuration of the mesh interface.
+func (c *Client) MeshConfig() (*MeshConfig, error) {
+	return batmanadv.GetMeshConfigWithRunner(c.runner, c.iface)
+}
+
+// Originators returns the originator table.
+func (c *Client) Originators() ([]Originator, error) {
+	originators, err := batmanadv.GetMeshOriginatorsWithRunner(c.runner, c.iface)
+	if err != nil {
+		return nil, err
+	}
+	return *originators, nil
+}
+
+// Neighbors returns the single hop neighbor table.
+func (c *Client) Neighbors() ([]Neighbor, error) {
+	neighbors, err := batmanadv.GetMeshNeighborsWithRunner(c.runner, c.iface)
+	if err != nil {
+		return nil, err
+	}
+	return *neighbors, nil
+}
+
+// Gateways returns the gateway table.
+func (c *Client) Gateways() ([]Gateway, error) {
+	gateways, err := batmanadv.GetMeshGatewaysWithRunner(c.runner, c.iface)
+	if err != nil {
+		return nil, err
+	}
+	return *gateways, nil
+}
+
+// Topology returns the topology graph of the local node, built from its originator
+// and neighbor tables.
+func (c *Client) Topology() (*Topology, error) {
+	return batmanadv.BuildTopologyWithRunner(c.runner, c.iface)
+}
+
+// Health summarises the originator and neighbor tables against th.
+func (c *Client) Health(th MeshHealthThresholds) (*MeshHealth, error) {
+	return batmanadv.GetMeshHealthWithRunner(c.runner, c.iface, th)
+}
+
+// loggingRunner logs the commands run by runner.
+type loggingRunner struct {
+	runner Runner
+	log    zerolog.Logger
+}
+
+func (r loggingRunner) Run(args ...string) ([]byte, error) {
+	output, err := r.runner.Run(args...)
+	if err != nil {
+		r.log.Debug().Err(err).Strs("args", args).Msg("batctl failed")
+		return nil, err
+	}
+
+	r.log.Debug().Strs("args", args).Msg("Ran batctl")
+	return output, nil
+}
@@ -0,0 +1,37 @@
+package batman
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewClient_BatctlPath(t *testing.T) {
+	// A stand-in for batctl that answers every command with one neighbor
+	batctl := filepath.Join(t.TempDir(), "batctl")
+	script := "#!/bin/sh\necho '[{\"neigh_address\": \"aa:00:00:00:00:02\", \"hard_ifname\": \"wlan0\"}]'\n"
+	if err := os.WriteFile(batctl, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	neighbors, err := NewClient(WithBatctlPath(batctl)).Neighbors()
+	if err != nil {
+		t.Fatalf("Neighbors() error = %v", err)
+	}
+	if len(neighbors) != 1 || neighbors[0].NeighAddress != "aa:00:00:00:00:02" {
+		t.Errorf("Neighbors() = %+v, want the neighbor of the stand-in", neighbors)
+	}
+
+	if _, err := NewClient(WithBatctlPath(filepath.Join(t.TempDir(), "missing"))).Neighbors(); err == nil {
+		t.Error("Neighbors() with a missing batctl succeeded")
+	}
+}
+
+func TestNewClient_MeshInterface(t *testing.T) {
+	if got := NewClient().MeshInterface(); got != DefaultMeshInterface {
+		t.Errorf("MeshInterface() = %q, want %q", got, DefaultMeshInterface)
+	}
+	if got := NewClient(WithMeshInterface("bat1")).MeshInterface(); got != "bat1" {
+		t.Errorf("MeshInterface() = %q, want bat1", got)
+	}
+}
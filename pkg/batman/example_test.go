@@ -0,0 +1,61 @@
+package batman_test
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/openmanet/openmanetd/pkg/batman"
+)
+
+// cannedRunner answers batctl commands with canned JSON, as a test of code using a
+// Client would.
+type cannedRunner map[string]string
+
+func (r cannedRunner) Run(args ...string) ([]byte, error) {
+	output, ok := r[strings.Join(args, " ")]
+	if !ok {
+		return nil, fmt.Errorf("unexpected batctl %s", strings.Join(args, " "))
+	}
+	return []byte(output), nil
+}
+
+var exampleRunner = cannedRunner{
+	"mj":  `{"mesh_ifname": "bat0", "hard_address": "aa:00:00:00:00:01", "algo_name": "BATMAN_IV", "gw_mode": "client"}`,
+	"oj":  `[{"orig_address": "aa:00:00:00:00:02", "neigh_address": "aa:00:00:00:00:02", "hard_ifname": "wlan0", "last_seen_msecs": 300, "tq": 220, "best": true}]`,
+	"nj":  `[{"neigh_address": "aa:00:00:00:00:02", "hard_ifname": "wlan0", "last_seen_msecs": 300}]`,
+	"gwj": `[{"orig_address": "aa:00:00:00:00:02", "hard_ifname": "wlan0", "best": true, "bandwidth_down": 50000, "bandwidth_up": 10000}]`,
+}
+
+func ExampleNewClient() {
+	c := batman.NewClient(batman.WithRunner(exampleRunner))
+
+	cfg, err := c.MeshConfig()
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(cfg.MeshIfname, cfg.AlgoName, cfg.GwMode)
+
+	gateways, err := c.Gateways()
+	if err != nil {
+		panic(err)
+	}
+	for _, gw := range gateways {
+		fmt.Println(gw.OrigAddress, gw.Best)
+	}
+	// Output:
+	// bat0 BATMAN_IV client
+	// aa:00:00:00:00:02 true
+}
+
+func ExampleClient_Topology() {
+	c := batman.NewClient(batman.WithRunner(exampleRunner))
+
+	topo, err := c.Topology()
+	if err != nil {
+		panic(err)
+	}
+	for _, e := range topo.Edges {
+		fmt.Println(e.From, "->", e.To, "tq", e.TQ)
+	}
+	// Output: aa:00:00:00:00:01 -> aa:00:00:00:00:02 tq 220
+}
@@ -0,0 +1,22 @@
+// Package pkg is the root of openmanetd's library surface: the packages below it let
+// other Go programs reuse what openmanetd does on a node without running it.
+//
+//   - uci reads and writes the network, DHCP and dnsmasq UCI configuration.
+//   - route reads and changes the kernel routing tables.
+//   - netif looks up network interfaces and their addresses.
+//   - batman reads the state of a batman-adv mesh through batctl.
+//
+// Each package is configured through options of its constructor, such as the UCI
+// tree path, batctl binary, netlink handle and logger, and keeps no package-level
+// mutable state, so that several differently configured instances can live in one
+// program or test. openmanetd itself builds on the same code under internal/.
+//
+// Stability: the exported API of the packages under pkg/ is kept backwards
+// compatible within a major version of the module. It is recorded in
+// testdata/api.txt and TestAPI fails on any difference; a change that is meant
+// is recorded with
+//
+//	go test ./pkg -run TestAPI -update
+//
+// and reviewed as an API change. Packages under internal/ make no such promise.
+package pkg
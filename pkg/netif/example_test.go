@@ -0,0 +1,25 @@
+package netif_test
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/openmanet/openmanetd/pkg/netif"
+)
+
+func ExampleLookup_ByName() {
+	l := netif.NewLookup()
+
+	iface, err := l.ByName("br-ahwlan")
+	if errors.Is(err, netif.ErrInterfaceNotFound) {
+		fmt.Println("the mesh bridge is not up")
+		return
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	if addr, ok := iface.PrimaryIPv4(); ok {
+		fmt.Println(iface.Name, addr.IP)
+	}
+}
@@ -0,0 +1,66 @@
+// Package netif looks up network interfaces and their addresses through netlink.
+//
+// Stability: netif is part of the supported library surface under pkg/. Its
+// exported identifiers are kept backwards compatible within a major version of the
+// module; new options and methods may be added. The types it aliases from openmanetd
+// are covered by the same promise.
+package netif
+
+import (
+	"github.com/openmanet/openmanetd/internal/network"
+	"github.com/vishvananda/netlink"
+)
+
+// Interface is a network interface with its addresses in kernel order, primary
+// addresses before their aliases.
+type Interface = network.NetworkInterface
+
+// Address is an address of an interface with its scope and flags.
+type Address = network.IPAddress
+
+// AddrOption widens the addresses Interface.IPv4, IPv6 and PrimaryIPv4 select.
+type AddrOption = network.AddrOption
+
+// IncludeDeprecated also selects addresses whose preferred lifetime has run out.
+func IncludeDeprecated() AddrOption { return network.IncludeDeprecated }
+
+// IncludeTemporary also selects IPv6 privacy addresses.
+func IncludeTemporary() AddrOption { return network.IncludeTemporary }
+
+// ErrInterfaceNotFound is returned when an interface does not exist, to be tested
+// with errors.Is.
+var ErrInterfaceNotFound = network.ErrInterfaceNotFound
+
+// Option configures a Lookup.
+type Option func(*Lookup)
+
+// WithHandle looks interfaces up through the netlink handle h, e.g. one opened in
+// another network namespace with netlink.NewHandleAt. The caller keeps ownership of
+// h and closes it after the Lookup is done.
+func WithHandle(h *netlink.Handle) Option {
+	return func(l *Lookup) {
+		l.handle = h
+	}
+}
+
+// Lookup looks up the interfaces of one network namespace. It is safe for
+// concurrent use.
+type Lookup struct {
+	handle *netlink.Handle
+}
+
+// NewLookup creates a Lookup on the current network namespace, or on the handle
+// given with WithHandle.
+func NewLookup(opts ...Option) *Lookup {
+	l := &Lookup{handle: &netlink.Handle{}}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// ByName returns the interface name. It returns an ErrInterfaceNotFound error if
+// there is no such interface.
+func (l *Lookup) ByName(name string) (Interface, error) {
+	return network.GetInterfaceByNameWithHandle(l.handle, name)
+}
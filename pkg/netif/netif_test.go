@@ -0,0 +1,26 @@
+package netif
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestLookup_ByName(t *testing.T) {
+	l := NewLookup()
+
+	lo, err := l.ByName("lo")
+	if err != nil {
+		t.Skipf("no loopback interface visible through netlink: %v", err)
+	}
+	if lo.Name != "lo" || lo.Flags&net.FlagLoopback == 0 {
+		t.Errorf("ByName(lo) = %+v, want the loopback interface", lo)
+	}
+	if !lo.HasAddress(net.IPv4(127, 0, 0, 1)) {
+		t.Errorf("ByName(lo) addresses = %v, want 127.0.0.1", lo.IP)
+	}
+
+	if _, err := l.ByName("openmanet-none0"); !errors.Is(err, ErrInterfaceNotFound) {
+		t.Errorf("ByName(missing) error = %v, want ErrInterfaceNotFound", err)
+	}
+}
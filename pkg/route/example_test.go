@@ -0,0 +1,78 @@
+package route_test
+
+import (
+	"fmt"
+	"net"
+	"slices"
+
+	"github.com/openmanet/openmanetd/pkg/route"
+	"golang.org/x/sys/unix"
+)
+
+// memTable is an in-memory route.Table, as a test of code using a Manager would
+// supply.
+type memTable struct {
+	routes []*route.Route
+}
+
+func (t *memTable) GetRoutes(table int) ([]*route.Route, error) {
+	var routes []*route.Route
+	for _, r := range t.routes {
+		if r.Table == table {
+			routes = append(routes, r)
+		}
+	}
+	return routes, nil
+}
+
+func (t *memTable) AddRoute(r *route.Route) error {
+	t.routes = append(t.routes, r)
+	return nil
+}
+
+func (t *memTable) DeleteRoute(r *route.Route) error {
+	t.routes = slices.DeleteFunc(t.routes, func(existing *route.Route) bool { return existing.String() == r.String() })
+	return nil
+}
+
+func ExampleNewManager() {
+	m := route.NewManager(route.WithTable(&memTable{}))
+
+	// The default route moves from one gateway to another; Replace deletes the
+	// route it installed before
+	for _, gw := range []string{"10.41.0.1", "10.41.0.2"} {
+		err := m.Replace(&route.Route{
+			Gateway:   net.ParseIP(gw),
+			Interface: "br-ahwlan",
+			Metric:    10,
+			Table:     unix.RT_TABLE_MAIN,
+		})
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	routes, err := m.Routes(unix.RT_TABLE_MAIN)
+	if err != nil {
+		panic(err)
+	}
+	for _, r := range routes {
+		fmt.Println(r, r.Protocol == route.ProtocolOpenMANET)
+	}
+	// Output: default via 10.41.0.2 dev br-ahwlan metric 10 table 254 true
+}
+
+func ExampleManager_Exists() {
+	m := route.NewManager(route.WithTable(&memTable{}))
+
+	_, dst, _ := net.ParseCIDR("10.42.0.0/16")
+	if err := m.Add(&route.Route{Destination: dst, Gateway: net.ParseIP("10.41.0.7"), Interface: "br-ahwlan", Metric: 20, Table: unix.RT_TABLE_MAIN}); err != nil {
+		panic(err)
+	}
+
+	probe := &route.Route{Destination: dst, Gateway: net.ParseIP("10.41.0.7"), Interface: "br-ahwlan", Table: unix.RT_TABLE_MAIN}
+	exact, _ := m.Exists(probe, route.MatchOptions{})
+	anyMetric, _ := m.Exists(probe, route.MatchOptions{IgnoreMetric: true})
+	fmt.Println(exact, anyMetric)
+	// Output: false true
+}
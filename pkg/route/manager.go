@@ -0,0 +1,139 @@
+// Package route reads and changes the kernel routing tables through netlink.
+//
+// Stability: route is part of the supported library surface under pkg/. Its
+// exported identifiers are kept backwards compatible within a major version of the
+// module; new options and methods may be added. The types it aliases from openmanetd
+// are covered by the same promise.
+//
+// Changes go through openmanetd's safe mode: while it is on they are logged and
+// refused with an error instead of being applied. Embedding daemons that never turn
+// it on are unaffected.
+package route
+
+import (
+	"github.com/openmanet/openmanetd/internal/network"
+	"github.com/rs/zerolog"
+	"github.com/vishvananda/netlink"
+)
+
+// Route is a routing table entry. A nil Destination is a default route.
+type Route = network.Route
+
+// Table is the view of the routing tables a Manager works on. The kernel tables
+// implement it; tests can supply their own with WithTable.
+type Table = network.RouteTable
+
+// MatchOptions leaves fields out of the comparison of routes in Exists.
+type MatchOptions = network.MatchOptions
+
+// ProtocolOpenMANET is the protocol Replace tags the routes it installs with, so that
+// they can be told apart from routes added by the kernel, netifd or an administrator.
+const ProtocolOpenMANET = network.RouteProtocolOpenMANET
+
+// Errors returned by Manager, to be tested with errors.Is.
+var (
+	// ErrInterfaceNotFound is returned when the interface of a route does not exist.
+	ErrInterfaceNotFound = network.ErrInterfaceNotFound
+
+	// ErrValidation is returned when arguments are invalid; nothing was changed.
+	ErrValidation = network.ErrValidation
+)
+
+// Option configures a Manager.
+type Option func(*options)
+
+type options struct {
+	table Table
+	log   zerolog.Logger
+}
+
+// WithHandle reads and changes routes through the netlink handle h, e.g. one
+// opened in another network namespace with netlink.NewHandleAt. The caller keeps
+// ownership of h and closes it after the Manager is done.
+func WithHandle(h *netlink.Handle) Option {
+	return func(o *options) {
+		o.table = network.KernelRouteTable{Handle: h}
+	}
+}
+
+// WithTable works on table instead of the kernel routing tables, e.g. an in-memory
+// table in tests.
+func WithTable(table Table) Option {
+	return func(o *options) {
+		o.table = table
+	}
+}
+
+// WithLogger logs the routes the Manager changes to log. By default nothing is
+// logged.
+func WithLogger(log zerolog.Logger) Option {
+	return func(o *options) {
+		o.log = log
+	}
+}
+
+// Manager reads and changes routes in one set of routing tables: the kernel's, as
+// seen through the default netlink handle unless configured otherwise. It is safe
+// for concurrent use if its Table is.
+type Manager struct {
+	table Table
+	log   zerolog.Logger
+}
+
+// NewManager creates a Manager on the kernel routing tables of the current network
+// namespace, or on the handle or table given as options.
+func NewManager(opts ...Option) *Manager {
+	o := options{
+		table: network.KernelRouteTable{},
+		log:   zerolog.Nop(),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return &Manager{table: o.table, log: o.log}
+}
+
+// Routes returns the routes of the routing table id, e.g. unix.RT_TABLE_MAIN.
+func (m *Manager) Routes(table int) ([]*Route, error) {
+	return m.table.GetRoutes(table)
+}
+
+// Add adds route. It fails if an identical route exists.
+func (m *Manager) Add(route *Route) error {
+	if err := m.table.AddRoute(route); err != nil {
+		return err
+	}
+
+	m.log.Debug().Stringer("route", route).Msg("Added route")
+	return nil
+}
+
+// Delete deletes the route matching all fields of route.
+func (m *Manager) Delete(route *Route) error {
+	if err := m.table.DeleteRoute(route); err != nil {
+		return err
+	}
+
+	m.log.Debug().Stringer("route", route).Msg("Deleted route")
+	return nil
+}
+
+// Replace installs route tagged with ProtocolOpenMANET and deletes the other routes
+// to its destination in its table that carry the tag, whatever their gateway,
+// interface or metric. Routes added by the kernel or an administrator are left
+// alone, and a tagged route identical to route is kept rather than re-added.
+func (m *Manager) Replace(route *Route) error {
+	if err := network.ReplaceRouteByDestinationWithRouteTable(route, m.table); err != nil {
+		return err
+	}
+
+	m.log.Debug().Stringer("route", route).Msg("Replaced route")
+	return nil
+}
+
+// Exists reports whether route is in its table, comparing destination, gateway,
+// interface and metric, less the fields opts leaves out.
+func (m *Manager) Exists(route *Route, opts MatchOptions) (bool, error) {
+	return network.RouteExistsWithRouteTable(route, opts, m.table)
+}
@@ -0,0 +1,89 @@
+package uci_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/openmanet/openmanetd/pkg/uci"
+)
+
+// exampleTree writes a UCI tree with a network and a dhcp config to a temporary
+// directory and returns its path.
+func exampleTree() string {
+	dir, err := os.MkdirTemp("", "uci-example")
+	if err != nil {
+		panic(err)
+	}
+
+	files := map[string]string{
+		"network": "config interface 'ahwlan'\n\toption proto 'static'\n\toption ipaddr '10.41.0.1'\n\toption netmask '255.255.0.0'\n",
+		"dhcp":    "config dnsmasq\n\toption domain 'mesh'\n\nconfig dnsmasq 'guest'\n\toption domain 'guest'\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			panic(err)
+		}
+	}
+
+	return dir
+}
+
+func ExampleNewReader() {
+	dir := exampleTree()
+	defer os.RemoveAll(dir)
+
+	r := uci.NewReader(uci.WithTreePath(dir))
+
+	lan, err := r.Network("ahwlan")
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(lan.Proto, lan.IPAddr, lan.NetMask)
+	// Output: static 10.41.0.1 255.255.0.0
+}
+
+func ExampleReader_SetDHCP() {
+	dir := exampleTree()
+	defer os.RemoveAll(dir)
+
+	r := uci.NewReader(uci.WithTreePath(dir))
+
+	changed, err := r.SetDHCP("ahwlan", &uci.DHCP{Interface: "ahwlan", Start: "100", Limit: "150"})
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println("changed:", changed)
+
+	// A Reader on the same directory sees the committed pool
+	pool, err := uci.NewReader(uci.WithTreePath(dir)).DHCP("ahwlan")
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(pool.Interface, pool.Start, pool.Limit)
+	// Output:
+	// changed: true
+	// ahwlan 100 150
+}
+
+func ExampleReader_Dnsmasq() {
+	dir := exampleTree()
+	defer os.RemoveAll(dir)
+
+	r := uci.NewReader(uci.WithTreePath(dir))
+
+	instances, err := r.DnsmasqInstances()
+	if err != nil {
+		panic(err)
+	}
+	for _, name := range instances {
+		cfg, err := r.Dnsmasq(name)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Println(name, cfg.Domain)
+	}
+	// Output:
+	// @dnsmasq[0] mesh
+	// guest guest
+}
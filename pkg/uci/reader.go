@@ -0,0 +1,222 @@
+// Package uci reads and writes the OpenWrt UCI configuration openmanetd manages:
+// network interfaces, DHCP pools and dnsmasq instances, and the openmanetd section.
+//
+// Stability: uci is part of the supported library surface under pkg/. Its exported
+// identifiers are kept backwards compatible within a major version of the module;
+// new options and methods may be added. The types it aliases from openmanetd are
+// covered by the same promise, their unexported details are not.
+//
+// Writes go through openmanetd's safe mode: while it is on they are logged and
+// refused with an error instead of being applied. Embedding daemons that never turn
+// it on are unaffected.
+package uci
+
+import (
+	"github.com/digineo/go-uci/v2"
+	"github.com/openmanet/openmanetd/internal/network"
+	"github.com/rs/zerolog"
+)
+
+// Network is the UCI configuration of a network interface section.
+type Network = network.UCINetwork
+
+// NetworkSection is a network interface section with its name.
+type NetworkSection = network.UCINetworkSection
+
+// DHCP is the UCI configuration of a DHCP pool section.
+type DHCP = network.UCIDHCP
+
+// DHCPSection is a DHCP pool section with its name.
+type DHCPSection = network.UCIDHCPSection
+
+// Dnsmasq is the UCI configuration of a dnsmasq instance.
+type Dnsmasq = network.UCIDnsmasq
+
+// OpenMANET is the UCI configuration of the openmanetd section.
+type OpenMANET = network.UCIOpenMANET
+
+// Errors returned by Reader, to be tested with errors.Is.
+var (
+	// ErrSectionNotFound is returned when a section required by a read does not
+	// exist.
+	ErrSectionNotFound = network.ErrSectionNotFound
+
+	// ErrCommitFailed is returned when staged changes cannot be written to disk.
+	ErrCommitFailed = network.ErrCommitFailed
+
+	// ErrReadOnlyFS is returned when a commit fails because the configuration
+	// directory is read-only.
+	ErrReadOnlyFS = network.ErrReadOnlyFS
+
+	// ErrValidation is returned when arguments are invalid; nothing was changed.
+	ErrValidation = network.ErrValidation
+)
+
+// Option configures a Reader.
+type Option func(*options)
+
+type options struct {
+	treePath string
+	log      zerolog.Logger
+}
+
+// WithTreePath reads the UCI configuration files from path instead of /etc/config,
+// e.g. from a directory of fixtures in tests.
+func WithTreePath(path string) Option {
+	return func(o *options) {
+		o.treePath = path
+	}
+}
+
+// WithLogger logs the changes the Reader writes to log. By default nothing is
+// logged.
+func WithLogger(log zerolog.Logger) Option {
+	return func(o *options) {
+		o.log = log
+	}
+}
+
+// Reader reads and writes one UCI configuration tree. All its methods share the
+// tree, so a write is seen by later reads of the same Reader. A Reader is not safe
+// for concurrent use.
+type Reader struct {
+	network   *network.UCINetworkConfigReader
+	dhcp      *network.UCIDHCPConfigReader
+	openmanet *network.UCIOpenMANETConfigReader
+	log       zerolog.Logger
+}
+
+// NewReader creates a Reader on the UCI tree at /etc/config, or at the path given
+// with WithTreePath. Configuration files are loaded on first use.
+func NewReader(opts ...Option) *Reader {
+	o := options{
+		treePath: uci.DefaultTreePath,
+		log:      zerolog.Nop(),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	tree := uci.NewTree(o.treePath)
+	return &Reader{
+		network:   network.NewUCINetworkConfigReaderWithTree(tree),
+		dhcp:      network.NewUCIDHCPConfigReaderWithTree(tree),
+		openmanet: network.NewUCIOpenMANETConfigReaderWithTree(tree),
+		log:       o.log,
+	}
+}
+
+// Network returns the configuration of the interface section name. Options that
+// are not set, as in a section that does not exist, are empty.
+func (r *Reader) Network(name string) (*Network, error) {
+	return network.GetUCINetworkByNameWithReader(name, r.network)
+}
+
+// Networks returns every interface section of the network config, in file order.
+func (r *Reader) Networks() ([]NetworkSection, error) {
+	return network.GetAllUCINetworksWithReader(r.network)
+}
+
+// SetNetwork creates or updates the interface section name and commits it. Empty
+// fields of cfg are left as they are. It reports whether anything changed.
+func (r *Reader) SetNetwork(name string, cfg *Network) (bool, error) {
+	changed, err := network.SetNetworkConfigWithReader(name, cfg, r.network)
+	if changed {
+		r.log.Debug().Str("section", name).Msg("Updated UCI network section")
+	}
+	return changed, err
+}
+
+// AddNetworkIPAddr adds a secondary IPv4 address in CIDR notation to the interface
+// section name and commits it. It reports whether anything changed.
+func (r *Reader) AddNetworkIPAddr(name, addr string) (bool, error) {
+	changed, err := network.AddNetworkIPAddrWithReader(name, addr, r.network)
+	if changed {
+		r.log.Debug().Str("section", name).Str("ipaddr", addr).Msg("Added UCI network address")
+	}
+	return changed, err
+}
+
+// RemoveNetworkIPAddr removes a secondary IPv4 address from the interface section
+// name and commits it. It reports whether anything changed.
+func (r *Reader) RemoveNetworkIPAddr(name, addr string) (bool, error) {
+	changed, err := network.RemoveNetworkIPAddrWithReader(name, addr, r.network)
+	if changed {
+		r.log.Debug().Str("section", name).Str("ipaddr", addr).Msg("Removed UCI network address")
+	}
+	return changed, err
+}
+
+// DHCP returns the configuration of the DHCP pool section name. Options that are
+// not set, as in a section that does not exist, are empty.
+func (r *Reader) DHCP(name string) (*DHCP, error) {
+	return network.GetDHCPConfigWithReader(name, r.dhcp)
+}
+
+// DHCPPools returns every DHCP pool section, in file order, including pools created
+// by other tooling.
+func (r *Reader) DHCPPools() ([]DHCPSection, error) {
+	return network.GetAllDHCPConfigsWithReader(r.dhcp)
+}
+
+// SetDHCP creates or updates the DHCP pool section name and commits it. Empty
+// fields of cfg are left as they are. It reports whether anything changed. The
+// change takes effect once dnsmasq is reloaded; see ReloadDnsmasq.
+func (r *Reader) SetDHCP(name string, cfg *DHCP) (bool, error) {
+	changed, err := network.SetDHCPConfigWithReader(name, cfg, r.dhcp)
+	if changed {
+		r.log.Debug().Str("section", name).Msg("Updated UCI DHCP section")
+	}
+	return changed, err
+}
+
+// DnsmasqInstances returns the names of the dnsmasq sections, in file order.
+// Anonymous sections are named as "@dnsmasq[0]".
+func (r *Reader) DnsmasqInstances() ([]string, error) {
+	return network.ListDnsmasqInstances(r.dhcp)
+}
+
+// Dnsmasq returns the configuration of the dnsmasq instance name; an empty name
+// selects the main instance. It returns an ErrSectionNotFound error if there is no
+// instance of that name.
+func (r *Reader) Dnsmasq(name string) (*Dnsmasq, error) {
+	return network.GetDnsmasqConfigForInstance(name, r.dhcp)
+}
+
+// SetDnsmasq creates or updates the dnsmasq instance cfg.Name, or the main instance
+// if it is empty, and commits it. Empty fields of cfg are left as they are. It
+// reports whether anything changed.
+func (r *Reader) SetDnsmasq(cfg *Dnsmasq) (bool, error) {
+	changed, err := network.SetDnsmasqConfigWithReader(cfg, r.dhcp)
+	if changed {
+		r.log.Debug().Str("section", cfg.Name).Msg("Updated UCI dnsmasq section")
+	}
+	return changed, err
+}
+
+// SetDnsmasqServers replaces the upstream resolvers of the dnsmasq instance name, or
+// of the main instance if name is empty, and commits them. An empty list removes
+// them. It reports whether anything changed.
+func (r *Reader) SetDnsmasqServers(name string, servers []string) (bool, error) {
+	changed, err := network.ReplaceDnsmasqServersWithReader(name, servers, r.dhcp)
+	if changed {
+		r.log.Debug().Str("section", name).Strs("servers", servers).Msg("Updated dnsmasq upstream servers")
+	}
+	return changed, err
+}
+
+// OpenMANET returns the openmanetd section; options that are not set are empty.
+func (r *Reader) OpenMANET() (*OpenMANET, error) {
+	return network.GetOpenMANETConfigWithReader(r.openmanet)
+}
+
+// ReloadDnsmasq applies committed DHCP and dnsmasq changes by reloading only the
+// dnsmasq service of the running system, leaving the network interfaces up.
+func ReloadDnsmasq() error {
+	return network.ReloadDnsmasq()
+}
+
+// RestartDnsmasq restarts only the dnsmasq service of the running system.
+func RestartDnsmasq() error {
+	return network.RestartDnsmasq()
+}